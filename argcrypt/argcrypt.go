@@ -0,0 +1,269 @@
+// Copyright 2020, Square, Inc.
+
+// Package argcrypt encrypts the values of sensitive request args (spec arg
+// sensitive: true). When arg encryption is enabled (config.ArgEncryption), the
+// Request Manager encrypts the given values of sensitive args when a request is
+// created, so they are saved (request_archives, request_args) and sent in job
+// chains only as ciphertext. Job Runners decrypt them just before a job runs and
+// give them to jobs that implement job.SensitiveJob.
+//
+// An encrypted value is a string: PREFIX, the key ID, a colon, the arg name, a
+// colon, and the base64-encoded nonce and AES-256-GCM ciphertext of the JSON-
+// encoded value. Since the key ID is in the value, keys can be rotated: add a new
+// key, make it the current key, and keep old keys until no request that can be
+// retried or resumed uses them.
+//
+// The key ID, request ID, and arg name are additional data, so a value decrypts
+// only for the request it was encrypted for: it cannot be copied into the args
+// of another request to have it decrypted there. The arg name is the name of the
+// request arg that the value was given for; it's in the value because the job
+// arg can have another name (node args). Retried requests have new IDs, so the
+// Request Manager encrypts their values again.
+package argcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// PREFIX is the prefix of every encrypted value.
+const PREFIX = "spincycle:enc:v2:"
+
+// anyPrefix is the prefix of values encrypted by every version, so values of an
+// unsupported version are not taken for plaintext.
+const anyPrefix = "spincycle:enc:"
+
+// KEY_SIZE is the size of keys in bytes: AES-256.
+const KEY_SIZE = 32
+
+// A KeyProvider provides the keys that encrypt and decrypt arg values. The
+// built-in KeyProvider is a Keyring loaded from a file. Users can provide one
+// that gets keys from a key management service (KMS) by setting the
+// MakeArgKeyProvider factory of the Request Manager and Job Runner. Since keys
+// are requested for every value, a KMS KeyProvider should cache them.
+type KeyProvider interface {
+	// CurrentKey returns the ID and value of the key that encrypts new values.
+	// Only the Request Manager calls it.
+	CurrentKey() (id string, key []byte, err error)
+
+	// Key returns the value of the key with the given ID, which decrypts the
+	// values encrypted with it.
+	Key(id string) ([]byte, error)
+}
+
+// Keyring is a KeyProvider with a fixed set of keys.
+type Keyring struct {
+	keys    map[string][]byte
+	current string
+}
+
+var _ KeyProvider = &Keyring{}
+
+// NewKeyring returns a Keyring with the given keys, keyed on ID. Keys must be
+// KEY_SIZE bytes, and IDs cannot contain a colon. The current key ID must be one
+// of the keys, or empty if the keyring is used only to decrypt (Job Runner).
+func NewKeyring(keys map[string][]byte, current string) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("no keys")
+	}
+	for id, key := range keys {
+		if id == "" || strings.Contains(id, ":") {
+			return nil, fmt.Errorf("invalid key ID '%s': must be set and not contain a colon", id)
+		}
+		if len(key) != KEY_SIZE {
+			return nil, fmt.Errorf("key %s is %d bytes, must be %d bytes", id, len(key), KEY_SIZE)
+		}
+	}
+	if _, ok := keys[current]; current != "" && !ok {
+		return nil, fmt.Errorf("current key %s not found", current)
+	}
+	return &Keyring{
+		keys:    keys,
+		current: current,
+	}, nil
+}
+
+// LoadKeyring returns a Keyring with the keys in a YAML file of key ID to
+// base64-encoded key, like:
+//
+//	---
+//	2020-01: 7Yt3Dq1hd5bhzCg3b2H5ZzNQ4bdo0PF5cOSuc/UPbtc=
+//	2020-07: Xg2yBNGuUAf3dxb8dUJk+TQC/Rw3ZbeKiEGKIw2lEy4=
+//
+// See NewKeyring.
+func LoadKeyring(file, current string) (*Keyring, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var encoded map[string]string
+	if err := yaml.Unmarshal(bytes, &encoded); err != nil {
+		return nil, fmt.Errorf("cannot decode YAML in %s: %s", file, err)
+	}
+	keys := make(map[string][]byte, len(encoded))
+	for id, s := range encoded {
+		key, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("key %s in %s is not base64-encoded: %s", id, file, err)
+		}
+		keys[id] = key
+	}
+	kr, err := NewKeyring(keys, current)
+	if err != nil {
+		return nil, fmt.Errorf("invalid keys in %s: %s", file, err)
+	}
+	return kr, nil
+}
+
+func (kr *Keyring) CurrentKey() (string, []byte, error) {
+	if kr.current == "" {
+		return "", nil, fmt.Errorf("no current key")
+	}
+	return kr.current, kr.keys[kr.current], nil
+}
+
+func (kr *Keyring) Key(id string) ([]byte, error) {
+	key, ok := kr.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("key %s not found", id)
+	}
+	return key, nil
+}
+
+// IsEncrypted returns true if the value was encrypted by Encrypt, or by another
+// version of it that Decrypt doesn't support.
+func IsEncrypted(value interface{}) bool {
+	s, ok := value.(string)
+	return ok && strings.HasPrefix(s, anyPrefix)
+}
+
+// Encrypt returns the value of the request arg encrypted with the current key,
+// for the request.
+func Encrypt(kp KeyProvider, value interface{}, requestId, arg string) (string, error) {
+	id, key, err := kp.CurrentKey()
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("cannot encode value: %s", err)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", fmt.Errorf("key %s: %s", id, err)
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData(id, requestId, arg))
+	return PREFIX + id + ":" + arg + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt returns the value encrypted by Encrypt for the request, as decoded by
+// encoding/json: numbers are float64, for example, like values in a
+// proto.CreateRequest. It returns an error if the value was encrypted for another
+// request.
+func Decrypt(kp KeyProvider, s, requestId string) (interface{}, error) {
+	if !strings.HasPrefix(s, PREFIX) {
+		if strings.HasPrefix(s, anyPrefix) {
+			return nil, fmt.Errorf("unsupported encrypted value version: expected %s", PREFIX)
+		}
+		return nil, fmt.Errorf("not an encrypted value")
+	}
+	// Key IDs cannot contain a colon, and base64 has none, so the arg name is
+	// everything between them
+	v := strings.TrimPrefix(s, PREFIX)
+	first, last := strings.Index(v, ":"), strings.LastIndex(v, ":")
+	if first == -1 || first == last {
+		return nil, fmt.Errorf("invalid encrypted value: no key ID or arg name")
+	}
+	id, arg := v[:first], v[first+1:last]
+	sealed, err := base64.RawStdEncoding.DecodeString(v[last+1:])
+	if err != nil {
+		return nil, fmt.Errorf("invalid encrypted value: %s", err)
+	}
+	key, err := kp.Key(id)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, fmt.Errorf("key %s: %s", id, err)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid encrypted value: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additionalData(id, requestId, arg))
+	if err != nil {
+		return nil, fmt.Errorf("cannot decrypt value with key %s (not encrypted for request %s, or altered): %s", id, requestId, err)
+	}
+	var value interface{}
+	if err := json.Unmarshal(plaintext, &value); err != nil {
+		return nil, fmt.Errorf("cannot decode decrypted value: %s", err)
+	}
+	return value, nil
+}
+
+// EncryptArgs returns a copy of args with the values of the named args encrypted
+// for the request. Values already encrypted are not encrypted again, and names not
+// in args are ignored.
+func EncryptArgs(kp KeyProvider, args map[string]interface{}, names []string, requestId string) (map[string]interface{}, error) {
+	enc := make(map[string]interface{}, len(args))
+	for k, v := range args {
+		enc[k] = v
+	}
+	for _, name := range names {
+		v, ok := enc[name]
+		if !ok || IsEncrypted(v) {
+			continue
+		}
+		s, err := Encrypt(kp, v, requestId, name)
+		if err != nil {
+			return nil, fmt.Errorf("cannot encrypt arg %s: %s", name, err)
+		}
+		enc[name] = s
+	}
+	return enc, nil
+}
+
+// DecryptArgs returns the decrypted values of the encrypted args of the request,
+// or an empty map if none are encrypted. Other args are not returned.
+func DecryptArgs(kp KeyProvider, args map[string]interface{}, requestId string) (map[string]interface{}, error) {
+	dec := map[string]interface{}{}
+	for name, v := range args {
+		if !IsEncrypted(v) {
+			continue
+		}
+		value, err := Decrypt(kp, v.(string), requestId)
+		if err != nil {
+			return nil, fmt.Errorf("cannot decrypt arg %s: %s", name, err)
+		}
+		dec[name] = value
+	}
+	return dec, nil
+}
+
+// additionalData returns the AEAD additional data of a value. Fields are
+// separated by NUL, which none of them contain.
+func additionalData(keyId, requestId, arg string) []byte {
+	return []byte(keyId + "\x00" + requestId + "\x00" + arg)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,218 @@
+// Copyright 2020, Square, Inc.
+
+package argcrypt_test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/argcrypt"
+)
+
+var (
+	key1 = bytes.Repeat([]byte{1}, argcrypt.KEY_SIZE)
+	key2 = bytes.Repeat([]byte{2}, argcrypt.KEY_SIZE)
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	kr, err := argcrypt.NewKeyring(map[string][]byte{"k1": key1}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, value := range []interface{}{"hunter2", float64(3306), []interface{}{"a", "b"}, nil} {
+		s, err := argcrypt.Encrypt(kr, value, "req1", "password")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !argcrypt.IsEncrypted(s) || !strings.HasPrefix(s, argcrypt.PREFIX+"k1:") {
+			t.Errorf("got %s, expected encrypted value with key k1", s)
+		}
+		got, err := argcrypt.Decrypt(kr, s, "req1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(got, value); diff != nil {
+			t.Error(diff)
+		}
+	}
+
+	// Nonce is random, so the same value encrypts differently
+	s1, _ := argcrypt.Encrypt(kr, "hunter2", "req1", "password")
+	s2, _ := argcrypt.Encrypt(kr, "hunter2", "req1", "password")
+	if s1 == s2 {
+		t.Errorf("same value encrypted twice is equal, expected different values")
+	}
+
+	// Tampered value or key ID
+	p := strings.SplitN(strings.TrimPrefix(s1, argcrypt.PREFIX), ":", 2)
+	sealed, _ := base64.RawStdEncoding.DecodeString(strings.TrimPrefix(p[1], "password:"))
+	sealed[len(sealed)-1] ^= 1
+	if _, err := argcrypt.Decrypt(kr, argcrypt.PREFIX+"k1:password:"+base64.RawStdEncoding.EncodeToString(sealed), "req1"); err == nil {
+		t.Errorf("no error decrypting tampered value, expected one")
+	}
+	if _, err := argcrypt.Decrypt(kr, argcrypt.PREFIX+"k2:"+p[1], "req1"); err == nil {
+		t.Errorf("no error decrypting with unknown key, expected one")
+	}
+	if _, err := argcrypt.Decrypt(kr, "hunter2", "req1"); err == nil {
+		t.Errorf("no error decrypting plaintext, expected one")
+	}
+
+	// Value encrypted for another request or arg
+	if _, err := argcrypt.Decrypt(kr, s1, "req2"); err == nil {
+		t.Errorf("no error decrypting value for another request, expected one")
+	}
+	if _, err := argcrypt.Decrypt(kr, strings.Replace(s1, ":password:", ":token:", 1), "req1"); err == nil {
+		t.Errorf("no error decrypting value with another arg name, expected one")
+	}
+
+	// Value of another version is encrypted, but cannot be decrypted
+	v1 := "spincycle:enc:v1:k1:" + base64.RawStdEncoding.EncodeToString(sealed)
+	if !argcrypt.IsEncrypted(v1) {
+		t.Errorf("value of another version is not encrypted, expected it to be")
+	}
+	if _, err := argcrypt.Decrypt(kr, v1, "req1"); err == nil {
+		t.Errorf("no error decrypting value of another version, expected one")
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	old, err := argcrypt.NewKeyring(map[string][]byte{"k1": key1}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s1, err := argcrypt.Encrypt(old, "hunter2", "req1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// New values are encrypted with the new current key, old values still
+	// decrypted with the old key
+	kr, err := argcrypt.NewKeyring(map[string][]byte{"k1": key1, "k2": key2}, "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s2, err := argcrypt.Encrypt(kr, "hunter3", "req1", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(s2, argcrypt.PREFIX+"k2:") {
+		t.Errorf("got %s, expected value encrypted with key k2", s2)
+	}
+	for s, expect := range map[string]string{s1: "hunter2", s2: "hunter3"} {
+		got, err := argcrypt.Decrypt(kr, s, "req1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != expect {
+			t.Errorf("got %v, expected %s", got, expect)
+		}
+	}
+
+	// Decrypt-only keyring (Job Runner) cannot encrypt
+	jr, err := argcrypt.NewKeyring(map[string][]byte{"k1": key1, "k2": key2}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := argcrypt.Encrypt(jr, "x", "req1", "password"); err == nil {
+		t.Errorf("no error encrypting without current key, expected one")
+	}
+	if _, err := argcrypt.Decrypt(jr, s1, "req1"); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestEncryptDecryptArgs(t *testing.T) {
+	kr, err := argcrypt.NewKeyring(map[string][]byte{"k1": key1}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := map[string]interface{}{
+		"host":     "db1",
+		"password": "hunter2",
+	}
+	enc, err := argcrypt.EncryptArgs(kr, args, []string{"password", "token"}, "req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if args["password"] != "hunter2" {
+		t.Errorf("args modified, expected a copy")
+	}
+	if enc["host"] != "db1" || !argcrypt.IsEncrypted(enc["password"]) {
+		t.Errorf("got %v, expected only password encrypted", enc)
+	}
+	if _, ok := enc["token"]; ok {
+		t.Errorf("token arg set, expected names not in args ignored")
+	}
+
+	// Encrypted values are not encrypted again
+	again, err := argcrypt.EncryptArgs(kr, enc, []string{"password"}, "req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again["password"] != enc["password"] {
+		t.Errorf("encrypted value encrypted again")
+	}
+
+	dec, err := argcrypt.DecryptArgs(kr, enc, "req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(dec, map[string]interface{}{"password": "hunter2"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNewKeyringErrors(t *testing.T) {
+	cases := []struct {
+		keys    map[string][]byte
+		current string
+	}{
+		{nil, ""},
+		{map[string][]byte{"k1": []byte("short")}, "k1"},
+		{map[string][]byte{"k:1": key1}, ""},
+		{map[string][]byte{"k1": key1}, "k2"},
+	}
+	for i, c := range cases {
+		if _, err := argcrypt.NewKeyring(c.keys, c.current); err == nil {
+			t.Errorf("case %d: no error, expected one", i)
+		}
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	f, err := ioutil.TempFile("", "argcrypt-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	yaml := "---\nk1: " + base64.StdEncoding.EncodeToString(key1) + "\nk2: " + base64.StdEncoding.EncodeToString(key2) + "\n"
+	if _, err := f.WriteString(yaml); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	kr, err := argcrypt.LoadKeyring(f.Name(), "k2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, key, err := kr.CurrentKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "k2" || !bytes.Equal(key, key2) {
+		t.Errorf("got current key %s, expected k2", id)
+	}
+	key, err = kr.Key("k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, key1) {
+		t.Errorf("wrong key k1")
+	}
+}
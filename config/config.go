@@ -11,6 +11,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"gopkg.in/yaml.v2"
 )
@@ -22,6 +23,54 @@ const (
 	DEFAULT_ADDR_JOB_RUNNER      = "127.0.0.1:32307"
 	DEFAULT_MYSQL_DSN            = "root:@tcp(localhost:3306)/spincycle_development"
 	DEFAULT_SPECS_DIR            = "specs/"
+	DEFAULT_SPECS_KEEP_VERSIONS  = 3
+	DEFAULT_SHUTDOWN_POLICY      = SHUTDOWN_POLICY_SUSPEND
+	DEFAULT_STATUS_STALE_AFTER   = "5s"
+	DEFAULT_STATUS_FULL_EVERY    = 10
+
+	DEFAULT_RESUME_BACKOFF      = "10s"
+	DEFAULT_RESUME_MAX_BACKOFF  = "10m"
+	DEFAULT_RESUME_MAX_ATTEMPTS = 10
+
+	DEFAULT_RECONCILE_INTERVAL = "1m"
+	DEFAULT_RECONCILE_GRACE    = "2m"
+
+	DEFAULT_READ_REPLICA_MAX_LAG        = "10s"
+	DEFAULT_READ_REPLICA_CHECK_INTERVAL = "5s"
+
+	DEFAULT_SLO_INTERVAL     = "1m"
+	DEFAULT_SLO_WINDOWS      = "1h,6h,24h,168h" // 1 hour to 7 days
+	DEFAULT_SLO_BURN_RATE    = 2.0
+	DEFAULT_SLO_MIN_REQUESTS = 10
+
+	DEFAULT_DELIVERY_FLUSH_INTERVAL = "5s"
+	DEFAULT_DELIVERY_MAX_QUEUED     = 10000
+	DEFAULT_DELIVERY_BATCH_INTERVAL = "100ms"
+
+	DEFAULT_TRAVERSER_STOP_TIMEOUT = "10s"
+	DEFAULT_TRAVERSER_SEND_TIMEOUT = "10s"
+
+	DEFAULT_GUARDRAILS_CHECK_INTERVAL = "5s"
+
+	DEFAULT_CIRCUIT_BREAKER_MIN_TRIES = 20
+	DEFAULT_CIRCUIT_BREAKER_WINDOW    = "5m"
+	DEFAULT_CIRCUIT_BREAKER_COOLDOWN  = "5m"
+	DEFAULT_CIRCUIT_BREAKER_ACTION    = "fail"
+
+	DEFAULT_LIMITS_JOB_NAME   = 100   // job_log.name VARBINARY(100)
+	DEFAULT_LIMITS_JOB_STATUS = 1024  // spinc ps shows only one line
+	DEFAULT_LIMITS_JOB_ERROR  = 65535 // job_log.error TEXT
+
+	DEFAULT_CHAIN_BUILD_WORKERS    = 8
+	DEFAULT_CHAIN_BUILD_MAX_QUEUED = 100
+
+	DEFAULT_BULK_CREATE_MAX_CONCURRENT = 2
+
+	DEFAULT_WRITE_BUFFER_MAX_QUEUED     = 1000
+	DEFAULT_WRITE_BUFFER_RETRY_INTERVAL = "1s"
+
+	DEFAULT_ACCESS_LOG_SAMPLE_RATE = 1.0 // all API requests
+	DEFAULT_ACCESS_LOG_SCRUB       = "password,secret,token"
 )
 
 // Load loads a config file into the struct pointed to by configStruct.
@@ -91,11 +140,54 @@ func Defaults() (RequestManager, JobRunner) {
 			DSN: DEFAULT_MYSQL_DSN,
 		},
 		Specs: Specs{
-			Dir: DEFAULT_SPECS_DIR,
+			Dir:          DEFAULT_SPECS_DIR,
+			KeepVersions: DEFAULT_SPECS_KEEP_VERSIONS,
 		},
 		JRClient: HTTPClient{
 			ServerURL: "http://" + DEFAULT_ADDR_JOB_RUNNER,
 		},
+		StatusPush: StatusPush{
+			StaleAfter: DEFAULT_STATUS_STALE_AFTER,
+		},
+		Resume: Resume{
+			Backoff:     DEFAULT_RESUME_BACKOFF,
+			MaxBackoff:  DEFAULT_RESUME_MAX_BACKOFF,
+			MaxAttempts: DEFAULT_RESUME_MAX_ATTEMPTS,
+		},
+		Reconcile: Reconcile{
+			Interval: DEFAULT_RECONCILE_INTERVAL,
+			Grace:    DEFAULT_RECONCILE_GRACE,
+		},
+		ReadReplica: ReadReplica{
+			MaxLag:        DEFAULT_READ_REPLICA_MAX_LAG,
+			CheckInterval: DEFAULT_READ_REPLICA_CHECK_INTERVAL,
+		},
+		SLO: SLO{
+			Interval:    DEFAULT_SLO_INTERVAL,
+			Windows:     strings.Split(DEFAULT_SLO_WINDOWS, ","),
+			BurnRate:    DEFAULT_SLO_BURN_RATE,
+			MinRequests: DEFAULT_SLO_MIN_REQUESTS,
+		},
+		Limits: Limits{
+			JobName:   DEFAULT_LIMITS_JOB_NAME,
+			JobStatus: DEFAULT_LIMITS_JOB_STATUS,
+			JobError:  DEFAULT_LIMITS_JOB_ERROR,
+		},
+		ChainBuild: ChainBuild{
+			Workers:   DEFAULT_CHAIN_BUILD_WORKERS,
+			MaxQueued: DEFAULT_CHAIN_BUILD_MAX_QUEUED,
+		},
+		BulkCreate: BulkCreate{
+			MaxConcurrent: DEFAULT_BULK_CREATE_MAX_CONCURRENT,
+		},
+		AccessLog: AccessLog{
+			SampleRate: DEFAULT_ACCESS_LOG_SAMPLE_RATE,
+			Scrub:      strings.Split(DEFAULT_ACCESS_LOG_SCRUB, ","),
+		},
+		WriteBuffer: WriteBuffer{
+			MaxQueued:     DEFAULT_WRITE_BUFFER_MAX_QUEUED,
+			RetryInterval: DEFAULT_WRITE_BUFFER_RETRY_INTERVAL,
+		},
 	}
 	jrCfg := JobRunner{
 		Server: Server{
@@ -104,6 +196,37 @@ func Defaults() (RequestManager, JobRunner) {
 		RMClient: HTTPClient{
 			ServerURL: "http://" + DEFAULT_ADDR_REQUEST_MANAGER,
 		},
+		Shutdown: Shutdown{
+			ShutdownPolicy: ShutdownPolicy{
+				Policy: DEFAULT_SHUTDOWN_POLICY,
+			},
+		},
+		Traverser: Traverser{
+			StopTimeout: DEFAULT_TRAVERSER_STOP_TIMEOUT,
+			SendTimeout: DEFAULT_TRAVERSER_SEND_TIMEOUT,
+		},
+		Guardrails: Guardrails{
+			CheckInterval: DEFAULT_GUARDRAILS_CHECK_INTERVAL,
+		},
+		StatusPush: StatusPush{
+			FullEvery: DEFAULT_STATUS_FULL_EVERY,
+		},
+		CircuitBreaker: CircuitBreaker{
+			MinTries: DEFAULT_CIRCUIT_BREAKER_MIN_TRIES,
+			Window:   DEFAULT_CIRCUIT_BREAKER_WINDOW,
+			Cooldown: DEFAULT_CIRCUIT_BREAKER_COOLDOWN,
+			Action:   DEFAULT_CIRCUIT_BREAKER_ACTION,
+		},
+		Delivery: Delivery{
+			FlushInterval: DEFAULT_DELIVERY_FLUSH_INTERVAL,
+			MaxQueued:     DEFAULT_DELIVERY_MAX_QUEUED,
+			BatchInterval: DEFAULT_DELIVERY_BATCH_INTERVAL,
+		},
+		Limits: Limits{
+			JobName:   DEFAULT_LIMITS_JOB_NAME,
+			JobStatus: DEFAULT_LIMITS_JOB_STATUS,
+			JobError:  DEFAULT_LIMITS_JOB_ERROR,
+		},
 	}
 	return rmCfg, jrCfg
 }
@@ -142,6 +265,13 @@ func Env(envar, def string) string {
 //       cert_file: myorg.crt
 //       key_file: myorg.key
 //       ca_file: myorg.ca
+//   read_only:
+//     enabled: true
+//     reason: "database failover, ETA 15m"
+//   access_log:
+//     enabled: true
+//     endpoints:
+//       "GET /api/v1/status/running": 0.01
 //
 // The reciprocal top-level config is JobRunner.
 type RequestManager struct {
@@ -150,6 +280,35 @@ type RequestManager struct {
 	Specs    Specs      `yaml:"specs"`     // request specs
 	Auth     Auth       `yaml:"auth"`      // auth plugin
 	JRClient HTTPClient `yaml:"jr_client"` // RM to JR internal communication
+	ReadOnly ReadOnly   `yaml:"read_only"` // start in read-only mode
+
+	ReadReplica ReadReplica `yaml:"read_replica"` // MySQL replica for heavy reads
+
+	StatusPush StatusPush `yaml:"status_push"` // running status pushed by JRs
+	Resume     Resume     `yaml:"resume"`      // resuming suspended job chains
+	Reconcile  Reconcile  `yaml:"reconcile"`   // running requests lost by JRs
+	SLO        SLO        `yaml:"slo"`         // request type SLO tracking
+	Limits     Limits     `yaml:"limits"`      // max length of job log strings
+	ChainBuild ChainBuild `yaml:"chain_build"` // concurrent job chain builds
+	BulkCreate BulkCreate `yaml:"bulk_create"` // throttling of bulk creates
+	AccessLog  AccessLog  `yaml:"access_log"`  // structured API access logs
+
+	WriteBuffer WriteBuffer `yaml:"write_buffer"` // job logs and progress while MySQL is unavailable
+
+	ArgEncryption ArgEncryption `yaml:"arg_encryption"` // encrypt sensitive arg values
+
+	// JobChainSchemaVersion is the schema version that job chains are saved and
+	// sent as. Set it to the previous version during a rolling upgrade that
+	// changes the version (see proto.JOB_CHAIN_SCHEMA_VERSION) until all Request
+	// Managers and Job Runners are upgraded. Version 0 is the format before schema
+	// versions. The default (nil) is the current version.
+	JobChainSchemaVersion *uint `yaml:"job_chain_schema_version"`
+
+	// JobChainFormat is the format that job chains are saved and sent as: "json"
+	// or "protobuf", which is smaller and faster for large job chains. Chains
+	// saved in either format can be read. A Job Runner that does not support
+	// protobuf is sent JSON. The default is "json".
+	JobChainFormat string `yaml:"job_chain_format"`
 }
 
 // JobRunner represents the top-level layout for a Job Runner (JR) YAML config file.
@@ -168,11 +327,43 @@ type RequestManager struct {
 //       cert_file: myorg.crt
 //       key_file: myorg.key
 //       ca_file: myorg.ca
+//   shutdown:
+//     policy: finish
+//     finish_timeout: 2m
+//   status_push:
+//     interval: 1s
+//   delivery:
+//     spool_dir: /var/spool/spincycle
+//   limits:
+//     job_status: 512
 //
 // The reciprocal top-level config is RequestManager.
 type JobRunner struct {
 	Server   Server     `yaml:"server"`    // API addr and TLS
 	RMClient HTTPClient `yaml:"rm_client"` // JR to RM internal communication
+	Shutdown Shutdown   `yaml:"shutdown"`  // what to do with running chains on shutdown
+
+	Traverser  Traverser  `yaml:"traverser"`   // how long to wait for jobs to stop
+	Guardrails Guardrails `yaml:"guardrails"`  // stop starting chains when overloaded
+	Standby    Standby    `yaml:"standby"`     // only run chains taken over from failed JRs
+	StatusPush StatusPush `yaml:"status_push"` // push running status to RM
+	Delivery   Delivery   `yaml:"delivery"`    // job log and final state delivery to RM
+	Debug      Debug      `yaml:"debug"`       // record jobs for replay
+	Limits     Limits     `yaml:"limits"`      // max length of job status strings
+	Jobs       Jobs       `yaml:"jobs"`        // job plugins
+	Workspace  Workspace  `yaml:"workspace"`   // per-request scratch directories
+
+	ArgEncryption ArgEncryption `yaml:"arg_encryption"` // decrypt sensitive arg values
+
+	CircuitBreaker CircuitBreaker `yaml:"circuit_breaker"` // fail or hold jobs of types that keep failing
+
+	// JobChainSchemaVersion is the schema version that suspended job chains
+	// are sent as. See RequestManager.JobChainSchemaVersion.
+	JobChainSchemaVersion *uint `yaml:"job_chain_schema_version"`
+
+	// JobChainFormat is the format that suspended job chains are sent as.
+	// See RequestManager.JobChainFormat.
+	JobChainFormat string `yaml:"job_chain_format"`
 }
 
 // --------------------------------------------------------------------------
@@ -190,12 +381,663 @@ type Auth struct {
 	Strict bool `yaml:"strict"`
 }
 
+// The read_only section of RequestManager starts the Request Manager in read-only
+// mode: status and log APIs work, but requests cannot be created, started, or
+// stopped. It's used during database maintenance and failovers. Admins can also
+// enable and disable read-only mode at runtime via the API.
+type ReadOnly struct {
+	// Enabled starts the Request Manager in read-only mode. It is disabled
+	// by default.
+	Enabled bool `yaml:"enabled"`
+
+	// Reason is returned to callers, for example "database failover, ETA 15m".
+	Reason string `yaml:"reason"`
+}
+
+// The read_replica section of RequestManager configures a MySQL read replica of
+// the MySQL database. Heavy read-only API endpoints (finding requests, job logs,
+// and request history) read from the replica, so reporting traffic does not slow
+// down creating and running requests, which always use the primary (MySQL).
+// While the replica lags more than MaxLag or cannot be reached, they read from
+// the primary.
+type ReadReplica struct {
+	// DSN is the data source name for connecting to the replica, like MySQL.DSN.
+	// Grant the MySQL user SELECT on the database and REPLICATION CLIENT to check
+	// replication lag.
+	//
+	// There is no default: all reads use the primary.
+	DSN string `yaml:"dsn"`
+
+	// TLS specifies certificate, key, and CA files to enable TLS connections
+	// to the replica, like MySQL.TLS.
+	//
+	// The default is no TLS.
+	TLS `yaml:"tls"`
+
+	// MaxLag is the maximum replication lag, like "10s", at which reads use the
+	// replica. API responses from the replica report the lag.
+	//
+	// The default is DEFAULT_READ_REPLICA_MAX_LAG.
+	MaxLag string `yaml:"max_lag"`
+
+	// CheckInterval is how often to check replication lag, like "5s".
+	//
+	// The default is DEFAULT_READ_REPLICA_CHECK_INTERVAL.
+	CheckInterval string `yaml:"check_interval"`
+}
+
+// The status_push section configures Job Runners to push their running status to
+// the Request Manager on an interval, so the Request Manager does not have to poll
+// every Job Runner on every status request. Both RequestManager and JobRunner have
+// a status_push section, but each uses only one option.
+type StatusPush struct {
+	// Interval is how often a Job Runner pushes its running status, like "1s".
+	// Only the JobRunner config uses it.
+	//
+	// There is no default: push is disabled and the Request Manager polls.
+	Interval string `yaml:"interval"`
+
+	// StaleAfter is how old the last status pushed by a Job Runner can be,
+	// like "5s", before the Request Manager ignores it and polls the Job Runner
+	// instead. Only the RequestManager config uses it. With N-many Request Managers
+	// behind a load balancer, each receives only some pushes, so it should be
+	// greater than the Job Runner interval times the number of Request Managers.
+	//
+	// The default is DEFAULT_STATUS_STALE_AFTER.
+	StaleAfter string `yaml:"stale_after"`
+
+	// Labels are pushed with the running status of a Job Runner, like "zone: us-east-1a".
+	// The Request Manager places requests on Job Runners with the labels set in the
+	// request spec if it uses the label-affinity placement policy. Only the JobRunner
+	// config uses it.
+	//
+	// There is no default: the Job Runner has no labels.
+	Labels map[string]string `yaml:"labels"`
+
+	// Deltas makes a Job Runner push only the running jobs that changed or
+	// finished since its last push, instead of all running jobs. Every push has
+	// a sequence number, and a Request Manager that sees a gap in the sequence,
+	// because it missed a push, polls the Job Runner until the next full push.
+	// Only the JobRunner config uses it.
+	//
+	// The default is false: every push has all running jobs.
+	Deltas bool `yaml:"deltas"`
+
+	// FullEvery is how often, in pushes, a Job Runner pushing deltas pushes all
+	// running jobs, so Request Managers that saw a gap stop polling it. A push
+	// after a failed push is always full. Only the JobRunner config uses it.
+	//
+	// The default is DEFAULT_STATUS_FULL_EVERY.
+	FullEvery uint `yaml:"full_every"`
+}
+
+// The resume section of RequestManager configures resuming suspended job chains
+// (SJC). If sending an SJC to a Job Runner fails, the Request Manager waits before
+// trying again, doubling the wait after each failed attempt. After MaxAttempts,
+// the SJC is deleted and the request state is set to FAILED_RESUME with the last
+// error, so an SJC that repeatedly crashes Job Runners is not resumed forever.
+type Resume struct {
+	// Backoff is how long to wait after the first failed attempt, like "10s".
+	//
+	// The default is DEFAULT_RESUME_BACKOFF.
+	Backoff string `yaml:"backoff"`
+
+	// MaxBackoff is the maximum wait between attempts, like "10m".
+	//
+	// The default is DEFAULT_RESUME_MAX_BACKOFF.
+	MaxBackoff string `yaml:"max_backoff"`
+
+	// MaxAttempts is the maximum number of failed attempts to resume an SJC.
+	// Zero is no maximum.
+	//
+	// The default is DEFAULT_RESUME_MAX_ATTEMPTS.
+	MaxAttempts uint `yaml:"max_attempts"`
+}
+
+// The reconcile section of RequestManager configures the reconciler, which finds
+// running requests that their Job Runner no longer knows about because it crashed
+// without suspending them. A request that is stale for the Grace period is failed
+// or, if Resume is true, suspended from its last checkpoint (job log) so that it's
+// resumed like a suspended job chain.
+type Reconcile struct {
+	// Interval is how often to check running requests, like "1m". Zero ("0s")
+	// disables the reconciler.
+	//
+	// The default is DEFAULT_RECONCILE_INTERVAL.
+	Interval string `yaml:"interval"`
+
+	// Grace is how long a request must be stale before it's reconciled, like "2m",
+	// so a Job Runner that's restarting or briefly unreachable isn't mistaken
+	// for a crashed one.
+	//
+	// The default is DEFAULT_RECONCILE_GRACE.
+	Grace string `yaml:"grace"`
+
+	// Resume stale requests instead of failing them. Jobs that were running when
+	// the Job Runner crashed are run again, so only enable if jobs are idempotent.
+	// Requests with a failed job are always failed.
+	//
+	// The default is false.
+	Resume bool `yaml:"resume"`
+
+	// TakeoverURL is the URL of a standby Job Runner (see Standby) that takes
+	// over stale requests: they're suspended from their last checkpoint, like
+	// Resume, and resumed on this Job Runner. The Job Runner that lost a request
+	// is fenced: the Request Manager rejects the final state of the request from
+	// it. Like Resume, only set if jobs are idempotent.
+	//
+	// There is no default: stale requests are not taken over.
+	TakeoverURL string `yaml:"takeover_url"`
+}
+
+// The slo section of RequestManager configures tracking of request type service
+// level objectives (the slo field of a request spec). The Request Manager reports
+// how well requests of each type meet their SLO in rolling windows, and alerts
+// when an SLO starts or stops burning: requests miss it fast enough to use up its
+// error budget (see proto.SLOWindow).
+type SLO struct {
+	// Interval is how often to check for burning SLOs, like "1m". Zero ("0s")
+	// disables alerts; the API still reports SLO status.
+	//
+	// The default is DEFAULT_SLO_INTERVAL.
+	Interval string `yaml:"interval"`
+
+	// Windows are the rolling windows in which SLO attainment is reported, like
+	// ["1h", "24h"]. They are sorted shortest first.
+	//
+	// The default is DEFAULT_SLO_WINDOWS.
+	Windows []string `yaml:"windows"`
+
+	// BurnRate is the error budget burn rate at or above which a window is burning.
+	// An SLO is burning when its two shortest windows are burning.
+	//
+	// The default is DEFAULT_SLO_BURN_RATE.
+	BurnRate float64 `yaml:"burn_rate"`
+
+	// MinRequests is the minimum number of requests that must finish in a window
+	// to judge the SLO. With fewer, the window meets the SLO and is not burning,
+	// so a few failures of a rare request type do not alert.
+	//
+	// The default is DEFAULT_SLO_MIN_REQUESTS.
+	MinRequests uint `yaml:"min_requests"`
+}
+
+// The standby section of JobRunner runs the Job Runner as a warm standby: it does
+// not start new job chains, but it resumes job chains, which the Request Manager
+// sends it to take over requests from failed Job Runners (see Reconcile.TakeoverURL).
+type Standby struct {
+	// Enabled runs the Job Runner as a warm standby. It is disabled by default.
+	Enabled bool `yaml:"enabled"`
+}
+
+// The delivery section of JobRunner configures delivery of job logs and final job
+// chain states to the Request Manager. If the Request Manager is unreachable, they
+// are queued and delivered in order when it's reachable again, so they are not lost
+// during Request Manager outages.
+type Delivery struct {
+	// SpoolDir is a directory where queued job logs and final job chain states
+	// are saved, one file each, so they are delivered after the Job Runner restarts.
+	// It is created if it does not exist.
+	//
+	// There is no default: they are queued only in memory and lost if the Job Runner
+	// stops before the Request Manager is reachable.
+	SpoolDir string `yaml:"spool_dir"`
+
+	// FlushInterval is how often the Job Runner tries to deliver queued job logs
+	// and final job chain states, like "5s".
+	//
+	// The default is DEFAULT_DELIVERY_FLUSH_INTERVAL.
+	FlushInterval string `yaml:"flush_interval"`
+
+	// MaxQueued is the maximum number of queued job logs and final job chain states.
+	// When the queue is full, they are dropped and an error is logged. Zero is no
+	// maximum.
+	//
+	// The default is DEFAULT_DELIVERY_MAX_QUEUED.
+	MaxQueued uint `yaml:"max_queued"`
+
+	// BatchSize is the maximum number of job logs sent to the Request Manager
+	// in one call. Job logs from all job chains are batched, so a Job Runner
+	// running wide job chains makes far fewer calls. The Request Manager must
+	// have feature job-log-batch; else job logs are sent one at a time.
+	//
+	// The default is zero: job logs are not batched.
+	BatchSize uint `yaml:"batch_size"`
+
+	// BatchInterval is the maximum time a job log waits for its batch to fill
+	// before the batch is sent, like "100ms". The job waits too, so keep it short.
+	// Only used if BatchSize is set.
+	//
+	// The default is DEFAULT_DELIVERY_BATCH_INTERVAL.
+	BatchInterval string `yaml:"batch_interval"`
+}
+
+// The debug section of JobRunner configures debug mode. In debug mode, every job
+// chain and every job try (input and output job data, and return) is recorded to
+// a file that the replay command uses to re-run jobs locally. See job-runner/replay.
+type Debug struct {
+	// RecordDir is a directory where job chains and job tries are recorded, one file
+	// per request named <request ID>.jsonl. It is created if it does not exist.
+	//
+	// There is no default: debug mode is disabled. Recording is not meant for
+	// production because job data can be large and sensitive.
+	RecordDir string `yaml:"record_dir"`
+}
+
+// The jobs section of JobRunner configures job implementations loaded at startup
+// from Go plugins, so job packages can be deployed independently of the Job Runner
+// binary. See job/registry.
+type Jobs struct {
+	// PluginDir is a directory of Go plugins (*.so files) that export job types.
+	// The Job Runner fails to start if a plugin cannot be loaded, is not compatible,
+	// or exports a job type that another plugin exports.
+	//
+	// There is no default: only jobs compiled into the Job Runner are made.
+	PluginDir string `yaml:"plugin_dir"`
+
+	// MeasureCPU measures the CPU time of the goroutine that runs each job try
+	// (job.Usage.CPUTime). On Linux, the goroutine is locked to its OS thread
+	// for the whole try, so every running job uses one OS thread; Go programs
+	// crash if they use more than 10,000 threads. On other platforms, it has
+	// no effect. Job CPU time from job.ProcessUsage is reported either way.
+	//
+	// The default is false: goroutine CPU time is not measured (zero).
+	MeasureCPU bool `yaml:"measure_cpu"`
+}
+
+// The limits section configures the maximum length, in bytes, of job strings
+// that are stored or displayed. Longer strings are truncated and end with
+// proto.TRUNCATED_MARKER, so truncation is explicit instead of failing or being
+// silently cut by MySQL. Both RequestManager and JobRunner have a limits section:
+// the Job Runner truncates running job status, and the Request Manager truncates
+// job log names and errors when it saves them. Zero is no limit, but the Request
+// Manager always truncates to the job_log column sizes.
+type Limits struct {
+	// JobName is the maximum length of job names saved in job logs. Only the
+	// RequestManager config uses it. It cannot be greater than the default.
+	//
+	// The default is DEFAULT_LIMITS_JOB_NAME.
+	JobName uint `yaml:"job_name"`
+
+	// JobStatus is the maximum length of running job status (job.Job.Status).
+	// Only the JobRunner config uses it.
+	//
+	// The default is DEFAULT_LIMITS_JOB_STATUS.
+	JobStatus uint `yaml:"job_status"`
+
+	// JobError is the maximum length of job log error messages. Only the
+	// RequestManager config uses it. It cannot be greater than the default.
+	//
+	// The default is DEFAULT_LIMITS_JOB_ERROR.
+	JobError uint `yaml:"job_error"`
+}
+
+// The chain_build section of RequestManager limits concurrent job chain builds
+// when requests are created, so that creating many large requests at once does
+// not spike Request Manager memory. Builds over the limits wait in a queue.
+type ChainBuild struct {
+	// Workers is the maximum number of job chains built at once. Zero is no
+	// maximum.
+	//
+	// The default is DEFAULT_CHAIN_BUILD_WORKERS.
+	Workers uint `yaml:"workers"`
+
+	// MaxQueued is the maximum number of builds waiting for a worker or memory.
+	// When the queue is full, creating a request returns HTTP 503. Zero is no
+	// maximum.
+	//
+	// The default is DEFAULT_CHAIN_BUILD_MAX_QUEUED.
+	MaxQueued uint `yaml:"max_queued"`
+
+	// MaxMemoryMB is the maximum estimated memory, in megabytes, of job chains
+	// built at once. The estimate for a request type is the size of its job chain
+	// the last time it was built. Zero is no maximum.
+	//
+	// There is no default (no maximum).
+	MaxMemoryMB uint `yaml:"max_memory_mb"`
+
+	// MaxChainMB is the maximum size, in megabytes, of one job chain. Creating
+	// a request with a larger job chain returns HTTP 400. Zero is no maximum.
+	//
+	// There is no default (no maximum).
+	MaxChainMB uint `yaml:"max_chain_mb"`
+}
+
+// The bulk_create section of RequestManager throttles bulk creates (POST
+// /api/v1/requests/bulk), so that integrations creating many requests at once
+// do not crowd out other callers. Chain builds are still limited by ChainBuild.
+type BulkCreate struct {
+	// MaxConcurrent is the maximum number of bulk creates handled at once. More
+	// return HTTP 429. Zero is no maximum.
+	//
+	// The default is DEFAULT_BULK_CREATE_MAX_CONCURRENT.
+	MaxConcurrent uint `yaml:"max_concurrent"`
+
+	// StartInterval is how long to wait between starting the requests of a bulk
+	// create, like "100ms", to spread the new job chains over time.
+	//
+	// There is no default (no wait).
+	StartInterval string `yaml:"start_interval"`
+}
+
+// The write_buffer section of RequestManager buffers job logs and request progress
+// sent by Job Runners when MySQL is briefly unavailable, like during a failover.
+// Writes that fail because MySQL is unavailable are queued in memory and retried
+// in order, and the Job Runner call succeeds. Queued writes are lost if the Request
+// Manager stops before MySQL is available again. Final request states are not
+// buffered; Job Runners queue them (see Delivery).
+type WriteBuffer struct {
+	// MaxQueued is the maximum number of queued writes. When the buffer is full,
+	// writes fail with HTTP 503 and Job Runners send them again later. Zero
+	// disables the buffer: writes fail while MySQL is unavailable.
+	//
+	// The default is DEFAULT_WRITE_BUFFER_MAX_QUEUED.
+	MaxQueued uint `yaml:"max_queued"`
+
+	// RetryInterval is how often queued writes are retried.
+	//
+	// The default is DEFAULT_WRITE_BUFFER_RETRY_INTERVAL.
+	RetryInterval string `yaml:"retry_interval"`
+}
+
+// The access_log section of RequestManager configures structured API access logs:
+// one entry per API request with the caller, endpoint, latency, HTTP status, and
+// request ID (if any), so operators can analyze API usage. Entries are logged with
+// the standard logger, or sent to an HTTP sink. Busy endpoints can be sampled.
+type AccessLog struct {
+	// Enabled replaces the plain API request log with structured access logs.
+	// It is disabled by default.
+	Enabled bool `yaml:"enabled"`
+
+	// SampleRate is the fraction of API requests logged, from 0 (none) to 1 (all).
+	// Requests that return an error (HTTP status 400 or greater) are always logged.
+	//
+	// The default is DEFAULT_ACCESS_LOG_SAMPLE_RATE.
+	SampleRate float64 `yaml:"sample_rate"`
+
+	// Endpoints overrides SampleRate for specific endpoints, keyed on method and
+	// route, like "GET /api/v1/status/running": 0.01 to log 1% of status requests.
+	//
+	// There is no default: SampleRate applies to all endpoints.
+	Endpoints map[string]float64 `yaml:"endpoints"`
+
+	// Scrub is a list of sensitive field names. Values of query parameters and
+	// request args (arg=name=value) whose name contains one of them, ignoring
+	// case, are replaced with "REDACTED".
+	//
+	// The default is DEFAULT_ACCESS_LOG_SCRUB.
+	Scrub []string `yaml:"scrub"`
+
+	// Sink sends entries to an HTTP endpoint instead of the standard logger: they
+	// are POSTed to Sink.ServerURL in batches, as JSON arrays. Entries are dropped,
+	// not retried, if the sink is down or too slow.
+	//
+	// There is no default: entries are logged with the standard logger.
+	Sink HTTPClient `yaml:"sink"`
+}
+
 // The specs section of RequestManager configures the request specs.
 type Specs struct {
-	// Directory where all request specs are located. Subdirectories are ignored.
+	// Directory where all request specs are located, including subdirectories.
 	//
 	// The default is DEFAULT_SPECS_DIR.
 	Dir string `yaml:"dir"`
+
+	// Version identifies the specs, for example the git SHA of the specs repo.
+	// The version is saved with every request so it's known which specs were
+	// used to build its job chain.
+	//
+	// The default is a hash of the contents of all spec files.
+	Version string `yaml:"version"`
+
+	// KeepVersions is the number of most recently loaded spec versions that
+	// Request Managers keep. Suspended job chains are resumed only if their
+	// request was built with one of these versions; others fail to resume.
+	// Set to 0 to resume suspended job chains built with any version.
+	//
+	// The default is DEFAULT_SPECS_KEEP_VERSIONS.
+	KeepVersions uint `yaml:"keep_versions"`
+
+	// Namespaces maps spec directories, relative to Dir, to namespaces, like
+	// "payments/": "payments". Request types in a namespace, and their requests,
+	// are seen and used only by callers in the namespace (auth.Caller.Namespace)
+	// or with an admin role. A spec file is in the namespace of the longest
+	// directory that contains it.
+	//
+	// There is no default: no request types are in a namespace.
+	Namespaces map[string]string `yaml:"namespaces"`
+
+	// Env is the environment name, like "staging" or "production". Node fields
+	// overridden for the environment (the node `env` field) are applied when the
+	// specs are loaded, so one specs repo can serve many environments.
+	//
+	// There is no default: no overrides are applied.
+	Env string `yaml:"env"`
+
+	// TemplateCacheDir is a directory where the Request Manager caches sequence
+	// graphs (templates) built from the specs, keyed on a hash of the specs.
+	// If the specs haven't changed, the cached graphs are used instead of
+	// rebuilding them on startup. The directory is created if it doesn't exist,
+	// and it can be shared by Request Managers.
+	//
+	// There is no default: sequence graphs are built on every startup.
+	TemplateCacheDir string `yaml:"template_cache_dir"`
+
+	// AllowErrors lets the Request Manager start when static or graph checks
+	// fail for some sequences. Request types that use a sequence with errors are
+	// unbuildable: creating a request of that type returns an error. Either way,
+	// the errors are in the spec report (GET /api/v1/spec-report). Spec files
+	// that cannot be parsed always prevent the Request Manager from starting.
+	//
+	// The default is false: any spec error prevents the Request Manager from starting.
+	AllowErrors bool `yaml:"allow_errors"`
+}
+
+const (
+	SHUTDOWN_POLICY_SUSPEND = "suspend"
+	SHUTDOWN_POLICY_FINISH  = "finish"
+)
+
+// The shutdown section of JobRunner configures what happens to running job chains
+// when the Job Runner shuts down (e.g. on deploy). For example:
+//
+//   shutdown:
+//     policy: finish
+//     finish_timeout: 2m
+//     request_types:
+//       long-migration:
+//         policy: suspend
+//
+// The top-level policy applies to all job chains, and RequestTypes overrides it
+// for job chains of the given request types.
+type Shutdown struct {
+	ShutdownPolicy `yaml:",inline"`
+
+	// RequestTypes overrides the top-level policy for job chains of specific
+	// request types, keyed on request type. An override that doesn't set Policy
+	// or FinishTimeout uses the top-level value.
+	RequestTypes map[string]ShutdownPolicy `yaml:"request_types"`
+}
+
+// ShutdownPolicy is the top-level shutdown policy, or a per-request type override.
+type ShutdownPolicy struct {
+	// Policy is SHUTDOWN_POLICY_SUSPEND ("suspend") to suspend running job chains
+	// immediately, or SHUTDOWN_POLICY_FINISH ("finish") to let running job chains
+	// keep running for up to FinishTimeout. Job chains not done by then are
+	// suspended. Suspended job chains are resumed by another Job Runner.
+	//
+	// The default is DEFAULT_SHUTDOWN_POLICY.
+	Policy string `yaml:"policy"`
+
+	// FinishTimeout is how long to let job chains keep running when Policy is
+	// "finish", like "2m". It should be shorter than the time given for the Job
+	// Runner to shut down before it's killed.
+	//
+	// There is no default. It must be set if Policy is "finish".
+	FinishTimeout string `yaml:"finish_timeout"`
+}
+
+// The traverser section of JobRunner configures how long job chain traversers wait
+// for running jobs when a request is stopped or its job chain is suspended. For
+// example:
+//
+//   traverser:
+//     stop_timeout: 1m
+//
+// A request spec can override StopTimeout for its request type (stopTimeout),
+// and the caller can override it when stopping a request.
+type Traverser struct {
+	// StopTimeout is how long to wait for running jobs to stop, like "10s".
+	// Jobs that don't stop by then are abandoned: the request is finished
+	// without their final state. Some jobs need minutes to halt safely.
+	//
+	// The default is DEFAULT_TRAVERSER_STOP_TIMEOUT.
+	StopTimeout string `yaml:"stop_timeout"`
+
+	// SendTimeout is how long a job that finished waits to be reaped before
+	// the Job Runner logs a warning that the reaper is slow, like "10s". Done
+	// jobs are queued, so they're never dropped: the job keeps waiting for the
+	// current reaper, even while the reaper is switched out to stop or suspend
+	// the job chain. Stopping and suspending also wait this long, in addition
+	// to StopTimeout, for the reaper to finish.
+	//
+	// The default is DEFAULT_TRAVERSER_SEND_TIMEOUT.
+	SendTimeout string `yaml:"send_timeout"`
+}
+
+// The guardrails section of JobRunner sets watermarks for goroutines and heap
+// memory. When the Job Runner is over a watermark, it does not start new or
+// resumed job chains (HTTP 503) until usage drops, so a busy Job Runner does
+// not run out of memory and take every running request down with it. For example:
+//
+//   guardrails:
+//     max_goroutines: 50000
+//     max_heap_mb: 4096
+//
+// Usage is always reported (GET /api/v1/status/health and /debug/vars on the
+// Job Runner API), even if no watermarks are set.
+type Guardrails struct {
+	// MaxGoroutines is the maximum number of goroutines. Zero is no maximum.
+	//
+	// There is no default (no maximum).
+	MaxGoroutines uint `yaml:"max_goroutines"`
+
+	// MaxHeapMB is the maximum heap memory in use, in megabytes. Zero is no
+	// maximum.
+	//
+	// There is no default (no maximum).
+	MaxHeapMB uint `yaml:"max_heap_mb"`
+
+	// CheckInterval is how often usage is checked, like "5s". New job chains
+	// are refused, or accepted again, only after a check.
+	//
+	// The default is DEFAULT_GUARDRAILS_CHECK_INTERVAL.
+	CheckInterval string `yaml:"check_interval"`
+}
+
+// The circuit_breaker section of JobRunner enables the job type circuit breaker:
+// when more than failure_rate of the tries of a job type fail within the window,
+// its breaker opens for the cooldown, so a broken downstream API isn't hit over
+// and over by every request. For example:
+//
+//   circuit_breaker:
+//     failure_rate: 0.5
+//     min_tries: 20
+//     window: 5m
+//     cooldown: 10m
+//     action: fail
+//
+// While a breaker is open, new tries of jobs of its type don't run: they fail
+// (action "fail") or wait until it closes (action "wait"). If status push is
+// enabled (StatusPush.Interval), failure rates are fleet-wide: Job Runners push
+// their tries to the Request Manager and get the tries of all Job Runners back.
+// Breakers are reported by GET /api/v1/status/circuit-breakers and /debug/vars
+// on the Job Runner API.
+type CircuitBreaker struct {
+	// FailureRate is the fraction of tries that fail, from 0 to 1, above which
+	// the breaker of a job type opens, like 0.5. Tries stopped and tries that
+	// fail with a caller error (job.ERROR_CATEGORY_USER) are not counted.
+	//
+	// There is no default (circuit breaker disabled).
+	FailureRate float64 `yaml:"failure_rate"`
+
+	// MinTries is the minimum number of tries of a job type in the window before
+	// its breaker can open, so a few failures of a rare job type don't open it.
+	//
+	// The default is DEFAULT_CIRCUIT_BREAKER_MIN_TRIES.
+	MinTries uint `yaml:"min_tries"`
+
+	// Window is how far back tries are counted, like "5m".
+	//
+	// The default is DEFAULT_CIRCUIT_BREAKER_WINDOW.
+	Window string `yaml:"window"`
+
+	// Cooldown is how long a breaker stays open, like "5m". Then it closes and
+	// tries are counted again from zero. An operator can close it sooner with
+	// PUT /api/v1/circuit-breakers/<job type>/close on each Job Runner.
+	//
+	// The default is DEFAULT_CIRCUIT_BREAKER_COOLDOWN.
+	Cooldown string `yaml:"cooldown"`
+
+	// Action is what new tries of a job type do while its breaker is open:
+	// "fail" (fail without running, with a job.Error that is not retryable, so
+	// the job fails) or "wait" (wait until the breaker closes, then run).
+	//
+	// The default is DEFAULT_CIRCUIT_BREAKER_ACTION.
+	Action string `yaml:"action"`
+}
+
+// The workspace section of JobRunner gives every job chain a scratch directory
+// for jobs to write files to, instead of /tmp. For example:
+//
+//   workspace:
+//     dir: /var/lib/spincycle/workspace
+//     max_mb: 1024
+//
+// The Job Runner creates <dir>/<request ID> when it starts or resumes a job
+// chain and removes it when the chain is done or suspended. Jobs get the directory
+// from their context (job.Workspace), so they must be ContextJobs.
+type Workspace struct {
+	// Dir is the directory in which request workspaces are created. It is created
+	// if it does not exist. Do not share it with other programs or Job Runners.
+	//
+	// There is no default (workspaces disabled).
+	Dir string `yaml:"dir"`
+
+	// MaxMB is the maximum size of one request workspace, in megabytes. Size is
+	// checked after every job try: if the workspace is larger, the try fails with
+	// a job.Error that is not retryable. Zero is no maximum.
+	//
+	// There is no default (no maximum).
+	MaxMB uint `yaml:"max_mb"`
+}
+
+// The arg_encryption section enables encryption of sensitive request args (spec
+// arg sensitive: true). Both RequestManager and JobRunner have an arg_encryption
+// section. The Request Manager encrypts the given values of sensitive args when a
+// request is created, so they are saved and sent in job chains only as ciphertext,
+// and Job Runners decrypt them just before a job runs (job.SensitiveJob). Every
+// Job Runner must have every key, so enable it on Job Runners first.
+//
+// Keys are loaded from KeyFile by default. To get keys from a key management
+// service (KMS), set the MakeArgKeyProvider factory of the Request Manager and
+// Job Runner instead (see argcrypt.KeyProvider).
+//
+// To rotate keys, add the new key to KeyFile on all Job Runners and Request
+// Managers, then set CurrentKey on the Request Managers. Keep the old key until
+// no request that can be retried or resumed was created with it.
+type ArgEncryption struct {
+	// KeyFile is a YAML file of key ID to base64-encoded 256-bit key. It must be
+	// readable only by Spin Cycle.
+	//
+	// There is no default (arg encryption disabled).
+	KeyFile string `yaml:"key_file"`
+
+	// CurrentKey is the ID of the key in KeyFile that encrypts values. It is
+	// required if KeyFile is set. Only the RequestManager config uses it.
+	//
+	// There is no default.
+	CurrentKey string `yaml:"current_key"`
 }
 
 // The server section configures the server and API. Both RequestManager and
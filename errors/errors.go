@@ -24,6 +24,30 @@ func (e RequestNotFound) Error() string {
 
 // --------------------------------------------------------------------------
 
+var _ error = RequestTypeNotFound{}
+
+type RequestTypeNotFound struct {
+	Type string
+}
+
+func (e RequestTypeNotFound) Error() string {
+	return fmt.Sprintf("request type %s not found", e.Type)
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = SLONotFound{}
+
+type SLONotFound struct {
+	Type string
+}
+
+func (e SLONotFound) Error() string {
+	return fmt.Sprintf("request type %s has no slo", e.Type)
+}
+
+// --------------------------------------------------------------------------
+
 var _ error = JobNotFound{}
 
 type JobNotFound struct {
@@ -37,6 +61,30 @@ func (e JobNotFound) Error() string {
 
 // --------------------------------------------------------------------------
 
+var _ error = UpgradeNotFound{}
+
+type UpgradeNotFound struct {
+	UpgradeId string
+}
+
+func (e UpgradeNotFound) Error() string {
+	return fmt.Sprintf("job runner upgrade %s not found", e.UpgradeId)
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = GroupNotFound{}
+
+type GroupNotFound struct {
+	GroupId string
+}
+
+func (e GroupNotFound) Error() string {
+	return fmt.Sprintf("request group %s not found", e.GroupId)
+}
+
+// --------------------------------------------------------------------------
+
 var _ error = DbError{}
 
 // Error represents a generic database error. This struct is not superfluous,
@@ -55,6 +103,10 @@ func (e DbError) Error() string {
 	return fmt.Sprintf("database error: %s (%s)", e.err, e.query)
 }
 
+func (e DbError) Unwrap() error {
+	return e.err
+}
+
 // --------------------------------------------------------------------------
 
 var _ error = ErrInvalidCreateRequest{}
@@ -98,3 +150,140 @@ type ValidationError struct {
 func (e ValidationError) Error() string {
 	return e.Message
 }
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrQuotaExceeded{}
+
+// ErrQuotaExceeded is returned when a user or team cannot create another request
+// until one of its requests finishes or its daily quota resets.
+type ErrQuotaExceeded struct {
+	Message string
+}
+
+func (e ErrQuotaExceeded) Error() string {
+	return e.Message
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrDuplicateRequest{}
+
+// ErrDuplicateRequest is returned when a request is created while another request
+// of the same type that's not finished has the same values of the args in its spec
+// uniqueBy. RequestId is the other request.
+type ErrDuplicateRequest struct {
+	RequestId string
+	Message   string
+}
+
+func (e ErrDuplicateRequest) Error() string {
+	return e.Message
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrJobNotRunning{}
+
+// ErrJobNotRunning is returned when stopping one job of a request that's not
+// running a try: it's pending, waiting to retry, or done.
+type ErrJobNotRunning struct {
+	RequestId string
+	JobId     string
+}
+
+func (e ErrJobNotRunning) Error() string {
+	return fmt.Sprintf("job %s of request %s is not running (pending, waiting to retry, or done)", e.JobId, e.RequestId)
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrReadOnly{}
+
+// ErrReadOnly is returned when the Request Manager is in read-only mode and the
+// caller tries to create, start, or stop a request.
+type ErrReadOnly struct {
+	Reason string
+}
+
+func (e ErrReadOnly) Error() string {
+	if e.Reason == "" {
+		return "Request Manager is read-only"
+	}
+	return "Request Manager is read-only: " + e.Reason
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrInvalidTransition{}
+
+// ErrInvalidTransition is returned when a request cannot change from one state
+// to another, for example a Job Runner reporting that a request finished in
+// state PENDING.
+type ErrInvalidTransition struct {
+	RequestId string
+	From      string
+	To        string
+}
+
+func (e ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("request %s cannot change state from %s to %s", e.RequestId, e.From, e.To)
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrFenced{}
+
+// ErrFenced is returned when a Job Runner that lost a request tries to change it:
+// it reports the final state of a request that was taken over by another Job Runner
+// (see config.Reconcile.TakeoverURL), or it sends a job log, final state, or suspended
+// job chain with a fencing token older than the latest one issued for the request
+// (see proto.JobChain.FenceToken) because the request was resumed since. The Job
+// Runner is fenced so it cannot change the request that another Job Runner is running.
+type ErrFenced struct {
+	RequestId    string
+	JobRunnerURL string // Job Runner that sent the final state
+	Owner        string // Job Runner running the request
+	Token        uint64 // fencing token sent by the Job Runner
+	CurrentToken uint64 // latest fencing token issued for the request
+}
+
+func (e ErrFenced) Error() string {
+	if e.CurrentToken > 0 {
+		return fmt.Sprintf("request %s fencing token %d is stale, latest is %d (job chain was resumed on another Job Runner)", e.RequestId, e.Token, e.CurrentToken)
+	}
+	return fmt.Sprintf("request %s is running on Job Runner %s, not %s (taken over)", e.RequestId, e.Owner, e.JobRunnerURL)
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrDuplicateJobLog{}
+
+// ErrDuplicateJobLog is returned when a Job Runner sends a job log for a job try
+// that already has one, usually because it sent it again when it didn't know
+// whether the first send succeeded (see proto.Delivery).
+type ErrDuplicateJobLog struct {
+	RequestId string
+	JobId     string
+	Try       uint
+}
+
+func (e ErrDuplicateJobLog) Error() string {
+	return fmt.Sprintf("request %s job %s try %d already has a job log", e.RequestId, e.JobId, e.Try)
+}
+
+// --------------------------------------------------------------------------
+
+var _ error = ErrJobRunnerHasRequest{}
+
+// ErrJobRunnerHasRequest is returned when an admin finalizes a request (see
+// proto.FinalizeRequest) that its Job Runner is still running. The request must
+// be stopped instead, so its jobs stop and the Job Runner reports its final state.
+type ErrJobRunnerHasRequest struct {
+	RequestId    string
+	JobRunnerURL string
+}
+
+func (e ErrJobRunnerHasRequest) Error() string {
+	return fmt.Sprintf("request %s is still running on Job Runner %s: stop it instead", e.RequestId, e.JobRunnerURL)
+}
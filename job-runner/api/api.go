@@ -8,16 +8,30 @@ package api
 import (
 	"context"
 	"errors"
+	"expvar"
+	"fmt"
+	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/orcaman/concurrent-map"
+	log "github.com/sirupsen/logrus"
 
 	"github.com/square/spincycle/v2/job-runner/app"
+	"github.com/square/spincycle/v2/job-runner/breaker"
 	"github.com/square/spincycle/v2/job-runner/chain"
 	"github.com/square/spincycle/v2/job-runner/status"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/job/registry"
+	"github.com/square/spincycle/v2/job/wait"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
 	v "github.com/square/spincycle/v2/version"
 )
 
@@ -33,6 +47,20 @@ var (
 
 	// Error when Job Runner is shutting down and not starting new job chains
 	ErrShuttingDown = errors.New("Job Runner is shutting down - no new job chains are being started")
+
+	// Error when Job Runner is draining (see drainHandler) and not starting new job chains
+	ErrDraining = errors.New("Job Runner is draining - no new job chains are being started")
+
+	// Error when Job Runner is over a guardrail watermark (see status.Monitor) and
+	// not starting new job chains
+	ErrOverloaded = errors.New("Job Runner is overloaded - no new job chains are being started")
+
+	// Error when Job Runner is a warm standby (config.Standby), which only resumes
+	// job chains taken over from other Job Runners
+	ErrStandby = errors.New("Job Runner is a standby - no new job chains are being started")
+
+	// Error when job type circuit breakers (config.CircuitBreaker) are not enabled
+	ErrNoCircuitBreaker = errors.New("circuit breaker not enabled")
 )
 
 // api provides controllers for endpoints it registers with a router.
@@ -41,8 +69,14 @@ type API struct {
 	traverserFactory chain.TraverserFactory
 	traverserRepo    cmap.ConcurrentMap
 	stat             status.Manager
+	monitor          *status.Monitor
 	shutdownChan     chan struct{}
 	baseURL          string
+	jobRegistry      *registry.Registry
+	draining         int32 // atomic: 1 if draining
+	standby          bool
+	breaker          *breaker.Breaker
+	newChainMux      *sync.Mutex // serializes newJobChainHandler (see runningChain)
 	// --
 	echo *echo.Echo
 }
@@ -52,20 +86,33 @@ type Config struct {
 	TraverserFactory chain.TraverserFactory
 	TraverserRepo    cmap.ConcurrentMap
 	StatusManager    status.Manager
+	Monitor          *status.Monitor // optional, default no guardrails
 	ShutdownChan     chan struct{}
-	BaseURL          string // returned in location header when starting/resuming job chains
+	BaseURL          string             // returned in location header when starting/resuming job chains
+	JobRegistry      *registry.Registry // optional, job types loaded from plugins
+	Standby          bool               // only resume job chains, don't start new ones
+	Breaker          *breaker.Breaker   // optional, job type circuit breakers
 }
 
 // NewAPI creates a new API struct. It initializes an echo web server within the
 // struct, and registers all of the API's routes with it.
 func NewAPI(cfg Config) *API {
+	monitor := cfg.Monitor
+	if monitor == nil {
+		monitor = status.NewMonitor(0, 0)
+	}
 	api := &API{
 		appCtx:           cfg.AppCtx,
 		traverserFactory: cfg.TraverserFactory,
 		traverserRepo:    cfg.TraverserRepo,
 		stat:             cfg.StatusManager,
+		monitor:          monitor,
 		shutdownChan:     cfg.ShutdownChan,
 		baseURL:          cfg.BaseURL,
+		jobRegistry:      cfg.JobRegistry,
+		standby:          cfg.Standby,
+		breaker:          cfg.Breaker,
+		newChainMux:      &sync.Mutex{},
 		// --
 		echo: echo.New(),
 	}
@@ -73,12 +120,24 @@ func NewAPI(cfg Config) *API {
 	// //////////////////////////////////////////////////////////////////////
 	// Routes
 	// //////////////////////////////////////////////////////////////////////
-	api.echo.POST(API_ROOT+"job-chains", api.newJobChainHandler)                 // start running new job chain
-	api.echo.POST(API_ROOT+"job-chains/resume", api.resumeJobChainHandler)       // resume suspended job chain
-	api.echo.PUT(API_ROOT+"job-chains/:requestId/stop", api.stopJobChainHandler) // stop job chain
+	api.echo.POST(API_ROOT+"job-chains", api.newJobChainHandler)                  // start running new job chain
+	api.echo.POST(API_ROOT+"job-chains/resume", api.resumeJobChainHandler)        // resume suspended job chain
+	api.echo.GET(API_ROOT+"job-chains/:requestId", api.getJobChainHandler)        // job chain running here -> 200, else 404
+	api.echo.PUT(API_ROOT+"job-chains/:requestId/stop", api.stopJobChainHandler)  // stop job chain
+	api.echo.PUT(API_ROOT+"job-chains/:requestId/log-level", api.logLevelHandler) // elevate job chain log level
+
+	api.echo.PUT(API_ROOT+"job-chains/:requestId/jobs/:jobId/stop", api.stopJobHandler) // stop one job try, not the chain
 
 	api.echo.GET(API_ROOT+"status/running", api.statusRunningHandler) // return running jobs -> []proto.JobStatus
+	api.echo.GET(API_ROOT+"status/health", api.statusHealthHandler)   // return resource usage -> proto.JobRunnerHealth
+	api.echo.PUT(API_ROOT+"drain", api.drainHandler)                  // stop starting new job chains
+	api.echo.GET(API_ROOT+"jobs", api.listJobsHandler)                // job types from plugins -> []proto.JobType
+
+	api.echo.GET(API_ROOT+"status/circuit-breakers", api.listCircuitBreakersHandler)         // job type breakers -> []proto.CircuitBreaker
+	api.echo.PUT(API_ROOT+"circuit-breakers/:jobType/close", api.closeCircuitBreakerHandler) // close open breaker
+
 	api.echo.GET("/version", api.versionHandler)
+	api.echo.GET("/debug/vars", echo.WrapHandler(expvar.Handler())) // metrics, like runner.JobPanics
 
 	// //////////////////////////////////////////////////////////////////////
 	// Middleware and hooks
@@ -130,19 +189,49 @@ func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 // Do some basic validation on a job chain, and, if it passes, add it to the
 // chain repo. If it doesn't pass, return the validation error. Then start
 // running the job chain.
+//
+// It's idempotent: if the job chain is already running here, like when the RM
+// retries a dispatch that timed out but the JR received, it returns 200 and the
+// running jobs of the chain ([]proto.JobStatus) instead of an error, and the
+// chain isn't started again.
 func (api *API) newJobChainHandler(c echo.Context) error {
+	// Convert the payload into a proto.JobChain. It's done first because a
+	// chain that's already running is not refused, even if the JR is shutting
+	// down, draining, or overloaded: the RM would start it on another JR.
+	var jc proto.JobChain
+	err := bindChain(c, &jc, func(b []byte) error { return proto.DecodeJobChain(b, &jc) })
+	if err != nil {
+		return err
+	}
+
+	// Dispatches are serialized so a duplicate dispatch sent concurrently
+	// finds the traverser of the first one.
+	api.newChainMux.Lock()
+	defer api.newChainMux.Unlock()
+	if t, ok := api.runningChain(jc.RequestId); ok {
+		log.Infof("Job chain %s already running: ignoring duplicate dispatch", jc.RequestId)
+		c.Response().Header().Set("Location", api.chainLocation(jc.RequestId))
+		return c.JSON(http.StatusOK, t.Running())
+	}
+
 	// If Job Runner is shutting down, don't start running any new job chains.
 	select {
 	case <-api.shutdownChan:
 		return handleError(ErrShuttingDown)
 	default:
 	}
-
-	// Convert the payload into a proto.JobChain and validate.
-	var jc proto.JobChain
-	if err := c.Bind(&jc); err != nil {
-		return err
+	if api.Draining() {
+		return handleError(ErrDraining)
+	}
+	if api.standby {
+		return handleError(ErrStandby)
 	}
+	if api.monitor.Overloaded() {
+		status.ChainsRefused.Add(1)
+		return handleError(ErrOverloaded)
+	}
+
+	// Validate the job chain.
 	if err := chain.Validate(jc, true); err != nil {
 		return handleError(err)
 	}
@@ -161,10 +250,11 @@ func (api *API) newJobChainHandler(c echo.Context) error {
 
 	// Start the traverser, and remove it from the repo when it's
 	// done running. This could take a very long time to return,
-	// so we run it in a goroutine.
+	// so we run it in a goroutine. Its goroutines are labeled with the
+	// request ID (see status.ChainGoroutines).
 	go func() {
 		defer api.traverserRepo.Remove(jc.RequestId)
-		t.Run()
+		status.RunChain(jc.RequestId, t.Run)
 	}()
 
 	// Set the location in the response header to point to this server.
@@ -184,10 +274,18 @@ func (api *API) resumeJobChainHandler(c echo.Context) error {
 		return handleError(ErrShuttingDown)
 	default:
 	}
+	if api.Draining() {
+		return handleError(ErrDraining)
+	}
+	if api.monitor.Overloaded() {
+		status.ChainsRefused.Add(1)
+		return handleError(ErrOverloaded)
+	}
 
 	// Convert the payload into a proto.SuspendedJobChain.
 	var sjc proto.SuspendedJobChain
-	if err := c.Bind(&sjc); err != nil {
+	err := bindChain(c, &sjc, func(b []byte) error { return proto.DecodeSuspendedJobChain(b, &sjc) })
+	if err != nil {
 		return err
 	}
 	if err := chain.Validate(*sjc.JobChain, false); err != nil {
@@ -211,20 +309,31 @@ func (api *API) resumeJobChainHandler(c echo.Context) error {
 
 	// Start the traverser, and remove it from the repo when it's
 	// done running. This could take a very long time to return,
-	// so we run it in a goroutine.
+	// so we run it in a goroutine. Its goroutines are labeled with the
+	// request ID (see status.ChainGoroutines).
 	go func() {
 		defer api.traverserRepo.Remove(sjc.RequestId)
-		t.Run()
+		status.RunChain(sjc.RequestId, t.Run)
 	}()
 
 	return nil
 }
 
-// PUT <API_ROOT>/job-chains/{requestId}/stop
-// Stop the traverser for a job chain.
+// PUT <API_ROOT>/job-chains/{requestId}/stop?timeout=5m
+// Stop the traverser for a job chain. The optional timeout overrides the stop
+// timeout: how long to wait for running jobs to stop.
 func (api *API) stopJobChainHandler(c echo.Context) error {
 	requestId := c.Param("requestId")
 
+	var timeout time.Duration
+	if val := c.QueryParam("timeout"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, fmt.Sprintf("invalid timeout %s: must be a duration greater than zero", val))
+		}
+		timeout = d
+	}
+
 	// Get the traverser to the repo.
 	val, exists := api.traverserRepo.Get(requestId)
 	if !exists {
@@ -235,8 +344,9 @@ func (api *API) stopJobChainHandler(c echo.Context) error {
 		return handleError(ErrInvalidTraverser)
 	}
 
-	// Stop the traverser. This is expected to return quickly.
-	err := traverser.Stop()
+	// Stop the traverser. This returns when the running jobs stop, or after
+	// the timeout.
+	err := traverser.Stop(timeout)
 	if err != nil {
 		return handleError(err)
 	}
@@ -247,6 +357,65 @@ func (api *API) stopJobChainHandler(c echo.Context) error {
 	return nil
 }
 
+// PUT <API_ROOT>/job-chains/{requestId}/jobs/{jobId}/stop
+// Stop the current try of one running job without stopping the job chain. The
+// try fails, so the job is retried if it has tries left. Returns 409 if the job
+// is not running a try.
+func (api *API) stopJobHandler(c echo.Context) error {
+	requestId := c.Param("requestId")
+	jobId := c.Param("jobId")
+
+	val, exists := api.traverserRepo.Get(requestId)
+	if !exists {
+		return handleError(ErrTraverserNotFound)
+	}
+	traverser, ok := val.(chain.Traverser)
+	if !ok {
+		return handleError(ErrInvalidTraverser)
+	}
+
+	// Blocks until the job try stops
+	if err := traverser.StopJob(jobId); err != nil {
+		return handleError(err)
+	}
+	return nil
+}
+
+// GET <API_ROOT>/job-chains/{requestId}
+// Return 200 if the job chain is running on this Job Runner, else 404. This is
+// the URL returned when a job chain is started or resumed. The RM reconciler
+// uses it to find running requests that a crashed Job Runner no longer knows about.
+func (api *API) getJobChainHandler(c echo.Context) error {
+	if _, exists := api.traverserRepo.Get(c.Param("requestId")); !exists {
+		return handleError(ErrTraverserNotFound)
+	}
+	return nil
+}
+
+// PUT <API_ROOT>/job-chains/{requestId}/log-level
+// Elevate the log level of a running job chain: its traverser, runners, and jobs
+// log at the given level, like debug, until the duration expires. Other job chains
+// are not affected. The RM forwards its request log level API to this endpoint.
+func (api *API) logLevelHandler(c echo.Context) error {
+	requestId := c.Param("requestId")
+
+	var ll proto.RequestLogLevel
+	if err := c.Bind(&ll); err != nil {
+		return err
+	}
+	level, d, err := reqlog.Parse(ll.Level, ll.Duration)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	if _, exists := api.traverserRepo.Get(requestId); !exists {
+		return handleError(ErrTraverserNotFound)
+	}
+
+	ll.Until = reqlog.Elevate(requestId, level, d)
+	return c.JSON(http.StatusOK, ll)
+}
+
 // GET <API_ROOT>/status/running
 func (api *API) statusRunningHandler(c echo.Context) error {
 	f := proto.StatusFilter{
@@ -260,16 +429,109 @@ func (api *API) statusRunningHandler(c echo.Context) error {
 	return c.JSON(http.StatusOK, jobs)
 }
 
+// GET <API_ROOT>/status/health
+// Return the resource usage of the Job Runner at the last guardrail check, and
+// the number of goroutines per running job chain now.
+func (api *API) statusHealthHandler(c echo.Context) error {
+	h := api.monitor.Health()
+	h.Chains = status.ChainGoroutines()
+	return c.JSON(http.StatusOK, h)
+}
+
+// PUT <API_ROOT>/drain
+// Drain the Job Runner: stop starting new and resumed job chains, but keep
+// running current job chains. The RM hits this endpoint when upgrading Job Runners.
+// Draining cannot be undone; restart the Job Runner instead.
+func (api *API) drainHandler(c echo.Context) error {
+	if atomic.CompareAndSwapInt32(&api.draining, 0, 1) {
+		log.Infof("Draining: no new job chains are being started, %d running", api.traverserRepo.Count())
+	}
+	return nil
+}
+
+// Draining returns true if the Job Runner is draining.
+func (api *API) Draining() bool {
+	return atomic.LoadInt32(&api.draining) == 1
+}
+
+// GET <API_ROOT>/jobs
+// Return the job types that the Job Runner can make: the built-in wait and poll
+// jobs and job types loaded from plugins or registered in code. Job types made
+// only by the jobs.Factory compiled into the Job Runner are not known, so they
+// are not returned.
+func (api *API) listJobsHandler(c echo.Context) error {
+	types := []proto.JobType{{Type: wait.JOB_TYPE}, {Type: poll.JOB_TYPE}}
+	if api.jobRegistry != nil {
+		types = append(types, api.jobRegistry.JobTypes()...)
+	}
+	return c.JSON(http.StatusOK, types)
+}
+
+// GET <API_ROOT>/status/circuit-breakers
+// Return the circuit breakers of job types that have tries in the window or are
+// open. Returns an empty list if circuit breakers are not enabled.
+func (api *API) listCircuitBreakersHandler(c echo.Context) error {
+	if api.breaker == nil {
+		return c.JSON(http.StatusOK, []proto.CircuitBreaker{})
+	}
+	return c.JSON(http.StatusOK, api.breaker.List())
+}
+
+// PUT <API_ROOT>/circuit-breakers/{jobType}/close
+// Close the open circuit breaker of a job type before its cool-down ends, like
+// when an operator knows the downstream API is fixed. The job type is URL-escaped.
+// Returns 409 if the breaker is not open.
+func (api *API) closeCircuitBreakerHandler(c echo.Context) error {
+	if api.breaker == nil {
+		return handleError(ErrNoCircuitBreaker)
+	}
+	jobType, err := url.PathUnescape(c.Param("jobType"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := api.breaker.Close(jobType); err != nil {
+		return handleError(err)
+	}
+	return nil
+}
+
 func (api *API) versionHandler(c echo.Context) error {
 	return c.String(http.StatusOK, v.Version())
 }
 
 // ------------------------------------------------------------------------- //
 
+// runningChain returns the traverser of the job chain if it's running on this
+// Job Runner.
+func (api *API) runningChain(requestId string) (chain.Traverser, bool) {
+	val, exists := api.traverserRepo.Get(requestId)
+	if !exists {
+		return nil, false
+	}
+	t, ok := val.(chain.Traverser)
+	return t, ok
+}
+
 func (api *API) chainLocation(requestId string) string {
 	return api.baseURL + API_ROOT + "job-chains/" + requestId
 }
 
+// bindChain binds the request body, a job chain or suspended job chain, to v like
+// c.Bind, but a protobuf body (proto.CONTENT_TYPE_PROTOBUF) is decoded by decode.
+func bindChain(c echo.Context, v interface{}, decode func([]byte) error) error {
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), proto.CONTENT_TYPE_PROTOBUF) {
+		return c.Bind(v)
+	}
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := decode(body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
 func handleError(err error) *echo.HTTPError {
 	switch err.(type) {
 	case chain.ErrInvalidChain:
@@ -280,7 +542,11 @@ func handleError(err error) *echo.HTTPError {
 			return echo.NewHTTPError(http.StatusNotFound, err.Error())
 		case ErrDuplicateTraverser:
 			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
-		case ErrShuttingDown:
+		case chain.ErrJobNotRunning, breaker.ErrNotOpen:
+			return echo.NewHTTPError(http.StatusConflict, err.Error())
+		case ErrNoCircuitBreaker:
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		case ErrShuttingDown, ErrDraining, ErrOverloaded, ErrStandby:
 			return echo.NewHTTPError(http.StatusServiceUnavailable, err.Error())
 		default:
 			return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
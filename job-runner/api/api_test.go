@@ -3,18 +3,30 @@
 package api_test
 
 import (
+	"bytes"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"testing"
+	"time"
 
+	"github.com/go-test/deep"
 	"github.com/orcaman/concurrent-map"
+	log "github.com/sirupsen/logrus"
 
+	"github.com/square/spincycle/v2/job"
 	"github.com/square/spincycle/v2/job-runner/api"
 	"github.com/square/spincycle/v2/job-runner/app"
+	"github.com/square/spincycle/v2/job-runner/breaker"
 	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/job-runner/status"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/job/registry"
+	"github.com/square/spincycle/v2/job/wait"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
 	testutil "github.com/square/spincycle/v2/test"
 	"github.com/square/spincycle/v2/test/mock"
 	v "github.com/square/spincycle/v2/version"
@@ -138,6 +150,119 @@ func TestNewJobChainMultipleTraverser(t *testing.T) {
 	}
 }
 
+// A job chain that's already running is not started again: the dispatch is
+// idempotent, even if the JR is draining.
+func TestNewJobChainDuplicate(t *testing.T) {
+	tf := &mock.TraverserFactory{
+		MakeFunc: func(jc *proto.JobChain) (chain.Traverser, error) {
+			t.Error("TraverserFactory.Make called, expected it NOT to be called for a running job chain")
+			return &mock.Traverser{}, nil
+		},
+	}
+	ctx := app.Defaults()
+	ctx.Config.Server.Addr = "host:port"
+	setupWithCtx(tf, ctx)
+	defer cleanup()
+
+	jobChain := proto.JobChain{
+		RequestId: "abc",
+		Jobs:      testutil.InitJobs(3),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+	payload, err := json.Marshal(jobChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running := []proto.JobStatus{{RequestId: "abc", JobId: "job2", State: proto.STATE_RUNNING}}
+	traverserRepo.Set(jobChain.RequestId, &mock.Traverser{JobStatus: running})
+
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"drain", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("drain response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	var got []proto.JobStatus
+	statusCode, headers, err := testutil.MakeHTTPRequest("POST", baseURL()+"job-chains", payload, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(got, running); diff != nil {
+		t.Error(diff)
+	}
+	expectedLocation := "http://host:port/api/v1/job-chains/abc"
+	if headers.Get("Location") != expectedLocation {
+		t.Errorf("location header = %s, expected %s", headers.Get("Location"), expectedLocation)
+	}
+}
+
+// The RM retries a dispatch that timed out, but the JR received the first one:
+// the job chain is started once, and both dispatches succeed.
+func TestNewJobChainDispatchRetry(t *testing.T) {
+	made := 0
+	done := make(chan struct{})
+	tf := &mock.TraverserFactory{
+		MakeFunc: func(jc *proto.JobChain) (chain.Traverser, error) {
+			made++
+			return &runningTraverser{done: done}, nil
+		},
+	}
+	setup(tf)
+	defer cleanup()
+	defer close(done)
+
+	jobChain := proto.JobChain{
+		RequestId: "abc",
+		Jobs:      testutil.InitJobs(3),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+	payload, err := json.Marshal(jobChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		statusCode, headers, err := testutil.MakeHTTPRequest("POST", baseURL()+"job-chains", payload, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if statusCode != http.StatusOK {
+			t.Errorf("dispatch %d: response status = %d, expected %d", i, statusCode, http.StatusOK)
+		}
+		if headers.Get("Location") == "" {
+			t.Errorf("dispatch %d: location header not set", i)
+		}
+	}
+	if made != 1 {
+		t.Errorf("made %d traversers, expected 1", made)
+	}
+	if traverserRepo.Count() != 1 {
+		t.Errorf("%d traversers in repo, expected 1", traverserRepo.Count())
+	}
+}
+
+// runningTraverser is a mock.Traverser that runs until done is closed.
+type runningTraverser struct {
+	mock.Traverser
+	done chan struct{}
+}
+
+func (t *runningTraverser) Run() {
+	<-t.done
+}
+
 // Test new job chain endpoint when Job Runner is shutting down.
 func TestNewJobChainShutdown(t *testing.T) {
 	setup(&mock.TraverserFactory{})
@@ -170,6 +295,165 @@ func TestNewJobChainShutdown(t *testing.T) {
 	}
 }
 
+func TestNewJobChainDraining(t *testing.T) {
+	trFactory := &mock.TraverserFactory{
+		MakeFunc: func(jc *proto.JobChain) (chain.Traverser, error) {
+			t.Error("TraverserFactory.Make called, expected it NOT to be called when draining")
+			return &mock.Traverser{}, nil
+		},
+	}
+	setup(trFactory)
+	defer cleanup()
+
+	jobChain := proto.JobChain{
+		RequestId: "abc",
+		Jobs:      testutil.InitJobs(3),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+	payload, err := json.Marshal(jobChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"drain", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL()+"job-chains", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestNewJobChainOverloaded(t *testing.T) {
+	trFactory := &mock.TraverserFactory{
+		MakeFunc: func(jc *proto.JobChain) (chain.Traverser, error) {
+			t.Error("TraverserFactory.Make called, expected it NOT to be called when overloaded")
+			return &mock.Traverser{}, nil
+		},
+	}
+	// Tests run more than 1 goroutine, so this is overloaded after a check
+	monitor := status.NewMonitor(1, 0)
+	monitor.Check()
+	appCtx := app.Defaults()
+	server = httptest.NewServer(api.NewAPI(api.Config{
+		AppCtx:           appCtx,
+		TraverserFactory: trFactory,
+		TraverserRepo:    cmap.New(),
+		StatusManager:    &mock.JRStatus{},
+		Monitor:          monitor,
+		ShutdownChan:     make(chan struct{}),
+	}))
+	defer cleanup()
+
+	jobChain := proto.JobChain{
+		RequestId: "abc",
+		Jobs:      testutil.InitJobs(3),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+	payload, err := json.Marshal(jobChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refused := status.ChainsRefused.Value()
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"job-chains", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusServiceUnavailable)
+	}
+	if status.ChainsRefused.Value() != refused+1 {
+		t.Errorf("chains_refused = %d, expected %d", status.ChainsRefused.Value(), refused+1)
+	}
+
+	var h proto.JobRunnerHealth
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"status/health", nil, &h)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if !h.Overloaded || h.MaxGoroutines != 1 || h.Reason == "" {
+		t.Errorf("health = %+v, expected overloaded with max 1 goroutine", h)
+	}
+}
+
+func TestNewJobChainStandby(t *testing.T) {
+	// A standby JR doesn't start new job chains, but it resumes job chains
+	// (taken over from other JRs)
+	trFactory := &mock.TraverserFactory{
+		MakeFunc: func(jc *proto.JobChain) (chain.Traverser, error) {
+			t.Error("TraverserFactory.Make called, expected it NOT to be called on standby")
+			return &mock.Traverser{}, nil
+		},
+	}
+	appCtx := app.Defaults()
+	server = httptest.NewServer(api.NewAPI(api.Config{
+		AppCtx:           appCtx,
+		TraverserFactory: trFactory,
+		TraverserRepo:    cmap.New(),
+		StatusManager:    &mock.JRStatus{},
+		ShutdownChan:     make(chan struct{}),
+		Standby:          true,
+	}))
+	defer cleanup()
+
+	jobChain := proto.JobChain{
+		RequestId: "abc",
+		Jobs:      testutil.InitJobs(3),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+	payload, err := json.Marshal(jobChain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"job-chains", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusServiceUnavailable)
+	}
+
+	sjc := proto.SuspendedJobChain{
+		RequestId:         "abc",
+		JobChain:          &jobChain,
+		TotalJobTries:     map[string]uint{},
+		LatestRunJobTries: map[string]uint{},
+		SequenceTries:     map[string]uint{},
+	}
+	payload, err = json.Marshal(sjc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL()+"job-chains/resume", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+}
+
 func TestNewJobChainSuccess(t *testing.T) {
 	requestId := "abc"
 	ctx := app.Defaults()
@@ -209,6 +493,59 @@ func TestNewJobChainSuccess(t *testing.T) {
 	}
 }
 
+func TestNewJobChainProtobuf(t *testing.T) {
+	var got proto.JobChain
+	tf := &mock.TraverserFactory{
+		MakeFunc: func(jc *proto.JobChain) (chain.Traverser, error) {
+			got = *jc
+			return &mock.Traverser{}, nil
+		},
+	}
+	setup(tf)
+	defer cleanup()
+
+	jobChain := proto.JobChain{
+		RequestId: "abc",
+		Jobs:      testutil.InitJobs(3),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+	payload, err := proto.EncodeJobChain(jobChain, proto.CHAIN_FORMAT_PROTOBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("POST", baseURL()+"job-chains", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", proto.CONTENT_TYPE_PROTOBUF)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", res.StatusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(got, jobChain); diff != nil {
+		t.Error(diff)
+	}
+
+	// Invalid protobuf is a bad request
+	req, _ = http.NewRequest("POST", baseURL()+"job-chains", bytes.NewReader(payload[:len(payload)/2]))
+	req.Header.Set("Content-Type", proto.CONTENT_TYPE_PROTOBUF)
+	res, err = http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
 // Test successfully resuming a job chain.
 func TestResumeJobChainSuccess(t *testing.T) {
 	requestId := "abc"
@@ -428,6 +765,138 @@ func TestStopJobChainHandlerSuccess(t *testing.T) {
 	}
 }
 
+func TestStopJobChainHandlerTimeout(t *testing.T) {
+	requestId := "abcd1234"
+	setup(&mock.TraverserFactory{})
+	defer cleanup()
+
+	// Invalid timeout: traverser is not stopped
+	trav := &mock.Traverser{}
+	traverserRepo.Set(requestId, trav)
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/stop?timeout=0s", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/stop?timeout=2m", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if trav.StopTimeout != 2*time.Minute {
+		t.Errorf("stop timeout = %s, expected 2m", trav.StopTimeout)
+	}
+}
+
+func TestStopJobHandler(t *testing.T) {
+	requestId := "abcd1234"
+	setup(&mock.TraverserFactory{})
+	defer cleanup()
+
+	// No traverser
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/jobs/job1/stop", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+
+	trav := &mock.Traverser{}
+	traverserRepo.Set(requestId, trav)
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/jobs/job1/stop", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if trav.StoppedJob != "job1" {
+		t.Errorf("stopped job %q, expected job1", trav.StoppedJob)
+	}
+
+	// Job not running
+	trav.StopJobErr = chain.ErrJobNotRunning
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/jobs/job1/stop", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
+	}
+}
+
+func TestGetJobChain(t *testing.T) {
+	requestId := "abcd1234"
+	setup(&mock.TraverserFactory{})
+	defer cleanup()
+
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"job-chains/"+requestId, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+
+	traverserRepo.Set(requestId, &mock.Traverser{})
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"job-chains/"+requestId, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+}
+
+func TestLogLevel(t *testing.T) {
+	requestId := "abcd1234"
+	setup(&mock.TraverserFactory{})
+	defer cleanup()
+
+	// Job chain not running here -> 404
+	payload := []byte(`{"level":"debug","duration":"5m"}`)
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/log-level", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+
+	// Invalid level -> 400
+	traverserRepo.Set(requestId, &mock.Traverser{})
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/log-level", []byte(`{"level":"chatty"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+
+	var ll proto.RequestLogLevel
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"job-chains/"+requestId+"/log-level", payload, &ll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reqlog.Elevate(requestId, log.GetLevel(), 0) // reset
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	level, until := reqlog.Level(requestId)
+	if level != log.DebugLevel {
+		t.Errorf("request log level = %s, expected debug", level)
+	}
+	if !ll.Until.Equal(until) {
+		t.Errorf("until = %s, expected %s", ll.Until, until)
+	}
+}
+
 func TestGetVersion(t *testing.T) {
 	setup(&mock.TraverserFactory{})
 	defer cleanup()
@@ -449,3 +918,110 @@ func TestGetVersion(t *testing.T) {
 		t.Errorf("got version '%s', expected '%s'", gotVersion, expectVersion)
 	}
 }
+
+func TestGetDebugVars(t *testing.T) {
+	setup(&mock.TraverserFactory{})
+	defer cleanup()
+	var vars map[string]interface{}
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", server.URL+"/debug/vars", nil, &vars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if _, ok := vars["job_panics"]; !ok {
+		t.Errorf("job_panics not in debug vars: %v", vars)
+	}
+}
+
+func TestListJobs(t *testing.T) {
+	reg := registry.New(nil)
+	err := reg.Register("test/job", func(id job.Id) (job.Job, error) { return &mock.Job{IdResp: id}, nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	traverserRepo = cmap.New()
+	shutdownChan = make(chan struct{})
+	cfg := api.Config{
+		AppCtx:           app.Defaults(),
+		TraverserFactory: &mock.TraverserFactory{},
+		TraverserRepo:    traverserRepo,
+		StatusManager:    &mock.JRStatus{},
+		ShutdownChan:     shutdownChan,
+		JobRegistry:      reg,
+	}
+	server = httptest.NewServer(api.NewAPI(cfg))
+	defer cleanup()
+
+	var got []proto.JobType
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"jobs", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expect := []proto.JobType{{Type: wait.JOB_TYPE}, {Type: poll.JOB_TYPE}, {Type: "test/job"}}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCircuitBreakers(t *testing.T) {
+	cb := breaker.New(breaker.Config{
+		FailureRate: 0.5,
+		MinTries:    1,
+		Window:      time.Minute,
+		Cooldown:    time.Minute,
+		Action:      breaker.ACTION_FAIL,
+	})
+	cb.Record("test/job", true)
+
+	traverserRepo = cmap.New()
+	shutdownChan = make(chan struct{})
+	cfg := api.Config{
+		AppCtx:           app.Defaults(),
+		TraverserFactory: &mock.TraverserFactory{},
+		TraverserRepo:    traverserRepo,
+		StatusManager:    &mock.JRStatus{},
+		ShutdownChan:     shutdownChan,
+		Breaker:          cb,
+	}
+	server = httptest.NewServer(api.NewAPI(cfg))
+	defer cleanup()
+
+	var got []proto.CircuitBreaker
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"status/circuit-breakers", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if len(got) != 1 || got[0].JobType != "test/job" || !got[0].Open {
+		t.Errorf("got %+v, expected open breaker for job type test/job", got)
+	}
+
+	// Job type is URL-escaped because it can contain /
+	closeURL := baseURL() + "circuit-breakers/" + url.PathEscape("test/job") + "/close"
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", closeURL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if _, open := cb.Check("test/job"); open {
+		t.Error("breaker open, expected closed")
+	}
+
+	// Not open -> 409
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", closeURL, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/square/spincycle/v2/argcrypt"
 	"github.com/square/spincycle/v2/config"
 	"github.com/square/spincycle/v2/request-manager"
 )
@@ -20,6 +21,12 @@ type Context struct {
 
 type Factories struct {
 	MakeRequestManagerClient func(Context) (rm.Client, error)
+
+	// MakeArgKeyProvider makes the key provider that decrypts sensitive arg
+	// values, or returns nil if arg encryption is disabled. The default loads
+	// config.ArgEncryption.KeyFile. Provide a custom factory to get keys from
+	// a key management service.
+	MakeArgKeyProvider func(Context) (argcrypt.KeyProvider, error)
 }
 
 type Hooks struct {
@@ -49,6 +56,7 @@ func Defaults() Context {
 	return Context{
 		Factories: Factories{
 			MakeRequestManagerClient: MakeRequestManagerClient,
+			MakeArgKeyProvider:       MakeArgKeyProvider,
 		},
 		Hooks: Hooks{
 			LoadConfig: LoadConfig,
@@ -105,3 +113,13 @@ func MakeRequestManagerClient(appCtx Context) (rm.Client, error) {
 	rmc := rm.NewClient(httpClient, cfg.RMClient.ServerURL)
 	return rmc, nil
 }
+
+// MakeArgKeyProvider is the default MakeArgKeyProvider factory. Job Runners only
+// decrypt, so config.ArgEncryption.CurrentKey is not used.
+func MakeArgKeyProvider(appCtx Context) (argcrypt.KeyProvider, error) {
+	cfg := appCtx.Config.ArgEncryption
+	if cfg.KeyFile == "" {
+		return nil, nil
+	}
+	return argcrypt.LoadKeyring(cfg.KeyFile, "")
+}
@@ -0,0 +1,181 @@
+// Copyright 2020, Square, Inc.
+
+// Package batch sends job logs to the Request Manager in batches, so a Job Runner
+// running wide job chains makes one call per batch instead of one call per job log.
+package batch
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager"
+	"github.com/square/spincycle/v2/retry"
+)
+
+const (
+	// Number of times to try sending a batch when the Request Manager is
+	// unreachable or returns a server error for the whole batch.
+	BATCH_TRIES = 3
+	// Time to wait between tries to send a batch.
+	BATCH_RETRY_WAIT = 200 * time.Millisecond
+)
+
+// Config configures a Client.
+type Config struct {
+	Size     uint          // max job logs per batch, sent when full
+	Interval time.Duration // max time a job log waits for a batch to fill
+}
+
+// pending is a job log waiting to be sent in a batch. The result of creating
+// it is sent on errChan.
+type pending struct {
+	jl      proto.JobLog
+	errChan chan error
+}
+
+// Client is an rm.Client that sends job logs (CreateJL) to the Request Manager in
+// batches (rm.Client.CreateJLBatch). A batch is sent when it has Config.Size job
+// logs or Config.Interval after its first job log, whichever is first. Other methods
+// call the Request Manager directly.
+//
+// CreateJL blocks until the job log's batch is sent and returns the error that
+// CreateJL would have returned for the job log alone, so callers retry and handle
+// errors as usual. The Request Manager creates job logs idempotently, so a batch
+// is sent again if the Request Manager is unreachable or fails the whole batch.
+// If the Request Manager is too old to create batches, job logs are sent one at
+// a time.
+type Client struct {
+	rm.Client
+	cfg Config
+
+	mux     *sync.Mutex // guards batch
+	batch   []pending
+	noBatch int32 // Request Manager can't create batches (atomic)
+}
+
+// NewClient returns a Client that sends job logs to the Request Manager using rmc.
+func NewClient(rmc rm.Client, cfg Config) *Client {
+	return &Client{
+		Client: rmc,
+		cfg:    cfg,
+		mux:    &sync.Mutex{},
+		batch:  []pending{},
+	}
+}
+
+func (c *Client) CreateJL(requestId string, jl proto.JobLog) error {
+	if atomic.LoadInt32(&c.noBatch) == 1 {
+		return c.Client.CreateJL(requestId, jl)
+	}
+	jl.RequestId = requestId // required in batches
+	p := pending{jl: jl, errChan: make(chan error, 1)}
+
+	c.mux.Lock()
+	c.batch = append(c.batch, p)
+	if len(c.batch) == 1 {
+		time.AfterFunc(c.cfg.Interval, c.Flush)
+	}
+	var full []pending
+	if uint(len(c.batch)) >= c.cfg.Size {
+		full = c.batch
+		c.batch = []pending{}
+	}
+	c.mux.Unlock()
+
+	// Send a full batch in this goroutine. Its Interval timer still fires,
+	// but it flushes only job logs added since, if any.
+	if full != nil {
+		c.send(full)
+	}
+	return <-p.errChan
+}
+
+// Flush sends the current batch, if any, without waiting for it to fill.
+func (c *Client) Flush() {
+	c.mux.Lock()
+	batch := c.batch
+	c.batch = []pending{}
+	c.mux.Unlock()
+	if len(batch) > 0 {
+		c.send(batch)
+	}
+}
+
+// send sends the batch and returns each job log's result on its errChan.
+func (c *Client) send(batch []pending) {
+	jls := make([]proto.JobLog, len(batch))
+	for i, p := range batch {
+		jls[i] = p.jl
+	}
+
+	var results []proto.JobLogResult
+	noBatch := false
+	err := retry.Do(BATCH_TRIES, BATCH_RETRY_WAIT,
+		func() error {
+			var err error
+			results, err = c.Client.CreateJLBatch(jls)
+			if err != nil && !retryable(err) {
+				noBatch = true
+				return nil // stop retrying, handled below
+			}
+			return err
+		},
+		func(err error) {
+			log.Warnf("error sending batch of %d job logs to Request Manager, retrying: %s", len(jls), err)
+		},
+	)
+	if noBatch {
+		// Request Manager older than POST /api/v1/job-logs (HTTP 404), so send
+		// job logs one at a time from now on
+		log.Warnf("Request Manager cannot create job log batches, sending job logs one at a time")
+		atomic.StoreInt32(&c.noBatch, 1)
+		for _, p := range batch {
+			p.errChan <- c.Client.CreateJL(p.jl.RequestId, p.jl)
+		}
+		return
+	}
+
+	for i, p := range batch {
+		switch {
+		case err != nil:
+			p.errChan <- err
+		case i >= len(results):
+			p.errChan <- fmt.Errorf("Request Manager returned %d results for %d job logs", len(results), len(batch))
+		default:
+			p.errChan <- resultError(results[i])
+		}
+	}
+}
+
+// resultError returns the error of one result in a batch like rm.Client.CreateJL
+// returns it: a proto.Error for HTTP 404 and 409, else an rm.APIError.
+func resultError(res proto.JobLogResult) error {
+	if res.Created {
+		return nil
+	}
+	if res.Error == nil {
+		return fmt.Errorf("job log not created, and Request Manager returned no error")
+	}
+	if res.Error.HTTPStatus == http.StatusNotFound || res.Error.HTTPStatus == http.StatusConflict {
+		return *res.Error
+	}
+	return rm.APIError{
+		HTTPStatus: res.Error.HTTPStatus,
+		Message:    fmt.Sprintf("API error: %s (HTTP status %d)", res.Error.Message, res.Error.HTTPStatus),
+	}
+}
+
+// retryable returns false if the error is a proto.Error, which the rm.Client
+// returns only for HTTP 404 and 409. For a batch, that's a Request Manager that
+// doesn't have the endpoint. All other errors might be transient.
+func retryable(err error) bool {
+	var perr proto.Error
+	return !errors.As(err, &perr)
+}
@@ -0,0 +1,237 @@
+// Copyright 2020, Square, Inc.
+
+package batch_test
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/job-runner/batch"
+	"github.com/square/spincycle/v2/proto"
+	rm "github.com/square/spincycle/v2/request-manager"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+// createJLs calls c.CreateJL for n job logs at once and returns their errors,
+// keyed on job ID.
+func createJLs(c *batch.Client, n int) map[string]error {
+	var mux sync.Mutex
+	var wg sync.WaitGroup
+	errs := map[string]error{}
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go func(jobId string) {
+			defer wg.Done()
+			err := c.CreateJL("req1", proto.JobLog{JobId: jobId, Try: 1})
+			mux.Lock()
+			errs[jobId] = err
+			mux.Unlock()
+		}(fmt.Sprintf("job%d", i))
+	}
+	wg.Wait()
+	return errs
+}
+
+func TestBatchSize(t *testing.T) {
+	// 10 job logs in batches of 5: sent when full, long before the interval
+	var mux sync.Mutex
+	batches := [][]string{}
+	rmc := &mock.RMClient{
+		CreateJLBatchFunc: func(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+			ids := []string{}
+			results := make([]proto.JobLogResult, len(jls))
+			for i, jl := range jls {
+				if jl.RequestId != "req1" {
+					t.Errorf("job log %s request ID = %s, expected req1", jl.JobId, jl.RequestId)
+				}
+				ids = append(ids, jl.JobId)
+				results[i] = proto.JobLogResult{Created: true}
+			}
+			mux.Lock()
+			batches = append(batches, ids)
+			mux.Unlock()
+			return results, nil
+		},
+		CreateJLFunc: func(string, proto.JobLog) error {
+			t.Errorf("CreateJL called, expected only CreateJLBatch")
+			return nil
+		},
+	}
+	c := batch.NewClient(rmc, batch.Config{Size: 5, Interval: time.Minute})
+
+	start := time.Now()
+	errs := createJLs(c, 10)
+	if d := time.Now().Sub(start); d > 5*time.Second {
+		t.Errorf("took %s, expected batches sent when full", d)
+	}
+	for jobId, err := range errs {
+		if err != nil {
+			t.Errorf("%s: got err '%s', expected nil", jobId, err)
+		}
+	}
+	if len(batches) != 2 {
+		t.Fatalf("got %d batches, expected 2: %v", len(batches), batches)
+	}
+	got := []string{}
+	for _, b := range batches {
+		if len(b) != 5 {
+			t.Errorf("batch has %d job logs, expected 5: %v", len(b), b)
+		}
+		got = append(got, b...)
+	}
+	if len(got) != 10 {
+		t.Errorf("got %d job logs, expected 10", len(got))
+	}
+}
+
+func TestBatchInterval(t *testing.T) {
+	// 3 job logs, batch size 100: sent after the interval
+	var mux sync.Mutex
+	batches := 0
+	rmc := &mock.RMClient{
+		CreateJLBatchFunc: func(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+			mux.Lock()
+			batches++
+			mux.Unlock()
+			results := make([]proto.JobLogResult, len(jls))
+			for i := range jls {
+				results[i] = proto.JobLogResult{Created: true}
+			}
+			return results, nil
+		},
+	}
+	c := batch.NewClient(rmc, batch.Config{Size: 100, Interval: 50 * time.Millisecond})
+
+	start := time.Now()
+	errs := createJLs(c, 3)
+	if d := time.Now().Sub(start); d < 50*time.Millisecond {
+		t.Errorf("took %s, expected at least the 50ms interval", d)
+	}
+	for jobId, err := range errs {
+		if err != nil {
+			t.Errorf("%s: got err '%s', expected nil", jobId, err)
+		}
+	}
+	if batches != 1 {
+		t.Errorf("got %d batches, expected 1", batches)
+	}
+}
+
+func TestBatchResultErrors(t *testing.T) {
+	// Each job log gets the error that CreateJL would have returned for it alone:
+	// proto.Error for 404 and 409, else rm.APIError
+	rmc := &mock.RMClient{
+		CreateJLBatchFunc: func(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+			results := make([]proto.JobLogResult, len(jls))
+			for i, jl := range jls {
+				switch jl.JobId {
+				case "job1":
+					results[i] = proto.JobLogResult{Created: true}
+				case "job2":
+					results[i] = proto.JobLogResult{Created: true, Duplicate: true}
+				case "job3":
+					results[i] = proto.JobLogResult{Error: &proto.Error{Message: "fenced", RequestId: "req1", HTTPStatus: http.StatusConflict}}
+				case "job4":
+					results[i] = proto.JobLogResult{Error: &proto.Error{Message: "db error", RequestId: "req1", HTTPStatus: http.StatusInternalServerError}}
+				}
+			}
+			return results, nil
+		},
+	}
+	c := batch.NewClient(rmc, batch.Config{Size: 4, Interval: time.Minute})
+
+	errs := createJLs(c, 4)
+	if errs["job1"] != nil || errs["job2"] != nil {
+		t.Errorf("job1 err = %v, job2 err = %v, expected nil", errs["job1"], errs["job2"])
+	}
+	if perr, ok := errs["job3"].(proto.Error); !ok || perr.Message != "fenced" {
+		t.Errorf("job3 err = %#v, expected proto.Error 'fenced'", errs["job3"])
+	}
+	if apiErr, ok := errs["job4"].(rm.APIError); !ok || apiErr.HTTPStatus != http.StatusInternalServerError {
+		t.Errorf("job4 err = %#v, expected rm.APIError with HTTP status 500", errs["job4"])
+	}
+}
+
+func TestBatchRetry(t *testing.T) {
+	// The RM is unreachable for the first try, so the batch is sent again
+	tries := 0
+	down := false
+	rmc := &mock.RMClient{
+		CreateJLBatchFunc: func(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+			tries++
+			if tries == 1 || down {
+				return nil, fmt.Errorf("dial tcp 127.0.0.1:32308: connect: connection refused")
+			}
+			results := make([]proto.JobLogResult, len(jls))
+			for i := range jls {
+				results[i] = proto.JobLogResult{Created: true}
+			}
+			return results, nil
+		},
+	}
+	c := batch.NewClient(rmc, batch.Config{Size: 2, Interval: time.Minute})
+
+	for jobId, err := range createJLs(c, 2) {
+		if err != nil {
+			t.Errorf("%s: got err '%s', expected nil", jobId, err)
+		}
+	}
+	if tries != 2 {
+		t.Errorf("%d tries, expected 2", tries)
+	}
+
+	// Unreachable for every try: every job log gets the error
+	tries = 0
+	down = true
+	for jobId, err := range createJLs(c, 2) {
+		if err == nil {
+			t.Errorf("%s: no error, expected one", jobId)
+		}
+	}
+	if tries != batch.BATCH_TRIES {
+		t.Errorf("%d tries, expected %d", tries, batch.BATCH_TRIES)
+	}
+}
+
+func TestBatchOldRM(t *testing.T) {
+	// RM older than POST /api/v1/job-logs: job logs are sent one at a time,
+	// then and from now on
+	batchCalls := 0
+	var mux sync.Mutex
+	got := []string{}
+	rmc := &mock.RMClient{
+		CreateJLBatchFunc: func(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+			batchCalls++
+			return nil, proto.Error{Message: "Not Found"}
+		},
+		CreateJLFunc: func(requestId string, jl proto.JobLog) error {
+			mux.Lock()
+			got = append(got, jl.JobId)
+			mux.Unlock()
+			return nil
+		},
+	}
+	c := batch.NewClient(rmc, batch.Config{Size: 2, Interval: time.Minute})
+
+	for jobId, err := range createJLs(c, 2) {
+		if err != nil {
+			t.Errorf("%s: got err '%s', expected nil", jobId, err)
+		}
+	}
+	if err := c.CreateJL("req1", proto.JobLog{JobId: "job3", Try: 1}); err != nil {
+		t.Errorf("job3: got err '%s', expected nil", err)
+	}
+	if batchCalls != 1 {
+		t.Errorf("CreateJLBatch called %d times, expected 1", batchCalls)
+	}
+	sort.Strings(got)
+	if diff := deep.Equal(got, []string{"job1", "job2", "job3"}); diff != nil {
+		t.Error(diff)
+	}
+}
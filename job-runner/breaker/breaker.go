@@ -0,0 +1,345 @@
+// Copyright 2020, Square, Inc.
+
+// Package breaker provides the job type circuit breaker of a Job Runner
+// (config.CircuitBreaker). When the failure rate of a job type exceeds a
+// threshold, its breaker opens for a cool-down period: new tries of jobs of that
+// type fail without running (ACTION_FAIL) or wait until it closes (ACTION_WAIT),
+// so a broken downstream API isn't hit thousands of times.
+//
+// Failure rates are counted over a sliding window. Each Job Runner counts the
+// tries it runs, and if it pushes its status to the Request Manager
+// (config.StatusPush), it sends its counts and gets the counts of all Job
+// Runners back (SetFleet), so a breaker opens on every Job Runner when a job type
+// fails fleet-wide.
+package breaker
+
+import (
+	"errors"
+	"expvar"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+const (
+	ACTION_FAIL = "fail" // fail tries without running the job
+	ACTION_WAIT = "wait" // wait to run tries until the breaker closes
+)
+
+// BUCKETS is the number of buckets in the sliding window of each job type.
+const BUCKETS = 10
+
+// ErrNotOpen is returned by Breaker.Close when the breaker of the job type is
+// not open.
+var ErrNotOpen = errors.New("circuit breaker is not open")
+
+// Circuit breaker metrics published as expvars (GET /debug/vars on the Job
+// Runner API). Each is a map keyed on job type.
+var (
+	// Opens counts how many times the breaker of the job type opened.
+	Opens = expvar.NewMap("circuit_breaker_opens")
+
+	// Open is 1 while the breaker of the job type is open, else 0.
+	Open = expvar.NewMap("circuit_breaker_open")
+
+	// ShortCircuits counts tries that failed without running, or waited,
+	// because the breaker of the job type was open. It's incremented by the
+	// runner.
+	ShortCircuits = expvar.NewMap("circuit_breaker_short_circuits")
+)
+
+// Config configures a Breaker. See config.CircuitBreaker.
+type Config struct {
+	FailureRate float64       // open when more than this fraction of tries failed
+	MinTries    uint          // tries in the window before the failure rate counts
+	Window      time.Duration // sliding window of tries
+	Cooldown    time.Duration // how long the breaker stays open
+	Action      string        // ACTION_* const
+}
+
+// Breaker is the circuit breaker of every job type. It's safe for concurrent use.
+type Breaker struct {
+	cfg     Config
+	width   time.Duration // of each bucket: Window / BUCKETS
+	types   map[string]*jobType
+	fleet   map[string]proto.JobTypeTries // tries of all Job Runners (SetFleet)
+	fleetAt time.Time                     // when fleet was set
+	closed  chan struct{}                 // closed (and replaced) when a breaker closes
+	mux     *sync.Mutex                   // guards all of the above
+}
+
+// jobType is the window and breaker state of one job type.
+type jobType struct {
+	buckets  []bucket           // oldest first
+	openedAt time.Time          // zero if closed
+	until    time.Time          // end of cool-down, zero if closed
+	opened   proto.JobTypeTries // tries when opened
+	fleet    bool               // opened on fleet tries
+	closedAt time.Time          // fleet tries are ignored for a window after closing
+}
+
+type bucket struct {
+	start  time.Time
+	tries  uint
+	failed uint
+}
+
+// New returns a Breaker with all job type breakers closed.
+func New(cfg Config) *Breaker {
+	width := cfg.Window / BUCKETS
+	if width <= 0 {
+		width = time.Millisecond
+	}
+	return &Breaker{
+		cfg:    cfg,
+		width:  width,
+		types:  map[string]*jobType{},
+		fleet:  map[string]proto.JobTypeTries{},
+		closed: make(chan struct{}),
+		mux:    &sync.Mutex{},
+	}
+}
+
+// Action returns the ACTION_* const that runners do while a breaker is open.
+func (b *Breaker) Action() string {
+	return b.cfg.Action
+}
+
+// Record counts one try of the job type that ran, and opens its breaker if the
+// failure rate is exceeded. Stopped tries should not be recorded.
+func (b *Breaker) Record(jobType string, failed bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	t := b.jobType(jobType)
+	if n := len(t.buckets); n > 0 && now.Sub(t.buckets[n-1].start) < b.width {
+		t.buckets[n-1].tries++
+		if failed {
+			t.buckets[n-1].failed++
+		}
+	} else {
+		bk := bucket{start: now, tries: 1}
+		if failed {
+			bk.failed = 1
+		}
+		t.buckets = append(t.buckets, bk)
+	}
+	b.check(jobType, t, now)
+}
+
+// Check returns the state of the breaker of the job type, and true if it's
+// open. A breaker closes when its cool-down ends.
+func (b *Breaker) Check(jobType string) (proto.CircuitBreaker, bool) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	t, ok := b.types[jobType]
+	if !ok {
+		return proto.CircuitBreaker{JobType: jobType}, false
+	}
+	b.check(jobType, t, now)
+	cb := b.state(jobType, t, now)
+	return cb, cb.Open
+}
+
+// Wait blocks until the breaker of the job type is closed, or until stop is
+// closed. It returns true if the breaker is closed, or false if stopped.
+func (b *Breaker) Wait(jobType string, stop <-chan struct{}) bool {
+	for {
+		cb, open := b.Check(jobType)
+		if !open {
+			return true
+		}
+		b.mux.Lock()
+		closed := b.closed
+		b.mux.Unlock()
+		timer := time.NewTimer(time.Until(cb.Until))
+		select {
+		case <-timer.C:
+		case <-closed:
+			timer.Stop()
+		case <-stop:
+			timer.Stop()
+			return false
+		}
+	}
+}
+
+// Close closes the open breaker of the job type before its cool-down ends, like
+// when an operator knows the downstream API is fixed. It returns ErrNotOpen if
+// the breaker is not open.
+func (b *Breaker) Close(jobType string) error {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	t, ok := b.types[jobType]
+	if !ok || t.openedAt.IsZero() {
+		return ErrNotOpen
+	}
+	log.Infof("Circuit breaker closed for job type %s (by Job Runner API)", jobType)
+	b.close(jobType, t, time.Now())
+	return nil
+}
+
+// Counts returns the tries of every job type in the window on this Job Runner.
+// It's pushed to the Request Manager (proto.JobRunnerStatus.JobTypes).
+func (b *Breaker) Counts() map[string]proto.JobTypeTries {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	counts := map[string]proto.JobTypeTries{}
+	for name, t := range b.types {
+		if c := b.local(t, now); c.Tries > 0 {
+			counts[name] = c
+		}
+	}
+	return counts
+}
+
+// SetFleet sets the tries of every job type in the window on all Job Runners,
+// as summed by the Request Manager (GET /api/v1/status/job-types), and opens the
+// breakers of job types with a fleet failure rate that's exceeded. Fleet tries
+// are used until they're older than the window.
+func (b *Breaker) SetFleet(fleet map[string]proto.JobTypeTries) {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	b.fleet = fleet
+	b.fleetAt = now
+	for name := range fleet {
+		b.check(name, b.jobType(name), now)
+	}
+}
+
+// List returns the state of the breakers of all job types that have tries in the
+// window or are open, sorted by job type.
+func (b *Breaker) List() []proto.CircuitBreaker {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	now := time.Now()
+	list := []proto.CircuitBreaker{}
+	for name, t := range b.types {
+		b.check(name, t, now)
+		cb := b.state(name, t, now)
+		if cb.Open || cb.Tries > 0 {
+			list = append(list, cb)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].JobType < list[j].JobType })
+	return list
+}
+
+// --------------------------------------------------------------------------
+
+// jobType returns the job type, adding it if new. The caller must lock b.mux.
+func (b *Breaker) jobType(name string) *jobType {
+	t, ok := b.types[name]
+	if !ok {
+		t = &jobType{}
+		b.types[name] = t
+	}
+	return t
+}
+
+// check closes the breaker if its cool-down ended, or opens it if the failure
+// rate is exceeded. The caller must lock b.mux.
+func (b *Breaker) check(name string, t *jobType, now time.Time) {
+	if !t.openedAt.IsZero() {
+		if !now.Before(t.until) {
+			log.Infof("Circuit breaker closed for job type %s (cool-down ended)", name)
+			b.close(name, t, now)
+		}
+		return
+	}
+	c, fleet := b.tries(name, t, now)
+	if c.Tries == 0 || c.Tries < b.cfg.MinTries || float64(c.Failed)/float64(c.Tries) <= b.cfg.FailureRate {
+		return
+	}
+	t.openedAt = now
+	t.until = now.Add(b.cfg.Cooldown)
+	t.opened = c
+	t.fleet = fleet
+	Opens.Add(name, 1)
+	Open.Set(name, gauge(1))
+	log.Warnf("Circuit breaker open for job type %s until %s: %d of %d tries failed in the last %s (max failure rate %.2f): action %s",
+		name, t.until.Format(time.RFC3339), c.Failed, c.Tries, b.cfg.Window, b.cfg.FailureRate, b.cfg.Action)
+}
+
+// close closes the breaker and resets its window, so it takes new failures to
+// open it again. The caller must lock b.mux.
+func (b *Breaker) close(name string, t *jobType, now time.Time) {
+	t.openedAt = time.Time{}
+	t.until = time.Time{}
+	t.opened = proto.JobTypeTries{}
+	t.fleet = false
+	t.buckets = nil
+	t.closedAt = now
+	Open.Set(name, gauge(0))
+	close(b.closed)
+	b.closed = make(chan struct{})
+}
+
+// tries returns the tries of the job type in the window: fleet tries if they're
+// current and more than the local tries (which they include, as of the last
+// push), else local tries. It returns true if they're fleet tries. The caller
+// must lock b.mux.
+func (b *Breaker) tries(name string, t *jobType, now time.Time) (proto.JobTypeTries, bool) {
+	c := b.local(t, now)
+	if now.Sub(b.fleetAt) > b.cfg.Window || now.Sub(t.closedAt) < b.cfg.Window {
+		return c, false
+	}
+	if f, ok := b.fleet[name]; ok && f.Tries > c.Tries {
+		return f, true
+	}
+	return c, false
+}
+
+// local returns the tries of the job type in the window on this Job Runner,
+// dropping older buckets. The caller must lock b.mux.
+func (b *Breaker) local(t *jobType, now time.Time) proto.JobTypeTries {
+	start := now.Add(-b.cfg.Window)
+	n := 0
+	for n < len(t.buckets) && t.buckets[n].start.Before(start) {
+		n++
+	}
+	t.buckets = t.buckets[n:]
+	var c proto.JobTypeTries
+	for _, bk := range t.buckets {
+		c.Tries += bk.tries
+		c.Failed += bk.failed
+	}
+	return c
+}
+
+// state returns the state of the breaker. The caller must lock b.mux.
+func (b *Breaker) state(name string, t *jobType, now time.Time) proto.CircuitBreaker {
+	c, fleet := b.tries(name, t, now)
+	cb := proto.CircuitBreaker{
+		JobType: name,
+		Tries:   c.Tries,
+		Failed:  c.Failed,
+		Fleet:   fleet,
+	}
+	if !t.openedAt.IsZero() {
+		cb.Open = true
+		cb.OpenedAt = t.openedAt.UTC()
+		cb.Until = t.until.UTC()
+		cb.Tries = t.opened.Tries
+		cb.Failed = t.opened.Failed
+		cb.Fleet = t.fleet
+	}
+	if cb.Tries > 0 {
+		cb.FailureRate = float64(cb.Failed) / float64(cb.Tries)
+	}
+	return cb
+}
+
+// gauge returns an expvar.Int set to v, for Open.
+func gauge(v int64) *expvar.Int {
+	i := new(expvar.Int)
+	i.Set(v)
+	return i
+}
@@ -0,0 +1,173 @@
+// Copyright 2020, Square, Inc.
+
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/job-runner/breaker"
+	"github.com/square/spincycle/v2/proto"
+)
+
+func TestBreakerOpenClose(t *testing.T) {
+	b := breaker.New(breaker.Config{
+		FailureRate: 0.5,
+		MinTries:    4,
+		Window:      time.Minute,
+		Cooldown:    50 * time.Millisecond,
+		Action:      breaker.ACTION_FAIL,
+	})
+
+	// Failure rate exceeded but not enough tries yet
+	b.Record("a", true)
+	b.Record("a", true)
+	b.Record("a", true)
+	if _, open := b.Check("a"); open {
+		t.Fatal("open after 3 tries, expected closed (MinTries 4)")
+	}
+
+	// 3 of 4 failed > 0.5: opens
+	b.Record("a", false)
+	cb, open := b.Check("a")
+	if !open {
+		t.Fatal("closed, expected open")
+	}
+	if cb.Tries != 4 || cb.Failed != 3 || cb.FailureRate != 0.75 || cb.Fleet {
+		t.Errorf("got %+v, expected 3 of 4 tries failed, not fleet", cb)
+	}
+	if _, open := b.Check("b"); open {
+		t.Error("job type b open, expected closed")
+	}
+
+	// Closes when cool-down ends, and the window is reset
+	time.Sleep(60 * time.Millisecond)
+	cb, open = b.Check("a")
+	if open {
+		t.Fatal("open after cool-down, expected closed")
+	}
+	if cb.Tries != 0 {
+		t.Errorf("got %d tries after closing, expected 0", cb.Tries)
+	}
+
+	// Operator can close it early
+	for i := 0; i < 4; i++ {
+		b.Record("a", true)
+	}
+	if _, open := b.Check("a"); !open {
+		t.Fatal("closed, expected open")
+	}
+	if err := b.Close("a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, open := b.Check("a"); open {
+		t.Error("open after Close, expected closed")
+	}
+	if err := b.Close("a"); err != breaker.ErrNotOpen {
+		t.Errorf("got err %v, expected ErrNotOpen", err)
+	}
+}
+
+func TestBreakerRateNotExceeded(t *testing.T) {
+	b := breaker.New(breaker.Config{
+		FailureRate: 0.5,
+		MinTries:    2,
+		Window:      time.Minute,
+		Cooldown:    time.Minute,
+		Action:      breaker.ACTION_FAIL,
+	})
+	b.Record("a", true)
+	b.Record("a", false)
+	if _, open := b.Check("a"); open {
+		t.Error("open at failure rate 0.5, expected closed (must exceed rate)")
+	}
+	counts := b.Counts()
+	if c := counts["a"]; c.Tries != 2 || c.Failed != 1 {
+		t.Errorf("got counts %+v, expected 1 of 2 tries failed", c)
+	}
+}
+
+func TestBreakerFleet(t *testing.T) {
+	b := breaker.New(breaker.Config{
+		FailureRate: 0.5,
+		MinTries:    10,
+		Window:      time.Minute,
+		Cooldown:    time.Minute,
+		Action:      breaker.ACTION_FAIL,
+	})
+
+	// Only 1 try on this JR, but 20 of 30 failed on all JRs
+	b.Record("a", true)
+	b.SetFleet(map[string]proto.JobTypeTries{"a": {Tries: 30, Failed: 20}})
+	cb, open := b.Check("a")
+	if !open {
+		t.Fatal("closed, expected open on fleet tries")
+	}
+	if !cb.Fleet || cb.Tries != 30 || cb.Failed != 20 {
+		t.Errorf("got %+v, expected 20 of 30 fleet tries failed", cb)
+	}
+	list := b.List()
+	if len(list) != 1 || list[0].JobType != "a" || !list[0].Open {
+		t.Errorf("got list %+v, expected open breaker for job type a", list)
+	}
+
+	// Fleet tries are ignored for a window after closing, else the breaker
+	// would reopen on the same stale tries
+	if err := b.Close("a"); err != nil {
+		t.Fatal(err)
+	}
+	b.SetFleet(map[string]proto.JobTypeTries{"a": {Tries: 30, Failed: 20}})
+	if _, open := b.Check("a"); open {
+		t.Error("open after Close, expected closed (fleet tries ignored)")
+	}
+}
+
+func TestBreakerWait(t *testing.T) {
+	b := breaker.New(breaker.Config{
+		FailureRate: 0.1,
+		MinTries:    1,
+		Window:      time.Minute,
+		Cooldown:    time.Minute,
+		Action:      breaker.ACTION_WAIT,
+	})
+
+	// Not open: returns immediately
+	if !b.Wait("a", nil) {
+		t.Error("Wait returned false, expected true (not open)")
+	}
+
+	// Open: returns when closed
+	b.Record("a", true)
+	doneChan := make(chan bool)
+	go func() { doneChan <- b.Wait("a", nil) }()
+	select {
+	case <-doneChan:
+		t.Fatal("Wait returned while open")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := b.Close("a"); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case closed := <-doneChan:
+		if !closed {
+			t.Error("Wait returned false, expected true (closed)")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after Close")
+	}
+
+	// Open: returns false when stopped
+	b.Record("a", true)
+	stopChan := make(chan struct{})
+	go func() { doneChan <- b.Wait("a", stopChan) }()
+	close(stopChan)
+	select {
+	case closed := <-doneChan:
+		if closed {
+			t.Error("Wait returned true, expected false (stopped)")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after stop")
+	}
+}
@@ -7,7 +7,9 @@ package chain
 import (
 	"fmt"
 	"sync"
+	"time"
 
+	"github.com/square/spincycle/v2/job"
 	"github.com/square/spincycle/v2/proto"
 )
 
@@ -22,6 +24,15 @@ type Chain struct {
 	sequenceTries     map[string]uint // Number of sequence retries attempted so far
 	latestRunJobTries map[string]uint // job.Id -> number of times tried for current sequence try
 	totalJobTries     map[string]uint // job.Id -> total number of times tried
+	jobRetries        uint            // job retries in the whole chain, counted against the retry budget
+	sequenceRetries   uint            // sequence retries in the whole chain, counted against the retry budget
+
+	scratch *scratch // job.Scratch shared by all jobs
+
+	delayMux        *sync.Mutex   // for access to queue delay stats
+	queueDelayJobs  uint          // jobs started on this JR
+	queueDelayTotal time.Duration // sum of their queue delays
+	queueDelayMax   time.Duration // longest queue delay
 }
 
 // NewChain takes a JobChain proto and maps of sequence + jobs tries, and turns them
@@ -40,6 +51,8 @@ func NewChain(jc *proto.JobChain, sequenceTries map[string]uint, totalJobTries m
 		triesMux:          &sync.RWMutex{},
 		totalJobTries:     totalJobTries,
 		latestRunJobTries: latestRunJobTries,
+		scratch:           newScratch(nil),
+		delayMux:          &sync.Mutex{},
 	}
 }
 
@@ -130,6 +143,9 @@ func (c *Chain) IsDoneRunning() (done bool, complete bool) {
 				return false, false
 			}
 			// Failed but no seq retry means the chain has failed
+		case proto.STATE_DEADLINE_EXCEEDED:
+			// Not run or retried because the request deadline passed; it won't
+			// run again, so the chain is done but not complete
 		default:
 			panic("IsDoneRunning: invalid job state: " + proto.StateName[job.State])
 		}
@@ -157,6 +173,64 @@ func (c *Chain) FailedJobs() uint {
 	return n
 }
 
+// Deadline returns the request deadline, or zero if the request doesn't have one.
+func (c *Chain) Deadline() time.Time {
+	if c.jobChain.Deadline == nil {
+		return time.Time{}
+	}
+	return *c.jobChain.Deadline
+}
+
+// DeadlineExceeded returns true if the request deadline has passed, or if a job
+// was not run or retried because of it. Reapers use this to finalize a chain that
+// did not complete as STATE_DEADLINE_EXCEEDED instead of STATE_FAIL.
+func (c *Chain) DeadlineExceeded() bool {
+	if c.jobChain.Deadline == nil {
+		return false
+	}
+	if time.Now().After(*c.jobChain.Deadline) {
+		return true
+	}
+	c.jobsMux.RLock()
+	defer c.jobsMux.RUnlock()
+	for _, job := range c.jobChain.Jobs {
+		if job.State == proto.STATE_DEADLINE_EXCEEDED {
+			return true
+		}
+	}
+	return false
+}
+
+// RunAfterFailJobs returns the RunAfterFail jobs after the failed job that are
+// runnable now that it failed. Jobs between the failed job and a RunAfterFail
+// job are not runnable because the failed job did not complete.
+func (c *Chain) RunAfterFailJobs(failedJobId string) proto.Jobs {
+	c.jobsMux.RLock()
+	defer c.jobsMux.RUnlock()
+	var runnable proto.Jobs
+	seen := map[string]bool{}
+	next := c.jobChain.AdjacencyList[failedJobId]
+	for len(next) > 0 {
+		jobId := next[0]
+		next = next[1:]
+		if seen[jobId] {
+			continue
+		}
+		seen[jobId] = true
+		job := c.jobChain.Jobs[jobId]
+		if job.RunAfterFail {
+			if c.isRunnable(jobId) {
+				runnable = append(runnable, job)
+			}
+			continue
+		}
+		if job.State == proto.STATE_PENDING {
+			next = append(next, c.jobChain.AdjacencyList[jobId]...)
+		}
+	}
+	return runnable
+}
+
 func (c *Chain) SequenceStartJob(jobId string) proto.Job {
 	c.jobsMux.RLock()
 	defer c.jobsMux.RUnlock()
@@ -169,11 +243,13 @@ func (c *Chain) IsSequenceStartJob(jobId string) bool {
 	return jobId == c.jobChain.Jobs[jobId].SequenceId
 }
 
+// CanRetrySequence returns true if the sequence of the job has tries left and the
+// chain retry budget has sequence retries left.
 func (c *Chain) CanRetrySequence(jobId string) bool {
 	sequenceStartJob := c.SequenceStartJob(jobId)
 	c.triesMux.RLock()
 	defer c.triesMux.RUnlock()
-	return c.sequenceTries[sequenceStartJob.Id] <= sequenceStartJob.SequenceRetry
+	return c.sequenceTries[sequenceStartJob.Id] <= sequenceStartJob.SequenceRetry && c.sequenceRetriesLeft()
 }
 
 func (c *Chain) IncrementJobTries(jobId string, delta int) {
@@ -238,11 +314,69 @@ func (c *Chain) FinishedJobs() uint {
 	return c.jobChain.FinishedJobs
 }
 
+// AddQueueDelay adds the queue delay of a job that started: how long it was
+// runnable before its first try started.
+func (c *Chain) AddQueueDelay(d time.Duration) {
+	c.delayMux.Lock()
+	defer c.delayMux.Unlock()
+	c.queueDelayJobs++
+	c.queueDelayTotal += d
+	if d > c.queueDelayMax {
+		c.queueDelayMax = d
+	}
+}
+
+// QueueDelay returns the number of jobs that started while the chain ran on this
+// Job Runner, and the total and longest of their queue delays. It's not saved
+// when the chain is suspended, so it's only for the current run of the chain.
+func (c *Chain) QueueDelay() (jobs uint, total, max time.Duration) {
+	c.delayMux.Lock()
+	defer c.delayMux.Unlock()
+	return c.queueDelayJobs, c.queueDelayTotal, c.queueDelayMax
+}
+
+// UseJobRetry counts one job retry and returns true if the chain retry budget
+// has job retries left, else it returns false. It implements runner.RetryBudget.
+func (c *Chain) UseJobRetry() bool {
+	c.triesMux.Lock()
+	defer c.triesMux.Unlock()
+	if rb := c.jobChain.RetryBudget; rb != nil && rb.JobRetries > 0 && c.jobRetries >= rb.JobRetries {
+		return false
+	}
+	c.jobRetries++
+	return true
+}
+
+// AddSequenceRetry counts one sequence retry. The caller must check
+// CanRetrySequence first.
+func (c *Chain) AddSequenceRetry() {
+	c.triesMux.Lock()
+	c.sequenceRetries++
+	c.triesMux.Unlock()
+}
+
+// SequenceRetriesLeft returns false if the chain retry budget has no sequence
+// retries left. It's always true if the chain has no retry budget.
+func (c *Chain) SequenceRetriesLeft() bool {
+	c.triesMux.RLock()
+	defer c.triesMux.RUnlock()
+	return c.sequenceRetriesLeft()
+}
+
+// Retries returns the number of job retries and sequence retries in the chain.
+func (c *Chain) Retries() (jobRetries, sequenceRetries uint) {
+	c.triesMux.RLock()
+	defer c.triesMux.RUnlock()
+	return c.jobRetries, c.sequenceRetries
+}
+
 func (c *Chain) ToSuspended() proto.SuspendedJobChain {
 	c.triesMux.RLock()
 	seqTries := c.sequenceTries
 	totalJobTries := c.totalJobTries
 	latestTries := c.latestRunJobTries
+	jobRetries := c.jobRetries
+	sequenceRetries := c.sequenceRetries
 	c.triesMux.RUnlock()
 
 	sjc := proto.SuspendedJobChain{
@@ -251,15 +385,46 @@ func (c *Chain) ToSuspended() proto.SuspendedJobChain {
 		TotalJobTries:     totalJobTries,
 		LatestRunJobTries: latestTries,
 		SequenceTries:     seqTries,
+		Scratch:           c.scratch.copy(),
+		JobRetries:        jobRetries,
+		SequenceRetries:   sequenceRetries,
 	}
 	return sjc
 }
 
+// Scratch returns the job chain scratch store shared by all jobs.
+func (c *Chain) Scratch() job.Scratch {
+	return c.scratch
+}
+
 // RequestId returns the request id of the job chain.
 func (c *Chain) RequestId() string {
 	return c.jobChain.RequestId
 }
 
+// CorrelationId returns the correlation ID of the request, if any
+// (proto.CreateRequest.CorrelationId).
+func (c *Chain) CorrelationId() string {
+	return c.jobChain.CorrelationId
+}
+
+// FenceToken returns the fencing token issued by the Request Manager when it sent
+// the job chain (proto.JobChain.FenceToken), or zero if none.
+func (c *Chain) FenceToken() uint64 {
+	return c.jobChain.FenceToken
+}
+
+// StopTimeout returns the request spec stop timeout (duration string), if any.
+func (c *Chain) StopTimeout() string {
+	return c.jobChain.StopTimeout
+}
+
+// RequestType returns the request type of the job chain. It's empty for job
+// chains created before the request type was set by the Request Manager.
+func (c *Chain) RequestType() string {
+	return c.jobChain.RequestType
+}
+
 // JobState returns the state of a given job.
 func (c *Chain) JobState(jobId string) byte {
 	c.jobsMux.RLock()
@@ -289,7 +454,8 @@ func (c *Chain) SetJobState(jobId string, state byte) {
 // -------------------------------------------------------------------------- //
 
 // isRunnable returns true if the job is runnable. A job is runnable iff its
-// state is PENDING and all immediately previous jobs are state COMPLETE.
+// state is PENDING and all immediately previous jobs are state COMPLETE, or
+// done (see isDone) if the job has RunAfterFail.
 func (c *Chain) isRunnable(jobId string) bool {
 	// CALLER MUST LOCK c.jobsMux!
 	job := c.jobChain.Jobs[jobId]
@@ -297,21 +463,71 @@ func (c *Chain) isRunnable(jobId string) bool {
 		return false
 	}
 	// Check that all previous jobs are complete.
-	for _, job := range c.previousJobs(jobId) {
-		if job.State != proto.STATE_COMPLETE {
+	var done map[string]bool
+	for _, prev := range c.previousJobs(jobId) {
+		if prev.State == proto.STATE_COMPLETE {
+			continue
+		}
+		if !job.RunAfterFail {
+			return false
+		}
+		if done == nil {
+			done = map[string]bool{}
+		}
+		if !c.isDone(prev.Id, done) {
 			return false
 		}
 	}
 	return true
 }
 
+// isDone returns true if the job will not run (again) in the current chain run:
+// it's COMPLETE, FAIL and its sequence cannot be retried, or PENDING but not
+// runnable because all previous jobs are done and at least one did not complete.
+// Results are saved in done because jobs can share previous jobs.
+func (c *Chain) isDone(jobId string, done map[string]bool) bool {
+	// CALLER MUST LOCK c.jobsMux!
+	if d, ok := done[jobId]; ok {
+		return d
+	}
+	var d bool
+	switch c.jobChain.Jobs[jobId].State {
+	case proto.STATE_COMPLETE:
+		d = true
+	case proto.STATE_FAIL:
+		d = !c.canRetrySequence(jobId)
+	case proto.STATE_DEADLINE_EXCEEDED:
+		d = true
+	case proto.STATE_PENDING:
+		if !c.isRunnable(jobId) {
+			d = true
+			for _, prev := range c.previousJobs(jobId) {
+				if !c.isDone(prev.Id, done) {
+					d = false
+					break
+				}
+			}
+		}
+	}
+	// Running and stopped jobs are not done
+	done[jobId] = d
+	return d
+}
+
 // Just like CanRetrySequence but without read locking jobsMux. Used within methods
 // that already read lock the jobsMux to avoid nested read locks.
 func (c *Chain) canRetrySequence(jobId string) bool {
 	sequenceStartJob := c.sequenceStartJob(jobId)
 	c.triesMux.RLock()
 	defer c.triesMux.RUnlock()
-	return c.sequenceTries[sequenceStartJob.Id] <= sequenceStartJob.SequenceRetry
+	return c.sequenceTries[sequenceStartJob.Id] <= sequenceStartJob.SequenceRetry && c.sequenceRetriesLeft()
+}
+
+// sequenceRetriesLeft returns false if the chain retry budget has no sequence
+// retries left. Caller must lock c.triesMux.
+func (c *Chain) sequenceRetriesLeft() bool {
+	rb := c.jobChain.RetryBudget
+	return rb == nil || rb.SequenceRetries == 0 || c.sequenceRetries < rb.SequenceRetries
 }
 
 // Just like SequenceStartJob but without read locking jobsMux. Used within methods
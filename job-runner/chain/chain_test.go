@@ -6,6 +6,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/square/spincycle/v2/proto"
 	testutil "github.com/square/spincycle/v2/test"
@@ -248,6 +249,77 @@ func TestIsRunnable(t *testing.T) {
 	}
 }
 
+func TestRunAfterFail(t *testing.T) {
+	// Sequential each: with continueOnFail: job1-3 is expansion 1 and job4-6 is
+	// expansion 2, which runs after expansion 1 even if it fails. job7 is the
+	// end of the each: node which runs only if both expansions complete.
+	jobs := testutil.InitJobs(7)
+	job4 := jobs["job4"]
+	job4.RunAfterFail = true
+	jobs["job4"] = job4
+	jc := &proto.JobChain{
+		Jobs: jobs,
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+			"job3": {"job4", "job7"},
+			"job4": {"job5"},
+			"job5": {"job6"},
+			"job6": {"job7"},
+		},
+	}
+	c := NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	c.IncrementSequenceTries("job1", 1)
+	c.SetJobState("job1", proto.STATE_COMPLETE)
+	c.SetJobState("job2", proto.STATE_FAIL) // can't retry seq
+
+	if !c.IsRunnable("job4") {
+		t.Errorf("job4 not runnable, expected it to be runnable after job2 failed")
+	}
+	if c.IsRunnable("job3") {
+		t.Errorf("job3 runnable, expected it NOT to be runnable after job2 failed")
+	}
+	got := c.RunAfterFailJobs("job2")
+	if len(got) != 1 || got[0].Id != "job4" {
+		t.Errorf("RunAfterFailJobs = %v, expected [job4]", got)
+	}
+	done, complete := c.IsDoneRunning()
+	if done || complete {
+		t.Errorf("done = %t, complete = %t, want false and false", done, complete)
+	}
+
+	// Expansion 2 completes but job7 doesn't run because expansion 1 failed
+	c.SetJobState("job4", proto.STATE_COMPLETE)
+	c.SetJobState("job5", proto.STATE_COMPLETE)
+	c.SetJobState("job6", proto.STATE_COMPLETE)
+	if c.IsRunnable("job7") {
+		t.Errorf("job7 runnable, expected it NOT to be runnable after job2 failed")
+	}
+	done, complete = c.IsDoneRunning()
+	if !done || complete {
+		t.Errorf("done = %t, complete = %t, want true and false", done, complete)
+	}
+
+	// If the sequence can be retried, the failed job isn't done, so job4 waits
+	jc = &proto.JobChain{
+		Jobs:          testutil.InitJobsWithSequenceRetry(7, 1),
+		AdjacencyList: jc.AdjacencyList,
+	}
+	job4 = jc.Jobs["job4"]
+	job4.RunAfterFail = true
+	jc.Jobs["job4"] = job4
+	c = NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	c.IncrementSequenceTries("job1", 1)
+	c.SetJobState("job1", proto.STATE_COMPLETE)
+	c.SetJobState("job2", proto.STATE_FAIL) // can retry seq
+	if c.IsRunnable("job4") {
+		t.Errorf("job4 runnable, expected it NOT to be runnable until job2 sequence retry")
+	}
+	if got := c.RunAfterFailJobs("job2"); len(got) != 0 {
+		t.Errorf("RunAfterFailJobs = %v, expected none", got)
+	}
+}
+
 func TestIsDoneRunning(t *testing.T) {
 	// A chain is not done (and not complete) if any job is running
 	jc := &proto.JobChain{
@@ -727,3 +799,128 @@ func TestIsDoneRetryableSequenceTrue(t *testing.T) {
 		t.Errorf("done = %v, expected %v. complete = %v, expected %v.", actualDone, expectDone, actualComplete, expectComplete)
 	}
 }
+
+func TestScratch(t *testing.T) {
+	jc := &proto.JobChain{
+		RequestId: "req1",
+		Jobs:      testutil.InitJobs(2),
+	}
+	c := NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+
+	// New chain has empty scratch store, which isn't saved in the SJC
+	s := c.Scratch()
+	if keys := s.Keys(); len(keys) != 0 {
+		t.Errorf("got keys %v, expected none", keys)
+	}
+	if sjc := c.ToSuspended(); sjc.Scratch != nil {
+		t.Errorf("SJC scratch = %v, expected nil", sjc.Scratch)
+	}
+
+	// Values are copied in and out
+	v := []byte("v1")
+	s.Set("k1", v)
+	v[0] = 'x'
+	got, ok := s.Get("k1")
+	if !ok || string(got) != "v1" {
+		t.Errorf("got %s, %t, expected v1, true", got, ok)
+	}
+	got[0] = 'x'
+	got, _ = s.Get("k1")
+	if string(got) != "v1" {
+		t.Errorf("got %s, expected v1", got)
+	}
+
+	s.Set("k2", []byte("v2"))
+	s.Set("k3", []byte("v3"))
+	s.Delete("k3")
+	s.Delete("k4")
+	if keys := s.Keys(); !reflect.DeepEqual(keys, []string{"k1", "k2"}) {
+		t.Errorf("got keys %v, expected [k1 k2]", keys)
+	}
+	_, ok = s.Get("k3")
+	if ok {
+		t.Errorf("k3 is set, expected it to be deleted")
+	}
+
+	// Scratch store is saved in the SJC
+	expect := map[string][]byte{
+		"k1": []byte("v1"),
+		"k2": []byte("v2"),
+	}
+	sjc := c.ToSuspended()
+	if !reflect.DeepEqual(sjc.Scratch, expect) {
+		t.Errorf("SJC scratch = %v, expected %v", sjc.Scratch, expect)
+	}
+}
+
+func TestQueueDelay(t *testing.T) {
+	c := NewChain(&proto.JobChain{}, map[string]uint{}, map[string]uint{}, map[string]uint{})
+	if jobs, total, max := c.QueueDelay(); jobs != 0 || total != 0 || max != 0 {
+		t.Errorf("got %d, %s, %s, expected 0, 0s, 0s", jobs, total, max)
+	}
+	c.AddQueueDelay(2 * time.Second)
+	c.AddQueueDelay(5 * time.Second)
+	c.AddQueueDelay(1 * time.Second)
+	jobs, total, max := c.QueueDelay()
+	if jobs != 3 || total != 8*time.Second || max != 5*time.Second {
+		t.Errorf("got %d, %s, %s, expected 3, 8s, 5s", jobs, total, max)
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	jobs := testutil.InitJobsWithSequenceRetry(4, 2)
+	jc := &proto.JobChain{
+		Jobs: jobs,
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+			"job3": {"job4"},
+		},
+		RetryBudget: &proto.RetryBudget{JobRetries: 2, SequenceRetries: 1},
+	}
+	c := NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+
+	// 2 job retries, then no more
+	for i := 1; i <= 2; i++ {
+		if !c.UseJobRetry() {
+			t.Errorf("UseJobRetry = false on retry %d, expected true", i)
+		}
+	}
+	if c.UseJobRetry() {
+		t.Error("UseJobRetry = true after budget used up, expected false")
+	}
+
+	// The sequence allows 2 retries, but the budget allows only 1
+	c.IncrementSequenceTries("job2", 1)
+	if !c.CanRetrySequence("job2") {
+		t.Error("can retry sequence = false, expected true")
+	}
+	c.AddSequenceRetry()
+	c.IncrementSequenceTries("job2", 1)
+	if c.CanRetrySequence("job2") {
+		t.Error("can retry sequence = true after budget used up, expected false")
+	}
+	if c.SequenceRetriesLeft() {
+		t.Error("sequence retries left = true, expected false")
+	}
+
+	// The counts are saved in the suspended job chain
+	if jobRetries, seqRetries := c.Retries(); jobRetries != 2 || seqRetries != 1 {
+		t.Errorf("retries = %d, %d, expected 2, 1", jobRetries, seqRetries)
+	}
+	sjc := c.ToSuspended()
+	if sjc.JobRetries != 2 || sjc.SequenceRetries != 1 {
+		t.Errorf("suspended job chain retries = %d, %d, expected 2, 1", sjc.JobRetries, sjc.SequenceRetries)
+	}
+
+	// No budget: retries are counted but not limited
+	c = NewChain(&proto.JobChain{Jobs: jobs}, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	for i := 1; i <= 5; i++ {
+		if !c.UseJobRetry() {
+			t.Errorf("UseJobRetry = false on retry %d without budget, expected true", i)
+		}
+	}
+	if jobRetries, _ := c.Retries(); jobRetries != 5 {
+		t.Errorf("job retries = %d, expected 5", jobRetries)
+	}
+}
@@ -79,6 +79,7 @@ type ChainReaperFactory struct {
 	ChainRepo    Repo
 	Logger       *log.Entry
 	RMClient     rm.Client
+	JRURL        string         // this Job Runner, sent with the final state
 	RMCTries     int            // times to try sending info to RM
 	RMCRetryWait time.Duration  // time to wait between tries to send info to RM
 	DoneJobChan  chan proto.Job // chan jobs are reaped from
@@ -92,6 +93,7 @@ func (f *ChainReaperFactory) MakeRunning() JobReaper {
 		reaper: reaper{
 			chain:             f.Chain,
 			rmc:               f.RMClient,
+			jrURL:             f.JRURL,
 			logger:            f.Logger,
 			finalizeTries:     f.RMCTries,
 			finalizeRetryWait: f.RMCRetryWait,
@@ -110,6 +112,7 @@ func (f *ChainReaperFactory) MakeSuspended() JobReaper {
 		reaper: reaper{
 			chain:             f.Chain,
 			rmc:               f.RMClient,
+			jrURL:             f.JRURL,
 			logger:            f.Logger,
 			finalizeTries:     f.RMCTries,
 			finalizeRetryWait: f.RMCRetryWait,
@@ -128,6 +131,7 @@ func (f *ChainReaperFactory) MakeStopped() JobReaper {
 		reaper: reaper{
 			chain:             f.Chain,
 			rmc:               f.RMClient,
+			jrURL:             f.JRURL,
 			logger:            f.Logger,
 			finalizeTries:     f.RMCTries,
 			finalizeRetryWait: f.RMCRetryWait,
@@ -232,11 +236,25 @@ func (r *RunningChainReaper) Reap(job proto.Job) {
 		}
 	case proto.STATE_STOPPED:
 		jLogger.Infof("job stopped")
+	case proto.STATE_DEADLINE_EXCEEDED:
+		// Not run or retried because the request deadline passed, so don't
+		// retry its sequence, either
+		jLogger.Warn("request deadline exceeded")
 	default:
 		// Job was NOT successful. The job.Runner already did job retries.
 		// Retry sequence if possible.
 		if !r.chain.CanRetrySequence(job.Id) {
-			jLogger.Warn("job failed, no sequence tries left")
+			if !r.chain.SequenceRetriesLeft() {
+				jLogger.Warn("job failed, chain retry budget has no sequence retries left")
+			} else {
+				jLogger.Warn("job failed, no sequence tries left")
+			}
+			// Run jobs that run after a fail, i.e. remaining expansions of
+			// a sequential each: node with continueOnFail
+			for _, nextJob := range r.chain.RunAfterFailJobs(job.Id) {
+				jLogger.WithFields(log.Fields{"next_job_id": nextJob.Id}).Infof("enqueueing next job (run after fail)")
+				r.runJobChan <- nextJob
+			}
 			return
 		}
 		jLogger.Warn("job failed, retrying sequence")
@@ -251,6 +269,9 @@ func (r *RunningChainReaper) Finalize(complete bool) {
 	if complete {
 		r.logger.Infof("job chain complete")
 		r.chain.SetState(proto.STATE_COMPLETE)
+	} else if r.chain.DeadlineExceeded() {
+		r.logger.Warn("job chain deadline exceeded")
+		r.chain.SetState(proto.STATE_DEADLINE_EXCEEDED)
 	} else {
 		r.logger.Warn("job chain failed")
 		r.chain.SetState(proto.STATE_FAIL)
@@ -283,12 +304,16 @@ func (r *SuspendedChainReaper) Run() {
 	// any running jobs left.
 	time.Sleep(runnerRepoWait)
 
-	// If there are already no jobs left to reap, the running reaper must have
-	// finished and finalized the chain before it got switched out for this reaper.
-	// There's nothing left to do, so return right away.
+	// If there are already no jobs left to reap and the chain is done running,
+	// the running reaper must have finished and finalized the chain before it got
+	// switched out for this reaper. There's nothing left to do, so return right
+	// away. If the chain isn't done, no jobs were running when it was suspended
+	// (e.g. between jobs), so finalize it below.
 	if r.runnerRepo.Count() == 0 {
-		log.Infof("SuspendedChainReaper.Run: no active runners")
-		return
+		if done, _ := r.chain.IsDoneRunning(); done {
+			log.Infof("SuspendedChainReaper.Run: no active runners")
+			return
+		}
 	}
 
 	// Reap jobs until there are no jobs left running, or the reaper is stopped.
@@ -363,6 +388,8 @@ func (r *SuspendedChainReaper) Reap(job proto.Job) {
 				nextJob.Data[k] = v
 			}
 		}
+	case proto.STATE_DEADLINE_EXCEEDED:
+		jLogger.Warn("request deadline exceeded")
 	default:
 		// If job isn't complete or failed, must be stopped.
 		jLogger.Infof("job stopped")
@@ -392,6 +419,14 @@ func (r *SuspendedChainReaper) Finalize() {
 		return
 	}
 
+	// Don't suspend a chain that can't run any more jobs when it's resumed
+	if r.chain.DeadlineExceeded() {
+		r.logger.Infof("job chain deadline exceeded")
+		r.chain.SetState(proto.STATE_DEADLINE_EXCEEDED)
+		r.sendFinalState(finishedAt)
+		return
+	}
+
 	if n := r.chain.FailedJobs(); n > 0 {
 		r.logger.Infof("job chain failed (%d failed jobs)", n)
 		r.chain.SetState(proto.STATE_FAIL)
@@ -436,11 +471,15 @@ func (r *StoppedChainReaper) Run() {
 	// will accurately reflect whether there are any running jobs left.
 	time.Sleep(runnerRepoWait)
 
-	// If there are already no jobs left to reap, the running reaper must have
-	// finished and finalized the chain before it got switched out for this reaper.
-	// There's nothing left to do, so return right away.
+	// If there are already no jobs left to reap and the chain is done running,
+	// the running reaper must have finished and finalized the chain before it got
+	// switched out for this reaper. There's nothing left to do, so return right
+	// away. If the chain isn't done, no jobs were running when it was stopped
+	// (e.g. before the first job ran), so finalize it below.
 	if r.runnerRepo.Count() == 0 {
-		return
+		if done, _ := r.chain.IsDoneRunning(); done {
+			return
+		}
 	}
 
 	// Reap jobs until there are no jobs left running, or the reaper is stopped.
@@ -531,6 +570,7 @@ func (r *StoppedChainReaper) Finalize() {
 type reaper struct {
 	chain             *Chain
 	rmc               rm.Client
+	jrURL             string
 	logger            *log.Entry
 	finalizeTries     int
 	finalizeRetryWait time.Duration
@@ -550,6 +590,8 @@ func (r *reaper) sendFinalState(finishedAt time.Time) {
 		State:        r.chain.State(),
 		FinishedAt:   finishedAt,
 		FinishedJobs: r.chain.FinishedJobs(),
+		JobRunnerURL: r.jrURL,
+		FenceToken:   r.chain.FenceToken(),
 	}
 	err := retry.Do(r.finalizeTries, r.finalizeRetryWait,
 		func() error {
@@ -565,12 +607,13 @@ func (r *reaper) sendFinalState(finishedAt time.Time) {
 // prepareSequenceRetry prepares a sequence to retry. The caller should check
 // r.chain.CanRetrySequence first; this func does not check the seq retry limit
 // or increment seq try count (that's done in traverser.runJobs when the seq
-// start job runs).
+// start job runs). It counts the retry against the chain retry budget.
 func (r *reaper) prepareSequenceRetry(failedJob proto.Job) proto.Job {
 	sequenceStartJob := r.chain.SequenceStartJob(failedJob.Id)
 
 	seqLogger := r.logger.WithFields(log.Fields{"sequence_id": sequenceStartJob.SequenceId})
 	seqLogger.Info("preparing sequence retry")
+	r.chain.AddSequenceRetry()
 
 	// sequenceJobsToRetry is a list containing the failed job and all previously
 	// completed jobs in the sequence. For example, if job C of A -> B -> C -> D
@@ -290,6 +290,7 @@ func TestRunningReaper(t *testing.T) {
 			"job3": {"job4"},
 		},
 		FinishedJobs: 0,
+		FenceToken:   2,
 	}
 	job1 := jc.Jobs["job1"]
 	job1.Data = map[string]interface{}{
@@ -300,10 +301,14 @@ func TestRunningReaper(t *testing.T) {
 
 	sent := false
 	var receivedState byte
+	var receivedJRURL string
+	var receivedToken uint64
 	rmc := &mock.RMClient{
 		FinishRequestFunc: func(fr proto.FinishRequest) error {
 			sent = true
 			receivedState = fr.State
+			receivedJRURL = fr.JobRunnerURL
+			receivedToken = fr.FenceToken
 			return nil
 		},
 	}
@@ -316,6 +321,7 @@ func TestRunningReaper(t *testing.T) {
 	factory := &chain.ChainReaperFactory{
 		Chain:        c,
 		RMClient:     rmc,
+		JRURL:        "http://jr1",
 		Logger:       log.WithFields(log.Fields{"requestId": reqId}),
 		RMCTries:     5,
 		RMCRetryWait: 50 * time.Millisecond,
@@ -388,6 +394,12 @@ func TestRunningReaper(t *testing.T) {
 	if receivedState != proto.STATE_FAIL {
 		t.Errorf("chain state %s sent to RM client, expected state %s", proto.StateName[receivedState], proto.StateName[proto.STATE_FAIL])
 	}
+	if receivedJRURL != "http://jr1" {
+		t.Errorf("JR URL %s sent to RM client, expected http://jr1", receivedJRURL)
+	}
+	if receivedToken != 2 {
+		t.Errorf("fence token %d sent to RM client, expected 2", receivedToken)
+	}
 
 	finishedJobs := c.FinishedJobs()
 	if finishedJobs != 4 {
@@ -1031,6 +1043,7 @@ func TestSuspendedReaper(t *testing.T) {
 			"job1": 1,
 			"job6": 1,
 		},
+		SequenceRetries: 1, // job6 failed, its sequence retry was prepared
 	}
 	if diff := deep.Equal(receivedSJC, expectedSJC); diff != nil {
 		t.Errorf("received SJC != expected SJC: %s", diff)
@@ -1345,3 +1358,163 @@ func TestSuspendedFinalizeFinished(t *testing.T) {
 		t.Errorf("chain state %s sent to RM client, expected state %s", proto.StateName[receivedState], proto.StateName[proto.STATE_FAIL])
 	}
 }
+
+// suspendedChainReaper.Run with no running jobs on a chain that isn't done
+// (suspended between jobs) must still send the SJC
+func TestSuspendedReaperNoRunningJobs(t *testing.T) {
+	reqId := "test_suspended_reaper_no_running_jobs"
+	factory := defaultFactory(reqId)
+
+	jc := &proto.JobChain{
+		RequestId: reqId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	c.SetJobState("job1", proto.STATE_COMPLETE)
+	c.IncrementFinishedJobs(1)
+	factory.Chain = c
+
+	sentState := false
+	sentSJC := false
+	factory.RMClient = &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			sentState = true
+			return nil
+		},
+		SuspendRequestFunc: func(reqId string, sjc proto.SuspendedJobChain) error {
+			sentSJC = true
+			return nil
+		},
+	}
+
+	reaper := factory.MakeSuspended()
+	reaper.Run()
+
+	if !sentSJC {
+		t.Errorf("SJC not sent, expected it to be sent")
+	}
+	if sentState {
+		t.Errorf("final chain state sent, expected only SJC to be sent")
+	}
+	if c.State() != proto.STATE_SUSPENDED {
+		t.Errorf("chain state = %d, expected %d", c.State(), proto.STATE_SUSPENDED)
+	}
+}
+
+// suspendedChainReaper.Run with no running jobs on a chain that's done running:
+// the running reaper already finalized it, so nothing is sent
+func TestSuspendedReaperDoneRunning(t *testing.T) {
+	reqId := "test_suspended_reaper_done_running"
+	factory := defaultFactory(reqId)
+
+	jc := &proto.JobChain{
+		RequestId: reqId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	c.SetJobState("job1", proto.STATE_COMPLETE)
+	c.SetJobState("job2", proto.STATE_COMPLETE)
+	c.IncrementFinishedJobs(2)
+	factory.Chain = c
+
+	sentState := false
+	sentSJC := false
+	factory.RMClient = &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			sentState = true
+			return nil
+		},
+		SuspendRequestFunc: func(reqId string, sjc proto.SuspendedJobChain) error {
+			sentSJC = true
+			return nil
+		},
+	}
+
+	reaper := factory.MakeSuspended()
+	reaper.Run()
+
+	if sentSJC {
+		t.Errorf("SJC sent, expected nothing to be sent")
+	}
+	if sentState {
+		t.Errorf("final chain state sent, expected nothing to be sent")
+	}
+}
+
+// stoppedChainReaper.Run with no running jobs on a chain that isn't done (stopped
+// before the first job ran) must still finalize the chain
+func TestStoppedReaperNoRunningJobs(t *testing.T) {
+	reqId := "test_stopped_reaper_no_running_jobs"
+	factory := defaultFactory(reqId)
+
+	jc := &proto.JobChain{
+		RequestId: reqId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	factory.Chain = c
+
+	sent := false
+	var receivedState byte
+	factory.RMClient = &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			sent = true
+			receivedState = fr.State
+			return nil
+		},
+	}
+
+	reaper := factory.MakeStopped()
+	reaper.Run()
+
+	if !sent {
+		t.Fatalf("final chain state not sent to RM client")
+	}
+	if receivedState != proto.STATE_STOPPED {
+		t.Errorf("chain state %s sent to RM client, expected state %s", proto.StateName[receivedState], proto.StateName[proto.STATE_STOPPED])
+	}
+}
+
+// stoppedChainReaper.Run with no running jobs on a chain that's done running:
+// the running reaper already finalized it, so it's not finalized again
+func TestStoppedReaperDoneRunning(t *testing.T) {
+	reqId := "test_stopped_reaper_done_running"
+	factory := defaultFactory(reqId)
+
+	jc := &proto.JobChain{
+		RequestId: reqId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	c.SetJobState("job1", proto.STATE_COMPLETE)
+	c.SetJobState("job2", proto.STATE_COMPLETE)
+	c.IncrementFinishedJobs(2)
+	factory.Chain = c
+
+	sent := false
+	factory.RMClient = &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			sent = true
+			return nil
+		},
+	}
+
+	reaper := factory.MakeStopped()
+	reaper.Run()
+
+	if sent {
+		t.Errorf("final chain state sent to RM client, expected it not to be sent again")
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020, Square, Inc.
+
+package chain
+
+import (
+	"sort"
+	"sync"
+)
+
+// scratch implements job.Scratch for a Chain. It's safe for concurrent use
+// because jobs in parallel sequences share it.
+type scratch struct {
+	*sync.RWMutex
+	kv map[string][]byte
+}
+
+// newScratch returns a scratch store with a copy of kv, which can be nil.
+func newScratch(kv map[string][]byte) *scratch {
+	s := &scratch{
+		RWMutex: &sync.RWMutex{},
+		kv:      map[string][]byte{},
+	}
+	for k, v := range kv {
+		s.kv[k] = copyBytes(v)
+	}
+	return s
+}
+
+func (s *scratch) Get(key string) ([]byte, bool) {
+	s.RLock()
+	defer s.RUnlock()
+	v, ok := s.kv[key]
+	if !ok {
+		return nil, false
+	}
+	return copyBytes(v), true
+}
+
+func (s *scratch) Set(key string, value []byte) {
+	s.Lock()
+	s.kv[key] = copyBytes(value)
+	s.Unlock()
+}
+
+func (s *scratch) Delete(key string) {
+	s.Lock()
+	delete(s.kv, key)
+	s.Unlock()
+}
+
+func (s *scratch) Keys() []string {
+	s.RLock()
+	keys := make([]string, 0, len(s.kv))
+	for k := range s.kv {
+		keys = append(keys, k)
+	}
+	s.RUnlock()
+	sort.Strings(keys)
+	return keys
+}
+
+// copy returns a copy of all keys and values, or nil if there are no keys.
+// It's saved in the suspended job chain.
+func (s *scratch) copy() map[string][]byte {
+	s.RLock()
+	defer s.RUnlock()
+	if len(s.kv) == 0 {
+		return nil
+	}
+	kv := make(map[string][]byte, len(s.kv))
+	for k, v := range s.kv {
+		kv[k] = copyBytes(v)
+	}
+	return kv
+}
+
+func copyBytes(b []byte) []byte {
+	if b == nil {
+		return nil
+	}
+	c := make([]byte, len(b))
+	copy(c, b)
+	return c
+}
@@ -4,14 +4,18 @@ package chain
 
 import (
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/square/spincycle/v2/config"
 	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/job-runner/workspace"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
 	rm "github.com/square/spincycle/v2/request-manager"
 	"github.com/square/spincycle/v2/retry"
 )
@@ -19,13 +23,12 @@ import (
 var (
 	// Returned when Stop is called but the chain has already been suspended.
 	ErrShuttingDown = fmt.Errorf("chain not stopped because traverser is shutting down")
+
+	// Returned when StopJob is called but the job is not running.
+	ErrJobNotRunning = fmt.Errorf("job not running")
 )
 
 const (
-	// Default timeout used by traverser factory for traverser's stopTimeout
-	// and sendTimeout.
-	defaultTimeout = 10 * time.Second
-
 	// Number of times to attempt sending a job log to the RM.
 	jobLogTries = 3
 	// Time to wait between attempts to send a job log to RM.
@@ -47,10 +50,18 @@ type Traverser interface {
 	Run()
 
 	// Stop makes a traverser stop traversing its job chain. It also sends a stop
-	// signal to all of the jobs that a traverser is running.
+	// signal to all of the jobs that a traverser is running, and waits up to the
+	// timeout for them to stop. If the timeout is zero, the traverser's stop
+	// timeout is used.
 	//
 	// It returns an error if it fails to stop all running jobs.
-	Stop() error
+	Stop(timeout time.Duration) error
+
+	// StopJob stops the current try of one running job, but not the job chain:
+	// the try fails, and the job is retried if it has tries left, else the chain
+	// handles the failed job as usual (see runner.Runner.StopTry). It returns
+	// ErrJobNotRunning if the job is not running or is waiting to retry.
+	StopJob(jobId string) error
 
 	// Running returns all currently running jobs. The status.Manager uses this
 	// to report running status.
@@ -63,19 +74,139 @@ type TraverserFactory interface {
 	MakeFromSJC(*proto.SuspendedJobChain) (Traverser, error)
 }
 
+// ShutdownPolicy determines how long job chains keep running when the Job Runner
+// shuts down before they are suspended. A zero duration means suspend immediately.
+type ShutdownPolicy struct {
+	FinishTimeout time.Duration            // for all request types
+	RequestTypes  map[string]time.Duration // overrides FinishTimeout, keyed on request type
+}
+
+// NewShutdownPolicy returns the ShutdownPolicy for the shutdown config. It returns
+// an error if a policy is invalid or a finish timeout is invalid or not set.
+func NewShutdownPolicy(cfg config.Shutdown) (ShutdownPolicy, error) {
+	p := ShutdownPolicy{
+		RequestTypes: map[string]time.Duration{},
+	}
+	d, err := finishTimeout(cfg.ShutdownPolicy)
+	if err != nil {
+		return p, err
+	}
+	p.FinishTimeout = d
+
+	for reqType, override := range cfg.RequestTypes {
+		if override.Policy == "" {
+			override.Policy = cfg.Policy
+		}
+		if override.FinishTimeout == "" {
+			override.FinishTimeout = cfg.FinishTimeout
+		}
+		d, err := finishTimeout(override)
+		if err != nil {
+			return p, fmt.Errorf("request type %s: %s", reqType, err)
+		}
+		p.RequestTypes[reqType] = d
+	}
+	return p, nil
+}
+
+func finishTimeout(cfg config.ShutdownPolicy) (time.Duration, error) {
+	switch cfg.Policy {
+	case config.SHUTDOWN_POLICY_SUSPEND, "":
+		return 0, nil
+	case config.SHUTDOWN_POLICY_FINISH:
+		if cfg.FinishTimeout == "" {
+			return 0, fmt.Errorf("finish_timeout must be set for shutdown policy %s", cfg.Policy)
+		}
+		d, err := time.ParseDuration(cfg.FinishTimeout)
+		if err != nil {
+			return 0, fmt.Errorf("invalid finish_timeout %s: %s", cfg.FinishTimeout, err)
+		}
+		return d, nil
+	}
+	return 0, fmt.Errorf("invalid shutdown policy %s: expected %s or %s",
+		cfg.Policy, config.SHUTDOWN_POLICY_SUSPEND, config.SHUTDOWN_POLICY_FINISH)
+}
+
+// Timeout returns the finish timeout for job chains of the request type.
+func (p ShutdownPolicy) Timeout(requestType string) time.Duration {
+	if d, ok := p.RequestTypes[requestType]; ok {
+		return d
+	}
+	return p.FinishTimeout
+}
+
+// Max returns the longest finish timeout of all request types.
+func (p ShutdownPolicy) Max() time.Duration {
+	max := p.FinishTimeout
+	for _, d := range p.RequestTypes {
+		if d > max {
+			max = d
+		}
+	}
+	return max
+}
+
+// Timeouts are how long traversers wait for running jobs when a job chain is
+// stopped or suspended. A request spec stopTimeout (JobChain.StopTimeout) overrides
+// Stop for job chains of that request type.
+type Timeouts struct {
+	Stop time.Duration // wait for running jobs to stop
+	Send time.Duration // warn if a done job is not reaped, and extra wait to stop
+}
+
+// NewTimeouts returns the Timeouts for the traverser config. It returns an error
+// if a timeout is invalid. Timeouts not set are the defaults.
+func NewTimeouts(cfg config.Traverser) (Timeouts, error) {
+	var t Timeouts
+	var err error
+	if t.Stop, err = timeout(cfg.StopTimeout, config.DEFAULT_TRAVERSER_STOP_TIMEOUT); err != nil {
+		return t, fmt.Errorf("invalid stop_timeout %s: %s", cfg.StopTimeout, err)
+	}
+	if t.Send, err = timeout(cfg.SendTimeout, config.DEFAULT_TRAVERSER_SEND_TIMEOUT); err != nil {
+		return t, fmt.Errorf("invalid send_timeout %s: %s", cfg.SendTimeout, err)
+	}
+	return t, nil
+}
+
+func timeout(val, def string) (time.Duration, error) {
+	if val == "" {
+		val = def
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, err
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("must be greater than zero")
+	}
+	return d, nil
+}
+
 type traverserFactory struct {
-	chainRepo    Repo
-	rf           runner.Factory
-	rmc          rm.Client
-	shutdownChan chan struct{}
+	chainRepo      Repo
+	rf             runner.Factory
+	rmc            rm.Client
+	baseURL        string
+	shutdownChan   chan struct{}
+	shutdownPolicy ShutdownPolicy
+	timeouts       Timeouts
+	workspaces     *workspace.Manager
 }
 
-func NewTraverserFactory(chainRepo Repo, rf runner.Factory, rmc rm.Client, shutdownChan chan struct{}) TraverserFactory {
+// NewTraverserFactory makes a TraverserFactory. baseURL is the base URL of this
+// Job Runner, which it reports in final request states so the Request Manager can
+// fence a Job Runner that lost a request (see proto.FinishRequest.JobRunnerURL).
+// If workspaces is not nil, every traverser has a request workspace for its jobs.
+func NewTraverserFactory(chainRepo Repo, rf runner.Factory, rmc rm.Client, baseURL string, shutdownChan chan struct{}, shutdownPolicy ShutdownPolicy, timeouts Timeouts, workspaces *workspace.Manager) TraverserFactory {
 	return &traverserFactory{
-		chainRepo:    chainRepo,
-		rf:           rf,
-		rmc:          rmc,
-		shutdownChan: shutdownChan,
+		chainRepo:      chainRepo,
+		rf:             rf,
+		rmc:            rmc,
+		baseURL:        baseURL,
+		shutdownChan:   shutdownChan,
+		shutdownPolicy: shutdownPolicy,
+		timeouts:       timeouts,
+		workspaces:     workspaces,
 	}
 }
 
@@ -91,7 +222,10 @@ func (f *traverserFactory) Make(jobChain *proto.JobChain) (Traverser, error) {
 func (f *traverserFactory) MakeFromSJC(sjc *proto.SuspendedJobChain) (Traverser, error) {
 	// Convert/wrap chain from proto to Go object.
 	chain := NewChain(sjc.JobChain, sjc.SequenceTries, sjc.TotalJobTries, sjc.LatestRunJobTries)
-	logger := log.WithFields(log.Fields{"request_id": sjc.RequestId})
+	chain.scratch = newScratch(sjc.Scratch)
+	chain.jobRetries = sjc.JobRetries
+	chain.sequenceRetries = sjc.SequenceRetries
+	logger := reqlog.Entry(chain.RequestId()).WithFields(logFields(chain))
 	logger.Infof("resuming request")
 
 	// Change all STOPPED jobs to PENDING. Traverser expects a ready-to-run chain.
@@ -130,6 +264,27 @@ func (f *traverserFactory) make(chain *Chain) (Traverser, error) {
 		return nil, fmt.Errorf("error adding job chain: %s", err)
 	}
 
+	// The request spec stop timeout overrides the JR stop timeout. The RM checks
+	// that it's valid, so an invalid value is only logged.
+	stopTimeout := f.timeouts.Stop
+	if chain.StopTimeout() != "" {
+		d, err := time.ParseDuration(chain.StopTimeout())
+		if err != nil || d <= 0 {
+			log.WithFields(logFields(chain)).Warnf("ignoring invalid request stop timeout %s, using %s", chain.StopTimeout(), stopTimeout)
+		} else {
+			stopTimeout = d
+		}
+	}
+
+	// Create the request workspace, if enabled, now so the request fails to start
+	// (or resume) on this JR if it can't be created. The traverser removes it
+	// when Run returns.
+	ws, err := f.workspaces.Create(chain.RequestId())
+	if err != nil {
+		f.chainRepo.Remove(chain.RequestId())
+		return nil, fmt.Errorf("error creating request workspace: %s", err)
+	}
+
 	// Create and return a traverser for the chain. The traverser is responsible
 	// for the chain: running, cleaning up, removing from repo when done, etc.
 	// And traverser and chain have the same lifespan: traverser is done when
@@ -139,9 +294,12 @@ func (f *traverserFactory) make(chain *Chain) (Traverser, error) {
 		ChainRepo:     f.chainRepo,
 		RunnerFactory: f.rf,
 		RMClient:      f.rmc,
+		BaseURL:       f.baseURL,
 		ShutdownChan:  f.shutdownChan,
-		StopTimeout:   defaultTimeout,
-		SendTimeout:   defaultTimeout,
+		StopTimeout:   stopTimeout,
+		SendTimeout:   f.timeouts.Send,
+		FinishTimeout: f.shutdownPolicy.Timeout(chain.RequestType()),
+		Workspace:     ws,
 	}
 	return NewTraverser(cfg), nil
 }
@@ -150,12 +308,15 @@ func (f *traverserFactory) make(chain *Chain) (Traverser, error) {
 
 type traverser struct {
 	reaperFactory ReaperFactory
-	reaper        JobReaper
+	reaper        JobReaper // current reaper: running, stopped, or suspended
+	runningReaper JobReaper // made in NewTraverser, run in Run
 
 	shutdownChan chan struct{}  // indicates JR is shutting down
 	runJobChan   chan proto.Job // jobs to be run
-	doneJobChan  chan proto.Job // jobs that are done
+	doneJobChan  chan proto.Job // jobs that are done, sent to the current reaper
+	doneQueue    *doneQueue     // jobs that are done, waiting to be sent on doneJobChan
 	doneChan     chan struct{}  // closed when traverser finishes running
+	returnChan   chan struct{}  // closed when Run returns
 
 	stopMux     *sync.RWMutex // lock around checks to stopped
 	stopped     bool          // has traverser been stopped
@@ -165,14 +326,18 @@ type traverser struct {
 	pending     int64         // N runJob goroutines are pending runnerRepo.Set
 
 	chain      *Chain
-	chainRepo  Repo // stores all currently running chains
+	chainRepo  Repo      // stores all currently running chains
+	startedAt  time.Time // when this JR started running the chain
 	rf         runner.Factory
 	runnerRepo runner.Repo // stores actively running jobs
 	rmc        rm.Client
 	logger     *log.Entry
+	workspace  *workspace.Workspace // request workspace, nil if disabled
 
-	stopTimeout time.Duration // Time to wait for jobs to stop
-	sendTimeout time.Duration // Time to wait for a job to send on doneJobChan.
+	stopTimeout   time.Duration // Time to wait for jobs to stop
+	sendTimeout   time.Duration // Time a done job waits to be reaped before a warning
+	finishTimeout time.Duration // Time to let chain run on shutdown before suspending
+	doneTimeout   int64         // Time Run waits for Stop or shutdown (atomic, nanoseconds)
 }
 
 type TraverserConfig struct {
@@ -183,10 +348,26 @@ type TraverserConfig struct {
 	ShutdownChan  chan struct{}
 	StopTimeout   time.Duration
 	SendTimeout   time.Duration
+	FinishTimeout time.Duration        // 0 = suspend immediately on shutdown
+	BaseURL       string               // this Job Runner, sent with the final request state
+	Workspace     *workspace.Workspace // removed when Run returns, nil if disabled
+}
+
+// logFields returns the log fields for every traverser and reaper log line:
+// the request ID and, if set, the request correlation ID so logs can be traced
+// back to the caller.
+func logFields(chain *Chain) log.Fields {
+	fields := log.Fields{"request_id": chain.RequestId()}
+	if cid := chain.CorrelationId(); cid != "" {
+		fields["correlation_id"] = cid
+	}
+	return fields
 }
 
 func NewTraverser(cfg TraverserConfig) *traverser {
-	logger := log.WithFields(log.Fields{"request_id": cfg.Chain.RequestId()})
+	// Traverser, reaper, and runners log at the request log level, which can be
+	// elevated while the chain runs (reqlog.Elevate). Released when Run returns.
+	logger := reqlog.Acquire(cfg.Chain.RequestId()).WithFields(logFields(cfg.Chain))
 
 	// Channels used to communicate between traverser + reaper(s)
 	doneJobChan := make(chan proto.Job)
@@ -203,6 +384,7 @@ func NewTraverser(cfg TraverserConfig) *traverser {
 		Chain:        cfg.Chain,
 		ChainRepo:    cfg.ChainRepo,
 		RMClient:     cfg.RMClient,
+		JRURL:        cfg.BaseURL,
 		RMCTries:     reaperTries,
 		RMCRetryWait: reaperRetryWait,
 		Logger:       logger,
@@ -211,23 +393,35 @@ func NewTraverser(cfg TraverserConfig) *traverser {
 		RunnerRepo:   runnerRepo,
 	}
 
+	// Make the running reaper now, not in Run, so Stop and shutdown always have
+	// a reaper to stop, even if called before Run starts the running reaper
+	runningReaper := reaperFactory.MakeRunning()
+
 	return &traverser{
 		reaperFactory: reaperFactory,
+		reaper:        runningReaper,
+		runningReaper: runningReaper,
 		logger:        logger,
 		chain:         cfg.Chain,
 		chainRepo:     cfg.ChainRepo,
+		startedAt:     time.Now(),
 		rf:            cfg.RunnerFactory,
 		runnerRepo:    runnerRepo,
 		shutdownChan:  cfg.ShutdownChan,
 		runJobChan:    runJobChan,
 		doneJobChan:   doneJobChan,
+		doneQueue:     newDoneQueue(),
 		doneChan:      make(chan struct{}),
+		returnChan:    make(chan struct{}),
 		stopChan:      make(chan struct{}),
 		pendingChan:   make(chan struct{}),
 		rmc:           cfg.RMClient,
+		workspace:     cfg.Workspace,
 		stopMux:       &sync.RWMutex{},
 		stopTimeout:   cfg.StopTimeout,
 		sendTimeout:   cfg.SendTimeout,
+		finishTimeout: cfg.FinishTimeout,
+		doneTimeout:   int64(cfg.StopTimeout + cfg.SendTimeout),
 	}
 }
 
@@ -237,11 +431,19 @@ func (t *traverser) Run() {
 	t.logger.Infof("traverser.Run call")
 	defer t.logger.Infof("traverser.Run return")
 
+	defer reqlog.Release(t.chain.RequestId())
 	defer t.chainRepo.Remove(t.chain.RequestId())
+	defer t.removeWorkspace()
+	defer t.logQueueDelay()
+	defer close(t.returnChan) // stop sendDoneJobs
+
+	// Start a goroutine to send done jobs to the current reaper on doneJobChan.
+	// It returns when Run returns.
+	go t.sendDoneJobs()
 
 	// Start a goroutine to run jobs. This consumes runJobChan. When jobs are done,
-	// they're sent to doneJobChan, which a reaper consumes. This goroutine returns
-	// when runJobChan is closed below.
+	// they're queued for sendDoneJobs. This goroutine returns when runJobChan is
+	// closed below.
 	go t.runJobs()
 
 	// Enqueue all the first runnable jobs
@@ -255,11 +457,10 @@ func (t *traverser) Run() {
 	// calls t.reaper.Stop(), which is this reaper. The close(t.runJobChan)
 	// causes runJobs() (started above ^) to return.
 	runningReaperChan := make(chan struct{})
-	t.reaper = t.reaperFactory.MakeRunning() // t.reaper = runningReaper
 	go func() {
 		defer close(runningReaperChan) // indicate reaper is done (see select below)
 		defer close(t.runJobChan)      // stop runJobs goroutine
-		t.reaper.Run()
+		t.runningReaper.Run()
 	}()
 
 	// Wait for running reaper to be done or traverser to be shut down.
@@ -271,25 +472,39 @@ func (t *traverser) Run() {
 		//
 		// We don't check if the chain was suspended, since that can only
 		// happen via the other case in this select.
-		t.stopMux.Lock()
-		if !t.stopped {
-			t.stopMux.Unlock()
+		if !t.isStopped() {
 			return
 		}
-		t.stopMux.Unlock()
 	case <-t.shutdownChan:
-		// The Job Runner is shutting down. Stop the running reaper and suspend
-		// the job chain, to be resumed later by another Job Runner.
-		t.shutdown()
+		// The Job Runner is shutting down. If the shutdown policy is "finish",
+		// let the chain keep running for up to finishTimeout. If it's not done
+		// by then (or the policy is "suspend"), stop the running reaper and
+		// suspend the job chain, to be resumed later by another Job Runner.
+		done := false
+		if t.finishTimeout > 0 {
+			t.logger.Infof("Job Runner shutting down - letting job chain run for up to %s before suspending", t.finishTimeout)
+			select {
+			case <-runningReaperChan:
+				done = true
+			case <-time.After(t.finishTimeout):
+				t.logger.Infof("job chain not done after %s - suspending", t.finishTimeout)
+			}
+		}
+		if !done {
+			t.shutdown()
+		} else if !t.isStopped() {
+			return // chain finished normally, like first case above
+		}
 	}
 
 	// Traverser is being stopped or shut down - wait for that to finish before
-	// returning.
+	// returning. Stop and shutdown wait up to the stop timeout for jobs to stop,
+	// plus the send timeout for the reaper to finish.
 	select {
 	case <-t.doneChan:
 		// Stopped/shutdown successfully - nothing left to do.
 		return
-	case <-time.After(20 * time.Second):
+	case <-time.After(time.Duration(atomic.LoadInt64(&t.doneTimeout))):
 		// Failed to stop/shutdown in a reasonable amount of time.
 		// Log the failure and return.
 		t.logger.Warnf("stopping or suspending the job chain took too long. Exiting...")
@@ -300,8 +515,8 @@ func (t *traverser) Run() {
 // Stop stops the running job chain by switching the running chain reaper for a
 // stopped chain reaper and stopping all currently running jobs. Stop blocks until
 // all jobs have finished and the stopped reaper has send the chain's final state
-// to the RM.
-func (t *traverser) Stop() error {
+// to the RM, or until the timeout (or stop timeout if zero).
+func (t *traverser) Stop(stopTimeout time.Duration) error {
 	// Don't do anything if the traverser has already been stopped or suspended.
 	t.stopMux.Lock()
 	defer t.stopMux.Unlock()
@@ -310,9 +525,13 @@ func (t *traverser) Stop() error {
 	} else if t.suspended {
 		return ErrShuttingDown
 	}
+	if stopTimeout <= 0 {
+		stopTimeout = t.stopTimeout
+	}
+	atomic.StoreInt64(&t.doneTimeout, int64(stopTimeout+t.sendTimeout))
 	close(t.stopChan)
 	t.stopped = true
-	t.logger.Infof("stopping traverser and all jobs")
+	t.logger.Infof("stopping traverser and all jobs (timeout %s)", stopTimeout)
 
 	// Stop the runningReaper and start the stoppedReaper which saves jobs' states
 	// but doesn't enqueue any more jobs to run. It sends the chain's final state
@@ -328,7 +547,7 @@ func (t *traverser) Stop() error {
 	// Stop all job runners in the runner repo. Do this after switching to the
 	// stopped reaper so that when the jobs finish and are sent on doneJobChan,
 	// they are reaped correctly.
-	timeout := time.After(t.stopTimeout)
+	timeout := time.After(stopTimeout)
 	err := t.stopRunningJobs(timeout)
 	if err != nil {
 		// Don't return the error yet - we still want to wait for the stop
@@ -349,6 +568,31 @@ func (t *traverser) Stop() error {
 	return err
 }
 
+func (t *traverser) StopJob(jobId string) error {
+	if t.isStopped() {
+		return ErrJobNotRunning // all jobs are stopping
+	}
+	r := t.runnerRepo.Get(jobId)
+	if r == nil {
+		return ErrJobNotRunning
+	}
+	t.logger.Infof("stopping job %s try", jobId)
+	if err := r.StopTry(); err != nil {
+		if err == runner.ErrNotRunning {
+			return ErrJobNotRunning
+		}
+		return err
+	}
+	return nil
+}
+
+// isStopped returns true if Stop was called.
+func (t *traverser) isStopped() bool {
+	t.stopMux.RLock()
+	defer t.stopMux.RUnlock()
+	return t.stopped
+}
+
 func (t *traverser) Running() []proto.JobStatus {
 	runners := t.runnerRepo.Items()                       // map[string]Runner keyed on jobId
 	jobStatus := make([]proto.JobStatus, 0, len(runners)) // for each runner
@@ -364,6 +608,10 @@ func (t *traverser) Running() []proto.JobStatus {
 			StartedAt: rs.StartedAt.UnixNano(),
 			Try:       rs.Try,
 			Status:    rs.Status,
+
+			SequenceTry:    t.chain.SequenceTries(rs.Job.Id),
+			QueueDelay:     int64(rs.QueueDelay),
+			ChainStartedAt: t.startedAt.UnixNano(),
 		}
 		jobStatus = append(jobStatus, js)
 	}
@@ -373,8 +621,8 @@ func (t *traverser) Running() []proto.JobStatus {
 // -------------------------------------------------------------------------- //
 
 // runJobs loops on the runJobChan, and runs each job that comes through the
-// channel. When the job is done, it sends the job out through the doneJobChan
-// which is being consumed by a reaper.
+// channel. When the job is done, it queues the job to be sent out through the
+// doneJobChan, which is being consumed by a reaper (see sendDoneJobs).
 func (t *traverser) runJobs() {
 	t.logger.Info("runJobs call")
 	defer t.logger.Info("runJobs return")
@@ -402,13 +650,18 @@ func (t *traverser) runJobs() {
 		default:
 		}
 
+		// The job is runnable now: the reaper (or Run, for the first jobs)
+		// sends it as soon as it's runnable. The time from now until its
+		// first try starts is its queue delay.
+		runnableAt := time.Now()
+
 		// Signal to stopRunningJobs that there's +1 goroutine that's going
 		// to add itself to runnerRepo
 		atomic.AddInt64(&t.pending, 1)
 
 		// Explicitly pass the job into the func, or all goroutines would share
 		// the same loop "job" variable.
-		go func(job proto.Job) {
+		go func(job proto.Job, runnableAt time.Time) {
 			jLogger := t.logger.WithFields(log.Fields{"job_id": job.Id, "sequence_id": job.SequenceId, "sequence_try": t.chain.SequenceTries(job.Id)})
 
 			// If this is sequence start job (which currently means sequenceId == job.Id),
@@ -424,26 +677,18 @@ func (t *traverser) runJobs() {
 						atomic.AddInt64(&t.pending, -1)
 						return
 					}
+					runnableAt = time.Now() // the wait isn't queue delay
 				}
 				t.chain.IncrementSequenceTries(job.Id, 1)
 				jLogger.Infof("sequence try %d", t.chain.SequenceTries(job.Id))
 			}
 
-			// Always send the finished job to doneJobChan to be reaped. If the
-			// reaper isn't reaping any more jobs (if this job took too long to
-			// finish after being stopped), sending to doneJobChan won't be
-			// possible - timeout after a while so we don't leak this goroutine.
+			// Always queue the finished job to be reaped. This never blocks,
+			// so a slow reaper or a reaper being switched out (on stop or
+			// suspend) doesn't lose the job: sendDoneJobs sends it to the
+			// current reaper, then removes its runner from the repo.
 			defer func() {
-				select {
-				case t.doneJobChan <- job: // reap the done job
-				case <-time.After(t.sendTimeout):
-					jLogger.Warnf("timed out sending job to doneJobChan")
-				}
-				// Remove the job's runner from the repo (if it was ever added)
-				// AFTER sending it to doneJobChan. This avoids a race condition
-				// when the stopped + suspended reapers check if the runnerRepo
-				// is empty.
-				t.runnerRepo.Remove(job.Id)
+				t.doneQueue.Push(job) // not deferred directly: job.State is set below
 			}()
 
 			// Job tries for current sequence try and total tries for all seq tries.
@@ -451,15 +696,42 @@ func (t *traverser) runJobs() {
 			// be > 0 which is why we pass them to the job runner: to resume for the
 			// last counts.
 			curTries, totalTries := t.chain.JobTries(job.Id)
+			jLogger.Debugf("job %s (%s): tries=%d total_tries=%d args=%v", job.Name, job.Type, curTries, totalTries, job.Args)
+
+			// Don't start the job after the request deadline. It's like the
+			// job failed, except its sequence isn't retried and the chain final
+			// state is DEADLINE_EXCEEDED. Checked here, after waiting to retry
+			// the sequence, because the wait can pass the deadline.
+			deadline := t.chain.Deadline()
+			if !deadline.IsZero() && !time.Now().Before(deadline) {
+				jLogger.Warnf("not running job: request deadline %s exceeded", deadline.Format(time.RFC3339))
+				atomic.AddInt64(&t.pending, -1)
+				// Count it as one try so the job log has a new try number
+				t.chain.IncrementJobTries(job.Id, 1)
+				job.State = proto.STATE_DEADLINE_EXCEEDED
+				t.sendJL(job, fmt.Errorf("request deadline %s exceeded", deadline.Format(time.RFC3339)), "")
+				return
+			}
 
-			runner, err := t.rf.Make(job, t.chain.RequestId(), curTries, totalTries)
+			runner, err := t.rf.Make(job, runner.Config{
+				RequestId:   t.chain.RequestId(),
+				PrevTries:   curTries,
+				TotalTries:  totalTries,
+				FenceToken:  t.chain.FenceToken(),
+				SequenceTry: t.chain.SequenceTries(job.Id),
+				Deadline:    deadline,
+				Scratch:     t.chain.Scratch(),
+				Workspace:   t.workspace,
+				RunnableAt:  runnableAt,
+				Budget:      t.chain,
+			})
 			if err != nil {
 				// Problem creating the job runner - treat job as failed.
 				// Send a JobLog to the RM so that it knows this job failed.
 				atomic.AddInt64(&t.pending, -1)
 				job.State = proto.STATE_FAIL
 				err = fmt.Errorf("problem creating job runner: %s", err)
-				t.sendJL(job, err)
+				t.sendJL(job, err, "")
 				return
 			}
 
@@ -475,34 +747,154 @@ func (t *traverser) runJobs() {
 			// Run the job. This is a blocking operation that could take a long time.
 			jLogger.Infof("running job")
 			t.chain.SetJobState(job.Id, proto.STATE_RUNNING)
-			ret := runner.Run(job.Data)
+			ret := t.runJob(runner, job)
 			jLogger.Infof("job done: state=%s (%d)", proto.StateName[ret.FinalState], ret.FinalState)
+			jLogger.Debugf("job done: tries=%d data=%v", ret.Tries, job.Data)
 
 			// We don't pass the Chain to the job runner, so it can't call this
 			// itself. Instead, it returns how many tries it did, and we set it.
 			t.chain.IncrementJobTries(job.Id, int(ret.Tries))
+			if ret.QueueDelay > 0 {
+				t.chain.AddQueueDelay(ret.QueueDelay)
+			}
 
 			// Set job final state because this job is about to be reaped on
-			// the doneJobChan, sent in this goroutine's defer func at top ^.
+			// the doneJobChan, queued in this goroutine's defer func at top ^.
 			job.State = ret.FinalState
-		}(job)
+		}(job, runnableAt)
+	}
+}
+
+// sendDoneJobs sends done jobs from the done queue to the current reaper on
+// doneJobChan, in the order they finished, until Run returns. The queue outlives
+// reapers, so a job that finishes while a reaper is slow or being switched out is
+// reaped by the next reaper, not lost. If a job waits longer than the send timeout
+// to be reaped, it logs a warning and keeps waiting. Jobs still queued when Run
+// returns were not reaped: their runners stay in the runner repo, so the stopped
+// or suspended reaper finalized them as still running.
+func (t *traverser) sendDoneJobs() {
+	t.logger.Info("sendDoneJobs call")
+	defer t.logger.Info("sendDoneJobs return")
+
+	for {
+		select {
+		case <-t.doneQueue.Ready():
+		case <-t.returnChan:
+			if n := t.doneQueue.Len(); n > 0 {
+				t.logger.Warnf("%d done jobs not reaped", n)
+			}
+			return
+		}
+		for {
+			job, ok := t.doneQueue.Peek()
+			if !ok {
+				break
+			}
+			if !t.sendDoneJob(job) {
+				return
+			}
+			t.doneQueue.Pop()
+
+			// Remove the job's runner from the repo (if it was ever added)
+			// AFTER sending it to doneJobChan. This avoids a race condition
+			// when the stopped + suspended reapers check if the runnerRepo
+			// is empty.
+			t.runnerRepo.Remove(job.Id)
+		}
+	}
+}
+
+// sendDoneJob sends the job on doneJobChan. It returns false if Run returned
+// before a reaper received the job.
+func (t *traverser) sendDoneJob(job proto.Job) bool {
+	var warn <-chan time.Time
+	if t.sendTimeout > 0 {
+		ticker := time.NewTicker(t.sendTimeout)
+		defer ticker.Stop()
+		warn = ticker.C
+	}
+	waitStart := time.Now()
+	for {
+		select {
+		case t.doneJobChan <- job: // reap the done job
+			return true
+		case <-warn:
+			t.logger.WithFields(log.Fields{"job_id": job.Id}).Warnf("job done but not reaped after %s: reaper is slow or stopping (%d jobs queued)",
+				time.Now().Sub(waitStart).Round(time.Millisecond), t.doneQueue.Len())
+		case <-t.returnChan:
+			t.logger.Warnf("%d done jobs not reaped, including %s", t.doneQueue.Len(), job.Id)
+			return false
+		}
+	}
+}
+
+// removeWorkspace removes the request workspace when Run returns: the chain is
+// done, stopped, or suspended. Files in it are not saved with the suspended job
+// chain, so a resumed chain starts with an empty workspace.
+func (t *traverser) removeWorkspace() {
+	if t.workspace == nil {
+		return
+	}
+	if err := t.workspace.Remove(); err != nil {
+		t.logger.Errorf("error removing request workspace %s: %s", t.workspace.Dir, err)
+		return
+	}
+	t.logger.Infof("removed request workspace %s", t.workspace.Dir)
+}
+
+// logQueueDelay logs the queue delay of jobs that started while the chain ran:
+// if it's long, the chain was slow because of scheduling, not the jobs.
+func (t *traverser) logQueueDelay() {
+	jobs, total, max := t.chain.QueueDelay()
+	if jobs == 0 {
+		return
 	}
+	avg := total / time.Duration(jobs)
+	t.logger.Infof("job queue delay: %d jobs, total %s, avg %s, max %s", jobs, total, avg, max)
+}
+
+// runJob calls r.Run, recovering from a panic so that one bad job runner fails
+// only its job instead of crashing the Job Runner and every chain running on it.
+// On panic, the job fails and a job log with the stack trace (as stderr) is sent
+// to the RM. Panics from job.Run are recovered by the runner, so this only
+// catches panics from the runner itself.
+func (t *traverser) runJob(r runner.Runner, job proto.Job) (ret runner.Return) {
+	defer func() {
+		panicErr := recover()
+		if panicErr == nil {
+			return
+		}
+		stack := debug.Stack()
+		runner.JobPanics.Add(1)
+		err := fmt.Errorf("panic from runner.Run: %v", panicErr)
+		t.logger.WithFields(log.Fields{"job_id": job.Id}).Errorf("%s\n%s", err, stack)
+
+		// The panicked run counts as one try. Increment it here, not in the
+		// caller, so the job log has a new try number.
+		t.chain.IncrementJobTries(job.Id, 1)
+		job.State = proto.STATE_FAIL
+		t.sendJL(job, err, string(stack))
+		ret = runner.Return{FinalState: proto.STATE_FAIL, Tries: 0}
+	}()
+	return r.Run(job.Data)
 }
 
 // sendJL sends a job log to the Request Manager.
-func (t *traverser) sendJL(job proto.Job, err error) {
+func (t *traverser) sendJL(job proto.Job, err error, stderr string) {
 	_, totalTries := t.chain.JobTries(job.Id)
 	jLogger := t.logger.WithFields(log.Fields{"job_id": job.Id})
 	jl := proto.JobLog{
-		RequestId:  t.chain.RequestId(),
-		JobId:      job.Id,
-		Name:       job.Name,
-		Type:       job.Type,
-		Try:        totalTries,
-		StartedAt:  0, // zero because the job never ran
-		FinishedAt: 0,
-		State:      job.State,
-		Exit:       1,
+		RequestId:   t.chain.RequestId(),
+		JobId:       job.Id,
+		Name:        job.Name,
+		Type:        job.Type,
+		Try:         totalTries,
+		SequenceTry: t.chain.SequenceTries(job.Id),
+		StartedAt:   0, // zero because the job never ran
+		FinishedAt:  0,
+		State:       job.State,
+		Exit:        1,
+		Stderr:      stderr,
 	}
 	if err != nil {
 		jl.Error = err.Error()
@@ -647,3 +1039,68 @@ func (t *traverser) stopRunningJobs(timeout <-chan time.Time) error {
 	}
 	return nil
 }
+
+// -------------------------------------------------------------------------- //
+
+// doneQueue is an unbounded FIFO queue of jobs that are done. Pushing never blocks,
+// so job goroutines never wait for (or time out on) a reaper. At most every job in
+// the chain is queued at once, so it's bounded by the size of the chain.
+type doneQueue struct {
+	*sync.Mutex
+	jobs  []proto.Job
+	ready chan struct{} // has a value when jobs were pushed
+}
+
+func newDoneQueue() *doneQueue {
+	return &doneQueue{
+		Mutex: &sync.Mutex{},
+		jobs:  []proto.Job{},
+		ready: make(chan struct{}, 1),
+	}
+}
+
+// Push adds the job to the end of the queue.
+func (q *doneQueue) Push(job proto.Job) {
+	q.Lock()
+	q.jobs = append(q.jobs, job)
+	q.Unlock()
+	select {
+	case q.ready <- struct{}{}:
+	default: // already signaled
+	}
+}
+
+// Peek returns the first job in the queue without removing it, or false if the
+// queue is empty.
+func (q *doneQueue) Peek() (proto.Job, bool) {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.jobs) == 0 {
+		return proto.Job{}, false
+	}
+	return q.jobs[0], true
+}
+
+// Pop removes the first job in the queue.
+func (q *doneQueue) Pop() {
+	q.Lock()
+	defer q.Unlock()
+	if len(q.jobs) == 0 {
+		return
+	}
+	q.jobs[0] = proto.Job{} // release job data
+	q.jobs = q.jobs[1:]
+}
+
+// Len returns the number of jobs in the queue.
+func (q *doneQueue) Len() int {
+	q.Lock()
+	defer q.Unlock()
+	return len(q.jobs)
+}
+
+// Ready returns a channel that receives after jobs are pushed. The queue can be
+// empty by then if the jobs were already popped.
+func (q *doneQueue) Ready() <-chan struct{} {
+	return q.ready
+}
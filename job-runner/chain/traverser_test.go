@@ -3,14 +3,21 @@
 package chain_test
 
 import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"sort"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/go-test/deep"
+	"github.com/square/spincycle/v2/config"
 	"github.com/square/spincycle/v2/job-runner/chain"
 	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/job-runner/workspace"
 	"github.com/square/spincycle/v2/proto"
 	testutil "github.com/square/spincycle/v2/test"
 	"github.com/square/spincycle/v2/test/mock"
@@ -51,7 +58,7 @@ func TestRunComplete(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	traverser.Run()
 
@@ -97,7 +104,7 @@ func TestRunNotComplete(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	traverser.Run()
 
@@ -163,7 +170,7 @@ func testSequenceRetryWait(t *testing.T, sequenceRetryWait string) time.Duration
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	start := time.Now()
 	traverser.Run()
@@ -188,6 +195,7 @@ func TestResume(t *testing.T) {
 	requestId := "test_resume"
 	chainRepo := chain.NewMemoryRepo()
 	var gotTotalTries uint
+	var gotScratch []byte
 	runnersToReturn := map[string]*mock.Runner{
 		"job3": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE, Tries: 1}},
 		"job4": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE, Tries: 1}},
@@ -195,16 +203,17 @@ func TestResume(t *testing.T) {
 		"job6": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE, Tries: 1}},
 	}
 	rf := &mock.RunnerFactory{
-		MakeFunc: func(job proto.Job, requestId string, prevTryNo uint, totalTries uint) (runner.Runner, error) {
+		MakeFunc: func(job proto.Job, cfg runner.Config) (runner.Runner, error) {
 			if job.Id == "job3" {
-				gotTotalTries = totalTries
+				gotTotalTries = cfg.TotalTries
+				gotScratch, _ = cfg.Scratch.Get("k1")
 			}
 			return runnersToReturn[job.Id], nil
 		},
 	}
 	rmc := &mock.RMClient{}
 	shutdownChan := make(chan struct{})
-	tf := chain.NewTraverserFactory(chainRepo, rf, rmc, shutdownChan)
+	tf := chain.NewTraverserFactory(chainRepo, rf, rmc, "", shutdownChan, chain.ShutdownPolicy{}, chain.Timeouts{Stop: time.Second, Send: time.Second}, nil)
 
 	jobs := map[string]proto.Job{
 		"job1": proto.Job{
@@ -270,6 +279,9 @@ func TestResume(t *testing.T) {
 		SequenceTries: map[string]uint{
 			"job1": 2,
 		},
+		Scratch: map[string][]byte{
+			"k1": []byte("v1"),
+		},
 	}
 	traverser, err := tf.MakeFromSJC(&sjc)
 	if err != nil {
@@ -315,6 +327,11 @@ func TestResume(t *testing.T) {
 	if gotTotalTries != 3 {
 		t.Errorf("got job3 tries before Stopped = %d, expected 3", gotTotalTries)
 	}
+
+	// Scratch store is restored from the SJC
+	if string(gotScratch) != "v1" {
+		t.Errorf("got job3 scratch k1 = %s, expected v1", gotScratch)
+	}
 }
 
 // Unknown job state should not cause the traverser to panic when running.
@@ -345,7 +362,7 @@ func TestJobUnknownState(t *testing.T) {
 	for _, j := range jc.Jobs {
 		j.State = proto.STATE_UNKNOWN
 	}
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	traverser.Run()
 
@@ -387,7 +404,7 @@ func TestRunJobsRunnerError(t *testing.T) {
 		Jobs:      testutil.InitJobs(1),
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	traverser.Run()
 
@@ -421,6 +438,133 @@ func TestRunJobsRunnerError(t *testing.T) {
 	}
 }
 
+// A panic in runner.Run fails the job instead of crashing the JR.
+func TestRunJobsRunnerPanic(t *testing.T) {
+	requestId := "test_run_jobs_runner_panic"
+	chainRepo := chain.NewMemoryRepo()
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{
+				RunFunc: func(jobData map[string]interface{}) byte {
+					panic("forced runner.Run panic")
+				},
+			},
+		},
+	}
+	var recvdjl proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			recvdjl = jl
+			return nil
+		},
+	}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(1),
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
+
+	panics := runner.JobPanics.Value()
+	traverser.Run()
+
+	if jc.State != proto.STATE_FAIL {
+		t.Errorf("chain state = %d, expected %d", jc.State, proto.STATE_FAIL)
+	}
+	if c.JobState("job1") != proto.STATE_FAIL {
+		t.Errorf("job1 state = %d, expected %d", c.JobState("job1"), proto.STATE_FAIL)
+	}
+	if n := runner.JobPanics.Value() - panics; n != 1 {
+		t.Errorf("job panics metric increased by %d, expected 1", n)
+	}
+	if recvdjl.Error != "panic from runner.Run: forced runner.Run panic" {
+		t.Errorf("jl error = %s, expected panic error", recvdjl.Error)
+	}
+	if recvdjl.Try != 1 {
+		t.Errorf("jl try = %d, expected 1", recvdjl.Try)
+	}
+	if !strings.Contains(recvdjl.Stderr, "TestRunJobsRunnerPanic") {
+		t.Errorf("jl stderr does not have panic stack trace: %s", recvdjl.Stderr)
+	}
+}
+
+// Jobs are not started after the request deadline, and the chain final state
+// is DEADLINE_EXCEEDED.
+func TestRunDeadlineExceeded(t *testing.T) {
+	requestId := "test_run_deadline_exceeded"
+	chainRepo := chain.NewMemoryRepo()
+	deadline := time.Now().Add(100 * time.Millisecond)
+	var gotDeadline time.Time
+	runnersToReturn := map[string]*mock.Runner{
+		"job1": &mock.Runner{
+			RunFunc: func(jobData map[string]interface{}) byte {
+				time.Sleep(200 * time.Millisecond) // past deadline
+				return proto.STATE_COMPLETE
+			},
+			RunReturn: runner.Return{Tries: 1},
+		},
+	}
+	rf := &mock.RunnerFactory{
+		MakeFunc: func(job proto.Job, cfg runner.Config) (runner.Runner, error) {
+			if job.Id != "job1" {
+				t.Errorf("made runner for %s, expected only job1", job.Id)
+			}
+			gotDeadline = cfg.Deadline
+			return runnersToReturn[job.Id], nil
+		},
+	}
+	var recvdjl proto.JobLog
+	var recvdfr proto.FinishRequest
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			recvdjl = jl
+			return nil
+		},
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			recvdfr = fr
+			return nil
+		},
+	}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+		Deadline: &deadline,
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
+
+	traverser.Run()
+
+	if !gotDeadline.Equal(deadline) {
+		t.Errorf("runner factory got deadline %s, expected %s", gotDeadline, deadline)
+	}
+	if c.JobState("job1") != proto.STATE_COMPLETE {
+		t.Errorf("job1 state = %d, expected %d", c.JobState("job1"), proto.STATE_COMPLETE)
+	}
+	if c.JobState("job2") != proto.STATE_DEADLINE_EXCEEDED {
+		t.Errorf("job2 state = %d, expected %d", c.JobState("job2"), proto.STATE_DEADLINE_EXCEEDED)
+	}
+	if jc.State != proto.STATE_DEADLINE_EXCEEDED {
+		t.Errorf("chain state = %d, expected %d", jc.State, proto.STATE_DEADLINE_EXCEEDED)
+	}
+	if recvdfr.State != proto.STATE_DEADLINE_EXCEEDED {
+		t.Errorf("final state = %d, expected %d", recvdfr.State, proto.STATE_DEADLINE_EXCEEDED)
+	}
+	if recvdjl.JobId != "job2" || recvdjl.State != proto.STATE_DEADLINE_EXCEEDED {
+		t.Errorf("jl job %s state %d, expected job2 state %d", recvdjl.JobId, recvdjl.State, proto.STATE_DEADLINE_EXCEEDED)
+	}
+	if recvdjl.Try != 1 {
+		t.Errorf("jl try = %d, expected 1", recvdjl.Try)
+	}
+}
+
 // Stop the traverser and all running jobs.
 func TestStop(t *testing.T) {
 	requestId := "test_stop"
@@ -447,7 +591,7 @@ func TestStop(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	// Start the traverser.
 	doneChan := make(chan struct{})
@@ -460,7 +604,7 @@ func TestStop(t *testing.T) {
 	// run until Stop is called (which will close their RunBlock channels).
 	runWg.Wait()
 
-	err := traverser.Stop()
+	err := traverser.Stop(0)
 	if err != nil {
 		t.Errorf("err = %s, expected nil", err)
 	}
@@ -492,6 +636,130 @@ func TestStop(t *testing.T) {
 	}
 }
 
+// Many jobs finish at once and wait longer than the send timeout to be reaped:
+// none are lost, so the chain completes
+func TestRunSlowReaper(t *testing.T) {
+	// Job Chain: job1 -> job2..job51 in parallel -> job52
+	requestId := "test_run_slow_reaper"
+	chainRepo := chain.NewMemoryRepo()
+	release := make(chan struct{})
+	var runWg sync.WaitGroup
+	runWg.Add(50)
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1":  &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+			"job52": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+		},
+	}
+	adjList := map[string][]string{"job1": {}}
+	for i := 2; i <= 51; i++ {
+		id := fmt.Sprintf("job%d", i)
+		rf.RunnersToReturn[id] = &mock.Runner{
+			RunFunc: func(jobData map[string]interface{}) byte {
+				runWg.Done()
+				<-release // all finish at once
+				return proto.STATE_COMPLETE
+			},
+		}
+		adjList["job1"] = append(adjList["job1"], id)
+		adjList[id] = []string{"job52"}
+	}
+	rmc := &mock.RMClient{}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId:     requestId,
+		Jobs:          testutil.InitJobs(52),
+		AdjacencyList: adjList,
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, time.Millisecond, 0, "", nil})
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+
+	runWg.Wait()
+	close(release)
+
+	select {
+	case <-doneChan:
+	case <-time.After(5 * time.Second):
+		t.Fatal("traverser did not finish running within 5 seconds (lost done jobs?)")
+	}
+
+	if c.State() != proto.STATE_COMPLETE {
+		t.Errorf("chain state = %s, expected COMPLETE", proto.StateName[c.State()])
+	}
+	for i := 1; i <= 52; i++ {
+		id := fmt.Sprintf("job%d", i)
+		if c.JobState(id) != proto.STATE_COMPLETE {
+			t.Errorf("%s state = %s, expected COMPLETE", id, proto.StateName[c.JobState(id)])
+		}
+	}
+}
+
+// Jobs that stop while the running reaper is switched for the stopped reaper,
+// which is slower than the send timeout to start reaping, are not lost
+func TestStopSlowReaper(t *testing.T) {
+	// Job Chain: job1 -> job2..job11 in parallel
+	requestId := "test_stop_slow_reaper"
+	chainRepo := chain.NewMemoryRepo()
+	var runWg sync.WaitGroup
+	runWg.Add(10)
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+		},
+	}
+	adjList := map[string][]string{"job1": {}}
+	for i := 2; i <= 11; i++ {
+		id := fmt.Sprintf("job%d", i)
+		rf.RunnersToReturn[id] = &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_STOPPED}, RunBlock: make(chan struct{}), RunWg: &runWg}
+		adjList["job1"] = append(adjList["job1"], id)
+	}
+	rmc := &mock.RMClient{}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId:     requestId,
+		Jobs:          testutil.InitJobs(11),
+		AdjacencyList: adjList,
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, time.Second, time.Millisecond, 0, "", nil})
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+
+	runWg.Wait()
+
+	if err := traverser.Stop(0); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+
+	select {
+	case <-doneChan:
+	case <-time.After(2 * time.Second):
+		t.Fatal("traverser did not finish running within 2 seconds")
+	}
+
+	if c.State() != proto.STATE_STOPPED {
+		t.Errorf("chain state = %s, expected STOPPED", proto.StateName[c.State()])
+	}
+	for i := 2; i <= 11; i++ {
+		id := fmt.Sprintf("job%d", i)
+		if c.JobState(id) != proto.STATE_STOPPED {
+			t.Errorf("%s state = %s, expected STOPPED", id, proto.StateName[c.JobState(id)])
+		}
+	}
+}
+
 // Stop a chain but runner.Run() never returns for one of the jobs
 func TestStopRunnerHangs(t *testing.T) {
 	requestId := "test_stop_runner_hangs"
@@ -531,7 +799,7 @@ func TestStopRunnerHangs(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	// Start the traverser.
 	go func() {
@@ -543,7 +811,7 @@ func TestStopRunnerHangs(t *testing.T) {
 	// run until Stop is called (which will close their RunBlock channels).
 	runWg.Wait()
 
-	err := traverser.Stop()
+	err := traverser.Stop(0)
 	if err != nil {
 		t.Errorf("err = %s, expected nil", err)
 	}
@@ -575,6 +843,58 @@ func TestStopRunnerHangs(t *testing.T) {
 	}
 }
 
+// Stop with a timeout longer than the traverser stop timeout waits for a job
+// that takes longer than the stop timeout to stop
+func TestStopTimeoutOverride(t *testing.T) {
+	requestId := "test_stop_timeout_override"
+	chainRepo := chain.NewMemoryRepo()
+	var runWg sync.WaitGroup
+	runWg.Add(1)
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+			"job2": &mock.Runner{
+				RunFunc: func(jobData map[string]interface{}) byte {
+					runWg.Done()
+					time.Sleep(3 * timeout) // slow to stop
+					return proto.STATE_STOPPED
+				},
+			},
+		},
+	}
+	rmc := &mock.RMClient{}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId:     requestId,
+		Jobs:          testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{"job1": {"job2"}},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+	runWg.Wait()
+
+	if err := traverser.Stop(10 * timeout); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	select {
+	case <-doneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("traverser did not finish stopping within 1 second")
+	}
+
+	// With the default stop timeout, job2 would be FAIL because it didn't stop in time
+	if c.JobState("job2") != proto.STATE_STOPPED {
+		t.Errorf("job2 state = %d, expected %d", c.JobState("job2"), proto.STATE_STOPPED)
+	}
+}
+
 // Stop the traverser after it's already done running
 func TestStopDoneRunning(t *testing.T) {
 	requestId := "test_stop_done_running"
@@ -609,11 +929,11 @@ func TestStopDoneRunning(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	traverser.Run()
 
-	err := traverser.Stop()
+	err := traverser.Stop(0)
 	if err != nil {
 		t.Errorf("err = %s, expected nil", err)
 	}
@@ -626,6 +946,127 @@ func TestStopDoneRunning(t *testing.T) {
 	}
 }
 
+// Stop called before Run starts the running reaper must not panic (nil reaper).
+func TestStopBeforeRun(t *testing.T) {
+	requestId := "test_stop_before_run"
+	chainRepo := chain.NewMemoryRepo()
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+			"job2": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+		},
+	}
+	var receivedState byte
+	rmc := &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			receivedState = fr.State
+			return nil
+		},
+	}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
+
+	// Stop blocks until the running reaper stops, which happens in Run
+	stopErrChan := make(chan error)
+	go func() {
+		stopErrChan <- traverser.Stop(0)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+
+	select {
+	case err := <-stopErrChan:
+		if err != nil {
+			t.Errorf("err = %s, expected nil", err)
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("traverser.Stop didn't return within 1 second")
+	}
+	select {
+	case <-doneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("traverser.Run didn't return within 1 second")
+	}
+
+	if receivedState != proto.STATE_STOPPED {
+		t.Errorf("chain state = %d, expected %d", receivedState, proto.STATE_STOPPED)
+	}
+	if c.JobState("job1") != proto.STATE_PENDING {
+		t.Errorf("job1 state = %d, expected %d (not run)", c.JobState("job1"), proto.STATE_PENDING)
+	}
+}
+
+// Shutdown before Run starts the running reaper must suspend the chain, not
+// panic on a nil reaper or hang.
+func TestShutdownBeforeRun(t *testing.T) {
+	requestId := "test_shutdown_before_run"
+	chainRepo := chain.NewMemoryRepo()
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_STOPPED}, RunBlock: make(chan struct{})},
+			"job2": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}},
+		},
+	}
+	sentState := false
+	sentSJC := make(chan struct{})
+	rmc := &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			sentState = true
+			return nil
+		},
+		SuspendRequestFunc: func(reqId string, sjc proto.SuspendedJobChain) error {
+			close(sentSJC)
+			return nil
+		},
+	}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
+
+	close(shutdownChan)
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+
+	select {
+	case <-doneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("traverser.Run didn't return within 1 second")
+	}
+	select {
+	case <-sentSJC:
+	default:
+		t.Errorf("SJC not sent, expected it to be sent")
+	}
+	if sentState {
+		t.Errorf("final chain state sent to RM, expected only SJC to be sent")
+	}
+}
+
 func TestStopAfterSuspend(t *testing.T) {
 	requestId := "test_stop_done_running"
 	chainRepo := chain.NewMemoryRepo()
@@ -657,7 +1098,7 @@ func TestStopAfterSuspend(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	go func() {
 		traverser.Run()
@@ -667,7 +1108,7 @@ func TestStopAfterSuspend(t *testing.T) {
 	close(shutdownChan)
 
 	time.Sleep(10 * time.Millisecond) // give time for traverser.shutdown() to start
-	err := traverser.Stop()
+	err := traverser.Stop(0)
 	if err == nil {
 		t.Errorf("got no error, but expected %s", chain.ErrShuttingDown)
 	} else if err != chain.ErrShuttingDown {
@@ -744,7 +1185,7 @@ func TestSuspend(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 0, "", nil})
 
 	// Start the traverser.
 	doneChan := make(chan struct{})
@@ -844,6 +1285,209 @@ func TestSuspend(t *testing.T) {
 	}
 }
 
+// Shutdown policy "finish": chain finishes within the finish timeout, so it's
+// not suspended.
+func TestShutdownFinish(t *testing.T) {
+	chainRepo := chain.NewMemoryRepo()
+	var runWg sync.WaitGroup
+	runWg.Add(1)
+	requestId := "test_shutdown_finish"
+	job1Block := make(chan struct{})
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{
+				RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE, Tries: 1},
+				RunBlock:  job1Block,
+				RunWg:     &runWg,
+			},
+			"job2": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE, Tries: 1}},
+		},
+	}
+	var finishedState byte
+	rmc := &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			finishedState = fr.State
+			return nil
+		},
+		SuspendRequestFunc: func(reqId string, sjc proto.SuspendedJobChain) error {
+			t.Errorf("SJC sent, expected chain to finish")
+			return nil
+		},
+	}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 5 * time.Second, "", nil})
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+
+	// Shut down while job1 is running, then let job1 finish. The chain keeps
+	// running, so job2 runs, too.
+	runWg.Wait()
+	close(shutdownChan)
+	time.Sleep(100 * time.Millisecond)
+	close(job1Block)
+
+	select {
+	case <-doneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("traverser.Run didn't return within 1 second of job1 finishing")
+	}
+
+	if c.State() != proto.STATE_COMPLETE {
+		t.Errorf("chain state = %d, expected %d", c.State(), proto.STATE_COMPLETE)
+	}
+	if finishedState != proto.STATE_COMPLETE {
+		t.Errorf("finished request state = %d, expected %d", finishedState, proto.STATE_COMPLETE)
+	}
+	if c.JobState("job2") != proto.STATE_COMPLETE {
+		t.Errorf("job2 state = %d, expected %d", c.JobState("job2"), proto.STATE_COMPLETE)
+	}
+}
+
+// Shutdown policy "finish": chain doesn't finish within the finish timeout, so
+// it's suspended.
+func TestShutdownFinishTimeout(t *testing.T) {
+	chainRepo := chain.NewMemoryRepo()
+	var runWg sync.WaitGroup
+	runWg.Add(1)
+	requestId := "test_shutdown_finish_timeout"
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{
+				RunReturn: runner.Return{FinalState: proto.STATE_STOPPED, Tries: 1},
+				RunBlock:  make(chan struct{}),
+				RunWg:     &runWg,
+			},
+		},
+	}
+	receivedSJCChan := make(chan struct{})
+	rmc := &mock.RMClient{
+		SuspendRequestFunc: func(reqId string, sjc proto.SuspendedJobChain) error {
+			close(receivedSJCChan)
+			return nil
+		},
+	}
+	shutdownChan := make(chan struct{})
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, rmc, shutdownChan, timeout, timeout, 200 * time.Millisecond, "", nil})
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+
+	runWg.Wait()
+	close(shutdownChan)
+
+	// Job1 blocks until stopped, so the chain is suspended after 200ms
+	select {
+	case <-receivedSJCChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("SJC not sent within 1 second of shutdown signal")
+	}
+	select {
+	case <-doneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("traverser.Run didn't return within 1 second of SJC sent")
+	}
+
+	if c.State() != proto.STATE_SUSPENDED {
+		t.Errorf("chain state = %d, expected %d", c.State(), proto.STATE_SUSPENDED)
+	}
+	if c.JobState("job1") != proto.STATE_STOPPED {
+		t.Errorf("job1 state = %d, expected %d", c.JobState("job1"), proto.STATE_STOPPED)
+	}
+}
+
+func TestNewShutdownPolicy(t *testing.T) {
+	cfg := config.Shutdown{
+		ShutdownPolicy: config.ShutdownPolicy{
+			Policy:        config.SHUTDOWN_POLICY_FINISH,
+			FinishTimeout: "2m",
+		},
+		RequestTypes: map[string]config.ShutdownPolicy{
+			"suspend-now": {Policy: config.SHUTDOWN_POLICY_SUSPEND},
+			"longer":      {FinishTimeout: "5m"},
+		},
+	}
+	p, err := chain.NewShutdownPolicy(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := p.Timeout("other"); d != 2*time.Minute {
+		t.Errorf("other timeout = %s, expected 2m", d)
+	}
+	if d := p.Timeout("suspend-now"); d != 0 {
+		t.Errorf("suspend-now timeout = %s, expected 0", d)
+	}
+	if d := p.Timeout("longer"); d != 5*time.Minute {
+		t.Errorf("longer timeout = %s, expected 5m", d)
+	}
+	if d := p.Max(); d != 5*time.Minute {
+		t.Errorf("max timeout = %s, expected 5m", d)
+	}
+
+	// Default policy (suspend) doesn't need a timeout
+	_, jrCfg := config.Defaults()
+	p, err = chain.NewShutdownPolicy(jrCfg.Shutdown)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Max() != 0 {
+		t.Errorf("max timeout = %s, expected 0", p.Max())
+	}
+
+	// "finish" requires a timeout
+	cfg = config.Shutdown{ShutdownPolicy: config.ShutdownPolicy{Policy: config.SHUTDOWN_POLICY_FINISH}}
+	if _, err := chain.NewShutdownPolicy(cfg); err == nil {
+		t.Error("no error for finish policy without timeout, expected one")
+	}
+	cfg = config.Shutdown{ShutdownPolicy: config.ShutdownPolicy{Policy: "wait"}}
+	if _, err := chain.NewShutdownPolicy(cfg); err == nil {
+		t.Error("no error for invalid policy, expected one")
+	}
+}
+
+func TestNewTimeouts(t *testing.T) {
+	to, err := chain.NewTimeouts(config.Traverser{StopTimeout: "2m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if to.Stop != 2*time.Minute {
+		t.Errorf("stop timeout = %s, expected 2m", to.Stop)
+	}
+	if to.Send != 10*time.Second { // DEFAULT_TRAVERSER_SEND_TIMEOUT
+		t.Errorf("send timeout = %s, expected 10s", to.Send)
+	}
+
+	for _, cfg := range []config.Traverser{{StopTimeout: "2"}, {SendTimeout: "0s"}} {
+		if _, err := chain.NewTimeouts(cfg); err == nil {
+			t.Errorf("no error for %+v, expected one", cfg)
+		}
+	}
+}
+
 func TestRunning(t *testing.T) {
 	requestId := "test_status"
 	chainRepo := chain.NewMemoryRepo()
@@ -891,7 +1535,7 @@ func TestRunning(t *testing.T) {
 		},
 	}
 	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
-	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, &mock.RMClient{}, make(chan struct{}), timeout, timeout})
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chainRepo, rf, &mock.RMClient{}, make(chan struct{}), timeout, timeout, 0, "", nil})
 
 	// Start the traverser.
 	doneChan := make(chan struct{})
@@ -906,22 +1550,24 @@ func TestRunning(t *testing.T) {
 
 	expectedStatus := []proto.JobStatus{
 		{
-			RequestId: requestId,
-			JobId:     "job2",
-			Type:      "j2type",
-			Name:      "j2name",
-			State:     proto.STATE_RUNNING,
-			Status:    "job2 running",
-			Try:       2,
+			RequestId:   requestId,
+			JobId:       "job2",
+			Type:        "j2type",
+			Name:        "j2name",
+			State:       proto.STATE_RUNNING,
+			Status:      "job2 running",
+			Try:         2,
+			SequenceTry: 1,
 		},
 		{
-			RequestId: requestId,
-			JobId:     "job3",
-			Type:      "j3type",
-			Name:      "j3name",
-			State:     proto.STATE_RUNNING,
-			Status:    "job3 running",
-			Try:       3,
+			RequestId:   requestId,
+			JobId:       "job3",
+			Type:        "j3type",
+			Name:        "j3name",
+			State:       proto.STATE_RUNNING,
+			Status:      "job3 running",
+			Try:         3,
+			SequenceTry: 1,
 		},
 	}
 	gotRunning := traverser.Running()
@@ -932,6 +1578,10 @@ func TestRunning(t *testing.T) {
 			t.Errorf("StartedAt is zero for job %s", j.JobId)
 		}
 		gotRunning[i].StartedAt = 0
+		if j.ChainStartedAt == 0 {
+			t.Errorf("ChainStartedAt is zero for job %s", j.JobId)
+		}
+		gotRunning[i].ChainStartedAt = 0
 	}
 
 	if diff := deep.Equal(gotRunning, expectedStatus); diff != nil {
@@ -950,3 +1600,109 @@ func TestRunning(t *testing.T) {
 		t.Errorf("chain state = %d, expected %d", c.State(), proto.STATE_COMPLETE)
 	}
 }
+
+// StopJob stops the try of one running job, not the chain.
+func TestStopJob(t *testing.T) {
+	var runWg sync.WaitGroup
+	runWg.Add(1)
+	job2 := &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}, RunBlock: make(chan struct{}), RunWg: &runWg}
+	rf := &mock.RunnerFactory{
+		RunnersToReturn: map[string]*mock.Runner{
+			"job1": &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE}, StopTryErr: runner.ErrNotRunning}, // done but maybe not reaped yet
+			"job2": job2,
+		},
+	}
+	jc := &proto.JobChain{
+		RequestId: "test_stop_job",
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	c := chain.NewChain(jc, make(map[string]uint), make(map[string]uint), make(map[string]uint))
+	traverser := chain.NewTraverser(chain.TraverserConfig{c, chain.NewMemoryRepo(), rf, &mock.RMClient{}, make(chan struct{}), timeout, timeout, 0, "", nil})
+
+	doneChan := make(chan struct{})
+	go func() {
+		traverser.Run()
+		close(doneChan)
+	}()
+	runWg.Wait() // job2 running
+
+	if err := traverser.StopJob("job1"); err != chain.ErrJobNotRunning {
+		t.Errorf("err = %v, expected chain.ErrJobNotRunning for job that finished", err)
+	}
+	if err := traverser.StopJob("job2"); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if !job2.TryStopped {
+		t.Errorf("job2 runner StopTry not called")
+	}
+
+	// The chain is not stopped: job2 finishes and the chain completes
+	close(job2.RunBlock)
+	select {
+	case <-doneChan:
+	case <-time.After(time.Second):
+		t.Fatal("traverser did not finish running within 1 second")
+	}
+	if c.State() != proto.STATE_COMPLETE {
+		t.Errorf("chain state = %d, expected %d", c.State(), proto.STATE_COMPLETE)
+	}
+}
+
+// The traverser factory creates the request workspace, every job runner gets it,
+// and it's removed when the chain is done.
+func TestWorkspace(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "spincycle-traverser-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	wm, err := workspace.NewManager(tmpdir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	requestId := "test_workspace"
+	wsDir := filepath.Join(tmpdir, requestId)
+	var gotDirs []string
+	var mux sync.Mutex
+	rf := &mock.RunnerFactory{
+		MakeFunc: func(job proto.Job, cfg runner.Config) (runner.Runner, error) {
+			mux.Lock()
+			defer mux.Unlock()
+			if cfg.Workspace == nil {
+				gotDirs = append(gotDirs, "")
+			} else {
+				gotDirs = append(gotDirs, cfg.Workspace.Dir)
+			}
+			return &mock.Runner{RunReturn: runner.Return{FinalState: proto.STATE_COMPLETE, Tries: 1}}, nil
+		},
+	}
+	tf := chain.NewTraverserFactory(chain.NewMemoryRepo(), rf, &mock.RMClient{}, "", make(chan struct{}), chain.ShutdownPolicy{}, chain.Timeouts{Stop: time.Second, Send: time.Second}, wm)
+
+	jc := &proto.JobChain{
+		RequestId: requestId,
+		Jobs:      testutil.InitJobs(2),
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+	traverser, err := tf.Make(jc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(wsDir); err != nil {
+		t.Errorf("workspace not created: %s", err)
+	}
+
+	traverser.Run()
+
+	if diff := deep.Equal(gotDirs, []string{wsDir, wsDir}); diff != nil {
+		t.Error(diff)
+	}
+	if _, err := os.Stat(wsDir); !os.IsNotExist(err) {
+		t.Errorf("workspace %s not removed (stat error: %v)", wsDir, err)
+	}
+}
@@ -10,7 +10,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/url"
+	"time"
 
+	serr "github.com/square/spincycle/v2/errors"
 	"github.com/square/spincycle/v2/proto"
 )
 
@@ -23,11 +25,36 @@ type Client interface {
 	// resumed. It returns the URL of the running job chain.
 	ResumeJobChain(baseURL string, sjc proto.SuspendedJobChain) (*url.URL, error)
 	// StopRequest stops the job chain that corresponds to a given request Id. The
-	// baseURL should point to the Job Runner running this request.
-	StopRequest(baseURL string, requestId string) error
+	// baseURL should point to the Job Runner running this request. If timeout is
+	// greater than zero, it overrides the stop timeout: how long the Job Runner
+	// waits for running jobs to stop.
+	StopRequest(baseURL string, requestId string, timeout time.Duration) error
+
+	// StopJob stops the current try of one job in the job chain for the given
+	// request Id on the Job Runner at baseURL, without stopping the job chain.
+	// The try fails, so the job is retried if it has tries left. It returns
+	// errors.ErrJobNotRunning if the job is not running a try.
+	StopJob(baseURL string, requestId, jobId string) error
+
+	// SetLogLevel elevates the log level of the job chain for the given request
+	// Id on the Job Runner at baseURL. It returns an error if the job chain is
+	// not running on that Job Runner.
+	SetLogLevel(baseURL string, requestId string, ll proto.RequestLogLevel) error
+
+	// HasJobChain returns true if the job chain for the given request Id is
+	// running on the Job Runner at baseURL, or false if that Job Runner does not
+	// know about it. It returns an error if the Job Runner cannot be reached.
+	HasJobChain(baseURL string, requestId string) (bool, error)
 
 	// Running reports running jobs. If no filters, all requests and jobs are reported.
 	Running(baseURL string, f proto.StatusFilter) ([]proto.JobStatus, error)
+
+	// Drain tells the Job Runner to stop starting new job chains. The baseURL
+	// should point to a specific Job Runner, not a load balancer.
+	Drain(baseURL string) error
+
+	// Ping returns nil if the Job Runner is up and responding.
+	Ping(baseURL string) error
 }
 
 type client struct {
@@ -47,14 +74,10 @@ func (c *client) NewJobChain(baseURL string, jobChain proto.JobChain) (*url.URL,
 	// POST /api/v1/job-chains
 	url := baseURL + "/api/v1/job-chains"
 
-	// Create the payload.
-	payload, err := json.Marshal(jobChain)
-	if err != nil {
-		return chainURL, err
-	}
-
 	// Make the request.
-	resp, body, err := c.post(url, payload)
+	resp, body, err := c.postChain(url, func(format string) ([]byte, error) {
+		return proto.EncodeJobChain(jobChain, format)
+	})
 	if err != nil {
 		return chainURL, err
 	}
@@ -79,14 +102,10 @@ func (c *client) ResumeJobChain(baseURL string, sjc proto.SuspendedJobChain) (*u
 	// POST /api/v1/job-chains/resume
 	url := baseURL + "/api/v1/job-chains/resume"
 
-	// Create the payload.
-	payload, err := json.Marshal(sjc)
-	if err != nil {
-		return chainURL, err
-	}
-
 	// Make the request.
-	resp, body, err := c.post(url, payload)
+	resp, body, err := c.postChain(url, func(format string) ([]byte, error) {
+		return proto.EncodeSuspendedJobChain(sjc, format)
+	})
 	if err != nil {
 		return chainURL, err
 	}
@@ -105,12 +124,15 @@ func (c *client) ResumeJobChain(baseURL string, sjc proto.SuspendedJobChain) (*u
 	return chainURL, nil
 }
 
-func (c *client) StopRequest(baseURL string, requestId string) error {
+func (c *client) StopRequest(baseURL string, requestId string, timeout time.Duration) error {
 	// PUT /api/v1/job-chains/${requestId}/stop
 	url := fmt.Sprintf(baseURL+"/api/v1/job-chains/%s/stop", requestId)
+	if timeout > 0 {
+		url += "?timeout=" + timeout.String()
+	}
 
 	// Make the request.
-	resp, body, err := c.put(url)
+	resp, body, err := c.put(url, nil)
 	if err != nil {
 		return err
 	}
@@ -122,6 +144,56 @@ func (c *client) StopRequest(baseURL string, requestId string) error {
 	return nil
 }
 
+func (c *client) StopJob(baseURL string, requestId, jobId string) error {
+	// PUT /api/v1/job-chains/${requestId}/jobs/${jobId}/stop
+	url := fmt.Sprintf(baseURL+"/api/v1/job-chains/%s/jobs/%s/stop", requestId, jobId)
+	resp, body, err := c.put(url, nil)
+	if err != nil {
+		return err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return nil
+	case http.StatusConflict:
+		return serr.ErrJobNotRunning{RequestId: requestId, JobId: jobId}
+	default:
+		return fmt.Errorf("unsuccessful status code: %d (response body: %s)", resp.StatusCode, string(body))
+	}
+}
+
+func (c *client) SetLogLevel(baseURL string, requestId string, ll proto.RequestLogLevel) error {
+	// PUT /api/v1/job-chains/${requestId}/log-level
+	url := fmt.Sprintf(baseURL+"/api/v1/job-chains/%s/log-level", requestId)
+	payload, err := json.Marshal(ll)
+	if err != nil {
+		return err
+	}
+	resp, body, err := c.put(url, payload)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unsuccessful status code: %d (response body: %s)", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (c *client) HasJobChain(baseURL string, requestId string) (bool, error) {
+	// GET /api/v1/job-chains/${requestId}
+	resp, body, err := c.get(baseURL + "/api/v1/job-chains/" + requestId)
+	if err != nil {
+		return false, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("unsuccessful status code: %d (response body: %s)", resp.StatusCode, string(body))
+	}
+}
+
 func (c *client) Running(baseURL string, f proto.StatusFilter) ([]proto.JobStatus, error) {
 	// GET /api/v1/job-chains/${requestId}/status
 	url := baseURL + "/api/v1/status/running" + f.String()
@@ -139,6 +211,30 @@ func (c *client) Running(baseURL string, f proto.StatusFilter) ([]proto.JobStatu
 	return status, nil
 }
 
+func (c *client) Drain(baseURL string) error {
+	// PUT /api/v1/drain
+	resp, body, err := c.put(baseURL+"/api/v1/drain", nil)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unsuccessful status code: %d (response body: %s)", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
+func (c *client) Ping(baseURL string) error {
+	// GET /version
+	resp, body, err := c.get(baseURL + "/version")
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unsuccessful status code: %d (response body: %s)", resp.StatusCode, string(body))
+	}
+	return nil
+}
+
 // ------------------------------------------------------------------------- //
 
 func (c *client) get(url string) (*http.Response, []byte, error) {
@@ -157,9 +253,9 @@ func (c *client) get(url string) (*http.Response, []byte, error) {
 	return resp, body, nil
 }
 
-func (c *client) put(url string) (*http.Response, []byte, error) {
+func (c *client) put(url string, payload []byte) (*http.Response, []byte, error) {
 	// Create the request.
-	req, err := http.NewRequest("PUT", url, nil)
+	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, nil, err
 	}
@@ -173,12 +269,36 @@ func (c *client) put(url string) (*http.Response, []byte, error) {
 	return resp, body, nil
 }
 
-func (c *client) post(url string, payload []byte) (*http.Response, []byte, error) {
+// postChain posts a job chain or suspended job chain encoded in the chain format
+// (proto.ChainFormat). If the Job Runner does not support the format (HTTP 415
+// Unsupported Media Type), like an older Job Runner during a rolling upgrade,
+// the chain is posted again as JSON.
+func (c *client) postChain(url string, encode func(format string) ([]byte, error)) (*http.Response, []byte, error) {
+	format := proto.ChainFormat()
+	for {
+		payload, err := encode(format)
+		if err != nil {
+			return nil, nil, err
+		}
+		resp, body, err := c.post(url, proto.ContentType(format), payload)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode == http.StatusUnsupportedMediaType && format != proto.CHAIN_FORMAT_JSON {
+			format = proto.CHAIN_FORMAT_JSON
+			continue
+		}
+		return resp, body, nil
+	}
+}
+
+func (c *client) post(url, contentType string, payload []byte) (*http.Response, []byte, error) {
 	// Create the request.
 	req, err := http.NewRequest("POST", url, bytes.NewBuffer(payload))
 	if err != nil {
 		return nil, nil, err
 	}
+	req.Header.Set("Content-Type", contentType)
 
 	// Send the request.
 	resp, body, err := c.do(req)
@@ -190,7 +310,9 @@ func (c *client) post(url string, payload []byte) (*http.Response, []byte, error
 }
 
 func (c *client) do(req *http.Request) (*http.Response, []byte, error) {
-	req.Header.Set("Content-Type", "application/json")
+	if req.Header.Get("Content-Type") == "" {
+		req.Header.Set("Content-Type", proto.CONTENT_TYPE_JSON)
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return nil, nil, fmt.Errorf("http.Client.Do: %s", err)
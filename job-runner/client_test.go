@@ -8,8 +8,10 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
+	serr "github.com/square/spincycle/v2/errors"
 	jr "github.com/square/spincycle/v2/job-runner"
 	"github.com/square/spincycle/v2/proto"
 )
@@ -87,6 +89,68 @@ func TestNewJobChain(t *testing.T) {
 	}
 }
 
+func TestNewJobChainProtobuf(t *testing.T) {
+	proto.SetChainFormat(proto.CHAIN_FORMAT_PROTOBUF)
+	defer proto.SetChainFormat(proto.CHAIN_FORMAT_JSON)
+
+	jc := proto.JobChain{
+		RequestId: "4",
+		Jobs: map[string]proto.Job{
+			"job1": {Id: "job1", Type: "type1", Args: map[string]interface{}{"host": "db1"}},
+		},
+		AdjacencyList: map[string][]string{"job1": {}},
+		State:         proto.STATE_PENDING,
+	}
+
+	// Old JR that does not support protobuf: 415, then the chain is sent as JSON
+	var contentTypes []string
+	var payload proto.JobChain
+	supported := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		if r.Header.Get("Content-Type") == proto.CONTENT_TYPE_PROTOBUF && !supported {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = proto.JobChain{}
+		if err := proto.DecodeJobChain(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		w.Header().Add("Location", "location")
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer ts.Close()
+	c := jr.NewClient(&http.Client{})
+
+	if _, err := c.NewJobChain(ts.URL, jc); err != nil {
+		t.Fatalf("err = %s, expected nil", err)
+	}
+	expect := []string{proto.CONTENT_TYPE_PROTOBUF, proto.CONTENT_TYPE_JSON}
+	if diff := deep.Equal(contentTypes, expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(payload, jc); diff != nil {
+		t.Error(diff)
+	}
+
+	// JR that supports protobuf
+	supported = true
+	contentTypes = nil
+	if _, err := c.NewJobChain(ts.URL, jc); err != nil {
+		t.Fatalf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(contentTypes, []string{proto.CONTENT_TYPE_PROTOBUF}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(payload, jc); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func TestResumeJobChain(t *testing.T) {
 	// Make a job chain.
 	jc := proto.JobChain{
@@ -179,7 +243,7 @@ func TestStopRequest(t *testing.T) {
 	}))
 	c := jr.NewClient(&http.Client{})
 
-	err := c.StopRequest(ts.URL, "2")
+	err := c.StopRequest(ts.URL, "2", 0)
 	if err == nil {
 		t.Errorf("expected an error but did not get one")
 	}
@@ -188,14 +252,16 @@ func TestStopRequest(t *testing.T) {
 	// Successful response status code.
 	var path string
 	var method string
+	var timeout string
 	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		path = r.URL.Path
 		method = r.Method
+		timeout = r.URL.Query().Get("timeout")
 		w.WriteHeader(http.StatusOK)
 	}))
 	c = jr.NewClient(&http.Client{})
 
-	err = c.StopRequest(ts.URL, "2")
+	err = c.StopRequest(ts.URL, "2", 5*time.Minute)
 	if err != nil {
 		t.Errorf("err = %s, expected nil", err)
 	}
@@ -209,6 +275,121 @@ func TestStopRequest(t *testing.T) {
 	if method != "PUT" {
 		t.Errorf("request method = %s, expected POST", method)
 	}
+
+	if timeout != "5m0s" {
+		t.Errorf("timeout = %s, expected 5m0s", timeout)
+	}
+}
+
+func TestStopJob(t *testing.T) {
+	var path, method string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		method = r.Method
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	c := jr.NewClient(&http.Client{})
+
+	if err := c.StopJob(ts.URL, "2", "job1"); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if path != "/api/v1/job-chains/2/jobs/job1/stop" || method != "PUT" {
+		t.Errorf("got %s %s, expected PUT /api/v1/job-chains/2/jobs/job1/stop", method, path)
+	}
+
+	// 409: job not running
+	status = http.StatusConflict
+	err := c.StopJob(ts.URL, "2", "job1")
+	if _, ok := err.(serr.ErrJobNotRunning); !ok {
+		t.Errorf("err = %v, expected errors.ErrJobNotRunning", err)
+	}
+
+	status = http.StatusInternalServerError
+	if err := c.StopJob(ts.URL, "2", "job1"); err == nil {
+		t.Errorf("expected an error but did not get one")
+	}
+}
+func TestSetLogLevel(t *testing.T) {
+	var path string
+	var method string
+	var payload proto.RequestLogLevel
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		method = r.Method
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := json.Unmarshal(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	c := jr.NewClient(&http.Client{})
+
+	ll := proto.RequestLogLevel{Level: "debug", Duration: "5m"}
+	if err := c.SetLogLevel(ts.URL, "2", ll); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	expectedPath := "/api/v1/job-chains/2/log-level"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+	if method != "PUT" {
+		t.Errorf("request method = %s, expected PUT", method)
+	}
+	if diff := deep.Equal(payload, ll); diff != nil {
+		t.Error(diff)
+	}
+
+	// 404: job chain not running on the JR
+	status = http.StatusNotFound
+	if err := c.SetLogLevel(ts.URL, "2", ll); err == nil {
+		t.Errorf("expected an error but did not get one")
+	}
+}
+
+func TestHasJobChain(t *testing.T) {
+	var path string
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	c := jr.NewClient(&http.Client{})
+
+	has, err := c.HasJobChain(ts.URL, "2")
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if !has {
+		t.Errorf("has = false, expected true")
+	}
+	expectedPath := "/api/v1/job-chains/2"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	// 404: JR doesn't have the job chain, which is not an error
+	status = http.StatusNotFound
+	has, err = c.HasJobChain(ts.URL, "2")
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if has {
+		t.Errorf("has = true, expected false")
+	}
+
+	// Any other status is an error because we don't know
+	status = http.StatusInternalServerError
+	if _, err = c.HasJobChain(ts.URL, "2"); err == nil {
+		t.Errorf("expected an error but did not get one")
+	}
 }
 
 func TestRunning(t *testing.T) {
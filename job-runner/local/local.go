@@ -0,0 +1,126 @@
+// Copyright 2020, Square, Inc.
+
+// Package local runs a job chain in-process, like an embedded Job Runner without
+// a Request Manager or database. It's used by 'spinc local' so job and spec
+// developers can run requests on a laptop.
+package local
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/proto"
+	rm "github.com/square/spincycle/v2/request-manager"
+)
+
+type Config struct {
+	// JobFactory makes the jobs in the job chain. It's usually the same job
+	// factory as the Job Runner: jobs.Factory wrapped by wait.NewFactory and poll.NewFactory.
+	JobFactory job.Factory
+
+	// OnJobLog is called after every job try, in the order that tries finish.
+	// It's optional.
+	OnJobLog func(proto.JobLog)
+
+	// StopChan stops the job chain when closed, like stopping a request. It's
+	// optional.
+	StopChan <-chan struct{}
+}
+
+// Result is the result of running a job chain.
+type Result struct {
+	State   byte           // final state of the job chain
+	JobLogs []proto.JobLog // every job try, in the order they finished
+}
+
+// Run runs the job chain and returns when it's done. Jobs run like they do in
+// the Job Runner: in order, in parallel, with retries and sequence retries, and
+// with the scratch store. A request deadline in the job chain is enforced.
+//
+// An error is returned only if the job chain cannot be run, for example if it's
+// invalid. A job chain that runs and fails returns a Result with a failed state.
+func Run(jc *proto.JobChain, cfg Config) (Result, error) {
+	if cfg.JobFactory == nil {
+		return Result{}, fmt.Errorf("no job factory")
+	}
+
+	rmc := &localClient{
+		mux:      &sync.Mutex{},
+		onJobLog: cfg.OnJobLog,
+		done:     make(chan struct{}),
+	}
+	if err := chain.Validate(*jc, true); err != nil {
+		return Result{}, fmt.Errorf("invalid job chain: %s", err)
+	}
+	c := chain.NewChain(jc, map[string]uint{}, map[string]uint{}, map[string]uint{})
+	repo := chain.NewMemoryRepo()
+	if err := repo.Add(c); err != nil {
+		return Result{}, err
+	}
+	t := chain.NewTraverser(chain.TraverserConfig{
+		Chain:         c,
+		ChainRepo:     repo,
+		RunnerFactory: runner.NewFactory(runner.FactoryConfig{JobFactory: cfg.JobFactory, RMClient: rmc}),
+		RMClient:      rmc,
+		ShutdownChan:  make(chan struct{}),
+		StopTimeout:   10 * time.Second,
+		SendTimeout:   10 * time.Second,
+	})
+
+	if cfg.StopChan != nil {
+		go func() {
+			select {
+			case <-cfg.StopChan:
+				t.Stop(0)
+			case <-rmc.done:
+			}
+		}()
+	}
+	t.Run()
+
+	rmc.mux.Lock()
+	defer rmc.mux.Unlock()
+	return Result{State: rmc.state, JobLogs: rmc.jls}, nil
+}
+
+// localClient is the RM client for a local job chain. It saves job logs and the
+// final state of the chain. The traverser does not call other methods, except
+// to suspend the chain, which is not possible locally.
+type localClient struct {
+	rm.Client // nil
+	mux       *sync.Mutex
+	onJobLog  func(proto.JobLog)
+	jls       []proto.JobLog
+	state     byte
+	done      chan struct{}
+}
+
+func (c *localClient) CreateJL(requestId string, jl proto.JobLog) error {
+	c.mux.Lock()
+	c.jls = append(c.jls, jl)
+	c.mux.Unlock()
+	if c.onJobLog != nil {
+		c.onJobLog(jl)
+	}
+	return nil
+}
+
+func (c *localClient) FinishRequest(fr proto.FinishRequest) error {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.state = fr.State
+	select {
+	case <-c.done:
+	default:
+		close(c.done)
+	}
+	return nil
+}
+
+func (c *localClient) SuspendRequest(requestId string, sjc proto.SuspendedJobChain) error {
+	return fmt.Errorf("cannot suspend local job chain")
+}
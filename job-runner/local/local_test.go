@@ -0,0 +1,80 @@
+// Copyright 2020, Square, Inc.
+
+package local_test
+
+import (
+	"testing"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/local"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func testChain(jobType string) *proto.JobChain {
+	return &proto.JobChain{
+		RequestId:   "abc",
+		RequestType: "test",
+		State:       proto.STATE_PENDING,
+		Jobs: map[string]proto.Job{
+			"job1": {Id: "job1", Name: "first", Type: jobType, SequenceId: "job1", State: proto.STATE_PENDING},
+			"job2": {Id: "job2", Name: "second", Type: jobType, SequenceId: "job1", State: proto.STATE_PENDING},
+		},
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+		},
+	}
+}
+
+func TestRun(t *testing.T) {
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"ok": {RunReturn: job.Return{State: proto.STATE_COMPLETE}},
+		},
+	}
+	var progress []string
+	res, err := local.Run(testChain("ok"), local.Config{
+		JobFactory: jf,
+		OnJobLog: func(jl proto.JobLog) {
+			progress = append(progress, jl.JobId)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != proto.STATE_COMPLETE {
+		t.Errorf("got state %s, expected COMPLETE", proto.StateName[res.State])
+	}
+	if len(res.JobLogs) != 2 {
+		t.Errorf("got %d job logs, expected 2", len(res.JobLogs))
+	}
+	if len(progress) != 2 || progress[0] != "job1" || progress[1] != "job2" {
+		t.Errorf("got progress %v, expected [job1 job2]", progress)
+	}
+}
+
+func TestRunFail(t *testing.T) {
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"fail": {RunReturn: job.Return{State: proto.STATE_FAIL}},
+		},
+	}
+	res, err := local.Run(testChain("fail"), local.Config{JobFactory: jf})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != proto.STATE_FAIL {
+		t.Errorf("got state %s, expected FAIL", proto.StateName[res.State])
+	}
+	if len(res.JobLogs) != 1 {
+		t.Errorf("got %d job logs, expected 1 (second job should not run)", len(res.JobLogs))
+	}
+}
+
+func TestRunInvalidChain(t *testing.T) {
+	jc := testChain("ok")
+	jc.AdjacencyList["job2"] = []string{"job1"} // cycle
+	if _, err := local.Run(jc, local.Config{JobFactory: &mock.JobFactory{}}); err == nil {
+		t.Error("no error running invalid job chain, expected an error")
+	}
+}
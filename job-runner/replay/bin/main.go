@@ -0,0 +1,174 @@
+// Copyright 2020, Square, Inc.
+
+// replay re-runs jobs from a Job Runner recording (config.Debug.RecordDir). It
+// must be built with the same jobs package as the Job Runner.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/job-runner/replay"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/job/wait"
+	"github.com/square/spincycle/v2/jobs"
+	"github.com/square/spincycle/v2/proto"
+)
+
+const usage = `Usage: replay [options] FILE
+
+Re-run jobs from a Job Runner recording file (<request ID>.jsonl in debug.record_dir).
+Real jobs run with real side effects. Other jobs are fake: they return their recorded
+output without running.
+
+Options:
+`
+
+func main() {
+	list := flag.Bool("list", false, "List jobs and their recorded tries")
+	jobId := flag.String("job", "", "Re-run only this job ID with its recorded input")
+	from := flag.String("from", "", "Re-run the job chain from this job ID: it and all jobs after it are real")
+	run := flag.String("run", "", "Re-run the job chain: comma-separated job IDs are real")
+	verbose := flag.Bool("v", false, "Log job chain traversal")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(1)
+	}
+	if !*verbose {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	rec, err := replay.Load(flag.Arg(0))
+	if err != nil {
+		fatal(err)
+	}
+
+	switch {
+	case *list:
+		listJobs(rec)
+	case *jobId != "":
+		replayJob(rec, *jobId)
+	case *from != "":
+		if _, ok := rec.JobChain.Jobs[*from]; !ok {
+			fatal(fmt.Errorf("job %s not in job chain", *from))
+		}
+		replayChain(rec, rec.SubChain(*from))
+	case *run != "":
+		ids := map[string]bool{}
+		for _, id := range strings.Split(*run, ",") {
+			if _, ok := rec.JobChain.Jobs[id]; !ok {
+				fatal(fmt.Errorf("job %s not in job chain", id))
+			}
+			ids[id] = true
+		}
+		replayChain(rec, ids)
+	default:
+		flag.Usage()
+		os.Exit(1)
+	}
+}
+
+func listJobs(rec replay.Recording) {
+	fmt.Printf("Request %s (%s): %d jobs, %d tries recorded\n", rec.JobChain.RequestId, rec.JobChain.RequestType, len(rec.JobChain.Jobs), len(rec.Tries))
+	for _, try := range rec.Tries {
+		fmt.Printf("  %-20s %-30s %-30s %s\n", try.JobId, try.Name, try.Type, proto.StateName[try.State])
+	}
+}
+
+func replayJob(rec replay.Recording, jobId string) {
+	res, err := replay.Job(rec, jobId, wait.NewFactory(poll.NewFactory(jobs.Factory)))
+	if err != nil {
+		fatal(err)
+	}
+	try, _ := rec.LastTry(jobId)
+	fmt.Printf("Job %s (%s): state %s (recorded %s), exit %d (recorded %d)\n",
+		try.Name, jobId, proto.StateName[res.Return.State], proto.StateName[try.State], res.Return.Exit, try.Exit)
+	if res.Error != nil {
+		fmt.Printf("Error: %s\n", res.Error)
+	} else if res.Return.Error != nil {
+		fmt.Printf("Error: %s\n", res.Return.Error)
+	}
+	if res.Return.Stdout != "" {
+		fmt.Printf("Stdout:\n%s\n", res.Return.Stdout)
+	}
+	if res.Return.Stderr != "" {
+		fmt.Printf("Stderr:\n%s\n", res.Return.Stderr)
+	}
+
+	// Compare output job data. It's round-tripped through JSON so values have
+	// the same types as the recorded output.
+	var recorded, output map[string]interface{}
+	json.Unmarshal(try.Output, &recorded)
+	bytes, err := json.Marshal(res.Output)
+	if err != nil {
+		fatal(fmt.Errorf("cannot encode output job data: %s", err))
+	}
+	json.Unmarshal(bytes, &output)
+	diff := diffData(recorded, output)
+	if len(diff) == 0 {
+		fmt.Println("Output job data: same as recorded")
+		return
+	}
+	fmt.Println("Output job data: different than recorded:")
+	for _, d := range diff {
+		fmt.Println("  " + d)
+	}
+}
+
+func replayChain(rec replay.Recording, run map[string]bool) {
+	res, err := replay.Chain(rec, run, wait.NewFactory(poll.NewFactory(jobs.Factory)))
+	if err != nil {
+		fatal(err)
+	}
+	for _, jl := range res.JobLogs {
+		fmt.Printf("  %-20s %-30s %-10s %s\n", jl.JobId, jl.Name, proto.StateName[jl.State], jl.Error)
+	}
+	fmt.Printf("Job chain: %s\n", proto.StateName[res.State])
+	if res.State != proto.STATE_COMPLETE {
+		os.Exit(1)
+	}
+}
+
+// diffData returns the keys that are different between job data a (recorded)
+// and b (replayed), sorted.
+func diffData(a, b map[string]interface{}) []string {
+	keys := map[string]bool{}
+	for k := range a {
+		keys[k] = true
+	}
+	for k := range b {
+		keys[k] = true
+	}
+	diff := []string{}
+	for k := range keys {
+		va, inA := a[k]
+		vb, inB := b[k]
+		switch {
+		case !inA:
+			diff = append(diff, fmt.Sprintf("+ %s: %v", k, vb))
+		case !inB:
+			diff = append(diff, fmt.Sprintf("- %s: %v", k, va))
+		case !reflect.DeepEqual(va, vb):
+			diff = append(diff, fmt.Sprintf("~ %s: %v -> %v", k, va, vb))
+		}
+	}
+	sort.Slice(diff, func(i, j int) bool { return diff[i][2:] < diff[j][2:] })
+	return diff
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "replay: %s\n", err)
+	os.Exit(1)
+}
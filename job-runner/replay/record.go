@@ -0,0 +1,223 @@
+// Copyright 2020, Square, Inc.
+
+// Package replay records and replays job chains for debugging. In debug mode
+// (config.Debug.RecordDir), the Job Runner records every job chain and every job
+// try: the job data before (input) and after (output) the job runs, and what the
+// job returned. The replay command (bin/) re-runs a single job or a sub-chain
+// locally from a recording, with fake runners for all other jobs that return
+// their recorded output instead of running. This makes it quick to debug how job
+// data is threaded through a chain without re-running the whole request.
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// A Record is one line in a recording file. Only one field is set: JobChain when
+// the Job Runner receives a job chain (new or resumed), or Try when a job try is
+// done.
+type Record struct {
+	Time     time.Time       `json:"time"`
+	JobChain *proto.JobChain `json:"jobChain,omitempty"`
+	Try      *Try            `json:"try,omitempty"`
+}
+
+// A Try is one run of a job: its input and output job data, and what it returned.
+// Input and Output are the jobData map (job.Job.Run) encoded as JSON.
+type Try struct {
+	RequestId  string          `json:"requestId"`
+	JobId      string          `json:"jobId"`
+	Name       string          `json:"name"`
+	Type       string          `json:"type"`
+	Input      json.RawMessage `json:"input,omitempty"`
+	Output     json.RawMessage `json:"output,omitempty"`
+	StartedAt  int64           `json:"startedAt"`
+	FinishedAt int64           `json:"finishedAt"`
+	State      byte            `json:"state"`
+	Exit       int64           `json:"exit"`
+	Error      string          `json:"error,omitempty"`
+	Stdout     string          `json:"stdout,omitempty"`
+	Stderr     string          `json:"stderr,omitempty"`
+}
+
+// A Recorder records job chains and job tries to files in a directory, one file
+// per request named <request ID>.jsonl, one Record per line. A resumed request is
+// appended to the same file.
+type Recorder struct {
+	dir string
+	mux *sync.Mutex
+}
+
+// NewRecorder returns a Recorder that records to files in dir, which is created
+// if it does not exist.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Recorder{
+		dir: dir,
+		mux: &sync.Mutex{},
+	}, nil
+}
+
+// File returns the recording file for the request.
+func (r *Recorder) File(requestId string) string {
+	return filepath.Join(r.dir, requestId+".jsonl")
+}
+
+// RecordChain records the job chain.
+func (r *Recorder) RecordChain(jc proto.JobChain) error {
+	return r.write(jc.RequestId, Record{Time: time.Now().UTC(), JobChain: &jc})
+}
+
+// RecordTry records the job try.
+func (r *Recorder) RecordTry(try Try) error {
+	return r.write(try.RequestId, Record{Time: time.Now().UTC(), Try: &try})
+}
+
+// JobFactory returns a job.Factory that makes jobs with jf and records every run
+// of every job.
+func (r *Recorder) JobFactory(jf job.Factory) job.Factory {
+	return &jobFactory{jf: jf, r: r}
+}
+
+// TraverserFactory returns a chain.TraverserFactory that records every job chain
+// and then makes a traverser for it with tf.
+func (r *Recorder) TraverserFactory(tf chain.TraverserFactory) chain.TraverserFactory {
+	return &traverserFactory{tf: tf, r: r}
+}
+
+func (r *Recorder) write(requestId string, rec Record) error {
+	bytes, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	f, err := os.OpenFile(r.File(requestId), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(bytes, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// --------------------------------------------------------------------------
+
+type traverserFactory struct {
+	tf chain.TraverserFactory
+	r  *Recorder
+}
+
+func (f *traverserFactory) Make(jc *proto.JobChain) (chain.Traverser, error) {
+	if err := f.r.RecordChain(*jc); err != nil {
+		log.WithFields(log.Fields{"request_id": jc.RequestId}).Warnf("cannot record job chain: %s", err)
+	}
+	return f.tf.Make(jc)
+}
+
+func (f *traverserFactory) MakeFromSJC(sjc *proto.SuspendedJobChain) (chain.Traverser, error) {
+	if sjc.JobChain != nil {
+		if err := f.r.RecordChain(*sjc.JobChain); err != nil {
+			log.WithFields(log.Fields{"request_id": sjc.RequestId}).Warnf("cannot record job chain: %s", err)
+		}
+	}
+	return f.tf.MakeFromSJC(sjc)
+}
+
+type jobFactory struct {
+	jf job.Factory
+	r  *Recorder
+}
+
+func (f *jobFactory) Make(id job.Id) (job.Job, error) {
+	j, err := f.jf.Make(id)
+	if err != nil {
+		return nil, err
+	}
+	return &recordedJob{Job: j, r: f.r}, nil
+}
+
+// recordedJob records every run of the job. It implements job.ContextJob so the
+// runner passes it a context, which is passed to the job if the job implements
+// job.ContextJob, too.
+type recordedJob struct {
+	job.Job
+	r *Recorder
+}
+
+func (j *recordedJob) Run(jobData map[string]interface{}) (job.Return, error) {
+	return j.RunContext(context.Background(), jobData)
+}
+
+func (j *recordedJob) RunContext(ctx context.Context, jobData map[string]interface{}) (ret job.Return, err error) {
+	id := j.Job.Id()
+	try := Try{
+		RequestId: id.RequestId,
+		JobId:     id.Id,
+		Name:      id.Name,
+		Type:      id.Type,
+		Input:     encode(jobData),
+		StartedAt: time.Now().UnixNano(),
+	}
+
+	// Record the try even if the job panics, then let the runner recover from
+	// the panic like usual
+	defer func() {
+		panicErr := recover()
+		try.FinishedAt = time.Now().UnixNano()
+		try.Output = encode(jobData)
+		if panicErr != nil {
+			try.State = proto.STATE_FAIL
+			try.Exit = 1
+			try.Error = fmt.Sprintf("panic from job.Run: %v", panicErr)
+		} else {
+			try.State = ret.State
+			try.Exit = ret.Exit
+			try.Stdout = ret.Stdout
+			try.Stderr = ret.Stderr
+			if err != nil {
+				try.Error = err.Error()
+			} else if ret.Error != nil {
+				try.Error = ret.Error.Error()
+			}
+		}
+		if rerr := j.r.RecordTry(try); rerr != nil {
+			log.WithFields(log.Fields{"request_id": id.RequestId, "job_id": id.Id}).Warnf("cannot record job try: %s", rerr)
+		}
+		if panicErr != nil {
+			panic(panicErr)
+		}
+	}()
+
+	if ctxJob, ok := j.Job.(job.ContextJob); ok {
+		return ctxJob.RunContext(ctx, jobData)
+	}
+	return j.Job.Run(jobData)
+}
+
+// encode returns the job data encoded as JSON, or nil if it cannot be encoded.
+// Job data must be JSON-encodable because it's sent in suspended job chains, too.
+func encode(jobData map[string]interface{}) json.RawMessage {
+	bytes, err := json.Marshal(jobData)
+	if err != nil {
+		log.Warnf("cannot record job data: %s", err)
+		return nil
+	}
+	return bytes
+}
@@ -0,0 +1,306 @@
+// Copyright 2020, Square, Inc.
+
+package replay
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/proto"
+	rm "github.com/square/spincycle/v2/request-manager"
+)
+
+// Max bytes of one line in a recording file. Lines are long because job data
+// and output are recorded.
+const maxLineSize = 64 << 20 // 64 MiB
+
+// A Recording is a recorded request loaded from a recording file.
+type Recording struct {
+	JobChain proto.JobChain // first job chain recorded
+	Tries    []Try          // all job tries, in the order they finished
+}
+
+// Load loads a recording file written by a Recorder.
+func Load(file string) (Recording, error) {
+	var rec Recording
+	f, err := os.Open(file)
+	if err != nil {
+		return rec, err
+	}
+	defer f.Close()
+
+	haveChain := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		var r Record
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			return rec, fmt.Errorf("%s line %d: %s", file, lineNo, err)
+		}
+		if r.JobChain != nil && !haveChain {
+			rec.JobChain = *r.JobChain
+			haveChain = true
+		}
+		if r.Try != nil {
+			rec.Tries = append(rec.Tries, *r.Try)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return rec, fmt.Errorf("%s: %s", file, err)
+	}
+	if !haveChain {
+		return rec, fmt.Errorf("%s: no job chain recorded", file)
+	}
+	return rec, nil
+}
+
+// LastTry returns the last recorded try of the job, or false if the job was
+// not run.
+func (rec Recording) LastTry(jobId string) (Try, bool) {
+	for i := len(rec.Tries) - 1; i >= 0; i-- {
+		if rec.Tries[i].JobId == jobId {
+			return rec.Tries[i], true
+		}
+	}
+	return Try{}, false
+}
+
+// SubChain returns the IDs of the job and all jobs after it in the job chain.
+func (rec Recording) SubChain(jobId string) map[string]bool {
+	ids := map[string]bool{}
+	next := []string{jobId}
+	for len(next) > 0 {
+		id := next[0]
+		next = next[1:]
+		if ids[id] {
+			continue
+		}
+		ids[id] = true
+		next = append(next, rec.JobChain.AdjacencyList[id]...)
+	}
+	return ids
+}
+
+// JobResult is the result of replaying one job.
+type JobResult struct {
+	Return job.Return             // returned by the job
+	Error  error                  // returned by the job, or panic
+	Output map[string]interface{} // job data after the job ran
+}
+
+// Job re-runs the job with the input job data of its last recorded try. The job
+// is made by jf, like the Job Runner makes it. An error is returned if the job
+// cannot be made or does not have a recorded try; errors from the job are
+// returned in the JobResult.
+func Job(rec Recording, jobId string, jf job.Factory) (JobResult, error) {
+	var res JobResult
+	pJob, ok := rec.JobChain.Jobs[jobId]
+	if !ok {
+		return res, fmt.Errorf("job %s not in job chain", jobId)
+	}
+	try, ok := rec.LastTry(jobId)
+	if !ok {
+		return res, fmt.Errorf("job %s (%s) has no recorded try", pJob.Name, jobId)
+	}
+	jobData, err := decode(try.Input)
+	if err != nil {
+		return res, fmt.Errorf("cannot decode recorded input of job %s: %s", jobId, err)
+	}
+	realJob, err := makeJob(jf, pJob, rec.JobChain.RequestId)
+	if err != nil {
+		return res, err
+	}
+
+	res.Output = jobData
+	defer func() {
+		if panicErr := recover(); panicErr != nil {
+			res.Return = job.Return{State: proto.STATE_FAIL, Exit: 1, Stderr: string(debug.Stack())}
+			res.Error = fmt.Errorf("panic from job.Run: %v", panicErr)
+		}
+	}()
+	if ctxJob, ok := realJob.(job.ContextJob); ok {
+		res.Return, res.Error = ctxJob.RunContext(context.Background(), jobData)
+	} else {
+		res.Return, res.Error = realJob.Run(jobData)
+	}
+	return res, nil
+}
+
+// ChainResult is the result of replaying a job chain.
+type ChainResult struct {
+	State   byte           // final state of the job chain
+	JobLogs []proto.JobLog // of jobs that ran, not fake jobs
+}
+
+// Chain re-runs the job chain locally with a chain traverser, like the Job Runner
+// runs it. Jobs in run are real: they are made by jf and run. All other jobs are
+// fake: they return the state and output job data of their last recorded try
+// without running. Use Recording.SubChain to run a job and all jobs after it.
+// Request deadlines are ignored.
+//
+// An error is returned only if the job chain cannot be run. A fake job that was
+// not recorded fails.
+func Chain(rec Recording, run map[string]bool, jf job.Factory) (ChainResult, error) {
+	// Copy the chain and make it ready to run. Completed jobs not re-run are
+	// left complete: they were completed before the recording (the request
+	// was resumed) so they don't have a recorded try.
+	jc := rec.JobChain
+	jc.Deadline = nil
+	jc.State = proto.STATE_PENDING
+	jc.Jobs = make(map[string]proto.Job, len(rec.JobChain.Jobs))
+	for id, j := range rec.JobChain.Jobs {
+		if j.State != proto.STATE_COMPLETE || run[id] {
+			j.State = proto.STATE_PENDING
+		}
+		if j.Data != nil {
+			data := make(map[string]interface{}, len(j.Data))
+			for k, v := range j.Data {
+				data[k] = v
+			}
+			j.Data = data
+		}
+		jc.Jobs[id] = j
+	}
+
+	rmc := &localClient{mux: &sync.Mutex{}}
+	c := chain.NewChain(&jc, map[string]uint{}, map[string]uint{}, map[string]uint{})
+	repo := chain.NewMemoryRepo()
+	if err := repo.Add(c); err != nil {
+		return ChainResult{}, err
+	}
+	t := chain.NewTraverser(chain.TraverserConfig{
+		Chain:         c,
+		ChainRepo:     repo,
+		RunnerFactory: &runnerFactory{rf: runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc}), rec: rec, run: run},
+		RMClient:      rmc,
+		ShutdownChan:  make(chan struct{}),
+		StopTimeout:   10 * time.Second,
+		SendTimeout:   10 * time.Second,
+	})
+	t.Run()
+
+	rmc.mux.Lock()
+	defer rmc.mux.Unlock()
+	return ChainResult{State: rmc.state, JobLogs: rmc.jls}, nil
+}
+
+// --------------------------------------------------------------------------
+
+func makeJob(jf job.Factory, pJob proto.Job, requestId string) (job.Job, error) {
+	realJob, err := jf.Make(job.NewIdWithRequestId(pJob.Type, pJob.Name, pJob.Id, requestId))
+	if err != nil {
+		return nil, fmt.Errorf("cannot make job %s (%s): %s", pJob.Name, pJob.Id, err)
+	}
+	if err := realJob.Deserialize(pJob.Bytes); err != nil {
+		return nil, fmt.Errorf("cannot deserialize job %s (%s): %s", pJob.Name, pJob.Id, err)
+	}
+	return realJob, nil
+}
+
+func decode(bytes json.RawMessage) (map[string]interface{}, error) {
+	jobData := map[string]interface{}{}
+	if len(bytes) == 0 {
+		return jobData, nil
+	}
+	if err := json.Unmarshal(bytes, &jobData); err != nil {
+		return nil, err
+	}
+	if jobData == nil { // "null"
+		jobData = map[string]interface{}{}
+	}
+	return jobData, nil
+}
+
+// runnerFactory makes real runners for jobs in run, and fake runners for all
+// other jobs.
+type runnerFactory struct {
+	rf  runner.Factory
+	rec Recording
+	run map[string]bool
+}
+
+func (f *runnerFactory) Make(pJob proto.Job, cfg runner.Config) (runner.Runner, error) {
+	if f.run[pJob.Id] {
+		return f.rf.Make(pJob, cfg)
+	}
+	try, ok := f.rec.LastTry(pJob.Id)
+	if !ok {
+		return nil, fmt.Errorf("job not recorded: cannot fake it")
+	}
+	output, err := decode(try.Output)
+	if err != nil {
+		return nil, fmt.Errorf("cannot decode recorded output: %s", err)
+	}
+	return &fakeRunner{pJob: pJob, try: try, output: output, startedAt: time.Now()}, nil
+}
+
+// fakeRunner replays a recorded job try: it sets the recorded output job data
+// and returns the recorded state without running the job.
+type fakeRunner struct {
+	pJob      proto.Job
+	try       Try
+	output    map[string]interface{}
+	startedAt time.Time
+}
+
+func (r *fakeRunner) Run(jobData map[string]interface{}) runner.Return {
+	for k, v := range r.output {
+		jobData[k] = v
+	}
+	return runner.Return{FinalState: r.try.State, Tries: 1}
+}
+
+func (r *fakeRunner) Stop() error {
+	return nil
+}
+
+func (r *fakeRunner) StopTry() error {
+	return runner.ErrNotRunning
+}
+
+func (r *fakeRunner) Status() runner.Status {
+	return runner.Status{
+		Job:       r.pJob,
+		StartedAt: r.startedAt,
+		Try:       1,
+		Status:    "(replay) recorded output",
+	}
+}
+
+// localClient is the RM client for a replayed chain. It saves job logs and the
+// final state of the chain. The traverser does not call other methods.
+type localClient struct {
+	rm.Client // nil
+	mux       *sync.Mutex
+	jls       []proto.JobLog
+	state     byte
+}
+
+func (c *localClient) CreateJL(requestId string, jl proto.JobLog) error {
+	c.mux.Lock()
+	c.jls = append(c.jls, jl)
+	c.mux.Unlock()
+	return nil
+}
+
+func (c *localClient) FinishRequest(fr proto.FinishRequest) error {
+	c.mux.Lock()
+	c.state = fr.State
+	c.mux.Unlock()
+	return nil
+}
+
+func (c *localClient) SuspendRequest(requestId string, sjc proto.SuspendedJobChain) error {
+	return fmt.Errorf("cannot suspend replayed job chain")
+}
@@ -0,0 +1,249 @@
+// Copyright 2020, Square, Inc.
+
+package replay_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/job-runner/replay"
+	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/test"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+// Job Chain: job1 -> job2 -> job3. Each job sets a job data key from the one set
+// by the previous job, which is the data threading that replay debugs.
+func testChain(requestId string) *proto.JobChain {
+	jobs := test.InitJobs(3)
+	for id, j := range jobs {
+		j.Type = "type-" + id
+		j.Name = "name-" + id
+		jobs[id] = j
+	}
+	return &proto.JobChain{
+		RequestId:   requestId,
+		RequestType: "test",
+		Jobs:        jobs,
+		AdjacencyList: map[string][]string{
+			"job1": {"job2"},
+			"job2": {"job3"},
+		},
+	}
+}
+
+func testJobFactory(suffix string) *mock.JobFactory {
+	return &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"type-job1": &mock.Job{
+				RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+					jobData["a"] = "a" + suffix
+					return job.Return{State: proto.STATE_COMPLETE}, nil
+				},
+			},
+			"type-job2": &mock.Job{
+				RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+					jobData["b"] = fmt.Sprintf("%v-b%s", jobData["a"], suffix)
+					return job.Return{State: proto.STATE_COMPLETE, Stdout: "job2 out"}, nil
+				},
+			},
+			"type-job3": &mock.Job{
+				RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+					jobData["c"] = fmt.Sprintf("%v-c%s", jobData["b"], suffix)
+					return job.Return{State: proto.STATE_COMPLETE}, nil
+				},
+			},
+		},
+	}
+}
+
+// record runs the job chain with a real traverser and recorder, like the Job
+// Runner in debug mode, and returns the recording file.
+func record(t *testing.T, dir string, jc *proto.JobChain, jf job.Factory) string {
+	recorder, err := replay.NewRecorder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rmc := &mock.RMClient{}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: recorder.JobFactory(jf), RMClient: rmc})
+	tf := recorder.TraverserFactory(chain.NewTraverserFactory(chain.NewMemoryRepo(), rf, rmc, "", make(chan struct{}), chain.ShutdownPolicy{}, chain.Timeouts{Stop: time.Second, Send: time.Second}, nil))
+	tr, err := tf.Make(jc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.Run()
+	return recorder.File(jc.RequestId)
+}
+
+func TestRecord(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := record(t, dir, testChain("req1"), testJobFactory("1"))
+	if file != filepath.Join(dir, "req1.jsonl") {
+		t.Errorf("recording file %s, expected req1.jsonl in %s", file, dir)
+	}
+
+	rec, err := replay.Load(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.JobChain.RequestId != "req1" || len(rec.JobChain.Jobs) != 3 {
+		t.Errorf("recorded job chain %s with %d jobs, expected req1 with 3 jobs", rec.JobChain.RequestId, len(rec.JobChain.Jobs))
+	}
+	if len(rec.Tries) != 3 {
+		t.Fatalf("%d tries recorded, expected 3: %+v", len(rec.Tries), rec.Tries)
+	}
+
+	try, ok := rec.LastTry("job2")
+	if !ok {
+		t.Fatal("job2 try not recorded")
+	}
+	if try.RequestId != "req1" || try.Name != "name-job2" || try.Type != "type-job2" {
+		t.Errorf("job2 try %+v, expected request id, name, and type", try)
+	}
+	if try.State != proto.STATE_COMPLETE || try.Stdout != "job2 out" {
+		t.Errorf("job2 try state %s, stdout %q, expected COMPLETE and job2 out", proto.StateName[try.State], try.Stdout)
+	}
+	if string(try.Input) != `{"a":"a1"}` {
+		t.Errorf("job2 input %s, expected {\"a\":\"a1\"}", try.Input)
+	}
+	if string(try.Output) != `{"a":"a1","b":"a1-b1"}` {
+		t.Errorf("job2 output %s, expected {\"a\":\"a1\",\"b\":\"a1-b1\"}", try.Output)
+	}
+	if try.StartedAt == 0 || try.FinishedAt < try.StartedAt {
+		t.Errorf("job2 try started at %d, finished at %d", try.StartedAt, try.FinishedAt)
+	}
+}
+
+func TestReplayJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec, err := replay.Load(record(t, dir, testChain("req1"), testJobFactory("1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Job re-runs with its recorded input, not the input from job1 re-running
+	res, err := replay.Job(rec, "job2", testJobFactory("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Return.State != proto.STATE_COMPLETE || res.Error != nil {
+		t.Errorf("return %+v, error %v, expected COMPLETE and no error", res.Return, res.Error)
+	}
+	expect := map[string]interface{}{"a": "a1", "b": "a1-b2"}
+	if diff := deep.Equal(res.Output, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	if _, err := replay.Job(rec, "job9", testJobFactory("2")); err == nil {
+		t.Error("no error replaying job not in chain")
+	}
+}
+
+func TestReplaySubChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	rec, err := replay.Load(record(t, dir, testChain("req1"), testJobFactory("1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-run job2 and job3 for real. job1 is fake: it must not run, and job2
+	// gets its recorded output.
+	run := rec.SubChain("job2")
+	if diff := deep.Equal(run, map[string]bool{"job2": true, "job3": true}); diff != nil {
+		t.Fatal(diff)
+	}
+	jf := testJobFactory("2")
+	jf.MockJobs["type-job1"].RunFunc = func(jobData map[string]interface{}) (job.Return, error) {
+		t.Error("fake job1 ran")
+		return job.Return{State: proto.STATE_FAIL}, nil
+	}
+	var gotData map[string]interface{}
+	jf.MockJobs["type-job3"].RunFunc = func(jobData map[string]interface{}) (job.Return, error) {
+		gotData = map[string]interface{}{}
+		for k, v := range jobData {
+			gotData[k] = v
+		}
+		return job.Return{State: proto.STATE_COMPLETE}, nil
+	}
+
+	res, err := replay.Chain(rec, run, jf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != proto.STATE_COMPLETE {
+		t.Errorf("chain state %s, expected COMPLETE", proto.StateName[res.State])
+	}
+	if len(res.JobLogs) != 2 {
+		t.Errorf("%d job logs, expected 2 (job2 and job3): %+v", len(res.JobLogs), res.JobLogs)
+	}
+	expect := map[string]interface{}{"a": "a1", "b": "a1-b2"}
+	if diff := deep.Equal(gotData, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Recorded chain isn't changed by replay
+	if rec.JobChain.Jobs["job1"].State != proto.STATE_PENDING {
+		t.Errorf("recorded job1 state %s, expected PENDING", proto.StateName[rec.JobChain.Jobs["job1"].State])
+	}
+}
+
+func TestReplayNotRecorded(t *testing.T) {
+	dir, err := ioutil.TempDir("", "replay-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// job2 fails, so job3 never runs and isn't recorded
+	jf := testJobFactory("1")
+	jf.MockJobs["type-job2"].RunFunc = func(jobData map[string]interface{}) (job.Return, error) {
+		return job.Return{State: proto.STATE_FAIL, Exit: 1}, fmt.Errorf("job2 failed")
+	}
+	rec, err := replay.Load(record(t, dir, testChain("req1"), jf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	try, _ := rec.LastTry("job2")
+	if try.State != proto.STATE_FAIL || try.Error != "job2 failed" {
+		t.Errorf("job2 try state %s, error %q, expected FAIL and job2 failed", proto.StateName[try.State], try.Error)
+	}
+	if _, ok := rec.LastTry("job3"); ok {
+		t.Error("job3 try recorded, expected none")
+	}
+
+	// Fake job2 fails like it was recorded, so real job3 doesn't run
+	res, err := replay.Chain(rec, map[string]bool{"job3": true}, testJobFactory("2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.State != proto.STATE_FAIL {
+		t.Errorf("chain state %s, expected FAIL", proto.StateName[res.State])
+	}
+	if len(res.JobLogs) != 0 {
+		t.Errorf("%d job logs, expected 0: %+v", len(res.JobLogs), res.JobLogs)
+	}
+}
@@ -3,39 +3,122 @@
 package runner
 
 import (
+	"fmt"
+	"time"
+
+	"github.com/square/spincycle/v2/argcrypt"
 	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/breaker"
+	"github.com/square/spincycle/v2/job-runner/workspace"
 	"github.com/square/spincycle/v2/proto"
 	rm "github.com/square/spincycle/v2/request-manager"
 )
 
-// A Factory makes a Runner for one job. There are two try counts: prevTries and
-// totalTries. prevTries is a gauge from [0, 1+retry], where retry is the retry
-// count from the request spec. The prevTries count is per-sequence try, which is
-// why it can reset to zero on sequence retry (handled by a chain.Reaper).
-// On suspend/resume, jobs are stopped and the try on which it's stopped doesn't count,
-// so prevTries is decremented by 1 on resume to retry. The totalTries count is
-// a monotonically increasing global counter of how many times the job was run.
-// This count is used for the proto.JobLog.Try field which cannot repeat a number
-// because the job_log table primary key is <request_id, job_id, try>.
+// A Factory makes a Runner for one job, configured by Config.
+//
+// The factory decrypts the encrypted (sensitive) job args of a job.SensitiveJob
+// with the arg key provider (FactoryConfig.ArgKeys), which is nil if arg
+// encryption is disabled. Runners check and count tries in the job type circuit
+// breaker (FactoryConfig.Breaker), which is nil if the circuit breaker is disabled.
 type Factory interface {
-	Make(job proto.Job, requestId string, prevTries, totalTries uint) (Runner, error)
+	Make(job proto.Job, cfg Config) (Runner, error)
+}
+
+// Config configures the Runner of one job: everything but the job itself.
+// Zero values are "none" or "not set", so callers set only what they have.
+//
+// There are two try counts: PrevTries and TotalTries. PrevTries is a gauge from
+// [0, 1+retry], where retry is the retry count from the request spec. The
+// PrevTries count is per-sequence try, which is why it can reset to zero on
+// sequence retry (handled by a chain.Reaper). On suspend/resume, jobs are
+// stopped and the try on which it's stopped doesn't count, so PrevTries is
+// decremented by 1 on resume to retry. The TotalTries count is a monotonically
+// increasing global counter of how many times the job was run. This count is
+// used for the proto.JobLog.Try field which cannot repeat a number because the
+// job_log table primary key is <request_id, job_id, try>.
+type Config struct {
+	RequestId  string
+	PrevTries  uint
+	TotalTries uint
+
+	// FenceToken is the job chain fencing token (proto.JobChain.FenceToken),
+	// and SequenceTry is the current try of the job's sequence; both are sent
+	// with every job log entry.
+	FenceToken  uint64
+	SequenceTry uint
+
+	// Deadline is the request deadline (proto.JobChain.Deadline), or zero if
+	// the request doesn't have one. The job is not retried after the deadline,
+	// and a job.ContextJob receives it in its context.
+	Deadline time.Time
+
+	// Scratch is the job chain scratch store; it's set on the job if it's a
+	// job.ScratchJob. Only used by Factory.Make.
+	Scratch job.Scratch
+
+	// Workspace is the request workspace, or nil if workspaces are disabled;
+	// it's in the context of a job.ContextJob (job.Workspace), and the runner
+	// checks its size after every try.
+	Workspace *workspace.Workspace
+
+	// RunnableAt is when the job became runnable; the time from then until the
+	// first try starts is the job queue delay (proto.JobLog.QueueDelay). If it's
+	// zero, the queue delay isn't reported.
+	RunnableAt time.Time
+
+	// Budget limits job retries across the whole job chain
+	// (proto.JobChain.RetryBudget): the job isn't retried if the budget has no
+	// job retries left. If it's nil, the job's retry setting is the only limit.
+	Budget RetryBudget
+}
+
+// FactoryConfig configures a Factory. JobFactory and RMClient are required.
+type FactoryConfig struct {
+	JobFactory job.Factory
+	RMClient   rm.Client
+	ArgKeys    argcrypt.KeyProvider // optional, nil if arg encryption is disabled
+	Breaker    *breaker.Breaker     // optional, nil if the circuit breaker is disabled
+
+	// MeasureCPU measures the CPU time of the goroutine that runs each try,
+	// which locks it to its OS thread on Linux (config.Jobs.MeasureCPU)
+	MeasureCPU bool
 }
 
 type factory struct {
-	jf  job.Factory
-	rmc rm.Client
+	jf   job.Factory
+	rmc  rm.Client
+	keys argcrypt.KeyProvider
+	cb   *breaker.Breaker
+	cpu  bool
 }
 
-// NewRunnerFactory makes a RunnerFactory.
-func NewFactory(jf job.Factory, rmc rm.Client) Factory {
+// NewFactory makes a Factory.
+func NewFactory(cfg FactoryConfig) Factory {
 	return &factory{
-		jf:  jf,
-		rmc: rmc,
+		jf:   cfg.JobFactory,
+		rmc:  cfg.RMClient,
+		keys: cfg.ArgKeys,
+		cb:   cfg.Breaker,
+		cpu:  cfg.MeasureCPU,
 	}
 }
 
 // Make a runner for a new job.
-func (f *factory) Make(pJob proto.Job, requestId string, prevTries, totalTries uint) (Runner, error) {
+func (f *factory) Make(pJob proto.Job, cfg Config) (Runner, error) {
+	realJob, err := f.makeJob(pJob, cfg.RequestId, cfg.Scratch)
+	if err != nil {
+		return nil, err
+	}
+	r := newRunner(pJob, realJob, f.rmc, cfg)
+	r.breaker = f.cb
+	r.measureCPU = f.cpu
+	r.remake = func() (job.Job, error) { return f.makeJob(pJob, cfg.RequestId, cfg.Scratch) }
+	return r, nil
+}
+
+// makeJob makes the job.Job for the proto.Job, ready to run. The runner makes
+// a new one to retry a try stopped by Runner.StopTry.
+func (f *factory) makeJob(pJob proto.Job, requestId string, scratch job.Scratch) (job.Job, error) {
 	// Instantiate a "blank" job of the given type.
 	realJob, err := f.jf.Make(job.NewIdWithRequestId(pJob.Type, pJob.Name, pJob.Id, requestId))
 	if err != nil {
@@ -48,6 +131,54 @@ func (f *factory) Make(pJob proto.Job, requestId string, prevTries, totalTries u
 		return nil, err
 	}
 
-	// Job should be ready to run. Create and return a runner for it.
-	return NewRunner(pJob, realJob, requestId, prevTries, totalTries, f.rmc), nil
+	// Give the job the chain scratch store if it uses it
+	if sj, ok := realJob.(job.ScratchJob); ok && scratch != nil {
+		sj.SetScratch(scratch)
+	}
+
+	// Give the job its sensitive args, decrypted only now, just before it runs
+	if sj, ok := realJob.(job.SensitiveJob); ok {
+		if err := f.setSensitiveArgs(sj, pJob, requestId); err != nil {
+			return nil, err
+		}
+	}
+
+	return realJob, nil
+}
+
+// setSensitiveArgs decrypts the encrypted args of the job, if any, and sets them
+// on the job. Values encrypted for another request don't decrypt.
+func (f *factory) setSensitiveArgs(sj job.SensitiveJob, pJob proto.Job, requestId string) error {
+	var encrypted bool
+	for _, v := range pJob.Args {
+		if argcrypt.IsEncrypted(v) {
+			encrypted = true
+			break
+		}
+	}
+	if !encrypted {
+		return nil
+	}
+	if f.keys == nil {
+		return fmt.Errorf("job %s has encrypted args but arg encryption is not enabled on this Job Runner (arg_encryption.key_file)", pJob.Id)
+	}
+	args, err := argcrypt.DecryptArgs(f.keys, pJob.Args, requestId)
+	if err != nil {
+		return fmt.Errorf("job %s: %s", pJob.Id, err)
+	}
+	return sj.SetSensitiveArgs(args)
+}
+
+// chainClient is an rm.Client that sets the fencing token and sequence try of
+// job log entries.
+type chainClient struct {
+	rm.Client
+	fenceToken  uint64
+	sequenceTry uint
+}
+
+func (c chainClient) CreateJL(requestId string, jl proto.JobLog) error {
+	jl.FenceToken = c.fenceToken
+	jl.SequenceTry = c.sequenceTry
+	return c.Client.CreateJL(requestId, jl)
 }
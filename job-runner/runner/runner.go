@@ -4,12 +4,19 @@
 package runner
 
 import (
+	"context"
+	"errors"
+	"expvar"
 	"fmt"
+	"runtime/debug"
 	"sync"
 	"time"
 
 	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/breaker"
+	"github.com/square/spincycle/v2/job-runner/workspace"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
 	rm "github.com/square/spincycle/v2/request-manager"
 	"github.com/square/spincycle/v2/retry"
 
@@ -21,19 +28,81 @@ const (
 	JOB_LOG_TRIES = 5
 	// Time to wait between attempts to send a job log to RM.
 	JOB_LOG_RETRY_WAIT = 500 * time.Millisecond
+	// Max bytes of stdout and stderr, each, sent in a job log. Only the last
+	// bytes are sent if a job returns more, since the end of the output usually
+	// explains why the job failed.
+	JOB_LOG_MAX_OUTPUT = 1 << 20 // 1 MiB
 )
 
+// ErrNotRunning is returned by Runner.StopTry when the job is not running a try:
+// it's waiting to retry, it hasn't started, or it's done.
+var ErrNotRunning = errors.New("job is not running a try")
+
+// ErrTryStopped is the error of a try stopped by Runner.StopTry.
+var ErrTryStopped = errors.New("try stopped by Job Runner API (stop job)")
+
+// JobPanics counts panics from jobs and runners recovered by the Job Runner.
+// It's published as expvar "job_panics" (GET /debug/vars on the Job Runner API).
+var JobPanics = expvar.NewInt("job_panics")
+
+// Job queue delay metrics published as expvars (GET /debug/vars on the Job Runner
+// API). Queue delay is how long a job was runnable before its first try started.
+var (
+	// JobsStarted counts jobs that started their first try in a run of a chain.
+	JobsStarted = expvar.NewInt("jobs_started")
+
+	// JobQueueDelay is the total queue delay, in milliseconds, of started jobs.
+	// Divide by JobsStarted for the average.
+	JobQueueDelay = expvar.NewInt("job_queue_delay_ms")
+
+	// JobQueueDelayMax is the longest queue delay, in milliseconds, of any job.
+	JobQueueDelayMax = expvar.NewInt("job_queue_delay_max_ms")
+)
+
+// queueDelayMaxMux serializes updates to JobQueueDelayMax.
+var queueDelayMaxMux = &sync.Mutex{}
+
+// Job resource usage metrics published as expvars (GET /debug/vars on the Job
+// Runner API). Each is a map keyed on job type, so owners of expensive jobs can
+// be found and Job Runner capacity planned from data. See job.Usage for what's
+// measured.
+var (
+	// JobTypeTries counts job tries by job type.
+	JobTypeTries = expvar.NewMap("job_type_tries")
+
+	// JobTypeCPU is the total CPU time, in milliseconds, of job tries by job
+	// type. Divide by JobTypeTries for the average.
+	JobTypeCPU = expvar.NewMap("job_type_cpu_ms")
+
+	// JobTypeMaxMemory is the highest peak memory, in bytes, reported by any
+	// try of the job type. Job types that don't report memory aren't set.
+	JobTypeMaxMemory = expvar.NewMap("job_type_max_memory_bytes")
+)
+
+// maxMemoryMux serializes updates to JobTypeMaxMemory.
+var maxMemoryMux = &sync.Mutex{}
+
 type Return struct {
-	FinalState byte // Final proto.STATE_*. Determines if/how chain continues running.
-	Tries      uint // Number of tries this run, not including any previous tries
+	FinalState byte          // Final proto.STATE_*. Determines if/how chain continues running.
+	Tries      uint          // Number of tries this run, not including any previous tries
+	QueueDelay time.Duration // Time runnable before first try started, zero if unknown or not started
 }
 
 type Status struct {
-	Job       proto.Job
-	StartedAt time.Time // set once when Runner created
-	Try       uint      // total tries, not current sequence try (proto.JobLog.Try)
-	Status    string    // real-time job status (job.Job.Status())
-	Sleeping  bool      // if sleeping between tries
+	Job        proto.Job
+	StartedAt  time.Time     // set once when Runner created
+	Try        uint          // total tries, not current sequence try (proto.JobLog.Try)
+	Status     string        // real-time job status (job.Job.Status())
+	Sleeping   bool          // if sleeping between tries
+	QueueDelay time.Duration // time runnable before first try started, zero until then
+}
+
+// A RetryBudget limits the total number of job retries in a job chain. It's
+// implemented by chain.Chain.
+type RetryBudget interface {
+	// UseJobRetry counts one job retry and returns true if the budget has job
+	// retries left, else it returns false.
+	UseJobRetry() bool
 }
 
 // A Runner runs and manages one job in a job chain. The job must implement the
@@ -50,6 +119,12 @@ type Runner interface {
 	// quickly because Stop blocks while waiting for the job to stop.
 	Stop() error
 
+	// StopTry stops the current try of the job, but not the job: the try fails,
+	// and the job is retried if it has tries left, like any failed try. It's for
+	// a job that's stuck, without stopping the job chain. It returns ErrNotRunning
+	// if the job is not running a try, and blocks like Stop.
+	StopTry() error
+
 	// Status returns the job try count and real-time status. The runner handles
 	// the try count. The underlying job.Job must handle async, real-time status
 	// requests while running.
@@ -58,10 +133,16 @@ type Runner interface {
 
 // A runner represents all information needed to run a job.
 type runner struct {
-	pJob    proto.Job
-	realJob job.Job   // the actual job interface to run
-	reqId   string    // the request id the job belongs to
-	rmc     rm.Client // client used to send JLs to the RM
+	pJob       proto.Job
+	realJob    job.Job              // the actual job interface to run
+	reqId      string               // the request id the job belongs to
+	deadline   time.Time            // request deadline, zero if none
+	rmc        rm.Client            // client used to send JLs to the RM
+	ws         *workspace.Workspace // request workspace, nil if disabled
+	runnableAt time.Time            // when the job became runnable, zero if unknown
+	budget     RetryBudget          // chain retry budget, nil if none
+	breaker    *breaker.Breaker     // job type circuit breaker, nil if disabled
+	measureCPU bool                 // measure goroutine CPU time of tries
 	// --
 	jobId      string
 	jobName    string
@@ -72,14 +153,32 @@ type runner struct {
 	retryWait  time.Duration
 	stopChan   chan struct{}
 	*sync.Mutex
-	logger    *log.Entry
-	startTime time.Time
-	sleeping  bool
+	logger     *log.Entry
+	startTime  time.Time
+	sleeping   bool
+	queueDelay time.Duration // runnableAt to first try start, set when it starts
+	inTry      bool          // running a try (realJob.Run)
+	tryStopped bool          // current try stopped by StopTry
+	tryChan    chan struct{} // closed by StopTry, new every try
+	cbWaiting  bool          // waiting for the job type circuit breaker to close
+
+	// Makes a new job to retry a try stopped by StopTry, nil if none
+	remake func() (job.Job, error)
 }
 
 // NewRunner takes a proto.Job struct and its corresponding job.Job interface, and
-// returns a Runner.
-func NewRunner(pJob proto.Job, realJob job.Job, reqId string, prevTries, totalTries uint, rmc rm.Client) Runner {
+// returns a Runner configured by cfg (Config.Scratch is not used: set it on the
+// job.ScratchJob first).
+func NewRunner(pJob proto.Job, realJob job.Job, rmc rm.Client, cfg Config) Runner {
+	return newRunner(pJob, realJob, rmc, cfg)
+}
+
+func newRunner(pJob proto.Job, realJob job.Job, rmc rm.Client, cfg Config) *runner {
+	// Job log entries have the fencing token so the RM rejects them if the
+	// chain was resumed on another JR, and the sequence try for try history.
+	if cfg.FenceToken > 0 || cfg.SequenceTry > 0 {
+		rmc = chainClient{Client: rmc, fenceToken: cfg.FenceToken, sequenceTry: cfg.SequenceTry}
+	}
 	var retryWait time.Duration
 	if pJob.RetryWait != "" {
 		retryWait, _ = time.ParseDuration(pJob.RetryWait) // validated by grapher
@@ -89,16 +188,20 @@ func NewRunner(pJob proto.Job, realJob job.Job, reqId string, prevTries, totalTr
 	return &runner{
 		pJob:       pJob,
 		realJob:    realJob,
-		reqId:      reqId,
-		prevTries:  prevTries,
-		totalTries: 1 + totalTries, // this run + past totalTries (on resume/retry)
+		reqId:      cfg.RequestId,
+		deadline:   cfg.Deadline,
+		prevTries:  cfg.PrevTries,
+		totalTries: 1 + cfg.TotalTries, // this run + past totalTries (on resume/retry)
 		rmc:        rmc,
+		ws:         cfg.Workspace,
+		runnableAt: cfg.RunnableAt,
+		budget:     cfg.Budget,
 		// --
 		maxTries:  1 + pJob.Retry, // + 1 because we always run once
 		retryWait: retryWait,
 		stopChan:  make(chan struct{}),
 		Mutex:     &sync.Mutex{},
-		logger:    log.WithFields(log.Fields{"request_id": reqId, "job_id": pJob.Id}),
+		logger:    reqlog.Entry(cfg.RequestId).WithFields(log.Fields{"request_id": cfg.RequestId, "job_id": pJob.Id}),
 		startTime: time.Now().UTC(),
 	}
 }
@@ -110,6 +213,7 @@ func (r *runner) Run(jobData map[string]interface{}) Return {
 	finalState := proto.STATE_PENDING
 	tries := uint(1)         // number of tries this run
 	tryNo := 1 + r.prevTries // this run + past tries (on resume/retry)
+	var queueDelay time.Duration
 TRY_LOOP:
 	for tryNo <= r.maxTries {
 		tryLogger := r.logger.WithFields(log.Fields{
@@ -126,23 +230,113 @@ TRY_LOOP:
 			break TRY_LOOP
 		}
 
+		// If the job type circuit breaker is open, the try fails without running
+		// the job, or it waits until the breaker closes (config.CircuitBreaker)
+		var cbErr error
+		if r.breaker != nil {
+			if cb, open := r.breaker.Check(r.pJob.Type); open {
+				breaker.ShortCircuits.Add(r.pJob.Type, 1)
+				if r.breaker.Action() == breaker.ACTION_WAIT {
+					tryLogger.Warnf("circuit breaker open for job type %s until %s: waiting", r.pJob.Type, cb.Until.Format(time.RFC3339))
+					r.Lock()
+					r.cbWaiting = true
+					r.Unlock()
+					closed := r.breaker.Wait(r.pJob.Type, r.stopChan)
+					r.Lock()
+					r.cbWaiting = false
+					r.Unlock()
+					if !closed {
+						tryLogger.Infof("job stopped while waiting for circuit breaker")
+						finalState = proto.STATE_STOPPED
+						break TRY_LOOP
+					}
+				} else {
+					cbErr = circuitOpenError(cb)
+				}
+			}
+		}
+
 		// Run the job. Use a separate method so we can easily recover from a panic
 		// in job.Run.
-		tryLogger.Infof("job start")
-		startedAt, finishedAt, jobRet, runErr := r.runJob(jobData)
-		runtime := time.Duration(finishedAt-startedAt) * time.Nanosecond
-		tryLogger.Infof("job return: runtime=%s, state=%s (%d), exit=%d, err=%v", runtime, proto.StateName[jobRet.State], jobRet.State, jobRet.Exit, runErr)
+		var startedAt, finishedAt int64
+		var jobRet job.Return
+		var runErr error
+		var tryStopped bool
+		if cbErr == nil {
+			tryLogger.Infof("job start")
+			r.Lock()
+			r.inTry = true
+			r.tryStopped = false
+			r.tryChan = make(chan struct{})
+			r.Unlock()
+			startedAt, finishedAt, jobRet, runErr = r.runJob(jobData)
+			r.Lock()
+			r.inTry = false
+			tryStopped = r.tryStopped
+			r.Unlock()
+			runtime := time.Duration(finishedAt-startedAt) * time.Nanosecond
+			tryLogger.Infof("job return: runtime=%s, state=%s (%d), exit=%d, err=%v", runtime, proto.StateName[jobRet.State], jobRet.State, jobRet.Exit, runErr)
+			tryLogger.Infof("job usage: cpu=%s, max_memory=%d", jobRet.Usage.CPUTime, jobRet.Usage.MaxMemory)
+			recordUsage(r.pJob.Type, jobRet.Usage)
+		} else {
+			tryLogger.Errorf("job not run: %s", cbErr)
+			startedAt = time.Now().UnixNano()
+			finishedAt = startedAt
+			jobRet = job.Return{State: proto.STATE_FAIL}
+			runErr = cbErr
+		}
+
+		// Queue delay is only for the first try this run. Later tries wait
+		// retryWait on purpose, which isn't a scheduling delay.
+		var jlQueueDelay int64
+		if tries == 1 && !r.runnableAt.IsZero() {
+			queueDelay = r.recordQueueDelay(startedAt)
+			jlQueueDelay = int64(queueDelay)
+			tryLogger.Infof("job queue delay: %s", queueDelay)
+		}
+
+		// If the request workspace is larger than its max size, the try fails
+		// with a quota error (a job.Error that's not retryable) even if the job
+		// completed. It's checked after every try because the jobs write to it.
+		if r.ws != nil && jobRet.State != proto.STATE_STOPPED {
+			if wsErr := r.ws.Check(); wsErr != nil {
+				if _, ok := job.AsError(wsErr); !ok {
+					tryLogger.Warnf("%s", wsErr)
+				} else {
+					tryLogger.Errorf("job failed: %s (job error: %v)", wsErr, runErr)
+					jobRet.State = proto.STATE_FAIL
+					runErr = wsErr
+				}
+			}
+		}
 
 		// Figure out what the error message in the JL should be. An
 		// error returned by Run takes precedence (because it implies
 		// a high-level error with the job), followed by the error
 		// returned in the job.Return struct from the job itself (which
 		// probably won't even be meaningful if runErr != nil).
+		//
+		// If the error is a structured job.Error, its category, code, and
+		// retryable flag are saved in the JL, too.
 		var errMsg string
+		var jobErr job.Error
+		var isJobErr bool
 		if runErr != nil {
 			errMsg = runErr.Error()
+			jobErr, isJobErr = job.AsError(runErr)
 		} else if jobRet.Error != nil {
 			errMsg = jobRet.Error.Error()
+			jobErr, isJobErr = job.AsError(jobRet.Error)
+		}
+
+		// Try stopped by StopTry: it failed, whatever the job returned, unless it
+		// completed first. The stop error replaces the job error, which is
+		// probably about being stopped, so the try is retried.
+		if tryStopped && !r.stopped() && jobRet.State != proto.STATE_COMPLETE {
+			tryLogger.Warnf("job try stopped: changing state %s (%d) to STATE_FAIL", proto.StateName[jobRet.State], jobRet.State)
+			jobRet.State = proto.STATE_FAIL
+			errMsg = ErrTryStopped.Error()
+			jobErr, isJobErr = job.Error{}, false
 		}
 
 		// Can be stopped while running, in which case STATE_FAIL is not really
@@ -155,20 +349,34 @@ TRY_LOOP:
 			}
 		}
 
+		// Count the try for the job type circuit breaker if the job ran and wasn't
+		// stopped. Caller errors (job.ERROR_CATEGORY_USER) aren't counted because
+		// they don't mean that what the job calls is broken.
+		if r.breaker != nil && cbErr == nil && !tryStopped && jobErr.Category != job.ERROR_CATEGORY_USER &&
+			(jobRet.State == proto.STATE_COMPLETE || jobRet.State == proto.STATE_FAIL) {
+			r.breaker.Record(r.pJob.Type, jobRet.State == proto.STATE_FAIL)
+		}
+
 		// Create a JL and send it to the RM.
 		jl := proto.JobLog{
-			RequestId:  r.reqId,
-			JobId:      r.pJob.Id,
-			Name:       r.pJob.Name,
-			Type:       r.pJob.Type,
-			Try:        r.totalTries,
-			StartedAt:  startedAt,
-			FinishedAt: finishedAt,
-			State:      jobRet.State,
-			Exit:       jobRet.Exit,
-			Error:      errMsg,
-			Stdout:     jobRet.Stdout,
-			Stderr:     jobRet.Stderr,
+			RequestId:      r.reqId,
+			JobId:          r.pJob.Id,
+			Name:           r.pJob.Name,
+			Type:           r.pJob.Type,
+			Try:            r.totalTries,
+			StartedAt:      startedAt,
+			FinishedAt:     finishedAt,
+			QueueDelay:     jlQueueDelay,
+			CPUTime:        int64(jobRet.Usage.CPUTime),
+			MaxMemory:      jobRet.Usage.MaxMemory,
+			State:          jobRet.State,
+			Exit:           jobRet.Exit,
+			Error:          errMsg,
+			ErrorCategory:  jobErr.Category,
+			ErrorCode:      jobErr.Code,
+			ErrorRetryable: isJobErr && !jobErr.Permanent,
+			Stdout:         truncateOutput(jobRet.Stdout, JOB_LOG_MAX_OUTPUT),
+			Stderr:         truncateOutput(jobRet.Stderr, JOB_LOG_MAX_OUTPUT),
 		}
 		err := retry.Do(JOB_LOG_TRIES, JOB_LOG_RETRY_WAIT,
 			func() error { return r.rmc.CreateJL(r.reqId, jl) },
@@ -196,6 +404,45 @@ TRY_LOOP:
 			break TRY_LOOP
 		}
 
+		// If the job returned a structured error that's permanent, don't retry
+		// even though it has tries left
+		if isJobErr && jobErr.Permanent {
+			tryLogger.Warnf("job error is not retryable (category %s, code %s): not retrying", jobErr.Category, jobErr.Code)
+			break TRY_LOOP
+		}
+
+		// Don't retry if the next try would start after the request deadline.
+		// The job state is changed so the chain isn't retried, either.
+		if !r.deadline.IsZero() && time.Now().Add(r.retryWait).After(r.deadline) {
+			tryLogger.Warnf("request deadline %s exceeded: not retrying", r.deadline.Format(time.RFC3339))
+			finalState = proto.STATE_DEADLINE_EXCEEDED
+			break TRY_LOOP
+		}
+
+		// Don't retry if the chain retry budget is used up, even though the
+		// job has tries left, so the chain fails fast
+		if r.budget != nil && !r.budget.UseJobRetry() {
+			tryLogger.Warnf("chain retry budget has no job retries left: not retrying")
+			break TRY_LOOP
+		}
+
+		// A stopped job cannot be run again (job.Job.Stop is final), so a try
+		// stopped by StopTry is retried with a new job
+		if tryStopped && jobRet.State == proto.STATE_FAIL {
+			if r.remake == nil {
+				tryLogger.Warnf("job try stopped: cannot make a new job: not retrying")
+				break TRY_LOOP
+			}
+			newJob, err := r.remake()
+			if err != nil {
+				tryLogger.Errorf("job try stopped: error making a new job: %s: not retrying", err)
+				break TRY_LOOP
+			}
+			r.Lock()
+			r.realJob = newJob
+			r.Unlock()
+		}
+
 		// Wait between retries. Can be stopped while waiting which is why we
 		// need to increment tryNo first. At this point, we're effectively on
 		// the next try. E.g. try 1 fails, we're waiting for try 2, then we're
@@ -221,23 +468,82 @@ TRY_LOOP:
 	return Return{
 		FinalState: finalState,
 		Tries:      tries,
+		QueueDelay: queueDelay,
+	}
+}
+
+// recordQueueDelay sets and returns the queue delay of the job, from runnableAt
+// to startedAt (UnixNano) of the first try, and adds it to the queue delay metrics.
+func (r *runner) recordQueueDelay(startedAt int64) time.Duration {
+	d := time.Duration(startedAt - r.runnableAt.UnixNano())
+	if d < 0 {
+		d = 0
+	}
+	r.Lock()
+	r.queueDelay = d
+	r.Unlock()
+
+	ms := d.Milliseconds()
+	JobsStarted.Add(1)
+	JobQueueDelay.Add(ms)
+	queueDelayMaxMux.Lock()
+	if ms > JobQueueDelayMax.Value() {
+		JobQueueDelayMax.Set(ms)
+	}
+	queueDelayMaxMux.Unlock()
+	return d
+}
+
+// recordUsage adds the resource usage of one try of the job type to the usage
+// metrics.
+func recordUsage(jobType string, u job.Usage) {
+	JobTypeTries.Add(jobType, 1)
+	JobTypeCPU.Add(jobType, u.CPUTime.Milliseconds())
+	if u.MaxMemory <= 0 {
+		return
+	}
+	maxMemoryMux.Lock()
+	defer maxMemoryMux.Unlock()
+	if v, ok := JobTypeMaxMemory.Get(jobType).(*expvar.Int); ok && v.Value() >= u.MaxMemory {
+		return
 	}
+	max := new(expvar.Int)
+	max.Set(u.MaxMemory)
+	JobTypeMaxMemory.Set(jobType, max)
+}
+
+// noCPU is the stop func of startCPU when CPU time is not measured.
+func noCPU() time.Duration {
+	return 0
 }
 
-// Actually run the job.
+// Actually run the job. If measureCPU is true, the CPU time of the goroutine
+// running the job (where it can be measured) is added to the usage that the job
+// returns.
 func (r *runner) runJob(jobData map[string]interface{}) (startedAt, finishedAt int64, ret job.Return, err error) {
+	stopCPU := noCPU
+	if r.measureCPU {
+		stopCPU = startCPU()
+	}
+	defer stopCPU() // on panic; no-op after the call below
 	defer func() {
 		// Recover from a panic inside Job.Run()
 		if panicErr := recover(); panicErr != nil {
 			// Set named return values. startedAt will already be set before
-			// the panic.
+			// the panic. The stack trace is saved as the job's stderr in the
+			// job log entry.
+			stack := debug.Stack()
 			finishedAt = time.Now().UnixNano()
 			ret = job.Return{
-				State: proto.STATE_FAIL,
-				Exit:  1,
+				State:  proto.STATE_FAIL,
+				Exit:   1,
+				Stderr: string(stack),
+				Usage:  job.Usage{CPUTime: stopCPU()},
 			}
 			// The returned error will be used in the job log entry.
 			err = fmt.Errorf("panic from job.Run: %s", panicErr)
+			JobPanics.Add(1)
+			r.logger.Errorf("%s\n%s", err, stack)
 		}
 	}()
 
@@ -245,12 +551,53 @@ func (r *runner) runJob(jobData map[string]interface{}) (startedAt, finishedAt i
 	// time. Run will return when a job finishes running (either by
 	// its own accord or by being forced to finish when Stop is called).
 	startedAt = time.Now().UnixNano()
-	jobRet, runErr := r.realJob.Run(jobData)
+	var jobRet job.Return
+	var runErr error
+	if ctxJob, ok := r.realJob.(job.ContextJob); ok {
+		ctx, cancel := r.context()
+		ctx = job.WithDebug(ctx, func() bool {
+			level, _ := reqlog.Level(r.reqId)
+			return level >= log.DebugLevel
+		})
+		if r.ws != nil {
+			ctx = job.WithWorkspace(ctx, r.ws.Dir)
+		}
+		jobRet, runErr = ctxJob.RunContext(ctx, jobData)
+		cancel()
+	} else {
+		jobRet, runErr = r.realJob.Run(jobData)
+	}
 	finishedAt = time.Now().UnixNano()
+	jobRet.Usage = jobRet.Usage.Add(job.Usage{CPUTime: stopCPU()})
 
 	return startedAt, finishedAt, jobRet, runErr
 }
 
+// context returns the context for a job.ContextJob. It has the request deadline,
+// if any, and it's canceled when the runner or the try is stopped.
+func (r *runner) context() (context.Context, context.CancelFunc) {
+	r.Lock()
+	tryChan := r.tryChan
+	r.Unlock()
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if r.deadline.IsZero() {
+		ctx, cancel = context.WithCancel(context.Background())
+	} else {
+		ctx, cancel = context.WithDeadline(context.Background(), r.deadline)
+	}
+	go func() {
+		select {
+		case <-r.stopChan:
+			cancel()
+		case <-tryChan:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
+}
+
 func (r *runner) Stop() error {
 	r.Lock() // LOCK
 
@@ -263,11 +610,36 @@ func (r *runner) Stop() error {
 	}
 
 	close(r.stopChan)
+	realJob := r.realJob // can be replaced after StopTry
 
 	r.Unlock() // UNLOCK
 
 	r.logger.Infof("stopping the job")
-	return r.realJob.Stop() // this is a blocking operation that should return quickly
+	return realJob.Stop() // this is a blocking operation that should return quickly
+}
+
+func (r *runner) StopTry() error {
+	r.Lock() // LOCK
+
+	if !r.inTry || r.stopped() {
+		r.Unlock() // UNLOCK
+		return ErrNotRunning
+	}
+
+	// Return if stop try was already called for this try.
+	if r.tryStopped {
+		r.Unlock() // UNLOCK
+		return nil
+	}
+	r.tryStopped = true
+	close(r.tryChan)
+	realJob := r.realJob
+	try := r.totalTries
+
+	r.Unlock() // UNLOCK
+
+	r.logger.Infof("stopping the job try %d", try)
+	return realJob.Stop()
 }
 
 func (r *runner) stopped() bool {
@@ -285,7 +657,10 @@ func (r *runner) Runtime() float64 {
 
 func (r *runner) Status() Status {
 	// Get real-time status before locking in case it's slow
-	status := r.realJob.Status()
+	r.Lock()
+	realJob := r.realJob
+	r.Unlock()
+	status := realJob.Status()
 
 	r.Lock()
 	defer r.Unlock()
@@ -294,12 +669,38 @@ func (r *runner) Status() Status {
 	if r.sleeping {
 		status = "(retry sleep) " + status
 	}
+	if r.cbWaiting {
+		status = "(circuit breaker open) " + status
+	}
 
 	return Status{
-		Job:       r.pJob,
-		StartedAt: r.startTime,
-		Try:       r.totalTries,
-		Status:    status,
-		Sleeping:  r.sleeping,
+		Job:        r.pJob,
+		StartedAt:  r.startTime,
+		Try:        r.totalTries,
+		Status:     status,
+		Sleeping:   r.sleeping,
+		QueueDelay: r.queueDelay,
+	}
+}
+
+// circuitOpenError returns the error of a try that failed without running
+// because the job type circuit breaker was open. It's a permanent job error,
+// so the job fails fast instead of using its tries while the breaker is open.
+func circuitOpenError(cb proto.CircuitBreaker) error {
+	return job.Error{
+		Category:  job.ERROR_CATEGORY_INFRA,
+		Code:      "circuit-breaker-open",
+		Permanent: true,
+		Err: fmt.Errorf("circuit breaker open for job type %s until %s: %d of %d tries failed (job not run)",
+			cb.JobType, cb.Until.Format(time.RFC3339), cb.Failed, cb.Tries),
+	}
+}
+
+// truncateOutput returns the last max bytes of job output (stdout or stderr),
+// noting how many bytes were discarded.
+func truncateOutput(out string, max int) string {
+	if len(out) <= max {
+		return out
 	}
+	return fmt.Sprintf("[output truncated: first %d bytes discarded]\n", len(out)-max) + out[len(out)-max:]
 }
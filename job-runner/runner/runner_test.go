@@ -3,12 +3,23 @@
 package runner_test
 
 import (
+	"context"
+	"expvar"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-test/deep"
+	"github.com/square/spincycle/v2/argcrypt"
 	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/breaker"
 	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/job-runner/workspace"
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/test/mock"
 )
@@ -23,7 +34,7 @@ func TestFactory(t *testing.T) {
 		MakeErr:  mock.ErrJob,
 	}
 	rmc := &mock.RMClient{}
-	rf := runner.NewFactory(jf, rmc)
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc})
 
 	pJob := proto.Job{
 		Id:    "j1",
@@ -31,7 +42,7 @@ func TestFactory(t *testing.T) {
 		Bytes: []byte{},
 	}
 
-	jr, err := rf.Make(pJob, "abc", 0, 0)
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc"})
 	if err != mock.ErrJob {
 		t.Errorf("err = nil, expected %s", mock.ErrJob)
 	}
@@ -67,7 +78,7 @@ func TestRunFail(t *testing.T) {
 			return nil
 		},
 	}
-	jr := runner.NewRunner(pJob, mJob, "abc", 0, 0, rmc)
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
 
 	ret := jr.Run(noJobData)
 	if ret.FinalState != proto.STATE_FAIL {
@@ -82,6 +93,115 @@ func TestRunFail(t *testing.T) {
 	}
 }
 
+type retryBudget struct {
+	left int
+	used int
+}
+
+func (b *retryBudget) UseJobRetry() bool {
+	if b.left == 0 {
+		return false
+	}
+	b.left--
+	b.used++
+	return true
+}
+
+func TestRunRetryBudget(t *testing.T) {
+	// The job can be retried twice, but the chain retry budget has only 1 job
+	// retry left, so it's tried twice, not 3 times
+	tries := 0
+	mJob := &mock.Job{
+		RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+			tries++
+			return job.Return{State: proto.STATE_FAIL}, nil
+		},
+	}
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{"jtype": mJob},
+	}
+	pJob := proto.Job{
+		Id:    "failJob",
+		Type:  "jtype",
+		Bytes: []byte{},
+		Retry: 2,
+	}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: &mock.RMClient{}})
+	budget := &retryBudget{left: 1}
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc", Budget: budget})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := jr.Run(noJobData)
+	if ret.FinalState != proto.STATE_FAIL {
+		t.Errorf("final state = %s, expected FAIL", proto.StateName[ret.FinalState])
+	}
+	if ret.Tries != 2 || tries != 2 {
+		t.Errorf("tries = %d (ran %d), expected 2", ret.Tries, tries)
+	}
+	if budget.used != 1 {
+		t.Errorf("used %d job retries, expected 1", budget.used)
+	}
+}
+
+func TestRunCircuitBreaker(t *testing.T) {
+	// The job can be tried 4 times, but the job type circuit breaker opens after
+	// 2 failed tries, so the 3rd try fails without running and isn't retried
+	tries := 0
+	mJob := &mock.Job{
+		RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+			tries++
+			return job.Return{State: proto.STATE_FAIL}, nil
+		},
+	}
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{"cbtype": mJob},
+	}
+	pJob := proto.Job{
+		Id:    "failJob",
+		Type:  "cbtype",
+		Bytes: []byte{},
+		Retry: 3,
+	}
+	var jls []proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			jls = append(jls, jl)
+			return nil
+		},
+	}
+	cb := breaker.New(breaker.Config{
+		FailureRate: 0.5,
+		MinTries:    2,
+		Window:      time.Minute,
+		Cooldown:    time.Minute,
+		Action:      breaker.ACTION_FAIL,
+	})
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc, Breaker: cb})
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ret := jr.Run(noJobData)
+	if ret.FinalState != proto.STATE_FAIL {
+		t.Errorf("final state = %s, expected FAIL", proto.StateName[ret.FinalState])
+	}
+	if ret.Tries != 3 || tries != 2 {
+		t.Errorf("tries = %d (ran %d), expected 3 (ran 2)", ret.Tries, tries)
+	}
+	if len(jls) != 3 {
+		t.Fatalf("runner sent %d JLs, expected 3", len(jls))
+	}
+	if jls[2].ErrorCode != "circuit-breaker-open" || jls[2].ErrorRetryable {
+		t.Errorf("last JL error code = %s (retryable %t), expected circuit-breaker-open (not retryable)", jls[2].ErrorCode, jls[2].ErrorRetryable)
+	}
+	if n := breaker.ShortCircuits.Get("cbtype"); n == nil || n.String() != "1" {
+		t.Errorf("short circuits = %v, expected 1", n)
+	}
+}
+
 func TestRunSuccess(t *testing.T) {
 	attemptNumber := 0
 	// Create a mock job that will succeed on the third of four retries.
@@ -109,7 +229,7 @@ func TestRunSuccess(t *testing.T) {
 			return nil
 		},
 	}
-	jr := runner.NewRunner(pJob, mJob, "abc", 0, 0, rmc)
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
 
 	ret := jr.Run(noJobData)
 	if ret.FinalState != proto.STATE_COMPLETE {
@@ -124,6 +244,122 @@ func TestRunSuccess(t *testing.T) {
 	}
 }
 
+// Stdout and stderr are sent separately, and truncated to the last JOB_LOG_MAX_OUTPUT bytes.
+func TestRunOutput(t *testing.T) {
+	stdout := strings.Repeat("o", runner.JOB_LOG_MAX_OUTPUT+10)
+	mJob := &mock.Job{
+		RunReturn: job.Return{
+			State:  proto.STATE_COMPLETE,
+			Stdout: stdout,
+			Stderr: "some error\n",
+		},
+	}
+	pJob := proto.Job{
+		Id:    "outputJob",
+		Type:  "jtype",
+		Bytes: []byte{},
+	}
+	var gotJL proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = jl
+			return nil
+		},
+	}
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
+	jr.Run(noJobData)
+
+	if gotJL.Stderr != "some error\n" {
+		t.Errorf("got stderr %q, expected %q", gotJL.Stderr, "some error\n")
+	}
+	expectStdout := "[output truncated: first 10 bytes discarded]\n" + stdout[10:]
+	if gotJL.Stdout != expectStdout {
+		t.Errorf("got stdout of %d bytes, expected %d bytes", len(gotJL.Stdout), len(expectStdout))
+	}
+}
+
+func TestRunJobError(t *testing.T) {
+	// Job returns a wrapped job.Error, which sets the JL error fields
+	mJob := &mock.Job{
+		RunReturn: job.Return{
+			State: proto.STATE_FAIL,
+			Error: fmt.Errorf("cannot connect: %w", job.Error{
+				Category: job.ERROR_CATEGORY_INFRA,
+				Code:     "ECONNREFUSED",
+				Err:      fmt.Errorf("connection refused"),
+			}),
+		},
+	}
+	pJob := proto.Job{
+		Id:    "errJob",
+		Type:  "jtype",
+		Bytes: []byte{},
+	}
+	var gotJL proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = jl
+			return nil
+		},
+	}
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
+	jr.Run(noJobData)
+
+	if gotJL.ErrorCategory != job.ERROR_CATEGORY_INFRA {
+		t.Errorf("got error category %q, expected infra", gotJL.ErrorCategory)
+	}
+	if gotJL.ErrorCode != "ECONNREFUSED" {
+		t.Errorf("got error code %q, expected ECONNREFUSED", gotJL.ErrorCode)
+	}
+	if !gotJL.ErrorRetryable {
+		t.Errorf("got error retryable false, expected true")
+	}
+	if gotJL.Error != "cannot connect: connection refused" {
+		t.Errorf("got error %q, expected %q", gotJL.Error, "cannot connect: connection refused")
+	}
+}
+
+func TestRunJobErrorPermanent(t *testing.T) {
+	// Job has 2 retries but returns a job.Error that's permanent, so it's tried
+	// only once
+	mJob := &mock.Job{
+		RunReturn: job.Return{
+			State: proto.STATE_FAIL,
+			Error: job.Error{
+				Category:  job.ERROR_CATEGORY_USER,
+				Code:      "bad-arg",
+				Permanent: true,
+				Err:       fmt.Errorf("invalid hostname"),
+			},
+		},
+	}
+	pJob := proto.Job{
+		Id:    "failJob",
+		Type:  "jtype",
+		Bytes: []byte{},
+		Retry: 2,
+	}
+	jlsSent := 0
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			jlsSent += 1
+			return nil
+		},
+	}
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
+
+	ret := jr.Run(noJobData)
+	if ret.FinalState != proto.STATE_FAIL {
+		t.Errorf("final state = %d, expected %d", ret.FinalState, proto.STATE_FAIL)
+	}
+	if ret.Tries != 1 {
+		t.Errorf("tries= %d, expected %d", ret.Tries, 1)
+	}
+	if jlsSent != 1 {
+		t.Errorf("runner sent %d JLs, expected %d", jlsSent, 1)
+	}
+}
+
 // Test to make sure the runner will return when Stop is called.
 func TestRunStop(t *testing.T) {
 	stopChan := make(chan struct{})
@@ -148,7 +384,7 @@ func TestRunStop(t *testing.T) {
 		RetryWait: "30s", // important...the runner will sleep for 30 seconds after the job fails the first time
 	}
 	rmc := &mock.RMClient{}
-	jr := runner.NewRunner(pJob, mJob, "abc", 0, 0, rmc)
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
 
 	// Run the job and let it block.
 	stateChan := make(chan byte)
@@ -196,7 +432,7 @@ func TestRunStatus(t *testing.T) {
 	}
 
 	now := time.Now()
-	jr := runner.NewRunner(pJob, realJob, "abc", 0, 0, &mock.RMClient{})
+	jr := runner.NewRunner(pJob, realJob, &mock.RMClient{}, runner.Config{RequestId: "abc"})
 	gotStatus := jr.Status()
 
 	startTime := gotStatus.StartedAt
@@ -241,12 +477,16 @@ func TestRunPanic(t *testing.T) {
 			return nil
 		},
 	}
-	jr := runner.NewRunner(pJob, mJob, "abc", 0, 0, rmc)
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc"})
 
+	panics := runner.JobPanics.Value()
 	ret := jr.Run(noJobData)
 	if ret.FinalState != proto.STATE_FAIL {
 		t.Errorf("final state = %d, expected %d", ret.FinalState, proto.STATE_FAIL)
 	}
+	if n := runner.JobPanics.Value() - panics; n != 2 {
+		t.Errorf("job panics metric increased by %d, expected 2", n)
+	}
 	if ret.Tries != 2 {
 		t.Errorf("tries= %d, expected %d", ret.Tries, 2)
 	}
@@ -263,6 +503,7 @@ func TestRunPanic(t *testing.T) {
 			State:      proto.STATE_FAIL,
 			Exit:       1,
 			Error:      "panic from job.Run: forced job.Run panic",
+			Stderr:     sentJLs[0].Stderr,
 		},
 		proto.JobLog{
 			RequestId:  "abc",
@@ -275,17 +516,25 @@ func TestRunPanic(t *testing.T) {
 			State:      proto.STATE_FAIL,
 			Exit:       1,
 			Error:      "panic from job.Run: forced job.Run panic",
+			Stderr:     sentJLs[1].Stderr,
 		},
 	}
 	if jlsSent != 2 {
 		t.Errorf("runner sent %d JLs, expected %d", jlsSent, 2)
 	}
+	for i := range sentJLs {
+		sentJLs[i].CPUTime = 0 // varies; see TestUsage
+	}
 	if diff := deep.Equal(expectedJLs, sentJLs); diff != nil {
 		t.Error(diff)
 	}
 	if sentJLs[0].StartedAt == 0 {
 		t.Errorf("expected real value for job log StartedAt, got placeholder 0")
 	}
+	// Stack trace of the panic is saved as stderr
+	if !strings.Contains(sentJLs[0].Stderr, "TestRunPanic") {
+		t.Errorf("job log stderr does not have panic stack trace: %s", sentJLs[0].Stderr)
+	}
 }
 
 func TestRunResumed(t *testing.T) {
@@ -313,7 +562,7 @@ func TestRunResumed(t *testing.T) {
 	// 2 = current tries, 3 = total tries. So this is re-run on try=4,
 	// i.e. always total tries + 1. But since current tries = 2, it'll
 	// only run once (ret.Tries=1) because Retry:2 == max tries = 3.
-	jr := runner.NewRunner(pJob, mJob, "abc", 2, 3, rmc)
+	jr := runner.NewRunner(pJob, mJob, rmc, runner.Config{RequestId: "abc", PrevTries: 2, TotalTries: 3})
 
 	ret := jr.Run(noJobData)
 	if ret.FinalState != proto.STATE_FAIL {
@@ -326,3 +575,512 @@ func TestRunResumed(t *testing.T) {
 		t.Errorf("jle.Try = %d, expected 3", gotJLE.Try)
 	}
 }
+
+// ctxJob is a mock job.ContextJob
+type ctxJob struct {
+	*mock.Job
+	runContextFunc func(ctx context.Context, jobData map[string]interface{}) (job.Return, error)
+}
+
+func (j *ctxJob) RunContext(ctx context.Context, jobData map[string]interface{}) (job.Return, error) {
+	return j.runContextFunc(ctx, jobData)
+}
+
+// A job.ContextJob gets the request deadline in its context, and the job is not
+// retried if the next try would start after the deadline.
+func TestRunDeadline(t *testing.T) {
+	deadline := time.Now().Add(200 * time.Millisecond)
+	var gotDeadline time.Time
+	var gotOk bool
+	tries := 0
+	cJob := &ctxJob{
+		Job: &mock.Job{},
+		runContextFunc: func(ctx context.Context, jobData map[string]interface{}) (job.Return, error) {
+			tries++
+			gotDeadline, gotOk = ctx.Deadline()
+			return job.Return{State: proto.STATE_FAIL}, nil
+		},
+	}
+	pJob := proto.Job{
+		Id:        "deadlineJob",
+		Type:      "jtype",
+		Bytes:     []byte{},
+		Retry:     2,
+		RetryWait: "1s", // longer than deadline
+	}
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			return nil
+		},
+	}
+	jr := runner.NewRunner(pJob, cJob, rmc, runner.Config{RequestId: "abc", Deadline: deadline})
+
+	ret := jr.Run(noJobData)
+	if !gotOk || !gotDeadline.Equal(deadline) {
+		t.Errorf("job context deadline %s (%t), expected %s", gotDeadline, gotOk, deadline)
+	}
+	if tries != 1 {
+		t.Errorf("job ran %d times, expected 1", tries)
+	}
+	if ret.FinalState != proto.STATE_DEADLINE_EXCEEDED {
+		t.Errorf("final state = %d, expected %d", ret.FinalState, proto.STATE_DEADLINE_EXCEEDED)
+	}
+	if ret.Tries != 1 {
+		t.Errorf("tries = %d, expected 1", ret.Tries)
+	}
+}
+
+// A job.ContextJob context is canceled when the job is stopped.
+func TestRunContextStop(t *testing.T) {
+	running := make(chan struct{})
+	cJob := &ctxJob{
+		Job: &mock.Job{},
+		runContextFunc: func(ctx context.Context, jobData map[string]interface{}) (job.Return, error) {
+			close(running)
+			<-ctx.Done()
+			return job.Return{State: proto.STATE_STOPPED}, nil
+		},
+	}
+	pJob := proto.Job{
+		Id:    "ctxJob",
+		Type:  "jtype",
+		Bytes: []byte{},
+	}
+	jr := runner.NewRunner(pJob, cJob, &mock.RMClient{}, runner.Config{RequestId: "abc"})
+
+	doneChan := make(chan runner.Return)
+	go func() {
+		doneChan <- jr.Run(noJobData)
+	}()
+	<-running
+	if err := jr.Stop(); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	select {
+	case ret := <-doneChan:
+		if ret.FinalState != proto.STATE_STOPPED {
+			t.Errorf("final state = %d, expected %d", ret.FinalState, proto.STATE_STOPPED)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("job did not return after Stop, expected context to be canceled")
+	}
+}
+
+type jobFactoryFunc func(job.Id) (job.Job, error)
+
+func (f jobFactoryFunc) Make(jid job.Id) (job.Job, error) {
+	return f(jid)
+}
+
+// StopTry fails the try, and the job is retried with a new job.
+func TestRunStopTry(t *testing.T) {
+	running := make(chan struct{})
+	made := 0
+	jf := jobFactoryFunc(func(jid job.Id) (job.Job, error) {
+		made++
+		if made > 1 {
+			return &mock.Job{RunReturn: job.Return{State: proto.STATE_COMPLETE}}, nil
+		}
+		// First try is stuck until its context is canceled
+		return &ctxJob{
+			Job: &mock.Job{},
+			runContextFunc: func(ctx context.Context, jobData map[string]interface{}) (job.Return, error) {
+				close(running)
+				<-ctx.Done()
+				return job.Return{State: proto.STATE_STOPPED}, fmt.Errorf("canceled")
+			},
+		}, nil
+	})
+	var jls []proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			jls = append(jls, jl)
+			return nil
+		},
+	}
+	pJob := proto.Job{
+		Id:    "stuckJob",
+		Type:  "jtype",
+		Bytes: []byte{},
+		Retry: 1,
+	}
+	jr, err := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc}).Make(pJob, runner.Config{RequestId: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jr.StopTry(); err != runner.ErrNotRunning {
+		t.Errorf("err = %v, expected runner.ErrNotRunning before Run", err)
+	}
+
+	doneChan := make(chan runner.Return)
+	go func() {
+		doneChan <- jr.Run(noJobData)
+	}()
+	<-running
+	if err := jr.StopTry(); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	var ret runner.Return
+	select {
+	case ret = <-doneChan:
+	case <-time.After(time.Second):
+		t.Fatal("job did not return after StopTry, expected context to be canceled")
+	}
+	if ret.FinalState != proto.STATE_COMPLETE || ret.Tries != 2 {
+		t.Errorf("final state = %s, tries = %d, expected STATE_COMPLETE, 2 tries", proto.StateName[ret.FinalState], ret.Tries)
+	}
+	if made != 2 {
+		t.Errorf("made %d jobs, expected 2 (new job for try 2)", made)
+	}
+	if len(jls) != 2 {
+		t.Fatalf("got %d JLs, expected 2", len(jls))
+	}
+	if jls[0].State != proto.STATE_FAIL || jls[0].Error != runner.ErrTryStopped.Error() {
+		t.Errorf("try 1 JL state = %s, error = %s, expected STATE_FAIL, %s", proto.StateName[jls[0].State], jls[0].Error, runner.ErrTryStopped)
+	}
+	if err := jr.StopTry(); err != runner.ErrNotRunning {
+		t.Errorf("err = %v, expected runner.ErrNotRunning after Run", err)
+	}
+}
+
+// scratchJob is a mock job.ScratchJob
+type scratchJob struct {
+	*mock.Job
+	scratch job.Scratch
+}
+
+func (j *scratchJob) SetScratch(s job.Scratch) {
+	j.scratch = s
+}
+
+type scratchJobFactory struct {
+	j *scratchJob
+}
+
+func (f scratchJobFactory) Make(jid job.Id) (job.Job, error) {
+	return f.j, nil
+}
+
+// A job.ScratchJob gets the chain scratch store from the runner factory.
+func TestFactoryScratch(t *testing.T) {
+	sJob := &scratchJob{
+		Job: &mock.Job{},
+	}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: scratchJobFactory{j: sJob}, RMClient: &mock.RMClient{}})
+
+	pJob := proto.Job{
+		Id:    "j1",
+		Type:  "jtype",
+		Bytes: []byte{},
+	}
+	scratch := &mock.Scratch{}
+
+	_, err := rf.Make(pJob, runner.Config{RequestId: "abc", Scratch: scratch})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sJob.scratch != scratch {
+		t.Errorf("job scratch = %v, expected %v", sJob.scratch, scratch)
+	}
+}
+
+// sensitiveJob is a mock job.SensitiveJob
+type sensitiveJob struct {
+	*mock.Job
+	args map[string]interface{}
+}
+
+func (j *sensitiveJob) SetSensitiveArgs(args map[string]interface{}) error {
+	j.args = args
+	return nil
+}
+
+type sensitiveJobFactory struct {
+	j *sensitiveJob
+}
+
+func (f sensitiveJobFactory) Make(jid job.Id) (job.Job, error) {
+	return f.j, nil
+}
+
+// A job.SensitiveJob gets its encrypted args decrypted from the runner factory.
+func TestFactorySensitiveArgs(t *testing.T) {
+	keys, err := argcrypt.NewKeyring(map[string][]byte{"k1": make([]byte, argcrypt.KEY_SIZE)}, "k1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	password, err := argcrypt.Encrypt(keys, "hunter2", "abc", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	pJob := proto.Job{
+		Id:    "j1",
+		Type:  "jtype",
+		Bytes: []byte{},
+		Args: map[string]interface{}{
+			"host":     "db1",
+			"password": password,
+		},
+	}
+
+	sJob := &sensitiveJob{Job: &mock.Job{}}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: sensitiveJobFactory{j: sJob}, RMClient: &mock.RMClient{}, ArgKeys: keys})
+	_, err = rf.Make(pJob, runner.Config{RequestId: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(sJob.args, map[string]interface{}{"password": "hunter2"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Value encrypted for another request doesn't decrypt
+	rf = runner.NewFactory(runner.FactoryConfig{JobFactory: sensitiveJobFactory{j: &sensitiveJob{Job: &mock.Job{}}}, RMClient: &mock.RMClient{}, ArgKeys: keys})
+	_, err = rf.Make(pJob, runner.Config{RequestId: "xyz"})
+	if err == nil {
+		t.Error("no error for value encrypted for another request, expected one")
+	}
+
+	// Without keys (arg encryption not enabled on the JR), the job cannot run
+	rf = runner.NewFactory(runner.FactoryConfig{JobFactory: sensitiveJobFactory{j: &sensitiveJob{Job: &mock.Job{}}}, RMClient: &mock.RMClient{}})
+	_, err = rf.Make(pJob, runner.Config{RequestId: "abc"})
+	if err == nil {
+		t.Error("no error without keys, expected one")
+	}
+}
+
+// Job log entries have the job chain fencing token and the sequence try.
+func TestFactoryFenceToken(t *testing.T) {
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"jtype": {
+				RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+					return job.Return{State: proto.STATE_COMPLETE}, nil
+				},
+			},
+		},
+	}
+	var gotJL proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = jl
+			return nil
+		},
+	}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc})
+
+	pJob := proto.Job{
+		Id:    "j1",
+		Type:  "jtype",
+		Bytes: []byte{},
+	}
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc", FenceToken: 3, SequenceTry: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr.Run(noJobData)
+
+	if gotJL.FenceToken != 3 {
+		t.Errorf("job log fence token = %d, expected 3", gotJL.FenceToken)
+	}
+	if gotJL.SequenceTry != 2 {
+		t.Errorf("job log sequence try = %d, expected 2", gotJL.SequenceTry)
+	}
+}
+
+// The first try's job log and the runner status have how long the job was
+// runnable before it started. Retries don't.
+func TestQueueDelay(t *testing.T) {
+	tries := 0
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"jtype": {
+				RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+					tries++
+					if tries == 1 {
+						return job.Return{State: proto.STATE_FAIL}, nil
+					}
+					return job.Return{State: proto.STATE_COMPLETE}, nil
+				},
+			},
+		},
+	}
+	var gotJLs []proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJLs = append(gotJLs, jl)
+			return nil
+		},
+	}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc})
+
+	pJob := proto.Job{
+		Id:    "j1",
+		Type:  "jtype",
+		Bytes: []byte{},
+		Retry: 1,
+	}
+	runnableAt := time.Now().Add(-2 * time.Second)
+	started := runner.JobsStarted.Value()
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc", RunnableAt: runnableAt})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := jr.Run(noJobData)
+
+	if ret.FinalState != proto.STATE_COMPLETE || ret.Tries != 2 {
+		t.Errorf("final state = %s, tries = %d, expected COMPLETE, 2", proto.StateName[ret.FinalState], ret.Tries)
+	}
+	if ret.QueueDelay < 2*time.Second || ret.QueueDelay > 3*time.Second {
+		t.Errorf("queue delay = %s, expected about 2s", ret.QueueDelay)
+	}
+	if len(gotJLs) != 2 {
+		t.Fatalf("got %d job logs, expected 2", len(gotJLs))
+	}
+	if gotJLs[0].QueueDelay != int64(ret.QueueDelay) {
+		t.Errorf("first try queue delay = %d, expected %d", gotJLs[0].QueueDelay, int64(ret.QueueDelay))
+	}
+	if gotJLs[1].QueueDelay != 0 {
+		t.Errorf("second try queue delay = %d, expected 0", gotJLs[1].QueueDelay)
+	}
+	if s := jr.Status(); s.QueueDelay != ret.QueueDelay {
+		t.Errorf("status queue delay = %s, expected %s", s.QueueDelay, ret.QueueDelay)
+	}
+	if n := runner.JobsStarted.Value(); n != started+1 {
+		t.Errorf("jobs_started = %d, expected %d", n, started+1)
+	}
+	if max := runner.JobQueueDelayMax.Value(); max < 2000 {
+		t.Errorf("job_queue_delay_max_ms = %d, expected >= 2000", max)
+	}
+}
+
+type ctxJobFactory struct {
+	j *ctxJob
+}
+
+func (f ctxJobFactory) Make(jid job.Id) (job.Job, error) {
+	return f.j, nil
+}
+
+// A job.ContextJob gets the request workspace in its context, and the try fails,
+// without retry, if the workspace is larger than its max size after the try.
+func TestFactoryWorkspace(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "spincycle-runner-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	wm, err := workspace.NewManager(tmpdir, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := wm.Create("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotDir string
+	cJob := &ctxJob{
+		Job: &mock.Job{},
+		runContextFunc: func(ctx context.Context, jobData map[string]interface{}) (job.Return, error) {
+			gotDir = job.Workspace(ctx)
+			if err := ioutil.WriteFile(filepath.Join(gotDir, "out"), []byte("more than 10 bytes"), 0600); err != nil {
+				return job.Return{State: proto.STATE_FAIL}, err
+			}
+			return job.Return{State: proto.STATE_COMPLETE}, nil
+		},
+	}
+	var gotJL proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = jl
+			return nil
+		},
+	}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: ctxJobFactory{j: cJob}, RMClient: rmc})
+
+	pJob := proto.Job{
+		Id:    "j1",
+		Type:  "jtype",
+		Bytes: []byte{},
+		Retry: 2,
+	}
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc", Workspace: ws})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := jr.Run(noJobData)
+
+	if gotDir != filepath.Join(tmpdir, "abc") {
+		t.Errorf("job workspace = %s, expected %s", gotDir, filepath.Join(tmpdir, "abc"))
+	}
+	expectRet := runner.Return{FinalState: proto.STATE_FAIL, Tries: 1}
+	if diff := deep.Equal(ret, expectRet); diff != nil {
+		t.Error(diff)
+	}
+	if gotJL.ErrorCode != workspace.ERROR_CODE_QUOTA || gotJL.ErrorRetryable {
+		t.Errorf("job log error code = %s, retryable = %t, expected %s, false", gotJL.ErrorCode, gotJL.ErrorRetryable, workspace.ERROR_CODE_QUOTA)
+	}
+}
+
+// Job logs have the CPU time of the job, which the runner measures on Linux, plus
+// the usage the job reports, and the usage metrics are by job type.
+func TestUsage(t *testing.T) {
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"usage-type": {
+				RunFunc: func(jobData map[string]interface{}) (job.Return, error) {
+					// Use some CPU so the runner can measure it
+					for start := time.Now(); time.Since(start) < 50*time.Millisecond; {
+					}
+					return job.Return{
+						State: proto.STATE_COMPLETE,
+						Usage: job.Usage{CPUTime: time.Second, MaxMemory: 1 << 20},
+					}, nil
+				},
+			},
+		},
+	}
+	var gotJL proto.JobLog
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = jl
+			return nil
+		},
+	}
+	rf := runner.NewFactory(runner.FactoryConfig{JobFactory: jf, RMClient: rmc, MeasureCPU: true})
+
+	pJob := proto.Job{
+		Id:    "j1",
+		Type:  "usage-type",
+		Bytes: []byte{},
+	}
+	jr, err := rf.Make(pJob, runner.Config{RequestId: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ret := jr.Run(noJobData)
+	if ret.FinalState != proto.STATE_COMPLETE {
+		t.Errorf("final state = %s, expected COMPLETE", proto.StateName[ret.FinalState])
+	}
+
+	minCPU := int64(time.Second)
+	if runtime.GOOS == "linux" {
+		minCPU += int64(10 * time.Millisecond)
+	}
+	if gotJL.CPUTime < minCPU {
+		t.Errorf("job log CPU time = %s, expected >= %s", time.Duration(gotJL.CPUTime), time.Duration(minCPU))
+	}
+	if gotJL.MaxMemory != 1<<20 {
+		t.Errorf("job log max memory = %d, expected %d", gotJL.MaxMemory, 1<<20)
+	}
+
+	if v := runner.JobTypeTries.Get("usage-type"); v == nil || v.String() != "1" {
+		t.Errorf("job_type_tries = %v, expected 1", v)
+	}
+	if v, ok := runner.JobTypeCPU.Get("usage-type").(*expvar.Int); !ok || v.Value() < 1000 {
+		t.Errorf("job_type_cpu_ms = %v, expected >= 1000", v)
+	}
+	if v := runner.JobTypeMaxMemory.Get("usage-type"); v == nil || v.String() != "1048576" {
+		t.Errorf("job_type_max_memory_bytes = %v, expected 1048576", v)
+	}
+}
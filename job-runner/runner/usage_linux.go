@@ -0,0 +1,42 @@
+// Copyright 2020, Square, Inc.
+
+package runner
+
+import (
+	"runtime"
+	"syscall"
+	"time"
+)
+
+const rusageThread = 1 // RUSAGE_THREAD, not defined in package syscall
+
+// startCPU locks the calling goroutine to its OS thread and returns a func that
+// unlocks it and returns the CPU time the thread used since startCPU. Since no
+// other goroutine runs on a locked thread, it's the CPU time of the goroutine.
+// The returned func must be called once, from the same goroutine; more calls
+// return zero.
+func startCPU() func() time.Duration {
+	runtime.LockOSThread()
+	start, ok := threadCPU()
+	done := false
+	return func() time.Duration {
+		if done {
+			return 0
+		}
+		done = true
+		end, endOk := threadCPU()
+		runtime.UnlockOSThread()
+		if !ok || !endOk || end < start {
+			return 0
+		}
+		return end - start
+	}
+}
+
+func threadCPU() (time.Duration, bool) {
+	var ru syscall.Rusage
+	if err := syscall.Getrusage(rusageThread, &ru); err != nil {
+		return 0, false
+	}
+	return time.Duration(ru.Utime.Nano() + ru.Stime.Nano()), true
+}
@@ -0,0 +1,16 @@
+// Copyright 2020, Square, Inc.
+
+//go:build !linux
+// +build !linux
+
+package runner
+
+import (
+	"time"
+)
+
+// startCPU returns noCPU: the CPU time of a goroutine cannot be measured on
+// this platform.
+func startCPU() func() time.Duration {
+	return noCPU
+}
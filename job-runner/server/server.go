@@ -15,13 +15,23 @@ import (
 	"github.com/orcaman/concurrent-map"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/square/spincycle/v2/argcrypt"
 	"github.com/square/spincycle/v2/config"
 	"github.com/square/spincycle/v2/job-runner/api"
 	"github.com/square/spincycle/v2/job-runner/app"
+	"github.com/square/spincycle/v2/job-runner/batch"
+	"github.com/square/spincycle/v2/job-runner/breaker"
 	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/job-runner/replay"
 	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/job-runner/spool"
 	"github.com/square/spincycle/v2/job-runner/status"
+	"github.com/square/spincycle/v2/job-runner/workspace"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/job/registry"
+	"github.com/square/spincycle/v2/job/wait"
 	"github.com/square/spincycle/v2/jobs"
+	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/request-manager"
 )
 
@@ -31,6 +41,15 @@ type Server struct {
 	traverserRepo cmap.ConcurrentMap
 	chainRepo     chain.Repo
 	rmc           rm.Client
+	delivery      *spool.Client
+	statusPusher  *status.Pusher
+	monitor       *status.Monitor
+	jobRegistry   *registry.Registry
+
+	shutdownPolicy     chain.ShutdownPolicy
+	timeouts           chain.Timeouts
+	statusPushInterval time.Duration // zero if push disabled
+	guardrailsInterval time.Duration
 
 	shutdownChan chan struct{}
 	apiStopped   chan struct{}
@@ -89,6 +108,43 @@ func (s *Server) Run(stopOnSignal bool) error {
 		}
 	}()
 
+	// Deliver job logs and final chain states queued while the RM is unreachable.
+	// This runs until Stop, after traversers are done, so their last job logs
+	// and final states are delivered, too.
+	go s.delivery.Run()
+
+	// Check goroutines and heap memory on an interval. When over a guardrail
+	// watermark, the API does not start new job chains.
+	go func() {
+		ticker := time.NewTicker(s.guardrailsInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				s.monitor.Check()
+			case <-s.shutdownChan:
+				return
+			}
+		}
+	}()
+
+	// If enabled, push running status to the RM on an interval. This is best
+	// effort, too: the RM polls this JR if pushes stop.
+	if s.statusPushInterval > 0 {
+		go func() {
+			ticker := time.NewTicker(s.statusPushInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					s.statusPusher.Push()
+				case <-s.shutdownChan:
+					return
+				}
+			}
+		}()
+	}
+
 	// Run the API - this will block until the API is stopped (or encounters
 	// some fatal error). If the RunAPI hook has been provided, call that instead
 	// of the default api.Run.
@@ -139,7 +195,22 @@ func (s *Server) Boot() error {
 	cfg.RMClient.TLS.CertFile = config.Env("SPINCYCLE_RM_CLIENT_TLS_CERT_FILE", cfg.RMClient.TLS.CertFile)
 	cfg.RMClient.TLS.KeyFile = config.Env("SPINCYCLE_RM_CLIENT_TLS_KEY_FILE", cfg.RMClient.TLS.KeyFile)
 	cfg.RMClient.TLS.CAFile = config.Env("SPINCYCLE_RM_CLIENT_TLS_CA_FILE", cfg.RMClient.TLS.CAFile)
+	cfg.StatusPush.Interval = config.Env("SPINCYCLE_STATUS_PUSH_INTERVAL", cfg.StatusPush.Interval)
+	cfg.Delivery.SpoolDir = config.Env("SPINCYCLE_DELIVERY_SPOOL_DIR", cfg.Delivery.SpoolDir)
+	cfg.Debug.RecordDir = config.Env("SPINCYCLE_DEBUG_RECORD_DIR", cfg.Debug.RecordDir)
+	cfg.ArgEncryption.KeyFile = config.Env("SPINCYCLE_ARG_ENCRYPTION_KEY_FILE", cfg.ArgEncryption.KeyFile)
+	cfg.Standby.Enabled = config.Env("SPINCYCLE_STANDBY_ENABLED", fmt.Sprintf("%t", cfg.Standby.Enabled)) == "true"
 	s.appCtx.Config = cfg
+	if cfg.JobChainSchemaVersion != nil {
+		if err := proto.SetEncodeSchemaVersion(*cfg.JobChainSchemaVersion); err != nil {
+			return fmt.Errorf("invalid job_chain_schema_version: %s", err)
+		}
+	}
+	if cfg.JobChainFormat != "" {
+		if err := proto.SetChainFormat(cfg.JobChainFormat); err != nil {
+			return fmt.Errorf("invalid job_chain_format: %s", err)
+		}
+	}
 	cfgstr, _ := json.MarshalIndent(cfg, "", "  ")
 	log.Printf("Config: %s", cfgstr)
 
@@ -149,6 +220,38 @@ func (s *Server) Boot() error {
 	if err != nil {
 		return fmt.Errorf("MakeRequestManagerClient: %s", err)
 	}
+
+	// Job logs are sent in batches, if enabled, to make fewer calls to the RM.
+	// The delivery client below wraps this client, so batches are queued too.
+	if cfg.Delivery.BatchSize > 0 {
+		batchInterval, err := time.ParseDuration(cfg.Delivery.BatchInterval)
+		if err != nil || batchInterval <= 0 {
+			return fmt.Errorf("invalid delivery.batch_interval %s: must be a duration greater than zero", cfg.Delivery.BatchInterval)
+		}
+		rmc = batch.NewClient(rmc, batch.Config{
+			Size:     cfg.Delivery.BatchSize,
+			Interval: batchInterval,
+		})
+		log.Infof("Sending job logs in batches of up to %d every %s", cfg.Delivery.BatchSize, batchInterval)
+	}
+
+	// Job logs and final chain states are queued (and spooled to disk, if
+	// configured) while the RM is unreachable, then delivered in order, so
+	// they're not lost during RM outages. Wrapping the RM client makes this
+	// transparent to runners and traversers.
+	flushInterval, err := time.ParseDuration(cfg.Delivery.FlushInterval)
+	if err != nil {
+		return fmt.Errorf("invalid delivery.flush_interval %s: %s", cfg.Delivery.FlushInterval, err)
+	}
+	s.delivery, err = spool.NewClient(rmc, spool.Config{
+		SpoolDir:      cfg.Delivery.SpoolDir,
+		FlushInterval: flushInterval,
+		MaxQueued:     cfg.Delivery.MaxQueued,
+	})
+	if err != nil {
+		return fmt.Errorf("invalid delivery config: %s", err)
+	}
+	rmc = s.delivery
 	s.rmc = rmc
 
 	// Chain repo holds running job chains in memory. It's primarily used by
@@ -156,35 +259,157 @@ func (s *Server) Boot() error {
 	// to report status back to RM (then back to user).
 	s.chainRepo = chain.NewMemoryRepo()
 
+	// The job factory makes built-in wait jobs (wait nodes in request specs)
+	// and poll jobs (type spincycle/poll), job types loaded from plugins (jobs.plugin_dir), and uses the user-provided
+	// jobs.Factory to make all other jobs.
+	//
+	// In debug mode, every job chain and job try is recorded so jobs can be
+	// replayed locally (see job-runner/replay). The recorder wraps the job
+	// factory and, below, the traverser factory.
+	s.jobRegistry = registry.New(jobs.Factory)
+	if cfg.Jobs.PluginDir != "" {
+		plugins, err := s.jobRegistry.Load(cfg.Jobs.PluginDir)
+		if err != nil {
+			return fmt.Errorf("error loading job plugins from jobs.plugin_dir %s: %s", cfg.Jobs.PluginDir, err)
+		}
+		for _, p := range plugins {
+			log.Infof("Loaded job plugin %s %s: %d job types", p.Name, p.Version, len(p.Jobs))
+		}
+	}
+	jf := wait.NewFactory(poll.NewFactory(s.jobRegistry))
+	var recorder *replay.Recorder
+	if cfg.Debug.RecordDir != "" {
+		recorder, err = replay.NewRecorder(cfg.Debug.RecordDir)
+		if err != nil {
+			return fmt.Errorf("invalid debug.record_dir %s: %s", cfg.Debug.RecordDir, err)
+		}
+		log.Warnf("Debug mode: recording job chains and job data in %s", cfg.Debug.RecordDir)
+		jf = recorder.JobFactory(jf)
+	}
+
+	// Arg key provider decrypts sensitive job args just before jobs run, nil if
+	// arg encryption is disabled. The factory is nil in custom app contexts that
+	// predate it.
+	var argKeys argcrypt.KeyProvider
+	if s.appCtx.Factories.MakeArgKeyProvider != nil {
+		argKeys, err = s.appCtx.Factories.MakeArgKeyProvider(s.appCtx)
+		if err != nil {
+			return fmt.Errorf("MakeArgKeyProvider: %s", err)
+		}
+	}
+	if argKeys != nil {
+		log.Infof("Arg encryption enabled: decrypting sensitive job args")
+	}
+
+	// Circuit breaker fails or holds jobs of types that keep failing. It's
+	// optional: disabled if no failure rate is set.
+	var cb *breaker.Breaker
+	if cfg.CircuitBreaker.FailureRate > 0 {
+		cbCfg, err := breakerConfig(cfg.CircuitBreaker)
+		if err != nil {
+			return err
+		}
+		cb = breaker.New(cbCfg)
+		log.Infof("Circuit breaker enabled: %+v", cfg.CircuitBreaker)
+	}
+
 	// Runner Factory makes a job.Runner to run one job. It's used by chain.Traversers
 	// to run jobs.
-	rf := runner.NewFactory(jobs.Factory, rmc)
+	rf := runner.NewFactory(runner.FactoryConfig{
+		JobFactory: jf,
+		RMClient:   rmc,
+		ArgKeys:    argKeys,
+		Breaker:    cb,
+		MeasureCPU: cfg.Jobs.MeasureCPU,
+	})
 
 	// Traverser Factory is used by API to make a new chain.Traverser to run a
 	// job chain. These are stored in a Traverser Repo (just a map) so API can
 	// keep track of what's running.
-	trFactory := chain.NewTraverserFactory(s.chainRepo, rf, rmc, s.shutdownChan)
-	s.traverserRepo = cmap.New()
-
-	// Status Manager reports what's happening in the JR
-	stat := status.NewManager(s.traverserRepo)
+	//
+	// The shutdown policy determines how long traversers let their chains run
+	// when the JR is shutting down before suspending them.
+	shutdownPolicy, err := chain.NewShutdownPolicy(cfg.Shutdown)
+	if err != nil {
+		return fmt.Errorf("invalid shutdown config: %s", err)
+	}
+	s.shutdownPolicy = shutdownPolicy
+	s.timeouts, err = chain.NewTimeouts(cfg.Traverser)
+	if err != nil {
+		return fmt.Errorf("invalid traverser config: %s", err)
+	}
 
 	// Base URL is what this JR reports itself as, e.g. https://spin-jr.prod.local:32307
 	// The RM saves this so it knows which JR to query to get the status of a
-	// given request.
+	// given request. Traversers send it with final request states so the RM
+	// can fence this JR if another JR took over the request.
 	baseURL, err := s.appCtx.Hooks.ServerURL(s.appCtx)
 	if err != nil {
 		return fmt.Errorf("error getting base server URL: %s", err)
 	}
 
+	// Request workspaces are optional: disabled if no dir is set.
+	var workspaces *workspace.Manager
+	if cfg.Workspace.Dir != "" {
+		workspaces, err = workspace.NewManager(cfg.Workspace.Dir, int64(cfg.Workspace.MaxMB)*1024*1024)
+		if err != nil {
+			return fmt.Errorf("invalid workspace.dir %s: %s", cfg.Workspace.Dir, err)
+		}
+		log.Infof("Request workspaces in %s (max %d MB, 0 = no max)", cfg.Workspace.Dir, cfg.Workspace.MaxMB)
+	}
+
+	trFactory := chain.NewTraverserFactory(s.chainRepo, rf, rmc, baseURL, s.shutdownChan, shutdownPolicy, s.timeouts, workspaces)
+	if recorder != nil {
+		trFactory = recorder.TraverserFactory(trFactory)
+	}
+	s.traverserRepo = cmap.New()
+
+	// Status Manager reports what's happening in the JR
+	stat := status.NewManager(s.traverserRepo, s.appCtx.Config.Limits.JobStatus)
+
+	// Monitor checks goroutines and heap memory against the guardrail watermarks.
+	// It's checked once now so health is reported before the first interval.
+	s.guardrailsInterval, err = time.ParseDuration(cfg.Guardrails.CheckInterval)
+	if err != nil || s.guardrailsInterval <= 0 {
+		return fmt.Errorf("invalid guardrails.check_interval %s: must be a duration greater than zero", cfg.Guardrails.CheckInterval)
+	}
+	s.monitor = status.NewMonitor(cfg.Guardrails.MaxGoroutines, cfg.Guardrails.MaxHeapMB)
+	s.monitor.Check()
+
+	// Status pusher sends running status to the RM so it doesn't have to poll
+	// this JR. It's optional: push is disabled if no interval is set.
+	if cfg.StatusPush.Interval != "" {
+		s.statusPushInterval, err = time.ParseDuration(cfg.StatusPush.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid status_push.interval %s: %s", cfg.StatusPush.Interval, err)
+		}
+	}
+	s.statusPusher = &status.Pusher{
+		Status:    stat,
+		RMC:       rmc,
+		BaseURL:   baseURL,
+		Monitor:   s.monitor,
+		Labels:    cfg.StatusPush.Labels,
+		Breaker:   cb,
+		Deltas:    cfg.StatusPush.Deltas,
+		FullEvery: cfg.StatusPush.FullEvery,
+	}
+
 	// The API instance
 	apiCfg := api.Config{
 		AppCtx:           s.appCtx,
 		TraverserFactory: trFactory,
 		TraverserRepo:    s.traverserRepo,
 		StatusManager:    stat,
+		Monitor:          s.monitor,
 		ShutdownChan:     s.shutdownChan,
 		BaseURL:          baseURL,
+		JobRegistry:      s.jobRegistry,
+		Standby:          cfg.Standby.Enabled,
+		Breaker:          cb,
+	}
+	if cfg.Standby.Enabled {
+		log.Warnf("Standby mode: not starting new job chains, only resuming job chains taken over from other Job Runners")
 	}
 	s.api = api.NewAPI(apiCfg)
 
@@ -217,8 +442,9 @@ func (s *Server) Stop() error {
 	close(s.shutdownChan)
 
 	// Wait for all traversers to shut down. Timeout if they aren't done
-	// within 20 seconds, and continue to shutting down the API.
-	timeout := time.After(20 * time.Second)
+	// within the stop and send timeouts (plus the longest time that the shutdown
+	// policy lets chains keep running), and continue to shutting down the API.
+	timeout := time.After(s.timeouts.Stop + s.timeouts.Send + s.shutdownPolicy.Max())
 WAIT_FOR_TRAVERSERS:
 	for !s.traverserRepo.IsEmpty() {
 		select {
@@ -229,6 +455,10 @@ WAIT_FOR_TRAVERSERS:
 		}
 	}
 
+	// Deliver job logs and final chain states still queued, if the RM is
+	// reachable. Else they're left in the spool dir, if configured.
+	s.delivery.Stop()
+
 	// Stop the API, using the StopAPI hook if provided and api.Stop otherwise.
 	var err error
 	if s.appCtx.Hooks.StopAPI != nil {
@@ -263,3 +493,31 @@ func (s *Server) waitForShutdown() {
 		log.Errorf("error shutting down server: %s", err)
 	}
 }
+
+// breakerConfig returns the circuit breaker config, validated.
+func breakerConfig(cfg config.CircuitBreaker) (breaker.Config, error) {
+	var cbCfg breaker.Config
+	if cfg.FailureRate <= 0 || cfg.FailureRate >= 1 {
+		return cbCfg, fmt.Errorf("invalid circuit_breaker.failure_rate %v: must be greater than 0 and less than 1", cfg.FailureRate)
+	}
+	window, err := time.ParseDuration(cfg.Window)
+	if err != nil || window <= 0 {
+		return cbCfg, fmt.Errorf("invalid circuit_breaker.window %s: must be a duration greater than zero", cfg.Window)
+	}
+	cooldown, err := time.ParseDuration(cfg.Cooldown)
+	if err != nil || cooldown <= 0 {
+		return cbCfg, fmt.Errorf("invalid circuit_breaker.cooldown %s: must be a duration greater than zero", cfg.Cooldown)
+	}
+	switch cfg.Action {
+	case breaker.ACTION_FAIL, breaker.ACTION_WAIT:
+	default:
+		return cbCfg, fmt.Errorf("invalid circuit_breaker.action %s: valid actions: %s, %s", cfg.Action, breaker.ACTION_FAIL, breaker.ACTION_WAIT)
+	}
+	return breaker.Config{
+		FailureRate: cfg.FailureRate,
+		MinTries:    cfg.MinTries,
+		Window:      window,
+		Cooldown:    cooldown,
+		Action:      cfg.Action,
+	}, nil
+}
@@ -0,0 +1,395 @@
+// Copyright 2020, Square, Inc.
+
+// Package spool delivers job logs and final job chain states to the Request
+// Manager, queuing them while it's unreachable.
+package spool
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager"
+)
+
+// FLUSH_BATCH_SIZE is the max number of queued entries that Flush sends to the
+// Request Manager in one call (rm.Client.Deliver).
+const FLUSH_BATCH_SIZE = 100
+
+// ErrQueueFull is returned by CreateJL and FinishRequest when the Request Manager
+// is unreachable and the queue has Config.MaxQueued entries.
+var ErrQueueFull = errors.New("delivery queue full")
+
+// Config configures a Client.
+type Config struct {
+	SpoolDir      string        // save queued entries here, if set, else only queue in memory
+	FlushInterval time.Duration // how often Run tries to deliver queued entries
+	MaxQueued     uint          // max queued entries, 0 = no max
+}
+
+// entry is a queued job log or final chain state. It's the format of spool files.
+type entry struct {
+	Seq       uint64               `json:"seq"`
+	RequestId string               `json:"requestId"`
+	JobLog    *proto.JobLog        `json:"jobLog,omitempty"`
+	Finish    *proto.FinishRequest `json:"finish,omitempty"`
+}
+
+// Client is an rm.Client that queues job logs (CreateJL) and final job chain states
+// (FinishRequest) if the Request Manager is unreachable, and delivers them in order
+// when it's reachable again (see Run). If Config.SpoolDir is set, queued entries
+// are saved there too, so they are delivered after the Job Runner restarts. Other
+// methods call the Request Manager directly.
+//
+// CreateJL and FinishRequest return nil if the entry is delivered or queued, and
+// return an error only if the Request Manager returns a permanent error (HTTP 4xx
+// other than 409 and 429, like request not found) or the queue is full. Errors
+// without an HTTP status (network errors), HTTP 5xx, and 429 are retried. HTTP
+// 409 (conflict) is treated as delivered: the Request Manager already has the
+// entry, like a duplicate job log, or won't take it because the request was
+// resumed on another Job Runner (fenced), so sending it again won't change anything.
+type Client struct {
+	rm.Client
+	cfg Config
+
+	mux   *sync.Mutex // guards queue and seq
+	queue []entry
+	seq   uint64
+
+	flushMux *sync.Mutex // serializes flushes
+	noBatch  bool        // Request Manager can't Deliver, guarded by flushMux
+	running  bool        // Run called, guarded by mux
+	stopChan chan struct{}
+	doneChan chan struct{}
+}
+
+// NewClient returns a Client that delivers to the Request Manager using rmc. If
+// cfg.SpoolDir is set, it's created if needed, and entries spooled by a previous
+// Job Runner are queued for delivery.
+func NewClient(rmc rm.Client, cfg Config) (*Client, error) {
+	c := &Client{
+		Client:   rmc,
+		cfg:      cfg,
+		mux:      &sync.Mutex{},
+		queue:    []entry{},
+		flushMux: &sync.Mutex{},
+		stopChan: make(chan struct{}),
+		doneChan: make(chan struct{}),
+	}
+	if cfg.SpoolDir != "" {
+		if err := os.MkdirAll(cfg.SpoolDir, 0700); err != nil {
+			return nil, err
+		}
+		if err := c.load(); err != nil {
+			return nil, fmt.Errorf("error loading spool dir %s: %s", cfg.SpoolDir, err)
+		}
+		if len(c.queue) > 0 {
+			log.Infof("%d job logs and final chain states spooled in %s, delivering to Request Manager", len(c.queue), cfg.SpoolDir)
+		}
+	}
+	return c, nil
+}
+
+func (c *Client) CreateJL(requestId string, jl proto.JobLog) error {
+	return c.deliver(entry{RequestId: requestId, JobLog: &jl})
+}
+
+func (c *Client) FinishRequest(fr proto.FinishRequest) error {
+	return c.deliver(entry{RequestId: fr.RequestId, Finish: &fr})
+}
+
+// Queued returns the number of queued entries.
+func (c *Client) Queued() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.queue)
+}
+
+// Run delivers queued entries every Config.FlushInterval until Stop is called.
+// It blocks, so call it in a goroutine.
+func (c *Client) Run() {
+	c.mux.Lock()
+	c.running = true
+	c.mux.Unlock()
+	defer close(c.doneChan)
+	ticker := time.NewTicker(c.cfg.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.Flush()
+		case <-c.stopChan:
+			c.Flush() // last try
+			if n := c.Queued(); n > 0 {
+				if c.cfg.SpoolDir != "" {
+					log.Warnf("%d job logs and final chain states not delivered to Request Manager, spooled in %s", n, c.cfg.SpoolDir)
+				} else {
+					log.Errorf("%d job logs and final chain states not delivered to Request Manager, lost (spool_dir not set)", n)
+				}
+			}
+			return
+		}
+	}
+}
+
+// Stop stops Run after it tries to deliver queued entries one last time. Call
+// it after all job chains have finished or been suspended. If Run was not called,
+// Stop tries to deliver queued entries and returns.
+func (c *Client) Stop() {
+	close(c.stopChan)
+	c.mux.Lock()
+	running := c.running
+	c.mux.Unlock()
+	if !running {
+		c.Flush()
+		return
+	}
+	<-c.doneChan
+}
+
+// Flush delivers queued entries in order, up to FLUSH_BATCH_SIZE per call to the
+// Request Manager, until the queue is empty or the Request Manager is unreachable.
+// Entries that the Request Manager rejects permanently (HTTP 4xx other than 409
+// and 429) are logged and dropped, and entries it rejects with 409 are delivered.
+func (c *Client) Flush() {
+	c.flushMux.Lock()
+	defer c.flushMux.Unlock()
+	for {
+		c.mux.Lock()
+		n := len(c.queue)
+		if n > FLUSH_BATCH_SIZE {
+			n = FLUSH_BATCH_SIZE
+		}
+		batch := make([]entry, n)
+		copy(batch, c.queue)
+		c.mux.Unlock()
+		if n == 0 {
+			return
+		}
+
+		done, err := c.sendBatch(batch)
+
+		c.mux.Lock()
+		c.queue = c.queue[done:]
+		c.mux.Unlock()
+		for _, e := range batch[:done] {
+			c.unspool(e)
+		}
+
+		if err != nil {
+			log.Warnf("cannot deliver job logs and final chain states to Request Manager (%d queued): %s", c.Queued(), err)
+			return
+		}
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// deliver sends the entry to the Request Manager, or queues it if other entries
+// are queued (to keep order) or the Request Manager is unreachable.
+func (c *Client) deliver(e entry) error {
+	if c.Queued() == 0 {
+		err := c.send(e)
+		if err != nil && delivered(err) {
+			log.Infof("Request Manager already has %s or won't take it: %s", e, err)
+			return nil
+		}
+		if err == nil || !retryable(err) {
+			return err
+		}
+		log.Warnf("cannot deliver %s to Request Manager, queuing it: %s", e, err)
+	}
+
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	if c.cfg.MaxQueued > 0 && uint(len(c.queue)) >= c.cfg.MaxQueued {
+		return ErrQueueFull
+	}
+	c.seq++
+	e.Seq = c.seq
+	if err := c.spool(e); err != nil {
+		// Still queue in memory; it's only lost if the JR restarts
+		log.Errorf("cannot spool %s: %s", e, err)
+	}
+	c.queue = append(c.queue, e)
+	return nil
+}
+
+func (c *Client) send(e entry) error {
+	if e.JobLog != nil {
+		return c.Client.CreateJL(e.RequestId, *e.JobLog)
+	}
+	return c.Client.FinishRequest(*e.Finish)
+}
+
+// sendBatch sends the entries to the Request Manager and returns how many of them,
+// from the first, are done: delivered, or dropped because the Request Manager rejected
+// them permanently. If not all are done, it returns the retryable error that stopped
+// delivery. The Request Manager applies deliveries in order and idempotently, so
+// entries it applied before a lost response are not applied twice when sent again.
+func (c *Client) sendBatch(batch []entry) (int, error) {
+	if c.noBatch {
+		return c.sendOne(batch[0])
+	}
+
+	deliveries := make([]proto.Delivery, len(batch))
+	for i, e := range batch {
+		deliveries[i] = proto.Delivery{RequestId: e.RequestId, JobLog: e.JobLog, Finish: e.Finish}
+	}
+	results, err := c.Client.Deliver(deliveries)
+	if err != nil {
+		if retryable(err) {
+			return 0, err
+		}
+		// Request Manager older than POST /api/v1/deliveries (HTTP 404), so send
+		// entries one at a time from now on
+		log.Warnf("Request Manager cannot deliver batches, sending job logs and final chain states one at a time: %s", err)
+		c.noBatch = true
+		return c.sendOne(batch[0])
+	}
+
+	for i, res := range results {
+		if i == len(batch) {
+			break
+		}
+		if res.Delivered {
+			continue
+		}
+		if res.Error == nil || retryable(*res.Error) {
+			return i, fmt.Errorf("cannot deliver %s: %v", batch[i], res.Error)
+		}
+		if delivered(*res.Error) {
+			log.Infof("Request Manager already has %s or won't take it: %s", batch[i], res.Error.Message)
+			continue
+		}
+		log.Errorf("dropping %s: %s", batch[i], res.Error.Message)
+	}
+	if len(results) < len(batch) {
+		return len(results), fmt.Errorf("Request Manager delivered %d of %d job logs and final chain states", len(results), len(batch))
+	}
+	return len(batch), nil
+}
+
+// sendOne sends the entry to the Request Manager with the single-item endpoints
+// and returns 1 (done) if it was delivered or dropped, like sendBatch.
+func (c *Client) sendOne(e entry) (int, error) {
+	err := c.send(e)
+	if err != nil && retryable(err) {
+		return 0, err
+	}
+	if err != nil && delivered(err) {
+		log.Infof("Request Manager already has %s or won't take it: %s", e, err)
+	} else if err != nil {
+		log.Errorf("dropping %s: %s", e, err)
+	}
+	return 1, nil
+}
+
+// retryable returns true if sending again might succeed: the error has no HTTP
+// status (like a network error), or it's HTTP 5xx (like 503 when the Request
+// Manager write buffer is full) or 429. Other HTTP 4xx errors are permanent.
+func retryable(err error) bool {
+	status := httpStatus(err)
+	return status == 0 || status >= http.StatusInternalServerError || status == http.StatusTooManyRequests
+}
+
+// delivered returns true if the error is HTTP 409 (conflict). See Client.
+func delivered(err error) bool {
+	return httpStatus(err) == http.StatusConflict
+}
+
+// httpStatus returns the HTTP status of an error returned by the rm.Client, or
+// zero if it's not an API error. The rm.Client returns a proto.Error for HTTP 404
+// and 409, and an rm.APIError for other HTTP errors. A proto.Error without a
+// status is from a Request Manager that doesn't set it, so it's a 404.
+func httpStatus(err error) int {
+	var perr proto.Error
+	if errors.As(err, &perr) {
+		if perr.HTTPStatus == 0 {
+			return http.StatusNotFound
+		}
+		return perr.HTTPStatus
+	}
+	var apiErr rm.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.HTTPStatus
+	}
+	return 0
+}
+
+func (e entry) String() string {
+	if e.JobLog != nil {
+		return fmt.Sprintf("job log for request %s job %s try %d", e.RequestId, e.JobLog.JobId, e.JobLog.Try)
+	}
+	return fmt.Sprintf("final state of request %s (%s)", e.RequestId, proto.StateName[e.Finish.State])
+}
+
+// spool saves the entry in Config.SpoolDir, if set. The file is written then
+// renamed so a partial file is never loaded.
+func (c *Client) spool(e entry) error {
+	if c.cfg.SpoolDir == "" {
+		return nil
+	}
+	bytes, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	file := c.file(e)
+	if err := ioutil.WriteFile(file+".tmp", bytes, 0600); err != nil {
+		return err
+	}
+	return os.Rename(file+".tmp", file)
+}
+
+func (c *Client) unspool(e entry) {
+	if c.cfg.SpoolDir == "" {
+		return
+	}
+	if err := os.Remove(c.file(e)); err != nil && !os.IsNotExist(err) {
+		log.Errorf("cannot remove spooled %s: %s", e, err)
+	}
+}
+
+func (c *Client) file(e entry) string {
+	return filepath.Join(c.cfg.SpoolDir, fmt.Sprintf("%020d.json", e.Seq))
+}
+
+// load queues entries spooled in Config.SpoolDir, in order.
+func (c *Client) load() error {
+	files, err := filepath.Glob(filepath.Join(c.cfg.SpoolDir, "*.json"))
+	if err != nil {
+		return err
+	}
+	sort.Strings(files) // zero-padded seq
+	for _, file := range files {
+		bytes, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		var e entry
+		if err := json.Unmarshal(bytes, &e); err != nil || (e.JobLog == nil && e.Finish == nil) {
+			log.Errorf("ignoring invalid spool file %s: %v", file, err)
+			continue
+		}
+		c.queue = append(c.queue, e)
+		if e.Seq > c.seq {
+			c.seq = e.Seq
+		}
+	}
+	// Remove partial files from a crash while spooling
+	tmp, _ := filepath.Glob(filepath.Join(c.cfg.SpoolDir, "*.json.tmp"))
+	for _, file := range tmp {
+		os.Remove(file)
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+// Copyright 2020, Square, Inc.
+
+package spool_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/job-runner/spool"
+	"github.com/square/spincycle/v2/proto"
+	rm "github.com/square/spincycle/v2/request-manager"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+var errDown = fmt.Errorf("dial tcp 127.0.0.1:32308: connect: connection refused")
+
+func TestDeliverDirect(t *testing.T) {
+	gotJL := []proto.JobLog{}
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = append(gotJL, jl)
+			return nil
+		},
+	}
+	c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1}); err != nil {
+		t.Errorf("got err '%s', expected nil", err)
+	}
+	if c.Queued() != 0 {
+		t.Errorf("%d queued, expected 0", c.Queued())
+	}
+	if len(gotJL) != 1 {
+		t.Errorf("RM got %d job logs, expected 1", len(gotJL))
+	}
+}
+
+func TestNotFoundNotQueued(t *testing.T) {
+	rmc := &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			return proto.Error{Message: "request req1 not found"}
+		},
+	}
+	c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.FinishRequest(proto.FinishRequest{RequestId: "req1", State: proto.STATE_COMPLETE})
+	if _, ok := err.(proto.Error); !ok {
+		t.Errorf("got err %#v, expected proto.Error", err)
+	}
+	if c.Queued() != 0 {
+		t.Errorf("%d queued, expected 0", c.Queued())
+	}
+}
+
+func TestDeliverErrors(t *testing.T) {
+	// Network errors, 5xx, and 429 are queued; 409 is delivered; other 4xx are
+	// permanent, so they're returned and not queued
+	tests := []struct {
+		err      error
+		queued   int
+		returned bool
+	}{
+		{errDown, 1, false},
+		{rm.APIError{HTTPStatus: 503, Message: "write buffer full"}, 1, false},
+		{rm.APIError{HTTPStatus: 500, Message: "db error"}, 1, false},
+		{rm.APIError{HTTPStatus: 429, Message: "too many requests"}, 1, false},
+		{proto.Error{Message: "duplicate job log", HTTPStatus: 409}, 0, false},
+		{proto.Error{Message: "request req1 not found", HTTPStatus: 404}, 0, true},
+		{rm.APIError{HTTPStatus: 400, Message: "bad job log"}, 0, true},
+		{rm.APIError{HTTPStatus: 401, Message: "not authorized"}, 0, true},
+	}
+	for _, test := range tests {
+		sendErr := test.err
+		rmc := &mock.RMClient{
+			CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+				return sendErr
+			},
+		}
+		c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second})
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1})
+		if (err != nil) != test.returned {
+			t.Errorf("%s: got err %v, expected error returned = %t", test.err, err, test.returned)
+		}
+		if c.Queued() != test.queued {
+			t.Errorf("%s: %d queued, expected %d", test.err, c.Queued(), test.queued)
+		}
+	}
+}
+
+func TestQueueAndFlushInOrder(t *testing.T) {
+	// RM is down: job logs and final state are queued, then delivered in order
+	// when it's back up
+	down := true
+	got := []string{}
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			if down {
+				return errDown
+			}
+			got = append(got, jl.JobId)
+			return nil
+		},
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			if down {
+				return errDown
+			}
+			got = append(got, "finish")
+			return nil
+		},
+	}
+	c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1})
+	c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job2", Try: 1})
+	c.FinishRequest(proto.FinishRequest{RequestId: "req1", State: proto.STATE_COMPLETE})
+	if c.Queued() != 3 {
+		t.Fatalf("%d queued, expected 3", c.Queued())
+	}
+
+	c.Flush() // still down
+	if c.Queued() != 3 {
+		t.Errorf("%d queued, expected 3", c.Queued())
+	}
+
+	down = false
+	c.Flush()
+	if c.Queued() != 0 {
+		t.Errorf("%d queued, expected 0", c.Queued())
+	}
+	expect := []string{"job1", "job2", "finish"}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestMaxQueued(t *testing.T) {
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			return errDown
+		},
+	}
+	c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second, MaxQueued: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1"}); err != nil {
+		t.Errorf("got err '%s', expected nil", err)
+	}
+	if err := c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job2"}); err != spool.ErrQueueFull {
+		t.Errorf("got err '%v', expected ErrQueueFull", err)
+	}
+}
+
+func TestSpoolDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spincycle-spool")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// First JR: RM is down, so job log and final state are spooled
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			return errDown
+		},
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			return errDown
+		},
+	}
+	c, err := spool.NewClient(rmc, spool.Config{SpoolDir: dir, FlushInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1})
+	c.FinishRequest(proto.FinishRequest{RequestId: "req1", State: proto.STATE_FAIL, FinishedJobs: 1})
+	c.Stop()
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("%d spool files, expected 2", len(files))
+	}
+
+	// Next JR: RM is up, so spooled entries are loaded and delivered
+	gotJL := []proto.JobLog{}
+	gotFR := []proto.FinishRequest{}
+	rmc = &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			gotJL = append(gotJL, jl)
+			return nil
+		},
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			gotFR = append(gotFR, fr)
+			return nil
+		},
+	}
+	c, err = spool.NewClient(rmc, spool.Config{SpoolDir: dir, FlushInterval: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Queued() != 2 {
+		t.Fatalf("%d queued, expected 2", c.Queued())
+	}
+	go c.Run()
+	time.Sleep(100 * time.Millisecond)
+	c.Stop()
+
+	if c.Queued() != 0 {
+		t.Errorf("%d queued, expected 0", c.Queued())
+	}
+	expectJL := []proto.JobLog{{RequestId: "req1", JobId: "job1", Try: 1}}
+	if diff := deep.Equal(gotJL, expectJL); diff != nil {
+		t.Error(diff)
+	}
+	expectFR := []proto.FinishRequest{{RequestId: "req1", State: proto.STATE_FAIL, FinishedJobs: 1}}
+	if diff := deep.Equal(gotFR, expectFR); diff != nil {
+		t.Error(diff)
+	}
+	files, _ = filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 0 {
+		t.Errorf("%d spool files, expected 0", len(files))
+	}
+}
+
+func TestFlushBatch(t *testing.T) {
+	// Queued entries are sent in one batch. The RM drops the fenced final state
+	// of req2 and fails (5xx) on req3, so req3 and the entry after it stay queued.
+	var batches [][]proto.Delivery
+	rmc := &mock.RMClient{
+		CreateJLFunc: func(reqId string, jl proto.JobLog) error {
+			return errDown
+		},
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			return errDown
+		},
+		DeliverFunc: func(deliveries []proto.Delivery) ([]proto.DeliveryResult, error) {
+			batches = append(batches, deliveries)
+			return []proto.DeliveryResult{
+				{Delivered: true},
+				{Error: &proto.Error{Message: "request req2 fenced", HTTPStatus: 409}},
+				{Error: &proto.Error{Message: "db error", HTTPStatus: 500}},
+			}, nil
+		},
+	}
+	c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1})
+	c.FinishRequest(proto.FinishRequest{RequestId: "req2", State: proto.STATE_COMPLETE})
+	c.CreateJL("req3", proto.JobLog{RequestId: "req3", JobId: "job1", Try: 1})
+	c.FinishRequest(proto.FinishRequest{RequestId: "req3", State: proto.STATE_COMPLETE})
+	if c.Queued() != 4 {
+		t.Fatalf("%d queued, expected 4", c.Queued())
+	}
+
+	c.Flush()
+	if len(batches) != 1 || len(batches[0]) != 4 {
+		t.Fatalf("got batches %+v, expected 1 batch of 4 deliveries", batches)
+	}
+	if batches[0][1].Finish == nil || batches[0][1].Finish.RequestId != "req2" {
+		t.Errorf("delivery 2 = %+v, expected final state of req2", batches[0][1])
+	}
+	if c.Queued() != 2 {
+		t.Errorf("%d queued, expected 2", c.Queued())
+	}
+}
+
+func TestFlushNoBatch(t *testing.T) {
+	// RM older than POST /api/v1/deliveries (404): entries are sent one at a time
+	delivers := 0
+	got := []string{}
+	rmc := &mock.RMClient{
+		DeliverFunc: func(deliveries []proto.Delivery) ([]proto.DeliveryResult, error) {
+			delivers++
+			return nil, proto.Error{Message: "Not Found"}
+		},
+	}
+	down := true
+	rmc.CreateJLFunc = func(reqId string, jl proto.JobLog) error {
+		if down {
+			return errDown
+		}
+		got = append(got, jl.JobId)
+		return nil
+	}
+	c, err := spool.NewClient(rmc, spool.Config{FlushInterval: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1})
+	c.CreateJL("req1", proto.JobLog{RequestId: "req1", JobId: "job2", Try: 1})
+
+	down = false
+	c.Flush()
+	if c.Queued() != 0 {
+		t.Errorf("%d queued, expected 0", c.Queued())
+	}
+	if delivers != 1 {
+		t.Errorf("Deliver called %d times, expected 1", delivers)
+	}
+	if diff := deep.Equal(got, []string{"job1", "job2"}); diff != nil {
+		t.Error(diff)
+	}
+}
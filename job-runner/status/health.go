@@ -0,0 +1,177 @@
+// Copyright 2020, Square, Inc.
+
+package status
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"runtime"
+	"runtime/pprof"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+// Guardrail metrics are published as expvars (GET /debug/vars on the Job Runner API).
+// They are set by Monitor.Check, so they're only as fresh as the last check.
+var (
+	// Goroutines is the number of goroutines.
+	Goroutines = expvar.NewInt("goroutines")
+
+	// HeapBytes is the heap memory in use.
+	HeapBytes = expvar.NewInt("heap_bytes")
+
+	// Overloaded is 1 while the Job Runner is over a guardrail watermark, else 0.
+	Overloaded = expvar.NewInt("overloaded")
+
+	// ChainsRefused counts new and resumed job chains refused because the Job
+	// Runner was overloaded. It's incremented by the API.
+	ChainsRefused = expvar.NewInt("chains_refused")
+)
+
+// CHAIN_LABEL is the pprof label set on goroutines that run a job chain. Its
+// value is the request ID.
+const CHAIN_LABEL = "request_id"
+
+// Monitor checks goroutines and heap memory against the guardrail watermarks
+// (config.Guardrails). It's checked on an interval in Server.Run(), and the API
+// does not start new or resumed job chains while Overloaded returns true.
+type Monitor struct {
+	maxGoroutines uint
+	maxHeapBytes  uint64
+	overloaded    int32       // atomic: 1 if overloaded at last check
+	mux           *sync.Mutex // guards last
+	last          proto.JobRunnerHealth
+}
+
+// NewMonitor returns a Monitor with the given watermarks. Zero is no maximum.
+func NewMonitor(maxGoroutines, maxHeapMB uint) *Monitor {
+	return &Monitor{
+		maxGoroutines: maxGoroutines,
+		maxHeapBytes:  uint64(maxHeapMB) * 1024 * 1024,
+		mux:           &sync.Mutex{},
+	}
+}
+
+// Check samples goroutines and heap memory, updates the metrics, and returns
+// the health. It logs when the Job Runner becomes overloaded and when it recovers.
+func (m *Monitor) Check() proto.JobRunnerHealth {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	goroutines := uint(runtime.NumGoroutine())
+	heapBytes := mem.HeapAlloc
+
+	h := proto.JobRunnerHealth{
+		Goroutines:    goroutines,
+		HeapBytes:     heapBytes,
+		MaxGoroutines: m.maxGoroutines,
+		MaxHeapBytes:  m.maxHeapBytes,
+		CheckedAt:     time.Now().UTC(),
+	}
+	reasons := []string{}
+	if m.maxGoroutines > 0 && goroutines > m.maxGoroutines {
+		reasons = append(reasons, fmt.Sprintf("%d goroutines > max %d", goroutines, m.maxGoroutines))
+	}
+	if m.maxHeapBytes > 0 && heapBytes > m.maxHeapBytes {
+		reasons = append(reasons, fmt.Sprintf("%d MB heap > max %d MB", heapBytes/1024/1024, m.maxHeapBytes/1024/1024))
+	}
+	h.Overloaded = len(reasons) > 0
+	h.Reason = strings.Join(reasons, ", ")
+
+	Goroutines.Set(int64(goroutines))
+	HeapBytes.Set(int64(heapBytes))
+
+	m.mux.Lock()
+	m.last = h
+	m.mux.Unlock()
+
+	if h.Overloaded {
+		Overloaded.Set(1)
+		if atomic.CompareAndSwapInt32(&m.overloaded, 0, 1) {
+			log.Warnf("Overloaded: %s: not starting new job chains", h.Reason)
+			for reqId, n := range ChainGoroutines() {
+				log.Warnf("Overloaded: request %s: %d goroutines", reqId, n)
+			}
+		}
+	} else {
+		Overloaded.Set(0)
+		if atomic.CompareAndSwapInt32(&m.overloaded, 1, 0) {
+			log.Infof("No longer overloaded: %d goroutines, %d MB heap: starting new job chains",
+				goroutines, heapBytes/1024/1024)
+		}
+	}
+	return h
+}
+
+// Overloaded returns true if the Job Runner was over a watermark at the last check.
+func (m *Monitor) Overloaded() bool {
+	return atomic.LoadInt32(&m.overloaded) == 1
+}
+
+// Health returns the health at the last check. It does not check again, and
+// Chains is not set.
+func (m *Monitor) Health() proto.JobRunnerHealth {
+	m.mux.Lock()
+	defer m.mux.Unlock()
+	return m.last
+}
+
+// --------------------------------------------------------------------------
+
+// RunChain calls run, which should be chain.Traverser.Run, with pprof label
+// CHAIN_LABEL set to the request ID. Goroutines started by run inherit the
+// label, so ChainGoroutines can attribute them to the job chain.
+func RunChain(requestId string, run func()) {
+	pprof.Do(context.Background(), pprof.Labels(CHAIN_LABEL, requestId), func(context.Context) {
+		run()
+	})
+}
+
+// ChainGoroutines returns the number of goroutines per job chain started with
+// RunChain, keyed on request ID. It reads the goroutine profile, which briefly
+// stops the world, so it should not be called often.
+func ChainGoroutines() map[string]uint {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("goroutine").WriteTo(&buf, 1); err != nil {
+		log.Warnf("ChainGoroutines: goroutine profile: %s", err)
+		return map[string]uint{}
+	}
+	return parseChainGoroutines(&buf)
+}
+
+// parseChainGoroutines parses a goroutine profile in debug=1 format: each record
+// is "<count> @ <stack addrs>" followed by "# labels: {...}" if the goroutines
+// have labels.
+func parseChainGoroutines(buf *bytes.Buffer) map[string]uint {
+	chains := map[string]uint{}
+	var count uint64
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if p := strings.SplitN(line, " @ ", 2); len(p) == 2 && !strings.HasPrefix(line, "#") {
+			count, _ = strconv.ParseUint(p[0], 10, 64)
+			continue
+		}
+		if !strings.HasPrefix(line, "# labels: ") {
+			continue
+		}
+		labels := map[string]string{}
+		if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "# labels: ")), &labels); err != nil {
+			continue
+		}
+		if reqId, ok := labels[CHAIN_LABEL]; ok {
+			chains[reqId] += uint(count)
+		}
+	}
+	return chains
+}
@@ -4,13 +4,17 @@
 package status
 
 import (
+	"sort"
+
 	"github.com/orcaman/concurrent-map"
 	log "github.com/sirupsen/logrus"
 
 	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/job-runner/breaker"
 	"github.com/square/spincycle/v2/job-runner/chain"
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/request-manager"
+	v "github.com/square/spincycle/v2/version"
 )
 
 type Manager interface {
@@ -19,11 +23,16 @@ type Manager interface {
 
 type manager struct {
 	traverserRepo cmap.ConcurrentMap
+	maxStatus     uint
 }
 
-func NewManager(traverserRepo cmap.ConcurrentMap) *manager {
+// NewManager returns a Manager that reports jobs running in the traversers.
+// Job status longer than maxStatus bytes is truncated (see proto.Truncate).
+// If maxStatus is zero, there is no maximum.
+func NewManager(traverserRepo cmap.ConcurrentMap, maxStatus uint) *manager {
 	m := &manager{
 		traverserRepo: traverserRepo,
+		maxStatus:     maxStatus,
 	}
 	return m
 }
@@ -50,6 +59,9 @@ func (m *manager) Running(f proto.StatusFilter) ([]proto.JobStatus, error) {
 	running := []proto.JobStatus{}
 	for _, tr := range traversers {
 		status := tr.Running()
+		for i := range status {
+			status[i].Status = proto.Truncate(status[i].Status, m.maxStatus)
+		}
 		running = append(running, status...)
 	}
 
@@ -83,3 +95,107 @@ func (f FinishedJobs) Update() {
 		}
 	}
 }
+
+// --------------------------------------------------------------------------
+
+// Pusher pushes the running status of this Job Runner to the Request Manager.
+// This is a singleton service that's ran in Server.Run() if config.StatusPush.Interval
+// is set. Pushes are best-effort: if they stop, the Request Manager polls the
+// Job Runner instead. If the circuit breaker is enabled, the Pusher pushes its
+// job type tries and sets the tries of all Job Runners in it, so failure rates
+// are fleet-wide.
+//
+// If Deltas is true, the Pusher pushes only the jobs that changed or finished
+// since its last push, except every FullEvery pushes and after a failed push,
+// when it pushes all running jobs. Push is not safe to call concurrently.
+type Pusher struct {
+	Status    Manager
+	RMC       rm.Client
+	BaseURL   string            // of this JR, same as the RM saves in requests.jr_url
+	Monitor   *Monitor          // optional, to push health
+	Labels    map[string]string // optional, config.StatusPush.Labels
+	Breaker   *breaker.Breaker  // optional, config.CircuitBreaker
+	Deltas    bool              // optional, config.StatusPush.Deltas
+	FullEvery uint              // config.StatusPush.FullEvery if Deltas, 0 = only after a failed push
+
+	seq  uint64                     // sequence number of the last push
+	last map[jobKey]proto.JobStatus // jobs in the last push if Deltas and it succeeded
+}
+
+type jobKey struct {
+	requestId string
+	jobId     string
+}
+
+func (p *Pusher) Push() {
+	running, err := p.Status.Running(proto.StatusFilter{})
+	if err != nil {
+		log.Warnf("Pusher.Push: Running: %s", err)
+		return
+	}
+	p.seq++
+	jrs := proto.JobRunnerStatus{
+		JobRunnerURL: p.BaseURL,
+		Jobs:         running,
+		Seq:          p.seq,
+		Labels:       p.Labels,
+		Version:      v.Version(),
+	}
+	var pushed map[jobKey]proto.JobStatus
+	if p.Deltas {
+		pushed = make(map[jobKey]proto.JobStatus, len(running))
+		for _, j := range running {
+			pushed[jobKey{j.RequestId, j.JobId}] = j
+		}
+		if p.last != nil && (p.FullEvery == 0 || p.seq%uint64(p.FullEvery) != 0) {
+			jrs.Delta = true
+			jrs.Jobs, jrs.Removed = delta(p.last, pushed, running)
+		}
+	}
+	if p.Monitor != nil {
+		h := p.Monitor.Health()
+		jrs.Health = &h
+	}
+	if p.Breaker != nil {
+		jrs.JobTypes = p.Breaker.Counts()
+	}
+	if err := p.RMC.PushStatus(jrs); err != nil {
+		log.Warnf("Pusher.Push: PushStatus: %s", err)
+		p.last = nil // next push is full
+		return
+	}
+	p.last = pushed
+	if p.Breaker != nil {
+		fleet, err := p.RMC.JobTypeTries()
+		if err != nil {
+			log.Warnf("Pusher.Push: JobTypeTries: %s", err)
+			return
+		}
+		p.Breaker.SetFleet(fleet)
+	}
+}
+
+// delta returns the running jobs that are new or changed since the last push,
+// in running order, and the jobs in the last push that are no longer running,
+// with only RequestId and JobId set, in order by RequestId and JobId, or nil.
+func delta(last, now map[jobKey]proto.JobStatus, running []proto.JobStatus) ([]proto.JobStatus, []proto.JobStatus) {
+	changed := []proto.JobStatus{}
+	for _, j := range running {
+		if l, ok := last[jobKey{j.RequestId, j.JobId}]; !ok || l != j {
+			changed = append(changed, j)
+		}
+	}
+	var removed []proto.JobStatus
+	for k := range last {
+		if _, ok := now[k]; !ok {
+			removed = append(removed, proto.JobStatus{RequestId: k.requestId, JobId: k.jobId})
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool {
+		if removed[i].RequestId != removed[j].RequestId {
+			return removed[i].RequestId < removed[j].RequestId
+		}
+		return removed[i].JobId < removed[j].JobId
+	})
+	return changed, removed
+}
@@ -10,10 +10,12 @@ import (
 	"github.com/orcaman/concurrent-map"
 
 	"github.com/go-test/deep"
+	"github.com/square/spincycle/v2/job-runner/breaker"
 	"github.com/square/spincycle/v2/job-runner/status"
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/test"
 	"github.com/square/spincycle/v2/test/mock"
+	v "github.com/square/spincycle/v2/version"
 )
 
 func TestRunning(t *testing.T) {
@@ -57,7 +59,7 @@ func TestRunning(t *testing.T) {
 	}
 	trRepo.Set("req2", tr2)
 
-	m := status.NewManager(trRepo)
+	m := status.NewManager(trRepo, 0)
 
 	got, err := m.Running(proto.StatusFilter{})
 	if err != nil {
@@ -119,3 +121,250 @@ func TestRunning(t *testing.T) {
 		t.Error(diff)
 	}
 }
+
+func TestRunningTruncateStatus(t *testing.T) {
+	trRepo := cmap.New()
+	trRepo.Set("req1", &mock.Traverser{
+		JobStatus: []proto.JobStatus{
+			{
+				RequestId: "req1",
+				JobId:     "job1",
+				State:     proto.STATE_RUNNING,
+				Status:    "0123456789abcdefghijklmnopqrstuvwxyz",
+			},
+		},
+	})
+
+	m := status.NewManager(trRepo, 20)
+	got, err := m.Running(proto.StatusFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d proto.JobStatus, expected 1", len(got))
+	}
+	expect := "012345" + proto.TRUNCATED_MARKER
+	if got[0].Status != expect {
+		t.Errorf("got status '%s', expected '%s'", got[0].Status, expect)
+	}
+}
+
+func TestPusher(t *testing.T) {
+	trRepo := cmap.New()
+	tr1 := &mock.Traverser{
+		JobStatus: []proto.JobStatus{
+			{
+				RequestId: "req1",
+				JobId:     "job1",
+				State:     proto.STATE_RUNNING,
+				Try:       1,
+			},
+		},
+	}
+	trRepo.Set("req1", tr1)
+
+	var got proto.JobRunnerStatus
+	rmc := &mock.RMClient{
+		PushStatusFunc: func(jrs proto.JobRunnerStatus) error {
+			got = jrs
+			return nil
+		},
+	}
+	p := status.Pusher{
+		Status:  status.NewManager(trRepo, 0),
+		RMC:     rmc,
+		BaseURL: "https://jr1.local:32307",
+		Labels:  map[string]string{"zone": "east"},
+	}
+	p.Push()
+
+	expect := proto.JobRunnerStatus{
+		JobRunnerURL: "https://jr1.local:32307",
+		Jobs:         tr1.JobStatus,
+		Seq:          1,
+		Labels:       map[string]string{"zone": "east"},
+		Version:      v.Version(),
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		test.Dump(got)
+		t.Error(diff)
+	}
+}
+
+func TestPusherDeltas(t *testing.T) {
+	trRepo := cmap.New()
+	tr1 := &mock.Traverser{
+		JobStatus: []proto.JobStatus{
+			{RequestId: "req1", JobId: "job1", State: proto.STATE_RUNNING, Try: 1},
+			{RequestId: "req1", JobId: "job2", State: proto.STATE_RUNNING, Try: 1},
+		},
+	}
+	trRepo.Set("req1", tr1)
+
+	var got proto.JobRunnerStatus
+	var pushErr error
+	rmc := &mock.RMClient{
+		PushStatusFunc: func(jrs proto.JobRunnerStatus) error {
+			got = jrs
+			return pushErr
+		},
+	}
+	p := status.Pusher{
+		Status:    status.NewManager(trRepo, 0),
+		RMC:       rmc,
+		BaseURL:   "https://jr1.local:32307",
+		Deltas:    true,
+		FullEvery: 4,
+	}
+	push := func(expectSeq uint64, expectDelta bool, expectJobs, expectRemoved []proto.JobStatus) {
+		t.Helper()
+		p.Push()
+		if got.Seq != expectSeq {
+			t.Errorf("seq %d, expected %d", got.Seq, expectSeq)
+		}
+		if got.Delta != expectDelta {
+			t.Errorf("seq %d: delta %t, expected %t", got.Seq, got.Delta, expectDelta)
+		}
+		if diff := deep.Equal(got.Jobs, expectJobs); diff != nil {
+			t.Errorf("seq %d jobs: %v", got.Seq, diff)
+		}
+		if diff := deep.Equal(got.Removed, expectRemoved); diff != nil {
+			t.Errorf("seq %d removed: %v", got.Seq, diff)
+		}
+	}
+
+	// First push is full, then only changes: job1 try 2, job2 finished, job3 new
+	push(1, false, tr1.JobStatus, nil)
+	push(2, true, []proto.JobStatus{}, nil)
+	tr1.JobStatus = []proto.JobStatus{
+		{RequestId: "req1", JobId: "job1", State: proto.STATE_RUNNING, Try: 2},
+		{RequestId: "req1", JobId: "job3", State: proto.STATE_RUNNING, Try: 1},
+	}
+	push(3, true, tr1.JobStatus, []proto.JobStatus{{RequestId: "req1", JobId: "job2"}})
+
+	// Every FullEvery pushes is full
+	push(4, false, tr1.JobStatus, nil)
+
+	// After a failed push, the next push is full because the RM might not have
+	// received the failed push
+	pushErr = mock.ErrRMClient
+	push(5, true, []proto.JobStatus{}, nil)
+	pushErr = nil
+	push(6, false, tr1.JobStatus, nil)
+	push(7, true, []proto.JobStatus{}, nil)
+}
+
+func TestPusherCircuitBreaker(t *testing.T) {
+	// Pusher sends the tries of each job type on this JR and sets the tries of
+	// all JRs returned by the RM, which opens the breaker of job type a
+	cb := breaker.New(breaker.Config{
+		FailureRate: 0.5,
+		MinTries:    10,
+		Window:      time.Minute,
+		Cooldown:    time.Minute,
+		Action:      breaker.ACTION_FAIL,
+	})
+	cb.Record("a", true)
+	cb.Record("b", false)
+
+	var got proto.JobRunnerStatus
+	rmc := &mock.RMClient{
+		PushStatusFunc: func(jrs proto.JobRunnerStatus) error {
+			got = jrs
+			return nil
+		},
+		JobTypeTriesFunc: func() (map[string]proto.JobTypeTries, error) {
+			return map[string]proto.JobTypeTries{"a": {Tries: 20, Failed: 15}, "b": {Tries: 20}}, nil
+		},
+	}
+	p := status.Pusher{
+		Status:  status.NewManager(cmap.New(), 0),
+		RMC:     rmc,
+		BaseURL: "https://jr1.local:32307",
+		Breaker: cb,
+	}
+	p.Push()
+
+	expect := map[string]proto.JobTypeTries{"a": {Tries: 1, Failed: 1}, "b": {Tries: 1}}
+	if diff := deep.Equal(got.JobTypes, expect); diff != nil {
+		t.Error(diff)
+	}
+	if _, open := cb.Check("a"); !open {
+		t.Error("job type a closed, expected open on fleet tries")
+	}
+	if _, open := cb.Check("b"); open {
+		t.Error("job type b open, expected closed")
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	// No watermarks: never overloaded, but usage is reported
+	m := status.NewMonitor(0, 0)
+	h := m.Check()
+	if h.Overloaded || m.Overloaded() {
+		t.Errorf("overloaded without watermarks: %+v", h)
+	}
+	if h.Goroutines == 0 || h.HeapBytes == 0 {
+		t.Errorf("usage not reported: %+v", h)
+	}
+	if status.Overloaded.Value() != 0 {
+		t.Errorf("overloaded metric = %d, expected 0", status.Overloaded.Value())
+	}
+
+	// Tests run more than 1 goroutine, so this is always overloaded
+	m = status.NewMonitor(1, 0)
+	h = m.Check()
+	if !h.Overloaded || !m.Overloaded() {
+		t.Errorf("not overloaded: %+v", h)
+	}
+	if h.Reason == "" {
+		t.Errorf("no reason")
+	}
+	if status.Overloaded.Value() != 1 {
+		t.Errorf("overloaded metric = %d, expected 1", status.Overloaded.Value())
+	}
+	if diff := deep.Equal(m.Health(), h); diff != nil {
+		t.Error(diff)
+	}
+
+	// Pusher pushes the health at the last check
+	var got proto.JobRunnerStatus
+	rmc := &mock.RMClient{
+		PushStatusFunc: func(jrs proto.JobRunnerStatus) error {
+			got = jrs
+			return nil
+		},
+	}
+	p := status.Pusher{
+		Status:  status.NewManager(cmap.New(), 0),
+		RMC:     rmc,
+		BaseURL: "https://jr1.local:32307",
+		Monitor: m,
+	}
+	p.Push()
+	if got.Health == nil {
+		t.Fatal("health not pushed")
+	}
+	if diff := deep.Equal(*got.Health, h); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestChainGoroutines(t *testing.T) {
+	// The chain goroutine starts a second goroutine, which inherits the label
+	stopChan := make(chan struct{})
+	running := make(chan struct{})
+	go status.RunChain("req1", func() {
+		go func() { <-stopChan }()
+		close(running)
+		<-stopChan
+	})
+	defer close(stopChan)
+	<-running
+
+	got := status.ChainGoroutines()
+	expect := map[string]uint{"req1": 2}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
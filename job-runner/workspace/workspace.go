@@ -0,0 +1,110 @@
+// Copyright 2020, Square, Inc.
+
+// Package workspace manages request workspaces: per-request scratch directories
+// that jobs write files to instead of /tmp.
+package workspace
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/square/spincycle/v2/job"
+)
+
+// ERROR_CODE_QUOTA is the job.Error code of a job try that failed because the
+// workspace was larger than its maximum size.
+const ERROR_CODE_QUOTA = "workspace-quota"
+
+// Manager creates request workspaces in one directory. A nil Manager is valid:
+// workspaces are disabled and Create returns nil.
+type Manager struct {
+	dir      string
+	maxBytes int64
+}
+
+// NewManager makes a Manager that creates request workspaces in dir, which is
+// created if it does not exist. If maxBytes is greater than zero, it's the
+// maximum size of each workspace.
+func NewManager(dir string, maxBytes int64) (*Manager, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Manager{
+		dir:      dir,
+		maxBytes: maxBytes,
+	}, nil
+}
+
+// Create creates the workspace of a request. If it already exists, like when a
+// job chain is resumed on the same Job Runner, it's reused as is.
+func (m *Manager) Create(requestId string) (*Workspace, error) {
+	if m == nil {
+		return nil, nil
+	}
+	if requestId == "" || requestId == "." || requestId == ".." || requestId != filepath.Base(requestId) {
+		return nil, fmt.Errorf("invalid request ID for workspace: %q", requestId)
+	}
+	dir := filepath.Join(m.dir, requestId)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &Workspace{
+		Dir:      dir,
+		MaxBytes: m.maxBytes,
+	}, nil
+}
+
+// Workspace is the scratch directory of one request.
+type Workspace struct {
+	Dir      string // <Manager dir>/<request ID>
+	MaxBytes int64  // 0 = no max
+}
+
+// Size returns the total size, in bytes, of all files in the workspace.
+func (w *Workspace) Size() (int64, error) {
+	var size int64
+	err := filepath.Walk(w.Dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil // removed by a job while walking
+			}
+			return err
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
+}
+
+// Check returns a job.Error if the workspace is larger than its maximum size.
+// The error is not retryable because the files are still there on retry.
+func (w *Workspace) Check() error {
+	if w.MaxBytes <= 0 {
+		return nil
+	}
+	size, err := w.Size()
+	if err != nil {
+		return fmt.Errorf("error checking workspace size: %s", err)
+	}
+	if size <= w.MaxBytes {
+		return nil
+	}
+	return job.Error{
+		Category:  job.ERROR_CATEGORY_USER,
+		Code:      ERROR_CODE_QUOTA,
+		Permanent: true,
+		Err:       fmt.Errorf("workspace %s is %d bytes, max is %d bytes", w.Dir, size, w.MaxBytes),
+	}
+}
+
+// Remove removes the workspace and all files in it.
+func (w *Workspace) Remove() error {
+	return os.RemoveAll(w.Dir)
+}
@@ -0,0 +1,106 @@
+// Copyright 2020, Square, Inc.
+
+package workspace_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/workspace"
+)
+
+func TestWorkspace(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "spincycle-workspace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	// Base dir is created
+	m, err := workspace.NewManager(filepath.Join(tmpdir, "ws"), 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ws, err := m.Create("req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ws.Dir != filepath.Join(tmpdir, "ws", "req1") {
+		t.Errorf("dir = %s, expected %s", ws.Dir, filepath.Join(tmpdir, "ws", "req1"))
+	}
+	if _, err := os.Stat(ws.Dir); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files in subdirs count toward the max size
+	if err := os.Mkdir(filepath.Join(ws.Dir, "sub"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(ws.Dir, "sub", "f1"), make([]byte, 60), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.Check(); err != nil {
+		t.Errorf("error %s for 60 bytes, expected nil", err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(ws.Dir, "f2"), make([]byte, 60), 0600); err != nil {
+		t.Fatal(err)
+	}
+	size, err := ws.Size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != 120 {
+		t.Errorf("size = %d, expected 120", size)
+	}
+	err = ws.Check()
+	jobErr, ok := job.AsError(err)
+	if !ok {
+		t.Fatalf("got error %v for 120 bytes, expected a job.Error", err)
+	}
+	if jobErr.Code != workspace.ERROR_CODE_QUOTA || !jobErr.Permanent {
+		t.Errorf("error code = %s, permanent = %t, expected %s, true", jobErr.Code, jobErr.Permanent, workspace.ERROR_CODE_QUOTA)
+	}
+
+	// Create reuses an existing workspace
+	ws2, err := m.Create("req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size, _ := ws2.Size(); size != 120 {
+		t.Errorf("size = %d after Create again, expected 120", size)
+	}
+
+	if err := ws.Remove(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(ws.Dir); !os.IsNotExist(err) {
+		t.Errorf("workspace not removed (stat error: %v)", err)
+	}
+}
+
+func TestCreateInvalid(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "spincycle-workspace-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+	m, err := workspace.NewManager(tmpdir, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, reqId := range []string{"", "..", "../req1", "a/b"} {
+		if _, err := m.Create(reqId); err == nil {
+			t.Errorf("no error for request ID %q, expected an error", reqId)
+		}
+	}
+
+	// Nil manager: workspaces disabled
+	var nilManager *workspace.Manager
+	ws, err := nilManager.Create("req1")
+	if ws != nil || err != nil {
+		t.Errorf("got %v, %v from nil manager, expected nil, nil", ws, err)
+	}
+}
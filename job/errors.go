@@ -107,3 +107,64 @@ func NewErrWrongArgType(key string, got, expect interface{}) ErrWrongArgType {
 func (e ErrWrongArgType) Error() string {
 	return fmt.Sprintf("%s in job args is type %s, expected type %s", e.Key, e.GotType, e.ExpectType)
 }
+
+// --------------------------------------------------------------------------
+
+// Job error categories. Categories are user-defined, but these are common.
+const (
+	ERROR_CATEGORY_USER    = "user"    // caller error, e.g. invalid args
+	ERROR_CATEGORY_INFRA   = "infra"   // infrastructure error, e.g. host down
+	ERROR_CATEGORY_TIMEOUT = "timeout" // job timed out
+)
+
+// Error is a structured job error: a category, like ERROR_CATEGORY_INFRA, a
+// machine-readable code, like "ECONNREFUSED", and whether or not the error is
+// permanent: retrying the job won't succeed. To set these in the job log, a
+// job returns an Error (or an error that wraps an Error) as Return.Error. For
+// example:
+//
+//   if err := db.Ping(); err != nil {
+//     ret.Error = job.Error{
+//       Category: job.ERROR_CATEGORY_INFRA,
+//       Code:     "db-ping",
+//       Err:      err,
+//     }
+//   }
+//
+// An Error is retryable by default, like any other error. If Permanent is true,
+// the job is not retried even if it has tries left (node spec retry). Request
+// specs can auto-retry a request that failed only because of job errors in
+// certain categories (see the autoRetry field of request specs).
+type Error struct {
+	Category  string // user-defined or ERROR_CATEGORY_* const
+	Code      string // user-defined, machine-readable error code
+	Permanent bool   // job won't succeed if retried
+	Err       error  // underlying error
+}
+
+func (e Error) Error() string {
+	if e.Err == nil {
+		return e.Category + " error"
+	}
+	return e.Err.Error()
+}
+
+func (e Error) Unwrap() error {
+	return e.Err
+}
+
+// AsError returns the Error if err is or wraps an Error.
+func AsError(err error) (Error, bool) {
+	var jobErr Error
+	if errors.As(err, &jobErr) {
+		return jobErr, true
+	}
+	return jobErr, false
+}
+
+// ErrorCategory returns the category of err if it is or wraps an Error. Else, it
+// returns an empty string.
+func ErrorCategory(err error) string {
+	jobErr, _ := AsError(err)
+	return jobErr.Category
+}
@@ -5,6 +5,10 @@
 // because everything else depends on it.
 package job
 
+import (
+	"context"
+)
+
 // A Job is the smallest, reusable building block in Spin Cycle that has meaning
 // by itself. A job should do one thing and be reusable. For example, job type
 // "net/down-ip" removes an IP address from a network interface. This job is
@@ -72,6 +76,95 @@ type Job interface {
 	Id() Id
 }
 
+// A ContextJob is a Job that runs with a context. If a job implements this
+// interface, the Job Runner calls RunContext instead of Run. The context is
+// canceled when the job is stopped, and it has the request deadline, if the
+// request has one (proto.CreateRequest.Deadline), so the job can return early
+// instead of running past the deadline. The job must still implement Run, and
+// it must still respond to Stop.
+type ContextJob interface {
+	Job
+	RunContext(ctx context.Context, jobData map[string]interface{}) (Return, error)
+}
+
+type debugKey struct{}
+
+// WithDebug returns a copy of ctx in which debug reports whether debug logging
+// is enabled for the request. The Job Runner sets it for every ContextJob.
+func WithDebug(ctx context.Context, debug func() bool) context.Context {
+	return context.WithValue(ctx, debugKey{}, debug)
+}
+
+// Debug returns true if debug logging is enabled for the request that the
+// ContextJob is running in, which is true while an operator has elevated the
+// request log level to debug (proto.RequestLogLevel). Jobs can check it to log
+// more only for that request. It returns false if ctx is not from the Job Runner.
+func Debug(ctx context.Context) bool {
+	debug, ok := ctx.Value(debugKey{}).(func() bool)
+	return ok && debug()
+}
+
+type workspaceKey struct{}
+
+// WithWorkspace returns a copy of ctx with the request workspace directory.
+// The Job Runner sets it for every ContextJob if workspaces are enabled.
+func WithWorkspace(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, workspaceKey{}, dir)
+}
+
+// Workspace returns the scratch directory of the request that the ContextJob is
+// running in, or an empty string if the Job Runner does not have workspaces
+// enabled or ctx is not from the Job Runner. All jobs in the request share the
+// directory. It exists while the job chain runs on the Job Runner: it's removed
+// when the chain is done or suspended, so files in it do not survive suspend
+// and resume. It can have a maximum size; if it's larger after a job try, the
+// try fails. Jobs should write temporary files here instead of /tmp.
+func Workspace(ctx context.Context) string {
+	dir, _ := ctx.Value(workspaceKey{}).(string)
+	return dir
+}
+
+// A Scratch is a key/value store shared by all jobs in a job chain. Unlike
+// jobData, which is threaded from upstream to downstream jobs, the scratch
+// store is one store for the whole chain: any job can read or write any key
+// at any time, including jobs running in parallel. It's saved with the suspended
+// job chain, so it survives suspend and resume, but it's not saved when the
+// chain is done. Values are copied in and out, so a job can modify a value
+// after Set or Get without changing the store.
+type Scratch interface {
+	// Get returns the value of key and true, or nil and false if key is not set.
+	Get(key string) ([]byte, bool)
+
+	// Set sets key to value, replacing the previous value, if any.
+	Set(key string, value []byte)
+
+	// Delete removes key. It's not an error if key is not set.
+	Delete(key string)
+
+	// Keys returns all keys, sorted.
+	Keys() []string
+}
+
+// A ScratchJob is a Job that uses the job chain scratch store. If a job implements
+// this interface, the Job Runner calls SetScratch once after Deserialize and before
+// Run (or RunContext). Jobs should use the scratch store for large or evolving
+// state that doesn't fit in jobData.
+type ScratchJob interface {
+	Job
+	SetScratch(Scratch)
+}
+
+// A SensitiveJob is a Job that uses sensitive request args (spec arg sensitive:
+// true) when arg encryption is enabled. The Request Manager encrypts their values,
+// so Create receives opaque encrypted strings, not the values. If a job implements
+// this interface, the Job Runner decrypts its encrypted job args and calls
+// SetSensitiveArgs with their values, keyed on job arg name, once after Deserialize
+// and before Run (or RunContext). Jobs should not serialize or return the values.
+type SensitiveJob interface {
+	Job
+	SetSensitiveArgs(args map[string]interface{}) error
+}
+
 // Id represents how jobs are uniquely identified per request. Type and Name are
 // user-defined in the external job factory (EJF) and request spec, respectively.
 // Id is defined per request by Spin Cycle. An example for each value:
@@ -152,10 +245,18 @@ type Factory interface {
 // successful because it handled being re-ran. For example, a job could delete
 // a record, but when re-ran the record has already been deleted, so the job
 // is successful but reports Error = ErrRecordNotFound for logging.
+//
+// Stdout and Stderr are saved separately in the job log. Use an Output for each
+// to capture them with a size limit and, optionally, line timestamps. The Job
+// Runner sends at most the last 1 MiB of each.
+//
+// Usage is optional: a job that runs a process should set it from ProcessUsage
+// so the job log has the CPU time and peak memory of the process.
 type Return struct {
 	State  byte   // proto/STATE_ const
 	Exit   int64  // Unix exit code
 	Error  error  // Go error
 	Stdout string // stdout output
 	Stderr string // stderr output
+	Usage  Usage  // resource usage of processes the job ran (optional)
 }
@@ -0,0 +1,99 @@
+// Copyright 2020, Square, Inc.
+
+package job
+
+import (
+	"bytes"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Output captures output (stdout or stderr) from a job. It implements io.Writer
+// so jobs can use it directly, for example as exec.Cmd.Stdout and exec.Cmd.Stderr.
+// Use one Output for stdout and another for stderr to keep them separate, then
+// set Return.Stdout and Return.Stderr from Output.String.
+//
+// Output keeps at most MaxBytes of output; additional output is discarded and
+// counted. If Timestamps is true, every line is prefixed with the time (UTC,
+// RFC3339 with microseconds) it was written. Output is safe for concurrent use.
+// Create an Output with NewOutput.
+type Output struct {
+	MaxBytes   int  // max bytes to keep, including timestamps; 0 = no limit
+	Timestamps bool // prefix each line with the time it was written
+
+	buf       bytes.Buffer
+	dropped   int  // bytes discarded because of MaxBytes
+	lineStart bool // next write begins a new line (for timestamps)
+	*sync.Mutex
+}
+
+// NewOutput returns an Output that keeps at most maxBytes of output. If timestamps
+// is true, every line is prefixed with the time it was written.
+func NewOutput(maxBytes int, timestamps bool) *Output {
+	return &Output{
+		MaxBytes:   maxBytes,
+		Timestamps: timestamps,
+		lineStart:  true,
+		Mutex:      &sync.Mutex{},
+	}
+}
+
+// Write writes p to the output. It never returns an error, and it always returns
+// len(p) even if some or all of p is discarded because of MaxBytes, so callers
+// like exec.Cmd don't fail when the limit is reached.
+func (o *Output) Write(p []byte) (int, error) {
+	o.Lock()
+	defer o.Unlock()
+
+	n := len(p)
+	now := time.Now().UTC().Format("2006-01-02T15:04:05.000000Z07:00 ")
+	for len(p) > 0 {
+		if o.Timestamps && o.lineStart {
+			o.write([]byte(now))
+		}
+		i := bytes.IndexByte(p, '\n')
+		if i < 0 {
+			o.write(p)
+			o.lineStart = false
+			break
+		}
+		o.write(p[:i+1])
+		o.lineStart = true
+		p = p[i+1:]
+	}
+	return n, nil
+}
+
+// write writes p to the buffer, discarding what doesn't fit. Caller must lock.
+func (o *Output) write(p []byte) {
+	if o.MaxBytes > 0 {
+		free := o.MaxBytes - o.buf.Len()
+		if free < 0 {
+			free = 0
+		}
+		if len(p) > free {
+			o.dropped += len(p) - free
+			p = p[:free]
+		}
+	}
+	o.buf.Write(p)
+}
+
+// String returns the output. If output was discarded because of MaxBytes, a
+// final line notes how many bytes were discarded.
+func (o *Output) String() string {
+	o.Lock()
+	defer o.Unlock()
+	if o.dropped == 0 {
+		return o.buf.String()
+	}
+	return o.buf.String() + fmt.Sprintf("\n[output truncated: %d bytes discarded]\n", o.dropped)
+}
+
+// Truncated returns true if output was discarded because of MaxBytes.
+func (o *Output) Truncated() bool {
+	o.Lock()
+	defer o.Unlock()
+	return o.dropped > 0
+}
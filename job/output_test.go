@@ -0,0 +1,44 @@
+// Copyright 2020, Square, Inc.
+
+package job_test
+
+import (
+	"fmt"
+	"regexp"
+	"testing"
+
+	"github.com/square/spincycle/v2/job"
+)
+
+func TestOutputMaxBytes(t *testing.T) {
+	out := job.NewOutput(10, false)
+	fmt.Fprint(out, "hello ")
+	n, err := fmt.Fprint(out, "world!")
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 6 {
+		t.Errorf("wrote %d bytes, expected 6 even though output was discarded", n)
+	}
+	if !out.Truncated() {
+		t.Errorf("Truncated is false, expected true")
+	}
+	expect := "hello worl\n[output truncated: 2 bytes discarded]\n"
+	if out.String() != expect {
+		t.Errorf("got %q, expected %q", out.String(), expect)
+	}
+}
+
+func TestOutputTimestamps(t *testing.T) {
+	out := job.NewOutput(0, true)
+	fmt.Fprint(out, "line 1\nline")
+	fmt.Fprint(out, " 2\n")
+	ts := `\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}Z `
+	re := regexp.MustCompile("^" + ts + "line 1\n" + ts + "line 2\n$")
+	if !re.MatchString(out.String()) {
+		t.Errorf("got %q, expected each line prefixed with a timestamp", out.String())
+	}
+	if out.Truncated() {
+		t.Errorf("Truncated is true, expected false")
+	}
+}
@@ -0,0 +1,501 @@
+// Copyright 2020, Square, Inc.
+
+// Package poll implements a built-in job that polls an HTTP URL or TCP address
+// until it's ready or a timeout elapses. It's used as a readiness gate between
+// steps, like waiting for an app to pass its health check after a deploy, without
+// writing a custom job. The job type is "spincycle/poll" (JOB_TYPE); the Request
+// Manager and Job Runner make it, not the user-provided job factory.
+//
+// The job is configured by job args, so every arg must be listed under args: in
+// the node spec:
+//
+//   url            HTTP(S) URL to GET, or
+//   addr           TCP address (host:port) to connect to
+//   status         HTTP status code that's ready (default: any 2xx)
+//   contains       string the HTTP response body must contain (default: any body)
+//   timeout        how long to poll before the job fails (default: 5m)
+//   interval       wait between the first and second attempt (default: 5s)
+//   maxInterval    max wait between attempts (default: 1m)
+//   backoff        multiplier of the wait after each attempt (default: 2)
+//   attemptTimeout timeout of each attempt (default: 10s)
+//
+// Exactly one of url or addr is required. Durations are Go duration strings,
+// like "30s". The job completes on the first ready attempt, fails when the timeout
+// elapses, and responds to Stop. Its deadline is saved in the job chain scratch
+// store, so a suspended and resumed job polls only for the remaining time. A retry
+// (or the job failing) starts a new timeout.
+package poll
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// JOB_TYPE is the job type (job.Id.Type and proto.Job.Type) of poll jobs.
+const JOB_TYPE = "spincycle/poll"
+
+// SCRATCH_KEY_PREFIX is the prefix of the job chain scratch store key where a
+// poll job saves its deadline. The full key is the prefix plus the job ID.
+const SCRATCH_KEY_PREFIX = "spincycle/poll/"
+
+// Defaults for job args that are not set.
+const (
+	DEFAULT_TIMEOUT         = 5 * time.Minute
+	DEFAULT_INTERVAL        = 5 * time.Second
+	DEFAULT_MAX_INTERVAL    = 1 * time.Minute
+	DEFAULT_BACKOFF         = 2.0
+	DEFAULT_ATTEMPT_TIMEOUT = 10 * time.Second
+)
+
+// MAX_BODY_SIZE is how much of the HTTP response body is read to check contains.
+const MAX_BODY_SIZE = 1 << 20 // 1 MiB
+
+// Job is a job.Job and job.ScratchJob that polls until ready.
+type Job struct {
+	// Internal data (serialized)
+	URL            string        `json:"url,omitempty"`
+	Addr           string        `json:"addr,omitempty"`
+	ExpectStatus   int           `json:"status,omitempty"`
+	Contains       string        `json:"contains,omitempty"`
+	Timeout        time.Duration `json:"timeout"`
+	Interval       time.Duration `json:"interval"`
+	MaxInterval    time.Duration `json:"maxInterval"`
+	Backoff        float64       `json:"backoff"`
+	AttemptTimeout time.Duration `json:"attemptTimeout"`
+
+	// While running
+	scratch  job.Scratch
+	attempts int
+	lastErr  error
+	next     time.Time // next attempt
+	deadline time.Time
+	cancel   context.CancelFunc
+	stopChan chan struct{}
+	stopped  bool
+	*sync.Mutex
+
+	// Meta
+	id job.Id
+}
+
+// New returns a poll job. It's called by the factory returned by NewFactory.
+func New(jid job.Id) *Job {
+	return &Job{
+		id:       jid,
+		Mutex:    &sync.Mutex{},
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Create is a job.Job interface method. It returns an error if the job args
+// are not set or invalid, so a bad poll node fails when the request is created,
+// not when the job runs.
+func (j *Job) Create(jobArgs map[string]interface{}) error {
+	var err error
+	if j.URL, err = stringArg(jobArgs, "url"); err != nil {
+		return err
+	}
+	if j.Addr, err = stringArg(jobArgs, "addr"); err != nil {
+		return err
+	}
+	switch {
+	case j.URL == "" && j.Addr == "":
+		return job.ErrArgNotSet{Arg: "url"}
+	case j.URL != "" && j.Addr != "":
+		return fmt.Errorf("job args url and addr are both set, expected only one")
+	case j.URL != "":
+		u, err := url.Parse(j.URL)
+		if err != nil {
+			return fmt.Errorf("job arg url: invalid URL %q: %s", j.URL, err)
+		}
+		if u.Scheme != "http" && u.Scheme != "https" {
+			return fmt.Errorf("job arg url: invalid URL %q: scheme must be http or https", j.URL)
+		}
+	default:
+		if _, _, err := net.SplitHostPort(j.Addr); err != nil {
+			return fmt.Errorf("job arg addr: invalid address %q: %s (expected host:port)", j.Addr, err)
+		}
+	}
+
+	if j.ExpectStatus, err = intArg(jobArgs, "status", 0); err != nil {
+		return err
+	}
+	if j.Contains, err = stringArg(jobArgs, "contains"); err != nil {
+		return err
+	}
+	if j.Addr != "" && (j.ExpectStatus != 0 || j.Contains != "") {
+		return fmt.Errorf("job args status and contains are only valid with url, not addr")
+	}
+
+	if j.Timeout, err = durationArg(jobArgs, "timeout", DEFAULT_TIMEOUT); err != nil {
+		return err
+	}
+	if j.Interval, err = durationArg(jobArgs, "interval", DEFAULT_INTERVAL); err != nil {
+		return err
+	}
+	if j.MaxInterval, err = durationArg(jobArgs, "maxInterval", DEFAULT_MAX_INTERVAL); err != nil {
+		return err
+	}
+	if j.AttemptTimeout, err = durationArg(jobArgs, "attemptTimeout", DEFAULT_ATTEMPT_TIMEOUT); err != nil {
+		return err
+	}
+	if j.Backoff, err = floatArg(jobArgs, "backoff", DEFAULT_BACKOFF); err != nil {
+		return err
+	}
+	if j.Backoff < 1 {
+		return fmt.Errorf("job arg backoff: %g is less than 1", j.Backoff)
+	}
+	if j.MaxInterval < j.Interval {
+		return fmt.Errorf("job arg maxInterval: %s is less than interval %s", j.MaxInterval, j.Interval)
+	}
+	return nil
+}
+
+// Serialize is a job.Job interface method.
+func (j *Job) Serialize() ([]byte, error) {
+	return json.Marshal(j)
+}
+
+// Deserialize is a job.Job interface method.
+func (j *Job) Deserialize(bytes []byte) error {
+	var d Job
+	if err := json.Unmarshal(bytes, &d); err != nil {
+		return err
+	}
+	j.URL = d.URL
+	j.Addr = d.Addr
+	j.ExpectStatus = d.ExpectStatus
+	j.Contains = d.Contains
+	j.Timeout = d.Timeout
+	j.Interval = d.Interval
+	j.MaxInterval = d.MaxInterval
+	j.Backoff = d.Backoff
+	j.AttemptTimeout = d.AttemptTimeout
+	return nil
+}
+
+// SetScratch is a job.ScratchJob interface method.
+func (j *Job) SetScratch(s job.Scratch) {
+	j.scratch = s
+}
+
+// Run is a job.Job interface method. It returns STATE_COMPLETE on the first ready
+// attempt, STATE_FAIL with job.ErrRunTimeout if the timeout elapses first, and
+// STATE_STOPPED if stopped.
+func (j *Job) Run(jobData map[string]interface{}) (job.Return, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	deadline := j.deadlineTime()
+	j.Lock()
+	if j.stopped {
+		j.Unlock()
+		return job.Return{State: proto.STATE_STOPPED}, nil
+	}
+	j.deadline = deadline
+	j.cancel = cancel
+	j.Unlock()
+
+	interval := j.Interval
+	for attempt := 1; ; attempt++ {
+		err := j.check(ctx)
+
+		j.Lock()
+		j.attempts = attempt
+		j.lastErr = err
+		j.Unlock()
+
+		if err == nil {
+			j.deleteDeadline()
+			return job.Return{
+				State:  proto.STATE_COMPLETE,
+				Stdout: fmt.Sprintf("%s ready after %d attempts\n", j.target(), attempt),
+			}, nil
+		}
+
+		select {
+		case <-j.stopChan:
+			// Keep the deadline in the scratch store so that, on resume, the
+			// job polls only for the remaining time
+			return job.Return{State: proto.STATE_STOPPED}, nil
+		default:
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			j.deleteDeadline()
+			return job.Return{
+				State:  proto.STATE_FAIL,
+				Error:  job.ErrRunTimeout,
+				Stderr: fmt.Sprintf("%s not ready after %s (%d attempts), last error: %s\n", j.target(), j.Timeout, attempt, err),
+			}, nil
+		}
+
+		wait := interval
+		if wait > left {
+			wait = left
+		}
+		j.Lock()
+		j.next = time.Now().Add(wait)
+		j.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-j.stopChan:
+			return job.Return{State: proto.STATE_STOPPED}, nil
+		}
+
+		interval = time.Duration(float64(interval) * j.Backoff)
+		if interval > j.MaxInterval {
+			interval = j.MaxInterval
+		}
+	}
+}
+
+// Stop is a job.Job interface method. It cancels an attempt in progress.
+func (j *Job) Stop() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.stopped {
+		return nil
+	}
+	j.stopped = true
+	close(j.stopChan)
+	if j.cancel != nil {
+		j.cancel()
+	}
+	return nil
+}
+
+// Status is a job.Job interface method. It returns the last attempt and when
+// the next one is, like "polling http://app/health: attempt 3: status 503,
+// expected 2xx; next attempt in 20s, timeout in 4m10s".
+func (j *Job) Status() string {
+	j.Lock()
+	defer j.Unlock()
+	if j.deadline.IsZero() {
+		return "not running"
+	}
+	status := fmt.Sprintf("polling %s: ", j.target())
+	if j.attempts == 0 {
+		status += "first attempt"
+	} else if j.lastErr == nil {
+		status += fmt.Sprintf("attempt %d: ready", j.attempts)
+		return status
+	} else {
+		status += fmt.Sprintf("attempt %d: %s; next attempt in %s", j.attempts, j.lastErr, untilRounded(j.next))
+	}
+	return status + fmt.Sprintf(", timeout in %s", untilRounded(j.deadline))
+}
+
+// Id is a job.Job interface method.
+func (j *Job) Id() job.Id {
+	return j.id
+}
+
+// check makes one attempt. It returns nil if the URL or address is ready, else
+// why it's not ready.
+func (j *Job) check(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, j.AttemptTimeout)
+	defer cancel()
+
+	if j.Addr != "" {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", j.Addr)
+		if err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", j.URL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if j.ExpectStatus != 0 && resp.StatusCode != j.ExpectStatus {
+		return fmt.Errorf("status %d, expected %d", resp.StatusCode, j.ExpectStatus)
+	}
+	if j.ExpectStatus == 0 && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+		return fmt.Errorf("status %d, expected 2xx", resp.StatusCode)
+	}
+	if j.Contains == "" {
+		return nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, MAX_BODY_SIZE))
+	if err != nil {
+		return fmt.Errorf("error reading response body: %s", err)
+	}
+	if !strings.Contains(string(body), j.Contains) {
+		return fmt.Errorf("response body does not contain %q", j.Contains)
+	}
+	return nil
+}
+
+func (j *Job) target() string {
+	if j.Addr != "" {
+		return j.Addr
+	}
+	return j.URL
+}
+
+// deadlineTime returns when the job stops polling: the deadline saved in the
+// scratch store by a previous run, if any, else now plus Timeout. A new deadline
+// is saved in the scratch store.
+func (j *Job) deadlineTime() time.Time {
+	if j.scratch != nil {
+		if v, ok := j.scratch.Get(j.scratchKey()); ok {
+			var deadline time.Time
+			if err := deadline.UnmarshalText(v); err == nil {
+				return deadline
+			}
+		}
+	}
+	deadline := time.Now().Add(j.Timeout)
+	if j.scratch != nil {
+		if v, err := deadline.MarshalText(); err == nil {
+			j.scratch.Set(j.scratchKey(), v)
+		}
+	}
+	return deadline
+}
+
+func (j *Job) deleteDeadline() {
+	if j.scratch != nil {
+		j.scratch.Delete(j.scratchKey())
+	}
+}
+
+func (j *Job) scratchKey() string {
+	return SCRATCH_KEY_PREFIX + j.id.Id
+}
+
+func untilRounded(t time.Time) time.Duration {
+	d := time.Until(t).Round(time.Second)
+	if d < 0 {
+		return 0
+	}
+	return d
+}
+
+// --------------------------------------------------------------------------
+
+// Job arg values are strings when they're request args, but can be other types
+// when set by jobs, so the helpers below accept both.
+
+func stringArg(jobArgs map[string]interface{}, name string) (string, error) {
+	v, ok := jobArgs[name]
+	if !ok || v == nil {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("job arg %s is type %T, expected string", name, v)
+	}
+	return s, nil
+}
+
+func intArg(jobArgs map[string]interface{}, name string, def int) (int, error) {
+	v, ok := jobArgs[name]
+	if !ok || v == nil || v == "" {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case int:
+		return n, nil
+	case int64:
+		return int(n), nil
+	case float64:
+		return int(n), nil
+	case string:
+		i, err := strconv.Atoi(n)
+		if err != nil {
+			return 0, fmt.Errorf("job arg %s: invalid integer %q", name, n)
+		}
+		return i, nil
+	}
+	return 0, fmt.Errorf("job arg %s is type %T, expected int or string", name, v)
+}
+
+func floatArg(jobArgs map[string]interface{}, name string, def float64) (float64, error) {
+	v, ok := jobArgs[name]
+	if !ok || v == nil || v == "" {
+		return def, nil
+	}
+	switch n := v.(type) {
+	case float64:
+		return n, nil
+	case int:
+		return float64(n), nil
+	case string:
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return 0, fmt.Errorf("job arg %s: invalid number %q", name, n)
+		}
+		return f, nil
+	}
+	return 0, fmt.Errorf("job arg %s is type %T, expected float64 or string", name, v)
+}
+
+func durationArg(jobArgs map[string]interface{}, name string, def time.Duration) (time.Duration, error) {
+	v, ok := jobArgs[name]
+	if !ok || v == nil || v == "" {
+		return def, nil
+	}
+	var d time.Duration
+	switch t := v.(type) {
+	case time.Duration:
+		d = t
+	case string:
+		var err error
+		d, err = time.ParseDuration(t)
+		if err != nil {
+			return 0, fmt.Errorf("job arg %s: invalid duration %q: %s", name, t, err)
+		}
+	default:
+		return 0, fmt.Errorf("job arg %s is type %T, expected time.Duration or duration string", name, v)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("job arg %s: duration %s must be greater than zero", name, d)
+	}
+	return d, nil
+}
+
+// --------------------------------------------------------------------------
+
+// NewFactory returns a job.Factory that makes poll jobs (JOB_TYPE) and uses jf
+// to make all other jobs. The Request Manager and Job Runner use it to make poll
+// jobs, which are not made by the user-provided job factory.
+func NewFactory(jf job.Factory) job.Factory {
+	return factory{jf: jf}
+}
+
+type factory struct {
+	jf job.Factory
+}
+
+func (f factory) Make(jid job.Id) (job.Job, error) {
+	if jid.Type == JOB_TYPE {
+		return New(jid), nil
+	}
+	return f.jf.Make(jid)
+}
@@ -0,0 +1,257 @@
+// Copyright 2020, Square, Inc.
+
+package poll_test
+
+import (
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+var jid = job.NewIdWithRequestId(poll.JOB_TYPE, "wait-for-app", "j1", "req1")
+
+// create makes a new poll job like the Request Manager, then deserializes it like
+// the Job Runner.
+func create(t *testing.T, jobArgs map[string]interface{}) job.Job {
+	jf := poll.NewFactory(&mock.JobFactory{})
+	j, err := jf.Make(jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := j.Create(jobArgs); err != nil {
+		t.Fatal(err)
+	}
+	bytes, err := j.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr, err := jf.Make(jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jr.Deserialize(bytes); err != nil {
+		t.Fatal(err)
+	}
+	return jr
+}
+
+func TestPollHTTP(t *testing.T) {
+	// Not ready (503) for the first 2 attempts, then ready
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&n, 1) <= 2 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{"status":"ok"}`))
+	}))
+	defer ts.Close()
+
+	jr := create(t, map[string]interface{}{
+		"url":      ts.URL,
+		"contains": `"ok"`,
+		"interval": "20ms",
+	})
+	if status := jr.Status(); status != "not running" {
+		t.Errorf("got status %q before run, expected 'not running'", status)
+	}
+
+	doneChan := make(chan job.Return)
+	go func() {
+		ret, _ := jr.Run(map[string]interface{}{})
+		doneChan <- ret
+	}()
+	time.Sleep(10 * time.Millisecond)
+	if status := jr.Status(); !strings.HasPrefix(status, "polling "+ts.URL+": attempt 1: status 503, expected 2xx") {
+		t.Errorf("got status %q while running, expected 'polling %s: attempt 1: status 503...'", status, ts.URL)
+	}
+
+	select {
+	case ret := <-doneChan:
+		if ret.State != proto.STATE_COMPLETE {
+			t.Errorf("got state %s, expected COMPLETE (error: %v)", proto.StateName[ret.State], ret.Error)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("job did not complete")
+	}
+	if got := atomic.LoadInt32(&n); got != 3 {
+		t.Errorf("got %d attempts, expected 3", got)
+	}
+}
+
+func TestPollHTTPTimeout(t *testing.T) {
+	// Always 200 but never the expected status or body
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("starting"))
+	}))
+	defer ts.Close()
+
+	for _, args := range []map[string]interface{}{
+		{"url": ts.URL, "status": "204"},
+		{"url": ts.URL, "contains": "ready"},
+	} {
+		args["timeout"] = "100ms"
+		args["interval"] = "20ms"
+		jr := create(t, args)
+		t0 := time.Now()
+		ret, err := jr.Run(map[string]interface{}{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ret.State != proto.STATE_FAIL {
+			t.Errorf("%v: got state %s, expected FAIL", args, proto.StateName[ret.State])
+		}
+		if ret.Error != job.ErrRunTimeout {
+			t.Errorf("%v: got error %v, expected job.ErrRunTimeout", args, ret.Error)
+		}
+		if d := time.Now().Sub(t0); d < 100*time.Millisecond || d > 1*time.Second {
+			t.Errorf("%v: polled for %s, expected about 100ms", args, d)
+		}
+	}
+}
+
+func TestPollTCP(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	jr := create(t, map[string]interface{}{"addr": ln.Addr().String()})
+	ret, err := jr.Run(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.State != proto.STATE_COMPLETE {
+		t.Errorf("got state %s, expected COMPLETE (error: %v)", proto.StateName[ret.State], ret.Error)
+	}
+}
+
+func TestPollBackoff(t *testing.T) {
+	// Attempts at 0, 20ms, 60ms, 110ms (max interval 50ms), 160ms, and a last
+	// one at the 180ms timeout
+	var n int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&n, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	jr := create(t, map[string]interface{}{
+		"url":         ts.URL,
+		"timeout":     "180ms",
+		"interval":    "20ms",
+		"maxInterval": "50ms",
+		"backoff":     2,
+	})
+	ret, _ := jr.Run(map[string]interface{}{})
+	if ret.State != proto.STATE_FAIL {
+		t.Errorf("got state %s, expected FAIL", proto.StateName[ret.State])
+	}
+	if got := atomic.LoadInt32(&n); got != 6 {
+		t.Errorf("got %d attempts, expected 6", got)
+	}
+}
+
+func TestPollStopResume(t *testing.T) {
+	var ready int32
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.LoadInt32(&ready) == 0 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer ts.Close()
+
+	scratch := &mock.Scratch{}
+	args := map[string]interface{}{"url": ts.URL, "timeout": "10s", "interval": "5s"}
+	jr := create(t, args)
+	jr.(job.ScratchJob).SetScratch(scratch)
+
+	doneChan := make(chan job.Return)
+	go func() {
+		ret, _ := jr.Run(map[string]interface{}{})
+		doneChan <- ret
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := jr.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ret := <-doneChan:
+		if ret.State != proto.STATE_STOPPED {
+			t.Errorf("got state %s, expected STOPPED", proto.StateName[ret.State])
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("job did not stop")
+	}
+
+	// The deadline is kept in the scratch store so the job resumes with the
+	// remaining time
+	key := poll.SCRATCH_KEY_PREFIX + jid.Id
+	if _, ok := scratch.Get(key); !ok {
+		t.Fatalf("deadline not saved in scratch store, expected key %s", key)
+	}
+
+	atomic.StoreInt32(&ready, 1)
+	jr = create(t, args)
+	jr.(job.ScratchJob).SetScratch(scratch)
+	ret, err := jr.Run(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.State != proto.STATE_COMPLETE {
+		t.Errorf("got state %s, expected COMPLETE", proto.StateName[ret.State])
+	}
+	if _, ok := scratch.Get(key); ok {
+		t.Errorf("deadline still in scratch store after job completed")
+	}
+}
+
+func TestPollCreateInvalid(t *testing.T) {
+	for _, args := range []map[string]interface{}{
+		{},
+		{"url": "http://app/health", "addr": "app:80"},
+		{"url": "ftp://app/health"},
+		{"addr": "app"},
+		{"addr": "app:80", "status": "200"},
+		{"url": "http://app/health", "status": "ok"},
+		{"url": "http://app/health", "timeout": "soon"},
+		{"url": "http://app/health", "timeout": "-1s"},
+		{"url": "http://app/health", "backoff": "0.5"},
+		{"url": "http://app/health", "interval": "2m", "maxInterval": "1m"},
+		{"url": 123},
+	} {
+		j := poll.New(jid)
+		if err := j.Create(args); err == nil {
+			t.Errorf("no error for job args %v, expected an error", args)
+		}
+	}
+}
+
+func TestFactory(t *testing.T) {
+	// Other job types are made by the wrapped factory
+	jf := poll.NewFactory(&mock.JobFactory{MockJobs: map[string]*mock.Job{"type1": &mock.Job{}}})
+	j, err := jf.Make(job.NewId("type1", "job1", "j2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.(*mock.Job); !ok {
+		t.Errorf("got job type %T, expected *mock.Job", j)
+	}
+	j, err = jf.Make(jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.(*poll.Job); !ok {
+		t.Errorf("got job type %T, expected *poll.Job", j)
+	}
+}
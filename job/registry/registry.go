@@ -0,0 +1,209 @@
+// Copyright 2020, Square, Inc.
+
+// Package registry provides a job.Factory that makes registered job types, so
+// job implementations can be deployed independently of the Job Runner binary.
+// Job types are registered in code with Register, or loaded at Job Runner
+// startup from Go plugins (.so files) with Load. A Go plugin must export a
+// Plugin variable named PLUGIN_SYMBOL:
+//
+//   package main
+//
+//   var Jobs = registry.Plugin{
+//     Name:             "mysql-jobs",
+//     Version:          "1.4.0",
+//     SpincycleVersion: version.VERSION,
+//     Jobs: map[string]registry.MakeFunc{
+//       "mysql/restart": func(id job.Id) (job.Job, error) { return mysql.NewRestart(id), nil },
+//     },
+//   }
+//
+// and be built with "go build -buildmode=plugin" against the same Spin Cycle
+// version and Go toolchain as the Job Runner.
+package registry
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/version"
+)
+
+// PLUGIN_SYMBOL is the name of the Plugin variable that a Go plugin exports.
+const PLUGIN_SYMBOL = "Jobs"
+
+// MakeFunc makes a new job. It has the same contract as job.Factory.Make.
+type MakeFunc func(job.Id) (job.Job, error)
+
+// Plugin is a set of job types, usually exported by a Go plugin.
+type Plugin struct {
+	Name             string              // plugin name, like "mysql-jobs"
+	Version          string              // plugin version, reported by the list-jobs API
+	SpincycleVersion string              // Spin Cycle version (version.VERSION) the plugin was built with
+	Jobs             map[string]MakeFunc // keyed on job type
+}
+
+type entry struct {
+	make    MakeFunc
+	plugin  string
+	version string
+}
+
+// Registry is a job.Factory that makes registered job types. Job types that are
+// not registered are made by the fallback factory, if any.
+type Registry struct {
+	fallback job.Factory
+	jobs     map[string]entry
+	*sync.RWMutex
+}
+
+var _ job.Factory = &Registry{}
+
+// New returns an empty Registry. If fallback is not nil, it makes job types that
+// are not registered, usually the built-in jobs.Factory.
+func New(fallback job.Factory) *Registry {
+	return &Registry{
+		fallback: fallback,
+		jobs:     map[string]entry{},
+		RWMutex:  &sync.RWMutex{},
+	}
+}
+
+// Register registers the job type made by f. It returns an error if the job type
+// is already registered.
+func (r *Registry) Register(jobType string, f MakeFunc) error {
+	return r.register(jobType, entry{make: f})
+}
+
+func (r *Registry) register(jobType string, e entry) error {
+	if jobType == "" {
+		return fmt.Errorf("job type is empty")
+	}
+	if e.make == nil {
+		return fmt.Errorf("job type %s: make func is nil", jobType)
+	}
+	r.Lock()
+	defer r.Unlock()
+	if prev, ok := r.jobs[jobType]; ok {
+		if prev.plugin != "" {
+			return fmt.Errorf("job type %s already registered by plugin %s", jobType, prev.plugin)
+		}
+		return fmt.Errorf("job type %s already registered", jobType)
+	}
+	r.jobs[jobType] = e
+	return nil
+}
+
+// RegisterPlugin registers all job types of the plugin. It returns an error,
+// and registers no job types, if the plugin is not compatible with this version
+// of Spin Cycle or one of its job types is already registered.
+func (r *Registry) RegisterPlugin(p Plugin) error {
+	if p.Name == "" {
+		return fmt.Errorf("plugin name is empty")
+	}
+	if err := compatible(p.SpincycleVersion); err != nil {
+		return fmt.Errorf("plugin %s: %s", p.Name, err)
+	}
+	r.RLock()
+	for jobType := range p.Jobs {
+		if prev, ok := r.jobs[jobType]; ok {
+			r.RUnlock()
+			if prev.plugin != "" {
+				return fmt.Errorf("plugin %s: job type %s already registered by plugin %s", p.Name, jobType, prev.plugin)
+			}
+			return fmt.Errorf("plugin %s: job type %s already registered", p.Name, jobType)
+		}
+	}
+	r.RUnlock()
+	for jobType, f := range p.Jobs {
+		if err := r.register(jobType, entry{make: f, plugin: p.Name, version: p.Version}); err != nil {
+			return fmt.Errorf("plugin %s: %s", p.Name, err)
+		}
+	}
+	return nil
+}
+
+// Load opens every Go plugin (*.so file) in dir and registers its job types.
+// It returns the first error: a file that is not a Go plugin, a plugin without
+// PLUGIN_SYMBOL, or any error from RegisterPlugin.
+func (r *Registry) Load(dir string) ([]Plugin, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	plugins := make([]Plugin, 0, len(files))
+	for _, file := range files {
+		p, err := plugin.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open plugin %s: %s", file, err)
+		}
+		sym, err := p.Lookup(PLUGIN_SYMBOL)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %s", file, err)
+		}
+		jobs, ok := sym.(*Plugin)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: %s is type %T, expected registry.Plugin", file, PLUGIN_SYMBOL, sym)
+		}
+		if err := r.RegisterPlugin(*jobs); err != nil {
+			return nil, fmt.Errorf("%s (%s)", err, file)
+		}
+		plugins = append(plugins, *jobs)
+	}
+	return plugins, nil
+}
+
+// Make makes a job of a registered job type, else it calls the fallback factory.
+// It returns job.ErrUnknownJobType if the job type is not registered and there
+// is no fallback factory.
+func (r *Registry) Make(id job.Id) (job.Job, error) {
+	r.RLock()
+	e, ok := r.jobs[id.Type]
+	r.RUnlock()
+	if ok {
+		return e.make(id)
+	}
+	if r.fallback != nil {
+		return r.fallback.Make(id)
+	}
+	return nil, job.ErrUnknownJobType
+}
+
+// JobTypes returns the registered job types, sorted by type. Job types made by
+// the fallback factory are not known, so they are not returned.
+func (r *Registry) JobTypes() []proto.JobType {
+	r.RLock()
+	defer r.RUnlock()
+	types := make([]proto.JobType, 0, len(r.jobs))
+	for jobType, e := range r.jobs {
+		types = append(types, proto.JobType{
+			Type:          jobType,
+			Plugin:        e.plugin,
+			PluginVersion: e.version,
+		})
+	}
+	sort.Slice(types, func(i, j int) bool { return types[i].Type < types[j].Type })
+	return types
+}
+
+// compatible returns an error unless the Spin Cycle version that a plugin was
+// built with has the same major version as this Spin Cycle.
+func compatible(pluginVersion string) error {
+	if pluginVersion == "" {
+		return fmt.Errorf("SpincycleVersion is empty, set it to version.VERSION")
+	}
+	if major(pluginVersion) != major(version.VERSION) {
+		return fmt.Errorf("built with Spin Cycle %s, which is not compatible with Spin Cycle %s", pluginVersion, version.VERSION)
+	}
+	return nil
+}
+
+func major(v string) string {
+	return strings.SplitN(strings.TrimPrefix(v, "v"), ".", 2)[0]
+}
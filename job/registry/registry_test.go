@@ -0,0 +1,120 @@
+// Copyright 2020, Square, Inc.
+
+package registry_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job/registry"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/test/mock"
+	"github.com/square/spincycle/v2/version"
+)
+
+func makeMock(id job.Id) (job.Job, error) {
+	return &mock.Job{IdResp: id}, nil
+}
+
+func TestRegistry(t *testing.T) {
+	fallback := &mock.JobFactory{}
+	r := registry.New(fallback)
+
+	if err := r.Register("local", makeMock); err != nil {
+		t.Fatal(err)
+	}
+	err := r.RegisterPlugin(registry.Plugin{
+		Name:             "p1",
+		Version:          "1.2.3",
+		SpincycleVersion: version.VERSION,
+		Jobs:             map[string]registry.MakeFunc{"p1/job": makeMock},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Registered job types are made by the registry, others by the fallback
+	for _, jobType := range []string{"local", "p1/job", "other"} {
+		j, err := r.Make(job.NewId(jobType, "name", "id"))
+		if err != nil {
+			t.Errorf("%s: got error %s, expected nil", jobType, err)
+			continue
+		}
+		if j.Id().Type != jobType {
+			t.Errorf("made job type %s, expected %s", j.Id().Type, jobType)
+		}
+	}
+
+	expect := []proto.JobType{
+		{Type: "local"},
+		{Type: "p1/job", Plugin: "p1", PluginVersion: "1.2.3"},
+	}
+	if diff := deep.Equal(r.JobTypes(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Without a fallback, unknown job types are an error
+	r = registry.New(nil)
+	if _, err := r.Make(job.NewId("other", "name", "id")); err != job.ErrUnknownJobType {
+		t.Errorf("got error %v, expected job.ErrUnknownJobType", err)
+	}
+}
+
+func TestRegisterPluginErrors(t *testing.T) {
+	r := registry.New(nil)
+	if err := r.RegisterPlugin(registry.Plugin{Name: "p1", SpincycleVersion: version.VERSION, Jobs: map[string]registry.MakeFunc{"a": makeMock}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Duplicate job type: no job types registered
+	err := r.RegisterPlugin(registry.Plugin{
+		Name:             "p2",
+		SpincycleVersion: version.VERSION,
+		Jobs:             map[string]registry.MakeFunc{"a": makeMock, "b": makeMock},
+	})
+	if err == nil {
+		t.Error("no error registering duplicate job type, expected an error")
+	}
+	if len(r.JobTypes()) != 1 {
+		t.Errorf("got %d job types, expected 1: %+v", len(r.JobTypes()), r.JobTypes())
+	}
+
+	// Incompatible versions
+	for _, v := range []string{"", "1.0.0", "3.0.0"} {
+		err := r.RegisterPlugin(registry.Plugin{Name: "old", SpincycleVersion: v, Jobs: map[string]registry.MakeFunc{"c": makeMock}})
+		if err == nil {
+			t.Errorf("no error registering plugin built with version '%s', expected an error", v)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spincycle-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// No plugins is not an error
+	r := registry.New(nil)
+	plugins, err := r.Load(dir)
+	if err != nil {
+		t.Fatalf("got error %s, expected nil", err)
+	}
+	if len(plugins) != 0 {
+		t.Errorf("loaded %d plugins, expected 0", len(plugins))
+	}
+
+	// A file that isn't a Go plugin is an error
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.so"), []byte("not a plugin"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Load(dir); err == nil {
+		t.Error("no error loading invalid plugin, expected an error")
+	}
+}
@@ -0,0 +1,45 @@
+// Copyright 2020, Square, Inc.
+
+package job
+
+import (
+	"os"
+	"time"
+)
+
+// Usage is the resource usage of one job try. The Job Runner measures the CPU
+// time of the goroutine that calls Run (or RunContext), where the platform allows
+// it (Linux), but it cannot measure processes or other goroutines that the job
+// starts, or memory, because jobs share the Job Runner process. A job that runs
+// a process should set Return.Usage from ProcessUsage; the Job Runner adds its
+// own measurement of CPU time.
+type Usage struct {
+	CPUTime   time.Duration // user + system CPU time
+	MaxMemory int64         // peak resident memory (bytes), zero if unknown
+}
+
+// ProcessUsage returns the resource usage of a process that has exited, like
+// exec.Cmd.ProcessState after Wait or Run. MaxMemory is set only on platforms
+// that report it (Linux and macOS). It returns zero Usage if ps is nil.
+func ProcessUsage(ps *os.ProcessState) Usage {
+	if ps == nil {
+		return Usage{}
+	}
+	return Usage{
+		CPUTime:   ps.UserTime() + ps.SystemTime(),
+		MaxMemory: maxRSS(ps),
+	}
+}
+
+// Add returns the sum of u and v: CPU time is added, and MaxMemory is the max of
+// the two because peak memory of different processes isn't additive over time.
+func (u Usage) Add(v Usage) Usage {
+	sum := Usage{
+		CPUTime:   u.CPUTime + v.CPUTime,
+		MaxMemory: u.MaxMemory,
+	}
+	if v.MaxMemory > sum.MaxMemory {
+		sum.MaxMemory = v.MaxMemory
+	}
+	return sum
+}
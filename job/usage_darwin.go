@@ -0,0 +1,16 @@
+// Copyright 2020, Square, Inc.
+
+package job
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak RSS of the process in bytes. macOS reports bytes.
+func maxRSS(ps *os.ProcessState) int64 {
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok && ru != nil {
+		return ru.Maxrss
+	}
+	return 0
+}
@@ -0,0 +1,16 @@
+// Copyright 2020, Square, Inc.
+
+package job
+
+import (
+	"os"
+	"syscall"
+)
+
+// maxRSS returns the peak RSS of the process in bytes. Linux reports kilobytes.
+func maxRSS(ps *os.ProcessState) int64 {
+	if ru, ok := ps.SysUsage().(*syscall.Rusage); ok && ru != nil {
+		return ru.Maxrss * 1024
+	}
+	return 0
+}
@@ -0,0 +1,15 @@
+// Copyright 2020, Square, Inc.
+
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+package job
+
+import (
+	"os"
+)
+
+// maxRSS returns zero: peak RSS is not reported on this platform.
+func maxRSS(ps *os.ProcessState) int64 {
+	return 0
+}
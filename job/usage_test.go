@@ -0,0 +1,42 @@
+// Copyright 2020, Square, Inc.
+
+package job_test
+
+import (
+	"os/exec"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+)
+
+func TestProcessUsage(t *testing.T) {
+	if u := job.ProcessUsage(nil); u != (job.Usage{}) {
+		t.Errorf("got %+v for nil process state, expected zero Usage", u)
+	}
+	if runtime.GOOS != "linux" {
+		t.Skip("peak memory is only tested on linux")
+	}
+	cmd := exec.Command("true")
+	if err := cmd.Run(); err != nil {
+		t.Skip(err)
+	}
+	u := job.ProcessUsage(cmd.ProcessState)
+	if u.MaxMemory <= 0 {
+		t.Errorf("MaxMemory = %d, expected > 0", u.MaxMemory)
+	}
+}
+
+func TestUsageAdd(t *testing.T) {
+	u := job.Usage{CPUTime: time.Second, MaxMemory: 100}
+	got := u.Add(job.Usage{CPUTime: 2 * time.Second, MaxMemory: 50})
+	expect := job.Usage{CPUTime: 3 * time.Second, MaxMemory: 100}
+	if got != expect {
+		t.Errorf("got %+v, expected %+v", got, expect)
+	}
+	got = got.Add(job.Usage{MaxMemory: 200})
+	if got.MaxMemory != 200 {
+		t.Errorf("MaxMemory = %d, expected 200", got.MaxMemory)
+	}
+}
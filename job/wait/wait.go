@@ -0,0 +1,209 @@
+// Copyright 2020, Square, Inc.
+
+// Package wait implements the built-in job for "wait" nodes (category: wait in
+// a request spec). A wait job sleeps in the Job Runner for a fixed duration or
+// until a time given by a job arg, then completes. It responds to Stop, and its
+// end time is saved in the job chain scratch store, so a suspended and resumed
+// job waits only for the remaining time, not the whole duration again.
+package wait
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// JOB_TYPE is the job type (job.Id.Type and proto.Job.Type) of wait jobs.
+const JOB_TYPE = "spincycle/wait"
+
+// SCRATCH_KEY_PREFIX is the prefix of the job chain scratch store key where a
+// wait job saves its end time. The full key is the prefix plus the job ID.
+const SCRATCH_KEY_PREFIX = "spincycle/wait/"
+
+// Job is a job.Job and job.ScratchJob that waits.
+type Job struct {
+	// Internal data (serialized)
+	Duration time.Duration `json:"duration,omitempty"` // how long to wait, or
+	Until    time.Time     `json:"until"`              // when to stop waiting
+
+	// Create only
+	untilArg string // job arg with Until value
+
+	// While running
+	scratch  job.Scratch
+	end      time.Time
+	stopChan chan struct{}
+	stopped  bool
+	*sync.Mutex
+
+	// Meta
+	id job.Id
+}
+
+// New returns a wait job that waits for duration, or until the time in job arg
+// untilArg if untilArg is not empty. It's called by the Request Manager to make
+// wait jobs from spec nodes.
+func New(jid job.Id, duration time.Duration, untilArg string) *Job {
+	j := newJob(jid)
+	j.Duration = duration
+	j.untilArg = untilArg
+	return j
+}
+
+func newJob(jid job.Id) *Job {
+	return &Job{
+		id:       jid,
+		Mutex:    &sync.Mutex{},
+		stopChan: make(chan struct{}),
+	}
+}
+
+// Create is a job.Job interface method. If the job waits until a time, the
+// job arg must be a time.Time or an RFC 3339 string, like "2020-06-01T12:00:00Z".
+func (j *Job) Create(jobArgs map[string]interface{}) error {
+	if j.untilArg == "" {
+		return nil
+	}
+	arg, ok := jobArgs[j.untilArg]
+	if !ok {
+		return job.ErrArgNotSet{Arg: j.untilArg}
+	}
+	switch v := arg.(type) {
+	case time.Time:
+		j.Until = v
+	case string:
+		until, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return fmt.Errorf("job arg %s: invalid time %q: %s (expected RFC 3339 format, like 2020-06-01T12:00:00Z)", j.untilArg, v, err)
+		}
+		j.Until = until
+	default:
+		return fmt.Errorf("job arg %s is type %T, expected time.Time or RFC 3339 string", j.untilArg, arg)
+	}
+	return nil
+}
+
+// Serialize is a job.Job interface method.
+func (j *Job) Serialize() ([]byte, error) {
+	return json.Marshal(j)
+}
+
+// Deserialize is a job.Job interface method.
+func (j *Job) Deserialize(bytes []byte) error {
+	var d Job
+	if err := json.Unmarshal(bytes, &d); err != nil {
+		return err
+	}
+	j.Duration = d.Duration
+	j.Until = d.Until
+	return nil
+}
+
+// SetScratch is a job.ScratchJob interface method.
+func (j *Job) SetScratch(s job.Scratch) {
+	j.scratch = s
+}
+
+// Run is a job.Job interface method.
+func (j *Job) Run(jobData map[string]interface{}) (job.Return, error) {
+	end := j.endTime()
+	j.Lock()
+	j.end = end
+	j.Unlock()
+
+	ret := job.Return{}
+	select {
+	case <-time.After(time.Until(end)):
+		if j.scratch != nil {
+			j.scratch.Delete(j.scratchKey())
+		}
+		ret.State = proto.STATE_COMPLETE
+	case <-j.stopChan:
+		// Keep the end time in the scratch store so that, on resume, the job
+		// waits only for the remaining time
+		ret.State = proto.STATE_STOPPED
+	}
+	return ret, nil
+}
+
+// Stop is a job.Job interface method.
+func (j *Job) Stop() error {
+	j.Lock()
+	defer j.Unlock()
+	if j.stopped {
+		return nil
+	}
+	j.stopped = true
+	close(j.stopChan)
+	return nil
+}
+
+// Status is a job.Job interface method. It returns the remaining time while
+// the job is running, like "waiting 4m30s (until 2020-06-01T12:00:00Z)".
+func (j *Job) Status() string {
+	j.Lock()
+	defer j.Unlock()
+	if j.end.IsZero() {
+		return "not running"
+	}
+	left := time.Until(j.end).Round(time.Second)
+	if left < 0 {
+		left = 0
+	}
+	return fmt.Sprintf("waiting %s (until %s)", left, j.end.UTC().Format(time.RFC3339))
+}
+
+// Id is a job.Job interface method.
+func (j *Job) Id() job.Id {
+	return j.id
+}
+
+// endTime returns when the job stops waiting: the end time saved in the scratch
+// store by a previous run, if any, else Until or now plus Duration. A new end
+// time is saved in the scratch store.
+func (j *Job) endTime() time.Time {
+	if j.scratch != nil {
+		if v, ok := j.scratch.Get(j.scratchKey()); ok {
+			var end time.Time
+			if err := end.UnmarshalText(v); err == nil {
+				return end
+			}
+		}
+	}
+	end := j.Until
+	if end.IsZero() {
+		end = time.Now().Add(j.Duration)
+	}
+	if j.scratch != nil {
+		if v, err := end.MarshalText(); err == nil {
+			j.scratch.Set(j.scratchKey(), v)
+		}
+	}
+	return end
+}
+
+func (j *Job) scratchKey() string {
+	return SCRATCH_KEY_PREFIX + j.id.Id
+}
+
+// NewFactory returns a job.Factory that makes wait jobs (JOB_TYPE) and uses jf
+// to make all other jobs. The Job Runner uses it to make wait jobs, which are
+// not made by the user-provided job factory.
+func NewFactory(jf job.Factory) job.Factory {
+	return factory{jf: jf}
+}
+
+type factory struct {
+	jf job.Factory
+}
+
+func (f factory) Make(jid job.Id) (job.Job, error) {
+	if jid.Type == JOB_TYPE {
+		return newJob(jid), nil
+	}
+	return f.jf.Make(jid)
+}
@@ -0,0 +1,186 @@
+// Copyright 2020, Square, Inc.
+
+package wait_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job/wait"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+var jid = job.NewIdWithRequestId(wait.JOB_TYPE, "wait-a-bit", "j1", "req1")
+
+// deserialize makes a new wait job like the Job Runner: with the factory, from
+// the serialized job made by the Request Manager.
+func deserialize(t *testing.T, j *wait.Job) job.Job {
+	bytes, err := j.Serialize()
+	if err != nil {
+		t.Fatal(err)
+	}
+	jr, err := wait.NewFactory(&mock.JobFactory{}).Make(jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := jr.Deserialize(bytes); err != nil {
+		t.Fatal(err)
+	}
+	return jr
+}
+
+func TestWaitDuration(t *testing.T) {
+	j := wait.New(jid, 200*time.Millisecond, "")
+	if err := j.Create(map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	jr := deserialize(t, j)
+
+	if status := jr.Status(); status != "not running" {
+		t.Errorf("got status %q before run, expected 'not running'", status)
+	}
+
+	t0 := time.Now()
+	doneChan := make(chan job.Return)
+	go func() {
+		ret, _ := jr.Run(map[string]interface{}{})
+		doneChan <- ret
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if status := jr.Status(); !strings.HasPrefix(status, "waiting ") {
+		t.Errorf("got status %q while running, expected 'waiting ...'", status)
+	}
+
+	ret := <-doneChan
+	if ret.State != proto.STATE_COMPLETE {
+		t.Errorf("got state %s, expected COMPLETE", proto.StateName[ret.State])
+	}
+	if d := time.Now().Sub(t0); d < 200*time.Millisecond {
+		t.Errorf("waited %s, expected at least 200ms", d)
+	}
+}
+
+func TestWaitUntil(t *testing.T) {
+	// Until in the past: done immediately
+	j := wait.New(jid, 0, "maintenanceStart")
+	if err := j.Create(map[string]interface{}{"maintenanceStart": "2020-06-01T12:00:00Z"}); err != nil {
+		t.Fatal(err)
+	}
+	jr := deserialize(t, j)
+	ret, err := jr.Run(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.State != proto.STATE_COMPLETE {
+		t.Errorf("got state %s, expected COMPLETE", proto.StateName[ret.State])
+	}
+
+	// Until arg can be a time.Time
+	j = wait.New(jid, 0, "maintenanceStart")
+	until := time.Now().Add(100 * time.Millisecond)
+	if err := j.Create(map[string]interface{}{"maintenanceStart": until}); err != nil {
+		t.Fatal(err)
+	}
+	jr = deserialize(t, j)
+	ret, err = jr.Run(map[string]interface{}{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ret.State != proto.STATE_COMPLETE {
+		t.Errorf("got state %s, expected COMPLETE", proto.StateName[ret.State])
+	}
+	if time.Now().Before(until) {
+		t.Errorf("done before until time")
+	}
+}
+
+func TestWaitUntilInvalid(t *testing.T) {
+	j := wait.New(jid, 0, "maintenanceStart")
+	if err := j.Create(map[string]interface{}{}); err == nil {
+		t.Error("no error when until arg not set, expected job.ErrArgNotSet")
+	}
+	for _, v := range []interface{}{"tomorrow", 123} {
+		if err := j.Create(map[string]interface{}{"maintenanceStart": v}); err == nil {
+			t.Errorf("no error for until arg %v, expected an error", v)
+		}
+	}
+}
+
+func TestWaitStopResume(t *testing.T) {
+	scratch := &mock.Scratch{}
+
+	j := wait.New(jid, 10*time.Second, "")
+	if err := j.Create(map[string]interface{}{}); err != nil {
+		t.Fatal(err)
+	}
+	jr := deserialize(t, j)
+	jr.(job.ScratchJob).SetScratch(scratch)
+
+	doneChan := make(chan job.Return)
+	go func() {
+		ret, _ := jr.Run(map[string]interface{}{})
+		doneChan <- ret
+	}()
+	time.Sleep(50 * time.Millisecond)
+	if err := jr.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ret := <-doneChan:
+		if ret.State != proto.STATE_STOPPED {
+			t.Errorf("got state %s, expected STOPPED", proto.StateName[ret.State])
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("job did not stop")
+	}
+
+	// The end time is kept in the scratch store so the job resumes with the
+	// remaining time. Set it to 100ms from now, as if most of the wait passed
+	// while the job chain was suspended.
+	key := wait.SCRATCH_KEY_PREFIX + jid.Id
+	if _, ok := scratch.Get(key); !ok {
+		t.Fatalf("end time not saved in scratch store, expected key %s", key)
+	}
+	end, _ := time.Now().Add(100 * time.Millisecond).MarshalText()
+	scratch.Set(key, end)
+
+	jr = deserialize(t, j)
+	jr.(job.ScratchJob).SetScratch(scratch)
+	go func() {
+		ret, _ := jr.Run(map[string]interface{}{})
+		doneChan <- ret
+	}()
+	select {
+	case ret := <-doneChan:
+		if ret.State != proto.STATE_COMPLETE {
+			t.Errorf("got state %s, expected COMPLETE", proto.StateName[ret.State])
+		}
+	case <-time.After(1 * time.Second):
+		t.Fatal("resumed job waited the whole duration again, expected only the remaining time")
+	}
+	if _, ok := scratch.Get(key); ok {
+		t.Errorf("end time still in scratch store after job completed")
+	}
+}
+
+func TestFactory(t *testing.T) {
+	// Other job types are made by the wrapped factory
+	jf := wait.NewFactory(&mock.JobFactory{MockJobs: map[string]*mock.Job{"type1": &mock.Job{}}})
+	j, err := jf.Make(job.NewId("type1", "job1", "j2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.(*mock.Job); !ok {
+		t.Errorf("got job type %T, expected *mock.Job", j)
+	}
+	j, err = jf.Make(jid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := j.(*wait.Job); !ok {
+		t.Errorf("got job type %T, expected *wait.Job", j)
+	}
+}
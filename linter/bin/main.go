@@ -9,7 +9,5 @@ import (
 )
 
 func main() {
-	if ok := linter.Run(); !ok {
-		os.Exit(1)
-	}
+	os.Exit(linter.Run())
 }
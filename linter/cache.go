@@ -0,0 +1,171 @@
+// Copyright 2020, Square, Inc.
+
+package linter
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/square/spincycle/v2/request-manager/spec"
+	v "github.com/square/spincycle/v2/version"
+)
+
+// CACHE_FILE is the name of the lint cache file in --cache-dir.
+const CACHE_FILE = "spinc-linter-cache.json"
+
+// lintCache caches the check results of sequences (--cache-dir), so sequences
+// that have not changed are not checked again. A sequence's results depend on
+// its spec and the specs of the sequences it calls, so it's cached by a key that
+// hashes the files of all of them, the linter version, the policy, and the env.
+// Sequences in the same file share its hash, so changing one sequence re-checks
+// the others in the file, too.
+type lintCache struct {
+	file      string
+	base      []byte                   // hash of linter version, policy, and env
+	sequences map[string]cachedResults // keyed on sequence name
+	changed   bool
+}
+
+// cachedResults are the check results of a sequence with the key they're for.
+type cachedResults struct {
+	Key      string        `json:"key"`
+	Errors   []cachedError `json:"errors,omitempty"`
+	Warnings []cachedError `json:"warnings,omitempty"`
+}
+
+// cachedError is a check error or warning. Check is empty if it's not a
+// spec.CheckError, like errors from graph checks.
+type cachedError struct {
+	Check   string `json:"check,omitempty"`
+	Message string `json:"message"`
+}
+
+// loadCache loads the cache file in dir. A missing or invalid cache file is an
+// empty cache; only an invalid policy file is an error.
+func loadCache(dir, policyFile, env string) (*lintCache, error) {
+	base := sha1.New()
+	base.Write([]byte(v.Version()))
+	if policyFile != "" {
+		policy, err := ioutil.ReadFile(policyFile)
+		if err != nil {
+			return nil, err
+		}
+		base.Write(policy)
+	}
+	base.Write([]byte(env))
+
+	c := &lintCache{
+		file:      filepath.Join(dir, CACHE_FILE),
+		base:      base.Sum(nil),
+		sequences: map[string]cachedResults{},
+	}
+	if bytes, err := ioutil.ReadFile(c.file); err == nil {
+		json.Unmarshal(bytes, &c.sequences) // ignore error: re-check everything
+	}
+	return c, nil
+}
+
+// key returns the cache key of the sequence: a hash of the base hash and the
+// name and file hash of the sequence and every sequence it calls.
+func (c *lintCache) key(name string, allSpecs spec.Specs, parser *spec.DirParser) string {
+	deps := withCallees(allSpecs, []string{name})
+	names := make([]string, 0, len(deps.Sequences))
+	for dep := range deps.Sequences {
+		names = append(names, dep)
+	}
+	sort.Strings(names)
+	h := sha1.New()
+	h.Write(c.base)
+	for _, dep := range names {
+		h.Write([]byte(dep))
+		h.Write([]byte{0})
+		h.Write([]byte(parser.Hash(deps.Sequences[dep].Filename)))
+		h.Write([]byte{0})
+	}
+	// Calls to sequences that don't exist are errors, until they exist
+	for _, callee := range calls(allSpecs.Sequences[name]) {
+		if _, ok := allSpecs.Sequences[callee]; !ok {
+			h.Write([]byte("missing:" + callee))
+			h.Write([]byte{0})
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// get returns the cached results of the sequence if its key matches.
+func (c *lintCache) get(name, key string) (*spec.CheckResult, bool) {
+	cr, ok := c.sequences[name]
+	if !ok || cr.Key != key {
+		return nil, false
+	}
+	result := &spec.CheckResult{}
+	for _, e := range cr.Errors {
+		result.Errors = append(result.Errors, e.error())
+	}
+	for _, e := range cr.Warnings {
+		result.Warnings = append(result.Warnings, e.error())
+	}
+	return result, true
+}
+
+// put caches the results of the sequence, which can be nil if it has no errors
+// or warnings.
+func (c *lintCache) put(name, key string, result *spec.CheckResult) {
+	cr := cachedResults{Key: key}
+	if result != nil {
+		for _, err := range result.Errors {
+			cr.Errors = append(cr.Errors, cachedError{Check: spec.CheckName(err, ""), Message: err.Error()})
+		}
+		for _, err := range result.Warnings {
+			cr.Warnings = append(cr.Warnings, cachedError{Check: spec.CheckName(err, ""), Message: err.Error()})
+		}
+	}
+	c.sequences[name] = cr
+	c.changed = true
+}
+
+// save writes the cache file if the cache changed. The file is replaced, not
+// overwritten, so concurrent linters don't read a partial file.
+func (c *lintCache) save() error {
+	if !c.changed {
+		return nil
+	}
+	bytes, err := json.Marshal(c.sequences)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.file), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(c.file), CACHE_FILE+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after rename
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.file); err != nil {
+		return err
+	}
+	c.changed = false
+	return nil
+}
+
+func (e cachedError) error() error {
+	err := errors.New(e.Message)
+	if e.Check == "" {
+		return err
+	}
+	return spec.CheckError{Check: e.Check, Err: err}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020, Square, Inc.
+
+package linter
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// changedSequences returns the sequences affected by spec file changes since the
+// git ref (--changed-since), sorted: sequences in files that were added or
+// modified since the ref or are untracked, and sequences that call them directly
+// or indirectly. Sequences removed or renamed since the ref are not linted, but
+// sequences that call them are.
+func changedSequences(specsDir, ref string, allSpecs spec.Specs) ([]string, error) {
+	// Paths are relative to the specs dir because git runs in it
+	diff, err := git(specsDir, "diff", "--name-only", "--no-renames", "--relative", ref, "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	untracked, err := git(specsDir, "ls-files", "--others", "--exclude-standard", "--", ".")
+	if err != nil {
+		return nil, err
+	}
+	changed := map[string]bool{}
+	for _, file := range append(diff, untracked...) {
+		if strings.HasSuffix(strings.ToLower(file), ".yaml") {
+			changed[file] = true
+		}
+	}
+
+	// Sequences in changed files now, and in changed files at the ref, which
+	// includes sequences that were removed
+	affected := map[string]bool{}
+	for name, seq := range allSpecs.Sequences {
+		if changed[seq.Filename] {
+			affected[name] = true
+		}
+	}
+	for file := range changed {
+		names, err := sequencesAt(specsDir, ref, file)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			affected[name] = true
+		}
+	}
+
+	addCallers(allSpecs, affected)
+
+	seqs := make([]string, 0, len(affected))
+	for name := range affected {
+		if _, ok := allSpecs.Sequences[name]; ok {
+			seqs = append(seqs, name)
+		}
+	}
+	sort.Strings(seqs)
+	return seqs, nil
+}
+
+// sequencesAt returns the names of the sequences in the spec file at the git ref,
+// or nil if the file did not exist or cannot be parsed.
+func sequencesAt(specsDir, ref, file string) ([]string, error) {
+	// ref:./file is relative to the current dir, which is the specs dir
+	if err := exec.Command("git", "-C", specsDir, "cat-file", "-e", ref+":./"+file).Run(); err != nil {
+		return nil, nil // not at ref: added since
+	}
+	out, err := exec.Command("git", "-C", specsDir, "show", ref+":./"+file).Output()
+	if err != nil {
+		return nil, fmt.Errorf("git show %s:%s: %s", ref, file, err)
+	}
+	var old struct {
+		Sequences map[string]interface{} `yaml:"sequences"`
+	}
+	if err := yaml.Unmarshal(out, &old); err != nil {
+		return nil, nil // invalid at ref; nothing can call its sequences
+	}
+	names := make([]string, 0, len(old.Sequences))
+	for name := range old.Sequences {
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// git runs a git command in the specs dir and returns its output lines.
+func git(specsDir string, args ...string) ([]string, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", append([]string{"-C", specsDir}, args...)...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s: %s: %s", strings.Join(args, " "), err, strings.TrimSpace(stderr.String()))
+	}
+	lines := []string{}
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, nil
+}
+
+// addCallers adds the sequences that call the affected sequences, directly or
+// indirectly, to affected. Affected sequences don't have to exist, like
+// sequences that were removed.
+func addCallers(allSpecs spec.Specs, affected map[string]bool) {
+	callers := map[string][]string{} // sequence --> sequences that call it
+	for name, seq := range allSpecs.Sequences {
+		for _, callee := range calls(seq) {
+			callers[callee] = append(callers[callee], name)
+		}
+	}
+	queue := make([]string, 0, len(affected))
+	for name := range affected {
+		queue = append(queue, name)
+	}
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		for _, caller := range callers[name] {
+			if !affected[caller] {
+				affected[caller] = true
+				queue = append(queue, caller)
+			}
+		}
+	}
+}
+
+// calls returns the names of the sequences that the sequence calls: the type of
+// sequence nodes and every branch of conditional nodes, whether or not they exist.
+func calls(seq *spec.Sequence) []string {
+	names := []string{}
+	for _, node := range seq.Nodes {
+		if node == nil {
+			continue
+		}
+		if node.IsSequence() && node.NodeType != nil {
+			names = append(names, *node.NodeType)
+		} else if node.IsConditional() {
+			for _, name := range node.Eq {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// withCallees returns the specs of the named sequences and every sequence they
+// call, directly or indirectly, which checks of the named sequences need.
+func withCallees(allSpecs spec.Specs, names []string) spec.Specs {
+	subset := spec.Specs{
+		Sequences: map[string]*spec.Sequence{},
+		Version:   allSpecs.Version,
+	}
+	queue := append([]string{}, names...)
+	for len(queue) > 0 {
+		name := queue[0]
+		queue = queue[1:]
+		seq, ok := allSpecs.Sequences[name]
+		if !ok {
+			continue
+		}
+		if _, ok := subset.Sequences[name]; ok {
+			continue
+		}
+		subset.Sequences[name] = seq
+		queue = append(queue, calls(seq)...)
+	}
+	return subset
+}
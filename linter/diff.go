@@ -0,0 +1,106 @@
+// Copyright 2020, Square, Inc.
+
+package linter
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/id"
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// diff prints the sequence graph differences from the specs in the --diff dir
+// (old) to the specs in SpecsDir (new), for reviewing spec changes. It returns
+// false if either specs dir cannot be graphed.
+func (linter *Linter) diff(oldParser, newParser *spec.DirParser) bool {
+	color := aurora.NewAurora(linter.Color)
+
+	oldGraphs, err := buildGraphs(oldParser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Old specs %s: %s", linter.Diff, err)))
+		return false
+	}
+	newGraphs, err := buildGraphs(newParser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("New specs %s: %s", linter.SpecsDir, err)))
+		return false
+	}
+
+	diffs := graph.DiffSequences(oldGraphs, newGraphs)
+	if len(diffs) == 0 {
+		fmt.Println(color.Green("No sequence graph differences"))
+		return true
+	}
+
+	added, removed, changed := 0, 0, 0
+	for _, d := range diffs {
+		fmt.Println(splitter)
+		switch {
+		case d.Added:
+			added++
+			fmt.Println(color.Green(fmt.Sprintf("#  Seq: %s (added)", d.Sequence)))
+			continue
+		case d.Removed:
+			removed++
+			fmt.Println(color.Red(fmt.Sprintf("#  Seq: %s (removed)", d.Sequence)))
+			continue
+		}
+		changed++
+		fmt.Printf("#  Seq: %s\n", d.Sequence)
+		for _, node := range d.NodesAdded {
+			fmt.Println(color.Green(fmt.Sprintf("+ %s", node)))
+		}
+		for _, node := range d.NodesRemoved {
+			fmt.Println(color.Red(fmt.Sprintf("- %s", node)))
+		}
+		for _, nd := range d.NodesChanged {
+			fmt.Println(color.Yellow(fmt.Sprintf("~ %s: %s: %s -> %s", nd.Node, nd.Field, fmtDiffValue(nd.Old), fmtDiffValue(nd.New))))
+		}
+	}
+	fmt.Println(splitter)
+	fmt.Printf("%d sequences changed: %d added, %d removed, %d modified\n", len(diffs), added, removed, changed)
+	return true
+}
+
+// buildGraphs parses and checks all specs and returns their sequence graphs.
+// The specs must be valid: it returns an error if any check fails.
+func buildGraphs(parser *spec.DirParser) (map[string]*graph.Graph, error) {
+	allSpecs, fileResults, err := parser.Parse()
+	if err != nil {
+		return nil, err
+	}
+	if fileResults.AnyError {
+		return nil, fmt.Errorf("specs have parse errors, run the linter on them")
+	}
+	if len(allSpecs.Sequences) == 0 {
+		return nil, fmt.Errorf("no specs found")
+	}
+	spec.ProcessSpecs(&allSpecs)
+
+	checker, err := spec.NewChecker([]spec.CheckFactory{spec.DefaultCheckFactory{AllSpecs: allSpecs}, spec.BaseCheckFactory{AllSpecs: allSpecs}})
+	if err != nil {
+		return nil, err
+	}
+	if seqResults := checker.RunChecks(allSpecs); seqResults.AnyError {
+		return nil, fmt.Errorf("specs have errors, run the linter on them")
+	}
+
+	gr := graph.NewGrapher(allSpecs, id.NewGeneratorFactory(4, 100))
+	seqGraphs, seqResults := gr.CheckSequences()
+	if seqGraphs == nil || seqResults.AnyError {
+		return nil, fmt.Errorf("specs have graph errors, run the linter on them")
+	}
+	return seqGraphs, nil
+}
+
+// fmtDiffValue returns v, or "(none)" if it's empty, like a node without deps.
+func fmtDiffValue(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
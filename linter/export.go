@@ -0,0 +1,53 @@
+// Copyright 2020, Square, Inc.
+
+package linter
+
+import (
+	"fmt"
+	"os"
+	"sort"
+
+	"github.com/logrusorgru/aurora"
+
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// export prints the sequence graph of each sequence in --sequences, or every
+// sequence if none are given, sorted by name, in the --export format. Only the
+// graphs are printed to stdout, so the output can be piped to other tools. It
+// returns false if the specs cannot be graphed or a sequence is not found.
+func (linter *Linter) export(parser *spec.DirParser) bool {
+	color := aurora.NewAurora(linter.Color)
+
+	seqGraphs, err := buildGraphs(parser)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Specs %s: %s", linter.SpecsDir, err)))
+		return false
+	}
+
+	sequences := splitList(linter.Sequences)
+	if len(sequences) == 0 {
+		for name := range seqGraphs {
+			sequences = append(sequences, name)
+		}
+		sort.Strings(sequences)
+	}
+	for _, name := range sequences {
+		g, ok := seqGraphs[name]
+		if !ok {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Sequence %s not found in specs", name)))
+			return false
+		}
+		bytes, err := graph.Export(graph.TemplateDAG(g), linter.Export)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Red(err))
+			return false
+		}
+		if linter.Export == graph.EXPORT_FORMAT_ARGO {
+			fmt.Println("---") // one YAML document per sequence
+		}
+		fmt.Println(string(bytes))
+	}
+	return true
+}
@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/alexflint/go-arg"
 	"github.com/logrusorgru/aurora"
@@ -21,37 +24,164 @@ import (
 type Linter struct {
 	SpecsDir string `arg:"positional" help:"path to spin cycle requests directory [default: current working dir]"`
 
-	Strict   bool `arg:"-s, --strict" help:"make all warnings into errors [default: false]"`
-	Warnings bool `help:"turn warnings on or off"`
-	Color    bool `help:"turn color on or off"`
+	Strict      bool `arg:"-s, --strict" help:"fail on any warning, like --max-warnings 0 [default: false]"`
+	MaxWarnings int  `arg:"--max-warnings" help:"fail with exit code 2 if there are more than this many warnings; -1 is no limit"`
+	Warnings    bool `help:"turn warnings on or off (suppressed warnings are still counted)"`
+	Color       bool `help:"turn color on or off"`
 
 	Sequences string `help:"comma-separated list of sequences for which to output info; sequence must exist in specs [default: all]"`
 
+	Include string `help:"comma-separated list of glob patterns; only spec files (relative path or file name) matching one are linted [default: all]"`
+	Exclude string `help:"comma-separated list of glob patterns; spec files and directories matching one are skipped"`
+
+	Env string `help:"environment name; apply node env overrides for it before checking, like the Request Manager with specs.env (all overrides are validated either way)"`
+
+	Policy string `help:"YAML file of organization policy that specs must meet: max retry and retryWait, required job args, banned job types, required ACLs, custom rules"`
+
+	CheckPlugins string `arg:"--check-plugins" help:"directory of Go plugins (*.so files) with custom spec checks to run alongside built-in checks"`
+
+	Watch         bool          `arg:"-w, --watch" help:"re-lint when spec files change, re-parsing only changed files and re-checking only sequences they affect [default: false]"`
+	WatchInterval time.Duration `help:"how often to check for changes in watch mode"`
+
+	Diff string `help:"path to old specs directory; instead of linting, print sequence graph differences from old specs to new specs (SpecsDir): nodes added and removed, and type, deps, and retry changes"`
+
+	Export string `help:"format in which to print the sequence graph of each sequence in --sequences instead of linting: argo (Argo Workflows YAML) or dag (DAG JSON)"`
+
+	Parallel     int    `arg:"-j, --parallel" help:"number of spec files parsed concurrently"`
+	CacheDir     string `arg:"--cache-dir" help:"directory in which to cache check results by sequence; sequences whose spec files and subsequence spec files have not changed are not checked again (not used with --check-plugins)"`
+	ChangedSince string `arg:"--changed-since" help:"git ref, like origin/master; lint only sequences in spec files changed since the ref (including uncommitted and untracked files) and sequences that call them"`
+
 	errorStr   string `arg:"-"`
 	warningStr string `arg:"-"`
 	count      int    `arg:"-"` // warning + error counter
 	anyWarning bool   `arg:"-"` // whether any warnings we would output with --warnings=true occurred
+
+	checkCounts map[string]*checkCount `arg:"-"` // errors and warnings by check name, for the summary
+
+	policy  *spec.Policy       `arg:"-"` // loaded from Policy file, if any
+	plugins []spec.CheckPlugin `arg:"-"` // loaded from CheckPlugins dir, if any
+	cache   *lintCache         `arg:"-"` // loaded from CacheDir, if any
+	watch   *watchState        `arg:"-"` // results of the last lint in watch mode
+	checked []string           `arg:"-"` // sequences checked by the last lint, not from cache or watch state
 }
 
 var splitter = "# ------------------------------------------------------------------------------"
 
+// Exit codes returned by Run. Errors take precedence over warnings, so CI can
+// fail on errors and gate warnings separately with --max-warnings.
+const (
+	EXIT_OK       = 0 // no errors, and warnings are within --max-warnings
+	EXIT_ERRORS   = 1 // spec errors, or the linter could not run
+	EXIT_WARNINGS = 2 // no errors, but more warnings than --max-warnings (or any with --strict)
+)
+
+// checkCount is the number of errors and warnings from one check.
+type checkCount struct {
+	errors   int
+	warnings int
+}
+
 func (linter *Linter) Version() string {
 	return "linter " + v.Version()
 }
 
-func Run() bool {
+// Run runs the linter and returns an EXIT_ code.
+func Run() int {
 	// 1. Setup
 	linter := Linter{
-		Strict:   false,
-		Warnings: true,
-		Color:    true,
-		SpecsDir: "./",
-
-		count:      1,
-		anyWarning: false,
+		Strict:        false,
+		MaxWarnings:   -1,
+		Warnings:      true,
+		Color:         true,
+		SpecsDir:      "./",
+		WatchInterval: 500 * time.Millisecond,
+		Parallel:      runtime.NumCPU(),
 	}
 	arg.MustParse(&linter)
 
+	color := aurora.NewAurora(linter.Color)
+	linter.errorStr = fmt.Sprintf("%s", color.Red("Errors"))
+	linter.warningStr = fmt.Sprintf("%s", color.Yellow("Warnings"))
+
+	if linter.Policy != "" {
+		policy, err := spec.LoadPolicy(linter.Policy)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Invalid policy file: %s", err)))
+			return EXIT_ERRORS
+		}
+		linter.policy = &policy
+	}
+	if linter.CheckPlugins != "" {
+		plugins, err := spec.LoadCheckPlugins(linter.CheckPlugins)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Invalid check plugin: %s", err)))
+			return EXIT_ERRORS
+		}
+		linter.plugins = plugins
+	}
+
+	// Check plugins can check anything, so their results can't be cached
+	if linter.CacheDir != "" && len(linter.plugins) == 0 {
+		cache, err := loadCache(linter.CacheDir, linter.Policy, linter.Env)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Cannot load cache: %s", err)))
+			return EXIT_ERRORS
+		}
+		linter.cache = cache
+	}
+
+	parser := spec.NewDirParser(linter.SpecsDir, splitList(linter.Include), splitList(linter.Exclude))
+	parser.Parallel(linter.Parallel)
+	if linter.Diff != "" {
+		if !linter.diff(spec.NewDirParser(linter.Diff, splitList(linter.Include), splitList(linter.Exclude)), parser) {
+			return EXIT_ERRORS
+		}
+		return EXIT_OK
+	}
+	if linter.Export != "" {
+		if !linter.export(parser) {
+			return EXIT_ERRORS
+		}
+		return EXIT_OK
+	}
+	if !linter.Watch {
+		return linter.lint(parser)
+	}
+
+	// Watch mode: lint, then re-lint every time a spec file changes. The parser
+	// caches parsed files, so only changed files are re-parsed, and only the
+	// sequences they affect are checked again (see watchState), unless there are
+	// check plugins, which can check anything. This runs until the linter is
+	// killed.
+	if len(linter.plugins) == 0 {
+		linter.watch = newWatchState()
+	}
+	for {
+		start := time.Now()
+		linter.lint(parser)
+		fmt.Printf("%s\n", color.Faint(fmt.Sprintf("Linted in %s. Watching %s for changes...", time.Now().Sub(start).Round(time.Millisecond), linter.SpecsDir)))
+		for {
+			time.Sleep(linter.WatchInterval)
+			changed, err := parser.Changed()
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s\n", err)
+				continue
+			}
+			if changed {
+				break
+			}
+		}
+	}
+}
+
+// lint parses and checks all specs, printing any errors and warnings, and a
+// summary of them by check. It returns an EXIT_ code.
+func (linter *Linter) lint(parser *spec.DirParser) int {
+	linter.count = 1 // warning + error counter
+	linter.checked = nil
+	linter.anyWarning = false
+	linter.checkCounts = map[string]*checkCount{}
+
 	var sequences []string
 	if len(linter.Sequences) != 0 {
 		sequences = strings.Split(linter.Sequences, ",")
@@ -60,21 +190,23 @@ func Run() bool {
 	// yet, so we can't fill out `sequences` properly yet
 
 	color := aurora.NewAurora(linter.Color)
-	linter.errorStr = fmt.Sprintf("%s", color.Red("Errors"))
-	linter.warningStr = fmt.Sprintf("%s", color.Yellow("Warnings"))
 
 	// 2. Parsing and static parse checks
-	allSpecs, fileResults, err := spec.ParseSpecsDir(linter.SpecsDir)
+	allSpecs, fileResults, err := parser.Parse()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s", err)
-		return false
+		return EXIT_ERRORS
+	}
+	for _, result := range fileResults.Results {
+		linter.countResult(result, "parse")
 	}
 	if fileResults.AnyError {
-		for file, result := range fileResults.Results {
+		for _, file := range fileResults.Keys() {
 			header := splitter + "\n" + fmt.Sprintf("# File: %s\n", file)
-			linter.printCheckResult(header, result)
+			linter.printCheckResult(header, fileResults.Results[file])
 		}
-		return false
+		linter.printSummary()
+		return EXIT_ERRORS
 	}
 	// Check that we did indeed read some specs.
 	if len(allSpecs.Sequences) == 0 {
@@ -83,7 +215,7 @@ func Run() bool {
 			errMsg += " (" + absPath + ")"
 		}
 		fmt.Fprintf(os.Stderr, "%s\n", color.Red(errMsg))
-		return false
+		return EXIT_ERRORS
 	}
 	// Check that all sequences provided by --sequences arg are actually in
 	// the specs.
@@ -94,7 +226,7 @@ func Run() bool {
 		}
 		if len(missing) > 0 {
 			fmt.Fprintf(os.Stderr, "Args to --sequences not found in specs: %s\n", strings.Join(missing, ", "))
-			return false
+			return EXIT_ERRORS
 		}
 	}
 	// If no --sequences were specified, then we'll output all sequences. Update
@@ -114,8 +246,8 @@ func Run() bool {
 		if linter.Warnings {
 			warnings := []error{}
 			// There should only be one warning per file right now
-			for file, result := range fileResults.Results {
-				for _, warn := range result.Warnings {
+			for _, file := range fileResults.Keys() {
+				for _, warn := range fileResults.Results[file].Warnings {
 					warnings = append(warnings, fmt.Errorf("%s: %s", file, warn))
 				}
 			}
@@ -124,17 +256,70 @@ func Run() bool {
 			fmt.Print(linter.fmtList("# Syntax warnings\n", warnings))
 		}
 	}
+	spec.ApplyEnv(allSpecs, linter.Env)
 	spec.ProcessSpecs(&allSpecs)
 
+	// Sequences to check: all, or only those affected by changes since the
+	// --changed-since ref, less those with results from the last lint in watch
+	// mode or cached results. Checks of a sequence
+	// need the sequences it calls, so checkSpecs has them, too, but only the
+	// results of the sequences to check are used.
+	lintSeqs := make([]string, 0, len(allSpecs.Sequences))
+	for seq := range allSpecs.Sequences {
+		lintSeqs = append(lintSeqs, seq)
+	}
+	if linter.ChangedSince != "" {
+		lintSeqs, err = changedSequences(linter.SpecsDir, linter.ChangedSince, allSpecs)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Red(fmt.Sprintf("Cannot get changes since %s: %s", linter.ChangedSince, err)))
+			return EXIT_ERRORS
+		}
+		sequences = intersect(sequences, lintSeqs)
+		fmt.Printf("%s\n", color.Faint(fmt.Sprintf("Linting %d sequences changed since %s and sequences that call them", len(lintSeqs), linter.ChangedSince)))
+		if len(lintSeqs) == 0 {
+			fmt.Println(color.Green("OK, no sequences changed"))
+			return EXIT_OK
+		}
+	}
+	cachedResults := spec.NewCheckResults()
+	cacheKeys := map[string]string{}
+	toCheck := lintSeqs
+	if linter.watch != nil {
+		toCheck = linter.watch.toCheck(lintSeqs, allSpecs, parser, cachedResults)
+	}
+	if linter.cache != nil {
+		uncached := toCheck
+		toCheck = []string{}
+		for _, seq := range uncached {
+			key := linter.cache.key(seq, allSpecs, parser)
+			if result, ok := linter.cache.get(seq, key); ok {
+				cachedResults.AddResult(seq, result)
+				continue
+			}
+			cacheKeys[seq] = key
+			toCheck = append(toCheck, seq)
+		}
+	}
+	checkSpecs := withCallees(allSpecs, toCheck)
+	linter.checked = toCheck
+
 	// 3. Static checks
 	checkFactories := []spec.CheckFactory{spec.DefaultCheckFactory{allSpecs}, spec.BaseCheckFactory{allSpecs}}
+	if linter.policy != nil {
+		checkFactories = append(checkFactories, spec.PolicyCheckFactory{Policy: *linter.policy, AllSpecs: allSpecs})
+	}
+	for _, p := range linter.plugins {
+		checkFactories = append(checkFactories, p.Factory(allSpecs))
+	}
 	checker, err := spec.NewChecker(checkFactories)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "%s", err)
-		return false
+		return EXIT_ERRORS
 	}
-	seqResults := checker.RunChecks(allSpecs)
+	seqResults := only(checker.RunChecks(checkSpecs), toCheck)
 	if seqResults.AnyError {
+		seqResults.Union(cachedResults)
+		linter.countResults(seqResults, sequences)
 		errorPrinted := false // whether we printed anything
 		for _, seq := range sequences {
 			header, err := fmtHeader(seq, allSpecs)
@@ -146,15 +331,29 @@ func Run() bool {
 		if !errorPrinted {
 			fmt.Printf("%s\n", color.Red("Sequence not listed in --sequences failed static check; fix errors to perform graph checks"))
 		}
-		return false
+		linter.printSummary()
+		return EXIT_ERRORS
 	}
 	// We'll print warnings later along with graph errors, if any.
 
 	// 4. Graph checks
 	idgen := id.NewGeneratorFactory(4, 100)
-	gr := graph.NewGrapher(allSpecs, idgen)
+	gr := graph.NewGrapher(checkSpecs, idgen)
 	_, graphResults := gr.CheckSequences()
-	seqResults.Union(graphResults)
+	seqResults.Union(only(graphResults, toCheck))
+	if linter.cache != nil {
+		for _, seq := range toCheck {
+			linter.cache.put(seq, cacheKeys[seq], seqResults.Results[seq])
+		}
+		if err := linter.cache.save(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", color.Yellow(fmt.Sprintf("Cannot save cache: %s", err)))
+		}
+	}
+	seqResults.Union(cachedResults)
+	if linter.watch != nil {
+		linter.watch.save(seqResults, lintSeqs)
+	}
+	linter.countResults(seqResults, sequences)
 	if seqResults.AnyError {
 		errorPrinted := false // whether we printed anything
 		for _, seq := range sequences {
@@ -165,7 +364,8 @@ func Run() bool {
 			errorPrinted = linter.printCheckResult(header, seqResults.Results[seq]) || errorPrinted
 		}
 		if errorPrinted {
-			return false
+			linter.printSummary()
+			return EXIT_ERRORS
 		}
 	}
 
@@ -189,11 +389,115 @@ func Run() bool {
 		// Case: no warnings and no errors
 		fmt.Println(color.Green("OK, all specs are valid"))
 	} // else Case: some warnings printed, no errors
+	linter.printSummary()
 
+	maxWarnings := linter.MaxWarnings
 	if linter.Strict {
-		return !linter.anyWarning
+		maxWarnings = 0
 	}
-	return true
+	if warnings := linter.warnings(); maxWarnings >= 0 && warnings > maxWarnings {
+		fmt.Println(color.Red(fmt.Sprintf("%d warnings, max %d", warnings, maxWarnings)))
+		return EXIT_WARNINGS
+	}
+	return EXIT_OK
+}
+
+// countResult counts the errors and warnings in result by check name. Errors
+// that are not from a check (parsing and graph checks) are counted as def.
+func (linter *Linter) countResult(result *spec.CheckResult, def string) {
+	if result == nil {
+		return
+	}
+	count := func(name string) *checkCount {
+		c, ok := linter.checkCounts[name]
+		if !ok {
+			c = &checkCount{}
+			linter.checkCounts[name] = c
+		}
+		return c
+	}
+	for _, err := range result.Errors {
+		count(spec.CheckName(err, def)).errors++
+	}
+	for _, err := range result.Warnings {
+		count(spec.CheckName(err, def)).warnings++
+	}
+}
+
+// countResults counts the errors and warnings of the given sequences. Errors
+// that are not from a check are from graph checks.
+func (linter *Linter) countResults(results *spec.CheckResults, sequences []string) {
+	for _, seq := range sequences {
+		linter.countResult(results.Results[seq], "graph")
+	}
+}
+
+// warnings returns the total number of warnings counted.
+func (linter *Linter) warnings() int {
+	n := 0
+	for _, c := range linter.checkCounts {
+		n += c.warnings
+	}
+	return n
+}
+
+// printSummary prints the number of errors and warnings by check, sorted by
+// check name, if there are any.
+func (linter *Linter) printSummary() {
+	if len(linter.checkCounts) == 0 {
+		return
+	}
+	names := make([]string, 0, len(linter.checkCounts))
+	errors := 0
+	for name, c := range linter.checkCounts {
+		names = append(names, name)
+		errors += c.errors
+	}
+	sort.Strings(names)
+	fmt.Println(splitter)
+	fmt.Printf("# Summary: %d errors, %d warnings\n", errors, linter.warnings())
+	fmt.Printf("%8s %8s  %s\n", "ERRORS", "WARNINGS", "CHECK")
+	for _, name := range names {
+		c := linter.checkCounts[name]
+		fmt.Printf("%8d %8d  %s\n", c.errors, c.warnings, name)
+	}
+}
+
+// only returns the results of the given sequences.
+func only(results *spec.CheckResults, sequences []string) *spec.CheckResults {
+	filtered := spec.NewCheckResults()
+	for _, seq := range sequences {
+		if result, ok := results.Get(seq); ok {
+			filtered.AddResult(seq, result)
+		}
+	}
+	return filtered
+}
+
+// intersect returns the values in a that are also in b, in the order of a.
+func intersect(a, b []string) []string {
+	in := map[string]bool{}
+	for _, v := range b {
+		in[v] = true
+	}
+	values := []string{}
+	for _, v := range a {
+		if in[v] {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// splitList splits a comma-separated list, ignoring empty values.
+func splitList(list string) []string {
+	values := []string{}
+	for _, val := range strings.Split(list, ",") {
+		if val = strings.TrimSpace(val); val != "" {
+			values = append(values, val)
+		}
+	}
+	return values
 }
 
 func fmtHeader(seqName string, allSpecs spec.Specs) (string, error) {
@@ -0,0 +1,101 @@
+// Copyright 2020, Square, Inc.
+
+package linter
+
+import (
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// watchState is the state of watch mode (--watch) between lints, so a lint after
+// spec files change checks only the sequences the changes affect: sequences that
+// the changed files define or defined before the change, and sequences that
+// call them, directly or indirectly. The results of other sequences are reused.
+// Like the lint cache, this relies on the results of a sequence depending only
+// on its spec and the specs of the sequences it calls.
+type watchState struct {
+	hashes  map[string]string            // spec file --> hash when last linted
+	defined map[string][]string          // spec file --> sequences it defined when last linted
+	results map[string]*spec.CheckResult // sequence --> results when last checked, nil if none
+	dirty   map[string]bool              // sequences to check even if their files don't change
+}
+
+func newWatchState() *watchState {
+	return &watchState{
+		hashes:  map[string]string{},
+		defined: map[string][]string{},
+		results: map[string]*spec.CheckResult{},
+		dirty:   map[string]bool{},
+	}
+}
+
+// toCheck returns the sequences in lintSeqs that must be checked, in the same
+// order, and adds the last results of the others to cached. Sequences to check
+// stay dirty until save is called with their results, so if a lint stops before
+// graph checks, like on static check errors, they're checked again next time.
+func (w *watchState) toCheck(lintSeqs []string, allSpecs spec.Specs, parser *spec.DirParser, cached *spec.CheckResults) []string {
+	hashes := map[string]string{}
+	defined := map[string][]string{}
+	for name, seq := range allSpecs.Sequences {
+		if _, ok := hashes[seq.Filename]; !ok {
+			hashes[seq.Filename] = parser.Hash(seq.Filename)
+		}
+		defined[seq.Filename] = append(defined[seq.Filename], name)
+	}
+
+	// Sequences in files that were added or changed, and in files that were
+	// changed or removed, which includes sequences that were removed
+	affected := map[string]bool{}
+	for file, hash := range hashes {
+		if w.hashes[file] != hash {
+			for _, name := range defined[file] {
+				affected[name] = true
+			}
+		}
+	}
+	for file, names := range w.defined {
+		if hashes[file] != w.hashes[file] {
+			for _, name := range names {
+				affected[name] = true
+			}
+		}
+	}
+	addCallers(allSpecs, affected)
+	w.hashes = hashes
+	w.defined = defined
+
+	for name := range w.results {
+		if _, ok := allSpecs.Sequences[name]; !ok {
+			delete(w.results, name)
+			delete(w.dirty, name)
+		}
+	}
+
+	seqs := []string{}
+	for _, name := range lintSeqs {
+		result, ok := w.results[name]
+		if ok && !affected[name] && !w.dirty[name] {
+			if result != nil {
+				cached.AddResult(name, result)
+			}
+			continue
+		}
+		w.dirty[name] = true
+		seqs = append(seqs, name)
+	}
+	return seqs
+}
+
+// save saves the results of the sequences after all checks.
+func (w *watchState) save(results *spec.CheckResults, seqs []string) {
+	for _, name := range seqs {
+		var saved *spec.CheckResult
+		if result, ok := results.Get(name); ok {
+			saved = &spec.CheckResult{
+				Errors:   append([]error{}, result.Errors...),
+				Warnings: append([]error{}, result.Warnings...),
+			}
+		}
+		w.results[name] = saved
+		delete(w.dirty, name)
+	}
+}
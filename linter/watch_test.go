@@ -0,0 +1,130 @@
+// Copyright 2020, Square, Inc.
+
+package linter
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+const watchCallerSpec = `---
+sequences:
+  restart-db:
+    request: true
+    args:
+      required:
+        - name: host
+    nodes:
+      stop:
+        category: sequence
+        type: %s
+        args:
+          - expected: host
+            given: host
+        deps: []
+`
+
+const watchCalleeSpec = `---
+sequences:
+  %s:
+    args:
+      required:
+        - name: host
+    nodes:
+      stop-mysqld:
+        category: job
+        type: mysql/stop
+        args:
+          - expected: host
+            given: host
+        deps: []
+        retry: %d
+`
+
+const watchOtherSpec = `---
+sequences:
+  check-db:
+    request: true
+    args:
+      required:
+        - name: host
+    nodes:
+      check:
+        category: job
+        type: mysql/check
+        args:
+          - expected: host
+            given: host
+        deps: []
+        retry: %d
+`
+
+func writeSpec(t *testing.T, dir, file, format string, args ...interface{}) {
+	t.Helper()
+	if err := ioutil.WriteFile(filepath.Join(dir, file), []byte(fmt.Sprintf(format, args...)), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchChecksAffectedSequences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "linter-watch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// restart-db (restart.yaml) calls stop-db (stop.yaml); check-db (check.yaml)
+	// is independent
+	writeSpec(t, dir, "restart.yaml", watchCallerSpec, "stop-db")
+	writeSpec(t, dir, "stop.yaml", watchCalleeSpec, "stop-db", 1)
+	writeSpec(t, dir, "check.yaml", watchOtherSpec, 1)
+
+	linter := &Linter{
+		SpecsDir:    dir,
+		MaxWarnings: -1,
+		watch:       newWatchState(),
+	}
+	parser := spec.NewDirParser(dir, nil, nil)
+	lint := func(expectExit int, expectChecked []string) {
+		t.Helper()
+		if exit := linter.lint(parser); exit != expectExit {
+			t.Errorf("exit %d, expected %d", exit, expectExit)
+		}
+		checked := append([]string{}, linter.checked...)
+		sort.Strings(checked)
+		if diff := deep.Equal(checked, expectChecked); diff != nil {
+			t.Errorf("checked %v, expected %v", checked, expectChecked)
+		}
+	}
+
+	// Everything is checked the first time, then nothing if nothing changed
+	lint(EXIT_OK, []string{"check-db", "restart-db", "stop-db"})
+	lint(EXIT_OK, []string{})
+
+	// Sequences in a changed file
+	writeSpec(t, dir, "check.yaml", watchOtherSpec, 10)
+	lint(EXIT_OK, []string{"check-db"})
+
+	// Sequences in a changed file and their callers
+	writeSpec(t, dir, "stop.yaml", watchCalleeSpec, "stop-db", 10)
+	lint(EXIT_OK, []string{"restart-db", "stop-db"})
+
+	// Callers of a renamed sequence, which fail static checks, so both are
+	// checked again next time
+	writeSpec(t, dir, "stop.yaml", watchCalleeSpec, "stop-mysql", 10)
+	lint(EXIT_ERRORS, []string{"restart-db", "stop-mysql"})
+	writeSpec(t, dir, "restart.yaml", watchCallerSpec, "stop-mysql")
+	lint(EXIT_OK, []string{"restart-db", "stop-mysql"})
+
+	writeSpec(t, dir, "check.yaml", watchOtherSpec, 100)
+	lint(EXIT_OK, []string{"check-db"})
+	lint(EXIT_OK, []string{})
+}
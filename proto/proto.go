@@ -6,9 +6,11 @@ package proto
 import (
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+	"unicode/utf8"
 )
 
 // DO NOT change the state values. The raw byte values is stored in tables,
@@ -29,6 +31,14 @@ const (
 	// A request or chain can be suspended and then resumed at a later time.
 	// Jobs aren't suspended - they're stopped when a chain is suspended.
 	STATE_SUSPENDED byte = 7
+
+	// A request or chain did not complete before its deadline. Jobs are not
+	// started after the deadline; they're left in this state.
+	STATE_DEADLINE_EXCEEDED byte = 8
+
+	// A suspended request could not be resumed after the max number of attempts
+	// (the Request Manager resume.max_attempts config). Request.ResumeError says why.
+	STATE_FAILED_RESUME byte = 9
 )
 
 var StateName = map[byte]string{
@@ -40,6 +50,9 @@ var StateName = map[byte]string{
 	STATE_RESERVED:  "RESERVED",
 	STATE_STOPPED:   "STOPPED",
 	STATE_SUSPENDED: "SUSPENDED",
+
+	STATE_DEADLINE_EXCEEDED: "DEADLINE_EXCEEDED",
+	STATE_FAILED_RESUME:     "FAILED_RESUME",
 }
 
 var StateValue = map[string]byte{
@@ -51,11 +64,15 @@ var StateValue = map[string]byte{
 	"RESERVED":  STATE_RESERVED,
 	"STOPPED":   STATE_STOPPED,
 	"SUSPENDED": STATE_SUSPENDED,
+
+	"DEADLINE_EXCEEDED": STATE_DEADLINE_EXCEEDED,
+	"FAILED_RESUME":     STATE_FAILED_RESUME,
 }
 
 const (
-	REQUEST_OP_START = "start"
-	REQUEST_OP_STOP  = "stop"
+	REQUEST_OP_START   = "start"
+	REQUEST_OP_STOP    = "stop"
+	REQUEST_OP_APPROVE = "approve" // start request that costs more than its budget approval threshold
 )
 
 // Job represents one job in a job chain. Jobs are identified by Id, which
@@ -73,16 +90,47 @@ type Job struct {
 	SequenceId        string                 `json:"sequenceId"`                  // Job.Id of first job in sequence
 	SequenceRetry     uint                   `json:"sequenceRetry"`               // retry sequence N times if first run fails. Only set for first job in sequence.
 	SequenceRetryWait string                 `json:"sequenceRetryWait,omitempty"` // wait between sequence tries (duration string: "N{ms|s|m|h}", default: 0s)
+	Cost              uint                   `json:"cost,omitempty"`              // abstract cost/impact score (spec node cost)
+	RunAfterFail      bool                   `json:"runAfterFail,omitempty"`      // runnable when previous jobs are done, even if failed (sequential each: with continueOnFail)
+	Skippable         bool                   `json:"skippable,omitempty"`         // operators can skip the job with resume points (spec node skippable)
+	SkipData          map[string]interface{} `json:"skipData,omitempty"`          // job data of the next jobs if the job is skipped (spec node sets default)
 }
 
 // JobChain represents a directed acyclic graph of jobs for one request.
 // Job chains are identified by RequestId, which must be globally unique.
 type JobChain struct {
-	RequestId     string              `json:"requestId"`     // unique identifier for the chain
-	Jobs          map[string]Job      `json:"jobs"`          // Job.Id => job
-	AdjacencyList map[string][]string `json:"adjacencyList"` // Job.Id => next []Job.Id
-	State         byte                `json:"state"`         // STATE_* const
-	FinishedJobs  uint                `json:"finishedJobs"`  // number of jobs that ran and finished with state = STATE_COMPLETE
+	RequestId     string              `json:"requestId"`             // unique identifier for the chain
+	RequestType   string              `json:"requestType,omitempty"` // type of request the chain was built for
+	Jobs          map[string]Job      `json:"jobs"`                  // Job.Id => job
+	AdjacencyList map[string][]string `json:"adjacencyList"`         // Job.Id => next []Job.Id
+	State         byte                `json:"state"`                 // STATE_* const
+	FinishedJobs  uint                `json:"finishedJobs"`          // number of jobs that ran and finished with state = STATE_COMPLETE
+	Annotations   map[string]string   `json:"annotations,omitempty"` // user-defined, set by request.ResolverPlugin
+	Deadline      *time.Time          `json:"deadline,omitempty"`    // jobs are not started after this time (CreateRequest.Deadline)
+
+	CorrelationId string `json:"correlationId,omitempty"` // CreateRequest.CorrelationId, logged by the Job Runner
+	StopTimeout   string `json:"stopTimeout,omitempty"`   // request spec stopTimeout, overrides Job Runner traverser.stop_timeout
+
+	// FenceToken is issued by the Request Manager each time it sends the chain
+	// to a Job Runner: 1 when the request is started, then incremented each time
+	// it's resumed. The Job Runner sends it with job logs, the final state, and
+	// the suspended job chain, and the Request Manager rejects them if a newer
+	// token was issued (serr.ErrFenced), so a Job Runner that lost the chain
+	// cannot change a request that's running on another Job Runner. Zero (chains
+	// sent before fencing tokens) is never rejected.
+	FenceToken uint64 `json:"fenceToken,omitempty"`
+
+	// RetryBudget is the request spec retryBudget, if any: the max total job and
+	// sequence retries in the chain, after which the Job Runner does not retry
+	// failed jobs or sequences.
+	RetryBudget *RetryBudget `json:"retryBudget,omitempty"`
+}
+
+// RetryBudget is the max total number of job retries and sequence retries in a
+// job chain. Zero is no max.
+type RetryBudget struct {
+	JobRetries      uint `json:"jobRetries,omitempty"`
+	SequenceRetries uint `json:"sequenceRetries,omitempty"`
 }
 
 // Request represents something that a user asks Spin Cycle to do.
@@ -91,8 +139,11 @@ type Request struct {
 	Type  string       `json:"type"`           // the type of request
 	State byte         `json:"state"`          // STATE_* const
 	User  string       `json:"user"`           // the user who made the request
+	Team  string       `json:"team,omitempty"` // the team of the user who made the request
 	Args  []RequestArg `json:"args,omitempty"` // final request args (request_archives.args)
 
+	Namespace string `json:"namespace,omitempty"` // namespace of the request type, if any
+
 	CreatedAt  time.Time  `json:"createdAt"`  // when the request was created
 	StartedAt  *time.Time `json:"startedAt"`  // when the request was sent to the job runner
 	FinishedAt *time.Time `json:"finishedAt"` // when the job runner finished the request. doesn't indicate success/failure
@@ -101,7 +152,34 @@ type Request struct {
 	TotalJobs    uint      `json:"totalJobs"`    // number of jobs in the request's job chain
 	FinishedJobs uint      `json:"finishedJobs"` // number of jobs that ran and finished with state = STATE_COMPLETE
 
-	JobRunnerURL string `json:"jrURL,omitempty"` // URL of the job runner running the request
+	JobRunnerURL string `json:"jrURL,omitempty"`       // URL of the job runner running the request
+	SpecVersion  string `json:"specVersion,omitempty"` // version of the specs used to build the job chain
+
+	RetryOf    string `json:"retryOf,omitempty"`    // id of the failed request that this request retries (auto-retry or RetryRequest)
+	RetryCount uint   `json:"retryCount,omitempty"` // number of auto-retries, 0 if not an auto-retry
+
+	ArgOverrides []ArgOverride `json:"argOverrides,omitempty"` // args changed by RetryRequest (request_archives.arg_overrides)
+
+	Cost uint `json:"cost"` // sum of job costs (JobChain.Jobs[].Cost)
+
+	Deadline *time.Time `json:"deadline,omitempty"` // when the request must finish by (CreateRequest.Deadline)
+
+	Warnings []string `json:"warnings,omitempty"` // non-fatal warnings from building the job chain (request_archives.warnings)
+
+	ResumeError string `json:"resumeError,omitempty"` // last resume error if State = STATE_FAILED_RESUME
+
+	CorrelationId string            `json:"correlationId,omitempty"` // CreateRequest.CorrelationId
+	Origin        map[string]string `json:"origin,omitempty"`        // CreateRequest.Origin (request_archives.origin)
+
+	GroupId string `json:"groupId,omitempty"` // request group, if created in one (RequestGroup.Id)
+
+	// A request type with a partitions spec is split into partition requests when
+	// it's started: each runs independent parts of the job chain on its own Job
+	// Runner. Partitions is set on the request that was split, which is running
+	// until all its partition requests are finished. PartitionOf is set on each
+	// partition request.
+	Partitions  uint   `json:"partitions,omitempty"`  // number of partition requests, 0 if not partitioned
+	PartitionOf string `json:"partitionOf,omitempty"` // id of the request that this partition request is part of
 }
 
 // SuspendedJobChain (SJC) represents the data required to reconstruct and resume a
@@ -123,23 +201,67 @@ type SuspendedJobChain struct {
 	// The number of times a sequence has been tried, keyed on the
 	// id of the first job in the sequence.
 	SequenceTries map[string]uint `json:"sequenceTries"`
+
+	// The job chain scratch store (job.Scratch) shared by all jobs in the chain.
+	Scratch map[string][]byte `json:"scratch,omitempty"`
+
+	// The Job Runner to resume the chain on, like a standby Job Runner taking
+	// over a request from a failed Job Runner. If empty, the Request Manager
+	// resumes it on any Job Runner (config.RequestManager.JRClient.ServerURL).
+	JobRunnerURL string `json:"jobRunnerURL,omitempty"`
+
+	// The number of job retries and sequence retries used so far, counted
+	// against JobChain.RetryBudget. They're counted even if there is no budget.
+	JobRetries      uint `json:"jobRetries,omitempty"`
+	SequenceRetries uint `json:"sequenceRetries,omitempty"`
 }
 
 // RequestSpec represents the metadata of a request necessary to start the request.
 type RequestSpec struct {
-	Name string
-	Args []RequestArg
+	Name        string
+	Args        []RequestArg
+	Deprecated  string `json:",omitempty"` // deprecation message if request is deprecated
+	Sunset      string `json:",omitempty"` // date (YYYY-MM-DD) from which new requests are rejected, if deprecated
+	Namespace   string `json:",omitempty"` // namespace of the request, if any
+	Description string `json:",omitempty"` // what the request does (spec description)
+	DocsURL     string `json:",omitempty"` // URL of more documentation (spec docsUrl)
 }
 
 // RequestArg represents an request argument and its metadata.
 type RequestArg struct {
-	Pos     int // position in request spec relative to required:, optional:, or static: stanza
-	Name    string
-	Desc    string
-	Type    string      // required, optional, static
-	Given   bool        // true if Required or Optional and value given
-	Default interface{} // default value if Optional or Static
-	Value   interface{} // final value
+	Pos       int // position in request spec relative to required:, optional:, or static: stanza
+	Name      string
+	Desc      string
+	Type      string      // required, optional, static
+	Given     bool        // true if Required or Optional and value given
+	Default   interface{} // default value if Optional or Static
+	Value     interface{} // final value
+	Sensitive bool        // do not display value (spec arg sensitive: true)
+}
+
+// RequestTypeMetadata documents a request type for humans: its request spec, and
+// the description and docs URL of the request sequence and every subsequence it
+// uses. It is returned by Request Manager GET /api/v1/request-types/${type}.
+type RequestTypeMetadata struct {
+	Request   RequestSpec        `json:"request"`
+	Sequences []SequenceMetadata `json:"sequences"` // request sequence first, then subsequences by name
+}
+
+// SequenceMetadata documents one sequence in RequestTypeMetadata.
+type SequenceMetadata struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description,omitempty"`
+	DocsURL     string         `json:"docsUrl,omitempty"`
+	Nodes       []NodeMetadata `json:"nodes"` // by name
+}
+
+// NodeMetadata documents one node of a sequence in SequenceMetadata.
+type NodeMetadata struct {
+	Name        string `json:"name"`
+	Category    string `json:"category"`       // job, sequence, conditional, or wait
+	Type        string `json:"type,omitempty"` // job type or sequence name; empty for conditional and wait
+	Description string `json:"description,omitempty"`
+	DocsURL     string `json:"docsUrl,omitempty"`
 }
 
 const (
@@ -155,16 +277,41 @@ type JobLog struct {
 	JobId     string `json:"jobId"`
 	Try       uint   `json:"try"` // try number that is monotonically increasing
 
+	// SequenceTry is the try number of the job's sequence when the job ran, starting
+	// at 1. It's zero in job logs from Job Runners that don't report it.
+	SequenceTry uint `json:"sequenceTry,omitempty"`
+
 	Name       string `json:"name"`
 	Type       string `json:"type"`
 	StartedAt  int64  `json:"startedAt"`  // when job started (UnixNano)
 	FinishedAt int64  `json:"finishedAt"` // when job finished, regardless of state (UnixNano)
 
-	State  byte   `json:"state"`  // STATE_* const
-	Exit   int64  `json:"exit"`   // unix exit code
-	Error  string `json:"error"`  // error message
-	Stdout string `json:"stdout"` // stdout output
-	Stderr string `json:"stderr"` // stderr output
+	// QueueDelay is how long, in nanoseconds, the job was runnable on the Job
+	// Runner before this try started. It's only set when the job starts, not for
+	// its retries, which wait RetryWait on purpose. It's zero in job logs from Job
+	// Runners that don't report it.
+	QueueDelay int64 `json:"queueDelay,omitempty"`
+
+	// CPUTime is the CPU time, in nanoseconds, of this try: the goroutine that
+	// ran the job, where the Job Runner can measure it, plus processes that the
+	// job reported (job.Return.Usage). MaxMemory is the peak memory, in bytes,
+	// of processes that the job reported, or zero if none or unknown. Both are
+	// zero in job logs from Job Runners that don't report them.
+	CPUTime   int64 `json:"cpuTime,omitempty"`
+	MaxMemory int64 `json:"maxMemory,omitempty"`
+
+	State          byte   `json:"state"`                    // STATE_* const
+	Exit           int64  `json:"exit"`                     // unix exit code
+	Error          string `json:"error"`                    // error message
+	ErrorCategory  string `json:"errorCategory,omitempty"`  // job.Error category, if any
+	ErrorCode      string `json:"errorCode,omitempty"`      // job.Error code, if any
+	ErrorRetryable bool   `json:"errorRetryable,omitempty"` // job.Error retryable, false if not a job.Error
+	Stdout         string `json:"stdout"`                   // stdout output
+	Stderr         string `json:"stderr"`                   // stderr output
+
+	// FenceToken is the JobChain.FenceToken of the chain that ran the job. It's
+	// not saved in the job log.
+	FenceToken uint64 `json:"fenceToken,omitempty"`
 }
 
 type JobLogById []JobLog
@@ -175,6 +322,15 @@ func (jls JobLogById) Less(i, j int) bool {
 }
 func (jls JobLogById) Swap(i, j int) { jls[i], jls[j] = jls[j], jls[i] }
 
+// JobType is a job type that a Job Runner can make, returned by the Job Runner
+// list-jobs API. Plugin and PluginVersion are set if the job type was loaded
+// from a Go plugin.
+type JobType struct {
+	Type          string `json:"type"`
+	Plugin        string `json:"plugin,omitempty"`
+	PluginVersion string `json:"pluginVersion,omitempty"`
+}
+
 // JobStatus represents the status of one job in a job chain.
 type JobStatus struct {
 	RequestId string `json:"requestId"`
@@ -185,6 +341,31 @@ type JobStatus struct {
 	State     byte   `json:"state"`            // usually proto.STATE_RUNNING
 	Status    string `json:"status,omitempty"` // real-time status, if running
 	Try       uint   `json:"try"`              // try number, can be >1+retry on sequence retry
+
+	SequenceTry    uint   `json:"sequenceTry"`              // try number of the job's sequence
+	QueueDelay     int64  `json:"queueDelay,omitempty"`     // nanoseconds runnable before first try started
+	ChainStartedAt int64  `json:"chainStartedAt,omitempty"` // when the JR started running the chain (UnixNano)
+	JobRunnerURL   string `json:"jrURL,omitempty"`          // URL of the JR running the job, set by the RM
+}
+
+// TRUNCATED_MARKER ends strings truncated by Truncate.
+const TRUNCATED_MARKER = "...[truncated]"
+
+// Truncate returns s if its length is <= max bytes. Else, it returns s truncated
+// and ending with TRUNCATED_MARKER, max bytes long (including the marker). It never
+// splits a multi-byte UTF-8 character. If max is zero, there is no maximum.
+func Truncate(s string, max uint) string {
+	if max == 0 || uint(len(s)) <= max {
+		return s
+	}
+	if max <= uint(len(TRUNCATED_MARKER)) {
+		return TRUNCATED_MARKER[:max]
+	}
+	n := int(max) - len(TRUNCATED_MARKER)
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n] + TRUNCATED_MARKER
 }
 
 // JobStatusByStartTime sorts []JobStatus by StartedAt ascending (oldest jobs first).
@@ -204,7 +385,68 @@ type RequestProgress struct {
 // Request Manager GET /api/v1/status/running
 type RunningStatus struct {
 	Jobs     []JobStatus        `json:"jobs"`
-	Requests map[string]Request `json:"requests"` // keyed on RequestId
+	Requests map[string]Request `json:"requests"`         // keyed on RequestId
+	Banner   string             `json:"banner,omitempty"` // notice for humans, e.g. RM is read-only
+}
+
+// JobRunnerStatus is the running status of one Job Runner that it pushes to the
+// Request Manager. By default, it's a full snapshot of all running jobs. If the
+// Job Runner pushes deltas (config.StatusPush.Deltas), Jobs and Removed are the
+// changes since push Seq-1, which the Request Manager applies only if it received
+// that push. Else, it polls the Job Runner until the next full push.
+type JobRunnerStatus struct {
+	JobRunnerURL string            `json:"jrURL"`             // base URL of the JR
+	Jobs         []JobStatus       `json:"jobs"`              // all running jobs on the JR, or changed jobs if Delta
+	Seq          uint64            `json:"seq,omitempty"`     // push sequence number, incremented on every push
+	Delta        bool              `json:"delta,omitempty"`   // Jobs and Removed are changes since push Seq-1
+	Removed      []JobStatus       `json:"removed,omitempty"` // if Delta, jobs no longer running (only RequestId and JobId)
+	Health       *JobRunnerHealth  `json:"health,omitempty"`  // resource usage of the JR
+	Labels       map[string]string `json:"labels,omitempty"`  // JR labels for placement (config.StatusPush.Labels)
+	Version      string            `json:"version,omitempty"` // Spin Cycle version of the JR
+
+	// JobTypes are the tries of each job type in the circuit breaker window
+	// (config.CircuitBreaker), keyed on job type. Not set if the JR circuit
+	// breaker is disabled.
+	JobTypes map[string]JobTypeTries `json:"jobTypes,omitempty"`
+}
+
+// JobRunnerHealth is the resource usage of one Job Runner at its last check,
+// compared to its guardrail watermarks (config.Guardrails). While Overloaded is
+// true, the Job Runner does not start new or resumed job chains.
+type JobRunnerHealth struct {
+	Goroutines    uint            `json:"goroutines"`
+	HeapBytes     uint64          `json:"heapBytes"`               // heap memory in use
+	MaxGoroutines uint            `json:"maxGoroutines,omitempty"` // zero if no maximum
+	MaxHeapBytes  uint64          `json:"maxHeapBytes,omitempty"`  // zero if no maximum
+	Overloaded    bool            `json:"overloaded"`
+	Reason        string          `json:"reason,omitempty"` // why overloaded
+	Chains        map[string]uint `json:"chains,omitempty"` // goroutines per running chain, keyed on RequestId
+	CheckedAt     time.Time       `json:"checkedAt"`
+}
+
+// JobTypeTries are the tries of one job type in the circuit breaker window
+// (config.CircuitBreaker). The Request Manager sums the tries pushed by all Job
+// Runners (proto.JobRunnerStatus.JobTypes) and returns them keyed on job type:
+// Request Manager GET /api/v1/status/job-types.
+type JobTypeTries struct {
+	Tries  uint `json:"tries"`
+	Failed uint `json:"failed"`
+}
+
+// CircuitBreaker is the state of the circuit breaker of one job type on a Job
+// Runner (config.CircuitBreaker). While it's open, tries of jobs of the type
+// fail without running, or wait, until Until. Tries and Failed are the tries in
+// the window, or the tries when it opened if it's open. Returned by Job Runner
+// GET /api/v1/status/circuit-breakers.
+type CircuitBreaker struct {
+	JobType     string    `json:"jobType"`
+	Open        bool      `json:"open"`
+	Tries       uint      `json:"tries"`
+	Failed      uint      `json:"failed"`
+	FailureRate float64   `json:"failureRate"`        // Failed / Tries
+	Fleet       bool      `json:"fleet"`              // tries of all JRs, not only this JR
+	OpenedAt    time.Time `json:"openedAt,omitempty"` // zero if closed
+	Until       time.Time `json:"until,omitempty"`    // end of cool-down, zero if closed
 }
 
 // StatusFilter represents optional filters for status requests.
@@ -227,11 +469,92 @@ func (f StatusFilter) String() string {
 	return "?" + strings.Join(q, "&")
 }
 
+// JobLogFilter represents optional filters when getting a request's job log.
+type JobLogFilter struct {
+	ErrorsOnly bool   // only tries that did not complete (state != STATE_COMPLETE)
+	NoOutput   bool   // don't return stdout and stderr, which can be large
+	Stream     string // "stdout" or "stderr": return only this output (ignored if NoOutput)
+	JobId      string // only tries of this job
+}
+
+func (f JobLogFilter) String() string {
+	q := []string{}
+	if f.ErrorsOnly {
+		q = append(q, "errorsOnly=true")
+	}
+	if f.NoOutput {
+		q = append(q, "noOutput=true")
+	}
+	if f.Stream != "" {
+		q = append(q, "stream="+strings.ToLower(f.Stream))
+	}
+	if f.JobId != "" {
+		q = append(q, "jobId="+f.JobId)
+	}
+	if len(q) == 0 {
+		return ""
+	}
+	return "?" + strings.Join(q, "&")
+}
+
 // CreateRequest represents the payload to create and start a new request.
 type CreateRequest struct {
 	Type string                 // the type of request being made
 	Args map[string]interface{} // the arguments for the request
 	User string                 // the user making the request
+	Team string                 // the team of the user making the request (auth.Caller.Team)
+
+	// Deadline is when the request must finish by, if set. Jobs are not started
+	// after the deadline, and the request final state is STATE_DEADLINE_EXCEEDED
+	// if it does not complete by then. Jobs that implement job.ContextJob receive
+	// the deadline in their context.
+	Deadline *time.Time
+
+	// CorrelationId is an ID from the caller, like an upstream ticket or pipeline
+	// run ID, that traces the request back to what caused it. The Request Manager
+	// API sets it from the X-Correlation-Id header if not set. It's saved with the
+	// request, logged by the Request Manager and Job Runner, and inherited by
+	// retries. It's optional and at most MAX_CORRELATION_ID_LEN characters.
+	CorrelationId string
+
+	// Origin is optional metadata about the caller system, like its name and a
+	// link to the pipeline or ticket. It's saved and returned with the request.
+	Origin map[string]string
+
+	// FromJob is the name of a job to start the request from: every job before
+	// it is COMPLETE and does not run. It's set by retrying a request from a job
+	// (RetryRequest.FromJob), and retries of the request inherit it.
+	FromJob string
+
+	// GroupId is the request group that the request is created in. It's set by
+	// the Request Manager API when creating a request group; callers cannot set it.
+	GroupId string `json:"-"`
+}
+
+// MAX_CORRELATION_ID_LEN is the maximum length of CreateRequest.CorrelationId.
+const MAX_CORRELATION_ID_LEN = 128
+
+// RetryRequest represents the payload to retry a failed request: create and
+// start a new request with the same create request, linked to the failed request
+// by Request.RetryOf. Args overrides the values of the given request args, like a
+// corrected hostname; other args have the same values as the failed request. Only
+// required and optional args can be overridden, not static args. If Deadline is
+// set, it replaces the failed request deadline, which has usually passed. If FromJob
+// is set, the new request starts from that job (CreateRequest.FromJob) to redo the
+// failed request from the job that failed, for example.
+type RetryRequest struct {
+	Args     map[string]interface{} `json:"args,omitempty"`     // request arg name => new value
+	Deadline *time.Time             `json:"deadline,omitempty"` // new deadline (CreateRequest.Deadline)
+	FromJob  string                 `json:"fromJob,omitempty"`  // job name to start from (CreateRequest.FromJob)
+	User     string                 `json:"user,omitempty"`     // the user retrying the request (set by the API)
+	Team     string                 `json:"team,omitempty"`     // the team of the user retrying the request (set by the API)
+}
+
+// ArgOverride is the record of one request arg overridden by a RetryRequest.
+type ArgOverride struct {
+	Name  string      `json:"name"`  // request arg name
+	Old   interface{} `json:"old"`   // value in the failed request
+	Value interface{} `json:"value"` // value in this request (RetryRequest.Args)
 }
 
 // FinishRequest represents the payload to tell the RM that a request has finished.
@@ -240,6 +563,64 @@ type FinishRequest struct {
 	State        byte      `json:"state"`        // the final state of the chain
 	FinishedAt   time.Time `json:"finishedAt"`   // when the Job Runner finished the request
 	FinishedJobs uint      `json:"finishedJobs"` // number of jobs that ran and finished with state = STATE_COMPLETE
+
+	// The Job Runner that ran the chain and the JobChain.FenceToken of the
+	// chain. If the request was taken over by another Job Runner or resumed
+	// after the chain was lost, the Request Manager rejects the final state
+	// (serr.ErrFenced).
+	JobRunnerURL string `json:"jobRunnerURL,omitempty"`
+	FenceToken   uint64 `json:"fenceToken,omitempty"`
+}
+
+// FinalizeRequest forcibly sets a final state on a request whose Job Runner is
+// unrecoverable, instead of changing the request in the database by hand. It is
+// the payload of Request Manager PUT /api/v1/requests/${requestId}/finalize, which
+// only admins can call. State must be STATE_FAIL or STATE_STOPPED, and Reason is
+// required. The change is saved in the request_audit table (AUDIT_ACTION_FINALIZE).
+type FinalizeRequest struct {
+	State  byte   `json:"state"`          // the final state to set
+	Reason string `json:"reason"`         // why, like "JR host lost, jobs verified by hand"
+	User   string `json:"user,omitempty"` // the admin finalizing the request (set by the API)
+}
+
+// Request audit actions: the action column of the request_audit table, which
+// records changes that an admin forced on a request.
+const (
+	AUDIT_ACTION_FINALIZE = "finalize" // FinalizeRequest
+)
+
+// Delivery is a job log or final request state that a Job Runner could not send
+// to the Request Manager when the job or chain finished, so it queued it to send
+// again later (see config.Delivery). Exactly one of JobLog and Finish is set.
+// Deliveries are sent in batches to POST /api/v1/deliveries.
+type Delivery struct {
+	RequestId string         `json:"requestId"`
+	JobLog    *JobLog        `json:"jobLog,omitempty"`
+	Finish    *FinishRequest `json:"finish,omitempty"`
+}
+
+// DeliveryResult is the result of one Delivery in a batch. Deliveries are
+// idempotent: a job log that was already saved, or a final state that the request
+// already has, is a duplicate and delivered, so the Job Runner can send it again
+// when it doesn't know whether the first send succeeded. If not delivered, Error
+// is the error that the single-item endpoint would have returned; like the rm.Client,
+// the Job Runner can retry HTTP 5xx errors but not others, like 404 (request
+// not found) and 409 (conflict, like serr.ErrFenced).
+type DeliveryResult struct {
+	Delivered bool   `json:"delivered"`
+	Duplicate bool   `json:"duplicate,omitempty"` // delivered previously
+	Error     *Error `json:"error,omitempty"`     // not delivered
+}
+
+// JobLogResult is the result of creating one job log in a batch (POST /api/v1/job-logs).
+// Like deliveries, creating job logs is idempotent: a job log that was already saved
+// for the job try is a duplicate and created, so the Job Runner can send a batch
+// again when it doesn't know whether the first send succeeded. If not created,
+// Error is the error that POST /api/v1/requests/${requestId}/log would have returned.
+type JobLogResult struct {
+	Created   bool   `json:"created"`
+	Duplicate bool   `json:"duplicate,omitempty"` // created previously
+	Error     *Error `json:"error,omitempty"`     // not created
 }
 
 // Jobs are a list of jobs sorted by id.
@@ -261,6 +642,27 @@ type RequestFilter struct {
 	States []byte // Request states to include.
 	User   string // User who made the request.
 
+	// Return only requests made by the caller: the Request Manager sets User to
+	// the caller's username (the user saved with requests it creates).
+	Mine bool
+
+	// Return only requests with this correlation ID (CreateRequest.CorrelationId).
+	CorrelationId string
+
+	// Return only requests in this request group (Request.GroupId).
+	GroupId string
+
+	// Return only the partition requests of this request (Request.PartitionOf).
+	PartitionOf string
+
+	// Return only requests in these namespaces. An empty string matches requests
+	// not in a namespace.
+	Namespaces []string
+
+	// Return only requests with these request arg values, keyed on arg name.
+	// Values are compared as strings.
+	Args map[string]string
+
 	// Return only requests that were created and run at any point within the time
 	// range. I.e. Requests created before Since but finished after Since will
 	// still be returned, as will requests created before Until but not finished
@@ -287,6 +689,31 @@ func (f RequestFilter) String() string {
 	if f.User != "" {
 		params.Add("user", f.User)
 	}
+	if f.Mine {
+		params.Add("mine", "true")
+	}
+	if f.CorrelationId != "" {
+		params.Add("correlationId", f.CorrelationId)
+	}
+	if f.GroupId != "" {
+		params.Add("groupId", f.GroupId)
+	}
+	if f.PartitionOf != "" {
+		params.Add("partitionOf", f.PartitionOf)
+	}
+	for _, ns := range f.Namespaces {
+		params.Add("namespace", ns)
+	}
+	if len(f.Args) != 0 {
+		names := make([]string, 0, len(f.Args))
+		for name := range f.Args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			params.Add("arg", name+"="+f.Args[name])
+		}
+	}
 	if !f.Since.IsZero() {
 		params.Add("since", f.Since.Format(time.RFC3339Nano))
 	}
@@ -302,6 +729,332 @@ func (f RequestFilter) String() string {
 	return params.Encode()
 }
 
+// RequestHistory reports past requests of one type and their outcomes. It is
+// returned by Request Manager GET /api/v1/request-history. The summary (Total
+// through MedianDuration) is of all requests since Since, even if Requests is
+// limited. Like RequestFilter.Since, requests created before Since but finished
+// after it are included.
+type RequestHistory struct {
+	Type           string          `json:"type"`
+	Since          time.Time       `json:"since"`
+	Requests       []Request       `json:"requests"`       // most recent first, without job chain or args
+	Total          uint            `json:"total"`          // number of requests
+	States         map[string]uint `json:"states"`         // state name -> number of requests
+	Finished       uint            `json:"finished"`       // number of finished requests
+	SuccessRate    float64         `json:"successRate"`    // COMPLETE / Finished, 0 if none finished
+	MedianDuration float64         `json:"medianDuration"` // seconds from start to finish of finished requests
+}
+
+// SLO is the service level objective of a request type (request spec slo).
+type SLO struct {
+	SuccessRate float64 `json:"successRate,omitempty"` // target fraction of finished requests that complete
+	Duration    string  `json:"duration,omitempty"`    // target request duration (duration string)
+	Percentile  float64 `json:"percentile,omitempty"`  // percent of finished requests that finish within Duration
+}
+
+// SLOWindow is how well requests of a type that finished in one rolling window
+// meet its SLO. The error budget is the fraction of requests allowed to miss the
+// SLO: 1 - SLO.SuccessRate, and 1 - SLO.Percentile/100. BurnRate is the fraction
+// that missed divided by the budget, the higher of the two: 1.0 uses the budget
+// exactly, greater uses it up.
+type SLOWindow struct {
+	Window             string  `json:"window"`             // like "1h"
+	Finished           uint    `json:"finished"`           // number of requests finished in the window
+	Complete           uint    `json:"complete"`           // number of finished requests that completed
+	WithinDuration     uint    `json:"withinDuration"`     // number of finished requests that finished within SLO.Duration
+	SuccessRate        float64 `json:"successRate"`        // Complete / Finished, 0 if none finished
+	DurationAttainment float64 `json:"durationAttainment"` // percent of finished requests within SLO.Duration, 0 if none finished
+	BurnRate           float64 `json:"burnRate"`           // error budget burn rate
+	Met                bool    `json:"met"`                // SLO met, or too few requests finished to judge
+	Burning            bool    `json:"burning"`            // BurnRate at or above the alert threshold
+}
+
+// SLOStatus is the SLO attainment of a request type. It is returned by Request
+// Manager GET /api/v1/slo and GET /api/v1/slo/${type}. A request type's SLO is
+// burning when it's burning in the two shortest windows (or the only window):
+// the long window shows the burn is significant and the short window shows it's
+// still happening.
+type SLOStatus struct {
+	Type      string      `json:"type"`
+	SLO       SLO         `json:"slo"`
+	Windows   []SLOWindow `json:"windows"` // shortest first
+	Burning   bool        `json:"burning"`
+	CheckedAt time.Time   `json:"checkedAt"`
+}
+
+// RequestBundle is a complete request exported from one Request Manager to import
+// into another, for example to reproduce a production issue in staging. It is
+// returned by Request Manager GET /api/v1/requests/${requestId}/export and sent
+// to POST /api/v1/requests/import.
+type RequestBundle struct {
+	Request           Request            `json:"request"`                     // with args and job chain
+	CreateRequest     CreateRequest      `json:"createRequest"`               // from caller (request_archives.create_request)
+	JobLogs           []JobLog           `json:"jobLogs"`                     // all tries, with stdout and stderr
+	SuspendedJobChain *SuspendedJobChain `json:"suspendedJobChain,omitempty"` // if request is suspended
+	ExportedAt        time.Time          `json:"exportedAt"`
+	Version           string             `json:"version"` // Spin Cycle version of the exporting Request Manager
+}
+
+// API_VERSION is the Request Manager API version: the N in /api/vN/. It changes
+// only when the API changes incompatibly; new endpoints are features.
+const API_VERSION uint = 1
+
+// Optional Request Manager capabilities listed in ServerVersion.Features. Clients
+// like spinc check features, not version numbers, to know what the Request Manager
+// supports. Never rename a feature; add new ones as endpoints are added.
+const (
+	FEATURE_REQUEST_HISTORY = "request-history" // GET /api/v1/request-history
+	FEATURE_REQUEST_EXPORT  = "request-export"  // export and import requests
+	FEATURE_REQUEST_RETRY   = "request-retry"   // POST /api/v1/requests/${requestId}/retry
+	FEATURE_REQUEST_GROUPS  = "request-groups"  // /api/v1/request-groups
+	FEATURE_JOB_TRIES       = "job-tries"       // GET /api/v1/requests/${requestId}/jobs/${jobId}/tries
+	FEATURE_PARTITIONS      = "partitions"      // request partitions (Request.Partitions)
+	FEATURE_PLACEMENT       = "placement"       // request spec placement policies
+	FEATURE_DELIVERIES      = "deliveries"      // POST /api/v1/deliveries
+	FEATURE_STATUS_PUSH     = "status-push"     // JRs push status (config.StatusPush); not set if disabled
+	FEATURE_REQUEST_TYPES   = "request-types"   // GET /api/v1/request-types/${type}
+	FEATURE_CHAIN_PROTOBUF  = "chain-protobuf"  // accepts protobuf suspended job chains (CONTENT_TYPE_PROTOBUF)
+	FEATURE_LOG_LEVEL       = "log-level"       // PUT /api/v1/requests/${requestId}/log-level
+	FEATURE_REQUESTS_MINE   = "requests-mine"   // GET /api/v1/requests?mine=true
+	FEATURE_RESUME_POINTS   = "resume-points"   // /api/v1/requests/${requestId}/resume-points
+	FEATURE_SPEC_REPORT     = "spec-report"     // GET /api/v1/spec-report
+	FEATURE_RETRY_FROM_JOB  = "retry-from-job"  // RetryRequest.FromJob
+	FEATURE_BULK_CREATE     = "bulk-create"     // POST /api/v1/requests/bulk
+	FEATURE_JOB_LOG_BATCH   = "job-log-batch"   // POST /api/v1/job-logs
+	FEATURE_SLO             = "slo"             // GET /api/v1/slo
+	FEATURE_READ_REPLICA    = "read-replica"    // heavy reads from a MySQL read replica (config.ReadReplica); not set if disabled
+	FEATURE_FINALIZE        = "finalize"        // PUT /api/v1/requests/${requestId}/finalize
+)
+
+// ServerVersion is the version of a Request Manager and the Job Runners that push
+// status to it (config.StatusPush). It is returned by Request Manager GET /api/v1/version.
+// Features are the same as GET /api/v1/features.
+type ServerVersion struct {
+	Version    string             `json:"version"`    // Spin Cycle version of the RM
+	APIVersion uint               `json:"apiVersion"` // API_VERSION of the RM
+	Features   []string           `json:"features"`   // FEATURE_* supported by the RM, sorted
+	JobRunners []JobRunnerVersion `json:"jobRunners"` // empty if JRs do not push status
+}
+
+// JobRunnerVersion is the version of one Job Runner in ServerVersion.
+type JobRunnerVersion struct {
+	JobRunnerURL string `json:"jrURL"`
+	Version      string `json:"version"` // empty if the JR is older than the RM and does not push it
+}
+
+// HasFeature returns true if the Request Manager supports the feature.
+func (v ServerVersion) HasFeature(feature string) bool {
+	for _, f := range v.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// RequestFailure is the root cause of a failed request: the earliest job try that
+// failed and the jobs that did not run because of it. It is returned by Request
+// Manager GET /api/v1/requests/${requestId}/failure. FailedJob is nil if no job
+// try failed, for example if the request was stopped.
+type RequestFailure struct {
+	RequestId   string  `json:"requestId"`
+	State       byte    `json:"state"`               // request state
+	FailedJob   *JobLog `json:"failedJob,omitempty"` // earliest failed try, without stdout and stderr
+	FailedTries uint    `json:"failedTries"`         // number of failed tries of all jobs
+	SkippedJobs []Job   `json:"skippedJobs"`         // downstream of FailedJob and never ran, without bytes or args
+}
+
+const (
+	QUOTA_SCOPE_USER      = "user"
+	QUOTA_SCOPE_TEAM      = "team"
+	QUOTA_SCOPE_NAMESPACE = "namespace"
+)
+
+// Quota limits the requests created by one user, team, or namespace. A quota with
+// an empty Name is the default for all users, teams, or namespaces without their
+// own quota. Zero values are unlimited.
+type Quota struct {
+	Scope      string `json:"scope"`      // QUOTA_SCOPE_* const
+	Name       string `json:"name"`       // user, team, or namespace name, or empty for default
+	MaxRunning uint   `json:"maxRunning"` // max pending, running, and suspended requests
+	MaxDaily   uint   `json:"maxDaily"`   // max requests created in the last 24 hours
+}
+
+// ReadOnly is the Request Manager read-only mode. When enabled, status and log
+// APIs work, but requests cannot be created, started, or stopped.
+type ReadOnly struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"` // why, e.g. "database failover"
+}
+
+// SpecReport is the result of checking the request specs that the Request Manager
+// loaded on startup: errors and warnings from parsing spec files, static checks,
+// and graph checks. Request types with errors are unbuildable: the Request Manager
+// does not create requests of those types. It only starts with spec errors if
+// config.Specs.AllowErrors is true.
+type SpecReport struct {
+	SpecVersion     string                     `json:"specVersion"`
+	TemplateVersion string                     `json:"templateVersion,omitempty"`
+	CheckedAt       time.Time                  `json:"checkedAt"`
+	Files           map[string]SpecCheckResult `json:"files,omitempty"`       // keyed on spec file, parse results
+	Sequences       map[string]SpecCheckResult `json:"sequences,omitempty"`   // keyed on sequence, static and graph check results
+	Unbuildable     []string                   `json:"unbuildable,omitempty"` // request types with errors, sorted
+}
+
+// SpecCheckResult is the errors and warnings of one spec file or sequence in a
+// SpecReport.
+type SpecCheckResult struct {
+	Errors   []string `json:"errors,omitempty"`
+	Warnings []string `json:"warnings,omitempty"`
+}
+
+// RequestLogLevel is the log level of one request, like "debug", elevated until
+// Until without changing the log level of other requests. It is the payload and
+// response of Request Manager and Job Runner PUT .../${requestId}/log-level.
+// Duration is a Go duration string, like "30m" (default 15m, max 24h). A level
+// not more verbose than the server log level resets the request log level, and
+// Until is zero.
+type RequestLogLevel struct {
+	Level    string    `json:"level"`
+	Duration string    `json:"duration,omitempty"`
+	Until    time.Time `json:"until"` // response only
+}
+
+// Resume point actions for ResumePoints.Jobs: what to do with a job when the
+// suspended job chain is resumed.
+const (
+	RESUME_COMPLETE = "complete" // job was done outside Spin Cycle (e.g. by hand); don't run it
+	RESUME_SKIP     = "skip"     // job does not need to be done; don't run it
+	RESUME_PENDING  = "pending"  // run the job (again) with all its tries
+)
+
+// ResumePoints changes the jobs of a suspended job chain before it's resumed. It
+// is the payload of Request Manager PUT /api/v1/requests/${requestId}/resume-points.
+// Complete and skipped jobs are both COMPLETE in the job chain, so the jobs after
+// them run. Hold is a Go duration string, like "10m": the request is not resumed
+// until it passes, so the job chain can be inspected and changed without racing
+// the Request Manager resuming it. Without Hold, the request is resumed as soon
+// as possible.
+type ResumePoints struct {
+	Jobs map[string]string `json:"jobs,omitempty"` // job ID => RESUME_* const
+	Hold string            `json:"hold,omitempty"`
+}
+
+// Steps of a JobRunnerUpgrade. Each Job Runner is drained, replaced by deploy
+// tooling, and health-checked before the next one is drained.
+const (
+	UPGRADE_STEP_DRAIN   = "drain"   // waiting for job chains on current JR to finish
+	UPGRADE_STEP_REPLACE = "replace" // waiting for deploy tooling to replace current JR
+	UPGRADE_STEP_HEALTH  = "health"  // waiting for replaced JR to respond
+	UPGRADE_STEP_DONE    = "done"    // all JRs upgraded
+	UPGRADE_STEP_FAILED  = "failed"  // see JobRunnerUpgrade.Error
+)
+
+// CreateJobRunnerUpgrade is the payload to start a rolling Job Runner upgrade.
+// Timeouts are Go duration strings, like "10m".
+type CreateJobRunnerUpgrade struct {
+	JobRunnerURLs []string `json:"jrURLs"`                  // upgraded in this order
+	DrainTimeout  string   `json:"drainTimeout,omitempty"`  // max wait for chains to finish (default 10m)
+	HealthTimeout string   `json:"healthTimeout,omitempty"` // max wait for replaced JR to respond (default 5m)
+}
+
+// JobRunnerReplaced is the payload sent by deploy tooling when the current Job
+// Runner of an upgrade has been replaced. JobRunnerURL is set only if the new
+// instance has a different URL.
+type JobRunnerReplaced struct {
+	JobRunnerURL string `json:"jrURL,omitempty"`
+}
+
+// JobRunnerUpgrade is the progress of a rolling Job Runner upgrade. Deploy tooling
+// polls it and replaces JobRunnerURLs[Current] when Step is UPGRADE_STEP_REPLACE.
+type JobRunnerUpgrade struct {
+	Id            string    `json:"id"`
+	JobRunnerURLs []string  `json:"jrURLs"`
+	Current       uint      `json:"current"` // index of JobRunnerURLs being upgraded
+	Step          string    `json:"step"`    // UPGRADE_STEP_* const
+	StepStartedAt time.Time `json:"stepStartedAt"`
+	RunningChains uint      `json:"runningChains"` // on current JR, only set during drain step
+	DrainTimeout  string    `json:"drainTimeout"`
+	HealthTimeout string    `json:"healthTimeout"`
+	Error         string    `json:"error,omitempty"`
+	CreatedAt     time.Time `json:"createdAt"`
+}
+
+// MAX_GROUP_REQUESTS is the maximum number of requests in a CreateRequestGroup.
+const MAX_GROUP_REQUESTS = 500
+
+// CreateRequestGroup is the payload to create and start a request group: many
+// requests created in one call and tracked as one unit, like the same request
+// type for 50 clusters. Each request is created like a CreateRequest; User and
+// Team are set by the Request Manager API for all requests.
+type CreateRequestGroup struct {
+	Name     string          `json:"name"`     // for humans, like "upgrade mysql 8.0 on all clusters"
+	Requests []CreateRequest `json:"requests"` // at least one, at most MAX_GROUP_REQUESTS
+}
+
+// RequestGroup is a request group and the aggregate status of its requests.
+// State is STATE_RUNNING while any request is not finished (including pending
+// and suspended requests), STATE_COMPLETE if all requests completed, STATE_STOPPED
+// if any request was stopped and none failed, else STATE_FAIL (including a group
+// with no requests because creating them failed).
+type RequestGroup struct {
+	Id        string    `json:"id"`
+	Name      string    `json:"name"`
+	User      string    `json:"user"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	State        byte            `json:"state"`        // STATE_* const, aggregate of all requests
+	States       map[string]uint `json:"states"`       // number of requests by state name, like "RUNNING": 3
+	TotalJobs    uint            `json:"totalJobs"`    // sum of Requests[].TotalJobs
+	FinishedJobs uint            `json:"finishedJobs"` // sum of Requests[].FinishedJobs
+	Requests     []Request       `json:"requests"`     // in order created
+}
+
+// Bulk create modes (CreateRequestBulk.Mode).
+const (
+	BULK_ALL_OR_NOTHING = "all-or-nothing" // create and start all requests, or none
+	BULK_BEST_EFFORT    = "best-effort"    // create and start every request that can be
+)
+
+// CreateRequestBulk is the payload to create and start many requests in one call
+// (POST /api/v1/requests/bulk). Each request is created like a CreateRequest;
+// User and Team are set by the Request Manager API for all requests. All requests
+// are put in a new request group, so they can be tracked and stopped as one unit.
+//
+// All requests are created before any is started. In mode BULK_ALL_OR_NOTHING
+// (the default), if any request cannot be created or the caller cannot start it,
+// the requests already created are failed before they run, and none are started.
+// In mode BULK_BEST_EFFORT, those requests are skipped, and the others run. In
+// both modes, a request that fails to start does not stop the others.
+type CreateRequestBulk struct {
+	Name     string          `json:"name,omitempty"` // request group name, default "bulk create"
+	Mode     string          `json:"mode,omitempty"` // BULK_* const, default BULK_ALL_OR_NOTHING
+	Requests []CreateRequest `json:"requests"`       // at least one, at most MAX_GROUP_REQUESTS
+}
+
+// BulkCreateResult is the result of a bulk create: the request group and one
+// BulkCreateItem for every CreateRequestBulk.Requests, in the same order.
+type BulkCreateResult struct {
+	GroupId string           `json:"groupId"` // RequestGroup.Id of all requests created
+	Mode    string           `json:"mode"`    // BULK_* const
+	Created uint             `json:"created"` // number of requests created and started
+	Failed  uint             `json:"failed"`  // number of requests not created or not started
+	Items   []BulkCreateItem `json:"items"`
+}
+
+// BulkCreateItem is the result of creating one request in a bulk create.
+// HTTPStatus and Error are what creating the request alone would have returned:
+// 201 if it was created and started, else the error. RequestId is set if the
+// request was created, even if it was failed before it ran because it, or in
+// mode BULK_ALL_OR_NOTHING another request, could not be created or started.
+type BulkCreateItem struct {
+	Index      int    `json:"index"`               // index in CreateRequestBulk.Requests
+	Type       string `json:"type"`                // CreateRequest.Type
+	RequestId  string `json:"requestId,omitempty"` // Request.Id, if created
+	HTTPStatus int    `json:"httpStatus"`          // 201 if created and started
+	Error      string `json:"error,omitempty"`     // why not created or started
+}
+
 // Error is the standard response for all handled errors. Client errors (HTTP 400
 // codes) and internal errors (HTTP 500 codes) are returned as an Error, if handled.
 // If not handled (API crash, panic, etc.), Spin Cycle returns an HTTP 500 code and the
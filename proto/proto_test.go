@@ -3,9 +3,14 @@
 package proto_test
 
 import (
+	"encoding/json"
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/go-test/deep"
+
 	"github.com/square/spincycle/v2/proto"
 )
 
@@ -47,15 +52,205 @@ func TestRequestFilterString(t *testing.T) {
 			proto.STATE_RUNNING,
 			proto.STATE_SUSPENDED,
 		},
-		User:   "felixp",
-		Since:  time.Date(2020, 01, 01, 12, 34, 56, 789123000, time.UTC),
-		Until:  time.Date(2020, 01, 02, 12, 34, 56, 789000000, time.UTC),
-		Limit:  5,
-		Offset: 10,
+		User:          "felixp",
+		CorrelationId: "build-1",
+		Namespaces:    []string{"", "payments"},
+		Since:         time.Date(2020, 01, 01, 12, 34, 56, 789123000, time.UTC),
+		Until:         time.Date(2020, 01, 02, 12, 34, 56, 789000000, time.UTC),
+		Limit:         5,
+		Offset:        10,
 	}
-	expect = "limit=5&offset=10&since=2020-01-01T12%3A34%3A56.789123Z&state=PENDING&state=RUNNING&state=SUSPENDED&type=request-type&until=2020-01-02T12%3A34%3A56.789Z&user=felixp"
+	expect = "correlationId=build-1&limit=5&namespace=&namespace=payments&offset=10&since=2020-01-01T12%3A34%3A56.789123Z&state=PENDING&state=RUNNING&state=SUSPENDED&type=request-type&until=2020-01-02T12%3A34%3A56.789Z&user=felixp"
 	got = f.String()
 	if got != expect {
 		t.Errorf("got '%s', expected '%s'", got, expect)
 	}
+
+	f = proto.RequestFilter{Mine: true, States: []byte{proto.STATE_RUNNING}}
+	expect = "mine=true&state=RUNNING"
+	got = f.String()
+	if got != expect {
+		t.Errorf("got '%s', expected '%s'", got, expect)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		s      string
+		max    uint
+		expect string
+	}{
+		{"short", 0, "short"},
+		{"short", 5, "short"},
+		{"short", 100, "short"},
+		{"0123456789abcdefghij", 18, "0123" + proto.TRUNCATED_MARKER},
+		{"0123456789abcdefghij", 3, "..."},
+		{"héllo wörld, 1234567890", 16, "h" + proto.TRUNCATED_MARKER}, // don't split é
+	}
+	for _, test := range tests {
+		got := proto.Truncate(test.s, test.max)
+		if got != test.expect {
+			t.Errorf("Truncate(%q, %d) = %q, expected %q", test.s, test.max, got, test.expect)
+		}
+		if test.max > 0 && uint(len(got)) > test.max {
+			t.Errorf("Truncate(%q, %d) = %q, longer than max", test.s, test.max, got)
+		}
+	}
+}
+
+func TestJobChainSchemaVersion(t *testing.T) {
+	jc := proto.JobChain{
+		RequestId: "abc",
+		Jobs: map[string]proto.Job{
+			"job1": proto.Job{Id: "job1", Type: "jobtype"},
+		},
+		State: proto.STATE_PENDING,
+	}
+
+	// Encoded as current version, decoded back to the same chain
+	data, err := json.Marshal(jc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), fmt.Sprintf(`{"schemaVersion":%d,`, proto.JOB_CHAIN_SCHEMA_VERSION)) {
+		t.Errorf("encoded job chain does not have schemaVersion: %s", data)
+	}
+	var got proto.JobChain
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, jc); diff != nil {
+		t.Error(diff)
+	}
+
+	// Unversioned (before schema versions) is version 0
+	got = proto.JobChain{}
+	err = json.Unmarshal([]byte(`{"requestId":"abc","jobs":{"job1":{"id":"job1","type":"jobtype"}},"state":1}`), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, jc); diff != nil {
+		t.Error(diff)
+	}
+
+	// Newer version is an error
+	err = json.Unmarshal([]byte(fmt.Sprintf(`{"schemaVersion":%d,"requestId":"abc"}`, proto.JOB_CHAIN_SCHEMA_VERSION+1)), &got)
+	if err == nil {
+		t.Error("no error decoding newer schema version, expected an error")
+	}
+
+	// Suspended job chain and its job chain
+	sjc := proto.SuspendedJobChain{
+		RequestId:     "abc",
+		JobChain:      &jc,
+		TotalJobTries: map[string]uint{"job1": 1},
+	}
+	data, err = json.Marshal(sjc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var gotSJC proto.SuspendedJobChain
+	if err := json.Unmarshal(data, &gotSJC); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(gotSJC, sjc); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJobChainSchemaVersionEncode(t *testing.T) {
+	defer proto.SetEncodeSchemaVersion(proto.JOB_CHAIN_SCHEMA_VERSION)
+
+	// Empty chains are valid JSON with schemaVersion
+	for _, v := range []interface{}{proto.JobChain{}, proto.SuspendedJobChain{}} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal(data, &m); err != nil {
+			t.Fatalf("invalid JSON: %s: %s", err, data)
+		}
+		if m["schemaVersion"] != float64(proto.JOB_CHAIN_SCHEMA_VERSION) {
+			t.Errorf("schemaVersion = %v, expected %d: %s", m["schemaVersion"], proto.JOB_CHAIN_SCHEMA_VERSION, data)
+		}
+	}
+
+	// Version 0 (before schema versions) can be selected: no schemaVersion
+	if err := proto.SetEncodeSchemaVersion(0); err != nil {
+		t.Fatal(err)
+	}
+	jc := proto.JobChain{RequestId: "abc", State: proto.STATE_PENDING}
+	data, err := json.Marshal(jc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "schemaVersion") {
+		t.Errorf("encoded version 0 job chain has schemaVersion: %s", data)
+	}
+	var got proto.JobChain
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, jc); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJobChainSchemaMigration(t *testing.T) {
+	// Replace the migration to the current version with one that renames field
+	// "requestId" to "reqId", i.e. the previous version had "reqId"
+	saved := proto.SchemaMigrations
+	defer func() {
+		proto.SchemaMigrations = saved
+		proto.SetEncodeSchemaVersion(proto.JOB_CHAIN_SCHEMA_VERSION)
+	}()
+	mg := proto.SchemaMigration{Version: proto.JOB_CHAIN_SCHEMA_VERSION}
+	mg.JobChain.Up = func(m map[string]interface{}) error {
+		m["requestId"] = m["reqId"]
+		delete(m, "reqId")
+		return nil
+	}
+	mg.JobChain.Down = func(m map[string]interface{}) error {
+		m["reqId"] = m["requestId"]
+		delete(m, "requestId")
+		return nil
+	}
+	proto.SchemaMigrations = []proto.SchemaMigration{mg}
+
+	// Previous version migrated up on decode
+	var got proto.JobChain
+	prev := proto.JOB_CHAIN_SCHEMA_VERSION - 1
+	err := json.Unmarshal([]byte(fmt.Sprintf(`{"schemaVersion":%d,"reqId":"abc","state":1}`, prev)), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := proto.JobChain{RequestId: "abc", State: proto.STATE_PENDING}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Encode as previous version: migrated down
+	if err := proto.SetEncodeSchemaVersion(prev); err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(expect)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m["reqId"] != "abc" {
+		t.Errorf("reqId = %v, expected abc: %s", m["reqId"], data)
+	}
+	if _, ok := m["requestId"]; ok {
+		t.Errorf("requestId set, expected it to be migrated down to reqId: %s", data)
+	}
+
+	// Can't encode as a newer version
+	if err := proto.SetEncodeSchemaVersion(proto.JOB_CHAIN_SCHEMA_VERSION + 1); err == nil {
+		t.Error("no error setting newer encode version, expected an error")
+	}
 }
@@ -0,0 +1,881 @@
+// Copyright 2020, Square, Inc.
+
+package proto
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Job chains can be serialized as JSON (the default) or protobuf, which is
+// smaller and faster to encode and decode for large job chains. The protobuf
+// messages are defined in chain.proto. Job args and data (map[string]interface{})
+// are decoded to the same values in both formats: numbers are float64, and other
+// types (like structs) are decoded from JSON.
+//
+// The format is negotiated by content type: the sender sets Content-Type to
+// CONTENT_TYPE_JSON or CONTENT_TYPE_PROTOBUF, and if the receiver does not
+// support protobuf (HTTP 415), the sender resends JSON. Saved chains can be
+// either format; DecodeJobChain and DecodeSuspendedJobChain detect it.
+const (
+	CHAIN_FORMAT_JSON     = "json"
+	CHAIN_FORMAT_PROTOBUF = "protobuf"
+
+	CONTENT_TYPE_JSON     = "application/json"
+	CONTENT_TYPE_PROTOBUF = "application/x-protobuf"
+)
+
+// chainFormat is the format that chains are encoded as.
+var chainFormat = CHAIN_FORMAT_JSON
+
+// SetChainFormat sets the format that JobChain and SuspendedJobChain are saved
+// and sent as: CHAIN_FORMAT_JSON (the default) or CHAIN_FORMAT_PROTOBUF. Like
+// SetEncodeSchemaVersion, it is not safe to call while chains are being encoded;
+// call it once on boot.
+func SetChainFormat(format string) error {
+	switch format {
+	case CHAIN_FORMAT_JSON, CHAIN_FORMAT_PROTOBUF:
+	default:
+		return fmt.Errorf("invalid job chain format: %s: valid formats: %s, %s", format, CHAIN_FORMAT_JSON, CHAIN_FORMAT_PROTOBUF)
+	}
+	chainFormat = format
+	return nil
+}
+
+// ChainFormat returns the format that chains are encoded as. It is JSON if the
+// encode schema version is not the current version, even if the format is set
+// to protobuf, because schema migrations are JSON.
+func ChainFormat() string {
+	if encodeVersion != JOB_CHAIN_SCHEMA_VERSION {
+		return CHAIN_FORMAT_JSON
+	}
+	return chainFormat
+}
+
+// ContentType returns the HTTP content type of the chain format.
+func ContentType(format string) string {
+	if format == CHAIN_FORMAT_PROTOBUF {
+		return CONTENT_TYPE_PROTOBUF
+	}
+	return CONTENT_TYPE_JSON
+}
+
+// EncodeJobChain encodes the job chain in the format.
+func EncodeJobChain(jc JobChain, format string) ([]byte, error) {
+	if format != CHAIN_FORMAT_PROTOBUF {
+		return json.Marshal(jc)
+	}
+	e := &pbEncoder{}
+	if err := e.jobChain(jc); err != nil {
+		return nil, err
+	}
+	return e.b, nil
+}
+
+// DecodeJobChain decodes a job chain encoded in any format.
+func DecodeJobChain(data []byte, jc *JobChain) error {
+	if isJSON(data) {
+		return json.Unmarshal(data, jc)
+	}
+	return decodeJobChain(data, jc)
+}
+
+// EncodeSuspendedJobChain encodes the suspended job chain in the format.
+func EncodeSuspendedJobChain(sjc SuspendedJobChain, format string) ([]byte, error) {
+	if format != CHAIN_FORMAT_PROTOBUF {
+		return json.Marshal(sjc)
+	}
+	e := &pbEncoder{}
+	if err := e.suspendedJobChain(sjc); err != nil {
+		return nil, err
+	}
+	return e.b, nil
+}
+
+// DecodeSuspendedJobChain decodes a suspended job chain encoded in any format.
+func DecodeSuspendedJobChain(data []byte, sjc *SuspendedJobChain) error {
+	if isJSON(data) {
+		return json.Unmarshal(data, sjc)
+	}
+	return decodeSuspendedJobChain(data, sjc)
+}
+
+// isJSON returns true if data is a JSON object or null. Protobuf chains begin
+// with field 1 (schema_version), tag byte 0x08, so they are never JSON.
+func isJSON(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{', 'n':
+			return true
+		}
+		return false
+	}
+	return true // empty: let encoding/json return the error
+}
+
+// --------------------------------------------------------------------------
+// Encoding (https://developers.google.com/protocol-buffers/docs/encoding)
+// --------------------------------------------------------------------------
+
+const (
+	wireVarint = 0
+	wire64     = 1
+	wireBytes  = 2
+	wire32     = 5
+)
+
+type pbEncoder struct {
+	b []byte
+}
+
+func (e *pbEncoder) varint(v uint64) {
+	for v >= 0x80 {
+		e.b = append(e.b, byte(v)|0x80)
+		v >>= 7
+	}
+	e.b = append(e.b, byte(v))
+}
+
+func (e *pbEncoder) tag(field, wire int) {
+	e.varint(uint64(field<<3 | wire))
+}
+
+func (e *pbEncoder) uint(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	e.tag(field, wireVarint)
+	e.varint(v)
+}
+
+func (e *pbEncoder) bool(field int, v bool) {
+	if v {
+		e.uint(field, 1)
+	}
+}
+
+func (e *pbEncoder) string(field int, s string) {
+	if s != "" {
+		e.stringValue(field, s)
+	}
+}
+
+// stringValue encodes s even if it's empty.
+func (e *pbEncoder) stringValue(field int, s string) {
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(s)))
+	e.b = append(e.b, s...)
+}
+
+func (e *pbEncoder) double(field int, f float64) {
+	e.tag(field, wire64)
+	var b [8]byte
+	binary.LittleEndian.PutUint64(b[:], math.Float64bits(f))
+	e.b = append(e.b, b[:]...)
+}
+
+func (e *pbEncoder) bytes(field int, b []byte) {
+	if len(b) == 0 {
+		return
+	}
+	e.tag(field, wireBytes)
+	e.varint(uint64(len(b)))
+	e.b = append(e.b, b...)
+}
+
+// message encodes a length-delimited embedded message. The message is encoded
+// in place, then moved to make room for its length.
+func (e *pbEncoder) message(field int, f func() error) error {
+	e.tag(field, wireBytes)
+	start := len(e.b)
+	if err := f(); err != nil {
+		return err
+	}
+	n := len(e.b) - start
+	e.varint(uint64(n)) // append length to make room, then move it before the message
+	l := len(e.b) - start - n
+	var lenBuf [10]byte
+	copy(lenBuf[:], e.b[start+n:])
+	copy(e.b[start+l:], e.b[start:start+n])
+	copy(e.b[start:], lenBuf[:l])
+	return nil
+}
+
+// fields encodes a map[string]interface{} as a Struct: repeated field 1 entries
+// of key and Value.
+func (e *pbEncoder) fields(m map[string]interface{}) error {
+	for k, v := range m {
+		k, v := k, v
+		err := e.message(1, func() error {
+			e.string(1, k)
+			return e.message(2, func() error { return e.value(v) })
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// value encodes one Value. Numbers are doubles and other types are JSON, so
+// decoded values are the same as decoded JSON.
+func (e *pbEncoder) value(v interface{}) error {
+	switch v := v.(type) {
+	case nil:
+		e.null()
+	case float64:
+		e.double(2, v)
+	case int:
+		e.double(2, float64(v))
+	case int64:
+		e.double(2, float64(v))
+	case uint:
+		e.double(2, float64(v))
+	case uint64:
+		e.double(2, float64(v))
+	case string:
+		e.stringValue(3, v)
+	case bool:
+		e.tag(4, wireVarint)
+		if v {
+			e.varint(1)
+		} else {
+			e.varint(0)
+		}
+	case []interface{}:
+		if v == nil {
+			e.null()
+			return nil
+		}
+		return e.message(5, func() error {
+			for _, v := range v {
+				v := v
+				if err := e.message(1, func() error { return e.value(v) }); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	case []string:
+		if v == nil {
+			e.null()
+			return nil
+		}
+		return e.message(5, func() error {
+			for _, s := range v {
+				s := s
+				e.message(1, func() error {
+					e.stringValue(3, s)
+					return nil
+				})
+			}
+			return nil
+		})
+	case map[string]interface{}:
+		if v == nil {
+			e.null()
+			return nil
+		}
+		return e.message(6, func() error { return e.fields(v) })
+	default:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		e.tag(7, wireBytes)
+		e.varint(uint64(len(b)))
+		e.b = append(e.b, b...)
+	}
+	return nil
+}
+
+func (e *pbEncoder) null() {
+	e.tag(1, wireVarint)
+	e.varint(1)
+}
+
+func (e *pbEncoder) jobChain(jc JobChain) error {
+	e.uint(1, uint64(JOB_CHAIN_SCHEMA_VERSION))
+	e.string(2, jc.RequestId)
+	e.string(3, jc.RequestType)
+	for id, job := range jc.Jobs {
+		job := job
+		err := e.message(4, func() error {
+			e.string(1, id)
+			return e.message(2, func() error { return e.job(job) })
+		})
+		if err != nil {
+			return err
+		}
+	}
+	for id, next := range jc.AdjacencyList {
+		next := next
+		e.message(5, func() error {
+			e.string(1, id)
+			return e.message(2, func() error {
+				for _, s := range next {
+					e.tag(1, wireBytes)
+					e.varint(uint64(len(s)))
+					e.b = append(e.b, s...)
+				}
+				return nil
+			})
+		})
+	}
+	e.uint(6, uint64(jc.State))
+	e.uint(7, uint64(jc.FinishedJobs))
+	for k, v := range jc.Annotations {
+		k, v := k, v
+		e.message(8, func() error {
+			e.string(1, k)
+			e.string(2, v)
+			return nil
+		})
+	}
+	if jc.Deadline != nil {
+		e.tag(9, wireVarint)
+		e.varint(uint64(jc.Deadline.UnixNano()))
+	}
+	e.string(10, jc.CorrelationId)
+	e.string(11, jc.StopTimeout)
+	e.uint(12, jc.FenceToken)
+	if jc.RetryBudget != nil {
+		e.message(13, func() error {
+			e.uint(1, uint64(jc.RetryBudget.JobRetries))
+			e.uint(2, uint64(jc.RetryBudget.SequenceRetries))
+			return nil
+		})
+	}
+	return nil
+}
+
+func (e *pbEncoder) job(job Job) error {
+	e.string(1, job.Id)
+	e.string(2, job.Name)
+	e.string(3, job.Type)
+	e.bytes(4, job.Bytes)
+	e.uint(5, uint64(job.State))
+	if len(job.Args) > 0 {
+		if err := e.message(6, func() error { return e.fields(job.Args) }); err != nil {
+			return fmt.Errorf("job %s args: %s", job.Id, err)
+		}
+	}
+	if len(job.Data) > 0 {
+		if err := e.message(7, func() error { return e.fields(job.Data) }); err != nil {
+			return fmt.Errorf("job %s data: %s", job.Id, err)
+		}
+	}
+	e.uint(8, uint64(job.Retry))
+	e.string(9, job.RetryWait)
+	e.string(10, job.SequenceId)
+	e.uint(11, uint64(job.SequenceRetry))
+	e.string(12, job.SequenceRetryWait)
+	e.uint(13, uint64(job.Cost))
+	e.bool(14, job.RunAfterFail)
+	e.bool(15, job.Skippable)
+	if len(job.SkipData) > 0 {
+		if err := e.message(16, func() error { return e.fields(job.SkipData) }); err != nil {
+			return fmt.Errorf("job %s skip data: %s", job.Id, err)
+		}
+	}
+	return nil
+}
+
+func (e *pbEncoder) suspendedJobChain(sjc SuspendedJobChain) error {
+	e.uint(1, uint64(JOB_CHAIN_SCHEMA_VERSION))
+	e.string(2, sjc.RequestId)
+	if sjc.JobChain != nil {
+		if err := e.message(3, func() error { return e.jobChain(*sjc.JobChain) }); err != nil {
+			return err
+		}
+	}
+	e.uintMap(4, sjc.TotalJobTries)
+	e.uintMap(5, sjc.LatestRunJobTries)
+	e.uintMap(6, sjc.SequenceTries)
+	for k, v := range sjc.Scratch {
+		k, v := k, v
+		e.message(7, func() error {
+			e.string(1, k)
+			e.bytes(2, v)
+			return nil
+		})
+	}
+	e.string(8, sjc.JobRunnerURL)
+	e.uint(9, uint64(sjc.JobRetries))
+	e.uint(10, uint64(sjc.SequenceRetries))
+	return nil
+}
+
+func (e *pbEncoder) uintMap(field int, m map[string]uint) {
+	for k, v := range m {
+		k, v := k, v
+		e.message(field, func() error {
+			e.string(1, k)
+			e.uint(2, uint64(v))
+			return nil
+		})
+	}
+}
+
+// --------------------------------------------------------------------------
+// Decoding
+// --------------------------------------------------------------------------
+
+var errTruncated = errors.New("truncated protobuf")
+
+type pbDecoder struct {
+	b []byte
+	i int
+}
+
+func (d *pbDecoder) more() bool {
+	return d.i < len(d.b)
+}
+
+func (d *pbDecoder) varint() (uint64, error) {
+	var v uint64
+	for shift := uint(0); shift < 64; shift += 7 {
+		if d.i >= len(d.b) {
+			return 0, errTruncated
+		}
+		c := d.b[d.i]
+		d.i++
+		v |= uint64(c&0x7f) << shift
+		if c < 0x80 {
+			return v, nil
+		}
+	}
+	return 0, errors.New("invalid protobuf varint")
+}
+
+func (d *pbDecoder) next() (field int, wire int, err error) {
+	v, err := d.varint()
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(v >> 3), int(v & 7), nil
+}
+
+func (d *pbDecoder) bytes() ([]byte, error) {
+	n, err := d.varint()
+	if err != nil {
+		return nil, err
+	}
+	if n > uint64(len(d.b)-d.i) {
+		return nil, errTruncated
+	}
+	b := d.b[d.i : d.i+int(n)]
+	d.i += int(n)
+	return b, nil
+}
+
+func (d *pbDecoder) string() (string, error) {
+	b, err := d.bytes()
+	return string(b), err
+}
+
+// skip skips the value of an unknown field, so fields added by newer versions
+// are ignored like unknown JSON fields.
+func (d *pbDecoder) skip(wire int) error {
+	switch wire {
+	case wireVarint:
+		_, err := d.varint()
+		return err
+	case wireBytes:
+		_, err := d.bytes()
+		return err
+	case wire64:
+		d.i += 8
+	case wire32:
+		d.i += 4
+	default:
+		return fmt.Errorf("unsupported protobuf wire type %d", wire)
+	}
+	if d.i > len(d.b) {
+		return errTruncated
+	}
+	return nil
+}
+
+// decodeFields calls f for each field in data until f returns an error.
+// Field values are read by f; unknown fields must be skipped by f.
+func decodeFields(data []byte, f func(d *pbDecoder, field, wire int) error) error {
+	d := &pbDecoder{b: data}
+	for d.more() {
+		field, wire, err := d.next()
+		if err != nil {
+			return err
+		}
+		if err := f(d, field, wire); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keyValue decodes a map entry: key (field 1) and the bytes of value (field 2).
+// The value is nil if it is a varint; use keyUint for those.
+func keyValue(data []byte) (key string, value []byte, err error) {
+	err = decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		var err error
+		switch {
+		case field == 1 && wire == wireBytes:
+			key, err = d.string()
+		case field == 2 && wire == wireBytes:
+			value, err = d.bytes()
+		default:
+			err = d.skip(wire)
+		}
+		return err
+	})
+	return
+}
+
+func keyUint(data []byte) (key string, value uint64, err error) {
+	err = decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		var err error
+		switch {
+		case field == 1 && wire == wireBytes:
+			key, err = d.string()
+		case field == 2 && wire == wireVarint:
+			value, err = d.varint()
+		default:
+			err = d.skip(wire)
+		}
+		return err
+	})
+	return
+}
+
+func checkSchemaVersion(v uint64) error {
+	if v > uint64(JOB_CHAIN_SCHEMA_VERSION) {
+		return fmt.Errorf("job chain schema version %d is newer than supported version %d: the sender must set job_chain_schema_version = %d until all Request Managers and Job Runners are upgraded",
+			v, JOB_CHAIN_SCHEMA_VERSION, JOB_CHAIN_SCHEMA_VERSION)
+	}
+	return nil
+}
+
+func decodeJobChain(data []byte, jc *JobChain) error {
+	return decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		if wire == wireVarint {
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			switch field {
+			case 1:
+				return checkSchemaVersion(v)
+			case 6:
+				jc.State = byte(v)
+			case 7:
+				jc.FinishedJobs = uint(v)
+			case 9:
+				t := time.Unix(0, int64(v))
+				jc.Deadline = &t
+			case 12:
+				jc.FenceToken = v
+			}
+			return nil
+		}
+		if wire != wireBytes {
+			return d.skip(wire)
+		}
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 2:
+			jc.RequestId = string(b)
+		case 3:
+			jc.RequestType = string(b)
+		case 4:
+			id, v, err := keyValue(b)
+			if err != nil {
+				return err
+			}
+			var job Job
+			if err := decodeJob(v, &job); err != nil {
+				return fmt.Errorf("job %s: %s", id, err)
+			}
+			if jc.Jobs == nil {
+				jc.Jobs = map[string]Job{}
+			}
+			jc.Jobs[id] = job
+		case 5:
+			id, v, err := keyValue(b)
+			if err != nil {
+				return err
+			}
+			next := []string{}
+			err = decodeFields(v, func(d *pbDecoder, field, wire int) error {
+				if field != 1 || wire != wireBytes {
+					return d.skip(wire)
+				}
+				s, err := d.string()
+				next = append(next, s)
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			if jc.AdjacencyList == nil {
+				jc.AdjacencyList = map[string][]string{}
+			}
+			jc.AdjacencyList[id] = next
+		case 8:
+			k, v, err := keyValue(b)
+			if err != nil {
+				return err
+			}
+			if jc.Annotations == nil {
+				jc.Annotations = map[string]string{}
+			}
+			jc.Annotations[k] = string(v)
+		case 10:
+			jc.CorrelationId = string(b)
+		case 11:
+			jc.StopTimeout = string(b)
+		case 13:
+			rb := &RetryBudget{}
+			err := decodeFields(b, func(d *pbDecoder, field, wire int) error {
+				if wire != wireVarint {
+					return d.skip(wire)
+				}
+				v, err := d.varint()
+				switch field {
+				case 1:
+					rb.JobRetries = uint(v)
+				case 2:
+					rb.SequenceRetries = uint(v)
+				}
+				return err
+			})
+			if err != nil {
+				return err
+			}
+			jc.RetryBudget = rb
+		}
+		return nil
+	})
+}
+
+// decodeStruct decodes a Struct encoded by pbEncoder.fields.
+func decodeStruct(data []byte) (map[string]interface{}, error) {
+	m := map[string]interface{}{}
+	err := decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		if field != 1 || wire != wireBytes {
+			return d.skip(wire)
+		}
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		k, vb, err := keyValue(b)
+		if err != nil {
+			return err
+		}
+		v, err := decodeValue(vb)
+		if err != nil {
+			return fmt.Errorf("%s: %s", k, err)
+		}
+		m[k] = v
+		return nil
+	})
+	return m, err
+}
+
+// decodeValue decodes a Value encoded by pbEncoder.value.
+func decodeValue(data []byte) (interface{}, error) {
+	var v interface{}
+	err := decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		var err error
+		switch {
+		case field == 1 && wire == wireVarint:
+			_, err = d.varint()
+			v = nil
+		case field == 2 && wire == wire64:
+			if len(d.b)-d.i < 8 {
+				return errTruncated
+			}
+			v = math.Float64frombits(binary.LittleEndian.Uint64(d.b[d.i:]))
+			d.i += 8
+		case field == 3 && wire == wireBytes:
+			v, err = d.string()
+		case field == 4 && wire == wireVarint:
+			var b uint64
+			b, err = d.varint()
+			v = b != 0
+		case field == 5 && wire == wireBytes:
+			var b []byte
+			if b, err = d.bytes(); err != nil {
+				return err
+			}
+			list := []interface{}{}
+			err = decodeFields(b, func(d *pbDecoder, field, wire int) error {
+				if field != 1 || wire != wireBytes {
+					return d.skip(wire)
+				}
+				b, err := d.bytes()
+				if err != nil {
+					return err
+				}
+				elem, err := decodeValue(b)
+				list = append(list, elem)
+				return err
+			})
+			v = list
+		case field == 6 && wire == wireBytes:
+			var b []byte
+			if b, err = d.bytes(); err != nil {
+				return err
+			}
+			v, err = decodeStruct(b)
+		case field == 7 && wire == wireBytes:
+			var b []byte
+			if b, err = d.bytes(); err != nil {
+				return err
+			}
+			err = json.Unmarshal(b, &v)
+		default:
+			err = d.skip(wire)
+		}
+		return err
+	})
+	return v, err
+}
+
+func decodeJob(data []byte, job *Job) error {
+	return decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		if wire == wireVarint {
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			switch field {
+			case 5:
+				job.State = byte(v)
+			case 8:
+				job.Retry = uint(v)
+			case 11:
+				job.SequenceRetry = uint(v)
+			case 13:
+				job.Cost = uint(v)
+			case 14:
+				job.RunAfterFail = v != 0
+			case 15:
+				job.Skippable = v != 0
+			}
+			return nil
+		}
+		if wire != wireBytes {
+			return d.skip(wire)
+		}
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 1:
+			job.Id = string(b)
+		case 2:
+			job.Name = string(b)
+		case 3:
+			job.Type = string(b)
+		case 4:
+			job.Bytes = append([]byte(nil), b...)
+		case 6:
+			if job.Args, err = decodeStruct(b); err != nil {
+				return fmt.Errorf("args: %s", err)
+			}
+		case 7:
+			if job.Data, err = decodeStruct(b); err != nil {
+				return fmt.Errorf("data: %s", err)
+			}
+		case 9:
+			job.RetryWait = string(b)
+		case 10:
+			job.SequenceId = string(b)
+		case 12:
+			job.SequenceRetryWait = string(b)
+		case 16:
+			if job.SkipData, err = decodeStruct(b); err != nil {
+				return fmt.Errorf("skip data: %s", err)
+			}
+		}
+		return nil
+	})
+}
+
+func decodeSuspendedJobChain(data []byte, sjc *SuspendedJobChain) error {
+	return decodeFields(data, func(d *pbDecoder, field, wire int) error {
+		if wire == wireVarint {
+			v, err := d.varint()
+			if err != nil {
+				return err
+			}
+			switch field {
+			case 1:
+				return checkSchemaVersion(v)
+			case 9:
+				sjc.JobRetries = uint(v)
+			case 10:
+				sjc.SequenceRetries = uint(v)
+			}
+			return nil
+		}
+		if wire != wireBytes {
+			return d.skip(wire)
+		}
+		b, err := d.bytes()
+		if err != nil {
+			return err
+		}
+		switch field {
+		case 2:
+			sjc.RequestId = string(b)
+		case 3:
+			jc := &JobChain{}
+			if err := decodeJobChain(b, jc); err != nil {
+				return err
+			}
+			sjc.JobChain = jc
+		case 4, 5, 6:
+			k, v, err := keyUint(b)
+			if err != nil {
+				return err
+			}
+			var m *map[string]uint
+			switch field {
+			case 4:
+				m = &sjc.TotalJobTries
+			case 5:
+				m = &sjc.LatestRunJobTries
+			case 6:
+				m = &sjc.SequenceTries
+			}
+			if *m == nil {
+				*m = map[string]uint{}
+			}
+			(*m)[k] = uint(v)
+		case 7:
+			k, v, err := keyValue(b)
+			if err != nil {
+				return err
+			}
+			if sjc.Scratch == nil {
+				sjc.Scratch = map[string][]byte{}
+			}
+			sjc.Scratch[k] = append([]byte(nil), v...)
+		case 8:
+			sjc.JobRunnerURL = string(b)
+		}
+		return nil
+	})
+}
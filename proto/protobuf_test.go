@@ -0,0 +1,269 @@
+// Copyright 2020, Square, Inc.
+
+package proto_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+func testJobChain() proto.JobChain {
+	deadline := time.Date(2020, 1, 2, 3, 4, 5, 6, time.Local)
+	return proto.JobChain{
+		RequestId:   "abc",
+		RequestType: "restart-db",
+		Jobs: map[string]proto.Job{
+			"job1": {
+				Id:                "job1",
+				Name:              "stop",
+				Type:              "mysql/stop",
+				Bytes:             []byte{0, 1, 2},
+				State:             proto.STATE_PENDING,
+				Args:              map[string]interface{}{"host": "db1", "port": float64(3306), "hosts": []interface{}{"a", "b"}},
+				Data:              map[string]interface{}{"pid": float64(123)},
+				Retry:             2,
+				RetryWait:         "3s",
+				SequenceId:        "job1",
+				SequenceRetry:     1,
+				SequenceRetryWait: "10s",
+				Cost:              5,
+				RunAfterFail:      true,
+				Skippable:         true,
+				SkipData:          map[string]interface{}{"host": "db2"},
+			},
+			"job2": {Id: "job2", Type: "mysql/start", SequenceId: "job1"},
+		},
+		AdjacencyList: map[string][]string{"job1": {"job2"}},
+		State:         proto.STATE_RUNNING,
+		FinishedJobs:  1,
+		Annotations:   map[string]string{"team": "dba"},
+		Deadline:      &deadline,
+		CorrelationId: "build-1",
+		StopTimeout:   "1m",
+		FenceToken:    3,
+		RetryBudget:   &proto.RetryBudget{JobRetries: 10, SequenceRetries: 2},
+	}
+}
+
+func TestProtobufJobChain(t *testing.T) {
+	jc := testJobChain()
+	data, err := proto.EncodeJobChain(jc, proto.CHAIN_FORMAT_PROTOBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got proto.JobChain
+	if err := proto.DecodeJobChain(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, jc); diff != nil {
+		t.Error(diff)
+	}
+
+	// JSON is detected and decoded too
+	data, err = proto.EncodeJobChain(jc, proto.CHAIN_FORMAT_JSON)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got = proto.JobChain{}
+	if err := proto.DecodeJobChain(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, jc); diff != nil {
+		t.Error(diff)
+	}
+
+	// Truncated is an error, not a partial chain
+	data, _ = proto.EncodeJobChain(jc, proto.CHAIN_FORMAT_PROTOBUF)
+	if err := proto.DecodeJobChain(data[:len(data)/2], &got); err == nil {
+		t.Error("no error decoding truncated job chain, expected an error")
+	}
+}
+
+func TestProtobufSuspendedJobChain(t *testing.T) {
+	jc := testJobChain()
+	sjc := proto.SuspendedJobChain{
+		RequestId:         "abc",
+		JobChain:          &jc,
+		TotalJobTries:     map[string]uint{"job1": 3, "job2": 1},
+		LatestRunJobTries: map[string]uint{"job1": 2},
+		SequenceTries:     map[string]uint{"job1": 2},
+		Scratch:           map[string][]byte{"k": []byte("v")},
+		JobRunnerURL:      "http://jr2",
+		JobRetries:        4,
+		SequenceRetries:   1,
+	}
+	data, err := proto.EncodeSuspendedJobChain(sjc, proto.CHAIN_FORMAT_PROTOBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got proto.SuspendedJobChain
+	if err := proto.DecodeSuspendedJobChain(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, sjc); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestProtobufArgs(t *testing.T) {
+	// Args are decoded like JSON: numbers are float64, slices are []interface{},
+	// and other types are decoded from JSON
+	type hostPort struct {
+		Host string `json:"host"`
+		Port int    `json:"port"`
+	}
+	jc := proto.JobChain{
+		RequestId: "abc",
+		Jobs: map[string]proto.Job{
+			"job1": {
+				Id: "job1",
+				Args: map[string]interface{}{
+					"count": 3,
+					"hosts": []string{"db1", "db2"},
+					"empty": "",
+					"none":  nil,
+					"addr":  hostPort{Host: "db1", Port: 3306},
+					"opts":  map[string]interface{}{"force": false, "list": []interface{}{}},
+				},
+			},
+		},
+	}
+	expect := map[string]interface{}{
+		"count": float64(3),
+		"hosts": []interface{}{"db1", "db2"},
+		"empty": "",
+		"none":  nil,
+		"addr":  map[string]interface{}{"host": "db1", "port": float64(3306)},
+		"opts":  map[string]interface{}{"force": false, "list": []interface{}{}},
+	}
+	for _, format := range []string{proto.CHAIN_FORMAT_JSON, proto.CHAIN_FORMAT_PROTOBUF} {
+		data, err := proto.EncodeJobChain(jc, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got proto.JobChain
+		if err := proto.DecodeJobChain(data, &got); err != nil {
+			t.Fatal(err)
+		}
+		if diff := deep.Equal(got.Jobs["job1"].Args, expect); diff != nil {
+			t.Errorf("%s: %v", format, diff)
+		}
+	}
+}
+
+func TestProtobufSchemaVersion(t *testing.T) {
+	// Newer version is an error: field 1 (varint) = current version + 1
+	data := []byte{0x08, byte(proto.JOB_CHAIN_SCHEMA_VERSION + 1)}
+	var jc proto.JobChain
+	if err := proto.DecodeJobChain(data, &jc); err == nil {
+		t.Error("no error decoding newer schema version, expected an error")
+	}
+
+	// Unknown fields are ignored: field 99 (varint) and field 100 (bytes)
+	data = []byte{0x08, byte(proto.JOB_CHAIN_SCHEMA_VERSION), 0x98, 0x06, 0x01, 0xa2, 0x06, 0x02, 'h', 'i', 0x12, 0x03, 'a', 'b', 'c'}
+	jc = proto.JobChain{}
+	if err := proto.DecodeJobChain(data, &jc); err != nil {
+		t.Fatal(err)
+	}
+	if jc.RequestId != "abc" {
+		t.Errorf("got request id %s, expected abc", jc.RequestId)
+	}
+}
+
+func TestChainFormat(t *testing.T) {
+	defer func() {
+		proto.SetChainFormat(proto.CHAIN_FORMAT_JSON)
+		proto.SetEncodeSchemaVersion(proto.JOB_CHAIN_SCHEMA_VERSION)
+	}()
+
+	if err := proto.SetChainFormat("xml"); err == nil {
+		t.Error("no error setting format xml, expected an error")
+	}
+	if err := proto.SetChainFormat(proto.CHAIN_FORMAT_PROTOBUF); err != nil {
+		t.Fatal(err)
+	}
+	if got := proto.ChainFormat(); got != proto.CHAIN_FORMAT_PROTOBUF {
+		t.Errorf("got format %s, expected %s", got, proto.CHAIN_FORMAT_PROTOBUF)
+	}
+	if got := proto.ContentType(proto.ChainFormat()); got != proto.CONTENT_TYPE_PROTOBUF {
+		t.Errorf("got content type %s, expected %s", got, proto.CONTENT_TYPE_PROTOBUF)
+	}
+
+	// Encoding as a previous schema version requires JSON
+	if err := proto.SetEncodeSchemaVersion(0); err != nil {
+		t.Fatal(err)
+	}
+	if got := proto.ChainFormat(); got != proto.CHAIN_FORMAT_JSON {
+		t.Errorf("got format %s with previous schema version, expected %s", got, proto.CHAIN_FORMAT_JSON)
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// wideJobChain returns a job chain with n jobs that have args and data like
+// real jobs.
+func wideJobChain(n int) proto.JobChain {
+	jc := proto.JobChain{
+		RequestId:     "b9uvdi8tk9kahl8ppvbg",
+		RequestType:   "restart-cluster",
+		Jobs:          make(map[string]proto.Job, n),
+		AdjacencyList: make(map[string][]string, n),
+		State:         proto.STATE_RUNNING,
+	}
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("job%05d", i)
+		jc.Jobs[id] = proto.Job{
+			Id:         id,
+			Name:       "restart-host",
+			Type:       "mysql/restart-host",
+			State:      proto.STATE_PENDING,
+			Args:       map[string]interface{}{"cluster": "db-cluster-001", "host": fmt.Sprintf("db%05d.example.com", i), "port": float64(3306)},
+			Data:       map[string]interface{}{"replicas": []interface{}{"r1", "r2"}},
+			Retry:      2,
+			RetryWait:  "5s",
+			SequenceId: "job00000",
+		}
+		if i > 0 {
+			jc.AdjacencyList["job00000"] = append(jc.AdjacencyList["job00000"], id)
+		}
+	}
+	return jc
+}
+
+func benchmarkEncode(b *testing.B, format string) {
+	jc := wideJobChain(10000)
+	b.ResetTimer()
+	var data []byte
+	for i := 0; i < b.N; i++ {
+		var err error
+		data, err = proto.EncodeJobChain(jc, format)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(len(data)), "bytes/chain")
+}
+
+func benchmarkDecode(b *testing.B, format string) {
+	data, err := proto.EncodeJobChain(wideJobChain(10000), format)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var jc proto.JobChain
+		if err := proto.DecodeJobChain(data, &jc); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncodeJobChainJSON(b *testing.B)     { benchmarkEncode(b, proto.CHAIN_FORMAT_JSON) }
+func BenchmarkEncodeJobChainProtobuf(b *testing.B) { benchmarkEncode(b, proto.CHAIN_FORMAT_PROTOBUF) }
+func BenchmarkDecodeJobChainJSON(b *testing.B)     { benchmarkDecode(b, proto.CHAIN_FORMAT_JSON) }
+func BenchmarkDecodeJobChainProtobuf(b *testing.B) { benchmarkDecode(b, proto.CHAIN_FORMAT_PROTOBUF) }
@@ -0,0 +1,194 @@
+// Copyright 2020, Square, Inc.
+
+package proto
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+)
+
+// JobChain and SuspendedJobChain are serialized (JSON), sent between Request
+// Managers and Job Runners, and saved in the database. Serialized chains have
+// a "schemaVersion" so that a Request Manager and Job Runner one version apart
+// can decode each other's chains during a rolling upgrade.
+//
+// When the serialized format changes, increment JOB_CHAIN_SCHEMA_VERSION and
+// append a SchemaMigration. Chains are migrated up to JOB_CHAIN_SCHEMA_VERSION
+// when decoded, and migrated down to the encode version (see SetEncodeSchemaVersion)
+// when encoded. The schema version is not a field of the structs; it only exists
+// in the serialized chains.
+const JOB_CHAIN_SCHEMA_VERSION uint = 1
+
+// A SchemaMigration changes a serialized JobChain or SuspendedJobChain, decoded
+// into a map, between adjacent schema versions: up from Version-1 to Version,
+// or down from Version to Version-1. A nil func means no change.
+type SchemaMigration struct {
+	Version  uint
+	JobChain struct {
+		Up   func(map[string]interface{}) error
+		Down func(map[string]interface{}) error
+	}
+	SuspendedJobChain struct {
+		Up   func(map[string]interface{}) error
+		Down func(map[string]interface{}) error
+	}
+}
+
+// SchemaMigrations are all schema migrations, in version order. Version 0 is
+// chains serialized before schema versions, which are the same as version 1
+// without "schemaVersion".
+var SchemaMigrations = []SchemaMigration{
+	{Version: 1},
+}
+
+// encodeVersion is the schema version that chains are encoded as.
+var encodeVersion = JOB_CHAIN_SCHEMA_VERSION
+
+// SetEncodeSchemaVersion sets the schema version that JobChain and SuspendedJobChain
+// are encoded as. The default is JOB_CHAIN_SCHEMA_VERSION. During a rolling upgrade
+// that increments the schema version, upgraded instances should encode chains as
+// the previous version until all instances are upgraded. It is not safe to call
+// while chains are being encoded; call it once on boot.
+func SetEncodeSchemaVersion(v uint) error {
+	if v > JOB_CHAIN_SCHEMA_VERSION {
+		return fmt.Errorf("job chain schema version %d is greater than current version %d", v, JOB_CHAIN_SCHEMA_VERSION)
+	}
+	encodeVersion = v
+	return nil
+}
+
+// EncodeSchemaVersion returns the schema version that chains are encoded as.
+func EncodeSchemaVersion() uint {
+	return encodeVersion
+}
+
+// jobChain and suspendedJobChain have the same fields as JobChain and
+// SuspendedJobChain but not their MarshalJSON and UnmarshalJSON methods.
+type jobChain JobChain
+type suspendedJobChain SuspendedJobChain
+
+// versionedJobChain and versionedSuspendedJobChain encode a chain as the current
+// version: its fields are inlined after "schemaVersion".
+type versionedJobChain struct {
+	SchemaVersion uint `json:"schemaVersion"`
+	*jobChain
+}
+
+type versionedSuspendedJobChain struct {
+	SchemaVersion uint `json:"schemaVersion"`
+	*suspendedJobChain
+}
+
+func (jc JobChain) MarshalJSON() ([]byte, error) {
+	v := jobChain(jc)
+	return marshalVersioned(v, versionedJobChain{JOB_CHAIN_SCHEMA_VERSION, &v}, jobChainDown)
+}
+
+func (jc *JobChain) UnmarshalJSON(data []byte) error {
+	return unmarshalVersioned(data, (*jobChain)(jc), jobChainUp)
+}
+
+func (sjc SuspendedJobChain) MarshalJSON() ([]byte, error) {
+	v := suspendedJobChain(sjc)
+	return marshalVersioned(v, versionedSuspendedJobChain{JOB_CHAIN_SCHEMA_VERSION, &v}, sjcDown)
+}
+
+func (sjc *SuspendedJobChain) UnmarshalJSON(data []byte) error {
+	return unmarshalVersioned(data, (*suspendedJobChain)(sjc), sjcUp)
+}
+
+func jobChainUp(m SchemaMigration) func(map[string]interface{}) error   { return m.JobChain.Up }
+func jobChainDown(m SchemaMigration) func(map[string]interface{}) error { return m.JobChain.Down }
+func sjcUp(m SchemaMigration) func(map[string]interface{}) error        { return m.SuspendedJobChain.Up }
+func sjcDown(m SchemaMigration) func(map[string]interface{}) error      { return m.SuspendedJobChain.Down }
+
+// marshalVersioned encodes v (a jobChain or suspendedJobChain) as the encode
+// version, migrating down from the current version if needed. current is v
+// wrapped with the current schema version, which is encoded as-is if the encode
+// version is the current version.
+func marshalVersioned(v, current interface{}, down func(SchemaMigration) func(map[string]interface{}) error) ([]byte, error) {
+	if encodeVersion == JOB_CHAIN_SCHEMA_VERSION {
+		return json.Marshal(current) // fast path: current version
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	m, err := decodeMap(data)
+	if err != nil {
+		return nil, err
+	}
+	for i := len(SchemaMigrations) - 1; i >= 0; i-- {
+		mg := SchemaMigrations[i]
+		if mg.Version <= encodeVersion || mg.Version > JOB_CHAIN_SCHEMA_VERSION {
+			continue
+		}
+		if f := down(mg); f != nil {
+			if err := f(m); err != nil {
+				return nil, fmt.Errorf("job chain schema migration from version %d to %d: %s", mg.Version, mg.Version-1, err)
+			}
+		}
+	}
+	if encodeVersion > 0 {
+		m["schemaVersion"] = encodeVersion
+	}
+	return json.Marshal(m)
+}
+
+// unmarshalVersioned decodes data into v (a *jobChain or *suspendedJobChain),
+// migrating up to the current version if needed. It returns an error if data
+// is a newer version.
+func unmarshalVersioned(data []byte, v interface{}, up func(SchemaMigration) func(map[string]interface{}) error) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil // no-op like encoding/json
+	}
+	var hdr struct {
+		SchemaVersion uint `json:"schemaVersion"`
+	}
+	if err := json.Unmarshal(data, &hdr); err != nil {
+		return err
+	}
+	if hdr.SchemaVersion > JOB_CHAIN_SCHEMA_VERSION {
+		return fmt.Errorf("job chain schema version %d is newer than supported version %d: the sender must set job_chain_schema_version = %d until all Request Managers and Job Runners are upgraded",
+			hdr.SchemaVersion, JOB_CHAIN_SCHEMA_VERSION, JOB_CHAIN_SCHEMA_VERSION)
+	}
+	if hdr.SchemaVersion == JOB_CHAIN_SCHEMA_VERSION {
+		return json.Unmarshal(data, v) // fast path: current version
+	}
+
+	m, err := decodeMap(data)
+	if err != nil {
+		return err
+	}
+	for _, mg := range SchemaMigrations {
+		if mg.Version <= hdr.SchemaVersion || mg.Version > JOB_CHAIN_SCHEMA_VERSION {
+			continue
+		}
+		if f := up(mg); f != nil {
+			if err := f(m); err != nil {
+				return fmt.Errorf("job chain schema migration from version %d to %d: %s", mg.Version-1, mg.Version, err)
+			}
+		}
+	}
+	data, err = json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// decodeMap decodes a JSON object into a map, keeping numbers as json.Number
+// so large integers are not changed by a migration.
+func decodeMap(data []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var m map[string]interface{}
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if m == nil {
+		m = map[string]interface{}{}
+	}
+	return m, nil
+}
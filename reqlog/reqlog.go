@@ -0,0 +1,170 @@
+// Copyright 2020, Square, Inc.
+
+// Package reqlog provides request loggers. A request logger logs like the
+// standard logger unless the request log level is elevated, which makes it log
+// more (like debug logging) for only that request until the elevation expires.
+// Request Managers and Job Runners use request loggers for request logs, so an
+// operator can get detailed logs for one request without changing the log level
+// of all requests.
+package reqlog
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DEFAULT_DURATION is how long a request log level is elevated if no
+	// duration is given.
+	DEFAULT_DURATION = 15 * time.Minute
+
+	// MAX_DURATION is the longest a request log level can be elevated.
+	MAX_DURATION = 24 * time.Hour
+)
+
+type request struct {
+	logger  *log.Logger
+	until   time.Time   // elevated until, zero if not elevated
+	timer   *time.Timer // resets the level at until
+	running bool        // job chain running (Acquire)
+}
+
+var (
+	mux      = &sync.Mutex{}
+	requests = map[string]*request{} // only elevated and running requests
+)
+
+// Parse parses and validates a log level and duration. An empty duration is
+// DEFAULT_DURATION.
+func Parse(level, duration string) (log.Level, time.Duration, error) {
+	l, err := log.ParseLevel(level)
+	if err != nil {
+		return 0, 0, err
+	}
+	d := DEFAULT_DURATION
+	if duration != "" {
+		d, err = time.ParseDuration(duration)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid duration %s: %s", duration, err)
+		}
+		if d <= 0 || d > MAX_DURATION {
+			return 0, 0, fmt.Errorf("invalid duration %s: must be greater than zero and at most %s", duration, MAX_DURATION)
+		}
+	}
+	return l, d, nil
+}
+
+// Entry returns a log entry for the request. It logs at the request log level:
+// the standard logger level, or the elevated level.
+func Entry(requestId string) *log.Entry {
+	mux.Lock()
+	defer mux.Unlock()
+	if r, ok := requests[requestId]; ok {
+		return log.NewEntry(r.logger)
+	}
+	return log.NewEntry(log.StandardLogger())
+}
+
+// Acquire returns a log entry for a request whose job chain is running, which
+// logs at the request log level for the life of the chain, even if the level
+// is elevated after Acquire. The caller must call Release when the chain is done.
+func Acquire(requestId string) *log.Entry {
+	mux.Lock()
+	defer mux.Unlock()
+	r := get(requestId)
+	r.running = true
+	return log.NewEntry(r.logger)
+}
+
+// Release releases a request acquired by Acquire. The request log level stays
+// elevated until it expires.
+func Release(requestId string) {
+	mux.Lock()
+	defer mux.Unlock()
+	r, ok := requests[requestId]
+	if !ok {
+		return
+	}
+	r.running = false
+	if r.until.IsZero() {
+		delete(requests, requestId)
+	}
+}
+
+// Elevate sets the request log level for duration d and returns when the
+// elevation expires. If level is not more verbose than the standard logger
+// level, the request log level is reset and the returned time is zero.
+func Elevate(requestId string, level log.Level, d time.Duration) time.Time {
+	mux.Lock()
+	defer mux.Unlock()
+	if level <= log.GetLevel() {
+		reset(requestId)
+		return time.Time{}
+	}
+	r := get(requestId)
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.until = time.Now().Add(d).UTC()
+	r.logger.SetLevel(level)
+	r.timer = time.AfterFunc(d, func() {
+		mux.Lock()
+		defer mux.Unlock()
+		if cur, ok := requests[requestId]; ok && cur == r && !time.Now().Before(r.until) {
+			reset(requestId)
+		}
+	})
+	log.WithFields(log.Fields{"request_id": requestId}).Infof("log level elevated to %s until %s", level, r.until.Format(time.RFC3339))
+	return r.until
+}
+
+// Level returns the request log level and when its elevation expires, or the
+// standard logger level and zero time if it's not elevated.
+func Level(requestId string) (log.Level, time.Time) {
+	mux.Lock()
+	defer mux.Unlock()
+	if r, ok := requests[requestId]; ok && !r.until.IsZero() {
+		return r.logger.Level, r.until
+	}
+	return log.GetLevel(), time.Time{}
+}
+
+// get returns the request, creating it if needed. The caller must lock mux.
+func get(requestId string) *request {
+	if r, ok := requests[requestId]; ok {
+		return r
+	}
+	// Log like the standard logger, but at the request log level
+	std := log.StandardLogger()
+	r := &request{
+		logger: &log.Logger{
+			Out:       std.Out,
+			Hooks:     std.Hooks,
+			Formatter: std.Formatter,
+			Level:     log.GetLevel(),
+		},
+	}
+	requests[requestId] = r
+	return r
+}
+
+// reset resets the request log level to the standard logger level. The caller
+// must lock mux.
+func reset(requestId string) {
+	r, ok := requests[requestId]
+	if !ok {
+		return
+	}
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	r.until = time.Time{}
+	r.timer = nil
+	r.logger.SetLevel(log.GetLevel())
+	if !r.running {
+		delete(requests, requestId)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020, Square, Inc.
+
+package reqlog_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/reqlog"
+)
+
+func TestElevate(t *testing.T) {
+	var buf bytes.Buffer
+	std := log.StandardLogger()
+	defer log.SetOutput(std.Out)
+	log.SetOutput(&buf)
+	log.SetLevel(log.InfoLevel)
+
+	// Running chain (Acquire) logs at the request log level, even if elevated
+	// after the entry was made
+	req1 := reqlog.Acquire("req1")
+	req2 := reqlog.Acquire("req2")
+	defer reqlog.Release("req1")
+	defer reqlog.Release("req2")
+
+	until := reqlog.Elevate("req1", log.DebugLevel, time.Minute)
+	if until.IsZero() {
+		t.Fatal("until is zero, expected elevated until time")
+	}
+	req1.Debug("req1 debug")
+	req2.Debug("req2 debug")
+	reqlog.Entry("req1").Debug("req1 entry debug")
+	if !strings.Contains(buf.String(), "req1 debug") {
+		t.Errorf("req1 debug not logged, expected it to be logged")
+	}
+	if !strings.Contains(buf.String(), "req1 entry debug") {
+		t.Errorf("req1 entry debug not logged, expected it to be logged")
+	}
+	if strings.Contains(buf.String(), "req2 debug") {
+		t.Errorf("req2 debug logged, expected it not to be logged")
+	}
+	level, gotUntil := reqlog.Level("req1")
+	if level != log.DebugLevel || !gotUntil.Equal(until) {
+		t.Errorf("got level %s until %s, expected debug until %s", level, gotUntil, until)
+	}
+
+	// Level not more verbose than the standard level resets it
+	until = reqlog.Elevate("req1", log.InfoLevel, time.Minute)
+	if !until.IsZero() {
+		t.Errorf("until = %s, expected zero", until)
+	}
+	buf.Reset()
+	req1.Debug("req1 debug")
+	if buf.Len() > 0 {
+		t.Errorf("logged after reset: %s", buf.String())
+	}
+}
+
+func TestElevateExpires(t *testing.T) {
+	log.SetLevel(log.InfoLevel)
+
+	// Elevated request that is not running, like on the RM
+	reqlog.Elevate("req3", log.DebugLevel, 50*time.Millisecond)
+	if level, _ := reqlog.Level("req3"); level != log.DebugLevel {
+		t.Errorf("got level %s, expected debug", level)
+	}
+	time.Sleep(100 * time.Millisecond)
+	level, until := reqlog.Level("req3")
+	if level != log.InfoLevel || !until.IsZero() {
+		t.Errorf("got level %s until %s after expire, expected info until zero", level, until)
+	}
+}
+
+func TestParse(t *testing.T) {
+	level, d, err := reqlog.Parse("debug", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if level != log.DebugLevel || d != reqlog.DEFAULT_DURATION {
+		t.Errorf("got %s for %s, expected debug for %s", level, d, reqlog.DEFAULT_DURATION)
+	}
+
+	invalid := [][]string{
+		{"chatty", ""},
+		{"debug", "soon"},
+		{"debug", "0s"},
+		{"debug", "25h"},
+	}
+	for _, in := range invalid {
+		if _, _, err := reqlog.Parse(in[0], in[1]); err == nil {
+			t.Errorf("no error parsing %v, expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,270 @@
+// Copyright 2020, Square, Inc.
+
+// Package accesslog provides structured, sampled Request Manager API access logs.
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/config"
+)
+
+const (
+	// Value of scrubbed query parameters and request args
+	REDACTED = "REDACTED"
+
+	// Sink batches are sent when full or every SINK_FLUSH_INTERVAL. At most
+	// SINK_MAX_QUEUED entries are queued; more are dropped.
+	SINK_BATCH_SIZE     = 100
+	SINK_FLUSH_INTERVAL = 1 * time.Second
+	SINK_MAX_QUEUED     = 10000
+)
+
+// An Entry is one API request.
+type Entry struct {
+	Time       time.Time `json:"time"`                // when the API request was received
+	Caller     string    `json:"caller"`              // username (auth.Caller.Name or SetUsername hook)
+	Method     string    `json:"method"`              // HTTP method
+	Endpoint   string    `json:"endpoint"`            // route, like /api/v1/requests/:reqId
+	Path       string    `json:"path"`                // actual path, like /api/v1/requests/b9uvdi8tk9kahl8ppvbg
+	Query      string    `json:"query,omitempty"`     // scrubbed query string
+	Status     int       `json:"status"`              // HTTP status code
+	LatencyMs  float64   `json:"latencyMs"`           // time to handle the API request
+	RequestId  string    `json:"requestId,omitempty"` // Spin Cycle request ID, if any
+	RemoteAddr string    `json:"remoteAddr"`          // client IP
+}
+
+// A Logger logs API requests. It's safe for concurrent use.
+type Logger interface {
+	// Log logs the entry if it's sampled. Log scrubs Entry.Query, so the caller
+	// should set it to the raw query string.
+	Log(Entry)
+
+	// Stop sends queued entries to the sink, if any, and stops the logger.
+	// Entries logged after Stop are dropped.
+	Stop()
+}
+
+type logger struct {
+	dropped    int64 // atomic: entries dropped because the sink queue is full; first for 64-bit alignment
+	sampleRate float64
+	endpoints  map[string]float64
+	scrub      []string
+	// Sink
+	sinkURL    string
+	httpClient *http.Client
+	entries    chan Entry
+	stopChan   chan struct{}
+	doneChan   chan struct{}
+	stopOnce   *sync.Once
+}
+
+// NewLogger returns a Logger configured by cfg. If cfg.Sink.ServerURL is set,
+// entries are sent with httpClient, else they are logged with the standard logger.
+func NewLogger(cfg config.AccessLog, httpClient *http.Client) (Logger, error) {
+	if cfg.SampleRate < 0 || cfg.SampleRate > 1 {
+		return nil, fmt.Errorf("invalid sample_rate %f: must be between 0 and 1", cfg.SampleRate)
+	}
+	for endpoint, rate := range cfg.Endpoints {
+		if rate < 0 || rate > 1 {
+			return nil, fmt.Errorf("invalid sample rate %f for endpoint %s: must be between 0 and 1", rate, endpoint)
+		}
+		if len(strings.Fields(endpoint)) != 2 {
+			return nil, fmt.Errorf("invalid endpoint '%s': must be method and route, like 'GET /api/v1/status/running'", endpoint)
+		}
+	}
+	scrub := make([]string, len(cfg.Scrub))
+	for i, s := range cfg.Scrub {
+		scrub[i] = strings.ToLower(s)
+	}
+	l := &logger{
+		sampleRate: cfg.SampleRate,
+		endpoints:  cfg.Endpoints,
+		scrub:      scrub,
+		sinkURL:    cfg.Sink.ServerURL,
+		httpClient: httpClient,
+		stopOnce:   &sync.Once{},
+	}
+	if l.sinkURL != "" {
+		l.entries = make(chan Entry, SINK_MAX_QUEUED)
+		l.stopChan = make(chan struct{})
+		l.doneChan = make(chan struct{})
+		go l.send()
+	}
+	return l, nil
+}
+
+func (l *logger) Log(e Entry) {
+	if !l.sampled(e) {
+		return
+	}
+	e.Query = l.scrubQuery(e.Query)
+
+	if l.sinkURL == "" {
+		log.WithFields(log.Fields{
+			"caller":     e.Caller,
+			"method":     e.Method,
+			"endpoint":   e.Endpoint,
+			"path":       e.Path,
+			"query":      e.Query,
+			"status":     e.Status,
+			"latencyMs":  e.LatencyMs,
+			"requestId":  e.RequestId,
+			"remoteAddr": e.RemoteAddr,
+		}).Info("access")
+		return
+	}
+
+	select {
+	case <-l.stopChan:
+		// stopped
+	default:
+		select {
+		case l.entries <- e:
+		default:
+			atomic.AddInt64(&l.dropped, 1) // logged by send
+		}
+	}
+}
+
+func (l *logger) Stop() {
+	if l.sinkURL == "" {
+		return
+	}
+	l.stopOnce.Do(func() {
+		close(l.stopChan)
+		<-l.doneChan
+	})
+}
+
+// sampled returns true if the entry is logged. Errors are always logged.
+func (l *logger) sampled(e Entry) bool {
+	if e.Status >= 400 {
+		return true
+	}
+	rate := l.sampleRate
+	if r, ok := l.endpoints[e.Method+" "+e.Endpoint]; ok {
+		rate = r
+	}
+	switch rate {
+	case 0:
+		return false
+	case 1:
+		return true
+	}
+	return rand.Float64() < rate
+}
+
+// scrubQuery returns the query string with values of sensitive query parameters
+// and request args replaced with REDACTED. If the query string cannot be parsed,
+// only the parameter names are returned so no values are leaked.
+func (l *logger) scrubQuery(query string) string {
+	if query == "" || len(l.scrub) == 0 {
+		return query
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		names := []string{}
+		for _, kv := range strings.Split(query, "&") {
+			names = append(names, strings.SplitN(kv, "=", 2)[0]+"="+REDACTED)
+		}
+		return strings.Join(names, "&")
+	}
+	for name, vals := range values {
+		for i, v := range vals {
+			if l.sensitive(name) {
+				vals[i] = REDACTED
+				continue
+			}
+			// Request arg: arg=name=value
+			if name == "arg" {
+				p := strings.SplitN(v, "=", 2)
+				if len(p) == 2 && l.sensitive(p[0]) {
+					vals[i] = p[0] + "=" + REDACTED
+				}
+			}
+		}
+	}
+	return values.Encode()
+}
+
+func (l *logger) sensitive(name string) bool {
+	name = strings.ToLower(name)
+	for _, s := range l.scrub {
+		if s != "" && strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// send sends entries to the sink in batches until Stop is called, then it sends
+// the remaining queued entries.
+func (l *logger) send() {
+	defer close(l.doneChan)
+	ticker := time.NewTicker(SINK_FLUSH_INTERVAL)
+	defer ticker.Stop()
+	batch := make([]Entry, 0, SINK_BATCH_SIZE)
+	for {
+		select {
+		case e := <-l.entries:
+			batch = append(batch, e)
+			if len(batch) < SINK_BATCH_SIZE {
+				continue
+			}
+		case <-ticker.C:
+		case <-l.stopChan:
+			for {
+				select {
+				case e := <-l.entries:
+					batch = append(batch, e)
+					if len(batch) == SINK_BATCH_SIZE {
+						l.post(batch)
+						batch = batch[:0]
+					}
+				default:
+					l.post(batch)
+					return
+				}
+			}
+		}
+		l.post(batch)
+		batch = batch[:0]
+		if n := atomic.SwapInt64(&l.dropped, 0); n > 0 {
+			log.Warnf("access log sink: queue full (%d entries), dropped %d entries", SINK_MAX_QUEUED, n)
+		}
+	}
+}
+
+// post sends one batch to the sink. On error, the batch is dropped: access logs
+// are best effort and must not back up the API.
+func (l *logger) post(batch []Entry) {
+	if len(batch) == 0 {
+		return
+	}
+	data, err := json.Marshal(batch)
+	if err != nil {
+		log.Errorf("access log sink: error encoding %d entries: %s", len(batch), err)
+		return
+	}
+	resp, err := l.httpClient.Post(l.sinkURL, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Errorf("access log sink: error sending %d entries, dropped: %s", len(batch), err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		log.Errorf("access log sink: %s returned HTTP status %d, dropped %d entries", l.sinkURL, resp.StatusCode, len(batch))
+	}
+}
@@ -0,0 +1,120 @@
+// Copyright 2020, Square, Inc.
+
+package accesslog_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	"github.com/square/spincycle/v2/config"
+	"github.com/square/spincycle/v2/request-manager/accesslog"
+)
+
+// sink returns an HTTP sink that saves the entries it receives.
+func sink(t *testing.T) (*httptest.Server, func() []accesslog.Entry) {
+	var entries []accesslog.Entry
+	mux := &sync.Mutex{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var batch []accesslog.Entry
+		if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+			t.Errorf("sink: error decoding batch: %s", err)
+		}
+		mux.Lock()
+		entries = append(entries, batch...)
+		mux.Unlock()
+	}))
+	return ts, func() []accesslog.Entry {
+		mux.Lock()
+		defer mux.Unlock()
+		return entries
+	}
+}
+
+func TestSampling(t *testing.T) {
+	ts, got := sink(t)
+	defer ts.Close()
+
+	cfg := config.AccessLog{
+		SampleRate: 1,
+		Endpoints: map[string]float64{
+			"GET /api/v1/status/running": 0,
+		},
+		Sink: config.HTTPClient{ServerURL: ts.URL},
+	}
+	l, err := accesslog.NewLogger(cfg, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Log(accesslog.Entry{Method: "GET", Endpoint: "/api/v1/requests/:reqId", Status: 200, RequestId: "r1"})
+	l.Log(accesslog.Entry{Method: "GET", Endpoint: "/api/v1/status/running", Status: 200}) // not sampled
+	l.Log(accesslog.Entry{Method: "GET", Endpoint: "/api/v1/status/running", Status: 500}) // error, always logged
+	l.Stop()
+
+	entries := got()
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, expected 2: %+v", len(entries), entries)
+	}
+	if entries[0].RequestId != "r1" {
+		t.Errorf("got request ID %s, expected r1", entries[0].RequestId)
+	}
+	if entries[1].Status != 500 {
+		t.Errorf("got status %d, expected 500", entries[1].Status)
+	}
+}
+
+func TestScrub(t *testing.T) {
+	ts, got := sink(t)
+	defer ts.Close()
+
+	cfg := config.AccessLog{
+		SampleRate: 1,
+		Scrub:      []string{"password", "Token"},
+		Sink:       config.HTTPClient{ServerURL: ts.URL},
+	}
+	l, err := accesslog.NewLogger(cfg, &http.Client{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Log(accesslog.Entry{
+		Method:   "GET",
+		Endpoint: "/api/v1/requests",
+		Status:   200,
+		Query:    "type=restart-db&authToken=abc&arg=host=db1&arg=dbPassword=secret",
+	})
+	l.Stop()
+
+	entries := got()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, expected 1", len(entries))
+	}
+	q, err := url.ParseQuery(entries[0].Query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Get("type") != "restart-db" {
+		t.Errorf("type = %s, expected restart-db (not scrubbed)", q.Get("type"))
+	}
+	if q.Get("authToken") != accesslog.REDACTED {
+		t.Errorf("authToken = %s, expected %s", q.Get("authToken"), accesslog.REDACTED)
+	}
+	args := q["arg"]
+	if len(args) != 2 || args[0] != "host=db1" || args[1] != "dbPassword="+accesslog.REDACTED {
+		t.Errorf("args = %v, expected [host=db1 dbPassword=%s]", args, accesslog.REDACTED)
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	for _, cfg := range []config.AccessLog{
+		{SampleRate: 1.5},
+		{SampleRate: 1, Endpoints: map[string]float64{"GET /api/v1/requests": -1}},
+		{SampleRate: 1, Endpoints: map[string]float64{"/api/v1/requests": 0.5}},
+	} {
+		if _, err := accesslog.NewLogger(cfg, &http.Client{}); err == nil {
+			t.Errorf("no error for config %+v, expected an error", cfg)
+		}
+	}
+}
@@ -8,11 +8,20 @@ package api
 
 import (
 	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/url"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/labstack/echo/v4"
@@ -21,21 +30,84 @@ import (
 
 	serr "github.com/square/spincycle/v2/errors"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/accesslog"
 	"github.com/square/spincycle/v2/request-manager/app"
 	"github.com/square/spincycle/v2/request-manager/auth"
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/group"
 	"github.com/square/spincycle/v2/request-manager/joblog"
+	"github.com/square/spincycle/v2/request-manager/replica"
 	"github.com/square/spincycle/v2/request-manager/request"
 	"github.com/square/spincycle/v2/request-manager/status"
+	"github.com/square/spincycle/v2/request-manager/writebuf"
 	v "github.com/square/spincycle/v2/version"
 )
 
 const (
 	API_ROOT = "/api/v1/"
+
+	// BULK_GROUP_NAME is the request group name of a bulk create without a name.
+	BULK_GROUP_NAME = "bulk create"
+
+	// Header with the caller correlation ID for POST /requests
+	// (proto.CreateRequest.CorrelationId)
+	CORRELATION_ID_HEADER = "X-Correlation-Id"
+
+	// Response header of endpoints that can read from the read replica
+	// (config.ReadReplica): READ_FROM_PRIMARY or READ_FROM_REPLICA. Callers
+	// can send it with READ_FROM_PRIMARY to not read from the replica.
+	READ_FROM_HEADER  = "X-Spincycle-Read-From"
+	READ_FROM_PRIMARY = "primary"
+	READ_FROM_REPLICA = "replica"
+
+	// Response header with the replication lag in seconds, like "1", if
+	// READ_FROM_HEADER is READ_FROM_REPLICA.
+	REPLICA_LAG_HEADER = "X-Spincycle-Replica-Lag"
 )
 
 var (
 	// Error when Request Manager is shutting down and not starting new requests
 	ErrShuttingDown = errors.New("Request Manager is shutting down - no new requests are being started")
+
+	// Error when more bulk creates than config.BulkCreate.MaxConcurrent are in
+	// progress
+	ErrBulkCreateBusy = errors.New("too many bulk creates in progress - try again later")
+
+	// How long Stop waits for in-flight API requests to finish before closing
+	// their connections.
+	ShutdownTimeout = 30 * time.Second
+
+	// How often Stop logs the number of in-flight API requests while waiting.
+	DrainLogInterval = 2 * time.Second
+
+	// Number of API requests being handled by all APIs, published as an expvar
+	// (GET /debug/vars). Deploy tooling can poll it before stopping the RM.
+	RequestsInFlight = expvar.NewInt("api_requests_in_flight")
+
+	// Optional capabilities that this Request Manager always has. Add a
+	// proto.FEATURE_* here when adding endpoints that clients need to check
+	// for. Features that can be disabled by config are added by API.features.
+	Features = []string{
+		proto.FEATURE_BULK_CREATE,
+		proto.FEATURE_CHAIN_PROTOBUF,
+		proto.FEATURE_DELIVERIES,
+		proto.FEATURE_FINALIZE,
+		proto.FEATURE_JOB_LOG_BATCH,
+		proto.FEATURE_JOB_TRIES,
+		proto.FEATURE_LOG_LEVEL,
+		proto.FEATURE_PARTITIONS,
+		proto.FEATURE_PLACEMENT,
+		proto.FEATURE_REQUEST_EXPORT,
+		proto.FEATURE_REQUEST_GROUPS,
+		proto.FEATURE_REQUEST_HISTORY,
+		proto.FEATURE_REQUEST_RETRY,
+		proto.FEATURE_REQUEST_TYPES,
+		proto.FEATURE_REQUESTS_MINE,
+		proto.FEATURE_RESUME_POINTS,
+		proto.FEATURE_RETRY_FROM_JOB,
+		proto.FEATURE_SLO,
+		proto.FEATURE_SPEC_REPORT,
+	}
 )
 
 // API provides controllers for endpoints it registers with a router.
@@ -46,7 +118,13 @@ type API struct {
 	sm           status.Manager
 	rr           request.Resumer
 	jls          joblog.Store
+	wb           writebuf.Buffer
 	shutdownChan chan struct{}
+	inFlight     int64 // atomic: number of API requests being handled
+	readOnly     proto.ReadOnly
+	readOnlyMux  *sync.RWMutex // guards readOnly
+	bulkSem      chan struct{} // bulk creates in progress, nil if no max
+	bulkInterval time.Duration // wait between starting requests of a bulk create
 	// --
 	echo *echo.Echo
 }
@@ -60,41 +138,117 @@ func NewAPI(appCtx app.Context) *API {
 		sm:           appCtx.Status,
 		jls:          appCtx.JLS,
 		rr:           appCtx.RR,
+		wb:           appCtx.WriteBuffer,
 		shutdownChan: appCtx.ShutdownChan,
+		readOnly: proto.ReadOnly{
+			Enabled: appCtx.Config.ReadOnly.Enabled,
+			Reason:  appCtx.Config.ReadOnly.Reason,
+		},
+		readOnlyMux: &sync.RWMutex{},
 		// --
 		echo: echo.New(),
 	}
+	if api.wb == nil {
+		api.wb = writebuf.Disabled
+	}
+	if n := appCtx.Config.BulkCreate.MaxConcurrent; n > 0 {
+		api.bulkSem = make(chan struct{}, n)
+	}
+	if appCtx.Config.BulkCreate.StartInterval != "" {
+		api.bulkInterval, _ = time.ParseDuration(appCtx.Config.BulkCreate.StartInterval) // validated by server
+	}
 
 	// //////////////////////////////////////////////////////////////////////
 	// Routes
 	// //////////////////////////////////////////////////////////////////////
 
 	// Request
-	api.echo.POST(API_ROOT+"requests", api.createRequestHandler)                   // create
-	api.echo.GET(API_ROOT+"requests", api.findRequestsHandler)                     // list requests
-	api.echo.GET(API_ROOT+"requests/:reqId", api.getRequestHandler)                // get -> proto.Request
-	api.echo.PUT(API_ROOT+"requests/:reqId/start", api.startRequestHandler)        // start
-	api.echo.PUT(API_ROOT+"requests/:reqId/finish", api.finishRequestHandler)      // finish
-	api.echo.PUT(API_ROOT+"requests/:reqId/stop", api.stopRequestHandler)          // stop
-	api.echo.PUT(API_ROOT+"requests/:reqId/suspend", api.suspendRequestHandler)    // suspend
-	api.echo.PUT(API_ROOT+"requests/:reqId/progress", api.requestProgressHandler)  // progress
-	api.echo.GET(API_ROOT+"requests/:reqId/job-chain", api.jobChainRequestHandler) // job chain
+	api.echo.POST(API_ROOT+"requests", api.createRequestHandler)                       // create
+	api.echo.GET(API_ROOT+"requests", api.findRequestsHandler)                         // list requests
+	api.echo.GET(API_ROOT+"requests/:reqId", api.getRequestHandler)                    // get -> proto.Request
+	api.echo.PUT(API_ROOT+"requests/:reqId/start", api.startRequestHandler)            // start
+	api.echo.PUT(API_ROOT+"requests/:reqId/finish", api.finishRequestHandler)          // finish
+	api.echo.PUT(API_ROOT+"requests/:reqId/stop", api.stopRequestHandler)              // stop
+	api.echo.PUT(API_ROOT+"requests/:reqId/suspend", api.suspendRequestHandler)        // suspend
+	api.echo.PUT(API_ROOT+"requests/:reqId/progress", api.requestProgressHandler)      // progress
+	api.echo.GET(API_ROOT+"requests/:reqId/job-chain", api.jobChainRequestHandler)     // job chain, or ?format=argo|dag
+	api.echo.GET(API_ROOT+"requests/:reqId/export", api.exportRequestHandler)          // export -> proto.RequestBundle
+	api.echo.POST(API_ROOT+"requests/import", api.importRequestHandler)                // import proto.RequestBundle
+	api.echo.POST(API_ROOT+"requests/:reqId/retry", api.retryRequestHandler)           // retry failed request -> proto.Request
+	api.echo.GET(API_ROOT+"requests/:reqId/failure", api.requestFailureHandler)        // root cause of failure -> proto.RequestFailure
+	api.echo.PUT(API_ROOT+"requests/:reqId/log-level", api.requestLogLevelHandler)     // elevate log level -> proto.RequestLogLevel
+	api.echo.GET(API_ROOT+"requests/:reqId/resume-points", api.getResumePointsHandler) // suspended job chain -> proto.JobChain
+	api.echo.PUT(API_ROOT+"requests/:reqId/resume-points", api.setResumePointsHandler) // change suspended jobs -> proto.JobChain
+	api.echo.PUT(API_ROOT+"requests/:reqId/finalize", api.finalizeRequestHandler)      // admin: force final state -> proto.Request
+
+	// Request groups
+	api.echo.POST(API_ROOT+"request-groups", api.createRequestGroupHandler)            // create and start -> proto.RequestGroup
+	api.echo.GET(API_ROOT+"request-groups/:groupId", api.getRequestGroupHandler)       // get -> proto.RequestGroup
+	api.echo.PUT(API_ROOT+"request-groups/:groupId/stop", api.stopRequestGroupHandler) // stop running requests
+	api.echo.POST(API_ROOT+"requests/bulk", api.bulkCreateHandler)                     // create and start -> proto.BulkCreateResult
 
 	// Job Log
 	api.echo.POST(API_ROOT+"requests/:reqId/log", api.createJLHandler)    // create
 	api.echo.GET(API_ROOT+"requests/:reqId/log", api.getFullJLHandler)    // per request
 	api.echo.GET(API_ROOT+"requests/:reqId/log/:jobId", api.getJLHandler) // per job
+	api.echo.POST(API_ROOT+"job-logs", api.createJLBatchHandler)          // create batch: []proto.JobLog -> []proto.JobLogResult
+
+	// Job
+	api.echo.GET(API_ROOT+"requests/:reqId/jobs/:jobId/tries", api.jobTriesHandler) // try history -> []proto.JobLog
+	api.echo.PUT(API_ROOT+"requests/:reqId/jobs/:jobId/stop", api.stopJobHandler)   // stop job try, not the request
+
+	// Job Runner deliveries (queued job logs and final states)
+	api.echo.POST(API_ROOT+"deliveries", api.deliveriesHandler) // []proto.Delivery -> []proto.DeliveryResult
 
 	// Meta
-	api.echo.GET(API_ROOT+"request-list", api.requestListHandler)     // request list
-	api.echo.GET(API_ROOT+"status/running", api.statusRunningHandler) // running requests/jobs -> proto.RunningStatus
-	api.echo.GET("/version", api.versionHandler)                      // return version.VERSION
+	api.echo.GET(API_ROOT+"request-list", api.requestListHandler)           // request list
+	api.echo.GET(API_ROOT+"request-history", api.requestHistoryHandler)     // past requests of a type -> proto.RequestHistory
+	api.echo.GET(API_ROOT+"request-types/:reqType", api.requestTypeHandler) // request type docs -> proto.RequestTypeMetadata
+	api.echo.GET(API_ROOT+"spec-report", api.specReportHandler)             // spec check results -> proto.SpecReport
+	api.echo.GET(API_ROOT+"slo", api.listSLOHandler)                        // SLO of all request types -> []proto.SLOStatus
+	api.echo.GET(API_ROOT+"slo/:reqType", api.getSLOHandler)                // SLO of one request type -> proto.SLOStatus
+	api.echo.GET(API_ROOT+"status/running", api.statusRunningHandler)       // running requests/jobs -> proto.RunningStatus
+	api.echo.PUT(API_ROOT+"status/job-runner", api.pushStatusHandler)       // JR pushes proto.JobRunnerStatus
+	api.echo.GET(API_ROOT+"status/job-types", api.jobTypeTriesHandler)      // fleet tries per job type -> map[string]proto.JobTypeTries
+	api.echo.GET(API_ROOT+"version", api.serverVersionHandler)              // RM and JR versions, features -> proto.ServerVersion
+	api.echo.GET(API_ROOT+"features", api.featuresHandler)                  // enabled features -> []string
+	api.echo.GET("/version", api.versionHandler)                            // return version.VERSION
+	api.echo.GET("/debug/vars", echo.WrapHandler(expvar.Handler()))         // metrics, like request.ResumeAttempts
+
+	// Admin
+	api.echo.GET(API_ROOT+"quotas", api.listQuotasHandler)     // list quotas -> []proto.Quota
+	api.echo.PUT(API_ROOT+"quotas", api.setQuotaHandler)       // create, update, or remove a quota
+	api.echo.GET(API_ROOT+"read-only", api.getReadOnlyHandler) // read-only mode -> proto.ReadOnly
+	api.echo.PUT(API_ROOT+"read-only", api.setReadOnlyHandler) // enable or disable read-only mode
+
+	// Admin: rolling Job Runner upgrades
+	api.echo.POST(API_ROOT+"job-runner-upgrades", api.createUpgradeHandler)                      // create -> proto.JobRunnerUpgrade
+	api.echo.GET(API_ROOT+"job-runner-upgrades/:upgradeId", api.getUpgradeHandler)               // get -> proto.JobRunnerUpgrade
+	api.echo.PUT(API_ROOT+"job-runner-upgrades/:upgradeId/advance", api.advanceUpgradeHandler)   // advance -> proto.JobRunnerUpgrade
+	api.echo.PUT(API_ROOT+"job-runner-upgrades/:upgradeId/replaced", api.upgradeReplacedHandler) // current JR replaced
 
 	// //////////////////////////////////////////////////////////////////////
 	// Middleware and hooks
 	// //////////////////////////////////////////////////////////////////////
+
+	// Count in-flight requests so Stop can report drain progress
+	api.echo.Use((func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			atomic.AddInt64(&api.inFlight, 1)
+			RequestsInFlight.Add(1)
+			defer func() {
+				atomic.AddInt64(&api.inFlight, -1)
+				RequestsInFlight.Add(-1)
+			}()
+			return next(c)
+		}
+	}))
 	api.echo.Use(middleware.Recover())
-	api.echo.Use(middleware.Logger())
+	if appCtx.AccessLog != nil {
+		api.echo.Use(api.accessLog)
+	} else {
+		api.echo.Use(middleware.Logger())
+	}
 
 	// Auth plugin: authenticate caller. This is called before every route.
 	// @todo: ignore OPTION requests?
@@ -128,6 +282,42 @@ func NewAPI(appCtx app.Context) *API {
 	return api
 }
 
+// accessLog is middleware that logs every API request to the access log. It's
+// used before the auth middleware so latency includes auth and failed auth is
+// logged. The caller is set by auth by the time the request is logged.
+func (api *API) accessLog(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		start := time.Now()
+		err := next(c)
+		if err != nil {
+			c.Error(err) // write error response to get its status code
+		}
+		e := accesslog.Entry{
+			Time:       start,
+			Method:     c.Request().Method,
+			Endpoint:   c.Path(),
+			Path:       c.Request().URL.Path,
+			Query:      c.Request().URL.RawQuery,
+			Status:     c.Response().Status,
+			LatencyMs:  float64(time.Now().Sub(start)) / float64(time.Millisecond),
+			RequestId:  c.Param("reqId"),
+			RemoteAddr: c.RealIP(),
+		}
+		if username, ok := c.Get("username").(string); ok {
+			e.Caller = username
+		}
+		// Create returns the new request in the Location header
+		if e.RequestId == "" {
+			loc := c.Response().Header().Get("Location")
+			if strings.HasPrefix(loc, API_ROOT+"requests/") {
+				e.RequestId = strings.TrimPrefix(loc, API_ROOT+"requests/")
+			}
+		}
+		api.appCtx.AccessLog.Log(e)
+		return err
+	}
+}
+
 func (api *API) Router() *echo.Echo {
 	return api.echo
 }
@@ -145,16 +335,52 @@ func (api *API) Run() error {
 
 // Stop stops the API when it's running. When Stop is called, Run returns
 // immediately. Make sure to wait for Stop to return.
+//
+// Stop drains the API: it stops accepting new connections, then waits up to
+// ShutdownTimeout for in-flight requests to finish. Requests still in flight
+// after the timeout have their connections closed.
 func (api *API) Stop() error {
-	var err error
+	server := api.echo.Server
 	if api.appCtx.Config.Server.TLS.CertFile != "" && api.appCtx.Config.Server.TLS.KeyFile != "" {
-		err = api.echo.TLSServer.Shutdown(context.TODO())
-	} else {
-		err = api.echo.Server.Shutdown(context.TODO())
+		server = api.echo.TLSServer
+	}
+
+	// Log drain progress until Shutdown returns
+	start := time.Now()
+	log.Infof("Draining API: %d requests in flight", api.InFlight())
+	drained := make(chan struct{})
+	defer close(drained)
+	go func() {
+		ticker := time.NewTicker(DrainLogInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-drained:
+				return
+			case <-ticker.C:
+				log.Infof("Draining API: %d requests in flight", api.InFlight())
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
+	defer cancel()
+	err := server.Shutdown(ctx)
+	if err == context.DeadlineExceeded {
+		log.Errorf("API not drained after %s: closing connections for %d in-flight requests", ShutdownTimeout, api.InFlight())
+		return server.Close()
+	}
+	if err == nil {
+		log.Infof("API drained in %s", time.Now().Sub(start).Round(time.Millisecond))
 	}
 	return err
 }
 
+// InFlight returns the number of API requests currently being handled.
+func (api *API) InFlight() int64 {
+	return atomic.LoadInt64(&api.inFlight)
+}
+
 // ServeHTTP makes the API implement the http.HandlerFunc interface.
 func (api *API) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	api.echo.ServeHTTP(w, r)
@@ -169,6 +395,9 @@ func (api *API) createRequestHandler(c echo.Context) error {
 		return handleError(ErrShuttingDown, c)
 	default:
 	}
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
 
 	// ----------------------------------------------------------------------
 	// Make and validate request
@@ -189,16 +418,48 @@ func (api *API) createRequestHandler(c echo.Context) error {
 		}
 	}
 
+	caller := c.Get("caller").(auth.Caller)
+	reqParams.Team = caller.Team
+
+	// Callers can trace the request back to themselves with a correlation ID
+	// in the payload or, more commonly, the header
+	if reqParams.CorrelationId == "" {
+		reqParams.CorrelationId = c.Request().Header.Get(CORRELATION_ID_HEADER)
+	}
+
+	// Callers cannot see request types in other namespaces, so deny before doing
+	// any work. Authorize checks the namespace again after the request is created.
+	namespace := api.namespace(reqParams.Type)
+	if err := api.authorizeNamespace(c, proto.Request{Type: reqParams.Type, Namespace: namespace}); err != nil {
+		return err
+	}
+
+	// Enforce user, team, and namespace quotas before doing any work
+	if err := api.appCtx.Quota.Check(reqParams.User, reqParams.Team, namespace); err != nil {
+		return handleError(err, c)
+	}
+
 	req, err := api.rm.Create(reqParams)
 	if err != nil {
 		return handleError(err, c)
 	}
 
+	return api.authorizeAndStart(c, caller, req)
+}
+
+// authorizeAndStart authorizes the caller to start the new (pending) request,
+// starts it, and returns it. It's the second half of creating or retrying a
+// request. If the caller is not allowed to start it, the request is failed, so
+// it doesn't stay pending, counting toward quotas and uniqueBy.
+func (api *API) authorizeAndStart(c echo.Context, caller auth.Caller, req proto.Request) error {
 	// ----------------------------------------------------------------------
 	// Authorize
 
-	if err := api.appCtx.Auth.Authorize(c.Get("caller").(auth.Caller), proto.REQUEST_OP_START, req); err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	if err := api.authorizeStart(caller, req); err != nil {
+		if err := api.rm.FailPending(req.Id); err != nil {
+			log.Errorf("error failing pending request %s: %s", req.Id, err)
+		}
+		return err
 	}
 
 	// ----------------------------------------------------------------------
@@ -220,18 +481,131 @@ func (api *API) createRequestHandler(c echo.Context) error {
 	return c.JSON(http.StatusCreated, req)
 }
 
+// authorizeStart authorizes the caller to start the new (pending) request. If
+// the request costs more than its budget approval threshold, the caller must
+// also be allowed to approve it. Authorization needs the created request (its args
+// and cost), so callers must fail the request (FailPending) if it returns an error.
+func (api *API) authorizeStart(caller auth.Caller, req proto.Request) error {
+	if err := api.appCtx.Auth.Authorize(caller, proto.REQUEST_OP_START, req); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	if seq, ok := api.appCtx.Specs.Sequences[req.Type]; ok && seq.Budget != nil && seq.Budget.Approval > 0 && req.Cost > seq.Budget.Approval {
+		if err := api.appCtx.Auth.Authorize(caller, proto.REQUEST_OP_APPROVE, req); err != nil {
+			msg := fmt.Sprintf("request cost %d exceeds budget approval threshold %d: %s", req.Cost, seq.Budget.Approval, err)
+			return echo.NewHTTPError(http.StatusUnauthorized, msg)
+		}
+	}
+	return nil
+}
+
+// POST <API_ROOT>/requests/{reqId}/retry
+// Retry a failed request: create and start a new request with the same args,
+// except the args overridden in the proto.RetryRequest payload. The new request
+// is linked to the failed request (proto.Request.RetryOf) and records the arg
+// overrides (proto.Request.ArgOverrides).
+func (api *API) retryRequestHandler(c echo.Context) error {
+	// If Request Manager is shutting down, don't start running any new requests.
+	select {
+	case <-api.shutdownChan:
+		return handleError(ErrShuttingDown, c)
+	default:
+	}
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+
+	reqId := c.Param("reqId")
+
+	var retryParams proto.RetryRequest
+	if err := c.Bind(&retryParams); err != nil {
+		return err
+	}
+
+	// Like create, the user is the caller retrying the request, not the user
+	// who created the failed request
+	retryParams.User = "?" // in case we can't get a username from the context
+	if val := c.Get("username"); val != nil {
+		if username, ok := val.(string); ok {
+			retryParams.User = username
+		}
+	}
+	caller := c.Get("caller").(auth.Caller)
+	retryParams.Team = caller.Team
+
+	// Caller must be able to see the failed request
+	req, err := api.rm.Get(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	if err := api.authorizeNamespace(c, req); err != nil {
+		return err
+	}
+
+	if err := api.appCtx.Quota.Check(retryParams.User, retryParams.Team, req.Namespace); err != nil {
+		return handleError(err, c)
+	}
+
+	retryReq, err := api.rm.Retry(reqId, retryParams)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	return api.authorizeAndStart(c, caller, retryReq)
+}
+
 // GET <API_ROOT>/requests
 // Return a list of requests matching the filter. Requests are in descending order
 // by create time (most recent first). Requests do not have job chain or args set.
 //
 // Time fields of the filter must be passed as strings following RFCC3339Nano.
 // States should be passed as a comma-separated list of state names (eg. PENDING).
+// Request arg values are passed as name=value, one per "arg" parameter.
+// Namespaces are passed one per "namespace" parameter; an empty value matches
+// requests not in a namespace. Unless the caller has an admin role, only requests
+// in its namespace or not in a namespace are returned. With mine=true, only
+// requests made by the caller (its username) are returned.
 func (api *API) findRequestsHandler(c echo.Context) error {
 	fmt.Printf("%v\n", c.QueryParams())
 
 	filter := proto.RequestFilter{
-		Type: c.QueryParam("type"),
-		User: c.QueryParam("user"),
+		Type:          c.QueryParam("type"),
+		User:          c.QueryParam("user"),
+		CorrelationId: c.QueryParam("correlationId"),
+		GroupId:       c.QueryParam("groupId"),
+		PartitionOf:   c.QueryParam("partitionOf"),
+		Namespaces:    c.QueryParams()["namespace"],
+	}
+	if mine := c.QueryParam("mine"); mine != "" {
+		filter.Mine = mine == "true"
+	}
+	if filter.Mine {
+		// Requests made by the caller have its username (see createRequestHandler)
+		username, _ := c.Get("username").(string)
+		if username == "" {
+			return handleError(serr.ValidationError{Message: "invalid 'mine' parameter: caller has no username"}, c)
+		}
+		if filter.User != "" && filter.User != username {
+			errMsg := fmt.Sprintf("invalid 'user' parameter: %q is not the caller (%s) with 'mine' parameter", filter.User, username)
+			return handleError(serr.ValidationError{Message: errMsg}, c)
+		}
+		filter.User = username
+	}
+	caller := c.Get("caller").(auth.Caller)
+	if len(filter.Namespaces) == 0 {
+		// Restrict to caller namespace unless it can see all namespaces
+		if !api.appCtx.Auth.AllNamespaces(caller) {
+			filter.Namespaces = []string{""}
+			if caller.Namespace != "" {
+				filter.Namespaces = append(filter.Namespaces, caller.Namespace)
+			}
+		}
+	} else {
+		for _, ns := range filter.Namespaces {
+			if !api.appCtx.Auth.InNamespace(caller, ns) {
+				return echo.NewHTTPError(http.StatusUnauthorized,
+					fmt.Sprintf("denied: caller is in namespace '%s', not %s", caller.Namespace, ns))
+			}
+		}
 	}
 	if states := c.QueryParams()["state"]; len(states) != 0 {
 		for _, state := range states {
@@ -243,11 +617,22 @@ func (api *API) findRequestsHandler(c echo.Context) error {
 			filter.States = append(filter.States, stateVal)
 		}
 	}
+	if args := c.QueryParams()["arg"]; len(args) != 0 {
+		filter.Args = map[string]string{}
+		for _, arg := range args {
+			split := strings.SplitN(arg, "=", 2)
+			if len(split) != 2 || split[0] == "" {
+				errMsg := fmt.Sprintf("invalid 'arg' parameter: %q is not of the form name=value", arg)
+				return handleError(serr.ValidationError{Message: errMsg}, c)
+			}
+			filter.Args[split[0]] = split[1]
+		}
+	}
 	if since := c.QueryParam("since"); since != "" {
 		var err error
 		filter.Since, err = time.Parse(time.RFC3339Nano, since)
 		if err != nil {
-			errMsg := fmt.Sprintf("invalid 'since' parameter: %q cannot be parsed to time.Time using RFC3339Nano format: %w", since, err)
+			errMsg := fmt.Sprintf("invalid 'since' parameter: %q cannot be parsed to time.Time using RFC3339Nano format: %s", since, err)
 			return handleError(serr.ValidationError{Message: errMsg}, c)
 		}
 	}
@@ -255,14 +640,14 @@ func (api *API) findRequestsHandler(c echo.Context) error {
 		var err error
 		filter.Until, err = time.Parse(time.RFC3339Nano, until)
 		if err != nil {
-			errMsg := fmt.Sprintf("invalid 'until' parameter: %q cannot be parsed to time.Time using RFC3339Nano format: %w", until, err)
+			errMsg := fmt.Sprintf("invalid 'until' parameter: %q cannot be parsed to time.Time using RFC3339Nano format: %s", until, err)
 			return handleError(serr.ValidationError{Message: errMsg}, c)
 		}
 	}
 	if limit := c.QueryParam("limit"); limit != "" {
 		limitInt, err := strconv.ParseUint(limit, 10, 0)
 		if err != nil {
-			errMsg := fmt.Sprintf("invalid 'limit' parameter: %q cannot be parsed to uint: %w", limit, err)
+			errMsg := fmt.Sprintf("invalid 'limit' parameter: %q cannot be parsed to uint: %s", limit, err)
 			return handleError(serr.ValidationError{Message: errMsg}, c)
 		}
 		filter.Limit = uint(limitInt)
@@ -270,14 +655,15 @@ func (api *API) findRequestsHandler(c echo.Context) error {
 		if offset := c.QueryParam("offset"); offset != "" {
 			offsetInt, err := strconv.ParseUint(offset, 10, 0)
 			if err != nil {
-				errMsg := fmt.Sprintf("invalid 'offset' parameter: %q cannot be parsed to uint: %w", offset, err)
+				errMsg := fmt.Sprintf("invalid 'offset' parameter: %q cannot be parsed to uint: %s", offset, err)
 				return handleError(serr.ValidationError{Message: errMsg}, c)
 			}
 			filter.Offset = uint(offsetInt)
 		}
 	}
 
-	requests, err := api.rm.Find(filter)
+	rm, _ := api.readers(c)
+	requests, err := rm.Find(filter)
 	if err != nil {
 		return handleError(err, c)
 	}
@@ -295,185 +681,1104 @@ func (api *API) getRequestHandler(c echo.Context) error {
 	if err != nil {
 		return handleError(err, c)
 	}
+	if err := api.authorizeNamespace(c, req); err != nil {
+		return err
+	}
 
 	// Return the request.
-	return c.JSON(http.StatusOK, req)
+	return jsonETag(c, req)
 }
 
-// PUT <API_ROOT>/requests/{reqId}/start
-// Start a request by sending it to the Job Runner.
-func (api *API) startRequestHandler(c echo.Context) error {
-	// If Request Manager is shutting down, don't start running any new requests.
-	select {
-	case <-api.shutdownChan:
-		return handleError(ErrShuttingDown, c)
-	default:
-	}
-
+// GET <API_ROOT>/requests/{reqId}/export
+// Export a request with everything needed to import it into another Request
+// Manager: args, job chain, job logs, and suspended job chain (if suspended).
+func (api *API) exportRequestHandler(c echo.Context) error {
 	reqId := c.Param("reqId")
 
-	if err := api.rm.Start(reqId); err != nil {
+	b, err := api.rm.Export(reqId)
+	if err != nil {
 		return handleError(err, c)
 	}
-
-	return nil
-}
-
-// PUT <API_ROOT>/requests/{reqId}/finish
-// Mark a request as being finished. The Job Runner hits this endpoint when
-// it finishes running a job chain.
-func (api *API) finishRequestHandler(c echo.Context) error {
-	reqId := c.Param("reqId")
-
-	// Convert the payload into a proto.FinishRequest.
-	var finishParams proto.FinishRequest
-	if err := c.Bind(&finishParams); err != nil {
+	if err := api.authorizeNamespace(c, b.Request); err != nil {
 		return err
 	}
 
-	if err := api.rm.Finish(reqId, finishParams); err != nil {
+	jl, err := api.jls.GetFull(reqId, proto.JobLogFilter{})
+	if err != nil {
 		return handleError(err, c)
 	}
+	b.JobLogs = jl
 
-	return nil
+	return c.JSON(http.StatusOK, b)
 }
 
-// PUT <API_ROOT>/requests/{reqId}/stop
-// Stop a request by telling the Job Runner to stop running it. Return an error
-// if the request is not running.
-func (api *API) stopRequestHandler(c echo.Context) error {
+// GET <API_ROOT>/requests/{reqId}/failure
+// Get the root cause of a failed request: the earliest failed job try and the
+// jobs that did not run because of it.
+func (api *API) requestFailureHandler(c echo.Context) error {
 	reqId := c.Param("reqId")
 
-	// Authorize caller to stop request
 	req, err := api.rm.Get(reqId)
 	if err != nil {
 		return handleError(err, c)
 	}
-	if err := api.appCtx.Auth.Authorize(c.Get("caller").(auth.Caller), proto.REQUEST_OP_STOP, req); err != nil {
-		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	if err := api.authorizeNamespace(c, req); err != nil {
+		return err
 	}
 
-	if err := api.rm.Stop(reqId); err != nil {
+	jc, err := api.rm.JobChain(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	jl, err := api.jls.GetFull(reqId, proto.JobLogFilter{NoOutput: true})
+	if err != nil {
 		return handleError(err, c)
 	}
 
-	return nil
+	return c.JSON(http.StatusOK, request.Failure(req, jc, jl))
 }
 
-// PUT <API_ROOT>/requests/{reqId}/suspend
-// Suspend a request and save its suspended job chain. The Job Runner hits this
-// endpoint when suspending a job chain on shutdown.
-func (api *API) suspendRequestHandler(c echo.Context) error {
-	// Convert the payload into a proto.SuspendedJobChain
-	var sjc proto.SuspendedJobChain
-	if err := c.Bind(&sjc); err != nil {
+// PUT <API_ROOT>/requests/{reqId}/log-level
+// Elevate the log level of one request, like to debug, on this Request Manager
+// and the Job Runner running it, until the duration expires. Only admins
+// (auth.admin_roles) can set it. It does not change the request, so it works
+// in read-only mode.
+func (api *API) requestLogLevelHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	var ll proto.RequestLogLevel
+	if err := c.Bind(&ll); err != nil {
 		return err
 	}
-
-	if err := api.rr.Suspend(sjc); err != nil {
+	ll, err := api.rm.SetLogLevel(c.Param("reqId"), ll)
+	if err != nil {
 		return handleError(err, c)
 	}
-
-	return nil
+	return c.JSON(http.StatusOK, ll)
 }
 
-func (api *API) requestProgressHandler(c echo.Context) error {
+// GET <API_ROOT>/requests/{reqId}/resume-points
+// Get the job chain of a suspended request with the job states it will be
+// resumed from.
+func (api *API) getResumePointsHandler(c echo.Context) error {
 	reqId := c.Param("reqId")
-	var prg proto.RequestProgress
-	if err := c.Bind(&prg); err != nil {
+	if err := api.authorizeRequestNamespace(c, reqId); err != nil {
 		return err
 	}
-	// Validate
-	if prg.RequestId == "" {
-		errMsg := "invalid proto.StatusProgress: RequestId is empty, must be set"
-		return handleError(serr.ValidationError{Message: errMsg}, c)
-	}
-	if prg.RequestId != reqId {
-		errMsg := fmt.Sprintf("invalid proto.StatusProgress: RequestId=%s does not match request ID in URL: %s", prg.RequestId, reqId)
-		return handleError(serr.ValidationError{Message: errMsg}, c)
-	}
-	// Update
-	if err := api.sm.UpdateProgress(prg); err != nil {
+	jc, err := api.rr.ResumePoints(reqId)
+	if err != nil {
 		return handleError(err, c)
 	}
-	return c.JSON(http.StatusOK, nil)
+	return c.JSON(http.StatusOK, jc)
 }
 
-// GET <API_ROOT>/requests/{reqId}/job-chain
-// Get the job chain for a request.
-func (api *API) jobChainRequestHandler(c echo.Context) error {
+// PUT <API_ROOT>/requests/{reqId}/resume-points
+// Change the jobs of a suspended request before it's resumed: mark jobs complete,
+// skipped, or pending (proto.ResumePoints). The changed job chain must be
+// consistent (see request.ApplyResumePoints), else nothing is changed and it
+// returns 400. Only admins (auth.admin_roles) can change it. Returns the changed
+// job chain.
+func (api *API) setResumePointsHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+	var rp proto.ResumePoints
+	if err := c.Bind(&rp); err != nil {
+		return err
+	}
 	reqId := c.Param("reqId")
-
-	// Get the request's job chain from the rm.
-	jc, err := api.rm.JobChain(reqId)
+	jc, err := api.rr.SetResumePoints(reqId, rp)
 	if err != nil {
 		return handleError(err, c)
 	}
-
-	// Return the job chain.
+	log.Infof("resume points of request %s set by %s: %+v", reqId, c.Get("username"), rp)
 	return c.JSON(http.StatusOK, jc)
 }
 
-// GET <API_ROOT>/requests/{reqId}/log
-// Get full job log.
-func (api *API) getFullJLHandler(c echo.Context) error {
-	reqId := c.Param("reqId")
-
-	// Get the JL from the rm.
-	jl, err := api.jls.GetFull(reqId)
-	if err != nil {
+// POST <API_ROOT>/request-groups
+// Create a request group, then create and start its requests. Every request is
+// created before any is started, so if one cannot be created or the caller is
+// not authorized to start one, none are started: the created requests are failed
+// and the error is returned. Each request is created and authorized like a single
+// request (see createRequestHandler).
+func (api *API) createRequestGroupHandler(c echo.Context) error {
+	// If Request Manager is shutting down, don't start running any new requests.
+	select {
+	case <-api.shutdownChan:
+		return handleError(ErrShuttingDown, c)
+	default:
+	}
+	if err := api.checkReadOnly(); err != nil {
 		return handleError(err, c)
 	}
 
-	// Return the JL.
-	return c.JSON(http.StatusOK, jl)
-}
+	var cg proto.CreateRequestGroup
+	if err := c.Bind(&cg); err != nil {
+		return err
+	}
+	if err := group.Validate(cg); err != nil {
+		return handleError(err, c)
+	}
 
-// GET <API_ROOT>/requests/{reqId}/log/{jobId}
-// Get a JL.
-func (api *API) getJLHandler(c echo.Context) error {
-	reqId := c.Param("reqId")
-	jobId := c.Param("jobId")
+	user := "?" // in case we can't get a username from the context
+	if val := c.Get("username"); val != nil {
+		if username, ok := val.(string); ok {
+			user = username
+		}
+	}
+	caller := c.Get("caller").(auth.Caller)
+	correlationId := c.Request().Header.Get(CORRELATION_ID_HEADER)
+
+	// Callers cannot see request types in other namespaces, so deny before doing
+	// any work
+	for i := range cg.Requests {
+		cg.Requests[i].User = user
+		cg.Requests[i].Team = caller.Team
+		if cg.Requests[i].CorrelationId == "" {
+			cg.Requests[i].CorrelationId = correlationId
+		}
+		ns := api.namespace(cg.Requests[i].Type)
+		if err := api.authorizeNamespace(c, proto.Request{Type: cg.Requests[i].Type, Namespace: ns}); err != nil {
+			return err
+		}
+	}
 
-	// Get the JL from the rm.
-	jl, err := api.jls.Get(reqId, jobId)
+	g, err := api.appCtx.Group.Create(cg, user)
 	if err != nil {
 		return handleError(err, c)
 	}
 
-	// Return the JL.
-	return c.JSON(http.StatusOK, jl)
-}
-
-// POST <API_ROOT>/requests/{reqId}/log
-// Create a JL.
-func (api *API) createJLHandler(c echo.Context) error {
-	reqId := c.Param("reqId")
+	// Create all requests. If any one fails, fail the ones already created
+	// (they're pending, so nothing ran) and return the error.
+	created := make([]proto.Request, 0, len(cg.Requests))
+	failCreated := func() {
+		for _, req := range created {
+			if err := api.rm.FailPending(req.Id); err != nil {
+				log.Errorf("request group %s: error failing pending request %s: %s", g.Id, req.Id, err)
+			}
+		}
+	}
+	for i, cr := range cg.Requests {
+		// Quotas count pending requests, so requests created above count, too
+		if err := api.appCtx.Quota.Check(cr.User, cr.Team, api.namespace(cr.Type)); err != nil {
+			failCreated()
+			return handleError(fmt.Errorf("Requests[%d] (%s): %w", i, cr.Type, err), c)
+		}
+		cr.GroupId = g.Id
+		req, err := api.rm.Create(cr)
+		if err != nil {
+			failCreated()
+			return handleError(fmt.Errorf("Requests[%d] (%s): %w", i, cr.Type, err), c)
+		}
+		created = append(created, req)
+	}
+	for _, req := range created {
+		if err := api.authorizeStart(caller, req); err != nil {
+			failCreated()
+			return err
+		}
+	}
 
-	// Get the JL from the payload.
-	var jl proto.JobLog
-	if err := c.Bind(&jl); err != nil {
-		return err
+	// Start all requests (non-blocking). A request that fails to start is failed
+	// like a single request, but the others keep running.
+	for _, req := range created {
+		if err := api.rm.Start(req.Id); err != nil {
+			log.Errorf("request group %s: error starting request %s: %s", g.Id, req.Id, err)
+			if err := api.rm.FailPending(req.Id); err != nil {
+				log.Errorf("request group %s: error failing pending request %s: %s", g.Id, req.Id, err)
+			}
+		}
 	}
+	log.Infof("request group %s (%s) created by %s: %d requests", g.Id, g.Name, user, len(created))
 
-	// Create a JL in the rm.
-	jl, err := api.jls.Create(reqId, jl)
+	g, err = api.appCtx.Group.Get(g.Id)
 	if err != nil {
 		return handleError(err, c)
 	}
-
-	// Return the JL.
-	return c.JSON(http.StatusCreated, jl)
+	locationUrl, _ := url.Parse(API_ROOT + "request-groups/" + g.Id)
+	c.Response().Header().Set("Location", locationUrl.EscapedPath())
+	return c.JSON(http.StatusCreated, g)
 }
 
-// GET <API_ROOT>/request-list
-// Get a list of all requests.
-func (api *API) requestListHandler(c echo.Context) error {
-	return c.JSON(http.StatusOK, api.rm.Specs())
+// GET <API_ROOT>/request-groups/{groupId}
+// Return the request group with all its requests and their aggregate status.
+func (api *API) getRequestGroupHandler(c echo.Context) error {
+	g, err := api.appCtx.Group.Get(c.Param("groupId"))
+	if err != nil {
+		return handleError(err, c)
+	}
+	for _, req := range g.Requests {
+		if err := api.authorizeNamespace(c, req); err != nil {
+			return err
+		}
+	}
+	return c.JSON(http.StatusOK, g)
 }
 
-// GET <API_ROOT>/status/running
-// Report all requests that are running.
+// PUT <API_ROOT>/request-groups/{groupId}/stop?timeout=5m
+// Stop all running requests in the request group, in parallel. The caller must
+// be authorized to stop every running request, else none are stopped. The optional
+// timeout is the same as stopping a single request.
+func (api *API) stopRequestGroupHandler(c echo.Context) error {
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+
+	groupId := c.Param("groupId")
+
+	var timeout time.Duration
+	if val := c.QueryParam("timeout"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return handleError(serr.ValidationError{Message: fmt.Sprintf("invalid timeout %s: must be a duration greater than zero", val)}, c)
+		}
+		timeout = d
+	}
+
+	g, err := api.appCtx.Group.Get(groupId)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	// Authorize caller to stop every running request before stopping any
+	caller := c.Get("caller").(auth.Caller)
+	running := []string{}
+	for _, r := range g.Requests {
+		if r.State != proto.STATE_RUNNING {
+			continue
+		}
+		req, err := api.rm.Get(r.Id)
+		if err != nil {
+			return handleError(err, c)
+		}
+		if err := api.appCtx.Auth.Authorize(caller, proto.REQUEST_OP_STOP, req); err != nil {
+			return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+		}
+		running = append(running, r.Id)
+	}
+
+	// Each stop waits for the request's running jobs to stop, so stop all at once
+	var wg sync.WaitGroup
+	var errMux sync.Mutex
+	errs := []string{}
+	for _, reqId := range running {
+		wg.Add(1)
+		go func(reqId string) {
+			defer wg.Done()
+			if err := api.rm.Stop(reqId, timeout); err != nil {
+				errMux.Lock()
+				errs = append(errs, fmt.Sprintf("%s: %s", reqId, err))
+				errMux.Unlock()
+			}
+		}(reqId)
+	}
+	wg.Wait()
+	if len(errs) > 0 {
+		sort.Strings(errs)
+		return handleError(fmt.Errorf("error stopping %d of %d running requests: %s", len(errs), len(running), strings.Join(errs, "; ")), c)
+	}
+	log.Infof("request group %s stopped by %s: %d running requests", groupId, c.Get("username"), len(running))
+
+	g, err = api.appCtx.Group.Get(groupId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, g)
+}
+
+// POST <API_ROOT>/requests/bulk
+// Create and start many requests (proto.CreateRequestBulk) in a new request group,
+// all or nothing or best effort, and return the result of each request. Bulk creates
+// are throttled by config.BulkCreate. The response is HTTP 201 if all requests were
+// created and started, else HTTP 200: callers must check BulkCreateResult.Failed.
+// Errors before any request is created, like an invalid payload, are a proto.Error.
+func (api *API) bulkCreateHandler(c echo.Context) error {
+	// If Request Manager is shutting down, don't start running any new requests.
+	select {
+	case <-api.shutdownChan:
+		return handleError(ErrShuttingDown, c)
+	default:
+	}
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+	if api.bulkSem != nil {
+		select {
+		case api.bulkSem <- struct{}{}:
+			defer func() { <-api.bulkSem }()
+		default:
+			return handleError(ErrBulkCreateBusy, c)
+		}
+	}
+
+	var cb proto.CreateRequestBulk
+	if err := c.Bind(&cb); err != nil {
+		return err
+	}
+	switch cb.Mode {
+	case "":
+		cb.Mode = proto.BULK_ALL_OR_NOTHING
+	case proto.BULK_ALL_OR_NOTHING, proto.BULK_BEST_EFFORT:
+	default:
+		return handleError(serr.ValidationError{Message: fmt.Sprintf("invalid proto.CreateRequestBulk: Mode %q, must be %s or %s", cb.Mode, proto.BULK_ALL_OR_NOTHING, proto.BULK_BEST_EFFORT)}, c)
+	}
+	if cb.Name == "" {
+		cb.Name = BULK_GROUP_NAME
+	}
+	cg := proto.CreateRequestGroup{Name: cb.Name, Requests: cb.Requests}
+	if err := group.Validate(cg); err != nil {
+		return handleError(err, c)
+	}
+
+	user := "?" // in case we can't get a username from the context
+	if val := c.Get("username"); val != nil {
+		if username, ok := val.(string); ok {
+			user = username
+		}
+	}
+	caller := c.Get("caller").(auth.Caller)
+	correlationId := c.Request().Header.Get(CORRELATION_ID_HEADER)
+
+	g, err := api.appCtx.Group.Create(cg, user)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	result := proto.BulkCreateResult{
+		GroupId: g.Id,
+		Mode:    cb.Mode,
+		Items:   make([]proto.BulkCreateItem, len(cb.Requests)),
+	}
+	setError := func(i int, err error) {
+		perr := bulkError(err)
+		result.Items[i].HTTPStatus = perr.HTTPStatus
+		result.Items[i].Error = perr.Message
+	}
+
+	// Create all requests (pending) before starting any, so in all-or-nothing
+	// mode nothing runs if any request cannot be created
+	created := make([]proto.Request, len(cb.Requests)) // Id is empty if not created
+	failedAt := -1                                     // first request not created
+	for i, cr := range cb.Requests {
+		result.Items[i].Index = i
+		result.Items[i].Type = cr.Type
+		if failedAt >= 0 && cb.Mode == proto.BULK_ALL_OR_NOTHING {
+			continue
+		}
+		cr.User = user
+		cr.Team = caller.Team
+		if cr.CorrelationId == "" {
+			cr.CorrelationId = correlationId
+		}
+		cr.GroupId = g.Id
+		req, err := api.bulkCreate(c, caller, cr)
+		result.Items[i].RequestId = req.Id
+		if err != nil {
+			setError(i, err)
+			if failedAt < 0 {
+				failedAt = i
+			}
+			continue
+		}
+		created[i] = req
+	}
+	if failedAt >= 0 && cb.Mode == proto.BULK_ALL_OR_NOTHING {
+		notCreated := fmt.Errorf("not started: Requests[%d] (%s) failed, mode is %s", failedAt, cb.Requests[failedAt].Type, proto.BULK_ALL_OR_NOTHING)
+		for i, req := range created {
+			if i == failedAt {
+				continue
+			}
+			if req.Id != "" {
+				if err := api.rm.FailPending(req.Id); err != nil {
+					log.Errorf("bulk create %s: error failing pending request %s: %s", g.Id, req.Id, err)
+				}
+			}
+			result.Items[i].HTTPStatus = http.StatusFailedDependency
+			result.Items[i].Error = notCreated.Error()
+		}
+		created = make([]proto.Request, len(cb.Requests))
+	}
+
+	// Start requests (non-blocking), waiting between them if throttled. A request
+	// that fails to start is failed like a single request, but the others keep
+	// running, even in all-or-nothing mode, because they cannot be unstarted.
+	started := 0
+	for i, req := range created {
+		if req.Id == "" {
+			continue
+		}
+		if started > 0 && api.bulkInterval > 0 {
+			time.Sleep(api.bulkInterval)
+		}
+		if err := api.rm.Start(req.Id); err != nil {
+			log.Errorf("bulk create %s: error starting request %s: %s", g.Id, req.Id, err)
+			if err := api.rm.FailPending(req.Id); err != nil {
+				log.Errorf("bulk create %s: error failing pending request %s: %s", g.Id, req.Id, err)
+			}
+			setError(i, err)
+			continue
+		}
+		started++
+		result.Items[i].HTTPStatus = http.StatusCreated
+	}
+	result.Created = uint(started)
+	result.Failed = uint(len(cb.Requests) - started)
+	log.Infof("bulk create %s (%s) by %s: %s: %d requests created, %d failed", g.Id, g.Name, user, cb.Mode, result.Created, result.Failed)
+
+	locationUrl, _ := url.Parse(API_ROOT + "request-groups/" + g.Id)
+	c.Response().Header().Set("Location", locationUrl.EscapedPath())
+	if result.Failed > 0 {
+		return c.JSON(http.StatusOK, result)
+	}
+	return c.JSON(http.StatusCreated, result)
+}
+
+// bulkCreate creates one request of a bulk create like createRequestHandler, but
+// does not start it. If the request is created but the caller cannot start it,
+// the request is failed and returned with the error.
+func (api *API) bulkCreate(c echo.Context, caller auth.Caller, cr proto.CreateRequest) (proto.Request, error) {
+	namespace := api.namespace(cr.Type)
+	if err := api.authorizeNamespace(c, proto.Request{Type: cr.Type, Namespace: namespace}); err != nil {
+		return proto.Request{}, err
+	}
+	// Quotas count pending requests, so requests created before count, too
+	if err := api.appCtx.Quota.Check(cr.User, cr.Team, namespace); err != nil {
+		return proto.Request{}, err
+	}
+	req, err := api.rm.Create(cr)
+	if err != nil {
+		return proto.Request{}, err
+	}
+	if err := api.authorizeStart(caller, req); err != nil {
+		if err := api.rm.FailPending(req.Id); err != nil {
+			log.Errorf("error failing pending request %s: %s", req.Id, err)
+		}
+		return req, err
+	}
+	return req, nil
+}
+
+// bulkError is apiError for errors that are echo.HTTPError, like authorization
+// errors.
+func bulkError(err error) proto.Error {
+	if herr, ok := err.(*echo.HTTPError); ok {
+		return proto.Error{Message: fmt.Sprintf("%v", herr.Message), HTTPStatus: herr.Code}
+	}
+	return apiError(err)
+}
+
+// POST <API_ROOT>/requests/import
+// Import a request exported from another Request Manager. Only admins
+// (auth.admin_roles) can import requests.
+func (api *API) importRequestHandler(c echo.Context) error {
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	var b proto.RequestBundle
+	if err := c.Bind(&b); err != nil {
+		return err
+	}
+
+	req, err := api.rm.Import(b)
+	if err != nil {
+		return handleError(err, c)
+	}
+	log.Infof("request %s imported by %s: exported at %s by version %s", req.Id, c.Get("username"), b.ExportedAt, b.Version)
+
+	req.JobChain = nil // don't include the job chain in the return
+	return c.JSON(http.StatusCreated, req)
+}
+
+// PUT <API_ROOT>/requests/{reqId}/start
+// Start a request by sending it to the Job Runner, and return it. Starting a
+// request that was already started is a no-op (200), so it's safe to retry.
+// Starting a request that was never started and is not pending returns 409.
+func (api *API) startRequestHandler(c echo.Context) error {
+	// If Request Manager is shutting down, don't start running any new requests.
+	select {
+	case <-api.shutdownChan:
+		return handleError(ErrShuttingDown, c)
+	default:
+	}
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+
+	reqId := c.Param("reqId")
+
+	if err := api.rm.Start(reqId); err != nil {
+		return handleError(err, c)
+	}
+
+	return api.currentRequest(c, reqId)
+}
+
+// PUT <API_ROOT>/requests/{reqId}/finish
+// Mark a request as being finished. The Job Runner hits this endpoint when
+// it finishes running a job chain.
+func (api *API) finishRequestHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+
+	// Convert the payload into a proto.FinishRequest.
+	var finishParams proto.FinishRequest
+	if err := c.Bind(&finishParams); err != nil {
+		return err
+	}
+
+	if err := api.rm.Finish(reqId, finishParams); err != nil {
+		return handleError(err, c)
+	}
+
+	return nil
+}
+
+// PUT <API_ROOT>/requests/{reqId}/stop?timeout=5m
+// Stop a request by telling the Job Runner to stop running it, and return it.
+// Stopping a request that already finished is a no-op (200), so it's safe to
+// retry. Stopping a pending or suspended request returns 409. The optional
+// timeout overrides how long the Job Runner waits for running jobs to stop.
+func (api *API) stopRequestHandler(c echo.Context) error {
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+
+	reqId := c.Param("reqId")
+
+	var timeout time.Duration
+	if val := c.QueryParam("timeout"); val != "" {
+		d, err := time.ParseDuration(val)
+		if err != nil || d <= 0 {
+			return handleError(serr.ValidationError{Message: fmt.Sprintf("invalid timeout %s: must be a duration greater than zero", val)}, c)
+		}
+		timeout = d
+	}
+
+	// Authorize caller to stop request
+	req, err := api.rm.Get(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	if err := api.appCtx.Auth.Authorize(c.Get("caller").(auth.Caller), proto.REQUEST_OP_STOP, req); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := api.rm.Stop(reqId, timeout); err != nil {
+		return handleError(err, c)
+	}
+
+	return api.currentRequest(c, reqId)
+}
+
+// PUT <API_ROOT>/requests/{reqId}/finalize
+// Forcibly set the final state of a request whose Job Runner is unrecoverable.
+// Only admins can finalize requests. Return the finalized request.
+func (api *API) finalizeRequestHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+
+	var f proto.FinalizeRequest
+	if err := c.Bind(&f); err != nil {
+		return err
+	}
+	f.User = "?" // in case we can't get a username from the context
+	if val := c.Get("username"); val != nil {
+		if username, ok := val.(string); ok {
+			f.User = username
+		}
+	}
+
+	req, err := api.rm.Finalize(c.Param("reqId"), f)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, req)
+}
+
+// currentRequest returns the request in its current state, which is the response
+// to starting and stopping a request. The state can change right after, e.g. a
+// stopped request is RUNNING until the Job Runner finishes stopping it.
+func (api *API) currentRequest(c echo.Context, reqId string) error {
+	req, err := api.rm.Get(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, req)
+}
+
+// PUT <API_ROOT>/requests/{reqId}/suspend
+// Suspend a request and save its suspended job chain. The Job Runner hits this
+// endpoint when suspending a job chain on shutdown.
+func (api *API) suspendRequestHandler(c echo.Context) error {
+	// Convert the payload into a proto.SuspendedJobChain
+	var sjc proto.SuspendedJobChain
+	err := bindChain(c, &sjc, func(b []byte) error { return proto.DecodeSuspendedJobChain(b, &sjc) })
+	if err != nil {
+		return err
+	}
+
+	if err := api.rr.Suspend(sjc); err != nil {
+		return handleError(err, c)
+	}
+
+	return nil
+}
+
+func (api *API) requestProgressHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+	var prg proto.RequestProgress
+	if err := c.Bind(&prg); err != nil {
+		return err
+	}
+	// Validate
+	if prg.RequestId == "" {
+		errMsg := "invalid proto.StatusProgress: RequestId is empty, must be set"
+		return handleError(serr.ValidationError{Message: errMsg}, c)
+	}
+	if prg.RequestId != reqId {
+		errMsg := fmt.Sprintf("invalid proto.StatusProgress: RequestId=%s does not match request ID in URL: %s", prg.RequestId, reqId)
+		return handleError(serr.ValidationError{Message: errMsg}, c)
+	}
+	// Update. If the database is unavailable, it's queued and only the latest
+	// progress of the request is updated later.
+	if _, err := api.wb.Write("progress:"+prg.RequestId, func() error { return api.sm.UpdateProgress(prg) }); err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, nil)
+}
+
+// GET <API_ROOT>/requests/{reqId}/job-chain?format=argo
+// Get the job chain for a request, optionally exported in a workflow format
+// (graph.EXPORT_FORMAT_*).
+func (api *API) jobChainRequestHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+	format := c.QueryParam("format")
+	if format != "" && format != graph.EXPORT_FORMAT_ARGO && format != graph.EXPORT_FORMAT_DAG {
+		errMsg := fmt.Sprintf("invalid 'format' parameter: %q, expected %s or %s", format, graph.EXPORT_FORMAT_ARGO, graph.EXPORT_FORMAT_DAG)
+		return handleError(serr.ValidationError{Message: errMsg}, c)
+	}
+	if err := api.authorizeRequestNamespace(c, reqId); err != nil {
+		return err
+	}
+
+	// Get the request's job chain from the rm.
+	jc, err := api.rm.JobChain(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	// Return the job chain.
+	if format == "" {
+		return jsonETag(c, jc)
+	}
+	bytes, err := graph.Export(graph.ChainDAG(jc), format)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.Blob(http.StatusOK, graph.ExportContentType(format), bytes)
+}
+
+// GET <API_ROOT>/requests/{reqId}/log?errorsOnly=true&noOutput=true&stream=stderr&jobId=abcd
+// Get full job log, optionally filtered.
+func (api *API) getFullJLHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+	f := proto.JobLogFilter{
+		ErrorsOnly: c.QueryParam("errorsOnly") == "true",
+		NoOutput:   c.QueryParam("noOutput") == "true",
+		Stream:     c.QueryParam("stream"),
+		JobId:      c.QueryParam("jobId"),
+	}
+	if f.Stream != "" && f.Stream != "stdout" && f.Stream != "stderr" {
+		errMsg := fmt.Sprintf("invalid 'stream' parameter: %q, expected stdout or stderr", f.Stream)
+		return handleError(serr.ValidationError{Message: errMsg}, c)
+	}
+	if err := api.authorizeRequestNamespace(c, reqId); err != nil {
+		return err
+	}
+
+	// Get the JL from the rm.
+	_, jls := api.readers(c)
+	jl, err := jls.GetFull(reqId, f)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	// Return the JL.
+	return jsonETag(c, jl)
+}
+
+// GET <API_ROOT>/requests/{reqId}/log/{jobId}
+// Get a JL.
+func (api *API) getJLHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+	jobId := c.Param("jobId")
+	if err := api.authorizeRequestNamespace(c, reqId); err != nil {
+		return err
+	}
+
+	// Get the JL from the rm.
+	_, jls := api.readers(c)
+	jl, err := jls.Get(reqId, jobId)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	// Return the JL.
+	return jsonETag(c, jl)
+}
+
+// GET <API_ROOT>/requests/{reqId}/jobs/{jobId}/tries
+// Get every try of a job, ordered by try number, without stdout and stderr. Each
+// try is a JL, which has the sequence try it belonged to. A job in the job chain
+// that hasn't run has no tries (empty list); a job not in the job chain is not found.
+func (api *API) jobTriesHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+	jobId := c.Param("jobId")
+	if err := api.authorizeRequestNamespace(c, reqId); err != nil {
+		return err
+	}
+
+	jc, err := api.rm.JobChain(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	if _, ok := jc.Jobs[jobId]; !ok {
+		return handleError(serr.JobNotFound{RequestId: reqId, JobId: jobId}, c)
+	}
+
+	tries, err := api.jls.GetFull(reqId, proto.JobLogFilter{JobId: jobId, NoOutput: true})
+	if err != nil {
+		return handleError(err, c)
+	}
+	sort.Slice(tries, func(i, j int) bool { return tries[i].Try < tries[j].Try })
+
+	return c.JSON(http.StatusOK, tries)
+}
+
+// PUT <API_ROOT>/requests/{reqId}/jobs/{jobId}/stop
+// Stop the current try of one job of a running request, like a stuck job, by
+// telling the Job Runner to stop it. The request is not stopped: the try fails,
+// so the job is retried if it has tries left, else the request handles the
+// failed job as usual (sequence retry or fail). Callers that can stop the
+// request can stop its jobs. Returns 409 if the request or job is not running.
+func (api *API) stopJobHandler(c echo.Context) error {
+	if err := api.checkReadOnly(); err != nil {
+		return handleError(err, c)
+	}
+
+	reqId := c.Param("reqId")
+	jobId := c.Param("jobId")
+
+	// Authorize caller to stop request
+	req, err := api.rm.Get(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	if err := api.appCtx.Auth.Authorize(c.Get("caller").(auth.Caller), proto.REQUEST_OP_STOP, req); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+
+	if err := api.rm.StopJob(reqId, jobId); err != nil {
+		return handleError(err, c)
+	}
+	log.Infof("job %s of request %s stopped by %s", jobId, reqId, c.Get("username"))
+	return c.NoContent(http.StatusOK)
+}
+
+// POST <API_ROOT>/requests/{reqId}/log
+// Create a JL.
+func (api *API) createJLHandler(c echo.Context) error {
+	reqId := c.Param("reqId")
+
+	// Get the JL from the payload.
+	var jl proto.JobLog
+	if err := c.Bind(&jl); err != nil {
+		return err
+	}
+
+	// Create a JL in the rm. If the database is unavailable, it's queued and
+	// created later, and the JL is returned as sent.
+	created, err := api.createJL(reqId, jl)
+	if err != nil {
+		return handleError(err, c)
+	}
+
+	// Return the JL.
+	return c.JSON(http.StatusCreated, created)
+}
+
+// createJL creates the JL, or queues it in the write buffer if the database is
+// unavailable. It returns the JL as saved (see joblog.Store.Create), or as sent
+// if queued.
+func (api *API) createJL(reqId string, jl proto.JobLog) (proto.JobLog, error) {
+	var created proto.JobLog
+	queued, err := api.wb.Write("", func() error {
+		// A JR that lost the request, which was resumed since, cannot add to its JL
+		if err := api.rm.CheckFence(reqId, jl.FenceToken); err != nil {
+			return err
+		}
+		var err error
+		created, err = api.jls.Create(reqId, jl)
+		return err
+	})
+	if err != nil {
+		return jl, err
+	}
+	if queued {
+		jl.RequestId = reqId
+		return jl, nil
+	}
+	return created, nil
+}
+
+// POST <API_ROOT>/job-logs
+// Create a batch of JLs ([]proto.JobLog) for any requests, which Job Runners send
+// instead of one call per JL, and return their results ([]proto.JobLogResult), one
+// per JL in the same order. Each JL is created like createJLHandler, so the batch
+// is not all-or-nothing: an error for one JL does not affect the others. JLs that
+// were already created are duplicates, so the Job Runner can send a batch again.
+func (api *API) createJLBatchHandler(c echo.Context) error {
+	var jls []proto.JobLog
+	if err := c.Bind(&jls); err != nil {
+		return err
+	}
+
+	results := make([]proto.JobLogResult, len(jls))
+	for i, jl := range jls {
+		var err error
+		if jl.RequestId == "" {
+			err = serr.ValidationError{Message: fmt.Sprintf("job log %d (job %s try %d) has no requestId", i, jl.JobId, jl.Try)}
+		} else {
+			_, err = api.createJL(jl.RequestId, jl)
+		}
+		if errors.As(err, &serr.ErrDuplicateJobLog{}) {
+			results[i] = proto.JobLogResult{Created: true, Duplicate: true}
+			continue
+		}
+		if err != nil {
+			log.Warnf("cannot create job log for request %s job %s try %d: %s", jl.RequestId, jl.JobId, jl.Try, err)
+			perr := apiError(err)
+			perr.RequestId = jl.RequestId
+			results[i] = proto.JobLogResult{Error: &perr}
+			continue
+		}
+		results[i] = proto.JobLogResult{Created: true}
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// POST <API_ROOT>/deliveries
+// Deliver a batch of job logs and final request states ([]proto.Delivery) that
+// a Job Runner queued because it could not send them when jobs and chains finished,
+// and return their results ([]proto.DeliveryResult). Deliveries are applied in
+// order, like the single-item endpoints, and are idempotent so the Job Runner can
+// send them again. Applying stops at the first delivery that fails with a server
+// error (5xx) because the Job Runner sends it and the ones after it again later,
+// so fewer results than deliveries can be returned.
+func (api *API) deliveriesHandler(c echo.Context) error {
+	var deliveries []proto.Delivery
+	if err := c.Bind(&deliveries); err != nil {
+		return err
+	}
+
+	results := make([]proto.DeliveryResult, 0, len(deliveries))
+	for _, d := range deliveries {
+		res := api.deliver(d)
+		results = append(results, res)
+		if res.Error != nil && res.Error.HTTPStatus >= http.StatusInternalServerError {
+			break
+		}
+	}
+
+	return c.JSON(http.StatusOK, results)
+}
+
+// deliver applies one delivery. A job log already saved for the job try, or a
+// final state the request already has, is a duplicate: it was delivered before.
+func (api *API) deliver(d proto.Delivery) proto.DeliveryResult {
+	var err error
+	switch {
+	case d.JobLog != nil && d.Finish == nil:
+		// Same as createJLHandler
+		_, err = api.createJL(d.RequestId, *d.JobLog)
+		if errors.As(err, &serr.ErrDuplicateJobLog{}) {
+			return proto.DeliveryResult{Delivered: true, Duplicate: true}
+		}
+	case d.Finish != nil && d.JobLog == nil:
+		err = api.rm.Finish(d.RequestId, *d.Finish)
+		if errors.As(err, &serr.ErrInvalidState{}) {
+			// Not running, so finished already or never ran
+			if req, gerr := api.rm.Get(d.RequestId); gerr == nil && req.State == d.Finish.State {
+				return proto.DeliveryResult{Delivered: true, Duplicate: true}
+			}
+		}
+	default:
+		err = serr.ValidationError{Message: fmt.Sprintf("delivery for request %s must have a job log or a final state, not both or neither", d.RequestId)}
+	}
+	if err != nil {
+		log.Warnf("cannot deliver to request %s: %s", d.RequestId, err)
+		perr := apiError(err)
+		perr.RequestId = d.RequestId
+		return proto.DeliveryResult{Error: &perr}
+	}
+	return proto.DeliveryResult{Delivered: true}
+}
+
+// GET <API_ROOT>/request-list
+// Get a list of all requests that the caller can see: not in a namespace, or in
+// the caller namespace.
+func (api *API) requestListHandler(c echo.Context) error {
+	caller := c.Get("caller").(auth.Caller)
+	all := api.rm.Specs()
+	specs := make([]proto.RequestSpec, 0, len(all))
+	for _, s := range all {
+		if api.appCtx.Auth.InNamespace(caller, s.Namespace) {
+			specs = append(specs, s)
+		}
+	}
+	return c.JSON(http.StatusOK, specs)
+}
+
+// GET <API_ROOT>/request-types/{reqType}
+// Return the documentation of a request type: its request spec, and the description
+// and docs URL of its sequences and nodes.
+func (api *API) requestTypeHandler(c echo.Context) error {
+	reqType := c.Param("reqType")
+	if err := api.authorizeNamespace(c, proto.Request{Type: reqType, Namespace: api.namespace(reqType)}); err != nil {
+		return err
+	}
+	md, err := api.rm.Metadata(reqType)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, md)
+}
+
+// GET <API_ROOT>/slo
+// Return the SLO status of all request types with an SLO that the caller can see:
+// not in a namespace, or in the caller namespace.
+func (api *API) listSLOHandler(c echo.Context) error {
+	caller := c.Get("caller").(auth.Caller)
+	all, err := api.appCtx.SLO.List()
+	if err != nil {
+		return handleError(err, c)
+	}
+	slos := make([]proto.SLOStatus, 0, len(all))
+	for _, s := range all {
+		if api.appCtx.Auth.InNamespace(caller, api.namespace(s.Type)) {
+			slos = append(slos, s)
+		}
+	}
+	return c.JSON(http.StatusOK, slos)
+}
+
+// GET <API_ROOT>/slo/{reqType}
+// Return the SLO status of a request type: how well its requests meet its SLO
+// in every window, and if it's burning.
+func (api *API) getSLOHandler(c echo.Context) error {
+	reqType := c.Param("reqType")
+	if err := api.authorizeNamespace(c, proto.Request{Type: reqType, Namespace: api.namespace(reqType)}); err != nil {
+		return err
+	}
+	s, err := api.appCtx.SLO.Status(reqType)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, s)
+}
+
+// GET <API_ROOT>/spec-report
+// Return the results of checking the specs on startup: errors and warnings per
+// spec file and sequence, and the request types that cannot be built because
+// of errors. Callers that cannot see all namespaces see only results in their
+// namespace.
+func (api *API) specReportHandler(c echo.Context) error {
+	caller := c.Get("caller").(auth.Caller)
+	report := api.appCtx.SpecReport
+	if api.appCtx.Auth.AllNamespaces(caller) {
+		return c.JSON(http.StatusOK, report)
+	}
+	fileNamespace := map[string]string{}
+	for _, seq := range api.appCtx.Specs.Sequences {
+		fileNamespace[seq.Filename] = seq.Namespace
+	}
+	files := map[string]proto.SpecCheckResult{}
+	for file, result := range report.Files {
+		if api.appCtx.Auth.InNamespace(caller, fileNamespace[file]) {
+			files[file] = result
+		}
+	}
+	sequences := map[string]proto.SpecCheckResult{}
+	for name, result := range report.Sequences {
+		if api.appCtx.Auth.InNamespace(caller, api.namespace(name)) {
+			sequences[name] = result
+		}
+	}
+	unbuildable := []string{}
+	for _, reqType := range report.Unbuildable {
+		if api.appCtx.Auth.InNamespace(caller, api.namespace(reqType)) {
+			unbuildable = append(unbuildable, reqType)
+		}
+	}
+	report.Files = files
+	report.Sequences = sequences
+	report.Unbuildable = unbuildable
+	return c.JSON(http.StatusOK, report)
+}
+
+// GET <API_ROOT>/request-history?type=<request type>&since=<time>&limit=<n>
+// Return past requests of a type and a summary of their outcomes. Type is required.
+// Since must be passed as a string following RFC3339Nano; if not set, all requests
+// are summarized. Limit limits the requests returned, not the summary.
+func (api *API) requestHistoryHandler(c echo.Context) error {
+	reqType := c.QueryParam("type")
+	if reqType == "" {
+		return handleError(serr.ValidationError{Message: "missing 'type' parameter"}, c)
+	}
+	if err := api.authorizeNamespace(c, proto.Request{Type: reqType, Namespace: api.namespace(reqType)}); err != nil {
+		return err
+	}
+	var since time.Time
+	if s := c.QueryParam("since"); s != "" {
+		var err error
+		since, err = time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid 'since' parameter: %q cannot be parsed to time.Time using RFC3339Nano format: %s", s, err)
+			return handleError(serr.ValidationError{Message: errMsg}, c)
+		}
+	}
+	var limit uint
+	if l := c.QueryParam("limit"); l != "" {
+		limitInt, err := strconv.ParseUint(l, 10, 0)
+		if err != nil {
+			errMsg := fmt.Sprintf("invalid 'limit' parameter: %q cannot be parsed to uint: %s", l, err)
+			return handleError(serr.ValidationError{Message: errMsg}, c)
+		}
+		limit = uint(limitInt)
+	}
+
+	rm, _ := api.readers(c)
+	h, err := rm.History(reqType, since, limit)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, h)
+}
+
+// GET <API_ROOT>/status/running
+// Report all requests that are running. Requests in other namespaces than the
+// caller namespace, and their jobs, are not reported.
 func (api *API) statusRunningHandler(c echo.Context) error {
 	f := proto.StatusFilter{
 		RequestId: c.QueryParam("requestId"),
@@ -483,31 +1788,365 @@ func (api *API) statusRunningHandler(c echo.Context) error {
 	if err != nil {
 		return handleError(err, c)
 	}
-	return c.JSON(http.StatusOK, running)
+	caller := c.Get("caller").(auth.Caller)
+	if !api.appCtx.Auth.AllNamespaces(caller) {
+		jobs := make([]proto.JobStatus, 0, len(running.Jobs))
+		for _, j := range running.Jobs {
+			if api.appCtx.Auth.InNamespace(caller, running.Requests[j.RequestId].Namespace) {
+				jobs = append(jobs, j)
+			}
+		}
+		running.Jobs = jobs
+		for id, r := range running.Requests {
+			if !api.appCtx.Auth.InNamespace(caller, r.Namespace) {
+				delete(running.Requests, id)
+			}
+		}
+	}
+	if err := api.checkReadOnly(); err != nil {
+		running.Banner = err.Error()
+	}
+	return jsonETag(c, running)
+}
+
+// PUT <API_ROOT>/status/job-runner
+// Save the running status pushed by a Job Runner. Job Runners hit this endpoint
+// on an interval if config.StatusPush.Interval is set.
+func (api *API) pushStatusHandler(c echo.Context) error {
+	var jrs proto.JobRunnerStatus
+	if err := c.Bind(&jrs); err != nil {
+		return err
+	}
+	if err := api.sm.Push(jrs); err != nil {
+		return handleError(err, c)
+	}
+	return c.NoContent(http.StatusOK)
+}
+
+// GET <API_ROOT>/status/job-types
+// Return the tries per job type summed over the status pushed by all Job Runners.
+// Job Runners with circuit breakers (config.CircuitBreaker) get it after every
+// push to compute fleet-wide failure rates.
+func (api *API) jobTypeTriesHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, api.sm.JobTypeTries())
+}
+
+// GET <API_ROOT>/quotas
+// Return all user and team quotas.
+func (api *API) listQuotasHandler(c echo.Context) error {
+	quotas, err := api.appCtx.Quota.List()
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, quotas)
+}
+
+// PUT <API_ROOT>/quotas
+// Create or update a user or team quota. A quota with zero limits is removed.
+// Only admins (auth.admin_roles) can set quotas.
+func (api *API) setQuotaHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	var q proto.Quota
+	if err := c.Bind(&q); err != nil {
+		return err
+	}
+	if err := api.appCtx.Quota.Set(q); err != nil {
+		return handleError(err, c)
+	}
+	log.Infof("quota set by %s: %+v", c.Get("username"), q)
+	return c.NoContent(http.StatusOK)
+}
+
+// GET <API_ROOT>/read-only
+// Return the read-only mode of this Request Manager.
+func (api *API) getReadOnlyHandler(c echo.Context) error {
+	api.readOnlyMux.RLock()
+	ro := api.readOnly
+	api.readOnlyMux.RUnlock()
+	return c.JSON(http.StatusOK, ro)
+}
+
+// PUT <API_ROOT>/read-only
+// Enable or disable read-only mode. Only admins (auth.admin_roles) can set it.
+// It is not saved, so it only affects this Request Manager until it restarts.
+func (api *API) setReadOnlyHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	var ro proto.ReadOnly
+	if err := c.Bind(&ro); err != nil {
+		return err
+	}
+	if !ro.Enabled {
+		ro.Reason = ""
+	}
+	api.readOnlyMux.Lock()
+	api.readOnly = ro
+	api.readOnlyMux.Unlock()
+	log.Infof("read-only mode set by %s: %+v", c.Get("username"), ro)
+	return c.NoContent(http.StatusOK)
+}
+
+// checkReadOnly returns an errors.ErrReadOnly if read-only mode is enabled,
+// else nil.
+// namespace returns the namespace of the request type, or an empty string if
+// the request type is not in a namespace or does not exist.
+// bindChain binds the request body, a job chain or suspended job chain, to v like
+// c.Bind, but a protobuf body (proto.CONTENT_TYPE_PROTOBUF) is decoded by decode.
+func bindChain(c echo.Context, v interface{}, decode func([]byte) error) error {
+	if !strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), proto.CONTENT_TYPE_PROTOBUF) {
+		return c.Bind(v)
+	}
+	body, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := decode(body); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	return nil
+}
+
+func (api *API) namespace(reqType string) string {
+	if seq, ok := api.appCtx.Specs.Sequences[reqType]; ok {
+		return seq.Namespace
+	}
+	return ""
+}
+
+// readers returns the request manager and job log store for a heavy read-only
+// endpoint: the read replica ones if the replica is usable and the caller did not
+// ask to read from the primary, else the primary ones. It sets READ_FROM_HEADER,
+// and REPLICA_LAG_HEADER if reading from the replica.
+func (api *API) readers(c echo.Context) (request.Manager, joblog.Store) {
+	if api.appCtx.Replica == nil || c.Request().Header.Get(READ_FROM_HEADER) == READ_FROM_PRIMARY {
+		c.Response().Header().Set(READ_FROM_HEADER, READ_FROM_PRIMARY)
+		return api.rm, api.jls
+	}
+	lag, ok := api.appCtx.Replica.Lag()
+	if !ok {
+		replica.Fallbacks.Add(1)
+		c.Response().Header().Set(READ_FROM_HEADER, READ_FROM_PRIMARY)
+		return api.rm, api.jls
+	}
+	replica.Reads.Add(1)
+	c.Response().Header().Set(READ_FROM_HEADER, READ_FROM_REPLICA)
+	c.Response().Header().Set(REPLICA_LAG_HEADER, strconv.FormatFloat(lag.Seconds(), 'f', -1, 64))
+	return api.appCtx.ReplicaRM, api.appCtx.ReplicaJLS
+}
+
+// authorizeNamespace returns an HTTP 401 error if the caller is not in the
+// namespace of the request (see auth.Manager.InNamespace), else nil.
+func (api *API) authorizeNamespace(c echo.Context, req proto.Request) error {
+	caller := c.Get("caller").(auth.Caller)
+	if api.appCtx.Auth.InNamespace(caller, req.Namespace) {
+		return nil
+	}
+	return echo.NewHTTPError(http.StatusUnauthorized,
+		fmt.Sprintf("denied: request %s is in namespace %s, caller is in namespace '%s'", req.Type, req.Namespace, caller.Namespace))
+}
+
+// authorizeRequestNamespace is authorizeNamespace for endpoints that do not
+// otherwise get the request. Callers that can see all namespaces are allowed
+// without getting it.
+func (api *API) authorizeRequestNamespace(c echo.Context, reqId string) error {
+	if api.appCtx.Auth.AllNamespaces(c.Get("caller").(auth.Caller)) {
+		return nil
+	}
+	req, err := api.rm.Get(reqId)
+	if err != nil {
+		return handleError(err, c)
+	}
+	return api.authorizeNamespace(c, req)
+}
+
+func (api *API) checkReadOnly() error {
+	api.readOnlyMux.RLock()
+	defer api.readOnlyMux.RUnlock()
+	if !api.readOnly.Enabled {
+		return nil
+	}
+	return serr.ErrReadOnly{Reason: api.readOnly.Reason}
+}
+
+// POST <API_ROOT>/job-runner-upgrades
+// Start a rolling Job Runner upgrade: drain the first Job Runner. Only admins
+// (auth.admin_roles) can upgrade Job Runners.
+func (api *API) createUpgradeHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	var cu proto.CreateJobRunnerUpgrade
+	if err := c.Bind(&cu); err != nil {
+		return err
+	}
+	u, err := api.appCtx.Upgrade.Create(cu)
+	if err != nil {
+		return handleError(err, c)
+	}
+	log.Infof("job runner upgrade %s created by %s: %v", u.Id, c.Get("username"), u.JobRunnerURLs)
+	return c.JSON(http.StatusCreated, u)
+}
+
+// GET <API_ROOT>/job-runner-upgrades/{upgradeId}
+// Return the Job Runner upgrade. It does not change the upgrade.
+func (api *API) getUpgradeHandler(c echo.Context) error {
+	u, err := api.appCtx.Upgrade.Get(c.Param("upgradeId"))
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, u)
+}
+
+// PUT <API_ROOT>/job-runner-upgrades/{upgradeId}/advance
+// Advance the Job Runner upgrade if its current step is done, and return it.
+// Deploy tooling polls this endpoint to drive the upgrade. Only admins
+// (auth.admin_roles) can upgrade Job Runners.
+func (api *API) advanceUpgradeHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	u, err := api.appCtx.Upgrade.Advance(c.Param("upgradeId"))
+	if err != nil {
+		return handleError(err, c)
+	}
+	return c.JSON(http.StatusOK, u)
+}
+
+// PUT <API_ROOT>/job-runner-upgrades/{upgradeId}/replaced
+// Tell the Job Runner upgrade that the current Job Runner was replaced. Only
+// admins (auth.admin_roles) can upgrade Job Runners.
+func (api *API) upgradeReplacedHandler(c echo.Context) error {
+	if err := api.appCtx.Auth.AuthorizeAdmin(c.Get("caller").(auth.Caller)); err != nil {
+		return echo.NewHTTPError(http.StatusUnauthorized, err.Error())
+	}
+	var r proto.JobRunnerReplaced
+	if err := c.Bind(&r); err != nil {
+		return err
+	}
+	if err := api.appCtx.Upgrade.Replaced(c.Param("upgradeId"), r); err != nil {
+		return handleError(err, c)
+	}
+	return c.NoContent(http.StatusOK)
 }
 
 func (api *API) versionHandler(c echo.Context) error {
 	return c.String(http.StatusOK, v.Version())
 }
 
+// GET <API_ROOT>/version
+// Return the version, API version, and features of this RM, and the versions of
+// JRs that push status. Clients like spinc use it to check compatibility.
+func (api *API) serverVersionHandler(c echo.Context) error {
+	sv := proto.ServerVersion{
+		Version:    v.Version(),
+		APIVersion: proto.API_VERSION,
+		Features:   api.features(),
+		JobRunners: []proto.JobRunnerVersion{},
+	}
+	for _, jr := range api.sm.JobRunners() {
+		sv.JobRunners = append(sv.JobRunners, proto.JobRunnerVersion{
+			JobRunnerURL: jr.JobRunnerURL,
+			Version:      jr.Version,
+		})
+	}
+	return c.JSON(http.StatusOK, sv)
+}
+
+// GET <API_ROOT>/features
+// Return the features (proto.FEATURE_*) enabled on this RM, sorted, so clients
+// can check what it supports instead of comparing versions.
+func (api *API) featuresHandler(c echo.Context) error {
+	return c.JSON(http.StatusOK, api.features())
+}
+
+// features returns Features and the features enabled by config, sorted.
+func (api *API) features() []string {
+	features := make([]string, len(Features), len(Features)+2)
+	copy(features, Features)
+	if api.appCtx.Replica != nil {
+		features = append(features, proto.FEATURE_READ_REPLICA)
+	}
+	// Status push is disabled if stale_after is zero: pushes are ignored
+	staleAfter, err := time.ParseDuration(api.appCtx.Config.StatusPush.StaleAfter)
+	if err == nil && staleAfter > 0 {
+		features = append(features, proto.FEATURE_STATUS_PUSH)
+	}
+	sort.Strings(features)
+	return features
+}
+
 // ------------------------------------------------------------------------- //
 
 func handleError(err error, c echo.Context) error {
+	ret := apiError(err)
+	return c.JSON(ret.HTTPStatus, ret)
+}
+
+// jsonETag returns v as JSON like c.JSON, with an ETag that is a hash of the JSON.
+// If the caller sent the same ETag in If-None-Match, it returns 304 Not Modified
+// without the JSON, so clients that poll (spinc status --watch) get the response
+// only when it changes. The response is still built on every call.
+func jsonETag(c echo.Context, v interface{}) error {
+	var bytes []byte
+	var err error
+	if _, pretty := c.QueryParams()["pretty"]; pretty {
+		bytes, err = json.MarshalIndent(v, "", "  ")
+	} else {
+		bytes, err = json.Marshal(v)
+	}
+	if err != nil {
+		return err
+	}
+	bytes = append(bytes, '\n') // like c.JSON
+	sum := sha1.Sum(bytes)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+	h := c.Response().Header()
+	h.Set("ETag", etag)
+	h.Set("Cache-Control", "no-cache") // revalidate every time
+	if etagMatch(c.Request().Header.Get("If-None-Match"), etag) {
+		return c.NoContent(http.StatusNotModified)
+	}
+	return c.JSONBlob(http.StatusOK, bytes)
+}
+
+// etagMatch returns true if the If-None-Match header value has the ETag or is *.
+// Weak ETags (W/) match, too, as RFC 7232 requires for If-None-Match.
+func etagMatch(ifNoneMatch, etag string) bool {
+	for _, t := range strings.Split(ifNoneMatch, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == etag || t == "*" {
+			return true
+		}
+	}
+	return false
+}
+
+// apiError maps the error to the proto.Error returned to the caller.
+func apiError(err error) proto.Error {
 	ret := proto.Error{
 		Message:    err.Error(),
 		HTTPStatus: http.StatusInternalServerError,
 	}
 
 	switch {
-	case errors.As(err, &serr.RequestNotFound{}), errors.As(err, &serr.JobNotFound{}):
+	case errors.As(err, &serr.RequestNotFound{}), errors.As(err, &serr.RequestTypeNotFound{}), errors.As(err, &serr.JobNotFound{}), errors.As(err, &serr.UpgradeNotFound{}), errors.As(err, &serr.GroupNotFound{}), errors.As(err, &serr.SLONotFound{}):
 		ret.HTTPStatus = http.StatusNotFound
 	case errors.As(err, &serr.ErrInvalidCreateRequest{}):
 		ret.HTTPStatus = http.StatusBadRequest
 	case errors.As(err, &serr.ValidationError{}):
 		ret.HTTPStatus = http.StatusBadRequest
-	case errors.Is(err, ErrShuttingDown):
+	// Conflict: the request or job is not in a state that allows the call.
+	// Invalid state was 500 in earlier versions (see docs/v2.0/api/overview.md).
+	case errors.As(err, &serr.ErrInvalidState{}), errors.As(err, &serr.ErrInvalidTransition{}), errors.As(err, &serr.ErrFenced{}), errors.As(err, &serr.ErrDuplicateJobLog{}), errors.As(err, &serr.ErrJobRunnerHasRequest{}), errors.As(err, &serr.ErrDuplicateRequest{}), errors.As(err, &serr.ErrJobNotRunning{}):
+		ret.HTTPStatus = http.StatusConflict
+	case errors.As(err, &serr.ErrQuotaExceeded{}), errors.Is(err, ErrBulkCreateBusy):
+		ret.HTTPStatus = http.StatusTooManyRequests
+	case errors.Is(err, ErrShuttingDown), errors.As(err, &serr.ErrReadOnly{}), errors.Is(err, request.ErrBuildQueueFull), errors.Is(err, writebuf.ErrFull):
 		ret.HTTPStatus = http.StatusServiceUnavailable
 	}
 
-	return c.JSON(ret.HTTPStatus, ret)
+	return ret
 }
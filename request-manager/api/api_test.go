@@ -3,20 +3,31 @@
 package api_test
 
 import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/go-test/deep"
 	"github.com/labstack/echo/v4"
 
+	"github.com/square/spincycle/v2/config"
+	serr "github.com/square/spincycle/v2/errors"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/accesslog"
 	"github.com/square/spincycle/v2/request-manager/api"
 	"github.com/square/spincycle/v2/request-manager/app"
 	"github.com/square/spincycle/v2/request-manager/auth"
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/spec"
+	"github.com/square/spincycle/v2/request-manager/writebuf"
 	testutil "github.com/square/spincycle/v2/test"
 	"github.com/square/spincycle/v2/test/mock"
 	v "github.com/square/spincycle/v2/version"
@@ -39,6 +50,10 @@ func setup(rm *mock.RequestManager, rr *mock.RequestResumer, jls *mock.JLStore,
 	appCtx.JLS = jls
 	appCtx.RR = rr
 	appCtx.Status = &mock.RMStatus{}
+	appCtx.Quota = &mock.QuotaManager{}
+	appCtx.Upgrade = &mock.UpgradeManager{}
+	appCtx.Group = &mock.GroupManager{}
+	appCtx.SLO = &mock.SLOManager{}
 	appCtx.ShutdownChan = shutdownChan
 	appCtx.Hooks.SetUsername = func(*http.Request) (string, error) {
 		return "admin", nil
@@ -216,6 +231,64 @@ func TestNewRequestHandlerSuccess(t *testing.T) {
 	}
 }
 
+func TestNewRequestHandlerCorrelationId(t *testing.T) {
+	var rmReqParams proto.CreateRequest
+	rm := &mock.RequestManager{
+		CreateFunc: func(reqParams proto.CreateRequest) (proto.Request, error) {
+			rmReqParams = reqParams
+			return proto.Request{Id: "abcd1234", State: proto.STATE_PENDING, CorrelationId: reqParams.CorrelationId}, nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Correlation ID from header
+	payload := `{"type":"something","origin":{"system":"ci","url":"https://ci.local/build/1"}}`
+	httpReq, err := http.NewRequest("POST", baseURL()+"requests", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(api.CORRELATION_ID_HEADER, "build-1")
+	res, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", res.StatusCode, http.StatusCreated)
+	}
+	expectedReqParams := proto.CreateRequest{
+		Type:          "something",
+		User:          "admin",
+		CorrelationId: "build-1",
+		Origin: map[string]string{
+			"system": "ci",
+			"url":    "https://ci.local/build/1",
+		},
+	}
+	if diff := deep.Equal(rmReqParams, expectedReqParams); diff != nil {
+		t.Error(diff)
+	}
+
+	// Correlation ID in payload takes precedence
+	payload = `{"type":"something","correlationId":"build-2"}`
+	httpReq, err = http.NewRequest("POST", baseURL()+"requests", strings.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(api.CORRELATION_ID_HEADER, "build-1")
+	res, err = http.DefaultClient.Do(httpReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if rmReqParams.CorrelationId != "build-2" {
+		t.Errorf("got correlation ID %s, expected build-2", rmReqParams.CorrelationId)
+	}
+}
+
 func TestGetRequestHandlerSuccess(t *testing.T) {
 	reqId := "abcd1234"
 	req := proto.Request{
@@ -249,6 +322,63 @@ func TestGetRequestHandlerSuccess(t *testing.T) {
 	}
 }
 
+func TestGetRequestETag(t *testing.T) {
+	reqId := "abcd1234"
+	req := proto.Request{
+		Id:    reqId,
+		State: proto.STATE_RUNNING,
+	}
+	rm := &mock.RequestManager{
+		GetWithJCFunc: func(r string) (proto.Request, error) {
+			return req, nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	get := func(etag string) *http.Response {
+		httpReq, err := http.NewRequest("GET", baseURL()+"requests/"+reqId, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if etag != "" {
+			httpReq.Header.Set("If-None-Match", etag)
+		}
+		resp, err := http.DefaultClient.Do(httpReq)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		return resp
+	}
+
+	resp := get("")
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("got status %d, ETag %q, expected 200 with an ETag", resp.StatusCode, etag)
+	}
+
+	// Same ETag, request not changed: 304
+	resp = get(etag)
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("response status = %d, expected %d", resp.StatusCode, http.StatusNotModified)
+	}
+	resp = get(`"other", W/` + etag)
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("response status = %d, expected %d (weak ETag in list)", resp.StatusCode, http.StatusNotModified)
+	}
+
+	// Request changed: 200 with a new ETag
+	req.State = proto.STATE_COMPLETE
+	resp = get(etag)
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	if resp.Header.Get("ETag") == etag {
+		t.Errorf("ETag did not change when the request changed")
+	}
+}
+
 func TestFindRequestsHandler(t *testing.T) {
 	reqs := []proto.Request{
 		proto.Request{
@@ -275,7 +405,11 @@ func TestFindRequestsHandler(t *testing.T) {
 			proto.STATE_RUNNING,
 			proto.STATE_SUSPENDED,
 		},
-		User:   "felixp",
+		User: "felixp",
+		Args: map[string]string{
+			"host":  "db1",
+			"query": "a=b",
+		},
 		Since:  time.Date(2020, 01, 01, 12, 34, 56, 789000000, time.UTC),
 		Until:  time.Date(2020, 01, 02, 12, 34, 56, 789000000, time.UTC),
 		Limit:  5,
@@ -306,7 +440,11 @@ func TestFindRequestsHandler(t *testing.T) {
 			proto.STATE_RUNNING,
 			proto.STATE_SUSPENDED,
 		},
-		User:   "felixp",
+		User: "felixp",
+		Args: map[string]string{
+			"host":  "db1",
+			"query": "a=b",
+		},
 		Since:  time.Date(2020, 01, 01, 12, 34, 56, 789000000, time.UTC),
 		Until:  time.Date(2020, 01, 02, 12, 34, 56, 789000000, time.UTC),
 		Limit:  5,
@@ -317,548 +455,3145 @@ func TestFindRequestsHandler(t *testing.T) {
 	}
 }
 
-func TestStartRequestHandlerSuccess(t *testing.T) {
-	reqId := "abcd1234"
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
-	defer cleanup()
-
-	// Make the HTTP request.
-	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/start", []byte{}, nil)
-	if err != nil {
-		t.Fatal(err)
-	}
-
-	// Check that the status code is what we expect.
-	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
-	}
-}
-
-func TestFinishRequestHandlerSuccess(t *testing.T) {
-	reqId := "abcd1234"
-	payload := []byte(fmt.Sprintf("{\"state\":%d}", proto.STATE_COMPLETE))
-	// Create a mock request manager that will record the finish params it receives.
-	var rmFinishParams proto.FinishRequest
+func TestFindRequestsHandlerMine(t *testing.T) {
+	// mine=true finds requests made by the caller: username "admin" (setup)
+	var gotFilter proto.RequestFilter
 	rm := &mock.RequestManager{
-		FinishFunc: func(r string, f proto.FinishRequest) error {
-			rmFinishParams = f
-			return nil
+		FindFunc: func(filter proto.RequestFilter) ([]proto.Request, error) {
+			gotFilter = filter
+			return []proto.Request{}, nil
 		},
 	}
 	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/finish", payload, nil)
+	sentFilter := proto.RequestFilter{Mine: true, States: []byte{proto.STATE_RUNNING}}
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests?"+sentFilter.String(), []byte{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-
-	// Check that the finish params sent to the request manager are what we expect.
-	expectedFinishParams := proto.FinishRequest{
-		State: proto.STATE_COMPLETE,
+	expectFilter := proto.RequestFilter{
+		User:   "admin",
+		Mine:   true,
+		States: []byte{proto.STATE_RUNNING},
 	}
-	if diff := deep.Equal(rmFinishParams, expectedFinishParams); diff != nil {
+	if diff := deep.Equal(gotFilter, expectFilter); diff != nil {
 		t.Error(diff)
 	}
-}
 
-func TestStopRequestHandlerSuccess(t *testing.T) {
-	reqId := "abcd1234"
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
-	defer cleanup()
-
-	// Make the HTTP request.
-	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/stop", []byte{}, nil)
+	// Cannot find another user's requests with mine=true
+	sentFilter = proto.RequestFilter{Mine: true, User: "felixp"}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"requests?"+sentFilter.String(), []byte{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
-	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
 	}
 }
 
-func TestSuspendRequestHandlerSuccess(t *testing.T) {
-	reqId := "729ghskd329dhj3sbjnr"
-	payload := []byte("{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobChain\":{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobs\":{\"hw48\":{\"id\":\"hw48\",\"type\":\"test\",\"bytes\":null,\"state\":6,\"args\":null,\"data\":null,\"retry\":5,\"retryWait\":\"1s\",\"sequenceId\":\"hw48\",\"sequenceRetry\":1}},\"adjacencyList\":null,\"state\":7},\"totalJobTries\":{\"hw48\":5},\"latestRunJobTries\":{\"hw48\":2},\"sequenceTries\":{\"hw48\":1}}")
-
-	// Create a mock request manager that will record the finish params it receives.
-	var rrSJC proto.SuspendedJobChain
-	rr := &mock.RequestResumer{
-		SuspendFunc: func(sjc proto.SuspendedJobChain) error {
-			rrSJC = sjc
-			return nil
+func TestRequestHistoryHandler(t *testing.T) {
+	h := proto.RequestHistory{
+		Type:           "request-type",
+		Since:          time.Date(2020, 01, 01, 12, 34, 56, 789000000, time.UTC),
+		Requests:       []proto.Request{{Id: "abcd1234", State: proto.STATE_COMPLETE}},
+		Total:          2,
+		States:         map[string]uint{"COMPLETE": 1, "FAIL": 1},
+		Finished:       2,
+		SuccessRate:    0.5,
+		MedianDuration: 90,
+	}
+	var gotType string
+	var gotSince time.Time
+	var gotLimit uint
+	rm := &mock.RequestManager{
+		HistoryFunc: func(reqType string, since time.Time, limit uint) (proto.RequestHistory, error) {
+			gotType = reqType
+			gotSince = since
+			gotLimit = limit
+			return h, nil
 		},
 	}
-	setup(&mock.RequestManager{}, rr, &mock.JLStore{}, make(chan struct{}))
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/suspend", payload, nil)
+	var actual proto.RequestHistory
+	url := baseURL() + "request-history?type=request-type&since=2020-01-01T12:34:56.789Z&limit=5"
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", url, []byte{}, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
-	}
-
-	// Check that the finish params sent to the request manager are what we expect.
-	expectedSJC := proto.SuspendedJobChain{
-		RequestId:         reqId,
-		TotalJobTries:     map[string]uint{"hw48": 5},
-		LatestRunJobTries: map[string]uint{"hw48": 2},
-		SequenceTries:     map[string]uint{"hw48": 1},
-		JobChain: &proto.JobChain{
-			RequestId: reqId,
-			Jobs: map[string]proto.Job{
-				"hw48": proto.Job{
-					Id:            "hw48",
-					Type:          "test",
-					State:         proto.STATE_STOPPED,
-					Retry:         5,
-					RetryWait:     "1s",
-					SequenceId:    "hw48",
-					SequenceRetry: 1,
-				},
-			},
-			State: proto.STATE_SUSPENDED,
-		},
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-	if diff := deep.Equal(rrSJC, expectedSJC); diff != nil {
+	if diff := deep.Equal(actual, h); diff != nil {
 		t.Error(diff)
 	}
-}
-
-func TestSuspendRequestHandlerInvalidPayload(t *testing.T) {
-	payload := `"bad":"json"}` // Bad payload.
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
-	defer cleanup()
+	if gotType != "request-type" || !gotSince.Equal(h.Since) || gotLimit != 5 {
+		t.Errorf("got type %s, since %s, limit %d; expected request-type, %s, 5", gotType, gotSince, gotLimit, h.Since)
+	}
 
-	// Make the HTTP request.
-	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/4/suspend", []byte(payload), nil)
+	// Type is required
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"request-history", []byte{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusBadRequest {
 		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
 	}
 }
 
-func TestSuspendRequestHandlerRMError(t *testing.T) {
-	// reqId := "4"
-	// payload := `{"requestId":"4","jobChain":{"requestId":"4","jobs":{"hw48":{"id":"hw48","type":"test","state":6,"retry":5,"sequenceId":"hw48","sequenceRetry":1}},"state":7},"jobTries":{"hw48":5},"stoppedJobTries":{"hw48":2},"sequenceRetries":{"hw48":1}}`
-	reqId := "729ghskd329dhj3sbjnr"
-	payload := []byte("{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobChain\":{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobs\":{\"hw48\":{\"id\":\"hw48\",\"type\":\"test\",\"bytes\":null,\"state\":6,\"args\":null,\"data\":null,\"retry\":5,\"retryWait\":\"1s\",\"sequenceId\":\"hw48\",\"sequenceRetry\":1}},\"adjacencyList\":null,\"state\":7},\"totalJobTries\":{\"hw48\":5},\"latestRunJobTries\":{\"hw48\":2},\"sequenceTries\":{\"hw48\":1}}")
-
-	// Create a mock request manager that will return an error and record the
-	// sjc it receives.
-	var rrSJC proto.SuspendedJobChain
-	rr := &mock.RequestResumer{
-		SuspendFunc: func(sjc proto.SuspendedJobChain) error {
-			rrSJC = sjc
-			return mock.ErrRequestResumer
+func TestRequestTypeHandler(t *testing.T) {
+	md := proto.RequestTypeMetadata{
+		Request: proto.RequestSpec{Name: "restart-db", Args: []proto.RequestArg{}, Description: "Restart MySQL"},
+		Sequences: []proto.SequenceMetadata{
+			{
+				Name:        "restart-db",
+				Description: "Restart MySQL",
+				Nodes:       []proto.NodeMetadata{{Name: "stop", Category: "job", Type: "stop-mysql", DocsURL: "https://wiki.local/stop"}},
+			},
 		},
 	}
-	setup(&mock.RequestManager{}, rr, &mock.JLStore{}, make(chan struct{}))
+	rm := &mock.RequestManager{
+		MetadataFunc: func(reqType string) (proto.RequestTypeMetadata, error) {
+			if reqType != "restart-db" {
+				return proto.RequestTypeMetadata{}, serr.RequestTypeNotFound{Type: reqType}
+			}
+			return md, nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/suspend", []byte(payload), nil)
+	var actual proto.RequestTypeMetadata
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"request-types/restart-db", []byte{}, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
-	if statusCode != http.StatusInternalServerError {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusInternalServerError)
+	if statusCode != http.StatusOK {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(actual, md); diff != nil {
+		t.Error(diff)
 	}
 
-	// Check the request params sent to the request manager.
-	expectedSJC := proto.SuspendedJobChain{
-		RequestId:         reqId,
-		TotalJobTries:     map[string]uint{"hw48": 5},
-		LatestRunJobTries: map[string]uint{"hw48": 2},
-		SequenceTries:     map[string]uint{"hw48": 1},
-		JobChain: &proto.JobChain{
-			RequestId: reqId,
-			Jobs: map[string]proto.Job{
-				"hw48": proto.Job{
-					Id:            "hw48",
-					Type:          "test",
-					State:         proto.STATE_STOPPED,
-					Retry:         5,
-					RetryWait:     "1s",
-					SequenceId:    "hw48",
-					SequenceRetry: 1,
-				},
-			},
-			State: proto.STATE_SUSPENDED,
-		},
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"request-types/nope", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if diff := deep.Equal(rrSJC, expectedSJC); diff != nil {
-		t.Error(diff)
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
 	}
 }
 
-func TestGetJobChainRequestHandlerSuccess(t *testing.T) {
+func TestExportRequestHandler(t *testing.T) {
 	reqId := "abcd1234"
-	jc := proto.JobChain{
-		RequestId: reqId,
-		State:     proto.STATE_RUNNING,
+	b := proto.RequestBundle{
+		Request: proto.Request{
+			Id:       reqId,
+			Type:     "request-type",
+			State:    proto.STATE_FAIL,
+			JobChain: &proto.JobChain{RequestId: reqId},
+		},
+		CreateRequest: proto.CreateRequest{Type: "request-type", User: "finch"},
+		Version:       "2.0.0",
 	}
-	// Create a mock jobchain store that will return a job chain.
+	jl := []proto.JobLog{{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_FAIL, Stdout: "out"}}
+	var gotFilter proto.JobLogFilter
 	rm := &mock.RequestManager{
-		JobChainFunc: func(r string) (proto.JobChain, error) {
-			return jc, nil
+		ExportFunc: func(id string) (proto.RequestBundle, error) {
+			if id != reqId {
+				return proto.RequestBundle{}, serr.RequestNotFound{RequestId: id}
+			}
+			return b, nil
 		},
 	}
-	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	jls := &mock.JLStore{
+		GetFullFunc: func(id string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			gotFilter = f
+			return jl, nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, jls, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	var actualJc proto.JobChain
-	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/job-chain", []byte{}, &actualJc)
+	var actual proto.RequestBundle
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/export", []byte{}, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
 
-	// Check that the job chain is what we expect.
-	if diff := deep.Equal(actualJc, jc); diff != nil {
+	// Bundle has all job logs with output
+	b.JobLogs = jl
+	if diff := deep.Equal(actual, b); diff != nil {
 		t.Error(diff)
 	}
+	if diff := deep.Equal(gotFilter, proto.JobLogFilter{}); diff != nil {
+		t.Error(diff)
+	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"requests/nonexistent/export", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
 }
 
-func TestGetJLHandlerSuccess(t *testing.T) {
+func TestRequestFailureHandler(t *testing.T) {
 	reqId := "abcd1234"
-	jobId := "job1"
-	jl := proto.JobLog{
-		RequestId: reqId,
-		State:     proto.STATE_COMPLETE,
+	rm := &mock.RequestManager{
+		GetFunc: func(id string) (proto.Request, error) {
+			if id != reqId {
+				return proto.Request{}, serr.RequestNotFound{RequestId: id}
+			}
+			return proto.Request{Id: reqId, State: proto.STATE_FAIL}, nil
+		},
+		JobChainFunc: func(id string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId:     reqId,
+				Jobs:          map[string]proto.Job{"j1": {Id: "j1", Name: "job1"}, "j2": {Id: "j2", Name: "job2"}},
+				AdjacencyList: map[string][]string{"j1": {"j2"}},
+			}, nil
+		},
 	}
-	// Create a mock joblog store that will return a jl.
+	var gotFilter proto.JobLogFilter
 	jls := &mock.JLStore{
-		GetFunc: func(r string, j string) (proto.JobLog, error) {
-			return jl, nil
+		GetFullFunc: func(id string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			gotFilter = f
+			return []proto.JobLog{{RequestId: reqId, JobId: "j1", Name: "job1", Try: 1, State: proto.STATE_FAIL, Error: "oops"}}, nil
 		},
 	}
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	setup(rm, &mock.RequestResumer{}, jls, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	var actualjl proto.JobLog
-	statusCode, _, err := testutil.MakeHTTPRequest("GET",
-		baseURL()+"requests/"+reqId+"/log/"+jobId, []byte{}, &actualjl)
+	var actual proto.RequestFailure
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/failure", []byte{}, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-
-	// Check that the job chain is what we expect.
-	if diff := deep.Equal(actualjl, jl); diff != nil {
+	expect := proto.RequestFailure{
+		RequestId:   reqId,
+		State:       proto.STATE_FAIL,
+		FailedJob:   &proto.JobLog{RequestId: reqId, JobId: "j1", Name: "job1", Try: 1, State: proto.STATE_FAIL, Error: "oops"},
+		FailedTries: 1,
+		SkippedJobs: []proto.Job{{Id: "j2", Name: "job2"}},
+	}
+	if diff := deep.Equal(actual, expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(gotFilter, proto.JobLogFilter{NoOutput: true}); diff != nil {
 		t.Error(diff)
 	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"requests/nonexistent/failure", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
 }
 
-func TestGetFullJLHandlerSuccess(t *testing.T) {
+func TestRequestLogLevelHandler(t *testing.T) {
 	reqId := "abcd1234"
-	jlList := []proto.JobLog{
-		proto.JobLog{
-			RequestId: reqId,
-			State:     proto.STATE_COMPLETE,
-		},
-	}
-	// Create a mock joblog store that will return a list of JLs.
-	jls := &mock.JLStore{
-		GetFullFunc: func(r string) ([]proto.JobLog, error) {
-			return jlList, nil
+	until := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var gotId string
+	var gotLL proto.RequestLogLevel
+	rm := &mock.RequestManager{
+		SetLogLevelFunc: func(id string, ll proto.RequestLogLevel) (proto.RequestLogLevel, error) {
+			gotId = id
+			gotLL = ll
+			if ll.Level == "chatty" {
+				return ll, serr.ValidationError{Message: "invalid log level"}
+			}
+			ll.Until = until
+			return ll, nil
 		},
 	}
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	var actualjlList []proto.JobLog
-	statusCode, _, err := testutil.MakeHTTPRequest("GET",
-		baseURL()+"requests/"+reqId+"/log", []byte{}, &actualjlList)
+	var actual proto.RequestLogLevel
+	payload := []byte(`{"level":"debug","duration":"30m"}`)
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/log-level", payload, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-
-	// Check that the job chain is what we expect.
-	if diff := deep.Equal(actualjlList, jlList); diff != nil {
+	if gotId != reqId {
+		t.Errorf("got request id %s, expected %s", gotId, reqId)
+	}
+	if diff := deep.Equal(gotLL, proto.RequestLogLevel{Level: "debug", Duration: "30m"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(actual, proto.RequestLogLevel{Level: "debug", Duration: "30m", Until: until}); diff != nil {
 		t.Error(diff)
 	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/log-level", []byte(`{"level":"chatty"}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
 }
 
-func TestCreateJLHandlerSuccess(t *testing.T) {
+func TestResumePointsHandlers(t *testing.T) {
 	reqId := "abcd1234"
-	payload := []byte(fmt.Sprintf("{\"requestId\":\"%s\",\"state\":%d}", reqId, proto.STATE_COMPLETE))
-	jl := proto.JobLog{
+	jc := proto.JobChain{
 		RequestId: reqId,
-		State:     proto.STATE_COMPLETE,
+		Jobs:      map[string]proto.Job{"j1": {Id: "j1", State: proto.STATE_STOPPED}},
 	}
-	// Create a mock joblog store that will return a jl and record the jl it receives.
-	var rmjl proto.JobLog
-	jls := &mock.JLStore{
-		CreateFunc: func(r string, j proto.JobLog) (proto.JobLog, error) {
-			rmjl = j
-			return jl, nil
+	var gotRP proto.ResumePoints
+	rr := &mock.RequestResumer{
+		ResumePointsFunc: func(id string) (proto.JobChain, error) {
+			if id != reqId {
+				return proto.JobChain{}, serr.NewErrInvalidState("SUSPENDED", "RUNNING")
+			}
+			return jc, nil
+		},
+		SetResumePointsFunc: func(id string, rp proto.ResumePoints) (proto.JobChain, error) {
+			gotRP = rp
+			if rp.Jobs["j1"] == "run" {
+				return proto.JobChain{}, serr.ValidationError{Message: "invalid resume point"}
+			}
+			changed := jc
+			changed.Jobs = map[string]proto.Job{"j1": {Id: "j1", State: proto.STATE_COMPLETE}}
+			changed.FinishedJobs = 1
+			return changed, nil
 		},
 	}
-
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	setup(&mock.RequestManager{}, rr, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	var actualjl proto.JobLog
-	statusCode, _, err := testutil.MakeHTTPRequest("POST",
-		baseURL()+"requests/"+reqId+"/log", payload, &actualjl)
+	var actual proto.JobChain
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/resume-points", []byte{}, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(actual, jc); diff != nil {
+		t.Error(diff)
+	}
 
-	// Check that the status code is what we expect.
-	if statusCode != http.StatusCreated {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"requests/running/resume-points", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
 	}
 
-	// Check that the response body is what we expect.
-	if diff := deep.Equal(actualjl, jl); diff != nil {
+	payload := []byte(`{"jobs":{"j1":"complete"},"hold":"10m"}`)
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/resume-points", payload, &actual)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotRP, proto.ResumePoints{Jobs: map[string]string{"j1": proto.RESUME_COMPLETE}, Hold: "10m"}); diff != nil {
 		t.Error(diff)
 	}
+	if actual.FinishedJobs != 1 {
+		t.Errorf("got FinishedJobs %d, expected 1", actual.FinishedJobs)
+	}
 
-	// Check the jl sent to the request manager is what we expect.
-	if diff := deep.Equal(rmjl, jl); diff != nil {
-		t.Error(diff)
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/resume-points", []byte(`{"jobs":{"j1":"run"}}`), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
 	}
 }
 
-func TestCreateJLHandlerJobFailed(t *testing.T) {
-	reqId := "abcd1234"
-	payload := []byte(fmt.Sprintf("{\"requestId\":\"%s\",\"state\":%d}", reqId, proto.STATE_FAIL))
-	jl := proto.JobLog{
-		RequestId: reqId,
-		State:     proto.STATE_FAIL,
+func TestImportRequestHandler(t *testing.T) {
+	b := proto.RequestBundle{
+		Request: proto.Request{
+			Id:       "abcd1234",
+			Type:     "request-type",
+			State:    proto.STATE_COMPLETE,
+			JobChain: &proto.JobChain{RequestId: "abcd1234"},
+		},
+		Version: "2.0.0",
 	}
-	// Create a mock joblog store that will return a jl.
-	jls := &mock.JLStore{
-		CreateFunc: func(r string, j proto.JobLog) (proto.JobLog, error) {
-			return jl, nil
+	var gotBundle proto.RequestBundle
+	rm := &mock.RequestManager{
+		ImportFunc: func(b proto.RequestBundle) (proto.Request, error) {
+			gotBundle = b
+			return b.Request, nil
 		},
 	}
-
-	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
 
-	// Make the HTTP request.
-	var actualjl proto.JobLog
-	statusCode, _, err := testutil.MakeHTTPRequest("POST",
-		baseURL()+"requests/"+reqId+"/log", payload, &actualjl)
+	payload, err := json.Marshal(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actual proto.Request
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"requests/import", payload, &actual)
 	if err != nil {
 		t.Fatal(err)
 	}
-
-	// Check that the status code is what we expect.
 	if statusCode != http.StatusCreated {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	if diff := deep.Equal(gotBundle, b); diff != nil {
+		t.Error(diff)
 	}
-}
 
-func TestAuth(t *testing.T) {
-	// Test authentication and authorizaiton with an auth plugin we control.
-	// The app default auth allows everything, so we have to override the plugin.
-	var caller auth.Caller
-	var authenErr, authorErr error
-	var authenticateCalled, authorizeCalled, createCalled, startCalled bool
-	var authOp string
-	reset := func() {
-		authenticateCalled = false
-		authorizeCalled = false
-		createCalled = false
-		startCalled = false
-		authenErr = nil
-		authorErr = nil
-		authOp = ""
-		caller = auth.Caller{
-			Name:  "dn",
-			Roles: []string{"role1", "role2"}, // matches roles in auth-001.yaml (see below)
-		}
+	// Job chain isn't returned
+	expect := b.Request
+	expect.JobChain = nil
+	if diff := deep.Equal(actual, expect); diff != nil {
+		t.Error(diff)
 	}
+}
+
+func TestImportRequestHandlerNotAdmin(t *testing.T) {
+	importCalled := false
 	ctx := app.Defaults()
 	ctx.Plugins.Auth = mock.AuthPlugin{
 		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
-			authenticateCalled = true
-			return caller, authenErr
-		},
-		AuthorizeFunc: func(c auth.Caller, op string, req proto.Request) error {
-			authorizeCalled = true
-			authOp = op
-			return authorErr
+			return auth.Caller{Name: "dn", Roles: []string{"dev"}}, nil
 		},
 	}
-
-	req := proto.Request{
-		Id:    "xyz",
-		Type:  "req1",
-		State: proto.STATE_PENDING,
-	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
 	ctx.RM = &mock.RequestManager{
-		CreateFunc: func(proto.CreateRequest) (proto.Request, error) {
-			createCalled = true
-			return req, nil
-		},
-		StartFunc: func(string) error {
-			startCalled = true
-			return nil
-		},
-	}
-
-	acls := map[string][]auth.ACL{
-		"req1": []auth.ACL{
-			{
-				Role:  "role1",
-				Admin: true,
-			},
-			{
-				Role: "role2",
-				Ops:  []string{"start", "stop"},
-			},
+		ImportFunc: func(b proto.RequestBundle) (proto.Request, error) {
+			importCalled = true
+			return b.Request, nil
 		},
 	}
-	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, acls, nil, true)
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
 
 	server := httptest.NewServer(api.NewAPI(ctx))
 	defer func() {
 		server.CloseClientConnections()
 		server.Close()
 	}()
-	baseURL := server.URL + api.API_ROOT
-
-	payload := `{"type":"req1","args":{"arg1":"hello","second":"arg2"}}`
-
-	// Authentication fails
-	// ----------------------------------------------------------------------
-
-	reset()
-	authenErr = fmt.Errorf("forced authenticated error")
 
-	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	payload := []byte(`{"request":{"id":"abcd1234","type":"request-type"}}`)
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", server.URL+api.API_ROOT+"requests/import", payload, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
 	if statusCode != http.StatusUnauthorized {
 		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
 	}
-	if authenticateCalled == false {
-		t.Errorf("Authenticate not called, expected it to be called")
-	}
-	if authorizeCalled == true {
-		t.Errorf("Authorize called, expected it NOT to be called")
-	}
-	if createCalled == true {
-		t.Errorf("request.Manager.Create called, expected it NOT to be called")
+	if importCalled {
+		t.Error("request imported, expected only admins to import")
 	}
+}
 
-	// Authentication ok, then authorize fails in the controller
-	// ----------------------------------------------------------------------
-
-	reset()
-	authorErr = fmt.Errorf("forced authorization error")
+func TestRetryRequestHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	payload := `{"args":{"host":"db2.local"}}`
+	newReq := proto.Request{
+		Id:      "efgh5678",
+		State:   proto.STATE_PENDING,
+		RetryOf: reqId,
+	}
+	// Create a mock request manager that will record the retry params it receives
+	// and the request it starts.
+	var rmRetryParams proto.RetryRequest
+	var started string
+	rm := &mock.RequestManager{
+		GetFunc: func(r string) (proto.Request, error) {
+			return proto.Request{Id: r, State: proto.STATE_FAIL}, nil
+		},
+		RetryFunc: func(r string, retry proto.RetryRequest) (proto.Request, error) {
+			if r != reqId {
+				t.Errorf("retried request %s, expected %s", r, reqId)
+			}
+			rmRetryParams = retry
+			return newReq, nil
+		},
+		StartFunc: func(r string) error {
+			started = r
+			return nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
 
-	var resp echo.HTTPError
-	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), &resp)
-	t.Logf("resp: %+v", resp)
+	// Make the HTTP request.
+	var actualReq proto.Request
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"requests/"+reqId+"/retry", []byte(payload), &actualReq)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if statusCode != http.StatusUnauthorized {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
-	}
-	if authenticateCalled == false {
-		t.Errorf("Authenticate not called, expected it to be called")
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
 	}
-	if authorizeCalled == false {
-		t.Errorf("Authorize not called, expected it to be called")
+
+	// Check that the response body is the new request, and that it was started.
+	if diff := deep.Equal(actualReq, newReq); diff != nil {
+		t.Error(diff)
 	}
-	if authOp != proto.REQUEST_OP_START {
-		t.Errorf("got op %s, expected %s", authOp, proto.REQUEST_OP_START)
+	if started != newReq.Id {
+		t.Errorf("started request '%s', expected %s", started, newReq.Id)
 	}
-	if createCalled == false { // have to create it to authorize it
-		t.Errorf("request.Manager.Create not called, expected it to be called")
+
+	// Check the retry params sent to the request manager.
+	expectedRetryParams := proto.RetryRequest{
+		Args: map[string]interface{}{"host": "db2.local"},
+		User: "admin",
 	}
-	if startCalled == true { // but auth fails, so don't start it
-		t.Errorf("request.Manager.Start called, expected it NOT to be called")
+	if diff := deep.Equal(rmRetryParams, expectedRetryParams); diff != nil {
+		t.Error(diff)
 	}
+}
 
-	// All auth OK
-	// ----------------------------------------------------------------------
+func TestRetryRequestHandlerInvalidState(t *testing.T) {
+	reqId := "abcd1234"
+	rm := &mock.RequestManager{
+		GetFunc: func(r string) (proto.Request, error) {
+			return proto.Request{Id: r, State: proto.STATE_RUNNING}, nil
+		},
+		RetryFunc: func(r string, retry proto.RetryRequest) (proto.Request, error) {
+			return proto.Request{}, serr.NewErrInvalidState(proto.StateName[proto.STATE_FAIL], proto.StateName[proto.STATE_RUNNING])
+		},
+		StartFunc: func(r string) error {
+			t.Errorf("request %s started, expected no new request", r)
+			return nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
 
-	reset()
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"requests/"+reqId+"/retry", []byte("{}"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
+	}
+}
 
-	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+func TestStartRequestHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/start", []byte{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if statusCode != http.StatusCreated {
-		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-	if authenticateCalled == false {
-		t.Errorf("Authenticate not called, expected it to be called")
+}
+
+func TestFinishRequestHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	payload := []byte(fmt.Sprintf("{\"state\":%d}", proto.STATE_COMPLETE))
+	// Create a mock request manager that will record the finish params it receives.
+	var rmFinishParams proto.FinishRequest
+	rm := &mock.RequestManager{
+		FinishFunc: func(r string, f proto.FinishRequest) error {
+			rmFinishParams = f
+			return nil
+		},
 	}
-	if authorizeCalled == false {
-		t.Errorf("Authorize not called, expected it to be called")
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/finish", payload, nil)
+	if err != nil {
+		t.Fatal(err)
 	}
-	if createCalled == false {
-		t.Errorf("request.Manager.Create not called, expected it to be called")
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-	if startCalled == false {
-		t.Errorf("request.Manager.Start not called, expected it to be called")
+
+	// Check that the finish params sent to the request manager are what we expect.
+	expectedFinishParams := proto.FinishRequest{
+		State: proto.STATE_COMPLETE,
+	}
+	if diff := deep.Equal(rmFinishParams, expectedFinishParams); diff != nil {
+		t.Error(diff)
 	}
 }
 
-func TestGetVersion(t *testing.T) {
+func TestStopRequestHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
 	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
 	defer cleanup()
-	resp, err := http.Get(server.URL + "/version")
+
+	// Make the HTTP request.
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/stop", []byte{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+}
+
+func TestStopRequestHandlerTimeout(t *testing.T) {
+	reqId := "abcd1234"
+	var gotTimeout time.Duration
+	rm := &mock.RequestManager{
+		StopFunc: func(id string, timeout time.Duration) error {
+			gotTimeout = timeout
+			return nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/stop?timeout=5m", []byte{}, nil)
 	if err != nil {
 		t.Fatal(err)
 	}
-	if resp.StatusCode != http.StatusOK {
-		t.Errorf("response status = %d, expected %d", resp.StatusCode, http.StatusOK)
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
 	}
-	expectVersion := v.Version()
-	gotVersion := string(body)
-	if gotVersion != expectVersion {
-		t.Errorf("got version '%s', expected '%s'", gotVersion, expectVersion)
+	if gotTimeout != 5*time.Minute {
+		t.Errorf("timeout = %s, expected 5m", gotTimeout)
+	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/stop?timeout=soon", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+}
+
+func TestStopJobHandler(t *testing.T) {
+	reqId := "abcd1234"
+	var gotJobId string
+	var stopErr error
+	rm := &mock.RequestManager{
+		StopJobFunc: func(id, jobId string) error {
+			gotJobId = jobId
+			return stopErr
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/jobs/job1/stop", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if gotJobId != "job1" {
+		t.Errorf("stopped job %q, expected job1", gotJobId)
+	}
+
+	// Job not running a try: 409
+	stopErr = serr.ErrJobNotRunning{RequestId: reqId, JobId: "job1"}
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/jobs/job1/stop", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
+	}
+}
+
+func TestSuspendRequestHandlerSuccess(t *testing.T) {
+	reqId := "729ghskd329dhj3sbjnr"
+	payload := []byte("{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobChain\":{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobs\":{\"hw48\":{\"id\":\"hw48\",\"type\":\"test\",\"bytes\":null,\"state\":6,\"args\":null,\"data\":null,\"retry\":5,\"retryWait\":\"1s\",\"sequenceId\":\"hw48\",\"sequenceRetry\":1}},\"adjacencyList\":null,\"state\":7},\"totalJobTries\":{\"hw48\":5},\"latestRunJobTries\":{\"hw48\":2},\"sequenceTries\":{\"hw48\":1}}")
+
+	// Create a mock request manager that will record the finish params it receives.
+	var rrSJC proto.SuspendedJobChain
+	rr := &mock.RequestResumer{
+		SuspendFunc: func(sjc proto.SuspendedJobChain) error {
+			rrSJC = sjc
+			return nil
+		},
+	}
+	setup(&mock.RequestManager{}, rr, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/suspend", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	// Check that the finish params sent to the request manager are what we expect.
+	expectedSJC := proto.SuspendedJobChain{
+		RequestId:         reqId,
+		TotalJobTries:     map[string]uint{"hw48": 5},
+		LatestRunJobTries: map[string]uint{"hw48": 2},
+		SequenceTries:     map[string]uint{"hw48": 1},
+		JobChain: &proto.JobChain{
+			RequestId: reqId,
+			Jobs: map[string]proto.Job{
+				"hw48": proto.Job{
+					Id:            "hw48",
+					Type:          "test",
+					State:         proto.STATE_STOPPED,
+					Retry:         5,
+					RetryWait:     "1s",
+					SequenceId:    "hw48",
+					SequenceRetry: 1,
+				},
+			},
+			State: proto.STATE_SUSPENDED,
+		},
+	}
+	if diff := deep.Equal(rrSJC, expectedSJC); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSuspendRequestHandlerProtobuf(t *testing.T) {
+	reqId := "729ghskd329dhj3sbjnr"
+	sjc := proto.SuspendedJobChain{
+		RequestId: reqId,
+		JobChain: &proto.JobChain{
+			RequestId: reqId,
+			Jobs:      map[string]proto.Job{"hw48": {Id: "hw48", Type: "test", State: proto.STATE_STOPPED}},
+			State:     proto.STATE_SUSPENDED,
+		},
+		TotalJobTries: map[string]uint{"hw48": 5},
+	}
+	var rrSJC proto.SuspendedJobChain
+	rr := &mock.RequestResumer{
+		SuspendFunc: func(sjc proto.SuspendedJobChain) error {
+			rrSJC = sjc
+			return nil
+		},
+	}
+	setup(&mock.RequestManager{}, rr, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	payload, err := proto.EncodeSuspendedJobChain(sjc, proto.CHAIN_FORMAT_PROTOBUF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req, err := http.NewRequest("PUT", baseURL()+"requests/"+reqId+"/suspend", bytes.NewReader(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", proto.CONTENT_TYPE_PROTOBUF)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", res.StatusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(rrSJC, sjc); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestSuspendRequestHandlerInvalidPayload(t *testing.T) {
+	payload := `"bad":"json"}` // Bad payload.
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/4/suspend", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+}
+
+func TestSuspendRequestHandlerRMError(t *testing.T) {
+	// reqId := "4"
+	// payload := `{"requestId":"4","jobChain":{"requestId":"4","jobs":{"hw48":{"id":"hw48","type":"test","state":6,"retry":5,"sequenceId":"hw48","sequenceRetry":1}},"state":7},"jobTries":{"hw48":5},"stoppedJobTries":{"hw48":2},"sequenceRetries":{"hw48":1}}`
+	reqId := "729ghskd329dhj3sbjnr"
+	payload := []byte("{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobChain\":{\"requestId\":\"729ghskd329dhj3sbjnr\",\"jobs\":{\"hw48\":{\"id\":\"hw48\",\"type\":\"test\",\"bytes\":null,\"state\":6,\"args\":null,\"data\":null,\"retry\":5,\"retryWait\":\"1s\",\"sequenceId\":\"hw48\",\"sequenceRetry\":1}},\"adjacencyList\":null,\"state\":7},\"totalJobTries\":{\"hw48\":5},\"latestRunJobTries\":{\"hw48\":2},\"sequenceTries\":{\"hw48\":1}}")
+
+	// Create a mock request manager that will return an error and record the
+	// sjc it receives.
+	var rrSJC proto.SuspendedJobChain
+	rr := &mock.RequestResumer{
+		SuspendFunc: func(sjc proto.SuspendedJobChain) error {
+			rrSJC = sjc
+			return mock.ErrRequestResumer
+		},
+	}
+	setup(&mock.RequestManager{}, rr, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL()+"requests/"+reqId+"/suspend", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusInternalServerError {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusInternalServerError)
+	}
+
+	// Check the request params sent to the request manager.
+	expectedSJC := proto.SuspendedJobChain{
+		RequestId:         reqId,
+		TotalJobTries:     map[string]uint{"hw48": 5},
+		LatestRunJobTries: map[string]uint{"hw48": 2},
+		SequenceTries:     map[string]uint{"hw48": 1},
+		JobChain: &proto.JobChain{
+			RequestId: reqId,
+			Jobs: map[string]proto.Job{
+				"hw48": proto.Job{
+					Id:            "hw48",
+					Type:          "test",
+					State:         proto.STATE_STOPPED,
+					Retry:         5,
+					RetryWait:     "1s",
+					SequenceId:    "hw48",
+					SequenceRetry: 1,
+				},
+			},
+			State: proto.STATE_SUSPENDED,
+		},
+	}
+	if diff := deep.Equal(rrSJC, expectedSJC); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestGetJobChainRequestHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	jc := proto.JobChain{
+		RequestId: reqId,
+		State:     proto.STATE_RUNNING,
+	}
+	// Create a mock jobchain store that will return a job chain.
+	rm := &mock.RequestManager{
+		JobChainFunc: func(r string) (proto.JobChain, error) {
+			return jc, nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	var actualJc proto.JobChain
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/job-chain", []byte{}, &actualJc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	// Check that the job chain is what we expect.
+	if diff := deep.Equal(actualJc, jc); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestGetJobChainExport(t *testing.T) {
+	reqId := "abcd1234"
+	jc := proto.JobChain{
+		RequestId:   reqId,
+		RequestType: "restart-app",
+		Jobs: map[string]proto.Job{
+			"j1": {Id: "j1", Name: "stop", Type: "stop-app"},
+			"j2": {Id: "j2", Name: "start", Type: "start-app"},
+		},
+		AdjacencyList: map[string][]string{"j1": {"j2"}},
+	}
+	rm := &mock.RequestManager{
+		JobChainFunc: func(r string) (proto.JobChain, error) {
+			return jc, nil
+		},
+	}
+	setup(rm, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+
+	var dag graph.DAG
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/job-chain?format=dag", []byte{}, &dag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(dag, graph.ChainDAG(jc)); diff != nil {
+		t.Error(diff)
+	}
+
+	statusCode, headers, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/job-chain?format=argo", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if ct := headers.Get("Content-Type"); ct != "application/yaml" {
+		t.Errorf("got Content-Type %s, expected application/yaml", ct)
+	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/job-chain?format=bpmn", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+}
+
+func TestGetJLHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	jobId := "job1"
+	jl := proto.JobLog{
+		RequestId: reqId,
+		State:     proto.STATE_COMPLETE,
+	}
+	// Create a mock joblog store that will return a jl.
+	jls := &mock.JLStore{
+		GetFunc: func(r string, j string) (proto.JobLog, error) {
+			return jl, nil
+		},
+	}
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	var actualjl proto.JobLog
+	statusCode, _, err := testutil.MakeHTTPRequest("GET",
+		baseURL()+"requests/"+reqId+"/log/"+jobId, []byte{}, &actualjl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	// Check that the job chain is what we expect.
+	if diff := deep.Equal(actualjl, jl); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestGetFullJLHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	jlList := []proto.JobLog{
+		proto.JobLog{
+			RequestId: reqId,
+			State:     proto.STATE_COMPLETE,
+		},
+	}
+	// Create a mock joblog store that will return a list of JLs.
+	jls := &mock.JLStore{
+		GetFullFunc: func(r string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			return jlList, nil
+		},
+	}
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	var actualjlList []proto.JobLog
+	statusCode, _, err := testutil.MakeHTTPRequest("GET",
+		baseURL()+"requests/"+reqId+"/log", []byte{}, &actualjlList)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	// Check that the job chain is what we expect.
+	if diff := deep.Equal(actualjlList, jlList); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJobTriesHandler(t *testing.T) {
+	reqId := "abcd1234"
+	rm := &mock.RequestManager{
+		JobChainFunc: func(r string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId: r,
+				Jobs:      map[string]proto.Job{"job1": {Id: "job1"}},
+			}, nil
+		},
+	}
+	var gotFilter proto.JobLogFilter
+	jls := &mock.JLStore{
+		GetFullFunc: func(r string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			gotFilter = f
+			return []proto.JobLog{
+				{RequestId: r, JobId: "job1", Try: 2, SequenceTry: 2, State: proto.STATE_COMPLETE},
+				{RequestId: r, JobId: "job1", Try: 1, SequenceTry: 1, State: proto.STATE_FAIL},
+			}, nil
+		},
+	}
+
+	setup(rm, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	var tries []proto.JobLog
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/jobs/job1/tries", nil, &tries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotFilter, proto.JobLogFilter{JobId: "job1", NoOutput: true}); diff != nil {
+		t.Error(diff)
+	}
+	expect := []proto.JobLog{
+		{RequestId: reqId, JobId: "job1", Try: 1, SequenceTry: 1, State: proto.STATE_FAIL},
+		{RequestId: reqId, JobId: "job1", Try: 2, SequenceTry: 2, State: proto.STATE_COMPLETE},
+	}
+	if diff := deep.Equal(tries, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Job not in the job chain
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL()+"requests/"+reqId+"/jobs/job9/tries", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+}
+
+func TestCreateJLHandlerSuccess(t *testing.T) {
+	reqId := "abcd1234"
+	payload := []byte(fmt.Sprintf("{\"requestId\":\"%s\",\"state\":%d}", reqId, proto.STATE_COMPLETE))
+	jl := proto.JobLog{
+		RequestId: reqId,
+		State:     proto.STATE_COMPLETE,
+	}
+	// Create a mock joblog store that will return a jl and record the jl it receives.
+	var rmjl proto.JobLog
+	jls := &mock.JLStore{
+		CreateFunc: func(r string, j proto.JobLog) (proto.JobLog, error) {
+			rmjl = j
+			return jl, nil
+		},
+	}
+
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	var actualjl proto.JobLog
+	statusCode, _, err := testutil.MakeHTTPRequest("POST",
+		baseURL()+"requests/"+reqId+"/log", payload, &actualjl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+
+	// Check that the response body is what we expect.
+	if diff := deep.Equal(actualjl, jl); diff != nil {
+		t.Error(diff)
+	}
+
+	// Check the jl sent to the request manager is what we expect.
+	if diff := deep.Equal(rmjl, jl); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCreateJLHandlerJobFailed(t *testing.T) {
+	reqId := "abcd1234"
+	payload := []byte(fmt.Sprintf("{\"requestId\":\"%s\",\"state\":%d}", reqId, proto.STATE_FAIL))
+	jl := proto.JobLog{
+		RequestId: reqId,
+		State:     proto.STATE_FAIL,
+	}
+	// Create a mock joblog store that will return a jl.
+	jls := &mock.JLStore{
+		CreateFunc: func(r string, j proto.JobLog) (proto.JobLog, error) {
+			return jl, nil
+		},
+	}
+
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	// Make the HTTP request.
+	var actualjl proto.JobLog
+	statusCode, _, err := testutil.MakeHTTPRequest("POST",
+		baseURL()+"requests/"+reqId+"/log", payload, &actualjl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Check that the status code is what we expect.
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+}
+
+func TestCreateJLHandlerFenced(t *testing.T) {
+	// A JL from a JR that lost the request (stale fencing token) is rejected
+	reqId := "abcd1234"
+	payload := []byte(fmt.Sprintf("{\"requestId\":\"%s\",\"state\":%d,\"fenceToken\":1}", reqId, proto.STATE_COMPLETE))
+	var gotToken uint64
+	rm := &mock.RequestManager{
+		CheckFenceFunc: func(r string, token uint64) error {
+			gotToken = token
+			return serr.ErrFenced{RequestId: r, Token: token, CurrentToken: 2}
+		},
+	}
+	jls := &mock.JLStore{
+		CreateFunc: func(r string, j proto.JobLog) (proto.JobLog, error) {
+			t.Errorf("JLStore.Create called, expected no call because the JL is fenced")
+			return j, nil
+		},
+	}
+
+	setup(rm, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	statusCode, _, err := testutil.MakeHTTPRequest("POST",
+		baseURL()+"requests/"+reqId+"/log", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
+	}
+	if gotToken != 1 {
+		t.Errorf("CheckFence token = %d, expected 1", gotToken)
+	}
+}
+
+func TestCreateJLHandlerBuffered(t *testing.T) {
+	// MySQL is unavailable, so the JL is queued in the write buffer and the JR
+	// gets 201 Created. When the buffer is full, the JR gets 503.
+	reqId := "abcd1234"
+	payload := []byte(fmt.Sprintf("{\"requestId\":\"%s\",\"jobId\":\"job1\",\"state\":%d}", reqId, proto.STATE_COMPLETE))
+	jls := &mock.JLStore{
+		CreateFunc: func(r string, j proto.JobLog) (proto.JobLog, error) {
+			return j, serr.NewDbError(driver.ErrBadConn, "INSERT INTO job_log")
+		},
+	}
+	wb, err := writebuf.NewBuffer(config.WriteBuffer{MaxQueued: 1, RetryInterval: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer wb.Stop()
+
+	ctx := app.Defaults()
+	ctx.RM = &mock.RequestManager{}
+	ctx.JLS = jls
+	ctx.WriteBuffer = wb
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	url := server.URL + api.API_ROOT + "requests/" + reqId + "/log"
+
+	var gotJL proto.JobLog
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", url, payload, &gotJL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	expectJL := proto.JobLog{RequestId: reqId, JobId: "job1", State: proto.STATE_COMPLETE}
+	if diff := deep.Equal(gotJL, expectJL); diff != nil {
+		t.Error(diff)
+	}
+	if n := wb.Len(); n != 1 {
+		t.Errorf("write buffer has %d writes, expected 1", n)
+	}
+
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", url, payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusServiceUnavailable)
+	}
+}
+
+func TestDeliveriesHandler(t *testing.T) {
+	// A JR sends a batch of queued JLs and final states. Duplicates are delivered,
+	// rejected deliveries have an error, and applying stops at the first server
+	// error (req4), so the last delivery isn't applied.
+	now := time.Now().UTC()
+	deliveries := []proto.Delivery{
+		{RequestId: "req1", JobLog: &proto.JobLog{RequestId: "req1", JobId: "job1", Try: 1}},
+		{RequestId: "req1", JobLog: &proto.JobLog{RequestId: "req1", JobId: "job2", Try: 1}},
+		{RequestId: "req2", Finish: &proto.FinishRequest{RequestId: "req2", State: proto.STATE_COMPLETE, FinishedAt: now}},
+		{RequestId: "req3", Finish: &proto.FinishRequest{RequestId: "req3", State: proto.STATE_FAIL, FinishedAt: now, FenceToken: 1}},
+		{RequestId: "req4", JobLog: &proto.JobLog{RequestId: "req4", JobId: "job1", Try: 1}},
+		{RequestId: "req4", Finish: &proto.FinishRequest{RequestId: "req4", State: proto.STATE_COMPLETE, FinishedAt: now}},
+	}
+	payload, err := json.Marshal(deliveries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotJL := []string{}
+	jls := &mock.JLStore{
+		CreateFunc: func(r string, jl proto.JobLog) (proto.JobLog, error) {
+			gotJL = append(gotJL, r+"/"+jl.JobId)
+			switch r + "/" + jl.JobId {
+			case "req1/job2":
+				return jl, serr.ErrDuplicateJobLog{RequestId: r, JobId: jl.JobId, Try: jl.Try}
+			case "req4/job1":
+				return jl, fmt.Errorf("db error")
+			}
+			return jl, nil
+		},
+	}
+	gotFinish := []string{}
+	rm := &mock.RequestManager{
+		FinishFunc: func(r string, fr proto.FinishRequest) error {
+			gotFinish = append(gotFinish, r)
+			switch r {
+			case "req2":
+				return serr.NewErrInvalidState(proto.StateName[proto.STATE_RUNNING], proto.StateName[proto.STATE_COMPLETE])
+			case "req3":
+				return serr.ErrFenced{RequestId: r, Token: 1, CurrentToken: 2}
+			}
+			return nil
+		},
+		GetFunc: func(r string) (proto.Request, error) {
+			return proto.Request{Id: r, State: proto.STATE_COMPLETE}, nil
+		},
+	}
+
+	setup(rm, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	var results []proto.DeliveryResult
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"deliveries", payload, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	expect := []proto.DeliveryResult{
+		{Delivered: true},
+		{Delivered: true, Duplicate: true},
+		{Delivered: true, Duplicate: true},
+		{Error: &proto.Error{Message: serr.ErrFenced{RequestId: "req3", Token: 1, CurrentToken: 2}.Error(), RequestId: "req3", HTTPStatus: http.StatusConflict}},
+		{Error: &proto.Error{Message: "db error", RequestId: "req4", HTTPStatus: http.StatusInternalServerError}},
+	}
+	if diff := deep.Equal(results, expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(gotJL, []string{"req1/job1", "req1/job2", "req4/job1"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(gotFinish, []string{"req2", "req3"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestCreateJLBatchHandler(t *testing.T) {
+	// A JR sends a batch of JLs for two requests. Unlike deliveries, every JL is
+	// created even after an error: duplicates are created, and JLs that fail,
+	// including one without a request ID, have an error.
+	batch := []proto.JobLog{
+		{RequestId: "req1", JobId: "job1", Try: 1},
+		{RequestId: "req1", JobId: "job2", Try: 1},
+		{RequestId: "req2", JobId: "job1", Try: 1},
+		{JobId: "job3", Try: 1},
+		{RequestId: "req2", JobId: "job2", Try: 2},
+	}
+	payload, err := json.Marshal(batch)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	gotJL := []string{}
+	jls := &mock.JLStore{
+		CreateFunc: func(r string, jl proto.JobLog) (proto.JobLog, error) {
+			gotJL = append(gotJL, r+"/"+jl.JobId)
+			switch r + "/" + jl.JobId {
+			case "req1/job2":
+				return jl, serr.ErrDuplicateJobLog{RequestId: r, JobId: jl.JobId, Try: jl.Try}
+			case "req2/job1":
+				return jl, fmt.Errorf("db error")
+			}
+			return jl, nil
+		},
+	}
+
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, jls, make(chan struct{}))
+	defer cleanup()
+
+	var results []proto.JobLogResult
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL()+"job-logs", payload, &results)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	expect := []proto.JobLogResult{
+		{Created: true},
+		{Created: true, Duplicate: true},
+		{Error: &proto.Error{Message: "db error", RequestId: "req2", HTTPStatus: http.StatusInternalServerError}},
+		{Error: &proto.Error{Message: "job log 3 (job job3 try 1) has no requestId", HTTPStatus: http.StatusBadRequest}},
+		{Created: true},
+	}
+	if diff := deep.Equal(results, expect); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(gotJL, []string{"req1/job1", "req1/job2", "req2/job1", "req2/job2"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestAuth(t *testing.T) {
+	// Test authentication and authorizaiton with an auth plugin we control.
+	// The app default auth allows everything, so we have to override the plugin.
+	var caller auth.Caller
+	var authenErr, authorErr error
+	var authenticateCalled, authorizeCalled, createCalled, startCalled, failPendingCalled bool
+	var authOp string
+	reset := func() {
+		authenticateCalled = false
+		authorizeCalled = false
+		createCalled = false
+		startCalled = false
+		failPendingCalled = false
+		authenErr = nil
+		authorErr = nil
+		authOp = ""
+		caller = auth.Caller{
+			Name:  "dn",
+			Roles: []string{"role1", "role2"}, // matches roles in auth-001.yaml (see below)
+		}
+	}
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			authenticateCalled = true
+			return caller, authenErr
+		},
+		AuthorizeFunc: func(c auth.Caller, op string, req proto.Request) error {
+			authorizeCalled = true
+			authOp = op
+			return authorErr
+		},
+	}
+
+	req := proto.Request{
+		Id:    "xyz",
+		Type:  "req1",
+		State: proto.STATE_PENDING,
+	}
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(proto.CreateRequest) (proto.Request, error) {
+			createCalled = true
+			return req, nil
+		},
+		StartFunc: func(string) error {
+			startCalled = true
+			return nil
+		},
+		FailPendingFunc: func(string) error {
+			failPendingCalled = true
+			return nil
+		},
+	}
+
+	acls := map[string][]auth.ACL{
+		"req1": []auth.ACL{
+			{
+				Role:  "role1",
+				Admin: true,
+			},
+			{
+				Role: "role2",
+				Ops:  []string{"start", "stop"},
+			},
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, acls, nil, true)
+	ctx.Quota = &mock.QuotaManager{}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	payload := `{"type":"req1","args":{"arg1":"hello","second":"arg2"}}`
+
+	// Authentication fails
+	// ----------------------------------------------------------------------
+
+	reset()
+	authenErr = fmt.Errorf("forced authenticated error")
+
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if authenticateCalled == false {
+		t.Errorf("Authenticate not called, expected it to be called")
+	}
+	if authorizeCalled == true {
+		t.Errorf("Authorize called, expected it NOT to be called")
+	}
+	if createCalled == true {
+		t.Errorf("request.Manager.Create called, expected it NOT to be called")
+	}
+
+	// Authentication ok, then authorize fails in the controller
+	// ----------------------------------------------------------------------
+
+	reset()
+	authorErr = fmt.Errorf("forced authorization error")
+
+	var resp echo.HTTPError
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), &resp)
+	t.Logf("resp: %+v", resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if authenticateCalled == false {
+		t.Errorf("Authenticate not called, expected it to be called")
+	}
+	if authorizeCalled == false {
+		t.Errorf("Authorize not called, expected it to be called")
+	}
+	if authOp != proto.REQUEST_OP_START {
+		t.Errorf("got op %s, expected %s", authOp, proto.REQUEST_OP_START)
+	}
+	if createCalled == false { // have to create it to authorize it
+		t.Errorf("request.Manager.Create not called, expected it to be called")
+	}
+	if startCalled == true { // but auth fails, so don't start it
+		t.Errorf("request.Manager.Start called, expected it NOT to be called")
+	}
+	if failPendingCalled == false { // and fail it, so it doesn't stay pending
+		t.Errorf("request.Manager.FailPending not called, expected it to be called")
+	}
+
+	// All auth OK
+	// ----------------------------------------------------------------------
+
+	reset()
+
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	if authenticateCalled == false {
+		t.Errorf("Authenticate not called, expected it to be called")
+	}
+	if authorizeCalled == false {
+		t.Errorf("Authorize not called, expected it to be called")
+	}
+	if createCalled == false {
+		t.Errorf("request.Manager.Create not called, expected it to be called")
+	}
+	if startCalled == false {
+		t.Errorf("request.Manager.Start not called, expected it to be called")
+	}
+}
+
+func TestAuthBudgetApproval(t *testing.T) {
+	// A request that costs more than its budget approval threshold requires
+	// the approve op in addition to the start op
+	var startCalled bool
+	caller := auth.Caller{
+		Name:  "dn",
+		Roles: []string{"role2"},
+	}
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Specs = spec.Specs{
+		Sequences: map[string]*spec.Sequence{
+			"req1": &spec.Sequence{
+				Name:    "req1",
+				Request: true,
+				Budget:  &spec.Budget{Approval: 10},
+			},
+		},
+	}
+
+	req := proto.Request{
+		Id:    "xyz",
+		Type:  "req1",
+		State: proto.STATE_PENDING,
+		Cost:  20,
+	}
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(proto.CreateRequest) (proto.Request, error) {
+			return req, nil
+		},
+		StartFunc: func(string) error {
+			startCalled = true
+			return nil
+		},
+	}
+
+	acls := map[string][]auth.ACL{
+		"req1": []auth.ACL{
+			{
+				Role: "role2",
+				Ops:  []string{"start", "stop"},
+			},
+			{
+				Role: "role3",
+				Ops:  []string{"start", "stop", "approve"},
+			},
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, acls, nil, true)
+	ctx.Quota = &mock.QuotaManager{}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	payload := `{"type":"req1","args":{"arg1":"hello"}}`
+
+	// Cost > approval threshold and caller role not granted approve op
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if startCalled {
+		t.Errorf("request.Manager.Start called, expected it NOT to be called")
+	}
+
+	// Caller role granted approve op
+	caller.Roles = []string{"role3"}
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	if !startCalled {
+		t.Errorf("request.Manager.Start not called, expected it to be called")
+	}
+
+	// Cost <= approval threshold, approve op not required
+	startCalled = false
+	caller.Roles = []string{"role2"}
+	req.Cost = 10
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	if !startCalled {
+		t.Errorf("request.Manager.Start not called, expected it to be called")
+	}
+}
+
+func TestSLO(t *testing.T) {
+	// Caller in namespace dba sees the SLO of request types in dba or not in
+	// a namespace
+	caller := auth.Caller{
+		Name:      "dn",
+		Roles:     []string{"dev"},
+		Namespace: "dba",
+	}
+	restart := proto.SLOStatus{
+		Type: "restart",
+		SLO:  proto.SLO{SuccessRate: 0.99},
+		Windows: []proto.SLOWindow{
+			{Window: "1h", Finished: 10, Complete: 9, SuccessRate: 0.9, BurnRate: 10, Burning: true},
+		},
+		Burning: true,
+	}
+	refund := proto.SLOStatus{Type: "refund", SLO: proto.SLO{Duration: "5m", Percentile: 95}}
+
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.Specs = spec.Specs{
+		Sequences: map[string]*spec.Sequence{
+			"refund":  &spec.Sequence{Name: "refund", Request: true, Namespace: "payments"},
+			"restart": &spec.Sequence{Name: "restart", Request: true},
+		},
+	}
+	ctx.SLO = &mock.SLOManager{
+		ListFunc: func() ([]proto.SLOStatus, error) {
+			return []proto.SLOStatus{refund, restart}, nil
+		},
+		StatusFunc: func(reqType string) (proto.SLOStatus, error) {
+			switch reqType {
+			case "restart":
+				return restart, nil
+			case "refund":
+				return refund, nil
+			}
+			return proto.SLOStatus{}, serr.SLONotFound{Type: reqType}
+		},
+	}
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	// List: refund is in another namespace
+	var gotList []proto.SLOStatus
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL+"slo", nil, &gotList)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotList, []proto.SLOStatus{restart}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Get one
+	var got proto.SLOStatus
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"slo/restart", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(got, restart); diff != nil {
+		t.Error(diff)
+	}
+
+	// Get one in another namespace: denied
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"slo/refund", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+
+	// Request type without an SLO: not found
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"slo/stop-host", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+}
+
+func TestQuotas(t *testing.T) {
+	caller := auth.Caller{
+		Name:  "dn",
+		Roles: []string{"dev"},
+		Team:  "dba",
+	}
+	var checkUser, checkTeam string
+	var checkErr error
+	var setQuota proto.Quota
+	createCalled := false
+	quotas := []proto.Quota{
+		{Scope: proto.QUOTA_SCOPE_USER, Name: "", MaxRunning: 10},
+	}
+
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(proto.CreateRequest) (proto.Request, error) {
+			createCalled = true
+			return proto.Request{Id: "xyz", Type: "req1"}, nil
+		},
+	}
+	ctx.Quota = &mock.QuotaManager{
+		CheckFunc: func(user, team, namespace string) error {
+			checkUser = user
+			checkTeam = team
+			return checkErr
+		},
+		ListFunc: func() ([]proto.Quota, error) {
+			return quotas, nil
+		},
+		SetFunc: func(q proto.Quota) error {
+			setQuota = q
+			return nil
+		},
+	}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	// Quota exceeded: HTTP 429 and request not created
+	checkErr = serr.ErrQuotaExceeded{Message: "forced error"}
+	payload := `{"type":"req1","args":{"arg1":"hello"}}`
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusTooManyRequests {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusTooManyRequests)
+	}
+	if checkUser != "dn" || checkTeam != "dba" {
+		t.Errorf("checked quota for user '%s' team '%s', expected user 'dn' team 'dba'", checkUser, checkTeam)
+	}
+	if createCalled {
+		t.Errorf("request.Manager.Create called, expected it NOT to be called")
+	}
+
+	// List quotas
+	var gotQuotas []proto.Quota
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"quotas", nil, &gotQuotas)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotQuotas, quotas); diff != nil {
+		t.Error(diff)
+	}
+
+	// Set quota denied: caller is not an admin
+	payload = `{"scope":"user","name":"dn","maxRunning":5,"maxDaily":20}`
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"quotas", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if setQuota.Scope != "" {
+		t.Errorf("quota.Manager.Set called, expected it NOT to be called")
+	}
+
+	// Set quota allowed: caller is an admin
+	caller.Roles = []string{"admin"}
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"quotas", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expectQuota := proto.Quota{Scope: proto.QUOTA_SCOPE_USER, Name: "dn", MaxRunning: 5, MaxDaily: 20}
+	if diff := deep.Equal(setQuota, expectQuota); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestPushStatusHandler(t *testing.T) {
+	var got proto.JobRunnerStatus
+	ctx := app.Defaults()
+	ctx.Status = &mock.RMStatus{
+		PushFunc: func(jrs proto.JobRunnerStatus) error {
+			got = jrs
+			return nil
+		},
+	}
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.Plugins.Auth = mockAuth
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	payload := `{"jrURL":"https://jr1.local:32307","jobs":[{"requestId":"abc","jobId":"job1","try":1,"sequenceTry":1}]}`
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", server.URL+api.API_ROOT+"status/job-runner", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expect := proto.JobRunnerStatus{
+		JobRunnerURL: "https://jr1.local:32307",
+		Jobs: []proto.JobStatus{
+			{RequestId: "abc", JobId: "job1", Try: 1, SequenceTry: 1},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestFinalizeRequest(t *testing.T) {
+	caller := auth.Caller{
+		Name:  "dn",
+		Roles: []string{"dev"},
+	}
+	var gotId string
+	var gotFinalize proto.FinalizeRequest
+
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.RM = &mock.RequestManager{
+		FinalizeFunc: func(reqId string, f proto.FinalizeRequest) (proto.Request, error) {
+			gotId = reqId
+			gotFinalize = f
+			if reqId == "running" {
+				return proto.Request{}, serr.ErrJobRunnerHasRequest{RequestId: reqId, JobRunnerURL: "http://jr1"}
+			}
+			return proto.Request{Id: reqId, State: f.State}, nil
+		},
+	}
+	ctx.Status = &mock.RMStatus{}
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+	payload := []byte(`{"state":4,"reason":"jr1 host lost","user":"spoofed"}`)
+
+	// Only admins can finalize requests
+	statusCode, _, err := testutil.MakeHTTPRequest("PUT", baseURL+"requests/abc/finalize", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if gotId != "" {
+		t.Errorf("request finalized by non-admin caller")
+	}
+
+	// Admin: user is the caller, not the payload
+	caller.Roles = []string{"admin"}
+	var got proto.Request
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"requests/abc/finalize", payload, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expect := proto.FinalizeRequest{State: proto.STATE_FAIL, Reason: "jr1 host lost", User: "dn"}
+	if diff := deep.Equal(gotFinalize, expect); diff != nil {
+		t.Error(diff)
+	}
+	if gotId != "abc" || got.Id != "abc" || got.State != proto.STATE_FAIL {
+		t.Errorf("finalized %s, got %+v, expected abc in state FAIL", gotId, got)
+	}
+
+	// JR still has the request: conflict
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"requests/running/finalize", payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusConflict {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusConflict)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	caller := auth.Caller{
+		Name:  "dn",
+		Roles: []string{"dev"},
+	}
+	createCalled := false
+	stopCalled := false
+
+	ctx := app.Defaults()
+	ctx.Config.ReadOnly.Enabled = true
+	ctx.Config.ReadOnly.Reason = "database failover"
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(proto.CreateRequest) (proto.Request, error) {
+			createCalled = true
+			return proto.Request{Id: "xyz", Type: "req1"}, nil
+		},
+		GetFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{Id: reqId, Type: "req1"}, nil
+		},
+		StopFunc: func(reqId string, timeout time.Duration) error {
+			stopCalled = true
+			return nil
+		},
+	}
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	// Read-only from config: create and stop return HTTP 503 with the reason
+	payload := `{"type":"req1","args":{"arg1":"hello"}}`
+	var respErr proto.Error
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), &respErr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusServiceUnavailable)
+	}
+	if respErr.Message != "Request Manager is read-only: database failover" {
+		t.Errorf("got error message '%s', expected the read-only reason", respErr.Message)
+	}
+	if createCalled {
+		t.Errorf("request.Manager.Create called, expected it NOT to be called")
+	}
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"requests/xyz/stop", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusServiceUnavailable {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusServiceUnavailable)
+	}
+	if stopCalled {
+		t.Errorf("request.Manager.Stop called, expected it NOT to be called")
+	}
+
+	// Status works and has a banner
+	var running proto.RunningStatus
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"status/running", nil, &running)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if running.Banner != "Request Manager is read-only: database failover" {
+		t.Errorf("got banner '%s', expected the read-only reason", running.Banner)
+	}
+
+	// Get read-only mode
+	var ro proto.ReadOnly
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"read-only", nil, &ro)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expectRO := proto.ReadOnly{Enabled: true, Reason: "database failover"}
+	if diff := deep.Equal(ro, expectRO); diff != nil {
+		t.Error(diff)
+	}
+
+	// Disable denied: caller is not an admin
+	payload = `{"enabled":false}`
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"read-only", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+
+	// Disable allowed: caller is an admin
+	caller.Roles = []string{"admin"}
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"read-only", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	// Not read-only: stop works and no banner
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"requests/xyz/stop", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if !stopCalled {
+		t.Errorf("request.Manager.Stop not called, expected it to be called")
+	}
+	running = proto.RunningStatus{}
+	_, _, err = testutil.MakeHTTPRequest("GET", baseURL+"status/running", nil, &running)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running.Banner != "" {
+		t.Errorf("got banner '%s', expected no banner", running.Banner)
+	}
+}
+
+func TestGetVersion(t *testing.T) {
+	setup(&mock.RequestManager{}, &mock.RequestResumer{}, &mock.JLStore{}, make(chan struct{}))
+	defer cleanup()
+	resp, err := http.Get(server.URL + "/version")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", resp.StatusCode, http.StatusOK)
+	}
+	expectVersion := v.Version()
+	gotVersion := string(body)
+	if gotVersion != expectVersion {
+		t.Errorf("got version '%s', expected '%s'", gotVersion, expectVersion)
+	}
+}
+
+func TestServerVersion(t *testing.T) {
+	ctx := app.Defaults()
+	ctx.Config.StatusPush.StaleAfter = "5s"
+	ctx.Status = &mock.RMStatus{
+		JobRunnersFunc: func() []proto.JobRunnerStatus {
+			return []proto.JobRunnerStatus{
+				{JobRunnerURL: "http://jr1", Version: "2.0.4"},
+				{JobRunnerURL: "http://jr2"}, // old JR doesn't push version
+			}
+		},
+	}
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.Plugins.Auth = mockAuth
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	var got proto.ServerVersion
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", server.URL+api.API_ROOT+"version", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expect := proto.ServerVersion{
+		Version:    v.Version(),
+		APIVersion: proto.API_VERSION,
+		Features:   append(api.Features, proto.FEATURE_STATUS_PUSH),
+		JobRunners: []proto.JobRunnerVersion{
+			{JobRunnerURL: "http://jr1", Version: "2.0.4"},
+			{JobRunnerURL: "http://jr2"},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	if !sort.StringsAreSorted(got.Features) {
+		t.Errorf("features not sorted: %v", got.Features)
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	ctx := app.Defaults()
+	ctx.Status = &mock.RMStatus{}
+	ctx.Config.StatusPush.StaleAfter = "0s" // status push disabled
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.Plugins.Auth = mockAuth
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	var got []string
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", server.URL+api.API_ROOT+"features", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(got, api.Features); diff != nil {
+		t.Error(diff)
+	}
+	if !sort.StringsAreSorted(api.Features) {
+		t.Errorf("api.Features not sorted: %v", api.Features)
+	}
+}
+
+func TestReadReplica(t *testing.T) {
+	// Requests are found on the replica while it's usable, else on the primary
+	var primaryFinds, replicaFinds int
+	lagOK := true
+	ctx := app.Defaults()
+	ctx.RM = &mock.RequestManager{
+		FindFunc: func(proto.RequestFilter) ([]proto.Request, error) {
+			primaryFinds++
+			return []proto.Request{}, nil
+		},
+	}
+	ctx.ReplicaRM = &mock.RequestManager{
+		FindFunc: func(proto.RequestFilter) ([]proto.Request, error) {
+			replicaFinds++
+			return []proto.Request{}, nil
+		},
+	}
+	ctx.JLS = &mock.JLStore{}
+	ctx.ReplicaJLS = &mock.JLStore{}
+	ctx.Replica = &mock.Replica{
+		LagFunc: func() (time.Duration, bool) {
+			return 1500 * time.Millisecond, lagOK
+		},
+	}
+	ctx.Status = &mock.RMStatus{}
+	ctx.Config.StatusPush.StaleAfter = "0s" // status push disabled
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	statusCode, header, err := testutil.MakeHTTPRequest("GET", baseURL+"requests", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if replicaFinds != 1 || primaryFinds != 0 {
+		t.Errorf("%d replica and %d primary finds, expected 1 and 0", replicaFinds, primaryFinds)
+	}
+	if got := header.Get(api.READ_FROM_HEADER); got != api.READ_FROM_REPLICA {
+		t.Errorf("%s = %s, expected %s", api.READ_FROM_HEADER, got, api.READ_FROM_REPLICA)
+	}
+	if got := header.Get(api.REPLICA_LAG_HEADER); got != "1.5" {
+		t.Errorf("%s = %s, expected 1.5", api.REPLICA_LAG_HEADER, got)
+	}
+
+	// Caller asks to read from the primary
+	req, err := http.NewRequest("GET", baseURL+"requests", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(api.READ_FROM_HEADER, api.READ_FROM_PRIMARY)
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if replicaFinds != 1 || primaryFinds != 1 {
+		t.Errorf("%d replica and %d primary finds, expected 1 and 1", replicaFinds, primaryFinds)
+	}
+	if got := res.Header.Get(api.READ_FROM_HEADER); got != api.READ_FROM_PRIMARY {
+		t.Errorf("%s = %s, expected %s", api.READ_FROM_HEADER, got, api.READ_FROM_PRIMARY)
+	}
+
+	// Replica lags too much: fall back to the primary
+	lagOK = false
+	_, header, err = testutil.MakeHTTPRequest("GET", baseURL+"requests", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replicaFinds != 1 || primaryFinds != 2 {
+		t.Errorf("%d replica and %d primary finds, expected 1 and 2", replicaFinds, primaryFinds)
+	}
+	if got := header.Get(api.READ_FROM_HEADER); got != api.READ_FROM_PRIMARY {
+		t.Errorf("%s = %s, expected %s", api.READ_FROM_HEADER, got, api.READ_FROM_PRIMARY)
+	}
+	if got := header.Get(api.REPLICA_LAG_HEADER); got != "" {
+		t.Errorf("%s = %s, expected it not set", api.REPLICA_LAG_HEADER, got)
+	}
+
+	// Feature reported only when the replica is configured
+	var features []string
+	_, _, err = testutil.MakeHTTPRequest("GET", baseURL+"features", nil, &features)
+	if err != nil {
+		t.Fatal(err)
+	}
+	found := false
+	for _, f := range features {
+		if f == proto.FEATURE_READ_REPLICA {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("features %v do not include %s", features, proto.FEATURE_READ_REPLICA)
+	}
+}
+
+func TestJobRunnerUpgrade(t *testing.T) {
+	caller := auth.Caller{
+		Name:  "dn",
+		Roles: []string{"dev"},
+	}
+	var gotCreate proto.CreateJobRunnerUpgrade
+	var gotReplacedId string
+	var gotReplaced proto.JobRunnerReplaced
+	advanced := 0
+	upgrade := proto.JobRunnerUpgrade{
+		Id:            "u1",
+		JobRunnerURLs: []string{"http://jr1", "http://jr2"},
+		Step:          proto.UPGRADE_STEP_DRAIN,
+		RunningChains: 2,
+		DrainTimeout:  "10m",
+		HealthTimeout: "5m",
+	}
+
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Upgrade = &mock.UpgradeManager{
+		CreateFunc: func(cu proto.CreateJobRunnerUpgrade) (proto.JobRunnerUpgrade, error) {
+			gotCreate = cu
+			return upgrade, nil
+		},
+		GetFunc: func(upgradeId string) (proto.JobRunnerUpgrade, error) {
+			if upgradeId != upgrade.Id {
+				return proto.JobRunnerUpgrade{}, serr.UpgradeNotFound{UpgradeId: upgradeId}
+			}
+			return upgrade, nil
+		},
+		AdvanceFunc: func(upgradeId string) (proto.JobRunnerUpgrade, error) {
+			advanced++
+			if upgradeId != upgrade.Id {
+				return proto.JobRunnerUpgrade{}, serr.UpgradeNotFound{UpgradeId: upgradeId}
+			}
+			return upgrade, nil
+		},
+		ReplacedFunc: func(upgradeId string, r proto.JobRunnerReplaced) error {
+			gotReplacedId = upgradeId
+			gotReplaced = r
+			return nil
+		},
+	}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	// Create denied: caller is not an admin
+	payload := `{"jrURLs":["http://jr1","http://jr2"],"drainTimeout":"10m"}`
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"job-runner-upgrades", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if gotCreate.JobRunnerURLs != nil {
+		t.Errorf("upgrade.Manager.Create called, expected it NOT to be called")
+	}
+
+	// Create allowed: caller is an admin
+	caller.Roles = []string{"admin"}
+	var got proto.JobRunnerUpgrade
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"job-runner-upgrades", []byte(payload), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	expectCreate := proto.CreateJobRunnerUpgrade{
+		JobRunnerURLs: []string{"http://jr1", "http://jr2"},
+		DrainTimeout:  "10m",
+	}
+	if diff := deep.Equal(gotCreate, expectCreate); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(got, upgrade); diff != nil {
+		t.Error(diff)
+	}
+
+	// Get
+	got = proto.JobRunnerUpgrade{}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"job-runner-upgrades/u1", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(got, upgrade); diff != nil {
+		t.Error(diff)
+	}
+
+	// Get unknown upgrade: HTTP 404
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"job-runner-upgrades/nope", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+
+	// Get is read-only: it doesn't advance the upgrade
+	if advanced != 0 {
+		t.Errorf("upgrade.Manager.Advance called %d times by get, expected 0", advanced)
+	}
+
+	// Advance denied: caller is not an admin
+	caller.Roles = []string{"dev"}
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"job-runner-upgrades/u1/advance", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if advanced != 0 {
+		t.Errorf("upgrade.Manager.Advance called, expected it NOT to be called")
+	}
+
+	// Advance allowed: caller is an admin
+	caller.Roles = []string{"admin"}
+	got = proto.JobRunnerUpgrade{}
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"job-runner-upgrades/u1/advance", nil, &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if advanced != 1 {
+		t.Errorf("upgrade.Manager.Advance called %d times, expected 1", advanced)
+	}
+	if diff := deep.Equal(got, upgrade); diff != nil {
+		t.Error(diff)
+	}
+
+	// Replaced with new URL
+	payload = `{"jrURL":"http://jr1-new"}`
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"job-runner-upgrades/u1/replaced", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if gotReplacedId != "u1" || gotReplaced.JobRunnerURL != "http://jr1-new" {
+		t.Errorf("got Replaced(%s, %+v), expected Replaced(u1, {JobRunnerURL:http://jr1-new})", gotReplacedId, gotReplaced)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	// Caller in namespace dba without an admin role sees only requests in dba or
+	// not in a namespace
+	caller := auth.Caller{
+		Name:      "dn",
+		Roles:     []string{"dev"},
+		Namespace: "dba",
+	}
+	createCalled := false
+	var gotFilter proto.RequestFilter
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Specs = spec.Specs{
+		Sequences: map[string]*spec.Sequence{
+			"refund":  &spec.Sequence{Name: "refund", Request: true, Namespace: "payments"},
+			"restart": &spec.Sequence{Name: "restart", Request: true},
+		},
+	}
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(proto.CreateRequest) (proto.Request, error) {
+			createCalled = true
+			return proto.Request{}, nil
+		},
+		GetWithJCFunc: func(string) (proto.Request, error) {
+			return proto.Request{Id: "abc", Type: "refund", Namespace: "payments"}, nil
+		},
+		SpecsFunc: func() []proto.RequestSpec {
+			return []proto.RequestSpec{
+				{Name: "refund", Namespace: "payments"},
+				{Name: "restart"},
+			}
+		},
+		FindFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			gotFilter = f
+			return []proto.Request{}, nil
+		},
+	}
+	ctx.Status = &mock.RMStatus{
+		RunningFunc: func(proto.StatusFilter) (proto.RunningStatus, error) {
+			return proto.RunningStatus{
+				Jobs: []proto.JobStatus{
+					{RequestId: "abc", JobId: "job1"},
+					{RequestId: "def", JobId: "job2"},
+				},
+				Requests: map[string]proto.Request{
+					"abc": {Id: "abc", Type: "refund", Namespace: "payments"},
+					"def": {Id: "def", Type: "restart"},
+				},
+			}, nil
+		},
+	}
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	// Request list: only request not in a namespace
+	var specs []proto.RequestSpec
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", baseURL+"request-list", nil, &specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(specs, []proto.RequestSpec{{Name: "restart"}}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Create request in other namespace: denied, not created
+	payload := `{"type":"refund"}`
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"requests", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+	if createCalled {
+		t.Errorf("request created, expected it not to be created")
+	}
+
+	// Get request in other namespace: denied
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"requests/abc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+
+	// Find: restricted to caller namespace and no namespace
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"requests", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotFilter.Namespaces, []string{"", "dba"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Find in other namespace: denied
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"requests?namespace=payments", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusUnauthorized {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusUnauthorized)
+	}
+
+	// Running status: request and jobs in other namespace removed
+	var running proto.RunningStatus
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"status/running", nil, &running)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expectRunning := proto.RunningStatus{
+		Jobs: []proto.JobStatus{
+			{RequestId: "def", JobId: "job2"},
+		},
+		Requests: map[string]proto.Request{
+			"def": {Id: "def", Type: "restart"},
+		},
+	}
+	if diff := deep.Equal(running, expectRunning); diff != nil {
+		t.Error(diff)
+	}
+
+	// Admin sees all namespaces
+	caller.Roles = []string{"admin"}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"requests/abc", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"requests", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotFilter.Namespaces) != 0 {
+		t.Errorf("got filter namespaces %v, expected none for admin", gotFilter.Namespaces)
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	var entries []accesslog.Entry
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.RM = &mock.RequestManager{
+		GetWithJCFunc: func(r string) (proto.Request, error) {
+			return proto.Request{Id: r}, nil
+		},
+	}
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.AccessLog = &mock.AccessLog{
+		LogFunc: func(e accesslog.Entry) {
+			entries = append(entries, e)
+		},
+	}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	var req proto.Request
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", server.URL+api.API_ROOT+"requests/abcd1234?verbose=1", []byte{}, &req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+
+	// Unknown endpoint: error status is logged too
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", server.URL+api.API_ROOT+"nope", []byte{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+
+	if len(entries) != 2 {
+		t.Fatalf("got %d access log entries, expected 2: %+v", len(entries), entries)
+	}
+	e := entries[0]
+	if e.Caller != "test" || e.Method != "GET" || e.Endpoint != api.API_ROOT+"requests/:reqId" ||
+		e.Path != api.API_ROOT+"requests/abcd1234" || e.Query != "verbose=1" || e.Status != http.StatusOK || e.RequestId != "abcd1234" {
+		t.Errorf("wrong access log entry: %+v", e)
+	}
+	if entries[1].Status != http.StatusNotFound {
+		t.Errorf("got status %d, expected %d", entries[1].Status, http.StatusNotFound)
+	}
+}
+
+func TestRequestGroup(t *testing.T) {
+	var gotCreate []proto.CreateRequest
+	var gotStarted, gotFailed, gotStopped []string
+	var gotTimeout time.Duration
+	failCreate := ""
+	group := proto.RequestGroup{
+		Id:    "g1",
+		Name:  "migrate",
+		User:  "admin",
+		State: proto.STATE_RUNNING,
+		Requests: []proto.Request{
+			{Id: "r0", Type: "req-a", State: proto.STATE_RUNNING, GroupId: "g1"},
+			{Id: "r1", Type: "req-b", State: proto.STATE_COMPLETE, GroupId: "g1"},
+		},
+	}
+
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.Hooks.SetUsername = func(*http.Request) (string, error) {
+		return "admin", nil
+	}
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Upgrade = &mock.UpgradeManager{}
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(cr proto.CreateRequest) (proto.Request, error) {
+			if cr.Type == failCreate {
+				return proto.Request{}, mock.ErrRequestManager
+			}
+			gotCreate = append(gotCreate, cr)
+			return proto.Request{Id: fmt.Sprintf("r%d", len(gotCreate)-1), Type: cr.Type, GroupId: cr.GroupId}, nil
+		},
+		GetFunc: func(requestId string) (proto.Request, error) {
+			return proto.Request{Id: requestId, State: proto.STATE_RUNNING}, nil
+		},
+		StartFunc: func(requestId string) error {
+			gotStarted = append(gotStarted, requestId)
+			return nil
+		},
+		FailPendingFunc: func(requestId string) error {
+			gotFailed = append(gotFailed, requestId)
+			return nil
+		},
+		StopFunc: func(requestId string, timeout time.Duration) error {
+			gotStopped = append(gotStopped, requestId)
+			gotTimeout = timeout
+			return nil
+		},
+	}
+	ctx.Group = &mock.GroupManager{
+		CreateFunc: func(cg proto.CreateRequestGroup, user string) (proto.RequestGroup, error) {
+			return proto.RequestGroup{Id: "g1", Name: cg.Name, User: user}, nil
+		},
+		GetFunc: func(groupId string) (proto.RequestGroup, error) {
+			if groupId != group.Id {
+				return proto.RequestGroup{}, serr.GroupNotFound{GroupId: groupId}
+			}
+			return group, nil
+		},
+	}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	baseURL := server.URL + api.API_ROOT
+
+	// Invalid: no name
+	payload := `{"requests":[{"type":"req-a"}]}`
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", baseURL+"request-groups", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+
+	// Create: all requests created in the group, then started
+	payload = `{"name":"migrate","requests":[{"type":"req-a","args":{"host":"h1"}},{"type":"req-b"}]}`
+	var gotGroup proto.RequestGroup
+	statusCode, headers, err := testutil.MakeHTTPRequest("POST", baseURL+"request-groups", []byte(payload), &gotGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	if headers["Location"][0] != api.API_ROOT+"request-groups/g1" {
+		t.Errorf("location = %s, expected %s", headers["Location"][0], api.API_ROOT+"request-groups/g1")
+	}
+	if diff := deep.Equal(gotGroup, group); diff != nil {
+		t.Error(diff)
+	}
+	if len(gotCreate) != 2 {
+		t.Fatalf("created %d requests, expected 2", len(gotCreate))
+	}
+	for i, cr := range gotCreate {
+		if cr.GroupId != "g1" {
+			t.Errorf("request %d GroupId = '%s', expected g1", i, cr.GroupId)
+		}
+		if cr.User != "admin" {
+			t.Errorf("request %d User = '%s', expected admin", i, cr.User)
+		}
+	}
+	if diff := deep.Equal(gotStarted, []string{"r0", "r1"}); diff != nil {
+		t.Error(diff)
+	}
+	if len(gotFailed) != 0 {
+		t.Errorf("failed requests %v, expected none", gotFailed)
+	}
+
+	// Create error: first request is created, second fails, so first is failed
+	// and neither is started
+	gotCreate = nil
+	gotStarted = nil
+	failCreate = "req-b"
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", baseURL+"request-groups", []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusInternalServerError {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusInternalServerError)
+	}
+	if diff := deep.Equal(gotFailed, []string{"r0"}); diff != nil {
+		t.Error(diff)
+	}
+	if len(gotStarted) != 0 {
+		t.Errorf("started requests %v, expected none", gotStarted)
+	}
+
+	// Get
+	gotGroup = proto.RequestGroup{}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"request-groups/g1", nil, &gotGroup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotGroup, group); diff != nil {
+		t.Error(diff)
+	}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", baseURL+"request-groups/nope", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusNotFound {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusNotFound)
+	}
+
+	// Stop: only running requests are stopped
+	statusCode, _, err = testutil.MakeHTTPRequest("PUT", baseURL+"request-groups/g1/stop?timeout=5m", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(gotStopped, []string{"r0"}); diff != nil {
+		t.Error(diff)
+	}
+	if gotTimeout != 5*time.Minute {
+		t.Errorf("stop timeout = %s, expected 5m", gotTimeout)
+	}
+}
+
+func TestSpecReportHandler(t *testing.T) {
+	caller := auth.Caller{
+		Name:      "dn",
+		Roles:     []string{"dev"},
+		Namespace: "dba",
+	}
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mock.AuthPlugin{
+		AuthenticateFunc: func(*http.Request) (auth.Caller, error) {
+			return caller, nil
+		},
+	}
+	ctx.Auth = auth.NewManager(ctx.Plugins.Auth, map[string][]auth.ACL{}, []string{"admin"}, false)
+	ctx.RM = &mock.RequestManager{}
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Specs = spec.Specs{
+		Sequences: map[string]*spec.Sequence{
+			"refund":  &spec.Sequence{Name: "refund", Request: true, Namespace: "payments", Filename: "payments/refund.yaml"},
+			"restart": &spec.Sequence{Name: "restart", Request: true, Filename: "restart.yaml"},
+		},
+	}
+	ctx.SpecReport = proto.SpecReport{
+		SpecVersion: "abc",
+		Files: map[string]proto.SpecCheckResult{
+			"payments/refund.yaml": {Warnings: []string{"w1"}},
+			"restart.yaml":         {Warnings: []string{"w2"}},
+		},
+		Sequences: map[string]proto.SpecCheckResult{
+			"refund":  {Errors: []string{"e1"}},
+			"restart": {Errors: []string{"e2"}},
+		},
+		Unbuildable: []string{"refund", "restart"},
+	}
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	url := server.URL + api.API_ROOT + "spec-report"
+
+	// Caller in namespace dba: only results not in a namespace
+	var report proto.SpecReport
+	statusCode, _, err := testutil.MakeHTTPRequest("GET", url, nil, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	expect := proto.SpecReport{
+		SpecVersion: "abc",
+		Files: map[string]proto.SpecCheckResult{
+			"restart.yaml": {Warnings: []string{"w2"}},
+		},
+		Sequences: map[string]proto.SpecCheckResult{
+			"restart": {Errors: []string{"e2"}},
+		},
+		Unbuildable: []string{"restart"},
+	}
+	if diff := deep.Equal(report, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Admin: everything
+	caller.Roles = []string{"admin"}
+	report = proto.SpecReport{}
+	statusCode, _, err = testutil.MakeHTTPRequest("GET", url, nil, &report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if diff := deep.Equal(report, ctx.SpecReport); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestBulkCreate(t *testing.T) {
+	var gotCreate []proto.CreateRequest
+	var gotStarted, gotFailed []string
+	failCreate := ""
+	failStart := ""
+
+	ctx := app.Defaults()
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.Hooks.SetUsername = func(*http.Request) (string, error) {
+		return "admin", nil
+	}
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Upgrade = &mock.UpgradeManager{}
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(cr proto.CreateRequest) (proto.Request, error) {
+			if cr.Type == failCreate {
+				return proto.Request{}, serr.ErrInvalidCreateRequest{Message: "missing arg"}
+			}
+			gotCreate = append(gotCreate, cr)
+			return proto.Request{Id: fmt.Sprintf("r%d", len(gotCreate)-1), Type: cr.Type, GroupId: cr.GroupId}, nil
+		},
+		StartFunc: func(requestId string) error {
+			if requestId == failStart {
+				return mock.ErrRequestManager
+			}
+			gotStarted = append(gotStarted, requestId)
+			return nil
+		},
+		FailPendingFunc: func(requestId string) error {
+			gotFailed = append(gotFailed, requestId)
+			return nil
+		},
+	}
+	var gotGroupName string
+	ctx.Group = &mock.GroupManager{
+		CreateFunc: func(cg proto.CreateRequestGroup, user string) (proto.RequestGroup, error) {
+			gotGroupName = cg.Name
+			return proto.RequestGroup{Id: "g1", Name: cg.Name, User: user}, nil
+		},
+	}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	bulkURL := server.URL + api.API_ROOT + "requests/bulk"
+	reset := func() {
+		gotCreate = nil
+		gotStarted = nil
+		gotFailed = nil
+	}
+
+	// Invalid mode
+	payload := `{"mode":"some","requests":[{"type":"req-a"}]}`
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", bulkURL, []byte(payload), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusBadRequest {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusBadRequest)
+	}
+
+	// All created and started, in a group with the default name
+	payload = `{"requests":[{"type":"req-a"},{"type":"req-b"},{"type":"req-c"}]}`
+	var got proto.BulkCreateResult
+	statusCode, headers, err := testutil.MakeHTTPRequest("POST", bulkURL, []byte(payload), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusCreated {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+	if headers["Location"][0] != api.API_ROOT+"request-groups/g1" {
+		t.Errorf("location = %s, expected %s", headers["Location"][0], api.API_ROOT+"request-groups/g1")
+	}
+	if gotGroupName != api.BULK_GROUP_NAME {
+		t.Errorf("group name = %s, expected %s", gotGroupName, api.BULK_GROUP_NAME)
+	}
+	expect := proto.BulkCreateResult{
+		GroupId: "g1",
+		Mode:    proto.BULK_ALL_OR_NOTHING,
+		Created: 3,
+		Items: []proto.BulkCreateItem{
+			{Index: 0, Type: "req-a", RequestId: "r0", HTTPStatus: http.StatusCreated},
+			{Index: 1, Type: "req-b", RequestId: "r1", HTTPStatus: http.StatusCreated},
+			{Index: 2, Type: "req-c", RequestId: "r2", HTTPStatus: http.StatusCreated},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+	for i, cr := range gotCreate {
+		if cr.GroupId != "g1" || cr.User != "admin" {
+			t.Errorf("request %d GroupId = '%s', User = '%s', expected g1, admin", i, cr.GroupId, cr.User)
+		}
+	}
+
+	// All or nothing: req-b fails, so r0 is failed and req-c is not created
+	reset()
+	failCreate = "req-b"
+	got = proto.BulkCreateResult{}
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", bulkURL, []byte(payload), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if got.Created != 0 || got.Failed != 3 {
+		t.Errorf("created %d, failed %d, expected 0, 3", got.Created, got.Failed)
+	}
+	if got.Items[1].HTTPStatus != http.StatusBadRequest || got.Items[1].Error == "" {
+		t.Errorf("item 1 = %+v, expected HTTP 400 with error", got.Items[1])
+	}
+	for _, i := range []int{0, 2} {
+		if got.Items[i].HTTPStatus != http.StatusFailedDependency {
+			t.Errorf("item %d status = %d, expected %d", i, got.Items[i].HTTPStatus, http.StatusFailedDependency)
+		}
+	}
+	if diff := deep.Equal(gotFailed, []string{"r0"}); diff != nil {
+		t.Error(diff)
+	}
+	if len(gotStarted) != 0 || len(gotCreate) != 1 {
+		t.Errorf("created %d, started %v, expected 1 created, none started", len(gotCreate), gotStarted)
+	}
+
+	// Best effort: req-b fails, req-a and req-c run, and a start error fails
+	// only that request
+	reset()
+	failStart = "r1"
+	payload = `{"name":"cleanup","mode":"best-effort","requests":[{"type":"req-a"},{"type":"req-b"},{"type":"req-c"},{"type":"req-d"}]}`
+	got = proto.BulkCreateResult{}
+	statusCode, _, err = testutil.MakeHTTPRequest("POST", bulkURL, []byte(payload), &got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusOK {
+		t.Fatalf("response status = %d, expected %d", statusCode, http.StatusOK)
+	}
+	if gotGroupName != "cleanup" {
+		t.Errorf("group name = %s, expected cleanup", gotGroupName)
+	}
+	if got.Created != 2 || got.Failed != 2 {
+		t.Errorf("created %d, failed %d, expected 2, 2", got.Created, got.Failed)
+	}
+	expectStatus := []int{http.StatusCreated, http.StatusBadRequest, http.StatusInternalServerError, http.StatusCreated}
+	for i, status := range expectStatus {
+		if got.Items[i].HTTPStatus != status {
+			t.Errorf("item %d status = %d, expected %d", i, got.Items[i].HTTPStatus, status)
+		}
+	}
+	if diff := deep.Equal(gotStarted, []string{"r0", "r2"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(gotFailed, []string{"r1"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestBulkCreateBusy(t *testing.T) {
+	created := make(chan struct{})
+	release := make(chan struct{})
+	ctx := app.Defaults()
+	ctx.Config.BulkCreate.MaxConcurrent = 1
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	ctx.Status = &mock.RMStatus{}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Upgrade = &mock.UpgradeManager{}
+	ctx.RM = &mock.RequestManager{
+		CreateFunc: func(cr proto.CreateRequest) (proto.Request, error) {
+			close(created)
+			<-release
+			return proto.Request{Id: "r0", Type: cr.Type}, nil
+		},
+	}
+	ctx.Group = &mock.GroupManager{}
+
+	server := httptest.NewServer(api.NewAPI(ctx))
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+	bulkURL := server.URL + api.API_ROOT + "requests/bulk"
+	payload := []byte(`{"requests":[{"type":"req-a"}]}`)
+
+	// First bulk create blocks in Create, so the second is throttled
+	done := make(chan int)
+	go func() {
+		statusCode, _, _ := testutil.MakeHTTPRequest("POST", bulkURL, payload, nil)
+		done <- statusCode
+	}()
+	<-created
+	statusCode, _, err := testutil.MakeHTTPRequest("POST", bulkURL, payload, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if statusCode != http.StatusTooManyRequests {
+		t.Errorf("response status = %d, expected %d", statusCode, http.StatusTooManyRequests)
+	}
+	close(release)
+	if statusCode := <-done; statusCode != http.StatusCreated {
+		t.Errorf("first bulk create status = %d, expected %d", statusCode, http.StatusCreated)
+	}
+}
+
+func TestInFlight(t *testing.T) {
+	// Handler blocks until released, so the request is in flight
+	running := make(chan struct{})
+	release := make(chan struct{})
+	ctx := app.Defaults()
+	ctx.Status = &mock.RMStatus{
+		RunningFunc: func(proto.StatusFilter) (proto.RunningStatus, error) {
+			close(running)
+			<-release
+			return proto.RunningStatus{}, nil
+		},
+	}
+	ctx.Quota = &mock.QuotaManager{}
+	ctx.Upgrade = &mock.UpgradeManager{}
+	ctx.Plugins.Auth = mockAuth
+	ctx.Auth = auth.NewManager(mockAuth, map[string][]auth.ACL{}, []string{"test"}, false)
+	a := api.NewAPI(ctx)
+	server := httptest.NewServer(a)
+	defer func() {
+		server.CloseClientConnections()
+		server.Close()
+	}()
+
+	before := api.RequestsInFlight.Value()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		testutil.MakeHTTPRequest("GET", server.URL+api.API_ROOT+"status/running", nil, nil)
+	}()
+	select {
+	case <-running:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for request to be handled")
+	}
+	if n := a.InFlight(); n != 1 {
+		t.Errorf("InFlight = %d, expected 1", n)
+	}
+	if n := api.RequestsInFlight.Value(); n != before+1 {
+		t.Errorf("api_requests_in_flight = %d, expected %d", n, before+1)
+	}
+
+	close(release)
+	<-done
+	if n := a.InFlight(); n != 0 {
+		t.Errorf("InFlight = %d, expected 0", n)
+	}
+	if n := api.RequestsInFlight.Value(); n != before {
+		t.Errorf("api_requests_in_flight = %d, expected %d", n, before)
 	}
 }
@@ -11,13 +11,23 @@ import (
 
 	"github.com/go-sql-driver/mysql"
 
+	"github.com/square/spincycle/v2/argcrypt"
 	"github.com/square/spincycle/v2/config"
 	jr "github.com/square/spincycle/v2/job-runner"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/accesslog"
 	"github.com/square/spincycle/v2/request-manager/auth"
+	"github.com/square/spincycle/v2/request-manager/group"
 	"github.com/square/spincycle/v2/request-manager/joblog"
+	"github.com/square/spincycle/v2/request-manager/placement"
+	"github.com/square/spincycle/v2/request-manager/quota"
+	"github.com/square/spincycle/v2/request-manager/replica"
 	"github.com/square/spincycle/v2/request-manager/request"
+	"github.com/square/spincycle/v2/request-manager/slo"
 	"github.com/square/spincycle/v2/request-manager/spec"
 	"github.com/square/spincycle/v2/request-manager/status"
+	"github.com/square/spincycle/v2/request-manager/upgrade"
+	"github.com/square/spincycle/v2/request-manager/writebuf"
 )
 
 // Context represents the config, core service singletons, and 3rd-party extensions.
@@ -25,15 +35,32 @@ import (
 // called api.appCtx.
 type Context struct {
 	// User-provided config from config file
-	Config config.RequestManager
-	Specs  spec.Specs
+	Config     config.RequestManager
+	Specs      spec.Specs
+	SpecReport proto.SpecReport // spec check results on startup
 
 	// Core service singletons, not user-configurable
-	RM     request.Manager
-	RR     request.Resumer
-	Status status.Manager
-	Auth   auth.Manager
-	JLS    joblog.Store
+	RM      request.Manager
+	RR      request.Resumer
+	Status  status.Manager
+	Auth    auth.Manager
+	JLS     joblog.Store
+	Quota   quota.Manager
+	Upgrade upgrade.Manager
+	Group   group.Manager
+	SLO     slo.Manager
+
+	// Read replica for heavy read-only API endpoints, and the request manager
+	// and job log store that read from it. All nil if disabled (config.ReadReplica).
+	Replica    replica.Replica
+	ReplicaRM  request.Manager
+	ReplicaJLS joblog.Store
+
+	// API access log, nil if disabled (config.AccessLog.Enabled)
+	AccessLog accesslog.Logger
+
+	// Job logs and progress queued while MySQL is unavailable, nil is disabled
+	WriteBuffer writebuf.Buffer
 
 	// Closed to initiate RM shutdown
 	ShutdownChan chan struct{}
@@ -50,6 +77,16 @@ type Context struct {
 type Factories struct {
 	MakeJobRunnerClient func(Context) (jr.Client, error)
 	MakeDbConnPool      func(Context) (*sql.DB, error)
+
+	// MakeReplicaDbConnPool makes the connection pool for the read replica.
+	// It's called only if config.ReadReplica.DSN is set.
+	MakeReplicaDbConnPool func(Context) (*sql.DB, error)
+
+	// MakeArgKeyProvider makes the key provider that encrypts sensitive arg
+	// values, or returns nil if arg encryption is disabled. The default loads
+	// config.ArgEncryption.KeyFile. Provide a custom factory to get keys from
+	// a key management service.
+	MakeArgKeyProvider func(Context) (argcrypt.KeyProvider, error)
 }
 
 // Hooks allow users to modify system behavior at certain points. All hooks are
@@ -81,6 +118,18 @@ type Hooks struct {
 	// when the Request Manager is shutting down, and it should cause RunAPI to
 	// return. If you provide this hook, you need to provide RunAPI as well.
 	StopAPI func() error
+
+	// RequestStateChanged is called after every request state change, for
+	// example to send request events to another system. It's called synchronously
+	// by the API handler or resumer that changed the state, so it should return
+	// quickly.
+	RequestStateChanged func(request.Transition)
+
+	// SLOChanged is called when the SLO of a request type starts burning
+	// (proto.SLOStatus.Burning is true) or stops burning, for example to alert
+	// its owners. Every Request Manager checks SLOs (config.SLO.Interval), so with
+	// N-many Request Managers it's called N times for each change.
+	SLOChanged func(proto.SLOStatus)
 }
 
 // Plugins allow users to provide custom components. All plugins are optional;
@@ -90,7 +139,13 @@ type Hooks struct {
 // completely. For example, the Auth plugin allows the user to provide a complete
 // and custom system of authentication and authorization.
 type Plugins struct {
-	Auth auth.Plugin
+	Auth     auth.Plugin
+	Resolver request.ResolverPlugin
+
+	// Placement are custom placement policies, keyed on the name used in request
+	// specs (spec.Placement.Policy), in addition to the built-in policies. A custom
+	// policy with the name of a built-in policy replaces it.
+	Placement map[string]placement.Policy
 }
 
 // Defaults returns a Context with default (built-in) 3rd-party extensions.
@@ -104,15 +159,18 @@ func Defaults() Context {
 	return Context{
 		ShutdownChan: make(chan struct{}),
 		Factories: Factories{
-			MakeJobRunnerClient: MakeJobRunnerClient,
-			MakeDbConnPool:      MakeDbConnPool,
+			MakeJobRunnerClient:   MakeJobRunnerClient,
+			MakeDbConnPool:        MakeDbConnPool,
+			MakeReplicaDbConnPool: MakeReplicaDbConnPool,
+			MakeArgKeyProvider:    MakeArgKeyProvider,
 		},
 		Hooks: Hooks{
 			LoadConfig: LoadConfig,
 			LoadSpecs:  LoadSpecs,
 		},
 		Plugins: Plugins{
-			Auth: auth.AllowAll{},
+			Auth:     auth.AllowAll{},
+			Resolver: request.NoResolverPlugin{},
 		},
 	}
 }
@@ -153,16 +211,38 @@ func MakeJobRunnerClient(ctx Context) (jr.Client, error) {
 
 // MakeDbConnPool is the default MakeDbConnPool factory.
 func MakeDbConnPool(ctx Context) (*sql.DB, error) {
+	return makeDbConnPool(ctx.Config.MySQL.DSN, ctx.Config.MySQL.TLS, "custom")
+}
+
+// MakeReplicaDbConnPool is the default MakeReplicaDbConnPool factory.
+func MakeReplicaDbConnPool(ctx Context) (*sql.DB, error) {
+	return makeDbConnPool(ctx.Config.ReadReplica.DSN, ctx.Config.ReadReplica.TLS, "replica")
+}
+
+// MakeArgKeyProvider is the default MakeArgKeyProvider factory.
+func MakeArgKeyProvider(ctx Context) (argcrypt.KeyProvider, error) {
+	cfg := ctx.Config.ArgEncryption
+	if cfg.KeyFile == "" {
+		return nil, nil
+	}
+	if cfg.CurrentKey == "" {
+		return nil, fmt.Errorf("arg_encryption.current_key is required")
+	}
+	return argcrypt.LoadKeyring(cfg.KeyFile, cfg.CurrentKey)
+}
+
+// makeDbConnPool returns a connection pool for the DSN. If all TLS files are
+// set, the TLS config is registered with the MySQL driver as tlsName.
+func makeDbConnPool(dsn string, tls config.TLS, tlsName string) (*sql.DB, error) {
 	// @todo: validate dsn
-	dbcfg := ctx.Config.MySQL
-	dsn := dbcfg.DSN + "?parseTime=true" // always needs to be set
-	if dbcfg.TLS.CAFile != "" && dbcfg.TLS.CertFile != "" && dbcfg.TLS.KeyFile != "" {
-		tlsConfig, err := config.NewTLSConfig(dbcfg.TLS.CAFile, dbcfg.TLS.CertFile, dbcfg.TLS.KeyFile)
+	dsn += "?parseTime=true" // always needs to be set
+	if tls.CAFile != "" && tls.CertFile != "" && tls.KeyFile != "" {
+		tlsConfig, err := config.NewTLSConfig(tls.CAFile, tls.CertFile, tls.KeyFile)
 		if err != nil {
 			log.Fatalf("error loading database TLS config: %s", err)
 		}
-		mysql.RegisterTLSConfig("custom", tlsConfig)
-		dsn += "&tls=custom"
+		mysql.RegisterTLSConfig(tlsName, tlsConfig)
+		dsn += "&tls=" + tlsName
 	}
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
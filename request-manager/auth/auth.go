@@ -26,6 +26,16 @@ type Caller struct {
 	// are matched against request ACL roles in specs, which are also user-defined.
 	// Roles are case-sensitive and not modified by Spin Cycle in any way.
 	Roles []string
+
+	// Team of the caller, like "dba" or "payments". The team is user-defined and
+	// optional. It is used for team quotas and setting proto.Request.Team.
+	Team string
+
+	// Namespace of the caller, like "payments". The namespace is user-defined
+	// and optional. Unless the caller has an admin role, it sees and acts only on
+	// request types and requests in its namespace or not in any namespace. Request
+	// types are put in namespaces by the config specs.namespaces.
+	Namespace string
 }
 
 // Plugin represents the auth plugin. Every request is authenticated and authorized.
@@ -126,6 +136,12 @@ func (m Manager) Authorize(caller Caller, op string, req proto.Request) error {
 		return nil // allow
 	}
 
+	// Deny requests in other namespaces before checking ACLs: ACL roles are
+	// user-defined and can be the same in different namespaces
+	if !m.InNamespace(caller, req.Namespace) {
+		return fmt.Errorf("denied: request %s is in namespace %s, caller is in namespace '%s'", req.Type, req.Namespace, caller.Namespace)
+	}
+
 	// Get ACLs for this request
 	acls, ok := m.acls[req.Type]
 	if !ok {
@@ -189,6 +205,34 @@ REQUEST_ACLS:
 	return nil // allow
 }
 
+// AuthorizeAdmin authorizes the caller for admin operations that are not
+// request-specific, like setting quotas. The caller must have a role listed in
+// auth.admin_roles. If no admin roles are configured and strict mode is
+// disabled (the default, i.e. no auth), all callers are allowed.
+func (m Manager) AuthorizeAdmin(caller Caller) error {
+	if m.isAdmin(caller) {
+		return nil // allow
+	}
+	if len(m.adminRoles) == 0 && !m.strict {
+		return nil // no auth, allow
+	}
+	return fmt.Errorf("denied: caller roles %v do not include an admin role", caller.Roles)
+}
+
+// InNamespace returns true if the caller can see and act on request types and
+// requests in the namespace: the namespace is empty (not a namespace), the caller
+// is in the namespace, or the caller has an admin role. It does not authorize
+// ops; Authorize does that, and it calls this method.
+func (m Manager) InNamespace(caller Caller, namespace string) bool {
+	return namespace == "" || caller.Namespace == namespace || m.AllNamespaces(caller)
+}
+
+// AllNamespaces returns true if the caller can see and act on request types and
+// requests in all namespaces, i.e. it has an admin role.
+func (m Manager) AllNamespaces(caller Caller) bool {
+	return m.isAdmin(caller)
+}
+
 // isAdmin returns true if the caller has an admin role.
 func (m Manager) isAdmin(caller Caller) bool {
 	if len(m.adminRoles) == 0 {
@@ -198,6 +198,95 @@ func TestManagerNoACLs(t *testing.T) {
 	}
 }
 
+func TestManagerAuthorizeAdmin(t *testing.T) {
+	caller := auth.Caller{
+		Name:  "dn",
+		Roles: []string{"dev"},
+	}
+
+	// No admin roles and not strict (no auth) = allow all
+	m := auth.NewManager(mock.AuthPlugin{}, map[string][]auth.ACL{}, nil, false)
+	if err := m.AuthorizeAdmin(caller); err != nil {
+		t.Errorf("not allowed (%s), expected AuthorizeAdmin to return nil", err)
+	}
+
+	// No admin roles but strict = deny all
+	m = auth.NewManager(mock.AuthPlugin{}, map[string][]auth.ACL{}, nil, true)
+	if err := m.AuthorizeAdmin(caller); err == nil {
+		t.Errorf("allowed, expected AuthorizeAdmin to return err")
+	}
+
+	// Caller does not have admin role
+	m = auth.NewManager(mock.AuthPlugin{}, map[string][]auth.ACL{}, []string{"admin"}, false)
+	if err := m.AuthorizeAdmin(caller); err == nil {
+		t.Errorf("allowed, expected AuthorizeAdmin to return err")
+	}
+
+	// Caller has admin role
+	caller.Roles = []string{"dev", "admin"}
+	if err := m.AuthorizeAdmin(caller); err != nil {
+		t.Errorf("not allowed (%s), expected AuthorizeAdmin to return nil", err)
+	}
+}
+
+func TestManagerNamespaces(t *testing.T) {
+	acls := map[string][]auth.ACL{
+		"req1": nil, // no ACLs, not strict: allow all in namespace
+	}
+	m := auth.NewManager(mock.AuthPlugin{}, acls, []string{"admin"}, false)
+
+	caller := auth.Caller{
+		Name:      "dn",
+		Roles:     []string{"dev"},
+		Namespace: "payments",
+	}
+	req := proto.Request{
+		Id:        "abc",
+		Type:      "req1",
+		Namespace: "payments",
+	}
+
+	// Same namespace and not in a namespace = allow
+	if !m.InNamespace(caller, "payments") || !m.InNamespace(caller, "") {
+		t.Errorf("InNamespace returned false, expected true for caller namespace and no namespace")
+	}
+	if err := m.Authorize(caller, proto.REQUEST_OP_START, req); err != nil {
+		t.Errorf("not allowed (%s), expected Authorize to return nil", err)
+	}
+
+	// Other namespace = deny
+	req.Namespace = "dba"
+	if m.InNamespace(caller, "dba") {
+		t.Errorf("InNamespace returned true, expected false for other namespace")
+	}
+	err := m.Authorize(caller, proto.REQUEST_OP_START, req)
+	t.Log(err)
+	if err == nil {
+		t.Errorf("allowed, expected Authorize to return err")
+	}
+
+	// Caller not in a namespace = deny
+	if m.InNamespace(auth.Caller{}, "dba") {
+		t.Errorf("InNamespace returned true, expected false for caller without namespace")
+	}
+
+	if m.AllNamespaces(caller) {
+		t.Errorf("AllNamespaces returned true, expected false for non-admin")
+	}
+
+	// Admins are in all namespaces
+	caller.Roles = []string{"admin"}
+	if !m.AllNamespaces(caller) {
+		t.Errorf("AllNamespaces returned false, expected true for admin")
+	}
+	if !m.InNamespace(caller, "dba") {
+		t.Errorf("InNamespace returned false, expected true for admin")
+	}
+	if err := m.Authorize(caller, proto.REQUEST_OP_START, req); err != nil {
+		t.Errorf("not allowed (%s), expected Authorize to return nil", err)
+	}
+}
+
 func TestAllowAll(t *testing.T) {
 	all := auth.AllowAll{}
 
@@ -0,0 +1,41 @@
+// Copyright 2020, Square, Inc.
+
+// Command backfill-args saves request args of requests created before the
+// request_args table existed so they can be found by arg value. It uses the
+// same config file and environment variables as the Request Manager to connect
+// to MySQL:
+//
+//	backfill-args [config file]
+package main
+
+import (
+	"log"
+
+	"github.com/square/spincycle/v2/config"
+	"github.com/square/spincycle/v2/request-manager/app"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+const batchSize = 100
+
+func main() {
+	appCtx := app.Defaults()
+	cfg, err := appCtx.Hooks.LoadConfig(appCtx)
+	if err != nil {
+		log.Fatalf("Error loading config: %s", err)
+	}
+	cfg.MySQL.DSN = config.Env("SPINCYCLE_MYSQL_DSN", cfg.MySQL.DSN)
+	appCtx.Config = cfg
+
+	db, err := appCtx.Factories.MakeDbConnPool(appCtx)
+	if err != nil {
+		log.Fatalf("Error connecting to MySQL: %s", err)
+	}
+	defer db.Close()
+
+	n, err := request.BackfillArgs(db, batchSize)
+	if err != nil {
+		log.Fatalf("Error backfilling request args after %d requests: %s", n, err)
+	}
+	log.Printf("Backfilled args for %d requests", n)
+}
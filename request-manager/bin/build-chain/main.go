@@ -0,0 +1,153 @@
+// Copyright 2020, Square, Inc.
+
+// Command build-chain builds the job chain of a request from the specs and
+// prints it, without a Request Manager, MySQL, or Job Runner. Use it in spec CI
+// pipelines to check that requests build with real args, and to debug grapher
+// issues:
+//
+//	build-chain --specs specs/ --type stop-host host=db1 reason=test
+//
+// Jobs are made by jobs.Factory, like the Request Manager, so build it with the
+// same jobs package, or use --stub-jobs to build without it: stub jobs only set
+// the job args that their node specs say they set, to placeholder values.
+//
+// The job chain is printed to stdout as JSON (proto.JobChain), or as a DAG
+// (--format dag or argo, see graph.Export). Warnings and errors are printed to
+// stderr, and it exits 1 on error.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/alexflint/go-arg"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/jobs"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/id"
+	"github.com/square/spincycle/v2/request-manager/request"
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+const FORMAT_JSON = "json"
+
+type options struct {
+	Specs  string   `help:"path to spin cycle requests directory"`
+	Type   string   `arg:"required" help:"request type (name of the request spec) to build"`
+	Env    string   `help:"environment name; apply node env overrides for it, like the Request Manager with specs.env"`
+	Format string   `help:"output format: json (job chain), dag (DAG JSON), or argo (Argo Workflows YAML)"`
+	User   string   `help:"request user, for specs that use it"`
+	Args   []string `arg:"positional" help:"request args as key=val"`
+
+	StubJobs bool `arg:"--stub-jobs" help:"make stub jobs that set the args in their node sets: instead of real jobs from jobs.Factory [default: false]"`
+}
+
+func main() {
+	opts := options{
+		Specs:  "./",
+		Format: FORMAT_JSON,
+	}
+	arg.MustParse(&opts)
+	if err := run(opts); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %s\n", err)
+		os.Exit(1)
+	}
+}
+
+func run(opts options) error {
+	switch opts.Format {
+	case FORMAT_JSON, graph.EXPORT_FORMAT_DAG, graph.EXPORT_FORMAT_ARGO:
+	default:
+		return fmt.Errorf("invalid --format %s: expected %s, %s, or %s", opts.Format, FORMAT_JSON, graph.EXPORT_FORMAT_DAG, graph.EXPORT_FORMAT_ARGO)
+	}
+
+	args := map[string]interface{}{}
+	for _, keyval := range opts.Args {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("invalid arg: %s: split on = produced %d values, expected 2 (key=val)", keyval, len(p))
+		}
+		args[p[0]] = p[1]
+	}
+
+	// Load, check, and graph specs like the Request Manager does at startup
+	specs, fileResults, err := spec.NewDirParser(opts.Specs, nil, nil).Parse()
+	if err != nil {
+		return err
+	}
+	printResults(fileResults)
+	if fileResults.AnyError {
+		return fmt.Errorf("specs have parse errors")
+	}
+	if opts.Env != "" {
+		spec.ApplyEnv(specs, opts.Env)
+	}
+	spec.ProcessSpecs(&specs)
+
+	checker, err := spec.NewChecker([]spec.CheckFactory{spec.DefaultCheckFactory{AllSpecs: specs}, spec.BaseCheckFactory{AllSpecs: specs}})
+	if err != nil {
+		return err
+	}
+	checkResults := checker.RunChecks(specs)
+	printResults(checkResults)
+	if checkResults.AnyError {
+		return fmt.Errorf("specs have errors")
+	}
+
+	gf := id.NewGeneratorFactory(4, 100)
+	seqGraphs, graphResults := graph.NewGrapher(specs, gf).CheckSequences()
+	printResults(graphResults)
+	if graphResults.AnyError {
+		return fmt.Errorf("specs have graph errors")
+	}
+
+	// Build the job chain. Built-in poll jobs are made by the poll factory, all
+	// other jobs by jobs.Factory, like the Request Manager, or stub jobs.
+	var jf job.Factory = jobs.Factory
+	if opts.StubJobs {
+		jf = newStubFactory(specs)
+	}
+	rf := graph.NewResolverFactory(poll.NewFactory(jf), specs.Sequences, seqGraphs, gf)
+	req, err := request.BuildJobChain(rf, specs.Sequences, proto.CreateRequest{
+		Type: opts.Type,
+		Args: args,
+		User: opts.User,
+	})
+	if err != nil {
+		return err
+	}
+	for _, warn := range req.Warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", warn)
+	}
+
+	if opts.Format != FORMAT_JSON {
+		bytes, err := graph.Export(graph.ChainDAG(*req.JobChain), opts.Format)
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(bytes))
+		return nil
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetEscapeHTML(false) // stub job placeholders, like "<set by node>"
+	enc.SetIndent("", "  ")
+	return enc.Encode(req.JobChain)
+}
+
+// printResults prints spec warnings and errors to stderr.
+func printResults(results *spec.CheckResults) {
+	for _, name := range results.Keys() {
+		result := results.Results[name]
+		for _, warn := range result.Warnings {
+			fmt.Fprintf(os.Stderr, "Warning: %s: %s\n", name, warn)
+		}
+		for _, err := range result.Errors {
+			fmt.Fprintf(os.Stderr, "Error: %s: %s\n", name, err)
+		}
+	}
+}
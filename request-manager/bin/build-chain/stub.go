@@ -0,0 +1,100 @@
+// Copyright 2020, Square, Inc.
+
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// stubFactory makes stub jobs (--stub-jobs) instead of real jobs, so job chains
+// can be built without the jobs package, like in spec CI pipelines. A stub job
+// sets the job args that its node spec says it sets (sets:) to placeholder
+// values: "<set by NODE>", or a list of one placeholder if any node iterates
+// over the arg (each:).
+type stubFactory struct {
+	sets map[string]map[string]interface{} // job type/node name => job args that the job sets
+}
+
+func newStubFactory(specs spec.Specs) stubFactory {
+	lists := map[string]bool{} // args that nodes iterate over
+	for _, seq := range specs.Sequences {
+		for _, node := range seq.Nodes {
+			for _, each := range node.Each {
+				lists[strings.Split(each, ":")[0]] = true
+			}
+		}
+	}
+	f := stubFactory{
+		sets: map[string]map[string]interface{}{},
+	}
+	for _, seq := range specs.Sequences {
+		for _, node := range seq.Nodes {
+			if node.NodeType == nil {
+				continue
+			}
+			key := *node.NodeType + "/" + node.Name
+			for _, set := range node.Sets {
+				if set == nil || set.Arg == nil {
+					continue
+				}
+				if f.sets[key] == nil {
+					f.sets[key] = map[string]interface{}{}
+				}
+				var val interface{} = fmt.Sprintf("<set by %s>", node.Name)
+				if lists[*set.Arg] || (set.As != nil && lists[*set.As]) {
+					val = []interface{}{val}
+				}
+				f.sets[key][*set.Arg] = val
+			}
+		}
+	}
+	return f
+}
+
+func (f stubFactory) Make(id job.Id) (job.Job, error) {
+	return &stubJob{id: id, sets: f.sets[id.Type+"/"+id.Name]}, nil
+}
+
+// stubJob is a job that only sets job args. It's never run.
+type stubJob struct {
+	id   job.Id
+	sets map[string]interface{}
+}
+
+func (j *stubJob) Create(jobArgs map[string]interface{}) error {
+	for arg, val := range j.sets {
+		if _, ok := jobArgs[arg]; !ok {
+			jobArgs[arg] = val
+		}
+	}
+	return nil
+}
+
+func (j *stubJob) Serialize() ([]byte, error) {
+	return nil, nil
+}
+
+func (j *stubJob) Deserialize(bytes []byte) error {
+	return nil
+}
+
+func (j *stubJob) Run(jobData map[string]interface{}) (job.Return, error) {
+	return job.Return{State: proto.STATE_FAIL}, fmt.Errorf("stub job cannot run")
+}
+
+func (j *stubJob) Status() string {
+	return "stub"
+}
+
+func (j *stubJob) Stop() error {
+	return nil
+}
+
+func (j *stubJob) Id() job.Id {
+	return j.id
+}
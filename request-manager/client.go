@@ -5,10 +5,15 @@ package rm
 
 import (
 	"bytes"
+	"container/list"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
 
 	"github.com/square/spincycle/v2/proto"
 )
@@ -27,6 +32,44 @@ type Client interface {
 	// (i.e. most recent first).
 	FindRequests(proto.RequestFilter) ([]proto.Request, error)
 
+	// RequestHistory takes a request type, since time, and limit, and returns
+	// the most recent requests of the type and a summary of their outcomes.
+	RequestHistory(string, time.Time, uint) (proto.RequestHistory, error)
+
+	// ExportRequest takes a request id and returns the request bundle to import
+	// into another Request Manager.
+	ExportRequest(string) (proto.RequestBundle, error)
+
+	// ImportRequest imports a request bundle exported from another Request
+	// Manager and returns the imported request.
+	ImportRequest(proto.RequestBundle) (proto.Request, error)
+
+	// RetryRequest takes the id of a failed request and args to override, and
+	// returns the new request that retries it. The new request is started.
+	RetryRequest(string, proto.RetryRequest) (proto.Request, error)
+
+	// RequestFailure takes a request id and returns the root cause of the
+	// request failure: the earliest failed job try and the jobs skipped because
+	// of it.
+	RequestFailure(string) (proto.RequestFailure, error)
+
+	// CreateRequestGroup creates a request group and creates and starts its
+	// requests. It returns the group with its requests.
+	CreateRequestGroup(proto.CreateRequestGroup) (proto.RequestGroup, error)
+
+	// GetRequestGroup takes a request group id and returns the group with its
+	// requests and their aggregate status.
+	GetRequestGroup(string) (proto.RequestGroup, error)
+
+	// StopRequestGroup takes a request group id and stops all running requests
+	// in the group. The timeout is the same as StopRequest.
+	StopRequestGroup(string, time.Duration) error
+
+	// CreateRequestBulk creates and starts many requests in a new request group,
+	// all or nothing or best effort (proto.CreateRequestBulk.Mode). It returns
+	// the result of every request; check BulkCreateResult.Failed.
+	CreateRequestBulk(proto.CreateRequestBulk) (proto.BulkCreateResult, error)
+
 	// StartRequest takes a request id and starts the corresponding request
 	// (by sending it to the job runner).
 	StartRequest(string) error
@@ -35,36 +78,131 @@ type Client interface {
 	FinishRequest(proto.FinishRequest) error
 
 	// StopRequest takes a request id and stops the corresponding request.
-	// If the request is not running, it returns an error.
-	StopRequest(string) error
+	// If the request is not running, it returns an error. If the timeout is
+	// greater than zero, it overrides how long the Job Runner waits for running
+	// jobs to stop.
+	StopRequest(string, time.Duration) error
+
+	// StopJob takes a request id and job id and stops the current try of the job
+	// without stopping the request. The try fails, so the job is retried if it
+	// has tries left. If the job is not running a try, it returns an error.
+	StopJob(requestId, jobId string) error
 
 	// SuspendRequest takes a request id and a SuspendedJobChain and suspends the
 	// corresponding request. It marks the request's state as suspended and saves
 	// the SuspendedJobChain.
 	SuspendRequest(string, proto.SuspendedJobChain) error
 
+	// SetRequestLogLevel takes a request id and elevates its log level on the
+	// Request Manager and the Job Runner running it. It returns the log level
+	// with Until set.
+	SetRequestLogLevel(string, proto.RequestLogLevel) (proto.RequestLogLevel, error)
+
+	// FinalizeRequest takes a request id and forcibly sets its final state, for
+	// a request whose Job Runner is unrecoverable. Only admins can finalize
+	// requests. It returns the finalized request.
+	FinalizeRequest(string, proto.FinalizeRequest) (proto.Request, error)
+
+	// GetResumePoints takes the id of a suspended request and returns its job
+	// chain with the job states it will be resumed from.
+	GetResumePoints(string) (proto.JobChain, error)
+
+	// SetResumePoints takes the id of a suspended request and marks its jobs
+	// complete, skipped, or pending before it's resumed. It returns the changed
+	// job chain.
+	SetResumePoints(string, proto.ResumePoints) (proto.JobChain, error)
+
 	// GetJobChain gets the job chain for a given request id.
 	GetJobChain(string) (proto.JobChain, error)
 
 	// GetJL gets the job log of the given request ID.
 	GetJL(string) ([]proto.JobLog, error)
 
+	// GetJLWithFilter gets the job log of the given request ID, filtered.
+	GetJLWithFilter(string, proto.JobLogFilter) ([]proto.JobLog, error)
+
+	// GetJobTries gets every try of a job in the given request ID, ordered by try
+	// number. The JLs do not have stdout and stderr.
+	GetJobTries(requestId, jobId string) ([]proto.JobLog, error)
+
 	// CreateJL creates a JL for a given request id.
 	CreateJL(string, proto.JobLog) error
 
+	// CreateJLBatch creates JLs for any requests in one call. Every JL must have
+	// its RequestId. It returns one result per JL, in order (see proto.JobLogResult).
+	CreateJLBatch([]proto.JobLog) ([]proto.JobLogResult, error)
+
+	// Deliver sends job logs and final request states that the Job Runner queued
+	// because the Request Manager was unreachable. It returns one result per
+	// delivery applied, in order, which can be fewer than the deliveries sent
+	// (see proto.DeliveryResult).
+	Deliver([]proto.Delivery) ([]proto.DeliveryResult, error)
+
 	// RequestList returns a list of possible requests.
 	RequestList() ([]proto.RequestSpec, error)
 
+	// RequestTypeMetadata returns the documentation of a request type: its request
+	// spec, and the description and docs URL of its sequences and nodes.
+	RequestTypeMetadata(string) (proto.RequestTypeMetadata, error)
+
+	// ListSLOs returns the SLO status of all request types with an SLO, sorted
+	// by type.
+	ListSLOs() ([]proto.SLOStatus, error)
+
+	// SLOStatus returns the SLO status of a request type: how well its requests
+	// meet its SLO in every window, and if it's burning.
+	SLOStatus(string) (proto.SLOStatus, error)
+
 	// Running returns a list of running jobs, sorted by runtime.
 	Running(proto.StatusFilter) (proto.RunningStatus, error)
 
 	// UpdateProgress updates request progress from Job Runner.
 	UpdateProgress(proto.RequestProgress) error
+
+	// PushStatus sends the running status of a Job Runner.
+	PushStatus(proto.JobRunnerStatus) error
+
+	// JobTypeTries returns the tries of each job type in the circuit breaker
+	// window on all Job Runners that push status, keyed on job type.
+	JobTypeTries() (map[string]proto.JobTypeTries, error)
+
+	// ServerVersion returns the version, API version, and features of the
+	// Request Manager, and the versions of Job Runners that push status.
+	ServerVersion() (proto.ServerVersion, error)
+
+	// Features returns the features (proto.FEATURE_*) enabled on the Request
+	// Manager, sorted.
+	Features() ([]string, error)
+
+	// SpecReport returns the results of checking the specs that the Request
+	// Manager loaded on startup, and the request types it cannot build.
+	SpecReport() (proto.SpecReport, error)
+}
+
+// APIError is returned by a Client when the API returns an error other than
+// 404 and 409, like a 500 on db error or a 401 when the caller is not allowed.
+// (404 and 409 errors are returned as the proto.Error from the API.)
+type APIError struct {
+	HTTPStatus int    // HTTP status code
+	Message    string // error message, including the HTTP status code
 }
 
+func (e APIError) Error() string {
+	return e.Message
+}
+
+// CACHE_SIZE is the max number of GET responses that a Client caches. The RM
+// returns an ETag with requests, job chains, job logs, and running status, so a
+// Client caches them and asks for them again with If-None-Match. If a response
+// has not changed, the RM returns 304 Not Modified without it, and the Client
+// uses the cached response. When the cache is full, the least recently used
+// response is removed.
+const CACHE_SIZE = 100
+
 type client struct {
 	*http.Client
 	baseUrl string
+	cache   *responseCache
 }
 
 // NewClient takes an http.Client and base API URL and creates a Client.
@@ -72,6 +210,7 @@ func NewClient(c *http.Client, baseUrl string) Client {
 	return &client{
 		Client:  c,
 		baseUrl: baseUrl,
+		cache:   newResponseCache(CACHE_SIZE),
 	}
 }
 
@@ -111,6 +250,96 @@ func (c *client) FindRequests(filter proto.RequestFilter) ([]proto.Request, erro
 	return requests, err
 }
 
+func (c *client) RequestHistory(reqType string, since time.Time, limit uint) (proto.RequestHistory, error) {
+	// GET /api/v1/request-history
+	params := url.Values{}
+	params.Add("type", reqType)
+	if !since.IsZero() {
+		params.Add("since", since.Format(time.RFC3339Nano))
+	}
+	if limit != 0 {
+		params.Add("limit", strconv.FormatUint(uint64(limit), 10))
+	}
+	url := c.baseUrl + "/api/v1/request-history?" + params.Encode()
+
+	var h proto.RequestHistory
+	err := c.makeRequest("GET", url, nil, &h)
+	return h, err
+}
+
+func (c *client) ExportRequest(requestId string) (proto.RequestBundle, error) {
+	// GET /api/v1/requests/${requestId}/export
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/export"
+
+	var b proto.RequestBundle
+	err := c.makeRequest("GET", url, nil, &b)
+	return b, err
+}
+
+func (c *client) ImportRequest(b proto.RequestBundle) (proto.Request, error) {
+	// POST /api/v1/requests/import
+	url := c.baseUrl + "/api/v1/requests/import"
+
+	var req proto.Request
+	err := c.makeRequest("POST", url, b, &req)
+	return req, err
+}
+
+func (c *client) RetryRequest(requestId string, retry proto.RetryRequest) (proto.Request, error) {
+	// POST /api/v1/requests/${requestId}/retry
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/retry"
+
+	var req proto.Request
+	err := c.makeRequest("POST", url, retry, &req)
+	return req, err
+}
+
+func (c *client) RequestFailure(requestId string) (proto.RequestFailure, error) {
+	// GET /api/v1/requests/${requestId}/failure
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/failure"
+
+	var f proto.RequestFailure
+	err := c.makeRequest("GET", url, nil, &f)
+	return f, err
+}
+
+func (c *client) CreateRequestGroup(cg proto.CreateRequestGroup) (proto.RequestGroup, error) {
+	// POST /api/v1/request-groups
+	url := c.baseUrl + "/api/v1/request-groups"
+
+	var g proto.RequestGroup
+	err := c.makeRequest("POST", url, cg, &g)
+	return g, err
+}
+
+func (c *client) GetRequestGroup(groupId string) (proto.RequestGroup, error) {
+	// GET /api/v1/request-groups/${groupId}
+	url := c.baseUrl + "/api/v1/request-groups/" + groupId
+
+	var g proto.RequestGroup
+	err := c.makeRequest("GET", url, nil, &g)
+	return g, err
+}
+
+func (c *client) StopRequestGroup(groupId string, timeout time.Duration) error {
+	// PUT /api/v1/request-groups/${groupId}/stop
+	url := c.baseUrl + "/api/v1/request-groups/" + groupId + "/stop"
+	if timeout > 0 {
+		url += "?timeout=" + timeout.String()
+	}
+
+	return c.makeRequest("PUT", url, nil, nil)
+}
+
+func (c *client) CreateRequestBulk(cb proto.CreateRequestBulk) (proto.BulkCreateResult, error) {
+	// POST /api/v1/requests/bulk
+	url := c.baseUrl + "/api/v1/requests/bulk"
+
+	var r proto.BulkCreateResult
+	err := c.makeRequest("POST", url, cb, &r)
+	return r, err
+}
+
 func (c *client) StartRequest(requestId string) error {
 	// PUT /api/v1/requests/${requestId}/start
 	url := c.baseUrl + "/api/v1/requests/" + requestId + "/start"
@@ -133,18 +362,79 @@ func (c *client) FinishRequest(fr proto.FinishRequest) error {
 	return c.makeRequest("PUT", url, fr, nil)
 }
 
-func (c *client) StopRequest(requestId string) error {
+func (c *client) StopRequest(requestId string, timeout time.Duration) error {
 	// PUT /api/v1/requests/${requestId}/stop
 	url := c.baseUrl + "/api/v1/requests/" + requestId + "/stop"
+	if timeout > 0 {
+		url += "?timeout=" + timeout.String()
+	}
 
 	return c.makeRequest("PUT", url, nil, nil)
 }
 
+func (c *client) StopJob(requestId, jobId string) error {
+	// PUT /api/v1/requests/${requestId}/jobs/${jobId}/stop
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/jobs/" + jobId + "/stop"
+
+	return c.makeRequest("PUT", url, nil, nil)
+}
+
+func (c *client) SetRequestLogLevel(requestId string, ll proto.RequestLogLevel) (proto.RequestLogLevel, error) {
+	// PUT /api/v1/requests/${requestId}/log-level
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/log-level"
+
+	var set proto.RequestLogLevel
+	err := c.makeRequest("PUT", url, ll, &set)
+	return set, err
+}
+
+func (c *client) FinalizeRequest(requestId string, f proto.FinalizeRequest) (proto.Request, error) {
+	// PUT /api/v1/requests/${requestId}/finalize
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/finalize"
+
+	var req proto.Request
+	err := c.makeRequest("PUT", url, f, &req)
+	return req, err
+}
+
+func (c *client) GetResumePoints(requestId string) (proto.JobChain, error) {
+	// GET /api/v1/requests/${requestId}/resume-points
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/resume-points"
+
+	var jc proto.JobChain
+	err := c.makeRequest("GET", url, nil, &jc)
+	return jc, err
+}
+
+func (c *client) SetResumePoints(requestId string, rp proto.ResumePoints) (proto.JobChain, error) {
+	// PUT /api/v1/requests/${requestId}/resume-points
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/resume-points"
+
+	var jc proto.JobChain
+	err := c.makeRequest("PUT", url, rp, &jc)
+	return jc, err
+}
+
 func (c *client) SuspendRequest(requestId string, sjc proto.SuspendedJobChain) error {
 	// PUT /api/v1/requests/${requestId}/suspend
 	url := c.baseUrl + "/api/v1/requests/" + requestId + "/suspend"
 
-	return c.makeRequest("PUT", url, sjc, nil)
+	// Send the SJC in the chain format (proto.ChainFormat), or JSON if the RM
+	// does not support the format (HTTP 415), like an older RM during a rolling
+	// upgrade
+	format := proto.ChainFormat()
+	if format == proto.CHAIN_FORMAT_JSON {
+		return c.makeRequest("PUT", url, sjc, nil)
+	}
+	payload, err := proto.EncodeSuspendedJobChain(sjc, format)
+	if err != nil {
+		return err
+	}
+	err = c.send("PUT", url, proto.ContentType(format), payload, nil)
+	if apiErr, ok := err.(APIError); ok && apiErr.HTTPStatus == http.StatusUnsupportedMediaType {
+		return c.makeRequest("PUT", url, sjc, nil)
+	}
+	return err
 }
 
 func (c *client) GetJobChain(requestId string) (proto.JobChain, error) {
@@ -157,14 +447,26 @@ func (c *client) GetJobChain(requestId string) (proto.JobChain, error) {
 }
 
 func (c *client) GetJL(requestId string) ([]proto.JobLog, error) {
+	return c.GetJLWithFilter(requestId, proto.JobLogFilter{})
+}
+
+func (c *client) GetJLWithFilter(requestId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
 	// GET /api/v1/requests/${requestId}/log
-	url := c.baseUrl + "/api/v1/requests/" + requestId + "/log"
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/log" + f.String()
 
 	var jl []proto.JobLog
 	err := c.makeRequest("GET", url, nil, &jl)
 	return jl, err
 }
 
+func (c *client) GetJobTries(requestId, jobId string) ([]proto.JobLog, error) {
+	// GET /api/v1/requests/${requestId}/jobs/${jobId}/tries
+	url := c.baseUrl + "/api/v1/requests/" + requestId + "/jobs/" + jobId + "/tries"
+	var tries []proto.JobLog
+	err := c.makeRequest("GET", url, nil, &tries)
+	return tries, err
+}
+
 func (c *client) CreateJL(requestId string, jl proto.JobLog) error {
 	// POST /api/v1/requests/${requestId}/log
 	url := c.baseUrl + "/api/v1/requests/" + requestId + "/log"
@@ -172,6 +474,22 @@ func (c *client) CreateJL(requestId string, jl proto.JobLog) error {
 	return c.makeRequest("POST", url, jl, nil)
 }
 
+func (c *client) CreateJLBatch(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+	// POST /api/v1/job-logs
+	url := c.baseUrl + "/api/v1/job-logs"
+	var results []proto.JobLogResult
+	err := c.makeRequest("POST", url, jls, &results)
+	return results, err
+}
+
+func (c *client) Deliver(deliveries []proto.Delivery) ([]proto.DeliveryResult, error) {
+	// POST /api/v1/deliveries
+	url := c.baseUrl + "/api/v1/deliveries"
+	var results []proto.DeliveryResult
+	err := c.makeRequest("POST", url, deliveries, &results)
+	return results, err
+}
+
 func (c *client) RequestList() ([]proto.RequestSpec, error) {
 	// GET /api/v1/requests
 	url := c.baseUrl + "/api/v1/request-list"
@@ -180,6 +498,30 @@ func (c *client) RequestList() ([]proto.RequestSpec, error) {
 	return req, err
 }
 
+func (c *client) RequestTypeMetadata(reqType string) (proto.RequestTypeMetadata, error) {
+	// GET /api/v1/request-types/${reqType}
+	url := c.baseUrl + "/api/v1/request-types/" + reqType
+	var md proto.RequestTypeMetadata
+	err := c.makeRequest("GET", url, nil, &md)
+	return md, err
+}
+
+func (c *client) ListSLOs() ([]proto.SLOStatus, error) {
+	// GET /api/v1/slo
+	url := c.baseUrl + "/api/v1/slo"
+	var slos []proto.SLOStatus
+	err := c.makeRequest("GET", url, nil, &slos)
+	return slos, err
+}
+
+func (c *client) SLOStatus(reqType string) (proto.SLOStatus, error) {
+	// GET /api/v1/slo/${reqType}
+	url := c.baseUrl + "/api/v1/slo/" + reqType
+	var s proto.SLOStatus
+	err := c.makeRequest("GET", url, nil, &s)
+	return s, err
+}
+
 func (c *client) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 	// GET /api/v1/requests
 	url := c.baseUrl + "/api/v1/status/running" + f.String()
@@ -194,6 +536,44 @@ func (c *client) UpdateProgress(prg proto.RequestProgress) error {
 	return c.makeRequest("PUT", url, prg, nil)
 }
 
+func (c *client) PushStatus(s proto.JobRunnerStatus) error {
+	// PUT /api/v1/status/job-runner
+	url := c.baseUrl + "/api/v1/status/job-runner"
+	return c.makeRequest("PUT", url, s, nil)
+}
+
+func (c *client) JobTypeTries() (map[string]proto.JobTypeTries, error) {
+	// GET /api/v1/status/job-types
+	url := c.baseUrl + "/api/v1/status/job-types"
+	var tries map[string]proto.JobTypeTries
+	err := c.makeRequest("GET", url, nil, &tries)
+	return tries, err
+}
+
+func (c *client) ServerVersion() (proto.ServerVersion, error) {
+	// GET /api/v1/version
+	url := c.baseUrl + "/api/v1/version"
+	var sv proto.ServerVersion
+	err := c.makeRequest("GET", url, nil, &sv)
+	return sv, err
+}
+
+func (c *client) Features() ([]string, error) {
+	// GET /api/v1/features
+	url := c.baseUrl + "/api/v1/features"
+	var features []string
+	err := c.makeRequest("GET", url, nil, &features)
+	return features, err
+}
+
+func (c *client) SpecReport() (proto.SpecReport, error) {
+	// GET /api/v1/spec-report
+	url := c.baseUrl + "/api/v1/spec-report"
+	var report proto.SpecReport
+	err := c.makeRequest("GET", url, nil, &report)
+	return report, err
+}
+
 // ------------------------------------------------------------------------- //
 
 // makeRequest is a helper function for making HTTP requests. The httpVerb, url,
@@ -212,15 +592,26 @@ func (c *client) makeRequest(httpVerb, url string, payloadStruct interface{}, re
 			return err
 		}
 	}
+	return c.send(httpVerb, url, proto.CONTENT_TYPE_JSON, payload, respStruct)
+}
 
+// send is makeRequest with a payload already encoded as the content type.
+func (c *client) send(httpVerb, url, contentType string, payload []byte, respStruct interface{}) error {
 	// Create the request.
 	req, err := http.NewRequest(httpVerb, url, bytes.NewBuffer(payload))
 	if err != nil {
 		return err
 	}
 
-	// Send the request.
-	req.Header.Set("Content-Type", "application/json")
+	// Send the request. If a GET response is cached, ask for it only if it
+	// changed.
+	req.Header.Set("Content-Type", contentType)
+	var cached *cachedResponse
+	if httpVerb == "GET" {
+		if cached = c.cache.get(url); cached != nil {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+	}
 	resp, err := c.Client.Do(req)
 	if err != nil {
 		return err
@@ -233,6 +624,18 @@ func (c *client) makeRequest(httpVerb, url string, payloadStruct interface{}, re
 		return err
 	}
 
+	if httpVerb == "GET" {
+		switch {
+		case resp.StatusCode == http.StatusNotModified && cached != nil:
+			resp.StatusCode = http.StatusOK
+			body = cached.body
+		case resp.StatusCode == http.StatusOK && resp.Header.Get("ETag") != "":
+			c.cache.put(url, resp.Header.Get("ETag"), body)
+		default:
+			c.cache.remove(url)
+		}
+	}
+
 	// Success if status 200 or 201. Else it should be a proto.Error message with
 	// a helpful error message. The err returned here will most likely be reported
 	// verbatim by the client (e.g. spinc), so it's important to make it clear.
@@ -240,24 +643,34 @@ func (c *client) makeRequest(httpVerb, url string, payloadStruct interface{}, re
 		if len(body) == 0 {
 			// If there's no response body, then the API probably crashed and
 			// the status code is probably 500
-			return fmt.Errorf("no response from API, check logs (HTTP status %d)", resp.StatusCode)
+			return APIError{
+				HTTPStatus: resp.StatusCode,
+				Message:    fmt.Sprintf("no response from API, check logs (HTTP status %d)", resp.StatusCode),
+			}
 		}
 		var perr proto.Error
 		err := json.Unmarshal(body, &perr)
 		if err == nil && perr.Message != "" {
-			if resp.StatusCode == http.StatusNotFound {
-				// 404s aren't API errors, so just report the "not found" error message as-is
+			if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusConflict {
+				// 404s and 409s aren't API errors, so just report the "not found"
+				// or conflict (like invalid state) error message as-is
 				return perr
 			} else {
 				// This can be anything from 500 errors on db error, or 401 errors
 				// if caller sends bad data
-				return fmt.Errorf("API error: %s (HTTP status %d)", perr, resp.StatusCode)
+				return APIError{
+					HTTPStatus: resp.StatusCode,
+					Message:    fmt.Sprintf("API error: %s (HTTP status %d)", perr, resp.StatusCode),
+				}
 			}
 		} else {
 			// If proto.Error.Message is empty, the API probably crashed and maybe
 			// the framework (Echo) sent something else. Dump whatever content body
 			// we have; it probably has some info about the error.
-			return fmt.Errorf("API error: %s (HTTP status %d)", string(body), resp.StatusCode)
+			return APIError{
+				HTTPStatus: resp.StatusCode,
+				Message:    fmt.Sprintf("API error: %s (HTTP status %d)", string(body), resp.StatusCode),
+			}
 		}
 	}
 
@@ -270,3 +683,67 @@ func (c *client) makeRequest(httpVerb, url string, payloadStruct interface{}, re
 
 	return nil
 }
+
+// responseCache is an LRU cache of GET responses with an ETag, keyed on URL.
+// It's safe for concurrent use.
+type responseCache struct {
+	max   int
+	lru   *list.List               // *cachedResponse, most recently used first
+	items map[string]*list.Element // keyed on URL
+	mux   *sync.Mutex
+}
+
+type cachedResponse struct {
+	url  string
+	etag string
+	body []byte
+}
+
+func newResponseCache(max int) *responseCache {
+	return &responseCache{
+		max:   max,
+		lru:   list.New(),
+		items: map[string]*list.Element{},
+		mux:   &sync.Mutex{},
+	}
+}
+
+// get returns the cached response for the URL, or nil if it's not cached.
+func (rc *responseCache) get(url string) *cachedResponse {
+	rc.mux.Lock()
+	defer rc.mux.Unlock()
+	e, ok := rc.items[url]
+	if !ok {
+		return nil
+	}
+	rc.lru.MoveToFront(e)
+	return e.Value.(*cachedResponse)
+}
+
+// put caches the response for the URL, replacing any cached response for it.
+func (rc *responseCache) put(url, etag string, body []byte) {
+	rc.mux.Lock()
+	defer rc.mux.Unlock()
+	r := &cachedResponse{url: url, etag: etag, body: body}
+	if e, ok := rc.items[url]; ok {
+		e.Value = r
+		rc.lru.MoveToFront(e)
+		return
+	}
+	rc.items[url] = rc.lru.PushFront(r)
+	if rc.lru.Len() > rc.max {
+		oldest := rc.lru.Back()
+		rc.lru.Remove(oldest)
+		delete(rc.items, oldest.Value.(*cachedResponse).url)
+	}
+}
+
+// remove removes the cached response for the URL, if any.
+func (rc *responseCache) remove(url string) {
+	rc.mux.Lock()
+	defer rc.mux.Unlock()
+	if e, ok := rc.items[url]; ok {
+		rc.lru.Remove(e)
+		delete(rc.items, url)
+	}
+}
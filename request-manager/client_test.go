@@ -157,6 +157,44 @@ func TestGetRequestSuccess(t *testing.T) {
 	}
 }
 
+func TestGetRequestETag(t *testing.T) {
+	// Server returns 304 if the client sends the current ETag
+	reqId := "abcd1234"
+	etag := `"v1"`
+	state := "1"
+	var ifNoneMatch []string
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ifNoneMatch = append(ifNoneMatch, r.Header.Get("If-None-Match"))
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		fmt.Fprintln(w, `{"id":"`+reqId+`","state":`+state+`}`)
+	}))
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	// 1st: 200, cached. 2nd: 304, cached response. 3rd: changed, 200.
+	for i, expectState := range []byte{proto.STATE_PENDING, proto.STATE_PENDING, proto.STATE_RUNNING} {
+		if i == 2 {
+			etag = `"v2"`
+			state = "2"
+		}
+		req, err := c.GetRequest(reqId)
+		if err != nil {
+			t.Fatalf("call %d: err = %s, expected nil", i+1, err)
+		}
+		if req.Id != reqId || req.State != expectState {
+			t.Errorf("call %d: got request %s state %d, expected %s state %d", i+1, req.Id, req.State, reqId, expectState)
+		}
+	}
+	if diff := deep.Equal(ifNoneMatch, []string{"", `"v1"`, `"v1"`}); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func TestFindRequestsSuccess(t *testing.T) {
 	setup(t, nil, http.StatusOK, "[{\"id\":\"blah\"}]")
 	defer cleanup()
@@ -297,13 +335,31 @@ func TestStopRequestError(t *testing.T) {
 	defer cleanup()
 	c := rm.NewClient(&http.Client{}, ts.URL)
 
-	err := c.StopRequest(reqId)
+	err := c.StopRequest(reqId, 0)
 	if err == nil {
 		t.Errorf("expected an error but did not get one")
 	}
 	ts.Close()
 }
 
+func TestStopRequestInvalidState(t *testing.T) {
+	reqId := "abcd1234"
+
+	// Request isn't running: 409, which isn't an API error
+	setup(t, nil, http.StatusConflict, `{"message":"request in state PENDING, expected state RUNNING","httpStatus":409}`)
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	err := c.StopRequest(reqId, 0)
+	perr, ok := err.(proto.Error)
+	if !ok {
+		t.Fatalf("got error %#v, expected a proto.Error", err)
+	}
+	if perr.HTTPStatus != http.StatusConflict {
+		t.Errorf("got HTTP status %d, expected %d", perr.HTTPStatus, http.StatusConflict)
+	}
+}
+
 func TestStopRequest(t *testing.T) {
 	reqId := "abcd1234"
 
@@ -311,7 +367,7 @@ func TestStopRequest(t *testing.T) {
 	defer cleanup()
 	c := rm.NewClient(&http.Client{}, ts.URL)
 
-	err := c.StopRequest(reqId)
+	err := c.StopRequest(reqId, 0)
 	if err != nil {
 		t.Errorf("err = %s, expected nil", err)
 	}
@@ -327,6 +383,190 @@ func TestStopRequest(t *testing.T) {
 	}
 }
 
+func TestSetRequestLogLevel(t *testing.T) {
+	reqId := "abcd1234"
+	var payload proto.RequestLogLevel
+
+	setup(t, &payload, http.StatusOK, "{\"level\":\"debug\",\"until\":\"2020-01-02T03:04:05Z\"}")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	ll, err := c.SetRequestLogLevel(reqId, proto.RequestLogLevel{Level: "debug"})
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(payload, proto.RequestLogLevel{Level: "debug"}); diff != nil {
+		t.Error(diff)
+	}
+	expect := proto.RequestLogLevel{Level: "debug", Until: time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)}
+	if diff := deep.Equal(ll, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	expectedPath := "/api/v1/requests/" + reqId + "/log-level"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if method != "PUT" {
+		t.Errorf("request method = %s, expected PUT", method)
+	}
+}
+
+func TestFinalizeRequest(t *testing.T) {
+	reqId := "abcd1234"
+	var payload proto.FinalizeRequest
+
+	setup(t, &payload, http.StatusOK, "{\"id\":\"abcd1234\",\"state\":4}")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	f := proto.FinalizeRequest{State: proto.STATE_FAIL, Reason: "jr1 lost"}
+	req, err := c.FinalizeRequest(reqId, f)
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(payload, f); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(req, proto.Request{Id: reqId, State: proto.STATE_FAIL}); diff != nil {
+		t.Error(diff)
+	}
+
+	expectedPath := "/api/v1/requests/" + reqId + "/finalize"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if method != "PUT" {
+		t.Errorf("request method = %s, expected PUT", method)
+	}
+}
+
+func TestSetResumePoints(t *testing.T) {
+	reqId := "abcd1234"
+	var payload proto.ResumePoints
+
+	setup(t, &payload, http.StatusOK, "{\"requestId\":\"abcd1234\",\"finishedJobs\":1}")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	rp := proto.ResumePoints{Jobs: map[string]string{"j1": proto.RESUME_SKIP}}
+	jc, err := c.SetResumePoints(reqId, rp)
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(payload, rp); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(jc, proto.JobChain{RequestId: reqId, FinishedJobs: 1}); diff != nil {
+		t.Error(diff)
+	}
+
+	expectedPath := "/api/v1/requests/" + reqId + "/resume-points"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if method != "PUT" {
+		t.Errorf("request method = %s, expected PUT", method)
+	}
+}
+
+func TestCreateRequestGroupSuccess(t *testing.T) {
+	var payload proto.CreateRequestGroup
+
+	setup(t, &payload, http.StatusCreated, "{\"id\":\"g1\",\"name\":\"migrate\"}")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	cg := proto.CreateRequestGroup{
+		Name: "migrate",
+		Requests: []proto.CreateRequest{
+			{Type: "something", Args: map[string]interface{}{"arg1": "val1"}},
+		},
+	}
+	g, err := c.CreateRequestGroup(cg)
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(payload, cg); diff != nil {
+		t.Error(diff)
+	}
+	if g.Id != "g1" {
+		t.Errorf("group id = %s, expected g1", g.Id)
+	}
+
+	expectedPath := "/api/v1/request-groups"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if method != "POST" {
+		t.Errorf("request method = %s, expected POST", method)
+	}
+}
+
+func TestCreateRequestBulk(t *testing.T) {
+	var payload proto.CreateRequestBulk
+
+	setup(t, &payload, http.StatusOK, "{\"groupId\":\"g1\",\"mode\":\"best-effort\",\"created\":1,\"failed\":1}")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	cb := proto.CreateRequestBulk{
+		Mode: proto.BULK_BEST_EFFORT,
+		Requests: []proto.CreateRequest{
+			{Type: "something", Args: map[string]interface{}{"arg1": "val1"}},
+			{Type: "something", Args: map[string]interface{}{"arg1": "val2"}},
+		},
+	}
+	r, err := c.CreateRequestBulk(cb)
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(payload, cb); diff != nil {
+		t.Error(diff)
+	}
+	if r.GroupId != "g1" || r.Created != 1 || r.Failed != 1 {
+		t.Errorf("got %+v, expected group g1, 1 created, 1 failed", r)
+	}
+
+	expectedPath := "/api/v1/requests/bulk"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if method != "POST" {
+		t.Errorf("request method = %s, expected POST", method)
+	}
+}
+
+func TestStopRequestGroup(t *testing.T) {
+	setup(t, nil, http.StatusOK, "")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	err := c.StopRequestGroup("g1", 5*time.Minute)
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	ts.Close()
+
+	expectedPath := "/api/v1/request-groups/g1/stop"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if queryString != "timeout=5m0s" {
+		t.Errorf("query = %s, expected timeout=5m0s", queryString)
+	}
+
+	if method != "PUT" {
+		t.Errorf("request method = %s, expected PUT", method)
+	}
+}
+
 func TestSuspendRequestError(t *testing.T) {
 	reqId := "abcd1234"
 	sjc := proto.SuspendedJobChain{
@@ -391,6 +631,72 @@ func TestSuspendRequest(t *testing.T) {
 	}
 }
 
+func TestSuspendRequestProtobuf(t *testing.T) {
+	proto.SetChainFormat(proto.CHAIN_FORMAT_PROTOBUF)
+	defer proto.SetChainFormat(proto.CHAIN_FORMAT_JSON)
+
+	reqId := "abcd1234"
+	sjc := proto.SuspendedJobChain{
+		RequestId: reqId,
+		JobChain: &proto.JobChain{
+			RequestId: reqId,
+			Jobs: map[string]proto.Job{
+				"job1": {Id: "job1", Data: map[string]interface{}{"data1": "val1"}},
+			},
+		},
+		TotalJobTries:     map[string]uint{"job1": 1},
+		LatestRunJobTries: map[string]uint{"job1": 1},
+		SequenceTries:     map[string]uint{"job1": 1},
+	}
+
+	// Old RM that does not support protobuf (like Echo): 415, then JSON
+	var contentTypes []string
+	var payload proto.SuspendedJobChain
+	supported := false
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		contentTypes = append(contentTypes, r.Header.Get("Content-Type"))
+		if r.Header.Get("Content-Type") == proto.CONTENT_TYPE_PROTOBUF && !supported {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			fmt.Fprintln(w, `{"message":"Unsupported Media Type"}`)
+			return
+		}
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload = proto.SuspendedJobChain{}
+		if err := proto.DecodeSuspendedJobChain(body, &payload); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	if err := c.SuspendRequest(reqId, sjc); err != nil {
+		t.Fatalf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(contentTypes, []string{proto.CONTENT_TYPE_PROTOBUF, proto.CONTENT_TYPE_JSON}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(payload, sjc); diff != nil {
+		t.Error(diff)
+	}
+
+	// RM that supports protobuf
+	supported = true
+	contentTypes = nil
+	if err := c.SuspendRequest(reqId, sjc); err != nil {
+		t.Fatalf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(contentTypes, []string{proto.CONTENT_TYPE_PROTOBUF}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(payload, sjc); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func TestGetJobChainError(t *testing.T) {
 	reqId := "abcd1234"
 
@@ -473,6 +779,14 @@ func TestGetJLSuccess(t *testing.T) {
 		t.Error(diff)
 	}
 
+	jl, err = c.GetJLWithFilter(reqId, proto.JobLogFilter{ErrorsOnly: true, NoOutput: true})
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if queryString != "errorsOnly=true&noOutput=true" {
+		t.Errorf("query = %s, expected errorsOnly=true&noOutput=true", queryString)
+	}
+
 	expectedPath := "/api/v1/requests/" + reqId + "/log"
 	if path != expectedPath {
 		t.Errorf("url path = %s, expected %s", path, expectedPath)
@@ -533,3 +847,69 @@ func TestCreateJLSuccess(t *testing.T) {
 		t.Errorf("request method = %s, expected POST", method)
 	}
 }
+
+func TestCreateJLBatch(t *testing.T) {
+	var payload []proto.JobLog
+
+	setup(t, &payload, http.StatusOK, "[{\"created\":true},{\"created\":false,\"error\":{\"message\":\"request req2 not found\",\"requestId\":\"req2\",\"httpStatus\":404}}]")
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	jls := []proto.JobLog{
+		{RequestId: "req1", JobId: "job1", Try: 1},
+		{RequestId: "req2", JobId: "job1", Try: 1},
+	}
+	results, err := c.CreateJLBatch(jls)
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	if diff := deep.Equal(payload, jls); diff != nil {
+		t.Error(diff)
+	}
+	expect := []proto.JobLogResult{
+		{Created: true},
+		{Error: &proto.Error{Message: "request req2 not found", RequestId: "req2", HTTPStatus: http.StatusNotFound}},
+	}
+	if diff := deep.Equal(results, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	expectedPath := "/api/v1/job-logs"
+	if path != expectedPath {
+		t.Errorf("url path = %s, expected %s", path, expectedPath)
+	}
+
+	if method != "POST" {
+		t.Errorf("request method = %s, expected POST", method)
+	}
+}
+
+func TestSLOStatus(t *testing.T) {
+	respBody := `{"type":"restart","slo":{"successRate":0.99},"windows":[{"window":"1h","finished":10,"complete":9,"successRate":0.9,"burnRate":10,"burning":true}],"burning":true}`
+
+	setup(t, nil, http.StatusOK, respBody)
+	defer cleanup()
+	c := rm.NewClient(&http.Client{}, ts.URL)
+
+	s, err := c.SLOStatus("restart")
+	if err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+	expect := proto.SLOStatus{
+		Type: "restart",
+		SLO:  proto.SLO{SuccessRate: 0.99},
+		Windows: []proto.SLOWindow{
+			{Window: "1h", Finished: 10, Complete: 9, SuccessRate: 0.9, BurnRate: 10, Burning: true},
+		},
+		Burning: true,
+	}
+	if diff := deep.Equal(s, expect); diff != nil {
+		t.Error(diff)
+	}
+	if path != "/api/v1/slo/restart" {
+		t.Errorf("url path = %s, expected /api/v1/slo/restart", path)
+	}
+	if method != "GET" {
+		t.Errorf("request method = %s, expected GET", method)
+	}
+}
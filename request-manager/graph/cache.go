@@ -0,0 +1,191 @@
+// Copyright 2020, Square, Inc.
+
+package graph
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// TemplateVersion returns the content hash of the sequence specs, which is the
+// version of the sequence graphs (templates) built from them. Unlike Specs.Version,
+// which can be user-provided, it changes if and only if the processed specs change,
+// including environment overrides and namespaces applied when they're loaded.
+func TemplateVersion(seqSpecs map[string]*spec.Sequence) string {
+	bytes, err := json.Marshal(seqSpecs) // map keys are sorted, so it's deterministic
+	if err != nil {
+		return "" // can't happen: specs are plain data
+	}
+	hash := sha1.Sum(bytes)
+	return hex.EncodeToString(hash[:])
+}
+
+// TemplateCache caches sequence graphs (templates), keyed on TemplateVersion, so
+// the Request Manager doesn't rebuild them when the specs haven't changed. Graphs
+// are cached in memory and, if a directory is given, in one file per version in
+// the directory, so they're reused after a restart. It is safe to use concurrently.
+//
+// Cached graphs must not be modified; the Resolver only reads them.
+type TemplateCache struct {
+	dir    string
+	graphs map[string]map[string]*Graph // version -> sequence name -> graph
+	*sync.Mutex
+}
+
+// NewTemplateCache returns a TemplateCache that saves graphs in dir, or only
+// in memory if dir is empty.
+func NewTemplateCache(dir string) *TemplateCache {
+	return &TemplateCache{
+		dir:    dir,
+		graphs: map[string]map[string]*Graph{},
+		Mutex:  &sync.Mutex{},
+	}
+}
+
+// Get returns the sequence graphs for the version, if cached. A cache file that
+// cannot be read or is for another version is ignored (a cache miss).
+func (c *TemplateCache) Get(version string) (map[string]*Graph, bool) {
+	c.Lock()
+	defer c.Unlock()
+	if graphs, ok := c.graphs[version]; ok {
+		return graphs, true
+	}
+	if c.dir == "" || version == "" {
+		return nil, false
+	}
+	bytes, err := ioutil.ReadFile(c.file(version))
+	if err != nil {
+		return nil, false
+	}
+	var cf cacheFile
+	if err := json.Unmarshal(bytes, &cf); err != nil || cf.Version != version {
+		return nil, false
+	}
+	graphs := make(map[string]*Graph, len(cf.Graphs))
+	for name, cg := range cf.Graphs {
+		g, err := cg.graph()
+		if err != nil {
+			return nil, false
+		}
+		graphs[name] = g
+	}
+	c.graphs[version] = graphs
+	return graphs, true
+}
+
+// Put caches the sequence graphs for the version. The graphs are cached in memory
+// even if an error is returned, which means they couldn't be saved in the cache
+// directory.
+func (c *TemplateCache) Put(version string, graphs map[string]*Graph) error {
+	c.Lock()
+	defer c.Unlock()
+	c.graphs[version] = graphs
+	if c.dir == "" || version == "" {
+		return nil
+	}
+	cf := cacheFile{
+		Version: version,
+		Graphs:  make(map[string]cachedGraph, len(graphs)),
+	}
+	for name, g := range graphs {
+		cf.Graphs[name] = newCachedGraph(g)
+	}
+	bytes, err := json.Marshal(cf)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return err
+	}
+	// Write then rename so another Request Manager sharing the directory never
+	// reads a partial file
+	tmp, err := ioutil.TempFile(c.dir, ".tmp-"+version)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(bytes); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), c.file(version))
+}
+
+func (c *TemplateCache) file(version string) string {
+	return filepath.Join(c.dir, version+".json")
+}
+
+// --------------------------------------------------------------------------
+
+// cacheFile is the contents of a cache file. The version is saved in the file,
+// too, so a renamed or copied file isn't mistaken for another version.
+type cacheFile struct {
+	Version string                 `json:"version"`
+	Graphs  map[string]cachedGraph `json:"graphs"`
+}
+
+// cachedGraph is a Graph with node pointers (Source, Sink, and Order) saved as
+// node IDs, so nodes are saved once and the pointers are restored when loaded.
+type cachedGraph struct {
+	Name     string              `json:"name"`
+	Source   string              `json:"source"`
+	Sink     string              `json:"sink"`
+	Nodes    map[string]*Node    `json:"nodes"`
+	Edges    map[string][]string `json:"edges"`
+	RevEdges map[string][]string `json:"revEdges"`
+	Order    []string            `json:"order"`
+}
+
+func newCachedGraph(g *Graph) cachedGraph {
+	cg := cachedGraph{
+		Name:     g.Name,
+		Nodes:    g.Nodes,
+		Edges:    g.Edges,
+		RevEdges: g.RevEdges,
+		Order:    make([]string, len(g.Order)),
+	}
+	if g.Source != nil {
+		cg.Source = g.Source.Id
+	}
+	if g.Sink != nil {
+		cg.Sink = g.Sink.Id
+	}
+	for i, n := range g.Order {
+		cg.Order[i] = n.Id
+	}
+	return cg
+}
+
+func (cg cachedGraph) graph() (*Graph, error) {
+	g := &Graph{
+		Name:     cg.Name,
+		Source:   cg.Nodes[cg.Source],
+		Sink:     cg.Nodes[cg.Sink],
+		Nodes:    cg.Nodes,
+		Edges:    cg.Edges,
+		RevEdges: cg.RevEdges,
+		Order:    make([]*Node, len(cg.Order)),
+	}
+	if g.Source == nil || g.Sink == nil {
+		return nil, fmt.Errorf("graph %s: source or sink node not found", cg.Name)
+	}
+	for i, id := range cg.Order {
+		n, ok := cg.Nodes[id]
+		if !ok {
+			return nil, fmt.Errorf("graph %s: node %s in order not found", cg.Name, id)
+		}
+		g.Order[i] = n
+	}
+	return g, nil
+}
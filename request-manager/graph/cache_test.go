@@ -0,0 +1,115 @@
+// Copyright 2020, Square, Inc.
+
+package graph_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	. "github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/spec"
+	rmtest "github.com/square/spincycle/v2/request-manager/test"
+)
+
+func templateVersion(t *testing.T, sequencesFile string) string {
+	specs, result := spec.ParseSpec(rmtest.SpecPath + "/" + sequencesFile)
+	if len(result.Errors) != 0 {
+		t.Fatal(result.Errors)
+	}
+	spec.ProcessSpecs(&specs)
+	return TemplateVersion(specs.Sequences)
+}
+
+func TestTemplateVersion(t *testing.T) {
+	v1 := templateVersion(t, "a-b-c.yaml")
+	if v1 == "" {
+		t.Fatal("template version is empty")
+	}
+	if v := templateVersion(t, "a-b-c.yaml"); v != v1 {
+		t.Errorf("template version of same specs = %s, expected %s", v, v1)
+	}
+	if v := templateVersion(t, "a-b-c-changed.yaml"); v == v1 {
+		t.Errorf("template version of changed specs = %s, expected a different version", v)
+	}
+}
+
+func TestTemplateCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spincycle-template-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	graphs, results := MakeGrapher(t, "a-b-c.yaml").CheckSequences()
+	if results.AnyError {
+		t.Fatalf("specs failed graph checks: %+v", results)
+	}
+	version := templateVersion(t, "a-b-c.yaml")
+
+	cache := NewTemplateCache(dir)
+	if _, ok := cache.Get(version); ok {
+		t.Fatal("cache hit before Put, expected a miss")
+	}
+	if err := cache.Put(version, graphs); err != nil {
+		t.Fatal(err)
+	}
+
+	// New cache, like after a restart, loads the graphs from the cache dir
+	cache = NewTemplateCache(dir)
+	got, ok := cache.Get(version)
+	if !ok {
+		t.Fatal("cache miss after Put, expected a hit")
+	}
+	if diff := deep.Equal(got, graphs); diff != nil {
+		t.Error(diff)
+	}
+	for name, g := range got {
+		if g.Source != g.Nodes[g.Source.Id] || g.Sink != g.Nodes[g.Sink.Id] {
+			t.Errorf("graph %s: source or sink is not a node in the graph", name)
+		}
+		for _, n := range g.Order {
+			if n != g.Nodes[n.Id] {
+				t.Errorf("graph %s: node %s in order is not a node in the graph", name, n.Id)
+			}
+		}
+	}
+
+	// Another version isn't cached
+	if _, ok := cache.Get(templateVersion(t, "a-b-c-changed.yaml")); ok {
+		t.Error("cache hit for another version, expected a miss")
+	}
+}
+
+func TestTemplateCacheWrongVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spincycle-template-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	graphs, results := MakeGrapher(t, "a-b-c.yaml").CheckSequences()
+	if results.AnyError {
+		t.Fatalf("specs failed graph checks: %+v", results)
+	}
+	if err := NewTemplateCache(dir).Put("v1", graphs); err != nil {
+		t.Fatal(err)
+	}
+
+	// A cache file copied to another version, or a corrupt file, is a miss
+	if err := os.Rename(filepath.Join(dir, "v1.json"), filepath.Join(dir, "v2.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "v3.json"), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cache := NewTemplateCache(dir)
+	for _, version := range []string{"v1", "v2", "v3"} {
+		if _, ok := cache.Get(version); ok {
+			t.Errorf("cache hit for %s, expected a miss", version)
+		}
+	}
+}
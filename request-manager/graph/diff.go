@@ -0,0 +1,173 @@
+// Copyright 2020, Square, Inc.
+
+package graph
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SequenceDiff is the difference between two versions of a sequence graph, like
+// the sequence in the specs before and after a change. Nodes are compared by name.
+// A sequence only in the old version is Removed, and a sequence only in the new
+// version is Added; their nodes are not listed.
+type SequenceDiff struct {
+	Sequence     string
+	Added        bool
+	Removed      bool
+	NodesAdded   []string   // names of nodes only in the new version
+	NodesRemoved []string   // names of nodes only in the old version
+	NodesChanged []NodeDiff // nodes in both versions that changed
+}
+
+// NodeDiff is one changed field of a node in both versions of a sequence graph.
+type NodeDiff struct {
+	Node  string // node name
+	Field string // NODE_FIELD_*
+	Old   string
+	New   string
+}
+
+// Node fields compared by DiffSequences, in the order they're reported.
+const (
+	NODE_FIELD_TYPE       = "type"      // category and type, like "job restart-mysql"
+	NODE_FIELD_DEPS       = "deps"      // dependencies in the graph, sorted by name
+	NODE_FIELD_RETRY      = "retry"     // job retry count
+	NODE_FIELD_RETRY_WAIT = "retryWait" // job retry wait
+)
+
+// Empty returns true if there are no differences.
+func (d SequenceDiff) Empty() bool {
+	return !d.Added && !d.Removed && len(d.NodesAdded) == 0 && len(d.NodesRemoved) == 0 && len(d.NodesChanged) == 0
+}
+
+// DiffSequences compares old and new sequence graphs, keyed on sequence name
+// (as returned by Grapher.CheckSequences), and returns the differences of every
+// sequence that changed, sorted by sequence name. It returns an empty slice if
+// no sequence changed.
+func DiffSequences(oldGraphs, newGraphs map[string]*Graph) []SequenceDiff {
+	names := map[string]bool{}
+	for name := range oldGraphs {
+		names[name] = true
+	}
+	for name := range newGraphs {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	diffs := []SequenceDiff{}
+	for _, name := range sorted {
+		oldGraph, inOld := oldGraphs[name]
+		newGraph, inNew := newGraphs[name]
+		var d SequenceDiff
+		switch {
+		case !inOld:
+			d = SequenceDiff{Sequence: name, Added: true}
+		case !inNew:
+			d = SequenceDiff{Sequence: name, Removed: true}
+		default:
+			d = diffSequence(name, oldGraph, newGraph)
+		}
+		if !d.Empty() {
+			diffs = append(diffs, d)
+		}
+	}
+	return diffs
+}
+
+// diffSequence compares the nodes of one sequence graph, ignoring the source and
+// sink nodes added by the Grapher.
+func diffSequence(name string, oldGraph, newGraph *Graph) SequenceDiff {
+	d := SequenceDiff{
+		Sequence:     name,
+		NodesAdded:   []string{},
+		NodesRemoved: []string{},
+		NodesChanged: []NodeDiff{},
+	}
+	oldNodes := specNodes(oldGraph)
+	newNodes := specNodes(newGraph)
+
+	for _, nodeName := range sortedKeys(oldNodes) {
+		if _, ok := newNodes[nodeName]; !ok {
+			d.NodesRemoved = append(d.NodesRemoved, nodeName)
+		}
+	}
+
+	for _, nodeName := range sortedKeys(newNodes) {
+		newNode := newNodes[nodeName]
+		oldNode, ok := oldNodes[nodeName]
+		if !ok {
+			d.NodesAdded = append(d.NodesAdded, nodeName)
+			continue
+		}
+		fields := []struct {
+			field    string
+			old, new string
+		}{
+			{NODE_FIELD_TYPE, nodeType(oldNode), nodeType(newNode)},
+			{NODE_FIELD_DEPS, nodeDeps(oldGraph, oldNode), nodeDeps(newGraph, newNode)},
+			{NODE_FIELD_RETRY, fmt.Sprintf("%d", oldNode.Spec.Retry), fmt.Sprintf("%d", newNode.Spec.Retry)},
+			{NODE_FIELD_RETRY_WAIT, oldNode.Spec.RetryWait, newNode.Spec.RetryWait},
+		}
+		for _, f := range fields {
+			if f.old != f.new {
+				d.NodesChanged = append(d.NodesChanged, NodeDiff{Node: nodeName, Field: f.field, Old: f.old, New: f.new})
+			}
+		}
+	}
+
+	return d
+}
+
+// specNodes returns the nodes of a sequence graph keyed on name, without the
+// source and sink nodes.
+func specNodes(g *Graph) map[string]*Node {
+	nodes := map[string]*Node{}
+	for id, n := range g.Nodes {
+		if id == g.Source.Id || id == g.Sink.Id {
+			continue
+		}
+		nodes[n.Name] = n
+	}
+	return nodes
+}
+
+// nodeType returns the node category and type, like "job restart-mysql".
+func nodeType(n *Node) string {
+	category, nodeType := "", ""
+	if n.Spec.Category != nil {
+		category = *n.Spec.Category
+	}
+	if n.Spec.NodeType != nil {
+		nodeType = *n.Spec.NodeType
+	}
+	return strings.TrimSpace(category + " " + nodeType)
+}
+
+// nodeDeps returns the names of the previous nodes in the graph, sorted and
+// comma-separated, or "" if the node only depends on the source node.
+func nodeDeps(g *Graph, n *Node) string {
+	deps := []string{}
+	for _, prev := range g.GetPrev(n) {
+		if prev.Id == g.Source.Id {
+			continue
+		}
+		deps = append(deps, prev.Name)
+	}
+	sort.Strings(deps)
+	return strings.Join(deps, ", ")
+}
+
+func sortedKeys(nodes map[string]*Node) []string {
+	keys := make([]string, 0, len(nodes))
+	for k := range nodes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,54 @@
+// Copyright 2020, Square, Inc.
+
+package graph_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	. "github.com/square/spincycle/v2/request-manager/graph"
+)
+
+func TestDiffSequences(t *testing.T) {
+	oldGraphs, results := MakeGrapher(t, "a-b-c.yaml").CheckSequences()
+	if results.AnyError {
+		t.Fatalf("old specs failed graph checks: %+v", results)
+	}
+	newGraphs, results := MakeGrapher(t, "a-b-c-changed.yaml").CheckSequences()
+	if results.AnyError {
+		t.Fatalf("new specs failed graph checks: %+v", results)
+	}
+
+	got := DiffSequences(oldGraphs, newGraphs)
+	expect := []SequenceDiff{
+		{
+			Sequence: "one-node",
+			Added:    true,
+		},
+		{
+			Sequence: "retry-three-nodes",
+			Removed:  true,
+		},
+		{
+			Sequence:     "three-nodes",
+			NodesAdded:   []string{"d"},
+			NodesRemoved: []string{"b"},
+			NodesChanged: []NodeDiff{
+				{Node: "a", Field: NODE_FIELD_RETRY, Old: "1", New: "4"},
+				{Node: "a", Field: NODE_FIELD_RETRY_WAIT, Old: "500ms", New: "1s"},
+				{Node: "c", Field: NODE_FIELD_TYPE, Old: "job cJobType", New: "job cJobTypeV2"},
+				{Node: "c", Field: NODE_FIELD_DEPS, Old: "b", New: "a"},
+			},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Same specs, no differences
+	got = DiffSequences(oldGraphs, oldGraphs)
+	if len(got) != 0 {
+		t.Errorf("got %d diffs comparing same graphs, expected 0: %+v", len(got), got)
+	}
+}
@@ -0,0 +1,402 @@
+// Copyright 2020, Square, Inc.
+
+package graph
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+// Export formats of a DAG, for comparing job chains and sequence graphs with
+// other workflow systems, visualizing them in external tools, and migrating
+// requests gradually.
+const (
+	EXPORT_FORMAT_ARGO = "argo" // Argo Workflows Workflow (YAML)
+	EXPORT_FORMAT_DAG  = "dag"  // DAG (JSON)
+)
+
+// Kinds of DAG.
+const (
+	DAG_KIND_CHAIN    = "chain"    // job chain of a request
+	DAG_KIND_TEMPLATE = "template" // sequence graph built from the specs
+)
+
+// ARGO_IMAGE is the container image of every Argo template. Spin Cycle jobs
+// are Go code, not containers, so it's a placeholder: to run the workflow in
+// Argo, replace it with an image that runs a job, given its category and type
+// as args, like "job stop-app".
+const ARGO_IMAGE = "spincycle-job"
+
+// DAG is a job chain or sequence graph in a generic format that's independent
+// of Spin Cycle internals. Nodes are in topological order: every node is after
+// its deps. Nodes that are ready at the same time are sorted by name, then ID,
+// so a DAG is exported the same way every time.
+type DAG struct {
+	Name  string    `json:"name"` // request type (chain) or sequence name (template)
+	Kind  string    `json:"kind"` // DAG_KIND_*
+	Nodes []DAGNode `json:"nodes"`
+	Edges []DAGEdge `json:"edges"`
+
+	RequestId string `json:"requestId,omitempty"` // chain only
+}
+
+// DAGNode is a job (chain) or node spec (template).
+type DAGNode struct {
+	Id        string                 `json:"id"`
+	Name      string                 `json:"name"`
+	Category  string                 `json:"category"` // job, sequence, or conditional
+	Type      string                 `json:"type"`     // job type or sequence name
+	Deps      []string               `json:"deps"`     // node IDs, sorted
+	Retry     uint                   `json:"retry,omitempty"`
+	RetryWait string                 `json:"retryWait,omitempty"`
+	State     string                 `json:"state,omitempty"` // chain only
+	Args      map[string]interface{} `json:"args,omitempty"`  // chain only
+}
+
+// DAGEdge is a directed edge: From is a dep of To.
+type DAGEdge struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// ChainDAG returns the DAG of a job chain. Every job is a node, including the
+// noop jobs at the start and end of sequences.
+func ChainDAG(jc proto.JobChain) DAG {
+	nodes := make(map[string]DAGNode, len(jc.Jobs))
+	for id, job := range jc.Jobs {
+		nodes[id] = DAGNode{
+			Id:        id,
+			Name:      job.Name,
+			Category:  "job",
+			Type:      job.Type,
+			Retry:     job.Retry,
+			RetryWait: job.RetryWait,
+			State:     proto.StateName[job.State],
+			Args:      job.Args,
+		}
+	}
+	name := jc.RequestType
+	if name == "" { // chains from before RequestType was set
+		name = jc.RequestId
+	}
+	dag := newDAG(name, DAG_KIND_CHAIN, nodes, jc.AdjacencyList)
+	dag.RequestId = jc.RequestId
+	return dag
+}
+
+// TemplateDAG returns the DAG of a sequence graph, as returned by
+// Grapher.CheckSequences. Sequence and conditional nodes are not expanded.
+// The source and sink nodes added by the Grapher are not included. Node IDs
+// are node names, which are unique in a sequence, not the random IDs from the
+// Grapher, so the DAG of a sequence is the same until its spec changes.
+func TemplateDAG(g *Graph) DAG {
+	nodes := make(map[string]DAGNode, len(g.Nodes))
+	for id, n := range g.Nodes {
+		if id == g.Source.Id || id == g.Sink.Id {
+			continue
+		}
+		dn := DAGNode{
+			Id:        n.Name,
+			Name:      n.Name,
+			Retry:     n.Spec.Retry,
+			RetryWait: n.Spec.RetryWait,
+		}
+		if n.Spec.Category != nil {
+			dn.Category = *n.Spec.Category
+		}
+		if n.Spec.NodeType != nil {
+			dn.Type = *n.Spec.NodeType
+		}
+		nodes[n.Name] = dn
+	}
+	edges := make(map[string][]string, len(g.Edges))
+	for from, next := range g.Edges {
+		for _, to := range next {
+			edges[g.Nodes[from].Name] = append(edges[g.Nodes[from].Name], g.Nodes[to].Name)
+		}
+	}
+	return newDAG(g.Name, DAG_KIND_TEMPLATE, nodes, edges)
+}
+
+// newDAG returns a DAG of the nodes in topological order with the edges
+// between them. Edges to or from other nodes are ignored.
+func newDAG(name, kind string, nodes map[string]DAGNode, edges map[string][]string) DAG {
+	dag := DAG{
+		Name:  name,
+		Kind:  kind,
+		Nodes: make([]DAGNode, 0, len(nodes)),
+		Edges: []DAGEdge{},
+	}
+	indegree := map[string]int{}
+	for from, next := range edges {
+		if _, ok := nodes[from]; !ok {
+			continue
+		}
+		for _, to := range next {
+			n, ok := nodes[to]
+			if !ok {
+				continue
+			}
+			n.Deps = append(n.Deps, from)
+			nodes[to] = n
+			indegree[to]++
+			dag.Edges = append(dag.Edges, DAGEdge{From: from, To: to})
+		}
+	}
+
+	less := func(a, b string) bool {
+		if nodes[a].Name != nodes[b].Name {
+			return nodes[a].Name < nodes[b].Name
+		}
+		return a < b
+	}
+	ready := []string{}
+	for id := range nodes {
+		if indegree[id] == 0 {
+			ready = append(ready, id)
+		}
+	}
+	for len(ready) > 0 {
+		sort.Slice(ready, func(i, j int) bool { return less(ready[i], ready[j]) })
+		id := ready[0]
+		ready = ready[1:]
+		n := nodes[id]
+		if n.Deps == nil {
+			n.Deps = []string{}
+		}
+		sort.Strings(n.Deps)
+		dag.Nodes = append(dag.Nodes, n)
+		for _, to := range edges[id] {
+			if _, ok := nodes[to]; !ok {
+				continue
+			}
+			indegree[to]--
+			if indegree[to] == 0 {
+				ready = append(ready, to)
+			}
+		}
+	}
+
+	sort.Slice(dag.Edges, func(i, j int) bool {
+		if dag.Edges[i].From != dag.Edges[j].From {
+			return dag.Edges[i].From < dag.Edges[j].From
+		}
+		return dag.Edges[i].To < dag.Edges[j].To
+	})
+	return dag
+}
+
+// Export returns the DAG in the EXPORT_FORMAT_*.
+func Export(dag DAG, format string) ([]byte, error) {
+	switch format {
+	case EXPORT_FORMAT_DAG:
+		return json.MarshalIndent(dag, "", "  ")
+	case EXPORT_FORMAT_ARGO:
+		return yaml.Marshal(argoWorkflow(dag))
+	}
+	return nil, fmt.Errorf("invalid export format: %s (expected %s or %s)", format, EXPORT_FORMAT_ARGO, EXPORT_FORMAT_DAG)
+}
+
+// ExportContentType returns the HTTP content type of the EXPORT_FORMAT_*.
+func ExportContentType(format string) string {
+	if format == EXPORT_FORMAT_ARGO {
+		return "application/yaml"
+	}
+	return "application/json"
+}
+
+// --------------------------------------------------------------------------
+// Argo Workflows
+// --------------------------------------------------------------------------
+
+// argoWorkflow returns the DAG as an Argo Workflows Workflow: the entrypoint
+// template is a DAG with a task per node, and each task has its own container
+// template, which has the node retry and job args.
+func argoWorkflow(dag DAG) argoObject {
+	annotations := map[string]string{
+		"spincycle/kind": dag.Kind,
+		"spincycle/name": dag.Name,
+	}
+	if dag.RequestId != "" {
+		annotations["spincycle/request-id"] = dag.RequestId
+	}
+	w := argoObject{
+		APIVersion: "argoproj.io/v1alpha1",
+		Kind:       "Workflow",
+		Metadata: argoMetadata{
+			GenerateName: argoName(dag.Name, 57) + "-", // Argo appends 5 random characters
+			Annotations:  annotations,
+		},
+		Spec: argoSpec{
+			Entrypoint: "main",
+		},
+	}
+
+	taskNames := make(map[string]string, len(dag.Nodes)) // node ID --> task name
+	used := map[string]bool{}
+	for _, n := range dag.Nodes {
+		name := argoTaskName(n)
+		for i := 2; used[name]; i++ { // names that differ only in invalid characters
+			name = fmt.Sprintf("%s-%d", argoTaskName(n), i)
+		}
+		used[name] = true
+		taskNames[n.Id] = name
+	}
+	main := argoTemplate{Name: "main", DAG: &argoDAG{}}
+	templates := make([]argoTemplate, 0, len(dag.Nodes))
+	for _, n := range dag.Nodes {
+		task := argoTask{
+			Name:     taskNames[n.Id],
+			Template: taskNames[n.Id],
+		}
+		for _, dep := range n.Deps {
+			task.Dependencies = append(task.Dependencies, taskNames[dep])
+		}
+		main.DAG.Tasks = append(main.DAG.Tasks, task)
+
+		t := argoTemplate{
+			Name: taskNames[n.Id],
+			Metadata: &argoMetadata{
+				Annotations: map[string]string{
+					"spincycle/id":   n.Id,
+					"spincycle/name": n.Name,
+				},
+			},
+			Container: &argoContainer{
+				Image: ARGO_IMAGE,
+				Args:  []string{n.Category, n.Type},
+			},
+		}
+		if n.Retry > 0 {
+			t.RetryStrategy = &argoRetryStrategy{Limit: n.Retry}
+			if n.RetryWait != "" {
+				t.RetryStrategy.Backoff = &argoBackoff{Duration: n.RetryWait}
+			}
+		}
+		if len(n.Args) > 0 {
+			t.Inputs = &argoInputs{}
+			for _, k := range sortedArgs(n.Args) {
+				t.Inputs.Parameters = append(t.Inputs.Parameters, argoParameter{Name: k, Default: argoValue(n.Args[k])})
+			}
+		}
+		templates = append(templates, t)
+	}
+	w.Spec.Templates = append([]argoTemplate{main}, templates...)
+	return w
+}
+
+var argoInvalid = regexp.MustCompile(`[^a-z0-9-]+`)
+
+// argoName returns s as a valid Argo name: lowercase letters, numbers, and
+// hyphens, starting with a letter, at most max characters.
+func argoName(s string, max int) string {
+	s = strings.Trim(argoInvalid.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if s == "" || s[0] < 'a' || s[0] > 'z' {
+		s = "x-" + s
+	}
+	if len(s) > max {
+		s = strings.TrimRight(s[:max], "-")
+	}
+	return s
+}
+
+// argoTaskName returns the Argo task and template name of the node: its name
+// and ID, which makes it unique, at most 63 characters. If it's too long, the
+// name is truncated, not the ID. Template nodes are named by their name only
+// because their ID is their name.
+func argoTaskName(n DAGNode) string {
+	if n.Id == n.Name {
+		return argoName(n.Name, 60) // room for a -N suffix if not unique
+	}
+	id := strings.Trim(argoInvalid.ReplaceAllString(strings.ToLower(n.Id), "-"), "-")
+	return argoName(n.Name, 63-len(id)-1) + "-" + id
+}
+
+// argoValue returns the job arg value as an Argo parameter value: strings as is,
+// other values JSON-encoded.
+func argoValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprintf("%v", v)
+	}
+	return string(bytes)
+}
+
+func sortedArgs(args map[string]interface{}) []string {
+	keys := make([]string, 0, len(args))
+	for k := range args {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// The subset of the Argo Workflows Workflow spec used by argoWorkflow.
+type argoObject struct {
+	APIVersion string       `yaml:"apiVersion"`
+	Kind       string       `yaml:"kind"`
+	Metadata   argoMetadata `yaml:"metadata"`
+	Spec       argoSpec     `yaml:"spec"`
+}
+
+type argoMetadata struct {
+	GenerateName string            `yaml:"generateName,omitempty"`
+	Annotations  map[string]string `yaml:"annotations,omitempty"`
+}
+
+type argoSpec struct {
+	Entrypoint string         `yaml:"entrypoint"`
+	Templates  []argoTemplate `yaml:"templates"`
+}
+
+type argoTemplate struct {
+	Name          string             `yaml:"name"`
+	Metadata      *argoMetadata      `yaml:"metadata,omitempty"`
+	Inputs        *argoInputs        `yaml:"inputs,omitempty"`
+	RetryStrategy *argoRetryStrategy `yaml:"retryStrategy,omitempty"`
+	DAG           *argoDAG           `yaml:"dag,omitempty"`
+	Container     *argoContainer     `yaml:"container,omitempty"`
+}
+
+type argoInputs struct {
+	Parameters []argoParameter `yaml:"parameters"`
+}
+
+type argoParameter struct {
+	Name    string `yaml:"name"`
+	Default string `yaml:"default"`
+}
+
+type argoRetryStrategy struct {
+	Limit   uint         `yaml:"limit"`
+	Backoff *argoBackoff `yaml:"backoff,omitempty"`
+}
+
+type argoBackoff struct {
+	Duration string `yaml:"duration"`
+}
+
+type argoDAG struct {
+	Tasks []argoTask `yaml:"tasks"`
+}
+
+type argoTask struct {
+	Name         string   `yaml:"name"`
+	Template     string   `yaml:"template"`
+	Dependencies []string `yaml:"dependencies,omitempty"`
+}
+
+type argoContainer struct {
+	Image string   `yaml:"image"`
+	Args  []string `yaml:"args"`
+}
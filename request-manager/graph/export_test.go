@@ -0,0 +1,206 @@
+// Copyright 2020, Square, Inc.
+
+package graph_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/go-test/deep"
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/spincycle/v2/proto"
+	. "github.com/square/spincycle/v2/request-manager/graph"
+)
+
+func TestTemplateDAG(t *testing.T) {
+	seqGraphs, results := MakeGrapher(t, "a-b-c.yaml").CheckSequences()
+	if results.AnyError {
+		t.Fatalf("specs failed graph checks: %+v", results)
+	}
+
+	dag := TemplateDAG(seqGraphs["three-nodes"])
+	if dag.Name != "three-nodes" || dag.Kind != DAG_KIND_TEMPLATE {
+		t.Errorf("got name %s kind %s, expected three-nodes template", dag.Name, dag.Kind)
+	}
+	names := []string{}
+	for _, n := range dag.Nodes {
+		names = append(names, n.Name)
+	}
+	if diff := deep.Equal(names, []string{"a", "b", "c"}); diff != nil {
+		t.Fatal(diff) // source and sink not included, in topological order
+	}
+	a, b := dag.Nodes[0], dag.Nodes[1]
+	if a.Category != "job" || a.Type != "aJobType" || a.Retry != 1 || a.RetryWait != "500ms" {
+		t.Errorf("got node a %+v, expected job aJobType with retry 1, 500ms", a)
+	}
+	if len(a.Deps) != 0 {
+		t.Errorf("node a has deps %v, expected none (source node not included)", a.Deps)
+	}
+	if diff := deep.Equal(b.Deps, []string{"a"}); diff != nil {
+		t.Error(diff) // node IDs are names
+	}
+	if diff := deep.Equal(dag.Edges, []DAGEdge{{From: "a", To: "b"}, {From: "b", To: "c"}}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Same DAG every time, although the Grapher generates random node IDs
+	seqGraphs2, _ := MakeGrapher(t, "a-b-c.yaml").CheckSequences()
+	if diff := deep.Equal(TemplateDAG(seqGraphs2["three-nodes"]), dag); diff != nil {
+		t.Error(diff)
+	}
+	bytes, err := Export(dag, EXPORT_FORMAT_ARGO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(bytes), "- name: b\n        template: b\n        dependencies:\n        - a\n") {
+		t.Errorf("task b not named b or does not depend on a:\n%s", bytes)
+	}
+
+	// Sequence nodes are not expanded
+	dag = TemplateDAG(seqGraphs["retry-three-nodes"])
+	if len(dag.Nodes) != 1 || dag.Nodes[0].Category != "sequence" || dag.Nodes[0].Type != "three-nodes" {
+		t.Errorf("got nodes %+v, expected one sequence node of type three-nodes", dag.Nodes)
+	}
+}
+
+func testChain() proto.JobChain {
+	return proto.JobChain{
+		RequestId:   "req1",
+		RequestType: "Restart_App",
+		Jobs: map[string]proto.Job{
+			"j1": {Id: "j1", Name: "start", Type: "noop", State: proto.STATE_COMPLETE},
+			"j2": {Id: "j2", Name: "stop", Type: "stop-app", State: proto.STATE_COMPLETE, Retry: 2, RetryWait: "5s", Args: map[string]interface{}{"host": "app1", "port": 8080}},
+			"j3": {Id: "j3", Name: "drain", Type: "drain-app", State: proto.STATE_FAIL},
+			"j4": {Id: "j4", Name: "end", Type: "noop", State: proto.STATE_PENDING},
+		},
+		AdjacencyList: map[string][]string{
+			"j1": {"j3", "j2"},
+			"j2": {"j4"},
+			"j3": {"j4"},
+		},
+	}
+}
+
+func TestChainDAG(t *testing.T) {
+	dag := ChainDAG(testChain())
+	expect := DAG{
+		Name:      "Restart_App",
+		Kind:      DAG_KIND_CHAIN,
+		RequestId: "req1",
+		Nodes: []DAGNode{
+			{Id: "j1", Name: "start", Category: "job", Type: "noop", Deps: []string{}, State: "COMPLETE"},
+			{Id: "j3", Name: "drain", Category: "job", Type: "drain-app", Deps: []string{"j1"}, State: "FAIL"},
+			{Id: "j2", Name: "stop", Category: "job", Type: "stop-app", Deps: []string{"j1"}, State: "COMPLETE", Retry: 2, RetryWait: "5s", Args: map[string]interface{}{"host": "app1", "port": 8080}},
+			{Id: "j4", Name: "end", Category: "job", Type: "noop", Deps: []string{"j2", "j3"}, State: "PENDING"},
+		},
+		Edges: []DAGEdge{
+			{From: "j1", To: "j2"},
+			{From: "j1", To: "j3"},
+			{From: "j2", To: "j4"},
+			{From: "j3", To: "j4"},
+		},
+	}
+	if diff := deep.Equal(dag, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	bytes, err := Export(dag, EXPORT_FORMAT_DAG)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got map[string]interface{}
+	if err := json.Unmarshal(bytes, &got); err != nil {
+		t.Fatalf("invalid JSON: %s", err)
+	}
+	if got["requestId"] != "req1" || len(got["nodes"].([]interface{})) != 4 {
+		t.Errorf("got %s, expected req1 with 4 nodes", bytes)
+	}
+
+	if _, err := Export(dag, "bpmn"); err == nil {
+		t.Errorf("no error exporting invalid format, expected one")
+	}
+}
+
+func TestExportArgo(t *testing.T) {
+	jc := testChain()
+	j := jc.Jobs["j3"]
+	j.Name = strings.Repeat("very_long_name", 10)
+	jc.Jobs["j3"] = j
+
+	bytes, err := Export(ChainDAG(jc), EXPORT_FORMAT_ARGO)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var w struct {
+		Kind     string
+		Metadata struct {
+			GenerateName string            `yaml:"generateName"`
+			Annotations  map[string]string `yaml:"annotations"`
+		}
+		Spec struct {
+			Entrypoint string
+			Templates  []struct {
+				Name          string
+				RetryStrategy *struct {
+					Limit   uint
+					Backoff struct{ Duration string }
+				} `yaml:"retryStrategy"`
+				Inputs *struct {
+					Parameters []struct{ Name, Default string }
+				}
+				DAG *struct {
+					Tasks []struct {
+						Name         string
+						Template     string
+						Dependencies []string
+					}
+				}
+				Container *struct {
+					Image string
+					Args  []string
+				}
+			}
+		}
+	}
+	if err := yaml.Unmarshal(bytes, &w); err != nil {
+		t.Fatalf("invalid YAML: %s", err)
+	}
+	if w.Kind != "Workflow" || w.Metadata.GenerateName != "restart-app-" || w.Metadata.Annotations["spincycle/request-id"] != "req1" {
+		t.Errorf("got kind %s, metadata %+v", w.Kind, w.Metadata)
+	}
+	if w.Spec.Entrypoint != "main" || len(w.Spec.Templates) != 5 || w.Spec.Templates[0].DAG == nil {
+		t.Fatalf("got entrypoint %s and %d templates, expected main DAG and 4 job templates:\n%s", w.Spec.Entrypoint, len(w.Spec.Templates), bytes)
+	}
+
+	tasks := w.Spec.Templates[0].DAG.Tasks
+	drain := strings.TrimRight(strings.Repeat("very-long-name", 10)[:60], "-") + "-j3"
+	names := []string{}
+	for _, task := range tasks {
+		names = append(names, task.Name)
+		if task.Template != task.Name {
+			t.Errorf("task %s has template %s, expected its own template", task.Name, task.Template)
+		}
+		if len(task.Name) > 63 {
+			t.Errorf("task name %s longer than 63 characters", task.Name)
+		}
+	}
+	if diff := deep.Equal(names, []string{"start-j1", "stop-j2", drain, "end-j4"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(tasks[3].Dependencies, []string{"stop-j2", drain}); diff != nil {
+		t.Error(diff)
+	}
+
+	stop := w.Spec.Templates[2]
+	if stop.Name != "stop-j2" || stop.RetryStrategy == nil || stop.RetryStrategy.Limit != 2 || stop.RetryStrategy.Backoff.Duration != "5s" {
+		t.Errorf("got template %+v, expected stop-j2 with retry 2, backoff 5s", stop)
+	}
+	if stop.Container == nil || stop.Container.Image != ARGO_IMAGE || strings.Join(stop.Container.Args, " ") != "job stop-app" {
+		t.Errorf("got container %+v, expected image %s, args job stop-app", stop.Container, ARGO_IMAGE)
+	}
+	if stop.Inputs == nil || len(stop.Inputs.Parameters) != 2 || stop.Inputs.Parameters[0].Default != "app1" || stop.Inputs.Parameters[1].Default != "8080" {
+		t.Errorf("got inputs %+v, expected host=app1, port=8080", stop.Inputs)
+	}
+}
@@ -42,6 +42,7 @@ type Node struct {
 	SequenceId        string                 // ID for first node in sequence
 	SequenceRetry     uint                   // Number of times to retry a sequence. Only set for first node in sequence.
 	SequenceRetryWait string                 // The time to sleep between sequence retries
+	RunAfterFail      bool                   // Runnable when previous nodes are done, even if failed
 }
 
 // IsValidGraph asserts that g is a valid graph by ensuring that
@@ -4,6 +4,7 @@ package graph
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/square/spincycle/v2/request-manager/id"
@@ -125,24 +126,34 @@ func (gr *Grapher) CheckSequences() (map[string]*Graph, *spec.CheckResults) {
 				}
 
 				// Do sets check.
-				missingSets := map[string][]string{} // node name -> list of missing `sets` args
+				missingSets := map[string]string{} // node name -> missing `sets` args
 				for nodeName, nodeSpec := range seqSpec.Nodes {
 					if nodeSpec.IsJob() {
 						continue
 					}
-					// Compare declared `sets` with what the node actually sets
+					// Compare declared `sets` with what the node actually sets.
+					// For conditional nodes, report every branch that doesn't set
+					// the args so it's caught here, not when the branch is taken.
+					if nodeSpec.IsConditional() {
+						missing := getMissingBranchSets(nodeSpec, seqSets, gr.sequenceSpecs)
+						if len(missing) != 0 {
+							missingSets[nodeName] = strings.Join(missing, ", ")
+						}
+						continue
+					}
 					subseqs := getNodeSubsequences(nodeSpec, gr.sequenceSpecs)
 					sets := getActualSets(subseqs, seqSets)
 					missing := getMissingSets(sets, nodeSpec.Sets)
 					if len(missing) != 0 {
-						missingSets[nodeName] = missing
+						missingSets[nodeName] = "failed to set " + strings.Join(missing, ", ")
 					}
 				}
 				if len(missingSets) > 0 {
 					msg := []string{}
 					for nodeName, missing := range missingSets {
-						msg = append(msg, fmt.Sprintf("%s (failed to set %s)", nodeName, strings.Join(missing, ", ")))
+						msg = append(msg, fmt.Sprintf("%s (%s)", nodeName, missing))
 					}
+					sort.Strings(msg)
 					multiple := ""
 					if len(missingSets) > 1 {
 						multiple = "s"
@@ -232,6 +243,36 @@ func getActualSets(subseqs []string, seqSets map[string]map[string]bool) map[str
 	return setsIntersection
 }
 
+// getMissingBranchSets returns, for each branch of a conditional node that
+// calls a sequence, the job args declared in the node's `sets` that the branch
+// does not set, like "branch 2 -> seq-b failed to set arg-b". Branches are
+// sorted by value with "default" last.
+func getMissingBranchSets(nodeSpec *spec.Node, seqSets map[string]map[string]bool, sequenceSpecs map[string]*spec.Sequence) []string {
+	values := make([]string, 0, len(nodeSpec.Eq))
+	for value := range nodeSpec.Eq {
+		if value != "default" {
+			values = append(values, value)
+		}
+	}
+	sort.Strings(values)
+	if _, ok := nodeSpec.Eq["default"]; ok {
+		values = append(values, "default")
+	}
+
+	branches := []string{}
+	for _, value := range values {
+		seq := nodeSpec.Eq[value]
+		if _, ok := sequenceSpecs[seq]; !ok {
+			continue
+		}
+		missing := getMissingSets(seqSets[seq], nodeSpec.Sets)
+		if len(missing) != 0 {
+			branches = append(branches, fmt.Sprintf("branch %s -> %s failed to set %s", value, seq, strings.Join(missing, ", ")))
+		}
+	}
+	return branches
+}
+
 // getMissingSets returns a list of job args that are present in `declared` but
 // not in `actual`.
 // These are job args that were supposed to have been set, but were not.
@@ -469,6 +510,13 @@ func checkNodeArgs(n *spec.Node, jobArgs map[string]bool) error {
 		}
 	}
 
+	// Likewise for wait nodes that wait until the time in the "until" job arg.
+	if n.IsWait() && n.Until != nil {
+		if !jobArgs[*n.Until] {
+			return fmt.Errorf("in node %s: 'until: %s': job arg %s is not set", n.Name, *n.Until, *n.Until)
+		}
+	}
+
 	missing := []string{}
 
 	// Assert that the iterable variable is present
@@ -487,8 +535,10 @@ func checkNodeArgs(n *spec.Node, jobArgs map[string]bool) error {
 
 	// Assert all other defined args are present
 	for _, arg := range n.Args {
-		if !jobArgs[*arg.Given] {
-			missing = append(missing, *arg.Given)
+		for _, given := range spec.GivenArgs(*arg.Given) {
+			if !jobArgs[given] {
+				missing = append(missing, given)
+			}
 		}
 	}
 
@@ -216,9 +216,16 @@ func TestFailMissingSetsConditionalGraphCheck(t *testing.T) {
 		t.Fatalf("error creating subsequence graph for sequence %s, expected no error: %v", subsequence, errs)
 	}
 	subsequence = "missing-sets-conditional"
-	if errs := getSeqErrors(subsequence, seqResults); len(errs) == 0 {
+	errs := getSeqErrors(subsequence, seqResults)
+	if len(errs) == 0 {
 		t.Fatalf("no error creating subsequence graph for sequence %s, expected error", subsequence)
 	}
+
+	// verify that error reports each branch that fails to set args
+	expectErr := "node did not set job args declared in 'sets': node-a (branch 1 -> missing-sets-subsequence-1 failed to set arg-c, branch 2 -> missing-sets-subsequence-2 failed to set arg-b)"
+	if errs[0].Error() != expectErr {
+		t.Errorf("got error %q, expected %q", errs[0], expectErr)
+	}
 }
 
 func TestFailMissingJobArgsGraphCheck(t *testing.T) {
@@ -7,18 +7,28 @@ import (
 	"reflect"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job/wait"
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/request-manager/id"
 	"github.com/square/spincycle/v2/request-manager/spec"
 )
 
+// LARGE_FAN_OUT is the number of each: expansions of one node above which the
+// resolver warns about a very large fan-out (see Resolver.Warnings).
+const LARGE_FAN_OUT = 100
+
 // ResolverFactory returns Resolvers tailored to create request graphs
 // for a specific input request.
 type ResolverFactory interface {
 	// Make makes a Resolver. A new resolver should be made for every request.
 	Make(proto.Request) Resolver
+
+	// TemplateVersion returns the TemplateVersion of the sequence specs that
+	// Resolvers use.
+	TemplateVersion() string
 }
 
 // Implements ResolverFactory interface.
@@ -27,6 +37,7 @@ type resolverFactory struct {
 	seqSpecs  map[string]*spec.Sequence
 	seqGraphs map[string]*Graph
 	idf       id.GeneratorFactory
+	version   string // TemplateVersion of seqSpecs
 }
 
 func NewResolverFactory(jf job.Factory, seqSpecs map[string]*spec.Sequence, seqGraphs map[string]*Graph, idf id.GeneratorFactory) ResolverFactory {
@@ -35,9 +46,14 @@ func NewResolverFactory(jf job.Factory, seqSpecs map[string]*spec.Sequence, seqG
 		seqSpecs:  seqSpecs,
 		seqGraphs: seqGraphs,
 		idf:       idf,
+		version:   TemplateVersion(seqSpecs),
 	}
 }
 
+func (f *resolverFactory) TemplateVersion() string {
+	return f.version
+}
+
 func (f *resolverFactory) Make(req proto.Request) Resolver {
 	return &resolver{
 		request:    req,
@@ -55,6 +71,12 @@ type Resolver interface {
 
 	// Build the request graph. Returns an error if any error occurs.
 	BuildRequestGraph(jobArgs map[string]interface{}) (*Graph, error)
+
+	// Warnings returns non-fatal warnings from RequestArgs and BuildRequestGraph,
+	// like deprecated sequences, optional args set to their default values, and
+	// very large fan-outs.
+	// They're returned to the request creator (proto.Request.Warnings).
+	Warnings() []string
 }
 
 // resolver implements the Resolver interface.
@@ -64,6 +86,7 @@ type resolver struct {
 	seqSpecs   map[string]*spec.Sequence // sequence name --> sequence spec
 	seqGraphs  map[string]*Graph         // sequence name --> sequence graph
 	idGen      id.Generator              // generates UIDs for jobs
+	warnings   []string                  // non-fatal warnings, in order
 }
 
 // RequestArgs takes user input args and returns them as a job args map, the form
@@ -79,6 +102,13 @@ func (r *resolver) RequestArgs(jobArgs map[string]interface{}) ([]proto.RequestA
 	if !seq.Request {
 		return nil, fmt.Errorf("%s is not a request", r.request.Type)
 	}
+	if seq.Deprecated != "" {
+		if seq.Sunset != "" {
+			r.warn(fmt.Sprintf("request %s is deprecated (new requests rejected from %s): %s", r.request.Type, seq.Sunset, seq.Deprecated))
+		} else {
+			r.warn(fmt.Sprintf("request %s is deprecated: %s", r.request.Type, seq.Deprecated))
+		}
+	}
 
 	for i, arg := range seq.Args.Required {
 		val, ok := jobArgs[*arg.Name]
@@ -86,11 +116,13 @@ func (r *resolver) RequestArgs(jobArgs map[string]interface{}) ([]proto.RequestA
 			return nil, fmt.Errorf("required arg '%s' not set", *arg.Name)
 		}
 		reqArgs = append(reqArgs, proto.RequestArg{
-			Pos:   i,
-			Name:  *arg.Name,
-			Type:  proto.ARG_TYPE_REQUIRED,
-			Value: val,
-			Given: true,
+			Pos:       i,
+			Name:      *arg.Name,
+			Desc:      arg.Desc,
+			Type:      proto.ARG_TYPE_REQUIRED,
+			Value:     val,
+			Given:     true,
+			Sensitive: arg.Sensitive,
 		})
 	}
 
@@ -98,23 +130,28 @@ func (r *resolver) RequestArgs(jobArgs map[string]interface{}) ([]proto.RequestA
 		val, ok := jobArgs[*arg.Name]
 		if !ok {
 			val = *arg.Default
+			r.warn(fmt.Sprintf("optional arg %s not given, using default value: %v", *arg.Name, val))
 		}
 		reqArgs = append(reqArgs, proto.RequestArg{
-			Pos:     i,
-			Name:    *arg.Name,
-			Type:    proto.ARG_TYPE_OPTIONAL,
-			Default: *arg.Default,
-			Value:   val,
-			Given:   ok,
+			Pos:       i,
+			Name:      *arg.Name,
+			Desc:      arg.Desc,
+			Type:      proto.ARG_TYPE_OPTIONAL,
+			Default:   *arg.Default,
+			Value:     val,
+			Given:     ok,
+			Sensitive: arg.Sensitive,
 		})
 	}
 
 	for i, arg := range seq.Args.Static {
 		reqArgs = append(reqArgs, proto.RequestArg{
-			Pos:   i,
-			Name:  *arg.Name,
-			Type:  proto.ARG_TYPE_STATIC,
-			Value: *arg.Default,
+			Pos:       i,
+			Name:      *arg.Name,
+			Desc:      arg.Desc,
+			Type:      proto.ARG_TYPE_STATIC,
+			Value:     *arg.Default,
+			Sensitive: arg.Sensitive,
 		})
 	}
 
@@ -166,6 +203,9 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 		// If this error is thrown, there's a bug in the code.
 		return nil, fmt.Errorf("cannot find specs for sequence: %s", seqName)
 	}
+	if seq.Deprecated != "" && seqName != r.request.Type { // request warned in RequestArgs
+		r.warn(fmt.Sprintf("sequence %s is deprecated: %s", seqName, seq.Deprecated))
+	}
 	for _, arg := range seq.Args.Optional {
 		if _, ok := jobArgs[*arg.Name]; !ok {
 			jobArgs[*arg.Name] = *arg.Default
@@ -212,6 +252,9 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 		if err != nil {
 			return nil, fmt.Errorf("in seq %s, node %s: invalid 'each:' %s", seqName, nodeSpec.Name, err)
 		}
+		if n := len(lists[0]); n > LARGE_FAN_OUT {
+			r.warn(fmt.Sprintf("in seq %s, node %s: large fan-out: 'each:' expands to %d (more than %d)", seqName, nodeSpec.Name, n, LARGE_FAN_OUT))
+		}
 
 		// All the graphs that make up this sequence graph node's subgraph,
 		// one for each time the node is repeated
@@ -255,6 +298,14 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 				}
 			}
 
+			// If this is a wait node that waits until a time, add the "until"
+			// job arg.
+			if nodeSpec.IsWait() && nodeSpec.Until != nil {
+				if untilArg, ok := jobArgs[*nodeSpec.Until]; ok {
+					jobArgsCopy[*nodeSpec.Until] = untilArg
+				}
+			}
+
 			// -----------------------------------------------------
 			// Resolve sequence node into a request subgraph and add
 			// to list of expansions
@@ -291,7 +342,7 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 					return nil, fmt.Errorf("in seq %s, node %s: %s", seqName, nodeSpec.Name, err)
 				}
 			} else {
-				// Node is a job: create the proto.Job and put
+				// Node is a job or wait: create the proto.Job and put
 				// it in a graph
 				reqSubgraph, err = r.buildSingleVertexGraph(nodeSpec, jobArgsCopy)
 				if err != nil {
@@ -325,8 +376,12 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 			// Serialize parallel expansions if number of expanded
 			// sequences exceeds `parallel`.
 			// Each parallel expansion is wrapped between dummy nodes.
+			// Sequential expansions are parallel expansions of one,
+			// so they run one at a time in list order.
 			var parallel uint
-			if nodeSpec.Parallel == nil {
+			if nodeSpec.Sequential {
+				parallel = 1
+			} else if nodeSpec.Parallel == nil {
 				parallel = uint(len(expandedSeqs))
 			} else {
 				parallel = *nodeSpec.Parallel
@@ -338,13 +393,20 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 			}
 
 			prev := wrappedReqSubgraph.Source
+			sinks := []*Node{} // of each parallel expansion
 			var count uint = 0
 			for _, c := range expandedSeqs {
 				currG.InsertComponentBetween(c, currG.Source, currG.Sink)
 				count++
 				if count == parallel {
+					if nodeSpec.ContinueOnFail && prev != wrappedReqSubgraph.Source {
+						// Run this expansion after the previous one is done,
+						// even if it failed
+						currG.Source.RunAfterFail = true
+					}
 					wrappedReqSubgraph.InsertComponentBetween(currG, prev, wrappedReqSubgraph.Sink)
 					prev = currG.Sink
+					sinks = append(sinks, currG.Sink)
 					currG, err = r.newReqGraph("repeat_"+nodeSpec.Name, jobArgs)
 					if err != nil {
 						return nil, err
@@ -355,6 +417,14 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 			if count != 0 {
 				wrappedReqSubgraph.InsertComponentBetween(currG, prev, wrappedReqSubgraph.Sink)
 			}
+			if nodeSpec.ContinueOnFail {
+				// Nodes that depend on this node run only if every expansion
+				// completed, not just the last one
+				for _, sink := range sinks[:len(sinks)-1] {
+					wrappedReqSubgraph.Edges[sink.Id] = append(wrappedReqSubgraph.Edges[sink.Id], wrappedReqSubgraph.Sink.Id)
+					wrappedReqSubgraph.RevEdges[wrappedReqSubgraph.Sink.Id] = append(wrappedReqSubgraph.RevEdges[wrappedReqSubgraph.Sink.Id], sink.Id)
+				}
+			}
 		} else if len(expandedSeqs) == 1 {
 			wrappedReqSubgraph = expandedSeqs[0]
 		} else if len(expandedSeqs) == 0 {
@@ -417,6 +487,21 @@ func (r *resolver) buildSequence(cfg buildSequenceConfig) (*Graph, error) {
 	return reqGraph, nil
 }
 
+func (r *resolver) Warnings() []string {
+	return r.warnings
+}
+
+// warn adds a warning unless it was already added, which happens when the same
+// sequence is built more than once (e.g. each: expansions of a sequence node).
+func (r *resolver) warn(msg string) {
+	for _, w := range r.warnings {
+		if w == msg {
+			return
+		}
+	}
+	r.warnings = append(r.warnings, msg)
+}
+
 // chooseConditional determines which path of a conditional to take
 // based on the value of the job args.
 // Assumes `n` is a conditional node.
@@ -517,6 +602,15 @@ func (r *resolver) getIterators(n *spec.Node, args map[string]interface{}) ([]*s
 func remapNodeArgs(n *spec.Node, args map[string]interface{}) (map[string]interface{}, error) {
 	jobArgs2 := map[string]interface{}{}
 	for _, arg := range n.Args {
+		// Given can be a template over job args, like "{cluster}.example.com"
+		if spec.IsArgTemplate(*arg.Given) {
+			val, err := spec.ExpandArgTemplate(*arg.Given, args)
+			if err != nil {
+				return nil, fmt.Errorf("cannot create job %s: %s", *n.NodeType, err)
+			}
+			jobArgs2[*arg.Expected] = val
+			continue
+		}
 		var ok bool
 		jobArgs2[*arg.Expected], ok = args[*arg.Given]
 		if !ok {
@@ -640,14 +734,31 @@ func (r *resolver) newNode(j *spec.Node, jobArgs map[string]interface{}) (*Node,
 		originalArgs[k] = v
 	}
 
+	// Wait nodes don't have a type: they're built-in wait jobs. Use a copy of
+	// the node spec with the wait job type because the type is used as the job
+	// type (proto.Job.Type).
+	if j.IsWait() {
+		waitSpec := *j
+		waitType := wait.JOB_TYPE
+		waitSpec.NodeType = &waitType
+		j = &waitSpec
+	}
+
 	// Make the name of this node unique within the request by assigning it an id.
 	id, err := r.idGen.UID()
 	if err != nil {
 		return nil, fmt.Errorf("Error making id for '%s %s' job: %s", *j.NodeType, j.Name, err)
 	}
 
-	// Create the job
-	rj, err := r.jobFactory.Make(job.NewIdWithRequestId(*j.NodeType, j.Name, id, r.request.Id))
+	// Create the job. Wait jobs are made here, not by the job factory, because
+	// they're configured by the node spec (duration or until), not job args.
+	var rj job.Job
+	jid := job.NewIdWithRequestId(*j.NodeType, j.Name, id, r.request.Id)
+	if j.IsWait() {
+		rj, err = newWaitJob(j, jid)
+	} else {
+		rj, err = r.jobFactory.Make(jid)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("Error making '%s %s' job: %s", *j.NodeType, j.Name, err)
 	}
@@ -671,3 +782,16 @@ func (r *resolver) newNode(j *spec.Node, jobArgs map[string]interface{}) (*Node,
 		RetryWait: j.RetryWait,
 	}, nil
 }
+
+// newWaitJob makes the wait job for wait node spec j. Static checks assert that
+// exactly one of duration or until is set, and that duration is valid.
+func newWaitJob(j *spec.Node, jid job.Id) (job.Job, error) {
+	if j.Until != nil {
+		return wait.New(jid, 0, *j.Until), nil
+	}
+	d, err := time.ParseDuration(j.Duration)
+	if err != nil {
+		return nil, fmt.Errorf("invalid duration %s: %s", j.Duration, err)
+	}
+	return wait.New(jid, d, ""), nil
+}
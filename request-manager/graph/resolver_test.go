@@ -6,9 +6,11 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job/wait"
 	"github.com/square/spincycle/v2/proto"
 	. "github.com/square/spincycle/v2/request-manager/graph"
 	"github.com/square/spincycle/v2/request-manager/id"
@@ -810,6 +812,146 @@ func TestCreateLimitParallel(t *testing.T) {
 	reqVerifyStep(g, currentStep, 1, "request_decommission-cluster_end", t)
 }
 
+func TestCreateSequential(t *testing.T) {
+	sequencesFile := "sequential.yaml"
+	requestName := "decommission-cluster"
+	args := map[string]interface{}{
+		"cluster": "test-cluster-001",
+	}
+
+	g, err := createGraph(t, sequencesFile, requestName, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startNode := g.Source.Id
+	currentStep := g.Edges[startNode]
+	reqVerifyStep(g, currentStep, 1, "decommission-cluster_begin", t)
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "get-instances", t)
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "repeat_decommission-instances_begin", t)
+	repeatEnd := ""
+
+	// One expansion at a time, in list order: each expansion is wrapped in
+	// repeat begin/end nodes, and the end node of one leads to the begin node
+	// of the next and, because of continueOnFail, the outer repeat end node
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	for i, instance := range []string{"node1", "node2", "node3", "node4"} {
+		reqVerifyStep(g, currentStep, 1, "repeat_decommission-instances_begin", t)
+		if runAfterFail := g.Nodes[currentStep[0]].RunAfterFail; runAfterFail != (i > 0) {
+			t.Errorf("expansion %d: RunAfterFail = %t, expected %t", i, runAfterFail, i > 0)
+		}
+
+		currentStep = reqGetNextStep(g.Edges, currentStep)
+		reqVerifyStep(g, currentStep, 1, "sequence_decommission-instances_begin", t)
+
+		currentStep = reqGetNextStep(g.Edges, currentStep)
+		reqVerifyStep(g, currentStep, 1, "decommission-instance_begin", t)
+
+		currentStep = reqGetNextStep(g.Edges, currentStep)
+		reqVerifyStep(g, currentStep, 1, "decom-1", t)
+		if got := g.Nodes[currentStep[0]].Args["container"]; got != instance {
+			t.Errorf("expansion %d: decom-1 container arg = %v, expected %s", i, got, instance)
+		}
+
+		currentStep = reqGetNextStep(g.Edges, currentStep)
+		reqVerifyStep(g, currentStep, 1, "decommission-instance_end", t)
+
+		currentStep = reqGetNextStep(g.Edges, currentStep)
+		reqVerifyStep(g, currentStep, 1, "sequence_decommission-instances_end", t)
+
+		currentStep = reqGetNextStep(g.Edges, currentStep)
+		reqVerifyStep(g, currentStep, 1, "repeat_decommission-instances_end", t)
+
+		next := g.Edges[currentStep[0]]
+		if i < 3 {
+			if len(next) != 2 {
+				t.Fatalf("expansion %d: repeat end node has %d out edges, expected 2", i, len(next))
+			}
+			// Follow the next expansion, not the outer repeat end node
+			for _, id := range next {
+				if g.Nodes[id].Name == "repeat_decommission-instances_begin" {
+					currentStep = []string{id}
+				} else {
+					repeatEnd = id
+				}
+			}
+		}
+	}
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "repeat_decommission-instances_end", t)
+	if currentStep[0] != repeatEnd {
+		t.Errorf("last expansion leads to %s, expected outer repeat end node %s", currentStep[0], repeatEnd)
+	}
+	if n := len(g.RevEdges[repeatEnd]); n != 4 {
+		t.Errorf("outer repeat end node has %d in edges, expected 4 (one per expansion)", n)
+	}
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "cleanup", t)
+}
+
+func TestCreateWait(t *testing.T) {
+	sequencesFile := "wait.yaml"
+	requestName := "restart-db"
+	args := map[string]interface{}{
+		"host":      "db1",
+		"restartAt": "2020-06-01T12:00:00Z",
+	}
+
+	g, err := createGraph(t, sequencesFile, requestName, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	startNode := g.Source.Id
+	currentStep := g.Edges[startNode]
+	reqVerifyStep(g, currentStep, 1, "restart-db_begin", t)
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "wait-for-window", t)
+
+	// Wait nodes are built-in wait jobs configured by the node spec, not made
+	// by the job factory
+	n := g.Nodes[currentStep[0]]
+	if *n.Spec.NodeType != wait.JOB_TYPE {
+		t.Errorf("wait node type = %s, expected %s", *n.Spec.NodeType, wait.JOB_TYPE)
+	}
+	w := &wait.Job{}
+	if err := w.Deserialize(n.JobBytes); err != nil {
+		t.Fatal(err)
+	}
+	if expect := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC); !w.Until.Equal(expect) {
+		t.Errorf("wait node until = %s, expected %s", w.Until, expect)
+	}
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "stop-db", t)
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "let-it-settle", t)
+	w = &wait.Job{}
+	if err := w.Deserialize(g.Nodes[currentStep[0]].JobBytes); err != nil {
+		t.Fatal(err)
+	}
+	if w.Duration != 30*time.Second {
+		t.Errorf("wait node duration = %s, expected 30s", w.Duration)
+	}
+
+	currentStep = reqGetNextStep(g.Edges, currentStep)
+	reqVerifyStep(g, currentStep, 1, "start-db", t)
+
+	// Bad until time fails when the request is created
+	args["restartAt"] = "tomorrow"
+	if _, err := createGraph(t, sequencesFile, requestName, args); err == nil {
+		t.Error("no error for invalid until time, expected an error")
+	}
+}
+
 func TestOptArgs(t *testing.T) {
 	sequencesFile := "opt-args.yaml"
 	requestName := "req"
@@ -1243,3 +1385,134 @@ func createDestroy2(args map[string]interface{}) error {
 func createEndNode(args map[string]interface{}) error {
 	return nil
 }
+
+func TestWarnings(t *testing.T) {
+	makeResolver := func(sequencesFile, requestName string, tf job.Factory) Resolver {
+		specs, result := spec.ParseSpec(rmtest.SpecPath + "/" + sequencesFile)
+		if len(result.Errors) != 0 {
+			t.Fatal(result.Errors)
+		}
+		spec.ProcessSpecs(&specs)
+		gr := NewGrapher(specs, id.NewGeneratorFactory(4, 100))
+		seqGraphs, seqResults := gr.CheckSequences()
+		if seqResults.AnyError {
+			t.Fatalf("failed to create sequence graphs: %v", seqResults)
+		}
+		rf := NewResolverFactory(tf, specs.Sequences, seqGraphs, id.NewGeneratorFactory(4, 100))
+		return rf.Make(proto.Request{Id: "reqABC", Type: requestName})
+	}
+
+	// Optional arg not given: warn that its default value is used
+	r := makeResolver("decomm.yaml", "decommission-cluster", &mock.JobFactory{})
+	if _, err := r.RequestArgs(map[string]interface{}{"cluster": "c1", "env": "prod"}); err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"optional arg something not given, using default value: 100"}
+	if diff := deep.Equal(r.Warnings(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// No warnings when the optional arg is given
+	r = makeResolver("decomm.yaml", "decommission-cluster", &mock.JobFactory{})
+	if _, err := r.RequestArgs(map[string]interface{}{"cluster": "c1", "env": "prod", "something": 5}); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Warnings()) != 0 {
+		t.Errorf("got warnings %v, expected none", r.Warnings())
+	}
+
+	// each: expands to more than LARGE_FAN_OUT: warn once
+	instances := make([]string, LARGE_FAN_OUT+1)
+	for i := range instances {
+		instances[i] = fmt.Sprintf("instance%d", i)
+	}
+	tf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"get-instances": &mock.Job{
+				SetJobArgs: map[string]interface{}{"instances": instances},
+			},
+		},
+	}
+	r = makeResolver("bad-each.yaml", "bad-each", tf)
+	if _, err := r.BuildRequestGraph(map[string]interface{}{"host": "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{fmt.Sprintf("in seq bad-each, node pre-flight-checks: large fan-out: 'each:' expands to %d (more than %d)", LARGE_FAN_OUT+1, LARGE_FAN_OUT)}
+	if diff := deep.Equal(r.Warnings(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Deprecated request and subsequence
+	r = makeResolver("deprecated.yaml", "old-req", &mock.JobFactory{})
+	jobArgs := map[string]interface{}{"host": "foo"}
+	if _, err := r.RequestArgs(jobArgs); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.BuildRequestGraph(jobArgs); err != nil {
+		t.Fatal(err)
+	}
+	expect = []string{
+		"request old-req is deprecated: use new-req",
+		"sequence old-seq is deprecated: use new-seq",
+	}
+	if diff := deep.Equal(r.Warnings(), expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestArgTemplate(t *testing.T) {
+	sequencesFile := "arg-template.yaml"
+	requestName := "req"
+	args := map[string]interface{}{
+		"cluster": "db1",
+	}
+	tf := &mock.JobFactory{
+		Created: map[string]*mock.Job{},
+	}
+
+	_, err := createGraph1(t, sequencesFile, requestName, args, tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job := tf.Created["job1name"]
+	if job == nil {
+		t.Fatal("job job1name not created")
+	}
+	expectedArgs := map[string]interface{}{
+		"cluster": "db1",
+		"host":    "db1.us-east-1.example.com",
+	}
+	if diff := deep.Equal(job.CreatedWithArgs, expectedArgs); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestEstimateChainSize(t *testing.T) {
+	// The estimate is exact when each: lists have their max length (get-instances
+	// sets 4, maxLen: 4) and the conditional chooses the largest sequence
+	// (env=testing: decommission-instance)
+	sequencesFile := "chain-size.yaml"
+	requestName := "chain-size"
+	args := map[string]interface{}{
+		"cluster": "test-cluster-001",
+		"env":     "testing",
+	}
+	g, err := createGraph(t, sequencesFile, requestName, args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	specs, result := spec.ParseSpec(rmtest.SpecPath + "/" + sequencesFile)
+	if len(result.Errors) != 0 {
+		t.Fatal(result.Errors)
+	}
+	spec.ProcessSpecs(&specs)
+	size := spec.EstimateChainSize(specs, requestName)
+	if size.Jobs != uint64(len(g.Nodes)) {
+		t.Errorf("estimated %d jobs, built %d jobs", size.Jobs, len(g.Nodes))
+	}
+	if len(size.Unbounded) != 0 {
+		t.Errorf("unbounded each lists %v, expected none", size.Unbounded)
+	}
+}
@@ -0,0 +1,166 @@
+// Copyright 2020, Square, Inc.
+
+// Package group provides request groups: many requests created in one call and
+// tracked as one unit.
+package group
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/xid"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+// MAX_NAME_LEN is the maximum length of CreateRequestGroup.Name (request_groups.name).
+const MAX_NAME_LEN = 255
+
+// A Manager saves request groups and aggregates the status of their requests.
+// It does not create, start, or stop requests: the API does that, so each request
+// is authorized like a single request. Requests are linked to their group by
+// proto.CreateRequest.GroupId.
+type Manager interface {
+	// Create validates and saves a new group created by the user. It has no
+	// requests until they are created with its ID.
+	Create(cg proto.CreateRequestGroup, user string) (proto.RequestGroup, error)
+
+	// Get returns the group with all its requests and their aggregate status.
+	Get(groupId string) (proto.RequestGroup, error)
+}
+
+// manager implements the Manager interface
+type manager struct {
+	dbc *sql.DB
+	rm  request.Manager
+}
+
+func NewManager(dbc *sql.DB, rm request.Manager) Manager {
+	return &manager{
+		dbc: dbc,
+		rm:  rm,
+	}
+}
+
+func (m *manager) Create(cg proto.CreateRequestGroup, user string) (proto.RequestGroup, error) {
+	var g proto.RequestGroup
+	if err := Validate(cg); err != nil {
+		return g, err
+	}
+	g = proto.RequestGroup{
+		Id:        xid.New().String(),
+		Name:      cg.Name,
+		User:      user,
+		CreatedAt: time.Now().UTC(),
+		States:    map[string]uint{},
+		Requests:  []proto.Request{},
+	}
+	_, err := m.dbc.ExecContext(context.TODO(),
+		"INSERT INTO request_groups (group_id, name, user, created_at) VALUES (?, ?, ?, ?)",
+		g.Id, g.Name, g.User, g.CreatedAt)
+	if err != nil {
+		return g, serr.NewDbError(err, "INSERT request_groups")
+	}
+	return g, nil
+}
+
+func (m *manager) Get(groupId string) (proto.RequestGroup, error) {
+	var g proto.RequestGroup
+	var user sql.NullString
+	err := m.dbc.QueryRowContext(context.TODO(),
+		"SELECT group_id, name, user, created_at FROM request_groups WHERE group_id = ?", groupId).Scan(
+		&g.Id,
+		&g.Name,
+		&user,
+		&g.CreatedAt,
+	)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return g, serr.GroupNotFound{GroupId: groupId}
+	default:
+		return g, serr.NewDbError(err, "SELECT request_groups")
+	}
+	if user.Valid {
+		g.User = user.String
+	}
+
+	requests, err := m.rm.Find(proto.RequestFilter{GroupId: groupId})
+	if err != nil {
+		return g, err
+	}
+	Aggregate(&g, requests)
+	return g, nil
+}
+
+// Validate returns a ValidationError if the create request group is invalid. It
+// does not validate the requests, which are validated when created.
+func Validate(cg proto.CreateRequestGroup) error {
+	if cg.Name == "" {
+		return serr.ValidationError{Message: "invalid proto.CreateRequestGroup: Name is empty, must be set"}
+	}
+	if len(cg.Name) > MAX_NAME_LEN {
+		return serr.ValidationError{Message: fmt.Sprintf("invalid proto.CreateRequestGroup: Name is %d characters, max is %d", len(cg.Name), MAX_NAME_LEN)}
+	}
+	if len(cg.Requests) == 0 {
+		return serr.ValidationError{Message: "invalid proto.CreateRequestGroup: Requests is empty, must have at least one"}
+	}
+	if len(cg.Requests) > proto.MAX_GROUP_REQUESTS {
+		return serr.ValidationError{Message: fmt.Sprintf("invalid proto.CreateRequestGroup: %d Requests, max is %d", len(cg.Requests), proto.MAX_GROUP_REQUESTS)}
+	}
+	for i, cr := range cg.Requests {
+		if cr.Type == "" {
+			return serr.ValidationError{Message: fmt.Sprintf("invalid proto.CreateRequestGroup: Requests[%d].Type is empty, must be a request name", i)}
+		}
+	}
+	return nil
+}
+
+// Aggregate sets the group requests, in order created, and their aggregate status.
+// See proto.RequestGroup for how the group state is determined.
+func Aggregate(g *proto.RequestGroup, requests []proto.Request) {
+	g.Requests = make([]proto.Request, len(requests))
+	copy(g.Requests, requests)
+	sort.SliceStable(g.Requests, func(i, j int) bool {
+		if g.Requests[i].CreatedAt.Equal(g.Requests[j].CreatedAt) {
+			return g.Requests[i].Id < g.Requests[j].Id
+		}
+		return g.Requests[i].CreatedAt.Before(g.Requests[j].CreatedAt)
+	})
+
+	g.States = map[string]uint{}
+	g.TotalJobs = 0
+	g.FinishedJobs = 0
+	running, complete, stopped := 0, 0, 0
+	for _, req := range g.Requests {
+		g.States[proto.StateName[req.State]]++
+		g.TotalJobs += req.TotalJobs
+		g.FinishedJobs += req.FinishedJobs
+		switch req.State {
+		case proto.STATE_PENDING, proto.STATE_RUNNING, proto.STATE_SUSPENDED:
+			running++
+		case proto.STATE_COMPLETE:
+			complete++
+		case proto.STATE_STOPPED:
+			stopped++
+		}
+	}
+
+	switch {
+	case len(g.Requests) == 0:
+		g.State = proto.STATE_FAIL // creating its requests failed
+	case running > 0:
+		g.State = proto.STATE_RUNNING
+	case complete == len(g.Requests):
+		g.State = proto.STATE_COMPLETE
+	case complete+stopped == len(g.Requests):
+		g.State = proto.STATE_STOPPED
+	default:
+		g.State = proto.STATE_FAIL
+	}
+}
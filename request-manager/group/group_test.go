@@ -0,0 +1,177 @@
+// Copyright 2020, Square, Inc.
+
+package group_test
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/group"
+	"github.com/square/spincycle/v2/request-manager/test"
+	testdb "github.com/square/spincycle/v2/request-manager/test/db"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+var dbm testdb.Manager
+var dbc *sql.DB
+
+func setup(t *testing.T, dataFile string) string {
+	// Setup a db manager to handle databases for all tests.
+	var err error
+	if dbm == nil {
+		dbm, err = testdb.NewManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Setup a db for this specific test, and seed it with some default data.
+	dbName, err := dbm.Create(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := dbm.Connect(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbc = db
+
+	return dbName
+}
+
+func teardown(t *testing.T, dbName string) {
+	if err := dbm.Destroy(dbName); err != nil {
+		t.Fatal(err)
+	}
+	dbc.Close()
+}
+
+// //////////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////////
+
+func TestCreateGet(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/request-default.sql")
+	defer teardown(t, dbName)
+
+	var gotFilter proto.RequestFilter
+	rm := &mock.RequestManager{
+		FindFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			gotFilter = f
+			return []proto.Request{
+				{Id: "r1", GroupId: f.GroupId, State: proto.STATE_COMPLETE, TotalJobs: 2, FinishedJobs: 2},
+			}, nil
+		},
+	}
+	m := group.NewManager(dbc, rm)
+
+	g, err := m.Create(proto.CreateRequestGroup{Name: "migrate", Requests: []proto.CreateRequest{{Type: "req-a"}}}, "finch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Id == "" {
+		t.Fatal("group Id not set")
+	}
+
+	got, err := m.Get(g.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotFilter.GroupId != g.Id {
+		t.Errorf("Find filter GroupId = '%s', expected %s", gotFilter.GroupId, g.Id)
+	}
+	if got.Name != "migrate" || got.User != "finch" {
+		t.Errorf("got name '%s' user '%s', expected migrate finch", got.Name, got.User)
+	}
+	if got.State != proto.STATE_COMPLETE || len(got.Requests) != 1 {
+		t.Errorf("got state %s with %d requests, expected COMPLETE with 1", proto.StateName[got.State], len(got.Requests))
+	}
+
+	_, err = m.Get("nope")
+	if _, ok := err.(serr.GroupNotFound); !ok {
+		t.Errorf("got err %v, expected a GroupNotFound", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := proto.CreateRequestGroup{Name: "migrate", Requests: []proto.CreateRequest{{Type: "req-a"}}}
+	if err := group.Validate(valid); err != nil {
+		t.Errorf("got err %s, expected nil", err)
+	}
+
+	tooMany := proto.CreateRequestGroup{Name: "migrate", Requests: make([]proto.CreateRequest, proto.MAX_GROUP_REQUESTS+1)}
+	for i := range tooMany.Requests {
+		tooMany.Requests[i].Type = "req-a"
+	}
+
+	invalid := []proto.CreateRequestGroup{
+		{Requests: []proto.CreateRequest{{Type: "req-a"}}},                                              // no name
+		{Name: strings.Repeat("x", group.MAX_NAME_LEN+1), Requests: []proto.CreateRequest{{Type: "a"}}}, // name too long
+		{Name: "migrate"}, // no requests
+		{Name: "migrate", Requests: []proto.CreateRequest{{Type: "req-a"}, {}}}, // no type
+		tooMany,
+	}
+	for i, cg := range invalid {
+		if _, ok := group.Validate(cg).(serr.ValidationError); !ok {
+			t.Errorf("invalid %d: got err %v, expected a ValidationError", i, group.Validate(cg))
+		}
+	}
+}
+
+func TestAggregate(t *testing.T) {
+	t0 := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	requests := []proto.Request{
+		{Id: "r3", State: proto.STATE_COMPLETE, CreatedAt: t0.Add(time.Second), TotalJobs: 3, FinishedJobs: 3},
+		{Id: "r2", State: proto.STATE_RUNNING, CreatedAt: t0, TotalJobs: 4, FinishedJobs: 1},
+		{Id: "r1", State: proto.STATE_COMPLETE, CreatedAt: t0, TotalJobs: 2, FinishedJobs: 2},
+	}
+
+	// Any request running -> group running, requests in order created
+	g := proto.RequestGroup{Id: "g1"}
+	group.Aggregate(&g, requests)
+	if g.State != proto.STATE_RUNNING {
+		t.Errorf("got state %s, expected RUNNING", proto.StateName[g.State])
+	}
+	ids := []string{}
+	for _, r := range g.Requests {
+		ids = append(ids, r.Id)
+	}
+	if diff := deep.Equal(ids, []string{"r1", "r2", "r3"}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(g.States, map[string]uint{"COMPLETE": 2, "RUNNING": 1}); diff != nil {
+		t.Error(diff)
+	}
+	if g.TotalJobs != 9 || g.FinishedJobs != 6 {
+		t.Errorf("got %d of %d jobs, expected 6 of 9", g.FinishedJobs, g.TotalJobs)
+	}
+
+	// Other states, in order: all complete, complete and stopped, any failed
+	tests := []struct {
+		states []byte
+		expect byte
+	}{
+		{[]byte{proto.STATE_COMPLETE, proto.STATE_COMPLETE}, proto.STATE_COMPLETE},
+		{[]byte{proto.STATE_COMPLETE, proto.STATE_STOPPED}, proto.STATE_STOPPED},
+		{[]byte{proto.STATE_COMPLETE, proto.STATE_FAIL, proto.STATE_STOPPED}, proto.STATE_FAIL},
+		{[]byte{proto.STATE_FAIL, proto.STATE_PENDING}, proto.STATE_RUNNING},
+		{[]byte{}, proto.STATE_FAIL},
+	}
+	for _, tt := range tests {
+		requests := make([]proto.Request, len(tt.states))
+		for i, s := range tt.states {
+			requests[i] = proto.Request{State: s}
+		}
+		group.Aggregate(&g, requests)
+		if g.State != tt.expect {
+			t.Errorf("states %v: got state %s, expected %s", tt.states, proto.StateName[g.State], proto.StateName[tt.expect])
+		}
+	}
+}
@@ -7,30 +7,54 @@ import (
 	"context"
 	"database/sql"
 
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/square/spincycle/v2/config"
 	serr "github.com/square/spincycle/v2/errors"
 	"github.com/square/spincycle/v2/proto"
 )
 
 // A Store reads and writes job logs to/from a persistent datastore.
 type Store interface {
-	// Create saves a JL to the db.
+	// Create saves a JL to the db. If the job try already has a JL, it returns
+	// serr.ErrDuplicateJobLog.
 	Create(requestId string, jl proto.JobLog) (proto.JobLog, error)
 
 	// Get gets a single JL.
 	Get(requestId string, jobId string) (proto.JobLog, error)
 
-	// GetFull gets all of the JLs for a request.
-	GetFull(requestId string) ([]proto.JobLog, error)
+	// GetFull gets all of the JLs for a request that match the filter.
+	GetFull(requestId string, f proto.JobLogFilter) ([]proto.JobLog, error)
 }
 
+// Max lengths of job_log columns. Create truncates strings to these lengths even
+// if the configured limits are greater or zero, so MySQL never fails or silently
+// truncates them.
+const (
+	maxNameLen          = 100   // job_log.name VARBINARY(100)
+	maxTypeLen          = 75    // job_log.type VARBINARY(75)
+	maxErrorLen         = 65535 // job_log.error TEXT
+	maxErrorCategoryLen = 64    // job_log.error_category VARCHAR(64)
+	maxErrorCodeLen     = 64    // job_log.error_code VARCHAR(64)
+)
+
+// MySQL error ER_DUP_ENTRY: job_log primary key (request_id, job_id, try) exists
+const errDupEntry = 1062
+
 // store implements the Store interface
 type store struct {
-	dbc *sql.DB
+	dbc     *sql.DB
+	maxName uint
+	maxErr  uint
 }
 
-func NewStore(dbc *sql.DB) Store {
+// NewStore returns a Store that saves job logs in the db. Job names and errors
+// longer than the limits are truncated (see proto.Truncate).
+func NewStore(dbc *sql.DB, limits config.Limits) Store {
 	return &store{
-		dbc: dbc,
+		dbc:     dbc,
+		maxName: minLimit(limits.JobName, maxNameLen),
+		maxErr:  minLimit(limits.JobError, maxErrorLen),
 	}
 }
 
@@ -38,23 +62,51 @@ func (s *store) Create(requestId string, jl proto.JobLog) (proto.JobLog, error)
 	jl.RequestId = requestId
 	ctx := context.TODO()
 
-	q := "INSERT INTO job_log (request_id, job_id, name, try, type, started_at, finished_at, state, `exit`, " +
-		"error, stdout, stderr) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+	// Truncate strings longer than their limits or columns, and return the
+	// truncated JL so the caller sees what was saved
+	jl.Name = proto.Truncate(jl.Name, s.maxName)
+	jl.Type = proto.Truncate(jl.Type, maxTypeLen)
+	jl.Error = proto.Truncate(jl.Error, s.maxErr)
+	jl.ErrorCategory = proto.Truncate(jl.ErrorCategory, maxErrorCategoryLen)
+	jl.ErrorCode = proto.Truncate(jl.ErrorCode, maxErrorCodeLen)
+
+	// If ErrorCategory or ErrorCode is empty, we want to set the db field to NULL
+	// (not an empty string).
+	var errCategory, errCode interface{}
+	if jl.ErrorCategory != "" {
+		errCategory = jl.ErrorCategory
+	}
+	if jl.ErrorCode != "" {
+		errCode = jl.ErrorCode
+	}
+
+	q := "INSERT INTO job_log (request_id, job_id, name, try, sequence_try, type, started_at, finished_at, queue_delay, cpu_time, max_memory, state, `exit`, " +
+		"error, error_category, error_code, error_retryable, stdout, stderr) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 	_, err := s.dbc.ExecContext(ctx, q,
 		&jl.RequestId,
 		&jl.JobId,
 		&jl.Name,
 		&jl.Try,
+		&jl.SequenceTry,
 		&jl.Type,
 		&jl.StartedAt,
 		&jl.FinishedAt,
+		&jl.QueueDelay,
+		&jl.CPUTime,
+		&jl.MaxMemory,
 		&jl.State,
 		&jl.Exit,
 		&jl.Error,
+		errCategory,
+		errCode,
+		&jl.ErrorRetryable,
 		&jl.Stdout,
 		&jl.Stderr,
 	)
 	if err != nil {
+		if myerr, ok := err.(*mysql.MySQLError); ok && myerr.Number == errDupEntry {
+			return jl, serr.ErrDuplicateJobLog{RequestId: jl.RequestId, JobId: jl.JobId, Try: jl.Try}
+		}
 		return jl, err
 	}
 
@@ -65,10 +117,10 @@ func (s *store) Get(requestId, jobId string) (proto.JobLog, error) {
 	var jl proto.JobLog
 	ctx := context.TODO()
 
-	var jErr, stdout, stderr sql.NullString // nullable columns
+	var jErr, errCategory, errCode, stdout, stderr sql.NullString // nullable columns
 	var exit sql.NullInt64
 
-	q := "SELECT request_id, job_id, name, type, state, started_at, finished_at, error, `exit`, stdout, stderr, try " +
+	q := "SELECT request_id, job_id, name, type, state, started_at, finished_at, queue_delay, cpu_time, max_memory, error, error_category, error_code, error_retryable, `exit`, stdout, stderr, try, sequence_try " +
 		" FROM job_log WHERE request_id = ? AND job_id = ? ORDER BY try DESC LIMIT 1"
 	err := s.dbc.QueryRowContext(ctx, q, requestId, jobId).Scan(
 		&jl.RequestId,
@@ -78,11 +130,18 @@ func (s *store) Get(requestId, jobId string) (proto.JobLog, error) {
 		&jl.State,
 		&jl.StartedAt,
 		&jl.FinishedAt,
+		&jl.QueueDelay,
+		&jl.CPUTime,
+		&jl.MaxMemory,
 		&jErr,
+		&errCategory,
+		&errCode,
+		&jl.ErrorRetryable,
 		&exit,
 		&stdout,
 		&stderr,
 		&jl.Try,
+		&jl.SequenceTry,
 	)
 	switch {
 	case err == sql.ErrNoRows:
@@ -94,6 +153,12 @@ func (s *store) Get(requestId, jobId string) (proto.JobLog, error) {
 	if jErr.Valid {
 		jl.Error = jErr.String
 	}
+	if errCategory.Valid {
+		jl.ErrorCategory = errCategory.String
+	}
+	if errCode.Valid {
+		jl.ErrorCode = errCode.String
+	}
 	if stdout.Valid {
 		jl.Stdout = stdout.String
 	}
@@ -107,15 +172,35 @@ func (s *store) Get(requestId, jobId string) (proto.JobLog, error) {
 	return jl, nil
 }
 
-func (s *store) GetFull(requestId string) ([]proto.JobLog, error) {
+func (s *store) GetFull(requestId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
 	ctx := context.TODO()
 
-	var jErr, stdout, stderr sql.NullString // nullable columns
+	var jErr, errCategory, errCode, stdout, stderr sql.NullString // nullable columns
 	var exit sql.NullInt64
 
-	q := "SELECT job_id, name, try, type, state, started_at, finished_at, error, `exit`, stdout, stderr" +
+	// Select NULL instead of stdout and/or stderr to avoid reading them, so the
+	// columns scanned are the same either way.
+	output := "stdout, stderr"
+	switch {
+	case f.NoOutput:
+		output = "NULL, NULL"
+	case f.Stream == "stdout":
+		output = "stdout, NULL"
+	case f.Stream == "stderr":
+		output = "NULL, stderr"
+	}
+	q := "SELECT job_id, name, try, sequence_try, type, state, started_at, finished_at, queue_delay, cpu_time, max_memory, error, error_category, error_code, error_retryable, `exit`, " + output +
 		" FROM job_log WHERE request_id = ?"
-	rows, err := s.dbc.QueryContext(ctx, q, requestId)
+	values := []interface{}{requestId}
+	if f.ErrorsOnly {
+		q += " AND state != ?"
+		values = append(values, proto.STATE_COMPLETE)
+	}
+	if f.JobId != "" {
+		q += " AND job_id = ?"
+		values = append(values, f.JobId)
+	}
+	rows, err := s.dbc.QueryContext(ctx, q, values...)
 	if err != nil {
 		return nil, err
 	}
@@ -131,11 +216,18 @@ func (s *store) GetFull(requestId string) ([]proto.JobLog, error) {
 			&l.JobId,
 			&l.Name,
 			&l.Try,
+			&l.SequenceTry,
 			&l.Type,
 			&l.State,
 			&l.StartedAt,
 			&l.FinishedAt,
+			&l.QueueDelay,
+			&l.CPUTime,
+			&l.MaxMemory,
 			&jErr,
+			&errCategory,
+			&errCode,
+			&l.ErrorRetryable,
 			&exit,
 			&stdout,
 			&stderr,
@@ -147,6 +239,12 @@ func (s *store) GetFull(requestId string) ([]proto.JobLog, error) {
 		if jErr.Valid {
 			l.Error = jErr.String
 		}
+		if errCategory.Valid {
+			l.ErrorCategory = errCategory.String
+		}
+		if errCode.Valid {
+			l.ErrorCode = errCode.String
+		}
 		if stdout.Valid {
 			l.Stdout = stdout.String
 		}
@@ -165,3 +263,11 @@ func (s *store) GetFull(requestId string) ([]proto.JobLog, error) {
 
 	return jl, nil
 }
+
+// minLimit returns the configured limit, or max if the limit is zero or greater.
+func minLimit(limit, max uint) uint {
+	if limit == 0 || limit > max {
+		return max
+	}
+	return limit
+}
@@ -5,10 +5,12 @@ package joblog_test
 import (
 	"database/sql"
 	"sort"
+	"strings"
 	"testing"
 
 	"github.com/go-test/deep"
 
+	"github.com/square/spincycle/v2/config"
 	serr "github.com/square/spincycle/v2/errors"
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/request-manager/joblog"
@@ -61,7 +63,7 @@ func TestGetNotFound(t *testing.T) {
 
 	reqId := "invalid"
 	jobId := "abcd"
-	s := joblog.NewStore(dbc)
+	s := joblog.NewStore(dbc, config.Limits{})
 	_, err := s.Get(reqId, jobId)
 	if err != nil {
 		switch v := err.(type) {
@@ -90,14 +92,29 @@ func TestCreateAndGet(t *testing.T) {
 	}
 	jobId2 := "df2j"
 	jl2 := proto.JobLog{
-		RequestId: reqId,
-		JobId:     jobId2,
-		Type:      "something-else",
-		State:     proto.STATE_COMPLETE,
+		RequestId:   reqId,
+		JobId:       jobId2,
+		SequenceTry: 2,
+		QueueDelay:  1500000,
+		CPUTime:     250000000,
+		MaxMemory:   1048576,
+		Type:        "something-else",
+		State:       proto.STATE_COMPLETE,
+	}
+	jobId3 := "s8dn"
+	jl3 := proto.JobLog{
+		RequestId:      reqId,
+		JobId:          jobId3,
+		Type:           "something",
+		State:          proto.STATE_FAIL,
+		Error:          "connection refused",
+		ErrorCategory:  "infra",
+		ErrorCode:      "ECONNREFUSED",
+		ErrorRetryable: true,
 	}
-	jls := []proto.JobLog{jl1, jl2}
+	jls := []proto.JobLog{jl1, jl2, jl3}
 
-	s := joblog.NewStore(dbc)
+	s := joblog.NewStore(dbc, config.Limits{})
 	for _, j := range jls {
 		_, err := s.Create(reqId, j)
 		if err != nil {
@@ -114,6 +131,61 @@ func TestCreateAndGet(t *testing.T) {
 	if diff := deep.Equal(actualJl, jl2); diff != nil {
 		t.Error(diff)
 	}
+
+	// Structured job error fields are saved, too
+	actualJl, err = s.Get(reqId, jobId3)
+	if err != nil {
+		t.Errorf("error = %s, expected nil", err)
+	}
+	if diff := deep.Equal(actualJl, jl3); diff != nil {
+		t.Error(diff)
+	}
+
+	// Same job try again
+	_, err = s.Create(reqId, jl1)
+	if _, ok := err.(serr.ErrDuplicateJobLog); !ok {
+		t.Errorf("got err %v, expected serr.ErrDuplicateJobLog", err)
+	}
+}
+
+func TestCreateTruncate(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/jl-default.sql")
+	defer teardown(t, dbName)
+
+	reqId := "fa0d862f16casg200lkf"
+	jl := proto.JobLog{
+		RequestId:     reqId,
+		JobId:         "fh17",
+		Name:          strings.Repeat("n", 150), // longer than job_log.name
+		Type:          "something",
+		State:         proto.STATE_FAIL,
+		Error:         strings.Repeat("e", 100),
+		ErrorCategory: strings.Repeat("c", 100), // longer than job_log.error_category
+	}
+
+	s := joblog.NewStore(dbc, config.Limits{JobError: 50})
+	created, err := s.Create(reqId, jl)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if len(created.Name) != 100 || !strings.HasSuffix(created.Name, proto.TRUNCATED_MARKER) {
+		t.Errorf("name not truncated to column size: %s", created.Name)
+	}
+	if len(created.Error) != 50 || !strings.HasSuffix(created.Error, proto.TRUNCATED_MARKER) {
+		t.Errorf("error not truncated to configured limit: %s", created.Error)
+	}
+	if len(created.ErrorCategory) != 64 {
+		t.Errorf("error category not truncated to column size: %s", created.ErrorCategory)
+	}
+
+	// What's saved is what Create returned
+	actualJl, err := s.Get(reqId, jl.JobId)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if diff := deep.Equal(actualJl, created); diff != nil {
+		t.Error(diff)
+	}
 }
 
 func TestGetFull(t *testing.T) {
@@ -121,8 +193,8 @@ func TestGetFull(t *testing.T) {
 	defer teardown(t, dbName)
 
 	reqId := "fa0d862f16casg200lkf"
-	s := joblog.NewStore(dbc)
-	a, err := s.GetFull(reqId)
+	s := joblog.NewStore(dbc, config.Limits{})
+	a, err := s.GetFull(reqId, proto.JobLogFilter{})
 	if err != nil {
 		t.Errorf("error = %s, expected nil", err)
 	}
@@ -145,4 +217,19 @@ func TestGetFull(t *testing.T) {
 	if diff := deep.Equal(actual, expected); diff != nil {
 		t.Error(diff)
 	}
+
+	// Only tries of one job
+	jobId := e[0].JobId
+	a, err = s.GetFull(reqId, proto.JobLogFilter{JobId: jobId})
+	if err != nil {
+		t.Errorf("error = %s, expected nil", err)
+	}
+	if len(a) == 0 {
+		t.Errorf("no JLs for job %s, expected at least 1", jobId)
+	}
+	for _, j := range a {
+		if j.JobId != jobId {
+			t.Errorf("got JL for job %s, expected only job %s", j.JobId, jobId)
+		}
+	}
 }
@@ -0,0 +1,188 @@
+// Copyright 2020, Square, Inc.
+
+// Package placement provides placement policies, which choose the Job Runner
+// that runs a request.
+package placement
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+// Names of the built-in policies, used in request specs (spec.Placement.Policy).
+const (
+	ROUND_ROBIN    = "round-robin"
+	LEAST_LOADED   = "least-loaded"
+	LABEL_AFFINITY = "label-affinity"
+)
+
+// Input is what a Policy uses to choose a Job Runner for a request.
+type Input struct {
+	Request   proto.Request     // request being started, with its job chain
+	ChainSize int               // number of jobs in the job chain
+	Labels    map[string]string // request spec placement labels (spec.Placement.Labels)
+
+	// JobRunners are the Job Runners that pushed their status recently (config.StatusPush),
+	// in order by URL. It's empty if Job Runners don't push status.
+	JobRunners []proto.JobRunnerStatus
+}
+
+// A Policy chooses the Job Runner that runs a request when the request is started.
+// Request specs set the policy for each request type (spec.Placement); request
+// types without one are sent to the default Job Runner URL (config.RequestManager.JRClient),
+// usually a load balancer. Policies must be safe to call concurrently.
+//
+// To add a custom policy, set App.Context.Plugins.Placement.
+type Policy interface {
+	// Place returns the base URL of the Job Runner to run the request, or an
+	// empty string for the default Job Runner URL. If an error is returned,
+	// the request is not started.
+	Place(Input) (string, error)
+}
+
+// ErrNoJobRunner is returned by a Policy when no Job Runner can run the request.
+type ErrNoJobRunner struct {
+	Policy string
+	Labels map[string]string
+}
+
+func (e ErrNoJobRunner) Error() string {
+	if len(e.Labels) == 0 {
+		return fmt.Sprintf("placement policy %s: no Job Runner available", e.Policy)
+	}
+	return fmt.Sprintf("placement policy %s: no Job Runner available with labels %s", e.Policy, labelString(e.Labels))
+}
+
+// BuiltIn returns new instances of the built-in policies, keyed on name.
+func BuiltIn() map[string]Policy {
+	return map[string]Policy{
+		ROUND_ROBIN:    NewRoundRobin(),
+		LEAST_LOADED:   LeastLoaded{},
+		LABEL_AFFINITY: LabelAffinity{},
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// RoundRobin places requests on each Job Runner in turn. Overloaded Job Runners
+// are skipped. If no Job Runners push status, requests are sent to the default
+// Job Runner URL.
+type RoundRobin struct {
+	next uint
+	*sync.Mutex
+}
+
+func NewRoundRobin() *RoundRobin {
+	return &RoundRobin{
+		Mutex: &sync.Mutex{},
+	}
+}
+
+func (p *RoundRobin) Place(in Input) (string, error) {
+	if len(in.JobRunners) == 0 {
+		return "", nil
+	}
+	jrs := available(in.JobRunners)
+	if len(jrs) == 0 {
+		return "", ErrNoJobRunner{Policy: ROUND_ROBIN}
+	}
+	p.Lock()
+	i := p.next % uint(len(jrs))
+	p.next++
+	p.Unlock()
+	return jrs[i].JobRunnerURL, nil
+}
+
+// LeastLoaded places requests on the Job Runner running the fewest job chains.
+// Ties go to the first by URL. Overloaded Job Runners are skipped. If no Job
+// Runners push status, requests are sent to the default Job Runner URL.
+type LeastLoaded struct{}
+
+func (p LeastLoaded) Place(in Input) (string, error) {
+	if len(in.JobRunners) == 0 {
+		return "", nil
+	}
+	jrs := available(in.JobRunners)
+	if len(jrs) == 0 {
+		return "", ErrNoJobRunner{Policy: LEAST_LOADED}
+	}
+	return leastLoaded(jrs).JobRunnerURL, nil
+}
+
+// LabelAffinity places requests on the least-loaded Job Runner with all the
+// request spec placement labels (config.StatusPush.Labels). Unlike the other
+// policies, it returns ErrNoJobRunner if no Job Runners push status because it
+// cannot know which ones have the labels.
+type LabelAffinity struct{}
+
+func (p LabelAffinity) Place(in Input) (string, error) {
+	jrs := []proto.JobRunnerStatus{}
+	for _, jr := range available(in.JobRunners) {
+		if hasLabels(jr, in.Labels) {
+			jrs = append(jrs, jr)
+		}
+	}
+	if len(jrs) == 0 {
+		return "", ErrNoJobRunner{Policy: LABEL_AFFINITY, Labels: in.Labels}
+	}
+	return leastLoaded(jrs).JobRunnerURL, nil
+}
+
+// --------------------------------------------------------------------------
+
+// available returns the Job Runners that are not overloaded: they refuse new
+// job chains (config.Guardrails).
+func available(jrs []proto.JobRunnerStatus) []proto.JobRunnerStatus {
+	avail := make([]proto.JobRunnerStatus, 0, len(jrs))
+	for _, jr := range jrs {
+		if jr.Health != nil && jr.Health.Overloaded {
+			continue
+		}
+		avail = append(avail, jr)
+	}
+	return avail
+}
+
+func leastLoaded(jrs []proto.JobRunnerStatus) proto.JobRunnerStatus {
+	min := 0
+	for i := range jrs {
+		if Load(jrs[i]) < Load(jrs[min]) {
+			min = i
+		}
+	}
+	return jrs[min]
+}
+
+// Load returns the number of job chains running on the Job Runner: from its
+// health, if pushed, else the number of requests with running jobs.
+func Load(jr proto.JobRunnerStatus) int {
+	if jr.Health != nil && jr.Health.Chains != nil {
+		return len(jr.Health.Chains)
+	}
+	reqs := map[string]bool{}
+	for _, j := range jr.Jobs {
+		reqs[j.RequestId] = true
+	}
+	return len(reqs)
+}
+
+func hasLabels(jr proto.JobRunnerStatus, labels map[string]string) bool {
+	for k, v := range labels {
+		if val, ok := jr.Labels[k]; !ok || val != v {
+			return false
+		}
+	}
+	return true
+}
+
+func labelString(labels map[string]string) string {
+	s := make([]string, 0, len(labels))
+	for k, v := range labels {
+		s = append(s, k+"="+v)
+	}
+	sort.Strings(s)
+	return fmt.Sprintf("%v", s)
+}
@@ -0,0 +1,109 @@
+// Copyright 2020, Square, Inc.
+
+package placement_test
+
+import (
+	"testing"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/placement"
+)
+
+// jr1 runs 2 chains, jr2 runs 1 chain (from health), jr3 runs none but is overloaded
+func jobRunners() []proto.JobRunnerStatus {
+	return []proto.JobRunnerStatus{
+		{
+			JobRunnerURL: "http://jr1",
+			Jobs: []proto.JobStatus{
+				{RequestId: "req1", JobId: "job1"},
+				{RequestId: "req1", JobId: "job2"},
+				{RequestId: "req2", JobId: "job1"},
+			},
+			Labels: map[string]string{"zone": "east", "tier": "batch"},
+		},
+		{
+			JobRunnerURL: "http://jr2",
+			Health:       &proto.JobRunnerHealth{Chains: map[string]uint{"req3": 10}},
+			Labels:       map[string]string{"zone": "east"},
+		},
+		{
+			JobRunnerURL: "http://jr3",
+			Health:       &proto.JobRunnerHealth{Overloaded: true},
+			Labels:       map[string]string{"zone": "west"},
+		},
+	}
+}
+
+func TestRoundRobin(t *testing.T) {
+	p := placement.NewRoundRobin()
+	in := placement.Input{JobRunners: jobRunners()}
+	expect := []string{"http://jr1", "http://jr2", "http://jr1"} // jr3 overloaded
+	for i, e := range expect {
+		got, err := p.Place(in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != e {
+			t.Errorf("place %d: got %s, expected %s", i, got, e)
+		}
+	}
+
+	// No pushed status: default JR URL
+	got, err := p.Place(placement.Input{})
+	if err != nil {
+		t.Error(err)
+	}
+	if got != "" {
+		t.Errorf("got %s, expected empty string (default JR URL)", got)
+	}
+
+	// All overloaded
+	in.JobRunners = in.JobRunners[2:]
+	if _, err := p.Place(in); err == nil {
+		t.Error("no error with all Job Runners overloaded, expected ErrNoJobRunner")
+	}
+}
+
+func TestLeastLoaded(t *testing.T) {
+	got, err := placement.LeastLoaded{}.Place(placement.Input{JobRunners: jobRunners()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://jr2" {
+		t.Errorf("got %s, expected http://jr2", got)
+	}
+}
+
+func TestLabelAffinity(t *testing.T) {
+	p := placement.LabelAffinity{}
+
+	// jr1 and jr2 in zone east, jr2 less loaded
+	got, err := p.Place(placement.Input{JobRunners: jobRunners(), Labels: map[string]string{"zone": "east"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://jr2" {
+		t.Errorf("got %s, expected http://jr2", got)
+	}
+
+	// Only jr1 has both labels
+	got, err = p.Place(placement.Input{JobRunners: jobRunners(), Labels: map[string]string{"zone": "east", "tier": "batch"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "http://jr1" {
+		t.Errorf("got %s, expected http://jr1", got)
+	}
+
+	// Only jr3 in zone west, but it's overloaded
+	_, err = p.Place(placement.Input{JobRunners: jobRunners(), Labels: map[string]string{"zone": "west"}})
+	if _, ok := err.(placement.ErrNoJobRunner); !ok {
+		t.Errorf("got error %v, expected ErrNoJobRunner", err)
+	}
+
+	// No pushed status: cannot know labels
+	_, err = p.Place(placement.Input{Labels: map[string]string{"zone": "east"}})
+	if _, ok := err.(placement.ErrNoJobRunner); !ok {
+		t.Errorf("got error %v, expected ErrNoJobRunner", err)
+	}
+}
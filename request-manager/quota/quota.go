@@ -0,0 +1,164 @@
+// Copyright 2020, Square, Inc.
+
+// Package quota provides per-user, per-team, and per-namespace request quotas.
+package quota
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// Day is the period of the daily quota (proto.Quota.MaxDaily). It is a rolling
+// period, not a calendar day.
+const Day = 24 * time.Hour
+
+// A Manager checks and sets request quotas. Quotas are saved in the quotas table
+// so they are shared by all Request Managers and can be changed without a restart.
+type Manager interface {
+	// Check returns nil if the user, team, and namespace can create another request,
+	// else it returns an errors.ErrQuotaExceeded. An empty team or namespace is not
+	// checked.
+	Check(user, team, namespace string) error
+
+	// List returns all quotas ordered by scope and name.
+	List() ([]proto.Quota, error)
+
+	// Set creates or updates a quota. If MaxRunning and MaxDaily are zero,
+	// the quota is removed (no limits).
+	Set(proto.Quota) error
+}
+
+// manager implements the Manager interface
+type manager struct {
+	dbc *sql.DB
+}
+
+func NewManager(dbc *sql.DB) Manager {
+	return &manager{
+		dbc: dbc,
+	}
+}
+
+// Requests in these states count toward MaxRunning.
+var runningStates = []interface{}{proto.STATE_PENDING, proto.STATE_RUNNING, proto.STATE_SUSPENDED}
+
+func (m *manager) Check(user, team, namespace string) error {
+	ctx := context.TODO()
+	checks := []struct {
+		scope string
+		name  string
+		col   string // requests column
+	}{
+		{proto.QUOTA_SCOPE_USER, user, "user"},
+		{proto.QUOTA_SCOPE_TEAM, team, "team"},
+		{proto.QUOTA_SCOPE_NAMESPACE, namespace, "namespace"},
+	}
+	for _, c := range checks {
+		if c.name == "" {
+			continue
+		}
+		q, err := m.get(ctx, c.scope, c.name)
+		if err != nil {
+			return err
+		}
+
+		if q.MaxRunning > 0 {
+			var n uint
+			query := "SELECT COUNT(*) FROM requests WHERE " + c.col + " = ? AND state IN (?, ?, ?)"
+			args := append([]interface{}{c.name}, runningStates...)
+			if err := m.dbc.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+				return serr.NewDbError(err, "SELECT requests")
+			}
+			if n >= q.MaxRunning {
+				return serr.ErrQuotaExceeded{
+					Message: fmt.Sprintf("%s %s has %d pending, running, or suspended requests, max is %d: wait for a request to finish, or stop one",
+						c.scope, c.name, n, q.MaxRunning),
+				}
+			}
+		}
+
+		if q.MaxDaily > 0 {
+			var n uint
+			since := time.Now().UTC().Add(-Day)
+			query := "SELECT COUNT(*) FROM requests WHERE " + c.col + " = ? AND created_at >= ?"
+			if err := m.dbc.QueryRowContext(ctx, query, c.name, since).Scan(&n); err != nil {
+				return serr.NewDbError(err, "SELECT requests")
+			}
+			if n >= q.MaxDaily {
+				return serr.ErrQuotaExceeded{
+					Message: fmt.Sprintf("%s %s created %d requests in the last 24 hours, max is %d: try again later",
+						c.scope, c.name, n, q.MaxDaily),
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// get returns the quota for the name, or the default quota for the scope if the
+// name has no quota, or a zero quota (no limits) if neither exist.
+func (m *manager) get(ctx context.Context, scope, name string) (proto.Quota, error) {
+	q := proto.Quota{Scope: scope}
+	// ORDER BY name DESC: name before default ("")
+	query := "SELECT name, max_running, max_daily FROM quotas WHERE scope = ? AND name IN (?, '') ORDER BY name DESC LIMIT 1"
+	err := m.dbc.QueryRowContext(ctx, query, scope, name).Scan(&q.Name, &q.MaxRunning, &q.MaxDaily)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		q.Name = name
+	default:
+		return q, serr.NewDbError(err, "SELECT quotas")
+	}
+	return q, nil
+}
+
+func (m *manager) List() ([]proto.Quota, error) {
+	ctx := context.TODO()
+	rows, err := m.dbc.QueryContext(ctx, "SELECT scope, name, max_running, max_daily FROM quotas ORDER BY scope, name")
+	if err != nil {
+		return nil, serr.NewDbError(err, "SELECT quotas")
+	}
+	defer rows.Close()
+	quotas := []proto.Quota{}
+	for rows.Next() {
+		var q proto.Quota
+		if err := rows.Scan(&q.Scope, &q.Name, &q.MaxRunning, &q.MaxDaily); err != nil {
+			return nil, err
+		}
+		quotas = append(quotas, q)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, serr.NewDbError(err, "SELECT quotas")
+	}
+	return quotas, nil
+}
+
+func (m *manager) Set(q proto.Quota) error {
+	if q.Scope != proto.QUOTA_SCOPE_USER && q.Scope != proto.QUOTA_SCOPE_TEAM && q.Scope != proto.QUOTA_SCOPE_NAMESPACE {
+		return serr.ValidationError{
+			Message: fmt.Sprintf("invalid quota scope '%s': expected %s, %s, or %s", q.Scope,
+				proto.QUOTA_SCOPE_USER, proto.QUOTA_SCOPE_TEAM, proto.QUOTA_SCOPE_NAMESPACE),
+		}
+	}
+	ctx := context.TODO()
+	if q.MaxRunning == 0 && q.MaxDaily == 0 {
+		_, err := m.dbc.ExecContext(ctx, "DELETE FROM quotas WHERE scope = ? AND name = ?", q.Scope, q.Name)
+		if err != nil {
+			return serr.NewDbError(err, "DELETE quotas")
+		}
+		return nil
+	}
+	_, err := m.dbc.ExecContext(ctx,
+		"INSERT INTO quotas (scope, name, max_running, max_daily) VALUES (?, ?, ?, ?)"+
+			" ON DUPLICATE KEY UPDATE max_running = VALUES(max_running), max_daily = VALUES(max_daily)",
+		q.Scope, q.Name, q.MaxRunning, q.MaxDaily)
+	if err != nil {
+		return serr.NewDbError(err, "INSERT quotas")
+	}
+	return nil
+}
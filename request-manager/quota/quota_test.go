@@ -0,0 +1,142 @@
+// Copyright 2020, Square, Inc.
+
+package quota_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/quota"
+	"github.com/square/spincycle/v2/request-manager/test"
+	testdb "github.com/square/spincycle/v2/request-manager/test/db"
+)
+
+var dbm testdb.Manager
+var dbc *sql.DB
+
+func setup(t *testing.T, dataFile string) string {
+	// Setup a db manager to handle databases for all tests.
+	var err error
+	if dbm == nil {
+		dbm, err = testdb.NewManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Setup a db for this specific test, and seed it with some default data.
+	dbName, err := dbm.Create(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := dbm.Connect(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbc = db
+
+	return dbName
+}
+
+func teardown(t *testing.T, dbName string) {
+	if err := dbm.Destroy(dbName); err != nil {
+		t.Fatal(err)
+	}
+	dbc.Close()
+}
+
+// //////////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////////
+
+func TestCheck(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/quota-default.sql")
+	defer teardown(t, dbName)
+
+	m := quota.NewManager(dbc)
+
+	// alice has 2 pending or running requests, her max
+	err := m.Check("alice", "", "")
+	if _, ok := err.(serr.ErrQuotaExceeded); !ok {
+		t.Errorf("err = %v, expected errors.ErrQuotaExceeded", err)
+	}
+
+	// carol has no requests and the default user quota
+	if err := m.Check("carol", "", ""); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+
+	// bob (team dba) created 2 requests today, team max is 3
+	if err := m.Check("bob", "dba", ""); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+
+	// Lower team dba max to 2
+	if err := m.Set(proto.Quota{Scope: proto.QUOTA_SCOPE_TEAM, Name: "dba", MaxDaily: 2}); err != nil {
+		t.Fatal(err)
+	}
+	err = m.Check("bob", "dba", "")
+	if _, ok := err.(serr.ErrQuotaExceeded); !ok {
+		t.Errorf("err = %v, expected errors.ErrQuotaExceeded", err)
+	}
+
+	// Removing alice's quota makes the default user quota (10) apply
+	if err := m.Set(proto.Quota{Scope: proto.QUOTA_SCOPE_USER, Name: "alice"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check("alice", "", ""); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+
+	// Namespace payments has 1 running request, its max
+	err = m.Check("carol", "", "payments")
+	if _, ok := err.(serr.ErrQuotaExceeded); !ok {
+		t.Errorf("err = %v, expected errors.ErrQuotaExceeded", err)
+	}
+
+	// Other namespaces have no quota
+	if err := m.Check("carol", "", "dba"); err != nil {
+		t.Errorf("err = %s, expected nil", err)
+	}
+}
+
+func TestListAndSet(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/quota-default.sql")
+	defer teardown(t, dbName)
+
+	m := quota.NewManager(dbc)
+
+	// Update alice, add default team quota
+	if err := m.Set(proto.Quota{Scope: proto.QUOTA_SCOPE_USER, Name: "alice", MaxRunning: 5, MaxDaily: 20}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Set(proto.Quota{Scope: proto.QUOTA_SCOPE_TEAM, MaxRunning: 50}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []proto.Quota{
+		{Scope: proto.QUOTA_SCOPE_NAMESPACE, Name: "payments", MaxRunning: 1},
+		{Scope: proto.QUOTA_SCOPE_TEAM, Name: "", MaxRunning: 50},
+		{Scope: proto.QUOTA_SCOPE_TEAM, Name: "dba", MaxDaily: 3},
+		{Scope: proto.QUOTA_SCOPE_USER, Name: "", MaxRunning: 10},
+		{Scope: proto.QUOTA_SCOPE_USER, Name: "alice", MaxRunning: 5, MaxDaily: 20},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Invalid scope
+	err = m.Set(proto.Quota{Scope: "org", Name: "sq", MaxRunning: 1})
+	if _, ok := err.(serr.ValidationError); !ok {
+		t.Errorf("err = %v, expected errors.ValidationError", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Copyright 2020, Square, Inc.
+
+// Package reconcile provides the reconciler, which finds and fixes running requests
+// lost by Job Runners.
+package reconcile
+
+import (
+	"expvar"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	jr "github.com/square/spincycle/v2/job-runner"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/joblog"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+// Reconciler metrics published as expvars (GET /debug/vars on the Request Manager API).
+var (
+	// StaleRequests counts running requests reconciled because their Job Runner
+	// no longer knows about them.
+	StaleRequests = expvar.NewInt("stale_requests")
+
+	// StaleRequestsFailed counts stale requests set to STATE_FAIL.
+	StaleRequestsFailed = expvar.NewInt("stale_requests_failed")
+
+	// StaleRequestsSuspended counts stale requests suspended from their last
+	// checkpoint to be resumed.
+	StaleRequestsSuspended = expvar.NewInt("stale_requests_suspended")
+
+	// StaleRequestsTakenOver counts stale requests suspended from their last
+	// checkpoint to be resumed on the standby Job Runner. They're also counted
+	// in StaleRequestsSuspended.
+	StaleRequestsTakenOver = expvar.NewInt("stale_requests_taken_over")
+)
+
+// A Reconciler finds running requests that their Job Runner no longer knows about
+// because it crashed without suspending them, and fails or suspends them. Without
+// it, those requests are RUNNING forever.
+//
+// A running request is stale if its Job Runner does not have its job chain or
+// cannot be reached. Requests must be stale for the grace period before they're
+// reconciled, so a Job Runner that's restarting or briefly unreachable, or
+// a final request state that's queued in a Job Runner (config.Delivery), isn't
+// mistaken for a lost request. Stale requests are failed unless resume is enabled,
+// in which case they're suspended from their last checkpoint: the job log. Jobs
+// with a completed latest try are not run again, but all other jobs are, including
+// jobs that were running when the Job Runner crashed. A request with a failed job
+// is always failed.
+//
+// If a takeover URL is set, stale requests are suspended (like resume enabled) and
+// resumed on that Job Runner: a warm standby (config.Standby) that takes over the
+// requests of failed Job Runners. The failed Job Runner is fenced: if it comes back,
+// the Request Manager rejects the final state of the request from it because the
+// request is running on the standby (see proto.FinishRequest.JobRunnerURL).
+//
+// A partitioned request (proto.Request.Partitions) is never stale: it has no Job
+// Runner. Its partition requests are reconciled, and it's finished when they are.
+//
+// Request state changes are made by the Request Manager and Resumer, so they're
+// validated, logged, and sent to the RequestStateChanged hook like any other.
+type Reconciler interface {
+	// Reconcile checks all running requests once and reconciles the ones that
+	// have been stale for the grace period. Errors are logged, not returned.
+	// It is not safe to call concurrently.
+	Reconcile()
+}
+
+type Config struct {
+	RequestManager request.Manager
+	Resumer        request.Resumer
+	JobLogStore    joblog.Store
+	JRClient       jr.Client
+	Grace          time.Duration // how long a request must be stale to be reconciled
+	Resume         bool          // suspend stale requests instead of failing them
+	TakeoverURL    string        // resume stale requests on this standby JR (implies Resume)
+}
+
+// reconciler implements the Reconciler interface.
+type reconciler struct {
+	rm     request.Manager
+	rr     request.Resumer
+	jls    joblog.Store
+	jrc    jr.Client
+	grace  time.Duration
+	resume bool
+	jrURL  string               // standby JR that takes over stale requests
+	stale  map[string]time.Time // request ID -> when first found stale
+}
+
+func NewReconciler(cfg Config) Reconciler {
+	return &reconciler{
+		rm:     cfg.RequestManager,
+		rr:     cfg.Resumer,
+		jls:    cfg.JobLogStore,
+		jrc:    cfg.JRClient,
+		grace:  cfg.Grace,
+		resume: cfg.Resume || cfg.TakeoverURL != "",
+		jrURL:  cfg.TakeoverURL,
+		stale:  map[string]time.Time{},
+	}
+}
+
+func (r *reconciler) Reconcile() {
+	requests, err := r.rm.Find(proto.RequestFilter{States: []byte{proto.STATE_RUNNING}})
+	if err != nil {
+		log.Errorf("reconciler: error finding running requests: %s", err)
+		return
+	}
+
+	now := time.Now()
+	running := map[string]bool{}
+	unreachable := map[string]bool{} // JR URL -> true, so each is tried only once
+	for _, req := range requests {
+		running[req.Id] = true
+		if req.Partitions > 0 {
+			// A partitioned request has no Job Runner. It's finished when all
+			// its partition requests are, which are reconciled like any other,
+			// but one finished by the Resumer (e.g. FAILED_RESUME) doesn't
+			// finish it, so check here.
+			if err := r.rm.FinishPartitions(req.Id); err != nil {
+				log.Errorf("reconciler: error finishing partitioned request %s: %s", req.Id, err)
+			}
+			continue
+		}
+		if !r.isStale(req, unreachable) {
+			delete(r.stale, req.Id)
+			continue
+		}
+		first, ok := r.stale[req.Id]
+		if !ok {
+			log.Warnf("reconciler: request %s is running but its Job Runner %s does not have it, reconciling in %s if still stale",
+				req.Id, req.JobRunnerURL, r.grace)
+			r.stale[req.Id] = now
+			first = now
+		}
+		if now.Sub(first) < r.grace {
+			continue
+		}
+		if r.reconcile(req) {
+			delete(r.stale, req.Id)
+		}
+	}
+
+	// Forget stale requests that are no longer running because they finished,
+	// were suspended, or were reconciled by another Request Manager
+	for id := range r.stale {
+		if !running[id] {
+			delete(r.stale, id)
+		}
+	}
+}
+
+// isStale returns true if the request's Job Runner does not have its job chain
+// or cannot be reached.
+func (r *reconciler) isStale(req proto.Request, unreachable map[string]bool) bool {
+	if req.JobRunnerURL == "" || unreachable[req.JobRunnerURL] {
+		return true
+	}
+	has, err := r.jrc.HasJobChain(req.JobRunnerURL, req.Id)
+	if err != nil {
+		log.Warnf("reconciler: cannot reach Job Runner %s: %s", req.JobRunnerURL, err)
+		unreachable[req.JobRunnerURL] = true
+		return true
+	}
+	return !has
+}
+
+// reconcile fails or suspends a stale request. It returns true if the request
+// was reconciled, or false on error to retry on the next call to Reconcile.
+func (r *reconciler) reconcile(req proto.Request) bool {
+	rlog := log.WithFields(log.Fields{"request_id": req.Id, "jr_url": req.JobRunnerURL})
+
+	sjc, failed, err := r.checkpoint(req.Id)
+	if err != nil {
+		rlog.Errorf("reconciler: error getting last checkpoint of stale request: %s", err)
+		return false
+	}
+
+	if r.resume && !failed {
+		sjc.JobRunnerURL = r.jrURL
+		if err := r.rr.Suspend(sjc); err != nil {
+			rlog.Errorf("reconciler: error suspending stale request: %s", err)
+			return false
+		}
+		StaleRequests.Add(1)
+		StaleRequestsSuspended.Add(1)
+		if r.jrURL != "" {
+			StaleRequestsTakenOver.Add(1)
+			rlog.Warnf("reconciler: suspended stale request to take over on standby Job Runner %s from last checkpoint (%d of %d jobs complete)",
+				r.jrURL, sjc.JobChain.FinishedJobs, len(sjc.JobChain.Jobs))
+			return true
+		}
+		rlog.Warnf("reconciler: suspended stale request to resume from last checkpoint (%d of %d jobs complete)",
+			sjc.JobChain.FinishedJobs, len(sjc.JobChain.Jobs))
+		return true
+	}
+
+	fr := proto.FinishRequest{
+		RequestId:    req.Id,
+		State:        proto.STATE_FAIL,
+		FinishedAt:   time.Now().UTC(),
+		FinishedJobs: sjc.JobChain.FinishedJobs,
+	}
+	if err := r.rm.Finish(req.Id, fr); err != nil {
+		rlog.Errorf("reconciler: error failing stale request: %s", err)
+		return false
+	}
+	StaleRequests.Add(1)
+	StaleRequestsFailed.Add(1)
+	rlog.Warnf("reconciler: failed stale request (%d of %d jobs complete)", fr.FinishedJobs, len(sjc.JobChain.Jobs))
+	return true
+}
+
+// checkpoint returns a suspended job chain for the request from its job log:
+// jobs with a completed latest try are complete, and all other jobs are pending.
+// It returns failed = true if the latest try of any job failed.
+func (r *reconciler) checkpoint(requestId string) (sjc proto.SuspendedJobChain, failed bool, err error) {
+	jc, err := r.rm.JobChain(requestId)
+	if err != nil {
+		return sjc, false, err
+	}
+	jls, err := r.jls.GetFull(requestId, proto.JobLogFilter{NoOutput: true})
+	if err != nil {
+		return sjc, false, err
+	}
+
+	// Latest try and its state for each job that ran
+	tries := map[string]uint{}
+	states := map[string]byte{}
+	for _, jl := range jls {
+		if jl.Try >= tries[jl.JobId] {
+			tries[jl.JobId] = jl.Try
+			states[jl.JobId] = jl.State
+		}
+	}
+
+	// Job tries in the job log are total tries. Pending jobs are run again with
+	// a new latest run, so they get all their retries.
+	sjc = proto.SuspendedJobChain{
+		RequestId:         requestId,
+		JobChain:          &jc,
+		TotalJobTries:     tries,
+		LatestRunJobTries: map[string]uint{},
+		SequenceTries:     map[string]uint{},
+	}
+	jc.FinishedJobs = 0
+	for id, job := range jc.Jobs {
+		switch states[id] {
+		case proto.STATE_COMPLETE:
+			job.State = proto.STATE_COMPLETE
+			sjc.LatestRunJobTries[id] = tries[id]
+			jc.FinishedJobs++
+		case proto.STATE_FAIL:
+			job.State = proto.STATE_FAIL
+			failed = true
+		default:
+			job.State = proto.STATE_PENDING
+		}
+		jc.Jobs[id] = job
+	}
+	return sjc, failed, nil
+}
@@ -0,0 +1,301 @@
+// Copyright 2020, Square, Inc.
+
+package reconcile_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/reconcile"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+// Request req1 running on jr1 with a 3-job chain: job1 completed on its 2nd try,
+// job2 was stopped (by a JR that's gone now), and job3 never ran
+func setup(hasJobChain bool) (*mock.RequestManager, *mock.RequestResumer, *mock.JLStore, *mock.JRClient) {
+	rm := &mock.RequestManager{
+		FindFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			return []proto.Request{{Id: "req1", State: proto.STATE_RUNNING, JobRunnerURL: "http://jr1"}}, nil
+		},
+		JobChainFunc: func(string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId: "req1",
+				Jobs: map[string]proto.Job{
+					"job1": {Id: "job1", State: proto.STATE_PENDING},
+					"job2": {Id: "job2", State: proto.STATE_PENDING},
+					"job3": {Id: "job3", State: proto.STATE_PENDING},
+				},
+				AdjacencyList: map[string][]string{"job1": {"job2"}, "job2": {"job3"}},
+			}, nil
+		},
+	}
+	jls := &mock.JLStore{
+		GetFullFunc: func(string, proto.JobLogFilter) ([]proto.JobLog, error) {
+			return []proto.JobLog{
+				{RequestId: "req1", JobId: "job1", Try: 1, State: proto.STATE_FAIL},
+				{RequestId: "req1", JobId: "job1", Try: 2, State: proto.STATE_COMPLETE},
+				{RequestId: "req1", JobId: "job2", Try: 1, State: proto.STATE_STOPPED},
+			}, nil
+		},
+	}
+	jrc := &mock.JRClient{
+		HasJobChainFunc: func(string, string) (bool, error) {
+			return hasJobChain, nil
+		},
+	}
+	return rm, &mock.RequestResumer{}, jls, jrc
+}
+
+func TestReconcileNotStale(t *testing.T) {
+	rm, rr, jls, jrc := setup(true)
+	var gotURL, gotId string
+	jrc.HasJobChainFunc = func(baseURL, requestId string) (bool, error) {
+		gotURL = baseURL
+		gotId = requestId
+		return true, nil
+	}
+	rm.FinishFunc = func(string, proto.FinishRequest) error {
+		t.Errorf("Finish called, expected no call because request is not stale")
+		return nil
+	}
+	rr.SuspendFunc = func(proto.SuspendedJobChain) error {
+		t.Errorf("Suspend called, expected no call because request is not stale")
+		return nil
+	}
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc, Resume: true})
+	r.Reconcile()
+
+	if gotURL != "http://jr1" || gotId != "req1" {
+		t.Errorf("HasJobChain called with %s, %s; expected http://jr1, req1", gotURL, gotId)
+	}
+}
+
+func TestReconcileFail(t *testing.T) {
+	rm, rr, jls, jrc := setup(false)
+	var gotFinish proto.FinishRequest
+	rm.FinishFunc = func(requestId string, fr proto.FinishRequest) error {
+		gotFinish = fr
+		return nil
+	}
+	rr.SuspendFunc = func(proto.SuspendedJobChain) error {
+		t.Errorf("Suspend called, expected no call because resume is disabled")
+		return nil
+	}
+	failed := reconcile.StaleRequestsFailed.Value()
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc})
+	r.Reconcile()
+
+	if gotFinish.RequestId != "req1" {
+		t.Fatalf("Finish not called for req1")
+	}
+	if gotFinish.State != proto.STATE_FAIL {
+		t.Errorf("finish state = %s, expected FAIL", proto.StateName[gotFinish.State])
+	}
+	if gotFinish.FinishedJobs != 1 {
+		t.Errorf("finished jobs = %d, expected 1", gotFinish.FinishedJobs)
+	}
+	if n := reconcile.StaleRequestsFailed.Value() - failed; n != 1 {
+		t.Errorf("stale_requests_failed += %d, expected 1", n)
+	}
+}
+
+func TestReconcileResume(t *testing.T) {
+	rm, rr, jls, jrc := setup(false)
+	rm.FinishFunc = func(string, proto.FinishRequest) error {
+		t.Errorf("Finish called, expected no call because request is resumable")
+		return nil
+	}
+	var gotSJC proto.SuspendedJobChain
+	rr.SuspendFunc = func(sjc proto.SuspendedJobChain) error {
+		gotSJC = sjc
+		return nil
+	}
+	suspended := reconcile.StaleRequestsSuspended.Value()
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc, Resume: true})
+	r.Reconcile()
+
+	expect := proto.SuspendedJobChain{
+		RequestId: "req1",
+		JobChain: &proto.JobChain{
+			RequestId: "req1",
+			Jobs: map[string]proto.Job{
+				"job1": {Id: "job1", State: proto.STATE_COMPLETE},
+				"job2": {Id: "job2", State: proto.STATE_PENDING},
+				"job3": {Id: "job3", State: proto.STATE_PENDING},
+			},
+			AdjacencyList: map[string][]string{"job1": {"job2"}, "job2": {"job3"}},
+			FinishedJobs:  1,
+		},
+		TotalJobTries:     map[string]uint{"job1": 2, "job2": 1},
+		LatestRunJobTries: map[string]uint{"job1": 2},
+		SequenceTries:     map[string]uint{},
+	}
+	if diff := deep.Equal(gotSJC, expect); diff != nil {
+		t.Error(diff)
+	}
+	if n := reconcile.StaleRequestsSuspended.Value() - suspended; n != 1 {
+		t.Errorf("stale_requests_suspended += %d, expected 1", n)
+	}
+}
+
+func TestReconcileTakeover(t *testing.T) {
+	// Takeover suspends stale requests to resume on the standby JR, even if
+	// resume is disabled
+	rm, rr, jls, jrc := setup(false)
+	rm.FinishFunc = func(string, proto.FinishRequest) error {
+		t.Errorf("Finish called, expected no call because request is taken over")
+		return nil
+	}
+	var gotSJC proto.SuspendedJobChain
+	rr.SuspendFunc = func(sjc proto.SuspendedJobChain) error {
+		gotSJC = sjc
+		return nil
+	}
+	takenOver := reconcile.StaleRequestsTakenOver.Value()
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc, TakeoverURL: "http://standby"})
+	r.Reconcile()
+
+	if gotSJC.RequestId != "req1" {
+		t.Fatalf("Suspend not called for req1")
+	}
+	if gotSJC.JobRunnerURL != "http://standby" {
+		t.Errorf("SJC JobRunnerURL = %s, expected http://standby", gotSJC.JobRunnerURL)
+	}
+	if n := reconcile.StaleRequestsTakenOver.Value() - takenOver; n != 1 {
+		t.Errorf("stale_requests_taken_over += %d, expected 1", n)
+	}
+}
+
+func TestReconcileResumeFailedJob(t *testing.T) {
+	// A request with a failed job is failed even if resume is enabled
+	rm, rr, jls, jrc := setup(false)
+	jls.GetFullFunc = func(string, proto.JobLogFilter) ([]proto.JobLog, error) {
+		return []proto.JobLog{
+			{RequestId: "req1", JobId: "job1", Try: 1, State: proto.STATE_COMPLETE},
+			{RequestId: "req1", JobId: "job2", Try: 1, State: proto.STATE_FAIL},
+		}, nil
+	}
+	var gotFinish proto.FinishRequest
+	rm.FinishFunc = func(requestId string, fr proto.FinishRequest) error {
+		gotFinish = fr
+		return nil
+	}
+	rr.SuspendFunc = func(proto.SuspendedJobChain) error {
+		t.Errorf("Suspend called, expected no call because a job failed")
+		return nil
+	}
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc, Resume: true})
+	r.Reconcile()
+
+	if gotFinish.State != proto.STATE_FAIL {
+		t.Errorf("finish state = %s, expected FAIL", proto.StateName[gotFinish.State])
+	}
+}
+
+func TestReconcileGrace(t *testing.T) {
+	rm, rr, jls, jrc := setup(false)
+	hasJobChain := false
+	jrc.HasJobChainFunc = func(string, string) (bool, error) {
+		return hasJobChain, nil
+	}
+	finished := 0
+	rm.FinishFunc = func(string, proto.FinishRequest) error {
+		finished++
+		return nil
+	}
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc, Grace: 100 * time.Millisecond})
+
+	// Stale but not for the grace period yet
+	r.Reconcile()
+	if finished != 0 {
+		t.Fatalf("request finished %d times, expected 0 during grace period", finished)
+	}
+
+	// JR has it again (e.g. was briefly unreachable), so it's not stale and
+	// the grace period starts over next time it's stale
+	hasJobChain = true
+	r.Reconcile()
+	hasJobChain = false
+	time.Sleep(150 * time.Millisecond)
+	r.Reconcile()
+	if finished != 0 {
+		t.Fatalf("request finished %d times, expected 0 because grace period restarted", finished)
+	}
+
+	// Stale for the grace period
+	time.Sleep(150 * time.Millisecond)
+	r.Reconcile()
+	if finished != 1 {
+		t.Errorf("request finished %d times, expected 1 after grace period", finished)
+	}
+}
+
+func TestReconcileJRUnreachable(t *testing.T) {
+	// Two requests on the same unreachable JR: it's tried only once, and both
+	// requests are stale
+	rm, rr, jls, jrc := setup(false)
+	rm.FindFunc = func(f proto.RequestFilter) ([]proto.Request, error) {
+		return []proto.Request{
+			{Id: "req1", State: proto.STATE_RUNNING, JobRunnerURL: "http://jr1"},
+			{Id: "req2", State: proto.STATE_RUNNING, JobRunnerURL: "http://jr1"},
+		}, nil
+	}
+	calls := 0
+	jrc.HasJobChainFunc = func(string, string) (bool, error) {
+		calls++
+		return false, mock.ErrJRClient
+	}
+	finished := []string{}
+	rm.FinishFunc = func(requestId string, fr proto.FinishRequest) error {
+		finished = append(finished, requestId)
+		return nil
+	}
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc})
+	r.Reconcile()
+
+	if calls != 1 {
+		t.Errorf("HasJobChain called %d times, expected 1", calls)
+	}
+	if diff := deep.Equal(finished, []string{"req1", "req2"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestReconcilePartitioned(t *testing.T) {
+	// Partitioned request has no JR, so it's never stale; it's finished from its
+	// partition requests instead
+	rm, rr, jls, jrc := setup(false)
+	rm.FindFunc = func(f proto.RequestFilter) ([]proto.Request, error) {
+		return []proto.Request{{Id: "req1", State: proto.STATE_RUNNING, Partitions: 2}}, nil
+	}
+	jrc.HasJobChainFunc = func(string, string) (bool, error) {
+		t.Errorf("HasJobChain called, expected no call for partitioned request")
+		return false, nil
+	}
+	rm.FinishFunc = func(string, proto.FinishRequest) error {
+		t.Errorf("Finish called, expected no call for partitioned request")
+		return nil
+	}
+	var gotId string
+	rm.FinishPartitionsFunc = func(requestId string) error {
+		gotId = requestId
+		return nil
+	}
+
+	r := reconcile.NewReconciler(reconcile.Config{RequestManager: rm, Resumer: rr, JobLogStore: jls, JRClient: jrc, Grace: 0})
+	r.Reconcile()
+
+	if gotId != "req1" {
+		t.Errorf("FinishPartitions called with '%s', expected req1", gotId)
+	}
+}
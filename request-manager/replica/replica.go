@@ -0,0 +1,154 @@
+// Copyright 2020, Square, Inc.
+
+// Package replica monitors the MySQL read replica that serves heavy read-only
+// API endpoints (config.ReadReplica).
+package replica
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Read replica metrics published as expvars (GET /debug/vars on the Request Manager API).
+var (
+	// Reads counts API reads served from the replica.
+	Reads = expvar.NewInt("replica_reads")
+
+	// Fallbacks counts API reads served from the primary because the replica
+	// lagged too much or could not be reached.
+	Fallbacks = expvar.NewInt("replica_fallbacks")
+)
+
+// CheckTimeout is how long Check waits for the replica to report its lag.
+var CheckTimeout = 5 * time.Second
+
+// A Replica reports if a read replica is usable and how stale it is. It's not
+// usable until it's checked.
+type Replica interface {
+	// Lag returns the replication lag at the last check, and true if the replica
+	// is usable: the last check succeeded and the lag is at most the max lag.
+	Lag() (time.Duration, bool)
+
+	// Check checks the replication lag once. Errors are logged and make the
+	// replica unusable until the next check succeeds. It is not safe to call
+	// concurrently.
+	Check()
+}
+
+// Config configures a Replica.
+type Config struct {
+	DB     *sql.DB       // replica connection pool
+	MaxLag time.Duration // max replication lag at which the replica is usable
+}
+
+// replica implements the Replica interface.
+type replica struct {
+	db     *sql.DB
+	maxLag time.Duration
+	// --
+	mux     *sync.Mutex // guards lag, ok, and checked
+	lag     time.Duration
+	ok      bool
+	checked bool
+}
+
+func NewReplica(cfg Config) Replica {
+	return &replica{
+		db:     cfg.DB,
+		maxLag: cfg.MaxLag,
+		mux:    &sync.Mutex{},
+	}
+}
+
+func (r *replica) Lag() (time.Duration, bool) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return r.lag, r.ok
+}
+
+func (r *replica) Check() {
+	lag, err := r.replicationLag()
+	ok := err == nil && lag <= r.maxLag
+
+	r.mux.Lock()
+	changed := ok != r.ok || !r.checked
+	r.lag = lag
+	r.ok = ok
+	r.checked = true
+	r.mux.Unlock()
+
+	// Log only changes, not every check
+	if !changed {
+		return
+	}
+	switch {
+	case err != nil:
+		log.Warnf("Read replica unusable, reading from primary: %s", err)
+	case !ok:
+		log.Warnf("Read replica lag %s greater than max %s, reading from primary", lag, r.maxLag)
+	default:
+		log.Infof("Read replica usable, lag %s", lag)
+	}
+}
+
+// replicationLag returns the lag reported by SHOW SLAVE STATUS.
+func (r *replica) replicationLag() (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), CheckTimeout)
+	defer cancel()
+	rows, err := r.db.QueryContext(ctx, "SHOW SLAVE STATUS")
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+		return 0, fmt.Errorf("not a replica: SHOW SLAVE STATUS returned no rows")
+	}
+	vals := make([]sql.RawBytes, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	if err := rows.Scan(ptrs...); err != nil {
+		return 0, fmt.Errorf("Error scanning row returned from MySQL: %s", err)
+	}
+	bytes := make([][]byte, len(vals))
+	for i, v := range vals {
+		bytes[i] = v
+	}
+	return ParseLag(cols, bytes)
+}
+
+// ParseLag returns the replication lag in a row of SHOW SLAVE STATUS, or SHOW
+// REPLICA STATUS in MySQL 8.0.22 and newer: column Seconds_Behind_Master or
+// Seconds_Behind_Source. It returns an error if the column is not found or NULL,
+// which means replication is not running.
+func ParseLag(cols []string, vals [][]byte) (time.Duration, error) {
+	for i, col := range cols {
+		if col != "Seconds_Behind_Master" && col != "Seconds_Behind_Source" {
+			continue
+		}
+		if i >= len(vals) || vals[i] == nil {
+			return 0, fmt.Errorf("replication not running: %s is NULL", col)
+		}
+		s, err := strconv.ParseUint(string(vals[i]), 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid %s: %s", col, err)
+		}
+		return time.Duration(s) * time.Second, nil
+	}
+	return 0, fmt.Errorf("SHOW SLAVE STATUS has no Seconds_Behind_Master column")
+}
@@ -0,0 +1,41 @@
+// Copyright 2020, Square, Inc.
+
+package replica_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/request-manager/replica"
+)
+
+func TestParseLag(t *testing.T) {
+	cols := []string{"Slave_IO_State", "Master_Host", "Seconds_Behind_Master", "SQL_Delay"}
+
+	lag, err := replica.ParseLag(cols, [][]byte{[]byte("Waiting for master"), []byte("db1"), []byte("3"), []byte("0")})
+	if err != nil {
+		t.Fatalf("got err '%s', expected nil", err)
+	}
+	if lag != 3*time.Second {
+		t.Errorf("lag = %s, expected 3s", lag)
+	}
+
+	// NULL: replication not running
+	if _, err := replica.ParseLag(cols, [][]byte{[]byte(""), []byte("db1"), nil, []byte("0")}); err == nil {
+		t.Errorf("no error for NULL Seconds_Behind_Master, expected one")
+	}
+
+	// MySQL 8.0.22 SHOW REPLICA STATUS
+	lag, err = replica.ParseLag([]string{"Replica_IO_State", "Seconds_Behind_Source"}, [][]byte{[]byte(""), []byte("0")})
+	if err != nil {
+		t.Fatalf("got err '%s', expected nil", err)
+	}
+	if lag != 0 {
+		t.Errorf("lag = %s, expected 0s", lag)
+	}
+
+	// No lag column
+	if _, err := replica.ParseLag([]string{"Variable_name"}, [][]byte{[]byte("x")}); err == nil {
+		t.Errorf("no error without Seconds_Behind_Master, expected one")
+	}
+}
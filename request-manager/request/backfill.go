@@ -0,0 +1,93 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// BackfillArgs saves the finalized request args (request_archives.args) of requests
+// created before request_args existed into request_args so they can be found by
+// arg value. Requests are processed in batches of batchSize in request ID order.
+// Requests that already have args in request_args are skipped, so it is safe to
+// run more than once and while the Request Manager is running. It returns the
+// number of requests backfilled.
+func BackfillArgs(db *sql.DB, batchSize uint) (uint, error) {
+	if batchSize == 0 {
+		return 0, fmt.Errorf("invalid batch size 0: must be greater than zero")
+	}
+	ctx := context.TODO()
+	q := "SELECT ra.request_id, ra.args FROM request_archives ra" +
+		" WHERE ra.request_id > ? AND NOT EXISTS (SELECT 1 FROM request_args a WHERE a.request_id = ra.request_id)" +
+		" ORDER BY ra.request_id LIMIT ?"
+
+	var total uint
+	lastId := ""
+	for {
+		type archive struct {
+			id   string
+			args []proto.RequestArg
+		}
+		batch := []archive{}
+		rows, err := db.QueryContext(ctx, q, lastId, batchSize)
+		if err != nil {
+			return total, serr.NewDbError(err, "SELECT request_archives")
+		}
+		var n uint
+		for rows.Next() {
+			var id string
+			var argsBytes []byte
+			if err := rows.Scan(&id, &argsBytes); err != nil {
+				rows.Close()
+				return total, err
+			}
+			n++
+			lastId = id
+			if len(argsBytes) == 0 {
+				continue // request without args
+			}
+			var args []proto.RequestArg
+			if err := json.Unmarshal(argsBytes, &args); err != nil {
+				log.Warnf("request %s: cannot unmarshal request args, skipping: %s", id, err)
+				continue
+			}
+			batch = append(batch, archive{id: id, args: args})
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return total, serr.NewDbError(err, "SELECT request_archives")
+		}
+
+		if len(batch) > 0 {
+			txn, err := db.BeginTx(ctx, nil)
+			if err != nil {
+				return total, err
+			}
+			for _, a := range batch {
+				// INSERT IGNORE in case a concurrent backfill saved the args first
+				if err := insertArgs(ctx, txn, "INSERT IGNORE", a.id, a.args); err != nil {
+					txn.Rollback()
+					return total, err
+				}
+			}
+			if err := txn.Commit(); err != nil {
+				return total, serr.NewDbError(err, "COMMIT request_args")
+			}
+			total += uint(len(batch))
+			log.Infof("backfilled args for %d requests (last request ID %s)", total, lastId)
+		}
+
+		if n < batchSize {
+			break // last batch
+		}
+	}
+	return total, nil
+}
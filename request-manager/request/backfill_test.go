@@ -0,0 +1,57 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/request-manager/request"
+	rmtest "github.com/square/spincycle/v2/request-manager/test"
+)
+
+func TestBackfillArgs(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-backfill-args.sql")
+	defer teardownManager(t, dbName)
+
+	// Batch size 1 to test paging through all requests
+	n, err := request.BackfillArgs(dbc, 1)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if n != 1 {
+		t.Errorf("backfilled %d requests, expected 1", n)
+	}
+
+	rows, err := dbc.Query("SELECT request_id, name, value FROM request_args ORDER BY request_id, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	got := [][3]string{}
+	for rows.Next() {
+		var row [3]string
+		if err := rows.Scan(&row[0], &row[1], &row[2]); err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, row)
+	}
+	expect := [][3]string{
+		{"b9uvdi8tk9kahl8ppvbg", "host", "db1"},
+		{"b9uvdi8tk9kahl8ppvbg", "port", "3306"},
+		{"d9uvdi8tk9kahl8ppvbg", "host", "db2"},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Running again is a no-op
+	n, err = request.BackfillArgs(dbc, 100)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if n != 0 {
+		t.Errorf("backfilled %d requests on second run, expected 0", n)
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// BuildJobChain builds the job chain of a new request like Manager.Create, but
+// offline: the request is not saved or started, and quotas, uniqueBy, and the
+// resolver plugin are not checked, so it needs no database or Job Runner. It's
+// used by the build-chain command to build job chains in spec CI pipelines and
+// to debug the grapher. The returned request has a new ID, its final args,
+// warnings, cost, and job chain.
+func BuildJobChain(rf graph.ResolverFactory, sequences map[string]*spec.Sequence, newReq proto.CreateRequest) (proto.Request, error) {
+	var req proto.Request
+	if newReq.Type == "" {
+		return req, serr.ErrInvalidCreateRequest{Message: "Type is empty, must be a request name"}
+	}
+	seq, ok := sequences[newReq.Type]
+	if !ok {
+		return req, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("request %s not found in specs", newReq.Type)}
+	}
+
+	req = proto.Request{
+		Id:        xid.New().String(),
+		Type:      newReq.Type,
+		CreatedAt: time.Now().UTC(),
+		State:     proto.STATE_PENDING,
+		User:      newReq.User,
+	}
+
+	resolver := rf.Make(req)
+	reqArgs, err := resolver.RequestArgs(newReq.Args)
+	if err != nil {
+		return req, err
+	}
+	req.Args = reqArgs
+
+	jobArgs := map[string]interface{}{}
+	for k, v := range newReq.Args {
+		jobArgs[k] = v
+	}
+	reqGraph, err := resolver.BuildRequestGraph(jobArgs)
+	if err != nil {
+		return req, err
+	}
+	req.Warnings = resolver.Warnings()
+	jc := NewJobChain(req, reqGraph)
+	setChainSpec(jc, seq)
+	req.JobChain = jc
+	req.TotalJobs = uint(len(jc.Jobs))
+
+	for _, job := range jc.Jobs {
+		req.Cost += job.Cost
+	}
+	if seq.Budget != nil && seq.Budget.Max > 0 && req.Cost > seq.Budget.Max {
+		return req, serr.ErrInvalidCreateRequest{
+			Message: fmt.Sprintf("request cost %d exceeds budget max %d", req.Cost, seq.Budget.Max),
+		}
+	}
+	return req, nil
+}
+
+// setChainSpec sets the job chain options from the request spec (sequence):
+// stop timeout and retry budget.
+func setChainSpec(jc *proto.JobChain, seq *spec.Sequence) {
+	jc.StopTimeout = seq.StopTimeout
+	if seq.RetryBudget != nil {
+		jc.RetryBudget = &proto.RetryBudget{
+			JobRetries:      seq.RetryBudget.JobRetries,
+			SequenceRetries: seq.RetryBudget.SequenceRetries,
+		}
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/id"
+	"github.com/square/spincycle/v2/request-manager/request"
+	"github.com/square/spincycle/v2/request-manager/spec"
+	rmtest "github.com/square/spincycle/v2/request-manager/test"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func buildSpecs(t *testing.T) (spec.Specs, graph.ResolverFactory) {
+	specs, result := spec.ParseSpec(rmtest.SpecPath + "/a-b-c.yaml")
+	if len(result.Errors) != 0 {
+		t.Fatal(result.Errors)
+	}
+	spec.ProcessSpecs(&specs)
+	specs.Sequences["three-nodes"].StopTimeout = "30s"
+	specs.Sequences["three-nodes"].RetryBudget = &spec.RetryBudget{JobRetries: 2}
+
+	gf := id.NewGeneratorFactory(4, 100)
+	seqGraphs, seqResults := graph.NewGrapher(specs, gf).CheckSequences()
+	if seqResults.AnyError {
+		t.Fatal(seqResults)
+	}
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"aJobType": &mock.Job{SetJobArgs: map[string]interface{}{"aArg": "aValue"}},
+			"bJobType": &mock.Job{},
+			"cJobType": &mock.Job{},
+		},
+	}
+	return specs, graph.NewResolverFactory(jf, specs.Sequences, seqGraphs, gf)
+}
+
+func TestBuildJobChain(t *testing.T) {
+	specs, rf := buildSpecs(t)
+	newReq := proto.CreateRequest{
+		Type: "three-nodes",
+		Args: map[string]interface{}{"foo": "foo-value"},
+	}
+	req, err := request.BuildJobChain(rf, specs.Sequences, newReq)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Id == "" || req.JobChain == nil || req.JobChain.RequestId != req.Id {
+		t.Fatalf("request %q has no job chain, or job chain has wrong request ID", req.Id)
+	}
+	if req.TotalJobs != uint(len(req.JobChain.Jobs)) {
+		t.Errorf("TotalJobs = %d, expected %d", req.TotalJobs, len(req.JobChain.Jobs))
+	}
+
+	// Job args set by job a are passed to job b
+	names := map[string]proto.Job{}
+	for _, j := range req.JobChain.Jobs {
+		names[j.Name] = j
+	}
+	for _, name := range []string{"a", "b", "c"} {
+		if _, ok := names[name]; !ok {
+			t.Errorf("no job %s in job chain", name)
+		}
+	}
+	if diff := deep.Equal(names["b"].Args, map[string]interface{}{"aArg": "aValue"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// Request spec options are set in the job chain
+	if req.JobChain.StopTimeout != "30s" {
+		t.Errorf("StopTimeout = %s, expected 30s", req.JobChain.StopTimeout)
+	}
+	if diff := deep.Equal(req.JobChain.RetryBudget, &proto.RetryBudget{JobRetries: 2}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestBuildJobChainErrors(t *testing.T) {
+	specs, rf := buildSpecs(t)
+
+	// Unknown request type
+	_, err := request.BuildJobChain(rf, specs.Sequences, proto.CreateRequest{Type: "nope"})
+	if _, ok := err.(serr.ErrInvalidCreateRequest); !ok {
+		t.Errorf("err = %v, expected ErrInvalidCreateRequest", err)
+	}
+
+	// Missing required arg
+	_, err = request.BuildJobChain(rf, specs.Sequences, proto.CreateRequest{Type: "three-nodes"})
+	if err == nil {
+		t.Error("no error, expected error for missing required arg foo")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	serr "github.com/square/spincycle/v2/errors"
+)
+
+// DEFAULT_BUILD_ESTIMATE is the estimated memory, in bytes, to build the job
+// chain of a request type that hasn't been built yet.
+const DEFAULT_BUILD_ESTIMATE = 1 << 20 // 1 MiB
+
+// ErrBuildQueueFull is returned by Create when the BuildPool queue is full.
+// The caller should try again later (HTTP 503).
+var ErrBuildQueueFull = errors.New("too many requests being created, try again later")
+
+// Chain build metrics published as expvars (GET /debug/vars on the Request Manager API).
+var (
+	// ChainBuildQueued is the number of builds waiting for a worker or memory.
+	ChainBuildQueued = expvar.NewInt("chain_build_queued")
+
+	// ChainBuildRunning is the number of builds in progress.
+	ChainBuildRunning = expvar.NewInt("chain_build_running")
+
+	// ChainBuildMemory is the estimated memory, in bytes, of builds in progress.
+	ChainBuildMemory = expvar.NewInt("chain_build_memory")
+
+	// ChainBuilds counts finished builds, successful or not.
+	ChainBuilds = expvar.NewInt("chain_builds")
+
+	// ChainBuildTime is the total time, in milliseconds, of finished builds.
+	// Divide by ChainBuilds for the average.
+	ChainBuildTime = expvar.NewInt("chain_build_time_ms")
+
+	// ChainBuildRejected counts builds rejected because the queue was full.
+	ChainBuildRejected = expvar.NewInt("chain_build_rejected")
+)
+
+type BuildPoolConfig struct {
+	Workers      uint  // max concurrent builds (0 = no max)
+	MaxQueued    uint  // max builds waiting (0 = no max)
+	MaxMemory    int64 // max estimated bytes of concurrent builds (0 = no max)
+	MaxChainSize int64 // max bytes of one job chain (0 = no max)
+}
+
+// A BuildPool limits concurrent job chain builds so that creating many large
+// requests at once doesn't spike Request Manager memory. A build waits until a
+// worker is free and its estimated memory fits under the max. The estimate is
+// the size of the job chain the last time the request type was built, so large
+// request types count more than small ones. A build always runs if no other
+// build is running, even if its estimate is greater than the max.
+//
+// A nil *BuildPool does not limit builds.
+type BuildPool struct {
+	cfg       BuildPoolConfig
+	cond      *sync.Cond
+	running   uint
+	queued    uint
+	memory    int64
+	estimates map[string]int64 // keyed on request type
+}
+
+func NewBuildPool(cfg BuildPoolConfig) *BuildPool {
+	return &BuildPool{
+		cfg:       cfg,
+		cond:      sync.NewCond(&sync.Mutex{}),
+		estimates: map[string]int64{},
+	}
+}
+
+// Acquire blocks until a build of the request type can run and returns a
+// function that the caller must call when the build is done. The done function
+// takes the actual size of the job chain, or zero if the build failed, which is
+// the estimate for the next build of the request type. Acquire returns
+// ErrBuildQueueFull if the queue is full.
+func (p *BuildPool) Acquire(reqType string) (func(size int64), error) {
+	if p == nil {
+		return func(int64) {}, nil
+	}
+
+	p.cond.L.Lock()
+	est, ok := p.estimates[reqType]
+	if !ok {
+		est = DEFAULT_BUILD_ESTIMATE
+	}
+	if !p.fits(est) {
+		if p.cfg.MaxQueued > 0 && p.queued >= p.cfg.MaxQueued {
+			p.cond.L.Unlock()
+			ChainBuildRejected.Add(1)
+			return nil, ErrBuildQueueFull
+		}
+		p.queued++
+		ChainBuildQueued.Add(1)
+		for !p.fits(est) {
+			p.cond.Wait()
+		}
+		p.queued--
+		ChainBuildQueued.Add(-1)
+	}
+	p.running++
+	p.memory += est
+	p.cond.L.Unlock()
+	ChainBuildRunning.Add(1)
+	ChainBuildMemory.Add(est)
+
+	t0 := time.Now()
+	var once sync.Once
+	done := func(size int64) {
+		once.Do(func() {
+			ChainBuilds.Add(1)
+			ChainBuildTime.Add(time.Since(t0).Milliseconds())
+			ChainBuildRunning.Add(-1)
+			ChainBuildMemory.Add(-est)
+
+			p.cond.L.Lock()
+			p.running--
+			p.memory -= est
+			if size > 0 {
+				p.estimates[reqType] = size
+			}
+			p.cond.L.Unlock()
+			p.cond.Broadcast()
+		})
+	}
+	return done, nil
+}
+
+// fits returns true if a build with the estimated memory can run now. The
+// caller must hold the lock.
+func (p *BuildPool) fits(est int64) bool {
+	if p.running == 0 {
+		return true
+	}
+	if p.cfg.Workers > 0 && p.running >= p.cfg.Workers {
+		return false
+	}
+	if p.cfg.MaxMemory > 0 && p.memory+est > p.cfg.MaxMemory {
+		return false
+	}
+	return true
+}
+
+// CheckSize returns serr.ErrInvalidCreateRequest if the job chain size, in bytes,
+// is greater than the max chain size.
+func (p *BuildPool) CheckSize(size int64) error {
+	if p == nil || p.cfg.MaxChainSize <= 0 || size <= p.cfg.MaxChainSize {
+		return nil
+	}
+	return serr.ErrInvalidCreateRequest{
+		Message: fmt.Sprintf("job chain is too large: %d bytes, max %d bytes", size, p.cfg.MaxChainSize),
+	}
+}
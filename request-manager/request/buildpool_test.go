@@ -0,0 +1,106 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+	"time"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+func TestBuildPoolWorkers(t *testing.T) {
+	p := request.NewBuildPool(request.BuildPoolConfig{Workers: 1, MaxQueued: 1})
+
+	done1, err := p.Acquire("req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Second build waits for the only worker
+	acquired := make(chan func(int64))
+	go func() {
+		done2, err := p.Acquire("req1")
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- done2
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second build acquired a worker, expected it to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// Third build is rejected because the queue (1) is full
+	if _, err := p.Acquire("req1"); err != request.ErrBuildQueueFull {
+		t.Errorf("got error %v, expected ErrBuildQueueFull", err)
+	}
+
+	// Finishing the first build lets the second run
+	done1(100)
+	select {
+	case done2 := <-acquired:
+		done2(100)
+	case <-time.After(time.Second):
+		t.Fatal("second build did not acquire a worker after the first finished")
+	}
+}
+
+func TestBuildPoolMemory(t *testing.T) {
+	p := request.NewBuildPool(request.BuildPoolConfig{MaxMemory: 1000})
+
+	// First build always runs, even though the default estimate > max memory
+	done, err := p.Acquire("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(600) // estimate for next "big" build
+
+	done1, err := p.Acquire("big")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan struct{})
+	go func() {
+		done2, err := p.Acquire("big") // 600 + 600 > 1000
+		if err != nil {
+			t.Error(err)
+		}
+		close(acquired)
+		done2(600)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("second build acquired memory, expected it to wait")
+	case <-time.After(100 * time.Millisecond):
+	}
+	done1(600)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("second build did not run after the first finished")
+	}
+}
+
+func TestBuildPoolCheckSize(t *testing.T) {
+	p := request.NewBuildPool(request.BuildPoolConfig{MaxChainSize: 1000})
+	if err := p.CheckSize(1000); err != nil {
+		t.Errorf("got error %s, expected nil", err)
+	}
+	if _, ok := p.CheckSize(1001).(serr.ErrInvalidCreateRequest); !ok {
+		t.Errorf("expected serr.ErrInvalidCreateRequest")
+	}
+
+	// Nil pool doesn't limit builds
+	var nilPool *request.BuildPool
+	done, err := nilPool.Acquire("req1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	done(0)
+	if err := nilPool.CheckSize(1 << 40); err != nil {
+		t.Errorf("got error %s, expected nil", err)
+	}
+}
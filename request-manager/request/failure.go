@@ -0,0 +1,74 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"github.com/square/spincycle/v2/proto"
+)
+
+// Failure returns the root cause of a failed request from its job chain and job
+// log (without output). The root cause is the earliest failed try by finish time.
+// Stopped tries are not failures. The skipped jobs are the jobs downstream of the
+// failed job that never ran, in breadth-first order. Failure does not check the
+// request state, so it works for running requests with failed tries, too.
+func Failure(req proto.Request, jc proto.JobChain, jl []proto.JobLog) proto.RequestFailure {
+	f := proto.RequestFailure{
+		RequestId:   req.Id,
+		State:       req.State,
+		SkippedJobs: []proto.Job{},
+	}
+
+	ran := map[string]bool{}
+	for i := range jl {
+		ran[jl[i].JobId] = true
+		if jl[i].State == proto.STATE_COMPLETE || jl[i].State == proto.STATE_STOPPED {
+			continue
+		}
+		f.FailedTries++
+		if f.FailedJob == nil || earlier(jl[i], *f.FailedJob) {
+			failed := jl[i]
+			failed.Stdout = ""
+			failed.Stderr = ""
+			f.FailedJob = &failed
+		}
+	}
+	if f.FailedJob == nil {
+		return f
+	}
+
+	seen := map[string]bool{f.FailedJob.JobId: true}
+	next := append([]string{}, jc.AdjacencyList[f.FailedJob.JobId]...)
+	for len(next) > 0 {
+		jobId := next[0]
+		next = next[1:]
+		if seen[jobId] {
+			continue
+		}
+		seen[jobId] = true
+		if ran[jobId] {
+			continue // ran after fail
+		}
+		job := jc.Jobs[jobId]
+		job.Bytes = nil
+		job.Args = nil
+		job.Data = nil
+		f.SkippedJobs = append(f.SkippedJobs, job)
+		next = append(next, jc.AdjacencyList[jobId]...)
+	}
+	return f
+}
+
+// earlier returns true if job log a finished before b. Ties are broken by start
+// time, then job ID and try so the result is stable.
+func earlier(a, b proto.JobLog) bool {
+	if a.FinishedAt != b.FinishedAt {
+		return a.FinishedAt < b.FinishedAt
+	}
+	if a.StartedAt != b.StartedAt {
+		return a.StartedAt < b.StartedAt
+	}
+	if a.JobId != b.JobId {
+		return a.JobId < b.JobId
+	}
+	return a.Try < b.Try
+}
@@ -0,0 +1,79 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+func TestFailure(t *testing.T) {
+	// a -> b -> c -> d
+	//        -> e (run after fail)
+	req := proto.Request{Id: "req1", State: proto.STATE_FAIL}
+	jc := proto.JobChain{
+		RequestId: "req1",
+		Jobs: map[string]proto.Job{
+			"a": {Id: "a", Name: "job-a", Type: "t"},
+			"b": {Id: "b", Name: "job-b", Type: "t", Args: map[string]interface{}{"k": "v"}},
+			"c": {Id: "c", Name: "job-c", Type: "t", Bytes: []byte("x")},
+			"d": {Id: "d", Name: "job-d", Type: "t"},
+			"e": {Id: "e", Name: "job-e", Type: "t", RunAfterFail: true},
+		},
+		AdjacencyList: map[string][]string{
+			"a": {"b"},
+			"b": {"c", "e"},
+			"c": {"d"},
+		},
+	}
+	jl := []proto.JobLog{
+		{RequestId: "req1", JobId: "a", Try: 1, State: proto.STATE_COMPLETE, StartedAt: 1, FinishedAt: 2},
+		{RequestId: "req1", JobId: "b", Try: 1, State: proto.STATE_FAIL, StartedAt: 3, FinishedAt: 4, Error: "first", Stderr: "stderr"},
+		{RequestId: "req1", JobId: "b", Try: 2, State: proto.STATE_FAIL, StartedAt: 5, FinishedAt: 6, Error: "second"},
+		{RequestId: "req1", JobId: "e", Try: 1, State: proto.STATE_COMPLETE, StartedAt: 7, FinishedAt: 8},
+	}
+
+	got := request.Failure(req, jc, jl)
+	expect := proto.RequestFailure{
+		RequestId: "req1",
+		State:     proto.STATE_FAIL,
+		FailedJob: &proto.JobLog{
+			RequestId: "req1", JobId: "b", Try: 1, State: proto.STATE_FAIL, StartedAt: 3, FinishedAt: 4, Error: "first",
+		},
+		FailedTries: 2,
+		SkippedJobs: []proto.Job{
+			{Id: "c", Name: "job-c", Type: "t"},
+			{Id: "d", Name: "job-d", Type: "t"},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestFailureNone(t *testing.T) {
+	// Stopped tries are not failures
+	req := proto.Request{Id: "req1", State: proto.STATE_STOPPED}
+	jc := proto.JobChain{
+		RequestId:     "req1",
+		Jobs:          map[string]proto.Job{"a": {Id: "a"}, "b": {Id: "b"}},
+		AdjacencyList: map[string][]string{"a": {"b"}},
+	}
+	jl := []proto.JobLog{
+		{RequestId: "req1", JobId: "a", Try: 1, State: proto.STATE_STOPPED},
+	}
+
+	got := request.Failure(req, jc, jl)
+	expect := proto.RequestFailure{
+		RequestId:   "req1",
+		State:       proto.STATE_STOPPED,
+		SkippedJobs: []proto.Job{},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,99 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"context"
+	"database/sql"
+
+	serr "github.com/square/spincycle/v2/errors"
+)
+
+// --------------------------------------------------------------------------
+// Fencing tokens:
+//
+// A Job Runner that crashes, is partitioned from the Request Manager, or hangs
+// can come back after its requests were taken over or resumed on another Job
+// Runner. Without fencing, both Job Runners run the same job chain and race to
+// write its job log and final state.
+//
+// Each time a job chain is sent to a Job Runner, the Request Manager issues it
+// a fencing token (proto.JobChain.FenceToken) that's greater than all previous
+// tokens for the request: 1 when the request is started, and the next token
+// (requests.fence_token + 1) each time it's resumed. Starting a request is
+// idempotent, so concurrent starts all issue token 1; a resumed chain is claimed
+// by one Resumer, so only it issues the next token. The Job Runner sends the
+// token with job logs, the final state, and the suspended job chain, and the
+// Request Manager rejects them (serr.ErrFenced) if the token is less than the
+// latest token issued for the request. The final state and suspended job chain
+// change the request, so the token is checked in the same UPDATE (fenceClause):
+// a request resumed between a separate check and the update would not be fenced.
+//
+// Token zero is chains sent before fencing tokens, which are never rejected.
+// --------------------------------------------------------------------------
+
+// FIRST_FENCE_TOKEN is the fencing token of a job chain when its request is started.
+const FIRST_FENCE_TOKEN uint64 = 1
+
+func (m *manager) CheckFence(requestId string, token uint64) error {
+	return checkFence(m.dbConnector, requestId, token)
+}
+
+// checkFence returns serr.ErrFenced if token is less than the latest fencing
+// token issued for the request.
+func checkFence(dbc *sql.DB, requestId string, token uint64) error {
+	if token == 0 {
+		return nil // chain sent before fencing tokens
+	}
+	var current uint64
+	q := "SELECT fence_token FROM requests WHERE request_id = ?"
+	if err := dbc.QueryRowContext(context.TODO(), q, requestId).Scan(&current); err != nil {
+		if err == sql.ErrNoRows {
+			return serr.RequestNotFound{RequestId: requestId}
+		}
+		return serr.NewDbError(err, "SELECT requests")
+	}
+	if token < current {
+		return serr.ErrFenced{RequestId: requestId, Token: token, CurrentToken: current}
+	}
+	return nil
+}
+
+// fenceClause returns the condition, and its arg, that fences an UPDATE of the
+// request with the token: it updates only if the token isn't less than the latest
+// fencing token. It's empty for token zero. If no row is updated, the caller
+// returns notUpdated.
+func fenceClause(token uint64) (string, []interface{}) {
+	if token == 0 {
+		return "", nil
+	}
+	return " AND fence_token <= ?", []interface{}{token}
+}
+
+// notUpdated returns the error of an UPDATE of the request fenced with the token
+// (fenceClause) that updated no row: serr.ErrFenced if it's fenced, else
+// ErrNotUpdated (the request is not in the expected state).
+func notUpdated(dbc *sql.DB, requestId string, token uint64) error {
+	if err, ok := checkFence(dbc, requestId, token).(serr.ErrFenced); ok {
+		return err
+	}
+	return ErrNotUpdated
+}
+
+// nextFenceToken issues and returns the next fencing token for the request.
+// It's atomic: LAST_INSERT_ID(expr) returns the value that the update set.
+func nextFenceToken(dbc *sql.DB, requestId string) (uint64, error) {
+	q := "UPDATE requests SET fence_token = LAST_INSERT_ID(GREATEST(fence_token, ?) + 1) WHERE request_id = ?"
+	res, err := dbc.ExecContext(context.TODO(), q, FIRST_FENCE_TOKEN, requestId)
+	if err != nil {
+		return 0, serr.NewDbError(err, "UPDATE requests")
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return 0, serr.RequestNotFound{RequestId: requestId}
+	}
+	token, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return uint64(token), nil
+}
@@ -0,0 +1,144 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/retry"
+)
+
+// --------------------------------------------------------------------------
+// Force finalize:
+//
+// A request whose Job Runner is lost for good (host gone, disk wiped, etc.) is
+// RUNNING until the reconciler fails it, if enabled, and a request that never
+// started because the Request Manager crashed is PENDING forever. Finalize lets
+// an admin set its final state instead of updating the requests table by hand.
+//
+// It's guarded: only pending and running requests can be finalized, and only to
+// FAIL or STOPPED, not COMPLETE. If the Job Runner still has the request, it's
+// an error: stop the request instead, so its jobs stop. The change is saved with
+// an audit record (request_audit) and passed to the RequestStateChanged hook like
+// any other, with the admin and reason (Transition.User and Reason). The fencing
+// token is incremented, so if the lost Job Runner comes back, its job logs are
+// rejected, and its final state is rejected because the request is not running.
+// --------------------------------------------------------------------------
+
+// MAX_FINALIZE_REASON is the max length of proto.FinalizeRequest.Reason: the
+// size of the request_audit.reason column.
+const MAX_FINALIZE_REASON = 2000
+
+func (m *manager) Finalize(requestId string, f proto.FinalizeRequest) (proto.Request, error) {
+	if f.State != proto.STATE_FAIL && f.State != proto.STATE_STOPPED {
+		return proto.Request{}, serr.ValidationError{
+			Message: fmt.Sprintf("invalid state %s: a request can only be finalized as %s or %s",
+				proto.StateName[f.State], proto.StateName[proto.STATE_FAIL], proto.StateName[proto.STATE_STOPPED]),
+		}
+	}
+	if f.Reason == "" {
+		return proto.Request{}, serr.ValidationError{Message: "reason is required"}
+	}
+	if len(f.Reason) > MAX_FINALIZE_REASON {
+		return proto.Request{}, serr.ValidationError{Message: fmt.Sprintf("reason is longer than %d characters", MAX_FINALIZE_REASON)}
+	}
+
+	req, err := m.Get(requestId)
+	if err != nil {
+		return req, err
+	}
+	prevState := req.State
+
+	// A suspended request is finished by the Resumer (resume.max_attempts), and
+	// a finished request is finished
+	if prevState != proto.STATE_PENDING && prevState != proto.STATE_RUNNING {
+		return req, serr.NewErrInvalidState(proto.StateName[proto.STATE_PENDING]+" or "+proto.StateName[proto.STATE_RUNNING], proto.StateName[prevState])
+	}
+	if err := m.sm.CheckFinal(req.Id, prevState, f.State); err != nil {
+		return req, err
+	}
+
+	// A partitioned request has no JR. It's finished when its partition requests
+	// are, so finalize them instead
+	if req.Partitions > 0 {
+		return req, serr.ValidationError{
+			Message: fmt.Sprintf("request %s is partitioned: finalize its partition requests instead (spinc find part-of=%s)", req.Id, req.Id),
+		}
+	}
+
+	// The JR must not have the request. If it cannot be reached, that's why
+	// the request is being finalized.
+	if prevState == proto.STATE_RUNNING && req.JobRunnerURL != "" {
+		has, err := m.jrClient.HasJobChain(req.JobRunnerURL, req.Id)
+		if err == nil && has {
+			return req, serr.ErrJobRunnerHasRequest{RequestId: req.Id, JobRunnerURL: req.JobRunnerURL}
+		}
+		if err != nil {
+			requestLogger(req).Infof("finalize: cannot reach Job Runner %s: %s", req.JobRunnerURL, err)
+		}
+	}
+
+	finishedAt := time.Now().UTC()
+	req.State = f.State
+	req.FinishedAt = &finishedAt
+	req.JobRunnerURL = ""
+
+	ctx := context.TODO()
+	var updated bool
+	err = retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		updated = false
+		txn, err := m.dbConnector.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback()
+
+		q := "UPDATE requests SET state = ?, finished_at = ?, jr_url = NULL, fence_token = GREATEST(fence_token, ?) + 1 WHERE request_id = ? AND state = ?"
+		res, err := txn.ExecContext(ctx, q, req.State, req.FinishedAt, FIRST_FENCE_TOKEN, req.Id, prevState)
+		if err != nil {
+			return serr.NewDbError(err, "UPDATE requests")
+		}
+		cnt, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			return nil // state changed since Get, like the JR finished it
+		}
+
+		var user interface{} // NULL if not set
+		if f.User != "" {
+			user = f.User
+		}
+		q = "INSERT INTO request_audit (request_id, action, user, reason, from_state, to_state, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)"
+		_, err = txn.ExecContext(ctx, q, req.Id, proto.AUDIT_ACTION_FINALIZE, user, f.Reason, prevState, req.State, finishedAt)
+		if err != nil {
+			return serr.NewDbError(err, "INSERT request_audit")
+		}
+		if err := txn.Commit(); err != nil {
+			return err
+		}
+		updated = true
+		return nil
+	}, nil)
+	if err != nil {
+		return req, err
+	}
+	if !updated {
+		cur, err := m.Get(requestId)
+		if err != nil {
+			return cur, err
+		}
+		return cur, serr.NewErrInvalidState(proto.StateName[prevState], proto.StateName[cur.State])
+	}
+	m.sm.Forced(req, prevState, req.State, f.User, f.Reason)
+
+	// Not auto-retried, but a partition request finishes the request it's part of
+	m.finishPartition(req)
+
+	return req, nil
+}
@@ -0,0 +1,146 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"fmt"
+	"net/url"
+	"testing"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+	rmtest "github.com/square/spincycle/v2/request-manager/test"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestFinalize(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+	reqId := "454ae2f98a05cv16sdwt" // running on http://jr:0000
+
+	var transitions []request.Transition
+	hasJobChain := true
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient: &mock.JRClient{
+			HasJobChainFunc: func(baseURL, requestId string) (bool, error) {
+				if hasJobChain {
+					return true, nil
+				}
+				return false, fmt.Errorf("dial tcp: connection refused")
+			},
+		},
+		ShutdownChan: shutdownChan,
+		DefaultJRURL: "http://defaulturl:1111",
+		StateMachine: &request.StateMachine{
+			OnTransition: func(tr request.Transition) { transitions = append(transitions, tr) },
+		},
+	}
+	m := request.NewManager(cfg)
+
+	f := proto.FinalizeRequest{State: proto.STATE_FAIL, Reason: "jr host lost", User: "admin1"}
+
+	// Invalid: no reason, or not a state that can be forced
+	if _, err := m.Finalize(reqId, proto.FinalizeRequest{State: proto.STATE_FAIL}); err == nil {
+		t.Errorf("no error without reason, expected one")
+	}
+	if _, err := m.Finalize(reqId, proto.FinalizeRequest{State: proto.STATE_COMPLETE, Reason: "x"}); err == nil {
+		t.Errorf("no error for COMPLETE, expected one")
+	}
+
+	// JR still has the request: stop it instead
+	_, err := m.Finalize(reqId, f)
+	if _, ok := err.(serr.ErrJobRunnerHasRequest); !ok {
+		t.Errorf("err = %v, expected errors.ErrJobRunnerHasRequest", err)
+	}
+
+	// JR unreachable: finalized, audited, and passed to OnTransition
+	hasJobChain = false
+	req, err := m.Finalize(reqId, f)
+	if err != nil {
+		t.Fatalf("err = %s, expected nil", err)
+	}
+	if req.State != proto.STATE_FAIL || req.FinishedAt == nil {
+		t.Errorf("got state %s, finished at %v, expected FAIL with finished at", proto.StateName[req.State], req.FinishedAt)
+	}
+	req, err = m.Get(reqId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != proto.STATE_FAIL || req.JobRunnerURL != "" {
+		t.Errorf("saved state %s, JR %s, expected FAIL without JR", proto.StateName[req.State], req.JobRunnerURL)
+	}
+
+	var action, user, reason string
+	var from, to byte
+	err = dbc.QueryRow("SELECT action, user, reason, from_state, to_state FROM request_audit WHERE request_id = ?", reqId).Scan(&action, &user, &reason, &from, &to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action != proto.AUDIT_ACTION_FINALIZE || user != "admin1" || reason != "jr host lost" || from != proto.STATE_RUNNING || to != proto.STATE_FAIL {
+		t.Errorf("got audit record %s %s %s %d %d, expected finalize admin1 'jr host lost' 2 4", action, user, reason, from, to)
+	}
+
+	if len(transitions) != 1 {
+		t.Fatalf("got %d transitions, expected 1: %+v", len(transitions), transitions)
+	}
+	tr := transitions[0]
+	if tr.From != proto.STATE_RUNNING || tr.To != proto.STATE_FAIL || tr.User != "admin1" || tr.Reason != "jr host lost" {
+		t.Errorf("got transition %+v, expected RUNNING -> FAIL by admin1", tr)
+	}
+
+	// The lost JR cannot finish it now, and it cannot be finalized again
+	err = m.Finish(reqId, proto.FinishRequest{State: proto.STATE_COMPLETE})
+	if _, ok := err.(serr.ErrInvalidState); !ok {
+		t.Errorf("Finish err = %v, expected errors.ErrInvalidState", err)
+	}
+	_, err = m.Finalize(reqId, f)
+	if _, ok := err.(serr.ErrInvalidState); !ok {
+		t.Errorf("Finalize err = %v, expected errors.ErrInvalidState", err)
+	}
+}
+
+func TestFinalizeFencesLostJR(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+	reqId := "0874a524aa1edn3ysp00" // request is pending
+
+	var recvdJc proto.JobChain
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient: &mock.JRClient{
+			NewJobChainFunc: func(baseURL string, jc proto.JobChain) (*url.URL, error) {
+				recvdJc = jc
+				return url.Parse("http://fake_host:1111/api/v1/job-chains/1")
+			},
+			HasJobChainFunc: func(baseURL, requestId string) (bool, error) {
+				return false, fmt.Errorf("dial tcp: connection refused")
+			},
+		},
+		ShutdownChan: shutdownChan,
+		DefaultJRURL: "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+
+	// Started but never resumed: the JR has the first token
+	if err := m.Start(reqId); err != nil {
+		t.Fatalf("Start err = %s, expected nil", err)
+	}
+	if recvdJc.FenceToken != request.FIRST_FENCE_TOKEN {
+		t.Fatalf("JR got fence token %d, expected %d", recvdJc.FenceToken, request.FIRST_FENCE_TOKEN)
+	}
+
+	_, err := m.Finalize(reqId, proto.FinalizeRequest{State: proto.STATE_FAIL, Reason: "jr host lost", User: "admin1"})
+	if err != nil {
+		t.Fatalf("Finalize err = %s, expected nil", err)
+	}
+
+	// Job logs from the lost JR are fenced
+	err = m.CheckFence(reqId, recvdJc.FenceToken)
+	if _, ok := err.(serr.ErrFenced); !ok {
+		t.Errorf("CheckFence err = %v, expected errors.ErrFenced", err)
+	}
+}
@@ -0,0 +1,84 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+// StartFromJob sets every job before the named job to COMPLETE, so the request
+// starts from that job. A job is before it if the spec orders it before the job:
+// the job depends on it, directly or through other jobs. Other jobs, like jobs in
+// parallel with it, run as usual. If several jobs have the name, like expansions
+// of an each: node, the request starts from all of them, and jobs after any of
+// them run. It returns the IDs of the jobs set to COMPLETE, sorted, or an error
+// if no job has the name.
+func StartFromJob(jc *proto.JobChain, name string) ([]string, error) {
+	from := map[string]bool{}
+	for id, job := range jc.Jobs {
+		if job.Name == name {
+			from[id] = true
+		}
+	}
+	if len(from) == 0 {
+		return nil, fmt.Errorf("no job named %s in the job chain", name)
+	}
+
+	prev := map[string][]string{} // job ID => IDs of previous jobs
+	for prevId, nextIds := range jc.AdjacencyList {
+		for _, nextId := range nextIds {
+			prev[nextId] = append(prev[nextId], prevId)
+		}
+	}
+
+	// A job that runs after a job it starts from must run, even if it's also
+	// before another one, like a later expansion of a sequential each: node.
+	// Else the jobs would be complete before their previous jobs are.
+	after := map[string]bool{}
+	walk(jc.AdjacencyList, from, after)
+	before := map[string]bool{}
+	walk(prev, from, before)
+
+	ids := []string{}
+	for id := range before {
+		if from[id] || after[id] {
+			continue
+		}
+		job := jc.Jobs[id]
+		job.State = proto.STATE_COMPLETE
+		jc.Jobs[id] = job
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	jc.FinishedJobs = 0
+	for _, job := range jc.Jobs {
+		if job.State == proto.STATE_COMPLETE {
+			jc.FinishedJobs++
+		}
+	}
+	return ids, nil
+}
+
+// walk adds to seen every job reachable from the start jobs in edges, not
+// including the start jobs unless they're reachable from another start job.
+func walk(edges map[string][]string, start map[string]bool, seen map[string]bool) {
+	queue := make([]string, 0, len(start))
+	for id := range start {
+		queue = append(queue, id)
+	}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		for _, next := range edges[id] {
+			if seen[next] {
+				continue
+			}
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+// fromJobChain returns a job chain a -> b -> c -> d, where b and x both run
+// after a and before c, and c is a sequential each: of two jobs named c.
+func fromJobChain() *proto.JobChain {
+	return &proto.JobChain{
+		RequestId: "req1",
+		Jobs: map[string]proto.Job{
+			"a":  {Id: "a", Name: "job-a", State: proto.STATE_PENDING},
+			"b":  {Id: "b", Name: "job-b", State: proto.STATE_PENDING},
+			"x":  {Id: "x", Name: "job-x", State: proto.STATE_PENDING},
+			"c1": {Id: "c1", Name: "job-c", State: proto.STATE_PENDING},
+			"c2": {Id: "c2", Name: "job-c", State: proto.STATE_PENDING},
+			"d":  {Id: "d", Name: "job-d", State: proto.STATE_PENDING},
+		},
+		AdjacencyList: map[string][]string{
+			"a":  {"b", "x"},
+			"b":  {"c1"},
+			"x":  {"c1"},
+			"c1": {"c2"},
+			"c2": {"d"},
+		},
+	}
+}
+
+func jobStates(jc *proto.JobChain) map[string]byte {
+	s := map[string]byte{}
+	for id, job := range jc.Jobs {
+		s[id] = job.State
+	}
+	return s
+}
+
+func TestStartFromJob(t *testing.T) {
+	// Start from b: a is before it; x is in parallel, so it runs
+	jc := fromJobChain()
+	ids, err := request.StartFromJob(jc, "job-b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(ids, []string{"a"}); diff != nil {
+		t.Error(diff)
+	}
+	expect := map[string]byte{
+		"a":  proto.STATE_COMPLETE,
+		"b":  proto.STATE_PENDING,
+		"x":  proto.STATE_PENDING,
+		"c1": proto.STATE_PENDING,
+		"c2": proto.STATE_PENDING,
+		"d":  proto.STATE_PENDING,
+	}
+	if diff := deep.Equal(jobStates(jc), expect); diff != nil {
+		t.Error(diff)
+	}
+	if jc.FinishedJobs != 1 {
+		t.Errorf("FinishedJobs = %d, expected 1", jc.FinishedJobs)
+	}
+
+	// Start from both expansions of c: c1 is before c2 but runs because it's
+	// one of the jobs the request starts from
+	jc = fromJobChain()
+	ids, err = request.StartFromJob(jc, "job-c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(ids, []string{"a", "b", "x"}); diff != nil {
+		t.Error(diff)
+	}
+	if jc.Jobs["c1"].State != proto.STATE_PENDING || jc.Jobs["c2"].State != proto.STATE_PENDING {
+		t.Errorf("c1 = %s, c2 = %s, expected PENDING, PENDING", proto.StateName[jc.Jobs["c1"].State], proto.StateName[jc.Jobs["c2"].State])
+	}
+	if jc.FinishedJobs != 3 {
+		t.Errorf("FinishedJobs = %d, expected 3", jc.FinishedJobs)
+	}
+
+	// Start from the first job: nothing before it
+	jc = fromJobChain()
+	ids, err = request.StartFromJob(jc, "job-a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != 0 || jc.FinishedJobs != 0 {
+		t.Errorf("got %v, FinishedJobs = %d, expected no jobs complete", ids, jc.FinishedJobs)
+	}
+
+	// No job with the name
+	jc = fromJobChain()
+	if _, err := request.StartFromJob(jc, "job-z"); err == nil {
+		t.Errorf("no error for unknown job, expected an error")
+	}
+	if diff := deep.Equal(jc, fromJobChain()); diff != nil {
+		t.Error(diff)
+	}
+}
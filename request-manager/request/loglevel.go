@@ -0,0 +1,64 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"fmt"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
+)
+
+// --------------------------------------------------------------------------
+// Request log level:
+//
+// An operator debugging one request can elevate its log level, like to debug,
+// without changing the log level of other requests (reqlog). The Request Manager
+// elevates it locally, for the logs of this Request Manager only, and forwards it
+// to the Job Runner running the request, where its traverser, runners, and jobs
+// (job.Debug) log at that level. The elevation is in memory and expires: it's
+// lost if the request is suspended and resumed on another Job Runner, and other
+// Request Managers behind a load balancer do not elevate it.
+// --------------------------------------------------------------------------
+
+func (m *manager) SetLogLevel(requestId string, ll proto.RequestLogLevel) (proto.RequestLogLevel, error) {
+	level, d, err := reqlog.Parse(ll.Level, ll.Duration)
+	if err != nil {
+		return ll, serr.ValidationError{Message: fmt.Sprintf("invalid log level: %s", err)}
+	}
+
+	req, err := m.Get(requestId)
+	if err != nil {
+		return ll, err
+	}
+
+	ll.Until = reqlog.Elevate(requestId, level, d)
+	if req.State != proto.STATE_RUNNING {
+		return ll, nil
+	}
+
+	// A partitioned request has no JR; its partition requests do
+	if req.Partitions > 0 {
+		parts, err := m.Find(proto.RequestFilter{PartitionOf: req.Id, States: []byte{proto.STATE_RUNNING}})
+		if err != nil {
+			return ll, err
+		}
+		for _, p := range parts {
+			if _, err := m.SetLogLevel(p.Id, ll); err != nil {
+				return ll, fmt.Errorf("error setting log level of partition request %s: %s", p.Id, err)
+			}
+		}
+		return ll, nil
+	}
+
+	if err := m.jrClient.SetLogLevel(req.JobRunnerURL, requestId, ll); err != nil {
+		// Like Stop, the job chain can finish between Get and SetLogLevel, in
+		// which case the JR no longer has it. That's not an error.
+		if cur, getErr := m.Get(requestId); getErr == nil && cur.State != proto.STATE_RUNNING {
+			return ll, nil
+		}
+		return ll, fmt.Errorf("error setting log level in Job Runner: %s", err)
+	}
+	return ll, nil
+}
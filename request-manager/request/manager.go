@@ -18,12 +18,15 @@ import (
 	"github.com/rs/xid"
 	log "github.com/sirupsen/logrus"
 
+	"github.com/square/spincycle/v2/argcrypt"
 	serr "github.com/square/spincycle/v2/errors"
 	jr "github.com/square/spincycle/v2/job-runner"
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/placement"
 	"github.com/square/spincycle/v2/request-manager/spec"
 	"github.com/square/spincycle/v2/retry"
+	"github.com/square/spincycle/v2/version"
 )
 
 const (
@@ -31,6 +34,10 @@ const (
 	DB_RETRY_WAIT = time.Duration(500 * time.Millisecond)
 	JR_TRIES      = 5
 	JR_RETRY_WAIT = time.Duration(5 * time.Second)
+
+	// Max length of request arg values saved in request_args for searching.
+	// Longer values are truncated.
+	ARG_VALUE_MAX_LEN = 255
 )
 
 // A Manager creates and manages the life cycle of requests.
@@ -47,11 +54,24 @@ type Manager interface {
 	// with its job chain and parameters.
 	GetWithJC(requestId string) (proto.Request, error)
 
-	// Start starts a request (sends it to the JR).
+	// Start starts a pending request (sends it to the JR). It's idempotent:
+	// if the request was already started, it's a no-op, even if the request
+	// has since finished. It returns ErrInvalidState if the request was never
+	// started and is not pending (e.g. it failed to start).
 	Start(requestId string) error
 
-	// Stop stops a request (sends a stop signal to the JR).
-	Stop(requestId string) error
+	// Stop stops a running request (sends a stop signal to the JR). It's
+	// idempotent: if the request already finished, it's a no-op. It returns
+	// ErrInvalidState if the request is pending or suspended. If timeout is
+	// greater than zero, it overrides the JR and request spec stop timeout.
+	Stop(requestId string, timeout time.Duration) error
+
+	// StopJob stops the current try of one job of a running request (sends a
+	// stop job signal to the JR) without stopping the request. The try fails,
+	// so the job is retried if it has tries left. It returns ErrInvalidState if
+	// the request is not running, JobNotFound if the job is not in its job chain,
+	// and ErrJobNotRunning if the job is not running a try.
+	StopJob(requestId, jobId string) error
 
 	// Finish marks a request as being finished. It gets the request's final
 	// state from the proto.FinishRequest argument.
@@ -60,9 +80,27 @@ type Manager interface {
 	// Fail a pending request (if it can't be started for some reason).
 	FailPending(requestId string) error
 
+	// FinishPartitions finishes a running request that was split into partition
+	// requests if all of them are finished: its final state is aggregated from
+	// theirs. It's a no-op if the request is not partitioned or not running, or
+	// if any partition request is not finished. Finish and FailPending call it
+	// when a partition request finishes.
+	FinishPartitions(requestId string) error
+
+	// CheckFence returns serr.ErrFenced if the fencing token that a Job Runner
+	// sent (proto.JobChain.FenceToken) is older than the latest one issued for
+	// the request because the request was resumed since. Token zero is never fenced.
+	CheckFence(requestId string, token uint64) error
+
 	// Specs returns a list of all the request specs the the RM knows about.
 	Specs() []proto.RequestSpec
 
+	// Metadata returns the documentation of a request type: its request spec, and
+	// the description and docs URL of the request sequence, every subsequence it
+	// uses, and their nodes. It returns serr.RequestTypeNotFound if the request
+	// type does not exist.
+	Metadata(reqType string) (proto.RequestTypeMetadata, error)
+
 	// JobChain returns the job chain for the given request id.
 	JobChain(requestId string) (proto.JobChain, error)
 
@@ -71,56 +109,210 @@ type Manager interface {
 	// by request id where create time is not unique. Returned requests do
 	// not have job chain or args set.
 	Find(filter proto.RequestFilter) ([]proto.Request, error)
+
+	// History returns the most recent requests of the type (at most limit,
+	// 0 = no limit) that were created or run after since, and a summary of
+	// the outcomes of all of them.
+	History(reqType string, since time.Time, limit uint) (proto.RequestHistory, error)
+
+	// Export returns a bundle of the request with its args, job chain, create
+	// request, and suspended job chain (if suspended). Job logs are not set;
+	// they are in the joblog.Store.
+	Export(requestId string) (proto.RequestBundle, error)
+
+	// Import saves a request bundle exported from another Request Manager, with
+	// the same request id. The imported request is never running: a running
+	// request, or a suspended request without a suspended job chain, is imported
+	// as stopped.
+	Import(proto.RequestBundle) (proto.Request, error)
+
+	// Retry creates a request that retries the failed request: same create
+	// request, except the args and deadline in the retry request. Overridden
+	// args are validated against the request spec and saved with the new request
+	// (proto.Request.ArgOverrides), which is linked to the failed request by
+	// proto.Request.RetryOf. If the retry request has FromJob, the new request
+	// starts from that job. Like Create, the new request is not started.
+	Retry(requestId string, retry proto.RetryRequest) (proto.Request, error)
+
+	// SetLogLevel elevates the log level of the request on this Request Manager
+	// and, if the request is running, on the Job Runner running it (or the Job
+	// Runners running its partition requests). It returns the log level with
+	// Until set.
+	SetLogLevel(requestId string, ll proto.RequestLogLevel) (proto.RequestLogLevel, error)
+
+	// Finalize forcibly sets the final state of a pending or running request
+	// whose Job Runner is unrecoverable, and saves an audit record. It returns
+	// serr.ErrJobRunnerHasRequest if the Job Runner still has the request, which
+	// must be stopped instead. It returns the finalized request.
+	Finalize(requestId string, f proto.FinalizeRequest) (proto.Request, error)
 }
 
 // manager implements the Manager interface.
 type manager struct {
 	resolverFactory graph.ResolverFactory
 	sequences       map[string]*spec.Sequence
+	specVersion     string
+	templateVersion string
+	resolverPlugin  ResolverPlugin
 	dbConnector     *sql.DB
 	jrClient        jr.Client
 	defaultJRURL    string
 	shutdownChan    chan struct{}
+	sm              *StateMachine
+	buildPool       *BuildPool
+	placement       map[string]placement.Policy
+	jobRunners      func() []proto.JobRunnerStatus
+	unbuildable     map[string][]string
+	argKeys         argcrypt.KeyProvider
 	*sync.Mutex
 }
 
 type ManagerConfig struct {
 	ResolverFactory graph.ResolverFactory
 	Sequences       map[string]*spec.Sequence
+	SpecVersion     string         // spec.Specs.Version of Sequences, saved with each request
+	TemplateVersion string         // graph.TemplateVersion of Sequences, checked before each build (optional)
+	ResolverPlugin  ResolverPlugin // optional
 	DBConnector     *sql.DB
 	JRClient        jr.Client
 	DefaultJRURL    string
 	ShutdownChan    chan struct{}
+	StateMachine    *StateMachine // optional, shared with the Resumer
+	BuildPool       *BuildPool    // optional, limits concurrent job chain builds
+
+	// Placement policies by name (spec.Placement.Policy), and Job Runners to place
+	// requests on (usually status.Manager.JobRunners). Both are optional: without
+	// them, requests are sent to DefaultJRURL.
+	Placement  map[string]placement.Policy
+	JobRunners func() []proto.JobRunnerStatus
+
+	// Unbuildable request types and their spec errors (optional, see
+	// config.Specs.AllowErrors). Requests of these types are not created.
+	Unbuildable map[string][]string
+
+	// ArgKeys encrypts the values of sensitive args (optional, see
+	// config.ArgEncryption). If nil, they're not encrypted.
+	ArgKeys argcrypt.KeyProvider
 }
 
 func NewManager(config ManagerConfig) Manager {
+	sm := config.StateMachine
+	if sm == nil {
+		sm = &StateMachine{}
+	}
 	return &manager{
 		resolverFactory: config.ResolverFactory,
 		sequences:       config.Sequences,
+		specVersion:     config.SpecVersion,
+		templateVersion: config.TemplateVersion,
+		resolverPlugin:  config.ResolverPlugin,
 		dbConnector:     config.DBConnector,
 		jrClient:        config.JRClient,
 		defaultJRURL:    config.DefaultJRURL,
 		shutdownChan:    config.ShutdownChan,
+		sm:              sm,
+		buildPool:       config.BuildPool,
+		placement:       config.Placement,
+		jobRunners:      config.JobRunners,
+		unbuildable:     config.Unbuildable,
+		argKeys:         config.ArgKeys,
 		Mutex:           &sync.Mutex{},
 	}
 }
 
 func (m *manager) Create(newReq proto.CreateRequest) (proto.Request, error) {
+	return m.create(newReq, "", 0, nil)
+}
+
+// create creates a request. If retryOf is set, the request retries that failed
+// request: it's auto-retry number retryCount, or a manual retry (Retry) if
+// retryCount is zero, in which case argOverrides records the args it changed.
+func (m *manager) create(newReq proto.CreateRequest, retryOf string, retryCount uint, argOverrides []proto.ArgOverride) (proto.Request, error) {
 	var req proto.Request
 	if newReq.Type == "" {
 		return req, serr.ErrInvalidCreateRequest{Message: "Type is empty, must be a request name"}
 	}
+	if newReq.Deadline != nil && !newReq.Deadline.After(time.Now()) {
+		return req, serr.ErrInvalidCreateRequest{
+			Message: fmt.Sprintf("Deadline %s is in the past", newReq.Deadline.UTC().Format(time.RFC3339)),
+		}
+	}
+	if len(newReq.CorrelationId) > proto.MAX_CORRELATION_ID_LEN {
+		return req, serr.ErrInvalidCreateRequest{
+			Message: fmt.Sprintf("CorrelationId is %d characters, max is %d", len(newReq.CorrelationId), proto.MAX_CORRELATION_ID_LEN),
+		}
+	}
+
+	// Let the resolver plugin modify (or reject) the create request before
+	// request args are finalized
+	if m.resolverPlugin != nil {
+		if err := m.resolverPlugin.PreResolve(&newReq); err != nil {
+			return req, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("rejected by resolver plugin: %s", err)}
+		}
+	}
+
+	// Request types with spec errors cannot be built. The RM only starts with
+	// them if config.Specs.AllowErrors is true.
+	if errs, ok := m.unbuildable[newReq.Type]; ok {
+		return req, serr.ErrInvalidCreateRequest{
+			Message: fmt.Sprintf("request %s cannot be built because its spec has errors (see GET /api/v1/spec-report): %s", newReq.Type, strings.Join(errs, "; ")),
+		}
+	}
+
+	// Deprecated request types with a sunset date are rejected from that date.
+	// Spec checks validate the date.
+	if seq, ok := m.sequences[newReq.Type]; ok && seq.Sunset != "" {
+		sunset, _ := time.Parse(spec.SUNSET_FORMAT, seq.Sunset)
+		if !time.Now().Before(sunset) {
+			return req, serr.ErrInvalidCreateRequest{
+				Message: fmt.Sprintf("request %s is deprecated and was sunset on %s: %s", newReq.Type, seq.Sunset, seq.Deprecated),
+			}
+		}
+	}
 
 	reqIdBytes := xid.New()
 	reqId := reqIdBytes.String()
 	req = proto.Request{
-		Id:        reqId,
-		Type:      newReq.Type,
-		CreatedAt: time.Now().UTC(),
-		State:     proto.STATE_PENDING,
-		User:      newReq.User, // Caller.Name if not set by SetUsername
+		Id:           reqId,
+		Type:         newReq.Type,
+		CreatedAt:    time.Now().UTC(),
+		State:        proto.STATE_PENDING,
+		User:         newReq.User, // Caller.Name if not set by SetUsername
+		Team:         newReq.Team, // Caller.Team
+		SpecVersion:  m.specVersion,
+		Namespace:    m.namespace(newReq.Type),
+		RetryOf:      retryOf,
+		RetryCount:   retryCount,
+		ArgOverrides: argOverrides,
+
+		CorrelationId: newReq.CorrelationId,
+		Origin:        newReq.Origin,
+		GroupId:       newReq.GroupId,
+	}
+	if newReq.Deadline != nil {
+		deadline := newReq.Deadline.UTC()
+		req.Deadline = &deadline
 	}
 
+	// The resolver must use the sequence graphs (templates) built from the specs
+	// that the request is saved with, else the job chain doesn't match its specs.
+	// It's a string comparison: template versions are hashed when specs are loaded.
+	if m.templateVersion != "" {
+		if v := m.resolverFactory.TemplateVersion(); v != m.templateVersion {
+			return req, fmt.Errorf("resolver template version %s does not match spec template version %s", v, m.templateVersion)
+		}
+	}
+
+	// Wait for a build pool worker. Building a job chain can use a lot of
+	// memory, so it's limited when many requests are created at once. The
+	// chain size is reported when done: it's the estimate for the next build.
+	var chainSize int64
+	buildDone, err := m.buildPool.Acquire(req.Type)
+	if err != nil {
+		return req, err
+	}
+	defer func() { buildDone(chainSize) }()
+
 	// ----------------------------------------------------------------------
 	// Verify and finalize request args. The final request args are given
 	// (from caller) + optional + static.
@@ -131,6 +323,17 @@ func (m *manager) Create(newReq proto.CreateRequest) (proto.Request, error) {
 	}
 	req.Args = reqArgs
 
+	// Encrypt the given values of sensitive args, if enabled. From here on,
+	// they're only ciphertext: in job args, arg overrides, and the create request
+	// and request args saved in request_archives. Spec checks don't let nodes
+	// evaluate sensitive args (if:, each:, until:, arg templates), because the
+	// job chain is built with the ciphertext.
+	if m.argKeys != nil {
+		if err := m.encryptArgs(req.Id, retryOf, &newReq, reqArgs, argOverrides); err != nil {
+			return req, err
+		}
+	}
+
 	// Copy requests args -> initial job args. We save the former as a record
 	// (request_archives.args) of every request arg that the request was started
 	// with. BuildRequestGraph modifies and greatly expands the latter (job args).
@@ -147,38 +350,69 @@ func (m *manager) Create(newReq proto.CreateRequest) (proto.Request, error) {
 	if err != nil {
 		return req, err
 	}
-	jc := &proto.JobChain{
-		AdjacencyList: reqGraph.Edges,
-		RequestId:     reqId,
-		State:         proto.STATE_PENDING,
-		Jobs:          map[string]proto.Job{},
-	}
-	for jobId, node := range reqGraph.Nodes {
-		job := proto.Job{
-			Type:              *node.Spec.NodeType,
-			Id:                node.Id,
-			Name:              node.Name,
-			Bytes:             node.JobBytes,
-			Args:              node.Args,
-			Retry:             node.Retry,
-			RetryWait:         node.RetryWait,
-			SequenceId:        node.SequenceId,
-			SequenceRetry:     node.SequenceRetry,
-			SequenceRetryWait: node.SequenceRetryWait,
-			State:             proto.STATE_PENDING,
-		}
-		jc.Jobs[jobId] = job
+	req.Warnings = resolver.Warnings()
+	jc := NewJobChain(req, reqGraph)
+	if seq, ok := m.sequences[req.Type]; ok {
+		setChainSpec(jc, seq)
 	}
 
 	req.JobChain = jc
 	req.TotalJobs = uint(len(jc.Jobs))
 
+	// Let the resolver plugin validate (or reject) and annotate the request
+	// before it's saved
+	if m.resolverPlugin != nil {
+		if err := m.resolverPlugin.PostResolve(&req); err != nil {
+			return req, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("rejected by resolver plugin: %s", err)}
+		}
+		if req.JobChain == nil {
+			return req, fmt.Errorf("resolver plugin PostResolve set request job chain to nil")
+		}
+		req.TotalJobs = uint(len(req.JobChain.Jobs))
+	}
+
+	// Start from a job: the jobs before it are complete. Done after PostResolve
+	// because it can change the jobs.
+	if newReq.FromJob != "" {
+		ids, err := StartFromJob(req.JobChain, newReq.FromJob)
+		if err != nil {
+			return req, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("cannot start from job %s: %s", newReq.FromJob, err)}
+		}
+		req.FinishedJobs = req.JobChain.FinishedJobs
+		requestLogger(req).Infof("starting from job %s: %d jobs before it are complete: %v", newReq.FromJob, len(ids), ids)
+	}
+
+	// Sum job costs after PostResolve, which can change the jobs, and enforce
+	// the request budget max, if any
+	for _, job := range req.JobChain.Jobs {
+		req.Cost += job.Cost
+	}
+	if seq, ok := m.sequences[req.Type]; ok && seq.Budget != nil && seq.Budget.Max > 0 && req.Cost > seq.Budget.Max {
+		return req, serr.ErrInvalidCreateRequest{
+			Message: fmt.Sprintf("request cost %d exceeds budget max %d", req.Cost, seq.Budget.Max),
+		}
+	}
+
+	// Reject the request if another unfinished request of the type has the same
+	// values of the spec uniqueBy args. It's checked last, just before the
+	// request is saved, so the window in which two requests can both pass is as
+	// short as possible.
+	if seq, ok := m.sequences[req.Type]; ok && len(seq.UniqueBy) > 0 {
+		if err := m.checkUnique(req, seq.UniqueBy); err != nil {
+			return req, err
+		}
+	}
+
 	// ----------------------------------------------------------------------
 	// Serial data for request_archives
-	jobChainBytes, err := json.Marshal(req.JobChain)
+	jobChainBytes, err := proto.EncodeJobChain(*req.JobChain, proto.ChainFormat())
 	if err != nil {
 		return req, fmt.Errorf("cannot marshal job chain: %s", err)
 	}
+	chainSize = int64(len(jobChainBytes))
+	if err := m.buildPool.CheckSize(chainSize); err != nil {
+		return req, err
+	}
 	newReqBytes, err := json.Marshal(newReq)
 	if err != nil {
 		return req, fmt.Errorf("cannot marshal create request: %s", err)
@@ -187,6 +421,30 @@ func (m *manager) Create(newReq proto.CreateRequest) (proto.Request, error) {
 	if err != nil {
 		return req, fmt.Errorf("cannot marshal request args: %s", err)
 	}
+	var warnings interface{} // NULL if no warnings
+	if len(req.Warnings) > 0 {
+		warningsBytes, err := json.Marshal(req.Warnings)
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal warnings: %s", err)
+		}
+		warnings = string(warningsBytes)
+	}
+	var overrides interface{} // NULL if not a manual retry with arg overrides
+	if len(req.ArgOverrides) > 0 {
+		argOverridesBytes, err := json.Marshal(req.ArgOverrides)
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal arg overrides: %s", err)
+		}
+		overrides = string(argOverridesBytes)
+	}
+	var origin interface{} // NULL if caller did not set origin
+	if len(req.Origin) > 0 {
+		originBytes, err := json.Marshal(req.Origin)
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal origin: %s", err)
+		}
+		origin = string(originBytes)
+	}
 
 	// ----------------------------------------------------------------------
 	// Save everything in a transaction. request_archive is immutable data,
@@ -200,29 +458,85 @@ func (m *manager) Create(newReq proto.CreateRequest) (proto.Request, error) {
 		}
 		defer txn.Rollback()
 
-		q := "INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES (?, ?, ?, ?)"
+		q := "INSERT INTO request_archives (request_id, create_request, args, job_chain, warnings, arg_overrides, origin) VALUES (?, ?, ?, ?, ?, ?, ?)"
 		_, err = txn.ExecContext(ctx, q,
 			reqIdBytes,
 			string(newReqBytes),
 			string(reqArgsBytes),
 			jobChainBytes,
+			warnings,
+			overrides,
+			origin,
 		)
 		if err != nil {
 			return serr.NewDbError(err, "INSERT request_archives")
 		}
 
-		q = "INSERT INTO requests (request_id, type, state, user, created_at, total_jobs) VALUES (?, ?, ?, ?, ?, ?)"
+		// If SpecVersion is empty, we want to set the db field to NULL (not an empty string).
+		var specVersion interface{}
+		if req.SpecVersion != "" {
+			specVersion = req.SpecVersion
+		}
+
+		var retryOf interface{}
+		if req.RetryOf != "" {
+			retryOf = req.RetryOf
+		}
+
+		var team interface{}
+		if req.Team != "" {
+			team = req.Team
+		}
+
+		var namespace interface{}
+		if req.Namespace != "" {
+			namespace = req.Namespace
+		}
+
+		var deadline interface{}
+		if req.Deadline != nil {
+			deadline = *req.Deadline
+		}
+
+		var correlationId interface{}
+		if req.CorrelationId != "" {
+			correlationId = req.CorrelationId
+		}
+
+		var groupId interface{}
+		if req.GroupId != "" {
+			groupId = req.GroupId
+		}
+
+		q = "INSERT INTO requests (request_id, type, state, user, team, namespace, created_at, total_jobs, finished_jobs, spec_version, retry_of, retry_count, cost, deadline, correlation_id, group_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
 		_, err = txn.ExecContext(ctx, q,
 			reqIdBytes,
 			req.Type,
 			req.State,
 			req.User,
+			team,
+			namespace,
 			req.CreatedAt,
 			req.TotalJobs,
+			req.FinishedJobs,
+			specVersion,
+			retryOf,
+			req.RetryCount,
+			req.Cost,
+			deadline,
+			correlationId,
+			groupId,
 		)
 		if err != nil {
 			return serr.NewDbError(err, "INSERT requests")
 		}
+
+		// Save request args as strings in request_args, too, so requests can
+		// be found by arg value (see Find)
+		if err := insertArgs(ctx, txn, "INSERT", reqIdBytes, reqArgs); err != nil {
+			return err
+		}
+
 		return txn.Commit()
 	}, nil)
 	return req, err
@@ -236,16 +550,28 @@ func (m *manager) Get(requestId string) (proto.Request, error) {
 
 	// Nullable columns.
 	var user sql.NullString
+	var team sql.NullString
+	var namespace sql.NullString
 	var jrURL sql.NullString
+	var specVersion sql.NullString
+	var retryOf sql.NullString
 	startedAt := mysql.NullTime{}
 	finishedAt := mysql.NullTime{}
+	deadline := mysql.NullTime{}
+	var resumeError sql.NullString
+	var correlationId sql.NullString
+	var groupId sql.NullString
+	var partitionOf sql.NullString
 
 	var reqArgsBytes []byte
+	var warningsBytes []byte
+	var argOverridesBytes []byte
+	var originBytes []byte
 
 	// Technically, a LEFT JOIN shouldn't be necessary, but we have tests that
 	// create a request but no corresponding request_archive which makes a plain
 	// JOIN not match any row.
-	q := "SELECT request_id, type, state, user, created_at, started_at, finished_at, total_jobs, finished_jobs, jr_url, args" +
+	q := "SELECT request_id, type, state, user, team, namespace, created_at, started_at, finished_at, total_jobs, finished_jobs, jr_url, spec_version, retry_of, retry_count, cost, deadline, resume_error, correlation_id, group_id, partitions, partition_of, args, warnings, arg_overrides, origin" +
 		" FROM requests r LEFT JOIN request_archives a USING (request_id)" +
 		" WHERE request_id = ?"
 	notFound := false
@@ -255,13 +581,28 @@ func (m *manager) Get(requestId string) (proto.Request, error) {
 			&req.Type,
 			&req.State,
 			&user,
+			&team,
+			&namespace,
 			&req.CreatedAt,
 			&startedAt,
 			&finishedAt,
 			&req.TotalJobs,
 			&req.FinishedJobs,
 			&jrURL,
+			&specVersion,
+			&retryOf,
+			&req.RetryCount,
+			&req.Cost,
+			&deadline,
+			&resumeError,
+			&correlationId,
+			&groupId,
+			&req.Partitions,
+			&partitionOf,
 			&reqArgsBytes,
+			&warningsBytes,
+			&argOverridesBytes,
+			&originBytes,
 		)
 		if err != nil {
 			switch err {
@@ -284,15 +625,42 @@ func (m *manager) Get(requestId string) (proto.Request, error) {
 	if user.Valid {
 		req.User = user.String
 	}
+	if team.Valid {
+		req.Team = team.String
+	}
+	if namespace.Valid {
+		req.Namespace = namespace.String
+	}
 	if jrURL.Valid {
 		req.JobRunnerURL = jrURL.String
 	}
+	if specVersion.Valid {
+		req.SpecVersion = specVersion.String
+	}
+	if retryOf.Valid {
+		req.RetryOf = retryOf.String
+	}
 	if startedAt.Valid {
 		req.StartedAt = &startedAt.Time
 	}
 	if finishedAt.Valid {
 		req.FinishedAt = &finishedAt.Time
 	}
+	if deadline.Valid {
+		req.Deadline = &deadline.Time
+	}
+	if resumeError.Valid {
+		req.ResumeError = resumeError.String
+	}
+	if correlationId.Valid {
+		req.CorrelationId = correlationId.String
+	}
+	if groupId.Valid {
+		req.GroupId = groupId.String
+	}
+	if partitionOf.Valid {
+		req.PartitionOf = partitionOf.String
+	}
 
 	if len(reqArgsBytes) > 0 {
 		var reqArgs []proto.RequestArg
@@ -301,6 +669,21 @@ func (m *manager) Get(requestId string) (proto.Request, error) {
 		}
 		req.Args = reqArgs
 	}
+	if len(warningsBytes) > 0 {
+		if err := json.Unmarshal(warningsBytes, &req.Warnings); err != nil {
+			return req, err
+		}
+	}
+	if len(argOverridesBytes) > 0 {
+		if err := json.Unmarshal(argOverridesBytes, &req.ArgOverrides); err != nil {
+			return req, err
+		}
+	}
+	if len(originBytes) > 0 {
+		if err := json.Unmarshal(originBytes, &req.Origin); err != nil {
+			return req, err
+		}
+	}
 	return req, nil
 }
 
@@ -310,23 +693,45 @@ func (m *manager) Start(requestId string) error {
 		return err
 	}
 
-	// Only start the request if it's currently Pending.
+	// Starting a request that was already started is a no-op, so callers can
+	// safely retry. Only a pending request can be started.
 	if req.State != proto.STATE_PENDING {
+		if started(req) {
+			return nil
+		}
 		return serr.NewErrInvalidState(proto.StateName[proto.STATE_PENDING], proto.StateName[req.State])
 	}
 
+	// A very wide job chain can be split into partition requests that run on
+	// different Job Runners (see PartitionJobChain)
+	if parts := m.partitions(req); parts != nil {
+		return m.startPartitions(req, parts)
+	}
+
 	// Send the request's job chain to the job runner, which will start running it.
+	jrURL, err := m.place(req)
+	if err != nil {
+		return err
+	}
+	req.JobChain.FenceToken = FIRST_FENCE_TOKEN
 	var chainURL *url.URL
 	for i := 0; i < JR_TRIES; i++ {
 		if i != 0 {
 			time.Sleep(JR_RETRY_WAIT)
 		}
-		chainURL, err = m.jrClient.NewJobChain(m.defaultJRURL, *req.JobChain)
+		chainURL, err = m.jrClient.NewJobChain(jrURL, *req.JobChain)
 		if err == nil {
 			break
 		}
 	}
 	if err != nil {
+		// A JR accepts a duplicate job chain it's already running (retries
+		// above are safe), but if another caller started the request
+		// concurrently on another JR, this one can fail. The request is
+		// started, so that's not an error.
+		if started, _ := m.startedElsewhere(requestId); started {
+			return nil
+		}
 		return err
 	}
 
@@ -341,53 +746,166 @@ func (m *manager) Start(requestId string) error {
 	// something else has changed the state since then.
 	err = m.updateRequest(req, proto.STATE_PENDING)
 	if err != nil {
+		if err == ErrNotUpdated {
+			if started, _ := m.startedElsewhere(requestId); started {
+				return nil
+			}
+		}
 		return err
 	}
+	m.sm.Changed(req, proto.STATE_PENDING, req.State)
 
 	return nil
 }
 
-func (m *manager) Stop(requestId string) error {
+// place returns the base URL of the Job Runner to start the request on: the one
+// chosen by the placement policy in the request spec, if any, else the default.
+func (m *manager) place(req proto.Request) (string, error) {
+	seq, ok := m.sequences[req.Type]
+	if !ok || seq.Placement == nil {
+		return m.defaultJRURL, nil
+	}
+	policy, ok := m.placement[seq.Placement.Policy]
+	if !ok {
+		return "", fmt.Errorf("placement policy %s not found", seq.Placement.Policy)
+	}
+	in := placement.Input{
+		Request:   req,
+		ChainSize: len(req.JobChain.Jobs),
+		Labels:    seq.Placement.Labels,
+	}
+	if m.jobRunners != nil {
+		in.JobRunners = m.jobRunners()
+	}
+	jrURL, err := policy.Place(in)
+	if err != nil {
+		return "", err
+	}
+	if jrURL == "" {
+		return m.defaultJRURL, nil
+	}
+	return jrURL, nil
+}
+
+// startedElsewhere returns true if the request is no longer pending because
+// something else (usually a concurrent Start) started it.
+func (m *manager) startedElsewhere(requestId string) (bool, error) {
+	req, err := m.Get(requestId)
+	if err != nil {
+		return false, err
+	}
+	return req.State != proto.STATE_PENDING && started(req), nil
+}
+
+// started returns true if the request was started: it's running or has a start
+// time. A request that failed to start (FailPending) was never started.
+func started(req proto.Request) bool {
+	return req.State == proto.STATE_RUNNING || req.StartedAt != nil
+}
+
+func (m *manager) Stop(requestId string, timeout time.Duration) error {
 	req, err := m.Get(requestId)
 	if err != nil {
 		return err
 	}
 
-	if req.State == proto.STATE_COMPLETE {
+	// Stopping a request that already finished is a no-op, so callers can
+	// safely retry. A pending or suspended request cannot be stopped because
+	// no JR is running it.
+	switch req.State {
+	case proto.STATE_RUNNING:
+	case proto.STATE_PENDING, proto.STATE_SUSPENDED:
+		return serr.NewErrInvalidState(proto.StateName[proto.STATE_RUNNING], proto.StateName[req.State])
+	default:
 		return nil
 	}
 
-	// Return an error unless the request is in the running state, which prevents
-	// us from stopping a request which should not be able to be stopped.
-	if req.State != proto.STATE_RUNNING {
-		return serr.NewErrInvalidState(proto.StateName[proto.STATE_RUNNING], proto.StateName[req.State])
+	// A partitioned request has no JR; its partition requests do
+	if req.Partitions > 0 {
+		return m.stopPartitions(req, timeout)
 	}
 
 	// Tell the JR to stop running the job chain for the request.
-	err = m.jrClient.StopRequest(req.JobRunnerURL, requestId)
+	err = m.jrClient.StopRequest(req.JobRunnerURL, requestId, timeout)
 	if err != nil {
+		// The job chain can finish between Get and StopRequest, in which case
+		// the JR no longer has it. The request is finished, so that's not an error.
+		if cur, getErr := m.Get(requestId); getErr == nil && cur.State != proto.STATE_RUNNING {
+			return nil
+		}
 		return fmt.Errorf("error stopping request in Job Runner: %s", err)
 	}
 
 	return nil
 }
 
+func (m *manager) StopJob(requestId, jobId string) error {
+	req, err := m.Get(requestId)
+	if err != nil {
+		return err
+	}
+	if req.State != proto.STATE_RUNNING {
+		return serr.NewErrInvalidState(proto.StateName[proto.STATE_RUNNING], proto.StateName[req.State])
+	}
+
+	// A partitioned request has no JR; its partition requests do
+	if req.Partitions > 0 {
+		return serr.ValidationError{Message: fmt.Sprintf("request %s is partitioned: stop the job in its partition request", requestId)}
+	}
+
+	jc, err := m.JobChain(requestId)
+	if err != nil {
+		return err
+	}
+	if _, ok := jc.Jobs[jobId]; !ok {
+		return serr.JobNotFound{RequestId: requestId, JobId: jobId}
+	}
+
+	requestLogger(req).Infof("stop job %s", jobId)
+	err = m.jrClient.StopJob(req.JobRunnerURL, requestId, jobId)
+	if err != nil {
+		if _, ok := err.(serr.ErrJobNotRunning); ok {
+			return err
+		}
+		// The job chain can finish between Get and StopJob, in which case the
+		// JR no longer has it
+		if cur, getErr := m.Get(requestId); getErr == nil && cur.State != proto.STATE_RUNNING {
+			return serr.NewErrInvalidState(proto.StateName[proto.STATE_RUNNING], proto.StateName[cur.State])
+		}
+		return fmt.Errorf("error stopping job in Job Runner: %s", err)
+	}
+	return nil
+}
+
 func (m *manager) Finish(requestId string, finishParams proto.FinishRequest) error {
 	req, err := m.Get(requestId)
 	if err != nil {
 		return err
 	}
-	log.Infof("finish request: %+v", finishParams)
+	requestLogger(req).Infof("finish request: %+v", finishParams)
 
 	prevState := req.State
 
+	// The JR must report a final state, e.g. not PENDING or SUSPENDED (the JR
+	// suspends a request with Resumer.Suspend)
+	if err := m.sm.CheckFinal(req.Id, proto.STATE_RUNNING, finishParams.State); err != nil {
+		return err
+	}
+
+	// A JR that lost the request, which was taken over by another JR, cannot
+	// finish it: the other JR is running it
+	if finishParams.JobRunnerURL != "" && req.JobRunnerURL != "" && !sameJR(finishParams.JobRunnerURL, req.JobRunnerURL) {
+		return serr.ErrFenced{RequestId: req.Id, JobRunnerURL: finishParams.JobRunnerURL, Owner: req.JobRunnerURL}
+	}
+
 	req.State = finishParams.State
 	req.FinishedAt = &finishParams.FinishedAt
 	req.FinishedJobs = finishParams.FinishedJobs
 	req.JobRunnerURL = ""
 
-	// This will only update the request if the current state is RUNNING.
-	err = m.updateRequest(req, proto.STATE_RUNNING)
+	// This will only update the request if the current state is RUNNING and
+	// the fencing token is not fenced: the JR that sent it wasn't resumed since.
+	err = m.updateFencedRequest(req, proto.STATE_RUNNING, finishParams.FenceToken)
 	if err != nil {
 		if prevState != proto.STATE_RUNNING {
 			// This should never happen - we never finish a request that isn't running.
@@ -395,6 +913,18 @@ func (m *manager) Finish(requestId string, finishParams proto.FinishRequest) err
 		}
 		return err
 	}
+	m.sm.Changed(req, proto.STATE_RUNNING, req.State)
+
+	// A partition request is not auto-retried: the request it's part of is
+	if req.PartitionOf != "" {
+		m.finishPartition(req)
+		return nil
+	}
+
+	// If the request failed, auto-retry it if its spec allows
+	if req.State == proto.STATE_FAIL {
+		m.goAutoRetry(req)
+	}
 
 	return nil
 }
@@ -420,6 +950,8 @@ func (m *manager) FailPending(requestId string) error {
 		}
 		return err
 	}
+	m.sm.Changed(req, proto.STATE_PENDING, req.State)
+	m.finishPartition(req)
 
 	return nil
 }
@@ -446,23 +978,30 @@ func (m *manager) Specs() []proto.RequestSpec {
 	requestList = make([]proto.RequestSpec, 0, len(sortedReqNames))
 	for _, name := range sortedReqNames {
 		s := proto.RequestSpec{
-			Name: name,
-			Args: []proto.RequestArg{},
+			Name:        name,
+			Args:        []proto.RequestArg{},
+			Deprecated:  req[name].Deprecated,
+			Sunset:      req[name].Sunset,
+			Namespace:   req[name].Namespace,
+			Description: req[name].Description,
+			DocsURL:     req[name].DocsURL,
 		}
 		for _, arg := range req[name].Args.Required {
 			a := proto.RequestArg{
-				Name: *arg.Name,
-				Desc: arg.Desc,
-				Type: proto.ARG_TYPE_REQUIRED,
+				Name:      *arg.Name,
+				Desc:      arg.Desc,
+				Type:      proto.ARG_TYPE_REQUIRED,
+				Sensitive: arg.Sensitive,
 			}
 			s.Args = append(s.Args, a)
 		}
 		for _, arg := range req[name].Args.Optional {
 			a := proto.RequestArg{
-				Name:    *arg.Name,
-				Desc:    arg.Desc,
-				Type:    proto.ARG_TYPE_OPTIONAL,
-				Default: arg.Default,
+				Name:      *arg.Name,
+				Desc:      arg.Desc,
+				Type:      proto.ARG_TYPE_OPTIONAL,
+				Default:   arg.Default,
+				Sensitive: arg.Sensitive,
 			}
 			s.Args = append(s.Args, a)
 		}
@@ -472,6 +1011,94 @@ func (m *manager) Specs() []proto.RequestSpec {
 	return requestList
 }
 
+func (m *manager) Metadata(reqType string) (proto.RequestTypeMetadata, error) {
+	var md proto.RequestTypeMetadata
+	found := false
+	for _, rs := range m.Specs() {
+		if rs.Name == reqType {
+			md.Request = rs
+			found = true
+			break
+		}
+	}
+	if !found {
+		return md, serr.RequestTypeNotFound{Type: reqType}
+	}
+
+	// Request sequence first, then every subsequence it uses (directly or
+	// through other subsequences and conditionals) by name
+	subseqs := map[string]bool{}
+	var visit func(seq *spec.Sequence)
+	visit = func(seq *spec.Sequence) {
+		for _, node := range seq.Nodes {
+			names := []string{}
+			switch {
+			case node.IsSequence() && node.NodeType != nil:
+				names = append(names, *node.NodeType)
+			case node.IsConditional():
+				for _, name := range node.Eq {
+					names = append(names, name)
+				}
+			}
+			for _, name := range names {
+				if subseqs[name] || name == reqType {
+					continue
+				}
+				if sub, ok := m.sequences[name]; ok {
+					subseqs[name] = true
+					visit(sub)
+				}
+			}
+		}
+	}
+	visit(m.sequences[reqType])
+	names := make([]string, 0, len(subseqs))
+	for name := range subseqs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	md.Sequences = make([]proto.SequenceMetadata, 0, len(names)+1)
+	for _, name := range append([]string{reqType}, names...) {
+		md.Sequences = append(md.Sequences, sequenceMetadata(m.sequences[name]))
+	}
+	return md, nil
+}
+
+func sequenceMetadata(seq *spec.Sequence) proto.SequenceMetadata {
+	sm := proto.SequenceMetadata{
+		Name:        seq.Name,
+		Description: seq.Description,
+		DocsURL:     seq.DocsURL,
+		Nodes:       make([]proto.NodeMetadata, 0, len(seq.Nodes)),
+	}
+	for name, node := range seq.Nodes {
+		nm := proto.NodeMetadata{
+			Name:        name,
+			Description: node.Description,
+			DocsURL:     node.DocsURL,
+		}
+		if node.Category != nil {
+			nm.Category = *node.Category
+		}
+		if node.NodeType != nil && (node.IsJob() || node.IsSequence()) {
+			nm.Type = *node.NodeType
+		}
+		sm.Nodes = append(sm.Nodes, nm)
+	}
+	sort.Slice(sm.Nodes, func(i, j int) bool { return sm.Nodes[i].Name < sm.Nodes[j].Name })
+	return sm
+}
+
+// namespace returns the namespace of the request type, or an empty string if
+// the request type is not in a namespace or does not exist.
+func (m *manager) namespace(reqType string) string {
+	if seq, ok := m.sequences[reqType]; ok {
+		return seq.Namespace
+	}
+	return ""
+}
+
 func (m *manager) JobChain(requestId string) (proto.JobChain, error) {
 	var jobChain proto.JobChain
 	var jobChainBytes []byte // raw job chains are stored as blobs in the db.
@@ -490,7 +1117,7 @@ func (m *manager) JobChain(requestId string) (proto.JobChain, error) {
 	}
 
 	// Unmarshal the job chain into a proto.JobChain.
-	if err := json.Unmarshal(jobChainBytes, &jobChain); err != nil {
+	if err := proto.DecodeJobChain(jobChainBytes, &jobChain); err != nil {
 		return jobChain, fmt.Errorf("cannot unmarshal job chain: %s", err)
 	}
 
@@ -530,7 +1157,7 @@ func (m *manager) GetWithJC(requestId string) (proto.Request, error) {
 	}
 
 	var jobChain proto.JobChain
-	if err := json.Unmarshal(jobChainBytes, &jobChain); err != nil {
+	if err := proto.DecodeJobChain(jobChainBytes, &jobChain); err != nil {
 		return req, fmt.Errorf("cannot unmarshal job chain: %s", err)
 	}
 	req.JobChain = &jobChain
@@ -540,7 +1167,7 @@ func (m *manager) GetWithJC(requestId string) (proto.Request, error) {
 
 func (m *manager) Find(filter proto.RequestFilter) ([]proto.Request, error) {
 	// Build the query from the filter.
-	query := "SELECT request_id, type, state, user, created_at, started_at, finished_at, total_jobs, finished_jobs, jr_url FROM requests "
+	query := "SELECT request_id, type, state, user, team, namespace, created_at, started_at, finished_at, total_jobs, finished_jobs, jr_url, spec_version, retry_of, retry_count, cost, deadline, correlation_id, group_id, partitions, partition_of FROM requests "
 
 	var fields []string
 	var values []interface{}
@@ -552,6 +1179,35 @@ func (m *manager) Find(filter proto.RequestFilter) ([]proto.Request, error) {
 		fields = append(fields, "user = ?")
 		values = append(values, filter.User)
 	}
+	if filter.CorrelationId != "" {
+		fields = append(fields, "correlation_id = ?")
+		values = append(values, filter.CorrelationId)
+	}
+	if filter.GroupId != "" {
+		fields = append(fields, "group_id = ?")
+		values = append(values, filter.GroupId)
+	}
+	if filter.PartitionOf != "" {
+		fields = append(fields, "partition_of = ?")
+		values = append(values, filter.PartitionOf)
+	}
+	if len(filter.Namespaces) != 0 {
+		// Empty namespace matches requests not in a namespace (NULL)
+		nsSQL := []string{}
+		for _, ns := range filter.Namespaces {
+			if ns == "" {
+				nsSQL = append(nsSQL, "namespace IS NULL")
+			} else {
+				nsSQL = append(nsSQL, "namespace = ?")
+				values = append(values, ns)
+			}
+		}
+		fields = append(fields, "("+strings.Join(nsSQL, " OR ")+")")
+	}
+	for name, value := range filter.Args {
+		fields = append(fields, "request_id IN (SELECT request_id FROM request_args WHERE name = ? AND value = ?)")
+		values = append(values, name, ArgValueString(value))
+	}
 	if len(filter.States) != 0 {
 		stateSQL := fmt.Sprintf("state IN (%s)", strings.TrimRight(strings.Repeat("?, ", len(filter.States)), ", "))
 		fields = append(fields, stateSQL)
@@ -603,21 +1259,40 @@ func (m *manager) Find(filter proto.RequestFilter) ([]proto.Request, error) {
 		var req proto.Request
 		// Nullable columns:
 		var user sql.NullString
+		var team sql.NullString
+		var namespace sql.NullString
 		var jrURL sql.NullString
+		var specVersion sql.NullString
+		var retryOf sql.NullString
 		startedAt := mysql.NullTime{}
 		finishedAt := mysql.NullTime{}
+		deadline := mysql.NullTime{}
+		var correlationId sql.NullString
+		var groupId sql.NullString
+		var partitionOf sql.NullString
 
 		err := rows.Scan(
 			&req.Id,
 			&req.Type,
 			&req.State,
 			&user,
+			&team,
+			&namespace,
 			&req.CreatedAt,
 			&startedAt,
 			&finishedAt,
 			&req.TotalJobs,
 			&req.FinishedJobs,
 			&jrURL,
+			&specVersion,
+			&retryOf,
+			&req.RetryCount,
+			&req.Cost,
+			&deadline,
+			&correlationId,
+			&groupId,
+			&req.Partitions,
+			&partitionOf,
 		)
 		if err != nil {
 			return []proto.Request{}, fmt.Errorf("Error scanning row returned from MySQL: %s", err)
@@ -626,15 +1301,39 @@ func (m *manager) Find(filter proto.RequestFilter) ([]proto.Request, error) {
 		if user.Valid {
 			req.User = user.String
 		}
+		if team.Valid {
+			req.Team = team.String
+		}
+		if namespace.Valid {
+			req.Namespace = namespace.String
+		}
 		if jrURL.Valid {
 			req.JobRunnerURL = jrURL.String
 		}
+		if specVersion.Valid {
+			req.SpecVersion = specVersion.String
+		}
+		if retryOf.Valid {
+			req.RetryOf = retryOf.String
+		}
 		if startedAt.Valid {
 			req.StartedAt = &startedAt.Time
 		}
 		if finishedAt.Valid {
 			req.FinishedAt = &finishedAt.Time
 		}
+		if deadline.Valid {
+			req.Deadline = &deadline.Time
+		}
+		if correlationId.Valid {
+			req.CorrelationId = correlationId.String
+		}
+		if groupId.Valid {
+			req.GroupId = groupId.String
+		}
+		if partitionOf.Valid {
+			req.PartitionOf = partitionOf.String
+		}
 
 		requests = append(requests, req)
 	}
@@ -645,48 +1344,814 @@ func (m *manager) Find(filter proto.RequestFilter) ([]proto.Request, error) {
 	return requests, nil
 }
 
-// ------------------------------------------------------------------------- //
-
-// Updates the state, started/finished timestamps, and JR url of the provided
-// request. The request is updated only if its current state (in the db) matches
-// the state provided.
-func (m *manager) updateRequest(req proto.Request, curState byte) error {
-	ctx := context.TODO()
-
-	// If JobRunnerURL is empty, we want to set the db field to NULL (not an empty string).
-	var jrURL interface{}
-	if req.JobRunnerURL != "" {
-		jrURL = req.JobRunnerURL
+func (m *manager) History(reqType string, since time.Time, limit uint) (proto.RequestHistory, error) {
+	h := proto.RequestHistory{
+		Type:   reqType,
+		Since:  since,
+		States: map[string]uint{},
 	}
 
-	// Fields that should never be updated by this package are not listed in this query.
-	q := "UPDATE requests SET state = ?, started_at = ?, finished_at = ?, finished_jobs = ?, jr_url = ?  WHERE request_id = ? AND state = ?"
-	var res sql.Result
-	err := retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
-		var err error
-		res, err = m.dbConnector.ExecContext(ctx, q,
-			req.State,
-			req.StartedAt,
-			req.FinishedAt,
-			req.FinishedJobs,
-			jrURL,
-			req.Id,
-			curState,
-		)
-		return err
-	}, nil)
+	var err error
+	h.Requests, err = m.Find(proto.RequestFilter{Type: reqType, Since: since, Limit: limit})
 	if err != nil {
-		return serr.NewDbError(err, "UPDATE requests")
+		return h, err
 	}
 
-	cnt, err := res.RowsAffected()
+	// Same conditions as Find so the summary matches the requests
+	where := "type = ? AND (finished_at > ? OR finished_at IS NULL)"
+	values := []interface{}{reqType, since.Format(time.RFC3339Nano)}
+
+	ctx := context.Background()
+	q := "SELECT state, COUNT(*), COUNT(finished_at) FROM requests WHERE " + where + " GROUP BY state"
+	rows, err := m.dbConnector.QueryContext(ctx, q, values...)
 	if err != nil {
-		return err
+		return h, serr.NewDbError(err, "SELECT requests (states)")
+	}
+	defer rows.Close()
+	var complete uint
+	for rows.Next() {
+		var state byte
+		var n, finished uint
+		if err := rows.Scan(&state, &n, &finished); err != nil {
+			return h, fmt.Errorf("Error scanning row returned from MySQL: %s", err)
+		}
+		name, ok := proto.StateName[state]
+		if !ok {
+			name = proto.StateName[proto.STATE_UNKNOWN]
+		}
+		h.States[name] += n
+		h.Total += n
+		h.Finished += finished
+		if state == proto.STATE_COMPLETE {
+			complete = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return h, fmt.Errorf("Error iterating over rows returned from MySQL: %s", err)
 	}
 
-	switch cnt {
+	// Durations of finished requests, sorted for the median
+	q = "SELECT TIMESTAMPDIFF(MICROSECOND, started_at, finished_at) FROM requests WHERE " + where +
+		" AND finished_at IS NOT NULL AND started_at IS NOT NULL ORDER BY 1"
+	rows, err = m.dbConnector.QueryContext(ctx, q, values...)
+	if err != nil {
+		return h, serr.NewDbError(err, "SELECT requests (durations)")
+	}
+	defer rows.Close()
+	durations := []int64{} // microseconds
+	for rows.Next() {
+		var d int64
+		if err := rows.Scan(&d); err != nil {
+			return h, fmt.Errorf("Error scanning row returned from MySQL: %s", err)
+		}
+		durations = append(durations, d)
+	}
+	if err := rows.Err(); err != nil {
+		return h, fmt.Errorf("Error iterating over rows returned from MySQL: %s", err)
+	}
+
+	if h.Finished > 0 {
+		h.SuccessRate = float64(complete) / float64(h.Finished)
+	}
+	if len(durations) > 0 {
+		mid := len(durations) / 2
+		median := float64(durations[mid])
+		if len(durations)%2 == 0 {
+			median = float64(durations[mid-1]+durations[mid]) / 2
+		}
+		h.MedianDuration = median / 1e6
+	}
+
+	return h, nil
+}
+
+func (m *manager) Export(requestId string) (proto.RequestBundle, error) {
+	b := proto.RequestBundle{
+		JobLogs:    []proto.JobLog{},
+		ExportedAt: time.Now().UTC(),
+		Version:    version.Version(),
+	}
+
+	req, err := m.GetWithJC(requestId)
+	if err != nil {
+		return b, err
+	}
+	b.Request = req
+
+	b.CreateRequest, err = m.createRequest(requestId)
+	if err != nil {
+		return b, err
+	}
+
+	if req.State != proto.STATE_SUSPENDED {
+		return b, nil
+	}
+
+	// The SJC might not exist if the request was just resumed, in which case
+	// the bundle doesn't have one
+	ctx := context.TODO()
+	var sjcBytes []byte
+	q := "SELECT suspended_job_chain FROM suspended_job_chains WHERE request_id = ?"
+	err = retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		err := m.dbConnector.QueryRowContext(ctx, q, requestId).Scan(&sjcBytes)
+		if err == sql.ErrNoRows {
+			return nil // don't try again
+		}
+		return err
+	}, nil)
+	if err != nil {
+		return b, serr.NewDbError(err, "SELECT suspended_job_chains")
+	}
+	if len(sjcBytes) > 0 {
+		var sjc proto.SuspendedJobChain
+		if err := proto.DecodeSuspendedJobChain(sjcBytes, &sjc); err != nil {
+			return b, fmt.Errorf("cannot unmarshal suspended job chain: %s", err)
+		}
+		b.SuspendedJobChain = &sjc
+	}
+
+	return b, nil
+}
+
+func (m *manager) Import(b proto.RequestBundle) (proto.Request, error) {
+	req := b.Request
+	if req.Id == "" || req.Type == "" {
+		return req, serr.ValidationError{Message: "request id and type are required"}
+	}
+	if req.JobChain == nil {
+		return req, serr.ValidationError{Message: "request job chain is required"}
+	}
+	if req.JobChain.RequestId != req.Id {
+		return req, serr.ValidationError{Message: fmt.Sprintf("job chain request id %s does not match request id %s", req.JobChain.RequestId, req.Id)}
+	}
+	for _, jl := range b.JobLogs {
+		if jl.RequestId != req.Id {
+			return req, serr.ValidationError{Message: fmt.Sprintf("job log request id %s does not match request id %s", jl.RequestId, req.Id)}
+		}
+	}
+
+	_, err := m.Get(req.Id)
+	if err == nil {
+		return req, serr.ValidationError{Message: fmt.Sprintf("request %s already exists", req.Id)}
+	}
+	if _, ok := err.(serr.RequestNotFound); !ok {
+		return req, err
+	}
+
+	// The request isn't running on any Job Runner here. Keep the SJC only if
+	// the request is suspended, in which case it's resumed like any other.
+	sjc := b.SuspendedJobChain
+	switch req.State {
+	case proto.STATE_RUNNING:
+		req.State = proto.STATE_STOPPED
+	case proto.STATE_SUSPENDED:
+		if sjc == nil {
+			req.State = proto.STATE_STOPPED
+		}
+	}
+	if req.State != proto.STATE_SUSPENDED {
+		sjc = nil
+	}
+	req.JobRunnerURL = ""
+
+	createReqBytes, err := json.Marshal(b.CreateRequest)
+	if err != nil {
+		return req, fmt.Errorf("cannot marshal create request: %s", err)
+	}
+	reqArgsBytes, err := json.Marshal(req.Args)
+	if err != nil {
+		return req, fmt.Errorf("cannot marshal request args: %s", err)
+	}
+	jobChainBytes, err := proto.EncodeJobChain(*req.JobChain, proto.ChainFormat())
+	if err != nil {
+		return req, fmt.Errorf("cannot marshal job chain: %s", err)
+	}
+	var warnings interface{} // NULL if no warnings
+	if len(req.Warnings) > 0 {
+		warningsBytes, err := json.Marshal(req.Warnings)
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal warnings: %s", err)
+		}
+		warnings = string(warningsBytes)
+	}
+	var argOverrides interface{} // NULL if no arg overrides
+	if len(req.ArgOverrides) > 0 {
+		argOverridesBytes, err := json.Marshal(req.ArgOverrides)
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal arg overrides: %s", err)
+		}
+		argOverrides = string(argOverridesBytes)
+	}
+	var origin interface{} // NULL if no origin
+	if len(req.Origin) > 0 {
+		originBytes, err := json.Marshal(req.Origin)
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal origin: %s", err)
+		}
+		origin = string(originBytes)
+	}
+	var sjcBytes []byte
+	if sjc != nil {
+		sjcBytes, err = proto.EncodeSuspendedJobChain(*sjc, proto.ChainFormat())
+		if err != nil {
+			return req, fmt.Errorf("cannot marshal suspended job chain: %s", err)
+		}
+	}
+
+	// Nullable columns are NULL if not set, like they are when created
+	var team, namespace, specVersion, retryOf, startedAt, finishedAt, deadline, correlationId interface{}
+	if req.Team != "" {
+		team = req.Team
+	}
+	if req.Namespace != "" {
+		namespace = req.Namespace
+	}
+	if req.SpecVersion != "" {
+		specVersion = req.SpecVersion
+	}
+	if req.RetryOf != "" {
+		retryOf = req.RetryOf
+	}
+	if req.StartedAt != nil {
+		startedAt = *req.StartedAt
+	}
+	if req.FinishedAt != nil {
+		finishedAt = *req.FinishedAt
+	}
+	if req.Deadline != nil {
+		deadline = *req.Deadline
+	}
+	if req.CorrelationId != "" {
+		correlationId = req.CorrelationId
+	}
+
+	// Save everything in a transaction, like create, so the request is
+	// imported completely or not at all
+	ctx := context.TODO()
+	err = retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		txn, err := m.dbConnector.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback()
+
+		q := "INSERT INTO request_archives (request_id, create_request, args, job_chain, warnings, arg_overrides, origin) VALUES (?, ?, ?, ?, ?, ?, ?)"
+		_, err = txn.ExecContext(ctx, q,
+			req.Id,
+			string(createReqBytes),
+			string(reqArgsBytes),
+			jobChainBytes,
+			warnings,
+			argOverrides,
+			origin,
+		)
+		if err != nil {
+			return serr.NewDbError(err, "INSERT request_archives")
+		}
+
+		q = "INSERT INTO requests (request_id, type, state, user, team, namespace, created_at, started_at, finished_at, total_jobs, finished_jobs, spec_version, retry_of, retry_count, cost, deadline, correlation_id) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		_, err = txn.ExecContext(ctx, q,
+			req.Id,
+			req.Type,
+			req.State,
+			req.User,
+			team,
+			namespace,
+			req.CreatedAt,
+			startedAt,
+			finishedAt,
+			req.TotalJobs,
+			req.FinishedJobs,
+			specVersion,
+			retryOf,
+			req.RetryCount,
+			req.Cost,
+			deadline,
+			correlationId,
+		)
+		if err != nil {
+			return serr.NewDbError(err, "INSERT requests")
+		}
+
+		if err := insertArgs(ctx, txn, "INSERT", req.Id, req.Args); err != nil {
+			return err
+		}
+
+		// Job logs are saved as exported, not truncated like joblog.Store.Create,
+		// because they were truncated when first saved
+		q = "INSERT INTO job_log (request_id, job_id, name, try, type, started_at, finished_at, state, `exit`, " +
+			"error, error_category, error_code, error_retryable, stdout, stderr) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+		for _, jl := range b.JobLogs {
+			var errCategory, errCode interface{}
+			if jl.ErrorCategory != "" {
+				errCategory = jl.ErrorCategory
+			}
+			if jl.ErrorCode != "" {
+				errCode = jl.ErrorCode
+			}
+			_, err = txn.ExecContext(ctx, q,
+				jl.RequestId,
+				jl.JobId,
+				jl.Name,
+				jl.Try,
+				jl.Type,
+				jl.StartedAt,
+				jl.FinishedAt,
+				jl.State,
+				jl.Exit,
+				jl.Error,
+				errCategory,
+				errCode,
+				jl.ErrorRetryable,
+				jl.Stdout,
+				jl.Stderr,
+			)
+			if err != nil {
+				return serr.NewDbError(err, "INSERT job_log")
+			}
+		}
+
+		if sjcBytes != nil {
+			q = "INSERT INTO suspended_job_chains (request_id, suspended_job_chain) VALUES (?, ?)"
+			if _, err := txn.ExecContext(ctx, q, req.Id, sjcBytes); err != nil {
+				return serr.NewDbError(err, "INSERT suspended_job_chains")
+			}
+		}
+
+		return txn.Commit()
+	}, nil)
+	return req, err
+}
+
+// checkUnique returns serr.ErrDuplicateRequest if another request of the same
+// type that's not finished (pending, running, or suspended) has the same values
+// of the uniqueBy args, compared as saved in request_args. Args without a value
+// are not compared, so they match any value. Partition requests are not checked
+// because the request they're part of is.
+func (m *manager) checkUnique(req proto.Request, uniqueBy []string) error {
+	args := map[string]string{}
+	for _, arg := range req.Args {
+		for _, name := range uniqueBy {
+			if arg.Name == name && arg.Value != nil {
+				args[name] = ArgValueString(arg.Value)
+			}
+		}
+	}
+	if len(args) == 0 {
+		return nil
+	}
+	reqs, err := m.Find(proto.RequestFilter{
+		Type:   req.Type,
+		States: []byte{proto.STATE_PENDING, proto.STATE_RUNNING, proto.STATE_SUSPENDED},
+		Args:   args,
+	})
+	if err != nil {
+		return err
+	}
+	for _, r := range reqs {
+		if r.PartitionOf != "" || r.Id == req.Id {
+			continue
+		}
+		values := make([]string, 0, len(uniqueBy))
+		for _, name := range uniqueBy {
+			if v, ok := args[name]; ok {
+				values = append(values, name+"="+v)
+			}
+		}
+		return serr.ErrDuplicateRequest{
+			RequestId: r.Id,
+			Message: fmt.Sprintf("request %s with the same %s is %s; %s allows only one at a time (spec uniqueBy)",
+				r.Id, strings.Join(values, " "), proto.StateName[r.State], req.Type),
+		}
+	}
+	return nil
+}
+
+// insertArgs inserts request args into request_args. The insert is a no-op if
+// there are no args. verb is "INSERT" or "INSERT IGNORE".
+func insertArgs(ctx context.Context, txn *sql.Tx, verb string, reqId interface{}, reqArgs []proto.RequestArg) error {
+	if len(reqArgs) == 0 {
+		return nil
+	}
+	q := verb + " INTO request_args (request_id, name, value) VALUES " +
+		strings.TrimRight(strings.Repeat("(?, ?, ?), ", len(reqArgs)), ", ")
+	values := make([]interface{}, 0, len(reqArgs)*3)
+	for _, arg := range reqArgs {
+		values = append(values, reqId, arg.Name, ArgValueString(arg.Value))
+	}
+	if _, err := txn.ExecContext(ctx, q, values...); err != nil {
+		return serr.NewDbError(err, verb+" request_args")
+	}
+	return nil
+}
+
+// ArgValueString returns the request arg value as saved in request_args: a string,
+// truncated to ARG_VALUE_MAX_LEN.
+func ArgValueString(value interface{}) string {
+	var s string
+	switch v := value.(type) {
+	case nil:
+		s = ""
+	case string:
+		s = v
+	default:
+		s = fmt.Sprintf("%v", v)
+	}
+	if len(s) > ARG_VALUE_MAX_LEN {
+		s = s[0:ARG_VALUE_MAX_LEN]
+	}
+	return s
+}
+
+// ------------------------------------------------------------------------- //
+
+// goAutoRetry auto-retries the failed request in a goroutine, so the caller (like
+// the JR finishing the request) doesn't wait while the new request is built and
+// started. The failed request is already finished, so errors are only logged.
+func (m *manager) goAutoRetry(req proto.Request) {
+	go func() {
+		if _, err := m.autoRetry(req); err != nil {
+			requestLogger(req).Errorf("error auto-retrying request %s: %s", req.Id, err)
+		}
+	}()
+}
+
+// autoRetry creates and starts a new request with the same create request as the
+// failed request if the request spec has autoRetry, the max number of auto-retries
+// has not been reached, and all jobs that failed returned a transient error category.
+// It returns the new request, or an empty request if the failed request is not
+// auto-retried.
+func (m *manager) autoRetry(req proto.Request) (proto.Request, error) {
+	seq, ok := m.sequences[req.Type]
+	if !ok || seq.AutoRetry == nil || seq.AutoRetry.Max == 0 {
+		return proto.Request{}, nil
+	}
+	if req.RetryCount >= seq.AutoRetry.Max {
+		log.Infof("not auto-retrying request %s: already retried %d of %d times", req.Id, req.RetryCount, seq.AutoRetry.Max)
+		return proto.Request{}, nil
+	}
+
+	ctx := context.TODO()
+
+	// Failed jobs and their error categories. If there are none, the request
+	// failed for some other reason (e.g. the JR), so it's not auto-retried.
+	transient := map[string]bool{}
+	for _, category := range seq.AutoRetry.Errors {
+		transient[category] = true
+	}
+	q := "SELECT job_id, error_category FROM job_log WHERE request_id = ? AND state = ?"
+	if req.Partitions > 0 {
+		// Job logs of a partitioned request are saved with its partition requests
+		q = "SELECT job_id, error_category FROM job_log WHERE request_id IN (SELECT request_id FROM requests WHERE partition_of = ?) AND state = ?"
+	}
+	var rows *sql.Rows
+	err := retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		var err error
+		rows, err = m.dbConnector.QueryContext(ctx, q, req.Id, proto.STATE_FAIL)
+		return err
+	}, nil)
+	if err != nil {
+		return proto.Request{}, serr.NewDbError(err, "SELECT job_log")
+	}
+	defer rows.Close()
+	nFailed := 0
+	for rows.Next() {
+		var jobId string
+		var category sql.NullString
+		if err := rows.Scan(&jobId, &category); err != nil {
+			return proto.Request{}, err
+		}
+		if !transient[category.String] {
+			log.Infof("not auto-retrying request %s: job %s failed with error category '%s'", req.Id, jobId, category.String)
+			return proto.Request{}, nil
+		}
+		nFailed++
+	}
+	if err := rows.Err(); err != nil {
+		return proto.Request{}, err
+	}
+	if nFailed == 0 {
+		log.Infof("not auto-retrying request %s: no failed jobs", req.Id)
+		return proto.Request{}, nil
+	}
+
+	// Create and start the new request from the original create request
+	newReq, err := m.createRequest(req.Id)
+	if err != nil {
+		return proto.Request{}, err
+	}
+	if newReq.Deadline != nil && !newReq.Deadline.After(time.Now()) {
+		log.Infof("not auto-retrying request %s: deadline %s passed", req.Id, newReq.Deadline.UTC().Format(time.RFC3339))
+		return proto.Request{}, nil
+	}
+
+	retryReq, err := m.create(newReq, req.Id, req.RetryCount+1, nil)
+	if err != nil {
+		return retryReq, err
+	}
+	requestLogger(retryReq).Infof("auto-retry %d of %d: request %s failed with transient errors, created request %s",
+		retryReq.RetryCount, seq.AutoRetry.Max, req.Id, retryReq.Id)
+	if err := m.Start(retryReq.Id); err != nil {
+		if err := m.FailPending(retryReq.Id); err != nil {
+			log.Errorf("error failing auto-retry request %s: %s", retryReq.Id, err)
+		}
+		return retryReq, fmt.Errorf("error starting auto-retry request %s: %s", retryReq.Id, err)
+	}
+	return retryReq, nil
+}
+
+func (m *manager) Retry(requestId string, r proto.RetryRequest) (proto.Request, error) {
+	req, err := m.Get(requestId)
+	if err != nil {
+		return proto.Request{}, err
+	}
+
+	// Only requests that are done but did not complete can be retried. A
+	// suspended request is resumed, not retried.
+	switch req.State {
+	case proto.STATE_FAIL, proto.STATE_STOPPED, proto.STATE_DEADLINE_EXCEEDED, proto.STATE_FAILED_RESUME:
+	default:
+		return proto.Request{}, serr.NewErrInvalidState("FAIL, STOPPED, DEADLINE_EXCEEDED, or FAILED_RESUME", proto.StateName[req.State])
+	}
+
+	seq, ok := m.sequences[req.Type]
+	if !ok {
+		return proto.Request{}, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("request %s no longer exists in the specs", req.Type)}
+	}
+
+	newReq, err := m.createRequest(requestId)
+	if err != nil {
+		return proto.Request{}, err
+	}
+
+	// Validate arg overrides against the request spec: only required and
+	// optional args can be overridden. Static args are fixed by the spec.
+	argType := map[string]string{}
+	for _, arg := range seq.Args.Required {
+		argType[*arg.Name] = proto.ARG_TYPE_REQUIRED
+	}
+	for _, arg := range seq.Args.Optional {
+		argType[*arg.Name] = proto.ARG_TYPE_OPTIONAL
+	}
+	for _, arg := range seq.Args.Static {
+		argType[*arg.Name] = proto.ARG_TYPE_STATIC
+	}
+	oldValue := map[string]interface{}{}
+	for _, arg := range req.Args {
+		oldValue[arg.Name] = arg.Value
+	}
+	names := make([]string, 0, len(r.Args))
+	for name := range r.Args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var argOverrides []proto.ArgOverride
+	for _, name := range names {
+		switch argType[name] {
+		case proto.ARG_TYPE_REQUIRED, proto.ARG_TYPE_OPTIONAL:
+		case proto.ARG_TYPE_STATIC:
+			return proto.Request{}, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("cannot override static arg %s", name)}
+		default:
+			return proto.Request{}, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("%s is not an arg of request %s", name, req.Type)}
+		}
+		if r.Args[name] == nil {
+			return proto.Request{}, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("arg %s override has no value", name)}
+		}
+		if newReq.Args == nil {
+			newReq.Args = map[string]interface{}{}
+		}
+		newReq.Args[name] = r.Args[name]
+		argOverrides = append(argOverrides, proto.ArgOverride{
+			Name:  name,
+			Old:   oldValue[name],
+			Value: r.Args[name],
+		})
+	}
+	if r.Deadline != nil {
+		newReq.Deadline = r.Deadline
+	}
+	if r.FromJob != "" {
+		newReq.FromJob = r.FromJob
+	}
+	newReq.User = r.User
+	newReq.Team = r.Team
+
+	// A manual retry doesn't count as an auto-retry (retry count 0), so the
+	// new request can be auto-retried up to the spec max again
+	retryReq, err := m.create(newReq, req.Id, 0, argOverrides)
+	if err != nil {
+		return retryReq, err
+	}
+	requestLogger(retryReq).Infof("user %s retried request %s: created request %s, arg overrides: %v, from job: %s", newReq.User, req.Id, retryReq.Id, argOverrides, newReq.FromJob)
+	return retryReq, nil
+}
+
+// encryptArgs encrypts the given values of sensitive args in the create request,
+// request args, and arg overrides for the request. Default and static values are
+// in the specs, so they're not encrypted. Values are encrypted for one request, so
+// values already encrypted for the retried request (retryOf) are decrypted and
+// encrypted again for this one. Callers cannot give other encrypted values.
+func (m *manager) encryptArgs(reqId, retryOf string, newReq *proto.CreateRequest, reqArgs []proto.RequestArg, argOverrides []proto.ArgOverride) error {
+	var names []string
+	for _, arg := range reqArgs {
+		if arg.Sensitive && arg.Given {
+			names = append(names, arg.Name)
+		}
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	plain := make(map[string]interface{}, len(newReq.Args))
+	for k, v := range newReq.Args {
+		plain[k] = v
+	}
+	for _, name := range names {
+		if v, ok := plain[name]; ok && argcrypt.IsEncrypted(v) {
+			dec, err := m.decryptRetried(v, retryOf, name)
+			if err != nil {
+				return err
+			}
+			plain[name] = dec
+		}
+	}
+	args, err := argcrypt.EncryptArgs(m.argKeys, plain, names, reqId)
+	if err != nil {
+		return err
+	}
+	newReq.Args = args
+	for i, arg := range reqArgs {
+		if arg.Sensitive && arg.Given {
+			reqArgs[i].Value = args[arg.Name]
+		}
+	}
+	for i, o := range argOverrides {
+		v, ok := args[o.Name]
+		if !ok || !argcrypt.IsEncrypted(v) {
+			continue
+		}
+		argOverrides[i].Value = v
+		if o.Old == nil {
+			continue
+		}
+		old := o.Old
+		if argcrypt.IsEncrypted(old) {
+			if old, err = m.decryptRetried(old, retryOf, o.Name); err != nil {
+				return err
+			}
+		}
+		if argOverrides[i].Old, err = argcrypt.Encrypt(m.argKeys, old, reqId, o.Name); err != nil {
+			return fmt.Errorf("cannot encrypt arg %s: %s", o.Name, err)
+		}
+	}
+	return nil
+}
+
+// decryptRetried returns the value of the arg decrypted for the retried request.
+// It returns serr.ErrInvalidCreateRequest if the request is not a retry, or if
+// the value was not encrypted for the retried request.
+func (m *manager) decryptRetried(v interface{}, retryOf, name string) (interface{}, error) {
+	if retryOf == "" {
+		return nil, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("arg %s value is encrypted: give the plaintext value", name)}
+	}
+	dec, err := argcrypt.Decrypt(m.argKeys, v.(string), retryOf)
+	if err != nil {
+		return nil, serr.ErrInvalidCreateRequest{Message: fmt.Sprintf("arg %s: %s", name, err)}
+	}
+	return dec, nil
+}
+
+// NewJobChain returns the pending job chain of the request from its request graph,
+// which is built by graph.Resolver.BuildRequestGraph.
+func NewJobChain(req proto.Request, reqGraph *graph.Graph) *proto.JobChain {
+	jc := &proto.JobChain{
+		AdjacencyList: reqGraph.Edges,
+		RequestId:     req.Id,
+		RequestType:   req.Type,
+		State:         proto.STATE_PENDING,
+		Jobs:          map[string]proto.Job{},
+		Deadline:      req.Deadline,
+		CorrelationId: req.CorrelationId,
+	}
+	for jobId, node := range reqGraph.Nodes {
+		job := proto.Job{
+			Type:              *node.Spec.NodeType,
+			Id:                node.Id,
+			Name:              node.Name,
+			Bytes:             node.JobBytes,
+			Args:              node.Args,
+			Retry:             node.Retry,
+			RetryWait:         node.RetryWait,
+			SequenceId:        node.SequenceId,
+			SequenceRetry:     node.SequenceRetry,
+			SequenceRetryWait: node.SequenceRetryWait,
+			State:             proto.STATE_PENDING,
+			Cost:              node.Spec.Cost,
+			RunAfterFail:      node.RunAfterFail,
+			Skippable:         node.Spec.Skippable,
+			SkipData:          skipData(node.Spec),
+		}
+		jc.Jobs[jobId] = job
+	}
+	return jc
+}
+
+// skipData returns the defaults of the args that a skippable node sets (spec
+// sets default), keyed on arg name, or nil if it has none.
+func skipData(node *spec.Node) map[string]interface{} {
+	if !node.Skippable {
+		return nil
+	}
+	var data map[string]interface{}
+	for _, set := range node.Sets {
+		if set == nil || set.As == nil || set.Default == nil {
+			continue
+		}
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		data[*set.As] = set.Default
+	}
+	return data
+}
+
+// createRequest returns the create request of the request, as saved when the
+// request was created.
+func (m *manager) createRequest(requestId string) (proto.CreateRequest, error) {
+	var newReq proto.CreateRequest
+	var newReqBytes []byte
+	ctx := context.TODO()
+	err := retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		q := "SELECT create_request FROM request_archives WHERE request_id = ?"
+		return m.dbConnector.QueryRowContext(ctx, q, requestId).Scan(&newReqBytes)
+	}, nil)
+	if err != nil {
+		return newReq, serr.NewDbError(err, "SELECT request_archives")
+	}
+	if err := json.Unmarshal(newReqBytes, &newReq); err != nil {
+		return newReq, fmt.Errorf("cannot unmarshal create request: %s", err)
+	}
+	return newReq, nil
+}
+
+// Updates the state, started/finished timestamps, and JR url of the provided
+// request. The request is updated only if its current state (in the db) matches
+// the state provided.
+func (m *manager) updateRequest(req proto.Request, curState byte) error {
+	return m.updateFencedRequest(req, curState, 0)
+}
+
+// updateFencedRequest is updateRequest for a change from a Job Runner with the
+// fencing token (see fenceClause). It returns serr.ErrFenced if the token is fenced.
+func (m *manager) updateFencedRequest(req proto.Request, curState byte, token uint64) error {
+	if err := m.sm.Check(req.Id, curState, req.State); err != nil {
+		return err
+	}
+
+	ctx := context.TODO()
+
+	// If JobRunnerURL is empty, we want to set the db field to NULL (not an empty string).
+	var jrURL interface{}
+	if req.JobRunnerURL != "" {
+		jrURL = req.JobRunnerURL
+	}
+
+	// Fields that should never be updated by this package are not listed in this query.
+	// Starting a request also persists the first fencing token, which Start
+	// sent to the JR with the job chain (see fence.go).
+	fence, fenceArgs := fenceClause(token)
+	args := []interface{}{
+		req.State,
+		req.StartedAt,
+		req.FinishedAt,
+		req.FinishedJobs,
+		jrURL,
+	}
+	set := ""
+	if curState == proto.STATE_PENDING && req.State == proto.STATE_RUNNING {
+		set = ", fence_token = GREATEST(fence_token, ?)"
+		args = append(args, FIRST_FENCE_TOKEN)
+	}
+	q := "UPDATE requests SET state = ?, started_at = ?, finished_at = ?, finished_jobs = ?, jr_url = ?" + set + " WHERE request_id = ? AND state = ?" + fence
+	args = append(args, req.Id, curState)
+	args = append(args, fenceArgs...)
+	var res sql.Result
+	err := retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		var err error
+		res, err = m.dbConnector.ExecContext(ctx, q, args...)
+		return err
+	}, nil)
+	if err != nil {
+		return serr.NewDbError(err, "UPDATE requests")
+	}
+
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	switch cnt {
 	case 0:
-		return ErrNotUpdated
+		return notUpdated(m.dbConnector, req.Id, token)
 	case 1:
 		break
 	default:
@@ -697,3 +2162,10 @@ func (m *manager) updateRequest(req proto.Request, curState byte) error {
 
 	return nil
 }
+
+// sameJR returns true if the Job Runner URLs are the same, ignoring a trailing
+// slash. The Request Manager saves the JR URL from the location it returns when
+// a chain is started or resumed, which is the JR base URL.
+func sameJR(url1, url2 string) bool {
+	return strings.TrimSuffix(url1, "/") == strings.TrimSuffix(url2, "/")
+}
@@ -6,6 +6,7 @@ import (
 	"database/sql"
 	"fmt"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -131,6 +132,137 @@ func TestCreateMissingType(t *testing.T) {
 	}
 }
 
+func TestCreateDeadlinePassed(t *testing.T) {
+	shutdownChan := make(chan struct{})
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+	defer close(shutdownChan)
+
+	deadline := time.Now().Add(-1 * time.Minute)
+	_, err := m.Create(proto.CreateRequest{Type: "three-nodes", Deadline: &deadline})
+	switch err.(type) {
+	case serr.ErrInvalidCreateRequest:
+	default:
+		t.Errorf("err = %v, expected request.ErrInvalidCreateRequest type", err)
+	}
+}
+
+func TestCreateSunset(t *testing.T) {
+	shutdownChan := make(chan struct{})
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+		Sequences: map[string]*spec.Sequence{
+			"three-nodes": &spec.Sequence{
+				Name:       "three-nodes",
+				Request:    true,
+				Deprecated: "use four-nodes",
+				Sunset:     "2020-01-01",
+			},
+		},
+	}
+	m := request.NewManager(cfg)
+	defer close(shutdownChan)
+
+	_, err := m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	switch err.(type) {
+	case serr.ErrInvalidCreateRequest:
+	default:
+		t.Errorf("err = %v, expected request.ErrInvalidCreateRequest type", err)
+	}
+}
+
+func TestCreateUnbuildable(t *testing.T) {
+	shutdownChan := make(chan struct{})
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+		Sequences: map[string]*spec.Sequence{
+			"three-nodes": &spec.Sequence{
+				Name:    "three-nodes",
+				Request: true,
+			},
+		},
+		Unbuildable: map[string][]string{
+			"three-nodes": {"subsequence failed checks: seq-a"},
+		},
+	}
+	m := request.NewManager(cfg)
+	defer close(shutdownChan)
+
+	_, err := m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	switch err.(type) {
+	case serr.ErrInvalidCreateRequest:
+		if !strings.Contains(err.Error(), "subsequence failed checks: seq-a") {
+			t.Errorf("error %q does not contain the spec error", err)
+		}
+	default:
+		t.Errorf("err = %v, expected request.ErrInvalidCreateRequest type", err)
+	}
+}
+
+func TestCreateResolverPluginReject(t *testing.T) {
+	dbName := setupManager(t, "")
+	defer teardownManager(t, dbName)
+
+	// PreResolve sees the create request and rejects it
+	var gotType string
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+		ResolverPlugin: mock.ResolverPlugin{
+			PreResolveFunc: func(newReq *proto.CreateRequest) error {
+				gotType = newReq.Type
+				return fmt.Errorf("forced error")
+			},
+		},
+	}
+	m := request.NewManager(cfg)
+	_, err := m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	switch err.(type) {
+	case serr.ErrInvalidCreateRequest:
+	default:
+		t.Errorf("err = %v, expected request.ErrInvalidCreateRequest type", err)
+	}
+	if gotType != "three-nodes" {
+		t.Errorf("PreResolve got request type %s, expected three-nodes", gotType)
+	}
+
+	// PostResolve sees the complete job chain and rejects it
+	var gotJobs int
+	cfg.ResolverPlugin = mock.ResolverPlugin{
+		PostResolveFunc: func(req *proto.Request) error {
+			gotJobs = len(req.JobChain.Jobs)
+			return fmt.Errorf("forced error")
+		},
+	}
+	m = request.NewManager(cfg)
+	_, err = m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	switch err.(type) {
+	case serr.ErrInvalidCreateRequest:
+	default:
+		t.Errorf("err = %v, expected request.ErrInvalidCreateRequest type", err)
+	}
+	if gotJobs == 0 {
+		t.Errorf("PostResolve got request with no jobs, expected complete job chain")
+	}
+}
+
 func TestCreate(t *testing.T) {
 	dbName := setupManager(t, "")
 	defer teardownManager(t, dbName)
@@ -202,6 +334,157 @@ func TestCreate(t *testing.T) {
 	}
 }
 
+func TestCreateBudget(t *testing.T) {
+	dbName := setupManager(t, "")
+	defer teardownManager(t, dbName)
+
+	// Request cost is the sum of job costs, which PostResolve can change
+	jobCost := uint(1)
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+		Sequences: map[string]*spec.Sequence{
+			"three-nodes": &spec.Sequence{
+				Name:    "three-nodes",
+				Request: true,
+				Budget:  &spec.Budget{Max: 10},
+			},
+		},
+		ResolverPlugin: mock.ResolverPlugin{
+			PostResolveFunc: func(req *proto.Request) error {
+				for id, job := range req.JobChain.Jobs {
+					job.Cost = jobCost
+					req.JobChain.Jobs[id] = job
+				}
+				return nil
+			},
+		},
+	}
+	m := request.NewManager(cfg)
+	reqParams := proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}}
+
+	// 7 jobs * cost 1 = 7 <= budget max 10
+	req, err := m.Create(reqParams)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if req.Cost != 7 {
+		t.Errorf("request cost = %d, expected 7", req.Cost)
+	}
+	req, err = m.Get(req.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Cost != 7 {
+		t.Errorf("saved request cost = %d, expected 7", req.Cost)
+	}
+
+	// 7 jobs * cost 2 = 14 > budget max 10
+	jobCost = 2
+	_, err = m.Create(reqParams)
+	switch err.(type) {
+	case serr.ErrInvalidCreateRequest:
+	default:
+		t.Errorf("err = %v, expected request.ErrInvalidCreateRequest type", err)
+	}
+}
+
+func TestCreateUniqueBy(t *testing.T) {
+	dbName := setupManager(t, "")
+	defer teardownManager(t, dbName)
+
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+		Sequences: map[string]*spec.Sequence{
+			"three-nodes": &spec.Sequence{
+				Name:     "three-nodes",
+				Request:  true,
+				UniqueBy: []string{"foo"},
+			},
+		},
+	}
+	m := request.NewManager(cfg)
+
+	req, err := m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+
+	// Same foo value as the pending request
+	_, err = m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	switch err.(type) {
+	case serr.ErrDuplicateRequest:
+		if !strings.Contains(err.Error(), req.Id) {
+			t.Errorf("error %q does not contain the request ID %s", err, req.Id)
+		}
+	default:
+		t.Errorf("err = %v, expected serr.ErrDuplicateRequest type", err)
+	}
+
+	// Different foo value is ok
+	if _, err := m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "other-value"}}); err != nil {
+		t.Errorf("error = %s, expected nil", err)
+	}
+}
+
+func TestCreateNamespace(t *testing.T) {
+	dbName := setupManager(t, "")
+	defer teardownManager(t, dbName)
+
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+		Sequences: map[string]*spec.Sequence{
+			"three-nodes": &spec.Sequence{
+				Name:      "three-nodes",
+				Request:   true,
+				Namespace: "payments",
+			},
+		},
+	}
+	m := request.NewManager(cfg)
+	req, err := m.Create(proto.CreateRequest{Type: "three-nodes", Args: map[string]interface{}{"foo": "foo-value"}})
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if req.Namespace != "payments" {
+		t.Errorf("request namespace = '%s', expected payments", req.Namespace)
+	}
+	req, err = m.Get(req.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Namespace != "payments" {
+		t.Errorf("saved request namespace = '%s', expected payments", req.Namespace)
+	}
+
+	// Find by namespace
+	found, err := m.Find(proto.RequestFilter{Namespaces: []string{"payments"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 1 || found[0].Id != req.Id {
+		t.Errorf("found %v, expected only request %s", found, req.Id)
+	}
+	found, err = m.Find(proto.RequestFilter{Namespaces: []string{"", "dba"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(found) != 0 {
+		t.Errorf("found %v, expected no requests", found)
+	}
+}
+
 func TestGetNotFound(t *testing.T) {
 	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
 	defer teardownManager(t, dbName)
@@ -281,7 +564,7 @@ func TestStartNotPending(t *testing.T) {
 	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
 	defer teardownManager(t, dbName)
 
-	reqId := "454ae2f98a05cv16sdwt" // request is running
+	reqId := "93ec156e204ety45sgf0" // request is complete, never started
 	cfg := request.ManagerConfig{
 		ResolverFactory: ref,
 		DBConnector:     dbc,
@@ -293,7 +576,33 @@ func TestStartNotPending(t *testing.T) {
 	err := m.Start(reqId)
 	_, ok := err.(serr.ErrInvalidState)
 	if !ok {
-		t.Errorf("error = %s, expected %s", err, serr.NewErrInvalidState(proto.StateName[proto.STATE_PENDING], proto.StateName[proto.STATE_RUNNING]))
+		t.Errorf("error = %s, expected %s", err, serr.NewErrInvalidState(proto.StateName[proto.STATE_PENDING], proto.StateName[proto.STATE_COMPLETE]))
+	}
+}
+
+func TestStartAlreadyStarted(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+
+	// Starting a running request again is a no-op: the JR shouldn't be hit.
+	mockJRc := &mock.JRClient{
+		NewJobChainFunc: func(baseURL string, jc proto.JobChain) (*url.URL, error) {
+			t.Errorf("job chain sent to JR, expected no-op")
+			return nil, nil
+		},
+	}
+
+	reqId := "454ae2f98a05cv16sdwt" // request is running
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        mockJRc,
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+	if err := m.Start(reqId); err != nil {
+		t.Errorf("error = %s, expected nil", err)
 	}
 }
 
@@ -338,6 +647,19 @@ func TestStart(t *testing.T) {
 	if req.State != proto.STATE_RUNNING {
 		t.Errorf("request state = %d, expected %d", req.State, proto.STATE_RUNNING)
 	}
+
+	// The first fencing token sent to the JR is persisted, so job logs from
+	// the JR aren't fenced and resuming the request issues the next token
+	var token uint64
+	if err := dbc.QueryRow("SELECT fence_token FROM requests WHERE request_id = ?", reqId).Scan(&token); err != nil {
+		t.Fatal(err)
+	}
+	if token != request.FIRST_FENCE_TOKEN {
+		t.Errorf("fence_token = %d, expected %d", token, request.FIRST_FENCE_TOKEN)
+	}
+	if err := m.CheckFence(reqId, recvdJc.FenceToken); err != nil {
+		t.Errorf("CheckFence returned error %v, expected nil", err)
+	}
 }
 
 func TestStopNotRunning(t *testing.T) {
@@ -353,7 +675,7 @@ func TestStopNotRunning(t *testing.T) {
 		DefaultJRURL:    "http://defaulturl:1111",
 	}
 	m := request.NewManager(cfg)
-	err := m.Stop(reqId)
+	err := m.Stop(reqId, 0)
 	if err != nil {
 		switch v := err.(type) {
 		case serr.ErrInvalidState:
@@ -374,7 +696,7 @@ func TestStopComplete(t *testing.T) {
 	// be hit.
 	var recvdId string
 	mockJRc := &mock.JRClient{
-		StopRequestFunc: func(baseURL string, reqId string) error {
+		StopRequestFunc: func(baseURL string, reqId string, timeout time.Duration) error {
 			recvdId = reqId
 			return nil
 		},
@@ -389,7 +711,7 @@ func TestStopComplete(t *testing.T) {
 		DefaultJRURL:    "http://defaulturl:1111",
 	}
 	m := request.NewManager(cfg)
-	err := m.Stop(reqId)
+	err := m.Stop(reqId, 0)
 	if err != nil {
 		t.Errorf("error = %s, expected nil", err)
 	}
@@ -408,7 +730,7 @@ func TestStop(t *testing.T) {
 	var recvdId string
 	var recvdHost string
 	mockJRc := &mock.JRClient{
-		StopRequestFunc: func(baseURL string, reqId string) error {
+		StopRequestFunc: func(baseURL string, reqId string, timeout time.Duration) error {
 			recvdId = reqId
 			recvdHost = baseURL
 			return nil
@@ -424,7 +746,7 @@ func TestStop(t *testing.T) {
 		DefaultJRURL:    "http://defaulturl:1111",
 	}
 	m := request.NewManager(cfg)
-	err := m.Stop(reqId)
+	err := m.Stop(reqId, 0)
 	if err != nil {
 		t.Errorf("error = %s, expected nil", err)
 	}
@@ -462,6 +784,128 @@ func TestFinishNotRunning(t *testing.T) {
 	}
 }
 
+func TestFinishNotFinalState(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+
+	reqId := "454ae2f98a05cv16sdwt" // request is running
+	params := proto.FinishRequest{
+		State: proto.STATE_PENDING,
+	}
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+	err := m.Finish(reqId, params)
+	if _, ok := err.(serr.ErrInvalidTransition); !ok {
+		t.Errorf("error = %v, expected serr.ErrInvalidTransition", err)
+	}
+
+	req, err := m.Get(reqId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != proto.STATE_RUNNING {
+		t.Errorf("request state = %s, expected RUNNING", proto.StateName[req.State])
+	}
+}
+
+func TestFinishFenced(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+
+	reqId := "454ae2f98a05cv16sdwt" // request is running on http://jr:0000
+	params := proto.FinishRequest{
+		State:        proto.STATE_COMPLETE,
+		FinishedAt:   time.Now().UTC(),
+		JobRunnerURL: "http://lost-jr:0000",
+	}
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+	err := m.Finish(reqId, params)
+	if _, ok := err.(serr.ErrFenced); !ok {
+		t.Errorf("error = %v, expected serr.ErrFenced", err)
+	}
+
+	req, err := m.Get(reqId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != proto.STATE_RUNNING {
+		t.Errorf("request state = %s, expected RUNNING", proto.StateName[req.State])
+	}
+
+	// The JR running the request can finish it
+	params.JobRunnerURL = "http://jr:0000/"
+	if err := m.Finish(reqId, params); err != nil {
+		t.Errorf("error = %s, expected nil", err)
+	}
+}
+
+func TestCheckFence(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+
+	reqId := "454ae2f98a05cv16sdwt" // request is running
+	if _, err := dbc.Exec("UPDATE requests SET fence_token = 3 WHERE request_id = ?", reqId); err != nil {
+		t.Fatal(err)
+	}
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+
+	// Token zero (chain sent before fencing tokens) and the latest token are
+	// not fenced, but older tokens are
+	for _, token := range []uint64{0, 3, 4} {
+		if err := m.CheckFence(reqId, token); err != nil {
+			t.Errorf("token %d: error = %s, expected nil", token, err)
+		}
+	}
+	err := m.CheckFence(reqId, 2)
+	if _, ok := err.(serr.ErrFenced); !ok {
+		t.Errorf("token 2: error = %v, expected serr.ErrFenced", err)
+	}
+
+	// Finish is fenced, too
+	params := proto.FinishRequest{
+		State:      proto.STATE_COMPLETE,
+		FinishedAt: time.Now().UTC(),
+		FenceToken: 2,
+	}
+	err = m.Finish(reqId, params)
+	if _, ok := err.(serr.ErrFenced); !ok {
+		t.Errorf("Finish error = %v, expected serr.ErrFenced", err)
+	}
+	req, err := m.Get(reqId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != proto.STATE_RUNNING {
+		t.Errorf("request state = %s, expected RUNNING", proto.StateName[req.State])
+	}
+
+	// Latest token finishes the request
+	params.FenceToken = 3
+	if err := m.Finish(reqId, params); err != nil {
+		t.Errorf("Finish error = %s, expected nil", err)
+	}
+}
+
 func TestFinish(t *testing.T) {
 	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
 	defer teardownManager(t, dbName)
@@ -540,6 +984,169 @@ func TestFailNotPending(t *testing.T) {
 	}
 }
 
+func TestFinishAutoRetry(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-auto-retry.sql")
+	defer teardownManager(t, dbName)
+
+	started := make(chan string, 1)
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		Sequences: map[string]*spec.Sequence{
+			"three-nodes": &spec.Sequence{
+				Name:    "three-nodes",
+				Request: true,
+				AutoRetry: &spec.AutoRetry{
+					Max:    1,
+					Errors: []string{"infra"},
+				},
+			},
+		},
+		DBConnector: dbc,
+		JRClient: &mock.JRClient{
+			NewJobChainFunc: func(baseURL string, jc proto.JobChain) (*url.URL, error) {
+				started <- jc.RequestId
+				url, _ := url.Parse("http://fake_host:1111/api/v1/job-chains/1")
+				return url, nil
+			},
+		},
+		ShutdownChan: shutdownChan,
+		DefaultJRURL: "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+
+	// Only failed job has transient error category "infra", so the request is
+	// auto-retried: a new request is created and started after Finish returns
+	reqId := "b9uvdi8tk9kahl8ppvbg"
+	params := proto.FinishRequest{
+		State:        proto.STATE_FAIL,
+		FinishedJobs: 1,
+		FinishedAt:   time.Now(),
+	}
+	if err := m.Finish(reqId, params); err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	var startedReqId string
+	select {
+	case startedReqId = <-started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timeout waiting for auto-retry request to start")
+	}
+	if startedReqId == reqId {
+		t.Fatalf("started request %s, expected new request", startedReqId)
+	}
+	// Start sends the job chain to the JR before it sets the state to RUNNING
+	var retryReq proto.Request
+	for i := 0; i < 50; i++ {
+		var err error
+		retryReq, err = m.Get(startedReqId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if retryReq.State != proto.STATE_PENDING {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if retryReq.RetryOf != reqId {
+		t.Errorf("RetryOf = %s, expected %s", retryReq.RetryOf, reqId)
+	}
+	if retryReq.RetryCount != 1 {
+		t.Errorf("RetryCount = %d, expected 1", retryReq.RetryCount)
+	}
+	if retryReq.State != proto.STATE_RUNNING {
+		t.Errorf("state = %s, expected RUNNING", proto.StateName[retryReq.State])
+	}
+	if retryReq.User != "john" {
+		t.Errorf("user = %s, expected john", retryReq.User)
+	}
+
+	// Failed job has no error category, so the request is not auto-retried
+	if err := m.Finish("c9uvdi8tk9kahl8ppvbg", params); err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	select {
+	case startedReqId = <-started:
+		t.Errorf("started request %s, expected no auto-retry", startedReqId)
+	case <-time.After(500 * time.Millisecond):
+	}
+}
+
+func TestRetry(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-auto-retry.sql")
+	defer teardownManager(t, dbName)
+
+	specs, result := spec.ParseSpec(rmtest.SpecPath + "/a-b-c.yaml")
+	if len(result.Errors) != 0 {
+		t.Fatal(result.Errors)
+	}
+	spec.ProcessSpecs(&specs)
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		Sequences:       specs.Sequences,
+		DBConnector:     dbc,
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+
+	// Request is running, so it cannot be retried
+	_, err := m.Retry("b9uvdi8tk9kahl8ppvbg", proto.RetryRequest{User: "finch"})
+	switch err.(type) {
+	case serr.ErrInvalidState:
+	default:
+		t.Errorf("error = %v, expected serr.ErrInvalidState", err)
+	}
+
+	// Args not in the spec cannot be overridden, and overrides must have a value
+	reqId := "d9uvdi8tk9kahl8ppvbg"
+	for _, args := range []map[string]interface{}{
+		{"baz": "x"},
+		{"foo": nil},
+	} {
+		_, err := m.Retry(reqId, proto.RetryRequest{Args: args, User: "finch"})
+		switch err.(type) {
+		case serr.ErrInvalidCreateRequest:
+		default:
+			t.Errorf("args %v: error = %v, expected serr.ErrInvalidCreateRequest", args, err)
+		}
+	}
+
+	// Retry with a new value for required arg foo. The new request is created
+	// but not started, linked to the failed request, and records the override.
+	retryReq, err := m.Retry(reqId, proto.RetryRequest{
+		Args: map[string]interface{}{"foo": "new-value"},
+		User: "finch",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	gotReq, err := m.Get(retryReq.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if gotReq.State != proto.STATE_PENDING {
+		t.Errorf("state = %s, expected PENDING", proto.StateName[gotReq.State])
+	}
+	if gotReq.RetryOf != reqId {
+		t.Errorf("RetryOf = %s, expected %s", gotReq.RetryOf, reqId)
+	}
+	if gotReq.RetryCount != 0 {
+		t.Errorf("RetryCount = %d, expected 0 (manual retry is not an auto-retry)", gotReq.RetryCount)
+	}
+	if gotReq.User != "finch" {
+		t.Errorf("user = %s, expected finch", gotReq.User)
+	}
+	expectOverrides := []proto.ArgOverride{{Name: "foo", Old: "foo-value", Value: "new-value"}}
+	if diff := deep.Equal(gotReq.ArgOverrides, expectOverrides); diff != nil {
+		t.Error(diff)
+	}
+	for _, arg := range gotReq.Args {
+		if arg.Name == "foo" && arg.Value != "new-value" {
+			t.Errorf("arg foo = %v, expected new-value", arg.Value)
+		}
+	}
+}
+
 func TestFailPending(t *testing.T) {
 	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
 	defer teardownManager(t, dbName)
@@ -871,4 +1478,235 @@ func TestFind(t *testing.T) {
 	if diff := deep.Equal(actual, expected); diff != nil {
 		t.Error(diff)
 	}
+
+	// 7. Filter request args: all args must match
+	filter = proto.RequestFilter{
+		Args: map[string]string{
+			"host": "db1",
+			"port": "3306",
+		},
+	}
+	m = request.NewManager(cfg)
+	actual, err = m.Find(filter)
+	if err != nil {
+		t.Errorf("error = %s, expected nil", err)
+	}
+
+	expected = []proto.Request{
+		testdb.SavedRequests["0874a524aa1edn3ysp00"],
+	}
+	for i, _ := range expected {
+		expected[i].JobChain = nil
+		expected[i].Args = nil
+	}
+
+	if diff := deep.Equal(actual, expected); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	// Specs don't use the db
+	jobCat, seqCat, condCat := "job", "sequence", "conditional"
+	stopType, checkType := "stop-mysql", "check"
+	sequences := map[string]*spec.Sequence{
+		"restart-db": &spec.Sequence{
+			Name:        "restart-db",
+			Request:     true,
+			Description: "Restart MySQL",
+			DocsURL:     "https://wiki.local/restart-db",
+			Nodes: map[string]*spec.Node{
+				"stop":  &spec.Node{Name: "stop", Category: &jobCat, NodeType: &stopType, Description: "Stop mysqld"},
+				"check": &spec.Node{Name: "check", Category: &seqCat, NodeType: &checkType},
+				"maybe": &spec.Node{Name: "maybe", Category: &condCat, Eq: map[string]string{"a": "check", "b": "other"}},
+			},
+		},
+		"check": &spec.Sequence{
+			Name:        "check",
+			Description: "Check replication",
+			Nodes:       map[string]*spec.Node{},
+		},
+		"other": &spec.Sequence{
+			Name:  "other",
+			Nodes: map[string]*spec.Node{},
+		},
+		"unused": &spec.Sequence{
+			Name:  "unused",
+			Nodes: map[string]*spec.Node{},
+		},
+	}
+	m := request.NewManager(request.ManagerConfig{Sequences: sequences})
+
+	got, err := m.Metadata("restart-db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := proto.RequestTypeMetadata{
+		Request: proto.RequestSpec{
+			Name:        "restart-db",
+			Args:        []proto.RequestArg{},
+			Description: "Restart MySQL",
+			DocsURL:     "https://wiki.local/restart-db",
+		},
+		Sequences: []proto.SequenceMetadata{
+			{
+				Name:        "restart-db",
+				Description: "Restart MySQL",
+				DocsURL:     "https://wiki.local/restart-db",
+				Nodes: []proto.NodeMetadata{
+					{Name: "check", Category: "sequence", Type: "check"},
+					{Name: "maybe", Category: "conditional"},
+					{Name: "stop", Category: "job", Type: "stop-mysql", Description: "Stop mysqld"},
+				},
+			},
+			{Name: "check", Description: "Check replication", Nodes: []proto.NodeMetadata{}},
+			{Name: "other", Nodes: []proto.NodeMetadata{}},
+		},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Only request sequences are request types
+	_, err = m.Metadata("check")
+	if _, ok := err.(serr.RequestTypeNotFound); !ok {
+		t.Errorf("got error %v, expected serr.RequestTypeNotFound", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+
+	// 6 do-another-thing requests: 4 suspended and 2 running. Only 2 are
+	// returned, but the summary is of all of them.
+	h, err := m.History("do-another-thing", time.Time{}, 2)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if len(h.Requests) != 2 {
+		t.Errorf("got %d requests, expected 2", len(h.Requests))
+	}
+	if h.Total != 6 {
+		t.Errorf("total = %d, expected 6", h.Total)
+	}
+	expectStates := map[string]uint{"SUSPENDED": 4, "RUNNING": 2}
+	if diff := deep.Equal(h.States, expectStates); diff != nil {
+		t.Error(diff)
+	}
+	if h.Finished != 0 || h.SuccessRate != 0 || h.MedianDuration != 0 {
+		t.Errorf("finished = %d, success rate = %f, median duration = %f, expected zero values", h.Finished, h.SuccessRate, h.MedianDuration)
+	}
+
+	// 1 something-else request: complete, but never started, so no duration
+	h, err = m.History("something-else", time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if h.Total != 1 || h.Finished != 1 || h.SuccessRate != 1 || h.MedianDuration != 0 {
+		t.Errorf("got %+v, expected 1 finished request with 100%% success and no duration", h)
+	}
+}
+
+func TestExportImport(t *testing.T) {
+	dbName := setupManager(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownManager(t, dbName)
+
+	cfg := request.ManagerConfig{
+		ResolverFactory: ref,
+		DBConnector:     dbc,
+		JRClient:        &mock.JRClient{},
+		ShutdownChan:    shutdownChan,
+		DefaultJRURL:    "http://defaulturl:1111",
+	}
+	m := request.NewManager(cfg)
+
+	// Suspended request is exported with its SJC
+	b, err := m.Export("suspended___________")
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if b.Request.State != proto.STATE_SUSPENDED || b.Request.JobChain == nil {
+		t.Errorf("got request %+v, expected suspended request with job chain", b.Request)
+	}
+	if b.SuspendedJobChain == nil || b.SuspendedJobChain.TotalJobTries["hw48"] != 5 {
+		t.Errorf("got SJC %+v, expected SJC with 5 total tries for hw48", b.SuspendedJobChain)
+	}
+
+	// Importing the same request fails because it already exists
+	_, err = m.Import(b)
+	if _, ok := err.(serr.ValidationError); !ok {
+		t.Errorf("error = %v, expected serr.ValidationError", err)
+	}
+
+	// Import it as a new request with a job log, then export it again
+	newId := "imported_suspended__"
+	b.Request.Id = newId
+	b.Request.JobChain.RequestId = newId
+	b.SuspendedJobChain.RequestId = newId
+	b.JobLogs = []proto.JobLog{
+		{RequestId: newId, JobId: "hw48", Try: 1, Type: "test", State: proto.STATE_STOPPED, Stdout: "out"},
+	}
+	req, err := m.Import(b)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if req.State != proto.STATE_SUSPENDED {
+		t.Errorf("imported state = %s, expected SUSPENDED", proto.StateName[req.State])
+	}
+	b2, err := m.Export(newId)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if diff := deep.Equal(b2.Request, b.Request); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(b2.SuspendedJobChain, b.SuspendedJobChain); diff != nil {
+		t.Error(diff)
+	}
+	var n int
+	if err := dbc.QueryRow("SELECT COUNT(*) FROM job_log WHERE request_id = ?", newId).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("got %d job logs, expected 1", n)
+	}
+
+	// Running request is imported as stopped without a JR
+	b, err = m.Export("454ae2f98a05cv16sdwt")
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	newId = "imported_running____"
+	b.Request.Id = newId
+	b.Request.JobChain.RequestId = newId
+	req, err = m.Import(b)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	actual, err := m.Get(newId)
+	if err != nil {
+		t.Fatalf("error = %s, expected nil", err)
+	}
+	if actual.State != proto.STATE_STOPPED || actual.JobRunnerURL != "" {
+		t.Errorf("got state %s, JR URL %q; expected STOPPED and no JR URL", proto.StateName[actual.State], actual.JobRunnerURL)
+	}
+
+	// Job logs must be for the request
+	b.Request.Id = "imported_bad_jl_____"
+	b.Request.JobChain.RequestId = b.Request.Id
+	b.JobLogs = []proto.JobLog{{RequestId: "454ae2f98a05cv16sdwt", JobId: "di12"}}
+	_, err = m.Import(b)
+	if _, ok := err.(serr.ValidationError); !ok {
+		t.Errorf("error = %v, expected serr.ValidationError", err)
+	}
 }
@@ -0,0 +1,462 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/retry"
+)
+
+// A request type with a partitions spec (spec.Sequence.Partitions) is split into
+// partition requests when it's started, so a very wide job chain, like an each:
+// over thousands of hosts, is run by several Job Runners instead of one. Each
+// partition request is a normal request with its own job chain, Job Runner, job
+// log, and state, linked to the original request by proto.Request.PartitionOf.
+// The original request has no Job Runner; it's running until all its partition
+// requests are finished, then its state is aggregated from theirs (see
+// AggregatePartitions).
+
+// PartitionJobChain splits the job chain into at most max partitions that can run
+// independently, or returns nil if it cannot be split into at least two. A job
+// chain can be split if it begins and ends with noop jobs (the request sequence
+// source and sink) and the jobs between them form two or more independent sub-graphs,
+// like the elements of an each:. The noop jobs that lead to or from the sub-graphs
+// are shared: every partition has a copy. Sub-graphs are assigned to partitions
+// largest first, each to the partition with the fewest jobs. Partitions have the
+// request ID of the job chain; the caller sets the partition request ID.
+func PartitionJobChain(jc proto.JobChain, max uint) []proto.JobChain {
+	if max < 2 || len(jc.Jobs) < 4 {
+		return nil
+	}
+
+	prev := map[string][]string{}
+	for id, next := range jc.AdjacencyList {
+		for _, n := range next {
+			prev[n] = append(prev[n], id)
+		}
+	}
+	var roots, leaves []string
+	for id := range jc.Jobs {
+		if len(prev[id]) == 0 {
+			roots = append(roots, id)
+		}
+		if len(jc.AdjacencyList[id]) == 0 {
+			leaves = append(leaves, id)
+		}
+	}
+	if len(roots) != 1 || len(leaves) != 1 {
+		return nil
+	}
+
+	// Shared jobs: the noop jobs from the root to the first job with many next
+	// jobs, and from the leaf back to the first job with many previous jobs. A job
+	// that starts a sequence retry isn't shared because the sequence would be
+	// retried in every partition.
+	shared := map[string]bool{}
+	for _, walk := range []struct {
+		start string
+		edges map[string][]string
+	}{
+		{roots[0], jc.AdjacencyList},
+		{leaves[0], prev},
+	} {
+		id := walk.start
+		for {
+			if shared[id] {
+				return nil // only a sequence of jobs, nothing to split
+			}
+			job := jc.Jobs[id]
+			if job.Type != "noop" || job.SequenceRetry > 0 {
+				return nil
+			}
+			shared[id] = true
+			if len(walk.edges[id]) != 1 {
+				break
+			}
+			id = walk.edges[id][0]
+		}
+	}
+
+	// Independent sub-graphs are the connected components of the other jobs
+	component := map[string]string{} // job ID -> ID of first job found in its component
+	var components [][]string
+	ids := make([]string, 0, len(jc.Jobs))
+	for id := range jc.Jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids) // deterministic partitions
+	for _, id := range ids {
+		if shared[id] || component[id] != "" {
+			continue
+		}
+		jobs := []string{}
+		todo := []string{id}
+		component[id] = id
+		for len(todo) > 0 {
+			cur := todo[0]
+			todo = todo[1:]
+			jobs = append(jobs, cur)
+			for _, n := range append(append([]string{}, jc.AdjacencyList[cur]...), prev[cur]...) {
+				if shared[n] || component[n] != "" {
+					continue
+				}
+				component[n] = id
+				todo = append(todo, n)
+			}
+		}
+		components = append(components, jobs)
+	}
+	if len(components) < 2 {
+		return nil
+	}
+
+	n := int(max)
+	if len(components) < n {
+		n = len(components)
+	}
+	sort.SliceStable(components, func(i, j int) bool { return len(components[i]) > len(components[j]) })
+	partJobs := make([][]string, n)
+	for _, jobs := range components {
+		min := 0
+		for i := range partJobs {
+			if len(partJobs[i]) < len(partJobs[min]) {
+				min = i
+			}
+		}
+		partJobs[min] = append(partJobs[min], jobs...)
+	}
+
+	parts := make([]proto.JobChain, n)
+	for i := range partJobs {
+		in := map[string]bool{}
+		for id := range shared {
+			in[id] = true
+		}
+		for _, id := range partJobs[i] {
+			in[id] = true
+		}
+		part := proto.JobChain{
+			RequestId:     jc.RequestId,
+			RequestType:   jc.RequestType,
+			Jobs:          map[string]proto.Job{},
+			AdjacencyList: map[string][]string{},
+			State:         jc.State,
+			Annotations:   jc.Annotations,
+			Deadline:      jc.Deadline,
+			CorrelationId: jc.CorrelationId,
+			StopTimeout:   jc.StopTimeout,
+			RetryBudget:   jc.RetryBudget,
+		}
+		for id := range in {
+			part.Jobs[id] = jc.Jobs[id]
+			var next []string
+			for _, n := range jc.AdjacencyList[id] {
+				if in[n] {
+					next = append(next, n)
+				}
+			}
+			if len(next) > 0 {
+				part.AdjacencyList[id] = next
+			}
+		}
+		parts[i] = part
+	}
+	return parts
+}
+
+// AggregatePartitions returns the request with its final state, finish time, and
+// finished jobs aggregated from its partition requests, and true, or false if any
+// partition request is not finished. The request is complete if all partitions
+// completed, stopped if all completed or stopped, deadline exceeded if all completed,
+// stopped, or exceeded the deadline, else failed. Jobs shared by all partitions
+// are counted once in finished jobs.
+func AggregatePartitions(req proto.Request, parts []proto.Request) (proto.Request, bool) {
+	if len(parts) == 0 {
+		return req, false
+	}
+	complete, stopped, deadline := 0, 0, 0
+	var finishedAt time.Time
+	var totalJobs, finishedJobs uint
+	for _, p := range parts {
+		if !FinalState(p.State) {
+			return req, false
+		}
+		switch p.State {
+		case proto.STATE_COMPLETE:
+			complete++
+		case proto.STATE_STOPPED:
+			stopped++
+		case proto.STATE_DEADLINE_EXCEEDED:
+			deadline++
+		}
+		if p.FinishedAt != nil && p.FinishedAt.After(finishedAt) {
+			finishedAt = *p.FinishedAt
+		}
+		totalJobs += p.TotalJobs
+		finishedJobs += p.FinishedJobs
+	}
+
+	switch {
+	case complete == len(parts):
+		req.State = proto.STATE_COMPLETE
+	case complete+stopped == len(parts):
+		req.State = proto.STATE_STOPPED
+	case complete+stopped+deadline == len(parts):
+		req.State = proto.STATE_DEADLINE_EXCEEDED
+	default:
+		req.State = proto.STATE_FAIL
+	}
+	if finishedAt.IsZero() {
+		finishedAt = time.Now().UTC()
+	}
+	req.FinishedAt = &finishedAt
+
+	// Every partition has a copy of the shared jobs, so the partitions have
+	// (partitions - 1) * shared jobs more than the request
+	if totalJobs > req.TotalJobs {
+		dupe := totalJobs - req.TotalJobs
+		if finishedJobs > dupe {
+			finishedJobs -= dupe
+		} else {
+			finishedJobs = 0
+		}
+	}
+	if finishedJobs > req.TotalJobs {
+		finishedJobs = req.TotalJobs
+	}
+	req.FinishedJobs = finishedJobs
+	return req, true
+}
+
+// partitions returns the job chain partitions of the pending request, or nil if
+// it's not partitioned: its spec doesn't set partitions, it's a partition request,
+// or its job chain cannot be split.
+func (m *manager) partitions(req proto.Request) []proto.JobChain {
+	if req.PartitionOf != "" || req.JobChain == nil {
+		return nil
+	}
+	seq, ok := m.sequences[req.Type]
+	if !ok || seq.Partitions < 2 {
+		return nil
+	}
+	return PartitionJobChain(*req.JobChain, seq.Partitions)
+}
+
+// startPartitions starts the pending request by creating and starting one
+// partition request per job chain partition. The request is running once its
+// partition requests are created. Partition requests that fail to start are
+// failed, which is reflected in the request state when all partitions finish.
+func (m *manager) startPartitions(req proto.Request, parts []proto.JobChain) error {
+	if err := m.sm.Check(req.Id, proto.STATE_PENDING, proto.STATE_RUNNING); err != nil {
+		return err
+	}
+	newReq, err := m.createRequest(req.Id)
+	if err != nil {
+		return err
+	}
+	newReqBytes, err := json.Marshal(newReq)
+	if err != nil {
+		return fmt.Errorf("cannot marshal create request: %s", err)
+	}
+	reqArgsBytes, err := json.Marshal(req.Args)
+	if err != nil {
+		return fmt.Errorf("cannot marshal request args: %s", err)
+	}
+
+	now := time.Now().UTC()
+	children := make([]proto.Request, len(parts))
+	chains := make([][]byte, len(parts))
+	for i := range parts {
+		id := xid.New().String()
+		parts[i].RequestId = id
+		chains[i], err = proto.EncodeJobChain(parts[i], proto.ChainFormat())
+		if err != nil {
+			return fmt.Errorf("cannot marshal job chain: %s", err)
+		}
+		children[i] = proto.Request{
+			Id:            id,
+			Type:          req.Type,
+			State:         proto.STATE_PENDING,
+			User:          req.User,
+			Team:          req.Team,
+			Namespace:     req.Namespace,
+			CreatedAt:     now,
+			TotalJobs:     uint(len(parts[i].Jobs)),
+			SpecVersion:   req.SpecVersion,
+			Deadline:      req.Deadline,
+			CorrelationId: req.CorrelationId,
+			PartitionOf:   req.Id,
+		}
+		for _, job := range parts[i].Jobs {
+			children[i].Cost += job.Cost
+		}
+	}
+
+	// Create the partition requests and set the request running in one transaction,
+	// so a concurrent Start creates them only once
+	ctx := context.TODO()
+	startedElsewhere := false
+	err = retry.Do(DB_TRIES, DB_RETRY_WAIT, func() error {
+		txn, err := m.dbConnector.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback()
+
+		q := "UPDATE requests SET state = ?, started_at = ?, partitions = ? WHERE request_id = ? AND state = ?"
+		res, err := txn.ExecContext(ctx, q, proto.STATE_RUNNING, now, len(parts), req.Id, proto.STATE_PENDING)
+		if err != nil {
+			return serr.NewDbError(err, "UPDATE requests")
+		}
+		cnt, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if cnt == 0 {
+			startedElsewhere = true
+			return nil
+		}
+
+		for i, child := range children {
+			q = "INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES (?, ?, ?, ?)"
+			_, err = txn.ExecContext(ctx, q, child.Id, string(newReqBytes), string(reqArgsBytes), chains[i])
+			if err != nil {
+				return serr.NewDbError(err, "INSERT request_archives")
+			}
+
+			var specVersion, team, namespace, deadline, correlationId interface{} // NULL if not set
+			if child.SpecVersion != "" {
+				specVersion = child.SpecVersion
+			}
+			if child.Team != "" {
+				team = child.Team
+			}
+			if child.Namespace != "" {
+				namespace = child.Namespace
+			}
+			if child.Deadline != nil {
+				deadline = *child.Deadline
+			}
+			if child.CorrelationId != "" {
+				correlationId = child.CorrelationId
+			}
+			q = "INSERT INTO requests (request_id, type, state, user, team, namespace, created_at, total_jobs, spec_version, cost, deadline, correlation_id, partition_of) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)"
+			_, err = txn.ExecContext(ctx, q,
+				child.Id,
+				child.Type,
+				child.State,
+				child.User,
+				team,
+				namespace,
+				child.CreatedAt,
+				child.TotalJobs,
+				specVersion,
+				child.Cost,
+				deadline,
+				correlationId,
+				child.PartitionOf,
+			)
+			if err != nil {
+				return serr.NewDbError(err, "INSERT requests")
+			}
+		}
+
+		return txn.Commit()
+	}, nil)
+	if err != nil {
+		return err
+	}
+	if startedElsewhere {
+		if started, _ := m.startedElsewhere(req.Id); started {
+			return nil
+		}
+		return ErrNotUpdated
+	}
+	req.State = proto.STATE_RUNNING
+	req.StartedAt = &now
+	req.Partitions = uint(len(parts))
+	m.sm.Changed(req, proto.STATE_PENDING, req.State)
+	requestLogger(req).Infof("request %s split into %d partition requests", req.Id, len(parts))
+
+	for _, child := range children {
+		if err := m.Start(child.Id); err != nil {
+			requestLogger(child).Errorf("error starting partition request %s of request %s: %s", child.Id, req.Id, err)
+			if err := m.FailPending(child.Id); err != nil {
+				requestLogger(child).Errorf("error failing partition request %s: %s", child.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// stopPartitions stops the running partition requests of the request.
+func (m *manager) stopPartitions(req proto.Request, timeout time.Duration) error {
+	parts, err := m.Find(proto.RequestFilter{PartitionOf: req.Id, States: []byte{proto.STATE_RUNNING}})
+	if err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if err := m.Stop(p.Id, timeout); err != nil {
+			return fmt.Errorf("error stopping partition request %s: %s", p.Id, err)
+		}
+	}
+	return nil
+}
+
+func (m *manager) FinishPartitions(requestId string) error {
+	req, err := m.Get(requestId)
+	if err != nil {
+		return err
+	}
+	if req.Partitions == 0 || req.State != proto.STATE_RUNNING {
+		return nil
+	}
+	parts, err := m.Find(proto.RequestFilter{PartitionOf: req.Id})
+	if err != nil {
+		return err
+	}
+	if uint(len(parts)) != req.Partitions {
+		return fmt.Errorf("request %s has %d partition requests, expected %d", req.Id, len(parts), req.Partitions)
+	}
+	req, done := AggregatePartitions(req, parts)
+	if !done {
+		return nil
+	}
+
+	// This will only update the request if the current state is RUNNING. If not,
+	// another partition request finished it concurrently.
+	if err := m.updateRequest(req, proto.STATE_RUNNING); err != nil {
+		if err == ErrNotUpdated {
+			return nil
+		}
+		return err
+	}
+	m.sm.Changed(req, proto.STATE_RUNNING, req.State)
+
+	if req.State == proto.STATE_FAIL {
+		m.goAutoRetry(req)
+	}
+	return nil
+}
+
+// finishPartition finishes the request of the finished partition request if all
+// its partition requests are finished. Errors are only logged because the partition
+// request is finished either way; the reconciler finishes the request later.
+func (m *manager) finishPartition(part proto.Request) {
+	if part.PartitionOf == "" {
+		return
+	}
+	if err := m.FinishPartitions(part.PartitionOf); err != nil {
+		log.Errorf("error finishing request %s of partition request %s: %s", part.PartitionOf, part.Id, err)
+	}
+}
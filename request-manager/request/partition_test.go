@@ -0,0 +1,179 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+func wideJobChain() proto.JobChain {
+	// begin -> seq_begin -> a1 -> a2 -> seq_end -> end
+	//                    -> b1 ------->
+	//                    -> c1 ------->
+	return proto.JobChain{
+		RequestId:   "req1",
+		RequestType: "wide",
+		State:       proto.STATE_PENDING,
+		StopTimeout: "1m",
+		Jobs: map[string]proto.Job{
+			"begin":     {Id: "begin", Type: "noop"},
+			"seq_begin": {Id: "seq_begin", Type: "noop"},
+			"a1":        {Id: "a1", Type: "t", SequenceId: "seq_begin"},
+			"a2":        {Id: "a2", Type: "t", SequenceId: "seq_begin"},
+			"b1":        {Id: "b1", Type: "t", SequenceId: "seq_begin"},
+			"c1":        {Id: "c1", Type: "t", SequenceId: "seq_begin"},
+			"seq_end":   {Id: "seq_end", Type: "noop"},
+			"end":       {Id: "end", Type: "noop"},
+		},
+		AdjacencyList: map[string][]string{
+			"begin":     {"seq_begin"},
+			"seq_begin": {"a1", "b1", "c1"},
+			"a1":        {"a2"},
+			"a2":        {"seq_end"},
+			"b1":        {"seq_end"},
+			"c1":        {"seq_end"},
+			"seq_end":   {"end"},
+		},
+	}
+}
+
+func jobIds(jc proto.JobChain) []string {
+	ids := []string{}
+	for id := range jc.Jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestPartitionJobChain(t *testing.T) {
+	parts := request.PartitionJobChain(wideJobChain(), 2)
+	if len(parts) != 2 {
+		t.Fatalf("got %d partitions, expected 2", len(parts))
+	}
+
+	// Largest sub-graph (a) first, then b and c to balance
+	expectIds := [][]string{
+		{"a1", "a2", "begin", "end", "seq_begin", "seq_end"},
+		{"b1", "begin", "c1", "end", "seq_begin", "seq_end"},
+	}
+	for i := range parts {
+		if diff := deep.Equal(jobIds(parts[i]), expectIds[i]); diff != nil {
+			t.Errorf("partition %d: %v", i, diff)
+		}
+		if parts[i].RequestId != "req1" || parts[i].StopTimeout != "1m" {
+			t.Errorf("partition %d: request id %s, stop timeout %s; expected req1, 1m", i, parts[i].RequestId, parts[i].StopTimeout)
+		}
+	}
+
+	expectAdj := map[string][]string{
+		"begin":     {"seq_begin"},
+		"seq_begin": {"b1", "c1"},
+		"b1":        {"seq_end"},
+		"c1":        {"seq_end"},
+		"seq_end":   {"end"},
+	}
+	if diff := deep.Equal(parts[1].AdjacencyList, expectAdj); diff != nil {
+		t.Error(diff)
+	}
+
+	// At most one partition per sub-graph
+	if parts := request.PartitionJobChain(wideJobChain(), 10); len(parts) != 3 {
+		t.Errorf("got %d partitions, expected 3 (one per sub-graph)", len(parts))
+	}
+}
+
+func TestPartitionJobChainCannotSplit(t *testing.T) {
+	if parts := request.PartitionJobChain(wideJobChain(), 1); parts != nil {
+		t.Errorf("got %d partitions with max 1, expected nil", len(parts))
+	}
+
+	// Sequence retry would retry the sequence in every partition
+	jc := wideJobChain()
+	job := jc.Jobs["seq_begin"]
+	job.SequenceRetry = 1
+	jc.Jobs["seq_begin"] = job
+	if parts := request.PartitionJobChain(jc, 2); parts != nil {
+		t.Errorf("got %d partitions with sequence retry, expected nil", len(parts))
+	}
+
+	// Not a noop source
+	jc = wideJobChain()
+	job = jc.Jobs["begin"]
+	job.Type = "t"
+	jc.Jobs["begin"] = job
+	if parts := request.PartitionJobChain(jc, 2); parts != nil {
+		t.Errorf("got %d partitions without noop source, expected nil", len(parts))
+	}
+
+	// Sequential jobs only
+	jc = proto.JobChain{
+		RequestId: "req1",
+		Jobs: map[string]proto.Job{
+			"begin": {Id: "begin", Type: "noop"},
+			"a":     {Id: "a", Type: "t"},
+			"b":     {Id: "b", Type: "t"},
+			"end":   {Id: "end", Type: "noop"},
+		},
+		AdjacencyList: map[string][]string{"begin": {"a"}, "a": {"b"}, "b": {"end"}},
+	}
+	if parts := request.PartitionJobChain(jc, 2); parts != nil {
+		t.Errorf("got %d partitions of sequential jobs, expected nil", len(parts))
+	}
+}
+
+func TestAggregatePartitions(t *testing.T) {
+	t1 := time.Date(2020, 1, 1, 0, 0, 1, 0, time.UTC)
+	t2 := time.Date(2020, 1, 1, 0, 0, 2, 0, time.UTC)
+
+	// 8 jobs, 4 shared: partitions have 6 jobs each
+	req := proto.Request{Id: "req1", State: proto.STATE_RUNNING, TotalJobs: 8, Partitions: 2}
+	parts := []proto.Request{
+		{Id: "p1", State: proto.STATE_COMPLETE, TotalJobs: 6, FinishedJobs: 6, FinishedAt: &t2},
+		{Id: "p2", State: proto.STATE_RUNNING, TotalJobs: 6, FinishedJobs: 3},
+	}
+	if _, done := request.AggregatePartitions(req, parts); done {
+		t.Error("done with a running partition request, expected not done")
+	}
+
+	parts[1].State = proto.STATE_COMPLETE
+	parts[1].FinishedJobs = 6
+	parts[1].FinishedAt = &t1
+	got, done := request.AggregatePartitions(req, parts)
+	if !done {
+		t.Fatal("not done, expected done")
+	}
+	if got.State != proto.STATE_COMPLETE || got.FinishedJobs != 8 || !got.FinishedAt.Equal(t2) {
+		t.Errorf("got state %s, %d finished jobs, finished at %v; expected COMPLETE, 8, %v",
+			proto.StateName[got.State], got.FinishedJobs, got.FinishedAt, t2)
+	}
+
+	for _, c := range []struct {
+		states []byte
+		expect byte
+	}{
+		{[]byte{proto.STATE_COMPLETE, proto.STATE_STOPPED}, proto.STATE_STOPPED},
+		{[]byte{proto.STATE_STOPPED, proto.STATE_DEADLINE_EXCEEDED}, proto.STATE_DEADLINE_EXCEEDED},
+		{[]byte{proto.STATE_COMPLETE, proto.STATE_FAIL}, proto.STATE_FAIL},
+		{[]byte{proto.STATE_STOPPED, proto.STATE_FAILED_RESUME}, proto.STATE_FAIL},
+	} {
+		parts[0].State = c.states[0]
+		parts[1].State = c.states[1]
+		got, done := request.AggregatePartitions(req, parts)
+		if !done {
+			t.Errorf("%s, %s: not done, expected done", proto.StateName[c.states[0]], proto.StateName[c.states[1]])
+			continue
+		}
+		if got.State != c.expect {
+			t.Errorf("%s, %s: got state %s, expected %s", proto.StateName[c.states[0]], proto.StateName[c.states[1]],
+				proto.StateName[got.State], proto.StateName[c.expect])
+		}
+	}
+}
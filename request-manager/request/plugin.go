@@ -0,0 +1,45 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"github.com/square/spincycle/v2/proto"
+)
+
+// ResolverPlugin represents the resolver plugin. It allows user-defined code to
+// run before and after a request's job chain is built (resolved from specs),
+// without modifying the resolver. The default ResolverPlugin (NoResolverPlugin)
+// does nothing.
+//
+// To enable a user-defined resolver plugin, set App.Context.Plugins.Resolver.
+type ResolverPlugin interface {
+	// PreResolve is called with the caller's create request before request args
+	// are finalized and the job chain is built. It can modify the create request,
+	// for example to normalize hostnames in request args. The modified create
+	// request is the one saved (request_archives.create_request). If an error
+	// is returned, the request is not created and the error is returned to the
+	// caller (HTTP 400).
+	PreResolve(*proto.CreateRequest) error
+
+	// PostResolve is called with the new request after its job chain is built,
+	// but before the request is saved. Request.Args are the final request args
+	// and Request.JobChain is the complete job chain. It can validate the request,
+	// for example verifying that the caller owns the hosts in the job args, and
+	// annotate the job chain (JobChain.Annotations). If an error is returned,
+	// the request is not created and the error is returned to the caller
+	// (HTTP 400).
+	PostResolve(*proto.Request) error
+}
+
+// NoResolverPlugin is the default ResolverPlugin which does nothing.
+type NoResolverPlugin struct{}
+
+// PreResolve returns nil.
+func (p NoResolverPlugin) PreResolve(*proto.CreateRequest) error {
+	return nil
+}
+
+// PostResolve returns nil.
+func (p NoResolverPlugin) PostResolve(*proto.Request) error {
+	return nil
+}
@@ -0,0 +1,117 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"fmt"
+	"sort"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// ApplyResumePoints changes the jobs of the suspended job chain: jobs maps job IDs
+// to proto.RESUME_* actions. Complete and skipped jobs are set to COMPLETE, and
+// pending jobs to PENDING with no tries in the latest run, so they get all their
+// tries when the chain is resumed. Only skippable jobs (spec node skippable) can
+// be skipped, and the jobs after a skipped job get its skip data (spec sets
+// default) in their job data, unless they already have a value. The resulting
+// job chain must be consistent:
+// every previous job of a complete job must be complete too, else the jobs after
+// it would never run. Jobs that run after a failed previous job (proto.Job.RunAfterFail)
+// are the exception. If the job chain is not consistent or a job or action is
+// invalid, it returns a serr.ValidationError and the job chain is not changed.
+func ApplyResumePoints(sjc *proto.SuspendedJobChain, jobs map[string]string) error {
+	if sjc.JobChain == nil {
+		return fmt.Errorf("suspended job chain of request %s has no job chain", sjc.RequestId)
+	}
+	jc := sjc.JobChain
+
+	// New job states, validated before the job chain is changed
+	states := make(map[string]byte, len(jc.Jobs))
+	for id, job := range jc.Jobs {
+		states[id] = job.State
+	}
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if _, ok := jc.Jobs[id]; !ok {
+			return serr.ValidationError{Message: fmt.Sprintf("job %s is not in the job chain of request %s", id, sjc.RequestId)}
+		}
+		switch jobs[id] {
+		case proto.RESUME_SKIP:
+			if job := jc.Jobs[id]; !job.Skippable {
+				return serr.ValidationError{Message: fmt.Sprintf("job %s (%s) is not skippable; only jobs of skippable nodes (spec skippable: true) can be skipped, "+
+					"set it complete if it was done outside Spin Cycle", job.Id, job.Name)}
+			}
+			states[id] = proto.STATE_COMPLETE
+		case proto.RESUME_COMPLETE:
+			states[id] = proto.STATE_COMPLETE
+		case proto.RESUME_PENDING:
+			states[id] = proto.STATE_PENDING
+		default:
+			return serr.ValidationError{Message: fmt.Sprintf("invalid resume point for job %s: %s (valid: %s, %s, %s)",
+				id, jobs[id], proto.RESUME_COMPLETE, proto.RESUME_SKIP, proto.RESUME_PENDING)}
+		}
+	}
+
+	// Every previous job of a complete job must be complete
+	prevIds := make([]string, 0, len(jc.AdjacencyList))
+	for id := range jc.AdjacencyList {
+		prevIds = append(prevIds, id)
+	}
+	sort.Strings(prevIds)
+	for _, prevId := range prevIds {
+		if states[prevId] == proto.STATE_COMPLETE {
+			continue
+		}
+		for _, nextId := range jc.AdjacencyList[prevId] {
+			if states[nextId] != proto.STATE_COMPLETE || jc.Jobs[nextId].RunAfterFail {
+				continue
+			}
+			prev, next := jc.Jobs[prevId], jc.Jobs[nextId]
+			return serr.ValidationError{Message: fmt.Sprintf("inconsistent resume points: job %s (%s) is complete but previous job %s (%s) is %s; "+
+				"set the previous job complete or skip, or the job pending", next.Id, next.Name, prev.Id, prev.Name, proto.StateName[states[prevId]])}
+		}
+	}
+
+	if sjc.LatestRunJobTries == nil {
+		sjc.LatestRunJobTries = map[string]uint{}
+	}
+	for _, id := range ids {
+		job := jc.Jobs[id]
+		job.State = states[id]
+		jc.Jobs[id] = job
+		if job.State == proto.STATE_PENDING {
+			delete(sjc.LatestRunJobTries, id)
+		}
+	}
+	for _, id := range ids {
+		if jobs[id] != proto.RESUME_SKIP {
+			continue
+		}
+		for k, v := range jc.Jobs[id].SkipData {
+			for _, nextId := range jc.AdjacencyList[id] {
+				next := jc.Jobs[nextId]
+				if _, ok := next.Data[k]; ok {
+					continue
+				}
+				if next.Data == nil {
+					next.Data = map[string]interface{}{}
+				}
+				next.Data[k] = v
+				jc.Jobs[nextId] = next
+			}
+		}
+	}
+	jc.FinishedJobs = 0
+	for _, job := range jc.Jobs {
+		if job.State == proto.STATE_COMPLETE {
+			jc.FinishedJobs++
+		}
+	}
+	return nil
+}
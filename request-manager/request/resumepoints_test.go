@@ -0,0 +1,155 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+// resumePointsSJC returns a suspended job chain a -> b -> c -> d where a is
+// complete, b was stopped, and c and d have not run. All jobs but a are skippable.
+func resumePointsSJC() proto.SuspendedJobChain {
+	return proto.SuspendedJobChain{
+		RequestId: "req1",
+		JobChain: &proto.JobChain{
+			RequestId: "req1",
+			Jobs: map[string]proto.Job{
+				"a": {Id: "a", Name: "job-a", State: proto.STATE_COMPLETE},
+				"b": {Id: "b", Name: "job-b", State: proto.STATE_STOPPED, Skippable: true},
+				"c": {Id: "c", Name: "job-c", State: proto.STATE_PENDING, Skippable: true},
+				"d": {Id: "d", Name: "job-d", State: proto.STATE_PENDING, Skippable: true},
+			},
+			AdjacencyList: map[string][]string{
+				"a": {"b"},
+				"b": {"c"},
+				"c": {"d"},
+			},
+			FinishedJobs: 1,
+		},
+		TotalJobTries:     map[string]uint{"a": 1, "b": 2},
+		LatestRunJobTries: map[string]uint{"a": 1, "b": 2},
+		SequenceTries:     map[string]uint{"a": 1},
+	}
+}
+
+func TestApplyResumePoints(t *testing.T) {
+	// Skip b and mark c complete: d runs when resumed
+	sjc := resumePointsSJC()
+	err := request.ApplyResumePoints(&sjc, map[string]string{
+		"b": proto.RESUME_SKIP,
+		"c": proto.RESUME_COMPLETE,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	states := map[string]byte{}
+	for id, job := range sjc.JobChain.Jobs {
+		states[id] = job.State
+	}
+	expect := map[string]byte{
+		"a": proto.STATE_COMPLETE,
+		"b": proto.STATE_COMPLETE,
+		"c": proto.STATE_COMPLETE,
+		"d": proto.STATE_PENDING,
+	}
+	if diff := deep.Equal(states, expect); diff != nil {
+		t.Error(diff)
+	}
+	if sjc.JobChain.FinishedJobs != 3 {
+		t.Errorf("FinishedJobs = %d, expected 3", sjc.JobChain.FinishedJobs)
+	}
+
+	// Run a and b again: a gets all its tries in the new run, total tries kept
+	sjc = resumePointsSJC()
+	err = request.ApplyResumePoints(&sjc, map[string]string{
+		"a": proto.RESUME_PENDING,
+		"b": proto.RESUME_PENDING,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sjc.JobChain.Jobs["a"].State != proto.STATE_PENDING {
+		t.Errorf("job a state = %s, expected PENDING", proto.StateName[sjc.JobChain.Jobs["a"].State])
+	}
+	if diff := deep.Equal(sjc.LatestRunJobTries, map[string]uint{}); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(sjc.TotalJobTries, map[string]uint{"a": 1, "b": 2}); diff != nil {
+		t.Error(diff)
+	}
+	if sjc.JobChain.FinishedJobs != 0 {
+		t.Errorf("FinishedJobs = %d, expected 0", sjc.JobChain.FinishedJobs)
+	}
+}
+
+func TestApplyResumePointsInvalid(t *testing.T) {
+	for _, jobs := range []map[string]string{
+		{"c": proto.RESUME_COMPLETE}, // previous job b not complete
+		{"x": proto.RESUME_SKIP},     // not in job chain
+		{"b": "run"},                 // invalid action
+		{"b": proto.RESUME_SKIP, "a": proto.RESUME_PENDING},                             // previous job a pending
+		{"d": proto.RESUME_COMPLETE, "c": proto.RESUME_SKIP},                            // previous job b not complete
+		{"b": proto.RESUME_COMPLETE, "c": proto.RESUME_PENDING, "d": proto.RESUME_SKIP}, // previous job c pending
+		{"a": proto.RESUME_SKIP},                                                        // not skippable
+	} {
+		sjc := resumePointsSJC()
+		err := request.ApplyResumePoints(&sjc, jobs)
+		if err == nil {
+			t.Errorf("no error for %v, expected an error", jobs)
+			continue
+		}
+		if _, ok := err.(serr.ValidationError); !ok {
+			t.Errorf("got error %T for %v, expected serr.ValidationError", err, jobs)
+		}
+		// Not changed on error
+		if diff := deep.Equal(sjc, resumePointsSJC()); diff != nil {
+			t.Errorf("job chain changed on error for %v: %v", jobs, diff)
+		}
+	}
+
+	// Run-after-fail jobs can be complete after a job that's not
+	sjc := resumePointsSJC()
+	c := sjc.JobChain.Jobs["c"]
+	c.RunAfterFail = true
+	sjc.JobChain.Jobs["c"] = c
+	if err := request.ApplyResumePoints(&sjc, map[string]string{"c": proto.RESUME_COMPLETE}); err != nil {
+		t.Errorf("got error %s for run-after-fail job, expected nil", err)
+	}
+}
+
+func TestApplyResumePointsSkipData(t *testing.T) {
+	// Job c gets the skip data of b, except the value it already has
+	sjc := resumePointsSJC()
+	b := sjc.JobChain.Jobs["b"]
+	b.SkipData = map[string]interface{}{"host": "localhost", "port": float64(3306)}
+	sjc.JobChain.Jobs["b"] = b
+	c := sjc.JobChain.Jobs["c"]
+	c.Data = map[string]interface{}{"port": float64(3307)}
+	sjc.JobChain.Jobs["c"] = c
+	if err := request.ApplyResumePoints(&sjc, map[string]string{"b": proto.RESUME_SKIP}); err != nil {
+		t.Fatal(err)
+	}
+	expect := map[string]interface{}{"host": "localhost", "port": float64(3307)}
+	if diff := deep.Equal(sjc.JobChain.Jobs["c"].Data, expect); diff != nil {
+		t.Error(diff)
+	}
+	if sjc.JobChain.Jobs["d"].Data != nil {
+		t.Errorf("job d data = %v, expected nil (not after b)", sjc.JobChain.Jobs["d"].Data)
+	}
+
+	// Complete jobs are done, so their skip data is not used
+	sjc = resumePointsSJC()
+	sjc.JobChain.Jobs["b"] = b
+	if err := request.ApplyResumePoints(&sjc, map[string]string{"b": proto.RESUME_COMPLETE}); err != nil {
+		t.Fatal(err)
+	}
+	if sjc.JobChain.Jobs["c"].Data != nil {
+		t.Errorf("job c data = %v, expected nil (b complete, not skipped)", sjc.JobChain.Jobs["c"].Data)
+	}
+}
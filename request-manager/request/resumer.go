@@ -5,10 +5,12 @@ package request
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"errors"
+	"expvar"
 	"fmt"
+	"math"
 	"math/rand"
+	"sort"
 	"strings"
 	"time"
 
@@ -17,6 +19,7 @@ import (
 	serr "github.com/square/spincycle/v2/errors"
 	jr "github.com/square/spincycle/v2/job-runner"
 	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
 )
 
 var (
@@ -24,6 +27,22 @@ var (
 	ErrMultipleUpdated = errors.New("multiple rows updated/deleted, expected single-row update/delete")
 )
 
+// Resume metrics published as expvars (GET /debug/vars on the Request Manager API).
+var (
+	// ResumeAttempts counts SJCs sent to a Job Runner to resume.
+	ResumeAttempts = expvar.NewInt("resume_attempts")
+
+	// ResumeErrors counts failed attempts to resume SJCs.
+	ResumeErrors = expvar.NewInt("resume_errors")
+
+	// ResumeFailed counts requests set to STATE_FAILED_RESUME because their SJC
+	// could not be resumed after the max attempts.
+	ResumeFailed = expvar.NewInt("resume_failed")
+)
+
+// MAX_RESUME_ERROR_LEN is the size of the requests.resume_error column.
+const MAX_RESUME_ERROR_LEN = 2000
+
 type Resumer interface {
 	// Suspend marks a running request as suspended and saves the corresponding
 	// suspended job chain.
@@ -46,6 +65,15 @@ type Resumer interface {
 	// creating the Resumer (rounded to the nearest second). They're deleted and
 	// their requests' states set to FAILED.
 	Cleanup()
+
+	// ResumePoints returns the job chain of a suspended request with the job
+	// states it will be resumed from.
+	ResumePoints(requestId string) (proto.JobChain, error)
+
+	// SetResumePoints changes the jobs of the suspended job chain of a request
+	// (see ApplyResumePoints) and how long to hold it before it's resumed, and
+	// returns the changed job chain. Changing jobs resets the resume attempts.
+	SetResumePoints(requestId string, rp proto.ResumePoints) (proto.JobChain, error)
 }
 
 // TODO(felixp): This kind of comment can probably be moved out of the code
@@ -70,6 +98,12 @@ type Resumer interface {
 // Resumer "unclaims" the SJC, removing its claim on the SJC and allowing another
 // Resumer (or the same Resumer at a later time) to retry this process.
 //
+// Failed attempts back off exponentially: the SJC is not resumed again until
+// Backoff, then 2x Backoff, and so on up to MaxBackoff. After MaxAttempts, the
+// SJC is deleted and its request's state changed from Suspended to Failed Resume
+// with the last error. This keeps a "poison" SJC that crashes every Job Runner
+// it's sent to from being resumed forever.
+//
 // After the attempting to resume all SJCs, the Resumer does some cleanup of any
 // remaining SJCs it has stored. Old SJCs, which were suspended more than an hour
 // ago, are deleted and their request's states changed from Suspended to Failed.
@@ -88,6 +122,11 @@ type resumer struct {
 	shutdownChan chan struct{}
 	logger       *log.Entry
 	sjcTTL       time.Duration // how long after being suspended do we keep an SJC
+	backoff      time.Duration // wait after first failed resume attempt
+	maxBackoff   time.Duration // max wait between resume attempts
+	maxAttempts  uint          // max failed resume attempts, 0 = no max
+	specVersions *SpecVersions // nil = resume any spec version
+	sm           *StateMachine
 }
 
 type ResumerConfig struct {
@@ -98,9 +137,18 @@ type ResumerConfig struct {
 	RMHost               string
 	ShutdownChan         chan struct{}
 	SuspendedJobChainTTL time.Duration
+	Backoff              time.Duration // wait after first failed resume attempt (0 = no wait)
+	MaxBackoff           time.Duration // max wait between resume attempts (0 = no max)
+	MaxAttempts          uint          // max failed resume attempts (0 = no max)
+	SpecVersions         *SpecVersions // optional, resume only kept spec versions
+	StateMachine         *StateMachine // optional, shared with the Manager
 }
 
 func NewResumer(cfg ResumerConfig) Resumer {
+	sm := cfg.StateMachine
+	if sm == nil {
+		sm = &StateMachine{}
+	}
 	return &resumer{
 		rm:           cfg.RequestManager,
 		dbc:          cfg.DBConnector,
@@ -109,6 +157,11 @@ func NewResumer(cfg ResumerConfig) Resumer {
 		host:         cfg.RMHost,
 		shutdownChan: cfg.ShutdownChan,
 		sjcTTL:       cfg.SuspendedJobChainTTL,
+		backoff:      cfg.Backoff,
+		maxBackoff:   cfg.MaxBackoff,
+		maxAttempts:  cfg.MaxAttempts,
+		specVersions: cfg.SpecVersions,
+		sm:           sm,
 	}
 }
 
@@ -123,7 +176,7 @@ func (r *resumer) Suspend(sjc proto.SuspendedJobChain) (err error) {
 		return serr.NewErrInvalidState(proto.StateName[proto.STATE_RUNNING], proto.StateName[req.State])
 	}
 
-	rawSJC, err := json.Marshal(sjc)
+	rawSJC, err := proto.EncodeSuspendedJobChain(sjc, proto.ChainFormat())
 	if err != nil {
 		return fmt.Errorf("cannot marshal Suspended Job Chain: %s", err)
 	}
@@ -148,10 +201,15 @@ func (r *resumer) Suspend(sjc proto.SuspendedJobChain) (err error) {
 	}
 
 	// Mark request as suspended and set JR url to null. This will only update the
-	// request if the current state is RUNNING (it should be, per the earlier test).
+	// request if the current state is RUNNING (it should be, per the earlier test)
+	// and, if the JR lost the request, which was resumed since, it's not fenced.
+	var token uint64
+	if sjc.JobChain != nil {
+		token = sjc.JobChain.FenceToken
+	}
 	req.State = proto.STATE_SUSPENDED
 	req.JobRunnerURL = ""
-	err = r.updateRequestWithTxn(req, proto.STATE_RUNNING, txn)
+	err = r.updateFencedRequestWithTxn(req, proto.STATE_RUNNING, token, txn)
 	if err != nil {
 		// If we couldn't update the state's request to Suspended, we don't commit
 		// the transaction that inserted the SJC into the db. We don't want to keep
@@ -159,7 +217,11 @@ func (r *resumer) Suspend(sjc proto.SuspendedJobChain) (err error) {
 		return err
 	}
 
-	return txn.Commit()
+	if err := txn.Commit(); err != nil {
+		return err
+	}
+	r.sm.Changed(req, proto.STATE_RUNNING, proto.STATE_SUSPENDED)
+	return nil
 }
 
 // ResumeAll tries to resume all currently suspended job chains. All errors are
@@ -168,8 +230,8 @@ func (r *resumer) Suspend(sjc proto.SuspendedJobChain) (err error) {
 func (r *resumer) ResumeAll() {
 	ctx := context.TODO()
 
-	// Retrieve IDs for all (unclaimed) SJCs.
-	q := "SELECT request_id FROM suspended_job_chains WHERE rm_host IS NULL"
+	// Retrieve IDs for all unclaimed SJCs not waiting to retry (backoff).
+	q := "SELECT request_id FROM suspended_job_chains WHERE rm_host IS NULL AND (resume_after IS NULL OR resume_after <= NOW(6))"
 	rows, err := r.dbc.QueryContext(ctx, q)
 	if err != nil {
 		log.Errorf("error querying db for SJCs: %s", err)
@@ -218,25 +280,117 @@ func (r *resumer) ResumeAll() {
 		err = r.Resume(id)
 		if err != nil {
 			log.Errorf("error resuming SJC %s: %s", id, err)
-			// We didn't resume the SJC, so unclaim it.
-			err := r.unclaimSJC(id, true)
-			if err != nil {
-				log.Errorf("error unclaiming SJC %s: %s", id, err)
+			ResumeErrors.Add(1)
+			// We didn't resume the SJC, so back off or, after max attempts,
+			// fail the request. Both unclaim or delete the SJC.
+			if err := r.resumeFailed(id, err); err != nil {
+				log.Errorf("error handling failed resume of SJC %s: %s", id, err)
+				if err := r.unclaimSJC(id, true); err != nil {
+					log.Errorf("error unclaiming SJC %s: %s", id, err)
+				}
 				continue
 			}
 		}
 	}
 }
 
+// resumeFailed records a failed attempt to resume the claimed SJC. If it has
+// reached the max attempts, or its spec version is not kept, the request state
+// is changed from Suspended to Failed Resume with the error, and the SJC is
+// deleted. Else, the SJC is unclaimed and not resumed again until after the
+// backoff wait.
+func (r *resumer) resumeFailed(id string, resumeErr error) error {
+	ctx := context.TODO()
+
+	var attempts uint
+	q := "SELECT resume_attempts FROM suspended_job_chains WHERE request_id = ? AND rm_host = ?"
+	if err := r.dbc.QueryRowContext(ctx, q, id, r.host).Scan(&attempts); err != nil {
+		return fmt.Errorf("error querying db for resume attempts: %s", err)
+	}
+	attempts++
+
+	var reason string
+	if errors.Is(resumeErr, ErrSpecVersionNotKept) {
+		log.Errorf("SJC %s cannot be resumed, setting request state to FAILED_RESUME: %s", id, resumeErr)
+		reason = proto.Truncate(resumeErr.Error(), MAX_RESUME_ERROR_LEN)
+	} else if r.maxAttempts > 0 && attempts >= r.maxAttempts {
+		log.Errorf("SJC %s failed to resume %d times (max attempts), setting request state to FAILED_RESUME", id, attempts)
+		reason = proto.Truncate(fmt.Sprintf("failed to resume %d times, last error: %s", attempts, resumeErr), MAX_RESUME_ERROR_LEN)
+	}
+	if reason != "" {
+		txn, err := r.dbc.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer txn.Rollback()
+		q = "UPDATE requests SET state = ?, jr_url = NULL, finished_at = NOW(6), resume_error = ? WHERE request_id = ? AND state = ?"
+		res, err := txn.ExecContext(ctx, q, proto.STATE_FAILED_RESUME, reason, id, proto.STATE_SUSPENDED)
+		if err != nil {
+			return err
+		}
+		if cnt, err := res.RowsAffected(); err != nil {
+			return err
+		} else if cnt != 1 {
+			return ErrNotUpdated
+		}
+		q = "DELETE FROM suspended_job_chains WHERE request_id = ? AND rm_host = ?"
+		if _, err := txn.ExecContext(ctx, q, id, r.host); err != nil {
+			return err
+		}
+		if err := txn.Commit(); err != nil {
+			return err
+		}
+		r.sm.Changed(proto.Request{Id: id}, proto.STATE_SUSPENDED, proto.STATE_FAILED_RESUME)
+		ResumeFailed.Add(1)
+		return nil
+	}
+
+	// Unclaim and back off in one update: rm_host = NULL is the strict unclaim,
+	// and the SJC isn't selected by ResumeAll until resume_after
+	wait := r.backoffWait(attempts)
+	log.Infof("SJC %s failed to resume %d times, retrying after %s", id, attempts, wait)
+	q = "UPDATE suspended_job_chains SET rm_host = NULL, resume_attempts = ?, resume_after = NOW(6) + INTERVAL ? MICROSECOND WHERE request_id = ? AND rm_host = ?"
+	res, err := r.dbc.ExecContext(ctx, q, attempts, wait.Microseconds(), id, r.host)
+	if err != nil {
+		return err
+	}
+	cnt, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if cnt != 1 {
+		return ErrNotUpdated
+	}
+	return nil
+}
+
+// backoffWait returns how long to wait after the given number of failed resume
+// attempts: backoff doubled for each attempt after the first, up to maxBackoff.
+func (r *resumer) backoffWait(attempts uint) time.Duration {
+	wait := r.backoff
+	for i := uint(1); i < attempts && wait < math.MaxInt64/2; i++ {
+		if r.maxBackoff > 0 && wait >= r.maxBackoff {
+			break
+		}
+		wait *= 2
+	}
+	if r.maxBackoff > 0 && wait > r.maxBackoff {
+		wait = r.maxBackoff
+	}
+	return wait
+}
+
 // Resume a request by sending it to the JR and updating its state.
 func (r *resumer) Resume(id string) error {
 	// Connect to database
 	ctx := context.TODO()
 
-	// Retrieve the request state.
+	// Retrieve the request state and the version of the specs its job chain
+	// was built with.
 	var state byte
-	q := "SELECT state FROM requests WHERE request_id = ?"
-	err := r.dbc.QueryRowContext(ctx, q, id).Scan(&state)
+	var specVersion sql.NullString
+	q := "SELECT state, spec_version FROM requests WHERE request_id = ?"
+	err := r.dbc.QueryRowContext(ctx, q, id).Scan(&state, &specVersion)
 	if err != nil {
 		return fmt.Errorf("error querying db for request state: %s", err)
 	}
@@ -255,6 +409,20 @@ func (r *resumer) Resume(id string) error {
 		return nil // no error - SJC was resumed earlier
 	}
 
+	// The SJC has the job chain built from the request's spec version. Resume
+	// it only if that version is still kept, i.e. one of the last versions
+	// loaded, so Job Runners can still run its jobs.
+	if specVersion.Valid && r.specVersions != nil {
+		kept, err := r.specVersions.Kept(specVersion.String)
+		if err != nil {
+			return err
+		}
+		if !kept {
+			return fmt.Errorf("%w: request built with spec version %s, which is not one of the last %d versions loaded",
+				ErrSpecVersionNotKept, specVersion.String, r.specVersions.keep)
+		}
+	}
+
 	// Retrieve the actual Suspended Job Chain
 	var rawSJC []byte
 	q = "SELECT suspended_job_chain FROM suspended_job_chains WHERE request_id = ? AND rm_host = ?"
@@ -264,13 +432,28 @@ func (r *resumer) Resume(id string) error {
 	}
 
 	var sjc proto.SuspendedJobChain
-	err = json.Unmarshal(rawSJC, &sjc)
+	err = proto.DecodeSuspendedJobChain(rawSJC, &sjc)
 	if err != nil {
 		return fmt.Errorf("error unmarshaling SJC: %s", err)
 	}
 
-	// Send suspended job chain to JR, which will resume running it.
-	chainURL, err := r.jrc.ResumeJobChain(r.defaultJRURL, sjc)
+	// Issue the next fencing token so the JR that ran the chain before, if it's
+	// still running it, cannot change the request
+	if sjc.JobChain != nil {
+		sjc.JobChain.FenceToken, err = nextFenceToken(r.dbc, id)
+		if err != nil {
+			return fmt.Errorf("error issuing fencing token: %s", err)
+		}
+	}
+
+	// Send suspended job chain to JR, which will resume running it. The SJC
+	// specifies the JR if a standby JR is taking over the request.
+	jrURL := r.defaultJRURL
+	if sjc.JobRunnerURL != "" {
+		jrURL = sjc.JobRunnerURL
+	}
+	ResumeAttempts.Add(1)
+	chainURL, err := r.jrc.ResumeJobChain(jrURL, sjc)
 	if err != nil {
 		return fmt.Errorf("error sending SJC to Job Runner: %s", err)
 	}
@@ -286,6 +469,10 @@ func (r *resumer) Resume(id string) error {
 	if err = r.updateRequest(req, proto.STATE_SUSPENDED); err != nil {
 		return fmt.Errorf("error setting request state to STATE_RUNNING and saving job runner url: %s", err)
 	}
+	if sjc.JobChain != nil {
+		req.CorrelationId = sjc.JobChain.CorrelationId // for logging
+	}
+	r.sm.Changed(req, proto.STATE_SUSPENDED, proto.STATE_RUNNING)
 
 	// Now that we've resumed running the request, we can delete the SJC. We don't
 	// do this within the same transaction as updating the request, because even if
@@ -336,7 +523,7 @@ func (r *resumer) Cleanup() {
 	rows.Close() // must close before new queries to unclaim SJCs
 
 	for _, reqId := range ids {
-		reqLogger := log.WithFields(log.Fields{"request": reqId})
+		reqLogger := reqlog.Entry(reqId).WithFields(log.Fields{"request": reqId})
 
 		// Unclaim SJC so another RM can resume it.
 		err = r.unclaimSJC(reqId, false)
@@ -372,7 +559,7 @@ func (r *resumer) Cleanup() {
 	// Delete the SJCs for all of these requests. If the request state is Suspended,
 	// mark it as Failed.
 	for _, req := range requests {
-		reqLogger := log.WithFields(log.Fields{"request": req.Id})
+		reqLogger := reqlog.Entry(req.Id).WithFields(log.Fields{"request": req.Id})
 
 		// Claim the SJC so an RM doesn't try to resume it while we're deleting it.
 		claimed, err := r.claimSJC(req.Id)
@@ -399,6 +586,9 @@ func (r *resumer) Cleanup() {
 			}
 			continue
 		}
+		if err == nil {
+			r.sm.Changed(req, proto.STATE_SUSPENDED, proto.STATE_FAIL)
+		}
 
 		// Delete the old SJC. If this fails, the SJC will get deleted the next time
 		// an RM tries to resume it (since the request is now marked Failed).
@@ -415,6 +605,134 @@ func (r *resumer) Cleanup() {
 	return
 }
 
+func (r *resumer) ResumePoints(requestId string) (proto.JobChain, error) {
+	req, err := r.rm.Get(requestId)
+	if err != nil {
+		return proto.JobChain{}, err
+	}
+	if req.State != proto.STATE_SUSPENDED {
+		return proto.JobChain{}, serr.NewErrInvalidState(proto.StateName[proto.STATE_SUSPENDED], proto.StateName[req.State])
+	}
+	var rawSJC []byte
+	q := "SELECT suspended_job_chain FROM suspended_job_chains WHERE request_id = ?"
+	if err := r.dbc.QueryRowContext(context.TODO(), q, requestId).Scan(&rawSJC); err != nil {
+		if err == sql.ErrNoRows {
+			return proto.JobChain{}, serr.NewErrInvalidState(proto.StateName[proto.STATE_SUSPENDED], "RUNNING (resumed)")
+		}
+		return proto.JobChain{}, serr.NewDbError(err, "SELECT suspended_job_chains")
+	}
+	var sjc proto.SuspendedJobChain
+	if err := proto.DecodeSuspendedJobChain(rawSJC, &sjc); err != nil {
+		return proto.JobChain{}, fmt.Errorf("error unmarshaling SJC: %s", err)
+	}
+	if sjc.JobChain == nil {
+		return proto.JobChain{}, fmt.Errorf("suspended job chain of request %s has no job chain", requestId)
+	}
+	return *sjc.JobChain, nil
+}
+
+// SetResumePoints claims the SJC so it's not resumed while it's changed, like
+// resuming it, then saves it and unclaims it in one update.
+func (r *resumer) SetResumePoints(requestId string, rp proto.ResumePoints) (proto.JobChain, error) {
+	var hold time.Duration
+	if rp.Hold != "" {
+		var err error
+		hold, err = time.ParseDuration(rp.Hold)
+		if err != nil || hold < 0 {
+			return proto.JobChain{}, serr.ValidationError{Message: fmt.Sprintf("invalid hold %s: must be a duration like 10m", rp.Hold)}
+		}
+	}
+
+	req, err := r.rm.Get(requestId)
+	if err != nil {
+		return proto.JobChain{}, err
+	}
+	if req.State != proto.STATE_SUSPENDED {
+		return proto.JobChain{}, serr.NewErrInvalidState(proto.StateName[proto.STATE_SUSPENDED], proto.StateName[req.State])
+	}
+	claimed, err := r.claimSJC(requestId)
+	if err != nil {
+		return proto.JobChain{}, serr.NewDbError(err, "UPDATE suspended_job_chains")
+	}
+	if !claimed {
+		// Being resumed or cleaned up by an RM, or already resumed
+		return proto.JobChain{}, serr.NewErrInvalidState(proto.StateName[proto.STATE_SUSPENDED], "SUSPENDED (being resumed)")
+	}
+
+	jc, err := r.setResumePoints(requestId, rp.Jobs, hold)
+	if err != nil {
+		if err := r.unclaimSJC(requestId, true); err != nil {
+			log.Errorf("error unclaiming SJC %s: %s", requestId, err)
+		}
+		return proto.JobChain{}, err
+	}
+	return jc, nil
+}
+
+// setResumePoints changes the jobs of the claimed SJC, saves it, and unclaims it.
+// If jobs changed, the resume attempts are reset. The SJC is not resumed until
+// after hold, if set.
+func (r *resumer) setResumePoints(requestId string, jobs map[string]string, hold time.Duration) (proto.JobChain, error) {
+	ctx := context.TODO()
+	var rawSJC []byte
+	q := "SELECT suspended_job_chain FROM suspended_job_chains WHERE request_id = ? AND rm_host = ?"
+	if err := r.dbc.QueryRowContext(ctx, q, requestId, r.host).Scan(&rawSJC); err != nil {
+		return proto.JobChain{}, serr.NewDbError(err, "SELECT suspended_job_chains")
+	}
+	var sjc proto.SuspendedJobChain
+	if err := proto.DecodeSuspendedJobChain(rawSJC, &sjc); err != nil {
+		return proto.JobChain{}, fmt.Errorf("error unmarshaling SJC: %s", err)
+	}
+	if err := ApplyResumePoints(&sjc, jobs); err != nil {
+		return proto.JobChain{}, err
+	}
+	rawSJC, err := proto.EncodeSuspendedJobChain(sjc, proto.ChainFormat())
+	if err != nil {
+		return proto.JobChain{}, fmt.Errorf("cannot marshal Suspended Job Chain: %s", err)
+	}
+
+	// Save and unclaim in one update, like resumeFailed. NULL resume_after
+	// resumes the SJC as soon as possible.
+	var resumeAfter interface{}
+	q = "UPDATE suspended_job_chains SET suspended_job_chain = ?, rm_host = NULL, resume_after = NULL"
+	if hold > 0 {
+		q = "UPDATE suspended_job_chains SET suspended_job_chain = ?, rm_host = NULL, resume_after = NOW(6) + INTERVAL ? MICROSECOND"
+		resumeAfter = hold.Microseconds()
+	}
+	if len(jobs) > 0 {
+		q += ", resume_attempts = 0"
+	}
+	q += " WHERE request_id = ? AND rm_host = ?"
+	args := []interface{}{rawSJC}
+	if resumeAfter != nil {
+		args = append(args, resumeAfter)
+	}
+	args = append(args, requestId, r.host)
+	res, err := r.dbc.ExecContext(ctx, q, args...)
+	if err != nil {
+		return proto.JobChain{}, serr.NewDbError(err, "UPDATE suspended_job_chains")
+	}
+	if cnt, err := res.RowsAffected(); err != nil {
+		return proto.JobChain{}, err
+	} else if cnt != 1 {
+		return proto.JobChain{}, ErrNotUpdated
+	}
+
+	logger := requestLogger(proto.Request{Id: requestId, CorrelationId: sjc.JobChain.CorrelationId})
+	ids := make([]string, 0, len(jobs))
+	for id := range jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		logger.Infof("resume point set: job %s (%s) %s", id, sjc.JobChain.Jobs[id].Name, jobs[id])
+	}
+	if hold > 0 {
+		logger.Infof("resume held for %s", hold)
+	}
+	return *sjc.JobChain, nil
+}
+
 // Update the State and JR url of a request. This is a wrapper around
 // updateRequestWithTxn that creates a transaction for updating the request.
 func (r *resumer) updateRequest(request proto.Request, curState byte) error {
@@ -437,6 +755,17 @@ func (r *resumer) updateRequest(request proto.Request, curState byte) error {
 // using the provided db transaction. The request is updated only if its current
 // state in the db matches the state provided.
 func (r *resumer) updateRequestWithTxn(request proto.Request, curState byte, txn *sql.Tx) error {
+	return r.updateFencedRequestWithTxn(request, curState, 0, txn)
+}
+
+// updateFencedRequestWithTxn is updateRequestWithTxn for a change from a Job
+// Runner with the fencing token (see fenceClause). It returns serr.ErrFenced if
+// the token is fenced.
+func (r *resumer) updateFencedRequestWithTxn(request proto.Request, curState byte, token uint64, txn *sql.Tx) error {
+	if err := r.sm.Check(request.Id, curState, request.State); err != nil {
+		return err
+	}
+
 	// If JobRunnerURL is empty, we want to set the db field to NULL (not an empty string).
 	var jrURL interface{}
 	if request.JobRunnerURL != "" {
@@ -444,8 +773,9 @@ func (r *resumer) updateRequestWithTxn(request proto.Request, curState byte, txn
 	}
 
 	// Update the 'state' and 'jr_url' fields only.
-	q := "UPDATE requests SET state = ?, jr_url = ? WHERE request_id = ? AND state = ?"
-	res, err := txn.Exec(q, request.State, jrURL, request.Id, curState)
+	fence, fenceArgs := fenceClause(token)
+	q := "UPDATE requests SET state = ?, jr_url = ? WHERE request_id = ? AND state = ?" + fence
+	res, err := txn.Exec(q, append([]interface{}{request.State, jrURL, request.Id, curState}, fenceArgs...)...)
 	if err != nil {
 		return err
 	}
@@ -457,9 +787,9 @@ func (r *resumer) updateRequestWithTxn(request proto.Request, curState byte, txn
 
 	switch cnt {
 	case 0:
-		// Either the request's current state != curState, or no request with the
-		// id given exists.
-		return ErrNotUpdated
+		// Either the request's current state != curState, no request with the
+		// id given exists, or the token is fenced.
+		return notUpdated(r.dbc, request.Id, token)
 	case 1:
 		return nil
 	default:
@@ -7,6 +7,7 @@ import (
 	"database/sql"
 	"encoding/json"
 	"net/url"
+	"strings"
 	"testing"
 	"time"
 
@@ -203,8 +204,13 @@ func TestResume(t *testing.T) {
 		t.Errorf("got error resuming request: %s", err)
 	}
 
-	// Make sure SJC is sent to JR.
-	if diff := deep.Equal(testdb.SavedSJCs[id], receivedSJC); diff != nil {
+	// Make sure SJC is sent to JR with the next fencing token: the first
+	// resume of a request is token 2 because it was started with token 1.
+	expectSJC := testdb.SavedSJCs[id]
+	expectJC := *expectSJC.JobChain
+	expectJC.FenceToken = 2
+	expectSJC.JobChain = &expectJC
+	if diff := deep.Equal(expectSJC, receivedSJC); diff != nil {
 		t.Error(diff)
 	}
 
@@ -428,6 +434,195 @@ func TestResumeAll(t *testing.T) {
 	}
 }
 
+func TestResumeAllBackoff(t *testing.T) {
+	dbName := setupResumer(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownResumer(t, dbName)
+
+	// JR fails to resume every SJC, like an SJC that crashes the JR
+	sent := map[string]int{}
+	jrc := &mock.JRClient{
+		ResumeJobChainFunc: func(baseURL string, sjc proto.SuspendedJobChain) (*url.URL, error) {
+			sent[sjc.RequestId]++
+			return nil, mock.ErrJRClient
+		},
+	}
+
+	cfg := request.ResumerConfig{
+		RequestManager: rm,
+		DBConnector:    dbc,
+		JRClient:       jrc,
+		RMHost:         "hostname",
+		ShutdownChan:   shutdownChan,
+		Backoff:        time.Hour,
+		MaxBackoff:     2 * time.Hour,
+		MaxAttempts:    2,
+	}
+	r := request.NewResumer(cfg)
+
+	// First attempt fails: SJCs unclaimed, attempts = 1, and not resumed again
+	// until after backoff (1h)
+	r.ResumeAll()
+	expectSent := map[string]int{
+		"suspended___________": 1,
+		"old_sjc_____________": 1,
+	}
+	if diff := deep.Equal(sent, expectSent); diff != nil {
+		t.Error(diff)
+	}
+	ctx := context.TODO()
+	for reqId := range expectSent {
+		var attempts uint
+		var rmHost sql.NullString
+		var waiting bool
+		q := "SELECT resume_attempts, rm_host, resume_after > NOW(6) FROM suspended_job_chains WHERE request_id = ?"
+		if err := dbc.QueryRowContext(ctx, q, reqId).Scan(&attempts, &rmHost, &waiting); err != nil {
+			t.Fatalf("error querying SJC %s: %s", reqId, err)
+		}
+		if attempts != 1 {
+			t.Errorf("SJC %s resume_attempts = %d, expected 1", reqId, attempts)
+		}
+		if rmHost.Valid {
+			t.Errorf("SJC %s rm_host = %s, expected NULL (unclaimed)", reqId, rmHost.String)
+		}
+		if !waiting {
+			t.Errorf("SJC %s resume_after not in the future, expected backoff", reqId)
+		}
+		req, err := rm.Get(reqId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.State != proto.STATE_SUSPENDED {
+			t.Errorf("request %s state = %s, expected SUSPENDED", reqId, proto.StateName[req.State])
+		}
+	}
+
+	// Backing off, so SJCs are not sent again
+	r.ResumeAll()
+	if diff := deep.Equal(sent, expectSent); diff != nil {
+		t.Error(diff)
+	}
+
+	// After backoff, second attempt fails: max attempts, so requests are
+	// FAILED_RESUME with the error, and SJCs are deleted
+	if _, err := dbc.ExecContext(ctx, "UPDATE suspended_job_chains SET resume_after = NOW(6) WHERE resume_after IS NOT NULL"); err != nil {
+		t.Fatal(err)
+	}
+	r.ResumeAll()
+	expectSent = map[string]int{
+		"suspended___________": 2,
+		"old_sjc_____________": 2,
+	}
+	if diff := deep.Equal(sent, expectSent); diff != nil {
+		t.Error(diff)
+	}
+	for reqId := range expectSent {
+		var n int
+		if err := dbc.QueryRowContext(ctx, "SELECT COUNT(*) FROM suspended_job_chains WHERE request_id = ?", reqId).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("SJC %s not deleted", reqId)
+		}
+		req, err := rm.Get(reqId)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if req.State != proto.STATE_FAILED_RESUME {
+			t.Errorf("request %s state = %s, expected FAILED_RESUME", reqId, proto.StateName[req.State])
+		}
+		if !strings.HasPrefix(req.ResumeError, "failed to resume 2 times, last error: ") {
+			t.Errorf("request %s resume error = %q, expected 'failed to resume 2 times...'", reqId, req.ResumeError)
+		}
+		if req.FinishedAt == nil {
+			t.Errorf("request %s finished_at not set", reqId)
+		}
+	}
+}
+
+func TestSetResumePoints(t *testing.T) {
+	dbName := setupResumer(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownResumer(t, dbName)
+
+	cfg := request.ResumerConfig{
+		RequestManager: rm,
+		DBConnector:    dbc,
+		JRClient:       &mock.JRClient{},
+		RMHost:         "hostname",
+		ShutdownChan:   shutdownChan,
+	}
+	r := request.NewResumer(cfg)
+
+	// Job hw48 was stopped
+	reqId := "suspended___________"
+	jc, err := r.ResumePoints(reqId)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jc.Jobs["hw48"].State != proto.STATE_STOPPED {
+		t.Errorf("job hw48 state = %s, expected STOPPED", proto.StateName[jc.Jobs["hw48"].State])
+	}
+
+	// Mark it complete and hold: saved, unclaimed, and not resumed until after hold
+	ctx := context.TODO()
+	if _, err := dbc.ExecContext(ctx, "UPDATE suspended_job_chains SET resume_attempts = 2 WHERE request_id = ?", reqId); err != nil {
+		t.Fatal(err)
+	}
+	jc, err = r.SetResumePoints(reqId, proto.ResumePoints{
+		Jobs: map[string]string{"hw48": proto.RESUME_COMPLETE},
+		Hold: "1h",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if jc.Jobs["hw48"].State != proto.STATE_COMPLETE || jc.FinishedJobs != 1 {
+		t.Errorf("job hw48 state = %s, finished jobs %d; expected COMPLETE, 1", proto.StateName[jc.Jobs["hw48"].State], jc.FinishedJobs)
+	}
+	var rawSJC []byte
+	var attempts uint
+	var rmHost sql.NullString
+	var waiting bool
+	q := "SELECT suspended_job_chain, resume_attempts, rm_host, resume_after > NOW(6) FROM suspended_job_chains WHERE request_id = ?"
+	if err := dbc.QueryRowContext(ctx, q, reqId).Scan(&rawSJC, &attempts, &rmHost, &waiting); err != nil {
+		t.Fatal(err)
+	}
+	var sjc proto.SuspendedJobChain
+	if err := proto.DecodeSuspendedJobChain(rawSJC, &sjc); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(*sjc.JobChain, jc); diff != nil {
+		t.Error(diff)
+	}
+	if attempts != 0 {
+		t.Errorf("resume_attempts = %d, expected 0 (reset)", attempts)
+	}
+	if rmHost.Valid {
+		t.Errorf("rm_host = %s, expected NULL (unclaimed)", rmHost.String)
+	}
+	if !waiting {
+		t.Error("resume_after not in the future, expected hold")
+	}
+
+	// Inconsistent resume points are not saved, and the SJC is unclaimed
+	_, err = r.SetResumePoints(reqId, proto.ResumePoints{Jobs: map[string]string{"nope": proto.RESUME_SKIP}})
+	if _, ok := err.(serr.ValidationError); !ok {
+		t.Errorf("got error %v, expected serr.ValidationError", err)
+	}
+	if err := dbc.QueryRowContext(ctx, "SELECT rm_host FROM suspended_job_chains WHERE request_id = ?", reqId).Scan(&rmHost); err != nil {
+		t.Fatal(err)
+	}
+	if rmHost.Valid {
+		t.Errorf("rm_host = %s, expected NULL (unclaimed)", rmHost.String)
+	}
+
+	// Only suspended requests, and not while an RM is resuming them
+	if _, err := r.SetResumePoints("454ae2f98a05cv16sdwt", proto.ResumePoints{}); err == nil {
+		t.Error("no error for running request, expected an error")
+	}
+	if _, err := r.SetResumePoints("abandoned_sjc_______", proto.ResumePoints{}); err == nil {
+		t.Error("no error for claimed SJC, expected an error")
+	}
+}
+
 func TestCleanup(t *testing.T) {
 	dbName := setupResumer(t, rmtest.DataPath+"/request-default.sql")
 	defer teardownResumer(t, dbName)
@@ -560,3 +755,80 @@ func TestCleanup(t *testing.T) {
 		t.Errorf("request %s state = %s, expected %s", req.Id, proto.StateName[req.State], "FAIL")
 	}
 }
+
+func TestResumeSpecVersionNotKept(t *testing.T) {
+	dbName := setupResumer(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownResumer(t, dbName)
+
+	// suspended___________ was built with a kept spec version, old_sjc_____________
+	// with a version that was dropped
+	ctx := context.TODO()
+	sv := request.NewSpecVersions(dbc, 2)
+	for _, version := range []string{"v1", "v2", "v3"} {
+		if err := sv.Load(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+	versions := map[string]string{
+		"suspended___________": "v2",
+		"old_sjc_____________": "v1",
+	}
+	for reqId, version := range versions {
+		if _, err := dbc.ExecContext(ctx, "UPDATE requests SET spec_version = ? WHERE request_id = ?", version, reqId); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sent := map[string]int{}
+	jrc := &mock.JRClient{
+		ResumeJobChainFunc: func(baseURL string, sjc proto.SuspendedJobChain) (*url.URL, error) {
+			sent[sjc.RequestId]++
+			return url.Parse(baseURL + "/api/v1/job-chains/" + sjc.RequestId)
+		},
+	}
+	cfg := request.ResumerConfig{
+		RequestManager: rm,
+		DBConnector:    dbc,
+		JRClient:       jrc,
+		DefaultJRURL:   "http://defaulturl:1111",
+		RMHost:         "hostname",
+		ShutdownChan:   shutdownChan,
+		Backoff:        time.Hour,
+		MaxAttempts:    10,
+		SpecVersions:   sv,
+	}
+	r := request.NewResumer(cfg)
+	r.ResumeAll()
+
+	// Only the request with a kept spec version is sent to the JR
+	if diff := deep.Equal(sent, map[string]int{"suspended___________": 1}); diff != nil {
+		t.Error(diff)
+	}
+	req, err := rm.Get("suspended___________")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != proto.STATE_RUNNING {
+		t.Errorf("request state = %s, expected RUNNING", proto.StateName[req.State])
+	}
+
+	// The other fails to resume on the first attempt, despite max attempts 10,
+	// and its SJC is deleted
+	req, err = rm.Get("old_sjc_____________")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.State != proto.STATE_FAILED_RESUME {
+		t.Errorf("request state = %s, expected FAILED_RESUME", proto.StateName[req.State])
+	}
+	if !strings.Contains(req.ResumeError, "spec version v1") {
+		t.Errorf("resume error = %q, expected spec version v1 error", req.ResumeError)
+	}
+	var n int
+	if err := dbc.QueryRowContext(ctx, "SELECT COUNT(*) FROM suspended_job_chains WHERE request_id = ?", "old_sjc_____________").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("SJC not deleted")
+	}
+}
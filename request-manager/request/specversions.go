@@ -0,0 +1,83 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrSpecVersionNotKept is returned by Resumer.Resume when a request was built
+// with a spec version that's no longer one of the kept versions. Resuming it
+// again won't help, so the request fails to resume without retrying.
+var ErrSpecVersionNotKept = errors.New("spec version not kept")
+
+// SpecVersions keeps the last spec versions loaded by any Request Manager in
+// the spec_versions table. A version is loaded when a Request Manager starts,
+// so during a rolling deploy both the old and new versions are kept. Suspended
+// job chains are resumed only if their request was built with a kept version:
+// the job chain, built from the version's specs, is resumed as-is, which is
+// only safe while Job Runners can still run the jobs in that version.
+type SpecVersions struct {
+	dbc  *sql.DB
+	keep uint
+}
+
+// NewSpecVersions returns a SpecVersions that keeps the last keep versions.
+// keep must be > 0.
+func NewSpecVersions(dbc *sql.DB, keep uint) *SpecVersions {
+	return &SpecVersions{
+		dbc:  dbc,
+		keep: keep,
+	}
+}
+
+// Load makes version the most recently loaded version and drops versions older
+// than the last keep versions.
+func (v *SpecVersions) Load(version string) error {
+	ctx := context.TODO()
+	q := "INSERT INTO spec_versions (version) VALUES (?) ON DUPLICATE KEY UPDATE loaded_at = NOW(6)"
+	if _, err := v.dbc.ExecContext(ctx, q, version); err != nil {
+		return fmt.Errorf("error saving spec version: %s", err)
+	}
+
+	// The derived table in the derived table is necessary because MySQL doesn't
+	// allow selecting from the table being deleted from. If there are not more
+	// than keep versions, the oldest kept is NULL and nothing is deleted.
+	q = "DELETE FROM spec_versions WHERE loaded_at < (SELECT loaded_at FROM (SELECT loaded_at FROM spec_versions ORDER BY loaded_at DESC LIMIT 1 OFFSET ?) AS oldest_kept)"
+	if _, err := v.dbc.ExecContext(ctx, q, v.keep-1); err != nil {
+		return fmt.Errorf("error dropping old spec versions: %s", err)
+	}
+	return nil
+}
+
+// Kept returns true if version is one of the last keep versions loaded.
+func (v *SpecVersions) Kept(version string) (bool, error) {
+	var n int
+	q := "SELECT COUNT(*) FROM spec_versions WHERE version = ?"
+	if err := v.dbc.QueryRowContext(context.TODO(), q, version).Scan(&n); err != nil {
+		return false, fmt.Errorf("error querying db for spec version: %s", err)
+	}
+	return n > 0, nil
+}
+
+// List returns the kept versions, most recently loaded first.
+func (v *SpecVersions) List() ([]string, error) {
+	q := "SELECT version FROM spec_versions ORDER BY loaded_at DESC"
+	rows, err := v.dbc.QueryContext(context.TODO(), q)
+	if err != nil {
+		return nil, fmt.Errorf("error querying db for spec versions: %s", err)
+	}
+	defer rows.Close()
+	versions := []string{}
+	for rows.Next() {
+		var version string
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,58 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/request-manager/request"
+	rmtest "github.com/square/spincycle/v2/request-manager/test"
+)
+
+func TestSpecVersions(t *testing.T) {
+	dbName := setupResumer(t, rmtest.DataPath+"/request-default.sql")
+	defer teardownResumer(t, dbName)
+
+	sv := request.NewSpecVersions(dbc, 2)
+	for _, version := range []string{"v1", "v2", "v3"} {
+		if err := sv.Load(version); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Last 2 versions kept, most recent first
+	versions, err := sv.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(versions, []string{"v3", "v2"}); diff != nil {
+		t.Error(diff)
+	}
+	for version, expect := range map[string]bool{"v1": false, "v2": true, "v3": true, "v4": false} {
+		kept, err := sv.Kept(version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if kept != expect {
+			t.Errorf("version %s kept = %t, expected %t", version, kept, expect)
+		}
+	}
+
+	// Loading a kept version again makes it the most recent, so the other
+	// version is dropped when a new version is loaded
+	if err := sv.Load("v2"); err != nil {
+		t.Fatal(err)
+	}
+	if err := sv.Load("v4"); err != nil {
+		t.Fatal(err)
+	}
+	versions, err = sv.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(versions, []string{"v4", "v2"}); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright 2020, Square, Inc.
+
+package request
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/reqlog"
+)
+
+// transitions is the request state machine: the states a request can change
+// to from each state. Final states (COMPLETE, FAIL, STOPPED, etc.) are not
+// listed because a request never changes state once it's final.
+var transitions = map[byte][]byte{
+	// Start (RUNNING) or fail to start (FailPending)
+	proto.STATE_PENDING: {proto.STATE_RUNNING, proto.STATE_FAIL},
+
+	// Finish, reported by the JR, or suspend on JR shutdown
+	proto.STATE_RUNNING: {
+		proto.STATE_COMPLETE,
+		proto.STATE_FAIL,
+		proto.STATE_STOPPED,
+		proto.STATE_DEADLINE_EXCEEDED,
+		proto.STATE_SUSPENDED,
+	},
+
+	// Resume (RUNNING), clean up an old SJC (FAIL), or give up resuming
+	proto.STATE_SUSPENDED: {proto.STATE_RUNNING, proto.STATE_FAIL, proto.STATE_FAILED_RESUME},
+}
+
+// ValidTransition returns true if a request can change from one state to the other.
+func ValidTransition(from, to byte) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// FinalState returns true if the state is final: a request in the state never
+// changes state again.
+func FinalState(state byte) bool {
+	return len(transitions[state]) == 0
+}
+
+// Transition is a request state change. It's passed to the StateMachine
+// OnTransition callback after the new state is saved.
+type Transition struct {
+	RequestId     string
+	CorrelationId string // proto.Request.CorrelationId, if any
+	From          byte   // proto.STATE_* const
+	To            byte   // proto.STATE_* const
+	At            time.Time
+
+	// Set only if an admin forced the state change (Manager.Finalize), so
+	// it was not reported by a Job Runner
+	User   string // admin who forced the change
+	Reason string // proto.FinalizeRequest.Reason
+}
+
+// StateMachine validates and records request state changes. Every state change
+// made by the Manager and Resumer, including the final state reported by the
+// Job Runner, is checked by Check before it's saved and passed to Changed after.
+// The zero value is valid.
+type StateMachine struct {
+	// OnTransition, if set, is called after every state change. It's called
+	// synchronously, so it should return quickly.
+	OnTransition func(Transition)
+}
+
+// Check returns serr.ErrInvalidTransition if the request cannot change from
+// one state to the other.
+func (sm *StateMachine) Check(requestId string, from, to byte) error {
+	if !ValidTransition(from, to) {
+		return serr.ErrInvalidTransition{
+			RequestId: requestId,
+			From:      proto.StateName[from],
+			To:        proto.StateName[to],
+		}
+	}
+	return nil
+}
+
+// CheckFinal is like Check but the new state must also be final. It's used to
+// finish a request.
+func (sm *StateMachine) CheckFinal(requestId string, from, to byte) error {
+	if err := sm.Check(requestId, from, to); err != nil {
+		return err
+	}
+	if !FinalState(to) {
+		return serr.ErrInvalidTransition{
+			RequestId: requestId,
+			From:      proto.StateName[from],
+			To:        proto.StateName[to],
+		}
+	}
+	return nil
+}
+
+// Changed records that the request changed state: it logs the transition and
+// calls OnTransition, if set. Only the request ID and correlation ID are used.
+func (sm *StateMachine) Changed(req proto.Request, from, to byte) {
+	requestLogger(req).Infof("request %s state changed: %s -> %s", req.Id, proto.StateName[from], proto.StateName[to])
+	sm.changed(Transition{
+		RequestId:     req.Id,
+		CorrelationId: req.CorrelationId,
+		From:          from,
+		To:            to,
+		At:            time.Now().UTC(),
+	})
+}
+
+// Forced is like Changed but for a state change forced by an admin: it logs
+// and passes the user and reason too.
+func (sm *StateMachine) Forced(req proto.Request, from, to byte, user, reason string) {
+	requestLogger(req).Warnf("request %s state forced by %s: %s -> %s: %s", req.Id, user, proto.StateName[from], proto.StateName[to], reason)
+	sm.changed(Transition{
+		RequestId:     req.Id,
+		CorrelationId: req.CorrelationId,
+		From:          from,
+		To:            to,
+		At:            time.Now().UTC(),
+		User:          user,
+		Reason:        reason,
+	})
+}
+
+func (sm *StateMachine) changed(t Transition) {
+	if sm == nil || sm.OnTransition == nil {
+		return
+	}
+	sm.OnTransition(t)
+}
+
+// requestLogger returns a logger with the request ID and, if set, its correlation
+// ID, so the Request Manager logs for a request can be traced back to the caller.
+func requestLogger(req proto.Request) *log.Entry {
+	fields := log.Fields{"request": req.Id}
+	if req.CorrelationId != "" {
+		fields["correlation_id"] = req.CorrelationId
+	}
+	return reqlog.Entry(req.Id).WithFields(fields)
+}
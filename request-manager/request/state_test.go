@@ -0,0 +1,81 @@
+// Copyright 2020, Square, Inc.
+
+package request_test
+
+import (
+	"testing"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/request"
+)
+
+func TestValidTransition(t *testing.T) {
+	valid := [][2]byte{
+		{proto.STATE_PENDING, proto.STATE_RUNNING},
+		{proto.STATE_PENDING, proto.STATE_FAIL},
+		{proto.STATE_RUNNING, proto.STATE_COMPLETE},
+		{proto.STATE_RUNNING, proto.STATE_STOPPED},
+		{proto.STATE_RUNNING, proto.STATE_SUSPENDED},
+		{proto.STATE_SUSPENDED, proto.STATE_RUNNING},
+		{proto.STATE_SUSPENDED, proto.STATE_FAILED_RESUME},
+	}
+	for _, tr := range valid {
+		if !request.ValidTransition(tr[0], tr[1]) {
+			t.Errorf("%s -> %s invalid, expected valid", proto.StateName[tr[0]], proto.StateName[tr[1]])
+		}
+	}
+
+	invalid := [][2]byte{
+		{proto.STATE_PENDING, proto.STATE_COMPLETE},
+		{proto.STATE_PENDING, proto.STATE_SUSPENDED},
+		{proto.STATE_RUNNING, proto.STATE_PENDING},
+		{proto.STATE_RUNNING, proto.STATE_RUNNING},
+		{proto.STATE_COMPLETE, proto.STATE_RUNNING},
+		{proto.STATE_STOPPED, proto.STATE_FAIL},
+		{proto.STATE_SUSPENDED, proto.STATE_COMPLETE},
+	}
+	for _, tr := range invalid {
+		if request.ValidTransition(tr[0], tr[1]) {
+			t.Errorf("%s -> %s valid, expected invalid", proto.StateName[tr[0]], proto.StateName[tr[1]])
+		}
+	}
+}
+
+func TestStateMachine(t *testing.T) {
+	var got []request.Transition
+	sm := &request.StateMachine{
+		OnTransition: func(tr request.Transition) {
+			got = append(got, tr)
+		},
+	}
+
+	err := sm.Check("abc", proto.STATE_COMPLETE, proto.STATE_RUNNING)
+	if _, ok := err.(serr.ErrInvalidTransition); !ok {
+		t.Errorf("got error %v, expected serr.ErrInvalidTransition", err)
+	}
+
+	// Finishing a request requires a final state
+	if err := sm.CheckFinal("abc", proto.STATE_RUNNING, proto.STATE_STOPPED); err != nil {
+		t.Errorf("got error %s, expected nil", err)
+	}
+	err = sm.CheckFinal("abc", proto.STATE_RUNNING, proto.STATE_SUSPENDED)
+	if _, ok := err.(serr.ErrInvalidTransition); !ok {
+		t.Errorf("got error %v, expected serr.ErrInvalidTransition", err)
+	}
+
+	sm.Changed(proto.Request{Id: "abc", CorrelationId: "xyz"}, proto.STATE_PENDING, proto.STATE_RUNNING)
+	if len(got) != 1 {
+		t.Fatalf("got %d transitions, expected 1", len(got))
+	}
+	if got[0].RequestId != "abc" || got[0].CorrelationId != "xyz" || got[0].From != proto.STATE_PENDING || got[0].To != proto.STATE_RUNNING {
+		t.Errorf("got transition %+v, expected abc PENDING -> RUNNING", got[0])
+	}
+	if got[0].At.IsZero() {
+		t.Errorf("transition time not set")
+	}
+
+	// The zero value is valid: no callback
+	var zero request.StateMachine
+	zero.Changed(proto.Request{Id: "abc"}, proto.STATE_PENDING, proto.STATE_RUNNING)
+}
@@ -0,0 +1,3 @@
+ALTER TABLE `requests`
+  ADD COLUMN `retry_of` BINARY(20) NULL DEFAULT NULL AFTER `spec_version`,
+  ADD COLUMN `retry_count` TINYINT UNSIGNED NOT NULL DEFAULT 0 AFTER `retry_of`;
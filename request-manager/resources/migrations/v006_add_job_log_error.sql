@@ -0,0 +1,4 @@
+ALTER TABLE `job_log`
+  ADD COLUMN `error_category` VARCHAR(64) NULL DEFAULT NULL AFTER `error`,
+  ADD COLUMN `error_code` VARCHAR(64) NULL DEFAULT NULL AFTER `error_category`,
+  ADD COLUMN `error_retryable` TINYINT(1) NOT NULL DEFAULT 0 AFTER `error_code`;
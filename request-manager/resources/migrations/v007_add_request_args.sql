@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS `request_args` (
+  `request_id`  BINARY(20)     NOT NULL,
+  `name`        VARBINARY(100) NOT NULL,
+  `value`       VARBINARY(255) NOT NULL,
+
+  PRIMARY KEY (`request_id`, `name`),
+  INDEX (`name`, `value`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
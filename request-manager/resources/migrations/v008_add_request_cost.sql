@@ -0,0 +1,2 @@
+ALTER TABLE `requests`
+  ADD COLUMN `cost` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `retry_count`;
@@ -0,0 +1,13 @@
+ALTER TABLE `requests`
+  ADD COLUMN `team` VARCHAR(100) NULL DEFAULT NULL AFTER `user`,
+  ADD INDEX (`user`, `created_at`),
+  ADD INDEX (`team`, `created_at`);
+
+CREATE TABLE IF NOT EXISTS `quotas` (
+  `scope`        VARBINARY(10)  NOT NULL,
+  `name`         VARBINARY(100) NOT NULL,
+  `max_running`  INT UNSIGNED   NOT NULL DEFAULT 0,
+  `max_daily`    INT UNSIGNED   NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`scope`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS `jr_upgrades` (
+  `upgrade_id`      BINARY(20)    NOT NULL,
+  `jr_urls`         BLOB          NOT NULL,
+  `current`         INT UNSIGNED  NOT NULL DEFAULT 0,
+  `step`            VARBINARY(10) NOT NULL,
+  `step_started_at` TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  `drain_timeout`   VARBINARY(20) NOT NULL,
+  `health_timeout`  VARBINARY(20) NOT NULL,
+  `error`           TEXT              NULL DEFAULT NULL,
+  `created_at`      TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+  PRIMARY KEY (`upgrade_id`),
+  INDEX (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
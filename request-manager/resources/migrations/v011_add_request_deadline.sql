@@ -0,0 +1,2 @@
+ALTER TABLE `requests`
+  ADD COLUMN `deadline` TIMESTAMP(6) NULL DEFAULT NULL AFTER `cost`;
@@ -0,0 +1,2 @@
+ALTER TABLE `request_archives`
+  ADD COLUMN `warnings` BLOB NULL DEFAULT NULL AFTER `job_chain`;
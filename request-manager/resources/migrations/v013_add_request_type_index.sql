@@ -0,0 +1,2 @@
+ALTER TABLE `requests`
+  ADD INDEX (`type`, `finished_at`);
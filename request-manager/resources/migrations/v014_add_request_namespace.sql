@@ -0,0 +1,3 @@
+ALTER TABLE `requests`
+  ADD COLUMN `namespace` VARCHAR(100) NULL DEFAULT NULL AFTER `team`,
+  ADD INDEX (`namespace`, `created_at`);
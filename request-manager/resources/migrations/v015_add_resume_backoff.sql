@@ -0,0 +1,6 @@
+ALTER TABLE `requests`
+  ADD COLUMN `resume_error` VARCHAR(2000) NULL DEFAULT NULL AFTER `deadline`;
+
+ALTER TABLE `suspended_job_chains`
+  ADD COLUMN `resume_attempts` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `suspended_at`,
+  ADD COLUMN `resume_after` TIMESTAMP(6) NULL DEFAULT NULL AFTER `resume_attempts`;
@@ -0,0 +1,2 @@
+ALTER TABLE `request_archives`
+  ADD COLUMN `arg_overrides` BLOB NULL DEFAULT NULL AFTER `warnings`;
@@ -0,0 +1,5 @@
+ALTER TABLE `requests`
+  ADD COLUMN `correlation_id` VARCHAR(128) NULL DEFAULT NULL AFTER `resume_error`,
+  ADD INDEX (`correlation_id`);
+ALTER TABLE `request_archives`
+  ADD COLUMN `origin` BLOB NULL DEFAULT NULL AFTER `arg_overrides`;
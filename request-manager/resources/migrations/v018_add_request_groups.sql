@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS `request_groups` (
+  `group_id`   BINARY(20)    NOT NULL,
+  `name`       VARCHAR(255)  NOT NULL,
+  `user`       VARCHAR(100)      NULL DEFAULT NULL,
+  `created_at` TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+  PRIMARY KEY (`group_id`),
+  INDEX (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+ALTER TABLE `requests`
+  ADD COLUMN `group_id` BINARY(20) NULL DEFAULT NULL AFTER `correlation_id`,
+  ADD INDEX (`group_id`);
@@ -0,0 +1,2 @@
+ALTER TABLE `requests`
+  ADD COLUMN `fence_token` BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER `group_id`;
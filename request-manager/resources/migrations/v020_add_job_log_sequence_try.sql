@@ -0,0 +1,2 @@
+ALTER TABLE `job_log`
+  ADD COLUMN `sequence_try` SMALLINT NOT NULL DEFAULT 0 AFTER `try`;
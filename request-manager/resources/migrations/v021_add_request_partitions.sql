@@ -0,0 +1,4 @@
+ALTER TABLE `requests`
+  ADD COLUMN `partitions` SMALLINT UNSIGNED NOT NULL DEFAULT 0 AFTER `fence_token`,
+  ADD COLUMN `partition_of` BINARY(20) NULL DEFAULT NULL AFTER `partitions`,
+  ADD INDEX (`partition_of`);
@@ -0,0 +1,2 @@
+ALTER TABLE `job_log`
+  ADD COLUMN `queue_delay` BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER `finished_at`;
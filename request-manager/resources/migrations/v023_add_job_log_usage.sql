@@ -0,0 +1,3 @@
+ALTER TABLE `job_log`
+  ADD COLUMN `cpu_time` BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER `queue_delay`,
+  ADD COLUMN `max_memory` BIGINT UNSIGNED NOT NULL DEFAULT 0 AFTER `cpu_time`;
@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS `request_audit` (
+  `request_id` BINARY(20)       NOT NULL,
+  `action`     VARBINARY(32)    NOT NULL,
+  `user`       VARCHAR(100)         NULL DEFAULT NULL,
+  `reason`     VARCHAR(2000)    NOT NULL,
+  `from_state` TINYINT UNSIGNED NOT NULL,
+  `to_state`   TINYINT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP(6)     NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+  PRIMARY KEY (`request_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
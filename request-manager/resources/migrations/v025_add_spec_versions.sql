@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS `spec_versions` (
+  `version`   VARCHAR(64)   NOT NULL,
+  `loaded_at` TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6), -- last time a Request Manager loaded this version
+
+  PRIMARY KEY (`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
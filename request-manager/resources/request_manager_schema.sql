@@ -7,17 +7,37 @@ CREATE TABLE IF NOT EXISTS `requests` (
   `type`           VARBINARY(75)    NOT NULL,
   `state`          TINYINT UNSIGNED NOT NULL DEFAULT 0,
   `user`           VARCHAR(100)         NULL DEFAULT NULL,
+  `team`           VARCHAR(100)         NULL DEFAULT NULL,
+  `namespace`      VARCHAR(100)         NULL DEFAULT NULL, -- spec namespace of the request type
   `created_at`     TIMESTAMP(6)     NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
   `started_at`     TIMESTAMP(6)         NULL DEFAULT NULL,
   `finished_at`    TIMESTAMP(6)         NULL DEFAULT NULL,
   `total_jobs`     INT UNSIGNED     NOT NULL DEFAULT 0,
   `finished_jobs`  INT UNSIGNED     NOT NULL DEFAULT 0,
   `jr_url`         VARCHAR(2000)        NULL DEFAULT NULL,
+  `spec_version`   VARCHAR(64)          NULL DEFAULT NULL,
+  `retry_of`       BINARY(20)           NULL DEFAULT NULL, -- failed request that this request retries (auto or manual)
+  `retry_count`    TINYINT UNSIGNED NOT NULL DEFAULT 0,
+  `cost`           INT UNSIGNED     NOT NULL DEFAULT 0, -- sum of job costs (spec node cost)
+  `deadline`       TIMESTAMP(6)         NULL DEFAULT NULL, -- proto.CreateRequest.Deadline
+  `resume_error`   VARCHAR(2000)        NULL DEFAULT NULL, -- why the request is FAILED_RESUME
+  `correlation_id` VARCHAR(128)         NULL DEFAULT NULL, -- proto.CreateRequest.CorrelationId
+  `group_id`       BINARY(20)           NULL DEFAULT NULL, -- request_groups.group_id
+  `fence_token`    BIGINT UNSIGNED  NOT NULL DEFAULT 0, -- latest proto.JobChain.FenceToken issued
+  `partitions`     SMALLINT UNSIGNED NOT NULL DEFAULT 0, -- number of partition requests (proto.Request.Partitions)
+  `partition_of`   BINARY(20)           NULL DEFAULT NULL, -- request that this partition request is part of
 
   PRIMARY KEY (`request_id`),
   INDEX (`created_at`),         -- recently created
   INDEX (`finished_at`),        -- recently finished
-  INDEX (`state`, `created_at`) -- currently running
+  INDEX (`state`, `created_at`), -- currently running
+  INDEX (`user`, `created_at`),  -- user quotas
+  INDEX (`team`, `created_at`),  -- team quotas
+  INDEX (`type`, `finished_at`), -- request history
+  INDEX (`namespace`, `created_at`), -- namespace quotas and filtering
+  INDEX (`correlation_id`),          -- find requests by correlation ID
+  INDEX (`group_id`),                -- requests in a request group
+  INDEX (`partition_of`)             -- partition requests of a request
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
 CREATE TABLE IF NOT EXISTS `request_archives` (
@@ -25,20 +45,85 @@ CREATE TABLE IF NOT EXISTS `request_archives` (
   `create_request`  BLOB       NOT NULL, -- proto.CreateRequest from caller
   `args`            BLOB       NOT NULL, -- finalized request args
   `job_chain`       LONGBLOB   NOT NULL, -- proto.JobChain
+  `warnings`        BLOB           NULL DEFAULT NULL, -- build warnings (proto.Request.Warnings)
+  `arg_overrides`   BLOB           NULL DEFAULT NULL, -- args changed by a manual retry (proto.Request.ArgOverrides)
+  `origin`          BLOB           NULL DEFAULT NULL, -- caller system metadata (proto.Request.Origin)
 
   PRIMARY KEY (`request_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
 
+CREATE TABLE IF NOT EXISTS `request_args` (
+  `request_id`  BINARY(20)     NOT NULL,
+  `name`        VARBINARY(100) NOT NULL,
+  `value`       VARBINARY(255) NOT NULL, -- proto.RequestArg.Value as string, truncated
+
+  PRIMARY KEY (`request_id`, `name`),
+  INDEX (`name`, `value`) -- find requests by arg value
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `quotas` (
+  `scope`        VARBINARY(10)  NOT NULL, -- proto.QUOTA_SCOPE_*
+  `name`         VARBINARY(100) NOT NULL, -- user, team, or namespace name, empty for default
+  `max_running`  INT UNSIGNED   NOT NULL DEFAULT 0,
+  `max_daily`    INT UNSIGNED   NOT NULL DEFAULT 0,
+
+  PRIMARY KEY (`scope`, `name`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `jr_upgrades` (
+  `upgrade_id`      BINARY(20)    NOT NULL,
+  `jr_urls`         BLOB          NOT NULL, -- JSON []string, upgraded in order
+  `current`         INT UNSIGNED  NOT NULL DEFAULT 0, -- index of jr_urls
+  `step`            VARBINARY(10) NOT NULL, -- proto.UPGRADE_STEP_*
+  `step_started_at` TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  `drain_timeout`   VARBINARY(20) NOT NULL,
+  `health_timeout`  VARBINARY(20) NOT NULL,
+  `error`           TEXT              NULL DEFAULT NULL,
+  `created_at`      TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+  PRIMARY KEY (`upgrade_id`),
+  INDEX (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `request_groups` (
+  `group_id`   BINARY(20)    NOT NULL,
+  `name`       VARCHAR(255)  NOT NULL, -- proto.CreateRequestGroup.Name
+  `user`       VARCHAR(100)      NULL DEFAULT NULL,
+  `created_at` TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+  PRIMARY KEY (`group_id`),
+  INDEX (`created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `request_audit` (
+  `request_id` BINARY(20)       NOT NULL,
+  `action`     VARBINARY(32)    NOT NULL, -- proto.AUDIT_ACTION_*
+  `user`       VARCHAR(100)         NULL DEFAULT NULL, -- caller who made the change
+  `reason`     VARCHAR(2000)    NOT NULL,
+  `from_state` TINYINT UNSIGNED NOT NULL,
+  `to_state`   TINYINT UNSIGNED NOT NULL,
+  `created_at` TIMESTAMP(6)     NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+
+  PRIMARY KEY (`request_id`, `created_at`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
 CREATE TABLE IF NOT EXISTS `job_log` (
   `request_id`    BINARY(20)       NOT NULL,
   `job_id`        BINARY(4)        NOT NULL,
   `name`          VARBINARY(100)   NOT NULL,
   `try`           SMALLINT         NOT NULL DEFAULT 0,
+  `sequence_try`  SMALLINT         NOT NULL DEFAULT 0,
   `type`          VARBINARY(75)    NOT NULL,
   `state`         TINYINT UNSIGNED NOT NULL DEFAULT 0,
   `started_at`    BIGINT UNSIGNED  NOT NULL DEFAULT 0, -- Unix time (nanoseconds)
   `finished_at`   BIGINT UNSIGNED  NOT NULL DEFAULT 0, -- Unix time (nanoseconds)
+  `queue_delay`   BIGINT UNSIGNED  NOT NULL DEFAULT 0, -- nanoseconds runnable before started
+  `cpu_time`      BIGINT UNSIGNED  NOT NULL DEFAULT 0, -- nanoseconds
+  `max_memory`    BIGINT UNSIGNED  NOT NULL DEFAULT 0, -- bytes
   `error`         TEXT                 NULL DEFAULT NULL,
+  `error_category` VARCHAR(64)         NULL DEFAULT NULL,
+  `error_code`    VARCHAR(64)          NULL DEFAULT NULL,
+  `error_retryable` TINYINT(1)     NOT NULL DEFAULT 0,
   `exit`          TINYINT UNSIGNED     NULL DEFAULT NULL,
   `stdout`        LONGBLOB             NULL DEFAULT NULL,
   `stderr`        LONGBLOB             NULL DEFAULT NULL,
@@ -52,6 +137,15 @@ CREATE TABLE IF NOT EXISTS `suspended_job_chains` (
   `rm_host`             VARCHAR(64)       NULL DEFAULT NULL,
   `updated_at`          TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6) ON UPDATE CURRENT_TIMESTAMP(6),
   `suspended_at`        TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6),
+  `resume_attempts`     INT UNSIGNED  NOT NULL DEFAULT 0, -- failed attempts to resume
+  `resume_after`        TIMESTAMP(6)      NULL DEFAULT NULL, -- backoff: not resumed before this time
 
   PRIMARY KEY (`request_id`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
+
+CREATE TABLE IF NOT EXISTS `spec_versions` (
+  `version`   VARCHAR(64)   NOT NULL,
+  `loaded_at` TIMESTAMP(6)  NOT NULL DEFAULT CURRENT_TIMESTAMP(6), -- last time a Request Manager loaded this version
+
+  PRIMARY KEY (`version`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4;
@@ -6,25 +6,39 @@ package server
 import (
 	"encoding/json"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strings"
 	"sync"
 	"syscall"
 	"time"
 
 	log "github.com/sirupsen/logrus"
 
+	"github.com/square/spincycle/v2/argcrypt"
 	"github.com/square/spincycle/v2/config"
+	"github.com/square/spincycle/v2/job/poll"
 	"github.com/square/spincycle/v2/jobs"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/accesslog"
 	"github.com/square/spincycle/v2/request-manager/api"
 	"github.com/square/spincycle/v2/request-manager/app"
 	"github.com/square/spincycle/v2/request-manager/auth"
 	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/group"
 	"github.com/square/spincycle/v2/request-manager/id"
 	"github.com/square/spincycle/v2/request-manager/joblog"
+	"github.com/square/spincycle/v2/request-manager/placement"
+	"github.com/square/spincycle/v2/request-manager/quota"
+	"github.com/square/spincycle/v2/request-manager/reconcile"
+	"github.com/square/spincycle/v2/request-manager/replica"
 	"github.com/square/spincycle/v2/request-manager/request"
+	"github.com/square/spincycle/v2/request-manager/slo"
 	"github.com/square/spincycle/v2/request-manager/spec"
 	"github.com/square/spincycle/v2/request-manager/status"
+	"github.com/square/spincycle/v2/request-manager/upgrade"
+	"github.com/square/spincycle/v2/request-manager/writebuf"
 )
 
 var (
@@ -39,27 +53,44 @@ type Server struct {
 	appCtx app.Context
 	api    *api.API
 
-	shutdownChan   chan struct{}
-	resumerStopped chan struct{}
-	apiStopped     chan struct{}
-	stopped        bool
-	stopMux        sync.Mutex
+	// Reconciler and how often it's run, nil if disabled (config.Reconcile.Interval)
+	reconciler        reconcile.Reconciler
+	reconcileInterval time.Duration
+
+	// How often SLOs are checked for burn alerts, zero if disabled (config.SLO.Interval)
+	sloInterval time.Duration
+
+	// How often read replica lag is checked, zero if disabled (config.ReadReplica)
+	replicaInterval time.Duration
+
+	shutdownChan      chan struct{}
+	resumerStopped    chan struct{}
+	reconcilerStopped chan struct{}
+	sloStopped        chan struct{}
+	replicaStopped    chan struct{}
+	apiStopped        chan struct{}
+	stopped           bool
+	stopMux           sync.Mutex
 }
 
 func NewServer(appCtx app.Context) *Server {
 	return &Server{
-		appCtx:         appCtx,
-		resumerStopped: make(chan struct{}),
-		apiStopped:     make(chan struct{}),
-		shutdownChan:   make(chan struct{}),
-		stopMux:        sync.Mutex{},
+		appCtx:            appCtx,
+		resumerStopped:    make(chan struct{}),
+		reconcilerStopped: make(chan struct{}),
+		sloStopped:        make(chan struct{}),
+		replicaStopped:    make(chan struct{}),
+		apiStopped:        make(chan struct{}),
+		shutdownChan:      make(chan struct{}),
+		stopMux:           sync.Mutex{},
 	}
 }
 
-// Run runs the Request Manager API and Request Resumer. It returns when the API
-// stops running (either from an error, or after a call to Stop). If a custom RunAPI
-// hook has been provided, it will be called to run the API instead of the default
-// api.Run.
+// Run runs the Request Manager API, Request Resumer, reconciler (if enabled), SLO
+// checks (if enabled), and read replica lag checks (if enabled).
+// It returns when the API stops running (either from an error, or after a call to
+// Stop). If a custom RunAPI hook has been provided, it will be called to run the
+// API instead of the default api.Run.
 //
 // If stopOnSignal = true, the server will listen for TERM and INT signals from the
 // OS and call Stop to shut itself down when those signals are received. Else, the
@@ -92,6 +123,66 @@ func (s *Server) Run(stopOnSignal bool) error {
 		ticker.Stop()
 	}()
 
+	// Run the reconciler in another goroutine, if enabled, to fail or suspend
+	// running requests lost by Job Runners that crashed
+	go func() {
+		defer close(s.reconcilerStopped)
+		if s.reconciler == nil {
+			return
+		}
+		ticker := time.NewTicker(s.reconcileInterval)
+	RECONCILER:
+		for {
+			select {
+			case <-s.shutdownChan:
+				break RECONCILER
+			case <-ticker.C:
+				s.reconciler.Reconcile()
+			}
+		}
+		ticker.Stop()
+	}()
+
+	// Check SLOs in another goroutine, if enabled, to alert when they start or
+	// stop burning
+	go func() {
+		defer close(s.sloStopped)
+		if s.sloInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(s.sloInterval)
+	SLO:
+		for {
+			select {
+			case <-s.shutdownChan:
+				break SLO
+			case <-ticker.C:
+				s.appCtx.SLO.Check()
+			}
+		}
+		ticker.Stop()
+	}()
+
+	// Check read replica lag in another goroutine, if enabled, so heavy reads
+	// use the primary while the replica lags too much
+	go func() {
+		defer close(s.replicaStopped)
+		if s.replicaInterval <= 0 {
+			return
+		}
+		ticker := time.NewTicker(s.replicaInterval)
+	REPLICA:
+		for {
+			select {
+			case <-s.shutdownChan:
+				break REPLICA
+			case <-ticker.C:
+				s.appCtx.Replica.Check()
+			}
+		}
+		ticker.Stop()
+	}()
+
 	// If stopOnSignal = true, watch for TERM + INT signals from the OS and shut
 	// down the Request Manager when we receive them.
 	if stopOnSignal {
@@ -113,6 +204,9 @@ func (s *Server) Run(stopOnSignal bool) error {
 	if s.stopped {
 		<-s.apiStopped
 		<-s.resumerStopped
+		<-s.reconcilerStopped
+		<-s.sloStopped
+		<-s.replicaStopped
 	}
 
 	if err != nil {
@@ -121,10 +215,11 @@ func (s *Server) Run(stopOnSignal bool) error {
 	return nil
 }
 
-// Stop stops the running Request Resumer and API. It signals the resumer to shut
-// down and then stops the API (using either the default api.Stop or the StopAPI
-// hook if provided). Once Stop has been called, the server cannot be reused -
-// future calls to Run will return an error.
+// Stop stops the running Request Resumer, background workers, and API. It signals
+// them to shut down, stops the API (using either the default api.Stop or the
+// StopAPI hook if provided), flushes the access log and write buffer, and waits
+// for the resumer and background workers to stop. Once Stop has been called,
+// the server cannot be reused - future calls to Run will return an error.
 //
 // If stopOnSignal was set when calling Run, Stop will automatically be called by
 // the server on receiving a TERM or INT signal from the OS. Otherwise, you must
@@ -142,11 +237,15 @@ func (s *Server) Stop() error {
 
 	log.Infof("Stopping Request Manager server")
 
-	// Stops the request resumer loop. The API will also begin refusing to start
-	// running new requests.
+	// Stops the request resumer loop. The API will also begin refusing to create
+	// and start new requests.
 	close(s.shutdownChan)
 
 	// Stop the API, using the StopAPI hook if provided and api.Stop otherwise.
+	// api.Stop drains the API: it stops accepting new connections and waits
+	// (up to api.ShutdownTimeout) for in-flight requests to finish, so requests
+	// being created or started aren't cut off mid-write.
+	log.Infof("Stopping API")
 	var err error
 	if s.appCtx.Hooks.StopAPI != nil {
 		err = s.appCtx.Hooks.StopAPI()
@@ -154,9 +253,28 @@ func (s *Server) Stop() error {
 		err = s.api.Stop()
 	}
 	close(s.apiStopped) // indicate to Run that the API is done shutting down
+	log.Infof("API stopped")
+
+	// Send remaining access log entries to the sink, if any
+	if s.appCtx.AccessLog != nil {
+		s.appCtx.AccessLog.Stop()
+	}
+
+	// Retry queued job logs and progress, if any, once more before they're lost
+	if s.appCtx.WriteBuffer != nil {
+		s.appCtx.WriteBuffer.Stop()
+	}
 
-	// Wait to return until the resumer has been stopped.
+	// Wait to return until the background workers have been stopped. Each
+	// finishes its current run, if any: the resumer finishes resuming the
+	// current SJC, but not the rest.
+	log.Infof("Waiting for request resumer to stop")
 	<-s.resumerStopped
+	log.Infof("Waiting for reconciler, SLO checks, and replica checks to stop")
+	<-s.reconcilerStopped
+	<-s.sloStopped
+	<-s.replicaStopped
+	log.Infof("Request Manager server stopped")
 
 	if err != nil {
 		return fmt.Errorf("error stopping API: %s", err)
@@ -177,21 +295,45 @@ func (s *Server) Boot() error {
 	cfg.Server.TLS.KeyFile = config.Env("SPINCYCLE_SERVER_TLS_KEY_FILE", cfg.Server.TLS.KeyFile)
 	cfg.Server.TLS.CAFile = config.Env("SPINCYCLE_SERVER_TLS_CA_FILE", cfg.Server.TLS.CAFile)
 	cfg.MySQL.DSN = config.Env("SPINCYCLE_MYSQL_DSN", cfg.MySQL.DSN)
+	cfg.ReadReplica.DSN = config.Env("SPINCYCLE_READ_REPLICA_DSN", cfg.ReadReplica.DSN)
 	cfg.Specs.Dir = config.Env("SPINCYCLE_SPECS_DIR", cfg.Specs.Dir)
+	cfg.Specs.Version = config.Env("SPINCYCLE_SPECS_VERSION", cfg.Specs.Version)
+	cfg.Specs.Env = config.Env("SPINCYCLE_SPECS_ENV", cfg.Specs.Env)
+	cfg.Specs.TemplateCacheDir = config.Env("SPINCYCLE_SPECS_TEMPLATE_CACHE_DIR", cfg.Specs.TemplateCacheDir)
 	cfg.JRClient.ServerURL = config.Env("SPINCYCLE_JR_CLIENT_URL", cfg.JRClient.ServerURL)
 	cfg.JRClient.TLS.CertFile = config.Env("SPINCYCLE_JR_CLIENT_TLS_CERT_FILE", cfg.JRClient.TLS.CertFile)
 	cfg.JRClient.TLS.KeyFile = config.Env("SPINCYCLE_JR_CLIENT_TLS_KEY_FILE", cfg.JRClient.TLS.KeyFile)
 	cfg.JRClient.TLS.CAFile = config.Env("SPINCYCLE_JR_CLIENT_TLS_CA_FILE", cfg.JRClient.TLS.CAFile)
+	cfg.ReadOnly.Enabled = config.Env("SPINCYCLE_READ_ONLY_ENABLED", fmt.Sprintf("%t", cfg.ReadOnly.Enabled)) == "true"
+	cfg.ReadOnly.Reason = config.Env("SPINCYCLE_READ_ONLY_REASON", cfg.ReadOnly.Reason)
+	cfg.StatusPush.StaleAfter = config.Env("SPINCYCLE_STATUS_PUSH_STALE_AFTER", cfg.StatusPush.StaleAfter)
+	cfg.Reconcile.TakeoverURL = config.Env("SPINCYCLE_RECONCILE_TAKEOVER_URL", cfg.Reconcile.TakeoverURL)
+	cfg.ArgEncryption.KeyFile = config.Env("SPINCYCLE_ARG_ENCRYPTION_KEY_FILE", cfg.ArgEncryption.KeyFile)
+	cfg.ArgEncryption.CurrentKey = config.Env("SPINCYCLE_ARG_ENCRYPTION_CURRENT_KEY", cfg.ArgEncryption.CurrentKey)
 	s.appCtx.Config = cfg
+	if cfg.JobChainSchemaVersion != nil {
+		if err := proto.SetEncodeSchemaVersion(*cfg.JobChainSchemaVersion); err != nil {
+			return fmt.Errorf("invalid job_chain_schema_version: %s", err)
+		}
+	}
+	if cfg.JobChainFormat != "" {
+		if err := proto.SetChainFormat(cfg.JobChainFormat); err != nil {
+			return fmt.Errorf("invalid job_chain_format: %s", err)
+		}
+	}
 	cfgstr, _ := json.MarshalIndent(cfg, "", "  ")
 	log.Printf("Config: %s", cfgstr)
+	if cfg.ReadOnly.Enabled {
+		log.Printf("Read-only mode enabled: %s", cfg.ReadOnly.Reason)
+	}
 
 	// Load and check requests specification files (specs)
 	specs, fileResults, err := s.appCtx.Hooks.LoadSpecs(s.appCtx)
 	if err != nil {
 		return fmt.Errorf("LoadSpecs: %s", err)
 	}
-	for file, result := range fileResults.Results {
+	for _, file := range fileResults.Keys() {
+		result := fileResults.Results[file]
 		for _, warn := range result.Warnings {
 			log.Errorf("Warning: %s: %s", file, warn)
 		}
@@ -205,7 +347,16 @@ func (s *Server) Boot() error {
 	if len(specs.Sequences) == 0 {
 		log.Errorf("Warning: no specs found in directory")
 	}
+	if cfg.Specs.Env != "" {
+		log.Infof("Spec environment: %s", cfg.Specs.Env)
+		spec.ApplyEnv(specs, cfg.Specs.Env)
+	}
 	spec.ProcessSpecs(&specs)
+	spec.SetNamespaces(specs, cfg.Specs.Namespaces)
+	if cfg.Specs.Version != "" {
+		specs.Version = cfg.Specs.Version
+	}
+	log.Infof("Spec version: %s", specs.Version)
 	s.appCtx.Specs = specs
 
 	checkFactories := []spec.CheckFactory{spec.DefaultCheckFactory{specs}, spec.BaseCheckFactory{specs}}
@@ -219,30 +370,71 @@ func (s *Server) Boot() error {
 			log.Errorf("Error: %s: %s", seq, err)
 		}
 	}
-	if staticResults.AnyError {
+	if staticResults.AnyError && !cfg.Specs.AllowErrors {
 		return fmt.Errorf("Static check(s) on request specification files failed; see log or run spinc-linter for details")
 	}
 
+	// The spec report has all results so operators don't have to find them in
+	// the log (GET /api/v1/spec-report). With specs.allow_errors, sequences with
+	// errors, and every sequence that calls them, are not graphed: their request
+	// types are unbuildable.
+	seqResults := spec.NewCheckResults()
+	seqResults.Union(staticResults)
+	spec.PropagateErrors(specs.Sequences, seqResults)
+
 	// Generator factory used to generate IDs for nodes in sequence graphs and jobs in job chains
 	gf := id.NewGeneratorFactory(4, 100)
 
-	// Do graph checks and get sequence graphs
-	tg := graph.NewGrapher(specs, gf)
-	seqGraphs, graphResults := tg.CheckSequences()
-	for seq, result := range graphResults.Results {
-		for _, warn := range result.Warnings {
-			log.Errorf("Warning: %s: %s", seq, warn)
+	// Do graph checks and get sequence graphs, unless they're cached for the
+	// same specs. Only graphs that passed all checks are cached.
+	templateVersion := graph.TemplateVersion(specs.Sequences)
+	templateCache := graph.NewTemplateCache(cfg.Specs.TemplateCacheDir)
+	seqGraphs, cached := templateCache.Get(templateVersion)
+	if cached {
+		log.Infof("Template version: %s (%d sequence graphs loaded from cache)", templateVersion, len(seqGraphs))
+	} else {
+		graphSpecs := buildableSpecs(specs, seqResults)
+		tg := graph.NewGrapher(graphSpecs, gf)
+		var graphResults *spec.CheckResults
+		seqGraphs, graphResults = tg.CheckSequences()
+		for seq, result := range graphResults.Results {
+			for _, warn := range result.Warnings {
+				log.Errorf("Warning: %s: %s", seq, warn)
+			}
+			for _, err := range result.Errors {
+				log.Errorf("Error: %s: %s", seq, err)
+			}
 		}
-		for _, err := range result.Errors {
-			log.Errorf("Error: %s: %s", seq, err)
+		seqResults.Union(graphResults)
+		if graphResults.AnyError {
+			if !cfg.Specs.AllowErrors {
+				return fmt.Errorf("Graph check(s) on request specification files failed; see log or run spinc-linter for details")
+			}
+			// Graph checks add errors to sequences that call sequences with
+			// errors, so graph again without them. It should not fail again.
+			graphSpecs = buildableSpecs(specs, seqResults)
+			seqGraphs, graphResults = graph.NewGrapher(graphSpecs, gf).CheckSequences()
+			if graphResults.AnyError {
+				return fmt.Errorf("Graph check(s) on request specification files failed on buildable sequences; see log or run spinc-linter for details")
+			}
+		}
+		if !seqResults.AnyError {
+			if err := templateCache.Put(templateVersion, seqGraphs); err != nil {
+				log.Errorf("Error caching sequence graphs in specs.template_cache_dir %s: %s", cfg.Specs.TemplateCacheDir, err)
+			}
 		}
+		log.Infof("Template version: %s (%d sequence graphs built)", templateVersion, len(seqGraphs))
 	}
-	if graphResults.AnyError {
-		return fmt.Errorf("Graph check(s) on request specification files failed; see log or run spinc-linter for details")
+
+	s.appCtx.SpecReport = spec.NewReport(specs, fileResults, seqResults)
+	s.appCtx.SpecReport.TemplateVersion = templateVersion
+	if len(s.appCtx.SpecReport.Unbuildable) > 0 {
+		log.Errorf("Unbuildable request types (spec errors): %s", strings.Join(s.appCtx.SpecReport.Unbuildable, ", "))
 	}
 
-	// Resolver Factory: creates Resolvers, which resolve sequence graphs into request graphs
-	resolverFactory := graph.NewResolverFactory(jobs.Factory, specs.Sequences, seqGraphs, gf)
+	// Resolver Factory: creates Resolvers, which resolve sequence graphs into request graphs.
+	// Built-in poll jobs are made by the poll factory, all other jobs by jobs.Factory.
+	resolverFactory := graph.NewResolverFactory(poll.NewFactory(jobs.Factory), specs.Sequences, seqGraphs, gf)
 
 	// Job Runner Client: how the Request Manager talks to Job Runners
 	jrClient, err := s.appCtx.Factories.MakeJobRunnerClient(s.appCtx)
@@ -256,14 +448,91 @@ func (s *Server) Boot() error {
 		return fmt.Errorf("MakeDbConnPool: %s", err)
 	}
 
+	// Request state machine: validates and records request state changes made
+	// by the Request Manager and Resumer
+	stateMachine := &request.StateMachine{
+		OnTransition: s.appCtx.Hooks.RequestStateChanged,
+	}
+
+	// Chain build pool: limit concurrent job chain builds (memory)
+	buildPool := request.NewBuildPool(request.BuildPoolConfig{
+		Workers:      cfg.ChainBuild.Workers,
+		MaxQueued:    cfg.ChainBuild.MaxQueued,
+		MaxMemory:    int64(cfg.ChainBuild.MaxMemoryMB) * 1024 * 1024,
+		MaxChainSize: int64(cfg.ChainBuild.MaxChainMB) * 1024 * 1024,
+	})
+
+	// Status: figure out request status using db and Job Runners (real-time),
+	// either status pushed by Job Runners or polling them
+	var statusStaleAfter time.Duration
+	if cfg.StatusPush.StaleAfter != "" {
+		statusStaleAfter, err = time.ParseDuration(cfg.StatusPush.StaleAfter)
+		if err != nil {
+			return fmt.Errorf("invalid status_push.stale_after %s: %s", cfg.StatusPush.StaleAfter, err)
+		}
+	}
+	s.appCtx.Status = status.NewManager(dbConnector, jrClient, statusStaleAfter)
+
+	// Bulk creates: the API parses start_interval, so validate it here
+	if cfg.BulkCreate.StartInterval != "" {
+		if _, err := time.ParseDuration(cfg.BulkCreate.StartInterval); err != nil {
+			return fmt.Errorf("invalid bulk_create.start_interval %s: %s", cfg.BulkCreate.StartInterval, err)
+		}
+	}
+
+	// Placement policies: built-in and custom, which choose the Job Runner for
+	// request types with a placement policy in their spec
+	policies := placement.BuiltIn()
+	for name, policy := range s.appCtx.Plugins.Placement {
+		policies[name] = policy
+	}
+	for name, seq := range specs.Sequences {
+		if seq.Placement == nil {
+			continue
+		}
+		if _, ok := policies[seq.Placement.Policy]; !ok {
+			return fmt.Errorf("request %s: placement policy %s not found: not built-in or in App.Context.Plugins.Placement", name, seq.Placement.Policy)
+		}
+	}
+
+	// Arg key provider: encrypts the values of sensitive args when requests are
+	// created, nil if arg encryption is disabled. The factory is nil in custom
+	// app contexts that predate it.
+	var argKeys argcrypt.KeyProvider
+	if s.appCtx.Factories.MakeArgKeyProvider != nil {
+		argKeys, err = s.appCtx.Factories.MakeArgKeyProvider(s.appCtx)
+		if err != nil {
+			return fmt.Errorf("MakeArgKeyProvider: %s", err)
+		}
+	}
+	if argKeys != nil {
+		id, _, err := argKeys.CurrentKey()
+		if err != nil {
+			return fmt.Errorf("arg key provider has no current key: %s", err)
+		}
+		log.Infof("Arg encryption enabled: encrypting sensitive args with key %s", id)
+	}
+
 	// Request Manager: core logic and coordination
 	managerConfig := request.ManagerConfig{
 		ResolverFactory: resolverFactory,
 		Sequences:       specs.Sequences,
+		SpecVersion:     specs.Version,
+		TemplateVersion: templateVersion,
+		ResolverPlugin:  s.appCtx.Plugins.Resolver,
 		DBConnector:     dbConnector,
 		JRClient:        jrClient,
 		DefaultJRURL:    s.appCtx.Config.JRClient.ServerURL,
 		ShutdownChan:    s.shutdownChan,
+		StateMachine:    stateMachine,
+		BuildPool:       buildPool,
+		Placement:       policies,
+		JobRunners:      s.appCtx.Status.JobRunners,
+		Unbuildable:     map[string][]string{},
+		ArgKeys:         argKeys,
+	}
+	for _, reqType := range s.appCtx.SpecReport.Unbuildable {
+		managerConfig.Unbuildable[reqType] = s.appCtx.SpecReport.Sequences[reqType].Errors
 	}
 	s.appCtx.RM = request.NewManager(managerConfig)
 
@@ -272,6 +541,26 @@ func (s *Server) Boot() error {
 	if err != nil {
 		return fmt.Errorf("error getting hostname: %s", err)
 	}
+	var specVersions *request.SpecVersions
+	if cfg.Specs.KeepVersions > 0 {
+		specVersions = request.NewSpecVersions(dbConnector, cfg.Specs.KeepVersions)
+		if err := specVersions.Load(specs.Version); err != nil {
+			return err
+		}
+	}
+	var resumeBackoff, resumeMaxBackoff time.Duration
+	if cfg.Resume.Backoff != "" {
+		resumeBackoff, err = time.ParseDuration(cfg.Resume.Backoff)
+		if err != nil {
+			return fmt.Errorf("invalid resume.backoff %s: %s", cfg.Resume.Backoff, err)
+		}
+	}
+	if cfg.Resume.MaxBackoff != "" {
+		resumeMaxBackoff, err = time.ParseDuration(cfg.Resume.MaxBackoff)
+		if err != nil {
+			return fmt.Errorf("invalid resume.max_backoff %s: %s", cfg.Resume.MaxBackoff, err)
+		}
+	}
 	resumerConfig := request.ResumerConfig{
 		RequestManager:       s.appCtx.RM,
 		DBConnector:          dbConnector,
@@ -280,19 +569,146 @@ func (s *Server) Boot() error {
 		RMHost:               hostname,
 		ShutdownChan:         s.shutdownChan,
 		SuspendedJobChainTTL: SJCTTL,
+		Backoff:              resumeBackoff,
+		MaxBackoff:           resumeMaxBackoff,
+		MaxAttempts:          cfg.Resume.MaxAttempts,
+		SpecVersions:         specVersions,
+		StateMachine:         stateMachine,
 	}
 	s.appCtx.RR = request.NewResumer(resumerConfig)
 
-	// Status: figure out request status using db and Job Runners (real-time)
-	s.appCtx.Status = status.NewManager(dbConnector, jrClient)
-
 	// Job log store: save job log entries (JLE) from Job Runners
-	s.appCtx.JLS = joblog.NewStore(dbConnector)
+	s.appCtx.JLS = joblog.NewStore(dbConnector, cfg.Limits)
+
+	// Read replica: heavy read-only endpoints read requests and job logs from it
+	// while its lag is at most max_lag. Everything else uses the primary.
+	if cfg.ReadReplica.DSN != "" {
+		var maxLag time.Duration
+		if cfg.ReadReplica.MaxLag != "" {
+			maxLag, err = time.ParseDuration(cfg.ReadReplica.MaxLag)
+			if err != nil {
+				return fmt.Errorf("invalid read_replica.max_lag %s: %s", cfg.ReadReplica.MaxLag, err)
+			}
+		}
+		if cfg.ReadReplica.CheckInterval != "" {
+			s.replicaInterval, err = time.ParseDuration(cfg.ReadReplica.CheckInterval)
+			if err != nil {
+				return fmt.Errorf("invalid read_replica.check_interval %s: %s", cfg.ReadReplica.CheckInterval, err)
+			}
+		}
+		if s.replicaInterval <= 0 {
+			return fmt.Errorf("invalid read_replica.check_interval %s: must be greater than zero", cfg.ReadReplica.CheckInterval)
+		}
+		replicaDB, err := s.appCtx.Factories.MakeReplicaDbConnPool(s.appCtx)
+		if err != nil {
+			return fmt.Errorf("MakeReplicaDbConnPool: %s", err)
+		}
+		replicaConfig := managerConfig
+		replicaConfig.DBConnector = replicaDB
+		s.appCtx.ReplicaRM = request.NewManager(replicaConfig)
+		s.appCtx.ReplicaJLS = joblog.NewStore(replicaDB, cfg.Limits)
+		s.appCtx.Replica = replica.NewReplica(replica.Config{
+			DB:     replicaDB,
+			MaxLag: maxLag,
+		})
+		s.appCtx.Replica.Check() // usable before the first interval
+	}
+
+	// Write buffer: queue job logs and progress while MySQL is unavailable
+	s.appCtx.WriteBuffer, err = writebuf.NewBuffer(cfg.WriteBuffer)
+	if err != nil {
+		return fmt.Errorf("invalid write_buffer config: %s", err)
+	}
+
+	// Quota Manager: per-user and per-team request quotas
+	s.appCtx.Quota = quota.NewManager(dbConnector)
+
+	// Reconciler: fail or suspend running requests lost by Job Runners
+	if cfg.Reconcile.Interval != "" {
+		s.reconcileInterval, err = time.ParseDuration(cfg.Reconcile.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid reconcile.interval %s: %s", cfg.Reconcile.Interval, err)
+		}
+	}
+	if s.reconcileInterval > 0 {
+		var grace time.Duration
+		if cfg.Reconcile.Grace != "" {
+			grace, err = time.ParseDuration(cfg.Reconcile.Grace)
+			if err != nil {
+				return fmt.Errorf("invalid reconcile.grace %s: %s", cfg.Reconcile.Grace, err)
+			}
+		}
+		s.reconciler = reconcile.NewReconciler(reconcile.Config{
+			RequestManager: s.appCtx.RM,
+			Resumer:        s.appCtx.RR,
+			JobLogStore:    s.appCtx.JLS,
+			JRClient:       jrClient,
+			Grace:          grace,
+			Resume:         cfg.Reconcile.Resume,
+			TakeoverURL:    cfg.Reconcile.TakeoverURL,
+		})
+		if cfg.Reconcile.TakeoverURL != "" {
+			log.Infof("Stale requests taken over by standby Job Runner %s", cfg.Reconcile.TakeoverURL)
+		}
+	}
+
+	// SLO Manager: request type SLO attainment and burn alerts
+	sloCfg := slo.Config{
+		Specs:       specs,
+		Windows:     make([]time.Duration, len(cfg.SLO.Windows)),
+		BurnRate:    cfg.SLO.BurnRate,
+		MinRequests: cfg.SLO.MinRequests,
+		OnChange:    s.appCtx.Hooks.SLOChanged,
+	}
+	for i, w := range cfg.SLO.Windows {
+		sloCfg.Windows[i], err = time.ParseDuration(w)
+		if err != nil || sloCfg.Windows[i] <= 0 {
+			return fmt.Errorf("invalid slo.windows %s: must be a duration greater than zero", w)
+		}
+	}
+	if len(sloCfg.Windows) == 0 {
+		return fmt.Errorf("invalid slo.windows: at least one window is required")
+	}
+	if sloCfg.BurnRate <= 0 {
+		return fmt.Errorf("invalid slo.burn_rate %f: must be greater than zero", cfg.SLO.BurnRate)
+	}
+	if cfg.SLO.Interval != "" {
+		s.sloInterval, err = time.ParseDuration(cfg.SLO.Interval)
+		if err != nil {
+			return fmt.Errorf("invalid slo.interval %s: %s", cfg.SLO.Interval, err)
+		}
+	}
+	s.appCtx.SLO = slo.NewManager(dbConnector, sloCfg)
+
+	// Upgrade Manager: rolling Job Runner upgrades driven by deploy tooling
+	s.appCtx.Upgrade = upgrade.NewManager(dbConnector, jrClient)
+
+	// Group Manager: request groups, many requests created and tracked as one
+	s.appCtx.Group = group.NewManager(dbConnector, s.appCtx.RM)
+
+	// Access log: structured API access logs, optionally sent to an HTTP sink
+	if cfg.AccessLog.Enabled {
+		httpClient := &http.Client{Timeout: 10 * time.Second}
+		sink := cfg.AccessLog.Sink
+		if sink.TLS.CertFile != "" && sink.TLS.KeyFile != "" && sink.TLS.CAFile != "" {
+			tlsConfig, err := config.NewTLSConfig(sink.TLS.CAFile, sink.TLS.CertFile, sink.TLS.KeyFile)
+			if err != nil {
+				return fmt.Errorf("error loading access_log.sink TLS config: %s", err)
+			}
+			httpClient.Transport = &http.Transport{TLSClientConfig: tlsConfig}
+		}
+		s.appCtx.AccessLog, err = accesslog.NewLogger(cfg.AccessLog, httpClient)
+		if err != nil {
+			return fmt.Errorf("invalid access_log config: %s", err)
+		}
+	}
 
 	// Auth Manager: request authorization (pre- (built-in) and post- using plugin)
 	s.appCtx.Auth = auth.NewManager(s.appCtx.Plugins.Auth, mapACL(specs), cfg.Auth.AdminRoles, cfg.Auth.Strict)
 
-	// API: endpoints and controllers, also handles auth via auth plugin
+	// API: endpoints and controllers, also handles auth via auth plugin. The API
+	// refuses to create and start requests once the server begins shutting down.
+	s.appCtx.ShutdownChan = s.shutdownChan
 	s.api = api.NewAPI(s.appCtx)
 
 	return nil
@@ -337,3 +753,18 @@ func mapACL(specs spec.Specs) map[string][]auth.ACL {
 	}
 	return acl
 }
+
+// buildableSpecs returns a copy of specs without the sequences that have errors.
+func buildableSpecs(specs spec.Specs, results *spec.CheckResults) spec.Specs {
+	buildable := spec.Specs{
+		Sequences: make(map[string]*spec.Sequence, len(specs.Sequences)),
+		Version:   specs.Version,
+	}
+	for name, seq := range specs.Sequences {
+		if result, ok := results.Get(name); ok && len(result.Errors) > 0 {
+			continue
+		}
+		buildable.Sequences[name] = seq
+	}
+	return buildable
+}
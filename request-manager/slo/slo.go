@@ -0,0 +1,241 @@
+// Copyright 2020, Square, Inc.
+
+// Package slo tracks the service level objectives (SLO) of request types.
+package slo
+
+import (
+	"context"
+	"database/sql"
+	"expvar"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// Burning is the number of request types whose SLO is burning, as of the last
+// Manager.Check, published as an expvar (GET /debug/vars on the Request Manager API).
+var Burning = expvar.NewInt("slo_burning")
+
+// A Manager reports and checks the SLOs of request types (spec.SLO). SLO attainment
+// is computed from the requests table on every call, so it's the same on all
+// Request Managers. A request meets the SLO success rate if it's COMPLETE, like
+// proto.RequestHistory.SuccessRate, and the SLO duration if it finished within
+// the duration after it started. A request that finished without starting (for
+// example, it failed to start) misses the SLO duration.
+type Manager interface {
+	// Status returns the SLO status of the request type. It returns
+	// errors.RequestTypeNotFound if the request type does not exist, or
+	// errors.SLONotFound if it has no SLO.
+	Status(reqType string) (proto.SLOStatus, error)
+
+	// List returns the SLO status of all request types with an SLO, sorted by type.
+	List() ([]proto.SLOStatus, error)
+
+	// Check checks all SLOs and calls Config.OnChange for every SLO that started
+	// or stopped burning since the last check. Errors are logged, not returned.
+	// It is not safe to call concurrently.
+	Check()
+}
+
+// Config configures a Manager.
+type Config struct {
+	Specs       spec.Specs
+	Windows     []time.Duration       // rolling windows, any order
+	BurnRate    float64               // window burning at or above this burn rate
+	MinRequests uint                  // min number of finished requests in a window to judge it
+	OnChange    func(proto.SLOStatus) // called by Check (optional)
+}
+
+// manager implements the Manager interface.
+type manager struct {
+	dbc       *sql.DB
+	cfg       Config
+	slos      map[string]proto.SLO     // request type -> SLO
+	durations map[string]time.Duration // request type -> SLO duration, if set
+	types     []string                 // request types with an SLO, sorted
+	burning   map[string]bool          // request type -> burning at last Check
+}
+
+func NewManager(dbc *sql.DB, cfg Config) Manager {
+	windows := make([]time.Duration, len(cfg.Windows))
+	copy(windows, cfg.Windows)
+	sort.Slice(windows, func(i, j int) bool { return windows[i] < windows[j] })
+	cfg.Windows = windows
+
+	m := &manager{
+		dbc:       dbc,
+		cfg:       cfg,
+		slos:      map[string]proto.SLO{},
+		durations: map[string]time.Duration{},
+		types:     []string{},
+		burning:   map[string]bool{},
+	}
+	for name, seq := range cfg.Specs.Sequences {
+		if !seq.Request || seq.SLO == nil {
+			continue
+		}
+		m.slos[name] = proto.SLO{
+			SuccessRate: seq.SLO.SuccessRate,
+			Duration:    seq.SLO.Duration,
+			Percentile:  seq.SLO.Percentile,
+		}
+		if seq.SLO.Duration != "" {
+			// Specs are checked on load (ValidSLOSequenceCheck), so this only
+			// fails if checks were skipped
+			d, err := time.ParseDuration(seq.SLO.Duration)
+			if err != nil {
+				log.Warnf("request type %s: invalid slo.duration %s, ignoring: %s", name, seq.SLO.Duration, err)
+			} else {
+				m.durations[name] = d
+			}
+		}
+		m.types = append(m.types, name)
+	}
+	sort.Strings(m.types)
+	return m
+}
+
+func (m *manager) Status(reqType string) (proto.SLOStatus, error) {
+	if _, ok := m.cfg.Specs.Sequences[reqType]; !ok {
+		return proto.SLOStatus{}, serr.RequestTypeNotFound{Type: reqType}
+	}
+	if _, ok := m.slos[reqType]; !ok {
+		return proto.SLOStatus{}, serr.SLONotFound{Type: reqType}
+	}
+	return m.status(context.TODO(), reqType, time.Now().UTC())
+}
+
+func (m *manager) List() ([]proto.SLOStatus, error) {
+	ctx := context.TODO()
+	now := time.Now().UTC()
+	all := make([]proto.SLOStatus, 0, len(m.types))
+	for _, reqType := range m.types {
+		s, err := m.status(ctx, reqType, now)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, s)
+	}
+	return all, nil
+}
+
+func (m *manager) Check() {
+	all, err := m.List()
+	if err != nil {
+		log.Errorf("cannot check SLOs: %s", err)
+		return
+	}
+	var n int64
+	for _, s := range all {
+		if s.Burning {
+			n++
+		}
+		if s.Burning == m.burning[s.Type] {
+			continue
+		}
+		m.burning[s.Type] = s.Burning
+		if s.Burning {
+			w := s.Windows[0]
+			log.Warnf("request type %s SLO is burning: burn rate %.1f in the last %s (%d of %d requests complete, %.1f%% within duration)",
+				s.Type, w.BurnRate, w.Window, w.Complete, w.Finished, w.DurationAttainment)
+		} else {
+			log.Infof("request type %s SLO stopped burning", s.Type)
+		}
+		if m.cfg.OnChange != nil {
+			m.cfg.OnChange(s)
+		}
+	}
+	Burning.Set(n)
+}
+
+// status returns the SLO status of the request type, which must have an SLO.
+func (m *manager) status(ctx context.Context, reqType string, now time.Time) (proto.SLOStatus, error) {
+	slo := m.slos[reqType]
+	d, hasDuration := m.durations[reqType]
+	s := proto.SLOStatus{
+		Type:      reqType,
+		SLO:       slo,
+		Windows:   make([]proto.SLOWindow, 0, len(m.cfg.Windows)),
+		CheckedAt: now,
+	}
+	q := "SELECT COUNT(*), COALESCE(SUM(state = ?), 0), COALESCE(SUM(TIMESTAMPDIFF(MICROSECOND, started_at, finished_at) <= ?), 0)" +
+		" FROM requests WHERE type = ? AND finished_at > ?"
+	for _, window := range m.cfg.Windows {
+		w := proto.SLOWindow{Window: FormatWindow(window)}
+		since := now.Add(-window).Format(time.RFC3339Nano)
+		err := m.dbc.QueryRowContext(ctx, q, proto.STATE_COMPLETE, d.Microseconds(), reqType, since).Scan(&w.Finished, &w.Complete, &w.WithinDuration)
+		if err != nil {
+			return s, serr.NewDbError(err, "SELECT requests")
+		}
+		if !hasDuration {
+			w.WithinDuration = 0
+		}
+		s.Windows = append(s.Windows, Attainment(slo, w, m.cfg.BurnRate, m.cfg.MinRequests))
+	}
+	s.Burning = IsBurning(s.Windows)
+	return s, nil
+}
+
+// Attainment returns the window with its rates, burn rate, Met, and Burning set
+// from its counts: Finished, Complete, and WithinDuration. A window with fewer
+// than minRequests finished requests (or none) meets the SLO and is not burning.
+func Attainment(slo proto.SLO, w proto.SLOWindow, burnRate float64, minRequests uint) proto.SLOWindow {
+	w.SuccessRate = 0
+	w.DurationAttainment = 0
+	w.BurnRate = 0
+	w.Met = true
+	w.Burning = false
+	if w.Finished == 0 {
+		return w
+	}
+
+	w.SuccessRate = float64(w.Complete) / float64(w.Finished)
+	w.DurationAttainment = float64(w.WithinDuration) / float64(w.Finished) * 100
+	if slo.SuccessRate > 0 {
+		w.BurnRate = (1 - w.SuccessRate) / (1 - slo.SuccessRate)
+	}
+	if slo.Duration != "" {
+		if r := (100 - w.DurationAttainment) / (100 - slo.Percentile); r > w.BurnRate {
+			w.BurnRate = r
+		}
+	}
+
+	if w.Finished < minRequests {
+		return w
+	}
+	w.Met = (slo.SuccessRate == 0 || w.SuccessRate >= slo.SuccessRate) &&
+		(slo.Duration == "" || w.DurationAttainment >= slo.Percentile)
+	w.Burning = w.BurnRate >= burnRate
+	return w
+}
+
+// IsBurning returns true if the two shortest windows are burning, or the only
+// window. Windows must be sorted shortest first.
+func IsBurning(windows []proto.SLOWindow) bool {
+	switch len(windows) {
+	case 0:
+		return false
+	case 1:
+		return windows[0].Burning
+	}
+	return windows[0].Burning && windows[1].Burning
+}
+
+// FormatWindow returns the window duration without zero minutes and seconds,
+// like "24h" instead of "24h0m0s".
+func FormatWindow(d time.Duration) string {
+	s := d.String()
+	if strings.HasSuffix(s, "m0s") {
+		s = strings.TrimSuffix(s, "0s")
+	}
+	if strings.HasSuffix(s, "h0m") {
+		s = strings.TrimSuffix(s, "0m")
+	}
+	return s
+}
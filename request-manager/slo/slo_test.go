@@ -0,0 +1,235 @@
+// Copyright 2020, Square, Inc.
+
+package slo_test
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/slo"
+	"github.com/square/spincycle/v2/request-manager/spec"
+	"github.com/square/spincycle/v2/request-manager/test"
+	testdb "github.com/square/spincycle/v2/request-manager/test/db"
+)
+
+var dbm testdb.Manager
+var dbc *sql.DB
+
+func setup(t *testing.T, dataFile string) string {
+	// Setup a db manager to handle databases for all tests.
+	var err error
+	if dbm == nil {
+		dbm, err = testdb.NewManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Setup a db for this specific test, and seed it with some default data.
+	dbName, err := dbm.Create(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := dbm.Connect(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbc = db
+
+	return dbName
+}
+
+func teardown(t *testing.T, dbName string) {
+	if err := dbm.Destroy(dbName); err != nil {
+		t.Fatal(err)
+	}
+	dbc.Close()
+}
+
+var specs = spec.Specs{
+	Sequences: map[string]*spec.Sequence{
+		"slo-type": &spec.Sequence{
+			Name:    "slo-type",
+			Request: true,
+			SLO:     &spec.SLO{SuccessRate: 0.9, Duration: "10m", Percentile: 95},
+		},
+		"other-type": &spec.Sequence{
+			Name:    "other-type",
+			Request: true,
+		},
+	},
+}
+
+// //////////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////////
+
+func TestAttainment(t *testing.T) {
+	target := proto.SLO{SuccessRate: 0.9, Duration: "10m", Percentile: 95}
+
+	// 8 of 10 complete: 20% failed / 10% budget = burn rate 2. 9 of 10 within
+	// duration: 10% slow / 5% budget = burn rate 2.
+	got := slo.Attainment(target, proto.SLOWindow{Window: "1h", Finished: 10, Complete: 8, WithinDuration: 9}, 2, 10)
+	expect := proto.SLOWindow{
+		Window:             "1h",
+		Finished:           10,
+		Complete:           8,
+		WithinDuration:     9,
+		SuccessRate:        0.8,
+		DurationAttainment: 90,
+		BurnRate:           2,
+		Met:                false,
+		Burning:            true,
+	}
+	deep.FloatPrecision = 6
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Same but fewer than min requests: not judged
+	got = slo.Attainment(target, proto.SLOWindow{Finished: 10, Complete: 8, WithinDuration: 9}, 2, 11)
+	if !got.Met || got.Burning {
+		t.Errorf("got Met %t and Burning %t, expected true and false with too few requests", got.Met, got.Burning)
+	}
+
+	// All complete and within duration: met, burn rate 0
+	got = slo.Attainment(target, proto.SLOWindow{Finished: 20, Complete: 20, WithinDuration: 20}, 2, 10)
+	if !got.Met || got.Burning || got.BurnRate != 0 {
+		t.Errorf("got Met %t, Burning %t, BurnRate %f, expected true, false, 0", got.Met, got.Burning, got.BurnRate)
+	}
+
+	// Success rate only: within duration is ignored
+	got = slo.Attainment(proto.SLO{SuccessRate: 0.5}, proto.SLOWindow{Finished: 10, Complete: 6}, 2, 10)
+	if !got.Met || got.Burning {
+		t.Errorf("got Met %t and Burning %t, expected true and false for success rate only", got.Met, got.Burning)
+	}
+
+	// No requests finished
+	got = slo.Attainment(target, proto.SLOWindow{}, 2, 0)
+	if !got.Met || got.Burning || got.SuccessRate != 0 {
+		t.Errorf("got %+v, expected met and not burning with no requests", got)
+	}
+}
+
+func TestIsBurning(t *testing.T) {
+	b := proto.SLOWindow{Burning: true}
+	n := proto.SLOWindow{}
+	cases := []struct {
+		windows []proto.SLOWindow
+		expect  bool
+	}{
+		{[]proto.SLOWindow{}, false},
+		{[]proto.SLOWindow{b}, true},
+		{[]proto.SLOWindow{n}, false},
+		{[]proto.SLOWindow{b, b, n}, true},
+		{[]proto.SLOWindow{b, n, b}, false}, // short spike
+		{[]proto.SLOWindow{n, b, b}, false}, // recovered
+	}
+	for i, c := range cases {
+		if got := slo.IsBurning(c.windows); got != c.expect {
+			t.Errorf("case %d: got %t, expected %t", i, got, c.expect)
+		}
+	}
+}
+
+func TestFormatWindow(t *testing.T) {
+	for d, expect := range map[time.Duration]string{
+		time.Hour:                     "1h",
+		168 * time.Hour:               "168h",
+		90 * time.Minute:              "1h30m",
+		30 * time.Minute:              "30m",
+		90 * time.Second:              "1m30s",
+		time.Hour + 30*time.Second:    "1h0m30s",
+		500 * time.Millisecond:        "500ms",
+		2*time.Hour + 5*time.Minute:   "2h5m",
+		10*time.Hour + 10*time.Second: "10h0m10s",
+	} {
+		if got := slo.FormatWindow(d); got != expect {
+			t.Errorf("%s: got %s, expected %s", d, got, expect)
+		}
+	}
+}
+
+func TestStatus(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/slo-default.sql")
+	defer teardown(t, dbName)
+
+	m := slo.NewManager(dbc, slo.Config{
+		Specs:       specs,
+		Windows:     []time.Duration{168 * time.Hour, time.Hour},
+		BurnRate:    2,
+		MinRequests: 5,
+	})
+
+	s, err := m.Status("slo-type")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(s.Windows) != 2 {
+		t.Fatalf("got %d windows, expected 2: %+v", len(s.Windows), s.Windows)
+	}
+	// Shortest first: 10 requests in the last hour, 11 in 7 days
+	w := s.Windows[0]
+	if w.Window != "1h" || w.Finished != 10 || w.Complete != 8 || w.WithinDuration != 9 {
+		t.Errorf("got window %+v, expected 1h with 10 finished, 8 complete, 9 within duration", w)
+	}
+	if !w.Burning || w.Met {
+		t.Errorf("1h window Burning %t and Met %t, expected true and false", w.Burning, w.Met)
+	}
+	w = s.Windows[1]
+	if w.Window != "168h" || w.Finished != 11 || w.Complete != 9 {
+		t.Errorf("got window %+v, expected 168h with 11 finished and 9 complete", w)
+	}
+	if s.Burning {
+		t.Errorf("SLO burning, expected not burning: 168h window burn rate %f", w.BurnRate)
+	}
+
+	_, err = m.Status("other-type")
+	if _, ok := err.(serr.SLONotFound); !ok {
+		t.Errorf("err = %v, expected errors.SLONotFound", err)
+	}
+	_, err = m.Status("no-such-type")
+	if _, ok := err.(serr.RequestTypeNotFound); !ok {
+		t.Errorf("err = %v, expected errors.RequestTypeNotFound", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/slo-default.sql")
+	defer teardown(t, dbName)
+
+	// One 1h window: burning, so OnChange is called once, not again until it changes
+	changes := []proto.SLOStatus{}
+	m := slo.NewManager(dbc, slo.Config{
+		Specs:       specs,
+		Windows:     []time.Duration{time.Hour},
+		BurnRate:    2,
+		MinRequests: 5,
+		OnChange:    func(s proto.SLOStatus) { changes = append(changes, s) },
+	})
+	m.Check()
+	m.Check()
+	if len(changes) != 1 {
+		t.Fatalf("OnChange called %d times, expected 1", len(changes))
+	}
+	if changes[0].Type != "slo-type" || !changes[0].Burning {
+		t.Errorf("got change %+v, expected slo-type burning", changes[0])
+	}
+	if slo.Burning.Value() != 1 {
+		t.Errorf("slo_burning = %d, expected 1", slo.Burning.Value())
+	}
+
+	all, err := m.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != 1 || all[0].Type != "slo-type" {
+		t.Errorf("got %+v, expected only slo-type", all)
+	}
+}
@@ -38,6 +38,37 @@ func (c BaseCheckFactory) MakeSequenceErrorChecks() ([]SequenceCheck, error) {
 		ACLAdminXorOpsSequenceCheck{},
 		ACLsHaveRolesSequenceCheck{},
 		NoDuplicateACLRolesSequenceCheck{},
+
+		AutoRetryRequestOnlySequenceCheck{},
+		AutoRetryHasErrorsSequenceCheck{},
+
+		BudgetRequestOnlySequenceCheck{},
+		BudgetApprovalBelowMaxSequenceCheck{},
+
+		SunsetRequestOnlySequenceCheck{},
+		ValidSunsetSequenceCheck{},
+
+		StopTimeoutRequestOnlySequenceCheck{},
+		ValidStopTimeoutSequenceCheck{},
+
+		RetryBudgetRequestOnlySequenceCheck{},
+
+		PartitionsRequestOnlySequenceCheck{},
+
+		PlacementRequestOnlySequenceCheck{},
+		PlacementHasPolicySequenceCheck{},
+
+		SLORequestOnlySequenceCheck{},
+		ValidSLOSequenceCheck{},
+
+		UniqueByRequestOnlySequenceCheck{},
+		ValidUniqueBySequenceCheck{},
+
+		SensitiveArgsNotEvaluatedSequenceCheck{c.AllSpecs},
+
+		SkippedSetsHaveDefaultsSequenceCheck{},
+
+		ValidDocsURLSequenceCheck{},
 	}, nil
 }
 
@@ -55,17 +86,32 @@ func (c BaseCheckFactory) MakeNodeErrorChecks() ([]NodeCheck, error) {
 		ValidEachNodeCheck{},
 		ArgsNotNilNodeCheck{},
 		ArgsAreNamedNodeCheck{},
+		ValidArgTemplateNodeCheck{},
 		SetsNotNilNodeCheck{},
 		SetsAreNamedNodeCheck{},
 
 		ValidParallelNodeCheck{},
+		ValidSequentialNodeCheck{},
 
 		ConditionalHasIfNodeCheck{},
 		ConditionalHasEqNodeCheck{},
 		NonconditionalHasTypeNodeCheck{},
 
+		WaitHasDurationXorUntilNodeCheck{},
+		ValidDurationNodeCheck{},
+		WaitNoSetsNodeCheck{},
+
 		ValidRetryWaitNodeCheck{},
 
+		CostOnlyJobNodeCheck{},
+
+		SkippableOnlyJobNodeCheck{},
+		SetsDefaultOnlySkippableNodeCheck{},
+
+		ValidDocsURLNodeCheck{},
+
+		ValidEnvNodeCheck{},
+
 		RequiredArgsProvidedNodeCheck{c.AllSpecs},
 	}, nil
 }
@@ -90,6 +136,8 @@ func (c DefaultCheckFactory) MakeSequenceErrorChecks() ([]SequenceCheck, error)
 func (c DefaultCheckFactory) MakeSequenceWarningChecks() ([]SequenceCheck, error) {
 	return []SequenceCheck{
 		NodesSetsUniqueSequenceCheck{},
+		ParallelSetsSequenceCheck{},
+		ShadowedArgsSequenceCheck{c.AllSpecs},
 	}, nil
 }
 
@@ -106,6 +154,10 @@ func (c DefaultCheckFactory) MakeNodeErrorChecks() ([]NodeCheck, error) {
 		NonconditionalNoIfNodeCheck{},
 		NonconditionalNoEqNodeCheck{},
 
+		WaitNoTypeNodeCheck{},
+		NonwaitNoDurationNodeCheck{},
+		NonwaitNoUntilNodeCheck{},
+
 		RetryIfRetryWaitNodeCheck{},
 	}, nil
 }
@@ -118,5 +170,6 @@ func (c DefaultCheckFactory) MakeNodeWarningChecks() ([]NodeCheck, error) {
 		SetsNotRenamedTwiceNodeCheck{},
 
 		NoExtraSequenceArgsProvidedNodeCheck{c.AllSpecs},
+		NoDeprecatedSubsequencesNodeCheck{c.AllSpecs},
 	}, nil
 }
@@ -2,6 +2,12 @@
 
 package spec
 
+import (
+	"errors"
+	"reflect"
+	"sort"
+)
+
 type CheckResult struct {
 	Errors   []error
 	Warnings []error
@@ -63,3 +69,53 @@ func (c *CheckResults) Get(key string) (*CheckResult, bool) {
 	result, ok := c.Results[key]
 	return result, ok
 }
+
+// Keys returns the keys of all results, sorted, to report results in the same
+// order every time.
+func (c *CheckResults) Keys() []string {
+	keys := make([]string, 0, len(c.Results))
+	for key := range c.Results {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// CheckError is an error or warning from a sequence or node check run by a
+// Checker. Check is the name of the check type, like "RetryIfRetryWaitNodeCheck",
+// so results can be counted by check. Error returns the check error unchanged.
+type CheckError struct {
+	Check string
+	Err   error
+}
+
+func (e CheckError) Error() string {
+	return e.Err.Error()
+}
+
+func (e CheckError) Unwrap() error {
+	return e.Err
+}
+
+// CheckName returns the name of the check that returned err if it's a CheckError,
+// else it returns def. Errors from parsing and graph checks are not CheckErrors.
+func CheckName(err error, def string) string {
+	var ce CheckError
+	if errors.As(err, &ce) {
+		return ce.Check
+	}
+	return def
+}
+
+// checkName returns the name of a SequenceCheck or NodeCheck: its CheckName, if
+// it has that method (like policy rules and checks from plugins), else its type name.
+func checkName(check interface{}) string {
+	if named, ok := check.(interface{ CheckName() string }); ok {
+		return named.CheckName()
+	}
+	t := reflect.TypeOf(check)
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t.Name()
+}
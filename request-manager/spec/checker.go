@@ -56,24 +56,24 @@ func (checker *Checker) RunChecks(allSpecs Specs) *CheckResults {
 	for name, sequence := range allSpecs.Sequences {
 		for _, sequenceCheck := range checker.sequenceErrorChecks {
 			if err := sequenceCheck.CheckSequence(*sequence); err != nil {
-				results.AddError(name, err)
+				results.AddError(name, CheckError{Check: checkName(sequenceCheck), Err: err})
 			}
 		}
 		for _, sequenceCheck := range checker.sequenceWarningChecks {
 			if err := sequenceCheck.CheckSequence(*sequence); err != nil {
-				results.AddWarning(name, err)
+				results.AddWarning(name, CheckError{Check: checkName(sequenceCheck), Err: err})
 			}
 		}
 
 		for _, node := range sequence.Nodes {
 			for _, nodeCheck := range checker.nodeErrorChecks {
 				if err := nodeCheck.CheckNode(*node); err != nil {
-					results.AddError(name, err)
+					results.AddError(name, CheckError{Check: checkName(nodeCheck), Err: err})
 				}
 			}
 			for _, nodeCheck := range checker.nodeWarningChecks {
 				if err := nodeCheck.CheckNode(*node); err != nil {
-					results.AddWarning(name, err)
+					results.AddWarning(name, CheckError{Check: checkName(nodeCheck), Err: err})
 				}
 			}
 		}
@@ -141,6 +141,24 @@ func TestFailRunChecks(t *testing.T) {
 	if !seqResults.AnyWarning {
 		t.Errorf("RunChecks reports no warnings, expected some warning")
 	}
+
+	// Errors and warnings are named by check, and their messages are unchanged
+	result := seqResults.Results["seq"]
+	if len(result.Errors) != 2 || len(result.Warnings) != 2 {
+		t.Fatalf("got %d errors and %d warnings, expected 2 and 2", len(result.Errors), len(result.Warnings))
+	}
+	for _, err := range append(result.Errors, result.Warnings...) {
+		name := CheckName(err, "")
+		if name != "FailSequenceCheck" && name != "FailNodeCheck" {
+			t.Errorf("got check name '%s' for error %s, expected FailSequenceCheck or FailNodeCheck", name, err)
+		}
+		if err.Error() != failSequenceCheckError.Error() && err.Error() != failNodeCheckError.Error() {
+			t.Errorf("got error %s, expected check error unchanged", err)
+		}
+	}
+	if name := CheckName(fmt.Errorf("graph error"), "graph"); name != "graph" {
+		t.Errorf("got check name '%s' for non-check error, expected default graph", name)
+	}
 }
 
 /* ++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++++ */
@@ -105,3 +105,19 @@ func (e DuplicateValueError) Error() string {
 	return fmt.Sprintf("%svalue%s %s duplicated in field '%s'%s",
 		loc, multipleValues, values, e.Field, explanation)
 }
+
+/* =========================================================================== */
+
+var _ error = DuplicateSequenceError{}
+
+// DuplicateSequenceError is a sequence defined in more than one spec file.
+// Files are relative to the specs directory, in lexical order.
+type DuplicateSequenceError struct {
+	Sequence string
+	Files    []string
+}
+
+func (e DuplicateSequenceError) Error() string {
+	return fmt.Sprintf("sequence %s defined in %d files: %s",
+		e.Sequence, len(e.Files), strings.Join(e.Files, ", "))
+}
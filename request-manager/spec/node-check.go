@@ -4,6 +4,8 @@ package spec
 
 import (
 	"fmt"
+	"path"
+	"sort"
 	"strings"
 	"time"
 )
@@ -31,17 +33,17 @@ func (check HasCategoryNodeCheck) CheckNode(node Node) error {
 /* ========================================================================== */
 type ValidCategoryNodeCheck struct{}
 
-/* 'category: (job | sequence | conditional)' */
+/* 'category: (job | sequence | conditional | wait)' */
 func (check ValidCategoryNodeCheck) CheckNode(node Node) error {
 	if node.Category == nil { // Another check's problem
 		return nil
 	}
-	if !node.IsJob() && !node.IsSequence() && !node.IsConditional() {
+	if !node.IsJob() && !node.IsSequence() && !node.IsConditional() && !node.IsWait() {
 		return InvalidValueError{
 			Node:     &node.Name,
 			Field:    "category",
 			Values:   []string{*node.Category},
-			Expected: "(job | sequence | conditional)",
+			Expected: "(job | sequence | conditional | wait)",
 		}
 	}
 
@@ -442,6 +444,40 @@ func (check ValidParallelNodeCheck) CheckNode(node Node) error {
 	return nil
 }
 
+/* ========================================================================== */
+type ValidSequentialNodeCheck struct{}
+
+/* If 'sequential' or 'continueOnFail' is set, 'each' and 'sequential' must be set, and 'parallel' must not be set. */
+func (check ValidSequentialNodeCheck) CheckNode(node Node) error {
+	if node.Sequential {
+		if node.Each == nil {
+			return MissingValueError{
+				Node:        &node.Name,
+				Field:       "each",
+				Explanation: "required when 'sequential' field set",
+			}
+		}
+		if node.Parallel != nil {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    "parallel",
+				Values:   []string{fmt.Sprintf("%d", *node.Parallel)},
+				Expected: "no value when 'sequential' field set ('sequential: true' runs one expansion at a time)",
+			}
+		}
+	}
+	if node.ContinueOnFail && !node.Sequential {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "continueOnFail",
+			Values:   []string{"true"},
+			Expected: "no value unless 'sequential: true'",
+		}
+	}
+
+	return nil
+}
+
 /* ========================================================================== */
 type ConditionalNoTypeNodeCheck struct{}
 
@@ -500,9 +536,9 @@ func (check ConditionalHasEqNodeCheck) CheckNode(node Node) error {
 /* ========================================================================== */
 type NonconditionalHasTypeNodeCheck struct{}
 
-/* Nonconditional nodes must specify a type. */
+/* Nonconditional nodes must specify a type, except wait nodes. */
 func (check NonconditionalHasTypeNodeCheck) CheckNode(node Node) error {
-	if !node.IsConditional() {
+	if !node.IsConditional() && !node.IsWait() {
 		if node.NodeType == nil {
 			return MissingValueError{
 				Node:        &node.Name,
@@ -570,6 +606,33 @@ func (check RetryIfRetryWaitNodeCheck) CheckNode(node Node) error {
 	return nil
 }
 
+/* ========================================================================== */
+type ValidArgTemplateNodeCheck struct{}
+
+/* 'given' templates, like '{cluster}.example.com', must be valid. */
+func (check ValidArgTemplateNodeCheck) CheckNode(node Node) error {
+	var values []string
+	for _, nodeArg := range node.Args {
+		if nodeArg == nil || nodeArg.Given == nil || !IsArgTemplate(*nodeArg.Given) {
+			continue
+		}
+		if _, err := ArgTemplateRefs(*nodeArg.Given); err != nil {
+			values = append(values, *nodeArg.Given)
+		}
+	}
+
+	if len(values) > 0 {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "args.given",
+			Values:   values,
+			Expected: "job arg name or template with balanced, non-empty {job arg} references",
+		}
+	}
+
+	return nil
+}
+
 /* ========================================================================== */
 type ValidRetryWaitNodeCheck struct{}
 
@@ -589,6 +652,266 @@ func (check ValidRetryWaitNodeCheck) CheckNode(node Node) error {
 	return nil
 }
 
+/* ========================================================================== */
+type ValidDocsURLNodeCheck struct{}
+
+/* 'docsUrl' should be an absolute http or https URL, so clients can link to it. */
+func (check ValidDocsURLNodeCheck) CheckNode(node Node) error {
+	if node.DocsURL != "" && !validDocsURL(node.DocsURL) {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "docsUrl",
+			Values:   []string{node.DocsURL},
+			Expected: "absolute http or https URL",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type CostOnlyJobNodeCheck struct{}
+
+/* 'cost' is only set on job nodes; a sequence costs the sum of its jobs. */
+func (check CostOnlyJobNodeCheck) CheckNode(node Node) error {
+	if node.Cost != 0 && !node.IsJob() {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "cost",
+			Values:   []string{fmt.Sprintf("%d", node.Cost)},
+			Expected: "cost only in job nodes (category: job)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type SkippableOnlyJobNodeCheck struct{}
+
+/* 'skippable' is only set on job nodes: operators skip jobs, not sequences. */
+func (check SkippableOnlyJobNodeCheck) CheckNode(node Node) error {
+	if node.Skippable && !node.IsJob() {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "skippable",
+			Values:   []string{"true"},
+			Expected: "skippable only in job nodes (category: job)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type SetsDefaultOnlySkippableNodeCheck struct{}
+
+/* 'sets' defaults are only used when a skippable node is skipped. */
+func (check SetsDefaultOnlySkippableNodeCheck) CheckNode(node Node) error {
+	if node.Skippable {
+		return nil
+	}
+	for _, set := range node.Sets {
+		if set != nil && set.Default != nil && set.As != nil {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    "sets.default",
+				Values:   []string{*set.As},
+				Expected: "default only in skippable nodes (skippable: true)",
+			}
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidEnvNodeCheck struct{}
+
+/*
+ * Every 'env' override sets at least one field that's valid for the node, and
+ * the node is valid with the override applied. All overrides are checked, not
+ * only the ones for the Request Manager environment.
+ */
+func (check ValidEnvNodeCheck) CheckNode(node Node) error {
+	for _, env := range node.Envs() {
+		o := node.Env[env]
+		field := "env." + env
+		if env == "" {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    "env",
+				Values:   []string{env},
+				Expected: "environment name",
+			}
+		}
+		if o.Empty() {
+			return MissingValueError{
+				Node:        &node.Name,
+				Field:       field,
+				Explanation: "override must set at least one of 'retry', 'retryWait', 'parallel', or 'duration'",
+			}
+		}
+		if (o.Retry != nil || o.RetryWait != nil) && !node.IsJob() {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    field,
+				Values:   []string{"retry"},
+				Expected: "'retry' and 'retryWait' only in job nodes (category: job)",
+			}
+		}
+		if o.Parallel != nil && node.Each == nil {
+			return MissingValueError{
+				Node:        &node.Name,
+				Field:       "each",
+				Explanation: fmt.Sprintf("required when '%s.parallel' field set", field),
+			}
+		}
+		if o.Duration != nil && !node.IsWait() {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    field,
+				Values:   []string{"duration"},
+				Expected: "'duration' only in wait nodes (category: wait)",
+			}
+		}
+
+		// Values must be valid like the node fields they override
+		overridden := node.WithEnv(env)
+		for _, c := range []NodeCheck{ValidParallelNodeCheck{}, ValidSequentialNodeCheck{}, ValidRetryWaitNodeCheck{}, ValidDurationNodeCheck{}} {
+			if err := c.CheckNode(overridden); err != nil {
+				if e, ok := err.(InvalidValueError); ok {
+					e.Field = field + "." + e.Field
+					return e
+				}
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type WaitNoTypeNodeCheck struct{}
+
+/* Wait nodes may not specify a type. */
+func (check WaitNoTypeNodeCheck) CheckNode(node Node) error {
+	if node.IsWait() && node.NodeType != nil {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "type",
+			Values:   []string{*node.NodeType},
+			Expected: "no value; wait nodes may not specify a type",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type WaitNoSetsNodeCheck struct{}
+
+/* Wait nodes may not specify 'sets'; they don't set any job args. */
+func (check WaitNoSetsNodeCheck) CheckNode(node Node) error {
+	if node.IsWait() && len(node.Sets) != 0 {
+		values := []string{}
+		for _, set := range node.Sets {
+			if set != nil && set.Arg != nil {
+				values = append(values, *set.Arg)
+			}
+		}
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "sets",
+			Values:   values,
+			Expected: "no value; wait nodes do not set job args",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type WaitHasDurationXorUntilNodeCheck struct{}
+
+/* Wait nodes must specify exactly one of 'duration' or 'until'. */
+func (check WaitHasDurationXorUntilNodeCheck) CheckNode(node Node) error {
+	if !node.IsWait() {
+		return nil
+	}
+	if node.Duration == "" && node.Until == nil {
+		return MissingValueError{
+			Node:        &node.Name,
+			Field:       "duration' or 'until",
+			Explanation: "required for wait nodes",
+		}
+	}
+	if node.Duration != "" && node.Until != nil {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "duration', 'until",
+			Values:   []string{node.Duration, *node.Until},
+			Expected: "only one of 'duration' or 'until'",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidDurationNodeCheck struct{}
+
+/* 'duration' should be a valid, positive duration. */
+func (check ValidDurationNodeCheck) CheckNode(node Node) error {
+	if node.Duration != "" {
+		if d, err := time.ParseDuration(node.Duration); err != nil || d <= 0 {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    "duration",
+				Values:   []string{node.Duration},
+				Expected: "valid duration string greater than zero",
+			}
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type NonwaitNoDurationNodeCheck struct{}
+
+/* Nonwait nodes may not specify 'duration'. */
+func (check NonwaitNoDurationNodeCheck) CheckNode(node Node) error {
+	if !node.IsWait() && node.Duration != "" {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "duration",
+			Values:   []string{node.Duration},
+			Expected: "no value; nonwait nodes may not specify duration",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type NonwaitNoUntilNodeCheck struct{}
+
+/* Nonwait nodes may not specify 'until'. */
+func (check NonwaitNoUntilNodeCheck) CheckNode(node Node) error {
+	if !node.IsWait() && node.Until != nil {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "until",
+			Values:   []string{*node.Until},
+			Expected: "no value; nonwait nodes may not specify until",
+		}
+	}
+
+	return nil
+}
+
 /* ========================================================================== */
 type RequiredArgsProvidedNodeCheck struct {
 	AllSpecs Specs
@@ -600,25 +923,44 @@ func (check RequiredArgsProvidedNodeCheck) CheckNode(node Node) error {
 		return nil
 	}
 
-	// List of sequences to check
+	// List of sequences to check. For conditional nodes, every branch is
+	// checked, and reported as "<sequence> (branch <value>)" so it's clear which
+	// branch would fail when taken.
 	sequences := getCalledSequences(node)
+	branches := map[string][]string{} // sequence -> eq values (conditional only)
+	if node.IsConditional() {
+		for value, seq := range node.Eq {
+			branches[seq] = append(branches[seq], value)
+		}
+		sort.Strings(sequences)
+	}
 
 	// Set of all (declared) inputs to a node
 	declaredArgs := getInputArgs(node)
 
 	// Check that all required args are present
 	missing := map[string][]string{} // missing arg -> list of sequences that require it
+	seen := map[string]bool{}
 	for _, sequence := range sequences {
+		if seen[sequence] {
+			continue // conditional with several branches to same sequence
+		}
+		seen[sequence] = true
 		seq, ok := check.AllSpecs.Sequences[sequence]
 		if !ok {
 			continue
 		}
+		name := seq.Name
+		if values, ok := branches[sequence]; ok {
+			sort.Strings(values)
+			name = fmt.Sprintf("%s (branch %s)", seq.Name, strings.Join(values, ", "))
+		}
 		for _, reqArg := range seq.Args.Required {
 			if reqArg == nil || reqArg.Name == nil {
 				continue
 			}
 			if _, ok = declaredArgs[*reqArg.Name]; !ok {
-				missing[*reqArg.Name] = append(missing[*reqArg.Name], seq.Name)
+				missing[*reqArg.Name] = append(missing[*reqArg.Name], name)
 			}
 		}
 	}
@@ -632,6 +974,7 @@ func (check RequiredArgsProvidedNodeCheck) CheckNode(node Node) error {
 			}
 			missingFmt = append(missingFmt, fmt.Sprintf("arg: %s, sequence%s: %s", missingArg, multipleValues, strings.Join(sequences, ",")))
 		}
+		sort.Strings(missingFmt)
 		multipleValues := ""
 		if len(missing) > 1 {
 			multipleValues = "s"
@@ -744,6 +1087,177 @@ func (check SubsequencesExistNodeCheck) CheckNode(node Node) error {
 	return nil
 }
 
+/* ========================================================================== */
+type NoDeprecatedSubsequencesNodeCheck struct {
+	AllSpecs Specs
+}
+
+/* Sequence and conditional nodes shouldn't call deprecated sequences. */
+func (check NoDeprecatedSubsequencesNodeCheck) CheckNode(node Node) error {
+	if node.IsJob() {
+		return nil
+	}
+
+	values := map[string]bool{}
+	for _, sequence := range getCalledSequences(node) {
+		seq, ok := check.AllSpecs.Sequences[sequence]
+		if !ok || seq.Deprecated == "" {
+			continue
+		}
+		values[fmt.Sprintf("%s (deprecated: %s)", sequence, seq.Deprecated)] = true
+	}
+
+	if len(values) > 0 {
+		var field string
+		if node.IsSequence() {
+			field = "type"
+		} else if node.IsConditional() {
+			field = "eq"
+		}
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    field,
+			Values:   stringSetToArray(values),
+			Expected: "subsequences that are not deprecated",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type MaxRetryPolicyNodeCheck struct {
+	Max uint
+}
+
+/* Policy: 'retry' is at most the policy max, including 'env' overrides. */
+func (check MaxRetryPolicyNodeCheck) CheckNode(node Node) error {
+	if node.Retry > check.Max {
+		return InvalidValueError{
+			Node:     &node.Name,
+			Field:    "retry",
+			Values:   []string{fmt.Sprintf("%d", node.Retry)},
+			Expected: fmt.Sprintf("at most %d (policy maxRetry)", check.Max),
+		}
+	}
+	for _, env := range node.Envs() {
+		if o := node.Env[env]; o != nil && o.Retry != nil && *o.Retry > check.Max {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    "env." + env + ".retry",
+				Values:   []string{fmt.Sprintf("%d", *o.Retry)},
+				Expected: fmt.Sprintf("at most %d (policy maxRetry)", check.Max),
+			}
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type MaxRetryWaitPolicyNodeCheck struct {
+	Max time.Duration
+}
+
+/* Policy: 'retryWait' is at most the policy max, including 'env' overrides. */
+func (check MaxRetryWaitPolicyNodeCheck) CheckNode(node Node) error {
+	retryWaits := []struct{ field, value string }{{"retryWait", node.RetryWait}}
+	for _, env := range node.Envs() {
+		if o := node.Env[env]; o != nil && o.RetryWait != nil {
+			retryWaits = append(retryWaits, struct{ field, value string }{"env." + env + ".retryWait", *o.RetryWait})
+		}
+	}
+	for _, rw := range retryWaits {
+		if rw.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(rw.value)
+		if err != nil { // Another check's problem
+			continue
+		}
+		if d > check.Max {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    rw.field,
+				Values:   []string{rw.value},
+				Expected: fmt.Sprintf("at most %s (policy maxRetryWait)", check.Max),
+			}
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type RequiredArgsPolicyNodeCheck struct {
+	RequiredArgs map[string][]string // job type pattern -> args
+}
+
+/* Policy: jobs with a type matching a pattern expect the required args. */
+func (check RequiredArgsPolicyNodeCheck) CheckNode(node Node) error {
+	if !node.IsJob() || node.NodeType == nil {
+		return nil
+	}
+
+	expected := map[string]bool{}
+	for _, arg := range node.Args {
+		if arg != nil && arg.Expected != nil {
+			expected[*arg.Expected] = true
+		}
+	}
+
+	missing := []string{}
+	patterns := []string{}
+	for pattern, args := range check.RequiredArgs {
+		if match, _ := path.Match(pattern, *node.NodeType); !match {
+			continue
+		}
+		patterns = append(patterns, pattern)
+		for _, arg := range args {
+			if !expected[arg] {
+				missing = append(missing, arg)
+			}
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		sort.Strings(patterns)
+		return MissingValueError{
+			Node:        &node.Name,
+			Field:       "args",
+			Explanation: fmt.Sprintf("policy requires job type %s (%s) to have args: %s", *node.NodeType, strings.Join(patterns, ", "), strings.Join(missing, ", ")),
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type BannedTypesPolicyNodeCheck struct {
+	BannedTypes []string // job type patterns
+}
+
+/* Policy: jobs do not have a banned type. */
+func (check BannedTypesPolicyNodeCheck) CheckNode(node Node) error {
+	if !node.IsJob() || node.NodeType == nil {
+		return nil
+	}
+
+	for _, pattern := range check.BannedTypes {
+		if match, _ := path.Match(pattern, *node.NodeType); match {
+			return InvalidValueError{
+				Node:     &node.Name,
+				Field:    "type",
+				Values:   []string{*node.NodeType},
+				Expected: fmt.Sprintf("job type not banned by policy (bannedTypes %s)", pattern),
+			}
+		}
+	}
+
+	return nil
+}
+
 /* ========================================================================== */
 // Helper functions
 
@@ -777,3 +1291,36 @@ func getInputArgs(node Node) map[string]bool {
 	}
 	return declaredArgs
 }
+
+// Get set of all job args used by a node: 'args' given (including args in
+// templates), 'each' lists, 'if', and 'until'.
+func getUsedArgs(node Node) map[string]bool {
+	used := map[string]bool{}
+	for _, nodeArg := range node.Args {
+		if nodeArg == nil {
+			continue
+		}
+		given := nodeArg.Given
+		if given == nil {
+			given = nodeArg.Expected
+		}
+		if given != nil {
+			for _, arg := range GivenArgs(*given) {
+				used[arg] = true
+			}
+		}
+	}
+	for _, each := range node.Each {
+		split := strings.Split(each, ":")
+		if len(split) == 2 {
+			used[split[0]] = true
+		}
+	}
+	if node.If != nil {
+		used[*node.If] = true
+	}
+	if node.Until != nil {
+		used[*node.Until] = true
+	}
+	return used
+}
@@ -5,6 +5,7 @@ package spec_test
 import (
 	"fmt"
 	"testing"
+	"time"
 
 	. "github.com/square/spincycle/v2/request-manager/spec"
 )
@@ -467,6 +468,58 @@ func TestFailEachIfParallelNodeCheck(t *testing.T) {
 	compareError(t, err, expectedErr, "accepted node with 'parallel' field with empty 'each' field, expected error")
 }
 
+func TestFailValidSequentialNodeCheck(t *testing.T) {
+	check := ValidSequentialNodeCheck{}
+	node := Node{
+		Name:       nodeA,
+		Sequential: true,
+	}
+	expectedErr := MissingValueError{
+		Node:  &nodeA,
+		Field: "each",
+	}
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted node with 'sequential' field with empty 'each' field, expected error")
+
+	var parallel uint = 2
+	node = Node{
+		Name:       nodeA,
+		Each:       []string{"instances:instance"},
+		Sequential: true,
+		Parallel:   &parallel,
+	}
+	expectedErr2 := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "parallel",
+		Values: []string{"2"},
+	}
+	err = check.CheckNode(node)
+	compareError(t, err, expectedErr2, "accepted node with 'sequential' and 'parallel' fields, expected error")
+
+	node = Node{
+		Name:           nodeA,
+		Each:           []string{"instances:instance"},
+		ContinueOnFail: true,
+	}
+	expectedErr2 = InvalidValueError{
+		Node:   &nodeA,
+		Field:  "continueOnFail",
+		Values: []string{"true"},
+	}
+	err = check.CheckNode(node)
+	compareError(t, err, expectedErr2, "accepted node with 'continueOnFail' field without 'sequential', expected error")
+
+	node = Node{
+		Name:           nodeA,
+		Each:           []string{"instances:instance"},
+		Sequential:     true,
+		ContinueOnFail: true,
+	}
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("got error '%s', expected nil", err)
+	}
+}
+
 func TestFailValidParallelNodeCheck(t *testing.T) {
 	check := ValidParallelNodeCheck{}
 	var parallel uint = 0
@@ -612,6 +665,309 @@ func TestFailValidRetryWaitNodeCheck(t *testing.T) {
 	compareError(t, err, expectedErr, "accepted bad retryWait: duration, expected error")
 }
 
+func TestFailValidDocsURLNodeCheck(t *testing.T) {
+	check := ValidDocsURLNodeCheck{}
+	node := Node{
+		Name:    nodeA,
+		DocsURL: testVal,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "docsUrl",
+		Values: []string{testVal},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted bad docsUrl: not a URL, expected error")
+}
+
+func TestValidEnvNodeCheck(t *testing.T) {
+	check := ValidEnvNodeCheck{}
+	job := "job"
+	retry := uint(0)
+	retryWait := "30s"
+	node := Node{
+		Name:      nodeA,
+		Category:  &job,
+		Retry:     3,
+		RetryWait: "5s",
+		Env: map[string]*NodeOverride{
+			"staging":    &NodeOverride{Retry: &retry},
+			"production": &NodeOverride{RetryWait: &retryWait},
+		},
+	}
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("error on valid env overrides: %s", err)
+	}
+}
+
+func TestFailValidEnvNodeCheck(t *testing.T) {
+	check := ValidEnvNodeCheck{}
+	job := "job"
+	retryWait := "5 minutes"
+	parallel := uint(0)
+
+	// Empty override
+	node := Node{
+		Name:     nodeA,
+		Category: &job,
+		Env:      map[string]*NodeOverride{"staging": nil},
+	}
+	err := check.CheckNode(node)
+	compareError(t, err, MissingValueError{Node: &nodeA, Field: "env.staging"}, "accepted empty env override, expected error")
+
+	// Invalid value
+	node.Env = map[string]*NodeOverride{"staging": &NodeOverride{RetryWait: &retryWait}}
+	err = check.CheckNode(node)
+	compareError(t, err, InvalidValueError{Node: &nodeA, Field: "env.staging.retryWait", Values: []string{retryWait}}, "accepted bad env retryWait, expected error")
+
+	// Field not valid for node: parallel without each
+	node.Env = map[string]*NodeOverride{"staging": &NodeOverride{Parallel: &parallel}}
+	err = check.CheckNode(node)
+	compareError(t, err, MissingValueError{Node: &nodeA, Field: "each"}, "accepted env parallel without each, expected error")
+
+	// Field not valid for node: duration in job node
+	node.Env = map[string]*NodeOverride{"staging": &NodeOverride{Duration: &retryWait}}
+	err = check.CheckNode(node)
+	compareError(t, err, InvalidValueError{Node: &nodeA, Field: "env.staging", Values: []string{"duration"}}, "accepted env duration in job node, expected error")
+
+	// Invalid value: parallel 0
+	node.Each = []string{"hosts:host"}
+	node.Env = map[string]*NodeOverride{"staging": &NodeOverride{Parallel: &parallel}}
+	err = check.CheckNode(node)
+	compareError(t, err, InvalidValueError{Node: &nodeA, Field: "env.staging.parallel", Values: []string{"0"}}, "accepted env parallel 0, expected error")
+}
+
+func TestValidArgTemplateNodeCheck(t *testing.T) {
+	check := ValidArgTemplateNodeCheck{}
+	host := "host"
+	given := "{cluster}.{region}.example.com"
+	node := Node{
+		Name: nodeA,
+		Args: []*NodeArg{
+			&NodeArg{Expected: &testVal, Given: &testVal},
+			&NodeArg{Expected: &host, Given: &given},
+		},
+	}
+
+	err := check.CheckNode(node)
+	if err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestFailValidArgTemplateNodeCheck(t *testing.T) {
+	check := ValidArgTemplateNodeCheck{}
+	host := "host"
+	given := "{cluster.example.com"
+	node := Node{
+		Name: nodeA,
+		Args: []*NodeArg{
+			&NodeArg{Expected: &host, Given: &given},
+		},
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "args.given",
+		Values: []string{given},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted invalid arg template, expected error")
+}
+
+func TestFailCostOnlyJobNodeCheck(t *testing.T) {
+	check := CostOnlyJobNodeCheck{}
+	sequence := "sequence"
+	node := Node{
+		Name:     nodeA,
+		Category: &sequence,
+		NodeType: &testVal,
+		Cost:     10,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "cost",
+		Values: []string{"10"},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted cost in sequence node, expected error")
+}
+
+func TestFailSkippableOnlyJobNodeCheck(t *testing.T) {
+	check := SkippableOnlyJobNodeCheck{}
+	sequence := "sequence"
+	node := Node{
+		Name:      nodeA,
+		Category:  &sequence,
+		NodeType:  &testVal,
+		Skippable: true,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "skippable",
+		Values: []string{"true"},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted skippable sequence node, expected error")
+}
+
+func TestFailSetsDefaultOnlySkippableNodeCheck(t *testing.T) {
+	check := SetsDefaultOnlySkippableNodeCheck{}
+	job := "job"
+	node := Node{
+		Name:     nodeA,
+		Category: &job,
+		NodeType: &testVal,
+		Sets:     []*NodeSet{{Arg: &testVal, As: &testVal, Default: "x"}},
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "sets.default",
+		Values: []string{testVal},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted sets default in node that is not skippable, expected error")
+
+	node.Skippable = true
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("got error '%s', expected nil for skippable node", err)
+	}
+}
+
+func TestFailWaitNoTypeNodeCheck(t *testing.T) {
+	check := WaitNoTypeNodeCheck{}
+	wait := "wait"
+	node := Node{
+		Name:     nodeA,
+		Category: &wait,
+		NodeType: &testVal,
+		Duration: "5m",
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "type",
+		Values: []string{testVal},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted wait node specifying a type, expected error")
+}
+
+func TestFailWaitNoSetsNodeCheck(t *testing.T) {
+	check := WaitNoSetsNodeCheck{}
+	wait := "wait"
+	node := Node{
+		Name:     nodeA,
+		Category: &wait,
+		Duration: "5m",
+		Sets:     []*NodeSet{{Arg: &testVal, As: &testVal}},
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "sets",
+		Values: []string{testVal},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted wait node with 'sets', expected error")
+}
+
+func TestFailWaitHasDurationXorUntilNodeCheck(t *testing.T) {
+	check := WaitHasDurationXorUntilNodeCheck{}
+	wait := "wait"
+
+	// Neither
+	node := Node{
+		Name:     nodeA,
+		Category: &wait,
+	}
+	expectedMissingErr := MissingValueError{
+		Node:  &nodeA,
+		Field: "duration' or 'until",
+	}
+	err := check.CheckNode(node)
+	compareError(t, err, expectedMissingErr, "accepted wait node without 'duration' or 'until', expected error")
+
+	// Both
+	node.Duration = "5m"
+	node.Until = &testVal
+	expectedInvalidErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "duration', 'until",
+		Values: []string{"5m", testVal},
+	}
+	err = check.CheckNode(node)
+	compareError(t, err, expectedInvalidErr, "accepted wait node with 'duration' and 'until', expected error")
+
+	// Only one is ok
+	node.Until = nil
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("wait node with only 'duration': got error %s, expected nil", err)
+	}
+}
+
+func TestFailValidDurationNodeCheck(t *testing.T) {
+	check := ValidDurationNodeCheck{}
+	wait := "wait"
+	for _, duration := range []string{testVal, "0s", "-5m"} {
+		node := Node{
+			Name:     nodeA,
+			Category: &wait,
+			Duration: duration,
+		}
+		expectedErr := InvalidValueError{
+			Node:   &nodeA,
+			Field:  "duration",
+			Values: []string{duration},
+		}
+
+		err := check.CheckNode(node)
+		compareError(t, err, expectedErr, "accepted bad duration: "+duration+", expected error")
+	}
+}
+
+func TestFailNonwaitNoDurationNodeCheck(t *testing.T) {
+	check := NonwaitNoDurationNodeCheck{}
+	job := "job"
+	node := Node{
+		Name:     nodeA,
+		Category: &job,
+		NodeType: &testVal,
+		Duration: "5m",
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "duration",
+		Values: []string{"5m"},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted job node with 'duration', expected error")
+}
+
+func TestFailNonwaitNoUntilNodeCheck(t *testing.T) {
+	check := NonwaitNoUntilNodeCheck{}
+	job := "job"
+	node := Node{
+		Name:     nodeA,
+		Category: &job,
+		NodeType: &testVal,
+		Until:    &testVal,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "until",
+		Values: []string{testVal},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted job node with 'until', expected error")
+}
+
 func TestFailRequiredArgsProvidedNodeCheck1(t *testing.T) {
 	seqa := "seq-a"
 	specs := Specs{
@@ -679,6 +1035,56 @@ func TestFailRequiredArgsProvidedNodeCheck2(t *testing.T) {
 	compareError(t, err, expectedErr, "not all required args to conditional sequence node listed in 'args', expected error")
 }
 
+func TestFailRequiredArgsProvidedNodeCheckBranch(t *testing.T) {
+	// Only the default branch of the conditional requires an arg that isn't
+	// given: the error names the branch and arg
+	seqa := "seq-a"
+	seqb := "seq-b"
+	reqa := "req-a"
+	reqb := "req-b"
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			seqa: &Sequence{
+				Name: seqa,
+				Args: SequenceArgs{
+					Required: []*Arg{
+						&Arg{Name: &reqa},
+					},
+				},
+			},
+			seqb: &Sequence{
+				Name: seqb,
+				Args: SequenceArgs{
+					Required: []*Arg{
+						&Arg{Name: &reqa},
+						&Arg{Name: &reqb},
+					},
+				},
+			},
+		},
+	}
+	check := RequiredArgsProvidedNodeCheck{specs}
+	conditional := "conditional"
+	node := Node{
+		Name:     nodeA,
+		Category: &conditional,
+		Eq: map[string]string{
+			"foo":     seqa,
+			"default": seqb,
+		},
+		Args: []*NodeArg{
+			&NodeArg{Expected: &reqa, Given: &reqa},
+		},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, MissingValueError{Node: &nodeA, Field: "args"}, "not all required args to conditional default branch listed in 'args', expected error")
+	expect := "required arg to sequence(s) called by node not provided: arg: req-b, sequence: seq-b (branch default)"
+	if e, ok := err.(MissingValueError); ok && e.Explanation != expect {
+		t.Errorf("got explanation %q, expected %q", e.Explanation, expect)
+	}
+}
+
 func TestFailRequiredArgsProvidedNodeCheck3(t *testing.T) {
 	seqa := "seq-a"
 	reqa := "req-a"
@@ -1037,3 +1443,157 @@ func TestFailSubsequencesExistNodeCheck2(t *testing.T) {
 	err := check.CheckNode(node)
 	compareError(t, err, expectedErr, "node calls seq that does not exist in specs, expected error")
 }
+
+func TestFailNoDeprecatedSubsequencesNodeCheck(t *testing.T) {
+	seqB := "seq-b"
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			seqA: &Sequence{
+				Name:       seqA,
+				Deprecated: "use seq-b",
+			},
+			seqB: &Sequence{
+				Name: seqB,
+			},
+		},
+	}
+	check := NoDeprecatedSubsequencesNodeCheck{specs}
+	sequence := "sequence"
+	node := Node{
+		Name:     nodeA,
+		Category: &sequence,
+		NodeType: &seqA,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "type",
+		Values: []string{seqA + " (deprecated: use seq-b)"},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "node calls deprecated seq, expected error")
+
+	node.NodeType = &seqB
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("got error '%s', expected nil for seq that is not deprecated", err)
+	}
+}
+
+func TestFailMaxRetryPolicyNodeCheck(t *testing.T) {
+	check := MaxRetryPolicyNodeCheck{Max: 3}
+	node := Node{
+		Name:  nodeA,
+		Retry: 4,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "retry",
+		Values: []string{"4"},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted retry above policy max, expected error")
+
+	node.Retry = 3
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("error on retry equal to policy max: %s", err)
+	}
+
+	// Env overrides must be within policy too
+	retry := uint(5)
+	node.Env = map[string]*NodeOverride{"production": &NodeOverride{Retry: &retry}}
+	expectedErr = InvalidValueError{
+		Node:   &nodeA,
+		Field:  "env.production.retry",
+		Values: []string{"5"},
+	}
+	err = check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted env retry above policy max, expected error")
+}
+
+func TestFailMaxRetryWaitPolicyNodeCheck(t *testing.T) {
+	check := MaxRetryWaitPolicyNodeCheck{Max: time.Minute}
+	node := Node{
+		Name:      nodeA,
+		Retry:     1,
+		RetryWait: "90s",
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "retryWait",
+		Values: []string{"90s"},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted retryWait above policy max, expected error")
+
+	node.RetryWait = "30s"
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("error on retryWait below policy max: %s", err)
+	}
+}
+
+func TestFailRequiredArgsPolicyNodeCheck(t *testing.T) {
+	check := RequiredArgsPolicyNodeCheck{
+		RequiredArgs: map[string][]string{
+			"mysql/*": {"timeout"},
+		},
+	}
+	job := "job"
+	jobType := "mysql/stop"
+	node := Node{
+		Name:     nodeA,
+		Category: &job,
+		NodeType: &jobType,
+		Args: []*NodeArg{
+			{Expected: &testVal, Given: &testVal},
+		},
+	}
+	expectedErr := MissingValueError{
+		Node:  &nodeA,
+		Field: "args",
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted job without policy required arg, expected error")
+
+	timeout := "timeout"
+	node.Args = append(node.Args, &NodeArg{Expected: &timeout, Given: &testVal})
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("error on job with policy required arg: %s", err)
+	}
+
+	// Job type doesn't match pattern
+	otherType := "redis/stop"
+	node.Args = nil
+	node.NodeType = &otherType
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("error on job type not matching policy pattern: %s", err)
+	}
+}
+
+func TestFailBannedTypesPolicyNodeCheck(t *testing.T) {
+	check := BannedTypesPolicyNodeCheck{BannedTypes: []string{"legacy/*"}}
+	job := "job"
+	jobType := "legacy/reboot"
+	node := Node{
+		Name:     nodeA,
+		Category: &job,
+		NodeType: &jobType,
+	}
+	expectedErr := InvalidValueError{
+		Node:   &nodeA,
+		Field:  "type",
+		Values: []string{jobType},
+	}
+
+	err := check.CheckNode(node)
+	compareError(t, err, expectedErr, "accepted banned job type, expected error")
+
+	// Only job types are banned, not sequence types
+	sequence := "sequence"
+	node.Category = &sequence
+	if err := check.CheckNode(node); err != nil {
+		t.Errorf("error on sequence node: %s", err)
+	}
+}
@@ -3,12 +3,18 @@
 package spec
 
 import (
+	"crypto/sha1"
+	"encoding/hex"
 	"fmt"
 	"gopkg.in/yaml.v2"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 // Parse a single request (YAML) file.
@@ -37,56 +43,291 @@ func ParseSpec(specFile string) (Specs, *CheckResult) {
 	return spec, result
 }
 
-// Read all specs file in indicated specs directory.
-// CheckResults are keyed on file name.
+// Read all specs file in indicated specs directory and its subdirectories.
+// CheckResults are keyed on file name. Specs.Version is set to a hash of the
+// relative path and contents of every spec file. Files are parsed concurrently,
+// one per CPU.
 func ParseSpecsDir(specsDir string) (Specs, *CheckResults, error) {
+	p := NewDirParser(specsDir, nil, nil)
+	p.Parallel(runtime.NumCPU())
+	return p.Parse()
+}
+
+// A DirParser parses all spec files in a specs directory and its subdirectories.
+// It caches parsed files, so subsequent calls to Parse only re-parse files that
+// were added or changed since the last call.
+//
+// Include and exclude are glob patterns (see filepath.Match) matched against
+// each file's path relative to the specs directory and against its base name.
+// If include patterns are given, only files matching one are parsed. Files and
+// directories matching an exclude pattern are skipped. Only .yaml files are
+// parsed regardless of include patterns.
+//
+// By default, files are parsed one at a time. Call Parallel to parse files
+// concurrently, which is much faster for thousands of files. Results do not
+// depend on the order in which files are parsed.
+type DirParser struct {
+	dir     string
+	include []string
+	exclude []string
+	workers int
+	cache   map[string]parsedFile // keyed on relative path
+}
+
+// A spec file parsed by a DirParser.
+type parsedFile struct {
+	modTime time.Time
+	size    int64
+	hash    []byte // of file contents
+	specs   Specs
+	result  CheckResult
+}
+
+func NewDirParser(specsDir string, include, exclude []string) *DirParser {
+	return &DirParser{
+		dir:     specsDir,
+		include: include,
+		exclude: exclude,
+		workers: 1,
+		cache:   map[string]parsedFile{},
+	}
+}
+
+// Parallel sets the number of files parsed concurrently. Values less than 1
+// are 1.
+func (p *DirParser) Parallel(n int) {
+	if n < 1 {
+		n = 1
+	}
+	p.workers = n
+}
+
+// Hash returns the hex-encoded SHA1 hash of the contents of the spec file, by
+// path relative to the specs directory, as of the last call to Parse. It returns
+// an empty string if the file was not parsed or could not be read.
+func (p *DirParser) Hash(relPath string) string {
+	return hex.EncodeToString(p.cache[relPath].hash)
+}
+
+// Parse parses all spec files, re-parsing only those that changed since the last
+// call. Return values are the same as ParseSpecsDir.
+func (p *DirParser) Parse() (Specs, *CheckResults, error) {
 	specs := Specs{
 		Sequences: map[string]*Sequence{},
 	}
 	fileResults := NewCheckResults()
 
-	seqFile := map[string]string{} // sequence name --> file it was first seen in
-	err := filepath.Walk(specsDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	files, err := p.files()
+	if err != nil {
+		return specs, fileResults, fmt.Errorf("error traversing specs directory: %s", err)
+	}
+
+	// Parse new and changed files, concurrently if enabled. Files are merged
+	// below in lexical order, so the results are the same either way.
+	parsed := make([]parsedFile, len(files))
+	todo := make(chan int, len(files))
+	for i, f := range files {
+		pf, ok := p.cache[f.relPath]
+		if ok && pf.modTime.Equal(f.info.ModTime()) && pf.size == f.info.Size() {
+			parsed[i] = pf
+			continue
 		}
-		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".yaml") {
-			return nil
+		todo <- i
+	}
+	close(todo)
+	var wg sync.WaitGroup
+	for w := 0; w < p.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range todo {
+				parsed[i] = parseFile(files[i].path, files[i].relPath, files[i].info)
+			}
+		}()
+	}
+	wg.Wait()
+
+	seqFiles := map[string][]string{} // sequence name --> files it's in, in lexical order
+	hash := sha1.New()                // files are in lexical order, so the hash is deterministic
+	cache := make(map[string]parsedFile, len(files))
+	for i, f := range files {
+		pf := parsed[i]
+		cache[f.relPath] = pf
+
+		hash.Write([]byte(f.relPath))
+		hash.Write(pf.hash)
+
+		// Copy the cached result because AddResult and AddError modify it
+		result := &CheckResult{
+			Errors:   append([]error{}, pf.result.Errors...),
+			Warnings: append([]error{}, pf.result.Warnings...),
 		}
-		relPath, err := filepath.Rel(specsDir, path)
-		if err != nil { // if we can't get the relative path, just use the full path
-			relPath = path
+		fileResults.AddResult(f.relPath, result)
+		if len(result.Errors) != 0 {
+			continue
 		}
 
-		spec, result := ParseSpec(path)
-		fileResults.AddResult(relPath, result)
-		if len(result.Errors) != 0 {
-			return nil
+		for name, spec := range pf.specs.Sequences {
+			seqFiles[name] = append(seqFiles[name], f.relPath)
+			specs.Sequences[name] = spec
 		}
+	}
+	p.cache = cache // drops removed files
 
-		// Set the file name of the sequences here. ParseSpec can't do it
-		// because it only knows the absolute path.
-		for _, seqSpec := range spec.Sequences {
-			seqSpec.Filename = relPath
+	// A sequence in more than one file is an error in every file it's in, and
+	// it's not loaded from any of them. Errors are added in sequence name order,
+	// so they're the same on every parse.
+	dupes := []string{}
+	for name, files := range seqFiles {
+		if len(files) > 1 {
+			dupes = append(dupes, name)
+		}
+	}
+	sort.Strings(dupes)
+	for _, name := range dupes {
+		err := DuplicateSequenceError{Sequence: name, Files: seqFiles[name]}
+		for _, file := range err.Files {
+			fileResults.AddError(file, err)
 		}
+		delete(specs.Sequences, name)
+	}
+	specs.Version = hex.EncodeToString(hash.Sum(nil))
 
-		for name, spec := range spec.Sequences {
-			if _, ok := seqFile[name]; ok {
-				fileResults.AddError(relPath, fmt.Errorf("sequence %s already seen in file %s", name, seqFile[name]))
-			} else {
-				specs.Sequences[name] = spec
-				seqFile[name] = relPath
-			}
+	return specs, fileResults, nil
+}
+
+// Changed returns true if any spec file was added, removed, or modified since
+// the last call to Parse.
+func (p *DirParser) Changed() (bool, error) {
+	files, err := p.files()
+	if err != nil {
+		return false, err
+	}
+	if len(files) != len(p.cache) {
+		return true, nil
+	}
+	for _, f := range files {
+		pf, ok := p.cache[f.relPath]
+		if !ok || !pf.modTime.Equal(f.info.ModTime()) || pf.size != f.info.Size() {
+			return true, nil
 		}
+	}
+	return false, nil
+}
+
+// A spec file found in the specs directory.
+type specFile struct {
+	path    string
+	relPath string
+	info    os.FileInfo
+}
 
+// files returns all spec files in lexical order, applying include and exclude.
+func (p *DirParser) files() ([]specFile, error) {
+	files := []specFile{}
+	err := filepath.Walk(p.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		relPath, err := filepath.Rel(p.dir, path)
+		if err != nil { // if we can't get the relative path, just use the full path
+			relPath = path
+		}
+		if path != p.dir && matchAny(p.exclude, relPath) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if info.IsDir() || !strings.HasSuffix(strings.ToLower(info.Name()), ".yaml") {
+			return nil
+		}
+		if len(p.include) > 0 && !matchAny(p.include, relPath) {
+			return nil
+		}
+		files = append(files, specFile{path: path, relPath: relPath, info: info})
 		return nil
 	})
+	return files, err
+}
 
-	if err != nil {
-		return specs, fileResults, fmt.Errorf("error traversing specs directory: %s", err)
+// parseFile parses one spec file for a DirParser.
+func parseFile(path, relPath string, info os.FileInfo) parsedFile {
+	pf := parsedFile{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+	}
+	if data, err := ioutil.ReadFile(path); err == nil {
+		sum := sha1.Sum(data)
+		pf.hash = sum[:]
 	}
 
-	return specs, fileResults, nil
+	spec, result := ParseSpec(path)
+	pf.result = *result
+	if len(result.Errors) != 0 {
+		return pf
+	}
+
+	// Set the file name of the sequences here. ParseSpec can't do it
+	// because it only knows the absolute path.
+	for _, seqSpec := range spec.Sequences {
+		seqSpec.Filename = relPath
+	}
+	pf.specs = spec
+	return pf
+}
+
+// matchAny returns true if the relative path or its base name matches any of
+// the glob patterns.
+func matchAny(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, relPath); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, filepath.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SetNamespaces sets the namespace of every sequence from the directory of the
+// file it was in. Dirs maps directories, relative to the specs directory, to
+// namespaces. A file is in the namespace of the longest directory that contains
+// it. Sequences in files not in a mapped directory are not in a namespace.
+func SetNamespaces(specs Specs, dirs map[string]string) {
+	for _, seq := range specs.Sequences {
+		seq.Namespace = ""
+		longest := -1
+		for dir, namespace := range dirs {
+			dir = filepath.Clean(dir)
+			if dir != "." && !strings.HasPrefix(seq.Filename, dir+string(filepath.Separator)) {
+				continue
+			}
+			if len(dir) > longest {
+				longest = len(dir)
+				seq.Namespace = namespace
+			}
+		}
+	}
+}
+
+// ApplyEnv applies the node overrides for the environment (the `env` field of
+// nodes) to every node that has them. It must be called before ProcessSpecs, which
+// sets defaults that depend on overridden fields, like retryWait. If env is empty,
+// no overrides are applied.
+func ApplyEnv(specs Specs, env string) {
+	if env == "" {
+		return
+	}
+	for _, seq := range specs.Sequences {
+		for _, node := range seq.Nodes {
+			if node == nil {
+				continue
+			}
+			*node = node.WithEnv(env)
+		}
+	}
 }
 
 // Specs require some processing after we've loaded them, but before we run the checker on them.
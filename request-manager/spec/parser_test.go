@@ -4,7 +4,11 @@ package spec_test
 
 import (
 	"gopkg.in/yaml.v2"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/go-test/deep"
 
@@ -53,6 +57,192 @@ func TestParseSpecsDir(t *testing.T) {
 	}
 }
 
+func TestParseSpecsDirVersion(t *testing.T) {
+	specsDir := specsDir + "parse-specs-dir"
+	specs1, _, err := ParseSpecsDir(specsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if specs1.Version == "" {
+		t.Fatalf("Specs.Version not set")
+	}
+	specs2, _, err := ParseSpecsDir(specsDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if specs1.Version != specs2.Version {
+		t.Errorf("got version %s then %s, expected same version for same specs", specs1.Version, specs2.Version)
+	}
+}
+
+func TestDirParserIncludeExclude(t *testing.T) {
+	specsDir := specsDir + "parse-specs-dir"
+
+	p := NewDirParser(specsDir, []string{"a-b-c.yaml", "decomm.yaml"}, []string{"decomm.yaml"})
+	specs, results, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := []string{}
+	for file := range results.Results {
+		files = append(files, file)
+	}
+	if diff := deep.Equal(files, []string{"a-b-c.yaml"}); diff != nil {
+		t.Error(diff)
+	}
+	for name, seq := range specs.Sequences {
+		if seq.Filename != "a-b-c.yaml" {
+			t.Errorf("sequence %s from file %s, expected only sequences from a-b-c.yaml", name, seq.Filename)
+		}
+	}
+}
+
+func TestDirParserParallel(t *testing.T) {
+	specsDir := specsDir + "parse-specs-dir"
+
+	specs1, results1, err := NewDirParser(specsDir, nil, nil).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewDirParser(specsDir, nil, nil)
+	p.Parallel(4)
+	specs2, results2, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if specs1.Version != specs2.Version {
+		t.Errorf("got version %s in parallel, expected %s", specs2.Version, specs1.Version)
+	}
+	if diff := deep.Equal(specs1.Sequences, specs2.Sequences); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(results1, results2); diff != nil {
+		t.Error(diff)
+	}
+	if p.Hash("a-b-c.yaml") == "" {
+		t.Errorf("no hash for a-b-c.yaml, expected hash of parsed file")
+	}
+	if p.Hash("nonexistent.yaml") != "" {
+		t.Errorf("got hash for file not parsed, expected empty string")
+	}
+}
+
+func TestDirParserDuplicateSequences(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spec-dir-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"a.yaml":     "sequences:\n  seq-a:\n    request: true\n  seq-b:\n    request: true\n",
+		"b.yaml":     "sequences:\n  seq-b:\n    request: true\n  seq-c:\n    request: true\n",
+		"sub/c.yaml": "sequences:\n  seq-b:\n    request: true\n  seq-a:\n    request: true\n",
+	}
+	for file, content := range files {
+		path := filepath.Join(dir, file)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Every file with a duplicate sequence has an error for each one, listing
+	// all its files, in the same order every time
+	expect := map[string][]error{
+		"a.yaml": {
+			DuplicateSequenceError{Sequence: "seq-a", Files: []string{"a.yaml", "sub/c.yaml"}},
+			DuplicateSequenceError{Sequence: "seq-b", Files: []string{"a.yaml", "b.yaml", "sub/c.yaml"}},
+		},
+		"b.yaml": {
+			DuplicateSequenceError{Sequence: "seq-b", Files: []string{"a.yaml", "b.yaml", "sub/c.yaml"}},
+		},
+		"sub/c.yaml": {
+			DuplicateSequenceError{Sequence: "seq-a", Files: []string{"a.yaml", "sub/c.yaml"}},
+			DuplicateSequenceError{Sequence: "seq-b", Files: []string{"a.yaml", "b.yaml", "sub/c.yaml"}},
+		},
+	}
+	for i := 0; i < 5; i++ {
+		p := NewDirParser(dir, nil, nil)
+		p.Parallel(3)
+		specs, results, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !results.AnyError {
+			t.Fatal("AnyError false, expected true")
+		}
+		got := map[string][]error{}
+		for file, result := range results.Results {
+			got[file] = result.Errors
+		}
+		if diff := deep.Equal(got, expect); diff != nil {
+			t.Fatal(diff)
+		}
+		if _, ok := specs.Sequences["seq-c"]; !ok || len(specs.Sequences) != 1 {
+			t.Errorf("got sequences %v, expected only seq-c", specs.Sequences)
+		}
+	}
+
+	err = DuplicateSequenceError{Sequence: "seq-a", Files: []string{"a.yaml", "sub/c.yaml"}}
+	if err.Error() != "sequence seq-a defined in 2 files: a.yaml, sub/c.yaml" {
+		t.Errorf("got error '%s'", err)
+	}
+}
+
+func TestDirParserChanged(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spec-dir-parser")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "seq.yaml")
+	if err := ioutil.WriteFile(file, []byte("sequences:\n  seq-a:\n    request: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewDirParser(dir, nil, nil)
+	specs1, _, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := specs1.Sequences["seq-a"]; !ok {
+		t.Fatalf("seq-a not parsed")
+	}
+	changed, err := p.Changed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed {
+		t.Errorf("Changed returned true, expected false before any change")
+	}
+
+	if err := ioutil.WriteFile(file, []byte("sequences:\n  seq-b:\n    request: true\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Second) // ensure mod time differs
+	os.Chtimes(file, later, later)
+	changed, err = p.Changed()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !changed {
+		t.Fatalf("Changed returned false, expected true after file changed")
+	}
+
+	specs2, _, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := specs2.Sequences["seq-b"]; !ok {
+		t.Errorf("seq-b not parsed after file changed")
+	}
+	if specs1.Version == specs2.Version {
+		t.Errorf("version did not change after file changed")
+	}
+}
+
 func TestFailParseSpecsDir(t *testing.T) {
 	specsDir := specsDir + "fail-parse-specs-dir"
 	_, results, _ := ParseSpecsDir(specsDir)
@@ -61,6 +251,94 @@ func TestFailParseSpecsDir(t *testing.T) {
 	}
 }
 
+func TestSetNamespaces(t *testing.T) {
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			"global":   &Sequence{Filename: "global.yaml"},
+			"payments": &Sequence{Filename: "payments/refund.yaml"},
+			"ledger":   &Sequence{Filename: "payments/ledger/close.yaml"},
+			"other":    &Sequence{Filename: "paymentsx/other.yaml"},
+		},
+	}
+	SetNamespaces(specs, map[string]string{
+		"payments":         "payments",
+		"payments/ledger/": "ledger",
+	})
+	expect := map[string]string{
+		"global":   "",
+		"payments": "payments",
+		"ledger":   "ledger", // longest dir
+		"other":    "",       // not in payments/
+	}
+	for name, seq := range specs.Sequences {
+		if seq.Namespace != expect[name] {
+			t.Errorf("sequence %s in namespace '%s', expected '%s'", name, seq.Namespace, expect[name])
+		}
+	}
+
+	// No dirs: no namespaces
+	SetNamespaces(specs, nil)
+	for name, seq := range specs.Sequences {
+		if seq.Namespace != "" {
+			t.Errorf("sequence %s in namespace '%s', expected none", name, seq.Namespace)
+		}
+	}
+}
+
+func TestApplyEnv(t *testing.T) {
+	job := "job"
+	retry := uint(0)
+	retryWait := "30s"
+	newSpecs := func() Specs {
+		return Specs{
+			Sequences: map[string]*Sequence{
+				"seq-a": &Sequence{
+					Nodes: map[string]*Node{
+						"node-a": &Node{
+							Category:  &job,
+							Retry:     3,
+							RetryWait: "5s",
+							Env: map[string]*NodeOverride{
+								"staging":    &NodeOverride{Retry: &retry},
+								"production": &NodeOverride{RetryWait: &retryWait},
+							},
+						},
+						"node-b": &Node{Category: &job, Retry: 1},
+					},
+				},
+			},
+		}
+	}
+
+	// Only the overrides for the env are applied; other fields are unchanged
+	specs := newSpecs()
+	ApplyEnv(specs, "production")
+	nodeA := specs.Sequences["seq-a"].Nodes["node-a"]
+	if nodeA.Retry != 3 || nodeA.RetryWait != "30s" {
+		t.Errorf("node-a retry %d, retryWait %s; expected 3, 30s", nodeA.Retry, nodeA.RetryWait)
+	}
+	if specs.Sequences["seq-a"].Nodes["node-b"].Retry != 1 {
+		t.Errorf("node-b changed, expected no change because it has no overrides")
+	}
+
+	specs = newSpecs()
+	ApplyEnv(specs, "staging")
+	nodeA = specs.Sequences["seq-a"].Nodes["node-a"]
+	if nodeA.Retry != 0 || nodeA.RetryWait != "5s" {
+		t.Errorf("node-a retry %d, retryWait %s; expected 0, 5s", nodeA.Retry, nodeA.RetryWait)
+	}
+
+	// No env or an env without overrides: no change
+	for _, env := range []string{"", "dev"} {
+		specs = newSpecs()
+		ApplyEnv(specs, env)
+		nodeA = specs.Sequences["seq-a"].Nodes["node-a"]
+		if nodeA.Retry != 3 || nodeA.RetryWait != "5s" {
+			t.Errorf("env '%s': node-a retry %d, retryWait %s; expected 3, 5s", env, nodeA.Retry, nodeA.RetryWait)
+		}
+	}
+}
+
 func TestProcessSpecs(t *testing.T) {
 	requiredA := "required-a"
 	optionalA := "optional-a"
@@ -0,0 +1,94 @@
+// Copyright 2020, Square, Inc.
+
+package spec
+
+import (
+	"fmt"
+	"path/filepath"
+	"plugin"
+	"sort"
+	"strings"
+
+	"github.com/square/spincycle/v2/version"
+)
+
+// CHECK_PLUGIN_SYMBOL is the name of the CheckPlugin variable that a Go plugin
+// of custom spec checks exports.
+const CHECK_PLUGIN_SYMBOL = "Checks"
+
+// CheckPlugin is a set of custom spec checks, usually exported by a Go plugin,
+// that the linter runs alongside the built-in checks (spinc-linter --check-plugins).
+// A Go plugin must export a CheckPlugin variable named CHECK_PLUGIN_SYMBOL:
+//
+//	package main
+//
+//	var Checks = spec.CheckPlugin{
+//	  Name:             "acme-checks",
+//	  SpincycleVersion: version.VERSION,
+//	  Factory: func(allSpecs spec.Specs) spec.CheckFactory {
+//	    return acme.CheckFactory{AllSpecs: allSpecs}
+//	  },
+//	}
+//
+// and be built with "go build -buildmode=plugin" against the same Spin Cycle
+// version and Go toolchain as the linter. Checks can implement CheckName() string
+// to name the check in linter summaries; else the check type name is used.
+type CheckPlugin struct {
+	Name             string                            // plugin name, like "acme-checks"
+	SpincycleVersion string                            // Spin Cycle version (version.VERSION) the plugin was built with
+	Factory          func(allSpecs Specs) CheckFactory // makes the checks for all specs
+}
+
+// LoadCheckPlugins opens every Go plugin (*.so file) in dir and returns their
+// CheckPlugin, sorted by file name. It returns the first error: a file that is
+// not a Go plugin, a plugin without CHECK_PLUGIN_SYMBOL, or a plugin that is
+// invalid or not compatible with this version of Spin Cycle.
+func LoadCheckPlugins(dir string) ([]CheckPlugin, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.so"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	plugins := make([]CheckPlugin, 0, len(files))
+	for _, file := range files {
+		p, err := plugin.Open(file)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open plugin %s: %s", file, err)
+		}
+		sym, err := p.Lookup(CHECK_PLUGIN_SYMBOL)
+		if err != nil {
+			return nil, fmt.Errorf("plugin %s: %s", file, err)
+		}
+		checks, ok := sym.(*CheckPlugin)
+		if !ok {
+			return nil, fmt.Errorf("plugin %s: %s is type %T, expected spec.CheckPlugin", file, CHECK_PLUGIN_SYMBOL, sym)
+		}
+		if err := checks.Validate(); err != nil {
+			return nil, fmt.Errorf("%s (%s)", err, file)
+		}
+		plugins = append(plugins, *checks)
+	}
+	return plugins, nil
+}
+
+// Validate returns an error if the plugin has no name or factory, or it was
+// built with a Spin Cycle version that has a different major version.
+func (p CheckPlugin) Validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("plugin name is empty")
+	}
+	if p.Factory == nil {
+		return fmt.Errorf("plugin %s: Factory is nil", p.Name)
+	}
+	if p.SpincycleVersion == "" {
+		return fmt.Errorf("plugin %s: SpincycleVersion is empty, set it to version.VERSION", p.Name)
+	}
+	if major(p.SpincycleVersion) != major(version.VERSION) {
+		return fmt.Errorf("plugin %s: built with Spin Cycle %s, which is not compatible with Spin Cycle %s", p.Name, p.SpincycleVersion, version.VERSION)
+	}
+	return nil
+}
+
+func major(v string) string {
+	return strings.SplitN(strings.TrimPrefix(v, "v"), ".", 2)[0]
+}
@@ -0,0 +1,56 @@
+// Copyright 2020, Square, Inc.
+
+package spec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	. "github.com/square/spincycle/v2/request-manager/spec"
+	"github.com/square/spincycle/v2/version"
+)
+
+func TestCheckPluginValidate(t *testing.T) {
+	factory := func(allSpecs Specs) CheckFactory { return BaseCheckFactory{allSpecs} }
+	p := CheckPlugin{Name: "acme", SpincycleVersion: version.VERSION, Factory: factory}
+	if err := p.Validate(); err != nil {
+		t.Errorf("got error %s, expected nil", err)
+	}
+	for _, p := range []CheckPlugin{
+		{SpincycleVersion: version.VERSION, Factory: factory},
+		{Name: "acme", SpincycleVersion: version.VERSION},
+		{Name: "acme", Factory: factory},
+		{Name: "acme", SpincycleVersion: "1.0.0", Factory: factory},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("no error for invalid plugin %+v, expected an error", p)
+		}
+	}
+}
+
+func TestLoadCheckPlugins(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spec-check-plugins")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// No plugins
+	plugins, err := LoadCheckPlugins(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plugins) != 0 {
+		t.Errorf("got %d plugins, expected 0", len(plugins))
+	}
+
+	// A file that's not a Go plugin
+	if err := ioutil.WriteFile(filepath.Join(dir, "bad.so"), []byte("not a plugin"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCheckPlugins(dir); err == nil {
+		t.Error("no error loading invalid plugin, expected an error")
+	}
+}
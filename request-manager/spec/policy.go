@@ -0,0 +1,175 @@
+// Copyright 2020, Square, Inc.
+
+package spec
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// A Policy is an organization policy for request specs: standards that specs
+// must meet beyond being valid. The linter enforces a policy file (--policy) so
+// platform teams can gate spec changes on it. Zero values are not enforced.
+// Job type patterns are path.Match patterns, like "mysql/*".
+//
+// Example policy file:
+//
+//	maxRetry: 5
+//	maxRetryWait: 5m
+//	requiredArgs:
+//	  mysql/*: [timeout]
+//	bannedTypes:
+//	  - legacy/*
+//	requireACL: true
+//	requireDescription: true
+//	maxJobs: 10000
+//	rules:
+//	  - name: no-password-args
+//	    on: node
+//	    expect: '{{not (has .Args "password")}}'
+//	    message: pass secrets by reference, not as job args
+//
+// Rules are custom checks (see Rule).
+type Policy struct {
+	MaxRetry           *uint               `yaml:"maxRetry"`           // max node retry
+	MaxRetryWait       string              `yaml:"maxRetryWait"`       // max node retryWait, like "5m"
+	RequiredArgs       map[string][]string `yaml:"requiredArgs"`       // job type pattern -> args that matching jobs must expect, like timeout
+	BannedTypes        []string            `yaml:"bannedTypes"`        // job type patterns that nodes must not use
+	RequireACL         bool                `yaml:"requireACL"`         // request sequences must have an acl
+	RequireDescription bool                `yaml:"requireDescription"` // request sequences must have a description
+	MaxJobs            uint64              `yaml:"maxJobs"`            // max jobs in the worst-case job chain of a request (EstimateChainSize)
+	Rules              []Rule              `yaml:"rules"`              // custom checks
+}
+
+// LoadPolicy loads and validates a policy file.
+func LoadPolicy(file string) (Policy, error) {
+	var p Policy
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return p, err
+	}
+	if err := yaml.UnmarshalStrict(bytes, &p); err != nil {
+		return p, fmt.Errorf("%s: %s", file, err)
+	}
+	if err := p.Validate(); err != nil {
+		return p, fmt.Errorf("%s: %s", file, err)
+	}
+	return p, nil
+}
+
+// Validate returns an error if the policy is invalid.
+func (p Policy) Validate() error {
+	if p.MaxRetryWait != "" {
+		if _, err := time.ParseDuration(p.MaxRetryWait); err != nil {
+			return fmt.Errorf("invalid maxRetryWait: %s", err)
+		}
+	}
+	for pattern := range p.RequiredArgs {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid requiredArgs job type pattern %s: %s", pattern, err)
+		}
+	}
+	for _, pattern := range p.BannedTypes {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid bannedTypes job type pattern %s: %s", pattern, err)
+		}
+	}
+	names := map[string]bool{}
+	for _, rule := range p.Rules {
+		if _, _, err := rule.compile(); err != nil {
+			return err
+		}
+		if names[rule.Name] {
+			return fmt.Errorf("duplicate rule name %s", rule.Name)
+		}
+		names[rule.Name] = true
+	}
+	return nil
+}
+
+// rules returns checks for the rules on sequences or nodes that are warnings or
+// errors. Rules must be valid (Validate).
+func (p Policy) rules(on string, warning bool) []ruleCheck {
+	checks := []ruleCheck{}
+	for _, rule := range p.Rules {
+		if rule.On != on || rule.Warning != warning {
+			continue
+		}
+		check, err := newRuleCheck(rule)
+		if err != nil {
+			continue // validated
+		}
+		checks = append(checks, check)
+	}
+	return checks
+}
+
+// Checks that enforce a policy. Policy violations are errors.
+type PolicyCheckFactory struct {
+	Policy   Policy
+	AllSpecs Specs // All specs in specs dir, for maxJobs
+}
+
+func (c PolicyCheckFactory) MakeSequenceErrorChecks() ([]SequenceCheck, error) {
+	if err := c.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	checks := []SequenceCheck{}
+	if c.Policy.RequireACL {
+		checks = append(checks, ACLRequiredPolicySequenceCheck{})
+	}
+	if c.Policy.RequireDescription {
+		checks = append(checks, DescriptionRequiredPolicySequenceCheck{})
+	}
+	if c.Policy.MaxJobs > 0 {
+		checks = append(checks, MaxJobsPolicySequenceCheck{AllSpecs: c.AllSpecs, Max: c.Policy.MaxJobs})
+	}
+	for _, check := range c.Policy.rules(RULE_ON_SEQUENCE, false) {
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (c PolicyCheckFactory) MakeSequenceWarningChecks() ([]SequenceCheck, error) {
+	checks := []SequenceCheck{}
+	for _, check := range c.Policy.rules(RULE_ON_SEQUENCE, true) {
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (c PolicyCheckFactory) MakeNodeErrorChecks() ([]NodeCheck, error) {
+	if err := c.Policy.Validate(); err != nil {
+		return nil, err
+	}
+	checks := []NodeCheck{}
+	if c.Policy.MaxRetry != nil {
+		checks = append(checks, MaxRetryPolicyNodeCheck{*c.Policy.MaxRetry})
+	}
+	if c.Policy.MaxRetryWait != "" {
+		max, _ := time.ParseDuration(c.Policy.MaxRetryWait) // validated above
+		checks = append(checks, MaxRetryWaitPolicyNodeCheck{max})
+	}
+	if len(c.Policy.RequiredArgs) > 0 {
+		checks = append(checks, RequiredArgsPolicyNodeCheck{c.Policy.RequiredArgs})
+	}
+	if len(c.Policy.BannedTypes) > 0 {
+		checks = append(checks, BannedTypesPolicyNodeCheck{c.Policy.BannedTypes})
+	}
+	for _, check := range c.Policy.rules(RULE_ON_NODE, false) {
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
+
+func (c PolicyCheckFactory) MakeNodeWarningChecks() ([]NodeCheck, error) {
+	checks := []NodeCheck{}
+	for _, check := range c.Policy.rules(RULE_ON_NODE, true) {
+		checks = append(checks, check)
+	}
+	return checks, nil
+}
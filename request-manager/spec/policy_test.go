@@ -0,0 +1,105 @@
+// Copyright 2020, Square, Inc.
+
+package spec_test
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	. "github.com/square/spincycle/v2/request-manager/spec"
+)
+
+func writePolicy(t *testing.T, yaml string) string {
+	f, err := ioutil.TempFile("", "spec-policy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(yaml)
+	f.Close()
+	return f.Name()
+}
+
+func TestLoadPolicy(t *testing.T) {
+	file := writePolicy(t, `
+maxRetry: 3
+maxRetryWait: 5m
+requiredArgs:
+  mysql/*: [timeout]
+bannedTypes:
+  - legacy/*
+requireACL: true
+requireDescription: true
+maxJobs: 10000
+`)
+	defer os.Remove(file)
+
+	policy, err := LoadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	maxRetry := uint(3)
+	expect := Policy{
+		MaxRetry:           &maxRetry,
+		MaxRetryWait:       "5m",
+		RequiredArgs:       map[string][]string{"mysql/*": {"timeout"}},
+		BannedTypes:        []string{"legacy/*"},
+		RequireACL:         true,
+		RequireDescription: true,
+		MaxJobs:            10000,
+	}
+	if diff := deep.Equal(policy, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// All checks enabled
+	checker, err := NewChecker([]CheckFactory{PolicyCheckFactory{Policy: policy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			seqA: &Sequence{
+				Name:    seqA,
+				Request: true,
+				Nodes: map[string]*Node{
+					nodeA: &Node{
+						Name:     nodeA,
+						Category: strPtr("job"),
+						NodeType: strPtr("legacy/reboot"),
+						Retry:    5,
+					},
+				},
+			},
+		},
+	}
+	results := checker.RunChecks(specs)
+	if !results.AnyError {
+		t.Fatalf("no policy errors, expected errors")
+	}
+	// acl, description, retry, and banned type; there are no mysql/* jobs
+	if len(results.Results[seqA].Errors) != 4 {
+		t.Errorf("got %d policy errors, expected 4: %v", len(results.Results[seqA].Errors), results.Results[seqA].Errors)
+	}
+}
+
+func TestLoadPolicyInvalid(t *testing.T) {
+	for _, yaml := range []string{
+		"maxRetryWait: soon\n",
+		"bannedTypes: [\"[\"]\n",
+		"maxRetries: 3\n", // unknown field
+	} {
+		file := writePolicy(t, yaml)
+		_, err := LoadPolicy(file)
+		os.Remove(file)
+		if err == nil {
+			t.Errorf("no error loading invalid policy %q", yaml)
+		}
+	}
+}
+
+func strPtr(s string) *string {
+	return &s
+}
@@ -0,0 +1,131 @@
+// Copyright 2020, Square, Inc.
+
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+// PropagateErrors adds an error to every sequence that calls a sequence with
+// errors, directly or through other sequences, because it cannot be built either.
+// Graph checks do this, but static checks do not.
+func PropagateErrors(seqs map[string]*Sequence, results *CheckResults) {
+	for {
+		added := false
+		names := make([]string, 0, len(seqs))
+		for name := range seqs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if hasErrors(results, name) {
+				continue
+			}
+			failed := []string{}
+			for _, subseq := range subsequences(seqs[name], seqs) {
+				if hasErrors(results, subseq) {
+					failed = append(failed, subseq)
+				}
+			}
+			if len(failed) == 0 {
+				continue
+			}
+			multiple := ""
+			if len(failed) > 1 {
+				multiple = "s"
+			}
+			results.AddError(name, fmt.Errorf("subsequence%s failed checks: %s", multiple, strings.Join(failed, ", ")))
+			added = true
+		}
+		if !added {
+			return
+		}
+	}
+}
+
+// NewReport returns the spec report of the specs. fileResults are the results
+// of parsing the spec files, and seqResults are the results of static and graph
+// checks. Request sequences with errors are unbuildable.
+func NewReport(specs Specs, fileResults, seqResults *CheckResults) proto.SpecReport {
+	report := proto.SpecReport{
+		SpecVersion: specs.Version,
+		CheckedAt:   time.Now().UTC(),
+		Files:       reportResults(fileResults),
+		Sequences:   reportResults(seqResults),
+		Unbuildable: []string{},
+	}
+	for name, seq := range specs.Sequences {
+		if seq.Request && hasErrors(seqResults, name) {
+			report.Unbuildable = append(report.Unbuildable, name)
+		}
+	}
+	sort.Strings(report.Unbuildable)
+	return report
+}
+
+func reportResults(results *CheckResults) map[string]proto.SpecCheckResult {
+	r := map[string]proto.SpecCheckResult{}
+	if results == nil {
+		return r
+	}
+	for key, result := range results.Results {
+		if len(result.Errors) == 0 && len(result.Warnings) == 0 {
+			continue
+		}
+		r[key] = proto.SpecCheckResult{
+			Errors:   errorStrings(result.Errors),
+			Warnings: errorStrings(result.Warnings),
+		}
+	}
+	return r
+}
+
+func errorStrings(errs []error) []string {
+	if len(errs) == 0 {
+		return nil
+	}
+	s := make([]string, len(errs))
+	for i, err := range errs {
+		s[i] = err.Error()
+	}
+	return s
+}
+
+func hasErrors(results *CheckResults, key string) bool {
+	if results == nil {
+		return false
+	}
+	result, ok := results.Get(key)
+	return ok && len(result.Errors) > 0
+}
+
+// subsequences returns the sequences that the sequence calls: the type of
+// sequence nodes and the sequences of conditional nodes.
+func subsequences(seq *Sequence, seqs map[string]*Sequence) []string {
+	set := map[string]bool{}
+	for _, node := range seq.Nodes {
+		if node == nil {
+			continue
+		}
+		if node.IsSequence() && node.NodeType != nil {
+			set[*node.NodeType] = true
+		} else if node.IsConditional() {
+			for _, s := range node.Eq {
+				if _, ok := seqs[s]; ok {
+					set[s] = true
+				}
+			}
+		}
+	}
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,106 @@
+// Copyright 2020, Square, Inc.
+
+package spec_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	. "github.com/square/spincycle/v2/request-manager/spec"
+)
+
+// reportSpecs returns specs where request req1 calls seq-a, which calls seq-b
+// in a conditional node, and request req2 calls only jobs.
+func reportSpecs() Specs {
+	jobCategory, seqCategory, condCategory := "job", "sequence", "conditional"
+	subseq, jobType := "seq-a", "job-type"
+	return Specs{
+		Version: "v1",
+		Sequences: map[string]*Sequence{
+			"req1": {
+				Name:    "req1",
+				Request: true,
+				Nodes: map[string]*Node{
+					"n1": {Name: "n1", Category: &seqCategory, NodeType: &subseq},
+				},
+			},
+			"seq-a": {
+				Name: "seq-a",
+				Nodes: map[string]*Node{
+					"n1": {Name: "n1", Category: &condCategory, Eq: map[string]string{"x": "seq-b", "default": "noop"}},
+				},
+			},
+			"seq-b": {
+				Name: "seq-b",
+				Nodes: map[string]*Node{
+					"n1": {Name: "n1", Category: &jobCategory, NodeType: &jobType},
+				},
+			},
+			"req2": {
+				Name:    "req2",
+				Request: true,
+				Nodes: map[string]*Node{
+					"n1": {Name: "n1", Category: &jobCategory, NodeType: &jobType},
+				},
+			},
+		},
+	}
+}
+
+func TestPropagateErrors(t *testing.T) {
+	specs := reportSpecs()
+	results := NewCheckResults()
+	results.AddError("seq-b", fmt.Errorf("bad"))
+	results.AddWarning("req2", fmt.Errorf("meh"))
+	PropagateErrors(specs.Sequences, results)
+
+	got := map[string][]string{}
+	for name, result := range results.Results {
+		for _, err := range result.Errors {
+			got[name] = append(got[name], err.Error())
+		}
+	}
+	expect := map[string][]string{
+		"seq-b": {"bad"},
+		"seq-a": {"subsequence failed checks: seq-b"},
+		"req1":  {"subsequence failed checks: seq-a"},
+	}
+	if diff := deep.Equal(got, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestNewReport(t *testing.T) {
+	specs := reportSpecs()
+	fileResults := NewCheckResults()
+	fileResults.AddWarning("seqs.yaml", fmt.Errorf("unknown field"))
+	seqResults := NewCheckResults()
+	seqResults.AddError("seq-b", fmt.Errorf("bad"))
+	seqResults.AddWarning("req2", fmt.Errorf("meh"))
+	PropagateErrors(specs.Sequences, seqResults)
+
+	report := NewReport(specs, fileResults, seqResults)
+	if report.CheckedAt.IsZero() {
+		t.Errorf("CheckedAt not set")
+	}
+	expect := proto.SpecReport{
+		SpecVersion: "v1",
+		CheckedAt:   report.CheckedAt,
+		Files: map[string]proto.SpecCheckResult{
+			"seqs.yaml": {Warnings: []string{"unknown field"}},
+		},
+		Sequences: map[string]proto.SpecCheckResult{
+			"seq-b": {Errors: []string{"bad"}},
+			"seq-a": {Errors: []string{"subsequence failed checks: seq-b"}},
+			"req1":  {Errors: []string{"subsequence failed checks: seq-a"}},
+			"req2":  {Warnings: []string{"meh"}},
+		},
+		Unbuildable: []string{"req1"},
+	}
+	if diff := deep.Equal(report, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,255 @@
+// Copyright 2020, Square, Inc.
+
+package spec
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// A Rule is a custom check in a policy file (i.e. the `rules` field), so an
+// organization can enforce its own conventions without writing Go. If and Expect
+// are Go text/template expressions that must render "true" or "false". The rule
+// applies to every sequence or node (On) for which If is true, or to all of them
+// if If is empty, and fails if Expect is false. For example:
+//
+//	rules:
+//	  - name: request-names
+//	    on: sequence
+//	    if: '{{.Request}}'
+//	    expect: '{{match "^[a-z][a-z0-9-]*$" .Name}}'
+//	    message: request names must be lowercase, like stop-container
+//
+// Templates have the functions of text/template plus hasPrefix, hasSuffix, and
+// contains (from package strings), match (regexp.MatchString), and has (list
+// contains string). See RuleSequence and RuleNode for the data of each.
+type Rule struct {
+	Name    string `yaml:"name"`    // unique rule name, reported as the check name
+	On      string `yaml:"on"`      // RULE_ON_SEQUENCE or RULE_ON_NODE
+	If      string `yaml:"if"`      // template, rule applies if true (optional, default all)
+	Expect  string `yaml:"expect"`  // template, rule fails if false
+	Message string `yaml:"message"` // error message if the rule fails (optional)
+	Warning bool   `yaml:"warning"` // rule failures are warnings, not errors
+}
+
+const (
+	RULE_ON_SEQUENCE = "sequence"
+	RULE_ON_NODE     = "node"
+)
+
+// RuleSequence is the data of a sequence rule template.
+type RuleSequence struct {
+	Name        string
+	Namespace   string
+	Filename    string
+	Request     bool
+	Description string
+	Deprecated  string
+	Args        []string // names of required, optional, and static args
+	Nodes       []string // node names, sorted
+	JobTypes    []string // types of job nodes, sorted and unique
+	ACLRoles    []string // acl roles
+}
+
+// RuleNode is the data of a node rule template.
+type RuleNode struct {
+	Name        string
+	Category    string
+	Type        string
+	Args        []string // expected job args
+	Sets        []string // job args set (sets: as)
+	Each        []string
+	Retry       uint
+	RetryWait   string
+	Description string
+}
+
+var ruleFuncs = template.FuncMap{
+	"hasPrefix": strings.HasPrefix,
+	"hasSuffix": strings.HasSuffix,
+	"contains":  strings.Contains,
+	"match":     regexp.MatchString,
+	"has": func(list []string, s string) bool {
+		for _, v := range list {
+			if v == s {
+				return true
+			}
+		}
+		return false
+	},
+}
+
+// compile returns the parsed If (nil if empty) and Expect templates, or an error
+// if the rule is invalid.
+func (r Rule) compile() (cond, expect *template.Template, err error) {
+	if r.Name == "" {
+		return nil, nil, fmt.Errorf("rule name is empty")
+	}
+	if r.On != RULE_ON_SEQUENCE && r.On != RULE_ON_NODE {
+		return nil, nil, fmt.Errorf("rule %s: invalid on %q, expected %s or %s", r.Name, r.On, RULE_ON_SEQUENCE, RULE_ON_NODE)
+	}
+	if r.Expect == "" {
+		return nil, nil, fmt.Errorf("rule %s: expect is empty", r.Name)
+	}
+	if r.If != "" {
+		if cond, err = template.New("if").Funcs(ruleFuncs).Option("missingkey=error").Parse(r.If); err != nil {
+			return nil, nil, fmt.Errorf("rule %s: invalid if: %s", r.Name, err)
+		}
+	}
+	if expect, err = template.New("expect").Funcs(ruleFuncs).Option("missingkey=error").Parse(r.Expect); err != nil {
+		return nil, nil, fmt.Errorf("rule %s: invalid expect: %s", r.Name, err)
+	}
+	return cond, expect, nil
+}
+
+// ruleCheck evaluates one rule. It's a SequenceCheck or NodeCheck depending on
+// Rule.On, and its check name is "rule:" + Rule.Name.
+type ruleCheck struct {
+	rule   Rule
+	cond   *template.Template
+	expect *template.Template
+}
+
+// newRuleCheck returns a check that evaluates the rule, or an error if the rule
+// is invalid.
+func newRuleCheck(rule Rule) (ruleCheck, error) {
+	cond, expect, err := rule.compile()
+	if err != nil {
+		return ruleCheck{}, err
+	}
+	return ruleCheck{rule: rule, cond: cond, expect: expect}, nil
+}
+
+func (check ruleCheck) CheckName() string {
+	return "rule:" + check.rule.Name
+}
+
+func (check ruleCheck) CheckSequence(sequence Sequence) error {
+	return check.eval(ruleSequence(sequence))
+}
+
+func (check ruleCheck) CheckNode(node Node) error {
+	if err := check.eval(ruleNode(node)); err != nil {
+		return fmt.Errorf("node %s: %s", node.Name, err)
+	}
+	return nil
+}
+
+func (check ruleCheck) eval(data interface{}) error {
+	if check.cond != nil {
+		ok, err := evalBool(check.cond, data)
+		if err != nil {
+			return fmt.Errorf("rule %s: if: %s", check.rule.Name, err)
+		}
+		if !ok {
+			return nil
+		}
+	}
+	ok, err := evalBool(check.expect, data)
+	if err != nil {
+		return fmt.Errorf("rule %s: expect: %s", check.rule.Name, err)
+	}
+	if ok {
+		return nil
+	}
+	msg := check.rule.Message
+	if msg == "" {
+		msg = "expected " + check.rule.Expect
+	}
+	return fmt.Errorf("rule %s: %s", check.rule.Name, msg)
+}
+
+// evalBool executes the template and returns true if it renders "true" or false
+// if it renders "false" (ignoring surrounding space), else an error.
+func evalBool(t *template.Template, data interface{}) (bool, error) {
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return false, err
+	}
+	switch strings.TrimSpace(buf.String()) {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	}
+	return false, fmt.Errorf("rendered %q, expected true or false", buf.String())
+}
+
+func ruleSequence(seq Sequence) RuleSequence {
+	rs := RuleSequence{
+		Name:        seq.Name,
+		Namespace:   seq.Namespace,
+		Filename:    seq.Filename,
+		Request:     seq.Request,
+		Description: seq.Description,
+		Deprecated:  seq.Deprecated,
+		Args:        []string{},
+		Nodes:       []string{},
+		JobTypes:    []string{},
+		ACLRoles:    []string{},
+	}
+	for _, args := range [][]*Arg{seq.Args.Required, seq.Args.Optional, seq.Args.Static} {
+		for _, arg := range args {
+			if arg != nil && arg.Name != nil {
+				rs.Args = append(rs.Args, *arg.Name)
+			}
+		}
+	}
+	jobTypes := map[string]bool{}
+	for name, node := range seq.Nodes {
+		rs.Nodes = append(rs.Nodes, name)
+		if node != nil && node.IsJob() && node.NodeType != nil {
+			jobTypes[*node.NodeType] = true
+		}
+	}
+	sort.Strings(rs.Nodes)
+	for jobType := range jobTypes {
+		rs.JobTypes = append(rs.JobTypes, jobType)
+	}
+	sort.Strings(rs.JobTypes)
+	for _, acl := range seq.ACL {
+		rs.ACLRoles = append(rs.ACLRoles, acl.Role)
+	}
+	return rs
+}
+
+func ruleNode(node Node) RuleNode {
+	rn := RuleNode{
+		Name:        node.Name,
+		Args:        []string{},
+		Sets:        []string{},
+		Each:        node.Each,
+		Retry:       node.Retry,
+		RetryWait:   node.RetryWait,
+		Description: node.Description,
+	}
+	if node.Category != nil {
+		rn.Category = *node.Category
+	}
+	if node.NodeType != nil {
+		rn.Type = *node.NodeType
+	}
+	if rn.Each == nil {
+		rn.Each = []string{}
+	}
+	for _, arg := range node.Args {
+		if arg != nil && arg.Expected != nil {
+			rn.Args = append(rn.Args, *arg.Expected)
+		}
+	}
+	for _, set := range node.Sets {
+		if set == nil {
+			continue
+		}
+		if set.As != nil {
+			rn.Sets = append(rn.Sets, *set.As)
+		} else if set.Arg != nil {
+			rn.Sets = append(rn.Sets, *set.Arg)
+		}
+	}
+	return rn
+}
@@ -0,0 +1,117 @@
+// Copyright 2020, Square, Inc.
+
+package spec_test
+
+import (
+	"os"
+	"testing"
+
+	. "github.com/square/spincycle/v2/request-manager/spec"
+)
+
+func TestPolicyRules(t *testing.T) {
+	file := writePolicy(t, `
+rules:
+  - name: request-names
+    on: sequence
+    if: '{{.Request}}'
+    expect: '{{match "^[a-z][a-z0-9-]*$" .Name}}'
+    message: request names must be lowercase
+  - name: notify-node
+    on: sequence
+    if: '{{.Request}}'
+    expect: '{{has .JobTypes "notify/slack"}}'
+    warning: true
+  - name: no-password-args
+    on: node
+    expect: '{{not (has .Args "password")}}'
+`)
+	defer os.Remove(file)
+
+	policy, err := LoadPolicy(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checker, err := NewChecker([]CheckFactory{PolicyCheckFactory{Policy: policy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			"Bad_Name": &Sequence{
+				Name:    "Bad_Name",
+				Request: true,
+				Nodes: map[string]*Node{
+					nodeA: &Node{
+						Name:     nodeA,
+						Category: strPtr("job"),
+						NodeType: strPtr("db/connect"),
+						Args:     []*NodeArg{{Expected: strPtr("password"), Given: strPtr("password")}},
+					},
+				},
+			},
+			// Not a request, so sequence rules don't apply
+			"Sub_Seq": &Sequence{
+				Name: "Sub_Seq",
+				Nodes: map[string]*Node{
+					"node-b": &Node{
+						Name:     "node-b",
+						Category: strPtr("job"),
+						NodeType: strPtr("notify/slack"),
+					},
+				},
+			},
+		},
+	}
+	results := checker.RunChecks(specs)
+
+	result := results.Results["Bad_Name"]
+	if result == nil {
+		t.Fatal("no results for Bad_Name, expected errors and warnings")
+	}
+	names := map[string]int{}
+	for _, err := range result.Errors {
+		names[CheckName(err, "")]++
+	}
+	if names["rule:request-names"] != 1 || names["rule:no-password-args"] != 1 || len(result.Errors) != 2 {
+		t.Errorf("got errors %v, expected request-names and no-password-args rule errors", result.Errors)
+	}
+	if len(result.Warnings) != 1 || CheckName(result.Warnings[0], "") != "rule:notify-node" {
+		t.Errorf("got warnings %v, expected notify-node rule warning", result.Warnings)
+	}
+	if result := results.Results["Sub_Seq"]; result != nil && (len(result.Errors) > 0 || len(result.Warnings) > 0) {
+		t.Errorf("got errors %v, warnings %v for Sub_Seq, expected none", result.Errors, result.Warnings)
+	}
+}
+
+func TestPolicyRulesInvalid(t *testing.T) {
+	for _, yaml := range []string{
+		"rules: [{on: node, expect: '{{true}}'}]\n",                                                         // no name
+		"rules: [{name: r1, on: job, expect: '{{true}}'}]\n",                                                // invalid on
+		"rules: [{name: r1, on: node}]\n",                                                                   // no expect
+		"rules: [{name: r1, on: node, expect: '{{true'}]\n",                                                 // invalid template
+		"rules: [{name: r1, on: node, expect: '{{nope .Name}}'}]\n",                                         // unknown func
+		"rules: [{name: r1, on: node, expect: '{{true}}'}, {name: r1, on: sequence, expect: '{{true}}'}]\n", // duplicate
+	} {
+		file := writePolicy(t, yaml)
+		_, err := LoadPolicy(file)
+		os.Remove(file)
+		if err == nil {
+			t.Errorf("no error loading invalid policy %q", yaml)
+		}
+	}
+}
+
+func TestPolicyRuleNotBool(t *testing.T) {
+	// Expect must render true or false, else the rule fails with an error
+	policy := Policy{Rules: []Rule{{Name: "r1", On: RULE_ON_SEQUENCE, Expect: "{{.Name}}"}}}
+	checker, err := NewChecker([]CheckFactory{PolicyCheckFactory{Policy: policy}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	specs := Specs{Sequences: map[string]*Sequence{seqA: &Sequence{Name: seqA}}}
+	results := checker.RunChecks(specs)
+	if !results.AnyError {
+		t.Error("no error for rule that renders a string, expected an error")
+	}
+}
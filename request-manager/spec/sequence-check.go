@@ -4,7 +4,10 @@ package spec
 
 import (
 	"fmt"
+	"net/url"
+	"sort"
 	"strings"
+	"time"
 )
 
 type SequenceCheck interface {
@@ -292,3 +295,761 @@ func (check NoDuplicateACLRolesSequenceCheck) CheckSequence(sequence Sequence) e
 
 	return nil
 }
+
+/* ========================================================================== */
+type AutoRetryRequestOnlySequenceCheck struct{}
+
+/* Only request sequences can be auto-retried. */
+func (check AutoRetryRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.AutoRetry != nil && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "autoRetry",
+			Values:   []string{"set"},
+			Expected: "autoRetry only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type AutoRetryHasErrorsSequenceCheck struct{}
+
+/* Auto-retry must specify the transient job error categories. */
+func (check AutoRetryHasErrorsSequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.AutoRetry != nil && len(sequence.AutoRetry.Errors) == 0 {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "autoRetry.errors",
+			Explanation: "at least one job error category must be provided",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type BudgetRequestOnlySequenceCheck struct{}
+
+/* Only request sequences have a budget. */
+func (check BudgetRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Budget != nil && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "budget",
+			Values:   []string{"set"},
+			Expected: "budget only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type BudgetApprovalBelowMaxSequenceCheck struct{}
+
+/* Budget approval threshold must be less than max, else approval is never required. */
+func (check BudgetApprovalBelowMaxSequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Budget == nil || sequence.Budget.Max == 0 || sequence.Budget.Approval == 0 {
+		return nil
+	}
+	if sequence.Budget.Approval >= sequence.Budget.Max {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "budget.approval",
+			Values:   []string{fmt.Sprintf("%d", sequence.Budget.Approval)},
+			Expected: fmt.Sprintf("value less than budget.max (%d)", sequence.Budget.Max),
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type SunsetRequestOnlySequenceCheck struct{}
+
+/* Only request sequences have a sunset: it rejects new requests. */
+func (check SunsetRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Sunset != "" && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "sunset",
+			Values:   []string{sequence.Sunset},
+			Expected: "sunset only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidSunsetSequenceCheck struct{}
+
+/* Sunset must be a date, and only deprecated sequences have a sunset. */
+func (check ValidSunsetSequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Sunset == "" {
+		return nil
+	}
+	if _, err := time.Parse(SUNSET_FORMAT, sequence.Sunset); err != nil {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "sunset",
+			Values:   []string{sequence.Sunset},
+			Expected: "date like " + SUNSET_FORMAT,
+		}
+	}
+	if sequence.Deprecated == "" {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "deprecated",
+			Explanation: "required if sunset is set",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type StopTimeoutRequestOnlySequenceCheck struct{}
+
+/* Only request sequences have a stop timeout: it applies to the whole job chain. */
+func (check StopTimeoutRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.StopTimeout != "" && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "stopTimeout",
+			Values:   []string{sequence.StopTimeout},
+			Expected: "stopTimeout only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidStopTimeoutSequenceCheck struct{}
+
+/* 'stopTimeout' should be a valid duration greater than zero. */
+func (check ValidStopTimeoutSequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.StopTimeout == "" {
+		return nil
+	}
+	if d, err := time.ParseDuration(sequence.StopTimeout); err != nil || d <= 0 {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "stopTimeout",
+			Values:   []string{sequence.StopTimeout},
+			Expected: "valid duration string greater than zero",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type RetryBudgetRequestOnlySequenceCheck struct{}
+
+/* Only request sequences have a retry budget. */
+func (check RetryBudgetRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.RetryBudget != nil && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "retryBudget",
+			Values:   []string{"set"},
+			Expected: "retryBudget only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type PartitionsRequestOnlySequenceCheck struct{}
+
+/* Only request sequences are partitioned: partitions split the whole job chain. */
+func (check PartitionsRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Partitions != 0 && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "partitions",
+			Values:   []string{fmt.Sprintf("%d", sequence.Partitions)},
+			Expected: "partitions only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type PlacementRequestOnlySequenceCheck struct{}
+
+/* Only request sequences have a placement policy: requests are placed on Job Runners. */
+func (check PlacementRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Placement != nil && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "placement",
+			Values:   []string{"set"},
+			Expected: "placement only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type PlacementHasPolicySequenceCheck struct{}
+
+/* Placement must name a policy, else labels are ignored. */
+func (check PlacementHasPolicySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Placement != nil && sequence.Placement.Policy == "" {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "placement.policy",
+			Explanation: "required if placement is set",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type SLORequestOnlySequenceCheck struct{}
+
+/* Only request sequences have an SLO: it's tracked per request type. */
+func (check SLORequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.SLO != nil && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "slo",
+			Values:   []string{"set"},
+			Expected: "slo only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidSLOSequenceCheck struct{}
+
+/* SLO must set a success rate, a duration and percentile, or both, and each must be in range. */
+func (check ValidSLOSequenceCheck) CheckSequence(sequence Sequence) error {
+	slo := sequence.SLO
+	if slo == nil {
+		return nil
+	}
+	if slo.SuccessRate == 0 && slo.Duration == "" {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "slo.successRate or slo.duration",
+			Explanation: "required if slo is set",
+		}
+	}
+	if slo.SuccessRate < 0 || slo.SuccessRate >= 1 {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "slo.successRate",
+			Values:   []string{fmt.Sprintf("%g", slo.SuccessRate)},
+			Expected: "fraction greater than 0 and less than 1, like 0.99",
+		}
+	}
+	if slo.Duration == "" {
+		if slo.Percentile != 0 {
+			return MissingValueError{
+				Node:        nil,
+				Field:       "slo.duration",
+				Explanation: "required if slo.percentile is set",
+			}
+		}
+		return nil
+	}
+	if d, err := time.ParseDuration(slo.Duration); err != nil || d <= 0 {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "slo.duration",
+			Values:   []string{slo.Duration},
+			Expected: "valid duration string greater than zero",
+		}
+	}
+	if slo.Percentile == 0 {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "slo.percentile",
+			Explanation: "required if slo.duration is set",
+		}
+	}
+	if slo.Percentile < 0 || slo.Percentile >= 100 {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "slo.percentile",
+			Values:   []string{fmt.Sprintf("%g", slo.Percentile)},
+			Expected: "percent greater than 0 and less than 100, like 95",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type UniqueByRequestOnlySequenceCheck struct{}
+
+/* Only request sequences have uniqueBy: it's checked when a request is created. */
+func (check UniqueByRequestOnlySequenceCheck) CheckSequence(sequence Sequence) error {
+	if len(sequence.UniqueBy) > 0 && !sequence.Request {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "uniqueBy",
+			Values:   sequence.UniqueBy,
+			Expected: "uniqueBy only in request sequences (request: true)",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidUniqueBySequenceCheck struct{}
+
+/* uniqueBy args must be unique args of the sequence, and not sensitive: their values are compared in plaintext. */
+func (check ValidUniqueBySequenceCheck) CheckSequence(sequence Sequence) error {
+	args := map[string]*Arg{}
+	for _, list := range [][]*Arg{sequence.Args.Required, sequence.Args.Optional, sequence.Args.Static} {
+		for _, arg := range list {
+			if arg != nil && arg.Name != nil {
+				args[*arg.Name] = arg
+			}
+		}
+	}
+
+	seen := map[string]bool{}
+	for _, name := range sequence.UniqueBy {
+		arg, ok := args[name]
+		if !ok {
+			return InvalidValueError{
+				Node:     nil,
+				Field:    "uniqueBy",
+				Values:   []string{name},
+				Expected: "required, optional, or static arg of the sequence",
+			}
+		}
+		if arg.Sensitive {
+			return InvalidValueError{
+				Node:     nil,
+				Field:    "uniqueBy",
+				Values:   []string{name},
+				Expected: "arg that is not sensitive",
+			}
+		}
+		if seen[name] {
+			return DuplicateValueError{
+				Node:   nil,
+				Field:  "uniqueBy",
+				Values: []string{name},
+			}
+		}
+		seen[name] = true
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type SensitiveArgsNotEvaluatedSequenceCheck struct {
+	AllSpecs Specs
+}
+
+/* Nodes of a request and its subsequences must not evaluate sensitive args (if:, each:, until:, arg templates): if arg encryption is enabled, their values are ciphertext when the job chain is built. */
+func (check SensitiveArgsNotEvaluatedSequenceCheck) CheckSequence(sequence Sequence) error {
+	if !sequence.Request {
+		return nil // only request args are encrypted
+	}
+	sensitive := map[string]bool{}
+	for _, list := range [][]*Arg{sequence.Args.Required, sequence.Args.Optional} {
+		for _, arg := range list {
+			if arg != nil && arg.Name != nil && arg.Sensitive {
+				sensitive[*arg.Name] = true
+			}
+		}
+	}
+	return check.checkSensitive(sequence, sensitive, map[string]bool{}, true)
+}
+
+// checkSensitive checks the nodes of the sequence, in which the args are
+// sensitive, then the subsequences that the args are passed to, under the
+// names that the nodes give them. Seen sequence args are not checked again.
+func (check SensitiveArgsNotEvaluatedSequenceCheck) checkSensitive(sequence Sequence, sensitive, seen map[string]bool, request bool) error {
+	if len(sensitive) == 0 {
+		return nil
+	}
+	names := make([]string, 0, len(sequence.Nodes))
+	for name := range sequence.Nodes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		node := sequence.Nodes[name]
+		nodeName := name
+		if !request {
+			nodeName = sequence.Name + "." + name
+		}
+		invalid := func(field, value string) error {
+			return InvalidValueError{
+				Node:     &nodeName,
+				Field:    field,
+				Values:   []string{value},
+				Expected: "no sensitive arg: if arg encryption is enabled, it's ciphertext when the job chain is built",
+			}
+		}
+		if node.If != nil && sensitive[*node.If] {
+			return invalid("if", *node.If)
+		}
+		if node.Until != nil && sensitive[*node.Until] {
+			return invalid("until", *node.Until)
+		}
+		for _, each := range node.Each {
+			if sensitive[strings.Split(each, ":")[0]] {
+				return invalid("each", each)
+			}
+		}
+
+		// Sensitive args passed to subsequences are sensitive in them, too
+		passed := map[string]bool{}
+		for _, arg := range node.Args {
+			if arg == nil || arg.Given == nil || arg.Expected == nil {
+				continue
+			}
+			if !IsArgTemplate(*arg.Given) {
+				if sensitive[*arg.Given] {
+					passed[*arg.Expected] = true
+				}
+				continue
+			}
+			refs, _ := ArgTemplateRefs(*arg.Given) // invalid templates are another check's problem
+			for _, ref := range refs {
+				if sensitive[ref] {
+					return invalid("args.given", *arg.Given)
+				}
+			}
+		}
+		for _, subseqName := range getCalledSequences(*node) {
+			subseq, ok := check.AllSpecs.Sequences[subseqName]
+			if !ok {
+				continue // another check's problem
+			}
+			unseen := map[string]bool{}
+			for arg := range passed {
+				if !seen[subseqName+"."+arg] {
+					seen[subseqName+"."+arg] = true
+					unseen[arg] = true
+				}
+			}
+			if err := check.checkSensitive(*subseq, unseen, seen, false); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ValidDocsURLSequenceCheck struct{}
+
+/* 'docsUrl' should be an absolute http or https URL, so clients can link to it. */
+func (check ValidDocsURLSequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.DocsURL != "" && !validDocsURL(sequence.DocsURL) {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "docsUrl",
+			Values:   []string{sequence.DocsURL},
+			Expected: "absolute http or https URL",
+		}
+	}
+
+	return nil
+}
+
+// validDocsURL returns true if s is an absolute http or https URL with a host.
+func validDocsURL(s string) bool {
+	u, err := url.Parse(s)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+/* ========================================================================== */
+type ParallelSetsSequenceCheck struct{}
+
+/* Nodes that can run in parallel shouldn't set the same args: only one value is kept. */
+func (check ParallelSetsSequenceCheck) CheckSequence(sequence Sequence) error {
+	ancestors := getNodeAncestors(sequence)
+
+	setBy := map[string][]string{} // arg --> nodes that set it
+	for name, node := range sequence.Nodes {
+		argsSet := map[string]bool{}
+		for _, set := range node.Sets {
+			if set.As != nil && !argsSet[*set.As] {
+				argsSet[*set.As] = true
+				setBy[*set.As] = append(setBy[*set.As], name)
+			}
+		}
+	}
+
+	values := []string{}
+	for arg, nodes := range setBy {
+		sort.Strings(nodes)
+
+		// Nodes that set the arg and neither depends on the other
+		parallel := map[string]bool{}
+		for i := 0; i < len(nodes); i++ {
+			for j := i + 1; j < len(nodes); j++ {
+				if !ancestors[nodes[i]][nodes[j]] && !ancestors[nodes[j]][nodes[i]] {
+					parallel[nodes[i]] = true
+					parallel[nodes[j]] = true
+				}
+			}
+		}
+		if len(parallel) > 0 {
+			names := stringSetToArray(parallel)
+			sort.Strings(names)
+			renames := make([]string, len(names))
+			for i, name := range names {
+				renames[i] = arg + "_" + name
+			}
+			values = append(values, fmt.Sprintf("%s (set by parallel nodes %s; rename, e.g. %s)",
+				arg, strings.Join(names, ", "), strings.Join(renames, ", ")))
+		}
+
+		// Expanded nodes set the arg once per expansion
+		for _, name := range nodes {
+			node := sequence.Nodes[name]
+			if len(node.Each) > 0 && !node.Sequential && (node.Parallel == nil || *node.Parallel > 1) {
+				values = append(values, fmt.Sprintf("%s (set by every parallel expansion of node %s; set it in a later node instead)", arg, name))
+			}
+		}
+	}
+
+	if len(values) > 0 {
+		sort.Strings(values)
+		return DuplicateValueError{
+			Node:        nil,
+			Field:       "nodes.sets.as",
+			Values:      values,
+			Explanation: "only one value is kept (last write wins), and which one depends on the order in which the request is built",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type SkippedSetsHaveDefaultsSequenceCheck struct{}
+
+/*
+ * Args set by a skippable node and used by nodes after it have a default, so the
+ * nodes after it still get a value if an operator skips the node.
+ */
+func (check SkippedSetsHaveDefaultsSequenceCheck) CheckSequence(sequence Sequence) error {
+	ancestors := getNodeAncestors(sequence)
+
+	values := []string{}
+	for name, node := range sequence.Nodes {
+		if node == nil || !node.Skippable {
+			continue
+		}
+		for _, set := range node.Sets {
+			if set == nil || set.As == nil || set.Default != nil {
+				continue
+			}
+			users := []string{}
+			for next, nextNode := range sequence.Nodes {
+				if ancestors[next][name] && getUsedArgs(*nextNode)[*set.As] {
+					users = append(users, next)
+				}
+			}
+			if len(users) > 0 {
+				sort.Strings(users)
+				values = append(values, fmt.Sprintf("%s (set by skippable node %s, used by %s)", *set.As, name, strings.Join(users, ", ")))
+			}
+		}
+	}
+
+	if len(values) > 0 {
+		sort.Strings(values)
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "nodes.sets",
+			Values:   values,
+			Expected: "a default for args that skippable nodes set and nodes after them use, which they get if the node is skipped",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type ShadowedArgsSequenceCheck struct {
+	AllSpecs Specs
+}
+
+/* Subsequence optional and static args shouldn't shadow job args that the calling node doesn't pass. */
+func (check ShadowedArgsSequenceCheck) CheckSequence(sequence Sequence) error {
+	ancestors := getNodeAncestors(sequence)
+
+	seqArgs := map[string]bool{}
+	for _, args := range [][]*Arg{sequence.Args.Required, sequence.Args.Optional, sequence.Args.Static} {
+		for _, arg := range args {
+			if arg != nil && arg.Name != nil {
+				seqArgs[*arg.Name] = true
+			}
+		}
+	}
+
+	values := []string{}
+	for name, node := range sequence.Nodes {
+		if node.IsJob() {
+			continue
+		}
+
+		// Job args available to the node: sequence args + args set by nodes it depends on
+		available := map[string]bool{}
+		for arg := range seqArgs {
+			available[arg] = true
+		}
+		for dep := range ancestors[name] {
+			if depNode, ok := sequence.Nodes[dep]; ok {
+				for _, set := range depNode.Sets {
+					if set.As != nil {
+						available[*set.As] = true
+					}
+				}
+			}
+		}
+		given := getInputArgs(*node)
+
+		for _, subseqName := range getCalledSequences(*node) {
+			subseq, ok := check.AllSpecs.Sequences[subseqName]
+			if !ok {
+				continue // another check's problem
+			}
+			for _, args := range [][]*Arg{subseq.Args.Optional, subseq.Args.Static} {
+				for _, arg := range args {
+					if arg == nil || arg.Name == nil || !available[*arg.Name] || given[*arg.Name] {
+						continue
+					}
+					values = append(values, fmt.Sprintf("%s (node %s: sequence %s uses its own value; pass it in 'args', or rename it in %s, e.g. %s_%s)",
+						*arg.Name, name, subseqName, subseqName, subseqName, *arg.Name))
+				}
+			}
+		}
+	}
+
+	if len(values) > 0 {
+		sort.Strings(values)
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "nodes.args",
+			Values:   values,
+			Expected: "job args with the same name as a subsequence optional or static arg to be passed to the subsequence",
+		}
+	}
+
+	return nil
+}
+
+// getNodeAncestors returns node name --> set of names of all nodes that it
+// depends on, directly or indirectly.
+func getNodeAncestors(sequence Sequence) map[string]map[string]bool {
+	ancestors := map[string]map[string]bool{}
+	var visit func(name string) map[string]bool
+	visit = func(name string) map[string]bool {
+		if a, ok := ancestors[name]; ok {
+			return a
+		}
+		a := map[string]bool{}
+		ancestors[name] = a // set before recursing in case of cyclical deps
+		node, ok := sequence.Nodes[name]
+		if !ok || node == nil {
+			return a
+		}
+		for _, dep := range node.Dependencies {
+			a[dep] = true
+			for d := range visit(dep) {
+				a[d] = true
+			}
+		}
+		return a
+	}
+	for name := range sequence.Nodes {
+		visit(name)
+	}
+	return ancestors
+}
+
+/* ========================================================================== */
+type ACLRequiredPolicySequenceCheck struct{}
+
+/* Policy: request sequences must have an ACL. */
+func (check ACLRequiredPolicySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Request && len(sequence.ACL) == 0 {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "acl",
+			Explanation: "policy requires request sequences to have an acl",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type DescriptionRequiredPolicySequenceCheck struct{}
+
+/* Policy: request sequences must have a description. */
+func (check DescriptionRequiredPolicySequenceCheck) CheckSequence(sequence Sequence) error {
+	if sequence.Request && strings.TrimSpace(sequence.Description) == "" {
+		return MissingValueError{
+			Node:        nil,
+			Field:       "description",
+			Explanation: "policy requires request sequences to have a description",
+		}
+	}
+
+	return nil
+}
+
+/* ========================================================================== */
+type MaxJobsPolicySequenceCheck struct {
+	AllSpecs Specs
+	Max      uint64
+}
+
+/* Policy: the worst-case job chain of a request must not have more than Max jobs. */
+func (check MaxJobsPolicySequenceCheck) CheckSequence(sequence Sequence) error {
+	if !sequence.Request {
+		return nil
+	}
+	size := EstimateChainSize(check.AllSpecs, sequence.Name)
+	if size.Jobs > check.Max {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "nodes",
+			Values:   []string{fmt.Sprintf("%d jobs", size.Jobs)},
+			Expected: fmt.Sprintf("at most %d jobs in the worst-case job chain (policy maxJobs); lower maxLen of each: lists or parallel expansions", check.Max),
+		}
+	}
+	if len(size.Unbounded) > 0 {
+		return InvalidValueError{
+			Node:     nil,
+			Field:    "nodes.each",
+			Values:   size.Unbounded,
+			Expected: "maxLen on each: list args (sequence args or node sets) so that the job chain size can be checked (policy maxJobs)",
+		}
+	}
+
+	return nil
+}
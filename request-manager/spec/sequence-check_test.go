@@ -236,3 +236,650 @@ func TestFailNoDuplicateACLRolesSequenceCheck(t *testing.T) {
 	err := check.CheckSequence(sequence)
 	compareError(t, err, expectedErr, "accepted duplicated acl roles, expected error")
 }
+
+func TestFailAutoRetryRequestOnlySequenceCheck(t *testing.T) {
+	check := AutoRetryRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:      seqA,
+		Request:   false,
+		AutoRetry: &AutoRetry{Max: 1, Errors: []string{testVal}},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "autoRetry",
+		Values: []string{"set"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted autoRetry in non-request sequence, expected error")
+}
+
+func TestFailAutoRetryHasErrorsSequenceCheck(t *testing.T) {
+	check := AutoRetryHasErrorsSequenceCheck{}
+	sequence := Sequence{
+		Name:      seqA,
+		Request:   true,
+		AutoRetry: &AutoRetry{Max: 1},
+	}
+	expectedErr := MissingValueError{
+		Field: "autoRetry.errors",
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted autoRetry with no errors, expected error")
+}
+
+func TestFailBudgetRequestOnlySequenceCheck(t *testing.T) {
+	check := BudgetRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:    seqA,
+		Request: false,
+		Budget:  &Budget{Max: 10},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "budget",
+		Values: []string{"set"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted budget in non-request sequence, expected error")
+}
+
+func TestFailBudgetApprovalBelowMaxSequenceCheck(t *testing.T) {
+	check := BudgetApprovalBelowMaxSequenceCheck{}
+	sequence := Sequence{
+		Name:    seqA,
+		Request: true,
+		Budget:  &Budget{Max: 10, Approval: 10},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "budget.approval",
+		Values: []string{"10"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted budget approval equal to max, expected error")
+
+	// Either one alone is ok
+	sequence.Budget = &Budget{Approval: 10}
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("got error '%s', expected nil for budget without max", err)
+	}
+}
+
+func TestFailSunsetRequestOnlySequenceCheck(t *testing.T) {
+	check := SunsetRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:       seqA,
+		Request:    false,
+		Deprecated: "use seq-b",
+		Sunset:     "2020-12-31",
+	}
+	expectedErr := InvalidValueError{
+		Field:  "sunset",
+		Values: []string{"2020-12-31"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted sunset in non-request sequence, expected error")
+}
+
+func TestFailValidSunsetSequenceCheck(t *testing.T) {
+	check := ValidSunsetSequenceCheck{}
+	sequence := Sequence{
+		Name:       seqA,
+		Request:    true,
+		Deprecated: "use seq-b",
+		Sunset:     "12/31/2020",
+	}
+	expectedErr := InvalidValueError{
+		Field:  "sunset",
+		Values: []string{"12/31/2020"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted invalid sunset date, expected error")
+
+	sequence.Sunset = "2020-12-31"
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("got error '%s', expected nil for valid sunset date", err)
+	}
+
+	// Sunset without deprecated
+	sequence.Deprecated = ""
+	expectedErr2 := MissingValueError{
+		Field: "deprecated",
+	}
+	err = check.CheckSequence(sequence)
+	compareError(t, err, expectedErr2, "accepted sunset without deprecated, expected error")
+}
+
+func TestFailStopTimeoutRequestOnlySequenceCheck(t *testing.T) {
+	check := StopTimeoutRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:        seqA,
+		Request:     false,
+		StopTimeout: "5m",
+	}
+	expectedErr := InvalidValueError{
+		Field:  "stopTimeout",
+		Values: []string{"5m"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted stopTimeout in non-request sequence, expected error")
+}
+
+func TestFailValidStopTimeoutSequenceCheck(t *testing.T) {
+	check := ValidStopTimeoutSequenceCheck{}
+	for _, val := range []string{"5", "0s", "-1m"} {
+		sequence := Sequence{
+			Name:        seqA,
+			Request:     true,
+			StopTimeout: val,
+		}
+		expectedErr := InvalidValueError{
+			Field:  "stopTimeout",
+			Values: []string{val},
+		}
+		err := check.CheckSequence(sequence)
+		compareError(t, err, expectedErr, "accepted invalid stopTimeout "+val+", expected error")
+	}
+
+	sequence := Sequence{Name: seqA, Request: true, StopTimeout: "5m"}
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("got error '%s', expected nil for valid stopTimeout", err)
+	}
+}
+
+func TestFailRetryBudgetRequestOnlySequenceCheck(t *testing.T) {
+	check := RetryBudgetRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:        seqA,
+		Request:     false,
+		RetryBudget: &RetryBudget{JobRetries: 10},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "retryBudget",
+		Values: []string{"set"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted retryBudget in non-request sequence, expected error")
+}
+
+func TestFailPartitionsRequestOnlySequenceCheck(t *testing.T) {
+	check := PartitionsRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:       seqA,
+		Request:    false,
+		Partitions: 4,
+	}
+	expectedErr := InvalidValueError{
+		Field:  "partitions",
+		Values: []string{"4"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted partitions in non-request sequence, expected error")
+}
+
+func TestFailPlacementRequestOnlySequenceCheck(t *testing.T) {
+	check := PlacementRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:      seqA,
+		Request:   false,
+		Placement: &Placement{Policy: "round-robin"},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "placement",
+		Values: []string{"set"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted placement in non-request sequence, expected error")
+}
+
+func TestFailPlacementHasPolicySequenceCheck(t *testing.T) {
+	check := PlacementHasPolicySequenceCheck{}
+	sequence := Sequence{
+		Name:      seqA,
+		Request:   true,
+		Placement: &Placement{Labels: map[string]string{"zone": "east"}},
+	}
+	expectedErr := MissingValueError{
+		Field: "placement.policy",
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted placement without policy, expected error")
+}
+
+func TestFailSLORequestOnlySequenceCheck(t *testing.T) {
+	check := SLORequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:    seqA,
+		Request: false,
+		SLO:     &SLO{SuccessRate: 0.99},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "slo",
+		Values: []string{"set"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted slo in non-request sequence, expected error")
+}
+
+func TestFailValidSLOSequenceCheck(t *testing.T) {
+	check := ValidSLOSequenceCheck{}
+	invalid := []struct {
+		slo SLO
+		err error
+	}{
+		{SLO{}, MissingValueError{Field: "slo.successRate or slo.duration"}},
+		{SLO{SuccessRate: 1}, InvalidValueError{Field: "slo.successRate", Values: []string{"1"}}},
+		{SLO{SuccessRate: -0.5}, InvalidValueError{Field: "slo.successRate", Values: []string{"-0.5"}}},
+		{SLO{SuccessRate: 0.9, Percentile: 95}, MissingValueError{Field: "slo.duration"}},
+		{SLO{Duration: "soon", Percentile: 95}, InvalidValueError{Field: "slo.duration", Values: []string{"soon"}}},
+		{SLO{Duration: "10m"}, MissingValueError{Field: "slo.percentile"}},
+		{SLO{Duration: "10m", Percentile: 100}, InvalidValueError{Field: "slo.percentile", Values: []string{"100"}}},
+	}
+	for _, c := range invalid {
+		slo := c.slo
+		sequence := Sequence{Name: seqA, Request: true, SLO: &slo}
+		err := check.CheckSequence(sequence)
+		compareError(t, err, c.err, fmt.Sprintf("accepted invalid slo %+v, expected error", slo))
+	}
+
+	for _, slo := range []SLO{{SuccessRate: 0.99}, {Duration: "10m", Percentile: 95}, {SuccessRate: 0.9, Duration: "1h", Percentile: 99.9}} {
+		slo := slo
+		sequence := Sequence{Name: seqA, Request: true, SLO: &slo}
+		if err := check.CheckSequence(sequence); err != nil {
+			t.Errorf("got error '%s', expected nil for valid slo %+v", err, slo)
+		}
+	}
+}
+
+func TestFailUniqueByRequestOnlySequenceCheck(t *testing.T) {
+	check := UniqueByRequestOnlySequenceCheck{}
+	sequence := Sequence{
+		Name:     seqA,
+		Request:  false,
+		UniqueBy: []string{"cluster"},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "uniqueBy",
+		Values: []string{"cluster"},
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted uniqueBy in non-request sequence, expected error")
+}
+
+func TestFailValidUniqueBySequenceCheck(t *testing.T) {
+	check := ValidUniqueBySequenceCheck{}
+	args := SequenceArgs{
+		Required: []*Arg{{Name: strPtr("cluster")}, {Name: strPtr("password"), Sensitive: true}},
+		Optional: []*Arg{{Name: strPtr("env"), Default: strPtr("prod")}},
+	}
+	invalid := []struct {
+		uniqueBy []string
+		err      error
+	}{
+		{[]string{"host"}, InvalidValueError{Field: "uniqueBy", Values: []string{"host"}}},
+		{[]string{"cluster", "password"}, InvalidValueError{Field: "uniqueBy", Values: []string{"password"}}},
+		{[]string{"cluster", "env", "cluster"}, DuplicateValueError{Field: "uniqueBy", Values: []string{"cluster"}}},
+	}
+	for _, c := range invalid {
+		sequence := Sequence{Name: seqA, Request: true, Args: args, UniqueBy: c.uniqueBy}
+		err := check.CheckSequence(sequence)
+		compareError(t, err, c.err, fmt.Sprintf("accepted invalid uniqueBy %v, expected error", c.uniqueBy))
+	}
+
+	sequence := Sequence{Name: seqA, Request: true, Args: args, UniqueBy: []string{"cluster", "env"}}
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("got error '%s', expected nil for valid uniqueBy", err)
+	}
+}
+
+func TestFailSensitiveArgsNotEvaluatedSequenceCheck(t *testing.T) {
+	args := SequenceArgs{
+		Required: []*Arg{{Name: strPtr("host")}, {Name: strPtr("password"), Sensitive: true}},
+	}
+	seqCategory := "sequence"
+	subseq := &Sequence{
+		Name: "subseq",
+		Args: SequenceArgs{Required: []*Arg{{Name: strPtr("db_password")}}},
+		Nodes: map[string]*Node{
+			"check": {Name: "check", If: strPtr("db_password"), Eq: map[string]string{"default": "noop"}},
+		},
+	}
+	check := SensitiveArgsNotEvaluatedSequenceCheck{AllSpecs: Specs{Sequences: map[string]*Sequence{"subseq": subseq}}}
+	subseqNode := "subseq.check"
+	invalid := []struct {
+		node *Node
+		err  InvalidValueError
+	}{
+		{&Node{Name: nodeA, If: strPtr("password")}, InvalidValueError{Node: &nodeA, Field: "if", Values: []string{"password"}}},
+		{&Node{Name: nodeA, Each: []string{"password:p"}}, InvalidValueError{Node: &nodeA, Field: "each", Values: []string{"password:p"}}},
+		{&Node{Name: nodeA, Until: strPtr("password")}, InvalidValueError{Node: &nodeA, Field: "until", Values: []string{"password"}}},
+		{
+			&Node{Name: nodeA, Args: []*NodeArg{{Expected: strPtr("dsn"), Given: strPtr("{host}:{password}")}}},
+			InvalidValueError{Node: &nodeA, Field: "args.given", Values: []string{"{host}:{password}"}},
+		},
+		{
+			// Passed to a subsequence that evaluates it under another name
+			&Node{Name: nodeA, Category: &seqCategory, NodeType: strPtr("subseq"), Args: []*NodeArg{{Expected: strPtr("db_password"), Given: strPtr("password")}}},
+			InvalidValueError{Node: &subseqNode, Field: "if", Values: []string{"db_password"}},
+		},
+	}
+	for _, c := range invalid {
+		sequence := Sequence{Name: seqA, Request: true, Args: args, Nodes: map[string]*Node{nodeA: c.node}}
+		err := check.CheckSequence(sequence)
+		compareError(t, err, c.err, fmt.Sprintf("accepted node %s field %s, expected error", nodeA, c.err.Field))
+	}
+
+	// Passing sensitive args to jobs and subsequences that don't evaluate them is
+	// ok, and so is evaluating args that are not sensitive
+	valid := []*Node{
+		{Name: nodeA, If: strPtr("host"), Args: []*NodeArg{{Expected: strPtr("password"), Given: strPtr("password")}}},
+		{Name: nodeA, Args: []*NodeArg{{Expected: strPtr("fqdn"), Given: strPtr("{host}.local")}}},
+		{Name: nodeA, Category: &seqCategory, NodeType: strPtr("subseq"), Args: []*NodeArg{{Expected: strPtr("db_password"), Given: strPtr("host")}}},
+	}
+	for _, node := range valid {
+		sequence := Sequence{Name: seqA, Request: true, Args: args, Nodes: map[string]*Node{nodeA: node}}
+		if err := check.CheckSequence(sequence); err != nil {
+			t.Errorf("got error '%s', expected nil", err)
+		}
+	}
+}
+
+func TestFailValidDocsURLSequenceCheck(t *testing.T) {
+	check := ValidDocsURLSequenceCheck{}
+	for _, val := range []string{"wiki/restart-db", "ftp://docs.local/restart-db", "https://"} {
+		sequence := Sequence{
+			Name:    seqA,
+			DocsURL: val,
+		}
+		expectedErr := InvalidValueError{
+			Field:  "docsUrl",
+			Values: []string{val},
+		}
+		err := check.CheckSequence(sequence)
+		compareError(t, err, expectedErr, "accepted invalid docsUrl "+val+", expected error")
+	}
+
+	sequence := Sequence{Name: seqA, DocsURL: "https://wiki.local/runbooks/restart-db"}
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("got error '%s', expected nil for valid docsUrl", err)
+	}
+}
+
+func TestParallelSetsSequenceCheck(t *testing.T) {
+	check := ParallelSetsSequenceCheck{}
+	nodeB := "node-b"
+	sequence := Sequence{ // Check that nodes setting the same arg one after the other _aren't_ caught
+		Name: seqA,
+		Nodes: map[string]*Node{
+			nodeA: &Node{
+				Name: nodeA,
+				Sets: []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+			},
+			nodeB: &Node{
+				Name:         nodeB,
+				Sets:         []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+				Dependencies: []string{nodeA},
+			},
+		},
+	}
+	err := check.CheckSequence(sequence)
+	if err != nil {
+		t.Fatalf("check failed, expected pass: %s", err)
+	}
+}
+
+func TestFailParallelSetsSequenceCheck1(t *testing.T) {
+	check := ParallelSetsSequenceCheck{}
+	nodeB := "node-b"
+	nodeC := "node-c"
+	sequence := Sequence{ // Check that parallel nodes setting the same arg are caught
+		Name: seqA,
+		Nodes: map[string]*Node{
+			nodeA: &Node{
+				Name: nodeA,
+			},
+			nodeB: &Node{
+				Name:         nodeB,
+				Sets:         []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+				Dependencies: []string{nodeA},
+			},
+			nodeC: &Node{
+				Name:         nodeC,
+				Sets:         []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+				Dependencies: []string{nodeA},
+			},
+		},
+	}
+	expectedErr := DuplicateValueError{
+		Field: "nodes.sets.as",
+		Values: []string{
+			fmt.Sprintf("%s (set by parallel nodes %s, %s; rename, e.g. %s_%s, %s_%s)", testVal, nodeB, nodeC, testVal, nodeB, testVal, nodeC),
+		},
+	}
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted sequence with parallel nodes setting the same arg, expected error")
+}
+
+func TestFailParallelSetsSequenceCheck2(t *testing.T) {
+	check := ParallelSetsSequenceCheck{}
+	sequence := Sequence{ // Check that a node expanded in parallel setting an arg is caught
+		Name: seqA,
+		Nodes: map[string]*Node{
+			nodeA: &Node{
+				Name: nodeA,
+				Each: []string{"hosts:host"},
+				Sets: []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+			},
+		},
+	}
+	expectedErr := DuplicateValueError{
+		Field: "nodes.sets.as",
+		Values: []string{
+			fmt.Sprintf("%s (set by every parallel expansion of node %s; set it in a later node instead)", testVal, nodeA),
+		},
+	}
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted sequence with expanded node setting an arg, expected error")
+
+	// Not in parallel (parallel: 1) is ok
+	var one uint = 1
+	sequence.Nodes[nodeA].Parallel = &one
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("check failed, expected pass: %s", err)
+	}
+}
+
+func TestFailSkippedSetsHaveDefaultsSequenceCheck(t *testing.T) {
+	check := SkippedSetsHaveDefaultsSequenceCheck{}
+	nodeB := "node-b"
+	nodeC := "node-c"
+	host := "host"
+	sequence := Sequence{ // b uses the arg that skippable node a sets, c doesn't
+		Name: seqA,
+		Nodes: map[string]*Node{
+			nodeA: &Node{
+				Name:      nodeA,
+				Skippable: true,
+				Sets:      []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+			},
+			nodeB: &Node{
+				Name:         nodeB,
+				Args:         []*NodeArg{&NodeArg{Expected: &host, Given: &testVal}},
+				Dependencies: []string{nodeA},
+			},
+			nodeC: &Node{
+				Name:         nodeC,
+				Dependencies: []string{nodeB},
+			},
+		},
+	}
+	expectedErr := InvalidValueError{
+		Field:  "nodes.sets",
+		Values: []string{fmt.Sprintf("%s (set by skippable node %s, used by %s)", testVal, nodeA, nodeB)},
+	}
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted sequence with arg set by skippable node and no default, expected error")
+
+	// Args in templates are used, too
+	tmpl := "{" + testVal + "}.local"
+	sequence.Nodes[nodeB].Args[0].Given = &tmpl
+	err = check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted sequence with arg set by skippable node and no default, expected error")
+
+	// A default makes it ok
+	sequence.Nodes[nodeA].Sets[0].Default = "localhost"
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("check failed, expected pass: %s", err)
+	}
+
+	// So does a node that's not skippable
+	sequence.Nodes[nodeA].Sets[0].Default = nil
+	sequence.Nodes[nodeA].Skippable = false
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("check failed, expected pass: %s", err)
+	}
+}
+
+func TestShadowedArgsSequenceCheck(t *testing.T) {
+	subseq := "subseq"
+	sequence := "sequence"
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			subseq: &Sequence{
+				Name: subseq,
+				Args: SequenceArgs{
+					Optional: []*Arg{&Arg{Name: &testVal, Default: &testVal}},
+				},
+			},
+		},
+	}
+	check := ShadowedArgsSequenceCheck{specs}
+	seq := Sequence{ // Check that a sequence arg passed to the subsequence _isn't_ caught
+		Name: seqA,
+		Args: SequenceArgs{
+			Required: []*Arg{&Arg{Name: &testVal}},
+		},
+		Nodes: map[string]*Node{
+			nodeA: &Node{
+				Name:     nodeA,
+				Category: &sequence,
+				NodeType: &subseq,
+				Args:     []*NodeArg{&NodeArg{Expected: &testVal, Given: &testVal}},
+			},
+		},
+	}
+	err := check.CheckSequence(seq)
+	if err != nil {
+		t.Fatalf("check failed, expected pass: %s", err)
+	}
+}
+
+func TestFailShadowedArgsSequenceCheck(t *testing.T) {
+	subseq := "subseq"
+	sequence := "sequence"
+	job := "job"
+	nodeB := "node-b"
+	specs := Specs{
+		Sequences: map[string]*Sequence{
+			subseq: &Sequence{
+				Name: subseq,
+				Args: SequenceArgs{
+					Static: []*Arg{&Arg{Name: &testVal, Default: &testVal}},
+				},
+			},
+		},
+	}
+	check := ShadowedArgsSequenceCheck{specs}
+	seq := Sequence{ // Check that an arg set by a previous node but not passed to the subsequence is caught
+		Name: seqA,
+		Nodes: map[string]*Node{
+			nodeA: &Node{
+				Name:     nodeA,
+				Category: &job,
+				NodeType: &job,
+				Sets:     []*NodeSet{&NodeSet{Arg: &testVal, As: &testVal}},
+			},
+			nodeB: &Node{
+				Name:         nodeB,
+				Category:     &sequence,
+				NodeType:     &subseq,
+				Dependencies: []string{nodeA},
+			},
+		},
+	}
+	expectedErr := InvalidValueError{
+		Field: "nodes.args",
+		Values: []string{
+			fmt.Sprintf("%s (node %s: sequence %s uses its own value; pass it in 'args', or rename it in %s, e.g. %s_%s)", testVal, nodeB, subseq, subseq, subseq, testVal),
+		},
+	}
+	err := check.CheckSequence(seq)
+	compareError(t, err, expectedErr, "accepted subsequence arg shadowing job arg, expected error")
+}
+
+func TestFailACLRequiredPolicySequenceCheck(t *testing.T) {
+	check := ACLRequiredPolicySequenceCheck{}
+	sequence := Sequence{
+		Name:    seqA,
+		Request: true,
+	}
+	expectedErr := MissingValueError{
+		Node:  nil,
+		Field: "acl",
+	}
+
+	err := check.CheckSequence(sequence)
+	compareError(t, err, expectedErr, "accepted request sequence without acl, expected error")
+
+	sequence.Request = false
+	if err := check.CheckSequence(sequence); err != nil {
+		t.Errorf("error on non-request sequence without acl: %s", err)
+	}
+}
+
+func TestFailMaxJobsPolicySequenceCheck(t *testing.T) {
+	specs := chainSizeSpecs(t)
+	check := MaxJobsPolicySequenceCheck{AllSpecs: specs, Max: 100}
+	expectedErr := InvalidValueError{
+		Field:  "nodes",
+		Values: []string{"113 jobs"},
+	}
+	err := check.CheckSequence(*specs.Sequences["chain-size"])
+	compareError(t, err, expectedErr, "accepted request with 113 jobs, expected error")
+
+	// Unbounded each: lists cannot be checked
+	specs.Sequences["chain-size"].Nodes["get-instances"].Sets[0].MaxLen = 0
+	expectedErr = InvalidValueError{
+		Field: "nodes.each",
+		Values: []string{
+			"chain-size.cond-each: instances",
+			"chain-size.decommission-instances: instances",
+			"chain-size.pre-flight-checks: instances",
+		},
+	}
+	err = check.CheckSequence(*specs.Sequences["chain-size"])
+	compareError(t, err, expectedErr, "accepted request with unbounded each lists, expected error")
+
+	// Not a request
+	if err := check.CheckSequence(*specs.Sequences["decommission-instance"]); err != nil {
+		t.Errorf("error for non-request sequence: %s", err)
+	}
+}
+
+func TestMaxJobsPolicySequenceCheck(t *testing.T) {
+	specs := chainSizeSpecs(t)
+	check := MaxJobsPolicySequenceCheck{AllSpecs: specs, Max: 113}
+	if err := check.CheckSequence(*specs.Sequences["chain-size"]); err != nil {
+		t.Errorf("error for request with 113 jobs, max 113: %s", err)
+	}
+}
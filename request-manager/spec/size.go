@@ -0,0 +1,153 @@
+// Copyright 2020, Square, Inc.
+
+package spec
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ChainSize is the worst-case size of the job chain of a request, estimated from
+// the specs by EstimateChainSize.
+type ChainSize struct {
+	Jobs      uint64   // max number of jobs, including the noop jobs that join sequences and expansions
+	Unbounded []string // each: lists without a maxLen, like "seq-a.node-b: hosts" (counted as one expansion)
+}
+
+// EstimateChainSize returns the worst-case size of the job chain built for
+// sequence seqName, without building it. The size depends on the length of
+// each: lists, which are only known when the request is created, so it uses the
+// max length (maxLen) declared on the list arg: on the sequence arg, or on the
+// node sets that set it. A list arg passed to a subsequence keeps its max length.
+// Conditional nodes count the largest sequence they can choose. The estimate is
+// exact when every each: list has its max length and every conditional chooses
+// the largest sequence.
+func EstimateChainSize(allSpecs Specs, seqName string) ChainSize {
+	e := &estimator{
+		allSpecs:  allSpecs,
+		unbounded: map[string]bool{},
+		calling:   map[string]bool{},
+	}
+	size := ChainSize{
+		Jobs:      e.sequence(seqName, map[string]uint{}),
+		Unbounded: stringSetToArray(e.unbounded),
+	}
+	sort.Strings(size.Unbounded)
+	return size
+}
+
+type estimator struct {
+	allSpecs  Specs
+	unbounded map[string]bool // seq.node: lists
+	calling   map[string]bool // sequences being estimated, to stop on cycles (graph checks catch them)
+}
+
+// sequence returns the max number of jobs in sequence seqName given the max
+// length of list args passed to it.
+func (e *estimator) sequence(seqName string, argLen map[string]uint) uint64 {
+	seq, ok := e.allSpecs.Sequences[seqName]
+	if !ok || e.calling[seqName] {
+		return 0
+	}
+	e.calling[seqName] = true
+	defer delete(e.calling, seqName)
+
+	// Max length of list args in the sequence: passed in, declared on the
+	// sequence args, or set by its nodes. Declared max lengths are promises, so
+	// the smallest one is the max.
+	maxLen := map[string]uint{}
+	setMax := func(arg string, n uint) {
+		if cur, ok := maxLen[arg]; n > 0 && (!ok || n < cur) {
+			maxLen[arg] = n
+		}
+	}
+	for arg, n := range argLen {
+		setMax(arg, n)
+	}
+	for _, args := range [][]*Arg{seq.Args.Required, seq.Args.Optional, seq.Args.Static} {
+		for _, arg := range args {
+			if arg != nil && arg.Name != nil {
+				setMax(*arg.Name, arg.MaxLen)
+			}
+		}
+	}
+	for _, node := range seq.Nodes {
+		for _, set := range node.Sets {
+			if set != nil && set.As != nil {
+				setMax(*set.As, set.MaxLen)
+			}
+		}
+	}
+
+	nodeNames := make([]string, 0, len(seq.Nodes))
+	for name := range seq.Nodes {
+		nodeNames = append(nodeNames, name)
+	}
+	sort.Strings(nodeNames)
+
+	var jobs uint64 = 4 // sequence start and end, and start and end of the node (or request) that calls it
+	for _, name := range nodeNames {
+		jobs += e.node(seqName, *seq.Nodes[name], maxLen)
+	}
+	return jobs
+}
+
+// node returns the max number of jobs of all expansions of the node.
+func (e *estimator) node(seqName string, node Node, maxLen map[string]uint) uint64 {
+	// One expansion
+	var size uint64 = 1 // job or wait
+	if node.IsSequence() || node.IsConditional() {
+		// Args passed to the subsequence, as named in the subsequence
+		argLen := map[string]uint{}
+		for _, arg := range node.Args {
+			if arg == nil || arg.Expected == nil || arg.Given == nil {
+				continue
+			}
+			if n, ok := maxLen[*arg.Given]; ok {
+				argLen[*arg.Expected] = n
+			}
+		}
+		size = 0
+		for _, subseq := range getCalledSequences(node) {
+			if n := e.sequence(subseq, argLen); n > size {
+				size = n
+			}
+		}
+	}
+	if len(node.Each) == 0 {
+		return size
+	}
+
+	// Number of expansions: lists must have the same length, so the shortest
+	// max length is the max
+	var n uint
+	bounded := false
+	lists := []string{}
+	for _, each := range node.Each {
+		list := strings.Split(each, ":")[0]
+		lists = append(lists, list)
+		if l, ok := maxLen[list]; ok && (!bounded || l < n) {
+			n = l
+			bounded = true
+		}
+	}
+	if !bounded {
+		e.unbounded[fmt.Sprintf("%s.%s: %s", seqName, node.Name, strings.Join(lists, ", "))] = true
+		return size
+	}
+	if n <= 1 {
+		return size
+	}
+
+	// Expansions are wrapped in a start and end job, and so is each group of
+	// parallel expansions
+	parallel := n
+	if node.Sequential {
+		parallel = 1
+	} else if node.Parallel != nil && *node.Parallel > 0 && *node.Parallel < n {
+		parallel = *node.Parallel
+	}
+	groups := uint64((n + parallel - 1) / parallel)
+	return uint64(n)*size + 2 + 2*groups
+}
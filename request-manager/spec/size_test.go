@@ -0,0 +1,76 @@
+// Copyright 2020, Square, Inc.
+
+package spec_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	. "github.com/square/spincycle/v2/request-manager/spec"
+)
+
+func chainSizeSpecs(t *testing.T) Specs {
+	specs, result := ParseSpec(specsDir + "chain-size.yaml")
+	if len(result.Errors) != 0 {
+		t.Fatal(result.Errors)
+	}
+	ProcessSpecs(&specs)
+	return specs
+}
+
+func TestEstimateChainSize(t *testing.T) {
+	// The exact number is checked against a built job chain in the graph tests
+	specs := chainSizeSpecs(t)
+	size := EstimateChainSize(specs, "chain-size")
+	expect := ChainSize{Jobs: 113, Unbounded: []string{}}
+	if diff := deep.Equal(size, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Job chain grows with the max length of the list
+	*specs.Sequences["chain-size"].Nodes["get-instances"].Sets[0] = NodeSet{
+		Arg:    strPtr("instances"),
+		As:     strPtr("instances"),
+		MaxLen: 100,
+	}
+	size = EstimateChainSize(specs, "chain-size")
+	if size.Jobs <= 113 {
+		t.Errorf("estimated %d jobs for maxLen 100, expected more than for maxLen 4", size.Jobs)
+	}
+
+	// maxLen declared on a sequence arg
+	*specs.Sequences["decommission-instance"] = Sequence{
+		Name: "decommission-instance",
+		Args: SequenceArgs{
+			Required: []*Arg{{Name: strPtr("instance")}},
+			Optional: []*Arg{{Name: strPtr("instances"), Default: strPtr(""), MaxLen: 2}},
+		},
+		Nodes: map[string]*Node{
+			"each-job": &Node{
+				Name:     "each-job",
+				Category: strPtr("job"),
+				NodeType: strPtr("decom-step-1"),
+				Each:     []string{"instances:i"},
+			},
+		},
+	}
+	size = EstimateChainSize(specs, "decommission-instance")
+	if size.Jobs != 4+2+2+2 { // sequence + each wrapper + 1 parallel group + 2 jobs
+		t.Errorf("estimated %d jobs, expected 10", size.Jobs)
+	}
+}
+
+func TestEstimateChainSizeUnbounded(t *testing.T) {
+	specs := chainSizeSpecs(t)
+	specs.Sequences["chain-size"].Nodes["get-instances"].Sets[0].MaxLen = 0
+	size := EstimateChainSize(specs, "chain-size")
+	expect := []string{
+		"chain-size.cond-each: instances",
+		"chain-size.decommission-instances: instances",
+		"chain-size.pre-flight-checks: instances",
+	}
+	if diff := deep.Equal(size.Unbounded, expect); diff != nil {
+		t.Error(diff)
+	}
+}
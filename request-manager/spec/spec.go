@@ -15,44 +15,103 @@
 
 package spec
 
+import (
+	"sort"
+)
+
 // Nodes in a sequence.
 type Node struct {
-	Name         string            `yaml:"-"`         // unique name assigned to this node
-	Category     *string           `yaml:"category"`  // "job", "sequence", or "conditional"
-	NodeType     *string           `yaml:"type"`      // the type of job or sequence to create
-	Each         []string          `yaml:"each"`      // arguments to repeat over
-	Args         []*NodeArg        `yaml:"args"`      // expected arguments
-	Parallel     *uint             `yaml:"parallel"`  // max number of sequences to run in parallel
-	Sets         []*NodeSet        `yaml:"sets"`      // expected job args to be set
-	Dependencies []string          `yaml:"deps"`      // nodes with out-edges leading to this node
-	Retry        uint              `yaml:"retry"`     // the number of times to retry a "job" that fails
-	RetryWait    string            `yaml:"retryWait"` // the time to sleep between "job" retries
-	If           *string           `yaml:"if"`        // the name of the jobArg to check for a conditional value
-	Eq           map[string]string `yaml:"eq"`        // conditional values mapping to appropriate sequence names
+	Name           string            `yaml:"-"`              // unique name assigned to this node
+	Category       *string           `yaml:"category"`       // "job", "sequence", "conditional", or "wait"
+	NodeType       *string           `yaml:"type"`           // the type of job or sequence to create
+	Each           []string          `yaml:"each"`           // arguments to repeat over
+	Args           []*NodeArg        `yaml:"args"`           // expected arguments
+	Parallel       *uint             `yaml:"parallel"`       // max number of sequences to run in parallel
+	Sequential     bool              `yaml:"sequential"`     // run each: expansions one at a time, in list order
+	ContinueOnFail bool              `yaml:"continueOnFail"` // if sequential, run remaining expansions after one fails
+	Sets           []*NodeSet        `yaml:"sets"`           // expected job args to be set
+	Dependencies   []string          `yaml:"deps"`           // nodes with out-edges leading to this node
+	Retry          uint              `yaml:"retry"`          // the number of times to retry a "job" that fails
+	RetryWait      string            `yaml:"retryWait"`      // the time to sleep between "job" retries
+	If             *string           `yaml:"if"`             // the name of the jobArg to check for a conditional value
+	Eq             map[string]string `yaml:"eq"`             // conditional values mapping to appropriate sequence names
+	Cost           uint              `yaml:"cost"`           // abstract cost/impact score of a "job" (optional)
+	Skippable      bool              `yaml:"skippable"`      // operators can skip the "job" with resume points (optional)
+	Duration       string            `yaml:"duration"`       // how long a "wait" node waits, or
+	Until          *string           `yaml:"until"`          // the name of the jobArg with the time until which a "wait" node waits
+	Description    string            `yaml:"description"`    // what the node does, for humans (optional)
+	DocsURL        string            `yaml:"docsUrl"`        // URL of more documentation, like a runbook (optional)
+
+	Env map[string]*NodeOverride `yaml:"env"` // per-environment overrides, keyed on environment name (optional)
+}
+
+// Per-environment overrides of node fields (i.e. the `env` field of a node). The
+// Request Manager applies the overrides for its environment (config.Specs.Env)
+// when it loads the specs, so one specs repo can serve many environments. Only
+// fields set in the override change the node. For example:
+//
+//	retry: 3
+//	env:
+//	  staging:
+//	    retry: 0
+//	  production:
+//	    retryWait: 30s
+type NodeOverride struct {
+	Retry     *uint   `yaml:"retry"`     // overrides Node.Retry
+	RetryWait *string `yaml:"retryWait"` // overrides Node.RetryWait
+	Parallel  *uint   `yaml:"parallel"`  // overrides Node.Parallel
+	Duration  *string `yaml:"duration"`  // overrides Node.Duration
+}
+
+// Empty returns true if the override does not set any field.
+func (o *NodeOverride) Empty() bool {
+	return o == nil || (o.Retry == nil && o.RetryWait == nil && o.Parallel == nil && o.Duration == nil)
 }
 
 // A node's args (i.e. the `args` field).
 type NodeArg struct {
 	Expected *string `yaml:"expected"` // the name of the argument that this job expects
-	Given    *string `yaml:"given"`    // the name of the argument that will be given to this job
+	Given    *string `yaml:"given"`    // the name of the argument that will be given to this job, or a template like "{cluster}.example.com"
 }
 
 // Args set by a node (i.e. the `sets` field).
 type NodeSet struct {
-	Arg *string `yaml:"arg"` // the name of the argument this job outputs by default
-	As  *string `yaml:"as"`  // the name of the argument this job should output
+	Arg    *string `yaml:"arg"`    // the name of the argument this job outputs by default
+	As     *string `yaml:"as"`     // the name of the argument this job should output
+	MaxLen uint    `yaml:"maxLen"` // max length if the arg is a list for each: (optional; see EstimateChainSize)
+
+	// Default is the value of the arg in the job data of the jobs after the job
+	// if an operator skips it. Only skippable nodes can set it (optional).
+	Default interface{} `yaml:"default"`
 }
 
 // A single sequence.
 type Sequence struct {
-	Name     string           `yaml:"-"`       // name of the sequence
-	Args     SequenceArgs     `yaml:"args"`    // arguments to the sequence
-	Nodes    map[string]*Node `yaml:"nodes"`   // list of nodes that are a part of the sequence
-	Request  bool             `yaml:"request"` // whether or not the sequence spec is a user request
-	ACL      []ACL            `yaml:"acl"`     // allowed caller roles (optional)
-	Filename string           `yaml:"_"`       // name of file this sequence was in
+	Name        string           `yaml:"-"`           // name of the sequence
+	Args        SequenceArgs     `yaml:"args"`        // arguments to the sequence
+	Nodes       map[string]*Node `yaml:"nodes"`       // list of nodes that are a part of the sequence
+	Request     bool             `yaml:"request"`     // whether or not the sequence spec is a user request
+	ACL         []ACL            `yaml:"acl"`         // allowed caller roles (optional)
+	AutoRetry   *AutoRetry       `yaml:"autoRetry"`   // auto-retry failed request (optional, request only)
+	Budget      *Budget          `yaml:"budget"`      // max request cost (optional, request only)
+	Deprecated  string           `yaml:"deprecated"`  // deprecation message, like what to use instead (optional)
+	Sunset      string           `yaml:"sunset"`      // date (SUNSET_FORMAT) from which new requests are rejected (optional, deprecated request only)
+	StopTimeout string           `yaml:"stopTimeout"` // how long the JR waits for jobs to stop (duration string, optional, request only)
+	RetryBudget *RetryBudget     `yaml:"retryBudget"` // max total retries in the job chain (optional, request only)
+	Partitions  uint             `yaml:"partitions"`  // max number of Job Runners to split the job chain across (optional, request only)
+	Placement   *Placement       `yaml:"placement"`   // how the RM chooses the Job Runner (optional, request only)
+	SLO         *SLO             `yaml:"slo"`         // service level objective of the request type (optional, request only)
+	UniqueBy    []string         `yaml:"uniqueBy"`    // args whose values must differ from every unfinished request of the type (optional, request only)
+	Description string           `yaml:"description"` // what the sequence does, for humans (optional)
+	DocsURL     string           `yaml:"docsUrl"`     // URL of more documentation, like a runbook (optional)
+	Filename    string           `yaml:"_"`           // name of file this sequence was in
+	Namespace   string           `yaml:"-"`           // namespace of the file's directory, if any (see SetNamespaces)
 }
 
+// Format of Sequence.Sunset: a date, like "2020-12-31". Requests are rejected
+// from 00:00 UTC on the sunset date.
+const SUNSET_FORMAT = "2006-01-02"
+
 // A sequence's arguments. A sequence can have required arguments; any arguments
 // on this list that are not provided by the calling sequence will result in an
 // error from template.Grapher.
@@ -65,11 +124,94 @@ type SequenceArgs struct {
 	Static   []*Arg `yaml:"static"`
 }
 
-// A sequence's args.
+// A sequence's args. Sensitive args, like passwords, are passed to jobs like any
+// arg, but clients like spinc do not display their values.
 type Arg struct {
-	Name    *string `yaml:"name"`
-	Desc    string  `yaml:"desc"`
-	Default *string `yaml:"default"`
+	Name      *string `yaml:"name"`
+	Desc      string  `yaml:"desc"`
+	Default   *string `yaml:"default"`
+	Sensitive bool    `yaml:"sensitive"`
+	MaxLen    uint    `yaml:"maxLen"` // max length if the arg is a list for each: (optional; see EstimateChainSize)
+}
+
+// Automatic retry of a failed request (i.e. the `autoRetry` field of a request
+// sequence). If all jobs that failed returned a job.Error with one of the
+// categories listed in Errors, the Request Manager creates and starts a new request
+// with the same args, up to Max times. For example:
+//
+//	autoRetry:
+//	  max: 2
+//	  errors: [infra, network]
+//
+// The categories are user-defined; they are transient errors for the request.
+type AutoRetry struct {
+	Max    uint     `yaml:"max"`    // max number of times to auto-retry the request
+	Errors []string `yaml:"errors"` // job error categories (job.Error.Category) that are transient
+}
+
+// Per-request cost budget (i.e. the `budget` field of a request sequence). The
+// cost of a request is the sum of the cost of every job in its job chain, which
+// depends on the request args (e.g. each: expansions). If Max is set, the
+// Request Manager does not create a request that costs more than Max. If Approval
+// is set, a request that costs more than Approval can only be started by callers
+// allowed the "approve" op (proto.REQUEST_OP_APPROVE). For example:
+//
+//	budget:
+//	  approval: 100
+//	  max: 500
+//
+// Costs are user-defined; they are only meaningful relative to one another.
+type Budget struct {
+	Max      uint `yaml:"max"`      // max request cost, 0 = no max
+	Approval uint `yaml:"approval"` // request cost above which approval is required, 0 = never required
+}
+
+// Per-request retry budget (i.e. the `retryBudget` field of a request sequence):
+// the max total number of job retries and sequence retries in the whole job chain.
+// Every job and sequence retry counts, on any node, until the budget is used up.
+// Then failed jobs and sequences are not retried, even if their node allows more
+// retries, so the chain fails fast. For example:
+//
+//	retryBudget:
+//	  jobRetries: 20
+//	  sequenceRetries: 3
+type RetryBudget struct {
+	JobRetries      uint `yaml:"jobRetries"`      // max total job retries, 0 = no max
+	SequenceRetries uint `yaml:"sequenceRetries"` // max total sequence retries, 0 = no max
+}
+
+// Per-request placement policy (i.e. the `placement` field of a request sequence),
+// which chooses the Job Runner that runs the request when it's started. Policy is
+// the name of a built-in policy (placement.ROUND_ROBIN, etc.) or a custom one
+// (App.Context.Plugins.Placement). Labels are passed to the policy. For example:
+//
+//	placement:
+//	  policy: label-affinity
+//	  labels:
+//	    zone: us-east-1a
+//
+// Without a placement policy, requests are sent to the default Job Runner URL.
+type Placement struct {
+	Policy string            `yaml:"policy"` // placement policy name
+	Labels map[string]string `yaml:"labels"` // Job Runner labels (optional)
+}
+
+// Per-request-type service level objective (i.e. the `slo` field of a request
+// sequence): the target fraction of finished requests that complete, and the
+// target duration within which Percentile percent of finished requests finish.
+// The Request Manager tracks how well requests of the type meet the SLO over
+// rolling windows and alerts when the SLO is burning (see package slo). For example:
+//
+//	slo:
+//	  successRate: 0.99
+//	  duration: 15m
+//	  percentile: 95
+//
+// At least one of SuccessRate or Duration must be set.
+type SLO struct {
+	SuccessRate float64 `yaml:"successRate"` // target fraction of finished requests that complete, 0 = not tracked
+	Duration    string  `yaml:"duration"`    // target request duration (duration string, optional)
+	Percentile  float64 `yaml:"percentile"`  // percent of finished requests that finish within Duration (required if Duration set)
 }
 
 // A single role-based ACL entry. Every auth.Caller (from the
@@ -87,6 +229,39 @@ type ACL struct {
 // Also contains the user defined no-op job.
 type Specs struct {
 	Sequences map[string]*Sequence `yaml:"sequences"`
+	Version   string               `yaml:"-"` // hash of all spec files, or user-provided (e.g. git SHA)
+}
+
+// WithEnv returns a copy of the node with the overrides for the environment
+// applied, or an unmodified copy if it has none.
+func (j Node) WithEnv(env string) Node {
+	o := j.Env[env]
+	if o == nil {
+		return j
+	}
+	if o.Retry != nil {
+		j.Retry = *o.Retry
+	}
+	if o.RetryWait != nil {
+		j.RetryWait = *o.RetryWait
+	}
+	if o.Parallel != nil {
+		j.Parallel = o.Parallel
+	}
+	if o.Duration != nil {
+		j.Duration = *o.Duration
+	}
+	return j
+}
+
+// Envs returns the names of the environments the node has overrides for, sorted.
+func (j *Node) Envs() []string {
+	envs := make([]string, 0, len(j.Env))
+	for env := range j.Env {
+		envs = append(envs, env)
+	}
+	sort.Strings(envs)
+	return envs
 }
 
 func (j *Node) IsJob() bool {
@@ -100,3 +275,7 @@ func (j *Node) IsSequence() bool {
 func (j *Node) IsConditional() bool {
 	return j.Category != nil && *j.Category == "conditional"
 }
+
+func (j *Node) IsWait() bool {
+	return j.Category != nil && *j.Category == "wait"
+}
@@ -0,0 +1,76 @@
+// Copyright 2020, Square, Inc.
+
+package spec
+
+import (
+	"fmt"
+	"strings"
+)
+
+// A node arg 'given' value is usually the name of a job arg, but it can also be
+// a template over job args, like "{cluster}.{region}.example.com". Each {name}
+// is replaced with the value of that job arg when the job chain is built. There
+// is no escaping: a template cannot contain literal braces.
+
+// IsArgTemplate returns true if the node arg 'given' value is a template.
+func IsArgTemplate(given string) bool {
+	return strings.ContainsAny(given, "{}")
+}
+
+// ArgTemplateRefs returns the job args referenced by the template, in order.
+// An error is returned if the template is invalid: unbalanced braces or an
+// empty {}.
+func ArgTemplateRefs(tmpl string) ([]string, error) {
+	refs := []string{}
+	rest := tmpl
+	for {
+		start := strings.IndexAny(rest, "{}")
+		if start == -1 {
+			break
+		}
+		if rest[start] == '}' {
+			return nil, fmt.Errorf("'}' without '{' in %s", tmpl)
+		}
+		end := strings.IndexAny(rest[start+1:], "{}")
+		if end == -1 || rest[start+1+end] == '{' {
+			return nil, fmt.Errorf("'{' without '}' in %s", tmpl)
+		}
+		name := rest[start+1 : start+1+end]
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("empty {} in %s", tmpl)
+		}
+		refs = append(refs, name)
+		rest = rest[start+1+end+1:]
+	}
+	return refs, nil
+}
+
+// ExpandArgTemplate returns the template with every {name} replaced by the
+// value of job arg name. An error is returned if the template is invalid or
+// a referenced job arg is not set.
+func ExpandArgTemplate(tmpl string, jobArgs map[string]interface{}) (string, error) {
+	refs, err := ArgTemplateRefs(tmpl)
+	if err != nil {
+		return "", err
+	}
+	oldnew := make([]string, 0, len(refs)*2)
+	for _, name := range refs {
+		val, ok := jobArgs[name]
+		if !ok {
+			return "", fmt.Errorf("job arg %s in %s is not set", name, tmpl)
+		}
+		oldnew = append(oldnew, "{"+name+"}", fmt.Sprintf("%v", val))
+	}
+	return strings.NewReplacer(oldnew...).Replace(tmpl), nil
+}
+
+// GivenArgs returns the job args that a node arg 'given' value uses: the args
+// referenced by the template, or the given arg itself if it's not a template.
+// Invalid templates return no args; static checks report them.
+func GivenArgs(given string) []string {
+	if !IsArgTemplate(given) {
+		return []string{given}
+	}
+	refs, _ := ArgTemplateRefs(given)
+	return refs
+}
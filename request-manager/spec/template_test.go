@@ -0,0 +1,63 @@
+// Copyright 2020, Square, Inc.
+
+package spec_test
+
+import (
+	"testing"
+
+	"github.com/go-test/deep"
+
+	. "github.com/square/spincycle/v2/request-manager/spec"
+)
+
+func TestArgTemplateRefs(t *testing.T) {
+	tests := []struct {
+		tmpl   string
+		refs   []string
+		hasErr bool
+	}{
+		{"{cluster}.{region}.example.com", []string{"cluster", "region"}, false},
+		{"db-{n}", []string{"n"}, false},
+		{"{a}{b}", []string{"a", "b"}, false},
+		{"{cluster", nil, true},
+		{"cluster}", nil, true},
+		{"{{cluster}}", nil, true},
+		{"{}.example.com", nil, true},
+	}
+	for _, test := range tests {
+		refs, err := ArgTemplateRefs(test.tmpl)
+		if (err != nil) != test.hasErr {
+			t.Errorf("%s: got error %v, expected error: %t", test.tmpl, err, test.hasErr)
+		}
+		if diff := deep.Equal(refs, test.refs); diff != nil && !test.hasErr {
+			t.Errorf("%s: %s", test.tmpl, diff)
+		}
+	}
+}
+
+func TestExpandArgTemplate(t *testing.T) {
+	jobArgs := map[string]interface{}{
+		"cluster": "db1",
+		"region":  "us-east",
+		"n":       3,
+	}
+	got, err := ExpandArgTemplate("{cluster}.{region}.example.com", jobArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "db1.us-east.example.com" {
+		t.Errorf("got %s, expected db1.us-east.example.com", got)
+	}
+
+	got, err = ExpandArgTemplate("{cluster}-{n}", jobArgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "db1-3" {
+		t.Errorf("got %s, expected db1-3", got)
+	}
+
+	if _, err := ExpandArgTemplate("{cluster}.{zone}", jobArgs); err == nil {
+		t.Errorf("got nil error for missing job arg, expected an error")
+	}
+}
@@ -29,17 +29,55 @@ const (
 type Manager interface {
 	Running(proto.StatusFilter) (proto.RunningStatus, error)
 	UpdateProgress(proto.RequestProgress) error
+
+	// Push saves the running status pushed by a Job Runner. Running uses it
+	// instead of polling the Job Runner until it's older than staleAfter. A delta
+	// push is applied to the last push only if it's the next in sequence. Else,
+	// Running polls the Job Runner until its next full push.
+	Push(proto.JobRunnerStatus) error
+
+	// JobRunners returns the last status pushed by each Job Runner that's not
+	// older than staleAfter, in order by URL. It's used to place requests on
+	// Job Runners (see placement.Policy).
+	JobRunners() []proto.JobRunnerStatus
+
+	// JobTypeTries returns the sum of the job type tries pushed by each Job
+	// Runner (proto.JobRunnerStatus.JobTypes) that's not older than staleAfter,
+	// keyed on job type. Job Runners use it for fleet-wide circuit breakers.
+	JobTypeTries() map[string]proto.JobTypeTries
 }
 
 type manager struct {
-	dbc *sql.DB
-	jrc jr.Client
+	dbc        *sql.DB
+	jrc        jr.Client
+	staleAfter time.Duration
+	pushed     map[string]pushedStatus // keyed on JR URL
+	pushedMux  *sync.Mutex             // guards pushed
 }
 
-func NewManager(dbc *sql.DB, jrClient jr.Client) Manager {
+// pushedStatus is the last status pushed by a Job Runner.
+type pushedStatus struct {
+	jobs       []proto.JobStatus
+	health     *proto.JobRunnerHealth
+	labels     map[string]string
+	version    string
+	jobTypes   map[string]proto.JobTypeTries
+	overloaded bool      // JR is over a guardrail watermark
+	seq        uint64    // push sequence number
+	gap        bool      // missed a delta push, jobs are out of date until a full push
+	at         time.Time // when received
+}
+
+// NewManager returns a Manager that polls Job Runners for running status, or uses
+// the status they push if it's not older than staleAfter. If staleAfter is zero,
+// pushed status is ignored and Job Runners are always polled.
+func NewManager(dbc *sql.DB, jrClient jr.Client, staleAfter time.Duration) Manager {
 	return &manager{
-		dbc: dbc,
-		jrc: jrClient,
+		dbc:        dbc,
+		jrc:        jrClient,
+		staleAfter: staleAfter,
+		pushed:     map[string]pushedStatus{},
+		pushedMux:  &sync.Mutex{},
 	}
 }
 
@@ -48,7 +86,7 @@ func (m *manager) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 	ctx := context.TODO()
 
 	// -------------------------------------------------------------------------
-	// Get running jobs from all JRs in parallel
+	// Get running jobs from all JRs: pushed if fresh, else poll in parallel
 	// -------------------------------------------------------------------------
 
 	jrURLs, err := m.jrURLS()
@@ -62,6 +100,10 @@ func (m *manager) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 	var wg sync.WaitGroup
 	jobStatusChan := make(chan []proto.JobStatus, len(jrURLs))
 	for _, url := range jrURLs {
+		if jobs, ok := m.pushedJobs(url, f); ok {
+			jobStatusChan <- jobs
+			continue
+		}
 		wg.Add(1)
 		go func(url string) {
 			defer wg.Done()
@@ -70,6 +112,9 @@ func (m *manager) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 				log.Warnf("error getting running status from %s: %s", url, err)
 				return
 			}
+			for i := range runningJobs {
+				runningJobs[i].JobRunnerURL = url
+			}
 			jobStatusChan <- runningJobs
 		}(url)
 	}
@@ -113,7 +158,7 @@ func (m *manager) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 		ids = append(ids, j.RequestId)
 	}
 
-	q := "SELECT request_id, type, state, user, created_at, started_at, finished_at, total_jobs, finished_jobs" +
+	q := "SELECT request_id, type, state, user, namespace, created_at, started_at, finished_at, total_jobs, finished_jobs, jr_url" +
 		" FROM requests WHERE request_id IN (" + inList(ids) + ")"
 	rows, err := m.dbc.QueryContext(ctx, q)
 	if err != nil {
@@ -125,16 +170,20 @@ func (m *manager) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 		r := proto.Request{}
 		startedAt := mysql.NullTime{}
 		finishedAt := mysql.NullTime{}
+		var jrURL sql.NullString
+		var namespace sql.NullString
 		err := rows.Scan(
 			&r.Id,
 			&r.Type,
 			&r.State,
 			&r.User,
+			&namespace,
 			&r.CreatedAt,
 			&startedAt,
 			&finishedAt,
 			&r.TotalJobs,
 			&r.FinishedJobs,
+			&jrURL,
 		)
 		if err != nil {
 			return noStatus, err
@@ -145,6 +194,12 @@ func (m *manager) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 		if finishedAt.Valid {
 			r.FinishedAt = &finishedAt.Time
 		}
+		if jrURL.Valid {
+			r.JobRunnerURL = jrURL.String
+		}
+		if namespace.Valid {
+			r.Namespace = namespace.String
+		}
 		all.Requests[r.Id] = r
 	}
 
@@ -193,6 +248,149 @@ func (m *manager) UpdateProgress(prg proto.RequestProgress) error {
 	return nil
 }
 
+func (m *manager) Push(jrs proto.JobRunnerStatus) error {
+	if jrs.JobRunnerURL == "" {
+		return serr.ValidationError{Message: "invalid proto.JobRunnerStatus: JobRunnerURL is empty, must be set"}
+	}
+	now := time.Now()
+	m.pushedMux.Lock()
+	defer m.pushedMux.Unlock()
+	ps := pushedStatus{
+		jobs:     jrs.Jobs,
+		health:   jrs.Health,
+		labels:   jrs.Labels,
+		version:  jrs.Version,
+		jobTypes: jrs.JobTypes,
+		seq:      jrs.Seq,
+		at:       now,
+	}
+	// A delta applies only to the push before it, so if this RM didn't receive
+	// that push (another RM did, or it failed), the jobs are unknown until the
+	// JR pushes all its jobs again. Meanwhile, the last jobs are kept for
+	// placement, but Running polls the JR.
+	if jrs.Delta {
+		last, ok := m.pushed[jrs.JobRunnerURL]
+		if ok && !last.gap && last.seq+1 == jrs.Seq {
+			ps.jobs = applyDelta(last.jobs, jrs.Jobs, jrs.Removed)
+		} else {
+			if ok && !last.gap {
+				log.Infof("Job Runner %s status push gap: got seq %d after %d, polling until next full push", jrs.JobRunnerURL, jrs.Seq, last.seq)
+			}
+			ps.jobs = last.jobs
+			ps.gap = true
+		}
+	}
+	// Log when a JR becomes overloaded: it's refusing new job chains, which
+	// usually means a runaway job or too many requests for too few JRs
+	if jrs.Health != nil {
+		ps.overloaded = jrs.Health.Overloaded
+		if ps.overloaded && !m.pushed[jrs.JobRunnerURL].overloaded {
+			log.Warnf("Job Runner %s is overloaded: %s", jrs.JobRunnerURL, jrs.Health.Reason)
+		}
+	}
+	m.pushed[jrs.JobRunnerURL] = ps
+	// Remove JRs that stopped pushing, e.g. shut down
+	for url, ps := range m.pushed {
+		if now.Sub(ps.at) > m.staleAfter {
+			delete(m.pushed, url)
+		}
+	}
+	return nil
+}
+
+func (m *manager) JobRunners() []proto.JobRunnerStatus {
+	m.pushedMux.Lock()
+	defer m.pushedMux.Unlock()
+	now := time.Now()
+	jrs := make([]proto.JobRunnerStatus, 0, len(m.pushed))
+	for url, ps := range m.pushed {
+		if now.Sub(ps.at) > m.staleAfter {
+			continue
+		}
+		jrs = append(jrs, proto.JobRunnerStatus{
+			JobRunnerURL: url,
+			Jobs:         ps.jobs,
+			Health:       ps.health,
+			Labels:       ps.labels,
+			Version:      ps.version,
+		})
+	}
+	sort.Slice(jrs, func(i, j int) bool { return jrs[i].JobRunnerURL < jrs[j].JobRunnerURL })
+	return jrs
+}
+
+func (m *manager) JobTypeTries() map[string]proto.JobTypeTries {
+	m.pushedMux.Lock()
+	defer m.pushedMux.Unlock()
+	now := time.Now()
+	tries := map[string]proto.JobTypeTries{}
+	for _, ps := range m.pushed {
+		if now.Sub(ps.at) > m.staleAfter {
+			continue
+		}
+		for jobType, t := range ps.jobTypes {
+			sum := tries[jobType]
+			sum.Tries += t.Tries
+			sum.Failed += t.Failed
+			tries[jobType] = sum
+		}
+	}
+	return tries
+}
+
+// pushedJobs returns a copy of the running jobs pushed by the JR, filtered, and
+// true if they are not stale. Else, it returns false and the JR should be polled.
+func (m *manager) pushedJobs(url string, f proto.StatusFilter) ([]proto.JobStatus, bool) {
+	m.pushedMux.Lock()
+	defer m.pushedMux.Unlock()
+	ps, ok := m.pushed[url]
+	if !ok || ps.gap || time.Now().Sub(ps.at) > m.staleAfter {
+		return nil, false
+	}
+	jobs := make([]proto.JobStatus, 0, len(ps.jobs))
+	for _, j := range ps.jobs {
+		if f.RequestId != "" && j.RequestId != f.RequestId {
+			continue
+		}
+		j.JobRunnerURL = url
+		jobs = append(jobs, j)
+	}
+	return jobs, true
+}
+
+// applyDelta returns the jobs with the changed jobs replaced or added, and the
+// removed jobs removed. Jobs are identified by request ID and job ID. The jobs
+// slice is not modified because Running might be reading it.
+func applyDelta(jobs, changed, removed []proto.JobStatus) []proto.JobStatus {
+	type jobKey struct{ requestId, jobId string }
+	drop := map[jobKey]bool{}
+	for _, j := range removed {
+		drop[jobKey{j.RequestId, j.JobId}] = true
+	}
+	update := map[jobKey]proto.JobStatus{}
+	for _, j := range changed {
+		update[jobKey{j.RequestId, j.JobId}] = j
+	}
+	applied := make([]proto.JobStatus, 0, len(jobs)+len(changed))
+	for _, j := range jobs {
+		k := jobKey{j.RequestId, j.JobId}
+		if drop[k] {
+			continue
+		}
+		if u, ok := update[k]; ok {
+			j = u
+			delete(update, k)
+		}
+		applied = append(applied, j)
+	}
+	for _, j := range changed {
+		if _, ok := update[jobKey{j.RequestId, j.JobId}]; ok {
+			applied = append(applied, j) // new job
+		}
+	}
+	return applied
+}
+
 func (m *manager) jrURLS() ([]string, error) {
 	// Make a list of the URLs of all JR hosts currently running any requests.
 	ctx := context.TODO()
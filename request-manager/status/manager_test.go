@@ -62,7 +62,7 @@ func TestIncrementFinishedJobs(t *testing.T) {
 	dbName := setup(t, rmtest.DataPath+"/request-default.sql")
 	defer teardown(t, dbName)
 
-	m := status.NewManager(dbc, &mock.JRClient{})
+	m := status.NewManager(dbc, &mock.JRClient{}, 0)
 
 	prg := proto.RequestProgress{
 		RequestId:    reqId,
@@ -124,7 +124,7 @@ func TestRunningJobRetried(t *testing.T) {
 		},
 	}
 
-	m := status.NewManager(dbc, mockJRC)
+	m := status.NewManager(dbc, mockJRC, 0)
 	got, err := m.Running(proto.StatusFilter{})
 	if err != nil {
 		t.Fatal(err)
@@ -141,11 +141,226 @@ func TestRunningJobRetried(t *testing.T) {
 				StartedAt:    &ts,
 				TotalJobs:    3,
 				FinishedJobs: 0,
+				JobRunnerURL: "http://localhost",
 			},
 		},
 		Jobs: []proto.JobStatus{job1Status, job2Status, job3Status},
 	}
+	for i := range expect.Jobs {
+		expect.Jobs[i].JobRunnerURL = "http://localhost" // set by RM
+	}
 	if diff := deep.Equal(got, expect); diff != nil {
 		t.Error(diff)
 	}
 }
+
+func TestRunningPushed(t *testing.T) {
+	reqId := "aaabbbcccdddeeefff00" // running on JR http://localhost
+	dbName := setup(t, rmtest.DataPath+"/retry-job-live-status.sql")
+	defer teardown(t, dbName)
+
+	polled := false
+	mockJRC := &mock.JRClient{
+		RunningFunc: func(baseURL string, f proto.StatusFilter) ([]proto.JobStatus, error) {
+			polled = true
+			return []proto.JobStatus{{RequestId: reqId, JobId: "polled"}}, nil
+		},
+	}
+
+	m := status.NewManager(dbc, mockJRC, time.Minute)
+	err := m.Push(proto.JobRunnerStatus{
+		JobRunnerURL: "http://localhost",
+		Jobs: []proto.JobStatus{
+			{RequestId: reqId, JobId: "pushed"},
+			{RequestId: "other", JobId: "filtered"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Pushed status is fresh: used instead of polling, filtered by request ID
+	got, err := m.Running(proto.StatusFilter{RequestId: reqId})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if polled {
+		t.Errorf("JR polled, expected pushed status to be used")
+	}
+	expect := []proto.JobStatus{{RequestId: reqId, JobId: "pushed", JobRunnerURL: "http://localhost"}}
+	if diff := deep.Equal(got.Jobs, expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Pushed status is stale (staleAfter=0): fall back to polling
+	m = status.NewManager(dbc, mockJRC, 0)
+	if err := m.Push(proto.JobRunnerStatus{JobRunnerURL: "http://localhost"}); err != nil {
+		t.Fatal(err)
+	}
+	got, err = m.Running(proto.StatusFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !polled {
+		t.Errorf("JR not polled, expected fallback to polling")
+	}
+	expect = []proto.JobStatus{{RequestId: reqId, JobId: "polled", JobRunnerURL: "http://localhost"}}
+	if diff := deep.Equal(got.Jobs, expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestRunningPushedDeltaGap(t *testing.T) {
+	reqId := "aaabbbcccdddeeefff00" // running on JR http://localhost
+	dbName := setup(t, rmtest.DataPath+"/retry-job-live-status.sql")
+	defer teardown(t, dbName)
+
+	polled := false
+	mockJRC := &mock.JRClient{
+		RunningFunc: func(baseURL string, f proto.StatusFilter) ([]proto.JobStatus, error) {
+			polled = true
+			return []proto.JobStatus{{RequestId: reqId, JobId: "polled"}}, nil
+		},
+	}
+	m := status.NewManager(dbc, mockJRC, time.Minute)
+	running := func(expect []proto.JobStatus, expectPolled bool) {
+		t.Helper()
+		polled = false
+		got, err := m.Running(proto.StatusFilter{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if polled != expectPolled {
+			t.Errorf("polled %t, expected %t", polled, expectPolled)
+		}
+		if diff := deep.Equal(got.Jobs, expect); diff != nil {
+			t.Error(diff)
+		}
+	}
+	push := func(jrs proto.JobRunnerStatus) {
+		t.Helper()
+		jrs.JobRunnerURL = "http://localhost"
+		if err := m.Push(jrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Full push, then the next delta in sequence is applied
+	push(proto.JobRunnerStatus{Seq: 1, Jobs: []proto.JobStatus{{RequestId: reqId, JobId: "job1"}}})
+	push(proto.JobRunnerStatus{Seq: 2, Delta: true, Jobs: []proto.JobStatus{{RequestId: reqId, JobId: "job2"}}})
+	running([]proto.JobStatus{
+		{RequestId: reqId, JobId: "job1", JobRunnerURL: "http://localhost"},
+		{RequestId: reqId, JobId: "job2", JobRunnerURL: "http://localhost"},
+	}, false)
+
+	// Missed push 3 (gap): poll the JR, even on later deltas, until a full push
+	push(proto.JobRunnerStatus{Seq: 4, Delta: true, Removed: []proto.JobStatus{{RequestId: reqId, JobId: "job1"}}})
+	running([]proto.JobStatus{{RequestId: reqId, JobId: "polled", JobRunnerURL: "http://localhost"}}, true)
+	push(proto.JobRunnerStatus{Seq: 5, Delta: true})
+	running([]proto.JobStatus{{RequestId: reqId, JobId: "polled", JobRunnerURL: "http://localhost"}}, true)
+	push(proto.JobRunnerStatus{Seq: 6, Jobs: []proto.JobStatus{{RequestId: reqId, JobId: "job2"}}})
+	running([]proto.JobStatus{{RequestId: reqId, JobId: "job2", JobRunnerURL: "http://localhost"}}, false)
+}
+
+func TestJobRunnersDeltas(t *testing.T) {
+	m := status.NewManager(nil, &mock.JRClient{}, time.Minute)
+	pushed := []proto.JobRunnerStatus{
+		{
+			JobRunnerURL: "http://jr1",
+			Seq:          1,
+			Jobs: []proto.JobStatus{
+				{RequestId: "req1", JobId: "job1", Try: 1},
+				{RequestId: "req1", JobId: "job2", Try: 1},
+				{RequestId: "req2", JobId: "job1", Try: 1},
+			},
+		},
+		{
+			JobRunnerURL: "http://jr1",
+			Seq:          2,
+			Delta:        true,
+			Jobs: []proto.JobStatus{
+				{RequestId: "req1", JobId: "job2", Try: 2},
+				{RequestId: "req3", JobId: "job1", Try: 1},
+			},
+			Removed: []proto.JobStatus{{RequestId: "req2", JobId: "job1"}},
+		},
+	}
+	for _, jrs := range pushed {
+		if err := m.Push(jrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := []proto.JobRunnerStatus{
+		{
+			JobRunnerURL: "http://jr1",
+			Jobs: []proto.JobStatus{
+				{RequestId: "req1", JobId: "job1", Try: 1},
+				{RequestId: "req1", JobId: "job2", Try: 2},
+				{RequestId: "req3", JobId: "job1", Try: 1},
+			},
+		},
+	}
+	if diff := deep.Equal(m.JobRunners(), expect); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestJobRunners(t *testing.T) {
+	// Pushed status isn't saved in the db
+	m := status.NewManager(nil, &mock.JRClient{}, time.Minute)
+	health := &proto.JobRunnerHealth{Overloaded: true}
+	pushed := []proto.JobRunnerStatus{
+		{JobRunnerURL: "http://jr2", Labels: map[string]string{"zone": "west"}, Version: "2.0.4"},
+		{JobRunnerURL: "http://jr1", Jobs: []proto.JobStatus{{RequestId: "req1", JobId: "job1"}}, Health: health},
+	}
+	for _, jrs := range pushed {
+		if err := m.Push(jrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := []proto.JobRunnerStatus{pushed[1], pushed[0]} // by URL
+	if diff := deep.Equal(m.JobRunners(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Stale pushes aren't returned
+	m = status.NewManager(nil, &mock.JRClient{}, 0)
+	if err := m.Push(pushed[0]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if got := m.JobRunners(); len(got) != 0 {
+		t.Errorf("got %d Job Runners, expected 0 (stale)", len(got))
+	}
+}
+
+func TestJobTypeTries(t *testing.T) {
+	m := status.NewManager(nil, &mock.JRClient{}, time.Minute)
+	pushed := []proto.JobRunnerStatus{
+		{JobRunnerURL: "http://jr1", JobTypes: map[string]proto.JobTypeTries{"a": {Tries: 10, Failed: 2}, "b": {Tries: 1}}},
+		{JobRunnerURL: "http://jr2", JobTypes: map[string]proto.JobTypeTries{"a": {Tries: 5, Failed: 5}}},
+		{JobRunnerURL: "http://jr3"},
+	}
+	for _, jrs := range pushed {
+		if err := m.Push(jrs); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := map[string]proto.JobTypeTries{
+		"a": {Tries: 15, Failed: 7},
+		"b": {Tries: 1},
+	}
+	if diff := deep.Equal(m.JobTypeTries(), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// Stale pushes aren't counted
+	m = status.NewManager(nil, &mock.JRClient{}, 0)
+	if err := m.Push(pushed[0]); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(time.Millisecond)
+	if got := m.JobTypeTries(); len(got) != 0 {
+		t.Errorf("got %d job types, expected 0 (stale)", len(got))
+	}
+}
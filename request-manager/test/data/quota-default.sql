@@ -0,0 +1,19 @@
+/*
+  This data is used by tests in the request-manager/quota package.
+*/
+
+-- default user quota, and quotas for user "alice", team "dba", and namespace "payments"
+INSERT INTO quotas (scope, name, max_running, max_daily) VALUES ('user', '', 10, 0), ('user', 'alice', 2, 0), ('team', 'dba', 0, 3), ('namespace', 'payments', 1, 0);
+
+-- alice: 2 running requests (1 pending, 1 running) and 1 complete request, created long ago
+INSERT INTO requests (request_id, type, user, created_at, state) VALUES ("quota_alice_pending_", 'some-type', 'alice', '2017-09-13 00:00:00', 1);
+INSERT INTO requests (request_id, type, user, created_at, state) VALUES ("quota_alice_running_", 'some-type', 'alice', '2017-09-13 00:00:00', 2);
+INSERT INTO requests (request_id, type, user, created_at, state) VALUES ("quota_alice_complete", 'some-type', 'alice', '2017-09-13 00:00:00', 3);
+
+-- bob (team dba): 1 running request, and 2 complete requests created today
+INSERT INTO requests (request_id, type, user, team, created_at, state) VALUES ("quota_bob_running___", 'some-type', 'bob', 'dba', NOW(6), 2);
+INSERT INTO requests (request_id, type, user, team, created_at, state) VALUES ("quota_bob_complete1_", 'some-type', 'bob', 'dba', NOW(6), 3);
+INSERT INTO requests (request_id, type, user, team, created_at, state) VALUES ("quota_bob_complete2_", 'some-type', 'bob', 'dba', '2017-09-13 00:00:00', 3);
+
+-- namespace payments: 1 running request by dan
+INSERT INTO requests (request_id, type, user, namespace, created_at, state) VALUES ("quota_payments_run__", 'some-type', 'dan', 'payments', NOW(6), 2);
@@ -0,0 +1,19 @@
+/*
+  This data is used by auto-retry and (manual) retry tests in the request-manager/request package.
+*/
+
+-- a running request: one job failed with a transient error category
+INSERT INTO requests (request_id, type, created_at, state, total_jobs, finished_jobs, jr_url, user) VALUES ("b9uvdi8tk9kahl8ppvbg", 'three-nodes', '2017-09-13 01:00:00', 2, 3, 1, "http://jr:0000", "john");
+INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("b9uvdi8tk9kahl8ppvbg", '{"Type":"three-nodes","Args":{"foo":"foo-value"},"User":"john"}', '', '{}');
+INSERT INTO job_log (request_id, job_id, name, try, type, state, error, error_category) VALUES ("b9uvdi8tk9kahl8ppvbg", "ldfi", "a", 1, "aJobType", 3, NULL, NULL),
+  ("b9uvdi8tk9kahl8ppvbg", "590s", "b", 1, "bJobType", 4, "connection refused", "infra");
+
+-- a running request: one job failed with an error that's not transient
+INSERT INTO requests (request_id, type, created_at, state, total_jobs, finished_jobs, jr_url, user) VALUES ("c9uvdi8tk9kahl8ppvbg", 'three-nodes', '2017-09-13 02:00:00', 2, 3, 1, "http://jr:0000", "john");
+INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("c9uvdi8tk9kahl8ppvbg", '{"Type":"three-nodes","Args":{"foo":"foo-value"},"User":"john"}', '', '{}');
+INSERT INTO job_log (request_id, job_id, name, try, type, state, error, error_category) VALUES ("c9uvdi8tk9kahl8ppvbg", "ldfi", "a", 1, "aJobType", 3, NULL, NULL),
+  ("c9uvdi8tk9kahl8ppvbg", "590s", "b", 1, "bJobType", 4, "host not found", NULL);
+
+-- a failed request that can be retried
+INSERT INTO requests (request_id, type, created_at, started_at, finished_at, state, total_jobs, finished_jobs, jr_url, user) VALUES ("d9uvdi8tk9kahl8ppvbg", 'three-nodes', '2017-09-13 03:00:00', '2017-09-13 03:00:01', '2017-09-13 03:10:00', 4, 3, 1, "http://jr:0000", "john");
+INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("d9uvdi8tk9kahl8ppvbg", '{"Type":"three-nodes","Args":{"foo":"foo-value"},"User":"john"}', '[{"Pos":0,"Name":"foo","Type":"required","Given":true,"Value":"foo-value"},{"Pos":0,"Name":"bar","Type":"optional","Given":false,"Default":175,"Value":175}]', '{}');
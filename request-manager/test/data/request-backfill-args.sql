@@ -0,0 +1,16 @@
+/*
+  This data is used by request args backfill tests in the request-manager/request package.
+*/
+
+-- a request created before request_args: needs backfill
+INSERT INTO requests (request_id, type, created_at, state, user) VALUES ("b9uvdi8tk9kahl8ppvbg", 'three-nodes', '2017-09-13 01:00:00', 3, "john");
+INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("b9uvdi8tk9kahl8ppvbg", '{}', '[{"Name":"host","Type":"required","Value":"db1"},{"Name":"port","Type":"optional","Value":3306}]', '{}');
+
+-- a request without args: nothing to backfill
+INSERT INTO requests (request_id, type, created_at, state, user) VALUES ("c9uvdi8tk9kahl8ppvbg", 'three-nodes', '2017-09-13 02:00:00', 3, "john");
+INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("c9uvdi8tk9kahl8ppvbg", '{}', '', '{}');
+
+-- a request already in request_args: not changed
+INSERT INTO requests (request_id, type, created_at, state, user) VALUES ("d9uvdi8tk9kahl8ppvbg", 'three-nodes', '2017-09-13 03:00:00', 3, "john");
+INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("d9uvdi8tk9kahl8ppvbg", '{}', '[{"Name":"host","Type":"required","Value":"db2"}]', '{}');
+INSERT INTO request_args (request_id, name, value) VALUES ("d9uvdi8tk9kahl8ppvbg", "host", "db2");
@@ -5,10 +5,12 @@
 -- a pending request + job chain
 INSERT INTO requests (request_id, type, user, created_at, state) VALUES ("0874a524aa1edn3ysp00", 'some-type', 'john', '2017-09-13 00:00:00', 1);
 INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("0874a524aa1edn3ysp00", '{"some":"param"}', '', '{"requestId":"0874a524aa1edn3ysp00","jobs":{"1q2w":{"id":"1q2w","type":"dummy","bytes":null,"state":1,"args":null,"data":null,"retry":0}},"adjacencyList":null,"state":1}');
+INSERT INTO request_args (request_id, name, value) VALUES ("0874a524aa1edn3ysp00", "host", "db1"), ("0874a524aa1edn3ysp00", "port", "3306");
 
 -- a running request + job chain + job logs
 INSERT INTO requests (request_id, type, created_at, state, total_jobs, finished_jobs, jr_url, user) VALUES ("454ae2f98a05cv16sdwt", 'do-something', '2017-09-13 01:00:00', 2, 4, 1, "http://jr:0000", "finch");
 INSERT INTO request_archives (request_id, create_request, args, job_chain) VALUES ("454ae2f98a05cv16sdwt", '{"some":"param"}', '', '{"requestId":"454ae2f98a05cv16sdwt","jobs":{"590s":{"id":"590s","type":"fake","bytes":null,"state":3,"args":null,"data":null,"retry":0},"9sa1":{"id":"9sa1","type":"fake","bytes":null,"state":4,"args":null,"data":null,"retry":0},"di12":{"id":"di12","type":"fake","bytes":null,"state":3,"args":null,"data":null,"retry":0},"g012":{"id":"g012","type":"fake","bytes":null,"state":1,"args":null,"data":null,"retry":0},"ldfi":{"id":"ldfi","type":"fake","bytes":null,"state":2,"args":null,"data":null,"retry":0},"pzi8":{"id":"pzi8","type":"fake","bytes":null,"state":1,"args":null,"data":null,"retry":0}},"adjacencyList":{"590s":["g012"],"9sa1":["pzi8"],"di12":["ldfi","590s","9sa1"],"g012":["pzi8"],"ldfi":["pzi8"]},"state":2}');
+INSERT INTO request_args (request_id, name, value) VALUES ("454ae2f98a05cv16sdwt", "host", "db1"), ("454ae2f98a05cv16sdwt", "port", "3307");
 INSERT INTO job_log (request_id, job_id, name, try, type, state) VALUES ("454ae2f98a05cv16sdwt", "di12", "", 0, "fake", 3),
 ("454ae2f98a05cv16sdwt", "590s", "", 0, "fake", 4), -- this job failed on its first try
 ("454ae2f98a05cv16sdwt", "590s", "", 1, "fake", 3), -- succeeded on its second
@@ -0,0 +1,22 @@
+/*
+  This data is used by tests in the request-manager/slo package.
+*/
+
+-- slo-type: 10 requests finished in the last hour, 8 complete and 2 failed. 9 took
+-- 1 minute and 1 took 20 minutes.
+INSERT INTO requests (request_id, type, user, created_at, started_at, finished_at, state) VALUES
+  ("slo_complete_1______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_2______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_3______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_4______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_5______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_6______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_7______", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 3),
+  ("slo_complete_slow___", 'slo-type', 'finch', NOW(6) - INTERVAL 50 MINUTE, NOW(6) - INTERVAL 50 MINUTE, NOW(6) - INTERVAL 30 MINUTE, 3),
+  ("slo_failed_1________", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 4),
+  ("slo_failed_2________", 'slo-type', 'finch', NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 30 MINUTE, NOW(6) - INTERVAL 29 MINUTE, 4);
+
+-- slo-type: 1 request finished 2 days ago (only in the 7 day window), and 1 still running
+INSERT INTO requests (request_id, type, user, created_at, started_at, finished_at, state) VALUES
+  ("slo_complete_old____", 'slo-type', 'finch', NOW(6) - INTERVAL 2 DAY, NOW(6) - INTERVAL 2 DAY, NOW(6) - INTERVAL 2 DAY, 3),
+  ("slo_running_________", 'slo-type', 'finch', NOW(6) - INTERVAL 5 MINUTE, NOW(6) - INTERVAL 5 MINUTE, NULL, 2);
@@ -0,0 +1,7 @@
+/*
+  This data is used by tests in the request-manager/upgrade package.
+*/
+
+-- http://jr1 is running 1 request, http://jr2 is running none
+INSERT INTO requests (request_id, type, user, created_at, state, jr_url) VALUES ("upgrade_jr1_running_", 'some-type', 'finch', '2017-09-13 00:00:00', 2, 'http://jr1');
+INSERT INTO requests (request_id, type, user, created_at, state, jr_url) VALUES ("upgrade_jr2_complete", 'some-type', 'finch', '2017-09-13 00:00:00', 3, 'http://jr2');
@@ -0,0 +1,301 @@
+// Copyright 2020, Square, Inc.
+
+// Package upgrade provides rolling Job Runner upgrades.
+package upgrade
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+
+	serr "github.com/square/spincycle/v2/errors"
+	jr "github.com/square/spincycle/v2/job-runner"
+	"github.com/square/spincycle/v2/proto"
+)
+
+const (
+	DEFAULT_DRAIN_TIMEOUT  = "10m"
+	DEFAULT_HEALTH_TIMEOUT = "5m"
+)
+
+// A Manager coordinates rolling Job Runner upgrades, one Job Runner at a time:
+// drain it, wait for its job chains to finish, wait for deploy tooling to replace
+// it, then wait for the replaced Job Runner to respond before draining the next.
+// Upgrades are saved in the jr_upgrades table and advanced lazily by Advance, so
+// any Request Manager can serve and advance an upgrade.
+type Manager interface {
+	// Create starts an upgrade by draining the first Job Runner. Only one upgrade
+	// can be in progress.
+	Create(proto.CreateJobRunnerUpgrade) (proto.JobRunnerUpgrade, error)
+
+	// Get returns the upgrade. It does not change the upgrade.
+	Get(upgradeId string) (proto.JobRunnerUpgrade, error)
+
+	// Advance advances the upgrade to the next step, if the current step is done,
+	// and returns it. Deploy tooling should call Advance periodically.
+	Advance(upgradeId string) (proto.JobRunnerUpgrade, error)
+
+	// Replaced tells the upgrade that deploy tooling replaced the current Job
+	// Runner. The upgrade must be in the UPGRADE_STEP_REPLACE step.
+	Replaced(upgradeId string, r proto.JobRunnerReplaced) error
+}
+
+// manager implements the Manager interface
+type manager struct {
+	dbc *sql.DB
+	jrc jr.Client
+}
+
+func NewManager(dbc *sql.DB, jrc jr.Client) Manager {
+	return &manager{
+		dbc: dbc,
+		jrc: jrc,
+	}
+}
+
+func (m *manager) Create(cu proto.CreateJobRunnerUpgrade) (proto.JobRunnerUpgrade, error) {
+	var u proto.JobRunnerUpgrade
+	if len(cu.JobRunnerURLs) == 0 {
+		return u, serr.ValidationError{Message: "invalid proto.CreateJobRunnerUpgrade: JobRunnerURLs is empty, must set at least one"}
+	}
+	for _, url := range cu.JobRunnerURLs {
+		if url == "" {
+			return u, serr.ValidationError{Message: "invalid proto.CreateJobRunnerUpgrade: JobRunnerURLs has an empty URL"}
+		}
+	}
+	if cu.DrainTimeout == "" {
+		cu.DrainTimeout = DEFAULT_DRAIN_TIMEOUT
+	}
+	if cu.HealthTimeout == "" {
+		cu.HealthTimeout = DEFAULT_HEALTH_TIMEOUT
+	}
+	if _, err := time.ParseDuration(cu.DrainTimeout); err != nil {
+		return u, serr.ValidationError{Message: fmt.Sprintf("invalid DrainTimeout %s: %s", cu.DrainTimeout, err)}
+	}
+	if _, err := time.ParseDuration(cu.HealthTimeout); err != nil {
+		return u, serr.ValidationError{Message: fmt.Sprintf("invalid HealthTimeout %s: %s", cu.HealthTimeout, err)}
+	}
+
+	ctx := context.TODO()
+	var running string
+	err := m.dbc.QueryRowContext(ctx, "SELECT upgrade_id FROM jr_upgrades WHERE step NOT IN (?, ?) LIMIT 1",
+		proto.UPGRADE_STEP_DONE, proto.UPGRADE_STEP_FAILED).Scan(&running)
+	switch err {
+	case nil:
+		return u, serr.ValidationError{Message: fmt.Sprintf("job runner upgrade %s is in progress: wait for it to finish", running)}
+	case sql.ErrNoRows:
+	default:
+		return u, serr.NewDbError(err, "SELECT jr_upgrades")
+	}
+
+	// Drain first JR before saving the upgrade so a bad URL is reported now
+	if err := m.jrc.Drain(cu.JobRunnerURLs[0]); err != nil {
+		return u, fmt.Errorf("error draining %s: %s", cu.JobRunnerURLs[0], err)
+	}
+
+	now := time.Now().UTC()
+	u = proto.JobRunnerUpgrade{
+		Id:            xid.New().String(),
+		JobRunnerURLs: cu.JobRunnerURLs,
+		Step:          proto.UPGRADE_STEP_DRAIN,
+		StepStartedAt: now,
+		DrainTimeout:  cu.DrainTimeout,
+		HealthTimeout: cu.HealthTimeout,
+		CreatedAt:     now,
+	}
+	urls, err := json.Marshal(u.JobRunnerURLs)
+	if err != nil {
+		return u, err
+	}
+	_, err = m.dbc.ExecContext(ctx,
+		"INSERT INTO jr_upgrades (upgrade_id, jr_urls, current, step, step_started_at, drain_timeout, health_timeout, created_at)"+
+			" VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		u.Id, urls, u.Current, u.Step, u.StepStartedAt, u.DrainTimeout, u.HealthTimeout, u.CreatedAt)
+	if err != nil {
+		return u, serr.NewDbError(err, "INSERT jr_upgrades")
+	}
+	log.Infof("job runner upgrade %s: draining %s (1 of %d)", u.Id, u.JobRunnerURLs[0], len(u.JobRunnerURLs))
+
+	return m.Advance(u.Id) // set RunningChains
+}
+
+func (m *manager) Get(upgradeId string) (proto.JobRunnerUpgrade, error) {
+	ctx := context.TODO()
+	u, err := m.get(ctx, upgradeId)
+	if err != nil {
+		return u, err
+	}
+	if u.Step == proto.UPGRADE_STEP_DRAIN {
+		err = m.setRunningChains(ctx, &u)
+	}
+	return u, err
+}
+
+func (m *manager) Advance(upgradeId string) (proto.JobRunnerUpgrade, error) {
+	ctx := context.TODO()
+	for {
+		u, err := m.get(ctx, upgradeId)
+		if err != nil {
+			return u, err
+		}
+		changed, err := m.advance(ctx, &u)
+		if err != nil || !changed {
+			return u, err
+		}
+		// Re-read and advance again because the next step might be done, too,
+		// like drain when the next JR isn't running any chains
+	}
+}
+
+func (m *manager) Replaced(upgradeId string, r proto.JobRunnerReplaced) error {
+	ctx := context.TODO()
+	u, err := m.get(ctx, upgradeId)
+	if err != nil {
+		return err
+	}
+	if u.Step != proto.UPGRADE_STEP_REPLACE {
+		return serr.ValidationError{
+			Message: fmt.Sprintf("job runner upgrade %s is in step %s, not %s", u.Id, u.Step, proto.UPGRADE_STEP_REPLACE),
+		}
+	}
+	old := u.JobRunnerURLs[u.Current]
+	if r.JobRunnerURL != "" {
+		u.JobRunnerURLs[u.Current] = r.JobRunnerURL
+	}
+	if _, err := m.setStep(ctx, u, u.Current, proto.UPGRADE_STEP_HEALTH, ""); err != nil {
+		return err
+	}
+	log.Infof("job runner upgrade %s: %s replaced by %s", u.Id, old, u.JobRunnerURLs[u.Current])
+	return nil
+}
+
+// ------------------------------------------------------------------------- //
+
+// advance moves the upgrade to the next step if the current step is done.
+// It returns true if the upgrade was changed in the database, by this or
+// another Request Manager.
+func (m *manager) advance(ctx context.Context, u *proto.JobRunnerUpgrade) (bool, error) {
+	url := u.JobRunnerURLs[u.Current]
+	elapsed := time.Now().UTC().Sub(u.StepStartedAt)
+
+	switch u.Step {
+	case proto.UPGRADE_STEP_DRAIN:
+		// The JR is draining, so it won't start new chains. Wait for the chains
+		// it's running to finish. On timeout, the remaining chains are suspended
+		// when the JR is stopped and resumed on another JR.
+		if err := m.setRunningChains(ctx, u); err != nil {
+			return false, err
+		}
+		n := u.RunningChains
+		timeout, _ := time.ParseDuration(u.DrainTimeout) // validated in Create
+		if n > 0 && elapsed < timeout {
+			return false, nil
+		}
+		if n > 0 {
+			log.Warnf("job runner upgrade %s: drain timeout on %s with %d running job chains, they will be suspended when it's stopped", u.Id, url, n)
+		}
+		return m.setStep(ctx, *u, u.Current, proto.UPGRADE_STEP_REPLACE, "")
+
+	case proto.UPGRADE_STEP_HEALTH:
+		err := m.jrc.Ping(url)
+		if err != nil {
+			timeout, _ := time.ParseDuration(u.HealthTimeout) // validated in Create
+			if elapsed < timeout {
+				return false, nil
+			}
+			return m.setStep(ctx, *u, u.Current, proto.UPGRADE_STEP_FAILED,
+				fmt.Sprintf("%s not healthy after %s: %s", url, u.HealthTimeout, err))
+		}
+		next := u.Current + 1
+		if int(next) == len(u.JobRunnerURLs) {
+			log.Infof("job runner upgrade %s: done", u.Id)
+			return m.setStep(ctx, *u, u.Current, proto.UPGRADE_STEP_DONE, "")
+		}
+		nextURL := u.JobRunnerURLs[next]
+		if err := m.jrc.Drain(nextURL); err != nil {
+			return m.setStep(ctx, *u, u.Current, proto.UPGRADE_STEP_FAILED,
+				fmt.Sprintf("error draining %s: %s", nextURL, err))
+		}
+		log.Infof("job runner upgrade %s: draining %s (%d of %d)", u.Id, nextURL, next+1, len(u.JobRunnerURLs))
+		return m.setStep(ctx, *u, next, proto.UPGRADE_STEP_DRAIN, "")
+	}
+
+	// UPGRADE_STEP_REPLACE waits for Replaced; done and failed are final
+	return false, nil
+}
+
+// setRunningChains sets the number of job chains running on the current Job
+// Runner, which is only meaningful in the UPGRADE_STEP_DRAIN step.
+func (m *manager) setRunningChains(ctx context.Context, u *proto.JobRunnerUpgrade) error {
+	var n uint
+	q := "SELECT COUNT(*) FROM requests WHERE jr_url = ? AND state = ?"
+	if err := m.dbc.QueryRowContext(ctx, q, u.JobRunnerURLs[u.Current], proto.STATE_RUNNING).Scan(&n); err != nil {
+		return serr.NewDbError(err, "SELECT requests")
+	}
+	u.RunningChains = n
+	return nil
+}
+
+// setStep updates the upgrade from its current JR and step to the given JR and
+// step. The update is conditional on the current JR and step, so if another
+// Request Manager changed the upgrade first, it's not changed again.
+func (m *manager) setStep(ctx context.Context, u proto.JobRunnerUpgrade, current uint, step, errMsg string) (bool, error) {
+	urls, err := json.Marshal(u.JobRunnerURLs)
+	if err != nil {
+		return false, err
+	}
+	var errCol interface{}
+	if errMsg != "" {
+		errCol = errMsg
+		log.Errorf("job runner upgrade %s failed: %s", u.Id, errMsg)
+	}
+	_, err = m.dbc.ExecContext(ctx,
+		"UPDATE jr_upgrades SET jr_urls = ?, current = ?, step = ?, step_started_at = ?, error = ?"+
+			" WHERE upgrade_id = ? AND current = ? AND step = ?",
+		urls, current, step, time.Now().UTC(), errCol, u.Id, u.Current, u.Step)
+	if err != nil {
+		return false, serr.NewDbError(err, "UPDATE jr_upgrades")
+	}
+	return true, nil
+}
+
+func (m *manager) get(ctx context.Context, upgradeId string) (proto.JobRunnerUpgrade, error) {
+	var u proto.JobRunnerUpgrade
+	var urls []byte
+	var errMsg sql.NullString
+	q := "SELECT upgrade_id, jr_urls, current, step, step_started_at, drain_timeout, health_timeout, error, created_at" +
+		" FROM jr_upgrades WHERE upgrade_id = ?"
+	err := m.dbc.QueryRowContext(ctx, q, upgradeId).Scan(
+		&u.Id,
+		&urls,
+		&u.Current,
+		&u.Step,
+		&u.StepStartedAt,
+		&u.DrainTimeout,
+		&u.HealthTimeout,
+		&errMsg,
+		&u.CreatedAt,
+	)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		return u, serr.UpgradeNotFound{UpgradeId: upgradeId}
+	default:
+		return u, serr.NewDbError(err, "SELECT jr_upgrades")
+	}
+	if err := json.Unmarshal(urls, &u.JobRunnerURLs); err != nil {
+		return u, fmt.Errorf("cannot decode jr_urls: %s", err)
+	}
+	if int(u.Current) >= len(u.JobRunnerURLs) {
+		return u, fmt.Errorf("job runner upgrade %s: current %d out of range of %d job runners", u.Id, u.Current, len(u.JobRunnerURLs))
+	}
+	if errMsg.Valid {
+		u.Error = errMsg.String
+	}
+	return u, nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2020, Square, Inc.
+
+package upgrade_test
+
+import (
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/test"
+	testdb "github.com/square/spincycle/v2/request-manager/test/db"
+	"github.com/square/spincycle/v2/request-manager/upgrade"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+var dbm testdb.Manager
+var dbc *sql.DB
+
+func setup(t *testing.T, dataFile string) string {
+	// Setup a db manager to handle databases for all tests.
+	var err error
+	if dbm == nil {
+		dbm, err = testdb.NewManager()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Setup a db for this specific test, and seed it with some default data.
+	dbName, err := dbm.Create(dataFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := dbm.Connect(dbName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbc = db
+
+	return dbName
+}
+
+func teardown(t *testing.T, dbName string) {
+	if err := dbm.Destroy(dbName); err != nil {
+		t.Fatal(err)
+	}
+	dbc.Close()
+}
+
+// //////////////////////////////////////////////////////////////////////////
+// Tests
+// //////////////////////////////////////////////////////////////////////////
+
+func TestUpgrade(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/upgrade-default.sql")
+	defer teardown(t, dbName)
+
+	drained := []string{}
+	var pingErr error
+	jrc := &mock.JRClient{
+		DrainFunc: func(baseURL string) error {
+			drained = append(drained, baseURL)
+			return nil
+		},
+		PingFunc: func(baseURL string) error {
+			return pingErr
+		},
+	}
+	m := upgrade.NewManager(dbc, jrc)
+
+	// Create drains first JR, which is running 1 chain
+	u, err := m.Create(proto.CreateJobRunnerUpgrade{JobRunnerURLs: []string{"http://jr1", "http://jr2"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Step != proto.UPGRADE_STEP_DRAIN || u.Current != 0 || u.RunningChains != 1 {
+		t.Errorf("got step %s current %d running %d, expected drain 0 1", u.Step, u.Current, u.RunningChains)
+	}
+	if u.DrainTimeout != upgrade.DEFAULT_DRAIN_TIMEOUT || u.HealthTimeout != upgrade.DEFAULT_HEALTH_TIMEOUT {
+		t.Errorf("got timeouts %s %s, expected defaults", u.DrainTimeout, u.HealthTimeout)
+	}
+	if len(drained) != 1 || drained[0] != "http://jr1" {
+		t.Errorf("drained %v, expected [http://jr1]", drained)
+	}
+
+	// Only one upgrade at a time
+	_, err = m.Create(proto.CreateJobRunnerUpgrade{JobRunnerURLs: []string{"http://jr3"}})
+	if _, ok := err.(serr.ValidationError); !ok {
+		t.Errorf("got err %v, expected a ValidationError", err)
+	}
+
+	// Replaced before drain is done is an error
+	if err := m.Replaced(u.Id, proto.JobRunnerReplaced{}); err == nil {
+		t.Errorf("no error from Replaced during drain step, expected one")
+	}
+
+	// Chain finishes -> replace step
+	if _, err := dbc.Exec("UPDATE requests SET state = ? WHERE request_id = 'upgrade_jr1_running_'", proto.STATE_COMPLETE); err != nil {
+		t.Fatal(err)
+	}
+	u, err = m.Advance(u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Step != proto.UPGRADE_STEP_REPLACE {
+		t.Errorf("got step %s, expected %s", u.Step, proto.UPGRADE_STEP_REPLACE)
+	}
+
+	// Replaced with new URL, but not healthy yet -> health step
+	pingErr = fmt.Errorf("connection refused")
+	if err := m.Replaced(u.Id, proto.JobRunnerReplaced{JobRunnerURL: "http://jr1-new"}); err != nil {
+		t.Fatal(err)
+	}
+	u, err = m.Advance(u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Step != proto.UPGRADE_STEP_HEALTH || u.JobRunnerURLs[0] != "http://jr1-new" {
+		t.Errorf("got step %s url %s, expected health http://jr1-new", u.Step, u.JobRunnerURLs[0])
+	}
+
+	// Healthy -> drain next JR, which isn't running any chains -> replace step
+	pingErr = nil
+	u, err = m.Advance(u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Current != 1 || u.Step != proto.UPGRADE_STEP_REPLACE {
+		t.Errorf("got current %d step %s, expected 1 replace", u.Current, u.Step)
+	}
+	if len(drained) != 2 || drained[1] != "http://jr2" {
+		t.Errorf("drained %v, expected [http://jr1 http://jr2]", drained)
+	}
+
+	// Last JR replaced and healthy -> done
+	if err := m.Replaced(u.Id, proto.JobRunnerReplaced{}); err != nil {
+		t.Fatal(err)
+	}
+	u, err = m.Advance(u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Step != proto.UPGRADE_STEP_DONE || u.Error != "" {
+		t.Errorf("got step %s error '%s', expected done and no error", u.Step, u.Error)
+	}
+
+	// Get doesn't change the upgrade
+	got, err := m.Get(u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(got, u); diff != nil {
+		t.Error(diff)
+	}
+
+	// Unknown upgrade
+	_, err = m.Get("nope")
+	if _, ok := err.(serr.UpgradeNotFound); !ok {
+		t.Errorf("got err %v, expected UpgradeNotFound", err)
+	}
+	_, err = m.Advance("nope")
+	if _, ok := err.(serr.UpgradeNotFound); !ok {
+		t.Errorf("got err %v, expected UpgradeNotFound", err)
+	}
+}
+
+func TestUpgradeHealthTimeout(t *testing.T) {
+	dbName := setup(t, test.DataPath+"/upgrade-default.sql")
+	defer teardown(t, dbName)
+
+	jrc := &mock.JRClient{
+		PingFunc: func(baseURL string) error {
+			return fmt.Errorf("connection refused")
+		},
+	}
+	m := upgrade.NewManager(dbc, jrc)
+
+	u, err := m.Create(proto.CreateJobRunnerUpgrade{JobRunnerURLs: []string{"http://jr2"}, HealthTimeout: "0s"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Step != proto.UPGRADE_STEP_REPLACE {
+		t.Fatalf("got step %s, expected %s", u.Step, proto.UPGRADE_STEP_REPLACE)
+	}
+	if err := m.Replaced(u.Id, proto.JobRunnerReplaced{}); err != nil {
+		t.Fatal(err)
+	}
+	u, err = m.Advance(u.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.Step != proto.UPGRADE_STEP_FAILED {
+		t.Errorf("got step %s, expected %s", u.Step, proto.UPGRADE_STEP_FAILED)
+	}
+	expectErr := "http://jr2 not healthy after 0s: connection refused"
+	if u.Error != expectErr {
+		t.Errorf("got error '%s', expected '%s'", u.Error, expectErr)
+	}
+
+	// Failed upgrade doesn't block a new one
+	if _, err := m.Create(proto.CreateJobRunnerUpgrade{JobRunnerURLs: []string{"http://jr2"}}); err != nil {
+		t.Errorf("got err %v, expected nil", err)
+	}
+}
@@ -0,0 +1,272 @@
+// Copyright 2020, Square, Inc.
+
+// Package writebuf provides a write-behind buffer for Request Manager writes from
+// Job Runners: job logs and request progress. If MySQL is briefly unavailable,
+// like during a failover, writes are queued in memory and retried until MySQL
+// is available again, so the Job Runner calls do not fail.
+package writebuf
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"expvar"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/config"
+)
+
+// ErrFull is returned by Write when the buffer is full. The caller should try
+// again later (HTTP 503).
+var ErrFull = errors.New("database unavailable and write buffer is full, try again later")
+
+// Write buffer metrics published as expvars (GET /debug/vars on the Request Manager API).
+var (
+	// Queued is the number of writes queued now.
+	Queued = expvar.NewInt("write_buffer_queued")
+
+	// Flushed counts queued writes that were retried and succeeded.
+	Flushed = expvar.NewInt("write_buffer_flushed")
+
+	// Rejected counts writes rejected (ErrFull) because the buffer was full.
+	Rejected = expvar.NewInt("write_buffer_rejected")
+
+	// Dropped counts queued writes that were lost: retried and failed with an
+	// error other than the database being unavailable, or still queued when the
+	// Request Manager stopped.
+	Dropped = expvar.NewInt("write_buffer_dropped")
+)
+
+// A Buffer queues writes that fail because the database is unavailable and
+// retries them in order. It's safe for concurrent use.
+type Buffer interface {
+	// Write calls write. If it fails because the database is unavailable (see
+	// Unavailable), write is queued and retried until it succeeds, and Write
+	// returns true and no error. While writes are queued, write is queued without
+	// calling it, so writes are done in order. If key is not empty, write replaces
+	// a queued write with the same key, like request progress where only the latest
+	// matters. If the buffer is full, Write returns ErrFull. Other errors from
+	// write are returned.
+	Write(key string, write func() error) (bool, error)
+
+	// Len returns the number of queued writes.
+	Len() int
+
+	// Stop retries queued writes once, drops the ones that still fail, and stops
+	// the buffer. Writes after Stop are not buffered.
+	Stop()
+}
+
+// Disabled is a Buffer that does not buffer: Write calls write and returns its
+// error.
+var Disabled Buffer = disabled{}
+
+type disabled struct{}
+
+func (disabled) Write(key string, write func() error) (bool, error) { return false, write() }
+func (disabled) Len() int                                           { return 0 }
+func (disabled) Stop()                                              {}
+
+type queued struct {
+	key      string
+	write    func() error
+	replaced uint // number of times write was replaced (key)
+}
+
+type buffer struct {
+	maxQueued     uint
+	retryInterval time.Duration
+	// --
+	*sync.Mutex // guards queue and stopped
+	queue       []*queued
+	stopped     bool
+	stopChan    chan struct{}
+	doneChan    chan struct{}
+	stopOnce    *sync.Once
+}
+
+// NewBuffer returns a Buffer configured by cfg, or Disabled if cfg.MaxQueued is zero.
+func NewBuffer(cfg config.WriteBuffer) (Buffer, error) {
+	if cfg.MaxQueued == 0 {
+		return Disabled, nil
+	}
+	retryInterval, err := time.ParseDuration(cfg.RetryInterval)
+	if err != nil || retryInterval <= 0 {
+		return nil, fmt.Errorf("invalid retry_interval %s: must be a duration greater than zero", cfg.RetryInterval)
+	}
+	b := &buffer{
+		maxQueued:     cfg.MaxQueued,
+		retryInterval: retryInterval,
+		Mutex:         &sync.Mutex{},
+		queue:         []*queued{},
+		stopChan:      make(chan struct{}),
+		doneChan:      make(chan struct{}),
+		stopOnce:      &sync.Once{},
+	}
+	go b.flush()
+	return b, nil
+}
+
+func (b *buffer) Write(key string, write func() error) (bool, error) {
+	b.Lock()
+	if b.stopped {
+		b.Unlock()
+		return false, write()
+	}
+	if len(b.queue) > 0 {
+		// Database was unavailable and queued writes haven't been retried yet
+		defer b.Unlock()
+		if err := b.enqueue(key, write); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	b.Unlock()
+
+	err := write()
+	if err == nil || !Unavailable(err) {
+		return false, err
+	}
+
+	b.Lock()
+	defer b.Unlock()
+	if b.stopped {
+		return false, err
+	}
+	if qerr := b.enqueue(key, write); qerr != nil {
+		return false, qerr
+	}
+	log.Warnf("database unavailable, write queued (%d queued): %s", len(b.queue), err)
+	return true, nil
+}
+
+func (b *buffer) Len() int {
+	b.Lock()
+	defer b.Unlock()
+	return len(b.queue)
+}
+
+func (b *buffer) Stop() {
+	b.stopOnce.Do(func() {
+		close(b.stopChan)
+		<-b.doneChan
+	})
+}
+
+// enqueue queues the write, or replaces the queued write with the same key. The
+// caller must lock b.
+func (b *buffer) enqueue(key string, write func() error) error {
+	if key != "" {
+		for _, q := range b.queue {
+			if q.key == key {
+				q.write = write
+				q.replaced++
+				return nil
+			}
+		}
+	}
+	if uint(len(b.queue)) >= b.maxQueued {
+		Rejected.Add(1)
+		return ErrFull
+	}
+	b.queue = append(b.queue, &queued{key: key, write: write})
+	Queued.Set(int64(len(b.queue)))
+	return nil
+}
+
+// flush retries queued writes every retry interval until Stop is called.
+func (b *buffer) flush() {
+	defer close(b.doneChan)
+	ticker := time.NewTicker(b.retryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			b.retry()
+		case <-b.stopChan:
+			b.retry()
+			b.Lock()
+			b.stopped = true
+			if n := len(b.queue); n > 0 {
+				log.Errorf("dropped %d queued writes on shutdown: database unavailable", n)
+				Dropped.Add(int64(n))
+			}
+			b.queue = nil
+			Queued.Set(0)
+			b.Unlock()
+			return
+		}
+	}
+}
+
+// retry retries queued writes in order until one fails because the database is
+// still unavailable.
+func (b *buffer) retry() {
+	for {
+		b.Lock()
+		if len(b.queue) == 0 {
+			b.Unlock()
+			return
+		}
+		q := b.queue[0]
+		write, replaced := q.write, q.replaced
+		b.Unlock()
+
+		err := write()
+
+		b.Lock()
+		if err != nil && Unavailable(err) {
+			b.Unlock()
+			return // try again next interval
+		}
+		// If the write was replaced while retrying it, the replacement is
+		// retried next. Else it's done: written or dropped.
+		if q.replaced != replaced {
+			b.Unlock()
+			continue
+		}
+		b.queue = b.queue[1:]
+		Queued.Set(int64(len(b.queue)))
+		b.Unlock()
+
+		if err != nil {
+			log.Errorf("dropped queued write: %s", err)
+			Dropped.Add(1)
+		} else {
+			Flushed.Add(1)
+		}
+	}
+}
+
+// Unavailable returns true if err means the database is unavailable, like a lost
+// connection, a timeout, or a MySQL instance that is read-only or shutting down
+// during a failover, so the write can succeed when it's retried.
+func Unavailable(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, mysql.ErrInvalidConn) ||
+		errors.Is(err, sql.ErrConnDone) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		switch myErr.Number {
+		case 1040, // ER_CON_COUNT_ERROR: too many connections
+			1053, // ER_SERVER_SHUTDOWN
+			1290, // ER_OPTION_PREVENTS_STATEMENT: --read-only
+			1792, // ER_CANT_EXECUTE_IN_READ_ONLY_TRANSACTION
+			1836: // ER_READ_ONLY_MODE
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,180 @@
+// Copyright 2020, Square, Inc.
+
+package writebuf_test
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/config"
+	serr "github.com/square/spincycle/v2/errors"
+	"github.com/square/spincycle/v2/request-manager/writebuf"
+)
+
+// db is a fake database that's unavailable until up is set.
+type db struct {
+	*sync.Mutex
+	up      bool
+	written []string
+}
+
+func (d *db) write(v string) func() error {
+	return func() error {
+		d.Lock()
+		defer d.Unlock()
+		if !d.up {
+			return serr.NewDbError(driver.ErrBadConn, "INSERT")
+		}
+		d.written = append(d.written, v)
+		return nil
+	}
+}
+
+func (d *db) set(up bool) {
+	d.Lock()
+	d.up = up
+	d.Unlock()
+}
+
+func (d *db) get() []string {
+	d.Lock()
+	defer d.Unlock()
+	return append([]string{}, d.written...)
+}
+
+func TestWrite(t *testing.T) {
+	b, err := writebuf.NewBuffer(config.WriteBuffer{MaxQueued: 3, RetryInterval: "10ms"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Stop()
+	d := &db{Mutex: &sync.Mutex{}, up: true}
+
+	// Database available: written now
+	queued, err := b.Write("", d.write("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if queued {
+		t.Error("queued = true, expected false")
+	}
+
+	// Other errors are returned, not queued
+	queued, err = b.Write("", func() error { return errors.New("duplicate") })
+	if err == nil || queued {
+		t.Errorf("got queued %t, error %v; expected error and not queued", queued, err)
+	}
+
+	// Database unavailable: queued until full. Writes with the same key replace
+	// the queued write.
+	d.set(false)
+	rejected := writebuf.Rejected.Value()
+	for _, v := range []string{"b", "c"} {
+		queued, err := b.Write("", d.write(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !queued {
+			t.Errorf("%s not queued, expected it to be queued", v)
+		}
+	}
+	if _, err := b.Write("p1", d.write("p1-old")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Write("p1", d.write("p1-new")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.Write("", d.write("d")); err != writebuf.ErrFull {
+		t.Errorf("got error %v, expected ErrFull", err)
+	}
+	if n := writebuf.Rejected.Value() - rejected; n != 1 {
+		t.Errorf("rejected %d, expected 1", n)
+	}
+	if n := b.Len(); n != 3 {
+		t.Errorf("queued %d, expected 3", n)
+	}
+
+	// Database available again: queued writes are written in order
+	d.set(true)
+	for i := 0; i < 100 && b.Len() > 0; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if diff := deep.Equal(d.get(), []string{"a", "b", "c", "p1-new"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestStop(t *testing.T) {
+	b, err := writebuf.NewBuffer(config.WriteBuffer{MaxQueued: 10, RetryInterval: "1h"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &db{Mutex: &sync.Mutex{}}
+
+	dropped := writebuf.Dropped.Value()
+	for _, v := range []string{"a", "b"} {
+		if _, err := b.Write("", d.write(v)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Stop()
+	if n := writebuf.Dropped.Value() - dropped; n != 2 {
+		t.Errorf("dropped %d, expected 2", n)
+	}
+
+	// Not buffered after Stop
+	queued, err := b.Write("", d.write("c"))
+	if err == nil || queued {
+		t.Errorf("got queued %t, error %v; expected error and not queued", queued, err)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	b, err := writebuf.NewBuffer(config.WriteBuffer{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != writebuf.Disabled {
+		t.Errorf("got %T, expected writebuf.Disabled", b)
+	}
+	d := &db{Mutex: &sync.Mutex{}}
+	queued, err := b.Write("", d.write("a"))
+	if err == nil || queued {
+		t.Errorf("got queued %t, error %v; expected error and not queued", queued, err)
+	}
+
+	if _, err := writebuf.NewBuffer(config.WriteBuffer{MaxQueued: 1, RetryInterval: "0s"}); err == nil {
+		t.Error("no error for retry interval 0s, expected an error")
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	unavailable := []error{
+		driver.ErrBadConn,
+		mysql.ErrInvalidConn,
+		serr.NewDbError(driver.ErrBadConn, "UPDATE requests"),
+		fmt.Errorf("wrapped: %w", &mysql.MySQLError{Number: 1290, Message: "read-only"}),
+	}
+	for _, err := range unavailable {
+		if !writebuf.Unavailable(err) {
+			t.Errorf("Unavailable(%v) = false, expected true", err)
+		}
+	}
+	available := []error{
+		errors.New("some error"),
+		&mysql.MySQLError{Number: 1062, Message: "duplicate entry"},
+		serr.ErrDuplicateJobLog{RequestId: "abc"},
+	}
+	for _, err := range available {
+		if writebuf.Unavailable(err) {
+			t.Errorf("Unavailable(%v) = true, expected false", err)
+		}
+	}
+}
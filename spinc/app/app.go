@@ -9,6 +9,7 @@ import (
 	"log"
 	"net/http"
 
+	"github.com/square/spincycle/v2/job"
 	"github.com/square/spincycle/v2/request-manager"
 	"github.com/square/spincycle/v2/spinc/config"
 )
@@ -34,6 +35,7 @@ type Context struct {
 	Command  config.Command // command and args, if any ("start <request>", etc.)
 	RMClient rm.Client      // Request Manager client
 	Nargs    int            // number of positional args including command
+	Color    bool           // print color: Out is a terminal and not --no-color
 }
 
 type Command interface {
@@ -54,6 +56,7 @@ type HTTPClientFactory interface {
 type Factories struct {
 	HTTPClient HTTPClientFactory
 	Command    CommandFactory
+	Jobs       job.Factory // for 'spinc local' (default: jobs.Factory)
 }
 
 type Hooks struct {
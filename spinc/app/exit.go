@@ -0,0 +1,84 @@
+// Copyright 2020, Square, Inc.
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager"
+)
+
+// Exit codes returned by spinc, one per failure class, so scripts can handle
+// failures without parsing error messages. They're documented in the spinc docs;
+// do not change them.
+const (
+	EXIT_OK             = 0 // success
+	EXIT_ERROR          = 1 // any other error, like invalid command line
+	EXIT_API_ERROR      = 2 // Request Manager returned an error or cannot be reached
+	EXIT_AUTH_ERROR     = 3 // Request Manager denied the caller (HTTP 401 or 403)
+	EXIT_REQUEST_FAILED = 4 // request did not complete
+	EXIT_TIMEOUT        = 5 // Request Manager did not respond within --timeout
+)
+
+// ErrRequestFailed is returned by a command when a request it ran or waited for
+// did not complete. spinc exits EXIT_REQUEST_FAILED.
+type ErrRequestFailed struct {
+	RequestId string
+	State     byte // proto.STATE_*
+}
+
+func (e ErrRequestFailed) Error() string {
+	if e.RequestId == "" {
+		return fmt.Sprintf("request did not complete: %s", proto.StateName[e.State])
+	}
+	return fmt.Sprintf("request %s did not complete: %s", e.RequestId, proto.StateName[e.State])
+}
+
+// ExitCode returns the exit code for the error returned by spinc.Run: EXIT_OK
+// if err is nil or ErrHelp, else the EXIT_* code of its failure class.
+func ExitCode(err error) int {
+	if err == nil || err == ErrHelp {
+		return EXIT_OK
+	}
+	switch v := err.(type) {
+	case ErrRequestFailed:
+		return EXIT_REQUEST_FAILED
+	case rm.APIError:
+		if v.HTTPStatus == http.StatusUnauthorized || v.HTTPStatus == http.StatusForbidden {
+			return EXIT_AUTH_ERROR
+		}
+		return EXIT_API_ERROR
+	case proto.Error:
+		return EXIT_API_ERROR // 404 or 409, like request not found
+	case net.Error:
+		// Includes *url.Error from the http.Client
+		if v.Timeout() {
+			return EXIT_TIMEOUT
+		}
+		return EXIT_API_ERROR
+	}
+	if err == context.DeadlineExceeded {
+		return EXIT_TIMEOUT
+	}
+	return EXIT_ERROR
+}
+
+// IsTerminal returns true if w is a terminal (TTY), not a file or pipe. spinc
+// prints color only to a terminal.
+func IsTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeCharDevice != 0
+}
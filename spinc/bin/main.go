@@ -20,7 +20,7 @@ func main() {
 	if err := spinc.Run(defaultContext); err != nil {
 		if err != app.ErrHelp {
 			fmt.Fprintln(os.Stderr, err)
-			os.Exit(1)
 		}
+		os.Exit(app.ExitCode(err))
 	}
 }
@@ -0,0 +1,101 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/prompt"
+)
+
+// finalizeStates are the states that 'spinc admin finalize --state' accepts, keyed
+// on lowercase name. The Request Manager allows only these final states.
+var finalizeStates = map[string]byte{
+	"fail":    proto.STATE_FAIL,
+	"failed":  proto.STATE_FAIL,
+	"stop":    proto.STATE_STOPPED,
+	"stopped": proto.STATE_STOPPED,
+}
+
+// Admin runs Request Manager admin operations. The only operation is finalize:
+// forcibly set the final state of a request whose Job Runner is unrecoverable.
+type Admin struct {
+	ctx    app.Context
+	subCmd string
+	reqId  string
+	state  byte
+}
+
+func NewAdmin(ctx app.Context) *Admin {
+	return &Admin{
+		ctx: ctx,
+	}
+}
+
+func (c *Admin) Prepare() error {
+	args := c.ctx.Command.Args
+	if len(args) != 2 || args[0] != "finalize" {
+		return fmt.Errorf("Usage: spinc admin finalize <request ID> --state failed|stopped --reason <why>\n")
+	}
+	c.subCmd = args[0]
+	c.reqId = args[1]
+
+	state, ok := finalizeStates[strings.ToLower(c.ctx.Options.State)]
+	if !ok {
+		return fmt.Errorf("Invalid --state '%s': must be failed or stopped", c.ctx.Options.State)
+	}
+	c.state = state
+	if strings.TrimSpace(c.ctx.Options.Reason) == "" {
+		return fmt.Errorf("--reason is required: why the request is finalized, like \"JR host lost, jobs checked by hand\"")
+	}
+	return nil
+}
+
+func (c *Admin) Run() error {
+	// Finalizing skips the Job Runner, so always confirm
+	if !c.ctx.Options.Yes {
+		req, err := c.ctx.RMClient.GetRequest(c.reqId)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.ctx.Out, "Request %s (%s) by %s: %s on Job Runner %s, %d of %d jobs complete\n",
+			req.Id, req.Type, req.User, proto.StateName[req.State], req.JobRunnerURL, req.FinishedJobs, req.TotalJobs)
+		fmt.Fprintf(c.ctx.Out, "Finalize as %s: %s (use --yes to skip confirmation)\n", proto.StateName[c.state], c.ctx.Options.Reason)
+		ok := prompt.NewConfirmationPrompt("Enter 'finalize' to finalize, or anything else to abort: ", "finalize", c.ctx.In, c.ctx.Out)
+		if err := ok.Prompt(); err != nil {
+			return fmt.Errorf("Not finalized")
+		}
+	}
+
+	req, err := c.ctx.RMClient.FinalizeRequest(c.reqId, proto.FinalizeRequest{
+		State:  c.state,
+		Reason: c.ctx.Options.Reason,
+	})
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(req, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !c.ctx.Options.Quiet {
+		fmt.Fprintf(c.ctx.Out, "OK, finalized %s as %s\n", req.Id, proto.StateName[req.State])
+	}
+	return nil
+}
+
+func (c *Admin) Cmd() string {
+	return "admin " + c.subCmd + " " + c.reqId
+}
+
+func (c *Admin) Help() string {
+	return "'spinc admin finalize <request ID> --state failed|stopped --reason <why>' sets the final state\n" +
+		"of a pending or running request whose Job Runner is unrecoverable, instead of changing it in the\n" +
+		"database. If the Job Runner still has the request, the Request Manager returns an error: stop the\n" +
+		"request instead. The change, with your username and reason, is saved in the request audit record.\n" +
+		"It prints the request and requires confirmation unless --yes is specified. Only admins can\n" +
+		"finalize requests.\n"
+}
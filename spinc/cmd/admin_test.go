@@ -0,0 +1,137 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestAdminFinalize(t *testing.T) {
+	var gotFinalize *proto.FinalizeRequest
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:           reqId,
+				Type:         "restart-db",
+				State:        proto.STATE_RUNNING,
+				User:         "finch",
+				JobRunnerURL: "http://jr1",
+				TotalJobs:    4,
+				FinishedJobs: 1,
+			}, nil
+		},
+		FinalizeRequestFunc: func(reqId string, f proto.FinalizeRequest) (proto.Request, error) {
+			gotFinalize = &f
+			return proto.Request{Id: reqId, Type: "restart-db", State: f.State}, nil
+		},
+	}
+	output := &bytes.Buffer{}
+	ctx := app.Context{
+		In:       bytes.NewBufferString("finalize\n"),
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{State: "failed", Reason: "jr1 host lost"},
+		Command: config.Command{
+			Cmd:  "admin",
+			Args: []string{"finalize", "b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	admin := cmd.NewAdmin(ctx)
+	if err := admin.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotFinalize == nil {
+		t.Fatal("request not finalized")
+	}
+	if gotFinalize.State != proto.STATE_FAIL || gotFinalize.Reason != "jr1 host lost" {
+		t.Errorf("got %+v, expected state FAIL and reason 'jr1 host lost'", *gotFinalize)
+	}
+
+	expectOutput := `Request b9uvdi8tk9kahl8ppvbg (restart-db) by finch: RUNNING on Job Runner http://jr1, 1 of 4 jobs complete
+Finalize as FAIL: jr1 host lost (use --yes to skip confirmation)
+Enter 'finalize' to finalize, or anything else to abort: OK, finalized b9uvdi8tk9kahl8ppvbg as FAIL
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+
+	if got := admin.Cmd(); got != "admin finalize b9uvdi8tk9kahl8ppvbg" {
+		t.Errorf("Cmd() = %s, expected admin finalize b9uvdi8tk9kahl8ppvbg", got)
+	}
+}
+
+func TestAdminFinalizeAbort(t *testing.T) {
+	var gotFinalize *proto.FinalizeRequest
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:           reqId,
+				Type:         "restart-db",
+				State:        proto.STATE_RUNNING,
+				User:         "finch",
+				JobRunnerURL: "http://jr1",
+				TotalJobs:    4,
+				FinishedJobs: 1,
+			}, nil
+		},
+		FinalizeRequestFunc: func(reqId string, f proto.FinalizeRequest) (proto.Request, error) {
+			gotFinalize = &f
+			return proto.Request{Id: reqId, Type: "restart-db", State: f.State}, nil
+		},
+	}
+	ctx := app.Context{
+		In:       bytes.NewBufferString("no\n"),
+		Out:      &bytes.Buffer{},
+		RMClient: rmc,
+		Options:  config.Options{State: "stopped", Reason: "jr1 host lost"},
+		Command: config.Command{
+			Cmd:  "admin",
+			Args: []string{"finalize", "b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	admin := cmd.NewAdmin(ctx)
+	if err := admin.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := admin.Run(); err == nil {
+		t.Error("no error, expected Not finalized")
+	}
+	if gotFinalize != nil {
+		t.Errorf("request finalized, expected abort")
+	}
+}
+
+func TestAdminPrepareErrors(t *testing.T) {
+	cases := []struct {
+		args    []string
+		options config.Options
+	}{
+		{[]string{}, config.Options{State: "failed", Reason: "lost"}},
+		{[]string{"finalize"}, config.Options{State: "failed", Reason: "lost"}},
+		{[]string{"unfinalize", "b9uvdi8tk9kahl8ppvbg"}, config.Options{State: "failed", Reason: "lost"}},
+		{[]string{"finalize", "b9uvdi8tk9kahl8ppvbg"}, config.Options{Reason: "lost"}},                    // no state
+		{[]string{"finalize", "b9uvdi8tk9kahl8ppvbg"}, config.Options{State: "complete", Reason: "lost"}}, // not allowed
+		{[]string{"finalize", "b9uvdi8tk9kahl8ppvbg"}, config.Options{State: "failed"}},                   // no reason
+	}
+	for i, c := range cases {
+		ctx := app.Context{
+			Options: c.options,
+			Command: config.Command{Cmd: "admin", Args: c.args},
+		}
+		if err := cmd.NewAdmin(ctx).Prepare(); err == nil {
+			t.Errorf("case %d: no error, expected one", i)
+		}
+	}
+}
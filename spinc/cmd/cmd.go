@@ -8,6 +8,9 @@ import (
 	"fmt"
 	"strings"
 
+	"github.com/logrusorgru/aurora"
+
+	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/spinc/app"
 )
 
@@ -15,6 +18,9 @@ var (
 	ErrNotExist = errors.New("command does not exist")
 )
 
+// REDACTED is printed instead of the value of sensitive request args.
+const REDACTED = "********"
+
 type ErrUnknownArgs struct {
 	Request string
 	Args    []string
@@ -29,14 +35,28 @@ type DefaultFactory struct {
 
 func (f *DefaultFactory) Make(name string, ctx app.Context) (app.Command, error) {
 	switch name {
+	case "admin":
+		return NewAdmin(ctx), nil
 	case "log":
 		return NewLog(ctx), nil
 	case "ps":
 		return NewPs(ctx), nil
 	case "running":
 		return NewRunning(ctx), nil
+	case "describe":
+		return NewDescribe(ctx), nil
 	case "find":
 		return NewFind(ctx), nil
+	case "history":
+		return NewHistory(ctx), nil
+	case "export":
+		return NewExport(ctx), nil
+	case "import":
+		return NewImport(ctx), nil
+	case "resume":
+		return NewResume(ctx), nil
+	case "retry":
+		return NewRetry(ctx), nil
 	case "start":
 		return NewStart(ctx), nil
 	case "status":
@@ -49,6 +69,16 @@ func (f *DefaultFactory) Make(name string, ctx app.Context) (app.Command, error)
 		return NewVersion(ctx), nil
 	case "info":
 		return NewInfo(ctx), nil
+	case "job":
+		return NewJob(ctx), nil
+	case "jobs":
+		return NewJobs(ctx), nil
+	case "local":
+		return NewLocal(ctx), nil
+	case "group":
+		return NewGroup(ctx), nil
+	case "spec":
+		return NewSpec(ctx), nil
 	default:
 		return nil, ErrNotExist
 	}
@@ -84,3 +114,62 @@ func QuoteArgValue(val string) string {
 	// Return in "" and escape inner ", if any
 	return `"` + strings.Replace(val, `"`, `\"`, -1) + `"`
 }
+
+// ArgValue returns the request arg value to print, or REDACTED if the arg is
+// sensitive. The value is not quoted; see QuoteArgValue.
+func ArgValue(arg proto.RequestArg) string {
+	if arg.Sensitive {
+		return REDACTED
+	}
+	return fmt.Sprintf("%v", arg.Value)
+}
+
+// ArgSource returns where the request arg value came from: the arg type (required,
+// optional, or static), or "default" if it's an optional arg that was not given.
+func ArgSource(arg proto.RequestArg) string {
+	if arg.Type == proto.ARG_TYPE_OPTIONAL && !arg.Given {
+		return "default"
+	}
+	return arg.Type
+}
+
+// ArgValueType returns the JSON type of the request arg value: string, number,
+// bool, list, map, or null. Args given on the command line are strings, but args
+// given to the API can be any JSON type.
+func ArgValueType(val interface{}) string {
+	switch val.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "bool"
+	case float64, float32, int, int64, int32, uint, uint64, uint32:
+		return "number"
+	case []interface{}:
+		return "list"
+	case map[string]interface{}:
+		return "map"
+	default:
+		return fmt.Sprintf("%T", val)
+	}
+}
+
+// StateName returns the name of the request or job state, in color if ctx.Color:
+// green if complete, red if failed, and yellow if running or pending.
+func StateName(ctx app.Context, state byte) string {
+	name, ok := proto.StateName[state]
+	if !ok {
+		name = proto.StateName[proto.STATE_UNKNOWN]
+	}
+	color := aurora.NewAurora(ctx.Color)
+	switch state {
+	case proto.STATE_COMPLETE:
+		return color.Green(name).String()
+	case proto.STATE_FAIL, proto.STATE_DEADLINE_EXCEEDED, proto.STATE_FAILED_RESUME:
+		return color.Red(name).String()
+	case proto.STATE_RUNNING, proto.STATE_PENDING:
+		return color.Yellow(name).String()
+	}
+	return name
+}
@@ -0,0 +1,59 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	v "github.com/square/spincycle/v2/version"
+)
+
+// commandFeatures are the Request Manager features that commands require.
+// Commands not listed work with every Request Manager.
+var commandFeatures = map[string]string{
+	"admin":    proto.FEATURE_FINALIZE,
+	"describe": proto.FEATURE_REQUEST_TYPES,
+	"export":   proto.FEATURE_REQUEST_EXPORT,
+	"group":    proto.FEATURE_REQUEST_GROUPS,
+	"history":  proto.FEATURE_REQUEST_HISTORY,
+	"import":   proto.FEATURE_REQUEST_EXPORT,
+	"job":      proto.FEATURE_JOB_TRIES,
+	"resume":   proto.FEATURE_RESUME_POINTS,
+	"retry":    proto.FEATURE_REQUEST_RETRY,
+}
+
+// CheckCompat returns warnings if the Request Manager is too old for the command,
+// or spinc is too old for the Request Manager API. Only commands that require a
+// feature are checked, so other commands do not make an extra API call. Errors
+// are ignored because the command reports them when it runs.
+func CheckCompat(ctx app.Context, cmd string) []string {
+	feature, ok := commandFeatures[cmd]
+	if !ok || ctx.RMClient == nil {
+		return nil
+	}
+	sv, err := ctx.RMClient.ServerVersion()
+	if err != nil {
+		if ctx.Options.Debug {
+			app.Debug("ServerVersion error: %s", err)
+		}
+		if _, ok := err.(proto.Error); ok {
+			// 404: Request Manager older than GET /api/v1/version, so it's
+			// older than every feature
+			return []string{fmt.Sprintf("Request Manager is older than spinc %s and does not report its features: 'spinc %s' requires feature %s and might not work. Upgrade the Request Manager.",
+				v.Version(), cmd, feature)}
+		}
+		return nil
+	}
+	warnings := []string{}
+	if sv.APIVersion > proto.API_VERSION {
+		warnings = append(warnings, fmt.Sprintf("Request Manager %s API v%d is newer than spinc %s API v%d. Upgrade spinc.",
+			sv.Version, sv.APIVersion, v.Version(), proto.API_VERSION))
+	}
+	if !sv.HasFeature(feature) {
+		warnings = append(warnings, fmt.Sprintf("Request Manager %s does not have feature %s: 'spinc %s' might not work. Upgrade the Request Manager.",
+			sv.Version, feature, cmd))
+	}
+	return warnings
+}
@@ -0,0 +1,98 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+type Describe struct {
+	ctx     app.Context
+	reqType string
+}
+
+func NewDescribe(ctx app.Context) *Describe {
+	return &Describe{
+		ctx: ctx,
+	}
+}
+
+func (c *Describe) Prepare() error {
+	if len(c.ctx.Command.Args) != 1 {
+		return fmt.Errorf("Usage: spinc describe <request>\n")
+	}
+	c.reqType = c.ctx.Command.Args[0]
+	return nil
+}
+
+func (c *Describe) Run() error {
+	md, err := c.ctx.RMClient.RequestTypeMetadata(c.reqType)
+	if err != nil {
+		return err
+	}
+
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(md, err)
+		return nil
+	}
+
+	/*
+	   restart-db: Restart MySQL
+	     docs: https://wiki.local/restart-db
+
+	   Sequences:
+	     restart-db: Restart MySQL
+	       stop (job stop-mysql): Stop mysqld
+	         docs: https://wiki.local/stop-mysql
+	       check (sequence check-repl)
+	     check-repl: Check replication
+	*/
+	r := md.Request
+	c.describe(0, r.Name, "", r.Description, r.DocsURL)
+	if r.Deprecated != "" {
+		fmt.Fprintf(c.ctx.Out, "  *** DEPRECATED: %s\n", r.Deprecated)
+	}
+	fmt.Fprintf(c.ctx.Out, "\nSequences:\n")
+	for _, seq := range md.Sequences {
+		c.describe(1, seq.Name, "", seq.Description, seq.DocsURL)
+		for _, n := range seq.Nodes {
+			kind := n.Category
+			if n.Type != "" {
+				kind += " " + n.Type
+			}
+			c.describe(2, n.Name, kind, n.Description, n.DocsURL)
+		}
+	}
+	fmt.Fprintf(c.ctx.Out, "\nRun 'spinc help %s' to list request args\n", r.Name)
+	return nil
+}
+
+// describe prints one request, sequence, or node indented by level: name, kind
+// (node category and type), description, and docs URL on the next line.
+func (c *Describe) describe(level int, name, kind, desc, docsURL string) {
+	indent := strings.Repeat("  ", level)
+	line := indent + name
+	if kind != "" {
+		line += " (" + kind + ")"
+	}
+	if desc != "" {
+		line += ": " + desc
+	}
+	fmt.Fprintln(c.ctx.Out, line)
+	if docsURL != "" {
+		fmt.Fprintf(c.ctx.Out, "%s  docs: %s\n", indent, docsURL)
+	}
+}
+
+func (c *Describe) Cmd() string {
+	return "describe " + c.reqType
+}
+
+func (c *Describe) Help() string {
+	return "'spinc describe <request>' prints the documentation of the request from its spec:\n" +
+		"the description and docs URL of the request, every sequence it uses (request first),\n" +
+		"and their nodes with category and type. Use 'spinc help <request>' to list request args.\n"
+}
@@ -0,0 +1,85 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestDescribe(t *testing.T) {
+	output := &bytes.Buffer{}
+	var gotType string
+	rmc := &mock.RMClient{
+		RequestTypeMetadataFunc: func(reqType string) (proto.RequestTypeMetadata, error) {
+			gotType = reqType
+			return proto.RequestTypeMetadata{
+				Request: proto.RequestSpec{
+					Name:        "restart-db",
+					Description: "Restart MySQL",
+					DocsURL:     "https://wiki.local/restart-db",
+				},
+				Sequences: []proto.SequenceMetadata{
+					{
+						Name:        "restart-db",
+						Description: "Restart MySQL",
+						DocsURL:     "https://wiki.local/restart-db",
+						Nodes: []proto.NodeMetadata{
+							{Name: "check", Category: "sequence", Type: "check-repl"},
+							{Name: "stop", Category: "job", Type: "stop-mysql", Description: "Stop mysqld", DocsURL: "https://wiki.local/stop-mysql"},
+						},
+					},
+					{
+						Name:        "check-repl",
+						Description: "Check replication",
+						Nodes: []proto.NodeMetadata{
+							{Name: "maybe-wait", Category: "conditional"},
+						},
+					},
+				},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "describe",
+			Args: []string{"restart-db"},
+		},
+	}
+	describe := cmd.NewDescribe(ctx)
+	if err := describe.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := describe.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotType != "restart-db" {
+		t.Errorf("got request type %s, expected restart-db", gotType)
+	}
+	expectOutput := `restart-db: Restart MySQL
+  docs: https://wiki.local/restart-db
+
+Sequences:
+  restart-db: Restart MySQL
+    docs: https://wiki.local/restart-db
+    check (sequence check-repl)
+    stop (job stop-mysql): Stop mysqld
+      docs: https://wiki.local/stop-mysql
+  check-repl: Check replication
+    maybe-wait (conditional)
+
+Run 'spinc help restart-db' to list request args
+`
+	if output.String() != expectOutput {
+		t.Errorf("output:\n%s\nexpected:\n%s", output, expectOutput)
+	}
+}
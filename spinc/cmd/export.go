@@ -0,0 +1,63 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+type Export struct {
+	ctx   app.Context
+	reqId string
+}
+
+func NewExport(ctx app.Context) *Export {
+	return &Export{
+		ctx: ctx,
+	}
+}
+
+func (c *Export) Prepare() error {
+	if len(c.ctx.Command.Args) == 0 {
+		return fmt.Errorf("Usage: spinc export <id> > <file>\n")
+	}
+	c.reqId = c.ctx.Command.Args[0]
+	return nil
+}
+
+func (c *Export) Run() error {
+	b, err := c.ctx.RMClient.ExportRequest(c.reqId)
+	if err != nil {
+		return err
+	}
+	if c.ctx.Options.Debug {
+		app.Debug("bundle: %d job logs, exported at %s", len(b.JobLogs), b.ExportedAt)
+	}
+
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(b, err)
+		return nil
+	}
+
+	bytes, err := json.MarshalIndent(b, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(c.ctx.Out, string(bytes))
+	return nil
+}
+
+func (c *Export) Cmd() string {
+	return "export " + c.reqId
+}
+
+func (c *Export) Help() string {
+	return `'spinc export <request ID>' prints the complete request as JSON: request, args, job chain,
+job logs, and suspended job chain (if suspended). Redirect the output to a file, then
+import it into another Request Manager with 'spinc import', for example to reproduce
+a production issue in staging.
+`
+}
@@ -0,0 +1,122 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+// Export a request, then import the output, which should be the same bundle.
+func TestExportImport(t *testing.T) {
+	created, _ := time.Parse("2006-01-02 15:04:05", "2020-03-27 11:30:00")
+	b := proto.RequestBundle{
+		Request: proto.Request{
+			Id:        "b9uvdi8tk9kahl8ppvbg",
+			Type:      "requestname",
+			State:     proto.STATE_FAIL,
+			User:      "owner",
+			CreatedAt: created,
+			Args:      []proto.RequestArg{{Name: "key", Value: "value"}},
+		},
+		CreateRequest: proto.CreateRequest{
+			Type: "requestname",
+			User: "owner",
+			Args: map[string]interface{}{"key": "value"},
+		},
+		JobLogs: []proto.JobLog{
+			{RequestId: "b9uvdi8tk9kahl8ppvbg", JobId: "j1", Try: 1, State: proto.STATE_FAIL, Error: "some error"},
+		},
+		ExportedAt: created,
+		Version:    "2.0.0",
+	}
+
+	var gotReqId string
+	var gotBundle proto.RequestBundle
+	rmc := &mock.RMClient{
+		ExportRequestFunc: func(reqId string) (proto.RequestBundle, error) {
+			gotReqId = reqId
+			return b, nil
+		},
+		ImportRequestFunc: func(b proto.RequestBundle) (proto.Request, error) {
+			gotBundle = b
+			return b.Request, nil
+		},
+	}
+
+	exported := &bytes.Buffer{}
+	ctx := app.Context{
+		Out:      exported,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "export",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	export := cmd.NewExport(ctx)
+	if err := export.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := export.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotReqId != "b9uvdi8tk9kahl8ppvbg" {
+		t.Errorf("exported request %s, expected b9uvdi8tk9kahl8ppvbg", gotReqId)
+	}
+
+	output := &bytes.Buffer{}
+	ctx = app.Context{
+		In:       exported,
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "import",
+			Args: []string{"-"},
+		},
+	}
+	imp := cmd.NewImport(ctx)
+	if err := imp.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := imp.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(gotBundle, b); diff != nil {
+		t.Error(diff)
+	}
+
+	expectOutput := "OK, imported b9uvdi8tk9kahl8ppvbg (requestname, FAIL)\n"
+	if output.String() != expectOutput {
+		t.Errorf("got output %q, expected %q", output, expectOutput)
+	}
+}
+
+func TestImportInvalidBundle(t *testing.T) {
+	ctx := app.Context{
+		In:       bytes.NewBufferString("not json"),
+		Out:      &bytes.Buffer{},
+		RMClient: &mock.RMClient{},
+		Command: config.Command{
+			Cmd:  "import",
+			Args: []string{"-"},
+		},
+	}
+	imp := cmd.NewImport(ctx)
+	if err := imp.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := imp.Run(); err == nil {
+		t.Error("no error, expected an error for invalid bundle")
+	}
+}
@@ -23,6 +23,8 @@ const (
 
 	findTimeFmt    = "YYYY-MM-DD HH:MM:SS UTC" // expected time input format
 	findTimeFmtStr = "2006-01-02 15:04:05 MST" // expected time input format as the actual format string (input to time.Parse)
+
+	findArgPrefix = "arg." // request arg filter: arg.<name>=<value>
 )
 
 var (
@@ -49,15 +51,20 @@ func (c *Find) Prepare() error {
 	validArgs := map[string]bool{
 		"timezone": true,
 
-		"type":   true,
-		"states": true,
-		"user":   true,
-		"since":  true,
-		"until":  true,
-		"limit":  true,
-		"offset": true,
+		"type":      true,
+		"states":    true,
+		"user":      true,
+		"namespace": true,
+		"corr-id":   true,
+		"group":     true,
+		"part-of":   true,
+		"since":     true,
+		"until":     true,
+		"limit":     true,
+		"offset":    true,
 	}
 	args := map[string]string{}
+	var reqArgs map[string]string
 	for _, arg := range c.ctx.Command.Args {
 		split := strings.SplitN(arg, "=", 2)
 		if len(split) != 2 {
@@ -66,6 +73,25 @@ func (c *Find) Prepare() error {
 		arg := split[0]
 		value := split[1]
 
+		// Request arg filter: arg.<name>=<value>
+		if strings.HasPrefix(arg, findArgPrefix) {
+			name := strings.TrimPrefix(arg, findArgPrefix)
+			if name == "" {
+				return fmt.Errorf("Invalid arg '%s': expected %s<request arg name>=<value>", arg, findArgPrefix)
+			}
+			if reqArgs == nil {
+				reqArgs = map[string]string{}
+			}
+			if _, ok := reqArgs[name]; ok {
+				return fmt.Errorf("Filter '%s' specified multiple times", arg)
+			}
+			reqArgs[name] = value
+			if c.ctx.Options.Debug {
+				app.Debug("request arg '%s'='%s'", name, value)
+			}
+			continue
+		}
+
 		if !validArgs[arg] {
 			return fmt.Errorf("Invalid arg '%s'", arg)
 		}
@@ -145,12 +171,22 @@ func (c *Find) Prepare() error {
 		offset = uint(o)
 	}
 
+	var namespaces []string
+	if args["namespace"] != "" {
+		namespaces = strings.Split(args["namespace"], ",")
+	}
+
 	/* Save args. */
 	c.local = local
 	c.filter = proto.RequestFilter{
-		Type:   args["type"],
-		States: states,
-		User:   args["user"],
+		Type:          args["type"],
+		States:        states,
+		User:          args["user"],
+		CorrelationId: args["corr-id"],
+		GroupId:       args["group"],
+		PartitionOf:   args["part-of"],
+		Namespaces:    namespaces,
+		Args:          reqArgs,
 
 		Since: since,
 		Until: until,
@@ -255,10 +291,16 @@ Filters:
   type        type of request to return
   states      comma-separated list of request states to include
   user        return only requests made by this user
+  namespace   comma-separated list of namespaces to include (default: all namespaces you can see)
+  corr-id     return only requests with this correlation ID
+  group       return only requests in this request group
+  part-of     return only the partition requests of this request
   since       return requests created or run after this time
   until       return requests created or run before this time
   limit       limit response to this many requests (default: %d)
   offset      skip the first <offset> requests
+  arg.NAME    return only requests with request arg NAME equal to value
+              (can be specified for multiple args, like arg.host=db1 arg.port=3306)
 Times should be formated as '%s'. Time should be specified in UTC.
 `, findLimitDefault,
 		strings.Join(getAllProtoStates(), " | "), findTimeFmt,
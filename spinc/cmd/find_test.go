@@ -8,6 +8,8 @@ import (
 	"testing"
 	"time"
 
+	"github.com/go-test/deep"
+
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/spinc/app"
 	"github.com/square/spincycle/v2/spinc/cmd"
@@ -178,6 +180,68 @@ func TestFailFindPrepare6(t *testing.T) {
 	}
 }
 
+func TestFailFindPrepareArgs(t *testing.T) {
+	// Empty arg name and duplicate arg name are errors
+	for _, args := range [][]string{
+		{"arg.=db1"},
+		{"arg.host=db1", "arg.host=db2"},
+	} {
+		command := config.Command{
+			Args: args,
+		}
+
+		ctx := app.Context{
+			Command: command,
+		}
+
+		find := cmd.NewFind(ctx)
+		err := find.Prepare()
+		if err == nil {
+			t.Errorf("No error in 'Prepare' with invalid input %v", args)
+		}
+	}
+}
+
+func TestFindRunArgs(t *testing.T) {
+	var gotFilter proto.RequestFilter
+	rmc := &mock.RMClient{
+		FindRequestsFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			gotFilter = f
+			return []proto.Request{}, nil
+		},
+	}
+	command := config.Command{
+		Args: []string{"type=requestname", "arg.host=db1", "arg.query=a=b", "namespace=payments,dba"},
+	}
+
+	ctx := app.Context{
+		Out:      &bytes.Buffer{},
+		RMClient: rmc,
+		Command:  command,
+	}
+
+	find := cmd.NewFind(ctx)
+	err := find.Prepare()
+	if err != nil {
+		t.Fatalf("Unexpected error in 'Prepare': %s", err)
+	}
+	err = find.Run()
+	if err != nil {
+		t.Fatalf("Unexpected error in 'Run': %s", err)
+	}
+
+	if gotFilter.Type != "requestname" {
+		t.Errorf("got filter type %s, expected requestname", gotFilter.Type)
+	}
+	expectArgs := map[string]string{"host": "db1", "query": "a=b"}
+	if diff := deep.Equal(gotFilter.Args, expectArgs); diff != nil {
+		t.Error(diff)
+	}
+	if diff := deep.Equal(gotFilter.Namespaces, []string{"payments", "dba"}); diff != nil {
+		t.Error(diff)
+	}
+}
+
 func TestFindRunUTC(t *testing.T) {
 	tsutc := "2020-08-02 15:00:00 UTC"
 	ts, _ := time.Parse("2006-01-02 15:04:05 MST", tsutc)
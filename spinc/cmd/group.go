@@ -0,0 +1,147 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/prompt"
+)
+
+// Group prints the status of a request group or stops its running requests.
+// Request groups are created with the Request Manager API.
+type Group struct {
+	ctx     app.Context
+	subCmd  string
+	groupId string
+	timeout time.Duration
+}
+
+func NewGroup(ctx app.Context) *Group {
+	return &Group{
+		ctx: ctx,
+	}
+}
+
+func (c *Group) Prepare() error {
+	args := c.ctx.Command.Args
+	if len(args) < 2 || (args[0] != "status" && args[0] != "stop") {
+		return fmt.Errorf("Usage: spinc group status <group ID>\n       spinc group stop <group ID> [timeout=<duration>]\n")
+	}
+	c.subCmd = args[0]
+	c.groupId = args[1]
+
+	for _, keyval := range args[2:] {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (key=val)", keyval, len(p))
+		}
+		if c.subCmd != "stop" || p[0] != "timeout" {
+			return fmt.Errorf("Invalid command arg: %s: unknown arg %s", keyval, p[0])
+		}
+		d, err := time.ParseDuration(p[1])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("Invalid timeout: %s: must be a duration greater than zero, like 5m", p[1])
+		}
+		c.timeout = d
+	}
+	return nil
+}
+
+func (c *Group) Run() error {
+	if c.subCmd == "stop" {
+		// Stopping a group can stop many requests, so always confirm
+		if !c.ctx.Options.Yes {
+			g, err := c.ctx.RMClient.GetRequestGroup(c.groupId)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(c.ctx.Out, "Group %s (%s): %d of %d requests running (use --yes to skip confirmation)\n",
+				g.Id, g.Name, g.States[proto.StateName[proto.STATE_RUNNING]], len(g.Requests))
+			ok := prompt.NewConfirmationPrompt("Enter 'stop' to stop, or anything else to abort: ", "stop", c.ctx.In, c.ctx.Out)
+			if err := ok.Prompt(); err != nil {
+				return fmt.Errorf("Not stopped")
+			}
+		}
+		if err := c.ctx.RMClient.StopRequestGroup(c.groupId, c.timeout); err != nil {
+			return err
+		}
+		if !c.ctx.Options.Quiet {
+			fmt.Fprintf(c.ctx.Out, "OK, stopped running requests in group %s\n", c.groupId)
+		}
+		return nil
+	}
+
+	g, err := c.ctx.RMClient.GetRequestGroup(c.groupId)
+	if err != nil {
+		return err
+	}
+	if c.ctx.Options.Debug {
+		app.Debug("group: %#v", g)
+	}
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(g, err)
+		return nil
+	}
+
+	// Request counts by state, like "COMPLETE=3 RUNNING=47", sorted by state name
+	states := make([]string, 0, len(g.States))
+	for state, n := range g.States {
+		states = append(states, fmt.Sprintf("%s=%d", state, n))
+	}
+	sort.Strings(states)
+
+	prg := 0.0
+	if g.TotalJobs > 0 {
+		prg = float64(g.FinishedJobs) / float64(g.TotalJobs) * 100
+	}
+
+	fmt.Fprintf(c.ctx.Out, "   group: %s\n", g.Name)
+	fmt.Fprintf(c.ctx.Out, "   state: %s\n", StateName(c.ctx, g.State))
+	fmt.Fprintf(c.ctx.Out, "progress: %.0f%% (%d of %d jobs)\n", prg, g.FinishedJobs, g.TotalJobs)
+	fmt.Fprintf(c.ctx.Out, "requests: %d: %s\n", len(g.Requests), strings.Join(states, " "))
+	fmt.Fprintf(c.ctx.Out, "  caller: %s\n", g.User)
+	fmt.Fprintf(c.ctx.Out, " created: %s\n", g.CreatedAt.UTC().Format(findTimeFmtStr))
+
+	if len(g.Requests) == 0 {
+		return nil
+	}
+
+	/*
+	   ID                   REQUEST                                  STATE     JOBS
+	   -------------------- 1234567890123456789012345678901234567890 123456789 *
+	*/
+	line := fmt.Sprintf("%%-%ds %%-%ds %%-%ds %%s\n", findIdColLen, findReqColLen, findStateColLen)
+	fmt.Fprintf(c.ctx.Out, "\n")
+	fmt.Fprintf(c.ctx.Out, line, "ID", "REQUEST", "STATE", "JOBS")
+	for _, r := range g.Requests {
+		state, ok := proto.StateName[r.State]
+		if !ok {
+			state = proto.StateName[proto.STATE_UNKNOWN]
+		}
+		fmt.Fprintf(c.ctx.Out, line,
+			SqueezeString(r.Id, findIdColLen, ".."),
+			SqueezeString(r.Type, findReqColLen, ".."),
+			SqueezeString(state, findStateColLen, ".."),
+			fmt.Sprintf("%d / %d", r.FinishedJobs, r.TotalJobs))
+	}
+	return nil
+}
+
+func (c *Group) Cmd() string {
+	return "group " + c.subCmd + " " + c.groupId
+}
+
+func (c *Group) Help() string {
+	return "'spinc group status <group ID>' prints the status of a request group: its aggregate state\n" +
+		"and progress, the number of requests in each state, and every request in the order created.\n" +
+		"'spinc group stop <group ID> [timeout=<duration>]' stops all running requests in the group\n" +
+		"after confirmation, unless --yes is specified. timeout is the same as 'spinc stop'.\n" +
+		"Request groups are created with the Request Manager API. To find requests in a group,\n" +
+		"use 'spinc find group=<group ID>'.\n"
+}
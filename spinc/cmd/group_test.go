@@ -0,0 +1,150 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestGroupStatus(t *testing.T) {
+	var stopped bool
+	output := &bytes.Buffer{}
+	rmc := &mock.RMClient{
+		GetRequestGroupFunc: func(groupId string) (proto.RequestGroup, error) {
+			return proto.RequestGroup{
+				Id:           groupId,
+				Name:         "migrate-dbs",
+				User:         "finch",
+				CreatedAt:    time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC),
+				State:        proto.STATE_RUNNING,
+				States:       map[string]uint{"RUNNING": 1, "COMPLETE": 1},
+				TotalJobs:    8,
+				FinishedJobs: 6,
+				Requests: []proto.Request{
+					{Id: "b9uvdi8tk9kahl8ppvbg", Type: "migrate-db", State: proto.STATE_COMPLETE, TotalJobs: 4, FinishedJobs: 4},
+					{Id: "b9uvdi8tk9kahl8ppvc0", Type: "migrate-db", State: proto.STATE_RUNNING, TotalJobs: 4, FinishedJobs: 2},
+				},
+			}, nil
+		},
+		StopRequestGroupFunc: func(groupId string, timeout time.Duration) error {
+			stopped = true
+			return nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Command: config.Command{
+			Cmd:  "group",
+			Args: []string{"status", "bpm6l4kt9kahl8ppvbg0"},
+		},
+	}
+	group := cmd.NewGroup(ctx)
+	if err := group.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := group.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput := `   group: migrate-dbs
+   state: RUNNING
+progress: 75% (6 of 8 jobs)
+requests: 2: COMPLETE=1 RUNNING=1
+  caller: finch
+ created: 2020-03-01 12:00:00 UTC
+
+ID                   REQUEST                                  STATE     JOBS
+b9uvdi8tk9kahl8ppvbg migrate-db                               COMPLETE  4 / 4
+b9uvdi8tk9kahl8ppvc0 migrate-db                               RUNNING   2 / 4
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+	if stopped {
+		t.Error("group stopped, expected only status")
+	}
+}
+
+func TestGroupStop(t *testing.T) {
+	// Stopped only if user enters "stop" or --yes is specified
+	for _, test := range []struct {
+		in     string
+		yes    bool
+		expect bool
+	}{
+		{"stop\n", false, true},
+		{"no\n", false, false},
+		{"", true, true},
+	} {
+		var stopped bool
+		var timeout time.Duration
+		rmc := &mock.RMClient{
+			GetRequestGroupFunc: func(groupId string) (proto.RequestGroup, error) {
+				return proto.RequestGroup{
+					Id:           groupId,
+					Name:         "migrate-dbs",
+					User:         "finch",
+					CreatedAt:    time.Date(2020, 3, 1, 12, 0, 0, 0, time.UTC),
+					State:        proto.STATE_RUNNING,
+					States:       map[string]uint{"RUNNING": 1, "COMPLETE": 1},
+					TotalJobs:    8,
+					FinishedJobs: 6,
+					Requests: []proto.Request{
+						{Id: "b9uvdi8tk9kahl8ppvbg", Type: "migrate-db", State: proto.STATE_COMPLETE, TotalJobs: 4, FinishedJobs: 4},
+						{Id: "b9uvdi8tk9kahl8ppvc0", Type: "migrate-db", State: proto.STATE_RUNNING, TotalJobs: 4, FinishedJobs: 2},
+					},
+				}, nil
+			},
+			StopRequestGroupFunc: func(groupId string, d time.Duration) error {
+				stopped = true
+				timeout = d
+				return nil
+			},
+		}
+		ctx := app.Context{
+			In:       bytes.NewBufferString(test.in),
+			Out:      &bytes.Buffer{},
+			RMClient: rmc,
+			Options:  config.Options{Yes: test.yes},
+			Command: config.Command{
+				Cmd:  "group",
+				Args: []string{"stop", "bpm6l4kt9kahl8ppvbg0", "timeout=5m"},
+			},
+		}
+		group := cmd.NewGroup(ctx)
+		if err := group.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		err := group.Run()
+		if test.expect && err != nil {
+			t.Errorf("in %q yes %t: got err %s, expected nil", test.in, test.yes, err)
+		}
+		if stopped != test.expect {
+			t.Errorf("in %q yes %t: stopped %t, expected %t", test.in, test.yes, stopped, test.expect)
+		}
+		if stopped && timeout != 5*time.Minute {
+			t.Errorf("stop timeout %s, expected 5m", timeout)
+		}
+	}
+
+	// Invalid timeout
+	ctx := app.Context{
+		Command: config.Command{
+			Cmd:  "group",
+			Args: []string{"stop", "bpm6l4kt9kahl8ppvbg0", "timeout=0s"},
+		},
+	}
+	if err := cmd.NewGroup(ctx).Prepare(); err == nil {
+		t.Error("no error for timeout=0s, expected one")
+	}
+}
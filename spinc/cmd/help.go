@@ -82,21 +82,57 @@ func (c *Help) Usage() {
 		"  --config   Config files (default: %s)\n"+
 		"  --debug    Print debug to stderr\n"+
 		"  --env      Environment (dev, staging, production)\n"+
+		"  --failed   Print only failed jobs (jobs only)\n"+
+		"  --from-job Job to start from (start --from-request only)\n"+
+		"  --from-request Request to start again from --from-job (start only)\n"+
 		"  --help     Print help\n"+
+		"  --mine     Stop all your pending and running requests (stop only)\n"+
+		"  --no-color Never print color (default: color only to a terminal)\n"+
+		"  --pending  Print only jobs that have not run (jobs only)\n"+
+		"  --quiet    Print only results, like the request ID (start, retry, import, stop, resume)\n"+
+		"  --reason   Why the request is finalized (admin finalize only)\n"+
+		"  --remote   Print Request Manager and Job Runner versions (version only)\n"+
+		"  --running  Print only running jobs (jobs only)\n"+
+		"  --state    Final state: failed or stopped (admin finalize only)\n"+
 		"  --timeout  API timeout, milliseconds (default: %d ms)\n"+
+		"  --verbose  Print all args with source and type (status only)\n"+
 		"  --version  Print version\n"+
+		"  --wide     Print more columns (ps only)\n"+
+		"  --yes      Stop, retry, or resume without confirmation (stop, retry, resume, start --from-request, admin finalize only)\n"+
 		"Commands:\n"+
+		"  admin   finalize <ID> --state <state> --reason <why>  Force final state of request lost by its Job Runner (admins only)\n"+
+		"  describe <request> Print request documentation: description, docs URL, sequences\n"+
+		"  export  <ID>       Print complete request as JSON to import elsewhere\n"+
 		"  find    [filters]  Print (optionally) filtered request history\n"+
+		"  group   <sub> <ID> Print request group status (status) or stop its requests (stop)\n"+
 		"  help    <cmd|req>  Print command or request help\n"+
+		"  history <request>  Print past requests and outcomes (since=30d)\n"+
+		"  import  <file>     Import request exported by 'spinc export'\n"+
 		"  info    <ID>       Print complete request information\n"+
-		"  log     <ID>       Print job log (tip: pipe output to less)\n"+
+		"  job     <ID> <job> Print job try history: state, sequence try, times, error\n"+
+		"  jobs    <ID>       Print every job: state, tries, sequence, dependencies\n"+
+		"  local   run <dir>  Run request locally with specs in dir (see spinc help local)\n"+
+		"  log     <ID>       Print job log table (full=true for everything, errors-only=true)\n"+
 		"  ps      [ID]       Show running requests and jobs (request ID optional)\n"+
+		"  resume  <ID>       Choose jobs to resume suspended request from (job=complete|skip|pending)\n"+
+		"  retry   <ID>       Retry failed request (arg=value to change args)\n"+
 		"  running <ID>       Exit 0 if request is pending or running, else exit 1\n"+
+		"  spec    new <name> Print new request spec to start from (see spinc help spec)\n"+
 		"  start   <request>  Start new request\n"+
+		"  start   --from-request <ID> --from-job <job>  Start failed request again from job\n"+
 		"  status  <ID>       Print request status and basic information\n"+
-		"  stop    <ID>       Stop request\n"+
-		"  version            Print Spin Cycle version\n",
-		config.DEFAULT_ADDR, config.DEFAULT_CONFIG_FILES, config.DEFAULT_TIMEOUT)
+		"  stop    <ID>       Stop request (timeout=<duration> to wait longer for jobs to stop)\n"+
+		"  stop    --mine     Stop all your pending and running requests (lists them first)\n"+
+		"  version            Print spinc version (--remote for Request Manager and Job Runners)\n"+
+		"Exit codes:\n"+
+		"  %d  OK\n"+
+		"  %d  Error (like invalid command)\n"+
+		"  %d  API error (Request Manager returned an error or is unreachable)\n"+
+		"  %d  Auth error (Request Manager denied the caller)\n"+
+		"  %d  Request failed (local run)\n"+
+		"  %d  Timeout (Request Manager did not respond within --timeout)\n",
+		config.DEFAULT_ADDR, config.DEFAULT_CONFIG_FILES, config.DEFAULT_TIMEOUT,
+		app.EXIT_OK, app.EXIT_ERROR, app.EXIT_API_ERROR, app.EXIT_AUTH_ERROR, app.EXIT_REQUEST_FAILED, app.EXIT_TIMEOUT)
 	fmt.Fprintf(c.ctx.Out, "\nRun spinc (no command) to lists requests\n")
 }
 
@@ -112,7 +148,11 @@ func (c *Help) QuickHelp() {
 			fmt.Fprintf(c.ctx.Out, "  Error getting request list: %s. Verify that --addr is correct and the Request Manager is running.\n", err)
 		} else {
 			for _, r := range req {
-				fmt.Fprintf(c.ctx.Out, "  "+r.Name+"\n")
+				if r.Deprecated != "" {
+					fmt.Fprintf(c.ctx.Out, "  "+r.Name+" (deprecated)\n")
+				} else {
+					fmt.Fprintf(c.ctx.Out, "  "+r.Name+"\n")
+				}
 			}
 		}
 		fmt.Fprintf(c.ctx.Out, "\nspinc help  <request>\n")
@@ -140,6 +180,20 @@ func (c *Help) RequestHelp(reqName string) error {
 	}
 
 	fmt.Fprintf(c.ctx.Out, "Request Manager address: %s\n\n", c.ctx.Options.Addr)
+	if req.Deprecated != "" {
+		fmt.Fprintf(c.ctx.Out, "*** DEPRECATED: %s\n", req.Deprecated)
+		if req.Sunset != "" {
+			fmt.Fprintf(c.ctx.Out, "*** New requests will be rejected from %s\n", req.Sunset)
+		}
+		fmt.Fprintln(c.ctx.Out)
+	}
+	if req.Description != "" {
+		fmt.Fprintf(c.ctx.Out, "%s: %s\n", req.Name, req.Description)
+		if req.DocsURL != "" {
+			fmt.Fprintf(c.ctx.Out, "  docs: %s\n", req.DocsURL)
+		}
+		fmt.Fprintln(c.ctx.Out)
+	}
 	fmt.Fprintf(c.ctx.Out, "%s request args (* required)\n\n", req.Name)
 	l := 0
 	for _, a := range req.Args {
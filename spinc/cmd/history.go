@@ -0,0 +1,189 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+const (
+	historySinceDefault = "30d" // requests in the last 30 days by default
+	historyLimitDefault = 20    // list the 20 most recent requests by default
+
+	historyIdColLen       = 20
+	historyUserColLen     = 16
+	historyStateColLen    = 9
+	historyDurationColLen = 12
+)
+
+type History struct {
+	ctx app.Context
+	// --
+	reqType string
+	since   time.Time
+	limit   uint
+	local   bool // If true, output times in local time, else output times in UTC
+}
+
+func NewHistory(ctx app.Context) *History {
+	return &History{
+		ctx: ctx,
+	}
+}
+
+func (c *History) Prepare() error {
+	if len(c.ctx.Command.Args) == 0 {
+		return fmt.Errorf("Usage: spinc history <request> [since=30d] [limit=N]\n'spinc' for request list")
+	}
+	c.reqType = c.ctx.Command.Args[0]
+
+	validArgs := map[string]bool{
+		"since":    true,
+		"limit":    true,
+		"timezone": true,
+	}
+	args := map[string]string{}
+	for _, arg := range c.ctx.Command.Args[1:] {
+		split := strings.SplitN(arg, "=", 2)
+		if len(split) != 2 {
+			return fmt.Errorf("Invalid command arg %s: expected arg of form arg=value (should contain exactly one '=')", arg)
+		}
+		if !validArgs[split[0]] {
+			return fmt.Errorf("Invalid arg '%s'", split[0])
+		}
+		if _, ok := args[split[0]]; ok {
+			return fmt.Errorf("Arg '%s' specified multiple times", split[0])
+		}
+		args[split[0]] = split[1]
+		if c.ctx.Options.Debug {
+			app.Debug("arg '%s'='%s'", split[0], split[1])
+		}
+	}
+
+	since := args["since"]
+	if since == "" {
+		since = historySinceDefault
+	}
+	d, err := parseHistorySince(since)
+	if err != nil {
+		return fmt.Errorf("Invalid since '%s': expected number of days like 30d, or duration like 12h", since)
+	}
+	c.since = time.Now().Add(-d).UTC()
+
+	c.limit = historyLimitDefault
+	if args["limit"] != "" {
+		l, err := strconv.ParseUint(args["limit"], 10, strconv.IntSize)
+		if err != nil {
+			return fmt.Errorf("Invalid limit '%s', expected value >= 0", args["limit"])
+		}
+		c.limit = uint(l)
+	}
+
+	switch strings.ToLower(args["timezone"]) {
+	case "", "utc":
+	case "local":
+		c.local = true
+	default:
+		return fmt.Errorf("Invalid timezone '%s': expected 'utc' or 'local'", args["timezone"])
+	}
+
+	return nil
+}
+
+func (c *History) Run() error {
+	h, err := c.ctx.RMClient.RequestHistory(c.reqType, c.since, c.limit)
+	if err != nil {
+		return err
+	}
+	if c.ctx.Options.Debug {
+		app.Debug("history: %#v", h)
+	}
+
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(h, err)
+		return nil
+	}
+
+	timeConv := (time.Time).UTC
+	if c.local {
+		timeConv = (time.Time).Local
+	}
+
+	/*
+	   ID                   USER             STATE     DURATION     CREATED
+	   -------------------- 1234567890123456 123456789 123456789012 -------
+	*/
+	if len(h.Requests) > 0 {
+		line := fmt.Sprintf("%%-%ds %%-%ds %%-%ds %%-%ds %%s\n",
+			historyIdColLen, historyUserColLen, historyStateColLen, historyDurationColLen)
+		fmt.Fprintf(c.ctx.Out, line, "ID", "USER", "STATE", "DURATION", "CREATED")
+		for _, r := range h.Requests {
+			state, ok := proto.StateName[r.State]
+			if !ok {
+				state = proto.StateName[proto.STATE_UNKNOWN]
+			}
+			duration := "N/A"
+			if r.StartedAt != nil && r.FinishedAt != nil {
+				duration = r.FinishedAt.Sub(*r.StartedAt).Round(time.Second).String()
+			}
+			fmt.Fprintf(c.ctx.Out, line,
+				SqueezeString(r.Id, historyIdColLen, ".."),
+				SqueezeString(r.User, historyUserColLen, ".."),
+				SqueezeString(state, historyStateColLen, ".."),
+				duration,
+				timeConv(r.CreatedAt).Format(findTimeFmtStr))
+		}
+		fmt.Fprintln(c.ctx.Out)
+	}
+
+	// Summary of all requests, not only the ones listed
+	median := "N/A"
+	if h.MedianDuration > 0 {
+		median = time.Duration(h.MedianDuration * float64(time.Second)).Round(time.Second).String()
+	}
+	fmt.Fprintf(c.ctx.Out, "%s: %d requests since %s, %d finished, %.0f%% success, median duration %s\n",
+		c.reqType, h.Total, timeConv(c.since).Format(findTimeFmtStr), h.Finished, h.SuccessRate*100, median)
+
+	return nil
+}
+
+func (c *History) Cmd() string {
+	return "history " + strings.Join(c.ctx.Command.Args, " ")
+}
+
+func (c *History) Help() string {
+	return fmt.Sprintf(`'spinc history <request> [arg=value]' lists past requests of one type and summarizes their outcomes.
+The summary line is of all requests since the given time, even if fewer are listed.
+
+Output columns:
+  ID:       Request ID
+  USER:     User/owner who started the request
+  STATE:    Current state of request
+  DURATION: Time from start to finish (N/A if request hasn't finished)
+  CREATED:  Time at which request was created
+Long column values are truncated in the middle with '..'.
+
+Args:
+  since     requests created or run in this last number of days or duration, like 7d or 12h (default: %s)
+  limit     list this many most recent requests (default: %d)
+  timezone  timezone to use in output ('utc' | 'local')
+`, historySinceDefault, historyLimitDefault)
+}
+
+// parseHistorySince parses a number of days like "30d", or a Go duration like "12h".
+func parseHistorySince(s string) (time.Duration, error) {
+	if strings.HasSuffix(s, "d") {
+		days, err := strconv.ParseUint(strings.TrimSuffix(s, "d"), 10, 32)
+		if err != nil {
+			return 0, err
+		}
+		return time.Duration(days) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,114 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestHistory(t *testing.T) {
+	created, _ := time.Parse("2006-01-02 15:04:05", "2020-03-27 11:30:00")
+	started := created.Add(time.Second)
+	finished := started.Add(90 * time.Second)
+	h := proto.RequestHistory{
+		Type: "requestname",
+		Requests: []proto.Request{
+			{
+				Id:        "b9uvdi8tk9kahl8ppvbg",
+				State:     proto.STATE_RUNNING,
+				User:      "owner",
+				CreatedAt: created,
+				StartedAt: &started,
+			},
+			{
+				Id:         "b9uvdi8tk9kahl8ppvbf",
+				State:      proto.STATE_COMPLETE,
+				User:       "owner2",
+				CreatedAt:  created,
+				StartedAt:  &started,
+				FinishedAt: &finished,
+			},
+		},
+		Total:          5,
+		States:         map[string]uint{"RUNNING": 1, "COMPLETE": 3, "FAIL": 1},
+		Finished:       4,
+		SuccessRate:    0.75,
+		MedianDuration: 90.4,
+	}
+	var gotType string
+	var gotSince time.Time
+	var gotLimit uint
+	rmc := &mock.RMClient{
+		RequestHistoryFunc: func(reqType string, since time.Time, limit uint) (proto.RequestHistory, error) {
+			gotType = reqType
+			gotSince = since
+			gotLimit = limit
+			return h, nil
+		},
+	}
+	output := &bytes.Buffer{}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "history",
+			Args: []string{"requestname", "since=7d", "limit=2"},
+		},
+	}
+	history := cmd.NewHistory(ctx)
+	if err := history.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := history.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if gotType != "requestname" || gotLimit != 2 {
+		t.Errorf("got type %s, limit %d; expected requestname, 2", gotType, gotLimit)
+	}
+	expectSince := time.Now().Add(-7 * 24 * time.Hour)
+	if d := expectSince.Sub(gotSince); d < 0 || d > time.Minute {
+		t.Errorf("got since %s, expected about %s", gotSince, expectSince)
+	}
+
+	expectOutput := fmt.Sprintf(`ID                   USER             STATE     DURATION     CREATED
+b9uvdi8tk9kahl8ppvbg owner            RUNNING   N/A          2020-03-27 11:30:00 UTC
+b9uvdi8tk9kahl8ppvbf owner2           COMPLETE  1m30s        2020-03-27 11:30:00 UTC
+
+requestname: 5 requests since %s, 4 finished, 75%% success, median duration 1m30s
+`, gotSince.Format("2006-01-02 15:04:05 MST"))
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestHistoryPrepareErrors(t *testing.T) {
+	for _, args := range [][]string{
+		{},
+		{"requestname", "since=30"},
+		{"requestname", "limit=-1"},
+		{"requestname", "foo=bar"},
+		{"requestname", "since"},
+	} {
+		ctx := app.Context{
+			Command: config.Command{
+				Cmd:  "history",
+				Args: args,
+			},
+		}
+		if err := cmd.NewHistory(ctx).Prepare(); err == nil {
+			t.Errorf("no error for args %v, expected an error", args)
+		}
+	}
+}
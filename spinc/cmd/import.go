@@ -0,0 +1,75 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+type Import struct {
+	ctx  app.Context
+	file string
+}
+
+func NewImport(ctx app.Context) *Import {
+	return &Import{
+		ctx: ctx,
+	}
+}
+
+func (c *Import) Prepare() error {
+	if len(c.ctx.Command.Args) == 0 {
+		return fmt.Errorf("Usage: spinc import <file>\n")
+	}
+	c.file = c.ctx.Command.Args[0]
+	return nil
+}
+
+func (c *Import) Run() error {
+	var bytes []byte
+	var err error
+	if c.file == "-" {
+		bytes, err = ioutil.ReadAll(c.ctx.In)
+	} else {
+		bytes, err = ioutil.ReadFile(c.file)
+	}
+	if err != nil {
+		return err
+	}
+	var b proto.RequestBundle
+	if err := json.Unmarshal(bytes, &b); err != nil {
+		return fmt.Errorf("Invalid request bundle in %s: %s", c.file, err)
+	}
+
+	req, err := c.ctx.RMClient.ImportRequest(b)
+	if err != nil {
+		return err
+	}
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(req, err)
+		return nil
+	}
+	if c.ctx.Options.Quiet {
+		fmt.Fprintln(c.ctx.Out, req.Id)
+		return nil
+	}
+	fmt.Fprintf(c.ctx.Out, "OK, imported %s (%s, %s)\n", req.Id, req.Type, proto.StateName[req.State])
+	return nil
+}
+
+func (c *Import) Cmd() string {
+	return "import " + c.file
+}
+
+func (c *Import) Help() string {
+	return `'spinc import <file>' imports a request exported by 'spinc export' from another
+Request Manager. Use - to read from stdin. The request keeps its ID. A request that
+was running is imported as STOPPED; a request that was suspended is resumed.
+Only admins can import requests.
+`
+}
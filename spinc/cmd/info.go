@@ -4,10 +4,10 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 	"time"
 
-	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/spinc/app"
 )
 
@@ -64,8 +64,7 @@ func (c *Info) Run() error {
 		if arg.Type == "static" {
 			continue
 		}
-		val := fmt.Sprintf("%s", arg.Value)
-		args = append(args, fmt.Sprintf("%s=%s", arg.Name, QuoteArgValue(val)))
+		args = append(args, fmt.Sprintf("%s=%s", arg.Name, QuoteArgValue(ArgValue(arg))))
 	}
 
 	fmt.Fprintf(c.ctx.Out, "      id: %s\n", r.Id)
@@ -74,10 +73,58 @@ func (c *Info) Run() error {
 	fmt.Fprintf(c.ctx.Out, " created: %s (%s ago)\n", r.CreatedAt.Format(tsFormat), now.Sub(r.CreatedAt).Round(time.Second))
 	fmt.Fprintf(c.ctx.Out, " started: %s\n", started)
 	fmt.Fprintf(c.ctx.Out, "finished: %s\n", finished)
-	fmt.Fprintf(c.ctx.Out, "   state: %s\n", proto.StateName[r.State])
+	state := StateName(c.ctx, r.State)
+	if r.ResumeError != "" {
+		state += " (" + r.ResumeError + ")"
+	}
+	fmt.Fprintf(c.ctx.Out, "   state: %s\n", state)
 	fmt.Fprintf(c.ctx.Out, "    host: %s\n", r.JobRunnerURL)
 	fmt.Fprintf(c.ctx.Out, "    jobs: %d (%d complete)\n", r.TotalJobs, r.FinishedJobs)
+	fmt.Fprintf(c.ctx.Out, "    cost: %d\n", r.Cost)
 	fmt.Fprintf(c.ctx.Out, "    args: %s\n", strings.Join(args, " "))
+	if r.RetryOf != "" {
+		fmt.Fprintf(c.ctx.Out, "retry of: %s\n", r.RetryOf)
+	}
+	if r.CorrelationId != "" {
+		fmt.Fprintf(c.ctx.Out, " corr id: %s\n", r.CorrelationId)
+	}
+	if r.Partitions > 0 {
+		fmt.Fprintf(c.ctx.Out, "   split: %d partition requests (spinc find part-of=%s)\n", r.Partitions, r.Id)
+	}
+	if r.PartitionOf != "" {
+		fmt.Fprintf(c.ctx.Out, " part of: %s\n", r.PartitionOf)
+	}
+	if len(r.Origin) > 0 {
+		origin := make([]string, 0, len(r.Origin))
+		for k, v := range r.Origin {
+			origin = append(origin, fmt.Sprintf("%s=%s", k, QuoteArgValue(v)))
+		}
+		sort.Strings(origin)
+		fmt.Fprintf(c.ctx.Out, "  origin: %s\n", strings.Join(origin, " "))
+	}
+	sensitive := map[string]bool{}
+	for _, arg := range r.Args {
+		sensitive[arg.Name] = arg.Sensitive
+	}
+	for i, o := range r.ArgOverrides {
+		val, old := fmt.Sprintf("%v", o.Value), fmt.Sprintf("%v", o.Old)
+		if sensitive[o.Name] {
+			val, old = REDACTED, REDACTED
+		}
+		line := fmt.Sprintf("%s=%s (was %s)", o.Name, QuoteArgValue(val), QuoteArgValue(old))
+		if i == 0 {
+			fmt.Fprintf(c.ctx.Out, "override: %s\n", line)
+		} else {
+			fmt.Fprintf(c.ctx.Out, "          %s\n", line)
+		}
+	}
+	for i, w := range r.Warnings {
+		if i == 0 {
+			fmt.Fprintf(c.ctx.Out, "warnings: %s\n", w)
+		} else {
+			fmt.Fprintf(c.ctx.Out, "          %s\n", w)
+		}
+	}
 
 	return nil
 }
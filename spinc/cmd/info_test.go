@@ -69,6 +69,7 @@ finished:
    state: RUNNING
     host: http://localhost
     jobs: 9 (1 complete)
+    cost: 0
     args: key=value key2=val2 opt=not-shown
 `, ago, ago)
 	if output.String() != expectOutput {
@@ -93,6 +94,7 @@ func TestInfoFinished(t *testing.T) {
 		Args:         args,
 		TotalJobs:    9,
 		FinishedJobs: 9,
+		Cost:         12,
 		CreatedAt:    ts,
 		StartedAt:    &ts,
 		FinishedAt:   &finished,
@@ -135,6 +137,7 @@ finished: 2019-03-27 12:00:59 UTC (%s ago)
    state: COMPLETE
     host: 
     jobs: 9 (9 complete)
+    cost: 12
     args: key=value key2=val2 opt=not-shown
 `, ago, ago, finishedAgo)
 	if output.String() != expectOutput {
@@ -142,3 +145,126 @@ finished: 2019-03-27 12:00:59 UTC (%s ago)
 		t.Error("wrong output, see above")
 	}
 }
+
+func TestInfoWarnings(t *testing.T) {
+	output := &bytes.Buffer{}
+	ts, _ := time.Parse("2006-01-02 15:04:05", "2019-03-27 11:30:00")
+	ago := time.Now().Sub(ts).Round(time.Second)
+	request := proto.Request{
+		Id:           "b9uvdi8tk9kahl8ppvbg",
+		Type:         "requestname",
+		State:        proto.STATE_RUNNING,
+		User:         "owner",
+		Args:         args,
+		TotalJobs:    9,
+		FinishedJobs: 1,
+		CreatedAt:    ts,
+		StartedAt:    &ts,
+		JobRunnerURL: "http://localhost",
+		Warnings:     []string{"optional arg opt not given, using default value: not-shown", "warning 2"},
+	}
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(id string) (proto.Request, error) {
+			if id == request.Id {
+				return request, nil
+			}
+			return proto.Request{}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "info",
+			Args: []string{request.Id},
+		},
+	}
+	info := cmd.NewInfo(ctx)
+
+	err := info.Prepare()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = info.Run()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectOutput := fmt.Sprintf(`      id: b9uvdi8tk9kahl8ppvbg
+ request: requestname
+  caller: owner
+ created: 2019-03-27 11:30:00 UTC (%s ago)
+ started: 2019-03-27 11:30:00 UTC (%s ago)
+finished: 
+   state: RUNNING
+    host: http://localhost
+    jobs: 9 (1 complete)
+    cost: 0
+    args: key=value key2=val2 opt=not-shown
+warnings: optional arg opt not given, using default value: not-shown
+          warning 2
+`, ago, ago)
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestInfoFailedResume(t *testing.T) {
+	output := &bytes.Buffer{}
+	ts, _ := time.Parse("2006-01-02 15:04:05", "2019-03-27 11:30:00")
+	ago := time.Now().Sub(ts).Round(time.Second)
+	request := proto.Request{
+		Id:           "b9uvdi8tk9kahl8ppvbg",
+		Type:         "requestname",
+		State:        proto.STATE_FAILED_RESUME,
+		User:         "owner",
+		Args:         args,
+		TotalJobs:    9,
+		FinishedJobs: 1,
+		CreatedAt:    ts,
+		StartedAt:    &ts,
+		FinishedAt:   &ts,
+		ResumeError:  "failed to resume 10 times, last error: error sending SJC to Job Runner: EOF",
+	}
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(id string) (proto.Request, error) {
+			return request, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "info",
+			Args: []string{request.Id},
+		},
+	}
+	info := cmd.NewInfo(ctx)
+	if err := info.Prepare(); err != nil {
+		t.Error(err)
+	}
+	if err := info.Run(); err != nil {
+		t.Error(err)
+	}
+
+	expectOutput := fmt.Sprintf(`      id: b9uvdi8tk9kahl8ppvbg
+ request: requestname
+  caller: owner
+ created: 2019-03-27 11:30:00 UTC (%s ago)
+ started: 2019-03-27 11:30:00 UTC (%s ago)
+finished: 2019-03-27 11:30:00 UTC (%s ago)
+   state: FAILED_RESUME (failed to resume 10 times, last error: error sending SJC to Job Runner: EOF)
+    host: 
+    jobs: 9 (1 complete)
+    cost: 0
+    args: key=value key2=val2 opt=not-shown
+`, ago, ago, ago)
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+type Job struct {
+	ctx   app.Context
+	reqId string
+	jobId string
+}
+
+func NewJob(ctx app.Context) *Job {
+	return &Job{
+		ctx: ctx,
+	}
+}
+
+func (c *Job) Prepare() error {
+	if len(c.ctx.Command.Args) != 2 {
+		return fmt.Errorf("Usage: spinc job <request ID> <job ID>\n")
+	}
+	c.reqId = c.ctx.Command.Args[0]
+	c.jobId = c.ctx.Command.Args[1]
+	return nil
+}
+
+func (c *Job) Run() error {
+	tries, err := c.ctx.RMClient.GetJobTries(c.reqId, c.jobId)
+	if err != nil {
+		return err
+	}
+
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(tries, err)
+		return nil
+	}
+
+	if len(tries) == 0 {
+		fmt.Fprintf(c.ctx.Out, "Job %s has not run\n", c.jobId)
+		return nil
+	}
+
+	/*
+	   first-job (job1, type shell-command)
+	   TRY SEQ STATE     STARTED             FINISHED            DURATION  EXIT ERROR
+	   1   1   FAIL      2006-01-02 15:04:05 2006-01-02 15:04:06 1.5s         1 error...
+	*/
+	fmt.Fprintf(c.ctx.Out, "%s (%s, type %s)\n", tries[0].Name, c.jobId, tries[0].Type)
+	hdr := fmt.Sprintf("%%-3s %%-3s %%-%ds %%-%ds %%-%ds %%-9s %%4s %%s\n",
+		logStateColLen, len(logTimeFmt), len(logTimeFmt))
+	line := fmt.Sprintf("%%-3d %%-3s %%-%ds %%-%ds %%-%ds %%-9s %%4d %%s",
+		logStateColLen, len(logTimeFmt), len(logTimeFmt))
+	fmt.Fprintf(c.ctx.Out, hdr, "TRY", "SEQ", "STATE", "STARTED", "FINISHED", "DURATION", "EXIT", "ERROR")
+	for _, l := range tries {
+		started, finished := logTimes(l)
+		startedStr := ""
+		if !started.IsZero() {
+			startedStr = started.UTC().Format(logTimeFmt)
+		}
+		finishedStr := ""
+		if !finished.IsZero() {
+			finishedStr = finished.UTC().Format(logTimeFmt)
+		}
+		duration := ""
+		if !started.IsZero() && !finished.IsZero() {
+			duration = finished.Sub(started).Round(time.Millisecond).String()
+		}
+		seqTry := "-" // job log from a JR that doesn't report it
+		if l.SequenceTry > 0 {
+			seqTry = fmt.Sprintf("%d", l.SequenceTry)
+		}
+		out := fmt.Sprintf(line,
+			l.Try,
+			seqTry,
+			proto.StateName[l.State],
+			startedStr,
+			finishedStr,
+			duration,
+			l.Exit,
+			truncateError(l.Error, logErrColLen),
+		)
+		fmt.Fprintln(c.ctx.Out, strings.TrimRight(out, " ")) // no trailing space if no error
+	}
+	return nil
+}
+
+func (c *Job) Cmd() string {
+	return "job " + c.reqId + " " + c.jobId
+}
+
+func (c *Job) Help() string {
+	return "'spinc job <request ID> <job ID>' prints the try history of the job, one line per try:\n" +
+		"try number, sequence try (the try of the job's sequence that the job try belonged to),\n" +
+		"state, started and finished times (UTC), duration, exit code, and error (truncated).\n" +
+		"Use 'spinc jobs <request ID>' to list job IDs, and 'spinc log <request ID> full=true'\n" +
+		"to print stdout and stderr.\n"
+}
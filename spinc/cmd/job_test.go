@@ -0,0 +1,93 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestJob(t *testing.T) {
+	output := &bytes.Buffer{}
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var gotReqId, gotJobId string
+	rmc := &mock.RMClient{
+		GetJobTriesFunc: func(reqId, jobId string) ([]proto.JobLog, error) {
+			gotReqId = reqId
+			gotJobId = jobId
+			return []proto.JobLog{
+				{
+					JobId:       "job1",
+					Name:        "first-job",
+					Type:        "shell-command",
+					Try:         1,
+					SequenceTry: 1,
+					State:       proto.STATE_FAIL,
+					StartedAt:   started.UnixNano(),
+					FinishedAt:  started.Add(1500 * time.Millisecond).UnixNano(),
+					Exit:        1,
+					Error:       "command failed",
+				},
+				{
+					JobId:       "job1",
+					Name:        "first-job",
+					Type:        "shell-command",
+					Try:         2,
+					SequenceTry: 2,
+					State:       proto.STATE_COMPLETE,
+					StartedAt:   started.Add(2 * time.Second).UnixNano(),
+					FinishedAt:  started.Add(3 * time.Second).UnixNano(),
+				},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "job",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg", "job1"},
+		},
+	}
+	job := cmd.NewJob(ctx)
+	if err := job.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := job.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotReqId != "b9uvdi8tk9kahl8ppvbg" || gotJobId != "job1" {
+		t.Errorf("got request ID %s job ID %s, expected b9uvdi8tk9kahl8ppvbg job1", gotReqId, gotJobId)
+	}
+
+	expectOutput := `first-job (job1, type shell-command)
+TRY SEQ STATE     STARTED             FINISHED            DURATION  EXIT ERROR
+1   1   FAIL      2020-01-02 03:04:05 2020-01-02 03:04:06 1.5s         1 command failed
+2   2   COMPLETE  2020-01-02 03:04:07 2020-01-02 03:04:08 1s           0
+`
+	if output.String() != expectOutput {
+		t.Errorf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+	}
+}
+
+func TestJobUsage(t *testing.T) {
+	ctx := app.Context{
+		Out:      &bytes.Buffer{},
+		RMClient: &mock.RMClient{},
+		Command: config.Command{
+			Cmd:  "job",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	if err := cmd.NewJob(ctx).Prepare(); err == nil {
+		t.Error("no error without job ID, expected usage error")
+	}
+}
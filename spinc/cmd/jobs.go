@@ -0,0 +1,188 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+const jobsNameColLen = 24 // names are padded, not truncated, so grep matches the full name
+
+type Jobs struct {
+	ctx   app.Context
+	reqId string
+}
+
+func NewJobs(ctx app.Context) *Jobs {
+	return &Jobs{
+		ctx: ctx,
+	}
+}
+
+func (c *Jobs) Prepare() error {
+	if len(c.ctx.Command.Args) != 1 {
+		return fmt.Errorf("Usage: spinc jobs <id> [--failed] [--pending] [--running]\n")
+	}
+	c.reqId = c.ctx.Command.Args[0]
+	return nil
+}
+
+func (c *Jobs) Run() error {
+	jc, err := c.ctx.RMClient.GetJobChain(c.reqId)
+	if err != nil {
+		return err
+	}
+	jl, err := c.ctx.RMClient.GetJLWithFilter(c.reqId, proto.JobLogFilter{NoOutput: true})
+	if err != nil {
+		return err
+	}
+	status, err := c.ctx.RMClient.Running(proto.StatusFilter{RequestId: c.reqId})
+	if err != nil {
+		return err
+	}
+
+	// The job chain has the jobs as created, so the job state is the state of
+	// its last try in the job log, or RUNNING if it's running now. Jobs that
+	// have not run are PENDING.
+	state := map[string]byte{}
+	tries := map[string]uint{}
+	sort.Sort(jobLog(jl))
+	for _, l := range jl {
+		state[l.JobId] = l.State
+		tries[l.JobId]++
+	}
+	for _, j := range status.Jobs {
+		state[j.JobId] = proto.STATE_RUNNING
+		if j.Try > tries[j.JobId] {
+			tries[j.JobId] = j.Try
+		}
+	}
+
+	// Previous jobs (dependencies) of each job, the reverse of the adjacency list
+	deps := map[string][]string{}
+	for prev, next := range jc.AdjacencyList {
+		for _, id := range next {
+			deps[id] = append(deps[id], prev)
+		}
+	}
+
+	jobs := []proto.Job{}
+	for _, id := range jobOrder(jc) {
+		j := jc.Jobs[id]
+		j.State = proto.STATE_PENDING
+		if s, ok := state[id]; ok {
+			j.State = s
+		}
+		if !c.match(j.State) {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(jobs, err)
+		return nil
+	}
+
+	/*
+	   JOB  NAME                     TYPE                     STATE     TRIES SEQ  DEPS
+	   abcd 123456789012345678901234 123456789012345678901234 COMPLETE  1/3   abcd efgh,ijkl
+	*/
+	line := fmt.Sprintf("%%-4s %%-%ds %%-%ds %%-9s %%-5s %%-4s %%s\n", jobsNameColLen, jobsNameColLen)
+	fmt.Fprintf(c.ctx.Out, line, "JOB", "NAME", "TYPE", "STATE", "TRIES", "SEQ", "DEPS")
+	for _, j := range jobs {
+		d := deps[j.Id]
+		sort.Strings(d)
+		depsStr := "-"
+		if len(d) > 0 {
+			depsStr = strings.Join(d, ",")
+		}
+		fmt.Fprintf(c.ctx.Out, line,
+			j.Id,
+			j.Name,
+			j.Type,
+			proto.StateName[j.State],
+			fmt.Sprintf("%d/%d", tries[j.Id], j.Retry+1),
+			j.SequenceId,
+			depsStr,
+		)
+	}
+	return nil
+}
+
+func (c *Jobs) Cmd() string {
+	cmd := "jobs " + c.reqId
+	if c.ctx.Options.Failed {
+		cmd += " --failed"
+	}
+	if c.ctx.Options.Pending {
+		cmd += " --pending"
+	}
+	if c.ctx.Options.Running {
+		cmd += " --running"
+	}
+	return cmd
+}
+
+func (c *Jobs) Help() string {
+	return "'spinc jobs <request ID>' prints every job in the job chain, one line per job in run order:\n" +
+		"job ID, name, type, state, tries (tries/max tries), sequence (job ID of first job in sequence),\n" +
+		"and dependencies (comma-separated job IDs of previous jobs, or - if none). Names are not truncated,\n" +
+		"so the output can be piped into grep or awk.\n\n" +
+		"Options:\n" +
+		"  --failed   Print only failed jobs\n" +
+		"  --pending  Print only jobs that have not run\n" +
+		"  --running  Print only running jobs\n" +
+		"Options can be combined, like --failed --running to print failed and running jobs.\n"
+}
+
+// match returns true if a job in the given state is printed: all jobs if no
+// filter option is given, else jobs matching any of the filter options.
+func (c *Jobs) match(state byte) bool {
+	o := c.ctx.Options
+	if !o.Failed && !o.Pending && !o.Running {
+		return true
+	}
+	return (o.Failed && state == proto.STATE_FAIL) ||
+		(o.Pending && state == proto.STATE_PENDING) ||
+		(o.Running && state == proto.STATE_RUNNING)
+}
+
+// jobOrder returns the job IDs in topological (run) order. Jobs that can run at
+// the same time are sorted by ID so the order is stable.
+func jobOrder(jc proto.JobChain) []string {
+	inDegree := map[string]int{}
+	for id := range jc.Jobs {
+		inDegree[id] = 0
+	}
+	for _, next := range jc.AdjacencyList {
+		for _, id := range next {
+			inDegree[id]++
+		}
+	}
+	ready := []string{}
+	for id, n := range inDegree {
+		if n == 0 {
+			ready = append(ready, id)
+		}
+	}
+	order := make([]string, 0, len(jc.Jobs))
+	for len(ready) > 0 {
+		sort.Strings(ready)
+		id := ready[0]
+		ready = ready[1:]
+		order = append(order, id)
+		for _, next := range jc.AdjacencyList[id] {
+			inDegree[next]--
+			if inDegree[next] == 0 {
+				ready = append(ready, next)
+			}
+		}
+	}
+	return order
+}
@@ -0,0 +1,159 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestJobs(t *testing.T) {
+	output := &bytes.Buffer{}
+	// Running request with 4 jobs: j1 completed, then j2 failed twice while j3
+	// is running, and j4 (after j2 and j3) has not run
+	rmc := &mock.RMClient{
+		GetJobChainFunc: func(reqId string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId: reqId,
+				Jobs: map[string]proto.Job{
+					"j1": {Id: "j1", Name: "check-db", Type: "mysql/check", SequenceId: "j1"},
+					"j2": {Id: "j2", Name: "stop-mysql", Type: "mysql/stop", Retry: 2, SequenceId: "j1"},
+					"j3": {Id: "j3", Name: "drain-traffic", Type: "lb/drain", SequenceId: "j1"},
+					"j4": {Id: "j4", Name: "start-mysql", Type: "mysql/start", SequenceId: "j1"},
+				},
+				AdjacencyList: map[string][]string{
+					"j1": {"j2", "j3"},
+					"j2": {"j4"},
+					"j3": {"j4"},
+				},
+			}, nil
+		},
+		GetJLWithFilterFunc: func(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			if !f.NoOutput {
+				return nil, fmt.Errorf("got job log filter %+v, expected NoOutput", f)
+			}
+			return []proto.JobLog{
+				{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_COMPLETE, FinishedAt: 1},
+				{RequestId: reqId, JobId: "j2", Try: 2, State: proto.STATE_FAIL, FinishedAt: 3},
+				{RequestId: reqId, JobId: "j2", Try: 1, State: proto.STATE_FAIL, FinishedAt: 2},
+			}, nil
+		},
+		RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+			return proto.RunningStatus{
+				Jobs: []proto.JobStatus{
+					{RequestId: f.RequestId, JobId: "j3", Name: "drain-traffic", Type: "lb/drain", Try: 1},
+				},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Command: config.Command{
+			Cmd:  "jobs",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	jobs := cmd.NewJobs(ctx)
+	if err := jobs.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := jobs.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectOutput := `JOB  NAME                     TYPE                     STATE     TRIES SEQ  DEPS
+j1   check-db                 mysql/check              COMPLETE  1/1   j1   -
+j2   stop-mysql               mysql/stop               FAIL      2/3   j1   j1
+j3   drain-traffic            lb/drain                 RUNNING   1/1   j1   j1
+j4   start-mysql              mysql/start              PENDING   0/1   j1   j2,j3
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestJobsFilters(t *testing.T) {
+	for _, test := range []struct {
+		options config.Options
+		expect  []string
+	}{
+		{config.Options{Failed: true}, []string{"j2"}},
+		{config.Options{Pending: true}, []string{"j4"}},
+		{config.Options{Running: true}, []string{"j3"}},
+		{config.Options{Failed: true, Running: true}, []string{"j2", "j3"}},
+	} {
+		var got []proto.Job
+		rmc := &mock.RMClient{
+			GetJobChainFunc: func(reqId string) (proto.JobChain, error) {
+				return proto.JobChain{
+					RequestId: reqId,
+					Jobs: map[string]proto.Job{
+						"j1": {Id: "j1", Name: "check-db", Type: "mysql/check", SequenceId: "j1"},
+						"j2": {Id: "j2", Name: "stop-mysql", Type: "mysql/stop", Retry: 2, SequenceId: "j1"},
+						"j3": {Id: "j3", Name: "drain-traffic", Type: "lb/drain", SequenceId: "j1"},
+						"j4": {Id: "j4", Name: "start-mysql", Type: "mysql/start", SequenceId: "j1"},
+					},
+					AdjacencyList: map[string][]string{
+						"j1": {"j2", "j3"},
+						"j2": {"j4"},
+						"j3": {"j4"},
+					},
+				}, nil
+			},
+			GetJLWithFilterFunc: func(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+				if !f.NoOutput {
+					return nil, fmt.Errorf("got job log filter %+v, expected NoOutput", f)
+				}
+				return []proto.JobLog{
+					{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_COMPLETE, FinishedAt: 1},
+					{RequestId: reqId, JobId: "j2", Try: 2, State: proto.STATE_FAIL, FinishedAt: 3},
+					{RequestId: reqId, JobId: "j2", Try: 1, State: proto.STATE_FAIL, FinishedAt: 2},
+				}, nil
+			},
+			RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+				return proto.RunningStatus{
+					Jobs: []proto.JobStatus{
+						{RequestId: f.RequestId, JobId: "j3", Name: "drain-traffic", Type: "lb/drain", Try: 1},
+					},
+				}, nil
+			},
+		}
+		ctx := app.Context{
+			Out:      &bytes.Buffer{},
+			RMClient: rmc,
+			Options:  test.options,
+			Command: config.Command{
+				Cmd:  "jobs",
+				Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+			},
+			Hooks: app.Hooks{
+				CommandRunResult: func(v interface{}, err error) {
+					got = v.([]proto.Job)
+				},
+			},
+		}
+		jobs := cmd.NewJobs(ctx)
+		if err := jobs.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		if err := jobs.Run(); err != nil {
+			t.Fatal(err)
+		}
+		gotIds := []string{}
+		for _, j := range got {
+			gotIds = append(gotIds, j.Id)
+		}
+		if fmt.Sprintf("%v", gotIds) != fmt.Sprintf("%v", test.expect) {
+			t.Errorf("options %+v: got jobs %v, expected %v", test.options, gotIds, test.expect)
+		}
+	}
+}
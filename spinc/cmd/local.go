@@ -0,0 +1,208 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/rs/xid"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/job-runner/local"
+	"github.com/square/spincycle/v2/job/poll"
+	"github.com/square/spincycle/v2/job/wait"
+	"github.com/square/spincycle/v2/jobs"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/id"
+	"github.com/square/spincycle/v2/request-manager/request"
+	"github.com/square/spincycle/v2/request-manager/spec"
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+// Local runs a request locally: it builds the job chain from specs on disk and
+// runs it with an in-process Job Runner. It does not use a Request Manager,
+// Job Runner, or database, so nothing is saved. It's meant for developing and
+// testing jobs and specs.
+type Local struct {
+	ctx app.Context
+	// --
+	specsDir string
+	reqType  string
+	args     map[string]interface{}
+	jf       job.Factory
+}
+
+func NewLocal(ctx app.Context) *Local {
+	jf := ctx.Factories.Jobs
+	if jf == nil {
+		jf = jobs.Factory
+	}
+	return &Local{
+		ctx: ctx,
+		jf:  poll.NewFactory(jf), // poll jobs are made by the RM and JR
+	}
+}
+
+func (c *Local) Prepare() error {
+	cmd := c.ctx.Command
+	if len(cmd.Args) < 3 || cmd.Args[0] != "run" {
+		return fmt.Errorf("Usage: spinc local run <specs dir> <request> [args]\n")
+	}
+	c.specsDir = cmd.Args[1]
+	c.reqType = cmd.Args[2]
+
+	c.args = map[string]interface{}{}
+	for _, keyval := range cmd.Args[3:] {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (key=val)", keyval, len(p))
+		}
+		c.args[p[0]] = p[1]
+		if c.ctx.Options.Debug {
+			app.Debug("given '%s'='%s'", p[0], p[1])
+		}
+	}
+	return nil
+}
+
+func (c *Local) Run() error {
+	// The job chain traverser and runners log a lot at info level, which
+	// would drown out the job log printed below
+	if !c.ctx.Options.Debug {
+		log.SetLevel(log.WarnLevel)
+	}
+
+	jc, err := c.jobChain()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(c.ctx.Out, "Running %s locally: %d jobs (Ctrl-C to stop)\n", c.reqType, len(jc.Jobs))
+
+	// Ctrl-C stops the job chain like 'spinc stop' stops a request
+	stopChan := make(chan struct{})
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, os.Interrupt)
+	defer signal.Stop(sigChan)
+	go func() {
+		if _, ok := <-sigChan; ok {
+			fmt.Fprintf(c.ctx.Out, "Stopping...\n")
+			close(stopChan)
+		}
+	}()
+
+	line := fmt.Sprintf("%%-19s  %%-%ds  %%-%ds  %%3d  %%s\n", logNameColLen, logStateColLen)
+	res, err := local.Run(jc, local.Config{
+		JobFactory: wait.NewFactory(c.jf),
+		StopChan:   stopChan,
+		OnJobLog: func(jl proto.JobLog) {
+			fmt.Fprintf(c.ctx.Out, line,
+				time.Unix(0, jl.FinishedAt).Local().Format(logTimeFmt),
+				SqueezeString(jl.Name, logNameColLen, ".."),
+				proto.StateName[jl.State],
+				jl.Try,
+				jl.Error,
+			)
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.ctx.Out, "%s %s\n", c.reqType, StateName(c.ctx, res.State))
+	if res.State != proto.STATE_COMPLETE {
+		return app.ErrRequestFailed{State: res.State}
+	}
+	return nil
+}
+
+func (c *Local) Cmd() string {
+	return "local run " + c.specsDir + " " + c.reqType
+}
+
+func (c *Local) Help() string {
+	return "'spinc local run <specs dir> <request> [args]' runs the request locally: it builds the job chain\n" +
+		"from the specs in <specs dir> and runs it with an in-process Job Runner. A Request Manager\n" +
+		"and Job Runner are not used, and nothing is saved. Args are key=val, like 'spinc start'.\n" +
+		"Press Ctrl-C to stop the request.\n"
+}
+
+// jobChain parses, checks, and resolves the specs like the Request Manager does
+// on startup, then builds the job chain for the request.
+func (c *Local) jobChain() (*proto.JobChain, error) {
+	specs, fileResults, err := spec.ParseSpecsDir(c.specsDir)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.printResults(fileResults); err != nil {
+		return nil, fmt.Errorf("Errors parsing request specification files in %s", c.specsDir)
+	}
+	spec.ProcessSpecs(&specs)
+
+	checkFactories := []spec.CheckFactory{spec.DefaultCheckFactory{AllSpecs: specs}, spec.BaseCheckFactory{AllSpecs: specs}}
+	checker, err := spec.NewChecker(checkFactories)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.printResults(checker.RunChecks(specs)); err != nil {
+		return nil, fmt.Errorf("Static check(s) on request specification files failed; run spinc-linter for details")
+	}
+
+	gf := id.NewGeneratorFactory(4, 100)
+	seqGraphs, graphResults := graph.NewGrapher(specs, gf).CheckSequences()
+	if err := c.printResults(graphResults); err != nil {
+		return nil, fmt.Errorf("Graph check(s) on request specification files failed; run spinc-linter for details")
+	}
+
+	seq, ok := specs.Sequences[c.reqType]
+	if !ok || !seq.Request {
+		return nil, fmt.Errorf("Unknown request: %s. No request with that name in %s.", c.reqType, c.specsDir)
+	}
+
+	req := proto.Request{
+		Id:          xid.New().String(),
+		Type:        c.reqType,
+		CreatedAt:   time.Now().UTC(),
+		State:       proto.STATE_PENDING,
+		SpecVersion: specs.Version,
+	}
+	resolver := graph.NewResolverFactory(c.jf, specs.Sequences, seqGraphs, gf).Make(req)
+	req.Args, err = resolver.RequestArgs(c.args)
+	if err != nil {
+		return nil, err
+	}
+	jobArgs := map[string]interface{}{}
+	for k, v := range c.args {
+		jobArgs[k] = v
+	}
+	reqGraph, err := resolver.BuildRequestGraph(jobArgs)
+	if err != nil {
+		return nil, err
+	}
+	for _, warn := range resolver.Warnings() {
+		fmt.Fprintf(c.ctx.Out, "Warning: %s\n", warn)
+	}
+	return request.NewJobChain(req, reqGraph), nil
+}
+
+// printResults prints spec check warnings and errors. It returns an error if
+// there are any errors.
+func (c *Local) printResults(results *spec.CheckResults) error {
+	for key, result := range results.Results {
+		for _, warn := range result.Warnings {
+			fmt.Fprintf(c.ctx.Out, "Warning: %s: %s\n", key, warn)
+		}
+		for _, err := range result.Errors {
+			fmt.Fprintf(c.ctx.Out, "Error: %s: %s\n", key, err)
+		}
+	}
+	if results.AnyError {
+		return fmt.Errorf("check errors")
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/spincycle/v2/job"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestLocalRun(t *testing.T) {
+	// Specs dir with only a-b-c.yaml because other test specs have errors
+	specsDir, err := ioutil.TempDir("", "spinc-local")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(specsDir)
+	spec, err := ioutil.ReadFile("../../request-manager/test/specs/a-b-c.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(specsDir, "a-b-c.yaml"), spec, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	complete := job.Return{State: proto.STATE_COMPLETE}
+	jf := &mock.JobFactory{
+		MockJobs: map[string]*mock.Job{
+			"aJobType": &mock.Job{RunReturn: complete, SetJobArgs: map[string]interface{}{"aArg": "a"}},
+			"bJobType": &mock.Job{RunReturn: complete},
+			"cJobType": &mock.Job{RunReturn: complete},
+			"noop":     &mock.Job{RunReturn: complete},
+		},
+	}
+	output := &bytes.Buffer{}
+	ctx := app.Context{
+		Out:       output,
+		Factories: app.Factories{Jobs: jf},
+		Command: config.Command{
+			Cmd:  "local",
+			Args: []string{"run", specsDir, "three-nodes", "foo=bar"},
+		},
+	}
+	local := cmd.NewLocal(ctx)
+	if err := local.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := local.Run(); err != nil {
+		t.Errorf("got error '%s', expected nil", err)
+	}
+	got := output.String()
+	for _, s := range []string{"Running three-nodes locally: 7 jobs", "three-nodes COMPLETE"} {
+		if !strings.Contains(got, s) {
+			t.Errorf("output does not contain '%s':\n%s", s, got)
+		}
+	}
+}
+
+func TestLocalUsage(t *testing.T) {
+	ctx := app.Context{
+		Out: &bytes.Buffer{},
+		Command: config.Command{
+			Cmd:  "local",
+			Args: []string{"three-nodes"},
+		},
+	}
+	local := cmd.NewLocal(ctx)
+	if err := local.Prepare(); err == nil {
+		t.Error("got nil error, expected usage error")
+	}
+}
@@ -5,6 +5,8 @@ package cmd
 import (
 	"fmt"
 	"sort"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/square/spincycle/v2/proto"
@@ -13,6 +15,12 @@ import (
 
 const (
 	RECORD_SEPARATOR = "--\n"
+
+	// formatting for log table
+	logNameColLen  = 24
+	logStateColLen = 9
+	logErrColLen   = 40
+	logTimeFmt     = "2006-01-02 15:04:05"
 )
 
 type jobLog []proto.JobLog
@@ -22,8 +30,11 @@ func (l jobLog) Swap(i, j int)      { l[i], l[j] = l[j], l[i] }
 func (l jobLog) Less(i, j int) bool { return l[i].FinishedAt < l[j].FinishedAt }
 
 type Log struct {
-	ctx   app.Context
-	reqId string
+	ctx        app.Context
+	reqId      string
+	errorsOnly bool   // only print tries that did not complete
+	full       bool   // print every field, untruncated, including stdout and stderr
+	stream     string // print only this output ("stdout" or "stderr") for each try
 }
 
 func NewLog(ctx app.Context) *Log {
@@ -34,14 +45,49 @@ func NewLog(ctx app.Context) *Log {
 
 func (c *Log) Prepare() error {
 	if len(c.ctx.Command.Args) == 0 {
-		return fmt.Errorf("Usage: spinc log <id>\n")
+		return fmt.Errorf("Usage: spinc log <id> [errors-only=true] [full=true] [stream=stdout|stderr]\n")
 	}
 	c.reqId = c.ctx.Command.Args[0]
+
+	for _, arg := range c.ctx.Command.Args[1:] {
+		split := strings.SplitN(arg, "=", 2)
+		if len(split) != 2 {
+			return fmt.Errorf("Invalid command arg %s: expected arg of form option=value (should contain exactly one '=')", arg)
+		}
+		switch split[0] {
+		case "errors-only", "full":
+			val, err := strconv.ParseBool(split[1])
+			if err != nil {
+				return fmt.Errorf("Invalid value '%s' for %s: expected true or false", split[1], split[0])
+			}
+			if split[0] == "full" {
+				c.full = val
+			} else {
+				c.errorsOnly = val
+			}
+		case "stream":
+			c.stream = strings.ToLower(split[1])
+			if c.stream != "stdout" && c.stream != "stderr" {
+				return fmt.Errorf("Invalid stream '%s': expected stdout or stderr", split[1])
+			}
+		default:
+			return fmt.Errorf("Invalid arg '%s'", split[0])
+		}
+	}
+	if c.full && c.stream != "" {
+		return fmt.Errorf("full and stream are mutually exclusive")
+	}
 	return nil
 }
 
 func (c *Log) Run() error {
-	jl, err := c.ctx.RMClient.GetJL(c.reqId)
+	// The table doesn't print stdout and stderr, so don't fetch them
+	f := proto.JobLogFilter{
+		ErrorsOnly: c.errorsOnly,
+		NoOutput:   !c.full && c.stream == "",
+		Stream:     c.stream,
+	}
+	jl, err := c.ctx.RMClient.GetJLWithFilter(c.reqId, f)
 	if err != nil {
 		return err
 	}
@@ -53,46 +99,158 @@ func (c *Log) Run() error {
 		return nil
 	}
 
-	n := len(jl)
-	for i, l := range jl {
-		var (
-			started  time.Time
-			finished time.Time
-		)
-		if l.StartedAt != 0 {
-			started = time.Unix(0, l.StartedAt)
+	switch {
+	case c.full:
+		c.printFull(jl)
+	case c.stream != "":
+		c.printStream(jl)
+	default:
+		c.printTable(jl)
+	}
+	return nil
+}
+
+func (c *Log) Cmd() string {
+	cmd := "log " + c.reqId
+	if c.errorsOnly {
+		cmd += " errors-only=true"
+	}
+	if c.full {
+		cmd += " full=true"
+	}
+	if c.stream != "" {
+		cmd += " stream=" + c.stream
+	}
+	return cmd
+}
+
+func (c *Log) Help() string {
+	return "'spinc log <request ID> [errors-only=true] [full=true]' prints the job log of the request.\n" +
+		"By default, it prints a table with one line per job try: job ID, name, try number, state,\n" +
+		"started and finished times (UTC), duration, exit code, and error (truncated).\n\n" +
+		"Options:\n" +
+		"  errors-only=true  Print only tries that did not complete\n" +
+		"  full=true         Print every field untruncated, including stdout and stderr.\n" +
+		"                    The full job log can be long, so pipe the output to less.\n" +
+		"  stream=stderr     Print only stderr (or stdout: stream=stdout) of each try, after\n" +
+		"                    a '# <job ID> <job name> try <N>' line\n"
+}
+
+// --------------------------------------------------------------------------
+
+func (c *Log) printTable(jl []proto.JobLog) {
+	/*
+	   JOB  NAME                     TRY   STATE     STARTED             FINISHED            DURATION  EXIT ERROR
+	   abcd 123456789012345678901234 1/3   FAIL      2006-01-02 15:04:05 2006-01-02 15:04:06 1.5s         1 error...
+	*/
+
+	// Number of tries per job, so each line shows "try/tries"
+	tries := map[string]uint{}
+	for _, l := range jl {
+		if l.Try > tries[l.JobId] {
+			tries[l.JobId] = l.Try
+		}
+	}
+
+	hdr := fmt.Sprintf("%%-4s %%-%ds %%-5s %%-%ds %%-%ds %%-%ds %%-9s %%4s %%s\n",
+		logNameColLen, logStateColLen, len(logTimeFmt), len(logTimeFmt))
+	line := fmt.Sprintf("%%-4s %%-%ds %%-5s %%-%ds %%-%ds %%-%ds %%-9s %%4d %%s",
+		logNameColLen, logStateColLen, len(logTimeFmt), len(logTimeFmt))
+	fmt.Fprintf(c.ctx.Out, hdr, "JOB", "NAME", "TRY", "STATE", "STARTED", "FINISHED", "DURATION", "EXIT", "ERROR")
+
+	for _, l := range jl {
+		started, finished := logTimes(l)
+		startedStr := ""
+		if !started.IsZero() {
+			startedStr = started.UTC().Format(logTimeFmt)
+		}
+		finishedStr := ""
+		if !finished.IsZero() {
+			finishedStr = finished.UTC().Format(logTimeFmt)
 		}
-		if l.FinishedAt != 0 {
-			finished = time.Unix(0, l.FinishedAt)
+		duration := ""
+		if !started.IsZero() && !finished.IsZero() {
+			duration = finished.Sub(started).Round(time.Millisecond).String()
 		}
+		out := fmt.Sprintf(line,
+			l.JobId,
+			SqueezeString(l.Name, logNameColLen, ".."),
+			fmt.Sprintf("%d/%d", l.Try, tries[l.JobId]),
+			proto.StateName[l.State],
+			startedStr,
+			finishedStr,
+			duration,
+			l.Exit,
+			truncateError(l.Error, logErrColLen),
+		)
+		fmt.Fprintln(c.ctx.Out, strings.TrimRight(out, " ")) // no trailing space if no error
+	}
+}
+
+func (c *Log) printFull(jl []proto.JobLog) {
+	n := len(jl)
+	for i, l := range jl {
+		started, finished := logTimes(l)
 		d := finished.Sub(started)
 
-		fmt.Printf("job id:   %s\n", l.JobId)
-		fmt.Printf("job name: %s\n", l.Name)
-		fmt.Printf("job type: %s\n", l.Type)
-		fmt.Printf("state:    %s\n", proto.StateName[l.State])
-		fmt.Printf("exit:     %d\n", l.Exit)
-		fmt.Printf("error:    %s\n", l.Error)
-		fmt.Printf("try:      %d\n", l.Try)
-		fmt.Printf("runtime:  %fs\n", d.Seconds())
-		fmt.Printf("started:  %s\n", started)
-		fmt.Printf("finished: %s\n", finished)
-		fmt.Printf("stdout:   %s\n", l.Stdout)
-		fmt.Printf("stderr:   %s\n", l.Stderr)
+		fmt.Fprintf(c.ctx.Out, "job id:   %s\n", l.JobId)
+		fmt.Fprintf(c.ctx.Out, "job name: %s\n", l.Name)
+		fmt.Fprintf(c.ctx.Out, "job type: %s\n", l.Type)
+		fmt.Fprintf(c.ctx.Out, "state:    %s\n", proto.StateName[l.State])
+		fmt.Fprintf(c.ctx.Out, "exit:     %d\n", l.Exit)
+		fmt.Fprintf(c.ctx.Out, "error:    %s\n", l.Error)
+		if l.ErrorCategory != "" || l.ErrorCode != "" { // structured job error
+			fmt.Fprintf(c.ctx.Out, "category: %s\n", l.ErrorCategory)
+			fmt.Fprintf(c.ctx.Out, "code:     %s\n", l.ErrorCode)
+			fmt.Fprintf(c.ctx.Out, "retry ok: %t\n", l.ErrorRetryable)
+		}
+		fmt.Fprintf(c.ctx.Out, "try:      %d\n", l.Try)
+		fmt.Fprintf(c.ctx.Out, "runtime:  %fs\n", d.Seconds())
+		fmt.Fprintf(c.ctx.Out, "started:  %s\n", started)
+		fmt.Fprintf(c.ctx.Out, "finished: %s\n", finished)
+		fmt.Fprintf(c.ctx.Out, "stdout:   %s\n", l.Stdout)
+		fmt.Fprintf(c.ctx.Out, "stderr:   %s\n", l.Stderr)
 
 		if i < n-1 {
-			fmt.Print(RECORD_SEPARATOR)
+			fmt.Fprint(c.ctx.Out, RECORD_SEPARATOR)
 		}
 	}
+}
 
-	return nil
+func (c *Log) printStream(jl []proto.JobLog) {
+	for _, l := range jl {
+		fmt.Fprintf(c.ctx.Out, "# %s %s try %d\n", l.JobId, l.Name, l.Try)
+		out := l.Stdout
+		if c.stream == "stderr" {
+			out = l.Stderr
+		}
+		if out == "" {
+			continue
+		}
+		fmt.Fprint(c.ctx.Out, out)
+		if !strings.HasSuffix(out, "\n") {
+			fmt.Fprintln(c.ctx.Out)
+		}
+	}
 }
 
-func (c *Log) Cmd() string {
-	return "log " + c.reqId
+// logTimes returns the started and finished times of the JL. Times not set
+// (zero in the JL) are returned as zero time.Time.
+func logTimes(l proto.JobLog) (started, finished time.Time) {
+	if l.StartedAt != 0 {
+		started = time.Unix(0, l.StartedAt)
+	}
+	if l.FinishedAt != 0 {
+		finished = time.Unix(0, l.FinishedAt)
+	}
+	return
 }
 
-func (c *Log) Help() string {
-	return "'spin log <request ID>' prints the entire job log of the request.\n" +
-		"The job log can be long, so pipe the output to less: 'spinc log <request ID> | less'.\n"
+// truncateError makes a job error fit on one line of n characters.
+func truncateError(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return strings.TrimRight(s[0:n-3], " ") + "..."
 }
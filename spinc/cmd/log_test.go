@@ -0,0 +1,171 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestLogTable(t *testing.T) {
+	output := &bytes.Buffer{}
+	started := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	var gotFilter proto.JobLogFilter
+	rmc := &mock.RMClient{
+		GetJLWithFilterFunc: func(id string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			gotFilter = f
+			return []proto.JobLog{
+				{
+					JobId:      "job2",
+					Name:       "second-job",
+					Try:        1,
+					State:      proto.STATE_COMPLETE,
+					StartedAt:  started.Add(3 * time.Second).UnixNano(),
+					FinishedAt: started.Add(4 * time.Second).UnixNano(),
+				},
+				{
+					JobId:      "job1",
+					Name:       "first-job",
+					Try:        1,
+					State:      proto.STATE_FAIL,
+					StartedAt:  started.UnixNano(),
+					FinishedAt: started.Add(1500 * time.Millisecond).UnixNano(),
+					Exit:       1,
+					Error:      "command failed:\nsome very long error message that does not fit in the table",
+				},
+				{
+					JobId:      "job1",
+					Name:       "first-job",
+					Try:        2,
+					State:      proto.STATE_COMPLETE,
+					StartedAt:  started.Add(2 * time.Second).UnixNano(),
+					FinishedAt: started.Add(3 * time.Second).UnixNano(),
+				},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "log",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	log := cmd.NewLog(ctx)
+	if err := log.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFilter := proto.JobLogFilter{NoOutput: true}
+	if diff := deep.Equal(gotFilter, expectFilter); diff != nil {
+		t.Error(diff)
+	}
+
+	expectOutput := `JOB  NAME                     TRY   STATE     STARTED             FINISHED            DURATION  EXIT ERROR
+job1 first-job                1/2   FAIL      2020-01-02 03:04:05 2020-01-02 03:04:06 1.5s         1 command failed: some very long error...
+job1 first-job                2/2   COMPLETE  2020-01-02 03:04:07 2020-01-02 03:04:08 1s           0
+job2 second-job               1/1   COMPLETE  2020-01-02 03:04:08 2020-01-02 03:04:09 1s           0
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestLogArgs(t *testing.T) {
+	var gotFilter proto.JobLogFilter
+	rmc := &mock.RMClient{
+		GetJLWithFilterFunc: func(id string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			gotFilter = f
+			return []proto.JobLog{}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      &bytes.Buffer{},
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "log",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg", "errors-only=true", "full=true"},
+		},
+	}
+	log := cmd.NewLog(ctx)
+	if err := log.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expectFilter := proto.JobLogFilter{ErrorsOnly: true}
+	if diff := deep.Equal(gotFilter, expectFilter); diff != nil {
+		t.Error(diff)
+	}
+
+	ctx.Command.Args = []string{"b9uvdi8tk9kahl8ppvbg", "bad=true"}
+	log = cmd.NewLog(ctx)
+	if err := log.Prepare(); err == nil {
+		t.Error("no error for invalid arg, expected an error")
+	}
+}
+
+func TestLogStream(t *testing.T) {
+	output := &bytes.Buffer{}
+	var gotFilter proto.JobLogFilter
+	rmc := &mock.RMClient{
+		GetJLWithFilterFunc: func(id string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			gotFilter = f
+			return []proto.JobLog{
+				{JobId: "job1", Name: "first-job", Try: 1, FinishedAt: 1, Stderr: "error 1"},
+				{JobId: "job1", Name: "first-job", Try: 2, FinishedAt: 2},
+				{JobId: "job2", Name: "second-job", Try: 1, FinishedAt: 3, Stderr: "error 2\n"},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "log",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg", "stream=stderr"},
+		},
+	}
+	log := cmd.NewLog(ctx)
+	if err := log.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := log.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	expectFilter := proto.JobLogFilter{Stream: "stderr"}
+	if diff := deep.Equal(gotFilter, expectFilter); diff != nil {
+		t.Error(diff)
+	}
+
+	expectOutput := `# job1 first-job try 1
+error 1
+# job1 first-job try 2
+# job2 second-job try 1
+error 2
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
@@ -4,6 +4,7 @@ package cmd
 
 import (
 	"fmt"
+	"net/url"
 	"time"
 
 	"github.com/square/spincycle/v2/proto"
@@ -14,6 +15,9 @@ const (
 	reqColLen  = 20
 	userColLen = 9
 	jobColLen  = 22
+	jrColLen   = 20
+
+	statusColLen = 80 // last column, but long status wraps and breaks the table
 )
 
 type Ps struct {
@@ -56,6 +60,10 @@ func (c *Ps) Run() error {
 		return nil
 	}
 
+	if status.Banner != "" {
+		fmt.Fprintf(c.ctx.Out, "%s\n", status.Banner)
+	}
+
 	if len(status.Jobs) == 0 {
 		return nil
 	}
@@ -65,28 +73,52 @@ func (c *Ps) Run() error {
 	/*
 	   REQUEST              ID                    PRG  USER      RUNTIME  TRY JOB                  STATUS
 	   12345678901234567890 --------------------  100% 123456789 12345678   3 12345678901234567890 *
+
+	   With --wide, these columns are printed before STATUS:
+
+	   JR                   CHAIN    SEQTRY
+	   12345678901234567890 12345678      2
 	*/
-	hdr := "%-" + fmt.Sprintf("%d", reqColLen) + "s %-20s %4s  %-" + fmt.Sprintf("%d", userColLen) + "s %-8s %3s %-" + fmt.Sprintf("%d", jobColLen) + "s %s\n"
-	fmt.Fprintf(c.ctx.Out, hdr, "REQUEST", "ID", "PRG", "USER", "RUNTIME", "TRY", "JOB", "STATUS")
+	hdr := "%-" + fmt.Sprintf("%d", reqColLen) + "s %-20s %4s  %-" + fmt.Sprintf("%d", userColLen) + "s %-8s %3s %-" + fmt.Sprintf("%d", jobColLen) + "s "
+	line := "%-" + fmt.Sprintf("%d", reqColLen) + "s %-20s %4s  %-" + fmt.Sprintf("%d", userColLen) + "s %-8s %3d %-" + fmt.Sprintf("%d", jobColLen) + "s "
+	hdrCols := []interface{}{"REQUEST", "ID", "PRG", "USER", "RUNTIME", "TRY", "JOB"}
+	if c.ctx.Options.Wide {
+		hdr += "%-" + fmt.Sprintf("%d", jrColLen) + "s %-8s %6s "
+		line += "%-" + fmt.Sprintf("%d", jrColLen) + "s %-8s %6d "
+		hdrCols = append(hdrCols, "JR", "CHAIN", "SEQTRY")
+	}
+	hdr += "%s\n"
+	line += "%s\n"
+	fmt.Fprintf(c.ctx.Out, hdr, append(hdrCols, "STATUS")...)
 
-	line := "%-" + fmt.Sprintf("%d", reqColLen) + "s %-20s %4s  %-" + fmt.Sprintf("%d", userColLen) + "s %-8s %3d %-" + fmt.Sprintf("%d", jobColLen) + "s %s\n"
 	for _, j := range status.Jobs {
 		reqName := "unknown"
 		reqId := ""
 		reqPrg := "0"
 		reqUser := ""
+		jrURL := j.JobRunnerURL
 		if r, ok := status.Requests[j.RequestId]; ok {
 			reqName = r.Type
 			reqId = r.Id
 			reqPrg = fmt.Sprintf("%.0f%%", float64(r.FinishedJobs)/float64(r.TotalJobs)*100)
 			reqUser = r.User
+			if jrURL == "" {
+				jrURL = r.JobRunnerURL
+			}
 		}
 		runtime := now.Sub(time.Unix(0, j.StartedAt)).Round(time.Second)
-		fmt.Fprintf(c.ctx.Out, line,
+		cols := []interface{}{
 			SqueezeString(reqName, reqColLen, ".."), reqId, reqPrg, SqueezeString(reqUser, userColLen, ".."),
 			runtime, j.Try, SqueezeString(j.Name, jobColLen, ".."),
-			j.Status,
-		)
+		}
+		if c.ctx.Options.Wide {
+			chainAge := ""
+			if j.ChainStartedAt > 0 {
+				chainAge = now.Sub(time.Unix(0, j.ChainStartedAt)).Round(time.Second).String()
+			}
+			cols = append(cols, SqueezeString(jrHost(jrURL), jrColLen, ".."), chainAge, j.SequenceTry)
+		}
+		fmt.Fprintf(c.ctx.Out, line, append(cols, truncateError(j.Status, statusColLen))...)
 	}
 
 	return nil
@@ -111,5 +143,21 @@ func (c *Ps) Help() string {
 		"  TRY:     Job try count\n" +
 		"  JOB:     Job name from request spec\n" +
 		"  STATUS:  Real-time job status\n" +
-		"Long column values are truncated in the middle with '..'.\n"
+		"With --wide, these columns are printed before STATUS:\n" +
+		"  JR:      Job Runner host running the job\n" +
+		"  CHAIN:   How long the Job Runner has been running the job chain (1s resolution)\n" +
+		"  SEQTRY:  Sequence try count\n" +
+		"Long column values are truncated in the middle with '..'.\n" +
+		"STATUS is printed on one line and truncated at the end with '...'.\n" +
+		"If the Request Manager returns a banner (e.g. it is read-only), it is printed first.\n"
+}
+
+// jrHost returns the host:port of a Job Runner URL, or the URL as-is if it cannot
+// be parsed.
+func jrHost(jrURL string) string {
+	u, err := url.Parse(jrURL)
+	if err != nil || u.Host == "" {
+		return jrURL
+	}
+	return u.Host
 }
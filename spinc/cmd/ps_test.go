@@ -148,7 +148,7 @@ func TestPsLongNames(t *testing.T) {
 				Type:      "jobtype",
 				Name:      "this-is-a-pretty-long-job-name",
 				StartedAt: time.Now().Add(-65 * time.Minute).UnixNano(),
-				Status:    "but job status has no length so we should see this whole string, nothing truncated...",
+				Status:    "job status can be long and span\nlines, so it is printed on one line and truncated at the end of the table",
 				Try:       999,
 			},
 		},
@@ -189,7 +189,94 @@ func TestPsLongNames(t *testing.T) {
 	}
 
 	expectOutput := `REQUEST              ID                    PRG  USER      RUNTIME  TRY JOB                    STATUS
-this-is-a..uest-name b9uvdi8tk9kahl8ppvbg 100%  mich..nch 1h5m0s   999 this-is-a-..g-job-name but job status has no length so we should see this whole string, nothing truncated...
+this-is-a..uest-name b9uvdi8tk9kahl8ppvbg 100%  mich..nch 1h5m0s   999 this-is-a-..g-job-name job status can be long and span lines, so it is printed on one line and trunc...
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestPsWide(t *testing.T) {
+	output := &bytes.Buffer{}
+	status := proto.RunningStatus{
+		Jobs: []proto.JobStatus{
+			{
+				RequestId:      "b9uvdi8tk9kahl8ppvbg",
+				JobId:          "jid1",
+				Type:           "jobtype",
+				Name:           "jobname",
+				StartedAt:      time.Now().Add(-3 * time.Second).UnixNano(),
+				Status:         "jobstatus",
+				Try:            1,
+				SequenceTry:    2,
+				ChainStartedAt: time.Now().Add(-10 * time.Minute).UnixNano(),
+				JobRunnerURL:   "https://jr1.local:32307",
+			},
+		},
+		Requests: map[string]proto.Request{
+			"b9uvdi8tk9kahl8ppvbg": proto.Request{
+				Id:           "b9uvdi8tk9kahl8ppvbg",
+				TotalJobs:    9,
+				Type:         "requestname",
+				User:         "owner",
+				FinishedJobs: 1,
+				JobRunnerURL: "https://jr2.local:32307",
+			},
+		},
+	}
+	rmc := &mock.RMClient{
+		RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+			return status, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{Wide: true},
+	}
+	ps := cmd.NewPs(ctx)
+	err := ps.Run()
+	if err != nil {
+		t.Errorf("got err '%s', exepcted nil", err)
+	}
+
+	// JR is from the job status, not the request, because the job status is
+	// from the JR that's actually running the job
+	expectOutput := `REQUEST              ID                    PRG  USER      RUNTIME  TRY JOB                    JR                   CHAIN    SEQTRY STATUS
+requestname          b9uvdi8tk9kahl8ppvbg  11%  owner     3s         1 jobname                jr1.local:32307      10m0s         2 jobstatus
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestPsBanner(t *testing.T) {
+	output := &bytes.Buffer{}
+	status := proto.RunningStatus{
+		Jobs:     []proto.JobStatus{},
+		Requests: map[string]proto.Request{},
+		Banner:   "Request Manager is read-only: database failover",
+	}
+	rmc := &mock.RMClient{
+		RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+			return status, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+	}
+	ps := cmd.NewPs(ctx)
+	err := ps.Run()
+	if err != nil {
+		t.Errorf("got err '%s', exepcted nil", err)
+	}
+
+	// Banner is printed even when nothing is running
+	expectOutput := `Request Manager is read-only: database failover
 `
 	if output.String() != expectOutput {
 		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
@@ -0,0 +1,234 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/prompt"
+)
+
+// resumeHold is how long the request is held (not resumed) while resume points
+// are chosen interactively.
+const resumeHold = "10m"
+
+type Resume struct {
+	ctx app.Context
+	// --
+	reqId string
+	jobs  map[string]string // job ID => proto.RESUME_*, empty if interactive
+}
+
+func NewResume(ctx app.Context) *Resume {
+	return &Resume{
+		ctx: ctx,
+	}
+}
+
+func (c *Resume) Prepare() error {
+	cmd := c.ctx.Command
+	if len(cmd.Args) == 0 {
+		return fmt.Errorf("Usage: spinc resume <ID> [job=complete|skip|pending...]\n")
+	}
+	c.reqId = cmd.Args[0]
+
+	c.jobs = map[string]string{}
+	for _, keyval := range cmd.Args[1:] {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (job=action)", keyval, len(p))
+		}
+		if !validResumePoint(p[1]) {
+			return fmt.Errorf("Invalid command arg: %s: unknown action %s, expected %s, %s, or %s",
+				keyval, p[1], proto.RESUME_COMPLETE, proto.RESUME_SKIP, proto.RESUME_PENDING)
+		}
+		c.jobs[p[0]] = p[1]
+	}
+	return nil
+}
+
+func (c *Resume) Run() error {
+	req, err := c.ctx.RMClient.GetRequest(c.reqId)
+	if err != nil {
+		return err
+	}
+	if req.State != proto.STATE_SUSPENDED {
+		return fmt.Errorf("Request %s is %s, not SUSPENDED: only suspended requests can be resumed from chosen jobs", c.reqId, proto.StateName[req.State])
+	}
+
+	// Interactive: hold the request so it's not resumed while jobs are chosen,
+	// and release the hold if not changed (resumed as it was)
+	in := bufio.NewReader(c.ctx.In)
+	interactive := len(c.jobs) == 0
+	if interactive {
+		if _, err := c.ctx.RMClient.SetResumePoints(c.reqId, proto.ResumePoints{Hold: resumeHold}); err != nil {
+			return err
+		}
+		changed := false
+		defer func() {
+			if changed {
+				return
+			}
+			if _, err := c.ctx.RMClient.SetResumePoints(c.reqId, proto.ResumePoints{}); err != nil {
+				fmt.Fprintf(c.ctx.Out, "Error releasing hold (request will be resumed in %s): %s\n", resumeHold, err)
+			}
+		}()
+		jc, err := c.ctx.RMClient.GetResumePoints(c.reqId)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(c.ctx.Out, "Request %s (%s) by %s: %s (held %s while you choose)\n\n", req.Id, req.Type, req.User, proto.StateName[req.State], resumeHold)
+		c.printJobs(jc)
+		if err := c.choose(jc, in); err != nil {
+			return err
+		}
+		if len(c.jobs) == 0 {
+			return fmt.Errorf("No jobs changed, request will be resumed as it was")
+		}
+		if err := c.confirm(jc, in); err != nil {
+			return err
+		}
+		if err := c.set(); err != nil {
+			return err
+		}
+		changed = true
+		return nil
+	}
+
+	jc, err := c.ctx.RMClient.GetResumePoints(c.reqId)
+	if err != nil {
+		return err
+	}
+	for id := range c.jobs {
+		if _, ok := jc.Jobs[id]; !ok {
+			return fmt.Errorf("Job %s is not in the job chain of request %s", id, c.reqId)
+		}
+	}
+	if !c.ctx.Options.Yes {
+		fmt.Fprintf(c.ctx.Out, "Request %s (%s) by %s: %s\n", req.Id, req.Type, req.User, proto.StateName[req.State])
+		if err := c.confirm(jc, in); err != nil {
+			return err
+		}
+	}
+	return c.set()
+}
+
+func (c *Resume) Cmd() string {
+	cmd := "resume " + c.reqId
+	for _, id := range c.jobIds() {
+		cmd += " " + id + "=" + c.jobs[id]
+	}
+	return cmd
+}
+
+func (c *Resume) Help() string {
+	return "'spinc resume <request ID> [job=complete|skip|pending...]' chooses where a suspended request\n" +
+		"resumes by marking jobs complete, skipped, or pending, then resumes it:\n" +
+		"  complete  The job was done outside Spin Cycle (like by hand); don't run it\n" +
+		"  skip      The job does not need to be done; don't run it\n" +
+		"  pending   Run the job (again) with all its tries\n" +
+		"Jobs after complete and skipped jobs run. Every previous job of a complete or skipped job must\n" +
+		"be complete or skipped too, else the Request Manager returns an error and nothing is changed.\n" +
+		"Run 'spinc jobs <request ID>' for job IDs.\n\n" +
+		"Without job args, it holds the request (not resumed for " + resumeHold + "), prints its jobs, and prompts\n" +
+		"for jobs to change. Changes require confirmation; with job args, --yes skips it.\n" +
+		"Only admins can change resume points.\n"
+}
+
+// printJobs prints the jobs of the suspended job chain in run order.
+func (c *Resume) printJobs(jc proto.JobChain) {
+	/*
+	   JOB  NAME                     TYPE                     STATE
+	   abcd 123456789012345678901234 123456789012345678901234 COMPLETE
+	*/
+	line := fmt.Sprintf("%%-4s %%-%ds %%-%ds %%s\n", jobsNameColLen, jobsNameColLen)
+	fmt.Fprintf(c.ctx.Out, line, "JOB", "NAME", "TYPE", "STATE")
+	for _, id := range jobOrder(jc) {
+		j := jc.Jobs[id]
+		fmt.Fprintf(c.ctx.Out, line, j.Id, j.Name, j.Type, proto.StateName[j.State])
+	}
+}
+
+// choose prompts for jobs to change, one "<job ID> <action>" per line, until an
+// empty line.
+func (c *Resume) choose(jc proto.JobChain, in *bufio.Reader) error {
+	fmt.Fprintf(c.ctx.Out, "\nEnter a job ID and %s, %s, or %s (like 'abcd %s'), one per line, or nothing when done:\n",
+		proto.RESUME_COMPLETE, proto.RESUME_SKIP, proto.RESUME_PENDING, proto.RESUME_SKIP)
+	for {
+		fmt.Fprintf(c.ctx.Out, "> ")
+		line, err := in.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		f := strings.Fields(line)
+		if len(f) == 0 {
+			return nil
+		}
+		if len(f) != 2 {
+			fmt.Fprintf(c.ctx.Out, "# Invalid input: %s: expected a job ID and action\n", strings.TrimSpace(line))
+		} else if _, ok := jc.Jobs[f[0]]; !ok {
+			fmt.Fprintf(c.ctx.Out, "# Invalid job ID: %s\n", f[0])
+		} else if !validResumePoint(f[1]) {
+			fmt.Fprintf(c.ctx.Out, "# Invalid action: %s\n", f[1])
+		} else {
+			c.jobs[f[0]] = f[1]
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+// confirm prints the job changes and prompts to confirm.
+func (c *Resume) confirm(jc proto.JobChain, in io.Reader) error {
+	fmt.Fprintf(c.ctx.Out, "Resume points:\n")
+	for _, id := range c.jobIds() {
+		j := jc.Jobs[id]
+		fmt.Fprintf(c.ctx.Out, "  %s (%s): %s -> %s\n", id, j.Name, proto.StateName[j.State], c.jobs[id])
+	}
+	ok := prompt.NewConfirmationPrompt("Enter 'resume' to resume, or anything else to abort: ", "resume", in, c.ctx.Out)
+	if err := ok.Prompt(); err != nil {
+		return fmt.Errorf("Not changed")
+	}
+	return nil
+}
+
+// set sets the resume points and prints the result.
+func (c *Resume) set() error {
+	jc, err := c.ctx.RMClient.SetResumePoints(c.reqId, proto.ResumePoints{Jobs: c.jobs})
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(jc, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !c.ctx.Options.Quiet {
+		fmt.Fprintf(c.ctx.Out, "OK, resuming %s (%d of %d jobs complete)\n", c.reqId, jc.FinishedJobs, len(jc.Jobs))
+	}
+	return nil
+}
+
+// jobIds returns the IDs of the jobs to change, sorted.
+func (c *Resume) jobIds() []string {
+	ids := make([]string, 0, len(c.jobs))
+	for id := range c.jobs {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func validResumePoint(action string) bool {
+	switch action {
+	case proto.RESUME_COMPLETE, proto.RESUME_SKIP, proto.RESUME_PENDING:
+		return true
+	}
+	return false
+}
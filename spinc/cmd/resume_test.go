@@ -0,0 +1,209 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestResumeInteractive(t *testing.T) {
+	// Suspended request with 3 jobs: j1 is complete, j2 was stopped, and j3
+	// has not run. Every call to SetResumePoints is appended to set.
+	set := []proto.ResumePoints{}
+	output := &bytes.Buffer{}
+	jc := proto.JobChain{
+		RequestId: "b9uvdi8tk9kahl8ppvbg",
+		Jobs: map[string]proto.Job{
+			"j1": {Id: "j1", Name: "check-db", Type: "mysql/check", State: proto.STATE_COMPLETE},
+			"j2": {Id: "j2", Name: "stop-mysql", Type: "mysql/stop", State: proto.STATE_STOPPED},
+			"j3": {Id: "j3", Name: "start-mysql", Type: "mysql/start", State: proto.STATE_PENDING},
+		},
+		AdjacencyList: map[string][]string{
+			"j1": {"j2"},
+			"j2": {"j3"},
+		},
+		FinishedJobs: 1,
+	}
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:    reqId,
+				Type:  "restart-db",
+				State: proto.STATE_SUSPENDED,
+				User:  "finch",
+			}, nil
+		},
+		GetResumePointsFunc: func(reqId string) (proto.JobChain, error) {
+			return jc, nil
+		},
+		SetResumePointsFunc: func(reqId string, rp proto.ResumePoints) (proto.JobChain, error) {
+			set = append(set, rp)
+			changed := jc
+			if len(rp.Jobs) > 0 {
+				changed.FinishedJobs = 2
+			}
+			return changed, nil
+		},
+	}
+	ctx := app.Context{
+		In:       bytes.NewBufferString("j2 complete\nj9 skip\nj3 run\n\nresume\n"),
+		Out:      output,
+		RMClient: rmc,
+		Command: config.Command{
+			Cmd:  "resume",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	resume := cmd.NewResume(ctx)
+	if err := resume.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := resume.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Held, then changed (which releases the hold)
+	expectSet := []proto.ResumePoints{
+		{Hold: "10m"},
+		{Jobs: map[string]string{"j2": proto.RESUME_COMPLETE}},
+	}
+	if diff := deep.Equal(set, expectSet); diff != nil {
+		t.Error(diff)
+	}
+
+	expectOutput := `Request b9uvdi8tk9kahl8ppvbg (restart-db) by finch: SUSPENDED (held 10m while you choose)
+
+JOB  NAME                     TYPE                     STATE
+j1   check-db                 mysql/check              COMPLETE
+j2   stop-mysql               mysql/stop               STOPPED
+j3   start-mysql              mysql/start              PENDING
+
+Enter a job ID and complete, skip, or pending (like 'abcd skip'), one per line, or nothing when done:
+> > # Invalid job ID: j9
+> # Invalid action: run
+> Resume points:
+  j2 (stop-mysql): STOPPED -> complete
+Enter 'resume' to resume, or anything else to abort: OK, resuming b9uvdi8tk9kahl8ppvbg (2 of 3 jobs complete)
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+
+	if got := resume.Cmd(); got != "resume b9uvdi8tk9kahl8ppvbg j2=complete" {
+		t.Errorf("got Cmd %q, expected 'resume b9uvdi8tk9kahl8ppvbg j2=complete'", got)
+	}
+
+	// Abort: hold released without changing jobs
+	set = []proto.ResumePoints{}
+	ctx.In = bytes.NewBufferString("j2 skip\n\nno\n")
+	resume = cmd.NewResume(ctx)
+	if err := resume.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := resume.Run(); err == nil {
+		t.Error("no error after abort, expected an error")
+	}
+	expectSet = []proto.ResumePoints{{Hold: "10m"}, {}}
+	if diff := deep.Equal(set, expectSet); diff != nil {
+		t.Error(diff)
+	}
+}
+
+func TestResumeArgs(t *testing.T) {
+	// Job args: not held, and confirmed unless --yes
+	for _, test := range []struct {
+		in     string
+		yes    bool
+		expect bool
+	}{
+		{"resume\n", false, true},
+		{"no\n", false, false},
+		{"", true, true},
+	} {
+		set := []proto.ResumePoints{}
+		jc := proto.JobChain{
+			RequestId: "b9uvdi8tk9kahl8ppvbg",
+			Jobs: map[string]proto.Job{
+				"j1": {Id: "j1", Name: "check-db", Type: "mysql/check", State: proto.STATE_COMPLETE},
+				"j2": {Id: "j2", Name: "stop-mysql", Type: "mysql/stop", State: proto.STATE_STOPPED},
+				"j3": {Id: "j3", Name: "start-mysql", Type: "mysql/start", State: proto.STATE_PENDING},
+			},
+			AdjacencyList: map[string][]string{
+				"j1": {"j2"},
+				"j2": {"j3"},
+			},
+			FinishedJobs: 1,
+		}
+		rmc := &mock.RMClient{
+			GetRequestFunc: func(reqId string) (proto.Request, error) {
+				return proto.Request{
+					Id:    reqId,
+					Type:  "restart-db",
+					State: proto.STATE_SUSPENDED,
+					User:  "finch",
+				}, nil
+			},
+			GetResumePointsFunc: func(reqId string) (proto.JobChain, error) {
+				return jc, nil
+			},
+			SetResumePointsFunc: func(reqId string, rp proto.ResumePoints) (proto.JobChain, error) {
+				set = append(set, rp)
+				changed := jc
+				if len(rp.Jobs) > 0 {
+					changed.FinishedJobs = 2
+				}
+				return changed, nil
+			},
+		}
+		ctx := app.Context{
+			In:       bytes.NewBufferString(test.in),
+			Out:      &bytes.Buffer{},
+			RMClient: rmc,
+			Options:  config.Options{Yes: test.yes},
+			Command: config.Command{
+				Cmd:  "resume",
+				Args: []string{"b9uvdi8tk9kahl8ppvbg", "j2=skip", "j3=pending"},
+			},
+		}
+		resume := cmd.NewResume(ctx)
+		if err := resume.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		err := resume.Run()
+		if test.expect && err != nil {
+			t.Errorf("input %q, yes %t: error %s, expected nil", test.in, test.yes, err)
+		}
+		if !test.expect && err == nil {
+			t.Errorf("input %q, yes %t: no error, expected an error", test.in, test.yes)
+		}
+		expectSet := []proto.ResumePoints{}
+		if test.expect {
+			expectSet = []proto.ResumePoints{{Jobs: map[string]string{"j2": proto.RESUME_SKIP, "j3": proto.RESUME_PENDING}}}
+		}
+		if diff := deep.Equal(set, expectSet); diff != nil {
+			t.Errorf("input %q, yes %t: %v", test.in, test.yes, diff)
+		}
+	}
+}
+
+func TestResumePrepareErrors(t *testing.T) {
+	for _, args := range [][]string{{}, {"b9uvdi8tk9kahl8ppvbg", "j2"}, {"b9uvdi8tk9kahl8ppvbg", "j2=run"}} {
+		ctx := app.Context{
+			Command: config.Command{Cmd: "resume", Args: args},
+		}
+		if err := cmd.NewResume(ctx).Prepare(); err == nil {
+			t.Errorf("no error for args %v, expected an error", args)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/prompt"
+)
+
+type Retry struct {
+	ctx app.Context
+	// --
+	reqId   string
+	args    map[string]interface{} // arg overrides
+	fromJob string                 // job name to start from (spinc start --from-job)
+}
+
+func NewRetry(ctx app.Context) *Retry {
+	return &Retry{
+		ctx: ctx,
+	}
+}
+
+func (c *Retry) Prepare() error {
+	cmd := c.ctx.Command
+	if len(cmd.Args) == 0 {
+		return fmt.Errorf("Usage: spinc retry <ID> [arg=value...]\n")
+	}
+	c.reqId = cmd.Args[0]
+
+	c.args = map[string]interface{}{}
+	for _, keyval := range cmd.Args[1:] {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (key=val)", keyval, len(p))
+		}
+		c.args[p[0]] = p[1]
+	}
+	return nil
+}
+
+func (c *Retry) Run() error {
+	// A Request Manager without the feature ignores fromJob and runs every job
+	// again, so it's required, not only a warning (CheckCompat)
+	if c.fromJob != "" {
+		sv, err := c.ctx.RMClient.ServerVersion()
+		if err != nil {
+			return err
+		}
+		if !sv.HasFeature(proto.FEATURE_RETRY_FROM_JOB) {
+			return fmt.Errorf("Request Manager %s does not have feature %s: cannot start from job %s. Upgrade the Request Manager.",
+				sv.Version, proto.FEATURE_RETRY_FROM_JOB, c.fromJob)
+		}
+	}
+
+	req, err := c.ctx.RMClient.GetRequest(c.reqId)
+	if err != nil {
+		return err
+	}
+
+	// Print the failed request and the arg overrides, then confirm unless --yes.
+	// With --quiet and --yes, there's nothing to confirm, so nothing is printed.
+	if !c.ctx.Options.Quiet || !c.ctx.Options.Yes {
+		c.preview(req)
+	}
+	if !c.ctx.Options.Yes {
+		ok := prompt.NewConfirmationPrompt("Enter 'ok' to retry, or anything else to abort: ", "ok", c.ctx.In, c.ctx.Out)
+		if err := ok.Prompt(); err != nil {
+			return fmt.Errorf("Not retried")
+		}
+	}
+
+	retryReq, err := c.ctx.RMClient.RetryRequest(c.reqId, proto.RetryRequest{Args: c.args, FromJob: c.fromJob})
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(retryReq, err)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if c.ctx.Options.Quiet {
+		fmt.Fprintln(c.ctx.Out, retryReq.Id)
+		return nil
+	}
+	if c.fromJob != "" {
+		fmt.Fprintf(c.ctx.Out, "OK, started %s request %s (from job %s of %s, %d jobs before it complete)\n\n"+
+			"  spinc status %s\n\n", retryReq.Type, retryReq.Id, c.fromJob, c.reqId, retryReq.FinishedJobs, retryReq.Id)
+		return nil
+	}
+	fmt.Fprintf(c.ctx.Out, "OK, started %s request %s (retry of %s)\n\n"+
+		"  spinc status %s\n\n", retryReq.Type, retryReq.Id, c.reqId, retryReq.Id)
+	return nil
+}
+
+func (c *Retry) Cmd() string {
+	cmd := "retry " + c.reqId
+	if c.fromJob != "" {
+		cmd = "start --from-request " + c.reqId + " --from-job " + QuoteArgValue(c.fromJob)
+	}
+	names := make([]string, 0, len(c.args))
+	for name := range c.args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		cmd += " " + name + "=" + QuoteArgValue(fmt.Sprintf("%v", c.args[name]))
+	}
+	return cmd
+}
+
+func (c *Retry) Help() string {
+	return `'spinc retry <request ID> [arg=value...]' retries a failed or stopped request:
+it starts a new request with the same args, except the args given, like a corrected
+hostname. Only required and optional args can be changed. The new request is linked
+to the failed request, and 'spinc info' shows the changed args. Use --yes to retry
+without confirmation.
+`
+}
+
+// preview prints the failed request and the arg overrides.
+func (c *Retry) preview(req proto.Request) {
+	fmt.Fprintf(c.ctx.Out, "Request %s (%s) by %s: %s\n", req.Id, req.Type, req.User, proto.StateName[req.State])
+	if c.fromJob != "" {
+		fmt.Fprintf(c.ctx.Out, "Start from job: %s (jobs before it do not run)\n", c.fromJob)
+	}
+	if len(c.args) > 0 {
+		old := map[string]interface{}{}
+		sensitive := map[string]bool{}
+		for _, arg := range req.Args {
+			old[arg.Name] = ArgValue(arg)
+			sensitive[arg.Name] = arg.Sensitive
+		}
+		names := make([]string, 0, len(c.args))
+		for name := range c.args {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(c.ctx.Out, "Arg overrides:\n")
+		for _, name := range names {
+			val := c.args[name]
+			if sensitive[name] {
+				val = REDACTED
+			}
+			fmt.Fprintf(c.ctx.Out, "  %s: %v -> %v\n", name, old[name], val)
+		}
+	} else {
+		fmt.Fprintf(c.ctx.Out, "Arg overrides: none (same args)\n")
+	}
+}
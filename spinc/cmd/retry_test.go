@@ -0,0 +1,236 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestRetry(t *testing.T) {
+	var gotRetry *proto.RetryRequest
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:    reqId,
+				Type:  "restart-db",
+				State: proto.STATE_FAIL,
+				User:  "finch",
+				Args: []proto.RequestArg{
+					{Name: "host", Type: proto.ARG_TYPE_REQUIRED, Value: "db1.local"},
+					{Name: "port", Type: proto.ARG_TYPE_OPTIONAL, Value: "3306"},
+				},
+			}, nil
+		},
+		RetryRequestFunc: func(reqId string, retry proto.RetryRequest) (proto.Request, error) {
+			gotRetry = &retry
+			return proto.Request{Id: "c9uvdi8tk9kahl8ppvbg", Type: "restart-db", RetryOf: reqId}, nil
+		},
+	}
+	output := &bytes.Buffer{}
+	ctx := app.Context{
+		In:       &bytes.Buffer{},
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{Yes: true},
+		Command: config.Command{
+			Cmd:  "retry",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg", "host=db2.local"},
+		},
+	}
+	retry := cmd.NewRetry(ctx)
+	if err := retry.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := retry.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotRetry == nil {
+		t.Fatal("request not retried")
+	}
+	if len(gotRetry.Args) != 1 || gotRetry.Args["host"] != "db2.local" {
+		t.Errorf("got retry args %v, expected map[host:db2.local]", gotRetry.Args)
+	}
+
+	expectOutput := `Request b9uvdi8tk9kahl8ppvbg (restart-db) by finch: FAIL
+Arg overrides:
+  host: db1.local -> db2.local
+OK, started restart-db request c9uvdi8tk9kahl8ppvbg (retry of b9uvdi8tk9kahl8ppvbg)
+
+  spinc status c9uvdi8tk9kahl8ppvbg
+
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+
+	if got := retry.Cmd(); got != "retry b9uvdi8tk9kahl8ppvbg host=db2.local" {
+		t.Errorf("got Cmd %q, expected 'retry b9uvdi8tk9kahl8ppvbg host=db2.local'", got)
+	}
+}
+
+func TestRetryConfirm(t *testing.T) {
+	// Retried only if user enters "ok" or --yes is specified
+	for _, test := range []struct {
+		in     string
+		yes    bool
+		expect bool
+	}{
+		{"ok\n", false, true},
+		{"no\n", false, false},
+		{"", true, true},
+	} {
+		var gotRetry *proto.RetryRequest
+		rmc := &mock.RMClient{
+			GetRequestFunc: func(reqId string) (proto.Request, error) {
+				return proto.Request{
+					Id:    reqId,
+					Type:  "restart-db",
+					State: proto.STATE_FAIL,
+					User:  "finch",
+					Args: []proto.RequestArg{
+						{Name: "host", Type: proto.ARG_TYPE_REQUIRED, Value: "db1.local"},
+						{Name: "port", Type: proto.ARG_TYPE_OPTIONAL, Value: "3306"},
+					},
+				}, nil
+			},
+			RetryRequestFunc: func(reqId string, retry proto.RetryRequest) (proto.Request, error) {
+				gotRetry = &retry
+				return proto.Request{Id: "c9uvdi8tk9kahl8ppvbg", Type: "restart-db", RetryOf: reqId}, nil
+			},
+		}
+		ctx := app.Context{
+			In:       bytes.NewBufferString(test.in),
+			Out:      &bytes.Buffer{},
+			RMClient: rmc,
+			Options:  config.Options{Yes: test.yes},
+			Command: config.Command{
+				Cmd:  "retry",
+				Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+			},
+		}
+		retry := cmd.NewRetry(ctx)
+		if err := retry.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		err := retry.Run()
+		if test.expect && err != nil {
+			t.Errorf("input %q, yes %t: error %s, expected nil", test.in, test.yes, err)
+		}
+		if !test.expect && err == nil {
+			t.Errorf("input %q, yes %t: no error, expected an error", test.in, test.yes)
+		}
+		if retried := gotRetry != nil; retried != test.expect {
+			t.Errorf("input %q, yes %t: retried = %t, expected %t", test.in, test.yes, retried, test.expect)
+		}
+	}
+}
+
+func TestRetryPrepareErrors(t *testing.T) {
+	for _, args := range [][]string{{}, {"b9uvdi8tk9kahl8ppvbg", "host"}} {
+		ctx := app.Context{
+			Command: config.Command{Cmd: "retry", Args: args},
+		}
+		if err := cmd.NewRetry(ctx).Prepare(); err == nil {
+			t.Errorf("no error for args %v, expected an error", args)
+		}
+	}
+}
+
+// spinc start --from-request --from-job is a retry from the job
+func TestStartFromJob(t *testing.T) {
+	var gotRetry *proto.RetryRequest
+	rmc := &mock.RMClient{
+		ServerVersionFunc: func() (proto.ServerVersion, error) {
+			return proto.ServerVersion{Version: "2.0.0", Features: []string{proto.FEATURE_RETRY_FROM_JOB}}, nil
+		},
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:    reqId,
+				Type:  "restart-db",
+				State: proto.STATE_FAIL,
+				User:  "finch",
+				Args: []proto.RequestArg{
+					{Name: "host", Type: proto.ARG_TYPE_REQUIRED, Value: "db1.local"},
+					{Name: "port", Type: proto.ARG_TYPE_OPTIONAL, Value: "3306"},
+				},
+			}, nil
+		},
+		RetryRequestFunc: func(reqId string, retry proto.RetryRequest) (proto.Request, error) {
+			gotRetry = &retry
+			return proto.Request{Id: "c9uvdi8tk9kahl8ppvbg", Type: "restart-db", RetryOf: reqId, FinishedJobs: 3}, nil
+		},
+	}
+	output := &bytes.Buffer{}
+	ctx := app.Context{
+		In:       &bytes.Buffer{},
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{Yes: true, FromRequest: "b9uvdi8tk9kahl8ppvbg", FromJob: "start-mysqld"},
+		Command: config.Command{
+			Cmd:  "start",
+			Args: []string{"port=3307"},
+		},
+	}
+	start := cmd.NewStart(ctx)
+	if err := start.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := start.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotRetry == nil {
+		t.Fatal("request not retried")
+	}
+	if gotRetry.FromJob != "start-mysqld" || len(gotRetry.Args) != 1 || gotRetry.Args["port"] != "3307" {
+		t.Errorf("got retry request %+v, expected FromJob start-mysqld and args map[port:3307]", gotRetry)
+	}
+
+	expectOutput := `Request b9uvdi8tk9kahl8ppvbg (restart-db) by finch: FAIL
+Start from job: start-mysqld (jobs before it do not run)
+Arg overrides:
+  port: 3306 -> 3307
+OK, started restart-db request c9uvdi8tk9kahl8ppvbg (from job start-mysqld of b9uvdi8tk9kahl8ppvbg, 3 jobs before it complete)
+
+  spinc status c9uvdi8tk9kahl8ppvbg
+
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+	if got := start.Cmd(); got != "start --from-request b9uvdi8tk9kahl8ppvbg --from-job start-mysqld port=3307" {
+		t.Errorf("got Cmd %q", got)
+	}
+
+	// Both options are required
+	ctx.Options.FromJob = ""
+	if err := cmd.NewStart(ctx).Prepare(); err == nil {
+		t.Error("no error without --from-job, expected an error")
+	}
+
+	// An old RM ignores FromJob and runs every job, so it's not retried
+	gotRetry = nil
+	ctx.Options.FromJob = "start-mysqld"
+	rmc.ServerVersionFunc = func() (proto.ServerVersion, error) {
+		return proto.ServerVersion{Version: "2.0.0", Features: []string{proto.FEATURE_REQUEST_RETRY}}, nil
+	}
+	start = cmd.NewStart(ctx)
+	if err := start.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := start.Run(); err == nil {
+		t.Error("no error for Request Manager without feature, expected an error")
+	}
+	if gotRetry != nil {
+		t.Error("request retried by Request Manager without feature")
+	}
+}
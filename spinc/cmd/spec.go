@@ -0,0 +1,175 @@
+// Copyright 2020, Square, Inc.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/square/spincycle/v2/spinc/app"
+)
+
+// specNameRe matches valid names for new sequences. Names are also file names,
+// so they're restricted to characters that are safe in both.
+var specNameRe = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// specTemplate is the skeleton of a new request spec. It must parse and pass the
+// linter as is (see TestSpecNewLints), so new spec authors start from a valid spec
+// and change the placeholders.
+var specTemplate = template.Must(template.New("spec").Parse(`---
+sequences:
+  {{.Name}}:
+    # A request can be started by callers. Set to false for a sequence that's
+    # only used by other sequences (category: sequence nodes).
+    request: {{.Request}}
+    description: "TODO: what {{.Name}} does"
+    args:
+      # Callers must give required args. Optional args have a default. Static
+      # args are constants that callers cannot set.
+      required:
+        - name: example_arg
+          desc: "TODO: describe example_arg"
+      optional:
+        - name: example_opt
+          desc: "TODO: describe example_opt"
+          default: "none"
+      static: []
+{{- if .Request}}
+    # Caller roles allowed to run the request. Without an acl, any caller can.
+    acl:
+      - role: TODO-role
+        admin: false
+        ops: ["start", "stop"]
+{{- end}}
+    nodes:
+      first-job:
+        category: job
+        type: TODO/first-job-type
+        description: "TODO: what first-job does"
+        args:
+          - expected: example_arg
+            given: example_arg
+          - expected: example_opt
+            given: example_opt
+        # Job args that the job sets for later nodes
+        sets:
+          - arg: example_result
+        deps: []
+        # Times to retry the job if it fails, and how long to wait between tries.
+        # Remove both to not retry.
+        retry: 2
+        retryWait: 10s
+      second-job:
+        category: job
+        type: TODO/second-job-type
+        description: "TODO: what second-job does"
+        args:
+          - expected: example_result
+            given: example_result
+        sets: []
+        deps: [first-job]
+`))
+
+// Spec scaffolds request specs. It does not use the Request Manager.
+type Spec struct {
+	ctx app.Context
+	// --
+	name    string
+	dir     string // write <dir>/<name>.yaml instead of printing
+	request bool
+}
+
+func NewSpec(ctx app.Context) *Spec {
+	return &Spec{
+		ctx:     ctx,
+		request: true,
+	}
+}
+
+func (c *Spec) Prepare() error {
+	args := c.ctx.Command.Args
+	if len(args) < 2 || args[0] != "new" {
+		return fmt.Errorf("Usage: spinc spec new <sequence name> [dir=<specs dir>] [request=false]\n")
+	}
+	c.name = args[1]
+	if !specNameRe.MatchString(c.name) {
+		return fmt.Errorf("Invalid sequence name: %s: must start with a letter or number and have only letters, numbers, -, _, and .", c.name)
+	}
+
+	for _, keyval := range args[2:] {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (key=val)", keyval, len(p))
+		}
+		switch p[0] {
+		case "dir":
+			c.dir = p[1]
+		case "request":
+			switch p[1] {
+			case "true":
+				c.request = true
+			case "false":
+				c.request = false
+			default:
+				return fmt.Errorf("Invalid request: %s: must be true or false", p[1])
+			}
+		default:
+			return fmt.Errorf("Invalid command arg: %s: unknown arg %s", keyval, p[0])
+		}
+	}
+	return nil
+}
+
+func (c *Spec) Run() error {
+	var buf bytes.Buffer
+	err := specTemplate.Execute(&buf, struct {
+		Name    string
+		Request bool
+	}{c.name, c.request})
+	if err != nil {
+		return err
+	}
+
+	if c.dir == "" {
+		_, err := c.ctx.Out.Write(buf.Bytes())
+		return err
+	}
+
+	// Never overwrite a spec file
+	file := filepath.Join(c.dir, c.name+".yaml")
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("%s already exists", file)
+		}
+		return err
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if !c.ctx.Options.Quiet {
+		fmt.Fprintf(c.ctx.Out, "Wrote %s. Replace the TODO placeholders, then run spinc-linter.\n", file)
+	}
+	return nil
+}
+
+func (c *Spec) Cmd() string {
+	return "spec new " + c.name
+}
+
+func (c *Spec) Help() string {
+	return "'spinc spec new <sequence name> [dir=<specs dir>] [request=false]' prints a new request spec\n" +
+		"with placeholder args, nodes, acl, and retry to start from. It passes spinc-linter as is;\n" +
+		"replace the TODO placeholders. With dir=, it writes <specs dir>/<sequence name>.yaml instead\n" +
+		"(never overwriting a file). With request=false, the sequence is not a request and has no acl.\n" +
+		"A Request Manager is not used.\n"
+}
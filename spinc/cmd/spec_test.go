@@ -0,0 +1,129 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/square/spincycle/v2/request-manager/graph"
+	"github.com/square/spincycle/v2/request-manager/id"
+	"github.com/square/spincycle/v2/request-manager/spec"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+)
+
+func runSpecNew(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	output := &bytes.Buffer{}
+	ctx := app.Context{
+		Out: output,
+		Command: config.Command{
+			Cmd:  "spec",
+			Args: append([]string{"new"}, args...),
+		},
+	}
+	c := cmd.NewSpec(ctx)
+	if err := c.Prepare(); err != nil {
+		return "", err
+	}
+	err := c.Run()
+	return output.String(), err
+}
+
+// The new spec must pass the linter as is: no parse, static check, or graph
+// check errors or warnings.
+func TestSpecNewLints(t *testing.T) {
+	for _, request := range []string{"true", "false"} {
+		specsDir, err := ioutil.TempDir("", "spinc-spec")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(specsDir)
+
+		if _, err := runSpecNew(t, "decom-cluster", "dir="+specsDir, "request="+request); err != nil {
+			t.Fatal(err)
+		}
+
+		specs, fileResults, err := spec.ParseSpecsDir(specsDir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkNoResults(t, "parse", fileResults)
+		spec.ProcessSpecs(&specs)
+		seq, ok := specs.Sequences["decom-cluster"]
+		if !ok {
+			t.Fatalf("no sequence decom-cluster in new spec, got %v", specs.Sequences)
+		}
+		if seq.Request != (request == "true") || (len(seq.ACL) > 0) != seq.Request {
+			t.Errorf("request = %t, acl = %v, expected request %s with acl only if request", seq.Request, seq.ACL, request)
+		}
+
+		checker, err := spec.NewChecker([]spec.CheckFactory{spec.DefaultCheckFactory{AllSpecs: specs}, spec.BaseCheckFactory{AllSpecs: specs}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkNoResults(t, "static", checker.RunChecks(specs))
+		_, graphResults := graph.NewGrapher(specs, id.NewGeneratorFactory(4, 100)).CheckSequences()
+		checkNoResults(t, "graph", graphResults)
+	}
+}
+
+func checkNoResults(t *testing.T, checks string, results *spec.CheckResults) {
+	t.Helper()
+	for key, result := range results.Results {
+		for _, err := range result.Errors {
+			t.Errorf("%s check error: %s: %s", checks, key, err)
+		}
+		for _, warn := range result.Warnings {
+			t.Errorf("%s check warning: %s: %s", checks, key, warn)
+		}
+	}
+}
+
+func TestSpecNew(t *testing.T) {
+	// Without dir=, the spec is printed
+	out, err := runSpecNew(t, "decom-cluster")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(out, "---\nsequences:\n  decom-cluster:\n    ") {
+		t.Errorf("output does not start with the sequence:\n%s", out)
+	}
+
+	// A spec file is never overwritten
+	specsDir, err := ioutil.TempDir("", "spinc-spec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(specsDir)
+	file := filepath.Join(specsDir, "decom-cluster.yaml")
+	if err := ioutil.WriteFile(file, []byte("keep"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := runSpecNew(t, "decom-cluster", "dir="+specsDir); err == nil {
+		t.Error("got nil error, expected error for existing file")
+	}
+	if b, _ := ioutil.ReadFile(file); string(b) != "keep" {
+		t.Errorf("existing file changed: %s", b)
+	}
+
+	// Invalid usage
+	for _, args := range [][]string{
+		{},
+		{"bad name"},
+		{"../decom"},
+		{"decom-cluster", "request=maybe"},
+		{"decom-cluster", "foo=bar"},
+		{"decom-cluster", "dir"},
+	} {
+		if _, err := runSpecNew(t, args...); err == nil {
+			t.Errorf("got nil error for args %v, expected an error", args)
+		}
+	}
+}
@@ -20,6 +20,9 @@ type Start struct {
 	debug        bool
 	args         map[string]interface{}
 	fullCmd      string
+	deprecated   string // deprecation message, if request is deprecated
+	sunset       string // date from which new requests are rejected, if any
+	from         *Retry // --from-request and --from-job: retry from the job
 }
 
 func NewStart(ctx app.Context) *Start {
@@ -32,6 +35,10 @@ func NewStart(ctx app.Context) *Start {
 func (c *Start) Prepare() error {
 	cmd := c.ctx.Command
 
+	if c.ctx.Options.FromRequest != "" || c.ctx.Options.FromJob != "" {
+		return c.prepareFrom()
+	}
+
 	if len(cmd.Args) == 0 {
 		return fmt.Errorf("Usage: spinc start <request> [args]\n'spinc' for request list")
 	}
@@ -56,6 +63,8 @@ func (c *Start) Prepare() error {
 	if req == nil {
 		return app.ErrUnknownRequest
 	}
+	c.deprecated = req.Deprecated
+	c.sunset = req.Sunset
 
 	// Split and save request args given on cmd line
 	given := map[string]string{}
@@ -152,6 +161,10 @@ func (c *Start) Prepare() error {
 }
 
 func (c *Start) Run() error {
+	if c.from != nil {
+		return c.from.Run()
+	}
+
 	// Prompt user for missing required args and possibly optional args
 	p := prompt.NewGuidedPrompt(c.requiredArgs, c.ctx.In, c.ctx.Out)
 	p.Prompt()
@@ -171,6 +184,15 @@ func (c *Start) Run() error {
 	}
 	fmt.Printf("\n# spinc %s\n\n", c.fullCmd)
 
+	// Print deprecation last, right before confirming, so the user sees it
+	if c.deprecated != "" {
+		fmt.Printf("*** DEPRECATED: %s request is deprecated: %s\n", c.reqName, c.deprecated)
+		if c.sunset != "" {
+			fmt.Printf("*** New %s requests will be rejected from %s\n", c.reqName, c.sunset)
+		}
+		fmt.Println()
+	}
+
 	// Prompt for 'ok' until user enters it or aborts
 	ok := prompt.NewConfirmationPrompt("Enter 'ok' to start, or ctrl-c to abort: ", "ok", c.ctx.In, c.ctx.Out)
 	for {
@@ -186,14 +208,31 @@ func (c *Start) Run() error {
 	if err != nil {
 		return err
 	}
+	if c.ctx.Options.Quiet {
+		fmt.Println(reqId)
+		return nil
+	}
 
 	fmt.Printf("OK, started %s request %s\n\n"+
 		"  spinc status %s\n\n", c.reqName, reqId, reqId)
 
+	// Print non-fatal warnings from building the job chain. This is best
+	// effort: the request was started even if getting it fails.
+	if req, err := c.ctx.RMClient.GetRequest(reqId); err == nil && len(req.Warnings) > 0 {
+		fmt.Printf("Warnings:\n")
+		for _, w := range req.Warnings {
+			fmt.Printf("  %s\n", w)
+		}
+		fmt.Println()
+	}
+
 	return nil
 }
 
 func (c *Start) Cmd() string {
+	if c.from != nil {
+		return c.from.Cmd()
+	}
 	if c.fullCmd != "" {
 		return c.fullCmd
 	}
@@ -218,5 +257,35 @@ func (c *Start) Cmd() string {
 
 func (c *Start) Help() string {
 	return "'spinc start <request> [args]' starts a new request.\n" +
-		"Request args can be provided, else spinc prompts for them. Run 'spinc help <request>' to list the request args.\n"
+		"Request args can be provided, else spinc prompts for them. Run 'spinc help <request>' to list the request args.\n\n" +
+		"'spinc start --from-request <ID> --from-job <job> [arg=value...]' starts a new request with the same\n" +
+		"type and args as the failed or stopped request, except the args given, like 'spinc retry'. Jobs before\n" +
+		"the job (by name) are complete and do not run, so the request starts from it. Jobs that the request spec\n" +
+		"does not order before the job, like jobs in parallel with it, run as usual. Use --yes to start without\n" +
+		"confirmation.\n"
+}
+
+// prepareFrom prepares to start a new request from a job of a previous request,
+// which is a retry of that request from the job.
+func (c *Start) prepareFrom() error {
+	opts := c.ctx.Options
+	if opts.FromRequest == "" || opts.FromJob == "" {
+		return fmt.Errorf("Usage: spinc start --from-request <ID> --from-job <job> [arg=value...]\n")
+	}
+	args := map[string]interface{}{}
+	for _, keyval := range c.ctx.Command.Args {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (key=val). "+
+				"The request type is the type of request %s.", keyval, len(p), opts.FromRequest)
+		}
+		args[p[0]] = p[1]
+	}
+	c.from = &Retry{
+		ctx:     c.ctx,
+		reqId:   opts.FromRequest,
+		args:    args,
+		fromJob: opts.FromJob,
+	}
+	return nil
 }
@@ -61,17 +61,58 @@ func (c *Status) Run() error {
 		if arg.Type != "required" {
 			continue
 		}
-		val := fmt.Sprintf("%s", arg.Value)
-		args = append(args, fmt.Sprintf("%s=%s", arg.Name, QuoteArgValue(val)))
+		args = append(args, fmt.Sprintf("%s=%s", arg.Name, QuoteArgValue(ArgValue(arg))))
 	}
 
-	fmt.Fprintf(c.ctx.Out, "   state: %s\n", proto.StateName[r.State])
+	// For failed requests, the headline is the root cause: the first job that
+	// failed and how many jobs did not run because of it
+	if r.State == proto.STATE_FAIL {
+		f, err := c.ctx.RMClient.RequestFailure(r.Id)
+		if err != nil {
+			if c.ctx.Options.Debug {
+				app.Debug("error getting request failure: %s", err)
+			}
+		} else if f.FailedJob != nil {
+			fmt.Fprintf(c.ctx.Out, "  failed: %s (try %d): %s\n", f.FailedJob.Name, f.FailedJob.Try, failureError(*f.FailedJob))
+			fmt.Fprintf(c.ctx.Out, " skipped: %d jobs\n", len(f.SkippedJobs))
+		}
+	}
+
+	fmt.Fprintf(c.ctx.Out, "   state: %s\n", StateName(c.ctx, r.State))
 	fmt.Fprintf(c.ctx.Out, "progress: %s\n", fmt.Sprintf("%.0f%%", float64(r.FinishedJobs)/float64(r.TotalJobs)*100))
 	fmt.Fprintf(c.ctx.Out, " runtime: %s\n", runtime)
 	fmt.Fprintf(c.ctx.Out, " request: %s\n", r.Type)
 	fmt.Fprintf(c.ctx.Out, "  caller: %s\n", r.User)
-	fmt.Fprintf(c.ctx.Out, "    args: %s\n", strings.Join(args, " "))
+	if !c.ctx.Options.Verbose {
+		fmt.Fprintf(c.ctx.Out, "    args: %s\n", strings.Join(args, " "))
+		return nil
+	}
+
+	// With --verbose, print all args in the order they're given to us, one per
+	// line, with where the value came from (required, optional, static, or
+	// default) and its type. Sensitive values are redacted.
+	if len(r.Args) == 0 {
+		fmt.Fprintf(c.ctx.Out, "    args: none\n")
+		return nil
+	}
+	nameColLen := len("ARG")
+	for _, arg := range r.Args {
+		if len(arg.Name) > nameColLen {
+			nameColLen = len(arg.Name)
+		}
+	}
 
+	/*
+	   ARG   SOURCE   TYPE   VALUE
+	   host  required string db1.local
+	   pass  required string ********
+	*/
+	line := fmt.Sprintf("%%-%ds %%-8s %%-6s %%s\n", nameColLen)
+	fmt.Fprintf(c.ctx.Out, "\n")
+	fmt.Fprintf(c.ctx.Out, line, "ARG", "SOURCE", "TYPE", "VALUE")
+	for _, arg := range r.Args {
+		fmt.Fprintf(c.ctx.Out, line, arg.Name, ArgSource(arg), ArgValueType(arg.Value), QuoteArgValue(ArgValue(arg)))
+	}
 	return nil
 }
 
@@ -81,5 +122,16 @@ func (c *Status) Cmd() string {
 
 func (c *Status) Help() string {
 	return "'spinc status <request ID>' prints request status and basic information.\n" +
+		"Only required args are printed. With --verbose, all args are printed in a table\n" +
+		"with their source (required, optional, static, or default) and type.\n" +
+		"Values of sensitive args are not printed.\n" +
 		"For complete request information, use 'spinc info <request ID>'.\n"
 }
+
+// failureError returns the job error with its category and code, if any.
+func failureError(jl proto.JobLog) string {
+	if jl.ErrorCode == "" {
+		return jl.Error
+	}
+	return fmt.Sprintf("%s [%s/%s]", jl.Error, jl.ErrorCategory, jl.ErrorCode)
+}
@@ -199,3 +199,188 @@ progress: 11%
 		t.Error("wrong output, see above")
 	}
 }
+
+func TestStatusVerbose(t *testing.T) {
+	var args []proto.RequestArg = []proto.RequestArg{
+		{
+			Name:  "host",
+			Type:  proto.ARG_TYPE_REQUIRED,
+			Value: "db1.local",
+			Given: true,
+		},
+		{
+			Name:      "password",
+			Type:      proto.ARG_TYPE_REQUIRED,
+			Value:     "hunter2",
+			Given:     true,
+			Sensitive: true,
+		},
+		{
+			Name:  "retries",
+			Type:  proto.ARG_TYPE_OPTIONAL,
+			Value: float64(3),
+			Given: true,
+		},
+		{
+			Name:    "reason",
+			Type:    proto.ARG_TYPE_OPTIONAL,
+			Default: "no reason",
+			Value:   "no reason",
+		},
+		{
+			Name:  "slackChan",
+			Type:  proto.ARG_TYPE_STATIC,
+			Value: "#dba",
+		},
+	}
+	output := &bytes.Buffer{}
+	startedAt := time.Now().Add(-5 * time.Second)
+	request := proto.Request{
+		Id:           "b9uvdi8tk9kahl8ppvbg",
+		Type:         "requestname",
+		State:        proto.STATE_RUNNING,
+		User:         "owner",
+		Args:         args,
+		TotalJobs:    9,
+		FinishedJobs: 1,
+		CreatedAt:    startedAt,
+		StartedAt:    &startedAt,
+	}
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(id string) (proto.Request, error) {
+			return request, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "status",
+			Args: []string{request.Id},
+		},
+	}
+
+	// Without --verbose, only required args but sensitive values are redacted
+	status := cmd.NewStatus(ctx)
+	if err := status.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := status.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput := `   state: RUNNING
+progress: 11%
+ runtime: 5s
+ request: requestname
+  caller: owner
+    args: host=db1.local password=********
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+
+	// With --verbose, all args in a table
+	output.Reset()
+	ctx.Options.Verbose = true
+	status = cmd.NewStatus(ctx)
+	if err := status.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := status.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput = `   state: RUNNING
+progress: 11%
+ runtime: 5s
+ request: requestname
+  caller: owner
+
+ARG       SOURCE   TYPE   VALUE
+host      required string db1.local
+password  required string ********
+retries   optional number 3
+reason    default  string "no reason"
+slackChan static   string #dba
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestStatusFailed(t *testing.T) {
+	output := &bytes.Buffer{}
+	createdAt := time.Now().Add(-10 * time.Second)
+	startedAt := time.Now().Add(-10 * time.Second)
+	finishedAt := time.Now().Add(-5 * time.Second)
+	request := proto.Request{
+		Id:           "b9uvdi8tk9kahl8ppvbg",
+		Type:         "requestname",
+		State:        proto.STATE_FAIL,
+		User:         "owner",
+		Args:         args,
+		TotalJobs:    9,
+		FinishedJobs: 3,
+		CreatedAt:    createdAt,
+		StartedAt:    &startedAt,
+		FinishedAt:   &finishedAt,
+	}
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(id string) (proto.Request, error) {
+			return request, nil
+		},
+		RequestFailureFunc: func(id string) (proto.RequestFailure, error) {
+			return proto.RequestFailure{
+				RequestId: id,
+				State:     proto.STATE_FAIL,
+				FailedJob: &proto.JobLog{
+					JobId:         "j3",
+					Name:          "stop-host",
+					Try:           2,
+					State:         proto.STATE_FAIL,
+					Error:         "host unreachable",
+					ErrorCategory: "network",
+					ErrorCode:     "ETIMEDOUT",
+				},
+				FailedTries: 2,
+				SkippedJobs: []proto.Job{{Id: "j4"}, {Id: "j5"}},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{},
+		Command: config.Command{
+			Cmd:  "status",
+			Args: []string{request.Id},
+		},
+	}
+	status := cmd.NewStatus(ctx)
+
+	err := status.Prepare()
+	if err != nil {
+		t.Error(err)
+	}
+
+	err = status.Run()
+	if err != nil {
+		t.Error(err)
+	}
+
+	expectOutput := `  failed: stop-host (try 2): host unreachable [network/ETIMEDOUT]
+ skipped: 2 jobs
+   state: FAIL
+progress: 33%
+ runtime: 5s
+ request: requestname
+  caller: owner
+    args: key=value key2=val2
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
@@ -4,13 +4,20 @@ package cmd
 
 import (
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
+	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/prompt"
 )
 
 type Stop struct {
-	ctx   app.Context
-	reqId string
+	ctx     app.Context
+	reqId   string
+	timeout time.Duration
+	mine    bool // --mine: stop all of the caller's pending and running requests
 }
 
 func NewStop(ctx app.Context) *Stop {
@@ -20,25 +27,236 @@ func NewStop(ctx app.Context) *Stop {
 }
 
 func (c *Stop) Prepare() error {
-	if len(c.ctx.Command.Args) == 0 {
-		return fmt.Errorf("Usage: spinc stop <id>\n")
+	args := c.ctx.Command.Args
+	c.mine = c.ctx.Options.Mine
+	if c.mine {
+		if len(args) > 0 && !strings.Contains(args[0], "=") {
+			return fmt.Errorf("Usage: spinc stop --mine [timeout=<duration>] (no request ID with --mine)\n")
+		}
+	} else {
+		if len(args) == 0 {
+			return fmt.Errorf("Usage: spinc stop <id> [timeout=<duration>]\n       spinc stop --mine [timeout=<duration>]\n")
+		}
+		c.reqId = args[0]
+		args = args[1:]
+	}
+
+	for _, keyval := range args {
+		p := strings.SplitN(keyval, "=", 2)
+		if len(p) != 2 {
+			return fmt.Errorf("Invalid command arg: %s: split on = produced %d values, expected 2 (key=val)", keyval, len(p))
+		}
+		if p[0] != "timeout" {
+			return fmt.Errorf("Invalid command arg: %s: unknown arg %s, expected timeout", keyval, p[0])
+		}
+		d, err := time.ParseDuration(p[1])
+		if err != nil || d <= 0 {
+			return fmt.Errorf("Invalid timeout: %s: must be a duration greater than zero, like 5m", p[1])
+		}
+		c.timeout = d
 	}
-	c.reqId = c.ctx.Command.Args[0]
 	return nil
 }
 
 func (c *Stop) Run() error {
-	if err := c.ctx.RMClient.StopRequest(c.reqId); err != nil {
+	if c.mine {
+		return c.stopMine()
+	}
+
+	req, err := c.ctx.RMClient.GetRequest(c.reqId)
+	if err != nil {
 		return err
 	}
-	fmt.Fprintf(c.ctx.Out, "OK, stopped %s\n", c.reqId)
+
+	// Print what stopping the request affects, then confirm if it's big. Only
+	// pending and running requests can be stopped; the RM returns an error for
+	// others. With --quiet, it's printed only if confirmation is required.
+	if req.State == proto.STATE_PENDING || req.State == proto.STATE_RUNNING {
+		confirm := !c.ctx.Options.Yes && req.TotalJobs > c.ctx.Options.StopConfirm
+		if !c.ctx.Options.Quiet || confirm {
+			c.preview(req)
+		}
+		if confirm {
+			fmt.Fprintf(c.ctx.Out, "\nRequest has more than %d jobs (use --yes to skip confirmation)\n", c.ctx.Options.StopConfirm)
+			ok := prompt.NewConfirmationPrompt("Enter 'stop' to stop, or anything else to abort: ", "stop", c.ctx.In, c.ctx.Out)
+			if err := ok.Prompt(); err != nil {
+				return fmt.Errorf("Not stopped")
+			}
+		}
+	}
+
+	if err := c.ctx.RMClient.StopRequest(c.reqId, c.timeout); err != nil {
+		return err
+	}
+	if !c.ctx.Options.Quiet {
+		fmt.Fprintf(c.ctx.Out, "OK, stopped %s\n", c.reqId)
+	}
 	return nil
 }
 
 func (c *Stop) Cmd() string {
+	if c.mine {
+		return "stop --mine"
+	}
 	return "stop " + c.reqId
 }
 
 func (c *Stop) Help() string {
-	return "'spinc stop <request ID>' stops the request immediately.\n"
+	return "'spinc stop <request ID> [timeout=<duration>]' stops the request immediately.\n" +
+		"Before stopping, it prints the request progress, running jobs, and jobs that will not run,\n" +
+		"including run-after-fail (cleanup) jobs. Stopping a request with more jobs than --stop-confirm\n" +
+		fmt.Sprintf("(default: %d) requires confirmation unless --yes is specified.\n", c.ctx.Options.StopConfirm) +
+		"timeout overrides how long the Job Runner waits for running jobs to stop, like timeout=5m.\n" +
+		"--timeout must be longer, because spinc waits for the jobs to stop.\n\n" +
+		"'spinc stop --mine [timeout=<duration>]' stops all pending and running requests created by you\n" +
+		"(your username on the Request Manager). It lists them first, then requires confirmation unless --yes\n" +
+		"is specified. To only list them, abort at the confirmation.\n"
+}
+
+// stopMine stops all pending and running requests created by the caller, after
+// listing them and confirming. Partition requests are not listed or stopped on
+// their own: stopping their request stops them.
+func (c *Stop) stopMine() error {
+	// A Request Manager without the feature ignores mine=true and returns
+	// everyone's requests, so it's required, not only a warning (CheckCompat)
+	sv, err := c.ctx.RMClient.ServerVersion()
+	if err != nil {
+		return err
+	}
+	if !sv.HasFeature(proto.FEATURE_REQUESTS_MINE) {
+		return fmt.Errorf("Request Manager %s does not have feature %s: cannot find only your requests. Upgrade the Request Manager.",
+			sv.Version, proto.FEATURE_REQUESTS_MINE)
+	}
+
+	found, err := c.ctx.RMClient.FindRequests(proto.RequestFilter{
+		Mine:   true,
+		States: []byte{proto.STATE_PENDING, proto.STATE_RUNNING},
+	})
+	if err != nil {
+		return err
+	}
+	if c.ctx.Options.Debug {
+		app.Debug("requests: %#v", found)
+	}
+	requests := make([]proto.Request, 0, len(found))
+	for _, req := range found {
+		if req.PartitionOf == "" {
+			requests = append(requests, req)
+		}
+	}
+	if len(requests) == 0 {
+		if !c.ctx.Options.Quiet {
+			fmt.Fprintf(c.ctx.Out, "You have no pending or running requests\n")
+		}
+		return nil
+	}
+
+	// List the requests (dry run), then always confirm because it can stop
+	// many requests, like 'spinc group stop'
+	if !c.ctx.Options.Quiet || !c.ctx.Options.Yes {
+		/*
+		   ID                   REQUEST                                  STATE     JOBS    CREATED
+		   -------------------- 1234567890123456789012345678901234567890 123456789 ******* *
+		*/
+		fmt.Fprintf(c.ctx.Out, "Your pending and running requests (user %s): %d\n\n", requests[0].User, len(requests))
+		line := fmt.Sprintf("%%-%ds %%-%ds %%-%ds %%-7s %%s\n", findIdColLen, findReqColLen, findStateColLen)
+		fmt.Fprintf(c.ctx.Out, line, "ID", "REQUEST", "STATE", "JOBS", "CREATED")
+		for _, req := range requests {
+			fmt.Fprintf(c.ctx.Out, line,
+				SqueezeString(req.Id, findIdColLen, ".."),
+				SqueezeString(req.Type, findReqColLen, ".."),
+				SqueezeString(proto.StateName[req.State], findStateColLen, ".."),
+				fmt.Sprintf("%d/%d", req.FinishedJobs, req.TotalJobs),
+				req.CreatedAt.UTC().Format(findTimeFmtStr))
+		}
+	}
+	if !c.ctx.Options.Yes {
+		fmt.Fprintf(c.ctx.Out, "\nStop all %d requests? (use --yes to skip confirmation)\n", len(requests))
+		ok := prompt.NewConfirmationPrompt("Enter 'stop' to stop, or anything else to abort: ", "stop", c.ctx.In, c.ctx.Out)
+		if err := ok.Prompt(); err != nil {
+			return fmt.Errorf("Not stopped")
+		}
+	}
+
+	// Stop every request even if stopping one fails, like when it finished
+	// after it was listed
+	failed := []string{}
+	for _, req := range requests {
+		if err := c.ctx.RMClient.StopRequest(req.Id, c.timeout); err != nil {
+			fmt.Fprintf(c.ctx.Out, "Error stopping %s: %s\n", req.Id, err)
+			failed = append(failed, req.Id)
+			continue
+		}
+		if !c.ctx.Options.Quiet {
+			fmt.Fprintf(c.ctx.Out, "OK, stopped %s\n", req.Id)
+		}
+	}
+	if len(failed) > 0 {
+		return fmt.Errorf("Failed to stop %d of %d requests: %s", len(failed), len(requests), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// preview prints the request progress, running jobs, and jobs that will not run.
+// Running and not run jobs are best effort: if getting them fails, the error is
+// printed instead, so the request can still be stopped.
+func (c *Stop) preview(req proto.Request) {
+	now := time.Now()
+	runtime := "not started"
+	if req.StartedAt != nil {
+		runtime = "running " + now.Sub(*req.StartedAt).Round(time.Second).String()
+	}
+	fmt.Fprintf(c.ctx.Out, "Request %s (%s) by %s: %s, %s\n", req.Id, req.Type, req.User, proto.StateName[req.State], runtime)
+	prg := 0.0
+	if req.TotalJobs > 0 {
+		prg = float64(req.FinishedJobs) / float64(req.TotalJobs) * 100
+	}
+	fmt.Fprintf(c.ctx.Out, "Progress: %d of %d jobs complete (%.0f%%)\n", req.FinishedJobs, req.TotalJobs, prg)
+
+	// Jobs that ran have a job log entry and running jobs are in the running
+	// status; all other jobs in the job chain have not run
+	ran := map[string]bool{}
+	status, err := c.ctx.RMClient.Running(proto.StatusFilter{RequestId: req.Id})
+	if err != nil {
+		fmt.Fprintf(c.ctx.Out, "Running jobs: unknown (%s)\n", err)
+	} else {
+		jobs := status.Jobs
+		sort.Sort(proto.JobStatusByStartTime(jobs))
+		fmt.Fprintf(c.ctx.Out, "Running jobs: %d\n", len(jobs))
+		for _, j := range jobs {
+			ran[j.JobId] = true
+			runtime := now.Sub(time.Unix(0, j.StartedAt)).Round(time.Second)
+			fmt.Fprintf(c.ctx.Out, "  %s (%s) try %d, running %s: %s\n", j.Name, j.Type, j.Try, runtime, truncateError(j.Status, statusColLen))
+		}
+	}
+
+	jc, err := c.ctx.RMClient.GetJobChain(req.Id)
+	if err != nil {
+		fmt.Fprintf(c.ctx.Out, "Not run: unknown (%s)\n", err)
+		return
+	}
+	jl, err := c.ctx.RMClient.GetJLWithFilter(req.Id, proto.JobLogFilter{NoOutput: true})
+	if err != nil {
+		fmt.Fprintf(c.ctx.Out, "Not run: unknown (%s)\n", err)
+		return
+	}
+	for _, l := range jl {
+		ran[l.JobId] = true
+	}
+	notRun := 0
+	cleanup := []string{}
+	for _, j := range jc.Jobs {
+		if ran[j.Id] {
+			continue
+		}
+		notRun++
+		if j.RunAfterFail {
+			cleanup = append(cleanup, j.Name)
+		}
+	}
+	fmt.Fprintf(c.ctx.Out, "Not run: %d jobs will not run\n", notRun)
+	if len(cleanup) > 0 {
+		sort.Strings(cleanup)
+		fmt.Fprintf(c.ctx.Out, "  including %d run-after-fail (cleanup) jobs: %s\n", len(cleanup), SqueezeString(fmt.Sprintf("%v", cleanup), statusColLen, ".."))
+	}
 }
@@ -0,0 +1,473 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+func TestStopPreview(t *testing.T) {
+	// Running request with 3 jobs: j1 ran, j2 is running, and j3
+	// (run-after-fail) has not run
+	stopped := false
+	output := &bytes.Buffer{}
+	started := time.Now().Add(-90 * time.Second)
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:           reqId,
+				Type:         "restart-db",
+				State:        proto.STATE_RUNNING,
+				User:         "finch",
+				StartedAt:    &started,
+				TotalJobs:    3,
+				FinishedJobs: 1,
+			}, nil
+		},
+		RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+			return proto.RunningStatus{
+				Jobs: []proto.JobStatus{
+					{RequestId: f.RequestId, JobId: "j2", Name: "stop-mysql", Type: "mysql/stop", Try: 1, StartedAt: time.Now().Add(-10 * time.Second).UnixNano(), Status: "waiting for shutdown"},
+				},
+			}, nil
+		},
+		GetJobChainFunc: func(reqId string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId: reqId,
+				Jobs: map[string]proto.Job{
+					"j1": {Id: "j1", Name: "check-db"},
+					"j2": {Id: "j2", Name: "stop-mysql"},
+					"j3": {Id: "j3", Name: "start-mysql", RunAfterFail: true},
+				},
+			}, nil
+		},
+		GetJLWithFilterFunc: func(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			if !f.NoOutput {
+				return nil, fmt.Errorf("got job log filter %+v, expected NoOutput", f)
+			}
+			return []proto.JobLog{{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_COMPLETE}}, nil
+		},
+		StopRequestFunc: func(reqId string, timeout time.Duration) error {
+			stopped = true
+			return nil
+		},
+	}
+	ctx := app.Context{
+		In:       &bytes.Buffer{},
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{StopConfirm: 10},
+		Command: config.Command{
+			Cmd:  "stop",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	stop := cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !stopped {
+		t.Error("request not stopped")
+	}
+
+	// Request has fewer jobs than StopConfirm, so no confirmation
+	expectOutput := `Request b9uvdi8tk9kahl8ppvbg (restart-db) by finch: RUNNING, running 1m30s
+Progress: 1 of 3 jobs complete (33%)
+Running jobs: 1
+  stop-mysql (mysql/stop) try 1, running 10s: waiting for shutdown
+Not run: 1 jobs will not run
+  including 1 run-after-fail (cleanup) jobs: [start-mysql]
+OK, stopped b9uvdi8tk9kahl8ppvbg
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+}
+
+func TestStopConfirm(t *testing.T) {
+	// Request has more jobs than StopConfirm: stopped only if user enters "stop"
+	// or --yes is specified
+	for _, test := range []struct {
+		in     string
+		yes    bool
+		expect bool
+	}{
+		{"stop\n", false, true},
+		{"no\n", false, false},
+		{"", true, true},
+	} {
+		stopped := false
+		started := time.Now().Add(-90 * time.Second)
+		rmc := &mock.RMClient{
+			GetRequestFunc: func(reqId string) (proto.Request, error) {
+				return proto.Request{
+					Id:           reqId,
+					Type:         "restart-db",
+					State:        proto.STATE_RUNNING,
+					User:         "finch",
+					StartedAt:    &started,
+					TotalJobs:    20,
+					FinishedJobs: 1,
+				}, nil
+			},
+			RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+				return proto.RunningStatus{
+					Jobs: []proto.JobStatus{
+						{RequestId: f.RequestId, JobId: "j2", Name: "stop-mysql", Type: "mysql/stop", Try: 1, StartedAt: time.Now().Add(-10 * time.Second).UnixNano(), Status: "waiting for shutdown"},
+					},
+				}, nil
+			},
+			GetJobChainFunc: func(reqId string) (proto.JobChain, error) {
+				return proto.JobChain{
+					RequestId: reqId,
+					Jobs: map[string]proto.Job{
+						"j1": {Id: "j1", Name: "check-db"},
+						"j2": {Id: "j2", Name: "stop-mysql"},
+						"j3": {Id: "j3", Name: "start-mysql", RunAfterFail: true},
+					},
+				}, nil
+			},
+			GetJLWithFilterFunc: func(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+				if !f.NoOutput {
+					return nil, fmt.Errorf("got job log filter %+v, expected NoOutput", f)
+				}
+				return []proto.JobLog{{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_COMPLETE}}, nil
+			},
+			StopRequestFunc: func(reqId string, timeout time.Duration) error {
+				stopped = true
+				return nil
+			},
+		}
+		ctx := app.Context{
+			In:       bytes.NewBufferString(test.in),
+			Out:      &bytes.Buffer{},
+			RMClient: rmc,
+			Options:  config.Options{StopConfirm: 10, Yes: test.yes},
+			Command: config.Command{
+				Cmd:  "stop",
+				Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+			},
+		}
+		stop := cmd.NewStop(ctx)
+		if err := stop.Prepare(); err != nil {
+			t.Fatal(err)
+		}
+		err := stop.Run()
+		if test.expect && err != nil {
+			t.Errorf("input %q, yes %t: error %s, expected nil", test.in, test.yes, err)
+		}
+		if !test.expect && err == nil {
+			t.Errorf("input %q, yes %t: no error, expected an error", test.in, test.yes)
+		}
+		if stopped != test.expect {
+			t.Errorf("input %q, yes %t: stopped = %t, expected %t", test.in, test.yes, stopped, test.expect)
+		}
+	}
+}
+
+func TestStopQuiet(t *testing.T) {
+	// Nothing is printed with --quiet when confirmation isn't required
+	stopped := false
+	output := &bytes.Buffer{}
+	started := time.Now().Add(-90 * time.Second)
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:           reqId,
+				Type:         "restart-db",
+				State:        proto.STATE_RUNNING,
+				User:         "finch",
+				StartedAt:    &started,
+				TotalJobs:    3,
+				FinishedJobs: 1,
+			}, nil
+		},
+		RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+			return proto.RunningStatus{
+				Jobs: []proto.JobStatus{
+					{RequestId: f.RequestId, JobId: "j2", Name: "stop-mysql", Type: "mysql/stop", Try: 1, StartedAt: time.Now().Add(-10 * time.Second).UnixNano(), Status: "waiting for shutdown"},
+				},
+			}, nil
+		},
+		GetJobChainFunc: func(reqId string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId: reqId,
+				Jobs: map[string]proto.Job{
+					"j1": {Id: "j1", Name: "check-db"},
+					"j2": {Id: "j2", Name: "stop-mysql"},
+					"j3": {Id: "j3", Name: "start-mysql", RunAfterFail: true},
+				},
+			}, nil
+		},
+		GetJLWithFilterFunc: func(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			if !f.NoOutput {
+				return nil, fmt.Errorf("got job log filter %+v, expected NoOutput", f)
+			}
+			return []proto.JobLog{{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_COMPLETE}}, nil
+		},
+		StopRequestFunc: func(reqId string, timeout time.Duration) error {
+			stopped = true
+			return nil
+		},
+	}
+	ctx := app.Context{
+		In:       &bytes.Buffer{},
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{StopConfirm: 10, Quiet: true},
+		Command: config.Command{
+			Cmd:  "stop",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg"},
+		},
+	}
+	stop := cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !stopped {
+		t.Error("request not stopped")
+	}
+	if output.Len() != 0 {
+		t.Errorf("got output %q, expected none", output.String())
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	var gotTimeout time.Duration
+	started := time.Now().Add(-90 * time.Second)
+	rmc := &mock.RMClient{
+		GetRequestFunc: func(reqId string) (proto.Request, error) {
+			return proto.Request{
+				Id:           reqId,
+				Type:         "restart-db",
+				State:        proto.STATE_RUNNING,
+				User:         "finch",
+				StartedAt:    &started,
+				TotalJobs:    3,
+				FinishedJobs: 1,
+			}, nil
+		},
+		RunningFunc: func(f proto.StatusFilter) (proto.RunningStatus, error) {
+			return proto.RunningStatus{
+				Jobs: []proto.JobStatus{
+					{RequestId: f.RequestId, JobId: "j2", Name: "stop-mysql", Type: "mysql/stop", Try: 1, StartedAt: time.Now().Add(-10 * time.Second).UnixNano(), Status: "waiting for shutdown"},
+				},
+			}, nil
+		},
+		GetJobChainFunc: func(reqId string) (proto.JobChain, error) {
+			return proto.JobChain{
+				RequestId: reqId,
+				Jobs: map[string]proto.Job{
+					"j1": {Id: "j1", Name: "check-db"},
+					"j2": {Id: "j2", Name: "stop-mysql"},
+					"j3": {Id: "j3", Name: "start-mysql", RunAfterFail: true},
+				},
+			}, nil
+		},
+		GetJLWithFilterFunc: func(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+			if !f.NoOutput {
+				return nil, fmt.Errorf("got job log filter %+v, expected NoOutput", f)
+			}
+			return []proto.JobLog{{RequestId: reqId, JobId: "j1", Try: 1, State: proto.STATE_COMPLETE}}, nil
+		},
+		StopRequestFunc: func(reqId string, timeout time.Duration) error {
+			gotTimeout = timeout
+			return nil
+		},
+	}
+	ctx := app.Context{
+		Out:      &bytes.Buffer{},
+		RMClient: rmc,
+		Options:  config.Options{StopConfirm: 10},
+		Command: config.Command{
+			Cmd:  "stop",
+			Args: []string{"b9uvdi8tk9kahl8ppvbg", "timeout=5m"},
+		},
+	}
+	stop := cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if gotTimeout != 5*time.Minute {
+		t.Errorf("timeout = %s, expected 5m", gotTimeout)
+	}
+
+	// Only timeout can be given, and it must be a valid duration
+	for _, arg := range []string{"timeout=5", "timeout=-1m", "wait=5m"} {
+		ctx.Command.Args = []string{"b9uvdi8tk9kahl8ppvbg", arg}
+		if err := cmd.NewStop(ctx).Prepare(); err == nil {
+			t.Errorf("%s: no error, expected an error", arg)
+		}
+	}
+}
+
+func TestStopMine(t *testing.T) {
+	// Two running requests of the caller and a partition request, which
+	// isn't stopped separately
+	stopped := []string{}
+	output := &bytes.Buffer{}
+	created := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	rmc := &mock.RMClient{
+		ServerVersionFunc: func() (proto.ServerVersion, error) {
+			return proto.ServerVersion{Version: "2.0.0", Features: []string{proto.FEATURE_REQUESTS_MINE}}, nil
+		},
+		FindRequestsFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			if !f.Mine || f.User != "" {
+				return nil, fmt.Errorf("got filter %+v, expected Mine and no User", f)
+			}
+			return []proto.Request{
+				{Id: "req1", Type: "restart-db", State: proto.STATE_RUNNING, User: "finch", TotalJobs: 3, FinishedJobs: 1, CreatedAt: created},
+				{Id: "req2", Type: "restart-db", State: proto.STATE_PENDING, User: "finch", TotalJobs: 3, CreatedAt: created},
+				{Id: "req1-p1", Type: "restart-db", State: proto.STATE_RUNNING, User: "finch", PartitionOf: "req1", CreatedAt: created},
+			}, nil
+		},
+		StopRequestFunc: func(reqId string, timeout time.Duration) error {
+			stopped = append(stopped, reqId)
+			return nil
+		},
+	}
+	ctx := app.Context{
+		In:       bytes.NewBufferString("stop\n"),
+		Out:      output,
+		RMClient: rmc,
+		Options:  config.Options{Mine: true},
+		Command: config.Command{
+			Cmd: "stop",
+		},
+	}
+	stop := cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if diff := deep.Equal(stopped, []string{"req1", "req2"}); diff != nil {
+		t.Error(diff)
+	}
+
+	expectOutput := `Your pending and running requests (user finch): 2
+
+ID                   REQUEST                                  STATE     JOBS    CREATED
+req1                 restart-db                               RUNNING   1/3     2020-06-01 12:00:00 UTC
+req2                 restart-db                               PENDING   0/3     2020-06-01 12:00:00 UTC
+
+Stop all 2 requests? (use --yes to skip confirmation)
+Enter 'stop' to stop, or anything else to abort: OK, stopped req1
+OK, stopped req2
+`
+	if output.String() != expectOutput {
+		fmt.Printf("got output:\n%s\nexpected:\n%s\n", output, expectOutput)
+		t.Error("wrong output, see above")
+	}
+
+	// Abort: requests are only listed
+	stopped = []string{}
+	ctx.In = bytes.NewBufferString("no\n")
+	stop = cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err == nil {
+		t.Error("no error after abort, expected an error")
+	}
+	if len(stopped) != 0 {
+		t.Errorf("stopped %v after abort, expected none", stopped)
+	}
+
+	// A request ID cannot be given with --mine
+	ctx.Command.Args = []string{"req1"}
+	if err := cmd.NewStop(ctx).Prepare(); err == nil {
+		t.Error("no error for request ID with --mine, expected an error")
+	}
+}
+
+func TestStopMineErrors(t *testing.T) {
+	// Stopping continues after an error
+	stopped := []string{}
+	created := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+	rmc := &mock.RMClient{
+		ServerVersionFunc: func() (proto.ServerVersion, error) {
+			return proto.ServerVersion{Version: "2.0.0", Features: []string{proto.FEATURE_REQUESTS_MINE}}, nil
+		},
+		FindRequestsFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			if !f.Mine || f.User != "" {
+				return nil, fmt.Errorf("got filter %+v, expected Mine and no User", f)
+			}
+			return []proto.Request{
+				{Id: "req1", Type: "restart-db", State: proto.STATE_RUNNING, User: "finch", TotalJobs: 3, FinishedJobs: 1, CreatedAt: created},
+				{Id: "req2", Type: "restart-db", State: proto.STATE_PENDING, User: "finch", TotalJobs: 3, CreatedAt: created},
+				{Id: "req1-p1", Type: "restart-db", State: proto.STATE_RUNNING, User: "finch", PartitionOf: "req1", CreatedAt: created},
+			}, nil
+		},
+		StopRequestFunc: func(reqId string, timeout time.Duration) error {
+			if reqId == "req1" {
+				return fmt.Errorf("request is not running")
+			}
+			stopped = append(stopped, reqId)
+			return nil
+		},
+	}
+	ctx := app.Context{
+		In:       &bytes.Buffer{},
+		Out:      &bytes.Buffer{},
+		RMClient: rmc,
+		Options:  config.Options{Mine: true, Yes: true},
+		Command:  config.Command{Cmd: "stop"},
+	}
+	stop := cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err == nil {
+		t.Error("no error, expected an error for req1")
+	}
+	if diff := deep.Equal(stopped, []string{"req2"}); diff != nil {
+		t.Error(diff)
+	}
+
+	// An old RM ignores mine=true and returns everyone's requests, so nothing
+	// is found or stopped
+	found := false
+	rmc = &mock.RMClient{
+		ServerVersionFunc: func() (proto.ServerVersion, error) {
+			return proto.ServerVersion{Version: "2.0.0", Features: []string{proto.FEATURE_REQUEST_RETRY}}, nil
+		},
+		FindRequestsFunc: func(f proto.RequestFilter) ([]proto.Request, error) {
+			found = true
+			return nil, nil
+		},
+	}
+	ctx.RMClient = rmc
+	stop = cmd.NewStop(ctx)
+	if err := stop.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := stop.Run(); err == nil {
+		t.Error("no error for Request Manager without feature, expected an error")
+	}
+	if found {
+		t.Error("FindRequests called, expected no call without the feature")
+	}
+}
@@ -4,31 +4,82 @@ package cmd
 
 import (
 	"fmt"
+	"strings"
 
+	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/spinc/app"
 	v "github.com/square/spincycle/v2/version"
 )
 
 type Version struct {
+	ctx app.Context
 }
 
 func NewVersion(ctx app.Context) *Version {
-	return &Version{}
+	return &Version{
+		ctx: ctx,
+	}
 }
 
 func (c *Version) Prepare() error {
+	if c.ctx.Options.Remote && c.ctx.RMClient == nil {
+		return fmt.Errorf("Cannot print remote versions: no Request Manager client (run with --debug for details)")
+	}
 	return nil
 }
 
 func (c *Version) Run() error {
-	fmt.Println("spinc " + v.Version())
+	fmt.Fprintf(c.ctx.Out, "spinc %s (API v%d)\n", v.Version(), proto.API_VERSION)
+	if !c.ctx.Options.Remote {
+		return nil
+	}
+
+	sv, err := c.ctx.RMClient.ServerVersion()
+	if err != nil {
+		if _, ok := err.(proto.Error); !ok {
+			return err
+		}
+		// 404: Request Manager older than GET /api/v1/version
+		fmt.Fprintf(c.ctx.Out, "rm    unknown (Request Manager does not report its version) %s\n", c.ctx.Options.Addr)
+		return nil
+	}
+
+	if c.ctx.Hooks.CommandRunResult != nil {
+		c.ctx.Hooks.CommandRunResult(sv, err)
+		return nil
+	}
+
+	/*
+	   spinc 2.0.4 (API v1)
+	   rm    2.0.4 (API v1) http://127.0.0.1:32308
+	         features: job-tries, partitions
+	   jr    2.0.4 https://jr1.local:32307
+	*/
+	fmt.Fprintf(c.ctx.Out, "rm    %s (API v%d) %s\n", sv.Version, sv.APIVersion, c.ctx.Options.Addr)
+	fmt.Fprintf(c.ctx.Out, "      features: %s\n", strings.Join(sv.Features, ", "))
+	if len(sv.JobRunners) == 0 {
+		fmt.Fprintf(c.ctx.Out, "jr    unknown (Job Runners do not push status)\n")
+		return nil
+	}
+	for _, jr := range sv.JobRunners {
+		version := jr.Version
+		if version == "" {
+			version = "unknown" // JR older than the RM
+		}
+		fmt.Fprintf(c.ctx.Out, "jr    %s %s\n", version, jr.JobRunnerURL)
+	}
 	return nil
 }
 
 func (c *Version) Cmd() string {
+	if c.ctx.Options.Remote {
+		return "version --remote"
+	}
 	return "version"
 }
 
 func (c *Version) Help() string {
-	return "'spinc version' prints the Spin Cycle version.\n"
+	return "'spinc version' prints the spinc version and the Request Manager API version it uses.\n" +
+		"With --remote, it also prints the version, API version, and features of the Request Manager,\n" +
+		"and the version of every Job Runner that pushes its status to the Request Manager.\n"
 }
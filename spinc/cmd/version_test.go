@@ -0,0 +1,118 @@
+// Copyright 2020, Square, Inc.
+
+package cmd_test
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/spinc/app"
+	"github.com/square/spincycle/v2/spinc/cmd"
+	"github.com/square/spincycle/v2/spinc/config"
+	"github.com/square/spincycle/v2/test/mock"
+	v "github.com/square/spincycle/v2/version"
+)
+
+func TestVersionRemote(t *testing.T) {
+	output := &bytes.Buffer{}
+	rmc := &mock.RMClient{
+		ServerVersionFunc: func() (proto.ServerVersion, error) {
+			return proto.ServerVersion{
+				Version:    "2.0.5",
+				APIVersion: 1,
+				Features:   []string{proto.FEATURE_JOB_TRIES, proto.FEATURE_PARTITIONS},
+				JobRunners: []proto.JobRunnerVersion{
+					{JobRunnerURL: "https://jr1.local:32307", Version: "2.0.5"},
+					{JobRunnerURL: "https://jr2.local:32307"},
+				},
+			}, nil
+		},
+	}
+	ctx := app.Context{
+		Out:      output,
+		RMClient: rmc,
+		Options: config.Options{
+			Addr:   "http://127.0.0.1:32308",
+			Remote: true,
+		},
+		Command: config.Command{
+			Cmd: "version",
+		},
+	}
+	version := cmd.NewVersion(ctx)
+	if err := version.Prepare(); err != nil {
+		t.Fatal(err)
+	}
+	if err := version.Run(); err != nil {
+		t.Fatal(err)
+	}
+	expectOutput := fmt.Sprintf(`spinc %s (API v1)
+rm    2.0.5 (API v1) http://127.0.0.1:32308
+      features: job-tries, partitions
+jr    2.0.5 https://jr1.local:32307
+jr    unknown https://jr2.local:32307
+`, v.Version())
+	if output.String() != expectOutput {
+		t.Errorf("output:\n%s\nexpected:\n%s", output, expectOutput)
+	}
+}
+
+func TestCheckCompat(t *testing.T) {
+	sv := proto.ServerVersion{
+		Version:    "2.0.5",
+		APIVersion: proto.API_VERSION,
+		Features:   []string{proto.FEATURE_JOB_TRIES},
+	}
+	var svErr error
+	called := false
+	rmc := &mock.RMClient{
+		ServerVersionFunc: func() (proto.ServerVersion, error) {
+			called = true
+			return sv, svErr
+		},
+	}
+	ctx := app.Context{RMClient: rmc}
+
+	// Command that doesn't require a feature: no API call
+	if got := cmd.CheckCompat(ctx, "status"); len(got) != 0 {
+		t.Errorf("got warnings %v, expected none", got)
+	}
+	if called {
+		t.Error("ServerVersion called for status, expected no call")
+	}
+
+	// RM has the feature
+	if got := cmd.CheckCompat(ctx, "job"); len(got) != 0 {
+		t.Errorf("got warnings %v, expected none", got)
+	}
+
+	// RM too old for the command
+	expect := []string{"Request Manager 2.0.5 does not have feature request-groups: 'spinc group' might not work. Upgrade the Request Manager."}
+	if diff := deep.Equal(cmd.CheckCompat(ctx, "group"), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// spinc too old for the RM
+	sv.APIVersion = proto.API_VERSION + 1
+	expect = []string{fmt.Sprintf("Request Manager 2.0.5 API v%d is newer than spinc %s API v%d. Upgrade spinc.",
+		proto.API_VERSION+1, v.Version(), proto.API_VERSION)}
+	if diff := deep.Equal(cmd.CheckCompat(ctx, "job"), expect); diff != nil {
+		t.Error(diff)
+	}
+
+	// RM without the version endpoint (404)
+	svErr = proto.Error{Message: "Not Found"}
+	if got := cmd.CheckCompat(ctx, "job"); len(got) != 1 {
+		t.Errorf("got %d warnings, expected 1: %v", len(got), got)
+	}
+
+	// Other errors are reported by the command
+	svErr = fmt.Errorf("connection refused")
+	if got := cmd.CheckCompat(ctx, "job"); len(got) != 0 {
+		t.Errorf("got warnings %v, expected none", got)
+	}
+}
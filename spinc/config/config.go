@@ -20,6 +20,7 @@ const (
 	DEFAULT_CONFIG_FILES = "/etc/spinc/spinc.yaml,~/.spinc.yaml"
 	DEFAULT_ADDR         = "http://127.0.0.1:32308"
 	DEFAULT_TIMEOUT      = 5000 // 5s
+	DEFAULT_STOP_CONFIRM = 10   // jobs
 )
 
 // Options represents typical command line options: --addr, --config, etc.
@@ -29,8 +30,31 @@ type Options struct {
 	Debug   bool   `arg:"env:SPINC_DEBUG" yaml:"debug"`
 	Env     string `arg:"env:SPINC_ENV" yaml:"env"`
 	Help    bool
+	Mine    bool // stop all of the caller's requests (stop only)
+	NoColor bool `arg:"--no-color,env:SPINC_NO_COLOR" yaml:"no_color"` // never print color
+	Quiet   bool `arg:"env:SPINC_QUIET" yaml:"quiet"`                  // print only results, like the request ID
+	Remote  bool // print Request Manager and Job Runner versions (version only)
 	Timeout uint `arg:"env:SPINC_TIMEOUT" yaml:"timeout"`
+	Verbose bool // print all args (status only)
 	Version bool
+	Wide    bool
+	Yes     bool // don't prompt for confirmation (stop and retry only)
+
+	// Job filters (jobs only)
+	Failed  bool
+	Pending bool
+	Running bool
+
+	// Stopping requests with more than this many jobs requires confirmation
+	StopConfirm uint `arg:"--stop-confirm,env:SPINC_STOP_CONFIRM" yaml:"stop_confirm"`
+
+	// Start a new request from a job of a previous request (start only)
+	FromRequest string `arg:"--from-request"`
+	FromJob     string `arg:"--from-job"`
+
+	// Final state and why (admin finalize only)
+	State  string
+	Reason string
 }
 
 // Command represents a command (start, stop, etc.) and its values.
@@ -121,6 +145,15 @@ func ParseConfigFiles(files string, debug bool) Options {
 		if o.Timeout != 0 {
 			def.Timeout = o.Timeout
 		}
+		if o.StopConfirm != 0 {
+			def.StopConfirm = o.StopConfirm
+		}
+		if o.NoColor {
+			def.NoColor = true
+		}
+		if o.Quiet {
+			def.Quiet = true
+		}
 	}
 	return def
 }
@@ -62,6 +62,13 @@ func Run(ctx app.Context) error {
 	if o.Addr == "" {
 		o.Addr = config.DEFAULT_ADDR
 	}
+	if o.StopConfirm == 0 {
+		o.StopConfirm = config.DEFAULT_STOP_CONFIRM
+	}
+
+	// Print color only to a terminal, and never if --no-color or the NO_COLOR
+	// env var (https://no-color.org) is set
+	ctx.Color = !o.NoColor && os.Getenv("NO_COLOR") == "" && app.IsTerminal(ctx.Out)
 
 	// This is a little hack to make spinc -> quick help work, i.e. print
 	// quick help when there is no command. We can't check os.Args because
@@ -123,6 +130,13 @@ func Run(ctx app.Context) error {
 		}
 	}
 
+	// Warn if the Request Manager is too old for the command, or spinc is too
+	// old for the Request Manager. Warnings go to stderr like errors so they
+	// don't mix with results, like 'spinc export' JSON.
+	for _, w := range cmd.CheckCompat(ctx, c.Cmd) {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", w)
+	}
+
 	// Let command prepare to run. The start command makes heavy use of this.
 	if err := spincCmd.Prepare(); err != nil {
 		if o.Debug {
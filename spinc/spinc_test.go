@@ -4,9 +4,15 @@ package spinc_test
 
 import (
 	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
 	"os"
 	"testing"
 
+	"github.com/square/spincycle/v2/proto"
+	rm "github.com/square/spincycle/v2/request-manager"
 	"github.com/square/spincycle/v2/spinc"
 	"github.com/square/spincycle/v2/spinc/app"
 )
@@ -24,3 +30,26 @@ func TestArgsNoCommand(t *testing.T) {
 		t.Errorf("got error '%v', expected ErrHelp", err)
 	}
 }
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err    error
+		expect int
+	}{
+		{nil, app.EXIT_OK},
+		{app.ErrHelp, app.EXIT_OK},
+		{fmt.Errorf("Unknown command: foo"), app.EXIT_ERROR},
+		{rm.APIError{HTTPStatus: http.StatusInternalServerError}, app.EXIT_API_ERROR},
+		{proto.Error{Message: "request not found"}, app.EXIT_API_ERROR},
+		{&url.Error{Op: "Get", URL: "http://localhost", Err: fmt.Errorf("connection refused")}, app.EXIT_API_ERROR},
+		{rm.APIError{HTTPStatus: http.StatusUnauthorized}, app.EXIT_AUTH_ERROR},
+		{rm.APIError{HTTPStatus: http.StatusForbidden}, app.EXIT_AUTH_ERROR},
+		{app.ErrRequestFailed{State: proto.STATE_FAIL}, app.EXIT_REQUEST_FAILED},
+		{&url.Error{Op: "Get", URL: "http://localhost", Err: context.DeadlineExceeded}, app.EXIT_TIMEOUT},
+	}
+	for _, test := range tests {
+		if got := app.ExitCode(test.err); got != test.expect {
+			t.Errorf("ExitCode(%#v) = %d, expected %d", test.err, got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,607 @@
+// Copyright 2020, Square, Inc.
+
+// Package chaos is a fault-injection test harness for the Job Runner. It runs a
+// real job chain traverser against scripted fake job runners and a fake Request
+// Manager client, injecting job latencies, panics, jobs that ignore or are slow to
+// stop, and RM client failures.
+//
+// A Scenario describes the job chain, how each job behaves, the faults to inject,
+// and the events (shutdown, stop, release) to trigger while the chain is running.
+// Events are triggered when a given job starts running, not at wall-clock times,
+// so scenarios reproduce shutdown, suspend, and stop race conditions deterministically.
+// Scenarios are usually YAML files; see the scenarios/ directory for examples.
+// Run a scenario with Run, then compare the Result to the scenario expectations
+// with Check:
+//
+//	s, err := chaos.Load("scenarios/shutdown-while-running.yaml")
+//	res, err := chaos.Run(s)
+//	for _, err := range s.Check(res) {
+//	    t.Error(err)
+//	}
+package chaos
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/spincycle/v2/job-runner/chain"
+	"github.com/square/spincycle/v2/job-runner/runner"
+	"github.com/square/spincycle/v2/proto"
+	"github.com/square/spincycle/v2/test/mock"
+)
+
+const (
+	// Default max time to wait for traverser.Run to return.
+	DEFAULT_TIMEOUT = 5 * time.Second
+
+	// Default traverser stop and send timeouts.
+	DEFAULT_TRAVERSER_TIMEOUT = 1 * time.Second
+)
+
+// Event actions.
+const (
+	ACTION_SHUTDOWN = "shutdown" // shut down the JR (close traverser shutdown chan)
+	ACTION_STOP     = "stop"     // stop the chain (traverser.Stop)
+	ACTION_RELEASE  = "release"  // let a blocked job finish
+)
+
+// Expected request results.
+const (
+	REQUEST_FINISHED  = "finished"  // final state sent to RM (FinishRequest)
+	REQUEST_SUSPENDED = "suspended" // SJC sent to RM (SuspendRequest)
+	REQUEST_NONE      = "none"      // nothing sent to RM
+)
+
+// Scenario is one fault-injection test scenario.
+type Scenario struct {
+	Name        string               `yaml:"name"`
+	Description string               `yaml:"description"`
+	Jobs        map[string]JobScript `yaml:"jobs"`      // keyed on job ID
+	Adjacency   map[string][]string  `yaml:"adjacency"` // job chain adjacency list
+	RMClient    RMClientScript       `yaml:"rm_client"`
+	Traverser   TraverserScript      `yaml:"traverser"`
+	Events      []Event              `yaml:"events"`
+	Timeout     string               `yaml:"timeout"` // max time for traverser.Run to return (default: 5s)
+	Expect      Expect               `yaml:"expect"`
+}
+
+// JobScript scripts how a fake job runner behaves.
+type JobScript struct {
+	Latency       string `yaml:"latency"`        // how long Run takes, like "100ms"
+	State         string `yaml:"state"`          // final state: COMPLETE (default), FAIL, or STOPPED
+	FailRuns      uint   `yaml:"fail_runs"`      // fail the first N runs, then return State
+	Tries         uint   `yaml:"tries"`          // tries returned by Run (default: 1)
+	SequenceRetry uint   `yaml:"sequence_retry"` // job is its own sequence with this many retries
+	Block         bool   `yaml:"block"`          // block after Latency until stopped or released
+	Panic         bool   `yaml:"panic"`          // panic at the end of Run
+	IgnoreStop    bool   `yaml:"ignore_stop"`    // keep running when stopped
+	StopDelay     string `yaml:"stop_delay"`     // how long Stop takes
+	StopError     string `yaml:"stop_error"`     // error returned by Stop
+}
+
+// RMClientScript scripts how the fake Request Manager client behaves.
+type RMClientScript struct {
+	Latency     string `yaml:"latency"`      // added to every call
+	FailFinish  uint   `yaml:"fail_finish"`  // fail the first N FinishRequest calls
+	FailSuspend uint   `yaml:"fail_suspend"` // fail the first N SuspendRequest calls
+	FailJL      uint   `yaml:"fail_jl"`      // fail the first N CreateJL calls
+}
+
+// TraverserScript sets traverser options.
+type TraverserScript struct {
+	StopTimeout   string `yaml:"stop_timeout"`   // default: 1s
+	SendTimeout   string `yaml:"send_timeout"`   // default: 1s
+	FinishTimeout string `yaml:"finish_timeout"` // shutdown policy "finish" timeout (default: 0, suspend)
+}
+
+// Event is an action triggered while the chain is running. The action is triggered
+// Delay after job After starts running, or Delay after the chain starts running if
+// After is not set.
+type Event struct {
+	After  string `yaml:"after"`  // job ID
+	Delay  string `yaml:"delay"`  // like "50ms"
+	Action string `yaml:"action"` // one of the ACTION_ constants
+	Job    string `yaml:"job"`    // job ID to release (ACTION_RELEASE)
+}
+
+// Expect are the expected results of a scenario. Empty fields are not checked.
+type Expect struct {
+	Request   string            `yaml:"request"`    // one of the REQUEST_ constants
+	State     string            `yaml:"state"`      // final chain state, like "COMPLETE"
+	Jobs      map[string]string `yaml:"jobs"`       // final job states keyed on job ID
+	StopError *bool             `yaml:"stop_error"` // if traverser.Stop returned an error
+}
+
+// Result is the result of running a scenario.
+type Result struct {
+	ChainState byte
+	JobStates  map[string]byte // keyed on job ID
+	Started    []string        // job IDs in the order they started running (once per run)
+	Finished   []proto.FinishRequest
+	Suspended  []proto.SuspendedJobChain
+	JobLogs    []proto.JobLog
+	RMCalls    map[string]uint // all calls (including failed) keyed on RM client method
+	StopErrors []error         // traverser.Stop return values
+	Duration   time.Duration   // how long traverser.Run took
+}
+
+// Load loads a scenario from a YAML file. If the scenario name is not set, it is
+// the base file name.
+func Load(file string) (Scenario, error) {
+	var s Scenario
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return s, err
+	}
+	if err := yaml.UnmarshalStrict(bytes, &s); err != nil {
+		return s, fmt.Errorf("%s: %s", file, err)
+	}
+	if s.Name == "" {
+		s.Name = filepath.Base(file)
+	}
+	return s, nil
+}
+
+// LoadDir loads all scenario files (*.yaml) in a directory, sorted by file name.
+func LoadDir(dir string) ([]Scenario, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	scenarios := make([]Scenario, 0, len(files))
+	for _, file := range files {
+		s, err := Load(file)
+		if err != nil {
+			return nil, err
+		}
+		scenarios = append(scenarios, s)
+	}
+	return scenarios, nil
+}
+
+// Run runs the scenario. It returns an error if the scenario is invalid or
+// traverser.Run does not return within the scenario timeout, which usually
+// means the traverser is deadlocked.
+func Run(s Scenario) (Result, error) {
+	h, err := newHarness(s)
+	if err != nil {
+		return Result{}, fmt.Errorf("%s: %s", s.Name, err)
+	}
+	return h.run()
+}
+
+// Check returns an error for every result that does not match the scenario
+// expectations.
+func (s Scenario) Check(res Result) []error {
+	errs := []error{}
+	e := s.Expect
+	if e.Request != "" {
+		got := REQUEST_NONE
+		if len(res.Finished) > 0 {
+			got = REQUEST_FINISHED
+		} else if len(res.Suspended) > 0 {
+			got = REQUEST_SUSPENDED
+		}
+		if got != e.Request {
+			errs = append(errs, fmt.Errorf("%s: request %s, expected %s", s.Name, got, e.Request))
+		}
+		if len(res.Finished)+len(res.Suspended) > 1 {
+			errs = append(errs, fmt.Errorf("%s: final state sent to RM %d times (%d finished, %d suspended), expected once",
+				s.Name, len(res.Finished)+len(res.Suspended), len(res.Finished), len(res.Suspended)))
+		}
+	}
+	if e.State != "" && proto.StateName[res.ChainState] != e.State {
+		errs = append(errs, fmt.Errorf("%s: chain state %s, expected %s", s.Name, proto.StateName[res.ChainState], e.State))
+	}
+	jobIds := make([]string, 0, len(e.Jobs))
+	for jobId := range e.Jobs {
+		jobIds = append(jobIds, jobId)
+	}
+	sort.Strings(jobIds)
+	for _, jobId := range jobIds {
+		if got := proto.StateName[res.JobStates[jobId]]; got != e.Jobs[jobId] {
+			errs = append(errs, fmt.Errorf("%s: job %s state %s, expected %s", s.Name, jobId, got, e.Jobs[jobId]))
+		}
+	}
+	if e.StopError != nil {
+		gotErr := false
+		for _, err := range res.StopErrors {
+			if err != nil {
+				gotErr = true
+			}
+		}
+		if gotErr != *e.StopError {
+			errs = append(errs, fmt.Errorf("%s: traverser.Stop error %t, expected %t (errors: %v)", s.Name, gotErr, *e.StopError, res.StopErrors))
+		}
+	}
+	return errs
+}
+
+// --------------------------------------------------------------------------
+
+type harness struct {
+	s             Scenario
+	timeout       time.Duration
+	stopTimeout   time.Duration
+	sendTimeout   time.Duration
+	finishTimeout time.Duration
+	rmLatency     time.Duration
+	jobs          map[string]*fakeJob
+
+	*sync.Mutex // guards fields below
+	res         Result
+	startedChan map[string]chan struct{} // closed when job first starts, keyed on job ID
+	rmFails     map[string]uint          // remaining failures, keyed on RM client method
+}
+
+// fakeJob is the scripted state of one job shared by all its fake runners.
+// Every run (try, sequence retry) makes a new runner.
+type fakeJob struct {
+	script    JobScript
+	latency   time.Duration
+	stopDelay time.Duration
+	state     byte
+	release   chan struct{}
+	once      *sync.Once
+	runs      uint
+}
+
+func newHarness(s Scenario) (*harness, error) {
+	if len(s.Jobs) == 0 {
+		return nil, fmt.Errorf("no jobs")
+	}
+	h := &harness{
+		s:           s,
+		jobs:        map[string]*fakeJob{},
+		Mutex:       &sync.Mutex{},
+		startedChan: map[string]chan struct{}{},
+		rmFails: map[string]uint{
+			"FinishRequest":  s.RMClient.FailFinish,
+			"SuspendRequest": s.RMClient.FailSuspend,
+			"CreateJL":       s.RMClient.FailJL,
+		},
+		res: Result{
+			JobStates: map[string]byte{},
+			RMCalls:   map[string]uint{},
+		},
+	}
+
+	var err error
+	if h.timeout, err = duration(s.Timeout, DEFAULT_TIMEOUT); err != nil {
+		return nil, fmt.Errorf("invalid timeout: %s", err)
+	}
+	if h.stopTimeout, err = duration(s.Traverser.StopTimeout, DEFAULT_TRAVERSER_TIMEOUT); err != nil {
+		return nil, fmt.Errorf("invalid traverser.stop_timeout: %s", err)
+	}
+	if h.sendTimeout, err = duration(s.Traverser.SendTimeout, DEFAULT_TRAVERSER_TIMEOUT); err != nil {
+		return nil, fmt.Errorf("invalid traverser.send_timeout: %s", err)
+	}
+	if h.finishTimeout, err = duration(s.Traverser.FinishTimeout, 0); err != nil {
+		return nil, fmt.Errorf("invalid traverser.finish_timeout: %s", err)
+	}
+	if h.rmLatency, err = duration(s.RMClient.Latency, 0); err != nil {
+		return nil, fmt.Errorf("invalid rm_client.latency: %s", err)
+	}
+
+	for jobId, script := range s.Jobs {
+		j := &fakeJob{
+			script:  script,
+			state:   proto.STATE_COMPLETE,
+			release: make(chan struct{}),
+			once:    &sync.Once{},
+		}
+		if j.latency, err = duration(script.Latency, 0); err != nil {
+			return nil, fmt.Errorf("job %s: invalid latency: %s", jobId, err)
+		}
+		if j.stopDelay, err = duration(script.StopDelay, 0); err != nil {
+			return nil, fmt.Errorf("job %s: invalid stop_delay: %s", jobId, err)
+		}
+		if script.State != "" {
+			state, ok := proto.StateValue[script.State]
+			if !ok {
+				return nil, fmt.Errorf("job %s: invalid state: %s", jobId, script.State)
+			}
+			j.state = state
+		}
+		h.jobs[jobId] = j
+		h.startedChan[jobId] = make(chan struct{})
+	}
+	for jobId, next := range s.Adjacency {
+		for _, id := range append([]string{jobId}, next...) {
+			if _, ok := s.Jobs[id]; !ok {
+				return nil, fmt.Errorf("adjacency: job %s not in jobs", id)
+			}
+		}
+	}
+	for i, e := range s.Events {
+		if _, err := duration(e.Delay, 0); err != nil {
+			return nil, fmt.Errorf("event %d: invalid delay: %s", i, err)
+		}
+		if e.After != "" && h.jobs[e.After] == nil {
+			return nil, fmt.Errorf("event %d: after job %s not in jobs", i, e.After)
+		}
+		switch e.Action {
+		case ACTION_SHUTDOWN, ACTION_STOP:
+		case ACTION_RELEASE:
+			if h.jobs[e.Job] == nil {
+				return nil, fmt.Errorf("event %d: release job %s not in jobs", i, e.Job)
+			}
+		default:
+			return nil, fmt.Errorf("event %d: invalid action: %s", i, e.Action)
+		}
+	}
+	return h, nil
+}
+
+func (h *harness) run() (Result, error) {
+	jobs := map[string]proto.Job{}
+	for jobId, j := range h.jobs {
+		jobs[jobId] = proto.Job{
+			Id:                jobId,
+			Name:              jobId,
+			Type:              "chaos",
+			State:             proto.STATE_PENDING,
+			Data:              map[string]interface{}{},
+			SequenceId:        jobId,
+			SequenceRetry:     j.script.SequenceRetry,
+			SequenceRetryWait: "0s",
+		}
+	}
+	jc := &proto.JobChain{
+		RequestId:     "chaos_" + h.s.Name,
+		RequestType:   "chaos",
+		Jobs:          jobs,
+		AdjacencyList: h.s.Adjacency,
+		State:         proto.STATE_PENDING,
+	}
+	c := chain.NewChain(jc, map[string]uint{}, map[string]uint{}, map[string]uint{})
+	shutdownChan := make(chan struct{})
+	shutdownOnce := &sync.Once{}
+
+	trav := chain.NewTraverser(chain.TraverserConfig{
+		Chain:         c,
+		ChainRepo:     chain.NewMemoryRepo(),
+		RunnerFactory: &mock.RunnerFactory{MakeFunc: h.makeRunner},
+		RMClient:      h.rmClient(),
+		ShutdownChan:  shutdownChan,
+		StopTimeout:   h.stopTimeout,
+		SendTimeout:   h.sendTimeout,
+		FinishTimeout: h.finishTimeout,
+	})
+
+	// Trigger events. Each event waits for its job to start (if any), then
+	// its delay. Events are not triggered after traverser.Run returns.
+	runDone := make(chan struct{})
+	eventsWg := &sync.WaitGroup{}
+	for _, e := range h.s.Events {
+		eventsWg.Add(1)
+		go func(e Event) {
+			defer eventsWg.Done()
+			if e.After != "" {
+				select {
+				case <-h.startedChan[e.After]:
+				case <-runDone:
+					return
+				}
+			}
+			delay, _ := duration(e.Delay, 0) // validated in newHarness
+			select {
+			case <-time.After(delay):
+			case <-runDone:
+				return
+			}
+			switch e.Action {
+			case ACTION_SHUTDOWN:
+				shutdownOnce.Do(func() { close(shutdownChan) })
+			case ACTION_STOP:
+				err := trav.Stop(0)
+				h.Lock()
+				h.res.StopErrors = append(h.res.StopErrors, err)
+				h.Unlock()
+			case ACTION_RELEASE:
+				j := h.jobs[e.Job]
+				j.once.Do(func() { close(j.release) })
+			}
+		}(e)
+	}
+
+	start := time.Now()
+	go func() {
+		trav.Run()
+		close(runDone)
+	}()
+
+	var err error
+	select {
+	case <-runDone:
+	case <-time.After(h.timeout):
+		err = fmt.Errorf("%s: traverser.Run did not return after %s", h.s.Name, h.timeout)
+	}
+	duration := time.Since(start)
+
+	// Let blocked jobs return so fake runner goroutines don't leak
+	for _, j := range h.jobs {
+		j.once.Do(func() { close(j.release) })
+	}
+	if err == nil {
+		eventsWg.Wait() // wait for in-progress Stop calls
+	}
+
+	h.Lock()
+	defer h.Unlock()
+	h.res.Duration = duration
+	h.res.ChainState = c.State()
+	for jobId := range h.jobs {
+		h.res.JobStates[jobId] = c.JobState(jobId)
+	}
+	return h.res, err
+}
+
+func (h *harness) makeRunner(job proto.Job, cfg runner.Config) (runner.Runner, error) {
+	j := h.jobs[job.Id]
+	h.Lock()
+	j.runs++
+	run := j.runs
+	h.Unlock()
+	return &fakeRunner{
+		h:        h,
+		job:      job,
+		j:        j,
+		run:      run,
+		started:  time.Now(),
+		stopChan: make(chan struct{}),
+		stopOnce: &sync.Once{},
+	}, nil
+}
+
+// started records that a job started running and closes its started chan the
+// first time it runs, which triggers events waiting for the job.
+func (h *harness) started(jobId string) {
+	h.Lock()
+	defer h.Unlock()
+	first := true
+	for _, id := range h.res.Started {
+		if id == jobId {
+			first = false
+			break
+		}
+	}
+	h.res.Started = append(h.res.Started, jobId)
+	if first {
+		close(h.startedChan[jobId])
+	}
+}
+
+// rmCall records an RM client call, sleeps for the scripted latency, and returns
+// an error if the call is scripted to fail.
+func (h *harness) rmCall(method string) error {
+	time.Sleep(h.rmLatency)
+	h.Lock()
+	defer h.Unlock()
+	h.res.RMCalls[method]++
+	if h.rmFails[method] > 0 {
+		h.rmFails[method]--
+		return fmt.Errorf("chaos: forced %s error", method)
+	}
+	return nil
+}
+
+func (h *harness) rmClient() *mock.RMClient {
+	return &mock.RMClient{
+		FinishRequestFunc: func(fr proto.FinishRequest) error {
+			if err := h.rmCall("FinishRequest"); err != nil {
+				return err
+			}
+			h.Lock()
+			h.res.Finished = append(h.res.Finished, fr)
+			h.Unlock()
+			return nil
+		},
+		SuspendRequestFunc: func(requestId string, sjc proto.SuspendedJobChain) error {
+			if err := h.rmCall("SuspendRequest"); err != nil {
+				return err
+			}
+			h.Lock()
+			h.res.Suspended = append(h.res.Suspended, sjc)
+			h.Unlock()
+			return nil
+		},
+		CreateJLFunc: func(requestId string, jl proto.JobLog) error {
+			if err := h.rmCall("CreateJL"); err != nil {
+				return err
+			}
+			h.Lock()
+			h.res.JobLogs = append(h.res.JobLogs, jl)
+			h.Unlock()
+			return nil
+		},
+	}
+}
+
+// --------------------------------------------------------------------------
+
+// fakeRunner is a runner.Runner that behaves as scripted by its JobScript.
+type fakeRunner struct {
+	h        *harness
+	job      proto.Job
+	j        *fakeJob
+	run      uint      // 1 for first run
+	started  time.Time // when runner was made
+	stopChan chan struct{}
+	stopOnce *sync.Once
+}
+
+func (r *fakeRunner) Run(jobData map[string]interface{}) runner.Return {
+	r.h.started(r.job.Id)
+
+	tries := r.j.script.Tries
+	if tries == 0 {
+		tries = 1
+	}
+	stopped := runner.Return{FinalState: proto.STATE_STOPPED, Tries: tries}
+
+	// Stop chan is nil (blocks forever) if the job ignores Stop
+	stopChan := r.stopChan
+	if r.j.script.IgnoreStop {
+		stopChan = nil
+	}
+
+	if r.j.latency > 0 {
+		select {
+		case <-time.After(r.j.latency):
+		case <-stopChan:
+			return stopped
+		}
+	}
+	if r.j.script.Block {
+		select {
+		case <-r.j.release:
+		case <-stopChan:
+			return stopped
+		}
+	}
+	if r.j.script.Panic {
+		panic(fmt.Sprintf("chaos: job %s panic", r.job.Id))
+	}
+	if r.run <= r.j.script.FailRuns {
+		return runner.Return{FinalState: proto.STATE_FAIL, Tries: tries}
+	}
+	return runner.Return{FinalState: r.j.state, Tries: tries}
+}
+
+func (r *fakeRunner) Stop() error {
+	time.Sleep(r.j.stopDelay)
+	r.stopOnce.Do(func() { close(r.stopChan) })
+	if r.j.script.StopError != "" {
+		return fmt.Errorf("%s", r.j.script.StopError)
+	}
+	return nil
+}
+
+func (r *fakeRunner) StopTry() error {
+	return runner.ErrNotRunning
+}
+
+func (r *fakeRunner) Status() runner.Status {
+	return runner.Status{
+		Job:       r.job,
+		StartedAt: r.started,
+		Try:       r.run,
+		Status:    "chaos",
+	}
+}
+
+// duration parses s, returning def if s is empty.
+func duration(s string, def time.Duration) (time.Duration, error) {
+	if s == "" {
+		return def, nil
+	}
+	return time.ParseDuration(s)
+}
@@ -0,0 +1,48 @@
+// Copyright 2020, Square, Inc.
+
+package chaos_test
+
+import (
+	"testing"
+
+	"github.com/square/spincycle/v2/test/chaos"
+)
+
+func TestScenarios(t *testing.T) {
+	scenarios, err := chaos.LoadDir("scenarios")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scenarios) == 0 {
+		t.Fatal("no scenarios in scenarios/")
+	}
+	for _, s := range scenarios {
+		s := s
+		t.Run(s.Name, func(t *testing.T) {
+			t.Parallel()
+			res, err := chaos.Run(s)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, err := range s.Check(res) {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestInvalidScenario(t *testing.T) {
+	invalid := []chaos.Scenario{
+		{Name: "no jobs"},
+		{Name: "bad latency", Jobs: map[string]chaos.JobScript{"job1": {Latency: "soon"}}},
+		{Name: "bad state", Jobs: map[string]chaos.JobScript{"job1": {State: "DONE"}}},
+		{Name: "bad adjacency", Jobs: map[string]chaos.JobScript{"job1": {}}, Adjacency: map[string][]string{"job1": {"job2"}}},
+		{Name: "bad action", Jobs: map[string]chaos.JobScript{"job1": {}}, Events: []chaos.Event{{Action: "explode"}}},
+		{Name: "bad release", Jobs: map[string]chaos.JobScript{"job1": {}}, Events: []chaos.Event{{Action: chaos.ACTION_RELEASE, Job: "job2"}}},
+	}
+	for _, s := range invalid {
+		if _, err := chaos.Run(s); err == nil {
+			t.Errorf("%s: no error, expected an error", s.Name)
+		}
+	}
+}
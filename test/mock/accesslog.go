@@ -0,0 +1,24 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"github.com/square/spincycle/v2/request-manager/accesslog"
+)
+
+type AccessLog struct {
+	LogFunc  func(accesslog.Entry)
+	StopFunc func()
+}
+
+func (a *AccessLog) Log(e accesslog.Entry) {
+	if a.LogFunc != nil {
+		a.LogFunc(e)
+	}
+}
+
+func (a *AccessLog) Stop() {
+	if a.StopFunc != nil {
+		a.StopFunc()
+	}
+}
@@ -0,0 +1,26 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"github.com/square/spincycle/v2/proto"
+)
+
+type GroupManager struct {
+	CreateFunc func(proto.CreateRequestGroup, string) (proto.RequestGroup, error)
+	GetFunc    func(groupId string) (proto.RequestGroup, error)
+}
+
+func (g *GroupManager) Create(cg proto.CreateRequestGroup, user string) (proto.RequestGroup, error) {
+	if g.CreateFunc != nil {
+		return g.CreateFunc(cg, user)
+	}
+	return proto.RequestGroup{}, nil
+}
+
+func (g *GroupManager) Get(groupId string) (proto.RequestGroup, error) {
+	if g.GetFunc != nil {
+		return g.GetFunc(groupId)
+	}
+	return proto.RequestGroup{Id: groupId}, nil
+}
@@ -15,7 +15,7 @@ var (
 type JLStore struct {
 	CreateFunc  func(string, proto.JobLog) (proto.JobLog, error)
 	GetFunc     func(string, string) (proto.JobLog, error)
-	GetFullFunc func(string) ([]proto.JobLog, error)
+	GetFullFunc func(string, proto.JobLogFilter) ([]proto.JobLog, error)
 }
 
 func (j *JLStore) Create(reqId string, jl proto.JobLog) (proto.JobLog, error) {
@@ -32,9 +32,9 @@ func (j *JLStore) Get(reqId, jobId string) (proto.JobLog, error) {
 	return proto.JobLog{}, nil
 }
 
-func (j *JLStore) GetFull(reqId string) ([]proto.JobLog, error) {
+func (j *JLStore) GetFull(reqId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
 	if j.GetFullFunc != nil {
-		return j.GetFullFunc(reqId)
+		return j.GetFullFunc(reqId, f)
 	}
 	return []proto.JobLog{}, nil
 }
@@ -5,6 +5,7 @@ package mock
 import (
 	"errors"
 	"net/url"
+	"time"
 
 	"github.com/square/spincycle/v2/proto"
 )
@@ -17,8 +18,13 @@ type JRClient struct {
 	NewJobChainFunc    func(string, proto.JobChain) (*url.URL, error)
 	ResumeJobChainFunc func(string, proto.SuspendedJobChain) (*url.URL, error)
 	StartRequestFunc   func(string, string) error
-	StopRequestFunc    func(string, string) error
+	StopRequestFunc    func(string, string, time.Duration) error
+	StopJobFunc        func(string, string, string) error
+	SetLogLevelFunc    func(string, string, proto.RequestLogLevel) error
+	HasJobChainFunc    func(string, string) (bool, error)
 	RunningFunc        func(string, proto.StatusFilter) ([]proto.JobStatus, error)
+	DrainFunc          func(string) error
+	PingFunc           func(string) error
 }
 
 func (c *JRClient) NewJobChain(baseURL string, jc proto.JobChain) (*url.URL, error) {
@@ -42,16 +48,51 @@ func (c *JRClient) StartRequest(baseURL string, requestId string) error {
 	return nil
 }
 
-func (c *JRClient) StopRequest(baseURL string, requestId string) error {
+func (c *JRClient) StopRequest(baseURL string, requestId string, timeout time.Duration) error {
 	if c.StopRequestFunc != nil {
-		return c.StopRequestFunc(baseURL, requestId)
+		return c.StopRequestFunc(baseURL, requestId, timeout)
 	}
 	return nil
 }
 
+func (c *JRClient) StopJob(baseURL string, requestId, jobId string) error {
+	if c.StopJobFunc != nil {
+		return c.StopJobFunc(baseURL, requestId, jobId)
+	}
+	return nil
+}
+
+func (c *JRClient) SetLogLevel(baseURL string, requestId string, ll proto.RequestLogLevel) error {
+	if c.SetLogLevelFunc != nil {
+		return c.SetLogLevelFunc(baseURL, requestId, ll)
+	}
+	return nil
+}
+
+func (c *JRClient) HasJobChain(baseURL string, requestId string) (bool, error) {
+	if c.HasJobChainFunc != nil {
+		return c.HasJobChainFunc(baseURL, requestId)
+	}
+	return true, nil
+}
+
 func (c *JRClient) Running(baseURL string, f proto.StatusFilter) ([]proto.JobStatus, error) {
 	if c.RunningFunc != nil {
 		return c.RunningFunc(baseURL, f)
 	}
 	return []proto.JobStatus{}, nil
 }
+
+func (c *JRClient) Drain(baseURL string) error {
+	if c.DrainFunc != nil {
+		return c.DrainFunc(baseURL)
+	}
+	return nil
+}
+
+func (c *JRClient) Ping(baseURL string) error {
+	if c.PingFunc != nil {
+		return c.PingFunc(baseURL)
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"github.com/square/spincycle/v2/proto"
+)
+
+type QuotaManager struct {
+	CheckFunc func(user, team, namespace string) error
+	ListFunc  func() ([]proto.Quota, error)
+	SetFunc   func(proto.Quota) error
+}
+
+func (q *QuotaManager) Check(user, team, namespace string) error {
+	if q.CheckFunc != nil {
+		return q.CheckFunc(user, team, namespace)
+	}
+	return nil
+}
+
+func (q *QuotaManager) List() ([]proto.Quota, error) {
+	if q.ListFunc != nil {
+		return q.ListFunc()
+	}
+	return []proto.Quota{}, nil
+}
+
+func (q *QuotaManager) Set(quota proto.Quota) error {
+	if q.SetFunc != nil {
+		return q.SetFunc(quota)
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"time"
+)
+
+type Replica struct {
+	LagFunc   func() (time.Duration, bool)
+	CheckFunc func()
+}
+
+func (r *Replica) Lag() (time.Duration, bool) {
+	if r.LagFunc != nil {
+		return r.LagFunc()
+	}
+	return 0, true
+}
+
+func (r *Replica) Check() {
+	if r.CheckFunc != nil {
+		r.CheckFunc()
+	}
+}
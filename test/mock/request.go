@@ -5,6 +5,7 @@ package mock
 import (
 	"errors"
 	"net/http"
+	"time"
 
 	"github.com/square/spincycle/v2/proto"
 	"github.com/square/spincycle/v2/request-manager/auth"
@@ -16,16 +17,26 @@ var (
 )
 
 type RequestManager struct {
-	CreateFunc      func(proto.CreateRequest) (proto.Request, error)
-	GetFunc         func(string) (proto.Request, error)
-	GetWithJCFunc   func(string) (proto.Request, error)
-	StartFunc       func(string) error
-	StopFunc        func(string) error
-	FinishFunc      func(string, proto.FinishRequest) error
-	FailPendingFunc func(string) error
-	SpecsFunc       func() []proto.RequestSpec
-	JobChainFunc    func(string) (proto.JobChain, error)
-	FindFunc        func(proto.RequestFilter) ([]proto.Request, error)
+	CreateFunc           func(proto.CreateRequest) (proto.Request, error)
+	GetFunc              func(string) (proto.Request, error)
+	GetWithJCFunc        func(string) (proto.Request, error)
+	StartFunc            func(string) error
+	StopFunc             func(string, time.Duration) error
+	StopJobFunc          func(string, string) error
+	FinishFunc           func(string, proto.FinishRequest) error
+	FailPendingFunc      func(string) error
+	FinishPartitionsFunc func(string) error
+	CheckFenceFunc       func(string, uint64) error
+	SpecsFunc            func() []proto.RequestSpec
+	MetadataFunc         func(string) (proto.RequestTypeMetadata, error)
+	JobChainFunc         func(string) (proto.JobChain, error)
+	FindFunc             func(proto.RequestFilter) ([]proto.Request, error)
+	HistoryFunc          func(string, time.Time, uint) (proto.RequestHistory, error)
+	ExportFunc           func(string) (proto.RequestBundle, error)
+	ImportFunc           func(proto.RequestBundle) (proto.Request, error)
+	RetryFunc            func(string, proto.RetryRequest) (proto.Request, error)
+	SetLogLevelFunc      func(string, proto.RequestLogLevel) (proto.RequestLogLevel, error)
+	FinalizeFunc         func(string, proto.FinalizeRequest) (proto.Request, error)
 }
 
 func (r *RequestManager) Create(reqParams proto.CreateRequest) (proto.Request, error) {
@@ -70,9 +81,30 @@ func (r *RequestManager) FailPending(reqId string) error {
 	return nil
 }
 
-func (r *RequestManager) Stop(reqId string) error {
+func (r *RequestManager) FinishPartitions(reqId string) error {
+	if r.FinishPartitionsFunc != nil {
+		return r.FinishPartitionsFunc(reqId)
+	}
+	return nil
+}
+
+func (r *RequestManager) CheckFence(reqId string, token uint64) error {
+	if r.CheckFenceFunc != nil {
+		return r.CheckFenceFunc(reqId, token)
+	}
+	return nil
+}
+
+func (r *RequestManager) Stop(reqId string, timeout time.Duration) error {
 	if r.StopFunc != nil {
-		return r.StopFunc(reqId)
+		return r.StopFunc(reqId, timeout)
+	}
+	return nil
+}
+
+func (r *RequestManager) StopJob(reqId, jobId string) error {
+	if r.StopJobFunc != nil {
+		return r.StopJobFunc(reqId, jobId)
 	}
 	return nil
 }
@@ -84,6 +116,13 @@ func (r *RequestManager) Specs() []proto.RequestSpec {
 	return []proto.RequestSpec{}
 }
 
+func (r *RequestManager) Metadata(reqType string) (proto.RequestTypeMetadata, error) {
+	if r.MetadataFunc != nil {
+		return r.MetadataFunc(reqType)
+	}
+	return proto.RequestTypeMetadata{}, nil
+}
+
 func (r *RequestManager) JobChain(reqId string) (proto.JobChain, error) {
 	if r.JobChainFunc != nil {
 		return r.JobChainFunc(reqId)
@@ -98,6 +137,48 @@ func (r *RequestManager) Find(filter proto.RequestFilter) ([]proto.Request, erro
 	return []proto.Request{}, nil
 }
 
+func (r *RequestManager) History(reqType string, since time.Time, limit uint) (proto.RequestHistory, error) {
+	if r.HistoryFunc != nil {
+		return r.HistoryFunc(reqType, since, limit)
+	}
+	return proto.RequestHistory{}, nil
+}
+
+func (r *RequestManager) Export(requestId string) (proto.RequestBundle, error) {
+	if r.ExportFunc != nil {
+		return r.ExportFunc(requestId)
+	}
+	return proto.RequestBundle{}, nil
+}
+
+func (r *RequestManager) Import(b proto.RequestBundle) (proto.Request, error) {
+	if r.ImportFunc != nil {
+		return r.ImportFunc(b)
+	}
+	return b.Request, nil
+}
+
+func (r *RequestManager) Retry(requestId string, retry proto.RetryRequest) (proto.Request, error) {
+	if r.RetryFunc != nil {
+		return r.RetryFunc(requestId, retry)
+	}
+	return proto.Request{}, nil
+}
+
+func (r *RequestManager) SetLogLevel(requestId string, ll proto.RequestLogLevel) (proto.RequestLogLevel, error) {
+	if r.SetLogLevelFunc != nil {
+		return r.SetLogLevelFunc(requestId, ll)
+	}
+	return ll, nil
+}
+
+func (r *RequestManager) Finalize(requestId string, f proto.FinalizeRequest) (proto.Request, error) {
+	if r.FinalizeFunc != nil {
+		return r.FinalizeFunc(requestId, f)
+	}
+	return proto.Request{}, nil
+}
+
 // --------------------------------------------------------------------------
 
 type RequestResumer struct {
@@ -105,6 +186,9 @@ type RequestResumer struct {
 	CleanupFunc   func()
 	ResumeFunc    func(string) error
 	SuspendFunc   func(proto.SuspendedJobChain) error
+
+	ResumePointsFunc    func(string) (proto.JobChain, error)
+	SetResumePointsFunc func(string, proto.ResumePoints) (proto.JobChain, error)
 }
 
 func (r *RequestResumer) ResumeAll() {
@@ -135,6 +219,20 @@ func (r *RequestResumer) Suspend(sjc proto.SuspendedJobChain) error {
 	return nil
 }
 
+func (r *RequestResumer) ResumePoints(requestId string) (proto.JobChain, error) {
+	if r.ResumePointsFunc != nil {
+		return r.ResumePointsFunc(requestId)
+	}
+	return proto.JobChain{}, nil
+}
+
+func (r *RequestResumer) SetResumePoints(requestId string, rp proto.ResumePoints) (proto.JobChain, error) {
+	if r.SetResumePointsFunc != nil {
+		return r.SetResumePointsFunc(requestId, rp)
+	}
+	return proto.JobChain{}, nil
+}
+
 // --------------------------------------------------------------------------
 
 type AuthPlugin struct {
@@ -155,3 +253,22 @@ func (a AuthPlugin) Authorize(c auth.Caller, op string, req proto.Request) error
 	}
 	return nil
 }
+
+type ResolverPlugin struct {
+	PreResolveFunc  func(*proto.CreateRequest) error
+	PostResolveFunc func(*proto.Request) error
+}
+
+func (p ResolverPlugin) PreResolve(newReq *proto.CreateRequest) error {
+	if p.PreResolveFunc != nil {
+		return p.PreResolveFunc(newReq)
+	}
+	return nil
+}
+
+func (p ResolverPlugin) PostResolve(req *proto.Request) error {
+	if p.PostResolveFunc != nil {
+		return p.PostResolveFunc(req)
+	}
+	return nil
+}
@@ -8,7 +8,8 @@ import (
 )
 
 type ResolverFactory struct {
-	MakeFunc func(proto.Request) graph.Resolver
+	MakeFunc            func(proto.Request) graph.Resolver
+	TemplateVersionFunc func() string
 }
 
 func (f *ResolverFactory) Make(req proto.Request) graph.Resolver {
@@ -18,9 +19,17 @@ func (f *ResolverFactory) Make(req proto.Request) graph.Resolver {
 	return nil
 }
 
+func (f *ResolverFactory) TemplateVersion() string {
+	if f.TemplateVersionFunc != nil {
+		return f.TemplateVersionFunc()
+	}
+	return ""
+}
+
 type Resolver struct {
 	RequestArgsFunc       func(jobArgs map[string]interface{}) ([]proto.RequestArg, error)
 	BuildRequestGraphFunc func(jobArgs map[string]interface{}) (*graph.Graph, error)
+	WarningsFunc          func() []string
 }
 
 func (o *Resolver) RequestArgs(jobArgs map[string]interface{}) ([]proto.RequestArg, error) {
@@ -35,3 +44,10 @@ func (o *Resolver) BuildRequestGraph(jobArgs map[string]interface{}) (*graph.Gra
 	}
 	return nil, nil
 }
+
+func (o *Resolver) Warnings() []string {
+	if o.WarningsFunc != nil {
+		return o.WarningsFunc()
+	}
+	return nil
+}
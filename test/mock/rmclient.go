@@ -4,6 +4,7 @@ package mock
 
 import (
 	"errors"
+	"time"
 
 	"github.com/square/spincycle/v2/proto"
 )
@@ -16,16 +17,44 @@ type RMClient struct {
 	CreateRequestFunc  func(string, map[string]interface{}) (string, error)
 	GetRequestFunc     func(string) (proto.Request, error)
 	FindRequestsFunc   func(proto.RequestFilter) ([]proto.Request, error)
-	StartRequestFunc   func(string) error
-	FinishRequestFunc  func(proto.FinishRequest) error
-	StopRequestFunc    func(string) error
-	SuspendRequestFunc func(string, proto.SuspendedJobChain) error
-	GetJobChainFunc    func(string) (proto.JobChain, error)
-	GetJLFunc          func(string) ([]proto.JobLog, error)
-	CreateJLFunc       func(string, proto.JobLog) error
-	RunningFunc        func(proto.StatusFilter) (proto.RunningStatus, error)
-	RequestListFunc    func() ([]proto.RequestSpec, error)
-	UpdateProgressFunc func(proto.RequestProgress) error
+	RequestHistoryFunc func(string, time.Time, uint) (proto.RequestHistory, error)
+	ExportRequestFunc  func(string) (proto.RequestBundle, error)
+	ImportRequestFunc  func(proto.RequestBundle) (proto.Request, error)
+	RetryRequestFunc   func(string, proto.RetryRequest) (proto.Request, error)
+	RequestFailureFunc func(string) (proto.RequestFailure, error)
+
+	StartRequestFunc        func(string) error
+	FinishRequestFunc       func(proto.FinishRequest) error
+	StopRequestFunc         func(string, time.Duration) error
+	StopJobFunc             func(string, string) error
+	SuspendRequestFunc      func(string, proto.SuspendedJobChain) error
+	SetRequestLogLevelFunc  func(string, proto.RequestLogLevel) (proto.RequestLogLevel, error)
+	FinalizeRequestFunc     func(string, proto.FinalizeRequest) (proto.Request, error)
+	GetResumePointsFunc     func(string) (proto.JobChain, error)
+	SetResumePointsFunc     func(string, proto.ResumePoints) (proto.JobChain, error)
+	GetJobChainFunc         func(string) (proto.JobChain, error)
+	GetJLFunc               func(string) ([]proto.JobLog, error)
+	GetJLWithFilterFunc     func(string, proto.JobLogFilter) ([]proto.JobLog, error)
+	GetJobTriesFunc         func(string, string) ([]proto.JobLog, error)
+	CreateJLFunc            func(string, proto.JobLog) error
+	CreateJLBatchFunc       func([]proto.JobLog) ([]proto.JobLogResult, error)
+	DeliverFunc             func([]proto.Delivery) ([]proto.DeliveryResult, error)
+	RunningFunc             func(proto.StatusFilter) (proto.RunningStatus, error)
+	RequestListFunc         func() ([]proto.RequestSpec, error)
+	RequestTypeMetadataFunc func(string) (proto.RequestTypeMetadata, error)
+	ListSLOsFunc            func() ([]proto.SLOStatus, error)
+	SLOStatusFunc           func(string) (proto.SLOStatus, error)
+	UpdateProgressFunc      func(proto.RequestProgress) error
+	PushStatusFunc          func(proto.JobRunnerStatus) error
+	JobTypeTriesFunc        func() (map[string]proto.JobTypeTries, error)
+	ServerVersionFunc       func() (proto.ServerVersion, error)
+	FeaturesFunc            func() ([]string, error)
+	SpecReportFunc          func() (proto.SpecReport, error)
+
+	CreateRequestGroupFunc func(proto.CreateRequestGroup) (proto.RequestGroup, error)
+	GetRequestGroupFunc    func(string) (proto.RequestGroup, error)
+	StopRequestGroupFunc   func(string, time.Duration) error
+	CreateRequestBulkFunc  func(proto.CreateRequestBulk) (proto.BulkCreateResult, error)
 }
 
 func (c *RMClient) CreateRequest(requestId string, args map[string]interface{}) (string, error) {
@@ -49,6 +78,69 @@ func (c *RMClient) FindRequests(filter proto.RequestFilter) ([]proto.Request, er
 	return []proto.Request{}, nil
 }
 
+func (c *RMClient) RequestHistory(reqType string, since time.Time, limit uint) (proto.RequestHistory, error) {
+	if c.RequestHistoryFunc != nil {
+		return c.RequestHistoryFunc(reqType, since, limit)
+	}
+	return proto.RequestHistory{}, nil
+}
+
+func (c *RMClient) ExportRequest(requestId string) (proto.RequestBundle, error) {
+	if c.ExportRequestFunc != nil {
+		return c.ExportRequestFunc(requestId)
+	}
+	return proto.RequestBundle{}, nil
+}
+
+func (c *RMClient) ImportRequest(b proto.RequestBundle) (proto.Request, error) {
+	if c.ImportRequestFunc != nil {
+		return c.ImportRequestFunc(b)
+	}
+	return b.Request, nil
+}
+
+func (c *RMClient) RetryRequest(requestId string, retry proto.RetryRequest) (proto.Request, error) {
+	if c.RetryRequestFunc != nil {
+		return c.RetryRequestFunc(requestId, retry)
+	}
+	return proto.Request{}, nil
+}
+
+func (c *RMClient) RequestFailure(requestId string) (proto.RequestFailure, error) {
+	if c.RequestFailureFunc != nil {
+		return c.RequestFailureFunc(requestId)
+	}
+	return proto.RequestFailure{RequestId: requestId}, nil
+}
+
+func (c *RMClient) CreateRequestGroup(cg proto.CreateRequestGroup) (proto.RequestGroup, error) {
+	if c.CreateRequestGroupFunc != nil {
+		return c.CreateRequestGroupFunc(cg)
+	}
+	return proto.RequestGroup{}, nil
+}
+
+func (c *RMClient) CreateRequestBulk(cb proto.CreateRequestBulk) (proto.BulkCreateResult, error) {
+	if c.CreateRequestBulkFunc != nil {
+		return c.CreateRequestBulkFunc(cb)
+	}
+	return proto.BulkCreateResult{}, nil
+}
+
+func (c *RMClient) GetRequestGroup(groupId string) (proto.RequestGroup, error) {
+	if c.GetRequestGroupFunc != nil {
+		return c.GetRequestGroupFunc(groupId)
+	}
+	return proto.RequestGroup{Id: groupId}, nil
+}
+
+func (c *RMClient) StopRequestGroup(groupId string, timeout time.Duration) error {
+	if c.StopRequestGroupFunc != nil {
+		return c.StopRequestGroupFunc(groupId, timeout)
+	}
+	return nil
+}
+
 func (c *RMClient) StartRequest(requestId string) error {
 	if c.StartRequestFunc != nil {
 		return c.StartRequestFunc(requestId)
@@ -63,9 +155,16 @@ func (c *RMClient) FinishRequest(fr proto.FinishRequest) error {
 	return nil
 }
 
-func (c *RMClient) StopRequest(requestId string) error {
+func (c *RMClient) StopJob(requestId, jobId string) error {
+	if c.StopJobFunc != nil {
+		return c.StopJobFunc(requestId, jobId)
+	}
+	return nil
+}
+
+func (c *RMClient) StopRequest(requestId string, timeout time.Duration) error {
 	if c.StopRequestFunc != nil {
-		return c.StopRequestFunc(requestId)
+		return c.StopRequestFunc(requestId, timeout)
 	}
 	return nil
 }
@@ -77,6 +176,34 @@ func (c *RMClient) SuspendRequest(requestId string, sjc proto.SuspendedJobChain)
 	return nil
 }
 
+func (c *RMClient) SetRequestLogLevel(requestId string, ll proto.RequestLogLevel) (proto.RequestLogLevel, error) {
+	if c.SetRequestLogLevelFunc != nil {
+		return c.SetRequestLogLevelFunc(requestId, ll)
+	}
+	return ll, nil
+}
+
+func (c *RMClient) FinalizeRequest(requestId string, f proto.FinalizeRequest) (proto.Request, error) {
+	if c.FinalizeRequestFunc != nil {
+		return c.FinalizeRequestFunc(requestId, f)
+	}
+	return proto.Request{}, nil
+}
+
+func (c *RMClient) GetResumePoints(requestId string) (proto.JobChain, error) {
+	if c.GetResumePointsFunc != nil {
+		return c.GetResumePointsFunc(requestId)
+	}
+	return proto.JobChain{}, nil
+}
+
+func (c *RMClient) SetResumePoints(requestId string, rp proto.ResumePoints) (proto.JobChain, error) {
+	if c.SetResumePointsFunc != nil {
+		return c.SetResumePointsFunc(requestId, rp)
+	}
+	return proto.JobChain{}, nil
+}
+
 func (c *RMClient) GetJobChain(requestId string) (proto.JobChain, error) {
 	if c.GetJobChainFunc != nil {
 		return c.GetJobChainFunc(requestId)
@@ -91,6 +218,20 @@ func (c *RMClient) GetJL(requestId string) ([]proto.JobLog, error) {
 	return []proto.JobLog{}, nil
 }
 
+func (c *RMClient) GetJLWithFilter(requestId string, f proto.JobLogFilter) ([]proto.JobLog, error) {
+	if c.GetJLWithFilterFunc != nil {
+		return c.GetJLWithFilterFunc(requestId, f)
+	}
+	return []proto.JobLog{}, nil
+}
+
+func (c *RMClient) GetJobTries(requestId, jobId string) ([]proto.JobLog, error) {
+	if c.GetJobTriesFunc != nil {
+		return c.GetJobTriesFunc(requestId, jobId)
+	}
+	return []proto.JobLog{}, nil
+}
+
 func (c *RMClient) CreateJL(requestId string, jl proto.JobLog) error {
 	if c.CreateJLFunc != nil {
 		return c.CreateJLFunc(requestId, jl)
@@ -98,6 +239,52 @@ func (c *RMClient) CreateJL(requestId string, jl proto.JobLog) error {
 	return nil
 }
 
+func (c *RMClient) CreateJLBatch(jls []proto.JobLog) ([]proto.JobLogResult, error) {
+	if c.CreateJLBatchFunc != nil {
+		return c.CreateJLBatchFunc(jls)
+	}
+	// Create each with CreateJL, like the Request Manager
+	results := make([]proto.JobLogResult, len(jls))
+	for i, jl := range jls {
+		if err := c.CreateJL(jl.RequestId, jl); err != nil {
+			perr, ok := err.(proto.Error)
+			if !ok {
+				perr = proto.Error{Message: err.Error(), RequestId: jl.RequestId, HTTPStatus: 500}
+			}
+			results[i] = proto.JobLogResult{Error: &perr}
+			continue
+		}
+		results[i] = proto.JobLogResult{Created: true}
+	}
+	return results, nil
+}
+
+func (c *RMClient) Deliver(deliveries []proto.Delivery) ([]proto.DeliveryResult, error) {
+	if c.DeliverFunc != nil {
+		return c.DeliverFunc(deliveries)
+	}
+	// Deliver with CreateJL and FinishRequest, like the Request Manager
+	results := []proto.DeliveryResult{}
+	for _, d := range deliveries {
+		var err error
+		if d.JobLog != nil {
+			err = c.CreateJL(d.RequestId, *d.JobLog)
+		} else {
+			err = c.FinishRequest(*d.Finish)
+		}
+		if err != nil {
+			perr, ok := err.(proto.Error)
+			if !ok {
+				return nil, err
+			}
+			results = append(results, proto.DeliveryResult{Error: &perr})
+			continue
+		}
+		results = append(results, proto.DeliveryResult{Delivered: true})
+	}
+	return results, nil
+}
+
 func (c *RMClient) RequestList() ([]proto.RequestSpec, error) {
 	if c.RequestListFunc != nil {
 		return c.RequestListFunc()
@@ -105,6 +292,27 @@ func (c *RMClient) RequestList() ([]proto.RequestSpec, error) {
 	return []proto.RequestSpec{}, nil
 }
 
+func (c *RMClient) RequestTypeMetadata(reqType string) (proto.RequestTypeMetadata, error) {
+	if c.RequestTypeMetadataFunc != nil {
+		return c.RequestTypeMetadataFunc(reqType)
+	}
+	return proto.RequestTypeMetadata{}, nil
+}
+
+func (c *RMClient) ListSLOs() ([]proto.SLOStatus, error) {
+	if c.ListSLOsFunc != nil {
+		return c.ListSLOsFunc()
+	}
+	return []proto.SLOStatus{}, nil
+}
+
+func (c *RMClient) SLOStatus(reqType string) (proto.SLOStatus, error) {
+	if c.SLOStatusFunc != nil {
+		return c.SLOStatusFunc(reqType)
+	}
+	return proto.SLOStatus{}, nil
+}
+
 func (c *RMClient) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
 	if c.RunningFunc != nil {
 		return c.RunningFunc(f)
@@ -118,3 +326,38 @@ func (c *RMClient) UpdateProgress(prg proto.RequestProgress) error {
 	}
 	return nil
 }
+
+func (c *RMClient) PushStatus(s proto.JobRunnerStatus) error {
+	if c.PushStatusFunc != nil {
+		return c.PushStatusFunc(s)
+	}
+	return nil
+}
+
+func (c *RMClient) JobTypeTries() (map[string]proto.JobTypeTries, error) {
+	if c.JobTypeTriesFunc != nil {
+		return c.JobTypeTriesFunc()
+	}
+	return map[string]proto.JobTypeTries{}, nil
+}
+
+func (c *RMClient) ServerVersion() (proto.ServerVersion, error) {
+	if c.ServerVersionFunc != nil {
+		return c.ServerVersionFunc()
+	}
+	return proto.ServerVersion{}, nil
+}
+
+func (c *RMClient) Features() ([]string, error) {
+	if c.FeaturesFunc != nil {
+		return c.FeaturesFunc()
+	}
+	return []string{}, nil
+}
+
+func (c *RMClient) SpecReport() (proto.SpecReport, error) {
+	if c.SpecReportFunc != nil {
+		return c.SpecReportFunc()
+	}
+	return proto.SpecReport{}, nil
+}
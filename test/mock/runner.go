@@ -17,14 +17,14 @@ var (
 type RunnerFactory struct {
 	RunnersToReturn map[string]*Runner // Keyed on job name.
 	MakeErr         error
-	MakeFunc        func(job proto.Job, requestId string, prevTries uint, totalTries uint) (runner.Runner, error)
+	MakeFunc        func(job proto.Job, cfg runner.Config) (runner.Runner, error)
 }
 
-func (f *RunnerFactory) Make(job proto.Job, requestId string, prevTries uint, totalTries uint) (runner.Runner, error) {
+func (f *RunnerFactory) Make(pJob proto.Job, cfg runner.Config) (runner.Runner, error) {
 	if f.MakeFunc != nil {
-		return f.MakeFunc(job, requestId, prevTries, totalTries)
+		return f.MakeFunc(pJob, cfg)
 	}
-	return f.RunnersToReturn[job.Id], f.MakeErr
+	return f.RunnersToReturn[pJob.Id], f.MakeErr
 }
 
 type Runner struct {
@@ -36,6 +36,8 @@ type Runner struct {
 	RunBlock     chan struct{}                             // Channel that runner.Run() will block on, if defined.
 	IgnoreStop   bool                                      // false: return immediately after Stop, true: keep running after Stop
 	StatusResp   runner.Status
+	StopTryErr   error // returned by StopTry
+	TryStopped   bool  // set true when StopTry is called
 
 	stopped bool // if Stop was called
 }
@@ -75,6 +77,11 @@ func (r *Runner) Stop() error {
 	return nil
 }
 
+func (r *Runner) StopTry() error {
+	r.TryStopped = true
+	return r.StopTryErr
+}
+
 func (r *Runner) Status() runner.Status {
 	if r.RunBlock != nil {
 		close(r.RunBlock)
@@ -0,0 +1,37 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"sort"
+)
+
+// Scratch is a simple job.Scratch. It's not safe for concurrent use.
+type Scratch struct {
+	KV map[string][]byte
+}
+
+func (s *Scratch) Get(key string) ([]byte, bool) {
+	v, ok := s.KV[key]
+	return v, ok
+}
+
+func (s *Scratch) Set(key string, value []byte) {
+	if s.KV == nil {
+		s.KV = map[string][]byte{}
+	}
+	s.KV[key] = value
+}
+
+func (s *Scratch) Delete(key string) {
+	delete(s.KV, key)
+}
+
+func (s *Scratch) Keys() []string {
+	keys := make([]string, 0, len(s.KV))
+	for k := range s.KV {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,33 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"github.com/square/spincycle/v2/proto"
+)
+
+type SLOManager struct {
+	StatusFunc func(reqType string) (proto.SLOStatus, error)
+	ListFunc   func() ([]proto.SLOStatus, error)
+	CheckFunc  func()
+}
+
+func (m *SLOManager) Status(reqType string) (proto.SLOStatus, error) {
+	if m.StatusFunc != nil {
+		return m.StatusFunc(reqType)
+	}
+	return proto.SLOStatus{}, nil
+}
+
+func (m *SLOManager) List() ([]proto.SLOStatus, error) {
+	if m.ListFunc != nil {
+		return m.ListFunc()
+	}
+	return []proto.SLOStatus{}, nil
+}
+
+func (m *SLOManager) Check() {
+	if m.CheckFunc != nil {
+		m.CheckFunc()
+	}
+}
@@ -22,6 +22,9 @@ func (s *JRStatus) Running(f proto.StatusFilter) ([]proto.JobStatus, error) {
 type RMStatus struct {
 	RunningFunc        func(proto.StatusFilter) (proto.RunningStatus, error)
 	UpdateProgressFunc func(proto.RequestProgress) error
+	PushFunc           func(proto.JobRunnerStatus) error
+	JobRunnersFunc     func() []proto.JobRunnerStatus
+	JobTypeTriesFunc   func() map[string]proto.JobTypeTries
 }
 
 func (s *RMStatus) Running(f proto.StatusFilter) (proto.RunningStatus, error) {
@@ -37,3 +40,24 @@ func (s *RMStatus) UpdateProgress(prg proto.RequestProgress) error {
 	}
 	return nil
 }
+
+func (s *RMStatus) Push(jrs proto.JobRunnerStatus) error {
+	if s.PushFunc != nil {
+		return s.PushFunc(jrs)
+	}
+	return nil
+}
+
+func (s *RMStatus) JobRunners() []proto.JobRunnerStatus {
+	if s.JobRunnersFunc != nil {
+		return s.JobRunnersFunc()
+	}
+	return nil
+}
+
+func (s *RMStatus) JobTypeTries() map[string]proto.JobTypeTries {
+	if s.JobTypeTriesFunc != nil {
+		return s.JobTypeTriesFunc()
+	}
+	return map[string]proto.JobTypeTries{}
+}
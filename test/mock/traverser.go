@@ -4,6 +4,7 @@ package mock
 
 import (
 	"errors"
+	"time"
 
 	"github.com/square/spincycle/v2/job-runner/chain"
 	"github.com/square/spincycle/v2/proto"
@@ -14,20 +15,29 @@ var (
 )
 
 type Traverser struct {
-	RunErr    error
-	StopErr   error
-	StatusErr error
-	JobStatus []proto.JobStatus
+	RunErr      error
+	StopErr     error
+	StopTimeout time.Duration // last Stop timeout
+	StatusErr   error
+	JobStatus   []proto.JobStatus
+	StopJobErr  error
+	StoppedJob  string // last StopJob job ID
 }
 
 func (t *Traverser) Run() {
 	return
 }
 
-func (t *Traverser) Stop() error {
+func (t *Traverser) Stop(timeout time.Duration) error {
+	t.StopTimeout = timeout
 	return t.StopErr
 }
 
+func (t *Traverser) StopJob(jobId string) error {
+	t.StoppedJob = jobId
+	return t.StopJobErr
+}
+
 func (t *Traverser) Running() []proto.JobStatus {
 	if t.JobStatus != nil {
 		return t.JobStatus
@@ -0,0 +1,42 @@
+// Copyright 2020, Square, Inc.
+
+package mock
+
+import (
+	"github.com/square/spincycle/v2/proto"
+)
+
+type UpgradeManager struct {
+	CreateFunc   func(proto.CreateJobRunnerUpgrade) (proto.JobRunnerUpgrade, error)
+	GetFunc      func(upgradeId string) (proto.JobRunnerUpgrade, error)
+	AdvanceFunc  func(upgradeId string) (proto.JobRunnerUpgrade, error)
+	ReplacedFunc func(upgradeId string, r proto.JobRunnerReplaced) error
+}
+
+func (u *UpgradeManager) Create(cu proto.CreateJobRunnerUpgrade) (proto.JobRunnerUpgrade, error) {
+	if u.CreateFunc != nil {
+		return u.CreateFunc(cu)
+	}
+	return proto.JobRunnerUpgrade{}, nil
+}
+
+func (u *UpgradeManager) Get(upgradeId string) (proto.JobRunnerUpgrade, error) {
+	if u.GetFunc != nil {
+		return u.GetFunc(upgradeId)
+	}
+	return proto.JobRunnerUpgrade{}, nil
+}
+
+func (u *UpgradeManager) Advance(upgradeId string) (proto.JobRunnerUpgrade, error) {
+	if u.AdvanceFunc != nil {
+		return u.AdvanceFunc(upgradeId)
+	}
+	return proto.JobRunnerUpgrade{}, nil
+}
+
+func (u *UpgradeManager) Replaced(upgradeId string, r proto.JobRunnerReplaced) error {
+	if u.ReplacedFunc != nil {
+		return u.ReplacedFunc(upgradeId, r)
+	}
+	return nil
+}
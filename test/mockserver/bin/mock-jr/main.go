@@ -0,0 +1,19 @@
+// Copyright 2020, Square, Inc.
+
+// Command mock-jr runs a mock Job Runner API that returns canned responses.
+// See package mockserver.
+//
+//	mock-jr [-addr 127.0.0.1:32307] [-routes routes.yaml]
+package main
+
+import (
+	"log"
+
+	"github.com/square/spincycle/v2/config"
+	"github.com/square/spincycle/v2/test/mockserver"
+)
+
+func main() {
+	err := mockserver.Run("Job Runner", config.DEFAULT_ADDR_JOB_RUNNER, mockserver.JobRunnerRoutes())
+	log.Fatal(err)
+}
@@ -0,0 +1,19 @@
+// Copyright 2020, Square, Inc.
+
+// Command mock-rm runs a mock Request Manager API that returns canned responses.
+// See package mockserver.
+//
+//	mock-rm [-addr 127.0.0.1:32308] [-routes routes.yaml]
+package main
+
+import (
+	"log"
+
+	"github.com/square/spincycle/v2/config"
+	"github.com/square/spincycle/v2/test/mockserver"
+)
+
+func main() {
+	err := mockserver.Run("Request Manager", config.DEFAULT_ADDR_REQUEST_MANAGER, mockserver.RequestManagerRoutes())
+	log.Fatal(err)
+}
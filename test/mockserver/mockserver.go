@@ -0,0 +1,340 @@
+// Copyright 2020, Square, Inc.
+
+// Package mockserver provides mock Request Manager and Job Runner API servers
+// that return canned responses, for testing clients and jobs without a full
+// deployment. Responses are scriptable (see Route) and errors can be injected:
+// HTTP errors, delays, and closed connections. Binaries are in bin/.
+//
+// A Server has a control API under /_mock/:
+//
+//	GET    /_mock/routes  list routes -> []Route
+//	PUT    /_mock/routes  add or replace routes ([]Route)
+//	GET    /_mock/calls   list API calls received -> []Call
+//	DELETE /_mock/calls   clear API calls received and reset response sequences
+package mockserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/square/spincycle/v2/proto"
+)
+
+const CONTROL_ROOT = "/_mock/"
+
+// A Response is a canned API response.
+type Response struct {
+	Status  int               `yaml:"status" json:"status,omitempty"`   // HTTP status code (default 200)
+	Headers map[string]string `yaml:"headers" json:"headers,omitempty"` // response headers
+	Body    interface{}       `yaml:"body" json:"body,omitempty"`       // encoded as JSON, unless string
+	Delay   string            `yaml:"delay" json:"delay,omitempty"`     // wait before responding, like "2s"
+	Close   bool              `yaml:"close" json:"close,omitempty"`     // close connection without responding
+}
+
+// A Route is a mock API endpoint. Path segments that begin with ":" match any
+// value, like "/api/v1/requests/:reqId". In response headers and body strings,
+// "{reqId}" is replaced with the matched value.
+//
+// Responses are returned in order for each call, and the last one is repeated.
+// For error injection, ErrorRate is the fraction of calls, from 0 to 1, that
+// return Error instead.
+type Route struct {
+	Method    string     `yaml:"method" json:"method"`
+	Path      string     `yaml:"path" json:"path"`
+	Responses []Response `yaml:"responses" json:"responses"`
+	ErrorRate float64    `yaml:"error_rate" json:"errorRate,omitempty"`
+	Error     Response   `yaml:"error" json:"error,omitempty"`
+}
+
+// A Call is an API call received by a Server.
+type Call struct {
+	Time   time.Time `json:"time"`
+	Method string    `json:"method"`
+	Path   string    `json:"path"`
+	Query  string    `json:"query,omitempty"`
+	Body   string    `json:"body,omitempty"`
+	Status int       `json:"status"` // 0 if connection closed
+}
+
+// route is a Route and its number of calls, for Route.Responses order.
+type route struct {
+	Route
+	calls int
+}
+
+// Server is a mock API server. It implements http.Handler.
+type Server struct {
+	mux    *sync.Mutex
+	routes []*route
+	calls  []Call
+	rand   *rand.Rand
+}
+
+// NewServer returns a Server with the given routes.
+func NewServer(routes []Route) *Server {
+	s := &Server{
+		mux:    &sync.Mutex{},
+		routes: []*route{},
+		calls:  []Call{},
+		rand:   rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	s.SetRoutes(routes)
+	return s
+}
+
+// SetRoutes adds routes, or replaces routes with the same method and path.
+func (s *Server) SetRoutes(routes []Route) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+NEXT_ROUTE:
+	for _, r := range routes {
+		r.Method = strings.ToUpper(r.Method)
+		for i := range s.routes {
+			if s.routes[i].Method == r.Method && s.routes[i].Path == r.Path {
+				s.routes[i] = &route{Route: r}
+				continue NEXT_ROUTE
+			}
+		}
+		s.routes = append(s.routes, &route{Route: r})
+	}
+}
+
+// Routes returns all routes.
+func (s *Server) Routes() []Route {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	routes := make([]Route, len(s.routes))
+	for i := range s.routes {
+		routes[i] = s.routes[i].Route
+	}
+	return routes
+}
+
+// Calls returns all API calls received, in order.
+func (s *Server) Calls() []Call {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	calls := make([]Call, len(s.calls))
+	copy(calls, s.calls)
+	return calls
+}
+
+// Reset clears API calls received and resets Route.Responses to the first response.
+func (s *Server) Reset() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	s.calls = []Call{}
+	for _, r := range s.routes {
+		r.calls = 0
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if strings.HasPrefix(req.URL.Path, CONTROL_ROOT) {
+		s.control(w, req)
+		return
+	}
+
+	body, _ := ioutil.ReadAll(req.Body)
+	call := Call{
+		Time:   time.Now().UTC(),
+		Method: req.Method,
+		Path:   req.URL.Path,
+		Query:  req.URL.RawQuery,
+		Body:   string(body),
+	}
+
+	resp, params := s.response(req.Method, req.URL.Path)
+	if resp.Delay != "" {
+		if d, err := time.ParseDuration(resp.Delay); err == nil {
+			time.Sleep(d)
+		}
+	}
+	if resp.Close {
+		s.record(call)
+		if hj, ok := w.(http.Hijacker); ok {
+			if conn, _, err := hj.Hijack(); err == nil {
+				conn.Close()
+				return
+			}
+		}
+		panic(http.ErrAbortHandler) // closes the connection
+	}
+
+	call.Status = resp.Status
+	if call.Status == 0 {
+		call.Status = http.StatusOK
+	}
+	s.record(call)
+	for k, v := range resp.Headers {
+		w.Header().Set(k, expand(v, params))
+	}
+	var out []byte
+	switch v := resp.Body.(type) {
+	case nil:
+	case string:
+		out = []byte(expand(v, params))
+	default:
+		out, _ = json.Marshal(v)
+		out = []byte(expand(string(out), params))
+		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	}
+	w.WriteHeader(call.Status)
+	w.Write(out)
+}
+
+// LoadRoutes loads routes from a YAML file, like:
+//
+//   - method: GET
+//     path: /api/v1/requests/:reqId
+//     responses:
+//   - status: 503
+//   - body: {id: "{reqId}", type: test, state: 2}
+//     error_rate: 0.1
+//     error: {status: 500, delay: 3s}
+func LoadRoutes(file string) ([]Route, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var routes []Route
+	if err := yaml.UnmarshalStrict(bytes, &routes); err != nil {
+		return nil, fmt.Errorf("cannot decode YAML in %s: %s", file, err)
+	}
+	for i := range routes {
+		if routes[i].Method == "" || routes[i].Path == "" {
+			return nil, fmt.Errorf("route %d in %s: method and path are required", i+1, file)
+		}
+		for j := range routes[i].Responses {
+			routes[i].Responses[j].Body = jsonable(routes[i].Responses[j].Body)
+		}
+		routes[i].Error.Body = jsonable(routes[i].Error.Body)
+	}
+	return routes, nil
+}
+
+// --------------------------------------------------------------------------
+
+// response returns the response for the API call, and the values of matched
+// path params.
+func (s *Server) response(method, path string) (Response, map[string]string) {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	for _, r := range s.routes {
+		if r.Method != method {
+			continue
+		}
+		params, ok := match(r.Path, path)
+		if !ok {
+			continue
+		}
+		if r.ErrorRate > 0 && s.rand.Float64() < r.ErrorRate {
+			return r.Error, params
+		}
+		if len(r.Responses) == 0 {
+			return Response{}, params
+		}
+		n := r.calls
+		if n >= len(r.Responses) {
+			n = len(r.Responses) - 1
+		}
+		r.calls++
+		return r.Responses[n], params
+	}
+	return Response{
+		Status: http.StatusNotFound,
+		Body: proto.Error{
+			Message:    fmt.Sprintf("mock server: no route for %s %s", method, path),
+			HTTPStatus: http.StatusNotFound,
+		},
+	}, nil
+}
+
+func (s *Server) record(call Call) {
+	s.mux.Lock()
+	s.calls = append(s.calls, call)
+	s.mux.Unlock()
+}
+
+func (s *Server) control(w http.ResponseWriter, req *http.Request) {
+	var v interface{}
+	switch req.Method + " " + strings.TrimPrefix(req.URL.Path, CONTROL_ROOT) {
+	case "GET routes":
+		v = s.Routes()
+	case "PUT routes":
+		var routes []Route
+		if err := json.NewDecoder(req.Body).Decode(&routes); err != nil {
+			http.Error(w, fmt.Sprintf("cannot decode []Route: %s", err), http.StatusBadRequest)
+			return
+		}
+		s.SetRoutes(routes)
+	case "GET calls":
+		v = s.Calls()
+	case "DELETE calls":
+		s.Reset()
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if v == nil {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// match returns the values of path params if path matches the route pattern.
+func match(pattern, path string) (map[string]string, bool) {
+	p := strings.Split(strings.Trim(pattern, "/"), "/")
+	v := strings.Split(strings.Trim(path, "/"), "/")
+	if len(p) != len(v) {
+		return nil, false
+	}
+	params := map[string]string{}
+	for i := range p {
+		if strings.HasPrefix(p[i], ":") {
+			params[p[i][1:]] = v[i]
+			continue
+		}
+		if p[i] != v[i] {
+			return nil, false
+		}
+	}
+	return params, true
+}
+
+// expand replaces "{name}" with the value of path param name.
+func expand(s string, params map[string]string) string {
+	for k, v := range params {
+		s = strings.Replace(s, "{"+k+"}", v, -1)
+	}
+	return s
+}
+
+// jsonable converts maps decoded from YAML, which have interface{} keys, to maps
+// with string keys so they can be encoded as JSON.
+func jsonable(v interface{}) interface{} {
+	switch t := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for k, v := range t {
+			m[fmt.Sprintf("%v", k)] = jsonable(v)
+		}
+		return m
+	case []interface{}:
+		for i := range t {
+			t[i] = jsonable(t[i])
+		}
+		return t
+	}
+	return v
+}
@@ -0,0 +1,219 @@
+// Copyright 2020, Square, Inc.
+
+package mockserver_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/go-test/deep"
+
+	jr "github.com/square/spincycle/v2/job-runner"
+	"github.com/square/spincycle/v2/proto"
+	rm "github.com/square/spincycle/v2/request-manager"
+	"github.com/square/spincycle/v2/test/mockserver"
+)
+
+func TestRequestManagerRoutes(t *testing.T) {
+	// The real RM client works with the mock RM
+	s := mockserver.NewServer(mockserver.RequestManagerRoutes())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	rmc := rm.NewClient(&http.Client{}, ts.URL)
+
+	reqId, err := rmc.CreateRequest("mock", map[string]interface{}{"arg1": "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reqId != mockserver.MOCK_REQUEST_ID {
+		t.Errorf("got request id %s, expected %s", reqId, mockserver.MOCK_REQUEST_ID)
+	}
+	req, err := rmc.GetRequest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Id != "abc" {
+		t.Errorf("got request id %s, expected abc (path param)", req.Id)
+	}
+	if err := rmc.StartRequest("abc"); err != nil {
+		t.Error(err)
+	}
+	if err := rmc.CreateJL("abc", proto.JobLog{RequestId: "abc", JobId: "job1"}); err != nil {
+		t.Error(err)
+	}
+	running, err := rmc.Running(proto.StatusFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(running.Jobs) != 1 {
+		t.Errorf("got %d running jobs, expected 1", len(running.Jobs))
+	}
+
+	calls := s.Calls()
+	if len(calls) != 5 {
+		t.Fatalf("got %d calls, expected 5: %+v", len(calls), calls)
+	}
+	if calls[0].Method != "POST" || calls[0].Path != "/api/v1/requests" || calls[0].Status != http.StatusCreated {
+		t.Errorf("first call %+v, expected POST /api/v1/requests 201", calls[0])
+	}
+	if !bytes.Contains([]byte(calls[0].Body), []byte(`"arg1":"a"`)) {
+		t.Errorf("create request body %s does not have args", calls[0].Body)
+	}
+}
+
+func TestJobRunnerRoutes(t *testing.T) {
+	// The real JR client works with the mock JR
+	s := mockserver.NewServer(mockserver.JobRunnerRoutes())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	jrc := jr.NewClient(&http.Client{})
+
+	url, err := jrc.NewJobChain(ts.URL, proto.JobChain{RequestId: "abc"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url == nil || url.Path != "/api/v1/job-chains/"+mockserver.MOCK_REQUEST_ID {
+		t.Errorf("got chain URL %v, expected path /api/v1/job-chains/%s", url, mockserver.MOCK_REQUEST_ID)
+	}
+	if err := jrc.StopRequest(ts.URL, "abc", 0); err != nil {
+		t.Error(err)
+	}
+	if err := jrc.Ping(ts.URL); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestErrorInjection(t *testing.T) {
+	// Scripted responses: 503 then OK (repeated). Connection closed on error.
+	s := mockserver.NewServer(mockserver.RequestManagerRoutes())
+	s.SetRoutes([]mockserver.Route{
+		{
+			Method: "get",
+			Path:   "/api/v1/requests/:reqId",
+			Responses: []mockserver.Response{
+				{Status: http.StatusServiceUnavailable, Body: proto.Error{Message: "down"}},
+				{Body: proto.Request{Id: "{reqId}", Type: "scripted"}},
+			},
+		},
+		{
+			Method:    "PUT",
+			Path:      "/api/v1/requests/:reqId/start",
+			ErrorRate: 1,
+			Error:     mockserver.Response{Close: true},
+		},
+	})
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	rmc := rm.NewClient(&http.Client{}, ts.URL)
+
+	if _, err := rmc.GetRequest("abc"); err == nil {
+		t.Error("no error on first call, expected 503 error")
+	}
+	for i := 0; i < 2; i++ {
+		req, err := rmc.GetRequest("abc")
+		if err != nil {
+			t.Fatal(err)
+		}
+		expect := proto.Request{Id: "abc", Type: "scripted"}
+		if diff := deep.Equal(req, expect); diff != nil {
+			t.Error(diff)
+		}
+	}
+	if err := rmc.StartRequest("abc"); err == nil {
+		t.Error("no error starting request, expected closed connection error")
+	}
+
+	// Unknown route is 404
+	if err := rmc.SuspendRequest("abc", proto.SuspendedJobChain{}); err != nil {
+		t.Errorf("suspend: %s", err)
+	}
+	resp, err := http.Get(ts.URL + "/api/v1/nope")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("got status %d for unknown route, expected 404", resp.StatusCode)
+	}
+
+	// Reset starts response sequences over
+	s.Reset()
+	if len(s.Calls()) != 0 {
+		t.Errorf("%d calls after Reset, expected 0", len(s.Calls()))
+	}
+	if _, err := rmc.GetRequest("abc"); err == nil {
+		t.Error("no error on first call after Reset, expected 503 error")
+	}
+}
+
+func TestControlAPI(t *testing.T) {
+	s := mockserver.NewServer(mockserver.JobRunnerRoutes())
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+
+	routes := []mockserver.Route{{Method: "PUT", Path: "/api/v1/drain", Responses: []mockserver.Response{{Status: 500}}}}
+	body, _ := json.Marshal(routes)
+	req, _ := http.NewRequest("PUT", ts.URL+mockserver.CONTROL_ROOT+"routes", bytes.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("PUT routes status %d, expected 200", resp.StatusCode)
+	}
+
+	jrc := jr.NewClient(&http.Client{})
+	if err := jrc.Drain(ts.URL); err == nil {
+		t.Error("no error draining, expected 500 error")
+	}
+
+	resp, err = http.Get(ts.URL + mockserver.CONTROL_ROOT + "calls")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var calls []mockserver.Call
+	if err := json.NewDecoder(resp.Body).Decode(&calls); err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 1 || calls[0].Path != "/api/v1/drain" || calls[0].Status != 500 {
+		t.Errorf("got calls %+v, expected 1 call to /api/v1/drain with status 500", calls)
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	f, err := ioutil.TempFile("", "mockserver-routes")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`
+- method: GET
+  path: /api/v1/requests/:reqId
+  responses:
+    - body: {id: "{reqId}", type: yaml, state: 3}
+`)
+	f.Close()
+
+	routes, err := mockserver.LoadRoutes(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := mockserver.NewServer(routes)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	req, err := rm.NewClient(&http.Client{}, ts.URL).GetRequest("abc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := proto.Request{Id: "abc", Type: "yaml", State: proto.STATE_COMPLETE}
+	if diff := deep.Equal(req, expect); diff != nil {
+		t.Error(diff)
+	}
+}
@@ -0,0 +1,167 @@
+// Copyright 2020, Square, Inc.
+
+package mockserver
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/square/spincycle/v2/config"
+	"github.com/square/spincycle/v2/proto"
+)
+
+// MOCK_REQUEST_ID is the request ID in canned responses that create a request.
+const MOCK_REQUEST_ID = "b9uvdi8tk9kahl8ppvbg"
+
+var mockTime = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// RequestManagerRoutes returns canned responses for the Request Manager API:
+// every request exists, is running one job, and has one job log entry.
+func RequestManagerRoutes() []Route {
+	req := proto.Request{
+		Id:           "{reqId}",
+		Type:         "mock",
+		State:        proto.STATE_RUNNING,
+		User:         "mock",
+		CreatedAt:    mockTime,
+		StartedAt:    &mockTime,
+		TotalJobs:    1,
+		JobRunnerURL: "http://" + config.DEFAULT_ADDR_JOB_RUNNER,
+	}
+	newReq := req
+	newReq.Id = MOCK_REQUEST_ID
+	newReq.State = proto.STATE_PENDING
+	newReq.StartedAt = nil
+	newReq.JobRunnerURL = ""
+	job := proto.Job{
+		Id:         "job1",
+		Name:       "mock-job",
+		Type:       "mock/job",
+		State:      proto.STATE_RUNNING,
+		SequenceId: "job1",
+	}
+	jl := proto.JobLog{
+		RequestId:  "{reqId}",
+		JobId:      job.Id,
+		Name:       job.Name,
+		Type:       job.Type,
+		Try:        1,
+		StartedAt:  mockTime.UnixNano(),
+		FinishedAt: mockTime.Add(time.Second).UnixNano(),
+		State:      proto.STATE_COMPLETE,
+	}
+	jobStatus := proto.JobStatus{
+		RequestId: "{reqId}",
+		JobId:     job.Id,
+		Type:      job.Type,
+		Name:      job.Name,
+		StartedAt: mockTime.UnixNano(),
+		State:     proto.STATE_RUNNING,
+		Status:    "mock status",
+		Try:       1,
+	}
+	running := jobStatus
+	running.RequestId = MOCK_REQUEST_ID
+	runningReq := req
+	runningReq.Id = MOCK_REQUEST_ID
+
+	return []Route{
+		{Method: "POST", Path: "/api/v1/requests", Responses: []Response{{Status: http.StatusCreated, Body: newReq}}},
+		{Method: "GET", Path: "/api/v1/requests", Responses: []Response{{Body: []proto.Request{runningReq}}}},
+		{Method: "GET", Path: "/api/v1/requests/:reqId", Responses: []Response{{Body: req}}},
+		{Method: "PUT", Path: "/api/v1/requests/:reqId/start"},
+		{Method: "PUT", Path: "/api/v1/requests/:reqId/finish"},
+		{Method: "PUT", Path: "/api/v1/requests/:reqId/stop"},
+		{Method: "PUT", Path: "/api/v1/requests/:reqId/suspend"},
+		{Method: "PUT", Path: "/api/v1/requests/:reqId/progress"},
+		{Method: "GET", Path: "/api/v1/requests/:reqId/job-chain", Responses: []Response{{
+			Body: proto.JobChain{
+				RequestId:     "{reqId}",
+				RequestType:   "mock",
+				Jobs:          map[string]proto.Job{job.Id: job},
+				AdjacencyList: map[string][]string{},
+				State:         proto.STATE_RUNNING,
+			},
+		}}},
+		{Method: "GET", Path: "/api/v1/requests/:reqId/export", Responses: []Response{{
+			Body: proto.RequestBundle{
+				Request:       req,
+				CreateRequest: proto.CreateRequest{Type: "mock", User: "mock"},
+				JobLogs:       []proto.JobLog{jl},
+				ExportedAt:    mockTime,
+				Version:       "mock",
+			},
+		}}},
+		{Method: "POST", Path: "/api/v1/requests/import", Responses: []Response{{Status: http.StatusCreated, Body: req}}},
+		{Method: "POST", Path: "/api/v1/requests/:reqId/log", Responses: []Response{{Status: http.StatusCreated, Body: jl}}},
+		{Method: "GET", Path: "/api/v1/requests/:reqId/log", Responses: []Response{{Body: []proto.JobLog{jl}}}},
+		{Method: "GET", Path: "/api/v1/requests/:reqId/log/:jobId", Responses: []Response{{Body: jl}}},
+		{Method: "GET", Path: "/api/v1/request-history", Responses: []Response{{
+			Body: proto.RequestHistory{
+				Type:     "mock",
+				Requests: []proto.Request{runningReq},
+				Total:    1,
+				States:   map[string]uint{"RUNNING": 1},
+			},
+		}}},
+		{Method: "GET", Path: "/api/v1/request-list", Responses: []Response{{
+			Body: []proto.RequestSpec{{Name: "mock", Args: []proto.RequestArg{{Name: "arg1", Type: proto.ARG_TYPE_REQUIRED}}}},
+		}}},
+		{Method: "GET", Path: "/api/v1/status/running", Responses: []Response{{
+			Body: proto.RunningStatus{
+				Jobs:     []proto.JobStatus{running},
+				Requests: map[string]proto.Request{MOCK_REQUEST_ID: runningReq},
+			},
+		}}},
+		{Method: "PUT", Path: "/api/v1/status/job-runner"},
+		{Method: "GET", Path: "/version", Responses: []Response{{Body: "mock"}}},
+	}
+}
+
+// JobRunnerRoutes returns canned responses for the Job Runner API: every job chain
+// is accepted and one job is running.
+func JobRunnerRoutes() []Route {
+	location := map[string]string{"Location": "/api/v1/job-chains/" + MOCK_REQUEST_ID}
+	return []Route{
+		{Method: "POST", Path: "/api/v1/job-chains", Responses: []Response{{Headers: location}}},
+		{Method: "POST", Path: "/api/v1/job-chains/resume", Responses: []Response{{Headers: location}}},
+		{Method: "PUT", Path: "/api/v1/job-chains/:requestId/stop"},
+		{Method: "GET", Path: "/api/v1/status/running", Responses: []Response{{
+			Body: []proto.JobStatus{{
+				RequestId: MOCK_REQUEST_ID,
+				JobId:     "job1",
+				Type:      "mock/job",
+				Name:      "mock-job",
+				StartedAt: mockTime.UnixNano(),
+				State:     proto.STATE_RUNNING,
+				Status:    "mock status",
+				Try:       1,
+			}},
+		}}},
+		{Method: "PUT", Path: "/api/v1/drain"},
+		{Method: "GET", Path: "/version", Responses: []Response{{Body: "mock"}}},
+	}
+}
+
+// Run runs a mock server with the given routes on the -addr flag address until
+// it fails. If the -routes flag is set, routes in the YAML file (see LoadRoutes)
+// are added or replace the given routes. It's the main func of the binaries in bin/.
+func Run(name, defaultAddr string, routes []Route) error {
+	addr := flag.String("addr", defaultAddr, "address:port to listen on")
+	routesFile := flag.String("routes", "", "YAML file of routes to add or replace")
+	flag.Parse()
+
+	s := NewServer(routes)
+	if *routesFile != "" {
+		more, err := LoadRoutes(*routesFile)
+		if err != nil {
+			return err
+		}
+		s.SetRoutes(more)
+		log.Printf("Loaded %d routes from %s", len(more), *routesFile)
+	}
+	log.Printf("Mock %s listening on %s", name, *addr)
+	return http.ListenAndServe(*addr, s)
+}